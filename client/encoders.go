@@ -16,9 +16,12 @@
 package client
 
 import (
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"hash"
 
@@ -62,6 +65,21 @@ func (p *ProtobufEncoder) EncodeMessageStream(msg *message.Message,
 func CreateHekaStream(msgBytes []byte, outBytes *[]byte,
 	msc *message.MessageSigningConfig) error {
 
+	return createHekaStream(msgBytes, outBytes, msc, false)
+}
+
+// CreateHekaStreamV2 frames the message with version 2 of the stream
+// framing, which adds a checksum and a magic sequence that let readers
+// detect corrupted records and resynchronize after them.
+func CreateHekaStreamV2(msgBytes []byte, outBytes *[]byte,
+	msc *message.MessageSigningConfig) error {
+
+	return createHekaStream(msgBytes, outBytes, msc, true)
+}
+
+func createHekaStream(msgBytes []byte, outBytes *[]byte,
+	msc *message.MessageSigningConfig, v2 bool) error {
+
 	msgSize := uint32(len(msgBytes))
 	if msgSize > message.MAX_MESSAGE_SIZE {
 		return fmt.Errorf("Message too big, requires %d (MAX_MESSAGE_SIZE = %d)",
@@ -78,12 +96,24 @@ func CreateHekaStream(msgBytes []byte, outBytes *[]byte,
 		case "sha1":
 			hm = hmac.New(sha1.New, []byte(msc.Key))
 			h.SetHmacHashFunction(message.Header_SHA1)
+		case "sha256":
+			hm = hmac.New(sha256.New, []byte(msc.Key))
+			h.SetHmacHashFunction(message.Header_SHA256)
+		case "ed25519":
+			key, err := message.DecodeEd25519PrivateKey(msc.Ed25519Key)
+			if err != nil {
+				return err
+			}
+			h.SetHmacHashFunction(message.Header_ED25519)
+			h.SetHmac(ed25519.Sign(key, msgBytes))
 		default:
 			hm = hmac.New(md5.New, []byte(msc.Key))
 		}
 
-		hm.Write(msgBytes)
-		h.SetHmac(hm.Sum(nil))
+		if hm != nil {
+			hm.Write(msgBytes)
+			h.SetHmac(hm.Sum(nil))
+		}
 	}
 	headerSize := proto.Size(h)
 	if headerSize > message.MAX_HEADER_SIZE {
@@ -92,21 +122,37 @@ func CreateHekaStream(msgBytes []byte, outBytes *[]byte,
 	}
 
 	requiredSize := message.HEADER_FRAMING_SIZE + headerSize + len(msgBytes)
+	headerStart := message.HEADER_DELIMITER_SIZE
+	if v2 {
+		requiredSize = message.FRAME_V2_FRAMING_SIZE + headerSize + len(msgBytes)
+		headerStart = message.FRAME_V2_MAGIC_SIZE + 1
+	}
 	if cap(*outBytes) < requiredSize {
 		*outBytes = make([]byte, requiredSize)
 	} else {
 		*outBytes = (*outBytes)[:requiredSize]
 	}
-	(*outBytes)[0] = message.RECORD_SEPARATOR
-	(*outBytes)[1] = uint8(headerSize)
+	if v2 {
+		copy(*outBytes, message.FRAME_V2_MAGIC)
+	} else {
+		(*outBytes)[0] = message.RECORD_SEPARATOR
+	}
+	(*outBytes)[headerStart-1] = uint8(headerSize)
 	// This looks odd but is correct; it effectively "seeks" the initial write
 	// position for the protobuf output to be at the
-	// `(*outBytes)[message.HEADER_DELIMITER_SIZE]` position.
-	pbuf := proto.NewBuffer((*outBytes)[message.HEADER_DELIMITER_SIZE:message.HEADER_DELIMITER_SIZE])
+	// `(*outBytes)[headerStart]` position.
+	pbuf := proto.NewBuffer((*outBytes)[headerStart:headerStart])
 	if err := pbuf.Marshal(h); err != nil {
 		return err
 	}
-	(*outBytes)[headerSize+message.HEADER_DELIMITER_SIZE] = message.UNIT_SEPARATOR
-	copy((*outBytes)[message.HEADER_FRAMING_SIZE+headerSize:], msgBytes)
+	headerEnd := headerStart + headerSize + 1
+	(*outBytes)[headerEnd-1] = message.UNIT_SEPARATOR
+	msgStart := headerEnd
+	if v2 {
+		checksum := message.FrameV2Checksum((*outBytes)[headerStart:headerEnd], msgBytes)
+		binary.BigEndian.PutUint32((*outBytes)[msgStart:], checksum)
+		msgStart += message.FRAME_V2_CHECKSUM_SIZE
+	}
+	copy((*outBytes)[msgStart:], msgBytes)
 	return nil
 }
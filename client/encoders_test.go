@@ -16,6 +16,8 @@ package client
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
 	"heka/message"
 	"strings"
 	"testing"
@@ -54,6 +56,58 @@ func TestEncodeMessageStreamSigned(t *testing.T) {
 	}
 }
 
+func TestEncodeMessageStreamSignedEd25519(t *testing.T) {
+	var out []byte
+	seed := bytes.Repeat([]byte{0x42}, ed25519.SeedSize)
+	sk := &message.MessageSigningConfig{
+		Name:       "test",
+		Hash:       "ed25519",
+		Ed25519Key: base64.StdEncoding.EncodeToString(seed),
+		Version:    2,
+	}
+	msg := &message.Message{}
+	msg.SetType("TEST")
+	msg.SetTimestamp(1416840893000000000)
+	pe := NewProtobufEncoder(sk)
+
+	if err := pe.EncodeMessageStream(msg, &out); err != nil {
+		t.Fatalf("EncodeMessageStream failed: %s", err)
+	}
+	headerEnd := int(out[1]) + message.HEADER_FRAMING_SIZE
+	header := &message.Header{}
+	if ok, err := message.DecodeHeader(out[2:headerEnd], header); !ok || err != nil {
+		t.Fatalf("DecodeHeader failed: %v %s", ok, err)
+	}
+	if header.GetHmacHashFunction() != message.Header_ED25519 {
+		t.Errorf("unexpected hash function: %s", header.GetHmacHashFunction())
+	}
+	if header.GetHmacKeyVersion() != 2 {
+		t.Errorf("unexpected key version: %d", header.GetHmacKeyVersion())
+	}
+	pub := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	if !ed25519.Verify(pub, out[headerEnd:], header.GetHmac()) {
+		t.Errorf("Ed25519 signature did not verify")
+	}
+}
+
+func TestEncodeMessageStreamBadEd25519Key(t *testing.T) {
+	var out []byte
+	sk := &message.MessageSigningConfig{Name: "test", Hash: "ed25519",
+		Ed25519Key: "c2hvcnQ="}
+	msg := &message.Message{}
+	msg.SetType("TEST")
+	msg.SetTimestamp(1416840893000000000)
+	pe := NewProtobufEncoder(sk)
+	expected := "invalid Ed25519 private key: length 5"
+
+	err := pe.EncodeMessageStream(msg, &out)
+	if err == nil {
+		t.Errorf("EncodeMessageStream should have failed on a bad key")
+	} else if err.Error() != expected {
+		t.Errorf("EncodeMessageStream expected: %s received: %s", expected, err)
+	}
+}
+
 func TestEncodeMessageStreamMessageLengthFailure(t *testing.T) {
 	var out []byte
 	msg := &message.Message{}
@@ -87,3 +141,28 @@ func TestEncodeMessageStreamHeaderLengthFailure(t *testing.T) {
 		t.Errorf("EncodeMessageStream expected: %s received: %s", expected, err)
 	}
 }
+
+func TestCreateHekaStreamV2(t *testing.T) {
+	var out []byte
+	msgBytes := []byte{0x10, 0x80, 0xc4, 0x8c, 0x94, 0x91, 0xa9, 0xe8, 0xd4, 0x13, 0x1a, 0x4, 0x54, 0x45, 0x53, 0x54}
+	expected := []byte{0x1e, 0x0, 0x48, 0x4b, 0x32, 0x2, 0x8, 0x10, 0x1f}
+
+	if err := CreateHekaStreamV2(msgBytes, &out, nil); err != nil {
+		t.Fatalf("CreateHekaStreamV2 failed: %s", err)
+	}
+	if !bytes.Equal(expected, out[:len(expected)]) {
+		t.Errorf("CreateHekaStreamV2 expected prefix: %#v received: %#v", expected, out)
+	}
+	header, unframed, ok := message.SplitFramedRecord(out)
+	if !ok {
+		t.Errorf("checksum mismatch")
+	}
+	if !bytes.Equal(header, []byte{0x8, 0x10, 0x1f}) || !bytes.Equal(unframed, msgBytes) {
+		t.Errorf("SplitFramedRecord received header: %#v message: %#v", header, unframed)
+	}
+
+	out[len(out)-1] ^= 0xff
+	if _, _, ok = message.SplitFramedRecord(out); ok {
+		t.Errorf("corrupted record passed its checksum")
+	}
+}
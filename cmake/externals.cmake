@@ -174,6 +174,11 @@ if (INCLUDE_GEOIP)
     add_external_plugin(git https://github.com/abh/geoip da130741c8ed2052f5f455d56e552f2e997e1ce9)
 endif()
 
+if (INCLUDE_SQL_DRIVERS)
+    git_clone(https://github.com/lib/pq v1.10.2)
+    git_clone(https://github.com/go-sql-driver/mysql v1.6.0)
+endif()
+
 if (INCLUDE_DOCKER_PLUGINS)
     git_clone(https://github.com/fsouza/go-dockerclient 175e1df973274f04e9b459a62cffc49808f1a649)
 endif()
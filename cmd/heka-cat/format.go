@@ -0,0 +1,190 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"heka/message"
+)
+
+// Returns all of a field's values, or just the one if there's only one.
+func fieldValue(f *message.Field) interface{} {
+	var values []interface{}
+	switch f.GetValueType() {
+	case message.Field_STRING:
+		for _, v := range f.ValueString {
+			values = append(values, v)
+		}
+	case message.Field_BYTES:
+		for _, v := range f.ValueBytes {
+			values = append(values, v)
+		}
+	case message.Field_INTEGER:
+		for _, v := range f.ValueInteger {
+			values = append(values, v)
+		}
+	case message.Field_DOUBLE:
+		for _, v := range f.ValueDouble {
+			values = append(values, v)
+		}
+	case message.Field_BOOL:
+		for _, v := range f.ValueBool {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// Converts a message to a flat map suitable for NDJSON output. Repeated
+// fields with the same name are collected into an array.
+func messageMap(msg *message.Message) map[string]interface{} {
+	m := map[string]interface{}{
+		"Uuid":       msg.GetUuidString(),
+		"Timestamp":  time.Unix(0, msg.GetTimestamp()).UTC().Format(time.RFC3339Nano),
+		"Type":       msg.GetType(),
+		"Logger":     msg.GetLogger(),
+		"Severity":   msg.GetSeverity(),
+		"Payload":    msg.GetPayload(),
+		"EnvVersion": msg.GetEnvVersion(),
+		"Pid":        msg.GetPid(),
+		"Hostname":   msg.GetHostname(),
+	}
+	fields := make(map[string]interface{})
+	for _, f := range msg.Fields {
+		name := f.GetName()
+		value := fieldValue(f)
+		if existing, ok := fields[name]; ok {
+			if list, isList := existing.([]interface{}); isList {
+				fields[name] = append(list, value)
+			} else {
+				fields[name] = []interface{}{existing, value}
+			}
+		} else {
+			fields[name] = value
+		}
+	}
+	m["Fields"] = fields
+	return m
+}
+
+func writeNdjson(out io.Writer, msg *message.Message) error {
+	contents, err := json.Marshal(messageMap(msg))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", contents)
+	return err
+}
+
+func writeText(out io.Writer, msg *message.Message) {
+	fmt.Fprintf(out, "Timestamp: %s\n"+
+		"Type: %s\n"+
+		"Hostname: %s\n"+
+		"Pid: %d\n"+
+		"UUID: %s\n"+
+		"Logger: %s\n"+
+		"Payload: %s\n"+
+		"EnvVersion: %s\n"+
+		"Severity: %d\n"+
+		"Fields:\n",
+		time.Unix(0, msg.GetTimestamp()), msg.GetType(),
+		msg.GetHostname(), msg.GetPid(), msg.GetUuidString(),
+		msg.GetLogger(), msg.GetPayload(), msg.GetEnvVersion(),
+		msg.GetSeverity())
+	for _, f := range msg.Fields {
+		fmt.Fprintf(out, "    %s (%s", f.GetName(), f.GetValueType())
+		if f.GetRepresentation() != "" {
+			fmt.Fprintf(out, ", %s", f.GetRepresentation())
+		}
+		fmt.Fprintf(out, "): %v\n", fieldValue(f))
+	}
+	fmt.Fprintln(out)
+}
+
+// Summary statistics for the matched messages.
+type catStats struct {
+	count     int64
+	bytes     int64
+	first     int64
+	last      int64
+	types     map[string]int64
+	loggers   map[string]int64
+	hostnames map[string]int64
+	severity  map[string]int64
+}
+
+func newCatStats() *catStats {
+	return &catStats{
+		types:     make(map[string]int64),
+		loggers:   make(map[string]int64),
+		hostnames: make(map[string]int64),
+		severity:  make(map[string]int64),
+	}
+}
+
+func (s *catStats) add(msg *message.Message, size int) {
+	ts := msg.GetTimestamp()
+	if s.count == 0 || ts < s.first {
+		s.first = ts
+	}
+	if s.count == 0 || ts > s.last {
+		s.last = ts
+	}
+	s.count++
+	s.bytes += int64(size)
+	s.types[msg.GetType()]++
+	s.loggers[msg.GetLogger()]++
+	s.hostnames[msg.GetHostname()]++
+	s.severity[fmt.Sprintf("%d", msg.GetSeverity())]++
+}
+
+func writeCounts(out io.Writer, title string, counts map[string]int64) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	// Most frequent first.
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Fprintf(out, "%s:\n", title)
+	for _, k := range keys {
+		fmt.Fprintf(out, "    %-40s %d\n", fmt.Sprintf("%q", k), counts[k])
+	}
+}
+
+func (s *catStats) write(out io.Writer) {
+	fmt.Fprintf(out, "Messages: %d\n", s.count)
+	fmt.Fprintf(out, "Bytes: %d\n", s.bytes)
+	if s.count > 0 {
+		fmt.Fprintf(out, "First: %s\n", time.Unix(0, s.first).UTC().Format(time.RFC3339Nano))
+		fmt.Fprintf(out, "Last: %s\n", time.Unix(0, s.last).UTC().Format(time.RFC3339Nano))
+	}
+	writeCounts(out, "Types", s.types)
+	writeCounts(out, "Loggers", s.loggers)
+	writeCounts(out, "Hostnames", s.hostnames)
+	writeCounts(out, "Severities", s.severity)
+}
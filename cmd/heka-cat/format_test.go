@@ -0,0 +1,100 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"heka/client"
+	"heka/message"
+)
+
+func testMessage(msgType string) *message.Message {
+	msg := &message.Message{}
+	msg.SetType(msgType)
+	msg.SetTimestamp(1e18)
+	msg.SetLogger("test")
+	msg.SetHostname("host.example.com")
+	message.NewIntField(msg, "count", 5, "count")
+	message.NewStringField(msg, "tag", "a")
+	message.NewStringField(msg, "tag", "b")
+	return msg
+}
+
+func testStream(t *testing.T, msgs ...*message.Message) *bytes.Buffer {
+	encoder := client.NewProtobufEncoder(nil)
+	stream := new(bytes.Buffer)
+	for _, msg := range msgs {
+		var out []byte
+		if err := encoder.EncodeMessageStream(msg, &out); err != nil {
+			t.Fatal(err)
+		}
+		stream.Write(out)
+	}
+	return stream
+}
+
+func TestNdjson(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := writeNdjson(out, testMessage("test.type")); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["Type"] != "test.type" {
+		t.Errorf("Type expected: 'test.type', got: %v", decoded["Type"])
+	}
+	if decoded["Timestamp"] != "2001-09-09T01:46:40Z" {
+		t.Errorf("Timestamp expected: '2001-09-09T01:46:40Z', got: %v", decoded["Timestamp"])
+	}
+	fields := decoded["Fields"].(map[string]interface{})
+	if fields["count"] != float64(5) {
+		t.Errorf("Fields[count] expected: 5, got: %v", fields["count"])
+	}
+	tags, ok := fields["tag"].([]interface{})
+	if !ok || len(tags) != 2 || tags[0] != "a" || tags[1] != "b" {
+		t.Errorf("Fields[tag] expected: [a b], got: %v", fields["tag"])
+	}
+}
+
+func TestCatMatchAndStats(t *testing.T) {
+	match, err := message.CreateMatcherSpecification("Type != 'skip'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	c := &catter{match: match, format: "stats", out: out, stats: newCatStats()}
+	stream := testStream(t, testMessage("one"), testMessage("skip"),
+		testMessage("two"), testMessage("two"))
+	if err = c.cat(stream, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if c.processed != 4 || c.matched != 3 {
+		t.Fatalf("processed/matched expected: 4/3, got: %d/%d", c.processed, c.matched)
+	}
+	c.stats.write(out)
+	report := out.String()
+	if !strings.Contains(report, "Messages: 3\n") {
+		t.Errorf("unexpected message count in stats:\n%s", report)
+	}
+	if strings.Index(report, `"two"`) > strings.Index(report, `"one"`) {
+		t.Errorf("stats types not ordered by count:\n%s", report)
+	}
+}
@@ -15,9 +15,9 @@
 
 /*
 
-A command-line utility for counting, viewing, filtering, and extracting Heka
-protobuf logs.
-用于计数、查看、过滤和提取 Heka protobuf 日志的命令行实用程序。
+A command-line utility for counting, viewing, filtering, converting, and
+extracting Heka protobuf streams, read from files, stdin, or TCP connections.
+用于计数、查看、过滤、转换和提取 Heka protobuf 流（文件、标准输入或 TCP 连接）的命令行实用程序。
 
 */
 package main
@@ -28,7 +28,11 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
@@ -48,19 +52,184 @@ func makeSplitterRunner() (pipeline.SplitterRunner, error) {
 	return sRunner, nil
 }
 
+// Reads Heka framed streams and writes the matching messages in the
+// requested format. Safe for concurrent use by multiple streams.
+type catter struct {
+	match *message.MatcherSpecification
+	// Nanosecond timestamps the messages must fall between, zero for no
+	// limit.
+	from      int64
+	until     int64
+	format    string
+	out       io.Writer
+	stats     *catStats
+	lock      sync.Mutex
+	processed int64
+	matched   int64
+}
+
+func (c *catter) handleRecord(record []byte, offset int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.processed += 1
+	msg := new(message.Message)
+	_, msgBytes, _ := message.SplitFramedRecord(record)
+	if err := proto.Unmarshal(msgBytes, msg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error unmarshalling message at offset: %d error: %s\n", offset, err)
+		return
+	}
+
+	if ts := msg.GetTimestamp(); (c.from != 0 && ts < c.from) ||
+		(c.until != 0 && ts > c.until) || !c.match.Match(msg) {
+		return
+	}
+	c.matched += 1
+
+	switch c.format {
+	case "count":
+		// no op
+	case "stats":
+		c.stats.add(msg, len(record))
+	case "json":
+		contents, _ := json.Marshal(msg)
+		fmt.Fprintf(c.out, "%s\n", contents)
+	case "ndjson":
+		if err := writeNdjson(c.out, msg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding message at offset: %d error: %s\n", offset, err)
+		}
+	case "heka":
+		fmt.Fprintf(c.out, "%s", record)
+	default:
+		writeText(c.out, msg)
+	}
+}
+
+// Processes every record in the stream, starting at the given offset, until
+// EOF. If tail is true it keeps waiting for more data instead.
+func (c *catter) cat(r io.Reader, offset int64, tail bool) error {
+	sRunner, err := makeSplitterRunner()
+	if err != nil {
+		return err
+	}
+	for true {
+		n, record, err := sRunner.GetRecordFromStream(r)
+		if n > 0 && n != len(record) {
+			fmt.Fprintf(os.Stderr, "Corruption detected at offset: %d bytes: %d\n", offset, n-len(record))
+		}
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			if !tail {
+				return nil
+			}
+			time.Sleep(time.Duration(500) * time.Millisecond)
+		} else if len(record) > 0 {
+			c.handleRecord(record, offset)
+		}
+		offset += int64(n)
+	}
+	return nil
+}
+
+// Accepts connections (e.g. from a TcpOutput) until interrupted, processing
+// each connection's stream concurrently.
+func (c *catter) listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		listener.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening on %s, interrupt to stop\n", listener.Addr())
+	var wg sync.WaitGroup
+	conns := make(map[net.Conn]struct{})
+	var connsLock sync.Mutex
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			break
+		}
+		connsLock.Lock()
+		conns[conn] = struct{}{}
+		connsLock.Unlock()
+		wg.Add(1)
+		go func(conn net.Conn) {
+			defer wg.Done()
+			if err := c.cat(conn, 0, false); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", conn.RemoteAddr(), err)
+			}
+			conn.Close()
+			connsLock.Lock()
+			delete(conns, conn)
+			connsLock.Unlock()
+		}(conn)
+	}
+	connsLock.Lock()
+	for conn := range conns {
+		conn.Close()
+	}
+	connsLock.Unlock()
+	wg.Wait()
+	return nil
+}
+
+// Parses a -from or -until time, empty meaning no limit.
+func parseTimeFlag(name, value string) int64 {
+	if value == "" {
+		return 0
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-%s: %s\n", name, err)
+		os.Exit(1)
+	}
+	return t.UnixNano()
+}
+
+// Returns the byte range of the file that can hold messages in the catter's
+// time range, going by the file's archive index, or false if it hasn't got
+// one.
+func (c *catter) archiveRange(file *os.File) (start, end int64, ok bool) {
+	blocks, err := pipeline.ReadArchiveIndex(file.Name())
+	if err != nil {
+		return 0, 0, false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, false
+	}
+	start, end = pipeline.ArchiveSeekRange(blocks, info.Size(), c.from, c.until)
+	return start, end, true
+}
+
 func main() {
 	flagMatch := flag.String("match", "TRUE", "message_matcher filter expression")
-	flagFormat := flag.String("format", "txt", "output format [txt|json|heka|count]")
+	flagFormat := flag.String("format", "txt", "output format [txt|json|ndjson|heka|count|stats]")
 	flagOutput := flag.String("output", "", "output filename, defaults to stdout")
 	flagTail := flag.Bool("tail", false, "don't exit on EOF")
 	flagOffset := flag.Int64("offset", 0, "starting offset for the input file in bytes")
 	flagMaxMessageSize := flag.Uint64("max-message-size", 4*1024*1024, "maximum message size in bytes")
+	flagListen := flag.String("listen", "", "read streams from TCP connections to this address instead of files")
+	flagFrom := flag.String("from", "", "only messages from this RFC 3339 time, seeking with archive indexes")
+	flagUntil := flag.String("until", "", "only messages until this RFC 3339 time, seeking with archive indexes")
 	flag.Parse()
 
-	if flag.NArg() != 1 {
+	if (*flagListen == "" && flag.NArg() == 0) || (*flagListen != "" && flag.NArg() > 0) {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <file|-> [<file|-> ...]\n"+
+			"       %s [options] -listen <address>\n", os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
+	if flag.NArg() > 1 && (*flagTail || *flagOffset != 0) {
+		fmt.Fprintln(os.Stderr, "-tail and -offset can only be used with a single input file")
+		os.Exit(1)
+	}
 
 	if *flagMaxMessageSize < math.MaxUint32 {
 		maxSize := uint32(*flagMaxMessageSize)
@@ -71,19 +240,14 @@ func main() {
 	}
 
 	var err error
-	var match *message.MatcherSpecification
-	if match, err = message.CreateMatcherSpecification(*flagMatch); err != nil {
+	c := &catter{format: *flagFormat, stats: newCatStats()}
+	c.from = parseTimeFlag("from", *flagFrom)
+	c.until = parseTimeFlag("until", *flagUntil)
+	if c.match, err = message.CreateMatcherSpecification(*flagMatch); err != nil {
 		fmt.Fprintf(os.Stderr, "Match specification - %s\n", err)
 		os.Exit(2)
 	}
 
-	var file *os.File
-	if file, err = os.Open(flag.Arg(0)); err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
-		os.Exit(3)
-	}
-	defer file.Close()
-
 	var out *os.File
 	if "" == *flagOutput {
 		out = os.Stdout
@@ -94,80 +258,62 @@ func main() {
 		}
 		defer out.Close()
 	}
+	c.out = out
 
-	var offset int64
-	if offset, err = file.Seek(*flagOffset, 0); err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
-		os.Exit(5)
-	}
-
-	sRunner, err := makeSplitterRunner()
-	if err != nil {
+	if _, err = makeSplitterRunner(); err != nil {
 		fmt.Println(err)
 		os.Exit(7)
 	}
-	msg := new(message.Message)
-	var processed, matched int64
 
-	fmt.Fprintf(os.Stderr, "Input:%s  Offset:%d  Match:%s  Format:%s  Tail:%t  Output:%s\n",
-		flag.Arg(0), *flagOffset, *flagMatch, *flagFormat, *flagTail, *flagOutput)
-	for true {
-		n, record, err := sRunner.GetRecordFromStream(file)
-		if n > 0 && n != len(record) {
-			fmt.Fprintf(os.Stderr, "Corruption detected at offset: %d bytes: %d\n", offset, n-len(record))
+	if *flagListen != "" {
+		fmt.Fprintf(os.Stderr, "Input:%s  Match:%s  Format:%s  Output:%s\n",
+			*flagListen, *flagMatch, *flagFormat, *flagOutput)
+		if err = c.listen(*flagListen); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(9)
 		}
-		if err != nil {
-			if err == io.EOF {
-				if !*flagTail || "count" == *flagFormat {
-					break
-				}
-				time.Sleep(time.Duration(500) * time.Millisecond)
-			} else {
-				break
-			}
-		} else {
-			if len(record) > 0 {
-				processed += 1
-				headerLen := int(record[1]) + message.HEADER_FRAMING_SIZE
-				if err = proto.Unmarshal(record[headerLen:], msg); err != nil {
-					fmt.Fprintf(os.Stderr, "Error unmarshalling message at offset: %d error: %s\n", offset, err)
-					continue
-				}
+	}
 
-				if !match.Match(msg) {
-					continue
-				}
-				matched += 1
-
-				switch *flagFormat {
-				case "count":
-					// no op
-				case "json":
-					contents, _ := json.Marshal(msg)
-					fmt.Fprintf(out, "%s\n", contents)
-				case "heka":
-					fmt.Fprintf(out, "%s", record)
-				default:
-					fmt.Fprintf(out, "Timestamp: %s\n"+
-						"Type: %s\n"+
-						"Hostname: %s\n"+
-						"Pid: %d\n"+
-						"UUID: %s\n"+
-						"Logger: %s\n"+
-						"Payload: %s\n"+
-						"EnvVersion: %s\n"+
-						"Severity: %d\n"+
-						"Fields: %+v\n\n",
-						time.Unix(0, msg.GetTimestamp()), msg.GetType(),
-						msg.GetHostname(), msg.GetPid(), msg.GetUuidString(),
-						msg.GetLogger(), msg.GetPayload(), msg.GetEnvVersion(),
-						msg.GetSeverity(), msg.Fields)
+	tail := *flagTail && "count" != *flagFormat && "stats" != *flagFormat
+	for _, name := range flag.Args() {
+		fmt.Fprintf(os.Stderr, "Input:%s  Offset:%d  Match:%s  Format:%s  Tail:%t  Output:%s\n",
+			name, *flagOffset, *flagMatch, *flagFormat, *flagTail, *flagOutput)
+		if name == "-" {
+			err = c.cat(os.Stdin, 0, tail)
+		} else {
+			var file *os.File
+			if file, err = os.Open(name); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				os.Exit(3)
+			}
+			var r io.Reader = file
+			start := *flagOffset
+			if start == 0 && (c.from != 0 || c.until != 0) {
+				if begin, end, ok := c.archiveRange(file); ok {
+					fmt.Fprintf(os.Stderr, "Index: bytes %d to %d\n", begin, end)
+					start = begin
+					if !tail {
+						r = io.LimitReader(file, end-begin)
+					}
 				}
 			}
+			var offset int64
+			if offset, err = file.Seek(start, 0); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				os.Exit(5)
+			}
+			err = c.cat(r, offset, tail)
+			file.Close()
 		}
-		offset += int64(n)
+		if err != nil {
+			break
+		}
+	}
+
+	if "stats" == *flagFormat {
+		c.stats.write(out)
 	}
-	fmt.Fprintf(os.Stderr, "Processed: %d, matched: %d messages\n", processed, matched)
+	fmt.Fprintf(os.Stderr, "Processed: %d, matched: %d messages\n", c.processed, c.matched)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(6)
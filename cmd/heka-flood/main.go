@@ -45,6 +45,7 @@ import (
 	"github.com/pborman/uuid"
 	"heka/client"
 	"heka/message"
+	"heka/pipeline"
 	"heka/plugins/tcp"
 )
 
@@ -325,6 +326,10 @@ func main() {
 		client.LogError.Printf("Configuration test: '%s' was not found", *configTest)
 		return
 	}
+	if err := pipeline.CheckFipsSigning(&test.Signer); err != nil {
+		client.LogError.Printf("Error in test '%s': %s", *configTest, err)
+		return
+	}
 
 	if test.MsgInterval != "" {
 		var err error
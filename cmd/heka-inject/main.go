@@ -17,14 +17,16 @@
 Heka Inject client.
 
 Inject client used to test heka message flow and plugin operations.
-Allows for injecting messages with specified message variable into Heka
-pipeline.
+Allows for injecting messages with specified message variables and fields,
+optionally built from a JSON template, into a Heka pipeline via a TcpInput
+listening on a TCP address or a Unix socket.
 允许快速测试插件。Inject 需要具有 Protobufs 编码器可用性的 TcpInput
 */
 package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"time"
 
@@ -40,10 +42,11 @@ type HekaClient struct {
 }
 
 // NewHekaClient returns a new HekaClient with pre-defined encoder and sender.
-func NewHekaClient(hi string) (hc *HekaClient, err error) {
+// Network is "tcp" or "unix".
+func NewHekaClient(network, hi string) (hc *HekaClient, err error) {
 	hc = &HekaClient{}
 	hc.encoder = client.NewProtobufEncoder(nil)
-	hc.sender, err = client.NewNetworkSender("tcp", hi)
+	hc.sender, err = client.NewNetworkSender(network, hi)
 	if err == nil {
 		return hc, nil
 	}
@@ -51,18 +54,18 @@ func NewHekaClient(hi string) (hc *HekaClient, err error) {
 }
 
 type InjectData struct {
-	mtype    string
-	logger   string
-	severity int
-	payload  string
-	pid      int
-	hostname string
+	mtype      string
+	logger     string
+	severity   int
+	payload    string
+	envVersion string
+	pid        int
+	hostname   string
+	fields     []*InjectField
 }
 
-func (hc *HekaClient) injectMessage(m *InjectData) (err error) {
-	var stream []byte
-
-	msg := &message.Message{}
+func (m *InjectData) newMessage() (msg *message.Message, err error) {
+	msg = &message.Message{}
 	msg.SetTimestamp(time.Now().UnixNano())
 	msg.SetUuid(uuid.NewRandom())
 	msg.SetType(m.mtype)
@@ -71,26 +74,77 @@ func (hc *HekaClient) injectMessage(m *InjectData) (err error) {
 	msg.SetSeverity(int32(m.severity))
 	msg.SetHostname(m.hostname)
 	msg.SetPayload(string(m.payload))
+	if m.envVersion != "" {
+		msg.SetEnvVersion(m.envVersion)
+	}
+	for _, field := range m.fields {
+		if err = field.addTo(msg); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+func (hc *HekaClient) injectMessage(m *InjectData) (err error) {
+	var stream []byte
 
-	err = hc.encoder.EncodeMessageStream(msg, &stream)
+	msg, err := m.newMessage()
 	if err != nil {
-		client.LogError.Printf("Inject: [error] encode message: %s\n", err)
+		return err
 	}
-	err = hc.sender.SendMessage(stream)
-	if err != nil {
-		client.LogError.Printf("Inject: [error] send message: %s\n", err)
+	if err = hc.encoder.EncodeMessageStream(msg, &stream); err != nil {
+		return fmt.Errorf("encode message: %s", err)
+	}
+	if err = hc.sender.SendMessage(stream); err != nil {
+		return fmt.Errorf("send message: %s", err)
 	}
 	return nil
 }
 
+// Overrides the data's defaults with any values provided by the template.
+func (m *InjectData) applyTemplate(tmpl *InjectTemplate) (err error) {
+	if tmpl.Type != nil {
+		m.mtype = *tmpl.Type
+	}
+	if tmpl.Logger != nil {
+		m.logger = *tmpl.Logger
+	}
+	if tmpl.Severity != nil {
+		m.severity = int(*tmpl.Severity)
+	}
+	if tmpl.Payload != nil {
+		m.payload = *tmpl.Payload
+	}
+	if tmpl.EnvVersion != nil {
+		m.envVersion = *tmpl.EnvVersion
+	}
+	if tmpl.Pid != nil {
+		m.pid = int(*tmpl.Pid)
+	}
+	if tmpl.Hostname != nil {
+		m.hostname = *tmpl.Hostname
+	}
+	m.fields, err = tmpl.fields()
+	return
+}
+
 func main() {
-	flagHekaInstance := flag.String("heka", "127.0.0.1:5565", "Heka instance to inject message")
+	flagHekaInstance := flag.String("heka", "127.0.0.1:5565",
+		"Heka instance to inject message, a TCP address or Unix socket path")
+	flagNet := flag.String("net", "tcp", "Network type of the Heka instance (tcp or unix)")
 	flagType := flag.String("type", "inject.message", "Type of message")
 	flagLogger := flag.String("logger", "Inject Client", "Data source")
 	flagSeverity := flag.Int("severity", 7, "Syslog severity level")
 	flagPayload := flag.String("payload", "", "Textual data")
 	flagPid := flag.Int("pid", 0, "Process ID generating message")
 	flagHostname := flag.String("hostname", "", "Hostname generating message")
+	flagTemplate := flag.String("template", "",
+		"JSON message template file, explicitly set flags take precedence")
+	flagCount := flag.Int("count", 1, "Number of messages to send, 0 to send until interrupted")
+	flagRate := flag.Float64("rate", 0, "Messages per second to send, 0 for no limit")
+	var fields fieldFlags
+	flag.Var(&fields, "field",
+		"Message field as name[:type[:representation]]=value, type is string (default), int, double or bool; can be repeated")
 
 	flag.Parse()
 
@@ -104,25 +158,72 @@ func main() {
 		logger:   *flagLogger,
 		severity: *flagSeverity,
 		payload:  *flagPayload,
+		pid:      *flagPid,
+		hostname: *flagHostname,
 	}
 
-	if *flagPid == 0 {
-		data.pid = os.Getpid()
-	} else {
-		data.pid = *flagPid
+	if *flagTemplate != "" {
+		tmpl, err := LoadInjectTemplate(*flagTemplate)
+		if err == nil {
+			err = data.applyTemplate(tmpl)
+		}
+		if err != nil {
+			client.LogError.Printf("Inject: [error] template: %s\n", err)
+			os.Exit(1)
+		}
+		// Explicitly set flags win over the template.
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "type":
+				data.mtype = *flagType
+			case "logger":
+				data.logger = *flagLogger
+			case "severity":
+				data.severity = *flagSeverity
+			case "payload":
+				data.payload = *flagPayload
+			case "pid":
+				data.pid = *flagPid
+			case "hostname":
+				data.hostname = *flagHostname
+			}
+		})
 	}
+	data.fields = append(data.fields, fields...)
 
-	if *flagHostname == "" {
+	if data.pid == 0 {
+		data.pid = os.Getpid()
+	}
+	if data.hostname == "" {
 		data.hostname, _ = os.Hostname()
-	} else {
-		data.hostname = *flagHostname
 	}
 
-	hc, err := NewHekaClient(*flagHekaInstance)
-	if err == nil {
-		err := hc.injectMessage(data)
-		if err != nil {
+	hc, err := NewHekaClient(*flagNet, *flagHekaInstance)
+	if err != nil {
+		client.LogError.Printf("Inject: [error] %s\n", err)
+		os.Exit(1)
+	}
+
+	var ticker *time.Ticker
+	if *flagRate > 0 {
+		ticker = time.NewTicker(time.Duration(float64(time.Second) / *flagRate))
+		defer ticker.Stop()
+	}
+	var sent int
+	for *flagCount == 0 || sent < *flagCount {
+		if ticker != nil && sent > 0 {
+			<-ticker.C
+		}
+		if err = hc.injectMessage(data); err != nil {
 			client.LogError.Printf("Inject: [error] %s\n", err)
+			break
 		}
+		sent++
+	}
+	if *flagCount != 1 {
+		fmt.Fprintf(os.Stderr, "Sent %d messages\n", sent)
+	}
+	if err != nil {
+		os.Exit(1)
 	}
 }
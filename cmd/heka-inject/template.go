@@ -0,0 +1,185 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"heka/message"
+)
+
+// A field to be added to each injected message.
+type InjectField struct {
+	name           string
+	representation string
+	values         []interface{}
+}
+
+// Repeatable `-field` flag value, of the form
+// `name[:type[:representation]]=value`, where type is one of string (the
+// default), int, double, or bool.
+type fieldFlags []*InjectField
+
+func (f *fieldFlags) String() string {
+	return fmt.Sprintf("%d fields", len(*f))
+}
+
+func (f *fieldFlags) Set(spec string) error {
+	field, err := parseFieldSpec(spec)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, field)
+	return nil
+}
+
+func parseFieldSpec(spec string) (*InjectField, error) {
+	eq := strings.Index(spec, "=")
+	if eq < 1 {
+		return nil, fmt.Errorf("invalid field '%s', expected name[:type[:representation]]=value",
+			spec)
+	}
+	parts := strings.SplitN(spec[:eq], ":", 3)
+	raw := spec[eq+1:]
+	field := &InjectField{name: parts[0]}
+	if len(parts) == 3 {
+		field.representation = parts[2]
+	}
+	valueType := "string"
+	if len(parts) > 1 && parts[1] != "" {
+		valueType = parts[1]
+	}
+
+	var value interface{}
+	var err error
+	switch valueType {
+	case "string":
+		value = raw
+	case "int":
+		value, err = strconv.ParseInt(raw, 10, 64)
+	case "double":
+		value, err = strconv.ParseFloat(raw, 64)
+	case "bool":
+		value, err = strconv.ParseBool(raw)
+	default:
+		return nil, fmt.Errorf("field '%s': unknown type '%s'", field.name, valueType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("field '%s': invalid %s value '%s'", field.name, valueType, raw)
+	}
+	field.values = []interface{}{value}
+	return field, nil
+}
+
+// Converts a decoded JSON value to a message field value. JSON numbers
+// become integers if they're integral, doubles otherwise.
+func jsonFieldValue(name string, v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case string, bool:
+		return val, nil
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i, nil
+		}
+		return val.Float64()
+	}
+	return nil, fmt.Errorf("field '%s': unsupported value %v", name, v)
+}
+
+// Message template loaded from a JSON file. Uses the same layout as
+// heka-cat's ndjson output, e.g.:
+//
+//	{"Type": "test", "Payload": "hi", "Fields": {"status": 404, "tags": ["a", "b"]}}
+type InjectTemplate struct {
+	Type       *string
+	Logger     *string
+	Severity   *int32
+	Payload    *string
+	EnvVersion *string
+	Pid        *int32
+	Hostname   *string
+	Fields     map[string]interface{}
+}
+
+func LoadInjectTemplate(filename string) (*InjectTemplate, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseInjectTemplate(contents)
+}
+
+func ParseInjectTemplate(contents []byte) (*InjectTemplate, error) {
+	tmpl := &InjectTemplate{}
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.UseNumber()
+	if err := decoder.Decode(tmpl); err != nil {
+		return nil, fmt.Errorf("can't parse template: %s", err)
+	}
+	// Make sure all of the field values are usable up front.
+	if _, err := tmpl.fields(); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func (t *InjectTemplate) fields() (fields []*InjectField, err error) {
+	names := make([]string, 0, len(t.Fields))
+	for name := range t.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := t.Fields[name]
+		field := &InjectField{name: name}
+		list, isList := v.([]interface{})
+		if !isList {
+			list = []interface{}{v}
+		}
+		for _, item := range list {
+			value, err := jsonFieldValue(name, item)
+			if err != nil {
+				return nil, err
+			}
+			field.values = append(field.values, value)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Adds the field's values to the message.
+func (f *InjectField) addTo(msg *message.Message) error {
+	if len(f.values) == 0 {
+		return nil
+	}
+	field, err := message.NewField(f.name, f.values[0], f.representation)
+	if err != nil {
+		return fmt.Errorf("field '%s': %s", f.name, err)
+	}
+	for _, v := range f.values[1:] {
+		if err = field.AddValue(v); err != nil {
+			return fmt.Errorf("field '%s': %s", f.name, err)
+		}
+	}
+	msg.AddField(field)
+	return nil
+}
@@ -0,0 +1,81 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseFieldSpec(t *testing.T) {
+	field, err := parseFieldSpec("latency:double:ms=1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if field.name != "latency" || field.representation != "ms" || field.values[0] != 1.5 {
+		t.Errorf("unexpected field: %+v", field)
+	}
+	if field, err = parseFieldSpec("path=/a=b"); err != nil {
+		t.Fatal(err)
+	}
+	if field.values[0] != "/a=b" {
+		t.Errorf("Fields[path] expected: '/a=b', got: %v", field.values[0])
+	}
+	if _, err = parseFieldSpec("status:int=abc"); err == nil {
+		t.Error("expected error for invalid int value")
+	}
+	if _, err = parseFieldSpec("status:uint=1"); err == nil {
+		t.Error("expected error for unknown type")
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tmpl, err := ParseInjectTemplate([]byte(`{"Type": "tmpl.type", "Severity": 3,
+		"Fields": {"status": 404, "ratio": 0.5, "tags": ["a", "b"], "ok": true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := &InjectData{mtype: "default", logger: "Inject Client", severity: 7}
+	if err = data.applyTemplate(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	data.fields = append(data.fields, &InjectField{name: "extra", values: []interface{}{"x"}})
+	msg, err := data.newMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.GetType() != "tmpl.type" || msg.GetLogger() != "Inject Client" ||
+		msg.GetSeverity() != 3 {
+
+		t.Errorf("unexpected message headers: %s", msg)
+	}
+	expected := map[string]interface{}{
+		"status": int64(404),
+		"ratio":  0.5,
+		"ok":     true,
+		"extra":  "x",
+	}
+	for name, value := range expected {
+		if v, _ := msg.GetFieldValue(name); v != value {
+			t.Errorf("Fields[%s] expected: %v, got: %v", name, value, v)
+		}
+	}
+	if tags := msg.FindFirstField("tags"); tags == nil || len(tags.ValueString) != 2 {
+		t.Errorf("Fields[tags] expected: [a b], got: %v", tags)
+	}
+
+	if _, err = ParseInjectTemplate([]byte(`{"Fields": {"bad": {"nested": 1}}}`)); err == nil {
+		t.Error("expected error for nested field value")
+	}
+}
@@ -54,6 +54,10 @@ func main() {
 		client.LogError.Printf("Error decoding config file: %s", err)
 		return
 	}
+	if err := pipeline.CheckFipsSigning(&config.Signer); err != nil {
+		client.LogError.Printf("Error in config file: %s", err)
+		return
+	}
 	var sender *client.NetworkSender
 	var err error
 	if config.UseTls {
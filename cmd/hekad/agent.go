@@ -0,0 +1,291 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Prefix of the environment variables configuring the agent profile.
+const agentEnvPrefix = "HEKA_AGENT_"
+
+// Kubelet log file names, <pod>_<namespace>_<container>-<container id>.log.
+const agentFileMatch = `(?P<Pod>[^_]+)_(?P<Namespace>[^_]+)_(?P<Container>.+)-` +
+	`(?P<ContainerId>[0-9a-f]{64})\.log`
+
+// The agent profile's settings, by environment variable name without the
+// prefix, and their defaults.
+var agentDefaults = map[string]string{
+	"BASE_DIR":           "/var/cache/hekad",
+	"SHARE_DIR":          "/usr/share/heka",
+	"HOSTNAME":           "",
+	"MAXPROCS":           "",
+	"INPUT":              "files",
+	"LOG_DIRECTORY":      "/var/log/containers",
+	"FILE_MATCH":         agentFileMatch,
+	"DIFFERENTIATOR":     "Pod,_,Namespace,_,Container,-,ContainerId",
+	"DOCKER_ENDPOINT":    "unix:///var/run/docker.sock",
+	"LOG_FORMAT":         "",
+	"MESSAGE_TYPE":       "container.log",
+	"INFER_SEVERITY":     "true",
+	"OUTPUT":             "heka",
+	"TARGETS":            "",
+	"MESSAGE_MATCHER":    "TRUE",
+	"COMPRESSION":        "none",
+	"USE_TLS":            "false",
+	"TLS_CERT_FILE":      "",
+	"TLS_KEY_FILE":       "",
+	"TLS_CA_FILE":        "",
+	"BUFFER_MAX_SIZE":    "1073741824",
+	"BUFFER_FULL_ACTION": "block",
+	"EXTRA_CONFIG":       "",
+}
+
+// Quotes a TOML basic string.
+func tomlString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func tomlStrings(ss []string) string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = tomlString(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// Splits a comma separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Builds the agent profile's config, a container log input decoded and
+// forwarded to another Heka through a disk buffer, from the environment
+// variables getenv returns.
+func buildAgentConfig(getenv func(string) string) (string, error) {
+	env := func(name string) string {
+		if v := getenv(agentEnvPrefix + name); v != "" {
+			return v
+		}
+		return agentDefaults[name]
+	}
+	boolEnv := func(name string) (bool, error) {
+		b, err := strconv.ParseBool(env(name))
+		if err != nil {
+			return false, fmt.Errorf("%s%s must be a boolean", agentEnvPrefix, name)
+		}
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("[hekad]\n")
+	fmt.Fprintf(&buf, "base_dir = %s\n", tomlString(env("BASE_DIR")))
+	fmt.Fprintf(&buf, "share_dir = %s\n", tomlString(env("SHARE_DIR")))
+	if hostname := env("HOSTNAME"); hostname != "" {
+		fmt.Fprintf(&buf, "Hostname = %s\n", tomlString(hostname))
+	}
+	if maxprocs := env("MAXPROCS"); maxprocs != "" {
+		n, err := strconv.Atoi(maxprocs)
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("%sMAXPROCS must be a positive integer", agentEnvPrefix)
+		}
+		fmt.Fprintf(&buf, "maxprocs = %d\n", n)
+	}
+
+	// The input, and the format its lines are in.
+	format := env("LOG_FORMAT")
+	buf.WriteString("\n[AgentInput]\n")
+	switch env("INPUT") {
+	case "files":
+		if format == "" {
+			format = "cri"
+		}
+		buf.WriteString("type = \"LogstreamerInput\"\n")
+		fmt.Fprintf(&buf, "log_directory = %s\n", tomlString(env("LOG_DIRECTORY")))
+		fmt.Fprintf(&buf, "file_match = %s\n", tomlString(env("FILE_MATCH")))
+		if diff := splitList(env("DIFFERENTIATOR")); len(diff) > 0 {
+			fmt.Fprintf(&buf, "differentiator = %s\n", tomlStrings(diff))
+		}
+	case "docker":
+		if format == "" {
+			format = "raw"
+		}
+		buf.WriteString("type = \"DockerLogInput\"\n")
+		fmt.Fprintf(&buf, "endpoint = %s\n", tomlString(env("DOCKER_ENDPOINT")))
+	default:
+		return "", fmt.Errorf("%sINPUT must be \"files\" or \"docker\"", agentEnvPrefix)
+	}
+
+	inferSeverity, err := boolEnv("INFER_SEVERITY")
+	if err != nil {
+		return "", err
+	}
+	var subs []string
+	var decoders bytes.Buffer
+	msgType := env("MESSAGE_TYPE")
+	switch format {
+	case "cri":
+		subs = append(subs, "AgentCriDecoder")
+		decoders.WriteString("\n[AgentCriDecoder]\ntype = \"PayloadRegexDecoder\"\n")
+		decoders.WriteString("match_regex = '^(?P<Timestamp>\\S+) (?P<Stream>stdout|stderr) " +
+			"[FP] (?P<Message>.*)$'\n")
+		decoders.WriteString("timestamp_layout = \"2006-01-02T15:04:05.999999999Z07:00\"\n")
+		decoders.WriteString("[AgentCriDecoder.message_fields]\n")
+		fmt.Fprintf(&decoders, "Type = %s\n", tomlString(msgType))
+		decoders.WriteString("Payload = \"%Message%\"\nStream = \"%Stream%\"\n")
+	case "json":
+		subs = append(subs, "AgentJsonDecoder")
+		decoders.WriteString("\n[AgentJsonDecoder]\ntype = \"SandboxDecoder\"\n")
+		decoders.WriteString("filename = \"lua_decoders/json.lua\"\n")
+		decoders.WriteString("[AgentJsonDecoder.config]\n")
+		fmt.Fprintf(&decoders, "type = %s\n", tomlString(msgType))
+		decoders.WriteString("map_fields = true\nPayload = \"log\"\n")
+	case "raw":
+		subs = append(subs, "AgentTypeDecoder")
+		decoders.WriteString("\n[AgentTypeDecoder]\ntype = \"ScribbleDecoder\"\n")
+		decoders.WriteString("[AgentTypeDecoder.message_fields]\n")
+		fmt.Fprintf(&decoders, "Type = %s\n", tomlString(msgType))
+	default:
+		return "", fmt.Errorf("%sLOG_FORMAT must be \"cri\", \"json\" or \"raw\"",
+			agentEnvPrefix)
+	}
+	if inferSeverity {
+		subs = append(subs, "AgentSeverityDecoder")
+		decoders.WriteString("\n[AgentSeverityDecoder]\ntype = \"SeverityDecoder\"\n")
+		decoders.WriteString("default_severity = 6\n")
+	}
+	if len(subs) == 1 {
+		fmt.Fprintf(&buf, "decoder = %s\n", tomlString(subs[0]))
+	} else {
+		buf.WriteString("decoder = \"AgentDecoder\"\n")
+		buf.WriteString("\n[AgentDecoder]\ntype = \"MultiDecoder\"\n")
+		fmt.Fprintf(&buf, "subs = %s\n", tomlStrings(subs))
+		buf.WriteString("cascade_strategy = \"all\"\n")
+	}
+	buf.Write(decoders.Bytes())
+
+	// The output, buffered to disk.
+	targets := splitList(env("TARGETS"))
+	if len(targets) == 0 {
+		return "", fmt.Errorf("%sTARGETS must be set", agentEnvPrefix)
+	}
+	useTls, err := boolEnv("USE_TLS")
+	if err != nil {
+		return "", err
+	}
+	maxBuffer, err := strconv.ParseUint(env("BUFFER_MAX_SIZE"), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%sBUFFER_MAX_SIZE must be a number of bytes", agentEnvPrefix)
+	}
+	buf.WriteString("\n[AgentOutput]\n")
+	switch env("OUTPUT") {
+	case "heka":
+		buf.WriteString("type = \"HekaOutput\"\n")
+		fmt.Fprintf(&buf, "targets = %s\n", tomlStrings(targets))
+		fmt.Fprintf(&buf, "compression = %s\n", tomlString(env("COMPRESSION")))
+	case "tcp":
+		if len(targets) > 1 {
+			return "", fmt.Errorf("the tcp output takes a single target")
+		}
+		buf.WriteString("type = \"TcpOutput\"\n")
+		fmt.Fprintf(&buf, "address = %s\n", tomlString(targets[0]))
+		buf.WriteString("encoder = \"ProtobufEncoder\"\n")
+	default:
+		return "", fmt.Errorf("%sOUTPUT must be \"heka\" or \"tcp\"", agentEnvPrefix)
+	}
+	fmt.Fprintf(&buf, "message_matcher = %s\n", tomlString(env("MESSAGE_MATCHER")))
+	fmt.Fprintf(&buf, "use_tls = %t\n", useTls)
+	buf.WriteString("use_buffering = true\n")
+	buf.WriteString("[AgentOutput.buffering]\n")
+	fmt.Fprintf(&buf, "max_buffer_size = %d\n", maxBuffer)
+	fmt.Fprintf(&buf, "full_action = %s\n", tomlString(env("BUFFER_FULL_ACTION")))
+	if useTls {
+		buf.WriteString("[AgentOutput.tls]\n")
+		if cert, key := env("TLS_CERT_FILE"), env("TLS_KEY_FILE"); cert != "" || key != "" {
+			fmt.Fprintf(&buf, "cert_file = %s\nkey_file = %s\n", tomlString(cert),
+				tomlString(key))
+		}
+		if ca := env("TLS_CA_FILE"); ca != "" {
+			fmt.Fprintf(&buf, "root_cafile = %s\n", tomlString(ca))
+		}
+		// Mounted Secrets are rotated in place.
+		buf.WriteString("reload_certs = true\n")
+	}
+	return buf.String(), nil
+}
+
+// Writes the agent profile's config to a directory under its base_dir, with
+// links to the TOML files of the EXTRA_CONFIG directory, if set, and returns
+// the directory's path, for hekad to load as its config.
+func writeAgentConfig(getenv func(string) string) (string, error) {
+	contents, err := buildAgentConfig(getenv)
+	if err != nil {
+		return "", err
+	}
+	baseDir := getenv(agentEnvPrefix + "BASE_DIR")
+	if baseDir == "" {
+		baseDir = agentDefaults["BASE_DIR"]
+	}
+	dir := filepath.Join(baseDir, "agent")
+	if err = os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "00-agent.toml"), []byte(contents),
+		0644); err != nil {
+		return "", err
+	}
+
+	extra := getenv(agentEnvPrefix + "EXTRA_CONFIG")
+	if extra == "" {
+		return dir, nil
+	}
+	if extra, err = filepath.Abs(extra); err != nil {
+		return "", err
+	}
+	files, err := ioutil.ReadDir(extra)
+	if err != nil {
+		return "", fmt.Errorf("can't read %sEXTRA_CONFIG: %s", agentEnvPrefix, err)
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".toml") {
+			continue
+		}
+		if f.Name() == "00-agent.toml" {
+			return "", errors.New("extra config can't have a 00-agent.toml")
+		}
+		if err = os.Symlink(filepath.Join(extra, f.Name()),
+			filepath.Join(dir, f.Name())); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
@@ -0,0 +1,131 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package main
+
+import (
+	"heka/pipeline"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func agentEnv(vars map[string]string) func(string) string {
+	return func(name string) string {
+		return vars[name]
+	}
+}
+
+func TestAgentConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "agent-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	logDir := filepath.Join(tmpDir, "containers")
+	extraDir := filepath.Join(tmpDir, "extra")
+	for _, dir := range []string{logDir, extraDir} {
+		if err = os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	extra := "[ExtraOutput]\ntype = \"LogOutput\"\nmessage_matcher = \"Type == 'x'\"\n"
+	if err = ioutil.WriteFile(filepath.Join(extraDir, "extra.toml"), []byte(extra),
+		0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := agentEnv(map[string]string{
+		"HEKA_AGENT_BASE_DIR":      tmpDir,
+		"HEKA_AGENT_SHARE_DIR":     "../../sandbox/lua",
+		"HEKA_AGENT_HOSTNAME":      "node-1",
+		"HEKA_AGENT_LOG_DIRECTORY": logDir,
+		"HEKA_AGENT_TARGETS":       "aggregator-0:5565, aggregator-1:5565",
+		"HEKA_AGENT_EXTRA_CONFIG":  extraDir,
+	})
+	configPath, err := writeAgentConfig(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadHekadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Hostname != "node-1" || config.BaseDir != tmpDir {
+		t.Fatalf("unexpected hekad config: %+v", config)
+	}
+	globals, _, _ := setGlobalConfigs(config)
+	pConfig := pipeline.NewPipelineConfig(globals)
+	if err = loadFullConfig(pConfig, &configPath); err != nil {
+		t.Fatalf("Error loading full config: %s", err.Error())
+	}
+	for _, name := range []string{"AgentOutput", "ExtraOutput"} {
+		if _, ok := pConfig.OutputRunners[name]; !ok {
+			t.Fatalf("output '%s' not loaded", name)
+		}
+	}
+	if _, ok := pConfig.InputRunners["AgentInput"]; !ok {
+		t.Fatal("input 'AgentInput' not loaded")
+	}
+}
+
+func TestAgentConfigFormats(t *testing.T) {
+	contents, err := buildAgentConfig(agentEnv(map[string]string{
+		"HEKA_AGENT_INPUT":          "docker",
+		"HEKA_AGENT_LOG_FORMAT":     "json",
+		"HEKA_AGENT_OUTPUT":         "tcp",
+		"HEKA_AGENT_TARGETS":        "aggregator:5565",
+		"HEKA_AGENT_USE_TLS":        "true",
+		"HEKA_AGENT_TLS_CA_FILE":    "/etc/heka/tls/ca.crt",
+		"HEKA_AGENT_INFER_SEVERITY": "false",
+		"HEKA_AGENT_MESSAGE_TYPE":   `app "logs"`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"type = \"DockerLogInput\"\n",
+		"decoder = \"AgentJsonDecoder\"\n",
+		"type = \"app \\\"logs\\\"\"\n",
+		"type = \"TcpOutput\"\naddress = \"aggregator:5565\"\n",
+		"root_cafile = \"/etc/heka/tls/ca.crt\"\nreload_certs = true\n",
+	} {
+		if !strings.Contains(contents, expected) {
+			t.Fatalf("config missing %q:\n%s", expected, contents)
+		}
+	}
+	if strings.Contains(contents, "SeverityDecoder") {
+		t.Fatalf("severity decoder configured:\n%s", contents)
+	}
+}
+
+func TestAgentConfigErrors(t *testing.T) {
+	cases := []map[string]string{
+		{},
+		{"HEKA_AGENT_TARGETS": "a:5565", "HEKA_AGENT_INPUT": "journal"},
+		{"HEKA_AGENT_TARGETS": "a:5565", "HEKA_AGENT_LOG_FORMAT": "xml"},
+		{"HEKA_AGENT_TARGETS": "a:5565", "HEKA_AGENT_OUTPUT": "otlp"},
+		{"HEKA_AGENT_TARGETS": "a:5565,b:5565", "HEKA_AGENT_OUTPUT": "tcp"},
+		{"HEKA_AGENT_TARGETS": "a:5565", "HEKA_AGENT_USE_TLS": "maybe"},
+		{"HEKA_AGENT_TARGETS": "a:5565", "HEKA_AGENT_MAXPROCS": "0"},
+		{"HEKA_AGENT_TARGETS": "a:5565", "HEKA_AGENT_BUFFER_MAX_SIZE": "1G"},
+	}
+	for _, vars := range cases {
+		if _, err := buildAgentConfig(agentEnv(vars)); err == nil {
+			t.Fatalf("no error for %v", vars)
+		}
+	}
+}
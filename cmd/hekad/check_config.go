@@ -0,0 +1,74 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"heka/message"
+	"heka/pipeline"
+)
+
+// Loads and validates the config at configPath without starting any plugins,
+// writing the effective config of each plugin to out with the values of
+// secret looking settings redacted, so that it can be shared safely. Errors
+// are logged, and give a non-zero exit code.
+func checkConfig(configPath string, out io.Writer) (exitCode int) {
+	config, err := LoadHekadConfig(configPath)
+	if err != nil {
+		pipeline.LogError.Println("Error reading config: ", err)
+		return 1
+	}
+	if config.MaxMessageSize > 1024 {
+		message.SetMaxMessageSize(config.MaxMessageSize)
+	}
+	if err = validatePipelines(config.Pipelines); err != nil {
+		pipeline.LogError.Printf("Error in 'pipelines' config: %s", err)
+		return 1
+	}
+	if _, err = pipeline.CompileRedactPatterns(config.RedactPatterns); err != nil {
+		pipeline.LogError.Printf("Error in 'redact_patterns' config: %s", err)
+		return 1
+	}
+
+	// Only the config and its errors are of interest.
+	pipeline.LogInfo.SetOutput(ioutil.Discard)
+	globals, _, _ := setGlobalConfigs(config)
+	check := func(pConfig *pipeline.PipelineConfig, path string) error {
+		if err := pConfig.PreloadFromConfigPath(path); err != nil {
+			return err
+		}
+		return pConfig.CheckConfig(out)
+	}
+	if len(config.Pipelines) == 0 {
+		if err = check(pipeline.NewPipelineConfig(globals), configPath); err != nil {
+			pipeline.LogError.Println("Error in config: ", err)
+			return 1
+		}
+		return 0
+	}
+	for _, name := range pipelineNames(config) {
+		fmt.Fprintf(out, "# Pipeline '%s'\n", name)
+		pConfig := pipeline.NewPipelineConfig(globals.PipelineGlobals(name))
+		path := pipelineConfigPath(config.Pipelines[name], configPath)
+		if err = check(pConfig, path); err != nil {
+			pipeline.LogError.Printf("Error in pipeline '%s' config: %s", name, err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
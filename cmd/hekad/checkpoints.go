@@ -0,0 +1,83 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"heka/pipeline"
+)
+
+// Backs up the input checkpoints to backupPath, or restores them from
+// restorePath, using the checkpoint storage configPath sets up. hekad
+// shouldn't be running while checkpoints are restored, or its inputs may
+// overwrite them.
+func checkpointsCommand(backupPath, restorePath, configPath string) (exitCode int) {
+	if backupPath != "" && restorePath != "" {
+		pipeline.LogError.Println("Only one of -checkpoints_backup and " +
+			"-checkpoints_restore may be given.")
+		return 1
+	}
+	config, err := LoadHekadConfig(configPath)
+	if err != nil {
+		pipeline.LogError.Println("Error reading config: ", err)
+		return 1
+	}
+	if config.Checkpoints != nil {
+		if err = config.Checkpoints.Validate(); err != nil {
+			pipeline.LogError.Printf("Error in 'checkpoints' config: %s", err)
+			return 1
+		}
+	}
+	globals, _, _ := setGlobalConfigs(config)
+	cp, err := pipeline.NewCheckpointer(globals.Checkpoints, globals)
+	if err != nil {
+		pipeline.LogError.Printf("Can't set up checkpoint storage: %s", err)
+		return 1
+	}
+
+	if backupPath != "" {
+		file, err := os.Create(backupPath)
+		if err != nil {
+			pipeline.LogError.Printf("Can't create backup: %s", err)
+			return 1
+		}
+		err = pipeline.BackupCheckpoints(cp, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			pipeline.LogError.Printf("Error backing up checkpoints: %s", err)
+			return 1
+		}
+		fmt.Printf("Checkpoints written to %s\n", backupPath)
+		return 0
+	}
+
+	file, err := os.Open(restorePath)
+	if err != nil {
+		pipeline.LogError.Printf("Can't open backup: %s", err)
+		return 1
+	}
+	defer file.Close()
+	n, err := pipeline.RestoreCheckpoints(cp, file)
+	if err != nil {
+		pipeline.LogError.Printf("Error restoring checkpoints: %s", err)
+		return 1
+	}
+	fmt.Printf("%d checkpoints restored from %s\n", n, restorePath)
+	return 0
+}
@@ -27,6 +27,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"heka/pipeline"
+	httpPlugin "heka/plugins/http"
 )
 
 type HekadConfig struct {
@@ -48,6 +49,95 @@ type HekadConfig struct {
 	MaxMessageSize        uint32 `toml:"max_message_size"`        // 发送的消息最大大小，默认 64k
 	LogFlags              int    `toml:"log_flags"`               // log格式
 	FullBufferMaxRetries  uint32 `toml:"full_buffer_max_retries"` // 缓冲区过大时，为减轻背压清空缓冲区，hekad等待缓存区小于90%的最大间隔数
+	// Maximum sustained rate of messages per second that filters and
+	// outputs can inject in total. Defaults to unlimited.
+	MaxInjectRate uint `toml:"max_inject_rate"`
+	// Maximum sustained bytes per second sent by the outputs with
+	// shared_egress_limit set, in total. Defaults to unlimited.
+	MaxEgressBytesPerSec uint64 `toml:"max_egress_bytes_per_sec"`
+	// Bytes they can send at once after being idle. Defaults to one second's
+	// worth.
+	EgressBurstBytes uint64 `toml:"egress_burst_bytes"`
+	// Maximum bytes of the records that splitters and decoders panicked on
+	// kept under base_dir/quarantine, 0 for none. Defaults to 16MiB.
+	MaxQuarantineSize uint64 `toml:"max_quarantine_size"`
+	// Decoder and splitter used by the inputs, and encoder used by the
+	// outputs, that don't set their own.
+	DefaultDecoder  string `toml:"default_decoder"`
+	DefaultSplitter string `toml:"default_splitter"`
+	DefaultEncoder  string `toml:"default_encoder"`
+	// Regular expressions matching, case insensitively, the config keys
+	// whose values are redacted wherever plugin configs are shown. Defaults
+	// to pipeline.DefaultRedactPatterns.
+	RedactPatterns []string `toml:"redact_patterns"`
+	// Max time to wait for the pipeline to drain on shutdown, e.g. "30s".
+	ShutdownDrainTimeout string `toml:"shutdown_drain_timeout"`
+	// How long the input pack pool can stay empty before the plugins
+	// holding its packs are logged, e.g. "5s".
+	StarvationThreshold string `toml:"pack_starvation_threshold"`
+	// Enables pack leak detection, logging packs not recycled this long
+	// after being injected, e.g. "1m".
+	PackLeakDeadline string `toml:"pack_leak_deadline"`
+	// Restrict crypto to FIPS approved algorithms.
+	FipsMode bool `toml:"fips_mode"`
+	// Per-tenant quotas, from the [hekad.tenancy] subsection.
+	Tenancy *pipeline.TenancyConfig `toml:"tenancy"`
+	// Coordination of singleton inputs, from the [hekad.cluster] subsection.
+	Cluster *pipeline.ClusterConfig `toml:"cluster"`
+	// Gossip mesh membership, from the [hekad.gossip] subsection.
+	Gossip *pipeline.GossipConfig `toml:"gossip"`
+	// Storage of input positions, from the [hekad.checkpoints] subsection.
+	Checkpoints *pipeline.CheckpointConfig `toml:"checkpoints"`
+	// Size and persistence of the key/value cache shared by plugins, from
+	// the [hekad.kv_cache] subsection.
+	KVCache *pipeline.KVCacheConfig `toml:"kv_cache"`
+	// Admin API serving plugin configs and states, from the [hekad.admin]
+	// subsection.
+	Admin *AdminSettings `toml:"admin"`
+	// Watching of the config, e.g. a Kubernetes ConfigMap volume, for changes
+	// that trigger a reload, from the [hekad.config_watch] subsection.
+	ConfigWatch *pipeline.ConfigWatchConfig `toml:"config_watch"`
+	// Host metadata provider whose values are added to injected messages,
+	// from the [hekad.host_metadata] subsection.
+	HostMetadata *pipeline.HostMetadataConfig `toml:"host_metadata"`
+	// Separate pipelines to run, from the [hekad.pipelines.<name>]
+	// subsections, by name.
+	Pipelines map[string]*PipelineInstanceConfig `toml:"pipelines"`
+}
+
+// The [hekad.admin] settings: where the admin API listens, and the
+// authentication of its clients, as for DashboardOutput.
+type AdminSettings struct {
+	pipeline.AdminConfig
+	Auth *httpPlugin.HttpAuthConfig `toml:"auth"`
+}
+
+// Validate sets up the authentication, if any, and checks the settings.
+func (s *AdminSettings) Validate() error {
+	if s.Auth != nil && s.Auth.Type != "" {
+		// The API is only served over plain HTTP.
+		if err := s.Auth.CheckListener(false, nil); err != nil {
+			return fmt.Errorf("auth: tls auth isn't supported")
+		}
+		auth, err := httpPlugin.NewHttpAuthenticator(s.Auth)
+		if err != nil {
+			return fmt.Errorf("auth: %s", err)
+		}
+		s.Authenticate = auth.Handler
+	}
+	return s.AdminConfig.Validate()
+}
+
+// Settings of one of several isolated pipelines run by hekad. Zero values
+// fall back to the [hekad] settings.
+type PipelineInstanceConfig struct {
+	// Config file or directory holding the pipeline's plugin sections.
+	// Relative paths start from the directory of the main config.
+	Config   string `toml:"config"`
+	PoolSize int    `toml:"poolsize"`
+	ChanSize int    `toml:"plugin_chansize"`
+	// Defaults to the pipelines/<name> directory under the main base_dir.
+	BaseDir string `toml:"base_dir"`
 }
 
 // 配置文件和环境变量处理
@@ -68,6 +158,7 @@ func LoadHekadConfig(configPath string) (config *HekadConfig, err error) {
 		MaxMsgProcessDuration: 100000,
 		MaxMsgTimerInject:     10,
 		MaxPackIdle:           "2m",
+		StarvationThreshold:   "5s",
 		BaseDir:               filepath.FromSlash("."), // /var/cache/hekad
 		ShareDir:              filepath.FromSlash("."), // /usr/share/heka
 		SampleDenominator:     1000,
@@ -75,6 +166,7 @@ func LoadHekadConfig(configPath string) (config *HekadConfig, err error) {
 		Hostname:              hostname,
 		LogFlags:              log.LstdFlags,
 		FullBufferMaxRetries:  10,
+		MaxQuarantineSize:     pipeline.DefaultQuarantineMaxSize,
 	}
 
 	var configFile map[string]toml.Primitive
@@ -18,7 +18,11 @@ package main
 import (
 	"heka/pipeline"
 	"heka/plugins"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestDecode(t *testing.T) {
@@ -52,6 +56,120 @@ func TestCustomHostname(t *testing.T) {
 	}
 }
 
+func TestTenancy(t *testing.T) {
+	config, err := LoadHekadConfig("../../pipeline/testsupport/sample-tenancy.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals, _, _ := setGlobalConfigs(config)
+	if globals.Tenancy == nil {
+		t.Fatal("globals.Tenancy not set")
+	}
+	if globals.Tenancy.Field != "Customer" {
+		t.Fatalf("Tenancy.Field expected: 'Customer', Got: %s", globals.Tenancy.Field)
+	}
+	if globals.Tenancy.Default.MaxMsgsPerSec != 100 {
+		t.Fatalf("Default.MaxMsgsPerSec expected: 100, Got: %d",
+			globals.Tenancy.Default.MaxMsgsPerSec)
+	}
+	acme := globals.Tenancy.Tenants["acme"]
+	if acme.MaxMsgsPerSec != 1000 || acme.MaxBufferBytes != 1048576 {
+		t.Fatalf("unexpected quota for 'acme': %+v", acme)
+	}
+}
+
+func TestCluster(t *testing.T) {
+	config, err := LoadHekadConfig("../../pipeline/testsupport/sample-cluster.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals, _, _ := setGlobalConfigs(config)
+	if globals.Cluster == nil {
+		t.Fatal("globals.Cluster not set")
+	}
+	if globals.Cluster.Backend != "consul" {
+		t.Fatalf("Cluster.Backend expected: 'consul', Got: %s", globals.Cluster.Backend)
+	}
+	if globals.Cluster.Ttl != 10 {
+		t.Fatalf("Cluster.Ttl expected: 10, Got: %d", globals.Cluster.Ttl)
+	}
+	if err = globals.Cluster.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGossip(t *testing.T) {
+	config, err := LoadHekadConfig("../../pipeline/testsupport/sample-gossip.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals, _, _ := setGlobalConfigs(config)
+	if globals.Gossip == nil {
+		t.Fatal("globals.Gossip not set")
+	}
+	if globals.Gossip.BindPort != 7947 {
+		t.Fatalf("Gossip.BindPort expected: 7947, Got: %d", globals.Gossip.BindPort)
+	}
+	if len(globals.Gossip.Join) != 2 {
+		t.Fatalf("Gossip.Join expected 2 addresses, Got: %v", globals.Gossip.Join)
+	}
+	if globals.Version != VERSION {
+		t.Fatalf("Version expected: %s, Got: %s", VERSION, globals.Version)
+	}
+	if err = globals.Gossip.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	config, err := LoadHekadConfig("../../pipeline/testsupport/sample-admin.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Admin == nil || config.Admin.Auth == nil {
+		t.Fatal("config.Admin.Auth not set")
+	}
+	if config.Admin.Address != "0.0.0.0:4353" {
+		t.Fatalf("Admin.Address expected: 0.0.0.0:4353, Got: %s", config.Admin.Address)
+	}
+	if err = config.Admin.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	globals, _, _ := setGlobalConfigs(config)
+	if globals.Admin == nil || globals.Admin.Authenticate == nil {
+		t.Fatal("globals.Admin.Authenticate not set")
+	}
+
+	// Without auth, only loopback addresses are allowed.
+	config.Admin.Auth = nil
+	config.Admin.Authenticate = nil
+	if err = config.Admin.Validate(); err == nil {
+		t.Fatal("Admin.Validate accepted 0.0.0.0:4353 without auth")
+	}
+}
+
+func TestCheckpoints(t *testing.T) {
+	config, err := LoadHekadConfig("../../pipeline/testsupport/sample-checkpoints.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals, _, _ := setGlobalConfigs(config)
+	if globals.Checkpoints == nil {
+		t.Fatal("globals.Checkpoints not set")
+	}
+	if globals.Checkpoints.Backend != "etcd" {
+		t.Fatalf("Checkpoints.Backend expected: 'etcd', Got: %s",
+			globals.Checkpoints.Backend)
+	}
+	if globals.Checkpoints.KeyPrefix != "heka/positions/" {
+		t.Fatalf("Checkpoints.KeyPrefix expected: 'heka/positions/', Got: %s",
+			globals.Checkpoints.KeyPrefix)
+	}
+	if err = globals.Checkpoints.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestLoadDir(t *testing.T) {
 	origAvailablePlugins := make(map[string]func() interface{})
 	for k, v := range pipeline.AvailablePlugins {
@@ -110,3 +228,64 @@ func TestLoadDir(t *testing.T) {
 		t.Fatal("`not_loaded` filter *was* loaded, shouldn't have been!")
 	}
 }
+
+func TestPipelines(t *testing.T) {
+	configPath := "../../pipeline/testsupport/sample-pipelines.toml"
+	config, err := LoadHekadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = validatePipelines(config.Pipelines); err != nil {
+		t.Fatal(err)
+	}
+	config.BaseDir, err = ioutil.TempDir("", "hekad-pipelines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(config.BaseDir)
+	globals, _, _ := setGlobalConfigs(config)
+	pipeconfs, err := loadPipelines(config, globals, configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pipeconfs) != 2 {
+		t.Fatalf("expected 2 pipelines, Got: %d", len(pipeconfs))
+	}
+	analytics, ops := pipeconfs[0], pipeconfs[1]
+	if analytics.Globals.Pipeline != "analytics" || ops.Globals.Pipeline != "ops" {
+		t.Fatalf("unexpected pipeline order: %s, %s", analytics.Globals.Pipeline,
+			ops.Globals.Pipeline)
+	}
+	if ops.Globals.PoolSize != 50 || analytics.Globals.PoolSize != 100 {
+		t.Fatalf("unexpected pool sizes: ops %d, analytics %d", ops.Globals.PoolSize,
+			analytics.Globals.PoolSize)
+	}
+	if analytics.Globals.PluginChanSize != 10 {
+		t.Fatalf("analytics PluginChanSize expected: 10, Got: %d",
+			analytics.Globals.PluginChanSize)
+	}
+	if ops.Globals.BaseDir != filepath.Join(config.BaseDir, "pipelines", "ops") {
+		t.Fatalf("unexpected ops BaseDir: %s", ops.Globals.BaseDir)
+	}
+	if _, ok := ops.OutputRunners["OpsLog"]; !ok {
+		t.Fatal("No OpsLog output in the ops pipeline")
+	}
+	if _, ok := ops.OutputRunners["AnalyticsLog"]; ok {
+		t.Fatal("AnalyticsLog output loaded into the ops pipeline")
+	}
+	if _, ok := analytics.OutputRunners["AnalyticsLog"]; !ok {
+		t.Fatal("No AnalyticsLog output in the analytics pipeline")
+	}
+	// Any pipeline shutting down signals the shared run loop.
+	ops.Globals.ShutDown(0)
+	select {
+	case <-analytics.Globals.SigChan():
+	case <-time.After(time.Second):
+		t.Fatal("ShutDown didn't signal the shared signal channel")
+	}
+
+	config.Pipelines["bad/name"] = &PipelineInstanceConfig{Config: "x.toml"}
+	if err = validatePipelines(config.Pipelines); err == nil {
+		t.Fatal("expected an error for an invalid pipeline name")
+	}
+}
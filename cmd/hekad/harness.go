@@ -0,0 +1,74 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"heka/message"
+	"heka/pipeline"
+)
+
+// Runs the cases in the test spec file against the config the spec names,
+// or against configPath if it doesn't name one. Prints a line for each case,
+// followed by the reasons for any failures, and returns a non-zero exit code
+// if any case failed.
+func runConfigTests(specPath, configPath string) (exitCode int) {
+	spec, err := pipeline.LoadConfigTestSpec(specPath)
+	if err != nil {
+		pipeline.LogError.Println("Error reading test spec: ", err)
+		return 1
+	}
+	if spec.ConfigPath() != "" {
+		configPath = spec.ConfigPath()
+	}
+	config, err := LoadHekadConfig(configPath)
+	if err != nil {
+		pipeline.LogError.Println("Error reading config: ", err)
+		return 1
+	}
+	if config.MaxMessageSize > 1024 {
+		message.SetMaxMessageSize(config.MaxMessageSize)
+	}
+
+	// Plugin loading and startup chatter would drown out the results.
+	pipeline.LogInfo.SetOutput(ioutil.Discard)
+	newGlobals := func() *pipeline.GlobalConfigStruct {
+		globals, _, _ := setGlobalConfigs(config)
+		return globals
+	}
+	results := spec.Run(newGlobals, func(pConfig *pipeline.PipelineConfig) error {
+		return pConfig.PreloadFromConfigPath(configPath)
+	})
+
+	failed := 0
+	for _, result := range results {
+		if result.Passed() {
+			fmt.Printf("PASS: %s\n", result.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL: %s\n", result.Name)
+		for _, failure := range result.Failures {
+			fmt.Printf("    %s\n", failure)
+		}
+	}
+	fmt.Printf("%d passed, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		exitCode = 1
+	}
+	return exitCode
+}
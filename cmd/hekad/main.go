@@ -38,21 +38,38 @@ import (
 	"heka/pipeline"
 	_ "heka/plugins"
 	_ "heka/plugins/amqp"
+	_ "heka/plugins/amqp1"
+	_ "heka/plugins/azure"
+	_ "heka/plugins/beats"
+	_ "heka/plugins/benchmark"
+	_ "heka/plugins/cassandra"
+	_ "heka/plugins/chatops"
 	_ "heka/plugins/dasher"
 	_ "heka/plugins/elasticsearch"
 	_ "heka/plugins/file"
+	_ "heka/plugins/fluentd"
+	_ "heka/plugins/gcp"
 	_ "heka/plugins/graphite"
+	_ "heka/plugins/graylog"
 	_ "heka/plugins/http"
 	_ "heka/plugins/irc"
 	_ "heka/plugins/kafka"
 	_ "heka/plugins/logstreamer"
+	_ "heka/plugins/metrics"
+	_ "heka/plugins/mongodb"
 	_ "heka/plugins/nagios"
+	_ "heka/plugins/parquet"
 	_ "heka/plugins/payload"
 	_ "heka/plugins/process"
+	_ "heka/plugins/sentry"
 	_ "heka/plugins/smtp"
+	_ "heka/plugins/snmp"
+	_ "heka/plugins/sql"
 	_ "heka/plugins/statsd"
+	_ "heka/plugins/stomp"
 	_ "heka/plugins/tcp"
 	_ "heka/plugins/udp"
+	_ "heka/plugins/zeromq"
 )
 
 const (
@@ -70,6 +87,15 @@ func setGlobalConfigs(config *HekadConfig) (*pipeline.GlobalConfigStruct, string
 	maxMsgProcessDuration := config.MaxMsgProcessDuration
 	maxMsgTimerInject := config.MaxMsgTimerInject
 	maxPackIdle, _ := time.ParseDuration(config.MaxPackIdle)
+	starvationThreshold, _ := time.ParseDuration(config.StarvationThreshold)
+	var leakDeadline time.Duration
+	if config.PackLeakDeadline != "" {
+		leakDeadline, _ = time.ParseDuration(config.PackLeakDeadline)
+	}
+	var drainTimeout time.Duration
+	if config.ShutdownDrainTimeout != "" {
+		drainTimeout, _ = time.ParseDuration(config.ShutdownDrainTimeout)
+	}
 
 	runtime.GOMAXPROCS(maxprocs)
 
@@ -83,12 +109,35 @@ func setGlobalConfigs(config *HekadConfig) (*pipeline.GlobalConfigStruct, string
 	globals.MaxMsgProcessInject = maxMsgProcessInject
 	globals.MaxMsgProcessDuration = maxMsgProcessDuration
 	globals.MaxMsgTimerInject = maxMsgTimerInject
+	globals.MaxInjectRate = config.MaxInjectRate
+	globals.MaxEgressBytesPerSec = config.MaxEgressBytesPerSec
+	globals.EgressBurstBytes = config.EgressBurstBytes
+	globals.QuarantineMaxSize = config.MaxQuarantineSize
+	globals.DefaultDecoder = config.DefaultDecoder
+	globals.DefaultSplitter = config.DefaultSplitter
+	globals.DefaultEncoder = config.DefaultEncoder
+	globals.RedactPatterns = config.RedactPatterns
 	globals.MaxPackIdle = maxPackIdle
+	globals.PackStarvationThreshold = starvationThreshold
+	globals.PackLeakDeadline = leakDeadline
 	globals.BaseDir = config.BaseDir
 	globals.ShareDir = config.ShareDir
 	globals.SampleDenominator = config.SampleDenominator
 	globals.Hostname = config.Hostname
 	globals.FullBufferMaxRetries = uint(config.FullBufferMaxRetries)
+	globals.ShutdownDrainTimeout = drainTimeout
+	globals.Tenancy = config.Tenancy
+	globals.Cluster = config.Cluster
+	globals.Gossip = config.Gossip
+	globals.Checkpoints = config.Checkpoints
+	globals.Cache = config.KVCache
+	if config.Admin != nil {
+		globals.Admin = &config.Admin.AdminConfig
+	}
+	globals.ConfigWatch = config.ConfigWatch
+	globals.HostMetadata = config.HostMetadata
+	globals.Version = VERSION
+	pipeline.SetFipsMode(config.FipsMode)
 
 	return globals, cpuProfName, memProfName
 }
@@ -107,19 +156,69 @@ func main() {
 		"Config file or directory. If directory is specified then all files "+
 			"in the directory will be loaded.")
 	version := flag.Bool("version", false, "Output version and exit")
+	service := flag.String("service", "",
+		"Windows service command: 'install', 'uninstall', or 'run'.")
+	serviceName := flag.String("service_name", "hekad",
+		"Name of the Windows service used by the -service commands.")
+	testSpec := flag.String("test", "",
+		"Run the test cases in the specified test spec file, then exit.")
+	backup := flag.String("checkpoints_backup", "",
+		"Write all stored input checkpoints to the specified file, then exit.")
+	restore := flag.String("checkpoints_restore", "",
+		"Store the input checkpoints from the specified backup file, then exit.")
+	check := flag.Bool("check_config", false,
+		"Validate the config and print each plugin's effective config, with "+
+			"secrets redacted, then exit.")
+	agent := flag.Bool("agent", false,
+		"Run the container log agent configured by the HEKA_AGENT_* environment "+
+			"variables, ignoring -config.")
 	flag.Parse()
 
+	if *version {
+		fmt.Println(VERSION)
+		return
+	}
+	if *agent {
+		var err error
+		if *configPath, err = writeAgentConfig(os.Getenv); err != nil {
+			pipeline.LogError.Println("Error in agent config: ", err)
+			exitCode = 1
+			return
+		}
+	}
+	if *check {
+		exitCode = checkConfig(*configPath, os.Stdout)
+		return
+	}
+	if *testSpec != "" {
+		exitCode = runConfigTests(*testSpec, *configPath)
+		return
+	}
+	if *backup != "" || *restore != "" {
+		exitCode = checkpointsCommand(*backup, *restore, *configPath)
+		return
+	}
+	if *service != "" {
+		exitCode = serviceCommand(*service, *serviceName, *configPath)
+		return
+	}
+	exitCode = runHekad(*configPath, nil)
+}
+
+// Loads the config and runs hekad until it shuts down, returning the exit
+// code. If globalsChan isn't nil, the global config is sent on it just
+// before the pipeline starts, so that a Windows service control handler can
+// trigger a shutdown.
+func runHekad(configPath string, globalsChan chan<- *pipeline.GlobalConfigStruct) (
+	exitCode int) {
+
 	config := &HekadConfig{}
 	var err error
 	var cpuProfName string
 	var memProfName string
 
-	if *version {
-		fmt.Println(VERSION)
-		return
-	}
 	// 加载hekad 配置 默认从etc读取，读不到退出
-	config, err = LoadHekadConfig(*configPath)
+	config, err = LoadHekadConfig(configPath)
 	if err != nil {
 		pipeline.LogError.Println("Error reading config: ", err)
 		exitCode = 1
@@ -140,8 +239,113 @@ func main() {
 		return
 	}
 
+	if _, err = time.ParseDuration(config.StarvationThreshold); err != nil {
+		pipeline.LogError.Printf("Can't parse `pack_starvation_threshold` time duration: %s\n",
+			config.StarvationThreshold)
+		exitCode = 1
+		return
+	}
+
+	if config.PackLeakDeadline != "" {
+		if _, err = time.ParseDuration(config.PackLeakDeadline); err != nil {
+			pipeline.LogError.Printf("Can't parse `pack_leak_deadline` time duration: %s\n",
+				config.PackLeakDeadline)
+			exitCode = 1
+			return
+		}
+	}
+
+	if config.ShutdownDrainTimeout != "" {
+		if _, err = time.ParseDuration(config.ShutdownDrainTimeout); err != nil {
+			pipeline.LogError.Printf("Can't parse `shutdown_drain_timeout` time duration: %s\n",
+				config.ShutdownDrainTimeout)
+			exitCode = 1
+			return
+		}
+	}
+
+	if _, err = pipeline.CompileRedactPatterns(config.RedactPatterns); err != nil {
+		pipeline.LogError.Printf("Error in 'redact_patterns' config: %s", err)
+		exitCode = 1
+		return
+	}
+
+	if config.Cluster != nil {
+		if err = config.Cluster.Validate(); err != nil {
+			pipeline.LogError.Printf("Error in 'cluster' config: %s", err)
+			exitCode = 1
+			return
+		}
+	}
+
+	if config.Gossip != nil {
+		if err = config.Gossip.Validate(); err != nil {
+			pipeline.LogError.Printf("Error in 'gossip' config: %s", err)
+			exitCode = 1
+			return
+		}
+	}
+
+	if config.Checkpoints != nil {
+		if err = config.Checkpoints.Validate(); err != nil {
+			pipeline.LogError.Printf("Error in 'checkpoints' config: %s", err)
+			exitCode = 1
+			return
+		}
+	}
+
+	if config.KVCache != nil {
+		if err = config.KVCache.Validate(); err != nil {
+			pipeline.LogError.Printf("Error in 'kv_cache' config: %s", err)
+			exitCode = 1
+			return
+		}
+	}
+
+	if config.Admin != nil {
+		if err = config.Admin.Validate(); err != nil {
+			pipeline.LogError.Printf("Error in 'admin' config: %s", err)
+			exitCode = 1
+			return
+		}
+	}
+
+	if config.ConfigWatch != nil {
+		if err = config.ConfigWatch.Validate(); err != nil {
+			pipeline.LogError.Printf("Error in 'config_watch' config: %s", err)
+			exitCode = 1
+			return
+		}
+	}
+
+	if config.HostMetadata != nil {
+		if err = config.HostMetadata.Validate(); err != nil {
+			pipeline.LogError.Printf("Error in 'host_metadata' config: %s", err)
+			exitCode = 1
+			return
+		}
+	}
+
+	if err = validatePipelines(config.Pipelines); err != nil {
+		pipeline.LogError.Printf("Error in 'pipelines' config: %s", err)
+		exitCode = 1
+		return
+	}
+
 	globals, cpuProfName, memProfName := setGlobalConfigs(config)
 
+	if config.HostMetadata != nil {
+		// Carry on without the provider's values if it can't be reached,
+		// rather than failing to start.
+		globals.HostInfo, err = pipeline.LoadHostMetadata(config.HostMetadata)
+		if err != nil {
+			pipeline.LogError.Printf("Error loading host metadata: %s", err)
+		}
+		if *config.HostMetadata.SetHostname && globals.HostInfo.Hostname != "" {
+			globals.Hostname = globals.HostInfo.Hostname
+		}
+	}
+
 	if err = os.MkdirAll(globals.BaseDir, 0755); err != nil {
 		pipeline.LogError.Printf("Error creating 'base_dir' %s: %s", config.BaseDir, err)
 		exitCode = 1
@@ -228,42 +432,34 @@ func main() {
 
 	// 读取其它节点配置开始管道运行，并初始化插件，失败则退出
 	// Set up and load the pipeline configuration and start the daemon.
+	if len(config.Pipelines) > 0 {
+		pipeconfs, err := loadPipelines(config, globals, configPath)
+		if err != nil {
+			pipeline.LogError.Println("Error reading config: ", err)
+			exitCode = 1
+			return
+		}
+		if globalsChan != nil {
+			globalsChan <- globals
+		}
+		exitCode = pipeline.RunPipelines(pipeconfs)
+		return
+	}
 	pipeconf := pipeline.NewPipelineConfig(globals)
-	if err = loadFullConfig(pipeconf, configPath); err != nil {
+	if err = loadFullConfig(pipeconf, &configPath); err != nil {
 		pipeline.LogError.Println("Error reading config: ", err)
 		exitCode = 1
 		return
 	}
+	if globalsChan != nil {
+		globalsChan <- globals
+	}
 	exitCode = pipeline.Run(pipeconf)
+	return
 }
 
 func loadFullConfig(pipeconf *pipeline.PipelineConfig, configPath *string) (err error) {
-	p, err := os.Open(*configPath)
-	if err != nil {
-		return fmt.Errorf("error opening file: %s", err.Error())
-	}
-	fi, err := p.Stat()
-	if err != nil {
-		return fmt.Errorf("can't stat file: %s", err.Error())
-	}
-	//判断传入的配置，是路径还是文件，路径则加载所有toml文件
-	if fi.IsDir() {
-		files, _ := ioutil.ReadDir(*configPath)
-		for _, f := range files {
-			fName := f.Name()
-			if !strings.HasSuffix(fName, ".toml") {
-				// Skip non *.toml files in a config dir.
-				continue
-			}
-			err = pipeconf.PreloadFromConfigFile(filepath.Join(*configPath, fName))
-			if err != nil {
-				break
-			}
-		}
-	} else {
-		err = pipeconf.PreloadFromConfigFile(*configPath)
-	}
-	if err == nil {
+	if err = pipeconf.PreloadFromConfigPath(*configPath); err == nil {
 		err = pipeconf.LoadConfig()
 	}
 	return err
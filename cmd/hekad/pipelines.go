@@ -0,0 +1,105 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"heka/pipeline"
+)
+
+// Checks the [hekad.pipelines] subsections.
+func validatePipelines(pipelines map[string]*PipelineInstanceConfig) error {
+	for name, inst := range pipelines {
+		if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+			return fmt.Errorf("invalid pipeline name '%s'", name)
+		}
+		if inst == nil || inst.Config == "" {
+			return fmt.Errorf("pipeline '%s' has no 'config' path", name)
+		}
+		if inst.PoolSize < 0 || inst.ChanSize < 0 {
+			return fmt.Errorf("pipeline '%s' 'poolsize' and 'plugin_chansize' "+
+				"can't be negative", name)
+		}
+	}
+	return nil
+}
+
+// Sets up a PipelineConfig for each of the named pipelines, in name order,
+// each loading its plugins from its own config path. Only the first joins the
+// gossip mesh, since they'd otherwise all bind the same port.
+func loadPipelines(config *HekadConfig, globals *pipeline.GlobalConfigStruct,
+	configPath string) ([]*pipeline.PipelineConfig, error) {
+
+	if len(config.Pipelines) == 0 {
+		return nil, errors.New("no pipelines configured")
+	}
+	names := pipelineNames(config)
+	pipeconfs := make([]*pipeline.PipelineConfig, len(names))
+	for i, name := range names {
+		inst := config.Pipelines[name]
+		g := globals.PipelineGlobals(name)
+		if inst.PoolSize > 0 {
+			g.PoolSize = inst.PoolSize
+		}
+		if inst.ChanSize > 0 {
+			g.PluginChanSize = inst.ChanSize
+		}
+		if inst.BaseDir != "" {
+			g.BaseDir = inst.BaseDir
+		}
+		if i > 0 {
+			g.Gossip = nil
+		}
+		if err := os.MkdirAll(g.BaseDir, 0755); err != nil {
+			return nil, fmt.Errorf("pipeline '%s' can't create 'base_dir' %s: %s",
+				name, g.BaseDir, err)
+		}
+		path := pipelineConfigPath(inst, configPath)
+		pipeconfs[i] = pipeline.NewPipelineConfig(g)
+		if err := loadFullConfig(pipeconfs[i], &path); err != nil {
+			return nil, fmt.Errorf("pipeline '%s': %s", name, err)
+		}
+	}
+	return pipeconfs, nil
+}
+
+// Returns the names of the configured pipelines, sorted.
+func pipelineNames(config *HekadConfig) []string {
+	names := make([]string, 0, len(config.Pipelines))
+	for name := range config.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the path of a pipeline's plugin config, relative paths starting
+// from the directory of the main config.
+func pipelineConfigPath(inst *PipelineInstanceConfig, configPath string) string {
+	if filepath.IsAbs(inst.Config) {
+		return inst.Config
+	}
+	configDir := configPath
+	if fi, err := os.Stat(configPath); err == nil && !fi.IsDir() {
+		configDir = filepath.Dir(configPath)
+	}
+	return filepath.Join(configDir, inst.Config)
+}
@@ -0,0 +1,193 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+	"heka/pipeline"
+)
+
+// Event IDs used when writing hekad's logs to the Windows Event Log.
+const (
+	eventIdInfo  = 1
+	eventIdError = 2
+)
+
+// Sends everything logged through a pipeline logger to the event log.
+type eventLogWriter struct {
+	elog    *eventlog.Log
+	isError bool
+}
+
+func (w *eventLogWriter) Write(p []byte) (n int, err error) {
+	msg := strings.TrimRight(string(p), "\r\n")
+	if w.isError {
+		err = w.elog.Error(eventIdError, msg)
+	} else {
+		err = w.elog.Info(eventIdInfo, msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Windows service control handler wrapping a hekad run.
+type hekadService struct {
+	configPath string
+	exitCode   int
+}
+
+func (s *hekadService) Execute(args []string, requests <-chan svc.ChangeRequest,
+	status chan<- svc.Status) (svcSpecificEC bool, exitCode uint32) {
+
+	status <- svc.Status{State: svc.StartPending}
+
+	globalsChan := make(chan *pipeline.GlobalConfigStruct, 1)
+	done := make(chan int)
+	go func() {
+		done <- runHekad(s.configPath, globalsChan)
+	}()
+
+	accepts := svc.AcceptStop | svc.AcceptShutdown
+	var globals *pipeline.GlobalConfigStruct
+	for {
+		select {
+		case globals = <-globalsChan:
+			status <- svc.Status{State: svc.Running, Accepts: accepts}
+		case code := <-done:
+			s.exitCode = code
+			if code != 0 {
+				return true, uint32(code)
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				if globals != nil {
+					globals.ShutDown(0)
+				}
+			}
+		}
+	}
+}
+
+func serviceCommand(cmd, name, configPath string) int {
+	var err error
+	switch cmd {
+	case "install":
+		err = installService(name, configPath)
+	case "uninstall":
+		err = uninstallService(name)
+	case "run":
+		return runService(name, configPath)
+	default:
+		err = fmt.Errorf("unknown service command '%s'", cmd)
+	}
+	if err != nil {
+		pipeline.LogError.Printf("Error: %s", err)
+		return 1
+	}
+	return 0
+}
+
+func installService(name, configPath string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("can't find hekad executable: %s", err)
+	}
+	if configPath, err = filepath.Abs(configPath); err != nil {
+		return fmt.Errorf("can't resolve config path: %s", err)
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("can't connect to service manager: %s", err)
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return fmt.Errorf("service '%s' already exists", name)
+	}
+	s, err := m.CreateService(name, exePath, mgr.Config{
+		DisplayName: "Heka (" + name + ")",
+		Description: "Heka data collection and processing daemon.",
+		StartType:   mgr.StartAutomatic,
+	}, "-config", configPath, "-service", "run", "-service_name", name)
+	if err != nil {
+		return fmt.Errorf("can't create service: %s", err)
+	}
+	defer s.Close()
+	err = eventlog.InstallAsEventCreate(name,
+		eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		s.Delete()
+		return fmt.Errorf("can't register event log source: %s", err)
+	}
+	pipeline.LogInfo.Printf("Installed service '%s'", name)
+	return nil
+}
+
+func uninstallService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("can't connect to service manager: %s", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service '%s' is not installed", name)
+	}
+	defer s.Close()
+	if err = s.Delete(); err != nil {
+		return fmt.Errorf("can't delete service: %s", err)
+	}
+	if err = eventlog.Remove(name); err != nil {
+		return fmt.Errorf("can't remove event log source: %s", err)
+	}
+	pipeline.LogInfo.Printf("Uninstalled service '%s'", name)
+	return nil
+}
+
+func runService(name, configPath string) int {
+	if isService, err := svc.IsWindowsService(); err != nil || !isService {
+		pipeline.LogError.Println("Error: '-service run' must be started by the service manager")
+		return 1
+	}
+	elog, err := eventlog.Open(name)
+	if err != nil {
+		pipeline.LogError.Printf("Can't open event log: %s", err)
+		return 1
+	}
+	defer elog.Close()
+	pipeline.LogInfo.SetOutput(&eventLogWriter{elog: elog})
+	pipeline.LogError.SetOutput(&eventLogWriter{elog: elog, isError: true})
+
+	s := &hekadService{configPath: configPath}
+	if err = svc.Run(name, s); err != nil {
+		elog.Error(eventIdError, fmt.Sprintf("Service '%s' failed: %s", name, err))
+		return 1
+	}
+	return s.exitCode
+}
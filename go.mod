@@ -9,7 +9,13 @@ require (
 	github.com/cactus/gostrftime v1.0.1
 	github.com/crankycoder/xmlpath v0.0.0-20130917154930-670b185b686f
 	github.com/fsouza/go-dockerclient v1.7.4
+	github.com/go-sql-driver/mysql v1.7.1
 	github.com/gogo/protobuf v1.3.2
+	github.com/golang/snappy v0.0.3
+	github.com/hashicorp/memberlist v0.2.4
+	github.com/klauspost/compress v1.12.2
+	github.com/lib/pq v1.10.9
+	github.com/miekg/dns v1.1.26
 	github.com/orfjackal/nanospec.go v0.0.0-20120727230329-de4694c1d701 // indirect
 	github.com/pborman/uuid v1.2.1
 	github.com/rafrombrc/go-notify v0.0.0-20130215201805-e3ddb616eea9
@@ -18,7 +24,8 @@ require (
 	github.com/rafrombrc/whisper-go v0.0.0-20130813185214-89e9ba3b5c6a
 	github.com/streadway/amqp v1.0.0
 	github.com/thoj/go-ircevent v0.0.0-20210723090443-73e444401d64
+	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e
+	golang.org/x/sys v0.0.0-20210616094352-59db8d763f22
 	launchpad.net/gocheck v0.0.0-20140225173054-000000000087 // indirect
 	launchpad.net/xmlpath v0.0.0-20130614043138-000000000004 // indirect
-
 )
@@ -348,11 +348,48 @@ func (l *Logstream) UpdateLogfiles(logfiles Logfiles) {
 	l.logfiles = logfiles
 }
 
+// Backfilling returns true when the logstream is behind, reading one of its
+// files older than the newest, or about to start on the oldest of several.
+func (l *Logstream) Backfilling() bool {
+	l.lfMutex.RLock()
+	defer l.lfMutex.RUnlock()
+	if len(l.logfiles) < 2 {
+		return false
+	}
+	return l.logfiles.IndexOf(l.position.Filename)+1 < len(l.logfiles)
+}
+
 // Save our position in the stream
 func (l *Logstream) SavePosition() error {
 	return l.position.Save()
 }
 
+// Reload our position from the journal, for when another reader may have
+// moved it on. Must not be called while the stream is being read.
+func (l *Logstream) ReloadPosition() error {
+	var (
+		position *LogstreamLocation
+		err      error
+	)
+	if l.position.store != nil {
+		position, err = LogstreamLocationFromStore(l.position.store, l.position.name, "")
+	} else {
+		position, err = LogstreamLocationFromFile(l.position.JournalPath)
+	}
+	if err != nil {
+		return err
+	}
+	if l.fd != nil {
+		l.fd.Close()
+		l.fd = nil
+		l.reader = nil
+	}
+	l.saveBuffer = l.saveBuffer[:0]
+	l.priorEOF = false
+	l.position = position
+	return nil
+}
+
 // Get a copy of the logfiles
 func (l *Logstream) GetLogfiles() (logfiles Logfiles) {
 	l.lfMutex.RLock()
@@ -379,6 +416,7 @@ type LogstreamSet struct {
 	journalRoot    string         // Base path for journal files (ie, /etc/journals)
 	fileMatch      *regexp.Regexp // File match for regular expression
 	initialTail    bool           // Whether to ignore previous logfiles while initial scan
+	store          PositionStore  // Where positions are saved instead of journal files
 }
 
 // append a path separator if needed and escape regexp meta characters
@@ -420,6 +458,15 @@ func NewLogstreamSet(sortPattern *SortPattern, oldest time.Duration,
 	return ls, nil
 }
 
+// Saves the positions of logstreams found from now on to the store, rather
+// than to journal files. Any journal files are still read for positions the
+// store doesn't have yet.
+func (ls *LogstreamSet) SetPositionStore(store PositionStore) {
+	ls.logstreamMutex.Lock()
+	defer ls.logstreamMutex.Unlock()
+	ls.store = store
+}
+
 // Access a logstream by name if it exists
 func (ls *LogstreamSet) GetLogstream(name string) (l *Logstream, ok bool) {
 	ls.logstreamMutex.RLock()
@@ -476,7 +523,15 @@ func (ls *LogstreamSet) ScanForLogstreams() (result []string, errors *MultipleEr
 		// the new logstream in the map, recording its newness in result
 		if !ok {
 			journalPath := filepath.Join(ls.journalRoot, name)
-			position, err := LogstreamLocationFromFile(journalPath)
+			var (
+				position *LogstreamLocation
+				err      error
+			)
+			if ls.store != nil {
+				position, err = LogstreamLocationFromStore(ls.store, name, journalPath)
+			} else {
+				position, err = LogstreamLocationFromFile(journalPath)
+			}
 			if err != nil {
 				errors.AddMessage(err.Error())
 				position.Reset()
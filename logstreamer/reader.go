@@ -36,6 +36,17 @@ type LogstreamLocation struct {
 	Hash         string `json:"last_hash"`
 	JournalPath  string `json:"-"`
 	lastLine     *ringbuf.Ringbuf
+	// Where the location is saved instead of the journal file, if set.
+	store PositionStore
+	name  string
+}
+
+// Saves logstream locations somewhere other than journal files, keyed by
+// logstream name.
+type PositionStore interface {
+	// LoadPosition returns the saved location, or nil if there's none.
+	LoadPosition(name string) ([]byte, error)
+	SavePosition(name string, position []byte) error
 }
 
 var LINEBUFFERLEN = 500
@@ -74,21 +85,46 @@ func LogstreamLocationFromFile(journalPath string) (l *LogstreamLocation, err er
 	contents := bytes.NewBuffer(nil)
 	defer seekJournal.Close()
 	io.Copy(contents, seekJournal)
+	err = l.decode(contents.Bytes())
+	return
+}
+
+// Loads a logstreamlocation from the store, falling back to the journal file
+// if the store has none, or returns an empty one if neither was found. The
+// location is saved to the store.
+func LogstreamLocationFromStore(store PositionStore, name, journalPath string) (
+	l *LogstreamLocation, err error) {
+
+	var saved []byte
+	if saved, err = store.LoadPosition(name); err != nil {
+		l = new(LogstreamLocation)
+		l.lastLine = ringbuf.New(LINEBUFFERLEN)
+	} else if saved == nil && journalPath != "" {
+		l, err = LogstreamLocationFromFile(journalPath)
+	} else {
+		l = new(LogstreamLocation)
+		l.lastLine = ringbuf.New(LINEBUFFERLEN)
+		err = l.decode(saved)
+	}
+	l.JournalPath = journalPath
+	l.store = store
+	l.name = name
+	return
+}
 
+func (l *LogstreamLocation) decode(contents []byte) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = errors.New("Error parsing the journal file")
 		}
 	}()
 
-	cBytes := contents.Bytes()
-	cBytes = bytes.TrimSpace(cBytes)
+	cBytes := bytes.TrimSpace(contents)
 	if len(cBytes) == 0 {
 		// File is empty, skip it.
 		return
 	}
-	err = json.Unmarshal(cBytes, l)
-	return
+	return json.Unmarshal(cBytes, l)
 }
 
 func (l *LogstreamLocation) Debug() string {
@@ -168,8 +204,8 @@ func (l *LogstreamLocation) IsZero() bool {
 }
 
 func (l *LogstreamLocation) Save() error {
-	// If we don't have a JournalPath, ignore
-	if l.JournalPath == "" {
+	// If we don't have a JournalPath or store, ignore
+	if l.JournalPath == "" && l.store == nil {
 		return nil
 	}
 
@@ -179,6 +215,9 @@ func (l *LogstreamLocation) Save() error {
 	if err != nil {
 		return err
 	}
+	if l.store != nil {
+		return l.store.SavePosition(l.name, b)
+	}
 
 	seekJournal, file_err := os.OpenFile(l.JournalPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0660)
 	if file_err != nil {
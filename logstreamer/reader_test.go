@@ -18,6 +18,7 @@ package logstreamer
 import (
 	"heka/ringbuf"
 	gs "github.com/rafrombrc/gospec/src/gospec"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -218,4 +219,114 @@ func ReaderSpec(c gs.Context) {
 		c.Expect(ls.position.Hash, gs.Equals, "72781af95a1583690cc97548fdcf3bb0efbe3119")
 		c.Expect(ls.position.Filename[len(testDirPath):], gs.Equals, "/2013/08/error.log")
 	})
+
+	c.Specify("A position can be reloaded from its journal", func() {
+		journalDir, err := ioutil.TempDir("", "logstreamer-journal")
+		c.Assume(err, gs.IsNil)
+		defer os.RemoveAll(journalDir)
+
+		regex := `/(?P<Year>\d+)/(?P<Month>\d+)/error\.log(\.(?P<Seq>\d+))?`
+		if runtime.GOOS == "windows" {
+			regex = `\\(?P<Year>\d+)\\(?P<Month>\d+)\\error\.log(\.(?P<Seq>\d+))?`
+		}
+		sp := &SortPattern{
+			FileMatch:      regex,
+			Translation:    make(SubmatchTranslationMap),
+			Priority:       []string{"Year", "Month", "^Seq"},
+			Differentiator: []string{"errorlog"},
+		}
+		fivey, _ := time.ParseDuration("5y")
+		lss, err := NewLogstreamSet(sp, fivey, testDirPath, journalDir, false)
+		c.Expect(err, gs.IsNil)
+		names, _ := lss.ScanForLogstreams()
+		c.Assume(len(names), gs.Equals, 1)
+		stream := lss.logstreams[names[0]]
+
+		// Another reader moves the stream on and saves its position.
+		other, err := LogstreamLocationFromFile(stream.position.JournalPath)
+		c.Assume(err, gs.IsNil)
+		other.Filename = filepath.Join(testDirPath, "2013", "08", "error.log")
+		other.SeekPosition = 1000
+		c.Assume(other.Save(), gs.IsNil)
+
+		c.Expect(stream.position.SeekPosition, gs.Equals, int64(0))
+		c.Expect(stream.ReloadPosition(), gs.IsNil)
+		c.Expect(stream.position.Filename, gs.Equals, other.Filename)
+		c.Expect(stream.position.SeekPosition, gs.Equals, int64(1000))
+	})
+
+	c.Specify("Positions can be kept in a store", func() {
+		store := memPositionStore{}
+		regex := `/(?P<Year>\d+)/(?P<Month>\d+)/error\.log(\.(?P<Seq>\d+))?`
+		if runtime.GOOS == "windows" {
+			regex = `\\(?P<Year>\d+)\\(?P<Month>\d+)\\error\.log(\.(?P<Seq>\d+))?`
+		}
+		sp := &SortPattern{
+			FileMatch:      regex,
+			Translation:    make(SubmatchTranslationMap),
+			Priority:       []string{"Year", "Month", "^Seq"},
+			Differentiator: []string{"errorlog"},
+		}
+		fivey, _ := time.ParseDuration("5y")
+
+		c.Specify("falling back to the journal file", func() {
+			journalDir, err := ioutil.TempDir("", "logstreamer-journal")
+			c.Assume(err, gs.IsNil)
+			defer os.RemoveAll(journalDir)
+			journal := `{"seek":1500,"file_name":"error.log","last_hash":"abc"}`
+			err = ioutil.WriteFile(filepath.Join(journalDir, "errorlog"), []byte(journal), 0644)
+			c.Assume(err, gs.IsNil)
+
+			lss, err := NewLogstreamSet(sp, fivey, testDirPath, journalDir, false)
+			c.Assume(err, gs.IsNil)
+			lss.SetPositionStore(store)
+			names, _ := lss.ScanForLogstreams()
+			c.Assume(len(names), gs.Equals, 1)
+			stream := lss.logstreams[names[0]]
+			c.Expect(stream.position.SeekPosition, gs.Equals, int64(1500))
+
+			stream.position.SeekPosition = 1000
+			c.Expect(stream.SavePosition(), gs.IsNil)
+			_, ok := store["errorlog"]
+			c.Expect(ok, gs.IsTrue)
+			saved, err := ioutil.ReadFile(filepath.Join(journalDir, "errorlog"))
+			c.Expect(string(saved), gs.Equals, journal)
+		})
+
+		c.Specify("and reloaded from it", func() {
+			journalDir, err := ioutil.TempDir("", "logstreamer-journal")
+			c.Assume(err, gs.IsNil)
+			defer os.RemoveAll(journalDir)
+			lss, err := NewLogstreamSet(sp, fivey, testDirPath, journalDir, false)
+			c.Assume(err, gs.IsNil)
+			lss.SetPositionStore(store)
+			names, _ := lss.ScanForLogstreams()
+			c.Assume(len(names), gs.Equals, 1)
+			stream := lss.logstreams[names[0]]
+
+			other, err := LogstreamLocationFromStore(store, "errorlog", "")
+			c.Assume(err, gs.IsNil)
+			other.Filename = filepath.Join(testDirPath, "2013", "08", "error.log")
+			other.SeekPosition = 1000
+			c.Assume(other.Save(), gs.IsNil)
+
+			c.Expect(stream.ReloadPosition(), gs.IsNil)
+			c.Expect(stream.position.Filename, gs.Equals, other.Filename)
+			c.Expect(stream.position.SeekPosition, gs.Equals, int64(1000))
+			// No journal files are written.
+			files, _ := ioutil.ReadDir(journalDir)
+			c.Expect(len(files), gs.Equals, 0)
+		})
+	})
+}
+
+type memPositionStore map[string][]byte
+
+func (m memPositionStore) LoadPosition(name string) ([]byte, error) {
+	return m[name], nil
+}
+
+func (m memPositionStore) SavePosition(name string, position []byte) error {
+	m[name] = position
+	return nil
 }
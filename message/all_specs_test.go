@@ -28,8 +28,11 @@ import (
 func TestAllSpecs(t *testing.T) {
 	r := gospec.NewRunner()
 	r.AddSpec(MessageFieldsSpec)
+	r.AddSpec(MessageChunksSpec)
 	r.AddSpec(MessageEqualsSpec)
 	r.AddSpec(MatcherSpecificationSpec)
+	r.AddSpec(NestedFieldsSpec)
+	r.AddSpec(TypedFieldsSpec)
 	gospec.MainGoTest(r, t)
 }
 
@@ -0,0 +1,152 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package message
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pborman/uuid"
+)
+
+// Fields linking the chunks of a message split up by ChunkMessage.
+const (
+	// The original message's UUID, shared by all of its chunks.
+	CHUNK_ID_FIELD = "ChunkId"
+	// The chunk's position, counting from zero.
+	CHUNK_SEQUENCE_FIELD = "ChunkSequence"
+	// How many chunks the message was split into.
+	CHUNK_TOTAL_FIELD = "ChunkTotal"
+)
+
+// Longest encoding of a payload's tag and length.
+const chunkPayloadOverhead = 1 + 5
+
+// Splits a message whose encoding is larger than maxSize into chunks that
+// aren't, each a copy of the message with its own UUID, a piece of the
+// payload and the chunk fields. The pieces are cut at character boundaries.
+// Returns an error if the message is still too large without its payload.
+func ChunkMessage(msg *Message, maxSize int) ([]*Message, error) {
+	payload := msg.GetPayload()
+	// Measure the message without its payload, with chunk fields at least as
+	// large as the real ones.
+	base := CopyMessage(msg)
+	base.Payload = nil
+	base.SetUuid(uuid.NewRandom())
+	NewStringField(base, CHUNK_ID_FIELD, uuid.NewRandom().String())
+	NewIntField(base, CHUNK_SEQUENCE_FIELD, len(payload), "")
+	NewIntField(base, CHUNK_TOTAL_FIELD, len(payload), "")
+	room := maxSize - proto.Size(base) - chunkPayloadOverhead
+	if room < utf8.UTFMax {
+		return nil, fmt.Errorf("message doesn't fit in %d bytes even without "+
+			"its payload", maxSize)
+	}
+
+	var pieces []string
+	for len(payload) > room {
+		cut := room
+		for cut > 0 && !utf8.RuneStart(payload[cut]) {
+			cut--
+		}
+		pieces = append(pieces, payload[:cut])
+		payload = payload[cut:]
+	}
+	pieces = append(pieces, payload)
+
+	id := msg.GetUuidString()
+	if id == "" {
+		id = uuid.NewRandom().String()
+	}
+	chunks := make([]*Message, len(pieces))
+	for i, piece := range pieces {
+		chunk := CopyMessage(msg)
+		chunk.SetUuid(uuid.NewRandom())
+		chunk.SetPayload(piece)
+		NewStringField(chunk, CHUNK_ID_FIELD, id)
+		NewIntField(chunk, CHUNK_SEQUENCE_FIELD, i, "")
+		NewIntField(chunk, CHUNK_TOTAL_FIELD, len(pieces), "")
+		chunks[i] = chunk
+	}
+	return chunks, nil
+}
+
+// Returns the chunk fields of a message made by ChunkMessage, ok is false if
+// the message isn't a chunk.
+func ChunkInfo(msg *Message) (id string, sequence, total int, ok bool) {
+	v, ok := msg.GetFieldValue(CHUNK_ID_FIELD)
+	if !ok {
+		return
+	}
+	if id, ok = v.(string); !ok {
+		return
+	}
+	var seq, tot int64
+	if v, ok = msg.GetFieldValue(CHUNK_SEQUENCE_FIELD); ok {
+		seq, ok = v.(int64)
+	}
+	if ok {
+		if v, ok = msg.GetFieldValue(CHUNK_TOTAL_FIELD); ok {
+			tot, ok = v.(int64)
+		}
+	}
+	if !ok || tot < 1 || seq < 0 || seq >= tot {
+		return "", 0, 0, false
+	}
+	return id, int(seq), int(tot), true
+}
+
+// Puts a message split by ChunkMessage back together from all of its chunks,
+// in sequence order. The message gets back its original UUID and loses the
+// chunk fields.
+func JoinChunks(chunks []*Message) (*Message, error) {
+	if len(chunks) == 0 {
+		return nil, errors.New("no chunks to join")
+	}
+	id, _, total, ok := ChunkInfo(chunks[0])
+	if !ok {
+		return nil, errors.New("not a chunk")
+	}
+	if total != len(chunks) {
+		return nil, fmt.Errorf("have %d of %d chunks", len(chunks), total)
+	}
+	var payload bytes.Buffer
+	for i, chunk := range chunks {
+		chunkId, seq, _, ok := ChunkInfo(chunk)
+		if !ok || chunkId != id || seq != i {
+			return nil, fmt.Errorf("chunk %d of '%s' is missing or out of order", i, id)
+		}
+		payload.WriteString(chunk.GetPayload())
+	}
+
+	msg := CopyMessage(chunks[0])
+	for _, name := range []string{CHUNK_ID_FIELD, CHUNK_SEQUENCE_FIELD,
+		CHUNK_TOTAL_FIELD} {
+
+		for f := msg.FindFirstField(name); f != nil; f = msg.FindFirstField(name) {
+			msg.DeleteField(f)
+		}
+	}
+	if len(msg.Fields) == 0 {
+		msg.Fields = nil
+	}
+	if u := uuid.Parse(id); u != nil {
+		msg.SetUuid(u)
+	}
+	msg.SetPayload(payload.String())
+	return msg, nil
+}
@@ -0,0 +1,71 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package message
+
+import (
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/rafrombrc/gospec/src/gospec"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func MessageChunksSpec(c gospec.Context) {
+	msg := getTestMessage()
+	msg.SetPayload(strings.Repeat("ab€", 1000))
+
+	c.Specify("A chunked message", func() {
+		chunks, err := ChunkMessage(msg, 1024)
+		c.Assume(err, gs.IsNil)
+
+		c.Specify("has chunks that fit", func() {
+			c.Expect(len(chunks) > 1, gs.IsTrue)
+			for i, chunk := range chunks {
+				c.Expect(proto.Size(chunk) <= 1024, gs.IsTrue)
+				id, seq, total, ok := ChunkInfo(chunk)
+				c.Expect(ok, gs.IsTrue)
+				c.Expect(id, gs.Equals, msg.GetUuidString())
+				c.Expect(seq, gs.Equals, i)
+				c.Expect(total, gs.Equals, len(chunks))
+				c.Expect(chunk.GetUuidString() == id, gs.IsFalse)
+				c.Expect(chunk.GetType(), gs.Equals, msg.GetType())
+			}
+		})
+
+		c.Specify("joins back into the original", func() {
+			joined, err := JoinChunks(chunks)
+			c.Expect(err, gs.IsNil)
+			c.Expect(joined.Equals(msg), gs.IsTrue)
+		})
+
+		c.Specify("won't join with a chunk missing", func() {
+			_, err := JoinChunks(chunks[1:])
+			c.Expect(err, gs.Not(gs.IsNil))
+			_, err = JoinChunks(append([]*Message{chunks[1], chunks[0]}, chunks[2:]...))
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+
+	c.Specify("A message too large without its payload isn't chunked", func() {
+		msg.SetLogger(strings.Repeat("x", 2000))
+		_, err := ChunkMessage(msg, 1024)
+		c.Expect(err, gs.Not(gs.IsNil))
+	})
+
+	c.Specify("A plain message has no chunk info", func() {
+		_, _, _, ok := ChunkInfo(msg)
+		c.Expect(ok, gs.IsFalse)
+	})
+}
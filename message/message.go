@@ -24,7 +24,11 @@ package message
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"reflect"
 
 	"github.com/gogo/protobuf/proto"
@@ -39,6 +43,44 @@ const (
 	UUID_SIZE             = 16
 )
 
+// Version 2 of the stream framing starts each record with FRAME_V2_MAGIC, a
+// record separator followed by a header length of zero, which version 1
+// never produces, and a sequence to resynchronize on after corruption. Then
+// come the header length, header and unit separator as in version 1, and a
+// big endian CRC32C of the header, unit separator included, and message
+// ahead of the message itself.
+const (
+	FRAME_V2_MAGIC_SIZE    = 5
+	FRAME_V2_CHECKSUM_SIZE = 4
+	// Framing bytes of a v2 record besides its header and message.
+	FRAME_V2_FRAMING_SIZE = FRAME_V2_MAGIC_SIZE + 2 + FRAME_V2_CHECKSUM_SIZE
+)
+
+var FRAME_V2_MAGIC = []byte{RECORD_SEPARATOR, 0, 'H', 'K', '2'}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Returns the CRC32C a v2 frame carries for the header and message.
+func FrameV2Checksum(header, msg []byte) uint32 {
+	return crc32.Update(crc32.Checksum(header, castagnoli), castagnoli, msg)
+}
+
+// Splits a complete framed record of either version into its header, with
+// the trailing unit separator as DecodeHeader expects, and its message. ok is
+// false if it's a v2 record whose checksum doesn't match.
+func SplitFramedRecord(record []byte) (header, msg []byte, ok bool) {
+	if !bytes.HasPrefix(record, FRAME_V2_MAGIC) {
+		headerEnd := int(record[1]) + HEADER_FRAMING_SIZE
+		return record[HEADER_DELIMITER_SIZE:headerEnd], record[headerEnd:], true
+	}
+	headerStart := FRAME_V2_MAGIC_SIZE + 1
+	headerEnd := headerStart + int(record[FRAME_V2_MAGIC_SIZE]) + 1
+	msgStart := headerEnd + FRAME_V2_CHECKSUM_SIZE
+	header, msg = record[headerStart:headerEnd], record[msgStart:]
+	checksum := binary.BigEndian.Uint32(record[headerEnd:msgStart])
+	return header, msg, checksum == FrameV2Checksum(header, msg)
+}
+
 var (
 	MAX_MESSAGE_SIZE = uint32(64 * 1024)
 	MAX_RECORD_SIZE  = uint32(HEADER_FRAMING_SIZE + MAX_HEADER_SIZE + MAX_MESSAGE_SIZE)
@@ -50,10 +92,42 @@ func SetMaxMessageSize(size uint32) {
 }
 
 type MessageSigningConfig struct {
-	Name    string `toml:"name"`
-	Hash    string `toml:"hmac_hash"`
-	Key     string `toml:"hmac_key"`
-	Version uint32 `toml:"version"`
+	Name string `toml:"name"`
+	// One of "md5" (the default), "sha1", "sha256", or "ed25519".
+	Hash string `toml:"hmac_hash"`
+	Key  string `toml:"hmac_key"`
+	// Base64 encoded Ed25519 private key (either the 32 byte seed or the full
+	// 64 byte key), used instead of hmac_key when hmac_hash is "ed25519".
+	Ed25519Key string `toml:"ed25519_key"`
+	Version    uint32 `toml:"version"`
+}
+
+// Decodes a base64 encoded Ed25519 private key, accepting either the 32 byte
+// seed or the full 64 byte private key.
+func DecodeEd25519PrivateKey(encoded string) (ed25519.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Ed25519 private key: %s", err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	}
+	return nil, fmt.Errorf("invalid Ed25519 private key: length %d", len(key))
+}
+
+// Decodes a base64 encoded Ed25519 public key.
+func DecodeEd25519PublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Ed25519 public key: %s", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 public key: length %d", len(key))
+	}
+	return ed25519.PublicKey(key), nil
 }
 
 // Decodes provided byte slice into a Heka protocol header object.
@@ -37,7 +37,14 @@ func CreateMatcherSpecification(spec string) (*MatcherSpecification, error) {
 // Match compares the message against the matcher spec and return the match
 // result
 func (m *MatcherSpecification) Match(message *Message) bool {
-	return evalMatcherSpecification(m.vm, message)
+	return evalMatcherSpecification(m.vm, message, "")
+}
+
+// MatchSigned is Match for a message whose signature was verified as the
+// given signer's, which the spec can test as the Signer variable. Signer is
+// empty for unsigned messages.
+func (m *MatcherSpecification) MatchSigned(message *Message, signer string) bool {
+	return evalMatcherSpecification(m.vm, message, signer)
 }
 
 // String outputs the spec as text
@@ -45,15 +52,15 @@ func (m *MatcherSpecification) String() string {
 	return m.spec
 }
 
-func evalMatcherSpecification(t *tree, msg *Message) (b bool) {
+func evalMatcherSpecification(t *tree, msg *Message, signer string) (b bool) {
 	if t == nil {
 		return false
 	}
 
 	if t.left != nil {
-		b = evalMatcherSpecification(t.left, msg)
+		b = evalMatcherSpecification(t.left, msg, signer)
 	} else {
-		return testExpr(msg, t.stmt)
+		return testExpr(msg, signer, t.stmt)
 	}
 	if b == true && t.stmt.op.tokenId == OP_OR {
 		return // short circuit
@@ -63,12 +70,12 @@ func evalMatcherSpecification(t *tree, msg *Message) (b bool) {
 	}
 
 	if t.right != nil {
-		b = evalMatcherSpecification(t.right, msg)
+		b = evalMatcherSpecification(t.right, msg, signer)
 	}
 	return
 }
 
-func getStringValue(msg *Message, stmt *Statement) string {
+func getStringValue(msg *Message, signer string, stmt *Statement) string {
 	switch stmt.field.tokenId {
 	case VAR_UUID:
 		return msg.GetUuidString()
@@ -82,6 +89,8 @@ func getStringValue(msg *Message, stmt *Statement) string {
 		return msg.GetEnvVersion()
 	case VAR_HOSTNAME:
 		return msg.GetHostname()
+	case VAR_SIGNER:
+		return signer
 	}
 	return ""
 }
@@ -172,7 +181,7 @@ func testNonExistence(stmt *Statement) bool {
 	return (stmt.value.tokenId == NIL_VALUE && stmt.op.tokenId == OP_EQ)
 }
 
-func testExpr(msg *Message, stmt *Statement) bool {
+func testExpr(msg *Message, signer string, stmt *Statement) bool {
 	switch stmt.op.tokenId {
 	case TRUE:
 		return true
@@ -181,8 +190,8 @@ func testExpr(msg *Message, stmt *Statement) bool {
 	default:
 		switch stmt.field.tokenId {
 		case VAR_UUID, VAR_TYPE, VAR_LOGGER, VAR_PAYLOAD,
-			VAR_ENVVERSION, VAR_HOSTNAME:
-			return stringTest(getStringValue(msg, stmt), stmt)
+			VAR_ENVVERSION, VAR_HOSTNAME, VAR_SIGNER:
+			return stringTest(getStringValue(msg, signer, stmt), stmt)
 		case VAR_TIMESTAMP, VAR_SEVERITY, VAR_PID:
 			return numericTest(getNumericValue(msg, stmt), stmt)
 		case VAR_FIELDS:
@@ -198,6 +207,9 @@ func testExpr(msg *Message, stmt *Statement) bool {
 				field = fields[fi]
 			} else {
 				if field = msg.FindFirstField(stmt.field.token); field == nil {
+					if ai == 0 && strings.Contains(stmt.field.token, ".") {
+						return pathTest(msg, stmt)
+					}
 					return testNonExistence(stmt)
 				}
 			}
@@ -226,20 +238,48 @@ func testExpr(msg *Message, stmt *Statement) bool {
 				if ai >= len(field.ValueBool) {
 					return testNonExistence(stmt)
 				}
-				if stmt.value.tokenId == NIL_VALUE {
-					if stmt.op.tokenId == OP_EQ {
-						return false
-					}
-					return true
-				}
-				b := field.ValueBool[ai]
-				if stmt.value.tokenId == TRUE {
-					return (b == true)
-				} else {
-					return (b == false)
-				}
+				return boolTest(field.ValueBool[ai], stmt)
 			}
 		}
 	}
 	return false
 }
+
+func boolTest(b bool, stmt *Statement) bool {
+	if stmt.value.tokenId == NIL_VALUE {
+		if stmt.op.tokenId == OP_EQ {
+			return false
+		}
+		return true
+	}
+	if stmt.value.tokenId == TRUE {
+		return (b == true)
+	} else {
+		return (b == false)
+	}
+}
+
+// Tests the value at a dotted path into a nested field, see GetFieldPath.
+// Objects and arrays only exist, they don't compare to anything.
+func pathTest(msg *Message, stmt *Statement) bool {
+	value, ok := msg.GetFieldPath(stmt.field.token)
+	if !ok {
+		return testNonExistence(stmt)
+	}
+	switch v := value.(type) {
+	case string:
+		return stringTest(v, stmt)
+	case float64:
+		return numericTest(v, stmt)
+	case bool:
+		if stmt.value.tokenId == TRUE || stmt.value.tokenId == FALSE ||
+			stmt.value.tokenId == NIL_VALUE {
+			return boolTest(v, stmt)
+		}
+	default:
+		if stmt.value.tokenId == NIL_VALUE {
+			return stmt.op.tokenId == OP_NE
+		}
+	}
+	return false
+}
@@ -15,6 +15,11 @@ const (
 	ENDS_WITH   = 2
 )
 
+// The signer of a verified message isn't part of the message itself, it's
+// passed to MatchSigned. It parses as a string variable and is told apart by
+// its tokenId.
+const VAR_SIGNER = -1
+
 var variables = map[string]int{
 	"Uuid":       VAR_UUID,
 	"Type":       VAR_TYPE,
@@ -25,6 +30,7 @@ var variables = map[string]int{
 	"Timestamp":  VAR_TIMESTAMP,
 	"Severity":   VAR_SEVERITY,
 	"Pid":        VAR_PID,
+	"Signer":     VAR_SIGNER,
 	"Fields":     VAR_FIELDS,
 	"TRUE":       TRUE,
 	"FALSE":      FALSE,
@@ -388,6 +394,9 @@ variable:
 		yylval.token = m.sym
 		m.peekrune = c
 	}
+	if yylval.tokenId == VAR_SIGNER {
+		return VAR_HOSTNAME
+	}
 	return yylval.tokenId
 
 number:
@@ -195,6 +195,26 @@ func MatcherSpecificationSpec(c gospec.Context) {
 				c.Expect(match, gs.IsTrue)
 			}
 		})
+
+		c.Specify("signer matcher tests", func() {
+			ms, err := CreateMatcherSpecification("Signer == 'edge-fleet' && Type == 'TEST'")
+			c.Expect(err, gs.IsNil)
+			c.Expect(ms.MatchSigned(msg, "edge-fleet"), gs.IsTrue)
+			c.Expect(ms.MatchSigned(msg, "other"), gs.IsFalse)
+			c.Expect(ms.Match(msg), gs.IsFalse)
+
+			ms, err = CreateMatcherSpecification("Signer == ''")
+			c.Expect(err, gs.IsNil)
+			c.Expect(ms.Match(msg), gs.IsTrue)
+			c.Expect(ms.MatchSigned(msg, "edge-fleet"), gs.IsFalse)
+
+			ms, err = CreateMatcherSpecification("Signer =~ /^edge-/")
+			c.Expect(err, gs.IsNil)
+			c.Expect(ms.MatchSigned(msg, "edge-fleet"), gs.IsTrue)
+
+			_, err = CreateMatcherSpecification("Signer == 1")
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
 	})
 }
 
@@ -0,0 +1,115 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package message
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Representation of a string field holding a structured value, i.e. maps and
+// arrays of mixed types, encoded as JSON.
+const NESTED_REPRESENTATION = "json"
+
+// Creates a field holding a structured value, such as the decoded JSON
+// objects and arrays that would otherwise have to be flattened into separate
+// fields. The parts of the value can be reached with GetFieldPath and in
+// message matchers as Fields[name.key.0].
+func NewNestedField(name string, value interface{}) (*Field, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return NewField(name, string(encoded), NESTED_REPRESENTATION)
+}
+
+// Convenience function for adding a nested field to a message object.
+func NewNestedFieldOnMessage(m *Message, name string, value interface{}) error {
+	f, err := NewNestedField(name, value)
+	if err != nil {
+		return err
+	}
+	m.AddField(f)
+	return nil
+}
+
+// Tells if the field holds a structured value made by NewNestedField.
+func (f *Field) IsNested() bool {
+	return f.GetRepresentation() == NESTED_REPRESENTATION &&
+		f.GetValueType() == Field_STRING && len(f.ValueString) > 0
+}
+
+// Returns the structured value of a nested field, with objects as
+// map[string]interface{}, arrays as []interface{} and numbers as float64.
+func (f *Field) NestedValue() (value interface{}, err error) {
+	if !f.IsNested() {
+		return nil, errors.New("not a nested field")
+	}
+	err = json.Unmarshal([]byte(f.ValueString[0]), &value)
+	return
+}
+
+// Finds the value at a dotted path, e.g. "user.roles.0", where the first
+// part names a field and the rest select object keys and array indexes
+// within the field's nested value. A field named by the whole path is
+// returned first, so field names containing dots still work. The value is
+// the field's first value for a plain field, or a map[string]interface{},
+// []interface{}, string, float64 or bool from a nested value. ok is false
+// if nothing is at the path.
+func (m *Message) GetFieldPath(path string) (value interface{}, ok bool) {
+	if value, ok = m.GetFieldValue(path); ok {
+		return
+	}
+	// Try the longest field name first.
+	for i := strings.LastIndex(path, "."); i > 0; i = strings.LastIndex(path[:i], ".") {
+		f := m.FindFirstField(path[:i])
+		if f == nil || !f.IsNested() {
+			continue
+		}
+		nested, err := f.NestedValue()
+		if err != nil {
+			return nil, false
+		}
+		return lookupPath(nested, strings.Split(path[i+1:], "."))
+	}
+	return nil, false
+}
+
+func lookupPath(value interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	if value == nil {
+		// JSON null.
+		return nil, false
+	}
+	return value, true
+}
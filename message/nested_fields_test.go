@@ -0,0 +1,99 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package message
+
+import (
+	"github.com/rafrombrc/gospec/src/gospec"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func NestedFieldsSpec(c gospec.Context) {
+	msg := getTestMessage()
+	user := map[string]interface{}{
+		"name":    "ana",
+		"age":     42,
+		"admin":   true,
+		"roles":   []interface{}{"dev", 7, map[string]interface{}{"team": "ops"}},
+		"manager": nil,
+	}
+	err := NewNestedFieldOnMessage(msg, "user", user)
+	c.Assume(err, gs.IsNil)
+	dotted, _ := NewField("user.name", "flat", "")
+
+	c.Specify("A nested field", func() {
+		f := msg.FindFirstField("user")
+
+		c.Specify("keeps its structure", func() {
+			c.Expect(f.IsNested(), gs.IsTrue)
+			value, err := f.NestedValue()
+			c.Expect(err, gs.IsNil)
+			roles := value.(map[string]interface{})["roles"].([]interface{})
+			c.Expect(len(roles), gs.Equals, 3)
+			c.Expect(roles[1], gs.Equals, float64(7))
+		})
+
+		c.Specify("is reached by dotted paths", func() {
+			value, ok := msg.GetFieldPath("user.name")
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(value, gs.Equals, "ana")
+			value, ok = msg.GetFieldPath("user.roles.2.team")
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(value, gs.Equals, "ops")
+			for _, path := range []string{"user.roles.3", "user.email",
+				"user.name.first", "user.manager", "nobody.name"} {
+
+				_, ok = msg.GetFieldPath(path)
+				c.Expect(ok, gs.IsFalse)
+			}
+		})
+
+		c.Specify("is shadowed by a field named by the whole path", func() {
+			msg.AddField(dotted)
+			value, ok := msg.GetFieldPath("user.name")
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(value, gs.Equals, "flat")
+		})
+
+		c.Specify("is matched by dotted paths", func() {
+			matches := []string{
+				"Fields[user.name] == 'ana'",
+				"Fields[user.age] >= 40",
+				"Fields[user.admin] == TRUE",
+				"Fields[user.roles.0] =~ /^d/",
+				"Fields[user.roles.2.team] == 'ops'",
+				"Fields[user.roles] != NIL",
+				"Fields[user.email] == NIL",
+				"Fields[user.manager] == NIL",
+			}
+			for _, v := range matches {
+				ms, err := CreateMatcherSpecification(v)
+				c.Expect(err, gs.IsNil)
+				c.Expect(ms.Match(msg), gs.IsTrue)
+			}
+			misses := []string{
+				"Fields[user.name] == 'bob'",
+				"Fields[user.age] == '42'",
+				"Fields[user.admin] == FALSE",
+				"Fields[user.roles] == 'dev'",
+				"Fields[user.email] != NIL",
+			}
+			for _, v := range misses {
+				ms, err := CreateMatcherSpecification(v)
+				c.Expect(err, gs.IsNil)
+				c.Expect(ms.Match(msg), gs.IsFalse)
+			}
+		})
+	})
+}
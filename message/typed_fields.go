@@ -0,0 +1,126 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package message
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// Representation of an integer field holding nanoseconds since the UNIX
+	// epoch.
+	TIMESTAMP_REPRESENTATION = "timestamp"
+	// Representation of a string field holding an RFC 3339 timestamp.
+	DATE_TIME_REPRESENTATION = "date-time"
+	// Representation of a bytes field whose content type isn't known.
+	DEFAULT_CONTENT_TYPE = "application/octet-stream"
+)
+
+// Duration units accepted as the representation of duration fields.
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// Adds a bytes field whose representation is a MIME content type such as
+// "image/png", defaulting to "application/octet-stream".
+func NewBytesField(m *Message, name string, data []byte, contentType string) {
+	if contentType == "" {
+		contentType = DEFAULT_CONTENT_TYPE
+	}
+	f := NewFieldInit(name, Field_BYTES, contentType)
+	f.AddValue(data)
+	m.AddField(f)
+}
+
+// Returns the first value of a bytes field along with its content type.
+func (m *Message) GetBytesField(name string) (data []byte, contentType string,
+	err error) {
+
+	f := m.FindFirstField(name)
+	if f == nil {
+		return nil, "", fmt.Errorf("no '%s' field", name)
+	}
+	if f.GetValueType() != Field_BYTES || len(f.ValueBytes) == 0 {
+		return nil, "", fmt.Errorf("'%s' field isn't a bytes field", name)
+	}
+	if contentType = f.GetRepresentation(); contentType == "" {
+		contentType = DEFAULT_CONTENT_TYPE
+	}
+	return f.ValueBytes[0], contentType, nil
+}
+
+// Adds an integer field holding the timestamp as nanoseconds since the UNIX
+// epoch.
+func NewTimestampField(m *Message, name string, t time.Time) {
+	f := NewFieldInit(name, Field_INTEGER, TIMESTAMP_REPRESENTATION)
+	f.AddValue(t.UnixNano())
+	m.AddField(f)
+}
+
+// Returns the first value of a timestamp field, either an integer field made
+// by NewTimestampField or a string field with a "date-time" representation.
+// Fields of any other type or representation are an error rather than being
+// guessed at.
+func (m *Message) GetTimestampField(name string) (time.Time, error) {
+	f := m.FindFirstField(name)
+	if f == nil {
+		return time.Time{}, fmt.Errorf("no '%s' field", name)
+	}
+	switch {
+	case f.GetValueType() == Field_INTEGER &&
+		f.GetRepresentation() == TIMESTAMP_REPRESENTATION && len(f.ValueInteger) > 0:
+		return time.Unix(0, f.ValueInteger[0]).UTC(), nil
+	case f.GetValueType() == Field_STRING &&
+		f.GetRepresentation() == DATE_TIME_REPRESENTATION && len(f.ValueString) > 0:
+		t, err := time.Parse(time.RFC3339Nano, f.ValueString[0])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("'%s' field: %s", name, err)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("'%s' field isn't a timestamp", name)
+}
+
+// Adds an integer field holding the duration in nanoseconds.
+func NewDurationField(m *Message, name string, d time.Duration) {
+	f := NewFieldInit(name, Field_INTEGER, "ns")
+	f.AddValue(int64(d))
+	m.AddField(f)
+}
+
+// Returns the first value of a duration field, an integer or double field
+// with a representation of "ns", "us", "ms" or "s". Fields without one of
+// these units are an error.
+func (m *Message) GetDurationField(name string) (time.Duration, error) {
+	f := m.FindFirstField(name)
+	if f == nil {
+		return 0, fmt.Errorf("no '%s' field", name)
+	}
+	unit, ok := durationUnits[f.GetRepresentation()]
+	if !ok {
+		return 0, fmt.Errorf("'%s' field has no duration unit", name)
+	}
+	switch {
+	case f.GetValueType() == Field_INTEGER && len(f.ValueInteger) > 0:
+		return time.Duration(f.ValueInteger[0]) * unit, nil
+	case f.GetValueType() == Field_DOUBLE && len(f.ValueDouble) > 0:
+		return time.Duration(f.ValueDouble[0] * float64(unit)), nil
+	}
+	return 0, fmt.Errorf("'%s' field isn't a duration", name)
+}
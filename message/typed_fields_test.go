@@ -0,0 +1,102 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package message
+
+import (
+	"time"
+
+	"github.com/rafrombrc/gospec/src/gospec"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func TypedFieldsSpec(c gospec.Context) {
+	msg := &Message{}
+
+	c.Specify("A bytes field", func() {
+		c.Specify("keeps its content type", func() {
+			NewBytesField(msg, "thumbnail", []byte{0x89, 'P', 'N', 'G'}, "image/png")
+			data, contentType, err := msg.GetBytesField("thumbnail")
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(data), gs.Equals, "\x89PNG")
+			c.Expect(contentType, gs.Equals, "image/png")
+		})
+
+		c.Specify("defaults to octet-stream", func() {
+			NewBytesField(msg, "blob", []byte("x"), "")
+			_, contentType, err := msg.GetBytesField("blob")
+			c.Expect(err, gs.IsNil)
+			c.Expect(contentType, gs.Equals, "application/octet-stream")
+		})
+
+		c.Specify("isn't read from a string field", func() {
+			NewStringField(msg, "blob", "x")
+			_, _, err := msg.GetBytesField("blob")
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+
+	c.Specify("A timestamp field", func() {
+		now := time.Date(2015, 6, 1, 12, 30, 0, 123456789, time.UTC)
+
+		c.Specify("round trips", func() {
+			NewTimestampField(msg, "received", now)
+			t, err := msg.GetTimestampField("received")
+			c.Expect(err, gs.IsNil)
+			c.Expect(t.Equal(now), gs.IsTrue)
+		})
+
+		c.Specify("is read from date-time strings", func() {
+			f, _ := NewField("received", now.Format(time.RFC3339Nano), "date-time")
+			msg.AddField(f)
+			t, err := msg.GetTimestampField("received")
+			c.Expect(err, gs.IsNil)
+			c.Expect(t.Equal(now), gs.IsTrue)
+		})
+
+		c.Specify("isn't guessed from other fields", func() {
+			NewInt64Field(msg, "count", now.UnixNano(), "count")
+			NewStringField(msg, "when", "yesterday")
+			f, _ := NewField("bad", "June 1st", "date-time")
+			msg.AddField(f)
+			for _, name := range []string{"count", "when", "bad", "missing"} {
+				_, err := msg.GetTimestampField(name)
+				c.Expect(err, gs.Not(gs.IsNil))
+			}
+		})
+	})
+
+	c.Specify("A duration field", func() {
+		c.Specify("round trips", func() {
+			NewDurationField(msg, "elapsed", 1500*time.Millisecond)
+			d, err := msg.GetDurationField("elapsed")
+			c.Expect(err, gs.IsNil)
+			c.Expect(d, gs.Equals, 1500*time.Millisecond)
+		})
+
+		c.Specify("is read in other units", func() {
+			f, _ := NewField("latency", 2.5, "ms")
+			msg.AddField(f)
+			d, err := msg.GetDurationField("latency")
+			c.Expect(err, gs.IsNil)
+			c.Expect(d, gs.Equals, 2500*time.Microsecond)
+		})
+
+		c.Specify("needs a unit", func() {
+			NewInt64Field(msg, "elapsed", 10, "count")
+			_, err := msg.GetDurationField("elapsed")
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -21,6 +21,11 @@ const (
 	ENDS_WITH   = 2
 )
 
+// The signer of a verified message isn't part of the message itself, it's
+// passed to MatchSigned. It parses as a string variable and is told apart by
+// its tokenId.
+const VAR_SIGNER = -1
+
 var variables = map[string]int{
 	"Uuid":       VAR_UUID,
 	"Type":       VAR_TYPE,
@@ -31,6 +36,7 @@ var variables = map[string]int{
 	"Timestamp":  VAR_TIMESTAMP,
 	"Severity":   VAR_SEVERITY,
 	"Pid":        VAR_PID,
+	"Signer":     VAR_SIGNER,
 	"Fields":     VAR_FIELDS,
 	"TRUE":       TRUE,
 	"FALSE":      FALSE,
@@ -74,7 +80,7 @@ func (s *stack) pop() (node *tree) {
 
 var nodes []*tree
 
-//line message_matcher_parser.y:73
+//line message_matcher_parser.y:80
 type yySymType struct {
 	yys        int
 	tokenId    int
@@ -152,7 +158,7 @@ const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line message_matcher_parser.y:191
+//line message_matcher_parser.y:198
 
 type MatcherSpecificationParser struct {
 	spec     string
@@ -352,6 +358,9 @@ variable:
 		yylval.token = m.sym
 		m.peekrune = c
 	}
+	if yylval.tokenId == VAR_SIGNER {
+		return VAR_HOSTNAME
+	}
 	return yylval.tokenId
 
 number:
@@ -925,83 +934,83 @@ yydefault:
 
 	case 22:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line message_matcher_parser.y:124
+//line message_matcher_parser.y:131
 		{
 			//fmt.Println("string_test", $1, $2, $3)
 			nodes = append(nodes, &tree{stmt: &Statement{yyDollar[1], yyDollar[2], yyDollar[3]}})
 		}
 	case 23:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line message_matcher_parser.y:129
+//line message_matcher_parser.y:136
 		{
 			//fmt.Println("string_test regexp", $1, $2, $3)
 			nodes = append(nodes, &tree{stmt: &Statement{yyDollar[1], yyDollar[2], yyDollar[3]}})
 		}
 	case 24:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line message_matcher_parser.y:135
+//line message_matcher_parser.y:142
 		{
 			//fmt.Println("numeric_test", $1, $2, $3)
 			nodes = append(nodes, &tree{stmt: &Statement{yyDollar[1], yyDollar[2], yyDollar[3]}})
 		}
 	case 25:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line message_matcher_parser.y:141
+//line message_matcher_parser.y:148
 		{
 			//fmt.Println("field_test numeric", $1, $2, $3)
 			nodes = append(nodes, &tree{stmt: &Statement{yyDollar[1], yyDollar[2], yyDollar[3]}})
 		}
 	case 26:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line message_matcher_parser.y:146
+//line message_matcher_parser.y:153
 		{
 			//fmt.Println("field_test string", $1, $2, $3)
 			nodes = append(nodes, &tree{stmt: &Statement{yyDollar[1], yyDollar[2], yyDollar[3]}})
 		}
 	case 27:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line message_matcher_parser.y:151
+//line message_matcher_parser.y:158
 		{
 			//fmt.Println("field_test boolean", $1, $2, $3)
 			nodes = append(nodes, &tree{stmt: &Statement{yyDollar[1], yyDollar[2], yyDollar[3]}})
 		}
 	case 28:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line message_matcher_parser.y:156
+//line message_matcher_parser.y:163
 		{
 			//fmt.Println("field_test regexp", $1, $2, $3)
 			nodes = append(nodes, &tree{stmt: &Statement{yyDollar[1], yyDollar[2], yyDollar[3]}})
 		}
 	case 29:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line message_matcher_parser.y:161
+//line message_matcher_parser.y:168
 		{
 			//fmt.Println("field_test existence", $1, $2, $3)
 			nodes = append(nodes, &tree{stmt: &Statement{yyDollar[1], yyDollar[2], yyDollar[3]}})
 		}
 	case 32:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line message_matcher_parser.y:168
+//line message_matcher_parser.y:175
 		{
 			yyVAL = yyDollar[2]
 		}
 	case 33:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line message_matcher_parser.y:172
+//line message_matcher_parser.y:179
 		{
 			//fmt.Println("and", $1, $2, $3)
 			nodes = append(nodes, &tree{stmt: &Statement{op: yyDollar[2]}})
 		}
 	case 34:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line message_matcher_parser.y:177
+//line message_matcher_parser.y:184
 		{
 			//fmt.Println("or", $1, $2, $3)
 			nodes = append(nodes, &tree{stmt: &Statement{op: yyDollar[2]}})
 		}
 	case 38:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line message_matcher_parser.y:185
+//line message_matcher_parser.y:192
 		{
 			//fmt.Println("boolean", $1)
 			nodes = append(nodes, &tree{stmt: &Statement{op: yyDollar[1]}})
@@ -0,0 +1,566 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"heka/message"
+)
+
+// Address the admin API is served on if neither an address nor a socket is
+// configured.
+const DefaultAdminAddress = "127.0.0.1:4353"
+
+// Admin API settings, from the `[hekad.admin]` config section.
+type AdminConfig struct {
+	// TCP address ("host:port") to serve the admin API on over HTTP.
+	// Defaults to DefaultAdminAddress.
+	Address string `toml:"address"`
+	// Path of a Unix socket to serve the admin API on instead, so access can
+	// be restricted with file permissions.
+	Socket string `toml:"socket"`
+	// Wraps the API's handler so that only authenticated clients are
+	// served. Set by hekad from the `auth` settings, and required for
+	// addresses that aren't loopback ones.
+	Authenticate func(http.Handler) http.Handler `toml:"-"`
+}
+
+// Validate checks that the settings are usable, filling in the default
+// address.
+func (c *AdminConfig) Validate() error {
+	if c.Address != "" && c.Socket != "" {
+		return errors.New("only one of address or socket can be set")
+	}
+	if c.Socket != "" {
+		return nil
+	}
+	if c.Address == "" {
+		c.Address = DefaultAdminAddress
+	}
+	host, _, err := net.SplitHostPort(c.Address)
+	if err != nil {
+		return fmt.Errorf("invalid admin address: %s", err)
+	}
+	if !isLoopbackHost(host) && c.Authenticate == nil {
+		return fmt.Errorf("address %s isn't a loopback address, auth must be "+
+			"set to serve the admin API on it", c.Address)
+	}
+	return nil
+}
+
+// Whether host only accepts connections from this machine. An empty host
+// listens on every interface.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Plugin runner states reported by the admin API.
+const (
+	RunnerRunning    = "running"
+	RunnerRetrying   = "retrying"
+	RunnerStopped    = "stopped"
+	RunnerTerminated = "terminated"
+)
+
+// A runner's state, as last set by its own goroutine. Holds a runnerState,
+// which the admin API reads from its own goroutines.
+type runnerStatus struct {
+	value atomic.Value
+}
+
+type runnerState struct {
+	state   string
+	lastErr string
+	since   time.Time
+}
+
+// Records a change of state, along with the error causing it, if any.
+func (s *runnerStatus) set(state string, err error) {
+	current, _ := s.value.Load().(runnerState)
+	if state == current.state && err == nil {
+		return
+	}
+	current.state = state
+	current.since = time.Now()
+	if err != nil {
+		current.lastErr = err.Error()
+	}
+	s.value.Store(current)
+}
+
+// Fills in the entry's state, runners that haven't started yet being
+// reported as running.
+func (s *runnerStatus) fill(entry *adminPlugin) {
+	current, _ := s.value.Load().(runnerState)
+	entry.State = current.state
+	if entry.State == "" {
+		entry.State = RunnerRunning
+	}
+	if !current.since.IsZero() {
+		entry.Since = &current.since
+	}
+	entry.LastError = current.lastErr
+}
+
+// A plugin's entry in the admin API.
+type adminPlugin struct {
+	Pipeline  string                 `json:"pipeline,omitempty"`
+	Name      string                 `json:"name"`
+	Category  string                 `json:"category"`
+	Type      string                 `json:"type,omitempty"`
+	State     string                 `json:"state,omitempty"`
+	Since     *time.Time             `json:"since,omitempty"`
+	LastError string                 `json:"last_error,omitempty"`
+	Config    map[string]interface{} `json:"config,omitempty"`
+	// Set instead of Config if the config can't be decoded any more.
+	ConfigError string                 `json:"config_error,omitempty"`
+	Stats       map[string]interface{} `json:"stats,omitempty"`
+	Buffer      *adminBuffer           `json:"buffer,omitempty"`
+}
+
+// Disk buffer usage of a filter or output.
+type adminBuffer struct {
+	QueueBytes    uint64 `json:"queue_bytes"`
+	MaxBufferSize uint64 `json:"max_buffer_size"`
+	FullAction    string `json:"full_action"`
+}
+
+// Adds the settings of a config struct or PluginConfig to fields, keyed by
+// their TOML names. Secrets aren't redacted yet.
+func addConfigFields(fields map[string]interface{}, config interface{}) {
+	if pc, ok := config.(PluginConfig); ok {
+		for k, v := range pc {
+			var value interface{}
+			if err := toml.PrimitiveDecode(v, &value); err == nil {
+				fields[k] = value
+			}
+		}
+		return
+	}
+	v := reflect.Indirect(reflect.ValueOf(config))
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue // Unexported.
+		}
+		key := strings.Split(sf.Tag.Get("toml"), ",")[0]
+		if key == "-" {
+			continue
+		}
+		if sf.Anonymous && key == "" {
+			addConfigFields(fields, v.Field(i).Interface())
+			continue
+		}
+		if key == "" {
+			key = sf.Name
+		}
+		if value, ok := configValue(v.Field(i)); ok {
+			fields[key] = value
+		}
+	}
+}
+
+// Converts a config setting to a value that marshals to JSON the way it's
+// written in TOML. Returns false for values that can't be configured.
+func configValue(v reflect.Value) (interface{}, bool) {
+	switch v.Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil, false
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, true
+		}
+		return configValue(v.Elem())
+	case reflect.Struct:
+		if _, ok := v.Interface().(encoding.TextMarshaler); ok {
+			return v.Interface(), true
+		}
+		nested := make(map[string]interface{})
+		addConfigFields(nested, v.Interface())
+		return nested, true
+	case reflect.Map:
+		// Tables, such as HTTP headers, so that their secrets can be redacted.
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		nested := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if value, ok := configValue(iter.Value()); ok {
+				nested[iter.Key().String()] = value
+			}
+		}
+		return nested, true
+	case reflect.Slice, reflect.Array:
+		// Arrays of tables, so that their secrets can be redacted.
+		elem := v.Type().Elem()
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct || elem.Implements(textMarshalerType) ||
+			reflect.PtrTo(elem).Implements(textMarshalerType) {
+			break
+		}
+		items := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if item, ok := configValue(v.Index(i)); ok {
+				items = append(items, item)
+			}
+		}
+		return items, true
+	}
+	return v.Interface(), true
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// Returns the plugin's config as decoded now, i.e. after environment
+// variable substitution and with defaults filled in, with its secrets
+// redacted, or nil if there's no maker for it.
+func (pc *PipelineConfig) effectiveConfig(category, name string) (
+	fields map[string]interface{}, typ string, err error) {
+
+	pc.makersLock.RLock()
+	maker, ok := pc.makers[category][name]
+	pc.makersLock.RUnlock()
+	if !ok {
+		return nil, "", nil
+	}
+	fields, err = pc.makerConfig(maker)
+	return fields, maker.Type(), err
+}
+
+// Returns the config a maker decodes for its plugin, including the common
+// config, with its secrets redacted.
+func (pc *PipelineConfig) makerConfig(maker PluginMaker) (map[string]interface{}, error) {
+	config, err := maker.PrepConfig()
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	if mutable, ok := maker.(MutableMaker); ok {
+		if common, e := mutable.OrigPrepCommonTypedConfig(); e == nil && common != nil {
+			addConfigFields(fields, common)
+		}
+	}
+	addConfigFields(fields, config)
+	pc.redactor.redact(fields)
+	return fields, nil
+}
+
+// Builds the admin API entry of a plugin, runner being nil for plugins that
+// don't have their own.
+func (pc *PipelineConfig) adminEntry(category, name string,
+	runner PluginRunner) *adminPlugin {
+
+	entry := &adminPlugin{
+		Pipeline: pc.Globals.Pipeline,
+		Name:     name,
+		Category: category,
+	}
+	config, typ, err := pc.effectiveConfig(category, name)
+	entry.Type = typ
+	if err != nil {
+		entry.ConfigError = err.Error()
+	} else {
+		entry.Config = config
+	}
+	if runner == nil {
+		return entry
+	}
+
+	var status *runnerStatus
+	switch r := runner.(type) {
+	case *iRunner:
+		status = &r.status
+	case *foRunner:
+		status = &r.status
+		if entry.Type == "" {
+			entry.Type = r.pluginType
+		}
+		if r.useBuffering && r.bufReader != nil {
+			entry.Buffer = &adminBuffer{
+				QueueBytes:    r.bufReader.queueSize.Get(),
+				MaxBufferSize: r.bufReader.config.MaxBufferSize,
+				FullAction:    r.bufReader.config.FullAction,
+			}
+		}
+	}
+	if status != nil {
+		status.fill(entry)
+	}
+
+	msg := new(message.Message)
+	if err = PopulateReportMsg(runner, msg); err == nil {
+		entry.Stats = make(map[string]interface{}, len(msg.Fields))
+		for _, f := range msg.Fields {
+			entry.Stats[f.GetName()] = f.GetValue()
+		}
+	}
+	return entry
+}
+
+// Most entries of stopped plugins kept, the oldest being dropped first.
+const maxEndedPlugins = 100
+
+// Keeps the admin API entry of a stoppable plugin's runner that has exited,
+// since it's no longer among the running plugins. Must be called before the
+// runner is unregistered, while its maker is still around.
+func (pc *PipelineConfig) recordEnded(category string, runner PluginRunner) {
+	entry := pc.adminEntry(category, runner.Name(), runner)
+	pc.endedLock.Lock()
+	defer pc.endedLock.Unlock()
+	if pc.ended == nil {
+		pc.ended = make(map[string]*adminPlugin)
+	}
+	if len(pc.ended) >= maxEndedPlugins {
+		var oldest string
+		var oldestSince time.Time
+		for key, e := range pc.ended {
+			if e.Since != nil && (oldest == "" || e.Since.Before(oldestSince)) {
+				oldest, oldestSince = key, *e.Since
+			}
+		}
+		delete(pc.ended, oldest)
+	}
+	pc.ended[category+"/"+entry.Name] = entry
+}
+
+// Returns the entries of the pipeline's plugins, or only those with the
+// given name if it's not empty, sorted by category and name.
+func (pc *PipelineConfig) adminEntries(name string) []*adminPlugin {
+	var entries []*adminPlugin
+	seen := make(map[string]bool)
+	add := func(category, pName string, runner PluginRunner) {
+		key := category + "/" + pName
+		if seen[key] || (name != "" && pName != name) {
+			return
+		}
+		seen[key] = true
+		entries = append(entries, pc.adminEntry(category, pName, runner))
+	}
+
+	pc.inputsLock.RLock()
+	inputs := make(map[string]PluginRunner, len(pc.InputRunners))
+	for n, runner := range pc.InputRunners {
+		inputs[n] = runner
+	}
+	pc.inputsLock.RUnlock()
+	pc.filtersLock.RLock()
+	filters := make(map[string]PluginRunner, len(pc.FilterRunners))
+	for n, runner := range pc.FilterRunners {
+		filters[n] = runner
+	}
+	pc.filtersLock.RUnlock()
+	pc.outputsLock.RLock()
+	outputs := make(map[string]PluginRunner, len(pc.OutputRunners))
+	for n, runner := range pc.OutputRunners {
+		outputs[n] = runner
+	}
+	pc.outputsLock.RUnlock()
+
+	for n, runner := range inputs {
+		add("Input", n, runner)
+	}
+	for n, runner := range filters {
+		add("Filter", n, runner)
+	}
+	for n, runner := range outputs {
+		add("Output", n, runner)
+	}
+
+	pc.endedLock.Lock()
+	for key, entry := range pc.ended {
+		if !seen[key] && (name == "" || entry.Name == name) {
+			seen[key] = true
+			entries = append(entries, entry)
+		}
+	}
+	pc.endedLock.Unlock()
+
+	// Decoders, encoders and splitters are created for the plugins using
+	// them, so they only have a config.
+	pc.makersLock.RLock()
+	var configured [][2]string
+	for category, makers := range pc.makers {
+		for n := range makers {
+			configured = append(configured, [2]string{category, n})
+		}
+	}
+	pc.makersLock.RUnlock()
+	for _, c := range configured {
+		add(c[0], c[1], nil)
+	}
+
+	sort.Sort(adminEntries(entries))
+	return entries
+}
+
+type adminEntries []*adminPlugin
+
+func (e adminEntries) Len() int      { return len(e) }
+func (e adminEntries) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e adminEntries) Less(i, j int) bool {
+	if e[i].Category != e[j].Category {
+		return e[i].Category < e[j].Category
+	}
+	return e[i].Name < e[j].Name
+}
+
+// Serves `GET /plugins`, listing all of the plugins of the pipelines, and
+// `GET /plugins/<name>`, listing only the named one. Either can be limited
+// to one pipeline with a `pipeline` query parameter. `GET /metrics` serves
+// the process's counters and gauges in the Prometheus text format, and
+// `POST /dump` writes a state dump, responding with its path.
+type adminHandler struct {
+	configs []*PipelineConfig
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	if path == "/dump" {
+		h.serveDump(w, req)
+		return
+	}
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if path == "/metrics" {
+		h.serveMetrics(w)
+		return
+	}
+	var name string
+	if strings.HasPrefix(path, "/plugins/") {
+		name = path[len("/plugins/"):]
+	} else if path != "/plugins" {
+		http.NotFound(w, req)
+		return
+	}
+
+	pipeline := req.URL.Query().Get("pipeline")
+	entries := make([]*adminPlugin, 0)
+	for _, config := range h.configs {
+		if pipeline == "" || config.Globals.Pipeline == pipeline {
+			entries = append(entries, config.adminEntries(name)...)
+		}
+	}
+	if name != "" && len(entries) == 0 {
+		http.NotFound(w, req)
+		return
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// Writes a state dump. Writing to disk takes a POST, so with auth configured
+// only clients with the admin role can ask for one.
+func (h *adminHandler) serveDump(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	LogInfo.Println("State dump initiated.")
+	path, err := writeStateDump(h.configs)
+	if err != nil {
+		LogError.Printf("Can't write state dump: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	LogInfo.Printf("State dump written to %s", path)
+	data, _ := json.Marshal(map[string]string{"path": path})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+func (h *adminHandler) serveMetrics(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if len(h.configs) == 0 {
+		return
+	}
+	if counters := h.configs[0].Globals.usedCounters(); counters != nil {
+		counters.WritePrometheus(w)
+	}
+}
+
+// Serves the admin API of RunPipelines' pipelines.
+type adminServer struct {
+	server *http.Server
+	// Address it's listening on.
+	addr string
+}
+
+func startAdmin(config *AdminConfig, configs []*PipelineConfig) (*adminServer, error) {
+	var (
+		listener net.Listener
+		err      error
+	)
+	if config.Socket != "" {
+		// Clear out the socket left behind by a hekad that didn't exit
+		// cleanly, but nothing else.
+		if info, e := os.Lstat(config.Socket); e == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(config.Socket)
+		}
+		listener, err = net.Listen("unix", config.Socket)
+	} else {
+		listener, err = net.Listen("tcp", config.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var handler http.Handler = &adminHandler{configs: configs}
+	if config.Authenticate != nil {
+		handler = config.Authenticate(handler)
+	}
+	admin := &adminServer{
+		server: &http.Server{Handler: handler},
+		addr:   listener.Addr().String(),
+	}
+	go admin.server.Serve(listener)
+	LogInfo.Printf("Admin API listening on %s", listener.Addr())
+	return admin, nil
+}
+
+func (a *adminServer) stop() {
+	a.server.Close()
+}
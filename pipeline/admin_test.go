@@ -0,0 +1,193 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+type adminTestTLS struct {
+	CertFile      string `toml:"cert_file"`
+	KeyPassphrase string `toml:"key_passphrase"`
+}
+
+type adminTestConfig struct {
+	Address  string       `toml:"address"`
+	Password string       `toml:"password"`
+	Timeout  uint         `toml:"timeout"`
+	Tls      adminTestTLS `toml:"tls"`
+}
+
+// Never actually run, the spec only inspects its runner.
+type adminTestOutput struct{}
+
+func (o *adminTestOutput) ConfigStruct() interface{} {
+	return &adminTestConfig{Timeout: 30}
+}
+
+func (o *adminTestOutput) Init(config interface{}) error {
+	return nil
+}
+
+func (o *adminTestOutput) Run(or OutputRunner, h PluginHelper) error {
+	return nil
+}
+
+func AdminSpec(c gs.Context) {
+	RegisterPlugin("AdminTestOutput", func() interface{} {
+		return new(adminTestOutput)
+	})
+
+	c.Specify("An admin config", func() {
+		config := &AdminConfig{Address: "127.0.0.1:4353"}
+		c.Expect(config.Validate(), gs.IsNil)
+		config.Socket = "/var/run/hekad.sock"
+		c.Expect(config.Validate(), gs.Not(gs.IsNil))
+		config.Address = ""
+		c.Expect(config.Validate(), gs.IsNil)
+
+		c.Specify("defaults to a loopback address", func() {
+			config.Socket = ""
+			c.Expect(config.Validate(), gs.IsNil)
+			c.Expect(config.Address, gs.Equals, DefaultAdminAddress)
+		})
+
+		c.Specify("requires auth for other addresses", func() {
+			config.Socket = ""
+			for _, address := range []string{"localhost:4353", "[::1]:4353"} {
+				config.Address = address
+				c.Expect(config.Validate(), gs.IsNil)
+			}
+			for _, address := range []string{":4353", "0.0.0.0:4353",
+				"10.0.0.1:4353", "admin.example.com:4353"} {
+
+				config.Address = address
+				c.Expect(config.Validate(), gs.Not(gs.IsNil))
+			}
+			config.Authenticate = func(h http.Handler) http.Handler { return h }
+			c.Expect(config.Validate(), gs.IsNil)
+		})
+	})
+
+	c.Specify("An admin server only serves the clients auth lets through", func() {
+		config := &AdminConfig{
+			Address: "127.0.0.1:0",
+			Authenticate: func(h http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					http.Error(w, "authentication required", http.StatusUnauthorized)
+				})
+			},
+		}
+		admin, err := startAdmin(config, nil)
+		c.Assume(err, gs.IsNil)
+		defer admin.stop()
+		resp, err := http.Get("http://" + admin.addr + "/plugins")
+		c.Assume(err, gs.IsNil)
+		resp.Body.Close()
+		c.Expect(resp.StatusCode, gs.Equals, http.StatusUnauthorized)
+	})
+
+	c.Specify("The admin API", func() {
+		os.Setenv("ADMIN_TEST_ADDRESS", "10.0.0.1:5565")
+		defer os.Unsetenv("ADMIN_TEST_ADDRESS")
+		pConfig := NewPipelineConfig(nil)
+		err := pConfig.PreloadFromConfigFile(filepath.Join(".", "testsupport",
+			"admin_config.toml"))
+		c.Assume(err, gs.IsNil)
+		c.Assume(pConfig.LoadConfig(), gs.IsNil)
+		handler := &adminHandler{configs: []*PipelineConfig{pConfig}}
+
+		get := func(path string) (code int, entries []*adminPlugin) {
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			handler.ServeHTTP(recorder, req)
+			if recorder.Code == http.StatusOK {
+				err := json.Unmarshal(recorder.Body.Bytes(), &entries)
+				c.Assume(err, gs.IsNil)
+			}
+			return recorder.Code, entries
+		}
+
+		c.Specify("reports the effective config", func() {
+			code, entries := get("/plugins/AdminOutput")
+			c.Assume(code, gs.Equals, http.StatusOK)
+			c.Assume(len(entries), gs.Equals, 1)
+			entry := entries[0]
+			c.Expect(entry.Category, gs.Equals, "Output")
+			c.Expect(entry.Type, gs.Equals, "AdminTestOutput")
+			c.Expect(entry.State, gs.Equals, RunnerRunning)
+			config := entry.Config
+			c.Expect(config["address"], gs.Equals, "10.0.0.1:5565")
+			c.Expect(config["timeout"], gs.Equals, float64(30))
+			c.Expect(config["message_matcher"], gs.Equals, "TRUE")
+			c.Expect(config["password"], gs.Equals, "<redacted>")
+			tls := config["tls"].(map[string]interface{})
+			c.Expect(tls["key_passphrase"], gs.Equals, "<redacted>")
+			c.Expect(tls["cert_file"], gs.Equals, "")
+			_, ok := entry.Stats["InChanCapacity"]
+			c.Expect(ok, gs.IsTrue)
+		})
+
+		c.Specify("lists every plugin", func() {
+			code, entries := get("/plugins")
+			c.Assume(code, gs.Equals, http.StatusOK)
+			var found bool
+			for _, entry := range entries {
+				if entry.Name == "AdminOutput" {
+					found = true
+				}
+			}
+			c.Expect(found, gs.IsTrue)
+			code, _ = get("/plugins/NoSuchOutput")
+			c.Expect(code, gs.Equals, http.StatusNotFound)
+		})
+
+		c.Specify("keeps reporting plugins that have exited", func() {
+			runner := pConfig.OutputRunners["AdminOutput"].(*foRunner)
+			runner.status.set(RunnerRetrying, errors.New("connection refused"))
+			_, entries := get("/plugins/AdminOutput")
+			c.Expect(entries[0].State, gs.Equals, RunnerRetrying)
+			c.Expect(entries[0].LastError, gs.Equals, "connection refused")
+
+			runner.status.set(RunnerTerminated, errors.New("out of retries"))
+			pConfig.recordEnded("Output", runner)
+			delete(pConfig.OutputRunners, "AdminOutput")
+			_, entries = get("/plugins/AdminOutput")
+			c.Assume(len(entries), gs.Equals, 1)
+			c.Expect(entries[0].State, gs.Equals, RunnerTerminated)
+			c.Expect(entries[0].LastError, gs.Equals, "out of retries")
+			c.Expect(entries[0].Config["address"], gs.Equals, "10.0.0.1:5565")
+		})
+
+		c.Specify("serves the counters as Prometheus metrics", func() {
+			pConfig.Counters().Add("requests", 3)
+			pConfig.Counters().Set("queue_depth", 1.5)
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/metrics", nil)
+			handler.ServeHTTP(recorder, req)
+			c.Expect(recorder.Code, gs.Equals, http.StatusOK)
+			c.Expect(recorder.Body.String(), gs.Equals,
+				"# TYPE heka_queue_depth gauge\nheka_queue_depth 1.5\n"+
+					"# TYPE heka_requests counter\nheka_requests 3\n")
+		})
+	})
+}
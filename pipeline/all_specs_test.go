@@ -37,17 +37,58 @@ func TestAllSpecs(t *testing.T) {
 	r := gospec.NewRunner()
 	r.Parallel = false
 
+	r.AddSpec(AdminSpec)
+	r.AddSpec(ArchiveIndexSpec)
+	r.AddSpec(CheckpointerSpec)
+	r.AddSpec(CircuitBreakerSpec)
+	r.AddSpec(ConfigWatchSpec)
+	r.AddSpec(ConnFieldsSpec)
+	r.AddSpec(ConnLimitSpec)
+	r.AddSpec(ContentTypeSpec)
+	r.AddSpec(CountersSpec)
+	r.AddSpec(ClockSkewSpec)
+	r.AddSpec(ClusterSpec)
+	r.AddSpec(DecodeFailureSpec)
+	r.AddSpec(DeprecationSpec)
+	r.AddSpec(DialerSpec)
+	r.AddSpec(DiscoverySpec)
+	r.AddSpec(DrainSpec)
+	r.AddSpec(EncoderChainSpec)
+	r.AddSpec(FilterInstancesSpec)
+	r.AddSpec(FipsSpec)
+	r.AddSpec(GossipSpec)
+	r.AddSpec(HarnessSpec)
 	r.AddSpec(HekaFramingSpec)
+	r.AddSpec(HostMetadataSpec)
 	r.AddSpec(InputRunnerSpec)
+	r.AddSpec(KVCacheSpec)
+	r.AddSpec(LatencySpec)
+	r.AddSpec(MatchRunnerSpec)
+	r.AddSpec(MessageLoopsSpec)
+	r.AddSpec(MessageSizeSpec)
 	r.AddSpec(MessageTemplateSpec)
 	r.AddSpec(OutputRunnerSpec)
+	r.AddSpec(PackLeakSpec)
+	r.AddSpec(PackMetadataSpec)
+	r.AddSpec(PackStarvationSpec)
+	r.AddSpec(PluginMakerSpec)
+	r.AddSpec(ProcessorChainSpec)
 	r.AddSpec(ProtobufDecoderSpec)
+	r.AddSpec(QuarantineSpec)
 	r.AddSpec(QueueBufferSpec)
 	r.AddSpec(PatternGroupingSpec)
+	r.AddSpec(RateLimitSpec)
+	r.AddSpec(RedactSpec)
 	r.AddSpec(RegexSpec)
 	r.AddSpec(ReportSpec)
+	r.AddSpec(ShadowSpec)
+	r.AddSpec(SocketSpec)
 	r.AddSpec(SplitterRunnerSpec)
 	r.AddSpec(StatAccumInputSpec)
+	r.AddSpec(StateDumpSpec)
+	r.AddSpec(SystemdSpec)
+	r.AddSpec(TenancySpec)
+	r.AddSpec(TimePartitionSpec)
 	r.AddSpec(TokenSpec)
 
 	gospec.MainGoTest(r, t)
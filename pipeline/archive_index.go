@@ -0,0 +1,150 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Suffix of the index sidecar written alongside each archive of framed
+// records.
+const ARCHIVE_INDEX_SUFFIX = ".idx"
+
+// First line of an archive index, naming its columns.
+const ARCHIVE_INDEX_HEADER = "# offset\tend\trecords\tmin_timestamp\tmax_timestamp"
+
+// A run of consecutive records of an archive, as listed in its index: the
+// byte offsets of the first record and just past the last, and the earliest
+// and latest of the records' timestamps, in nanoseconds.
+type ArchiveBlock struct {
+	Offset  int64
+	End     int64
+	Records int
+	MinTime int64
+	MaxTime int64
+}
+
+// Returns the block's index line, without the newline.
+func (b ArchiveBlock) String() string {
+	return fmt.Sprintf("%d\t%d\t%d\t%d\t%d", b.Offset, b.End, b.Records, b.MinTime,
+		b.MaxTime)
+}
+
+// Groups the records of an archive being written into index blocks.
+type ArchiveIndexer struct {
+	every int
+	block ArchiveBlock
+}
+
+// Creates an indexer for records written from the given offset, with every
+// records in each block.
+func NewArchiveIndexer(offset int64, every int) *ArchiveIndexer {
+	return &ArchiveIndexer{
+		every: every,
+		block: ArchiveBlock{Offset: offset, End: offset},
+	}
+}
+
+// Records that a record of the given size and timestamp has been written
+// after the previous one. Returns the block it completes, if it does.
+func (ai *ArchiveIndexer) Add(size int, timestamp int64) (ArchiveBlock, bool) {
+	b := &ai.block
+	if b.Records == 0 || timestamp < b.MinTime {
+		b.MinTime = timestamp
+	}
+	if b.Records == 0 || timestamp > b.MaxTime {
+		b.MaxTime = timestamp
+	}
+	b.Records++
+	b.End += int64(size)
+	if b.Records < ai.every {
+		return ArchiveBlock{}, false
+	}
+	return ai.Pending()
+}
+
+// Returns the records written since the last completed block as a block of
+// their own, if there are any, and starts a new one.
+func (ai *ArchiveIndexer) Pending() (ArchiveBlock, bool) {
+	block := ai.block
+	ai.block = ArchiveBlock{Offset: block.End, End: block.End}
+	return block, block.Records > 0
+}
+
+// Reads the index of the archive at the given path. A partly written last
+// line is ignored, the archive's writer not having got to it yet.
+func ReadArchiveIndex(archivePath string) ([]ArchiveBlock, error) {
+	file, err := os.Open(archivePath + ARCHIVE_INDEX_SUFFIX)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var blocks []ArchiveBlock
+	r := bufio.NewReader(file)
+	for lineNum := 1; ; lineNum++ {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return blocks, nil
+		} else if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var b ArchiveBlock
+		if _, err = fmt.Sscanf(line, "%d\t%d\t%d\t%d\t%d", &b.Offset, &b.End,
+			&b.Records, &b.MinTime, &b.MaxTime); err != nil {
+
+			return nil, fmt.Errorf("%s%s line %d: %s", archivePath, ARCHIVE_INDEX_SUFFIX,
+				lineNum, err)
+		}
+		blocks = append(blocks, b)
+	}
+}
+
+// Returns the byte range of an archive of the given size that holds all of
+// its records with timestamps from `from` to `until`, inclusive, a zero for
+// either meaning no limit. Records past the last indexed block, written since
+// the index was last updated, are always included. Records in the range may
+// still fall outside the times, an archive's records not being in timestamp
+// order.
+func ArchiveSeekRange(blocks []ArchiveBlock, size, from, until int64) (start, end int64) {
+	if len(blocks) == 0 {
+		return 0, size
+	}
+	indexed := blocks[len(blocks)-1].End
+	start = indexed
+	for _, b := range blocks {
+		if from == 0 || b.MaxTime >= from {
+			start = b.Offset
+			break
+		}
+	}
+	if until == 0 || size > indexed {
+		return start, size
+	}
+	end = start
+	for _, b := range blocks {
+		if b.MinTime <= until && b.End > end {
+			end = b.End
+		}
+	}
+	return start, end
+}
@@ -0,0 +1,105 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func ArchiveIndexSpec(c gs.Context) {
+	c.Specify("An ArchiveIndexer", func() {
+		ai := NewArchiveIndexer(100, 3)
+
+		c.Specify("completes a block every n records", func() {
+			_, done := ai.Add(10, 50)
+			c.Expect(done, gs.IsFalse)
+			ai.Add(20, 30)
+			block, done := ai.Add(30, 40)
+			c.Assume(done, gs.IsTrue)
+			c.Expect(block, gs.Equals, ArchiveBlock{Offset: 100, End: 160,
+				Records: 3, MinTime: 30, MaxTime: 50})
+
+			ai.Add(5, 60)
+			block, done = ai.Pending()
+			c.Assume(done, gs.IsTrue)
+			c.Expect(block, gs.Equals, ArchiveBlock{Offset: 160, End: 165,
+				Records: 1, MinTime: 60, MaxTime: 60})
+			_, done = ai.Pending()
+			c.Expect(done, gs.IsFalse)
+		})
+	})
+
+	c.Specify("An archive index", func() {
+		tmpDir, err := ioutil.TempDir("", "archive-index-tests")
+		c.Assume(err, gs.IsNil)
+		defer os.RemoveAll(tmpDir)
+		archive := filepath.Join(tmpDir, "archive.pb")
+		blocks := []ArchiveBlock{
+			{Offset: 0, End: 100, Records: 10, MinTime: 1000, MaxTime: 1900},
+			{Offset: 100, End: 200, Records: 10, MinTime: 1800, MaxTime: 2900},
+			{Offset: 200, End: 300, Records: 10, MinTime: 3000, MaxTime: 3900},
+		}
+
+		c.Specify("is read back, skipping a partial last line", func() {
+			content := ARCHIVE_INDEX_HEADER + "\n"
+			for _, b := range blocks {
+				content += b.String() + "\n"
+			}
+			content += "300\t4"
+			err := ioutil.WriteFile(archive+ARCHIVE_INDEX_SUFFIX, []byte(content), 0644)
+			c.Assume(err, gs.IsNil)
+			read, err := ReadArchiveIndex(archive)
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(read), gs.Equals, 3)
+			c.Expect(read[2], gs.Equals, blocks[2])
+		})
+
+		c.Specify("rejects a malformed line", func() {
+			err := ioutil.WriteFile(archive+ARCHIVE_INDEX_SUFFIX, []byte("0\tx\n"), 0644)
+			c.Assume(err, gs.IsNil)
+			_, err = ReadArchiveIndex(archive)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("narrows a time range to the blocks that can hold it", func() {
+			start, end := ArchiveSeekRange(blocks, 300, 2000, 2500)
+			c.Expect(start, gs.Equals, int64(100))
+			c.Expect(end, gs.Equals, int64(200))
+			// Blocks can overlap in time.
+			start, end = ArchiveSeekRange(blocks, 300, 1850, 1850)
+			c.Expect(start, gs.Equals, int64(0))
+			c.Expect(end, gs.Equals, int64(200))
+			start, end = ArchiveSeekRange(blocks, 300, 0, 0)
+			c.Expect(start, gs.Equals, int64(0))
+			c.Expect(end, gs.Equals, int64(300))
+		})
+
+		c.Specify("includes records past the last indexed block", func() {
+			start, end := ArchiveSeekRange(blocks, 350, 5000, 6000)
+			c.Expect(start, gs.Equals, int64(300))
+			c.Expect(end, gs.Equals, int64(350))
+			start, end = ArchiveSeekRange(blocks, 350, 2000, 2500)
+			c.Expect(start, gs.Equals, int64(100))
+			c.Expect(end, gs.Equals, int64(350))
+			start, end = ArchiveSeekRange(nil, 350, 2000, 2500)
+			c.Expect(start, gs.Equals, int64(0))
+			c.Expect(end, gs.Equals, int64(350))
+		})
+	})
+}
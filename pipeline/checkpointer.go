@@ -0,0 +1,519 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checkpoint storage settings, from the `[hekad.checkpoints]` config section.
+type CheckpointConfig struct {
+	// Where checkpoints are kept, "file" for files under base_dir, or
+	// "consul", "etcd", "redis" or "s3" for an external store. Defaults to
+	// "file".
+	Backend string `toml:"backend"`
+	// Base URL of the KV store's HTTP API, e.g. "http://127.0.0.1:8500",
+	// the redis server's "host:port", or for s3 the endpoint URL, defaulting
+	// to AWS's for the region.
+	Address string `toml:"address"`
+	// Prefix of the checkpoint keys in the external store. Defaults to
+	// "heka/checkpoints/<hostname>/".
+	KeyPrefix string `toml:"key_prefix"`
+	// Password sent to the redis server, if it requires one.
+	Password string `toml:"password"`
+	// Redis database number. Defaults to 0.
+	Database int `toml:"database"`
+	// S3 bucket the checkpoints are kept in.
+	Bucket string `toml:"bucket"`
+	// AWS region of the bucket. Defaults to "us-east-1".
+	Region string `toml:"region"`
+	// AWS credentials. Default to the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY environment variables.
+	AccessKeyId     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+}
+
+// Validate checks that the settings name a supported backend.
+func (c *CheckpointConfig) Validate() error {
+	switch c.Backend {
+	case "", "file":
+		return nil
+	case "s3":
+		if c.Bucket == "" {
+			return errors.New("checkpoint bucket must be set")
+		}
+		return nil
+	case "consul", "etcd", "redis":
+	default:
+		return fmt.Errorf("unsupported checkpoint backend '%s'", c.Backend)
+	}
+	if c.Address == "" {
+		return errors.New("checkpoint address must be set")
+	}
+	return nil
+}
+
+// Checkpointer stores the positions inputs have reached, e.g. file offsets,
+// Kafka offsets or polling cursors, so they can carry on from there after a
+// restart. Keys are slash separated paths, conventionally starting with the
+// plugin type, e.g. "kafka/<input name>".
+type Checkpointer interface {
+	// Get returns the checkpoint stored under the key, or nil if there's
+	// none.
+	Get(key string) ([]byte, error)
+	// Set stores the checkpoint under the key, replacing any that's there.
+	Set(key string, value []byte) error
+	// CompareAndSet stores the checkpoint only if the one stored under the
+	// key is still old, or if old is nil only if there's none, returning
+	// true if it was stored.
+	CompareAndSet(key string, old, value []byte) (bool, error)
+	// Delete removes the checkpoint stored under the key, if there is one.
+	Delete(key string) error
+	// List returns the keys of all the stored checkpoints, sorted.
+	List() ([]string, error)
+}
+
+// NewCheckpointer returns a Checkpointer using the configured backend, or
+// files under base_dir if conf is nil.
+func NewCheckpointer(conf *CheckpointConfig, globals *GlobalConfigStruct) (
+	Checkpointer, error) {
+
+	if conf == nil {
+		conf = &CheckpointConfig{}
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	if conf.Backend == "" || conf.Backend == "file" {
+		return &fileCheckpointer{globals: globals}, nil
+	}
+	prefix := conf.KeyPrefix
+	if prefix == "" {
+		prefix = fmt.Sprintf("heka/checkpoints/%s/", globals.Hostname)
+	}
+	if globals.Pipeline != "" {
+		prefix += globals.Pipeline + "/"
+	}
+	switch conf.Backend {
+	case "redis":
+		return newRedisCheckpointer(conf, prefix), nil
+	case "s3":
+		return newS3Checkpointer(conf, prefix), nil
+	}
+	api := &httpJSONClient{
+		address: strings.TrimRight(conf.Address, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	if conf.Backend == "consul" {
+		return &consulCheckpointer{api: api, prefix: prefix}, nil
+	}
+	return &etcdCheckpointer{api: api, prefix: prefix}, nil
+}
+
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return fmt.Errorf("bad checkpoint key '%s'", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("bad checkpoint key '%s'", key)
+		}
+	}
+	return nil
+}
+
+// Keeps each checkpoint in its own file under base_dir/checkpoints, replaced
+// atomically on each update.
+type fileCheckpointer struct {
+	// The base_dir is looked up on each use, it may change before the
+	// pipeline starts.
+	globals *GlobalConfigStruct
+	// Serializes updates, so compare and set is atomic within this process.
+	lock sync.Mutex
+}
+
+func (f *fileCheckpointer) root() string {
+	return f.globals.PrependBaseDir("checkpoints")
+}
+
+func (f *fileCheckpointer) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.root(), filepath.FromSlash(key)), nil
+}
+
+func (f *fileCheckpointer) read(path string) ([]byte, error) {
+	value, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (f *fileCheckpointer) write(path string, value []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, value, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (f *fileCheckpointer) Get(key string) ([]byte, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return f.read(path)
+}
+
+func (f *fileCheckpointer) Set(key string, value []byte) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.write(path, value)
+}
+
+func (f *fileCheckpointer) CompareAndSet(key string, old, value []byte) (bool, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return false, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	current, err := f.read(path)
+	if err != nil {
+		return false, err
+	}
+	if (current == nil) != (old == nil) || !bytes.Equal(current, old) {
+		return false, nil
+	}
+	return true, f.write(path, value)
+}
+
+func (f *fileCheckpointer) Delete(key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err = os.Remove(path); os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (f *fileCheckpointer) List() ([]string, error) {
+	root := f.root()
+	var keys []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			return err
+		}
+		// Skipping any temporary files left by a crash mid update.
+		if info.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+// Keeps checkpoints in consul's KV store, using its check-and-set indexes,
+// see https://www.consul.io/api/kv.html.
+type consulCheckpointer struct {
+	api    *httpJSONClient
+	prefix string
+}
+
+type consulKeyValue struct {
+	Value       []byte
+	ModifyIndex uint64
+}
+
+// Returns the stored entry, or nil if there's none.
+func (c *consulCheckpointer) get(key string) (*consulKeyValue, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	var entries []consulKeyValue
+	status, err := c.api.call("GET", "/v1/kv/"+c.prefix+key, nil, &entries)
+	if status == http.StatusNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+func (c *consulCheckpointer) put(key string, value []byte, query string) (bool, error) {
+	var stored bool
+	_, err := c.api.call("PUT", "/v1/kv/"+c.prefix+key+query, string(value), &stored)
+	return stored, err
+}
+
+func (c *consulCheckpointer) Get(key string) ([]byte, error) {
+	entry, err := c.get(key)
+	if entry == nil || err != nil {
+		return nil, err
+	}
+	if entry.Value == nil {
+		// Stored empty.
+		return []byte{}, nil
+	}
+	return entry.Value, nil
+}
+
+func (c *consulCheckpointer) Set(key string, value []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := c.put(key, value, "")
+	return err
+}
+
+func (c *consulCheckpointer) CompareAndSet(key string, old, value []byte) (bool, error) {
+	entry, err := c.get(key)
+	if err != nil {
+		return false, err
+	}
+	// An index of 0 only stores the value if there's no entry.
+	var index uint64
+	if entry != nil {
+		if old == nil || !bytes.Equal(entry.Value, old) {
+			return false, nil
+		}
+		index = entry.ModifyIndex
+	} else if old != nil {
+		return false, nil
+	}
+	return c.put(key, value, "?cas="+strconv.FormatUint(index, 10))
+}
+
+func (c *consulCheckpointer) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := c.api.call("DELETE", "/v1/kv/"+c.prefix+key, nil, nil)
+	return err
+}
+
+func (c *consulCheckpointer) List() ([]string, error) {
+	var keys []string
+	status, err := c.api.call("GET", "/v1/kv/"+c.prefix+"?keys", nil, &keys)
+	if status == http.StatusNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, c.prefix)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Keeps checkpoints in etcd, through its v3 JSON gateway, using transactions
+// for compare and set.
+type etcdCheckpointer struct {
+	api    *httpJSONClient
+	prefix string
+}
+
+func (e *etcdCheckpointer) Get(key string) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	req := map[string]string{"key": etcdEncode(e.prefix + key)}
+	var resp struct {
+		Kvs []struct{ Value string }
+	}
+	if _, err := e.api.call("POST", "/v3/kv/range", req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(resp.Kvs[0].Value)
+}
+
+func (e *etcdCheckpointer) Set(key string, value []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req := map[string]string{
+		"key":   etcdEncode(e.prefix + key),
+		"value": base64.StdEncoding.EncodeToString(value),
+	}
+	_, err := e.api.call("POST", "/v3/kv/put", req, nil)
+	return err
+}
+
+func (e *etcdCheckpointer) CompareAndSet(key string, old, value []byte) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	fullKey := etcdEncode(e.prefix + key)
+	compare := map[string]string{"key": fullKey}
+	if old == nil {
+		compare["target"] = "CREATE"
+		compare["create_revision"] = "0"
+	} else {
+		compare["target"] = "VALUE"
+		compare["value"] = base64.StdEncoding.EncodeToString(old)
+	}
+	req := map[string]interface{}{
+		"compare": []map[string]string{compare},
+		"success": []map[string]interface{}{{
+			"request_put": map[string]string{
+				"key":   fullKey,
+				"value": base64.StdEncoding.EncodeToString(value),
+			},
+		}},
+	}
+	var resp struct{ Succeeded bool }
+	if _, err := e.api.call("POST", "/v3/kv/txn", req, &resp); err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+func (e *etcdCheckpointer) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req := map[string]string{"key": etcdEncode(e.prefix + key)}
+	_, err := e.api.call("POST", "/v3/kv/deleterange", req, nil)
+	return err
+}
+
+func (e *etcdCheckpointer) List() ([]string, error) {
+	// The range covers every key starting with the prefix.
+	end := []byte(e.prefix)
+	end[len(end)-1]++
+	req := map[string]interface{}{
+		"key":       etcdEncode(e.prefix),
+		"range_end": base64.StdEncoding.EncodeToString(end),
+		"keys_only": true,
+	}
+	var resp struct {
+		Kvs []struct{ Key string }
+	}
+	if _, err := e.api.call("POST", "/v3/kv/range", req, &resp); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, strings.TrimPrefix(string(key), e.prefix))
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// BackupCheckpoints writes every stored checkpoint to w, as a JSON object
+// mapping each key to its base64 encoded checkpoint.
+func BackupCheckpoints(cp Checkpointer, w io.Writer) error {
+	keys, err := cp.List()
+	if err != nil {
+		return err
+	}
+	backup := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		value, err := cp.Get(key)
+		if err != nil {
+			return fmt.Errorf("reading '%s': %s", key, err)
+		}
+		if value != nil {
+			backup[key] = value
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(backup)
+}
+
+// RestoreCheckpoints stores the checkpoints written by BackupCheckpoints,
+// replacing those already stored under the same keys. Returns how many were
+// restored.
+func RestoreCheckpoints(cp Checkpointer, r io.Reader) (int, error) {
+	var backup map[string][]byte
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return 0, fmt.Errorf("can't decode checkpoint backup: %s", err)
+	}
+	keys := make([]string, 0, len(backup))
+	for key := range backup {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		if err := cp.Set(key, backup[key]); err != nil {
+			return i, fmt.Errorf("restoring '%s': %s", key, err)
+		}
+	}
+	return len(keys), nil
+}
+
+// MigrateCheckpointFile moves the checkpoint an input used to keep in its
+// own file at path into cp under key, unless cp already holds one. The file
+// is removed once its content is stored.
+func MigrateCheckpointFile(cp Checkpointer, key, path string) error {
+	value, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err = cp.CompareAndSet(key, nil, value); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
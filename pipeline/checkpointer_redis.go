@@ -0,0 +1,257 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sets KEYS[1] to ARGV[3] if it's unset and ARGV[1] is "0", or if it's set to
+// ARGV[2] and ARGV[1] is "1".
+const redisCompareAndSet = `local v = redis.call('GET', KEYS[1])
+if (ARGV[1] == '0' and v == false) or (ARGV[1] == '1' and v == ARGV[2]) then
+  redis.call('SET', KEYS[1], ARGV[3])
+  return 1
+end
+return 0`
+
+// Keeps checkpoints in redis, over a single connection that's reopened
+// whenever a command fails.
+type redisCheckpointer struct {
+	address  string
+	password string
+	database int
+	prefix   string
+	timeout  time.Duration
+	// Protects the connection, one command is sent at a time.
+	lock sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newRedisCheckpointer(conf *CheckpointConfig, prefix string) *redisCheckpointer {
+	return &redisCheckpointer{
+		address:  conf.Address,
+		password: conf.Password,
+		database: conf.Database,
+		prefix:   prefix,
+		timeout:  10 * time.Second,
+	}
+}
+
+// An error reply from the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (r *redisCheckpointer) connect() error {
+	conn, err := net.DialTimeout("tcp", r.address, r.timeout)
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	r.r = bufio.NewReader(conn)
+	if r.password != "" {
+		if _, err = r.send("AUTH", r.password); err != nil {
+			return err
+		}
+	}
+	if r.database != 0 {
+		if _, err = r.send("SELECT", strconv.Itoa(r.database)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs a command, connecting first if need be. Replies are returned as nil,
+// int64, string (for status replies), []byte or []interface{}.
+func (r *redisCheckpointer) do(args ...string) (interface{}, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			r.close()
+			return nil, err
+		}
+	}
+	reply, err := r.send(args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		// The connection's state is unknown, start over with a new one.
+		r.close()
+	}
+	return reply, err
+}
+
+func (r *redisCheckpointer) close() {
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+}
+
+func (r *redisCheckpointer) send(args ...string) (interface{}, error) {
+	r.conn.SetDeadline(time.Now().Add(r.timeout))
+	cmd := make([]byte, 0, 64)
+	cmd = append(cmd, fmt.Sprintf("*%d\r\n", len(args))...)
+	for _, arg := range args {
+		cmd = append(cmd, fmt.Sprintf("$%d\r\n", len(arg))...)
+		cmd = append(cmd, arg...)
+		cmd = append(cmd, "\r\n"...)
+	}
+	if _, err := r.conn.Write(cmd); err != nil {
+		return nil, err
+	}
+	return readRedisReply(r.r)
+}
+
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("bad redis reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			if replies[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	}
+	return nil, fmt.Errorf("bad redis reply %q", line)
+}
+
+func (r *redisCheckpointer) Get(key string) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	reply, err := r.do("GET", r.prefix+key)
+	if reply == nil || err != nil {
+		return nil, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected redis reply %v", reply)
+	}
+	return value, nil
+}
+
+func (r *redisCheckpointer) Set(key string, value []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := r.do("SET", r.prefix+key, string(value))
+	return err
+}
+
+func (r *redisCheckpointer) CompareAndSet(key string, old, value []byte) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	exists := "1"
+	if old == nil {
+		exists = "0"
+	}
+	reply, err := r.do("EVAL", redisCompareAndSet, "1", r.prefix+key, exists,
+		string(old), string(value))
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+func (r *redisCheckpointer) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := r.do("DEL", r.prefix+key)
+	return err
+}
+
+// Escapes the glob characters in a SCAN pattern.
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`,
+	`[`, `\[`, `]`, `\]`)
+
+func (r *redisCheckpointer) List() ([]string, error) {
+	pattern := redisGlobEscaper.Replace(r.prefix) + "*"
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := r.do("SCAN", cursor, "MATCH", pattern, "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return nil, errors.New("unexpected redis SCAN reply")
+		}
+		next, _ := parts[0].([]byte)
+		found, _ := parts[1].([]interface{})
+		for _, key := range found {
+			if k, ok := key.([]byte); ok {
+				keys = append(keys, strings.TrimPrefix(string(k), r.prefix))
+			}
+		}
+		if cursor = string(next); cursor == "0" || cursor == "" {
+			break
+		}
+	}
+	// SCAN can return a key more than once.
+	sort.Strings(keys)
+	unique := keys[:0]
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			unique = append(unique, key)
+		}
+	}
+	return unique, nil
+}
@@ -0,0 +1,165 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Keeps each checkpoint in an object of an S3 bucket, or of any service with
+// a compatible API. Compare and set uses conditional writes.
+type s3Checkpointer struct {
+	*S3Client
+	prefix string
+}
+
+func newS3Checkpointer(conf *CheckpointConfig, prefix string) *s3Checkpointer {
+	return &s3Checkpointer{
+		S3Client: NewS3Client(conf.Address, conf.Bucket, conf.Region,
+			conf.AccessKeyId, conf.SecretAccessKey),
+		prefix: prefix,
+	}
+}
+
+// Sends a request for the checkpoint's object, or for the bucket if key is
+// empty.
+func (s *s3Checkpointer) request(method, key string, query url.Values, body []byte,
+	header http.Header) (*http.Response, []byte, error) {
+
+	if key != "" {
+		key = s.prefix + key
+	}
+	return s.Request(method, key, query, body, header)
+}
+
+// Returns the object's content and ETag, or nil if there's no such object.
+func (s *s3Checkpointer) get(key string) ([]byte, string, error) {
+	if err := checkKey(key); err != nil {
+		return nil, "", err
+	}
+	resp, body, err := s.request("GET", key, nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if body == nil {
+			body = []byte{}
+		}
+		return body, resp.Header.Get("ETag"), nil
+	case http.StatusNotFound:
+		return nil, "", nil
+	}
+	return nil, "", S3Error("GET", key, resp, body)
+}
+
+// Stores the object, returning false if the request's conditions failed.
+func (s *s3Checkpointer) put(key string, value []byte, header http.Header) (bool, error) {
+	resp, body, err := s.request("PUT", key, nil, value, header)
+	if err != nil {
+		return false, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return false, nil
+	}
+	return false, S3Error("PUT", key, resp, body)
+}
+
+func (s *s3Checkpointer) Get(key string) ([]byte, error) {
+	value, _, err := s.get(key)
+	return value, err
+}
+
+func (s *s3Checkpointer) Set(key string, value []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := s.put(key, value, nil)
+	return err
+}
+
+func (s *s3Checkpointer) CompareAndSet(key string, old, value []byte) (bool, error) {
+	header := make(http.Header)
+	if old == nil {
+		if err := checkKey(key); err != nil {
+			return false, err
+		}
+		header.Set("If-None-Match", "*")
+	} else {
+		current, etag, err := s.get(key)
+		if err != nil || current == nil || !bytes.Equal(current, old) {
+			return false, err
+		}
+		header.Set("If-Match", etag)
+	}
+	return s.put(key, value, header)
+}
+
+func (s *s3Checkpointer) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	resp, body, err := s.request("DELETE", key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return S3Error("DELETE", key, resp, body)
+}
+
+func (s *s3Checkpointer) List() ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+	for {
+		resp, body, err := s.request("GET", "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, S3Error("GET", "", resp, body)
+		}
+		var result struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err = xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("s3 list: %s", err)
+		}
+		for _, obj := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(obj.Key, s.prefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
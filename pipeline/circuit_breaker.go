@@ -0,0 +1,196 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"heka/message"
+)
+
+// Settings for an output's circuit breaker, which stops delivery attempts
+// for a while once too many of them fail, leaving messages in the output's
+// disk buffer rather than retrying each of them against a failing backend.
+type CircuitBreakerConfig struct {
+	// Percentage of the deliveries within a window that must fail to trip
+	// the breaker. Defaults to 50.
+	ErrorThreshold float64 `toml:"error_threshold"`
+	// Fewest deliveries within a window before the breaker can trip.
+	// Defaults to 10.
+	MinRequests uint `toml:"min_requests"`
+	// Length of the windows the error rate is measured over. Defaults to
+	// 60s.
+	Window string
+	// How long the breaker stays open before letting probes through.
+	// Defaults to 30s.
+	OpenDuration string `toml:"open_duration"`
+	// Successful probes needed, while half open, to close the breaker.
+	// Defaults to 1.
+	HalfOpenProbes uint `toml:"half_open_probes"`
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (state circuitState) String() string {
+	switch state {
+	case circuitClosed:
+		return "closed"
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type circuitBreaker struct {
+	threshold    float64
+	minRequests  int64
+	window       time.Duration
+	openDuration time.Duration
+	probes       int
+	runner       PluginRunner
+	lock         sync.Mutex
+	state        circuitState
+	windowStart  time.Time
+	openedAt     time.Time
+	requests     int64
+	failures     int64
+	successes    int
+	tripCount    int64
+	now          func() time.Time
+}
+
+func newCircuitBreaker(config *CircuitBreakerConfig, runner PluginRunner) (
+	*circuitBreaker, error) {
+
+	cb := &circuitBreaker{
+		threshold:    config.ErrorThreshold,
+		minRequests:  int64(config.MinRequests),
+		window:       time.Minute,
+		openDuration: 30 * time.Second,
+		probes:       int(config.HalfOpenProbes),
+		runner:       runner,
+		now:          time.Now,
+	}
+	if cb.threshold == 0 {
+		cb.threshold = 50
+	}
+	if cb.threshold < 0 || cb.threshold > 100 {
+		return nil, fmt.Errorf("circuit breaker error_threshold must be between 0 and 100")
+	}
+	if cb.minRequests == 0 {
+		cb.minRequests = 10
+	}
+	if cb.probes == 0 {
+		cb.probes = 1
+	}
+	var err error
+	if config.Window != "" {
+		if cb.window, err = time.ParseDuration(config.Window); err != nil {
+			return nil, fmt.Errorf("can't parse circuit breaker window: %s", err)
+		}
+	}
+	if config.OpenDuration != "" {
+		if cb.openDuration, err = time.ParseDuration(config.OpenDuration); err != nil {
+			return nil, fmt.Errorf("can't parse circuit breaker open_duration: %s", err)
+		}
+	}
+	if cb.window <= 0 || cb.openDuration <= 0 {
+		return nil, fmt.Errorf("circuit breaker durations must be positive")
+	}
+	cb.windowStart = cb.now()
+	return cb, nil
+}
+
+// Returns how long to hold off before the next delivery attempt, zero if
+// one can be made now.
+func (cb *circuitBreaker) wait() time.Duration {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	if cb.state != circuitOpen {
+		return 0
+	}
+	remaining := cb.openDuration - cb.now().Sub(cb.openedAt)
+	if remaining > 0 {
+		return remaining
+	}
+	cb.state = circuitHalfOpen
+	cb.successes = 0
+	cb.runner.LogMessage("circuit breaker half-open, probing")
+	return 0
+}
+
+// Records the outcome of a delivery attempt.
+func (cb *circuitBreaker) record(ok bool) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	switch cb.state {
+	case circuitHalfOpen:
+		if !ok {
+			cb.trip()
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.probes {
+			cb.state = circuitClosed
+			cb.resetWindow()
+			cb.runner.LogMessage("circuit breaker closed")
+		}
+	case circuitClosed:
+		if cb.now().Sub(cb.windowStart) >= cb.window {
+			cb.resetWindow()
+		}
+		cb.requests++
+		if !ok {
+			cb.failures++
+		}
+		if cb.requests >= cb.minRequests &&
+			float64(cb.failures)*100 >= cb.threshold*float64(cb.requests) {
+			cb.trip()
+		}
+	}
+}
+
+// Opens the breaker. Expects the lock to be held.
+func (cb *circuitBreaker) trip() {
+	cb.state = circuitOpen
+	cb.openedAt = cb.now()
+	cb.tripCount++
+	cb.resetWindow()
+	cb.runner.LogError(fmt.Errorf("circuit breaker open for %s", cb.openDuration))
+}
+
+func (cb *circuitBreaker) resetWindow() {
+	cb.windowStart = cb.now()
+	cb.requests = 0
+	cb.failures = 0
+}
+
+// Adds the breaker's state to a plugin report message.
+func (cb *circuitBreaker) report(msg *message.Message) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	message.NewStringField(msg, "CircuitState", cb.state.String())
+	message.NewInt64Field(msg, "CircuitTripCount", cb.tripCount, "count")
+}
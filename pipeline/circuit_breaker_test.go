@@ -0,0 +1,116 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"time"
+
+	"heka/message"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func CircuitBreakerSpec(c gs.Context) {
+	c.Specify("A circuit breaker", func() {
+		runner := new(foRunner)
+		runner.name = "BreakerOutput"
+		config := &CircuitBreakerConfig{
+			MinRequests:    4,
+			OpenDuration:   "10s",
+			HalfOpenProbes: 2,
+		}
+		now := time.Now()
+		newBreaker := func() *circuitBreaker {
+			cb, err := newCircuitBreaker(config, runner)
+			c.Assume(err, gs.IsNil)
+			cb.now = func() time.Time { return now }
+			return cb
+		}
+
+		c.Specify("stays closed below the error threshold", func() {
+			cb := newBreaker()
+			for _, ok := range []bool{true, false, true, true, false, true} {
+				cb.record(ok)
+			}
+			c.Expect(cb.state, gs.Equals, circuitClosed)
+			c.Expect(cb.wait(), gs.Equals, time.Duration(0))
+		})
+
+		c.Specify("needs min_requests before tripping", func() {
+			cb := newBreaker()
+			cb.record(false)
+			cb.record(false)
+			cb.record(false)
+			c.Expect(cb.state, gs.Equals, circuitClosed)
+			cb.record(false)
+			c.Expect(cb.state, gs.Equals, circuitOpen)
+			c.Expect(cb.wait(), gs.Equals, 10*time.Second)
+		})
+
+		c.Specify("measures the error rate per window", func() {
+			cb := newBreaker()
+			cb.record(false)
+			cb.record(false)
+			cb.record(true)
+			now = now.Add(2 * time.Minute)
+			cb.record(false)
+			c.Expect(cb.state, gs.Equals, circuitClosed)
+			c.Expect(cb.requests, gs.Equals, int64(1))
+		})
+
+		c.Specify("probes once open_duration has passed", func() {
+			cb := newBreaker()
+			for i := 0; i < 4; i++ {
+				cb.record(false)
+			}
+			now = now.Add(4 * time.Second)
+			c.Expect(cb.wait(), gs.Equals, 6*time.Second)
+			now = now.Add(6 * time.Second)
+			c.Expect(cb.wait(), gs.Equals, time.Duration(0))
+			c.Expect(cb.state, gs.Equals, circuitHalfOpen)
+
+			c.Specify("and closes after enough succeed", func() {
+				cb.record(true)
+				c.Expect(cb.state, gs.Equals, circuitHalfOpen)
+				cb.record(true)
+				c.Expect(cb.state, gs.Equals, circuitClosed)
+			})
+
+			c.Specify("and reopens when one fails", func() {
+				cb.record(true)
+				cb.record(false)
+				c.Expect(cb.state, gs.Equals, circuitOpen)
+				c.Expect(cb.wait(), gs.Equals, 10*time.Second)
+
+				msg := new(message.Message)
+				cb.report(msg)
+				state, _ := msg.GetFieldValue("CircuitState")
+				c.Expect(state, gs.Equals, "open")
+				trips, _ := msg.GetFieldValue("CircuitTripCount")
+				c.Expect(trips, gs.Equals, int64(2))
+			})
+		})
+
+		c.Specify("rejects bad settings", func() {
+			config.ErrorThreshold = 150
+			_, err := newCircuitBreaker(config, runner)
+			c.Expect(err, gs.Not(gs.IsNil))
+			config.ErrorThreshold = 0
+			config.Window = "soon"
+			_, err = newCircuitBreaker(config, runner)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,113 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+)
+
+// Settings for checking an input's message timestamps against the time the
+// messages are received.
+type ClockSkewConfig struct {
+	// How far into the future a timestamp may be before it's skewed.
+	// Defaults to 1m.
+	Tolerance string
+	// How far into the past a timestamp may be before it's skewed. Defaults
+	// to not checking past timestamps, as late messages are usually just
+	// late.
+	PastTolerance string `toml:"past_tolerance"`
+	// "tag" adds the skew to the message in `field`, "correct" also replaces
+	// the timestamp with the receive time. Defaults to "tag".
+	Action string
+	// Name of the field the skew is added in, as signed milliseconds, positive
+	// for timestamps in the future. Defaults to "ClockSkew".
+	Field string
+}
+
+type clockSkew struct {
+	tolerance     time.Duration
+	pastTolerance time.Duration
+	correct       bool
+	field         string
+	skewedCount   int64
+	now           func() time.Time
+}
+
+func newClockSkew(config *ClockSkewConfig) (*clockSkew, error) {
+	cs := &clockSkew{
+		tolerance: time.Minute,
+		field:     config.Field,
+		now:       time.Now,
+	}
+	var err error
+	if config.Tolerance != "" {
+		if cs.tolerance, err = time.ParseDuration(config.Tolerance); err != nil {
+			return nil, fmt.Errorf("can't parse clock_skew tolerance: %s", err)
+		}
+	}
+	if config.PastTolerance != "" {
+		if cs.pastTolerance, err = time.ParseDuration(config.PastTolerance); err != nil {
+			return nil, fmt.Errorf("can't parse clock_skew past_tolerance: %s", err)
+		}
+	}
+	if cs.tolerance < 0 || cs.pastTolerance < 0 {
+		return nil, fmt.Errorf("clock_skew tolerances can't be negative")
+	}
+	switch config.Action {
+	case "", "tag":
+	case "correct":
+		cs.correct = true
+	default:
+		return nil, fmt.Errorf("clock_skew action must be 'tag' or 'correct', got '%s'",
+			config.Action)
+	}
+	if cs.field == "" {
+		cs.field = "ClockSkew"
+	}
+	return cs, nil
+}
+
+// Tags the pack's message with its skew, and corrects its timestamp if so
+// configured, if the timestamp is too far from now.
+func (cs *clockSkew) apply(pack *PipelinePack) {
+	ts := pack.Message.GetTimestamp()
+	if ts == 0 {
+		return
+	}
+	now := cs.now()
+	skew := time.Unix(0, ts).Sub(now)
+	if skew <= cs.tolerance && (cs.pastTolerance == 0 || -skew <= cs.pastTolerance) {
+		return
+	}
+	atomic.AddInt64(&cs.skewedCount, 1)
+	msg := pack.Message
+	for f := msg.FindFirstField(cs.field); f != nil; f = msg.FindFirstField(cs.field) {
+		msg.DeleteField(f)
+	}
+	message.NewInt64Field(msg, cs.field, int64(skew/time.Millisecond), "ms")
+	if cs.correct {
+		msg.SetTimestamp(now.UnixNano())
+	}
+	pack.TrustMsgBytes = false
+}
+
+// Returns how many messages have been found skewed.
+func (cs *clockSkew) count() int64 {
+	return atomic.LoadInt64(&cs.skewedCount)
+}
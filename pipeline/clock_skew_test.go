@@ -0,0 +1,85 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func ClockSkewSpec(c gs.Context) {
+	c.Specify("A clock skew check", func() {
+		config := new(ClockSkewConfig)
+		now := time.Now()
+		newSkew := func() *clockSkew {
+			cs, err := newClockSkew(config)
+			c.Assume(err, gs.IsNil)
+			cs.now = func() time.Time { return now }
+			return cs
+		}
+		newPack := func(offset time.Duration) *PipelinePack {
+			pack := NewPipelinePack(nil)
+			pack.Message.SetTimestamp(now.Add(offset).UnixNano())
+			pack.TrustMsgBytes = true
+			return pack
+		}
+
+		c.Specify("leaves timestamps within tolerance alone", func() {
+			cs := newSkew()
+			pack := newPack(30 * time.Second)
+			cs.apply(pack)
+			_, ok := pack.Message.GetFieldValue("ClockSkew")
+			c.Expect(ok, gs.IsFalse)
+			c.Expect(pack.TrustMsgBytes, gs.IsTrue)
+			// Past timestamps aren't checked by default.
+			cs.apply(newPack(-24 * time.Hour))
+			c.Expect(cs.count(), gs.Equals, int64(0))
+		})
+
+		c.Specify("tags future timestamps with their skew", func() {
+			cs := newSkew()
+			pack := newPack(time.Hour)
+			cs.apply(pack)
+			skew, _ := pack.Message.GetFieldValue("ClockSkew")
+			c.Expect(skew, gs.Equals, int64(time.Hour/time.Millisecond))
+			c.Expect(pack.Message.GetTimestamp(), gs.Equals, now.Add(time.Hour).UnixNano())
+			c.Expect(pack.TrustMsgBytes, gs.IsFalse)
+			c.Expect(cs.count(), gs.Equals, int64(1))
+		})
+
+		c.Specify("corrects skewed timestamps", func() {
+			config.Action = "correct"
+			config.Field = "Skew"
+			config.PastTolerance = "1h"
+			cs := newSkew()
+			pack := newPack(-2 * time.Hour)
+			cs.apply(pack)
+			skew, _ := pack.Message.GetFieldValue("Skew")
+			c.Expect(skew, gs.Equals, -int64(2*time.Hour/time.Millisecond))
+			c.Expect(pack.Message.GetTimestamp(), gs.Equals, now.UnixNano())
+		})
+
+		c.Specify("rejects bad settings", func() {
+			config.Action = "fix"
+			_, err := newClockSkew(config)
+			c.Expect(err, gs.Not(gs.IsNil))
+			config.Action = ""
+			config.Tolerance = "-1m"
+			_, err = newClockSkew(config)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,563 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cluster coordination settings, from the `[hekad.cluster]` config section.
+type ClusterConfig struct {
+	// Coordination service, "consul" or "etcd".
+	Backend string `toml:"backend"`
+	// Base URL of the service's HTTP API, e.g. "http://127.0.0.1:8500".
+	Address string `toml:"address"`
+	// Prefix of the keys recording which node leads for each singleton
+	// input, and which nodes belong to each shard group. Defaults to
+	// "heka/leader/".
+	KeyPrefix string `toml:"key_prefix"`
+	// Name identifying this node to the others. Defaults to the hostname.
+	NodeName string `toml:"node_name"`
+	// Number of seconds a leader's claim lasts without being renewed, and so
+	// how long a dead leader's inputs go without running. Defaults to 15.
+	Ttl uint `toml:"ttl"`
+}
+
+// Validate checks that the settings name a supported coordination service.
+func (c *ClusterConfig) Validate() error {
+	switch c.Backend {
+	case "consul", "etcd":
+	default:
+		return fmt.Errorf("unsupported cluster backend '%s'", c.Backend)
+	}
+	if c.Address == "" {
+		return errors.New("cluster address must be set")
+	}
+	if c.Ttl != 0 && c.Ttl < 3 {
+		return errors.New("cluster ttl must be at least 3 seconds")
+	}
+	return nil
+}
+
+// LeaderElector decides which node of a cluster runs each singleton input.
+type LeaderElector interface {
+	// Campaign blocks until this node leads for the key, or the stop channel
+	// is closed in which case it returns ErrStopping. The returned channel is
+	// closed if leadership is later lost.
+	Campaign(key string, stop <-chan struct{}) (lost <-chan struct{}, err error)
+	// Resign gives up leadership for the key.
+	Resign(key string) error
+}
+
+// A claim on a key held in the coordination service, which lapses unless
+// renewed within the ttl.
+type leaderLock interface {
+	// Tries to claim the key, returning true if this node now holds it.
+	acquire(key string) (bool, error)
+	// Extends the claim on a held key, returning false if it's been lost.
+	renew(key string) (bool, error)
+	// Gives up the claim on a held key.
+	release(key string) error
+	// Returns the claimed keys starting with the prefix.
+	list(prefix string) ([]string, error)
+}
+
+type leaderElector struct {
+	lock     leaderLock
+	node     string
+	prefix   string
+	ttl      time.Duration
+	interval time.Duration
+	// Protects resigns, which holds a channel for each key this node leads
+	// for, closed on resigning.
+	resignsLock sync.Mutex
+	resigns     map[string]chan struct{}
+}
+
+// NewLeaderElector returns a LeaderElector using the configured coordination
+// service.
+func NewLeaderElector(conf *ClusterConfig, hostname string) (LeaderElector, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	node := conf.NodeName
+	if node == "" {
+		node = hostname
+	}
+	ttl := time.Duration(conf.Ttl) * time.Second
+	if ttl == 0 {
+		ttl = 15 * time.Second
+	}
+	prefix := conf.KeyPrefix
+	if prefix == "" {
+		prefix = "heka/leader/"
+	}
+	api := &httpJSONClient{
+		address: strings.TrimRight(conf.Address, "/"),
+		client:  &http.Client{Timeout: ttl / 3},
+	}
+	e := &leaderElector{
+		node:     node,
+		prefix:   prefix,
+		ttl:      ttl,
+		interval: ttl / 3,
+		resigns:  make(map[string]chan struct{}),
+	}
+	if conf.Backend == "consul" {
+		e.lock = &consulLock{api: api, node: node, ttl: ttl,
+			sessions: make(map[string]string)}
+	} else {
+		e.lock = &etcdLock{api: api, node: node, ttl: ttl,
+			leases: make(map[string]string)}
+	}
+	return e, nil
+}
+
+func (e *leaderElector) Campaign(key string, stop <-chan struct{}) (<-chan struct{}, error) {
+	key = e.prefix + key
+	for {
+		held, err := e.lock.acquire(key)
+		if err != nil {
+			LogError.Printf("Can't campaign for leadership of '%s': %s", key, err)
+		}
+		if held {
+			break
+		}
+		select {
+		case <-stop:
+			return nil, ErrStopping
+		case <-time.After(e.interval):
+		}
+	}
+	lost := make(chan struct{})
+	resign := make(chan struct{})
+	e.resignsLock.Lock()
+	e.resigns[key] = resign
+	e.resignsLock.Unlock()
+	go e.hold(key, lost, resign)
+	return lost, nil
+}
+
+// Keeps renewing the claim on the key until resigning, closing the lost
+// channel if the claim lapses. A claim that can't be renewed is given up a
+// renewal interval before it expires, so two nodes never both think they
+// lead.
+func (e *leaderElector) hold(key string, lost, resign chan struct{}) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-resign:
+			return
+		case <-ticker.C:
+		}
+		held, err := e.lock.renew(key)
+		if err != nil {
+			LogError.Printf("Can't renew leadership of '%s': %s", key, err)
+			held = time.Since(renewed) < e.ttl-e.interval
+		} else if held {
+			renewed = time.Now()
+		}
+		if !held {
+			// Losing the claim while resigning isn't losing leadership.
+			e.resignsLock.Lock()
+			resigned := e.resigns[key] != resign
+			if !resigned {
+				delete(e.resigns, key)
+			}
+			e.resignsLock.Unlock()
+			if !resigned {
+				close(lost)
+			}
+			return
+		}
+	}
+}
+
+func (e *leaderElector) Resign(key string) error {
+	key = e.prefix + key
+	e.resignsLock.Lock()
+	if resign, ok := e.resigns[key]; ok {
+		close(resign)
+		delete(e.resigns, key)
+	}
+	e.resignsLock.Unlock()
+	return e.lock.release(key)
+}
+
+// Minimal client for the coordination services' JSON HTTP APIs.
+type httpJSONClient struct {
+	address string
+	client  *http.Client
+}
+
+// Sends the request body, JSON encoded unless it's a string, and decodes the
+// response into result if it isn't nil. Returns the response status code.
+func (c *httpJSONClient) call(method, path string, body, result interface{}) (
+	int, error) {
+
+	var reqBody []byte
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reqBody = []byte(b)
+	default:
+		var err error
+		if reqBody, err = json.Marshal(b); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, c.address+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status,
+			strings.TrimSpace(string(respBody)))
+	}
+	if result != nil {
+		if err = json.Unmarshal(respBody, result); err != nil {
+			return resp.StatusCode, fmt.Errorf("%s %s: %s", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// Claims keys using consul sessions, see
+// https://www.consul.io/docs/guides/leader-election.html.
+type consulLock struct {
+	api  *httpJSONClient
+	node string
+	ttl  time.Duration
+	// Protects sessions, which holds the session used to claim each key.
+	lock     sync.Mutex
+	sessions map[string]string
+}
+
+func (c *consulLock) session(key string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if id, ok := c.sessions[key]; ok {
+		return id, nil
+	}
+	req := map[string]string{
+		"Name":      c.node,
+		"TTL":       c.ttl.String(),
+		"Behavior":  "delete",
+		"LockDelay": "0s",
+	}
+	var resp struct{ ID string }
+	if _, err := c.api.call("PUT", "/v1/session/create", req, &resp); err != nil {
+		return "", err
+	}
+	c.sessions[key] = resp.ID
+	return resp.ID, nil
+}
+
+func (c *consulLock) dropSession(key string) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	id := c.sessions[key]
+	delete(c.sessions, key)
+	return id
+}
+
+func (c *consulLock) acquire(key string) (bool, error) {
+	id, err := c.session(key)
+	if err != nil {
+		return false, err
+	}
+	var held bool
+	path := fmt.Sprintf("/v1/kv/%s?acquire=%s", key, url.QueryEscape(id))
+	if _, err = c.api.call("PUT", path, c.node, &held); err != nil {
+		// The session may have expired while waiting, use a new one.
+		c.dropSession(key)
+		return false, err
+	}
+	return held, nil
+}
+
+func (c *consulLock) renew(key string) (bool, error) {
+	c.lock.Lock()
+	id := c.sessions[key]
+	c.lock.Unlock()
+	status, err := c.api.call("PUT", "/v1/session/renew/"+id, nil, nil)
+	if status == http.StatusNotFound {
+		c.dropSession(key)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var entries []struct{ Session string }
+	status, err = c.api.call("GET", "/v1/kv/"+key, nil, &entries)
+	if status == http.StatusNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return len(entries) > 0 && entries[0].Session == id, nil
+}
+
+func (c *consulLock) release(key string) error {
+	id := c.dropSession(key)
+	if id == "" {
+		return nil
+	}
+	path := fmt.Sprintf("/v1/kv/%s?release=%s", key, url.QueryEscape(id))
+	if _, err := c.api.call("PUT", path, nil, nil); err != nil {
+		return err
+	}
+	_, err := c.api.call("PUT", "/v1/session/destroy/"+id, nil, nil)
+	return err
+}
+
+func (c *consulLock) list(prefix string) ([]string, error) {
+	var keys []string
+	status, err := c.api.call("GET", "/v1/kv/"+prefix+"?keys", nil, &keys)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	return keys, err
+}
+
+// Claims keys using etcd leases, through etcd's v3 JSON gateway.
+type etcdLock struct {
+	api  *httpJSONClient
+	node string
+	ttl  time.Duration
+	// Protects leases, which holds the lease attached to each claimed key.
+	lock   sync.Mutex
+	leases map[string]string
+}
+
+type etcdKeyValue struct {
+	Value string `json:"value"`
+	Lease string `json:"lease"`
+}
+
+func etcdEncode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func (e *etcdLock) lease(key string) (string, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if id, ok := e.leases[key]; ok {
+		return id, nil
+	}
+	req := map[string]interface{}{"TTL": int64(e.ttl / time.Second)}
+	var resp struct{ ID string }
+	if _, err := e.api.call("POST", "/v3/lease/grant", req, &resp); err != nil {
+		return "", err
+	}
+	e.leases[key] = resp.ID
+	return resp.ID, nil
+}
+
+func (e *etcdLock) dropLease(key string) string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	id := e.leases[key]
+	delete(e.leases, key)
+	return id
+}
+
+// Returns the lease the key is held with, or "" if it's not held.
+func (e *etcdLock) holder(key string) (string, error) {
+	req := map[string]string{"key": etcdEncode(key)}
+	var resp struct{ Kvs []etcdKeyValue }
+	if _, err := e.api.call("POST", "/v3/kv/range", req, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+	return resp.Kvs[0].Lease, nil
+}
+
+func (e *etcdLock) acquire(key string) (bool, error) {
+	id, err := e.lease(key)
+	if err != nil {
+		return false, err
+	}
+	req := map[string]interface{}{
+		"compare": []map[string]string{{
+			"key":             etcdEncode(key),
+			"target":          "CREATE",
+			"create_revision": "0",
+		}},
+		"success": []map[string]interface{}{{
+			"request_put": map[string]string{
+				"key":   etcdEncode(key),
+				"value": etcdEncode(e.node),
+				"lease": id,
+			},
+		}},
+	}
+	var resp struct{ Succeeded bool }
+	if _, err = e.api.call("POST", "/v3/kv/txn", req, &resp); err != nil {
+		// The lease may have expired while waiting, use a new one.
+		e.dropLease(key)
+		return false, err
+	}
+	if resp.Succeeded {
+		return true, nil
+	}
+	// An earlier attempt may have succeeded without us hearing about it.
+	holder, err := e.holder(key)
+	return holder == id, err
+}
+
+func (e *etcdLock) renew(key string) (bool, error) {
+	e.lock.Lock()
+	id := e.leases[key]
+	e.lock.Unlock()
+	var resp struct {
+		Result struct{ TTL string }
+	}
+	req := map[string]string{"ID": id}
+	if _, err := e.api.call("POST", "/v3/lease/keepalive", req, &resp); err != nil {
+		return false, err
+	}
+	if resp.Result.TTL == "" || resp.Result.TTL == "0" {
+		e.dropLease(key)
+		return false, nil
+	}
+	holder, err := e.holder(key)
+	return holder == id, err
+}
+
+func (e *etcdLock) list(prefix string) ([]string, error) {
+	// The range covers every key starting with the prefix.
+	end := []byte(prefix)
+	end[len(end)-1]++
+	req := map[string]interface{}{
+		"key":       etcdEncode(prefix),
+		"range_end": base64.StdEncoding.EncodeToString(end),
+		"keys_only": true,
+	}
+	var resp struct {
+		Kvs []struct{ Key string }
+	}
+	if _, err := e.api.call("POST", "/v3/kv/range", req, &resp); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, string(key))
+	}
+	return keys, nil
+}
+
+func (e *etcdLock) release(key string) error {
+	id := e.dropLease(key)
+	if id == "" {
+		return nil
+	}
+	// Revoking the lease deletes the key.
+	_, err := e.api.call("POST", "/v3/lease/revoke", map[string]string{"ID": id}, nil)
+	return err
+}
+
+// Wraps an input configured with `singleton = true`, so it's only run while
+// this node leads for it, and is stopped if leadership is lost.
+type singletonInput struct {
+	Input
+	ir       *iRunner
+	elector  LeaderElector
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+func newSingletonInput(ir *iRunner, elector LeaderElector) *singletonInput {
+	return &singletonInput{
+		Input:    ir.input,
+		ir:       ir,
+		elector:  elector,
+		stopChan: make(chan struct{}),
+	}
+}
+
+func (s *singletonInput) resign() {
+	if err := s.elector.Resign(s.ir.name); err != nil {
+		s.ir.LogError(fmt.Errorf("can't resign leadership: %s", err))
+	}
+}
+
+func (s *singletonInput) Run(ir InputRunner, h PluginHelper) error {
+	for {
+		lost, err := s.elector.Campaign(s.ir.name, s.stopChan)
+		if err != nil {
+			// Stopped before being elected.
+			return nil
+		}
+		ir.LogMessage("Elected leader, starting")
+		done := make(chan error, 1)
+		go func() {
+			done <- s.Input.Run(ir, h)
+		}()
+		select {
+		case err = <-done:
+			s.resign()
+			return err
+		case <-s.stopChan:
+			s.Input.Stop()
+			err = <-done
+			s.resign()
+			return err
+		case <-lost:
+		}
+
+		ir.LogMessage("Lost leadership, stopping")
+		s.Input.Stop()
+		if err = <-done; err != nil {
+			ir.LogError(err)
+		}
+		// The input has to be initialized afresh before it can run again.
+		if err = s.ir.reinitPlugin(); err != nil {
+			return fmt.Errorf("can't reinitialize after losing leadership: %s", err)
+		}
+	}
+}
+
+func (s *singletonInput) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+}
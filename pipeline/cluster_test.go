@@ -0,0 +1,430 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+// Stands in for the parts of consul's HTTP API used for leader election.
+type fakeConsul struct {
+	lock     sync.Mutex
+	nextId   int
+	sessions map[string]bool
+	// Session holding each key.
+	keys map[string]string
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	path := r.URL.Path
+	switch {
+	case path == "/v1/session/create":
+		f.nextId++
+		id := fmt.Sprintf("session-%d", f.nextId)
+		f.sessions[id] = true
+		fmt.Fprintf(w, `{"ID": "%s"}`, id)
+	case strings.HasPrefix(path, "/v1/session/renew/"):
+		if !f.sessions[strings.TrimPrefix(path, "/v1/session/renew/")] {
+			http.NotFound(w, r)
+		}
+	case strings.HasPrefix(path, "/v1/session/destroy/"):
+		f.expire(strings.TrimPrefix(path, "/v1/session/destroy/"))
+	case strings.HasPrefix(path, "/v1/kv/"):
+		key := strings.TrimPrefix(path, "/v1/kv/")
+		holder := f.keys[key]
+		if id := r.URL.Query().Get("acquire"); id != "" {
+			if !f.sessions[id] {
+				http.Error(w, "invalid session", http.StatusInternalServerError)
+				return
+			}
+			if holder == "" {
+				f.keys[key] = id
+			}
+			fmt.Fprint(w, holder == "" || holder == id)
+		} else if id := r.URL.Query().Get("release"); id != "" {
+			if holder == id {
+				delete(f.keys, key)
+			}
+			fmt.Fprint(w, true)
+		} else if _, ok := r.URL.Query()["keys"]; ok {
+			var keys []string
+			for k := range f.keys {
+				if strings.HasPrefix(k, key) {
+					keys = append(keys, k)
+				}
+			}
+			if len(keys) == 0 {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(keys)
+		} else if holder == "" {
+			http.NotFound(w, r)
+		} else {
+			fmt.Fprintf(w, `[{"Session": "%s"}]`, holder)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Invalidates a session, releasing its keys. Must be called with the lock
+// held.
+func (f *fakeConsul) expire(id string) {
+	delete(f.sessions, id)
+	for key, holder := range f.keys {
+		if holder == id {
+			delete(f.keys, key)
+		}
+	}
+}
+
+// Stands in for the parts of etcd's v3 JSON gateway used for leader election.
+type fakeEtcd struct {
+	lock      sync.Mutex
+	nextLease int
+	leases    map[string]bool
+	// Lease attached to each key.
+	keys map[string]string
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	var req struct {
+		ID       string
+		Key      string
+		RangeEnd string `json:"range_end"`
+		Success  []struct {
+			RequestPut struct {
+				Key   string
+				Lease string
+			} `json:"request_put"`
+		}
+	}
+	json.Unmarshal(body, &req)
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		f.nextLease++
+		id := fmt.Sprintf("%d", f.nextLease)
+		f.leases[id] = true
+		fmt.Fprintf(w, `{"ID": "%s", "TTL": "1"}`, id)
+	case "/v3/lease/keepalive":
+		if f.leases[req.ID] {
+			fmt.Fprintf(w, `{"result": {"ID": "%s", "TTL": "1"}}`, req.ID)
+		} else {
+			fmt.Fprintf(w, `{"result": {"ID": "%s"}}`, req.ID)
+		}
+	case "/v3/lease/revoke":
+		f.expire(req.ID)
+		fmt.Fprint(w, `{}`)
+	case "/v3/kv/txn":
+		put := req.Success[0].RequestPut
+		if _, ok := f.keys[put.Key]; ok {
+			fmt.Fprint(w, `{"succeeded": false}`)
+			return
+		}
+		f.keys[put.Key] = put.Lease
+		fmt.Fprint(w, `{"succeeded": true}`)
+	case "/v3/kv/range":
+		if req.RangeEnd != "" {
+			prefix, _ := base64.StdEncoding.DecodeString(req.Key)
+			var kvs []string
+			for k := range f.keys {
+				key, _ := base64.StdEncoding.DecodeString(k)
+				if strings.HasPrefix(string(key), string(prefix)) {
+					kvs = append(kvs, fmt.Sprintf(`{"key": "%s"}`, k))
+				}
+			}
+			fmt.Fprintf(w, `{"kvs": [%s]}`, strings.Join(kvs, ","))
+		} else if lease, ok := f.keys[req.Key]; ok {
+			fmt.Fprintf(w, `{"kvs": [{"lease": "%s"}]}`, lease)
+		} else {
+			fmt.Fprint(w, `{}`)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Must be called with the lock held.
+func (f *fakeEtcd) expire(id string) {
+	delete(f.leases, id)
+	for key, lease := range f.keys {
+		if lease == id {
+			delete(f.keys, key)
+		}
+	}
+}
+
+// An elector whose leadership is granted and taken away by the test.
+type testElector struct {
+	elected chan chan struct{}
+	resigns chan string
+}
+
+func (e *testElector) Campaign(key string, stop <-chan struct{}) (<-chan struct{}, error) {
+	select {
+	case lost := <-e.elected:
+		return lost, nil
+	case <-stop:
+		return nil, ErrStopping
+	}
+}
+
+func (e *testElector) Resign(key string) error {
+	e.resigns <- key
+	return nil
+}
+
+// Input that runs until stopped, reporting when it starts.
+type clusterTestInput struct {
+	started  chan bool
+	stopChan chan bool
+	inits    int
+}
+
+func (i *clusterTestInput) Init(config interface{}) error {
+	i.inits++
+	i.stopChan = make(chan bool)
+	return nil
+}
+
+func (i *clusterTestInput) Run(ir InputRunner, h PluginHelper) error {
+	i.started <- true
+	<-i.stopChan
+	return nil
+}
+
+func (i *clusterTestInput) Stop() {
+	close(i.stopChan)
+}
+
+func ClusterSpec(c gs.Context) {
+	newElector := func(backend string, handler http.Handler, node string) (
+		*leaderElector, func()) {
+
+		server := httptest.NewServer(handler)
+		conf := &ClusterConfig{Backend: backend, Address: server.URL}
+		elector, err := NewLeaderElector(conf, node)
+		c.Assume(err, gs.IsNil)
+		e := elector.(*leaderElector)
+		e.interval = 10 * time.Millisecond
+		e.ttl = 50 * time.Millisecond
+		return e, server.Close
+	}
+	isClosed := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		case <-time.After(time.Second):
+			return false
+		}
+	}
+
+	c.Specify("A ClusterConfig", func() {
+		c.Specify("requires a known backend", func() {
+			conf := &ClusterConfig{Backend: "zookeeper", Address: "http://localhost"}
+			c.Expect(conf.Validate().Error(), gs.Equals,
+				"unsupported cluster backend 'zookeeper'")
+		})
+
+		c.Specify("requires an address", func() {
+			conf := &ClusterConfig{Backend: "consul"}
+			c.Expect(conf.Validate(), gs.Not(gs.IsNil))
+		})
+	})
+
+	backends := map[string]func() (http.Handler, func(key string)){
+		"consul": func() (http.Handler, func(key string)) {
+			f := &fakeConsul{sessions: make(map[string]bool),
+				keys: make(map[string]string)}
+			return f, func(key string) {
+				f.lock.Lock()
+				f.expire(f.keys[key])
+				f.lock.Unlock()
+			}
+		},
+		"etcd": func() (http.Handler, func(key string)) {
+			f := &fakeEtcd{leases: make(map[string]bool), keys: make(map[string]string)}
+			return f, func(key string) {
+				f.lock.Lock()
+				f.expire(f.keys[base64.StdEncoding.EncodeToString([]byte(key))])
+				f.lock.Unlock()
+			}
+		},
+	}
+	for backend, newFake := range backends {
+		backend, newFake := backend, newFake
+		c.Specify("A LeaderElector using "+backend, func() {
+			handler, expire := newFake()
+			one, closeOne := newElector(backend, handler, "one")
+			defer closeOne()
+			two, closeTwo := newElector(backend, handler, "two")
+			defer closeTwo()
+			stop := make(chan struct{})
+			defer close(stop)
+
+			c.Specify("elects one node at a time", func() {
+				lost, err := one.Campaign("input", stop)
+				c.Assume(err, gs.IsNil)
+
+				elected := make(chan error, 1)
+				go func() {
+					_, err := two.Campaign("input", stop)
+					elected <- err
+				}()
+				select {
+				case <-elected:
+					c.Expect("second node elected", gs.Equals, "")
+				case <-time.After(100 * time.Millisecond):
+				}
+
+				c.Expect(one.Resign("input"), gs.IsNil)
+				c.Expect(<-elected, gs.IsNil)
+				c.Expect(two.Resign("input"), gs.IsNil)
+				select {
+				case <-lost:
+					c.Expect("leadership lost after resigning", gs.Equals, "")
+				default:
+				}
+			})
+
+			c.Specify("gives up campaigning when stopped", func() {
+				_, err := one.Campaign("input", stop)
+				c.Assume(err, gs.IsNil)
+				twoStop := make(chan struct{})
+				close(twoStop)
+				_, err = two.Campaign("input", twoStop)
+				c.Expect(err, gs.Equals, ErrStopping)
+				one.Resign("input")
+			})
+
+			c.Specify("shares out items among shard group members", func() {
+				pConfig := NewPipelineConfig(nil)
+				pConfig.elector = one
+				groupOne, err := pConfig.JoinShardGroup("files")
+				c.Assume(err, gs.IsNil)
+				defer groupOne.Leave()
+				pConfig.elector = two
+				groupTwo, err := pConfig.JoinShardGroup("files")
+				c.Assume(err, gs.IsNil)
+
+				waitForMembers := func(g *ShardGroup, n int) {
+					for i := 0; i < 100 && len(g.Members()) != n; i++ {
+						<-g.Changes()
+					}
+				}
+				waitForMembers(groupOne, 2)
+				waitForMembers(groupTwo, 2)
+				c.Expect(groupOne.Members()[1], gs.Equals, "two")
+
+				items := []string{"a.log", "b.log", "c.log", "d.log", "e.log", "f.log"}
+				ownedByOne := 0
+				for _, item := range items {
+					// Every item has exactly one owner.
+					c.Expect(groupOne.Owns(item), gs.Equals, !groupTwo.Owns(item))
+					if groupOne.Owns(item) {
+						ownedByOne++
+					}
+				}
+				c.Expect(ownedByOne > 0 && ownedByOne < len(items), gs.IsTrue)
+
+				// The remaining member takes over when the other leaves.
+				groupTwo.Leave()
+				waitForMembers(groupOne, 1)
+				for _, item := range items {
+					c.Expect(groupOne.Owns(item), gs.IsTrue)
+				}
+				c.Expect(len(groupTwo.Members()), gs.Equals, 0)
+			})
+
+			c.Specify("notices when leadership lapses", func() {
+				lost, err := one.Campaign("input", stop)
+				c.Assume(err, gs.IsNil)
+				expire("heka/leader/input")
+				c.Expect(isClosed(lost), gs.IsTrue)
+				// Another node can then take over.
+				_, err = two.Campaign("input", stop)
+				c.Expect(err, gs.IsNil)
+				two.Resign("input")
+			})
+		})
+	}
+
+	c.Specify("A singleton input", func() {
+		input := &clusterTestInput{started: make(chan bool, 1)}
+		input.Init(nil)
+		ir := NewInputRunner("singleton", input, CommonInputConfig{}).(*iRunner)
+		elector := &testElector{
+			elected: make(chan chan struct{}),
+			resigns: make(chan string, 1),
+		}
+		singleton := newSingletonInput(ir, elector)
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- singleton.Run(ir, nil)
+		}()
+
+		c.Specify("doesn't run until elected", func() {
+			select {
+			case <-input.started:
+				c.Expect("input started", gs.Equals, "")
+			case <-time.After(50 * time.Millisecond):
+			}
+			singleton.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		})
+
+		c.Specify("runs while elected and resigns when stopped", func() {
+			elector.elected <- make(chan struct{})
+			c.Expect(<-input.started, gs.IsTrue)
+			singleton.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+			c.Expect(<-elector.resigns, gs.Equals, "singleton")
+		})
+
+		c.Specify("stops the input when leadership is lost", func() {
+			maker := new(pluginMaker)
+			maker.SetPrepConfig(func() (interface{}, error) {
+				return nil, nil
+			})
+			ir.maker = maker
+			lost := make(chan struct{})
+			elector.elected <- lost
+			c.Expect(<-input.started, gs.IsTrue)
+			close(lost)
+			// It's initialized afresh and run again once reelected.
+			elector.elected <- make(chan struct{})
+			c.Expect(<-input.started, gs.IsTrue)
+			c.Expect(input.inits, gs.Equals, 2)
+			singleton.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		})
+	})
+}
@@ -19,14 +19,18 @@ package pipeline
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
@@ -37,6 +41,7 @@ import (
 
 const (
 	HEKA_DAEMON     = "hekad"
+	NAMED_PIPELINES = "pipeline"
 	invalidEnvChars = "\n\r\t "
 )
 
@@ -159,8 +164,14 @@ type PipelineConfig struct {
 	// PipelinePack supply for Filter plugins (separate pool prevents
 	// deadlocks).
 	injectRecycleChan chan *PipelinePack
-	// Stores log messages generated by plugin config errors.
+	// Stores log messages generated by plugin config errors and warnings.
 	LogMsgs []string
+	// Hides the secrets in plugin configs shown by the admin API, state
+	// dumps and config checks.
+	redactor *configRedactor
+	// Warnings about deprecated options used by plugin configs.
+	configWarnings     []ConfigWarning
+	configWarningsLock sync.Mutex
 	// Lock protecting access to the set of running filters so dynamic filters
 	// can be safely added and removed while Heka is running.
 	filtersLock sync.RWMutex
@@ -187,8 +198,16 @@ type PipelineConfig struct {
 	allEncoders map[string]Encoder
 	// Mutex protecting allEncoders.
 	allEncodersLock sync.RWMutex
+	// Map providing access to the Processors of all of the inputs' processor
+	// chains.
+	allProcessors map[string]*processorStage
+	// Mutex protecting allProcessors.
+	allProcessorsLock sync.RWMutex
 	// Name of host on which Heka is running.
 	hostname string
+	// Host metadata fields added to injected messages, nil if there are
+	// none.
+	hostFields *hostFields
 	// Heka process id.
 	pid int32
 	// Lock protecting access to the set of running inputs so they
@@ -201,6 +220,46 @@ type PipelineConfig struct {
 	outputsLock sync.RWMutex
 	// Internal reporting channel.
 	reportRecycleChan chan *PipelinePack
+	// Per-tenant quota enforcement, nil if tenancy isn't configured.
+	tenants *TenantRegistry
+	// Limit on messages injected by all filters and outputs, nil if there's
+	// no max_inject_rate.
+	injectLimit *injectLimit
+	// Bandwidth shared by the outputs with shared_egress_limit set, nil if
+	// there's no global max_egress_bytes_per_sec.
+	egressBucket *byteBucket
+	// Throttles the diagnostics sent by ReportMessageLoop.
+	loops *loopReporter
+	// Admin API entries of stoppable plugins that have exited, by category
+	// and name.
+	ended map[string]*adminPlugin
+	// Mutex protecting ended.
+	endedLock sync.Mutex
+	// Leader election for singleton inputs, nil if clustering isn't
+	// configured.
+	elector LeaderElector
+	// Membership of the gossip mesh, nil if gossip isn't configured or the
+	// pipeline isn't running.
+	gossip *gossipMesh
+	// Storage for input positions.
+	checkpointer Checkpointer
+	// Where the records splitters and decoders panic on are kept, nil if
+	// they aren't.
+	quarantine *Quarantine
+	// Reports input pack pool exhaustion, nil until the pipeline is running.
+	starvation *starvationMonitor
+	// Is freed when all Output runners have stopped.
+	outputsWg sync.WaitGroup
+	// Closed to stop the pack diagnostics, and message loop diagnostics
+	// still waiting to be sent, once the pipeline has stopped.
+	diagnosticsStop chan struct{}
+	// Shadow comparisons, by primary output name.
+	shadows map[string]*ShadowTracker
+	// Mutex protecting shadows.
+	shadowsLock sync.RWMutex
+	// Decoder and processor chains inputs can refer to by name, from the
+	// `[pipeline.<name>]` config sections.
+	namedPipelines map[string]*NamedPipelineConfig
 
 	// The next few values are used only during the initial configuration
 	// loading process.
@@ -211,6 +270,9 @@ type PipelineConfig struct {
 	makersByCategory map[string][]PluginMaker
 	// Number of config loading errors.
 	errcnt uint
+	// Digest of the config files loaded, after environment variable
+	// substitution.
+	configDigest hash.Hash
 }
 
 // Creates and initializes a PipelineConfig object. `nil` value for `globals`
@@ -228,23 +290,54 @@ func NewPipelineConfig(globals *GlobalConfigStruct) (config *PipelineConfig) {
 	config.makers["Encoder"] = make(map[string]PluginMaker)
 	config.makers["Output"] = make(map[string]PluginMaker)
 	config.makers["Splitter"] = make(map[string]PluginMaker)
+	config.makers["Processor"] = make(map[string]PluginMaker)
 	config.DecoderMakers = config.makers["Decoder"]
 
 	config.InputRunners = make(map[string]InputRunner)
 	config.FilterRunners = make(map[string]FilterRunner)
 	config.OutputRunners = make(map[string]OutputRunner)
+	config.shadows = make(map[string]*ShadowTracker)
 
 	config.allEncoders = make(map[string]Encoder)
+	config.allProcessors = make(map[string]*processorStage)
 	config.router = NewMessageRouter(globals.PluginChanSize, globals.abortChan)
 	config.inputRecycleChan = make(chan *PipelinePack, globals.PoolSize)
 	config.injectRecycleChan = make(chan *PipelinePack, globals.PoolSize)
 	config.LogMsgs = make([]string, 0, 4)
+	config.redactor = newConfigRedactor(globals)
 	config.allDecoders = make([]DecoderRunner, 0, 10)
 	config.allSyncDecoders = make([]ReportingDecoder, 0, 10)
 	config.allSplitters = make([]SplitterRunner, 0, 10)
 	config.hostname = globals.Hostname
+	if globals.HostMetadata != nil {
+		config.hostFields = newHostFields(globals.HostInfo, globals.HostMetadata.FieldPrefix,
+			globals.Hostname)
+	}
 	config.pid = int32(os.Getpid())
 	config.reportRecycleChan = make(chan *PipelinePack, 1)
+	if globals.Tenancy != nil {
+		config.tenants = NewTenantRegistry(globals.Tenancy)
+	}
+	config.injectLimit = newInjectLimit("max_inject_rate", globals.MaxInjectRate)
+	config.egressBucket = newByteBucket(globals.MaxEgressBytesPerSec,
+		globals.EgressBurstBytes, time.Now())
+	config.loops = newLoopReporter()
+	config.quarantine = NewQuarantine(filepath.Join(globals.BaseDir, "quarantine"),
+		globals.QuarantineMaxSize)
+	if globals.Cluster != nil {
+		var err error
+		if config.elector, err = NewLeaderElector(globals.Cluster, globals.Hostname); err != nil {
+			LogError.Printf("Can't set up cluster coordination: %s", err)
+		} else if e, ok := config.elector.(*leaderElector); ok && globals.Pipeline != "" {
+			// Same named inputs of other pipelines are separate singletons.
+			e.prefix += globals.Pipeline + "/"
+		}
+	}
+	var err error
+	if config.checkpointer, err = NewCheckpointer(globals.Checkpoints, globals); err != nil {
+		LogError.Printf("Can't set up checkpoint storage, using base_dir: %s", err)
+		config.checkpointer, _ = NewCheckpointer(nil, globals)
+	}
 
 	return config
 }
@@ -253,14 +346,27 @@ func NewPipelineConfig(globals *GlobalConfigStruct) (config *PipelineConfig) {
 // objects they are holding. Returns a PipelinePack for injection into Heka
 // pipeline, or nil if the msgLoopCount is above the configured maximum.
 func (self *PipelineConfig) PipelinePack(msgLoopCount uint) (*PipelinePack, error) {
+	return self.pipelinePack(msgLoopCount, nil)
+}
+
+// PipelinePack that also gives up with an AbortError when stop is closed.
+func (self *PipelineConfig) pipelinePack(msgLoopCount uint,
+	stop <-chan struct{}) (*PipelinePack, error) {
+
 	if msgLoopCount++; msgLoopCount > self.Globals.MaxMsgLoops {
-		return nil, fmt.Errorf("exceeded MaxMsgLoops = %d", self.Globals.MaxMsgLoops)
+		return nil, MsgLoopsError(self.Globals.MaxMsgLoops)
 	}
 	var pack *PipelinePack
 	select {
 	case pack = <-self.injectRecycleChan:
 	case <-self.Globals.abortChan:
 		return nil, AbortError
+	case <-stop:
+		return nil, AbortError
+	}
+	if self.Globals.PackLeakDeadline > 0 {
+		// The plugin asking isn't known here.
+		pack.diagnostics.SetBorrower("")
 	}
 	pack.Message.SetTimestamp(time.Now().UnixNano())
 	pack.Message.SetUuid(uuid.NewRandom())
@@ -276,6 +382,60 @@ func (self *PipelineConfig) Router() MessageRouter {
 	return self.router
 }
 
+// Returns the key/value cache shared by all of the process's plugins.
+func (self *PipelineConfig) KVCache() *KVCache {
+	return self.Globals.KVCache()
+}
+
+// Returns the counters and gauges shared by all of the process's plugins.
+func (self *PipelineConfig) Counters() *Counters {
+	return self.Globals.Counters()
+}
+
+// Returns the storage inputs keep their positions in.
+func (self *PipelineConfig) Checkpointer() Checkpointer {
+	return self.checkpointer
+}
+
+// LoadStateFile fetches the state stored under key from an external
+// checkpoint store into the file at path, for plugins such as the sandboxes
+// that read and write their state files themselves. A file already at path
+// is left alone if the store has nothing for the key. Does nothing when
+// checkpoints are kept in files under base_dir.
+func (self *PipelineConfig) LoadStateFile(key, path string) error {
+	if _, ok := self.checkpointer.(*fileCheckpointer); ok {
+		return nil
+	}
+	value, err := self.checkpointer.Get(key)
+	if value == nil || err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, value, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SaveStateFile stores the file at path under key in an external checkpoint
+// store, or deletes the key if there's no file. Does nothing when
+// checkpoints are kept in files under base_dir.
+func (self *PipelineConfig) SaveStateFile(key, path string) error {
+	if _, ok := self.checkpointer.(*fileCheckpointer); ok {
+		return nil
+	}
+	value, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return self.checkpointer.Delete(key)
+	} else if err != nil {
+		return err
+	}
+	return self.checkpointer.Set(key, value)
+}
+
 // Returns the inputRecycleChannel.
 func (self *PipelineConfig) InputRecycleChan() chan *PipelinePack {
 	return self.inputRecycleChan
@@ -448,6 +608,12 @@ func (self *PipelineConfig) RemoveFilterRunner(name string) bool {
 	if fRunner, ok := self.FilterRunners[name]; ok {
 		self.router.RemoveFilterMatcher() <- fRunner.MatchRunner()
 		delete(self.FilterRunners, name)
+		// Additional instances stop along with the matcher they share.
+		if dispatch := fRunner.MatchRunner().dispatch; dispatch != nil {
+			for _, instance := range dispatch.instances {
+				delete(self.FilterRunners, instance.name)
+			}
+		}
 		return true
 	}
 	return false
@@ -550,7 +716,7 @@ func (self *PipelineConfig) log(msg string) {
 }
 
 // PluginTypeRegex 插件类型 有5种，都是在名字或者type上可以看出来的
-var PluginTypeRegex = regexp.MustCompile("(Decoder|Encoder|Filter|Input|Output|Splitter)$")
+var PluginTypeRegex = regexp.MustCompile("(Decoder|Encoder|Filter|Input|Output|Processor|Splitter)$")
 
 func getPluginCategory(pluginType string) string {
 	pluginCats := PluginTypeRegex.FindStringSubmatch(pluginType)
@@ -589,6 +755,47 @@ type CommonInputConfig struct {
 	LogDecodeFailures  *bool `toml:"log_decode_failures"`
 	CanExit            *bool `toml:"can_exit"`
 	Retries            RetryOptions
+	// Tenant name stamped onto every message from this input.
+	Tenant string `toml:"tenant"`
+	// Name of a message field (e.g. TcpInput's TlsTenant or KafkaInput's
+	// Topic) whose value is used as the tenant name, falling back to Tenant.
+	TenantFromField string `toml:"tenant_from_field"`
+	// Set to true to only run the input on whichever node of the cluster
+	// currently leads for it.
+	Singleton bool `toml:"singleton"`
+	// Tags or corrects message timestamps too far from when the messages are
+	// received.
+	ClockSkew *ClockSkewConfig `toml:"clock_skew"`
+	// Largest encoded message the input delivers, overriding the global
+	// max_message_size.
+	MaxMessageSize uint32 `toml:"max_message_size"`
+	// What's done with larger messages, "drop" (the default), "truncate" to
+	// cut down the payload, "route" to change their type, or "chunk" to split
+	// them into linked chunk messages.
+	OversizePolicy string `toml:"oversize_policy"`
+	// Type given to oversize messages by the "route" policy. Defaults to
+	// "heka.oversize".
+	OversizeType string `toml:"oversize_type"`
+	// Processors run in turn on each message, after decoding and before
+	// routing.
+	Processors []string `toml:"processors"`
+	// Name of a `[pipeline.<name>]` section whose decoder is used unless
+	// Decoder is set, and whose processors run before Processors.
+	Pipeline string `toml:"pipeline"`
+}
+
+type CommonDecoderConfig struct {
+	// The same as the input settings, applied to the decoder's messages in
+	// place of those of the input using it.
+	MaxMessageSize uint32 `toml:"max_message_size"`
+	OversizePolicy string `toml:"oversize_policy"`
+	OversizeType   string `toml:"oversize_type"`
+}
+
+type CommonProcessorConfig struct {
+	// Only messages matching this are processed, others are passed on
+	// untouched. Defaults to processing all messages.
+	Matcher string `toml:"message_matcher"`
 }
 
 type CommonFOConfig struct {
@@ -601,6 +808,50 @@ type CommonFOConfig struct {
 	UseFraming   *bool              `toml:"use_framing"` // Output only.
 	UseBuffering *bool              `toml:"use_buffering"`
 	Buffering    *QueueBufferConfig `toml:"buffering"`
+	// Messages older than this, going by their timestamps, are skipped
+	// rather than processed, e.g. "10m". Defaults to processing all.
+	MaxMessageAge string `toml:"max_message_age"`
+	// Name of an output to copy a sample of this one's messages to, for
+	// comparing their encodings. Output only.
+	Shadow string `toml:"shadow"`
+	// Percentage of messages copied to the shadow. Defaults to 100.
+	ShadowPercent float64 `toml:"shadow_percent"`
+	// Stops delivery attempts for a while once too many fail. Output only,
+	// and requires use_buffering.
+	CircuitBreaker *CircuitBreakerConfig `toml:"circuit_breaker"`
+	// Delivery latency objective, checked against the p99. Output only.
+	LatencySlo *LatencySloConfig `toml:"latency_slo"`
+	// Number of identical instances of the plugin to run behind its matcher,
+	// to spread its load across cores. Filter only, defaults to 1.
+	Instances uint `toml:"instances"`
+	// How messages are shared among the instances, "round_robin" (the
+	// default) or "hash", keeping each message source on one instance.
+	Dispatch string `toml:"dispatch"`
+	// Hashes this instead of the message source, e.g. "Fields[user_id]", so
+	// that messages with the same key always go to the same instance.
+	ShardBy string `toml:"shard_by"`
+	// Encoders run in turn in place of Encoder, each after the first
+	// transforming the bytes produced by the one before. Output only.
+	EncoderChain []string `toml:"encoder_chain"`
+	// Version of the stream framing applied with use_framing, 1 (the
+	// default) or 2, which adds per-record checksums. Output only.
+	FramingVersion uint `toml:"framing_version"`
+	// Maximum sustained rate of messages per second the plugin can inject,
+	// shared by all of a filter's instances. Defaults to unlimited.
+	MaxInjectRate uint `toml:"max_inject_rate"`
+	// Maximum sustained bytes per second an output sends, as encoded.
+	// Defaults to unlimited. Output only.
+	MaxEgressBytesPerSec uint64 `toml:"max_egress_bytes_per_sec"`
+	// Bytes an output can send at once after being idle. Defaults to one
+	// second's worth of max_egress_bytes_per_sec. Output only.
+	EgressBurstBytes uint64 `toml:"egress_burst_bytes"`
+	// Whether an output's sends also count against hekad's global egress
+	// limit. Output only.
+	SharedEgressLimit bool `toml:"shared_egress_limit"`
+	// Media type of what the output's encoder produces, in place of the one
+	// the encoder declares, e.g. for a PayloadEncoder passing on payloads
+	// already in the format the output needs. Output only.
+	ContentType string `toml:"content_type"`
 }
 
 type CommonSplitterConfig struct {
@@ -662,6 +913,10 @@ func (self *PipelineConfig) PreloadFromConfigFile(filename string) error {
 	if err != nil {
 		return err
 	}
+	if self.configDigest == nil {
+		self.configDigest = sha256.New()
+	}
+	self.configDigest.Write([]byte(contents))
 	// TOML 解析成 configFile
 	if _, err = toml.Decode(contents, &configFile); err != nil {
 		return fmt.Errorf("Error decoding config file: %s", err)
@@ -680,6 +935,13 @@ func (self *PipelineConfig) PreloadFromConfigFile(filename string) error {
 		if name == HEKA_DAEMON {
 			continue
 		}
+		if name == NAMED_PIPELINES {
+			if err = self.preloadNamedPipelines(conf); err != nil {
+				self.log(err.Error())
+				self.errcnt++
+			}
+			continue
+		}
 		if _, ok := self.defaultConfigs[name]; ok {
 			self.defaultConfigs[name] = true
 		}
@@ -706,6 +968,35 @@ func (self *PipelineConfig) PreloadFromConfigFile(filename string) error {
 	return nil
 }
 
+// PreloadFromConfigPath calls PreloadFromConfigFile for the specified file or,
+// if path is a directory, for each of the *.toml files it contains.
+func (self *PipelineConfig) PreloadFromConfigPath(path string) error {
+	p, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening file: %s", err.Error())
+	}
+	fi, err := p.Stat()
+	p.Close()
+	if err != nil {
+		return fmt.Errorf("can't stat file: %s", err.Error())
+	}
+	if !fi.IsDir() {
+		return self.PreloadFromConfigFile(path)
+	}
+	files, _ := ioutil.ReadDir(path)
+	for _, f := range files {
+		fName := f.Name()
+		if !strings.HasSuffix(fName, ".toml") {
+			// Skip non *.toml files in a config dir.
+			continue
+		}
+		if err = self.PreloadFromConfigFile(filepath.Join(path, fName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // LoadConfig any not yet preloaded default plugins, then it finishes loading
 // and initializing all of the plugin config that has been prepped from calls
 // to PreloadFromConfigFile. This method should be called only once, after
@@ -749,10 +1040,11 @@ func (self *PipelineConfig) LoadConfig() error {
 	makersByCategory["Decoder"] = append(makersByCategory["Decoder"],
 		makersByCategory["MultiDecoder"]...)
 
-	// Force decoders and encoders to be loaded before the other plugin
-	// types are initialized so we know they'll be there for inputs and
-	// outputs to use during initialization.
-	order := []string{"Decoder", "Encoder", "Splitter", "Input", "Filter", "Output"}
+	// Force decoders, encoders and processors to be loaded before the other
+	// plugin types are initialized so we know they'll be there for inputs
+	// and outputs to use during initialization.
+	order := []string{"Decoder", "Encoder", "Processor", "Splitter", "Input", "Filter",
+		"Output"}
 	for _, category := range order {
 		for _, maker := range makersByCategory[category] {
 			LogInfo.Printf("Loading: [%s]\n", maker.Name())
@@ -761,7 +1053,7 @@ func (self *PipelineConfig) LoadConfig() error {
 				self.errcnt++
 			}
 			self.makers[category][maker.Name()] = maker
-			if category == "Encoder" {
+			if category == "Encoder" || category == "Processor" {
 				continue
 			}
 			runner, err := maker.MakeRunner("") // todo xx 这里才是运行插件 找对应的插件运行
@@ -787,6 +1079,20 @@ func (self *PipelineConfig) LoadConfig() error {
 				self.InputRunners[maker.Name()] = runner.(InputRunner)
 			case "Filter":
 				self.FilterRunners[maker.Name()] = runner.(FilterRunner)
+				fRunner, ok := runner.(*foRunner)
+				if !ok || fRunner.config.Instances <= 1 {
+					continue
+				}
+				instances, err := self.makeFilterInstances(maker, fRunner)
+				if err != nil {
+					self.log(fmt.Sprintf("Error making instances of %s: %s",
+						maker.Name(), err))
+					self.errcnt++
+					continue
+				}
+				for _, instance := range instances[1:] {
+					self.FilterRunners[instance.name] = instance
+				}
 			case "Output":
 				self.OutputRunners[maker.Name()] = runner.(OutputRunner)
 			}
@@ -0,0 +1,150 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Writes the effective configs of makers, with their secrets redacted, to w
+// as TOML, a section per plugin. The makers whose configs can't be decoded
+// are returned with their errors instead.
+func (self *PipelineConfig) writeEffectiveConfig(w io.Writer, makers []PluginMaker) (
+	errs []error, err error) {
+
+	sections := make(map[string]interface{}, len(makers))
+	for _, maker := range makers {
+		fields, e := self.makerConfig(maker)
+		if e != nil {
+			errs = append(errs, fmt.Errorf("Error loading config for %s: %s", maker.Name(), e))
+			continue
+		}
+		if _, ok := fields["type"]; !ok {
+			fields["type"] = maker.Type()
+		}
+		sections[maker.Name()] = fields
+	}
+	if len(sections) > 0 {
+		err = toml.NewEncoder(w).Encode(sections)
+	}
+	return errs, err
+}
+
+// Returns the makers of the PipelineConfig's plugins, or of those preloaded
+// from the config files if LoadConfig hasn't run, sorted by name.
+func (self *PipelineConfig) allMakers() []PluginMaker {
+	seen := make(map[string]bool)
+	var makers []PluginMaker
+	add := func(maker PluginMaker) {
+		if !seen[maker.Name()] {
+			seen[maker.Name()] = true
+			makers = append(makers, maker)
+		}
+	}
+	self.makersLock.RLock()
+	for _, byName := range self.makers {
+		for _, maker := range byName {
+			add(maker)
+		}
+	}
+	self.makersLock.RUnlock()
+	for _, preloaded := range self.makersByCategory {
+		for _, maker := range preloaded {
+			add(maker)
+		}
+	}
+	sort.Slice(makers, func(i, j int) bool {
+		return makers[i].Name() < makers[j].Name()
+	})
+	return makers
+}
+
+// Returns errors for the decoders, splitters, processors, encoders and named
+// pipelines a plugin's common config refers to that aren't configured.
+func (self *PipelineConfig) checkReferences(maker PluginMaker,
+	configured map[string]bool) (errs []error) {
+
+	check := func(what, name string) {
+		if name != "" && name != "none" && !configured[name] {
+			errs = append(errs, fmt.Errorf("%s refers to %s '%s', which isn't configured",
+				maker.Name(), what, name))
+		}
+	}
+	mutable, ok := maker.(MutableMaker)
+	if !ok {
+		return nil
+	}
+	common, err := mutable.OrigPrepCommonTypedConfig()
+	if err != nil {
+		return nil // Reported along with the rest of its config.
+	}
+	switch c := common.(type) {
+	case CommonInputConfig:
+		check("decoder", c.Decoder)
+		check("splitter", c.Splitter)
+		for _, name := range c.Processors {
+			check("processor", name)
+		}
+		if _, ok := self.namedPipelines[c.Pipeline]; c.Pipeline != "" && !ok {
+			errs = append(errs, fmt.Errorf("%s refers to pipeline '%s', which isn't "+
+				"configured", maker.Name(), c.Pipeline))
+		}
+	case CommonFOConfig:
+		if maker.Category() == "Output" {
+			check("encoder", c.Encoder)
+			for _, name := range c.EncoderChain {
+				check("encoder", name)
+			}
+		}
+	}
+	return errs
+}
+
+// CheckConfig decodes the config of every plugin preloaded from the config
+// files, without initializing or starting any, and checks that the plugins
+// they refer to are configured. It writes their effective configs, i.e. after
+// environment variable substitution and with defaults filled in, to w as
+// TOML with their secrets redacted. Returns an error if the config files had
+// any errors, which are logged along the way.
+func (self *PipelineConfig) CheckConfig(w io.Writer) error {
+	if len(self.makersByCategory) == 0 && self.errcnt == 0 {
+		return errors.New("Empty configuration")
+	}
+	makers := self.allMakers()
+	errs, err := self.writeEffectiveConfig(w, makers)
+	if err != nil {
+		return fmt.Errorf("can't write effective config: %s", err)
+	}
+	configured := makeDefaultConfigs()
+	for _, maker := range makers {
+		configured[maker.Name()] = true
+	}
+	for _, maker := range makers {
+		errs = append(errs, self.checkReferences(maker, configured)...)
+	}
+	for _, e := range errs {
+		self.log(e.Error())
+		self.errcnt++
+	}
+	if self.errcnt != 0 {
+		return fmt.Errorf("%d errors in config", self.errcnt)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rafrombrc/go-notify"
+)
+
+// The symlink Kubernetes swaps to update ConfigMap and Secret volumes.
+const k8sDataLink = "..data"
+
+// Config watch settings, from the `[hekad.config_watch]` config section.
+// A change only reopens files and TLS certificates, as a SIGHUP does, so
+// there's no default path: watching hekad's own config would promise a
+// reload of its plugins that doesn't happen.
+type ConfigWatchConfig struct {
+	// Files and directories watched. Required.
+	Paths []string `toml:"paths"`
+	// Seconds between checks. Defaults to 10.
+	PollInterval uint `toml:"poll_interval"`
+}
+
+// Validate checks that the settings are usable.
+func (c *ConfigWatchConfig) Validate() error {
+	if len(c.Paths) == 0 {
+		return errors.New("paths must be set")
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = 10
+	}
+	return nil
+}
+
+// Returns a string which changes when the file or directory at path does. A
+// Kubernetes ConfigMap or Secret volume changes when its data symlink is
+// swapped to the directory of the new contents, anything else when the
+// files' sizes, modification times or, for those that are symlinks, targets
+// do.
+func mountFingerprint(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return fileFingerprint(path, fi), nil
+	}
+	if target, err := os.Readlink(filepath.Join(path, k8sDataLink)); err == nil {
+		return k8sDataLink + " " + target, nil
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		entryPath := filepath.Join(path, entry.Name())
+		if fi, err = os.Stat(entryPath); err != nil || fi.IsDir() {
+			continue
+		}
+		buf.WriteString(fileFingerprint(entryPath, fi))
+		buf.WriteByte('\n')
+	}
+	return buf.String(), nil
+}
+
+func fileFingerprint(path string, fi os.FileInfo) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		resolved = path
+	}
+	return fmt.Sprintf("%s %s %d %d", path, resolved, fi.Size(), fi.ModTime().UnixNano())
+}
+
+// Polls the watched paths, posting the reload notification a SIGHUP does
+// when any of them changes, until stop is closed.
+func watchConfig(config *ConfigWatchConfig, stop chan struct{}) {
+	fingerprints := make(map[string]string, len(config.Paths))
+	for _, path := range config.Paths {
+		fp, err := mountFingerprint(path)
+		if err != nil {
+			LogError.Printf("Can't watch '%s' for config changes: %s", path, err)
+		}
+		fingerprints[path] = fp
+	}
+	ticker := time.NewTicker(time.Duration(config.PollInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		changed := ""
+		for _, path := range config.Paths {
+			fp, err := mountFingerprint(path)
+			if err != nil {
+				// Usually a swap in progress, the next check will see it.
+				continue
+			}
+			if fp != fingerprints[path] {
+				if fingerprints[path] != "" && changed == "" {
+					changed = path
+				}
+				fingerprints[path] = fp
+			}
+		}
+		if changed != "" {
+			LogInfo.Printf("Change to '%s' detected, reload initiated.", changed)
+			if err := notify.Post(RELOAD, nil); err != nil {
+				LogError.Println("Error sending reload event: ", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rafrombrc/go-notify"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func ConfigWatchSpec(c gs.Context) {
+	tmpDir, err := ioutil.TempDir("", "config-watch-tests")
+	c.Assume(err, gs.IsNil)
+	defer os.RemoveAll(tmpDir)
+
+	// Swaps the ..data symlink to a new directory holding hekad.toml, as the
+	// kubelet updates ConfigMap volumes.
+	swap := func(version, contents string) {
+		dir := filepath.Join(tmpDir, version)
+		os.Mkdir(dir, 0755)
+		ioutil.WriteFile(filepath.Join(dir, "hekad.toml"), []byte(contents), 0644)
+		link := filepath.Join(tmpDir, "..data_tmp")
+		os.Symlink(version, link)
+		os.Rename(link, filepath.Join(tmpDir, k8sDataLink))
+	}
+
+	c.Specify("mountFingerprint", func() {
+		c.Specify("changes when a ConfigMap is swapped", func() {
+			swap("..v1", "[a]")
+			os.Symlink(filepath.Join(k8sDataLink, "hekad.toml"),
+				filepath.Join(tmpDir, "hekad.toml"))
+			dirFp, err := mountFingerprint(tmpDir)
+			c.Expect(err, gs.IsNil)
+			fileFp, err := mountFingerprint(filepath.Join(tmpDir, "hekad.toml"))
+			c.Expect(err, gs.IsNil)
+
+			swap("..v2", "[a]")
+			newDirFp, _ := mountFingerprint(tmpDir)
+			c.Expect(newDirFp == dirFp, gs.IsFalse)
+			newFileFp, _ := mountFingerprint(filepath.Join(tmpDir, "hekad.toml"))
+			c.Expect(newFileFp == fileFp, gs.IsFalse)
+		})
+
+		c.Specify("changes when a plain directory's files change", func() {
+			path := filepath.Join(tmpDir, "a.toml")
+			ioutil.WriteFile(path, []byte("[a]"), 0644)
+			fp, err := mountFingerprint(tmpDir)
+			c.Expect(err, gs.IsNil)
+			again, _ := mountFingerprint(tmpDir)
+			c.Expect(again, gs.Equals, fp)
+
+			later := time.Now().Add(time.Minute)
+			os.Chtimes(path, later, later)
+			changed, _ := mountFingerprint(tmpDir)
+			c.Expect(changed == fp, gs.IsFalse)
+		})
+
+		c.Specify("fails for a missing path", func() {
+			_, err := mountFingerprint(filepath.Join(tmpDir, "missing"))
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+
+	c.Specify("watchConfig posts a reload when the config changes", func() {
+		swap("..v1", "[a]")
+		reloads := make(chan interface{}, 1)
+		notify.Start(RELOAD, reloads)
+		defer notify.Stop(RELOAD, reloads)
+		stop := make(chan struct{})
+		defer close(stop)
+		config := &ConfigWatchConfig{Paths: []string{tmpDir}, PollInterval: 1}
+		go watchConfig(config, stop)
+
+		time.Sleep(100 * time.Millisecond)
+		swap("..v2", "[b]")
+		select {
+		case <-reloads:
+		case <-time.After(3 * time.Second):
+			c.Expect("reload", gs.Equals, "not posted")
+		}
+	})
+
+	c.Specify("ConfigWatchConfig", func() {
+		config := &ConfigWatchConfig{}
+		c.Expect(config.Validate(), gs.Not(gs.IsNil))
+		config.Paths = []string{tmpDir}
+		c.Expect(config.Validate(), gs.IsNil)
+		c.Expect(config.PollInterval, gs.Equals, uint(10))
+	})
+}
@@ -0,0 +1,233 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+
+	"heka/message"
+)
+
+// Transport metadata a listening input writes to its messages, from its
+// `connection_fields` config subsection.
+type ConnFieldsConfig struct {
+	// Metadata written to each message, any of "remote_addr", "remote_port",
+	// "local_port", "tls_version", "tls_cipher" and "protocol". Empty means
+	// none.
+	Fields []string `toml:"fields"`
+	// Prefix of the message field names, e.g. "ConnRemoteAddr" for
+	// remote_addr with a prefix of "Conn".
+	Prefix string `toml:"prefix"`
+}
+
+// Message field names of the metadata, before the prefix.
+var connFieldNames = map[string]string{
+	"remote_addr": "RemoteAddr",
+	"remote_port": "RemotePort",
+	"local_port":  "LocalPort",
+	"tls_version": "TlsVersion",
+	"tls_cipher":  "TlsCipher",
+	"protocol":    "Protocol",
+}
+
+// Kinds of metadata that are integers.
+var connMetadataInts = map[string]bool{
+	"remote_port": true,
+	"local_port":  true,
+}
+
+var tlsVersionNames = map[uint16]string{
+	tls.VersionSSL30: "SSL 3.0",
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// Pack metadata key prefix of stashed connection metadata.
+const connMetadataPrefix = "conn."
+
+// The transport metadata of a connection, or of a datagram or request.
+// Empty values are left out of messages.
+type ConnMetadata struct {
+	RemoteAddr string
+	RemotePort int
+	LocalPort  int
+	TlsVersion string
+	TlsCipher  string
+	// The protocol spoken, e.g. the HTTP version of a request.
+	Protocol string
+}
+
+// NewConnMetadata returns the metadata of a connection, including its TLS
+// settings if it's a TLS connection whose handshake is complete.
+func NewConnMetadata(conn net.Conn) *ConnMetadata {
+	md := new(ConnMetadata)
+	if addr := conn.RemoteAddr(); addr != nil {
+		md.SetRemote(addr.String())
+	}
+	if addr := conn.LocalAddr(); addr != nil {
+		md.SetLocal(addr.String())
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		md.SetTls(&state)
+	}
+	return md
+}
+
+// SetRemote sets the remote address and port from a "host:port" address.
+// Other addresses, such as those of Unix sockets, are used as they are.
+func (md *ConnMetadata) SetRemote(addr string) {
+	md.RemoteAddr, md.RemotePort = splitConnAddr(addr)
+}
+
+// SetLocal sets the local port from a "host:port" address.
+func (md *ConnMetadata) SetLocal(addr string) {
+	_, md.LocalPort = splitConnAddr(addr)
+}
+
+// SetTls sets the TLS version and cipher suite, if state is of a completed
+// handshake.
+func (md *ConnMetadata) SetTls(state *tls.ConnectionState) {
+	if state == nil || !state.HandshakeComplete {
+		return
+	}
+	md.TlsVersion = tlsVersionNames[state.Version]
+	if md.TlsVersion == "" {
+		md.TlsVersion = fmt.Sprintf("0x%04x", state.Version)
+	}
+	md.TlsCipher = tls.CipherSuiteName(state.CipherSuite)
+}
+
+func splitConnAddr(addr string) (host string, port int) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	port, _ = strconv.Atoi(portStr)
+	return host, port
+}
+
+// Returns the metadata value of the given kind, "" or 0 if unknown.
+func (md *ConnMetadata) value(kind string) interface{} {
+	switch kind {
+	case "remote_addr":
+		return md.RemoteAddr
+	case "remote_port":
+		return md.RemotePort
+	case "local_port":
+		return md.LocalPort
+	case "tls_version":
+		return md.TlsVersion
+	case "tls_cipher":
+		return md.TlsCipher
+	case "protocol":
+		return md.Protocol
+	}
+	return nil
+}
+
+// Writes the metadata chosen by a ConnFieldsConfig to messages, replacing
+// any fields of the same names that the client sent, so that downstream
+// plugins can base decisions on them.
+type ConnFields struct {
+	kinds []string
+	names []string
+}
+
+// NewConnFields returns nil if the config doesn't choose any metadata.
+func NewConnFields(conf ConnFieldsConfig) (*ConnFields, error) {
+	if len(conf.Fields) == 0 {
+		return nil, nil
+	}
+	cf := new(ConnFields)
+	for _, kind := range conf.Fields {
+		name, ok := connFieldNames[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown connection field '%s'", kind)
+		}
+		cf.kinds = append(cf.kinds, kind)
+		cf.names = append(cf.names, conf.Prefix+name)
+	}
+	return cf, nil
+}
+
+// Write replaces msg's connection fields with md's values.
+func (cf *ConnFields) Write(msg *message.Message, md *ConnMetadata) {
+	if cf == nil {
+		return
+	}
+	for i, kind := range cf.kinds {
+		cf.write(msg, cf.names[i], md.value(kind))
+	}
+}
+
+func (cf *ConnFields) write(msg *message.Message, name string, value interface{}) {
+	for f := msg.FindFirstField(name); f != nil; f = msg.FindFirstField(name) {
+		msg.DeleteField(f)
+	}
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			message.NewStringField(msg, name, v)
+		}
+	case int:
+		if v != 0 {
+			message.NewIntField(msg, name, v, "")
+		}
+	}
+}
+
+// Decorator returns a deliverer pack decorator writing md's fields to each
+// decoded message.
+func (cf *ConnFields) Decorator(md *ConnMetadata) func(*PipelinePack) {
+	return func(pack *PipelinePack) {
+		cf.Write(pack.Message, md)
+	}
+}
+
+// Stash records md in the pack's metadata, for inputs whose deliverer is
+// shared by connections or requests. It's written to the message by the
+// deliverer's StashedDecorator once the pack has been decoded, so that
+// decoders can't overwrite it.
+func (cf *ConnFields) Stash(pack *PipelinePack, md *ConnMetadata) {
+	for _, kind := range cf.kinds {
+		switch v := md.value(kind).(type) {
+		case string:
+			pack.SetMetadata(connMetadataPrefix+kind, v)
+		case int:
+			pack.SetMetadata(connMetadataPrefix+kind, strconv.Itoa(v))
+		}
+	}
+}
+
+// StashedDecorator returns a deliverer pack decorator writing the metadata
+// stashed in each pack to its message.
+func (cf *ConnFields) StashedDecorator() func(*PipelinePack) {
+	return func(pack *PipelinePack) {
+		for i, kind := range cf.kinds {
+			stashed, _ := pack.GetMetadata(connMetadataPrefix + kind)
+			var value interface{} = stashed
+			if connMetadataInts[kind] {
+				value, _ = strconv.Atoi(stashed)
+			}
+			cf.write(pack.Message, cf.names[i], value)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"crypto/tls"
+	"net"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+)
+
+func ConnFieldsSpec(c gs.Context) {
+	c.Specify("ConnFields", func() {
+		c.Specify("are nil when no metadata is chosen", func() {
+			cf, err := NewConnFields(ConnFieldsConfig{Prefix: "Conn"})
+			c.Expect(err, gs.IsNil)
+			c.Expect(cf == nil, gs.IsTrue)
+			// Writing with nil fields does nothing.
+			cf.Write(new(message.Message), new(ConnMetadata))
+		})
+
+		c.Specify("reject unknown metadata", func() {
+			_, err := NewConnFields(ConnFieldsConfig{Fields: []string{"remote_mac"}})
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		cf, err := NewConnFields(ConnFieldsConfig{Prefix: "Conn", Fields: []string{
+			"remote_addr", "remote_port", "local_port", "tls_version", "tls_cipher",
+			"protocol"}})
+		c.Assume(err, gs.IsNil)
+		md := &ConnMetadata{Protocol: "relay/3"}
+		md.SetRemote("10.1.2.3:40000")
+		md.SetLocal("[::]:5565")
+		md.SetTls(&tls.ConnectionState{HandshakeComplete: true,
+			Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256})
+
+		c.Specify("write the metadata, replacing what the client sent", func() {
+			msg := new(message.Message)
+			message.NewStringField(msg, "ConnRemoteAddr", "spoofed")
+			message.NewStringField(msg, "ConnRemoteAddr", "spoofed again")
+			cf.Write(msg, md)
+			c.Expect(len(msg.FindAllFields("ConnRemoteAddr")), gs.Equals, 1)
+			addr, _ := msg.GetFieldValue("ConnRemoteAddr")
+			c.Expect(addr, gs.Equals, "10.1.2.3")
+			port, _ := msg.GetFieldValue("ConnRemotePort")
+			c.Expect(port, gs.Equals, int64(40000))
+			port, _ = msg.GetFieldValue("ConnLocalPort")
+			c.Expect(port, gs.Equals, int64(5565))
+			version, _ := msg.GetFieldValue("ConnTlsVersion")
+			c.Expect(version, gs.Equals, "TLS 1.3")
+			cipher, _ := msg.GetFieldValue("ConnTlsCipher")
+			c.Expect(cipher, gs.Equals, "TLS_AES_128_GCM_SHA256")
+			protocol, _ := msg.GetFieldValue("ConnProtocol")
+			c.Expect(protocol, gs.Equals, "relay/3")
+		})
+
+		c.Specify("leave out what a connection doesn't have", func() {
+			msg := new(message.Message)
+			message.NewStringField(msg, "ConnTlsVersion", "TLS 1.3")
+			plain := new(ConnMetadata)
+			plain.SetRemote("/tmp/heka.sock")
+			cf.Write(msg, plain)
+			c.Expect(msg.FindFirstField("ConnTlsVersion") == nil, gs.IsTrue)
+			c.Expect(msg.FindFirstField("ConnRemotePort") == nil, gs.IsTrue)
+			addr, _ := msg.GetFieldValue("ConnRemoteAddr")
+			c.Expect(addr, gs.Equals, "/tmp/heka.sock")
+		})
+
+		c.Specify("survive decoding when stashed in the pack", func() {
+			pack := NewPipelinePack(nil)
+			cf.Stash(pack, md)
+			// A decoder replacing the message.
+			pack.Message = new(message.Message)
+			cf.StashedDecorator()(pack)
+			port, _ := pack.Message.GetFieldValue("ConnRemotePort")
+			c.Expect(port, gs.Equals, int64(40000))
+			cipher, _ := pack.Message.GetFieldValue("ConnTlsCipher")
+			c.Expect(cipher, gs.Equals, "TLS_AES_128_GCM_SHA256")
+		})
+	})
+
+	c.Specify("NewConnMetadata reads a connection's addresses", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		c.Assume(err, gs.IsNil)
+		defer listener.Close()
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		c.Assume(err, gs.IsNil)
+		defer conn.Close()
+		md := NewConnMetadata(conn)
+		c.Expect(md.RemoteAddr, gs.Equals, "127.0.0.1")
+		c.Expect(md.RemotePort, gs.Equals, listener.Addr().(*net.TCPAddr).Port)
+		c.Expect(md.LocalPort, gs.Equals, conn.LocalAddr().(*net.TCPAddr).Port)
+		c.Expect(md.TlsVersion, gs.Equals, "")
+	})
+}
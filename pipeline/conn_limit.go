@@ -0,0 +1,288 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+)
+
+// Connection limits of a listening input, from its `limits` config
+// subsection. Zero means no limit.
+type ConnLimitConfig struct {
+	// Maximum number of connections open at once.
+	MaxConnections uint `toml:"max_connections"`
+	// Maximum number of connections open at once from a single client IP
+	// address.
+	MaxClientConnections uint `toml:"max_client_connections"`
+	// Messages per second a client IP address may send, across all of its
+	// connections.
+	ClientMessageRate uint `toml:"client_message_rate"`
+	// Seconds a connection may go without delivering a complete message
+	// before it's closed, so that clients trickling data can't hold
+	// connections open.
+	IdleTimeout uint `toml:"idle_timeout"`
+}
+
+// Enforces an input's ConnLimitConfig on the connections it accepts, and
+// counts what it turns away.
+type ConnLimiter struct {
+	conf    ConnLimitConfig
+	lock    sync.Mutex
+	open    int
+	clients map[string]*connClient
+	// Accessed atomically.
+	rejected       int64
+	clientRejected int64
+	throttled      int64
+	idleClosed     int64
+}
+
+// A client IP address's open connections, and the rate its messages are
+// limited to.
+type connClient struct {
+	conns  int
+	bucket *tokenBucket
+}
+
+func NewConnLimiter(conf ConnLimitConfig) *ConnLimiter {
+	return &ConnLimiter{conf: conf, clients: make(map[string]*connClient)}
+}
+
+// Returns the IP address, or failing that the whole address, of a
+// connection's remote end.
+func ConnClient(conn net.Conn) string {
+	raddr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(raddr); err == nil {
+		return host
+	}
+	return raddr
+}
+
+// Listener wraps listener so that connections over the limits are closed as
+// soon as they're accepted. Connections must be wrapped for the client
+// message rate to apply.
+func (l *ConnLimiter) Listener(listener net.Listener) net.Listener {
+	if l.conf.MaxConnections == 0 && l.conf.MaxClientConnections == 0 &&
+		l.conf.ClientMessageRate == 0 {
+
+		return listener
+	}
+	return &limitListener{Listener: listener, limiter: l}
+}
+
+// Registers a new connection from client, or returns false if that would
+// exceed the limits.
+func (l *ConnLimiter) acquire(client string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.conf.MaxConnections > 0 && l.open >= int(l.conf.MaxConnections) {
+		atomic.AddInt64(&l.rejected, 1)
+		return false
+	}
+	c := l.clients[client]
+	if c == nil {
+		c = &connClient{bucket: newTokenBucket(l.conf.ClientMessageRate, time.Now())}
+		l.clients[client] = c
+	}
+	if l.conf.MaxClientConnections > 0 && c.conns >= int(l.conf.MaxClientConnections) {
+		atomic.AddInt64(&l.clientRejected, 1)
+		if c.conns == 0 {
+			delete(l.clients, client)
+		}
+		return false
+	}
+	c.conns++
+	l.open++
+	return true
+}
+
+func (l *ConnLimiter) release(client string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.open--
+	if c := l.clients[client]; c != nil {
+		if c.conns--; c.conns <= 0 {
+			delete(l.clients, client)
+		}
+	}
+}
+
+func (l *ConnLimiter) bucket(client string) *tokenBucket {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if c := l.clients[client]; c != nil {
+		return c.bucket
+	}
+	return nil
+}
+
+// AllowMessage tells whether client may send another message now, counting
+// the message as throttled if it can't. For inputs that can refuse
+// messages, such as with an HTTP 429 response.
+func (l *ConnLimiter) AllowMessage(client string) bool {
+	if l.bucket(client).take(time.Now()) {
+		return true
+	}
+	atomic.AddInt64(&l.throttled, 1)
+	return false
+}
+
+// WaitMessage blocks until client may send another message, or stop is
+// closed. For stream inputs, which then stop reading from the client.
+func (l *ConnLimiter) WaitMessage(client string, stop <-chan bool) {
+	bucket := l.bucket(client)
+	if bucket.take(time.Now()) {
+		return
+	}
+	atomic.AddInt64(&l.throttled, 1)
+	wait := time.Second / time.Duration(l.conf.ClientMessageRate)
+	for !bucket.take(time.Now()) {
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// WrapDeliverer wraps the deliverer of a connection from a limited listener,
+// throttling it to the client's message rate, and closing conn if no
+// message is delivered for longer than the idle timeout. The returned
+// function must be called once the connection is done with.
+func (l *ConnLimiter) WrapDeliverer(d Deliverer, conn net.Conn, stop <-chan bool) (
+	Deliverer, func()) {
+
+	if l.conf.ClientMessageRate == 0 && l.conf.IdleTimeout == 0 {
+		return d, func() {}
+	}
+	ld := &limitDeliverer{Deliverer: d, limiter: l, client: ConnClient(conn),
+		stop: stop, last: time.Now().UnixNano()}
+	if l.conf.IdleTimeout == 0 {
+		return ld, func() {}
+	}
+	done := make(chan struct{})
+	timeout := time.Duration(l.conf.IdleTimeout) * time.Second
+	go func() {
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				last := time.Unix(0, atomic.LoadInt64(&ld.last))
+				if now.Sub(last) > timeout {
+					atomic.AddInt64(&l.idleClosed, 1)
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+	return ld, func() { close(done) }
+}
+
+// ReportMsg adds the open connection count and the rejection counters to
+// an input's report message.
+func (l *ConnLimiter) ReportMsg(msg *message.Message) {
+	l.lock.Lock()
+	open := l.open
+	l.lock.Unlock()
+	message.NewInt64Field(msg, "Connections", int64(open), "count")
+	message.NewInt64Field(msg, "RejectedConnections", atomic.LoadInt64(&l.rejected),
+		"count")
+	message.NewInt64Field(msg, "RejectedClientConnections",
+		atomic.LoadInt64(&l.clientRejected), "count")
+	message.NewInt64Field(msg, "ThrottledMessages", atomic.LoadInt64(&l.throttled),
+		"count")
+	message.NewInt64Field(msg, "IdleConnectionsClosed", atomic.LoadInt64(&l.idleClosed),
+		"count")
+}
+
+type limitListener struct {
+	net.Listener
+	limiter *ConnLimiter
+}
+
+func (ll *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := ll.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		client := ConnClient(conn)
+		if ll.limiter.acquire(client) {
+			return &limitConn{Conn: conn, limiter: ll.limiter, client: client}, nil
+		}
+		conn.Close()
+	}
+}
+
+// A connection that's released from its limiter when closed.
+type limitConn struct {
+	net.Conn
+	limiter *ConnLimiter
+	client  string
+	once    sync.Once
+}
+
+func (lc *limitConn) Close() error {
+	lc.once.Do(func() {
+		lc.limiter.release(lc.client)
+	})
+	return lc.Conn.Close()
+}
+
+// Keep alive settings pass through to TCP connections.
+func (lc *limitConn) SetKeepAlive(keepalive bool) error {
+	if tcpConn, ok := lc.Conn.(*net.TCPConn); ok {
+		return tcpConn.SetKeepAlive(keepalive)
+	}
+	return errors.New("keep alive is only supported for TCP connections")
+}
+
+func (lc *limitConn) SetKeepAlivePeriod(d time.Duration) error {
+	if tcpConn, ok := lc.Conn.(*net.TCPConn); ok {
+		return tcpConn.SetKeepAlivePeriod(d)
+	}
+	return errors.New("keep alive is only supported for TCP connections")
+}
+
+type limitDeliverer struct {
+	Deliverer
+	limiter *ConnLimiter
+	client  string
+	stop    <-chan bool
+	// Nanosecond time of the last delivery, accessed atomically.
+	last int64
+}
+
+func (ld *limitDeliverer) Deliver(pack *PipelinePack) {
+	if ld.limiter.conf.ClientMessageRate > 0 {
+		ld.limiter.WaitMessage(ld.client, ld.stop)
+	}
+	atomic.StoreInt64(&ld.last, time.Now().UnixNano())
+	ld.Deliverer.Deliver(pack)
+}
+
+func (ld *limitDeliverer) DeliverFunc() DeliverFunc {
+	return ld.Deliver
+}
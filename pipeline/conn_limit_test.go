@@ -0,0 +1,179 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"net"
+	"time"
+
+	"heka/message"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+// Counts deliveries.
+type countingDeliverer struct {
+	delivered chan struct{}
+}
+
+func (d *countingDeliverer) Deliver(pack *PipelinePack) {
+	d.delivered <- struct{}{}
+}
+
+func (d *countingDeliverer) DeliverFunc() DeliverFunc {
+	return d.Deliver
+}
+
+func (d *countingDeliverer) SetPackDecorator(decorator func(*PipelinePack)) {}
+
+func (d *countingDeliverer) Done() {}
+
+func ConnLimitSpec(c gs.Context) {
+	c.Specify("A ConnLimiter", func() {
+		conf := ConnLimitConfig{}
+		report := func(limiter *ConnLimiter, name string) int64 {
+			msg := new(message.Message)
+			limiter.ReportMsg(msg)
+			value, _ := msg.GetFieldValue(name)
+			return value.(int64)
+		}
+
+		listen := func(limiter *ConnLimiter) (net.Listener, chan net.Conn) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			c.Assume(err, gs.IsNil)
+			listener = limiter.Listener(listener)
+			accepted := make(chan net.Conn, 10)
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					accepted <- conn
+				}
+			}()
+			return listener, accepted
+		}
+		// Dials the listener, returning the client end once the server end's
+		// accepted, or nil if it was turned away.
+		dial := func(listener net.Listener, accepted chan net.Conn) (net.Conn, net.Conn) {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			c.Assume(err, gs.IsNil)
+			select {
+			case server := <-accepted:
+				return conn, server
+			case <-time.After(200 * time.Millisecond):
+				conn.Close()
+				return nil, nil
+			}
+		}
+
+		c.Specify("leaves the listener alone without limits", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			c.Assume(err, gs.IsNil)
+			defer listener.Close()
+			c.Expect(NewConnLimiter(conf).Listener(listener) == listener, gs.IsTrue)
+		})
+
+		c.Specify("turns away connections over the maximum", func() {
+			conf.MaxConnections = 1
+			limiter := NewConnLimiter(conf)
+			listener, accepted := listen(limiter)
+			defer listener.Close()
+
+			first, server := dial(listener, accepted)
+			c.Assume(first, gs.Not(gs.IsNil))
+			second, _ := dial(listener, accepted)
+			c.Expect(second == nil, gs.IsTrue)
+			c.Expect(report(limiter, "RejectedConnections"), gs.Equals, int64(1))
+			c.Expect(report(limiter, "Connections"), gs.Equals, int64(1))
+
+			c.Specify("until one closes", func() {
+				server.Close()
+				first.Close()
+				third, _ := dial(listener, accepted)
+				c.Expect(third == nil, gs.IsFalse)
+				third.Close()
+			})
+		})
+
+		c.Specify("limits the connections of each client", func() {
+			conf.MaxClientConnections = 2
+			limiter := NewConnLimiter(conf)
+			listener, accepted := listen(limiter)
+			defer listener.Close()
+
+			for i := 0; i < 2; i++ {
+				conn, _ := dial(listener, accepted)
+				c.Assume(conn, gs.Not(gs.IsNil))
+				defer conn.Close()
+			}
+			conn, _ := dial(listener, accepted)
+			c.Expect(conn == nil, gs.IsTrue)
+			c.Expect(report(limiter, "RejectedClientConnections"), gs.Equals, int64(1))
+		})
+
+		c.Specify("limits each client's message rate", func() {
+			conf.ClientMessageRate = 2
+			limiter := NewConnLimiter(conf)
+			listener, accepted := listen(limiter)
+			defer listener.Close()
+			conn, server := dial(listener, accepted)
+			c.Assume(conn, gs.Not(gs.IsNil))
+			defer conn.Close()
+
+			client := ConnClient(server)
+			c.Expect(limiter.AllowMessage(client), gs.IsTrue)
+			c.Expect(limiter.AllowMessage(client), gs.IsTrue)
+			c.Expect(limiter.AllowMessage(client), gs.IsFalse)
+			c.Expect(report(limiter, "ThrottledMessages"), gs.Equals, int64(1))
+
+			c.Specify("throttling stream deliveries", func() {
+				d := &countingDeliverer{make(chan struct{}, 1)}
+				wrapped, release := limiter.WrapDeliverer(d, server, make(chan bool))
+				defer release()
+				start := time.Now()
+				wrapped.Deliver(nil)
+				<-d.delivered
+				c.Expect(time.Since(start) > 300*time.Millisecond, gs.IsTrue)
+				c.Expect(report(limiter, "ThrottledMessages"), gs.Equals, int64(2))
+			})
+		})
+
+		c.Specify("closes connections that don't deliver messages", func() {
+			conf.IdleTimeout = 1
+			limiter := NewConnLimiter(conf)
+			listener, accepted := listen(limiter)
+			defer listener.Close()
+			conn, server := dial(listener, accepted)
+			c.Assume(conn, gs.Not(gs.IsNil))
+			defer conn.Close()
+
+			d := &countingDeliverer{make(chan struct{}, 1)}
+			wrapped, release := limiter.WrapDeliverer(d, server, make(chan bool))
+			defer release()
+			time.Sleep(600 * time.Millisecond)
+			wrapped.Deliver(nil)
+			<-d.delivered
+			time.Sleep(600 * time.Millisecond)
+			c.Expect(report(limiter, "IdleConnectionsClosed"), gs.Equals, int64(0))
+
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, err := conn.Read(make([]byte, 1))
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(report(limiter, "IdleConnectionsClosed"), gs.Equals, int64(1))
+		})
+	})
+}
@@ -0,0 +1,77 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Returns the media type the encoder declares, without its parameters, or an
+// empty string if it doesn't declare one.
+func encoderContentType(encoder Encoder) string {
+	typer, ok := encoder.(ContentTypeEncoder)
+	if !ok {
+		return ""
+	}
+	contentType := typer.ContentType()
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// Tells whether the media type is one of those accepted, which may end in
+// "/*".
+func contentTypeAccepted(contentType string, accepted []string) bool {
+	for _, a := range accepted {
+		a = strings.ToLower(a)
+		if a == contentType || a == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(contentType, a[:len(a)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Makes sure that the output accepts what its encoder produces, if both of
+// them say, so that misconfigurations such as an ElasticSearchOutput given a
+// plain text encoder show up at startup rather than as rejected requests.
+func (foRunner *foRunner) checkContentType() error {
+	acceptor, ok := foRunner.plugin.(ContentTypeAcceptor)
+	if !ok || foRunner.encoder == nil {
+		return nil
+	}
+	contentType := strings.ToLower(foRunner.config.ContentType)
+	if contentType == "" {
+		contentType = encoderContentType(foRunner.encoder)
+	}
+	if contentType == "" {
+		return nil
+	}
+	accepted := acceptor.AcceptedContentTypes()
+	if contentTypeAccepted(contentType, accepted) {
+		return nil
+	}
+	encoder := foRunner.config.Encoder
+	if encoder == "" {
+		encoder = strings.Join(foRunner.config.EncoderChain, ", ")
+	}
+	return fmt.Errorf("%s accepts %s, but its encoder %s produces %s; set content_type "+
+		"if that's wrong", foRunner.name, strings.Join(accepted, ", "), encoder, contentType)
+}
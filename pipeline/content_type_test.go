@@ -0,0 +1,112 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+type contentTypeOutput struct{}
+
+func (o *contentTypeOutput) Init(config interface{}) error {
+	return nil
+}
+
+func (o *contentTypeOutput) AcceptedContentTypes() []string {
+	return []string{"application/json", "text/*"}
+}
+
+type jsonEncoder struct {
+	contentType string
+}
+
+func (e *jsonEncoder) Init(config interface{}) error {
+	return nil
+}
+
+func (e *jsonEncoder) Encode(pack *PipelinePack) ([]byte, error) {
+	return []byte("{}"), nil
+}
+
+func (e *jsonEncoder) EncodeBytes(input []byte) ([]byte, error) {
+	return []byte("{}"), nil
+}
+
+func (e *jsonEncoder) ContentType() string {
+	return e.contentType
+}
+
+// Declares no content type.
+type textWrapper struct{}
+
+func (e *textWrapper) Init(config interface{}) error {
+	return nil
+}
+
+func (e *textWrapper) Encode(pack *PipelinePack) ([]byte, error) {
+	return e.EncodeBytes(pack.MsgBytes)
+}
+
+func (e *textWrapper) EncodeBytes(input []byte) ([]byte, error) {
+	return input, nil
+}
+
+func ContentTypeSpec(c gs.Context) {
+	runner := &foRunner{
+		pRunnerBase: pRunnerBase{name: "out", plugin: new(contentTypeOutput)},
+		kind:        foOutput,
+	}
+	runner.config.Encoder = "JsonEncoder"
+	encoder := &jsonEncoder{contentType: "application/json; charset=utf-8"}
+	runner.encoder = encoder
+
+	c.Specify("An output's content types", func() {
+		c.Specify("accept its encoder's", func() {
+			c.Expect(runner.checkContentType(), gs.IsNil)
+			encoder.contentType = "text/plain"
+			c.Expect(runner.checkContentType(), gs.IsNil)
+		})
+
+		c.Specify("are checked against its encoder's", func() {
+			encoder.contentType = "application/x-protobuf"
+			c.Expect(runner.checkContentType(), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("are checked against its content_type setting", func() {
+			runner.config.ContentType = "application/JSON"
+			encoder.contentType = "application/x-protobuf"
+			c.Expect(runner.checkContentType(), gs.IsNil)
+			runner.config.ContentType = "image/png"
+			c.Expect(runner.checkContentType(), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("aren't checked against encoders that don't declare one", func() {
+			runner.encoder = new(textWrapper)
+			c.Expect(runner.checkContentType(), gs.IsNil)
+		})
+
+		c.Specify("are checked against the last encoder of a chain", func() {
+			runner.config.Encoder = ""
+			runner.config.EncoderChain = []string{"a", "b"}
+			encoder.contentType = "application/x-protobuf"
+			runner.encoder = &encoderChain{encoder: encoder,
+				wrappers: []WrapperEncoder{new(textWrapper)}}
+			c.Expect(runner.checkContentType(), gs.IsNil)
+			runner.encoder = &encoderChain{encoder: new(textWrapper),
+				wrappers: []WrapperEncoder{encoder}}
+			c.Expect(runner.checkContentType(), gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,166 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"heka/message"
+)
+
+// Names counters and gauges may have, the same as Prometheus metric names.
+var counterNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Process-wide named counters and gauges that plugins, e.g. sandbox
+// filters, update directly rather than injecting stat messages. They're
+// published in a "heka.counters-report" report and, in the Prometheus text
+// format, by the admin API's `GET /metrics`. A counter only goes up, a gauge
+// is set to whatever it currently is. Names are shared by every plugin.
+// Safe for concurrent use.
+type Counters struct {
+	lock    sync.RWMutex
+	metrics map[string]*counterMetric
+}
+
+type counterMetric struct {
+	gauge bool
+	// Bits of the float64 value, accessed atomically.
+	bits uint64
+}
+
+func NewCounters() *Counters {
+	return &Counters{metrics: make(map[string]*counterMetric)}
+}
+
+// Returns the named metric, creating it if need be, or an error if the name
+// is invalid or already used by the other kind of metric.
+func (c *Counters) metric(name string, gauge bool) (*counterMetric, error) {
+	c.lock.RLock()
+	m := c.metrics[name]
+	c.lock.RUnlock()
+	if m == nil {
+		if !counterNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid counter name '%s'", name)
+		}
+		c.lock.Lock()
+		if m = c.metrics[name]; m == nil {
+			m = &counterMetric{gauge: gauge}
+			c.metrics[name] = m
+		}
+		c.lock.Unlock()
+	}
+	if m.gauge != gauge {
+		if m.gauge {
+			return nil, fmt.Errorf("'%s' is a gauge, not a counter", name)
+		}
+		return nil, fmt.Errorf("'%s' is a counter, not a gauge", name)
+	}
+	return m, nil
+}
+
+// Add atomically adds delta, which can't be negative, to the named counter,
+// creating it if need be.
+func (c *Counters) Add(name string, delta float64) error {
+	if delta < 0 || math.IsNaN(delta) {
+		return fmt.Errorf("counter '%s' can't be decreased", name)
+	}
+	m, err := c.metric(name, false)
+	if err != nil {
+		return err
+	}
+	for {
+		old := atomic.LoadUint64(&m.bits)
+		value := math.Float64frombits(old) + delta
+		if atomic.CompareAndSwapUint64(&m.bits, old, math.Float64bits(value)) {
+			return nil
+		}
+	}
+}
+
+// Set sets the named gauge, creating it if need be.
+func (c *Counters) Set(name string, value float64) error {
+	m, err := c.metric(name, true)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint64(&m.bits, math.Float64bits(value))
+	return nil
+}
+
+// Value returns the named metric's value, and whether it exists.
+func (c *Counters) Value(name string) (float64, bool) {
+	c.lock.RLock()
+	m := c.metrics[name]
+	c.lock.RUnlock()
+	if m == nil {
+		return 0, false
+	}
+	return math.Float64frombits(atomic.LoadUint64(&m.bits)), true
+}
+
+type counterValue struct {
+	name  string
+	gauge bool
+	value float64
+}
+
+// Returns the current values, sorted by name.
+func (c *Counters) values() []counterValue {
+	c.lock.RLock()
+	values := make([]counterValue, 0, len(c.metrics))
+	for name, m := range c.metrics {
+		values = append(values, counterValue{name, m.gauge,
+			math.Float64frombits(atomic.LoadUint64(&m.bits))})
+	}
+	c.lock.RUnlock()
+	sort.Slice(values, func(i, j int) bool { return values[i].name < values[j].name })
+	return values
+}
+
+// ReportMsg adds a field holding each metric's value to a report message.
+func (c *Counters) ReportMsg(msg *message.Message) {
+	for _, v := range c.values() {
+		representation := "count"
+		if v.gauge {
+			representation = ""
+		}
+		if f, err := message.NewField(v.name, v.value, representation); err == nil {
+			msg.AddField(f)
+		}
+	}
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition
+// format, with their names prefixed with "heka_".
+func (c *Counters) WritePrometheus(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	for _, v := range c.values() {
+		kind := "counter"
+		if v.gauge {
+			kind = "gauge"
+		}
+		fmt.Fprintf(buf, "# TYPE heka_%s %s\nheka_%s %s\n", v.name, kind, v.name,
+			strconv.FormatFloat(v.value, 'g', -1, 64))
+	}
+	return buf.Flush()
+}
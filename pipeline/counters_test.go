@@ -0,0 +1,88 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"sync"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+)
+
+func CountersSpec(c gs.Context) {
+	c.Specify("Counters", func() {
+		counters := NewCounters()
+
+		c.Specify("add up concurrently", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					for j := 0; j < 100; j++ {
+						counters.Add("events", 0.5)
+					}
+					wg.Done()
+				}()
+			}
+			wg.Wait()
+			value, ok := counters.Value("events")
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(value, gs.Equals, float64(500))
+		})
+
+		c.Specify("can't go down", func() {
+			c.Expect(counters.Add("events", -1), gs.Not(gs.IsNil))
+			_, ok := counters.Value("events")
+			c.Expect(ok, gs.IsFalse)
+		})
+
+		c.Specify("keep gauges apart from counters", func() {
+			c.Expect(counters.Set("depth", 7), gs.IsNil)
+			c.Expect(counters.Set("depth", 2), gs.IsNil)
+			value, _ := counters.Value("depth")
+			c.Expect(value, gs.Equals, float64(2))
+			c.Expect(counters.Add("depth", 1), gs.Not(gs.IsNil))
+			c.Expect(counters.Add("events", 1), gs.IsNil)
+			c.Expect(counters.Set("events", 1), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("reject invalid names", func() {
+			c.Expect(counters.Add("bad name", 1), gs.Not(gs.IsNil))
+			c.Expect(counters.Set("9lives", 1), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("report their values", func() {
+			counters.Add("events", 2)
+			counters.Set("depth", 4)
+			msg := new(message.Message)
+			counters.ReportMsg(msg)
+			c.Expect(len(msg.Fields), gs.Equals, 2)
+			value, _ := msg.GetFieldValue("events")
+			c.Expect(value, gs.Equals, float64(2))
+			f := msg.FindFirstField("depth")
+			c.Expect(f.GetValueDouble()[0], gs.Equals, float64(4))
+			c.Expect(f.GetRepresentation(), gs.Equals, "")
+		})
+
+		c.Specify("are shared by a process's pipelines", func() {
+			root := DefaultGlobals()
+			child := DefaultGlobals()
+			child.parent = root
+			c.Expect(root.usedCounters(), gs.IsNil)
+			child.Counters().Add("events", 1)
+			c.Expect(root.usedCounters(), gs.Equals, child.Counters())
+		})
+	})
+}
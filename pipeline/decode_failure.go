@@ -0,0 +1,104 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"heka/message"
+)
+
+// Message type given to packs that failed to decode when a plugin has
+// `send_decode_failures` set.
+const DECODE_FAILURE_TYPE = "heka.decode_failure"
+
+// Largest raw sample of the undecodable input kept on a decode failure
+// message, in bytes.
+const maxRawSample = 500
+
+// DecodeError can be returned by decoders to say what kind of problem they
+// ran into and where in the input, which is then recorded on the decode
+// failure message. Other errors are classified as well as they can be.
+type DecodeError struct {
+	// Short machine friendly class of the error, e.g. "syntax".
+	Class string
+	// Byte offset of the offending input, or -1 if it isn't known.
+	Offset int64
+	Err    error
+}
+
+func NewDecodeError(class string, offset int64, err error) *DecodeError {
+	return &DecodeError{Class: class, Offset: offset, Err: err}
+}
+
+func (e *DecodeError) Error() string {
+	return e.Err.Error()
+}
+
+// Returns the class and, if known, the byte offset of a decode error.
+func classifyDecodeError(err error) (class string, offset int64) {
+	switch e := err.(type) {
+	case *DecodeError:
+		return e.Class, e.Offset
+	case *json.SyntaxError:
+		return "syntax", e.Offset
+	case *json.UnmarshalTypeError:
+		return "type", e.Offset
+	case *strconv.NumError:
+		return "number", -1
+	case *time.ParseError:
+		return "timestamp", -1
+	}
+	if strings.HasPrefix(err.Error(), "proto:") {
+		return "protobuf", -1
+	}
+	return "decode", -1
+}
+
+// Turns a pack that the named decoder failed to decode into a decode failure
+// message. Alongside the `decode_failure` and `decode_error` fields added by
+// AddDecodeFailureFields it gets the decoder's name, the error class, the
+// offset of the offending input when known, and a sample of the raw input,
+// and its type is set to DECODE_FAILURE_TYPE.
+func setDecodeFailure(pack *PipelinePack, decoderName string, decodeErr error) error {
+	msg := pack.Message
+	raw := pack.MsgBytes
+	if len(raw) == 0 {
+		raw = []byte(msg.GetPayload())
+	}
+	if len(raw) > maxRawSample {
+		raw = raw[:maxRawSample]
+	}
+	if err := AddDecodeFailureFields(msg, decodeErr.Error()); err != nil {
+		return err
+	}
+	class, offset := classifyDecodeError(decodeErr)
+	message.NewStringField(msg, "decoder", decoderName)
+	message.NewStringField(msg, "decode_error_class", class)
+	if offset >= 0 {
+		message.NewInt64Field(msg, "decode_error_offset", offset, "B")
+	}
+	if len(raw) > 0 {
+		// The copy keeps the sample from changing along with the pack's
+		// buffer.
+		message.NewBytesField(msg, "decode_raw_sample", append([]byte(nil), raw...), "")
+	}
+	msg.SetType(DECODE_FAILURE_TYPE)
+	pack.TrustMsgBytes = false
+	return nil
+}
@@ -0,0 +1,82 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func DecodeFailureSpec(c gs.Context) {
+	c.Specify("A decode failure", func() {
+		pack := NewPipelinePack(nil)
+		pack.Message.SetType("nginx.access")
+		pack.TrustMsgBytes = true
+
+		c.Specify("is marked as such", func() {
+			pack.Message.SetPayload("not a log line")
+			err := setDecodeFailure(pack, "nginx-Decoder", errors.New("no match"))
+			c.Expect(err, gs.IsNil)
+			msg := pack.Message
+			c.Expect(msg.GetType(), gs.Equals, DECODE_FAILURE_TYPE)
+			c.Expect(pack.TrustMsgBytes, gs.IsFalse)
+			value, _ := msg.GetFieldValue("decode_failure")
+			c.Expect(value, gs.Equals, true)
+			value, _ = msg.GetFieldValue("decode_error")
+			c.Expect(value, gs.Equals, "no match")
+			value, _ = msg.GetFieldValue("decoder")
+			c.Expect(value, gs.Equals, "nginx-Decoder")
+			value, _ = msg.GetFieldValue("decode_error_class")
+			c.Expect(value, gs.Equals, "decode")
+			c.Expect(msg.FindFirstField("decode_error_offset"), gs.IsNil)
+			sample, _, err := msg.GetBytesField("decode_raw_sample")
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(sample), gs.Equals, "not a log line")
+		})
+
+		c.Specify("records where the input went wrong", func() {
+			var v interface{}
+			pack.MsgBytes = []byte(`{"a": 1,}`)
+			jsonErr := json.Unmarshal(pack.MsgBytes, &v)
+			c.Assume(jsonErr, gs.Not(gs.IsNil))
+			setDecodeFailure(pack, "JsonDecoder", jsonErr)
+			value, _ := pack.Message.GetFieldValue("decode_error_class")
+			c.Expect(value, gs.Equals, "syntax")
+			value, _ = pack.Message.GetFieldValue("decode_error_offset")
+			c.Expect(value, gs.Equals, int64(9))
+			sample, _, _ := pack.Message.GetBytesField("decode_raw_sample")
+			c.Expect(string(sample), gs.Equals, `{"a": 1,}`)
+		})
+
+		c.Specify("keeps a decoder's own error class", func() {
+			err := NewDecodeError("missing_field", 12, errors.New("no 'status'"))
+			setDecodeFailure(pack, "AccessDecoder", err)
+			value, _ := pack.Message.GetFieldValue("decode_error_class")
+			c.Expect(value, gs.Equals, "missing_field")
+			value, _ = pack.Message.GetFieldValue("decode_error_offset")
+			c.Expect(value, gs.Equals, int64(12))
+		})
+
+		c.Specify("truncates the raw sample", func() {
+			pack.Message.SetPayload(strings.Repeat("x", 2000))
+			setDecodeFailure(pack, "AccessDecoder", errors.New("no match"))
+			sample, _, _ := pack.Message.GetBytesField("decode_raw_sample")
+			c.Expect(len(sample), gs.Equals, maxRawSample)
+		})
+	})
+}
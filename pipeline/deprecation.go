@@ -0,0 +1,172 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+)
+
+// A config option that's been renamed or removed.
+type deprecatedOption struct {
+	// Empty if the option was removed.
+	newName string
+	note    string
+}
+
+var (
+	// Deprecated options by plugin type or category, then by old name.
+	deprecatedOptions     = make(map[string]map[string]deprecatedOption)
+	deprecatedOptionsLock sync.RWMutex
+)
+
+// RegisterDeprecatedOption tells Heka that a plugin's `oldName` config option
+// has been renamed to `newName`, so that configs still using the old name keep
+// working, with a warning, until they've been updated. An empty `newName`
+// means the option was removed, and it's dropped from the config with a
+// warning instead of failing the config load. `pluginType` is either a
+// registered plugin type, or a plugin category such as "Input" or "Output"
+// for the options Heka defines for every plugin of that category. `note`, if
+// given, is added to the warning, e.g. to say what to use instead of a
+// removed option.
+func RegisterDeprecatedOption(pluginType, oldName, newName, note string) {
+	deprecatedOptionsLock.Lock()
+	defer deprecatedOptionsLock.Unlock()
+	options, ok := deprecatedOptions[pluginType]
+	if !ok {
+		options = make(map[string]deprecatedOption)
+		deprecatedOptions[pluginType] = options
+	}
+	options[oldName] = deprecatedOption{newName: newName, note: note}
+}
+
+// A plugin config that loaded but uses deprecated options, and should be
+// updated before they stop working.
+type ConfigWarning struct {
+	// Name of the plugin's config section.
+	Plugin string
+	// Deprecated option used.
+	Option string
+	// Option it maps to, empty if it was removed.
+	NewOption string
+	Message   string
+}
+
+func (w ConfigWarning) String() string {
+	return w.Message
+}
+
+// Records a config warning, logging it along with the config errors.
+func (self *PipelineConfig) warn(w ConfigWarning) {
+	self.configWarningsLock.Lock()
+	self.configWarnings = append(self.configWarnings, w)
+	self.LogMsgs = append(self.LogMsgs, w.Message)
+	self.configWarningsLock.Unlock()
+	LogInfo.Println(w.Message)
+}
+
+// ConfigWarnings returns the warnings about deprecated options recorded while
+// loading plugin configs.
+func (self *PipelineConfig) ConfigWarnings() []ConfigWarning {
+	self.configWarningsLock.Lock()
+	defer self.configWarningsLock.Unlock()
+	return append([]ConfigWarning(nil), self.configWarnings...)
+}
+
+// Returns the deprecated options that apply to a plugin type of the given
+// category, in a stable order.
+func deprecatedOptionsFor(pluginType, category string) (names []string,
+	options map[string]deprecatedOption) {
+
+	deprecatedOptionsLock.RLock()
+	defer deprecatedOptionsLock.RUnlock()
+	options = make(map[string]deprecatedOption)
+	for _, key := range []string{category, pluginType} {
+		for oldName, opt := range deprecatedOptions[key] {
+			options[oldName] = opt
+		}
+	}
+	for oldName := range options {
+		names = append(names, oldName)
+	}
+	sort.Strings(names)
+	return names, options
+}
+
+// Maps any deprecated options in a plugin's config section to their new
+// names, or drops them if they were removed, recording a warning for each.
+// Returns the section unchanged if it uses no deprecated options. If both an
+// option's old and new names are set the new one wins.
+func (self *PipelineConfig) migrateOptions(name, pluginType, category string,
+	section toml.Primitive) (toml.Primitive, bool, error) {
+
+	names, deprecated := deprecatedOptionsFor(pluginType, category)
+	if len(names) == 0 {
+		return section, false, nil
+	}
+	var options map[string]interface{}
+	if err := toml.PrimitiveDecode(section, &options); err != nil {
+		return section, false, err
+	}
+
+	var warnings []ConfigWarning
+	for _, oldName := range names {
+		value, ok := options[oldName]
+		if !ok {
+			continue
+		}
+		opt := deprecated[oldName]
+		delete(options, oldName)
+		w := ConfigWarning{Plugin: name, Option: oldName, NewOption: opt.newName}
+		switch {
+		case opt.newName == "":
+			w.Message = fmt.Sprintf("'%s' option '%s' is deprecated and ignored",
+				name, oldName)
+		case options[opt.newName] != nil:
+			w.Message = fmt.Sprintf(
+				"'%s' option '%s' is deprecated and ignored, since '%s' is also set",
+				name, oldName, opt.newName)
+		default:
+			options[opt.newName] = value
+			w.Message = fmt.Sprintf("'%s' option '%s' is deprecated, use '%s' instead",
+				name, oldName, opt.newName)
+		}
+		if opt.note != "" {
+			w.Message = fmt.Sprintf("%s: %s", w.Message, opt.note)
+		}
+		warnings = append(warnings, w)
+	}
+	if len(warnings) == 0 {
+		return section, false, nil
+	}
+
+	// Round trip the migrated options through TOML to get a new section.
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(map[string]interface{}{name: options}); err != nil {
+		return section, false, fmt.Errorf("can't migrate deprecated options: %s", err)
+	}
+	var configFile ConfigFile
+	if _, err := toml.Decode(buf.String(), &configFile); err != nil {
+		return section, false, fmt.Errorf("can't migrate deprecated options: %s", err)
+	}
+	for _, w := range warnings {
+		self.warn(w)
+	}
+	return configFile[name], true, nil
+}
@@ -0,0 +1,112 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"github.com/BurntSushi/toml"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func DeprecationSpec(c gs.Context) {
+	RegisterPlugin("DeprecatedStatAccumInput", func() interface{} {
+		return new(StatAccumInput)
+	})
+	RegisterPlugin("FooOutput", func() interface{} {
+		return new(FooOutput)
+	})
+	RegisterDeprecatedOption("DeprecatedStatAccumInput", "ticker", "ticker_interval", "")
+	RegisterDeprecatedOption("DeprecatedStatAccumInput", "emit_both", "",
+		"set emit_in_payload and emit_in_fields")
+	RegisterDeprecatedOption("Output", "old_message_matcher", "message_matcher", "")
+	pConfig := NewPipelineConfig(nil)
+
+	makeMaker := func(name, section string) *pluginMaker {
+		var configFile ConfigFile
+		_, err := toml.Decode(section, &configFile)
+		c.Assume(err, gs.IsNil)
+		maker, err := NewPluginMaker(name, pConfig, configFile[name])
+		c.Assume(err, gs.IsNil)
+		return maker.(*pluginMaker)
+	}
+
+	prepConfig := func(maker *pluginMaker) *StatAccumInputConfig {
+		config, err := maker.PrepConfig()
+		c.Assume(err, gs.IsNil)
+		return config.(*StatAccumInputConfig)
+	}
+
+	c.Specify("Deprecated options", func() {
+		c.Specify("are mapped to their new names", func() {
+			maker := makeMaker("stats", `[stats]
+			type = "DeprecatedStatAccumInput"
+			ticker = 7
+			`)
+			c.Expect(prepConfig(maker).TickerInterval, gs.Equals, uint(7))
+			warnings := pConfig.ConfigWarnings()
+			c.Expect(len(warnings), gs.Equals, 1)
+			c.Expect(warnings[0].Plugin, gs.Equals, "stats")
+			c.Expect(warnings[0].Option, gs.Equals, "ticker")
+			c.Expect(warnings[0].NewOption, gs.Equals, "ticker_interval")
+			c.Expect(warnings[0].Message, gs.Equals,
+				"'stats' option 'ticker' is deprecated, use 'ticker_interval' instead")
+			c.Expect(pConfig.LogMsgs[len(pConfig.LogMsgs)-1], gs.Equals, warnings[0].Message)
+		})
+
+		c.Specify("lose to their new names when both are set", func() {
+			maker := makeMaker("stats", `[stats]
+			type = "DeprecatedStatAccumInput"
+			ticker = 7
+			ticker_interval = 3
+			`)
+			c.Expect(prepConfig(maker).TickerInterval, gs.Equals, uint(3))
+			warnings := pConfig.ConfigWarnings()
+			c.Expect(len(warnings), gs.Equals, 1)
+			c.Expect(warnings[0].Message, gs.Equals, "'stats' option 'ticker' is "+
+				"deprecated and ignored, since 'ticker_interval' is also set")
+		})
+
+		c.Specify("are dropped if they were removed", func() {
+			maker := makeMaker("stats", `[stats]
+			type = "DeprecatedStatAccumInput"
+			emit_both = true
+			`)
+			prepConfig(maker)
+			warnings := pConfig.ConfigWarnings()
+			c.Expect(len(warnings), gs.Equals, 1)
+			c.Expect(warnings[0].NewOption, gs.Equals, "")
+			c.Expect(warnings[0].Message, gs.Equals, "'stats' option 'emit_both' is "+
+				"deprecated and ignored: set emit_in_payload and emit_in_fields")
+		})
+
+		c.Specify("of a category apply to its common config", func() {
+			maker := makeMaker("FooOutput", `[FooOutput]
+			old_message_matcher = "Type == 'foo'"
+			`)
+			runner, err := maker.MakeRunner("")
+			c.Expect(err, gs.IsNil)
+			c.Expect(runner.(*foRunner).config.Matcher, gs.Equals, "Type == 'foo'")
+			c.Expect(len(pConfig.ConfigWarnings()), gs.Equals, 1)
+		})
+
+		c.Specify("leave configs that don't use them alone", func() {
+			maker := makeMaker("stats", `[stats]
+			type = "DeprecatedStatAccumInput"
+			ticker_interval = 3
+			`)
+			c.Expect(prepConfig(maker).TickerInterval, gs.Equals, uint(3))
+			c.Expect(len(pConfig.ConfigWarnings()), gs.Equals, 0)
+		})
+	})
+}
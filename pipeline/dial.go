@@ -0,0 +1,51 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+var ErrTcpUserTimeoutUnsupported = errors.New(
+	"tcp_user_timeout is only supported on Linux")
+
+// TcpDialer returns a dialer whose TCP connections are dropped by the kernel
+// once data sent over them has gone unacknowledged for userTimeout
+// (TCP_USER_TIMEOUT). A peer that has silently gone away, e.g. behind a NAT
+// or load balancer that dropped the connection, is then noticed in that
+// time, rather than after the many minutes of retransmissions it otherwise
+// takes. A zero userTimeout keeps the system default.
+func TcpDialer(userTimeout time.Duration) (*net.Dialer, error) {
+	dialer := &net.Dialer{}
+	if userTimeout <= 0 {
+		return dialer, nil
+	}
+	if !TcpUserTimeoutSupported {
+		return nil, ErrTcpUserTimeoutUnsupported
+	}
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			sockErr = setTcpUserTimeout(fd, userTimeout)
+		}); err != nil {
+			return err
+		}
+		return sockErr
+	}
+	return dialer, nil
+}
@@ -0,0 +1,50 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"net"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func DialerSpec(c gs.Context) {
+	c.Specify("A TcpDialer", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		c.Assume(err, gs.IsNil)
+		defer listener.Close()
+
+		c.Specify("dials with the system default user timeout", func() {
+			dialer, err := TcpDialer(0)
+			c.Assume(err, gs.IsNil)
+			conn, err := dialer.Dial("tcp", listener.Addr().String())
+			c.Expect(err, gs.IsNil)
+			conn.Close()
+		})
+
+		c.Specify("sets the user timeout where it's supported", func() {
+			dialer, err := TcpDialer(5 * time.Second)
+			if !TcpUserTimeoutSupported {
+				c.Expect(err, gs.Equals, ErrTcpUserTimeoutUnsupported)
+				return
+			}
+			c.Assume(err, gs.IsNil)
+			conn, err := dialer.Dial("tcp", listener.Addr().String())
+			c.Expect(err, gs.IsNil)
+			conn.Close()
+		})
+	})
+}
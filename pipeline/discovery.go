@@ -0,0 +1,299 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Endpoint discovery settings, from an output's `discovery` config
+// subsection. One of Srv and ConsulService must be set.
+type DiscoveryConfig struct {
+	// DNS SRV name to look up, e.g. "_heka._tcp.aggregator.example.com".
+	// Names without dots are tried with the resolv.conf search domains.
+	Srv string `toml:"srv"`
+	// Address, "host:port", of the DNS server queried. Defaults to the first
+	// resolv.conf nameserver.
+	DnsServer string `toml:"dns_server"`
+	// Consul service whose healthy instances are used.
+	ConsulService string `toml:"consul_service"`
+	// Consul agent's HTTP API address. Defaults to "http://127.0.0.1:8500".
+	ConsulAddress string `toml:"consul_address"`
+	// Tag the Consul service instances must have.
+	ConsulTag string `toml:"consul_tag"`
+	// Consul datacenter queried, defaulting to the agent's own.
+	ConsulDatacenter string `toml:"consul_datacenter"`
+	// Consul ACL token.
+	ConsulToken string `toml:"consul_token"`
+	// Maximum number of seconds between lookups. SRV records are looked up
+	// again when their TTL expires, if that's sooner. Defaults to 30.
+	RefreshInterval uint `toml:"refresh_interval"`
+}
+
+// Validate checks that the settings are usable, and fills in the defaults.
+func (c *DiscoveryConfig) Validate() error {
+	if (c.Srv == "") == (c.ConsulService == "") {
+		return errors.New("exactly one of 'srv' and 'consul_service' must be set")
+	}
+	if c.ConsulService != "" {
+		if c.ConsulAddress == "" {
+			c.ConsulAddress = "http://127.0.0.1:8500"
+		}
+		if _, err := url.Parse(c.ConsulAddress); err != nil {
+			return fmt.Errorf("invalid consul_address: %s", err)
+		}
+	}
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = 30
+	}
+	return nil
+}
+
+// Looks up the "host:port" endpoints of a DNS SRV name or Consul service for
+// an output, in the order they should be tried, and keeps them current.
+// Endpoints of equal preference are shuffled, so that the outputs of many
+// hekad instances spread their connections over all of them. Not safe for
+// concurrent use.
+type EndpointResolver struct {
+	conf      *DiscoveryConfig
+	client    *http.Client
+	dnsConfig *dns.ClientConfig
+	endpoints []string
+	refreshAt time.Time
+	// Replaced by tests.
+	now func() time.Time
+}
+
+// NewEndpointResolver returns a resolver for the validated config.
+func NewEndpointResolver(conf *DiscoveryConfig) (*EndpointResolver, error) {
+	r := &EndpointResolver{
+		conf:   conf,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+	if conf.Srv != "" {
+		var err error
+		if conf.DnsServer == "" {
+			if r.dnsConfig, err = dns.ClientConfigFromFile("/etc/resolv.conf"); err != nil {
+				return nil, fmt.Errorf("can't read resolv.conf: %s", err)
+			}
+			if len(r.dnsConfig.Servers) == 0 {
+				return nil, errors.New("no nameservers in resolv.conf")
+			}
+		} else {
+			host, port, err := net.SplitHostPort(conf.DnsServer)
+			if err != nil {
+				return nil, fmt.Errorf("invalid dns_server: %s", err)
+			}
+			r.dnsConfig = &dns.ClientConfig{Servers: []string{host}, Port: port, Ndots: 1,
+				Timeout: 5, Attempts: 2}
+		}
+	}
+	return r, nil
+}
+
+// Endpoints returns the current endpoints, looking them up again first if
+// they're due to be. changed is true when the set of endpoints differs from
+// the one returned before. If a lookup fails the previous endpoints are
+// returned along with the error, and the lookup is retried a few seconds
+// later.
+func (r *EndpointResolver) Endpoints() (endpoints []string, changed bool, err error) {
+	now := r.now()
+	if r.endpoints != nil && now.Before(r.refreshAt) {
+		return r.endpoints, false, nil
+	}
+	refresh := time.Duration(r.conf.RefreshInterval) * time.Second
+	var ttl time.Duration
+	if r.conf.Srv != "" {
+		endpoints, ttl, err = r.lookupSrv()
+	} else {
+		endpoints, err = r.lookupConsul()
+	}
+	if err == nil && len(endpoints) == 0 {
+		err = errors.New("no endpoints found")
+	}
+	if err != nil {
+		retry := 5 * time.Second
+		if retry > refresh {
+			retry = refresh
+		}
+		r.refreshAt = now.Add(retry)
+		return r.endpoints, false, err
+	}
+	if ttl > 0 && ttl < refresh {
+		refresh = ttl
+	}
+	r.refreshAt = now.Add(refresh)
+	changed = r.endpoints != nil && !sameEndpoints(r.endpoints, endpoints)
+	if r.endpoints == nil || changed {
+		r.endpoints = endpoints
+	}
+	return r.endpoints, changed, nil
+}
+
+func sameEndpoints(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string(nil), a...)
+	y := append([]string(nil), b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Orders SRV records as RFC 2782 has clients try them: by priority, and
+// within a priority randomly, in proportion to their weights.
+func orderSrv(records []*dns.SRV) []string {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Priority < records[j].Priority
+	})
+	endpoints := make([]string, 0, len(records))
+	for start := 0; start < len(records); {
+		end := start
+		for end < len(records) && records[end].Priority == records[start].Priority {
+			end++
+		}
+		group := records[start:end]
+		for len(group) > 0 {
+			total := 0
+			for _, rr := range group {
+				total += int(rr.Weight) + 1
+			}
+			pick, n := rand.Intn(total), 0
+			for i, rr := range group {
+				if n += int(rr.Weight) + 1; pick < n {
+					endpoints = append(endpoints, net.JoinHostPort(
+						strings.TrimSuffix(rr.Target, "."), strconv.Itoa(int(rr.Port))))
+					group[0], group[i] = group[i], group[0]
+					group = group[1:]
+					break
+				}
+			}
+		}
+		start = end
+	}
+	return endpoints
+}
+
+// Looks up the SRV records, returning their endpoints and smallest TTL.
+func (r *EndpointResolver) lookupSrv() ([]string, time.Duration, error) {
+	client := &dns.Client{Timeout: time.Duration(r.dnsConfig.Timeout) * time.Second}
+	var lastErr error
+	for _, name := range r.dnsConfig.NameList(r.conf.Srv) {
+		msg := new(dns.Msg)
+		msg.SetQuestion(name, dns.TypeSRV)
+		for _, server := range r.dnsConfig.Servers {
+			resp, _, err := client.Exchange(msg, net.JoinHostPort(server, r.dnsConfig.Port))
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if resp.Rcode != dns.RcodeSuccess {
+				lastErr = fmt.Errorf("%s: %s", name, dns.RcodeToString[resp.Rcode])
+				break
+			}
+			var records []*dns.SRV
+			ttl := uint32(0)
+			for _, rr := range resp.Answer {
+				if srv, ok := rr.(*dns.SRV); ok {
+					records = append(records, srv)
+					if ttl == 0 || srv.Hdr.Ttl < ttl {
+						ttl = srv.Hdr.Ttl
+					}
+				}
+			}
+			if len(records) == 0 {
+				lastErr = fmt.Errorf("%s: no SRV records", name)
+				break
+			}
+			return orderSrv(records), time.Duration(ttl) * time.Second, nil
+		}
+	}
+	return nil, 0, lastErr
+}
+
+// An instance in a Consul health API response.
+type consulServiceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+// Looks up the Consul service's instances that pass their health checks.
+func (r *EndpointResolver) lookupConsul() ([]string, error) {
+	query := url.Values{"passing": {"1"}}
+	if r.conf.ConsulTag != "" {
+		query.Set("tag", r.conf.ConsulTag)
+	}
+	if r.conf.ConsulDatacenter != "" {
+		query.Set("dc", r.conf.ConsulDatacenter)
+	}
+	reqUrl := fmt.Sprintf("%s/v1/health/service/%s?%s",
+		strings.TrimSuffix(r.conf.ConsulAddress, "/"), url.PathEscape(r.conf.ConsulService),
+		query.Encode())
+	req, err := http.NewRequest("GET", reqUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.conf.ConsulToken != "" {
+		req.Header.Set("X-Consul-Token", r.conf.ConsulToken)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Consul responded %s", resp.Status)
+	}
+	var entries []consulServiceEntry
+	if err = json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("can't decode Consul response: %s", err)
+	}
+	endpoints := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		endpoints = append(endpoints, net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)))
+	}
+	rand.Shuffle(len(endpoints), func(i, j int) {
+		endpoints[i], endpoints[j] = endpoints[j], endpoints[i]
+	})
+	return endpoints, nil
+}
@@ -0,0 +1,186 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func DiscoverySpec(c gs.Context) {
+	c.Specify("DiscoveryConfig", func() {
+		c.Specify("needs exactly one of srv and consul_service", func() {
+			conf := &DiscoveryConfig{}
+			c.Expect(conf.Validate(), gs.Not(gs.IsNil))
+			conf = &DiscoveryConfig{Srv: "_heka._tcp", ConsulService: "heka"}
+			c.Expect(conf.Validate(), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("fills in the defaults", func() {
+			conf := &DiscoveryConfig{ConsulService: "heka"}
+			c.Expect(conf.Validate(), gs.IsNil)
+			c.Expect(conf.ConsulAddress, gs.Equals, "http://127.0.0.1:8500")
+			c.Expect(conf.RefreshInterval, gs.Equals, uint(30))
+		})
+	})
+
+	c.Specify("An EndpointResolver", func() {
+		now := time.Unix(1400000000, 0)
+		clock := func() time.Time { return now }
+
+		c.Specify("looks up SRV records", func() {
+			var lock sync.Mutex
+			ttl := uint32(10)
+			targets := []string{"a.example.com.", "b.example.com."}
+			queries := 0
+			handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+				lock.Lock()
+				defer lock.Unlock()
+				queries++
+				resp := new(dns.Msg)
+				resp.SetReply(req)
+				if req.Question[0].Name != "_heka._tcp.example.com." {
+					resp.Rcode = dns.RcodeNameError
+				}
+				for i, target := range targets {
+					rr, _ := dns.NewRR(fmt.Sprintf("%s %d IN SRV %d 10 %d %s",
+						req.Question[0].Name, ttl, i, 5565+i, target))
+					resp.Answer = append(resp.Answer, rr)
+				}
+				w.WriteMsg(resp)
+			})
+			pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+			c.Assume(err, gs.IsNil)
+			server := &dns.Server{PacketConn: pc, Handler: handler}
+			go server.ActivateAndServe()
+			defer server.Shutdown()
+
+			conf := &DiscoveryConfig{Srv: "_heka._tcp.example.com",
+				DnsServer: pc.LocalAddr().String(), RefreshInterval: 60}
+			c.Assume(conf.Validate(), gs.IsNil)
+			r, err := NewEndpointResolver(conf)
+			c.Assume(err, gs.IsNil)
+			r.now = clock
+
+			endpoints, changed, err := r.Endpoints()
+			c.Expect(err, gs.IsNil)
+			c.Expect(changed, gs.IsFalse)
+			c.Expect(len(endpoints), gs.Equals, 2)
+			// In priority order.
+			c.Expect(endpoints[0], gs.Equals, "a.example.com:5565")
+			c.Expect(endpoints[1], gs.Equals, "b.example.com:5566")
+
+			c.Specify("again when their TTL expires", func() {
+				lock.Lock()
+				targets = []string{"a.example.com.", "c.example.com."}
+				lock.Unlock()
+				now = now.Add(5 * time.Second)
+				_, changed, _ = r.Endpoints()
+				c.Expect(changed, gs.IsFalse)
+				c.Expect(queries, gs.Equals, 1)
+
+				now = now.Add(5 * time.Second)
+				endpoints, changed, err = r.Endpoints()
+				c.Expect(err, gs.IsNil)
+				c.Expect(changed, gs.IsTrue)
+				c.Expect(endpoints[1], gs.Equals, "c.example.com:5566")
+				c.Expect(queries, gs.Equals, 2)
+			})
+
+			c.Specify("keeps the previous endpoints when a lookup fails", func() {
+				server.Shutdown()
+				now = now.Add(time.Minute)
+				endpoints, changed, err = r.Endpoints()
+				c.Expect(err, gs.Not(gs.IsNil))
+				c.Expect(changed, gs.IsFalse)
+				c.Expect(len(endpoints), gs.Equals, 2)
+			})
+		})
+
+		c.Specify("orders SRV records of a priority by weight", func() {
+			counts := make(map[string]int)
+			for i := 0; i < 1000; i++ {
+				records := []*dns.SRV{
+					{Priority: 1, Weight: 90, Port: 1, Target: "heavy."},
+					{Priority: 1, Weight: 9, Port: 1, Target: "light."},
+					{Priority: 0, Weight: 0, Port: 1, Target: "first."},
+				}
+				endpoints := orderSrv(records)
+				c.Assume(endpoints[0], gs.Equals, "first:1")
+				counts[endpoints[1]]++
+			}
+			c.Expect(counts["heavy:1"] > counts["light:1"], gs.IsTrue)
+		})
+
+		c.Specify("looks up healthy Consul service instances", func() {
+			var path, query, token string
+			body := `[{"Node": {"Address": "10.0.0.1"}, "Service": {"Address": "", "Port": 5565}},
+				{"Node": {"Address": "10.0.0.2"}, "Service": {"Address": "10.1.0.2", "Port": 5566}}]`
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+				req *http.Request) {
+				path, query = req.URL.Path, req.URL.RawQuery
+				token = req.Header.Get("X-Consul-Token")
+				w.Write([]byte(body))
+			}))
+			defer ts.Close()
+
+			conf := &DiscoveryConfig{ConsulService: "heka", ConsulAddress: ts.URL,
+				ConsulTag: "aggregator", ConsulToken: "secret"}
+			c.Assume(conf.Validate(), gs.IsNil)
+			r, err := NewEndpointResolver(conf)
+			c.Assume(err, gs.IsNil)
+			r.now = clock
+
+			endpoints, _, err := r.Endpoints()
+			c.Expect(err, gs.IsNil)
+			c.Expect(path, gs.Equals, "/v1/health/service/heka")
+			c.Expect(query, gs.Equals, "passing=1&tag=aggregator")
+			c.Expect(token, gs.Equals, "secret")
+			sorted := append([]string(nil), endpoints...)
+			sort.Strings(sorted)
+			c.Expect(len(sorted), gs.Equals, 2)
+			c.Expect(sorted[0], gs.Equals, "10.0.0.1:5565")
+			c.Expect(sorted[1], gs.Equals, "10.1.0.2:5566")
+
+			c.Specify("and notices when they change", func() {
+				body = `[{"Node": {"Address": "10.0.0.1"}, "Service": {"Port": 5565}}]`
+				now = now.Add(29 * time.Second)
+				_, changed, _ := r.Endpoints()
+				c.Expect(changed, gs.IsFalse)
+				now = now.Add(time.Second)
+				endpoints, changed, err = r.Endpoints()
+				c.Expect(err, gs.IsNil)
+				c.Expect(changed, gs.IsTrue)
+				c.Expect(len(endpoints), gs.Equals, 1)
+			})
+
+			c.Specify("and fails when there are none", func() {
+				body = `[]`
+				r2, _ := NewEndpointResolver(conf)
+				endpoints, _, err = r2.Endpoints()
+				c.Expect(err, gs.Not(gs.IsNil))
+				c.Expect(len(endpoints), gs.Equals, 0)
+			})
+		})
+	})
+}
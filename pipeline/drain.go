@@ -0,0 +1,109 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// How often drain checks whether the pipeline has emptied.
+var drainPollInterval = 100 * time.Millisecond
+
+// Describes whatever is still working its way through the pipeline, one
+// entry per place that messages are waiting. Returns an empty slice if the
+// pipeline is fully drained.
+func (pc *PipelineConfig) undelivered() (pending []string) {
+	poolSize := pc.Globals.PoolSize
+	if n := poolSize - len(pc.inputRecycleChan); n > 0 {
+		pending = append(pending, fmt.Sprintf("%d input pack(s) in flight", n))
+	}
+	if n := poolSize - len(pc.injectRecycleChan); n > 0 {
+		pending = append(pending, fmt.Sprintf("%d inject pack(s) in flight", n))
+	}
+
+	runnerPending := func(kind, name string, runner *foRunner) {
+		queued := len(runner.inChan)
+		if runner.matcher != nil {
+			queued += len(runner.matcher.inChan)
+		}
+		if queued > 0 {
+			pending = append(pending, fmt.Sprintf("%s '%s': %d message(s) queued",
+				kind, name, queued))
+		}
+		if runner.useBuffering && runner.bufReader != nil {
+			if n := runner.bufReader.UnackedBytes(); n > 0 {
+				pending = append(pending, fmt.Sprintf(
+					"%s '%s': %d byte(s) undelivered in disk buffer", kind, name, n))
+			}
+		}
+	}
+
+	pc.filtersLock.RLock()
+	names := make([]string, 0, len(pc.FilterRunners))
+	for name := range pc.FilterRunners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if runner, ok := pc.FilterRunners[name].(*foRunner); ok {
+			runnerPending("filter", name, runner)
+		}
+	}
+	pc.filtersLock.RUnlock()
+
+	pc.outputsLock.RLock()
+	names = make([]string, 0, len(pc.OutputRunners))
+	for name := range pc.OutputRunners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if runner, ok := pc.OutputRunners[name].(*foRunner); ok {
+			runnerPending("output", name, runner)
+		}
+	}
+	pc.outputsLock.RUnlock()
+	return pending
+}
+
+// Waits for all in-flight messages to be fully processed and for all output
+// disk buffers to be emptied, giving up after the timeout. Should only be
+// called after the inputs have stopped. Returns whatever remained
+// undelivered, or an empty slice if the pipeline drained completely.
+func (pc *PipelineConfig) drain(timeout time.Duration) []string {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		pending := pc.undelivered()
+		if len(pending) == 0 {
+			return pending
+		}
+		select {
+		case <-deadline:
+			return pending
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain is drain for plugins, such as inputs that shut hekad down once their
+// source is used up, and so want what they read to be processed first. Other
+// inputs carrying on keep it from draining completely.
+func (pc *PipelineConfig) Drain(timeout time.Duration) []string {
+	return pc.drain(timeout)
+}
@@ -0,0 +1,74 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func DrainSpec(c gs.Context) {
+	globals := DefaultGlobals()
+	globals.PoolSize = 2
+	pConfig := NewPipelineConfig(globals)
+	for i := 0; i < globals.PoolSize; i++ {
+		pConfig.inputRecycleChan <- NewPipelinePack(pConfig.inputRecycleChan)
+		pConfig.injectRecycleChan <- NewPipelinePack(pConfig.injectRecycleChan)
+	}
+	drainPollInterval = time.Millisecond
+
+	c.Specify("A drained pipeline has nothing undelivered", func() {
+		c.Expect(len(pConfig.undelivered()), gs.Equals, 0)
+		c.Expect(len(pConfig.drain(time.Second)), gs.Equals, 0)
+	})
+
+	c.Specify("Drain reports in-flight and queued messages", func() {
+		pack := <-pConfig.inputRecycleChan
+		runner := &foRunner{inChan: make(chan *PipelinePack, 1)}
+		runner.inChan <- pack
+		pConfig.OutputRunners["out"] = runner
+
+		pending := pConfig.drain(10 * time.Millisecond)
+		c.Expect(len(pending), gs.Equals, 2)
+		c.Expect(pending[0], gs.Equals, "1 input pack(s) in flight")
+		c.Expect(pending[1], gs.Equals, "output 'out': 1 message(s) queued")
+
+		c.Specify("and completes once they're processed", func() {
+			go func() {
+				time.Sleep(5 * time.Millisecond)
+				(<-runner.inChan).recycle()
+			}()
+			c.Expect(len(pConfig.drain(time.Second)), gs.Equals, 0)
+		})
+	})
+
+	c.Specify("A BufferReader counts unacknowledged queue bytes", func() {
+		tmpDir, err := ioutil.TempDir("", "drain-tests")
+		c.Assume(err, gs.IsNil)
+		defer os.RemoveAll(tmpDir)
+		for name, size := range map[string]int{"0.log": 5, "1.log": 30, "2.log": 20} {
+			err = ioutil.WriteFile(filepath.Join(tmpDir, name), make([]byte, size), 0644)
+			c.Assume(err, gs.IsNil)
+		}
+		br := &BufferReader{queue: tmpDir, cursorId: 1, cursorOffset: 10}
+		c.Expect(br.UnackedBytes(), gs.Equals, uint64(40))
+		br.cursorId, br.cursorOffset = 2, 20
+		c.Expect(br.UnackedBytes(), gs.Equals, uint64(0))
+	})
+}
@@ -0,0 +1,72 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+)
+
+// An Encoder made of an output's encoder_chain. The first encoder encodes
+// the message, and each of the wrappers following it transforms the bytes
+// produced by the previous one.
+type encoderChain struct {
+	encoder  Encoder
+	wrappers []WrapperEncoder
+}
+
+func (c *encoderChain) Encode(pack *PipelinePack) (output []byte, err error) {
+	if output, err = c.encoder.Encode(pack); err != nil || output == nil {
+		return
+	}
+	for _, wrapper := range c.wrappers {
+		if output, err = wrapper.EncodeBytes(output); err != nil || output == nil {
+			return
+		}
+	}
+	return
+}
+
+// The chain produces whatever its last encoder does.
+func (c *encoderChain) ContentType() string {
+	var last Encoder = c.encoder
+	if len(c.wrappers) > 0 {
+		last = c.wrappers[len(c.wrappers)-1].(Encoder)
+	}
+	return encoderContentType(last)
+}
+
+// Creates the encoders of the runner's encoder_chain, each named after the
+// runner and its position in the chain.
+func (foRunner *foRunner) makeEncoderChain() (*encoderChain, error) {
+	chain := new(encoderChain)
+	for i, name := range foRunner.config.EncoderChain {
+		fullName := fmt.Sprintf("%s-%d-%s", foRunner.name, i, name)
+		encoder, ok := foRunner.pConfig.Encoder(name, fullName)
+		if !ok {
+			return nil, fmt.Errorf("%s can't create encoder %s", foRunner.name, name)
+		}
+		if i == 0 {
+			chain.encoder = encoder
+			continue
+		}
+		wrapper, ok := encoder.(WrapperEncoder)
+		if !ok {
+			return nil, fmt.Errorf("%s encoder_chain: %s can't follow another encoder",
+				foRunner.name, name)
+		}
+		chain.wrappers = append(chain.wrappers, wrapper)
+	}
+	return chain, nil
+}
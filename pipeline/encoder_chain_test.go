@@ -0,0 +1,91 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bytes"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+type chainPayloadEncoder struct{}
+
+func (e *chainPayloadEncoder) Init(config interface{}) error {
+	return nil
+}
+
+func (e *chainPayloadEncoder) Encode(pack *PipelinePack) ([]byte, error) {
+	return []byte(pack.Message.GetPayload()), nil
+}
+
+type chainUpperEncoder struct{}
+
+func (e *chainUpperEncoder) Init(config interface{}) error {
+	return nil
+}
+
+func (e *chainUpperEncoder) Encode(pack *PipelinePack) ([]byte, error) {
+	return e.EncodeBytes(pack.MsgBytes)
+}
+
+func (e *chainUpperEncoder) EncodeBytes(input []byte) ([]byte, error) {
+	return bytes.ToUpper(input), nil
+}
+
+func EncoderChainSpec(c gs.Context) {
+	RegisterPlugin("ChainPayloadEncoder", func() interface{} {
+		return new(chainPayloadEncoder)
+	})
+	RegisterPlugin("ChainUpperEncoder", func() interface{} {
+		return new(chainUpperEncoder)
+	})
+	pConfig := NewPipelineConfig(nil)
+	c.Assume(pConfig.RegisterDefault("ChainPayloadEncoder"), gs.IsNil)
+	c.Assume(pConfig.RegisterDefault("ChainUpperEncoder"), gs.IsNil)
+	runner := &foRunner{
+		pRunnerBase: pRunnerBase{name: "out"},
+		pConfig:     pConfig,
+	}
+	pack := NewPipelinePack(make(chan *PipelinePack, 1))
+	pack.Message.SetPayload("shout")
+
+	c.Specify("An encoder chain", func() {
+		c.Specify("runs each wrapper on the previous encoder's output", func() {
+			runner.config.EncoderChain = []string{"ChainPayloadEncoder",
+				"ChainUpperEncoder", "ChainUpperEncoder"}
+			chain, err := runner.makeEncoderChain()
+			c.Assume(err, gs.IsNil)
+			c.Expect(len(chain.wrappers), gs.Equals, 2)
+			output, err := chain.Encode(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(output), gs.Equals, "SHOUT")
+			_, ok := pConfig.allEncoders["out-2-ChainUpperEncoder"]
+			c.Expect(ok, gs.IsTrue)
+		})
+
+		c.Specify("only lets wrapper encoders follow the first", func() {
+			runner.config.EncoderChain = []string{"ChainUpperEncoder",
+				"ChainPayloadEncoder"}
+			_, err := runner.makeEncoderChain()
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("fails on unknown encoders", func() {
+			runner.config.EncoderChain = []string{"ChainPayloadEncoder", "NoEncoder"}
+			_, err := runner.makeEncoderChain()
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,165 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"heka/message"
+)
+
+// Spreads the messages matched by a filter's matcher across the filter's
+// instances, either taking turns or by hashing a key from each message so
+// that all of the messages with the same key are handled by the same
+// instance.
+type instanceDispatcher struct {
+	// The instances, the first of which owns the matcher.
+	instances []*foRunner
+	// Extracts a message's key, nil when taking turns. Messages for which no
+	// key is found are also handed out in turns.
+	key func(msg *message.Message) (string, bool)
+	// Index of the instance the next message goes to when taking turns. Only
+	// accessed from the matcher's goroutine.
+	next int
+}
+
+func newInstanceDispatcher(instances []*foRunner, dispatch, shardBy string) (
+	*instanceDispatcher, error) {
+
+	d := &instanceDispatcher{instances: instances}
+	switch dispatch {
+	case "round_robin":
+		if shardBy != "" {
+			return nil, errors.New("shard_by requires 'hash' dispatch")
+		}
+	case "", "hash":
+		if shardBy != "" {
+			var err error
+			if d.key, err = MessageKey(shardBy); err != nil {
+				return nil, fmt.Errorf("can't shard by '%s'", shardBy)
+			}
+		} else if dispatch == "hash" {
+			d.key = sourceKey
+		}
+	default:
+		return nil, fmt.Errorf("dispatch must be 'round_robin' or 'hash', got '%s'",
+			dispatch)
+	}
+	return d, nil
+}
+
+// The default key for hash dispatch, the message's source.
+func sourceKey(msg *message.Message) (string, bool) {
+	return msg.GetHostname() + "\x00" + msg.GetLogger(), true
+}
+
+// MessageKey returns a function extracting a key from a message, such as
+// shard_by's, named by either a header name or a field name wrapped in
+// "Fields[]". The function returns false if the message has no such key.
+func MessageKey(key string) (func(msg *message.Message) (string, bool), error) {
+	if l := len(key); l > 8 && strings.HasPrefix(key, "Fields[") &&
+		key[l-1] == ']' {
+
+		name := key[7 : l-1]
+		return func(msg *message.Message) (string, bool) {
+			value, ok := msg.GetFieldValue(name)
+			if !ok {
+				return "", false
+			}
+			return fmt.Sprint(value), true
+		}, nil
+	}
+	var header func(msg *message.Message) string
+	switch key {
+	case "Type":
+		header = (*message.Message).GetType
+	case "Logger":
+		header = (*message.Message).GetLogger
+	case "Hostname":
+		header = (*message.Message).GetHostname
+	case "EnvVersion":
+		header = (*message.Message).GetEnvVersion
+	case "Payload":
+		header = (*message.Message).GetPayload
+	default:
+		return nil, fmt.Errorf("unknown message key '%s'", key)
+	}
+	return func(msg *message.Message) (string, bool) {
+		value := header(msg)
+		return value, value != ""
+	}, nil
+}
+
+// Picks the instance that should process the pack.
+func (d *instanceDispatcher) pick(pack *PipelinePack) *foRunner {
+	if d.key != nil {
+		if key, ok := d.key(pack.Message); ok {
+			h := fnv.New32a()
+			h.Write([]byte(key))
+			return d.instances[h.Sum32()%uint32(len(d.instances))]
+		}
+	}
+	instance := d.instances[d.next]
+	d.next = (d.next + 1) % len(d.instances)
+	return instance
+}
+
+// Hands a matched pack to one of the instances.
+func (d *instanceDispatcher) deliver(pack *PipelinePack) {
+	instance := d.pick(pack)
+	pack.diagnostics.AddStamp(instance)
+	instance.inChan <- pack
+}
+
+// Closes the input channels of all but the first instance, whose channel is
+// the matcher's own matchChan, so that they shut down along with it.
+func (d *instanceDispatcher) close() {
+	for _, instance := range d.instances[1:] {
+		close(instance.inChan)
+	}
+}
+
+// Makes the additional instances of a filter configured with `instances`
+// greater than one, named after the filter with their instance number
+// appended, and puts them all behind the first instance's matcher.
+func (self *PipelineConfig) makeFilterInstances(maker PluginMaker,
+	primary *foRunner) ([]*foRunner, error) {
+
+	count := int(primary.config.Instances)
+	instances := make([]*foRunner, 1, count)
+	instances[0] = primary
+	for i := 2; i <= count; i++ {
+		runner, err := maker.MakeRunner(fmt.Sprintf("%s-%d", primary.name, i))
+		if err != nil {
+			return nil, err
+		}
+		instance := runner.(*foRunner)
+		instance.instanceOf = primary
+		instance.matcher = primary.matcher
+		instance.injectLimit = primary.injectLimit
+		instance.received = primary.received
+		instances = append(instances, instance)
+	}
+	dispatcher, err := newInstanceDispatcher(instances, primary.config.Dispatch,
+		primary.config.ShardBy)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' %s", primary.name, err)
+	}
+	primary.matcher.dispatch = dispatcher
+	return instances, nil
+}
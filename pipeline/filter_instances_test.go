@@ -0,0 +1,161 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"path/filepath"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+)
+
+func FilterInstancesSpec(c gs.Context) {
+	recycleChan := make(chan *PipelinePack, 6)
+	newPack := func(hostname string) *PipelinePack {
+		pack := NewPipelinePack(recycleChan)
+		pack.Message.SetHostname(hostname)
+		pack.RefCount = 1
+		return pack
+	}
+	newInstances := func() []*foRunner {
+		instances := make([]*foRunner, 3)
+		for i, name := range []string{"filter", "filter-2", "filter-3"} {
+			instances[i] = &foRunner{
+				pRunnerBase: pRunnerBase{name: name},
+				inChan:      make(chan *PipelinePack, 6),
+			}
+		}
+		return instances
+	}
+
+	c.Specify("An instanceDispatcher", func() {
+		instances := newInstances()
+
+		c.Specify("takes turns by default", func() {
+			d, err := newInstanceDispatcher(instances, "", "")
+			c.Assume(err, gs.IsNil)
+			for i := 0; i < 6; i++ {
+				c.Expect(d.pick(newPack("")), gs.Equals, instances[i%3])
+			}
+		})
+
+		c.Specify("keeps each source on one instance when hashing", func() {
+			d, err := newInstanceDispatcher(instances, "hash", "")
+			c.Assume(err, gs.IsNil)
+			first := d.pick(newPack("web1"))
+			for i := 0; i < 5; i++ {
+				c.Expect(d.pick(newPack("web1")), gs.Equals, first)
+			}
+		})
+
+		c.Specify("keeps each shard_by key on one instance", func() {
+			d, err := newInstanceDispatcher(instances, "", "Fields[user_id]")
+			c.Assume(err, gs.IsNil)
+			keyed := func(hostname string, userId int64) *PipelinePack {
+				pack := newPack(hostname)
+				message.NewInt64Field(pack.Message, "user_id", userId, "")
+				return pack
+			}
+			for userId := int64(0); userId < 10; userId++ {
+				first := d.pick(keyed("web1", userId))
+				c.Expect(d.pick(keyed("web2", userId)), gs.Equals, first)
+				c.Expect(d.pick(keyed("web3", userId)), gs.Equals, first)
+			}
+
+			// Messages without the key are handed out in turns.
+			for i := 0; i < 6; i++ {
+				c.Expect(d.pick(newPack("web1")), gs.Equals, instances[i%3])
+			}
+		})
+
+		c.Specify("shards by message headers", func() {
+			d, err := newInstanceDispatcher(instances, "hash", "Type")
+			c.Assume(err, gs.IsNil)
+			pack := newPack("web1")
+			pack.Message.SetType("login")
+			first := d.pick(pack)
+			pack.Message.SetHostname("web2")
+			c.Expect(d.pick(pack), gs.Equals, first)
+		})
+
+		c.Specify("rejects bad shard_by settings", func() {
+			_, err := newInstanceDispatcher(instances, "", "Uuid")
+			c.Expect(err, gs.Not(gs.IsNil))
+			_, err = newInstanceDispatcher(instances, "", "Fields[]")
+			c.Expect(err, gs.Not(gs.IsNil))
+			_, err = newInstanceDispatcher(instances, "round_robin", "Type")
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("rejects unknown dispatch methods", func() {
+			_, err := newInstanceDispatcher(instances, "random", "")
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+
+	c.Specify("A MatchRunner shared by filter instances", func() {
+		instances := newInstances()
+		mr, err := NewMatchRunner("TRUE", "", instances[0], 6, instances[0].inChan)
+		c.Assume(err, gs.IsNil)
+		mr.dispatch, err = newInstanceDispatcher(instances, "round_robin", "")
+		c.Assume(err, gs.IsNil)
+		mr.Start(1)
+
+		packs := make([]*PipelinePack, 3)
+		for i := range packs {
+			packs[i] = newPack("")
+			mr.inChan <- packs[i]
+		}
+		for i, instance := range instances {
+			pack := <-instance.inChan
+			c.Expect(pack, gs.Equals, packs[i])
+			c.Expect(pack.diagnostics.PluginNames()[0], gs.Equals, instance.name)
+		}
+
+		// Closing the matcher closes every instance's channel.
+		mr.Close()
+		for _, instance := range instances {
+			_, ok := <-instance.inChan
+			c.Expect(ok, gs.IsFalse)
+		}
+	})
+
+	c.Specify("A config with filter instances", func() {
+		pConfig := NewPipelineConfig(nil)
+
+		c.Specify("makes the instances behind one matcher", func() {
+			err := pConfig.PreloadFromConfigFile(filepath.Join(".", "testsupport",
+				"config_test_instances.toml"))
+			c.Assume(err, gs.IsNil)
+			c.Assume(pConfig.LoadConfig(), gs.IsNil)
+			c.Expect(len(pConfig.FilterRunners), gs.Equals, 3)
+			primary := pConfig.FilterRunners["CounterFilter"].(*foRunner)
+			for _, name := range []string{"CounterFilter-2", "CounterFilter-3"} {
+				instance := pConfig.FilterRunners[name].(*foRunner)
+				c.Expect(instance.instanceOf, gs.Equals, primary)
+				c.Expect(instance.MatchRunner(), gs.Equals, primary.MatchRunner())
+				c.Expect(instance.Plugin() == primary.Plugin(), gs.IsFalse)
+			}
+			c.Expect(primary.MatchRunner().dispatch.key, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("rejects unknown dispatch methods", func() {
+			err := pConfig.PreloadFromConfigFile(filepath.Join(".", "testsupport",
+				"config_bad_instances.toml"))
+			c.Assume(err, gs.IsNil)
+			c.Expect(pConfig.LoadConfig(), gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,66 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"heka/message"
+)
+
+// Non-zero when FIPS mode is enabled, accessed atomically.
+var fipsMode int32
+
+func init() {
+	// Picks up the `fips` build tag setting.
+	SetFipsMode(false)
+}
+
+// SetFipsMode enables or disables FIPS mode, in which Heka restricts its use
+// of cryptography to FIPS 140-2 approved algorithms: TLS configs are limited
+// to approved protocol versions, cipher suites, and curves, and messages
+// signed with HMAC-MD5 fail authentication. Configs asking for algorithms
+// that aren't approved are refused when they're loaded. Binaries built with
+// the `fips` build tag are always in FIPS mode, so it can't be disabled.
+func SetFipsMode(enabled bool) {
+	var val int32
+	if enabled || fipsBuild {
+		val = 1
+	}
+	atomic.StoreInt32(&fipsMode, val)
+}
+
+// FipsMode returns true if FIPS mode is enabled.
+func FipsMode() bool {
+	return atomic.LoadInt32(&fipsMode) == 1
+}
+
+// CheckFipsSigning returns an error if FIPS mode is enabled and the signing
+// config uses a hash function that isn't approved, i.e. anything but
+// HMAC-SHA1 or HMAC-SHA256.
+func CheckFipsSigning(msc *message.MessageSigningConfig) error {
+	if !FipsMode() || msc == nil || msc.Name == "" {
+		return nil
+	}
+	switch msc.Hash {
+	case "sha1", "sha256":
+		return nil
+	case "":
+		// MD5 is the default.
+		return fmt.Errorf("signer '%s': md5 isn't allowed in FIPS mode", msc.Name)
+	}
+	return fmt.Errorf("signer '%s': %s isn't allowed in FIPS mode", msc.Name, msc.Hash)
+}
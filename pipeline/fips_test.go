@@ -0,0 +1,41 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"heka/message"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func FipsSpec(c gs.Context) {
+	c.Specify("A message signing config", func() {
+		msc := &message.MessageSigningConfig{Name: "test", Key: "testkey"}
+
+		c.Specify("may use any hash outside of FIPS mode", func() {
+			c.Expect(CheckFipsSigning(msc), gs.IsNil)
+		})
+
+		c.Specify("is limited to approved hashes in FIPS mode", func() {
+			SetFipsMode(true)
+			defer SetFipsMode(false)
+			c.Expect(CheckFipsSigning(msc), gs.Not(gs.IsNil))
+			msc.Hash = "ed25519"
+			c.Expect(CheckFipsSigning(msc), gs.Not(gs.IsNil))
+			msc.Hash = "sha256"
+			c.Expect(CheckFipsSigning(msc), gs.IsNil)
+		})
+	})
+}
@@ -0,0 +1,399 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"heka/message"
+)
+
+// How long a node that has left the mesh stays in the cluster report.
+var gossipDepartedRetention = time.Hour
+
+// Gossip mesh settings, from the `[hekad.gossip]` config section.
+type GossipConfig struct {
+	// Address to listen on for gossip from the other nodes. Defaults to
+	// "0.0.0.0".
+	BindAddress string `toml:"bind_address"`
+	// Port to listen on, for both TCP and UDP. Defaults to 7946.
+	BindPort int `toml:"bind_port"`
+	// Address and port the other nodes should use to reach this one, if
+	// different from the bind address, e.g. behind NAT.
+	AdvertiseAddress string `toml:"advertise_address"`
+	AdvertisePort    int    `toml:"advertise_port"`
+	// Addresses ("host:port") of existing mesh members to join through. Any
+	// one that's reachable will do.
+	Join []string `toml:"join"`
+	// Name identifying this node in the mesh, which must be unique. Defaults
+	// to the hostname.
+	NodeName string `toml:"node_name"`
+	// Base64 encoded 16, 24 or 32 byte key used to encrypt gossip. All nodes
+	// must use the same key. Defaults to no encryption.
+	SecretKey string `toml:"secret_key"`
+	// Number of seconds between refreshes of this node's load summary.
+	// Defaults to 10.
+	UpdateInterval uint `toml:"update_interval"`
+}
+
+// Validate checks that the settings are usable.
+func (c *GossipConfig) Validate() error {
+	if c.BindPort < 0 || c.BindPort > 65535 {
+		return fmt.Errorf("invalid gossip bind_port %d", c.BindPort)
+	}
+	if c.AdvertisePort < 0 || c.AdvertisePort > 65535 {
+		return fmt.Errorf("invalid gossip advertise_port %d", c.AdvertisePort)
+	}
+	if c.SecretKey != "" {
+		key, err := base64.StdEncoding.DecodeString(c.SecretKey)
+		if err != nil {
+			return fmt.Errorf("can't decode gossip secret_key: %s", err)
+		}
+		if err = memberlist.ValidateKey(key); err != nil {
+			return fmt.Errorf("invalid gossip secret_key: %s", err)
+		}
+	}
+	return nil
+}
+
+// Identity and load of a hekad, gossiped to the rest of the mesh as node
+// metadata. It has to fit in memberlist.MetaMaxSize bytes of JSON.
+type gossipSummary struct {
+	Hostname  string
+	Version   string
+	Pid       int32
+	StartTime int64
+	Inputs    int
+	Filters   int
+	Outputs   int
+	// Messages processed by the router, in total and per second since the
+	// last refresh.
+	ProcessMessageCount int64
+	ProcessMessageRate  float64
+	// Free packs in the input and inject pools, out of PoolSize each.
+	InputPoolFree  int
+	InjectPoolFree int
+	PoolSize       int
+	HeapAlloc      uint64
+	UpdateTime     int64
+}
+
+// A node that has left the mesh, or stopped answering, as last seen.
+type gossipDeparted struct {
+	node     memberlist.Node
+	leftTime time.Time
+}
+
+// Exchanges identity and load summaries with the other hekads of the mesh.
+type gossipMesh struct {
+	pConfig  *PipelineConfig
+	conf     *GossipConfig
+	list     *memberlist.Memberlist
+	interval time.Duration
+	started  time.Time
+	// Protects meta, the encoded summary of this node, and the router count
+	// as of the last refresh.
+	lock      sync.Mutex
+	meta      []byte
+	lastCount int64
+	lastTime  time.Time
+	// Protects departed, keyed by node name.
+	departedLock sync.Mutex
+	departed     map[string]gossipDeparted
+	stopChan     chan struct{}
+	wg           sync.WaitGroup
+}
+
+// Joins the gossip mesh described by the global config, which must be set.
+func startGossip(pConfig *PipelineConfig) (*gossipMesh, error) {
+	conf := pConfig.Globals.Gossip
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	interval := time.Duration(conf.UpdateInterval) * time.Second
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	g := &gossipMesh{
+		pConfig:  pConfig,
+		conf:     conf,
+		interval: interval,
+		started:  time.Now(),
+		departed: make(map[string]gossipDeparted),
+		stopChan: make(chan struct{}),
+	}
+	g.refresh()
+
+	mlConf := memberlist.DefaultLANConfig()
+	mlConf.Name = conf.NodeName
+	if mlConf.Name == "" {
+		mlConf.Name = pConfig.Globals.Hostname
+	}
+	if conf.BindAddress != "" {
+		mlConf.BindAddr = conf.BindAddress
+	}
+	if conf.BindPort != 0 {
+		mlConf.BindPort = conf.BindPort
+	}
+	mlConf.AdvertiseAddr = conf.AdvertiseAddress
+	mlConf.AdvertisePort = mlConf.BindPort
+	if conf.AdvertisePort != 0 {
+		mlConf.AdvertisePort = conf.AdvertisePort
+	}
+	if conf.SecretKey != "" {
+		mlConf.SecretKey, _ = base64.StdEncoding.DecodeString(conf.SecretKey)
+	}
+	mlConf.Delegate = g
+	mlConf.Events = g
+	mlConf.LogOutput = gossipLogWriter{}
+
+	var err error
+	if g.list, err = memberlist.Create(mlConf); err != nil {
+		return nil, err
+	}
+	g.join()
+	g.wg.Add(1)
+	go g.run()
+	return g, nil
+}
+
+// Joins through the configured members, unless there aren't any or we
+// already know of other nodes.
+func (g *gossipMesh) join() {
+	if len(g.conf.Join) == 0 || g.list.NumMembers() > 1 {
+		return
+	}
+	if _, err := g.list.Join(g.conf.Join); err != nil {
+		LogError.Printf("Can't join gossip mesh: %s", err)
+	}
+}
+
+// Refreshes this node's summary each interval, retrying the join until it
+// succeeds.
+func (g *gossipMesh) run() {
+	defer g.wg.Done()
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stopChan:
+			return
+		case <-ticker.C:
+			g.refresh()
+			if err := g.list.UpdateNode(g.interval); err != nil {
+				LogError.Printf("Can't gossip node summary: %s", err)
+			}
+			g.join()
+		}
+	}
+}
+
+// Gathers and encodes this node's current summary.
+func (g *gossipMesh) refresh() {
+	pc := g.pConfig
+	summary := gossipSummary{
+		Hostname:       pc.hostname,
+		Version:        pc.Globals.Version,
+		Pid:            pc.pid,
+		StartTime:      g.started.UnixNano(),
+		Outputs:        len(pc.OutputRunners),
+		InputPoolFree:  len(pc.inputRecycleChan),
+		InjectPoolFree: len(pc.injectRecycleChan),
+		PoolSize:       pc.Globals.PoolSize,
+	}
+	pc.inputsLock.Lock()
+	summary.Inputs = len(pc.InputRunners)
+	pc.inputsLock.Unlock()
+	pc.filtersLock.Lock()
+	summary.Filters = len(pc.FilterRunners)
+	pc.filtersLock.Unlock()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	summary.HeapAlloc = m.HeapAlloc
+
+	now := time.Now()
+	count := atomic.LoadInt64(&pc.router.processMessageCount)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	summary.ProcessMessageCount = count
+	if secs := now.Sub(g.lastTime).Seconds(); !g.lastTime.IsZero() && secs > 0 {
+		summary.ProcessMessageRate = float64(count-g.lastCount) / secs
+	}
+	g.lastCount, g.lastTime = count, now
+	summary.UpdateTime = now.UnixNano()
+	meta, err := json.Marshal(summary)
+	if err != nil {
+		LogError.Printf("Can't encode node summary: %s", err)
+		return
+	}
+	g.meta = meta
+}
+
+// NodeMeta, from memberlist.Delegate, returns this node's summary.
+func (g *gossipMesh) NodeMeta(limit int) []byte {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if len(g.meta) > limit {
+		return nil
+	}
+	return g.meta
+}
+
+// The rest of memberlist.Delegate is unused, everything we gossip is in the
+// node metadata.
+func (g *gossipMesh) NotifyMsg([]byte)                           {}
+func (g *gossipMesh) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+func (g *gossipMesh) LocalState(join bool) []byte                { return nil }
+func (g *gossipMesh) MergeRemoteState(buf []byte, join bool)     {}
+
+// NotifyJoin, from memberlist.EventDelegate, forgets that a rejoining node
+// had left.
+func (g *gossipMesh) NotifyJoin(node *memberlist.Node) {
+	g.departedLock.Lock()
+	delete(g.departed, node.Name)
+	g.departedLock.Unlock()
+	LogInfo.Printf("Gossip mesh node joined: %s (%s)", node.Name, node.Address())
+}
+
+// NotifyLeave, from memberlist.EventDelegate, remembers a departed node for
+// the cluster report.
+func (g *gossipMesh) NotifyLeave(node *memberlist.Node) {
+	g.departedLock.Lock()
+	g.departed[node.Name] = gossipDeparted{node: *node, leftTime: time.Now()}
+	g.departedLock.Unlock()
+	LogInfo.Printf("Gossip mesh node left: %s (%s)", node.Name, node.Address())
+}
+
+func (g *gossipMesh) NotifyUpdate(node *memberlist.Node) {}
+
+// Leaves the mesh letting the other nodes know we've gone.
+func (g *gossipMesh) stop() {
+	close(g.stopChan)
+	g.wg.Wait()
+	if err := g.list.Leave(g.interval); err != nil {
+		LogError.Printf("Can't leave gossip mesh: %s", err)
+	}
+	g.list.Shutdown()
+}
+
+// One node's entry in the cluster report.
+type clusterReportMember struct {
+	gossipSummary
+	Name    string
+	Address string
+	// "alive", "suspect" (not answering but not yet given up on), or "left".
+	State    string
+	LeftTime int64 `json:",omitempty"`
+}
+
+// Returns every known node of the mesh, with its latest summary, ordered by
+// name.
+func (g *gossipMesh) members() []clusterReportMember {
+	var members []clusterReportMember
+	add := func(node *memberlist.Node, state string) clusterReportMember {
+		member := clusterReportMember{
+			Name:    node.Name,
+			Address: node.Address(),
+			State:   state,
+		}
+		if len(node.Meta) > 0 {
+			if err := json.Unmarshal(node.Meta, &member.gossipSummary); err != nil {
+				LogError.Printf("Can't decode summary of gossip mesh node %s: %s",
+					node.Name, err)
+			}
+		}
+		return member
+	}
+	for _, node := range g.list.Members() {
+		state := "alive"
+		if node.State == memberlist.StateSuspect {
+			state = "suspect"
+		}
+		members = append(members, add(node, state))
+	}
+
+	g.departedLock.Lock()
+	now := time.Now()
+	for name, departed := range g.departed {
+		if now.Sub(departed.leftTime) > gossipDepartedRetention {
+			delete(g.departed, name)
+			continue
+		}
+		member := add(&departed.node, "left")
+		member.LeftTime = departed.leftTime.UnixNano()
+		members = append(members, member)
+	}
+	g.departedLock.Unlock()
+
+	sort.Slice(members, func(a, b int) bool {
+		return members[a].Name < members[b].Name
+	})
+	return members
+}
+
+// Generates the "heka.cluster-report" message, whose payload is a JSON
+// object listing every node of the gossip mesh, or nil if the mesh isn't
+// configured.
+func (pc *PipelineConfig) clusterReportMsg() (*PipelinePack, error) {
+	if pc.gossip == nil {
+		return nil, nil
+	}
+	members := pc.gossip.members()
+	var alive int
+	for _, member := range members {
+		if member.State == "alive" {
+			alive++
+		}
+	}
+	buffer := new(bytes.Buffer)
+	if err := json.NewEncoder(buffer).Encode(map[string]interface{}{
+		"Node":    pc.gossip.list.LocalNode().Name,
+		"Members": members,
+	}); err != nil {
+		return nil, err
+	}
+
+	pack, err := pc.PipelinePack(0)
+	if err != nil {
+		return nil, err
+	}
+	msg := pack.Message
+	msg.SetLogger(HEKA_DAEMON)
+	msg.SetType("heka.cluster-report")
+	msg.SetPayload(buffer.String())
+	message.NewIntField(msg, "MemberCount", len(members), "count")
+	message.NewIntField(msg, "AliveCount", alive, "count")
+	return pack, nil
+}
+
+// Passes memberlist's warnings and errors on to the error log, dropping the
+// chatter.
+type gossipLogWriter struct{}
+
+func (w gossipLogWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("[ERR]")) || bytes.Contains(p, []byte("[WARN]")) {
+		LogError.Printf("Gossip mesh: %s", bytes.TrimSpace(p))
+	}
+	return len(p), nil
+}
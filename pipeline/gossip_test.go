@@ -0,0 +1,136 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func GossipSpec(c gs.Context) {
+	freePort := func() int {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		c.Assume(err, gs.IsNil)
+		defer l.Close()
+		return l.Addr().(*net.TCPAddr).Port
+	}
+	newNode := func(name string, join ...string) (*PipelineConfig, int) {
+		port := freePort()
+		globals := DefaultGlobals()
+		globals.Version = "0.11.0"
+		globals.Gossip = &GossipConfig{
+			BindAddress: "127.0.0.1",
+			BindPort:    port,
+			NodeName:    name,
+			Join:        join,
+		}
+		pConfig := NewPipelineConfig(globals)
+		var err error
+		pConfig.gossip, err = startGossip(pConfig)
+		c.Assume(err, gs.IsNil)
+		return pConfig, port
+	}
+	// Waits for the node to see the member in the given state.
+	waitForMember := func(pConfig *PipelineConfig, name, state string) (
+		member clusterReportMember, ok bool) {
+
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			for _, member = range pConfig.gossip.members() {
+				if member.Name == name && member.State == state {
+					return member, true
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return member, false
+	}
+
+	c.Specify("A GossipConfig", func() {
+		c.Specify("accepts an AES key", func() {
+			conf := &GossipConfig{SecretKey: "8Bp9cWzOmDo7ub0bkL7jAg=="}
+			c.Expect(conf.Validate(), gs.IsNil)
+		})
+
+		c.Specify("rejects a key of the wrong size", func() {
+			conf := &GossipConfig{SecretKey: "c2hvcnQ="}
+			c.Expect(conf.Validate(), gs.Not(gs.IsNil))
+		})
+	})
+
+	c.Specify("A gossip mesh", func() {
+		pc1, port1 := newNode("node1")
+		defer pc1.gossip.stop()
+		pc2, _ := newNode("node2", fmt.Sprintf("127.0.0.1:%d", port1))
+		stopped := false
+		defer func() {
+			if !stopped {
+				pc2.gossip.stop()
+			}
+		}()
+
+		c.Specify("shares each node's summary", func() {
+			member, ok := waitForMember(pc1, "node2", "alive")
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(member.Version, gs.Equals, "0.11.0")
+			c.Expect(member.Hostname, gs.Equals, pc2.hostname)
+			c.Expect(member.PoolSize, gs.Equals, pc2.Globals.PoolSize)
+			_, ok = waitForMember(pc2, "node1", "alive")
+			c.Expect(ok, gs.IsTrue)
+		})
+
+		c.Specify("reports every member", func() {
+			_, ok := waitForMember(pc1, "node2", "alive")
+			c.Assume(ok, gs.IsTrue)
+			pc1.injectRecycleChan <- NewPipelinePack(pc1.injectRecycleChan)
+			pack, err := pc1.clusterReportMsg()
+			c.Assume(err, gs.IsNil)
+			c.Expect(pack.Message.GetType(), gs.Equals, "heka.cluster-report")
+			count, _ := pack.Message.GetFieldValue("AliveCount")
+			c.Expect(count, gs.Equals, int64(2))
+
+			var report struct {
+				Node    string
+				Members []clusterReportMember
+			}
+			err = json.Unmarshal([]byte(pack.Message.GetPayload()), &report)
+			c.Expect(err, gs.IsNil)
+			c.Expect(report.Node, gs.Equals, "node1")
+			c.Expect(len(report.Members), gs.Equals, 2)
+			c.Expect(report.Members[0].Name, gs.Equals, "node1")
+			c.Expect(report.Members[1].Name, gs.Equals, "node2")
+		})
+
+		c.Specify("reports members that have left", func() {
+			_, ok := waitForMember(pc1, "node2", "alive")
+			c.Assume(ok, gs.IsTrue)
+			pc2.gossip.stop()
+			stopped = true
+			member, ok := waitForMember(pc1, "node2", "left")
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(member.LeftTime > 0, gs.IsTrue)
+		})
+	})
+
+	c.Specify("A pipeline without gossip has no cluster report", func() {
+		pack, err := NewPipelineConfig(nil).clusterReportMsg()
+		c.Expect(err, gs.IsNil)
+		c.Expect(pack == nil, gs.IsTrue)
+	})
+}
@@ -0,0 +1,387 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"heka/message"
+)
+
+// Expectations for the messages that reach a single output during a config
+// test case.
+type ConfigTestExpect struct {
+	// Name of the output under test.
+	Output string `toml:"output"`
+	// Exact number of messages the output should receive, if specified.
+	Count *int `toml:"count"`
+	// Message matcher expressions, each of which must match the message
+	// received by the output at the same position.
+	Match []string `toml:"match"`
+	// Message matcher expression that every received message must match.
+	AllMatch string `toml:"all_match"`
+	// Expected output of the output's encoder for the message at the same
+	// position.
+	Encoded []string `toml:"encoded"`
+}
+
+// A single config test case.
+type ConfigTestCase struct {
+	Name string `toml:"name"`
+	// Fixture files, keyed by input name. Each file's contents are fed
+	// through the input's splitter and decoder. Inputs that aren't listed
+	// receive no data.
+	Fixtures map[string]string  `toml:"fixtures"`
+	Expect   []ConfigTestExpect `toml:"expect"`
+}
+
+// A set of test cases to be run against a Heka config, loaded from a TOML
+// test spec file.
+type ConfigTestSpec struct {
+	// Heka config file or directory under test, relative to the spec file.
+	Config string `toml:"config"`
+	// Maximum time to wait for each case's messages to be processed,
+	// defaults to "5s".
+	Timeout string            `toml:"timeout"`
+	Cases   []*ConfigTestCase `toml:"case"`
+	dir     string
+	timeout time.Duration
+}
+
+// The outcome of a single config test case.
+type ConfigTestResult struct {
+	Name     string
+	Failures []string
+}
+
+func (r *ConfigTestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *ConfigTestResult) fail(format string, args ...interface{}) {
+	r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+}
+
+// Loads and validates a config test spec file.
+func LoadConfigTestSpec(filename string) (*ConfigTestSpec, error) {
+	spec := &ConfigTestSpec{Timeout: "5s"}
+	if _, err := toml.DecodeFile(filename, spec); err != nil {
+		return nil, fmt.Errorf("Error decoding test spec: %s", err)
+	}
+	var err error
+	if spec.timeout, err = time.ParseDuration(spec.Timeout); err != nil {
+		return nil, fmt.Errorf("Can't parse `timeout` time duration: %s", spec.Timeout)
+	}
+	if len(spec.Cases) == 0 {
+		return nil, fmt.Errorf("No test cases in %s", filename)
+	}
+	spec.dir = filepath.Dir(filename)
+	for i, tc := range spec.Cases {
+		if tc.Name == "" {
+			tc.Name = fmt.Sprintf("case %d", i+1)
+		}
+		for _, expect := range tc.Expect {
+			if expect.Output == "" {
+				return nil, fmt.Errorf("%s: expectation without an `output`", tc.Name)
+			}
+			exprs := append([]string{}, expect.Match...)
+			if expect.AllMatch != "" {
+				exprs = append(exprs, expect.AllMatch)
+			}
+			for _, expr := range exprs {
+				if _, err = message.CreateMatcherSpecification(expr); err != nil {
+					return nil, fmt.Errorf("%s: invalid matcher '%s': %s", tc.Name, expr, err)
+				}
+			}
+		}
+	}
+	return spec, nil
+}
+
+// Returns the path of the Heka config under test, or an empty string if the
+// spec doesn't specify one.
+func (s *ConfigTestSpec) ConfigPath() string {
+	return s.path(s.Config)
+}
+
+func (s *ConfigTestSpec) path(name string) string {
+	if name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(s.dir, name)
+}
+
+// Runs each of the spec's test cases in order, each against a freshly loaded
+// pipeline. newGlobals should return a new GlobalConfigStruct for every call,
+// and preload should preload the config under test into the provided
+// PipelineConfig, usually via PreloadFromConfigPath.
+func (s *ConfigTestSpec) Run(newGlobals func() *GlobalConfigStruct,
+	preload func(pConfig *PipelineConfig) error) []*ConfigTestResult {
+
+	results := make([]*ConfigTestResult, len(s.Cases))
+	for i, tc := range s.Cases {
+		results[i] = s.runCase(tc, newGlobals(), preload)
+	}
+	return results
+}
+
+// Loads the spec file and runs its cases against the config it specifies,
+// using default global settings. Intended for use from Go tests.
+func RunConfigTestFile(filename string) ([]*ConfigTestResult, error) {
+	spec, err := LoadConfigTestSpec(filename)
+	if err != nil {
+		return nil, err
+	}
+	configPath := spec.ConfigPath()
+	if configPath == "" {
+		return nil, fmt.Errorf("%s doesn't specify a `config`", filename)
+	}
+	results := spec.Run(DefaultGlobals, func(pConfig *PipelineConfig) error {
+		return pConfig.PreloadFromConfigPath(configPath)
+	})
+	return results, nil
+}
+
+func (s *ConfigTestSpec) runCase(tc *ConfigTestCase, globals *GlobalConfigStruct,
+	preload func(pConfig *PipelineConfig) error) *ConfigTestResult {
+
+	result := &ConfigTestResult{Name: tc.Name}
+
+	// Keep plugin state out of the configured base_dir.
+	baseDir, err := ioutil.TempDir("", "heka-test")
+	if err != nil {
+		result.fail("can't create base_dir: %s", err)
+		return result
+	}
+	defer os.RemoveAll(baseDir)
+	globals.BaseDir = baseDir
+
+	pConfig := NewPipelineConfig(globals)
+	if err = preload(pConfig); err != nil {
+		result.fail("error reading config: %s", err)
+		return result
+	}
+	fixtures, captures := s.substitute(pConfig, tc, result)
+	if !result.Passed() {
+		return result
+	}
+	if err = pConfig.LoadConfig(); err != nil {
+		result.fail("error loading config: %s", err)
+		for _, msg := range pConfig.LogMsgs {
+			result.fail("%s", msg)
+		}
+		return result
+	}
+
+	exitChan := make(chan int, 1)
+	go func() {
+		exitChan <- Run(pConfig)
+	}()
+
+	deadline := time.After(s.timeout)
+fixtureLoop:
+	for _, fixture := range fixtures {
+		select {
+		case <-fixture.done:
+		case exitCode := <-exitChan:
+			result.fail("hekad exited early with code %d", exitCode)
+			return result
+		case <-deadline:
+			result.fail("timed out delivering fixture to '%s'", fixture.name)
+			break fixtureLoop
+		}
+	}
+	if result.Passed() {
+		for _, desc := range pConfig.drain(s.timeout) {
+			result.fail("undelivered after %s: %s", s.timeout, desc)
+		}
+	}
+	globals.ShutDown(0)
+	if exitCode := <-exitChan; exitCode != 0 {
+		result.fail("hekad exited with code %d", exitCode)
+	}
+
+	for _, expect := range tc.Expect {
+		captures[expect.Output].check(expect, result)
+	}
+	return result
+}
+
+// Replaces every input in the preloaded config with a fixture input, and
+// every output with one that captures whatever it receives. The plugins'
+// original TOML is still used to configure the runners, so the configured
+// splitters, decoders, message matchers, and encoders all still apply.
+func (s *ConfigTestSpec) substitute(pConfig *PipelineConfig, tc *ConfigTestCase,
+	result *ConfigTestResult) (fixtures []*fixtureInput, captures map[string]*captureOutput) {
+
+	inputs := make(map[string]bool)
+	for _, maker := range pConfig.makersByCategory["Input"] {
+		m := maker.(*pluginMaker)
+		fixture := &fixtureInput{
+			name: m.name,
+			path: s.path(tc.Fixtures[m.name]),
+			done: make(chan struct{}),
+			stop: make(chan struct{}),
+		}
+		fixtures = append(fixtures, fixture)
+		m.constructor = func() interface{} { return fixture }
+		inputs[m.name] = true
+	}
+	names := make([]string, 0, len(tc.Fixtures))
+	for name := range tc.Fixtures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !inputs[name] {
+			result.fail("fixture for unknown input '%s'", name)
+		}
+	}
+
+	captures = make(map[string]*captureOutput)
+	for _, maker := range pConfig.makersByCategory["Output"] {
+		m := maker.(*pluginMaker)
+		capture := new(captureOutput)
+		captures[m.name] = capture
+		m.constructor = func() interface{} { return capture }
+	}
+	for _, expect := range tc.Expect {
+		if _, ok := captures[expect.Output]; !ok {
+			result.fail("expectation for unknown output '%s'", expect.Output)
+		}
+	}
+	return fixtures, captures
+}
+
+// Stands in for a configured input, feeding it the contents of a fixture
+// file.
+type fixtureInput struct {
+	name string
+	path string
+	done chan struct{}
+	stop chan struct{}
+}
+
+func (f *fixtureInput) Init(config interface{}) error {
+	return nil
+}
+
+func (f *fixtureInput) Run(ir InputRunner, h PluginHelper) error {
+	func() {
+		defer close(f.done)
+		if f.path == "" {
+			return
+		}
+		file, err := os.Open(f.path)
+		if err != nil {
+			ir.LogError(fmt.Errorf("can't open fixture: %s", err))
+			return
+		}
+		defer file.Close()
+		sRunner := ir.NewSplitterRunner("")
+		defer sRunner.Done()
+		if err = sRunner.SplitStream(file, nil); err != nil && err != io.EOF {
+			ir.LogError(fmt.Errorf("error reading fixture: %s", err))
+		}
+	}()
+	// Wait for shutdown so that the InputRunner doesn't treat this input as
+	// having exited.
+	<-f.stop
+	return nil
+}
+
+func (f *fixtureInput) Stop() {
+	close(f.stop)
+}
+
+// Stands in for a configured output, capturing the messages it receives
+// along with their encoded form.
+type captureOutput struct {
+	lock    sync.Mutex
+	msgs    []*message.Message
+	encoded [][]byte
+}
+
+func (c *captureOutput) Init(config interface{}) error {
+	return nil
+}
+
+func (c *captureOutput) Run(or OutputRunner, h PluginHelper) error {
+	for pack := range or.InChan() {
+		var encoded []byte
+		if or.Encoder() != nil {
+			outBytes, err := or.Encode(pack)
+			if err != nil {
+				or.LogError(fmt.Errorf("Error encoding message: %s", err))
+			}
+			encoded = append(encoded, outBytes...)
+		}
+		c.lock.Lock()
+		c.msgs = append(c.msgs, message.CopyMessage(pack.Message))
+		c.encoded = append(c.encoded, encoded)
+		c.lock.Unlock()
+		or.UpdateCursor(pack.QueueCursor)
+		pack.Recycle(nil)
+	}
+	return nil
+}
+
+func (c *captureOutput) check(expect ConfigTestExpect, result *ConfigTestResult) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	name := expect.Output
+	if expect.Count != nil && len(c.msgs) != *expect.Count {
+		result.fail("output '%s': received %d message(s), expected %d", name,
+			len(c.msgs), *expect.Count)
+	}
+	for i, expr := range expect.Match {
+		if i >= len(c.msgs) {
+			result.fail("output '%s': no message %d to match '%s'", name, i+1, expr)
+			continue
+		}
+		spec, _ := message.CreateMatcherSpecification(expr)
+		if !spec.Match(c.msgs[i]) {
+			result.fail("output '%s': message %d doesn't match '%s'", name, i+1, expr)
+		}
+	}
+	if expect.AllMatch != "" {
+		spec, _ := message.CreateMatcherSpecification(expect.AllMatch)
+		for i, msg := range c.msgs {
+			if !spec.Match(msg) {
+				result.fail("output '%s': message %d doesn't match '%s'", name, i+1,
+					expect.AllMatch)
+			}
+		}
+	}
+	for i, want := range expect.Encoded {
+		if i >= len(c.encoded) {
+			result.fail("output '%s': no message %d, expected it encoded as %q", name,
+				i+1, want)
+			continue
+		}
+		if got := string(c.encoded[i]); got != want {
+			result.fail("output '%s': message %d encoded as %q, expected %q", name,
+				i+1, got, want)
+		}
+	}
+}
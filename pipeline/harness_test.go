@@ -0,0 +1,91 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"path/filepath"
+	"strings"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+type harnessPayloadEncoder struct{}
+
+func (e *harnessPayloadEncoder) Init(config interface{}) error {
+	return nil
+}
+
+func (e *harnessPayloadEncoder) Encode(pack *PipelinePack) ([]byte, error) {
+	return []byte(pack.Message.GetPayload()), nil
+}
+
+func HarnessSpec(c gs.Context) {
+	// Never actually run, the harness replaces all outputs.
+	RegisterPlugin("HarnessCaptureOutput", func() interface{} {
+		return new(captureOutput)
+	})
+	RegisterPlugin("HarnessPayloadEncoder", func() interface{} {
+		return new(harnessPayloadEncoder)
+	})
+	specFile := filepath.Join(".", "testsupport", "harness_spec.toml")
+
+	c.Specify("A config test spec", func() {
+		spec, err := LoadConfigTestSpec(specFile)
+		c.Assume(err, gs.IsNil)
+		c.Expect(len(spec.Cases), gs.Equals, 2)
+		c.Expect(spec.ConfigPath(), gs.Equals,
+			filepath.Join("testsupport", "harness_config.toml"))
+
+		c.Specify("passes when its expectations are met", func() {
+			results, err := RunConfigTestFile(specFile)
+			c.Assume(err, gs.IsNil)
+			c.Expect(len(results), gs.Equals, 2)
+			for _, result := range results {
+				c.Expect(strings.Join(result.Failures, "; "), gs.Equals, "")
+			}
+		})
+
+		c.Specify("reports unmet expectations", func() {
+			tc := spec.Cases[0]
+			count := 1
+			tc.Expect[0].Count = &count
+			tc.Expect[0].Match[1] = "Payload =~ /^third/"
+			tc.Expect[1].AllMatch = "Payload =~ /error/"
+			result := spec.runCase(tc, DefaultGlobals(), func(pConfig *PipelineConfig) error {
+				return pConfig.PreloadFromConfigPath(spec.ConfigPath())
+			})
+			c.Expect(result.Passed(), gs.IsFalse)
+			c.Expect(len(result.Failures), gs.Equals, 3)
+			c.Expect(result.Failures[0], gs.Equals,
+				"output 'ErrorOutput': received 2 message(s), expected 1")
+			c.Expect(result.Failures[1], gs.Equals,
+				"output 'ErrorOutput': message 2 doesn't match 'Payload =~ /^third/'")
+			c.Expect(result.Failures[2], gs.Equals,
+				"output 'AllOutput': message 2 doesn't match 'Payload =~ /error/'")
+		})
+
+		c.Specify("rejects fixtures for unknown inputs", func() {
+			tc := &ConfigTestCase{
+				Name:     "bad",
+				Fixtures: map[string]string{"NoSuchInput": "harness_fixture.txt"},
+			}
+			result := spec.runCase(tc, DefaultGlobals(), func(pConfig *PipelineConfig) error {
+				return pConfig.PreloadFromConfigPath(spec.ConfigPath())
+			})
+			c.Expect(len(result.Failures), gs.Equals, 1)
+			c.Expect(result.Failures[0], gs.Equals, "fixture for unknown input 'NoSuchInput'")
+		})
+	})
+}
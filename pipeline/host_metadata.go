@@ -0,0 +1,501 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"heka/message"
+)
+
+// Host metadata settings, from the `[hekad.host_metadata]` config section.
+type HostMetadataConfig struct {
+	// Where the metadata comes from: "ec2", "gce", "azure", "kubernetes",
+	// "static", or the name of a provider registered with
+	// RegisterHostMetadataProvider.
+	Provider string `toml:"provider"`
+	// Base URL of the metadata service, replacing the provider's well known
+	// one, e.g. for a proxy.
+	Endpoint string `toml:"endpoint"`
+	// Seconds to wait for the metadata service. Defaults to 2.
+	Timeout uint `toml:"timeout"`
+	// Directory the Kubernetes downward API volume is mounted on. Defaults
+	// to "/etc/podinfo".
+	DownwardApiDir string `toml:"downward_api_dir"`
+	// Set to false to keep the [hekad] hostname rather than using the
+	// provider's. Defaults to true.
+	SetHostname *bool `toml:"set_hostname"`
+	// Prepended to the names of the fields added to messages, e.g. "Host".
+	FieldPrefix string `toml:"field_prefix"`
+	// Values used in place of the provider's, and the only ones the static
+	// provider has.
+	Hostname         string `toml:"hostname"`
+	Region           string `toml:"region"`
+	AvailabilityZone string `toml:"availability_zone"`
+	InstanceId       string `toml:"instance_id"`
+	InstanceType     string `toml:"instance_type"`
+	// Further fields added to every message.
+	Fields map[string]string `toml:"fields"`
+}
+
+// Validate checks that the settings are usable, and fills in the defaults.
+func (c *HostMetadataConfig) Validate() error {
+	if c.Provider == "" {
+		return errors.New("'provider' must be set")
+	}
+	hostMetadataProvidersLock.RLock()
+	_, ok := hostMetadataProviders[c.Provider]
+	hostMetadataProvidersLock.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown provider '%s'", c.Provider)
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 2
+	}
+	if c.DownwardApiDir == "" {
+		c.DownwardApiDir = "/etc/podinfo"
+	}
+	if c.SetHostname == nil {
+		b := true
+		c.SetHostname = &b
+	}
+	return nil
+}
+
+// What's known about the host hekad runs on. Empty values are unknown.
+type HostMetadata struct {
+	Hostname         string
+	Region           string
+	AvailabilityZone string
+	InstanceId       string
+	InstanceType     string
+	// Any other values the provider has, by field name.
+	Fields map[string]string
+}
+
+// Looks up the metadata of the host, e.g. from its cloud provider's metadata
+// service.
+type HostMetadataProvider interface {
+	HostMetadata() (*HostMetadata, error)
+}
+
+var (
+	// Host metadata provider constructors, by provider name.
+	hostMetadataProviders = map[string]func(*HostMetadataConfig) HostMetadataProvider{
+		"static":     func(*HostMetadataConfig) HostMetadataProvider { return staticMetadata{} },
+		"ec2":        func(c *HostMetadataConfig) HostMetadataProvider { return newEc2Metadata(c) },
+		"gce":        func(c *HostMetadataConfig) HostMetadataProvider { return newGceMetadata(c) },
+		"azure":      func(c *HostMetadataConfig) HostMetadataProvider { return newAzureMetadata(c) },
+		"kubernetes": func(c *HostMetadataConfig) HostMetadataProvider { return &downwardApiMetadata{c.DownwardApiDir} },
+	}
+	hostMetadataProvidersLock sync.RWMutex
+)
+
+// RegisterHostMetadataProvider makes a host metadata provider available by
+// name to the `provider` setting.
+func RegisterHostMetadataProvider(name string,
+	factory func(*HostMetadataConfig) HostMetadataProvider) {
+
+	hostMetadataProvidersLock.Lock()
+	defer hostMetadataProvidersLock.Unlock()
+	hostMetadataProviders[name] = factory
+}
+
+// LoadHostMetadata looks up the host's metadata from the validated config's
+// provider, overridden by any values the config sets itself. If the lookup
+// fails the config's own values are returned along with the error.
+func LoadHostMetadata(conf *HostMetadataConfig) (*HostMetadata, error) {
+	hostMetadataProvidersLock.RLock()
+	factory := hostMetadataProviders[conf.Provider]
+	hostMetadataProvidersLock.RUnlock()
+	meta, err := factory(conf).HostMetadata()
+	if err != nil || meta == nil {
+		meta = &HostMetadata{}
+	}
+	if err != nil {
+		err = fmt.Errorf("%s metadata: %s", conf.Provider, err)
+	}
+	override := func(value *string, with string) {
+		if with != "" {
+			*value = with
+		}
+	}
+	override(&meta.Hostname, conf.Hostname)
+	override(&meta.Region, conf.Region)
+	override(&meta.AvailabilityZone, conf.AvailabilityZone)
+	override(&meta.InstanceId, conf.InstanceId)
+	override(&meta.InstanceType, conf.InstanceType)
+	if len(conf.Fields) > 0 && meta.Fields == nil {
+		meta.Fields = make(map[string]string, len(conf.Fields))
+	}
+	for name, value := range conf.Fields {
+		meta.Fields[name] = value
+	}
+	return meta, err
+}
+
+// The fields host metadata adds to messages, in name order.
+type hostFields struct {
+	hostname string
+	// Hekad's own hostname, which may differ from the provider's if
+	// set_hostname is off.
+	hekaHostname string
+	names        []string
+	values       []string
+}
+
+func newHostFields(meta *HostMetadata, prefix, hekaHostname string) *hostFields {
+	if meta == nil {
+		return nil
+	}
+	fields := make(map[string]string, len(meta.Fields)+4)
+	for name, value := range meta.Fields {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	standard := map[string]string{
+		"Region":           meta.Region,
+		"AvailabilityZone": meta.AvailabilityZone,
+		"InstanceId":       meta.InstanceId,
+		"InstanceType":     meta.InstanceType,
+	}
+	for name, value := range standard {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	hf := &hostFields{hostname: meta.Hostname, hekaHostname: hekaHostname}
+	for name := range fields {
+		hf.names = append(hf.names, name)
+	}
+	sort.Strings(hf.names)
+	for i, name := range hf.names {
+		hf.values = append(hf.values, fields[name])
+		hf.names[i] = prefix + name
+	}
+	return hf
+}
+
+// Adds the host fields the message doesn't already have, and the hostname
+// if it has none. Messages from other hosts, such as those relayed by a
+// HekaInput, are left alone so they don't pick up this host's metadata.
+func (hf *hostFields) apply(pack *PipelinePack) {
+	if hf == nil {
+		return
+	}
+	msg := pack.Message
+	switch msg.GetHostname() {
+	case "":
+		if hf.hostname != "" {
+			msg.SetHostname(hf.hostname)
+			pack.TrustMsgBytes = false
+		}
+	case hf.hostname, hf.hekaHostname:
+	default:
+		return
+	}
+	for i, name := range hf.names {
+		if msg.FindFirstField(name) == nil {
+			message.NewStringField(msg, name, hf.values[i])
+			pack.TrustMsgBytes = false
+		}
+	}
+}
+
+type staticMetadata struct{}
+
+func (staticMetadata) HostMetadata() (*HostMetadata, error) {
+	return &HostMetadata{}, nil
+}
+
+// Fetches metadata over HTTP.
+type metadataClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+func newMetadataClient(conf *HostMetadataConfig, endpoint string) *metadataClient {
+	if conf.Endpoint != "" {
+		endpoint = strings.TrimSuffix(conf.Endpoint, "/")
+	}
+	return &metadataClient{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: time.Duration(conf.Timeout) * time.Second},
+	}
+}
+
+// Requests path from the metadata service, returning the body of a
+// successful response.
+func (m *metadataClient) get(method, path string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest(method, m.endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded %s", path, resp.Status)
+	}
+	return body, nil
+}
+
+// Reads the EC2 instance metadata service, with an IMDSv2 session token.
+type ec2Metadata struct {
+	*metadataClient
+}
+
+func newEc2Metadata(conf *HostMetadataConfig) *ec2Metadata {
+	return &ec2Metadata{newMetadataClient(conf, "http://169.254.169.254")}
+}
+
+func (m *ec2Metadata) HostMetadata() (*HostMetadata, error) {
+	token, err := m.get("PUT", "/latest/api/token",
+		http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"60"}})
+	if err != nil {
+		return nil, fmt.Errorf("can't get session token: %s", err)
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {string(token)}}
+	body, err := m.get("GET", "/latest/dynamic/instance-identity/document", header)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+		InstanceId       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+		AccountId        string `json:"accountId"`
+	}
+	if err = json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("can't decode instance identity: %s", err)
+	}
+	meta := &HostMetadata{
+		Region:           doc.Region,
+		AvailabilityZone: doc.AvailabilityZone,
+		InstanceId:       doc.InstanceId,
+		InstanceType:     doc.InstanceType,
+		Fields:           map[string]string{"AccountId": doc.AccountId},
+	}
+	if hostname, err := m.get("GET", "/latest/meta-data/local-hostname", header); err == nil {
+		meta.Hostname = strings.TrimSpace(string(hostname))
+	}
+	return meta, nil
+}
+
+// Reads the Google Compute Engine metadata server.
+type gceMetadata struct {
+	*metadataClient
+}
+
+func newGceMetadata(conf *HostMetadataConfig) *gceMetadata {
+	return &gceMetadata{newMetadataClient(conf, "http://metadata.google.internal")}
+}
+
+// Returns the last part of a GCE resource path, such as
+// "projects/123/zones/us-central1-a".
+func lastPathPart(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+func (m *gceMetadata) HostMetadata() (*HostMetadata, error) {
+	header := http.Header{"Metadata-Flavor": {"Google"}}
+	body, err := m.get("GET", "/computeMetadata/v1/instance/?recursive=true", header)
+	if err != nil {
+		return nil, err
+	}
+	var instance struct {
+		Id          json.Number `json:"id"`
+		Hostname    string      `json:"hostname"`
+		Zone        string      `json:"zone"`
+		MachineType string      `json:"machineType"`
+	}
+	if err = json.Unmarshal(body, &instance); err != nil {
+		return nil, fmt.Errorf("can't decode instance metadata: %s", err)
+	}
+	meta := &HostMetadata{
+		Hostname:         instance.Hostname,
+		AvailabilityZone: lastPathPart(instance.Zone),
+		InstanceId:       instance.Id.String(),
+		InstanceType:     lastPathPart(instance.MachineType),
+	}
+	// Zones are named after their region, e.g. "us-central1-a".
+	if i := strings.LastIndex(meta.AvailabilityZone, "-"); i > 0 {
+		meta.Region = meta.AvailabilityZone[:i]
+	}
+	if project, err := m.get("GET", "/computeMetadata/v1/project/project-id",
+		header); err == nil {
+
+		meta.Fields = map[string]string{"ProjectId": string(project)}
+	}
+	return meta, nil
+}
+
+// Reads the Azure instance metadata service.
+type azureMetadata struct {
+	*metadataClient
+}
+
+func newAzureMetadata(conf *HostMetadataConfig) *azureMetadata {
+	return &azureMetadata{newMetadataClient(conf, "http://169.254.169.254")}
+}
+
+func (m *azureMetadata) HostMetadata() (*HostMetadata, error) {
+	body, err := m.get("GET", "/metadata/instance/compute?api-version=2021-02-01",
+		http.Header{"Metadata": {"true"}})
+	if err != nil {
+		return nil, err
+	}
+	var compute struct {
+		Name              string `json:"name"`
+		Location          string `json:"location"`
+		Zone              string `json:"zone"`
+		VmId              string `json:"vmId"`
+		VmSize            string `json:"vmSize"`
+		ResourceGroupName string `json:"resourceGroupName"`
+		SubscriptionId    string `json:"subscriptionId"`
+		OsProfile         struct {
+			ComputerName string `json:"computerName"`
+		} `json:"osProfile"`
+	}
+	if err = json.Unmarshal(body, &compute); err != nil {
+		return nil, fmt.Errorf("can't decode compute metadata: %s", err)
+	}
+	meta := &HostMetadata{
+		Hostname:         compute.OsProfile.ComputerName,
+		Region:           compute.Location,
+		AvailabilityZone: compute.Zone,
+		InstanceId:       compute.VmId,
+		InstanceType:     compute.VmSize,
+		Fields: map[string]string{
+			"ResourceGroup":  compute.ResourceGroupName,
+			"SubscriptionId": compute.SubscriptionId,
+		},
+	}
+	if meta.Hostname == "" {
+		meta.Hostname = compute.Name
+	}
+	// Zones are numbered within the region.
+	if meta.AvailabilityZone != "" {
+		meta.AvailabilityZone = compute.Location + "-" + compute.Zone
+	}
+	return meta, nil
+}
+
+// Reads the files of a Kubernetes downward API volume. The pod's labels and
+// annotations files become a field per label or annotation, and each other
+// file a field named after it, e.g. "NodeName" for a "node_name" file. A
+// node_name file gives the hostname, and topology labels the region and
+// zone.
+type downwardApiMetadata struct {
+	dir string
+}
+
+// Turns a downward API file name like "pod_name" or "pod-ip" into a field
+// name like "PodName" or "PodIp".
+func downwardFieldName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+	return strings.Join(parts, "")
+}
+
+// Parses the key="value" lines of a downward API labels or annotations file.
+func parseDownwardPairs(contents string) map[string]string {
+	pairs := make(map[string]string)
+	for _, line := range strings.Split(contents, "\n") {
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			continue
+		}
+		value := line[eq+1:]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		pairs[line[:eq]] = value
+	}
+	return pairs
+}
+
+func (m *downwardApiMetadata) HostMetadata() (*HostMetadata, error) {
+	entries, err := ioutil.ReadDir(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	meta := &HostMetadata{Fields: make(map[string]string)}
+	for _, entry := range entries {
+		// The volume's files are symlinks into hidden, timestamped
+		// directories.
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(m.dir, name)
+		if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+			continue
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		value := strings.TrimSpace(string(contents))
+		switch name {
+		case "labels", "annotations":
+			prefix := "Label_"
+			if name == "annotations" {
+				prefix = "Annotation_"
+			}
+			for key, val := range parseDownwardPairs(value) {
+				meta.Fields[prefix+key] = val
+				switch key {
+				case "topology.kubernetes.io/region":
+					meta.Region = val
+				case "topology.kubernetes.io/zone":
+					meta.AvailabilityZone = val
+				}
+			}
+		case "node_name":
+			meta.Hostname = value
+			fallthrough
+		default:
+			meta.Fields[downwardFieldName(name)] = value
+		}
+	}
+	return meta, nil
+}
@@ -0,0 +1,221 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"heka/message"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func HostMetadataSpec(c gs.Context) {
+	c.Specify("A host metadata config", func() {
+		conf := &HostMetadataConfig{}
+		c.Expect(conf.Validate(), gs.Not(gs.IsNil))
+		conf.Provider = "nosuchcloud"
+		c.Expect(conf.Validate(), gs.Not(gs.IsNil))
+		conf.Provider = "ec2"
+		c.Expect(conf.Validate(), gs.IsNil)
+		c.Expect(conf.Timeout, gs.Equals, uint(2))
+		c.Expect(*conf.SetHostname, gs.IsTrue)
+	})
+
+	load := func(conf *HostMetadataConfig) (*HostMetadata, error) {
+		c.Assume(conf.Validate(), gs.IsNil)
+		return LoadHostMetadata(conf)
+	}
+
+	serve := func(handler http.HandlerFunc) *httptest.Server {
+		return httptest.NewServer(handler)
+	}
+
+	c.Specify("The ec2 provider reads the instance identity", func() {
+		ts := serve(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/latest/api/token" {
+				c.Expect(req.Method, gs.Equals, "PUT")
+				w.Write([]byte("session"))
+				return
+			}
+			if req.Header.Get("X-Aws-Ec2-Metadata-Token") != "session" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch req.URL.Path {
+			case "/latest/dynamic/instance-identity/document":
+				w.Write([]byte(`{"region": "eu-west-1", "availabilityZone": "eu-west-1b",
+					"instanceId": "i-0123", "instanceType": "m5.large",
+					"accountId": "4567"}`))
+			case "/latest/meta-data/local-hostname":
+				w.Write([]byte("ip-10-0-0-1.eu-west-1.compute.internal"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+		defer ts.Close()
+		meta, err := load(&HostMetadataConfig{Provider: "ec2", Endpoint: ts.URL})
+		c.Expect(err, gs.IsNil)
+		c.Expect(meta.Hostname, gs.Equals, "ip-10-0-0-1.eu-west-1.compute.internal")
+		c.Expect(meta.Region, gs.Equals, "eu-west-1")
+		c.Expect(meta.AvailabilityZone, gs.Equals, "eu-west-1b")
+		c.Expect(meta.InstanceId, gs.Equals, "i-0123")
+		c.Expect(meta.InstanceType, gs.Equals, "m5.large")
+		c.Expect(meta.Fields["AccountId"], gs.Equals, "4567")
+	})
+
+	c.Specify("The gce provider reads the instance metadata", func() {
+		ts := serve(func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			switch req.URL.Path {
+			case "/computeMetadata/v1/instance/":
+				w.Write([]byte(`{"id": 8675309123456789, "hostname": "web-1.c.proj.internal",
+					"zone": "projects/123/zones/us-central1-a",
+					"machineType": "projects/123/machineTypes/n1-standard-1"}`))
+			case "/computeMetadata/v1/project/project-id":
+				w.Write([]byte("proj"))
+			}
+		})
+		defer ts.Close()
+		meta, err := load(&HostMetadataConfig{Provider: "gce", Endpoint: ts.URL})
+		c.Expect(err, gs.IsNil)
+		c.Expect(meta.Hostname, gs.Equals, "web-1.c.proj.internal")
+		c.Expect(meta.Region, gs.Equals, "us-central1")
+		c.Expect(meta.AvailabilityZone, gs.Equals, "us-central1-a")
+		c.Expect(meta.InstanceId, gs.Equals, "8675309123456789")
+		c.Expect(meta.InstanceType, gs.Equals, "n1-standard-1")
+		c.Expect(meta.Fields["ProjectId"], gs.Equals, "proj")
+	})
+
+	c.Specify("The azure provider reads the compute metadata", func() {
+		ts := serve(func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Metadata") != "true" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"name": "vm1", "location": "westeurope", "zone": "2",
+				"vmId": "02aab8a4", "vmSize": "Standard_D2s_v3",
+				"resourceGroupName": "logs", "osProfile": {"computerName": "web-1"}}`))
+		})
+		defer ts.Close()
+		meta, err := load(&HostMetadataConfig{Provider: "azure", Endpoint: ts.URL})
+		c.Expect(err, gs.IsNil)
+		c.Expect(meta.Hostname, gs.Equals, "web-1")
+		c.Expect(meta.Region, gs.Equals, "westeurope")
+		c.Expect(meta.AvailabilityZone, gs.Equals, "westeurope-2")
+		c.Expect(meta.InstanceId, gs.Equals, "02aab8a4")
+		c.Expect(meta.Fields["ResourceGroup"], gs.Equals, "logs")
+	})
+
+	c.Specify("The kubernetes provider reads the downward API volume", func() {
+		dir, err := ioutil.TempDir("", "podinfo")
+		c.Assume(err, gs.IsNil)
+		defer os.RemoveAll(dir)
+		write := func(name, contents string) {
+			err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+			c.Assume(err, gs.IsNil)
+		}
+		write("node_name", "node-7\n")
+		write("pod_namespace", "logging")
+		write("labels", "app=\"web\"\ntopology.kubernetes.io/zone=\"eu-west-1a\"\n")
+		c.Assume(os.Mkdir(filepath.Join(dir, "..data"), 0755), gs.IsNil)
+
+		meta, err := load(&HostMetadataConfig{Provider: "kubernetes", DownwardApiDir: dir})
+		c.Expect(err, gs.IsNil)
+		c.Expect(meta.Hostname, gs.Equals, "node-7")
+		c.Expect(meta.AvailabilityZone, gs.Equals, "eu-west-1a")
+		c.Expect(meta.Fields["NodeName"], gs.Equals, "node-7")
+		c.Expect(meta.Fields["PodNamespace"], gs.Equals, "logging")
+		c.Expect(meta.Fields["Label_app"], gs.Equals, "web")
+	})
+
+	c.Specify("The config's values", func() {
+		conf := &HostMetadataConfig{Provider: "static", Hostname: "web-1",
+			Region: "dc1", Fields: map[string]string{"Rack": "r12"}}
+
+		c.Specify("are all the static provider has", func() {
+			meta, err := load(conf)
+			c.Expect(err, gs.IsNil)
+			c.Expect(meta.Hostname, gs.Equals, "web-1")
+			c.Expect(meta.Region, gs.Equals, "dc1")
+			c.Expect(meta.Fields["Rack"], gs.Equals, "r12")
+		})
+
+		c.Specify("are kept when the provider fails", func() {
+			ts := serve(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			})
+			defer ts.Close()
+			conf.Provider = "ec2"
+			conf.Endpoint = ts.URL
+			meta, err := load(conf)
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(meta.Region, gs.Equals, "dc1")
+		})
+	})
+
+	c.Specify("Host fields", func() {
+		meta := &HostMetadata{Hostname: "web-1", Region: "eu-west-1",
+			InstanceId: "i-0123", Fields: map[string]string{"AccountId": ""}}
+		hf := newHostFields(meta, "Host", "heka-1")
+		pack := NewPipelinePack(nil)
+
+		c.Specify("are added to messages", func() {
+			pack.TrustMsgBytes = true
+			hf.apply(pack)
+			c.Expect(pack.TrustMsgBytes, gs.IsFalse)
+			c.Expect(pack.Message.GetHostname(), gs.Equals, "web-1")
+			region, _ := pack.Message.GetFieldValue("HostRegion")
+			c.Expect(region, gs.Equals, "eu-west-1")
+			id, _ := pack.Message.GetFieldValue("HostInstanceId")
+			c.Expect(id, gs.Equals, "i-0123")
+			c.Expect(len(pack.Message.Fields), gs.Equals, 2)
+		})
+
+		c.Specify("don't replace the message's own", func() {
+			pack.Message.SetHostname("heka-1")
+			message.NewStringField(pack.Message, "HostRegion", "us-east-1")
+			hf.apply(pack)
+			c.Expect(pack.Message.GetHostname(), gs.Equals, "heka-1")
+			c.Expect(len(pack.Message.FindAllFields("HostRegion")), gs.Equals, 1)
+			region, _ := pack.Message.GetFieldValue("HostRegion")
+			c.Expect(region, gs.Equals, "us-east-1")
+			id, _ := pack.Message.GetFieldValue("HostInstanceId")
+			c.Expect(id, gs.Equals, "i-0123")
+		})
+
+		c.Specify("aren't added to messages from other hosts", func() {
+			pack.Message.SetHostname("agent-7")
+			pack.TrustMsgBytes = true
+			hf.apply(pack)
+			c.Expect(pack.Message.GetHostname(), gs.Equals, "agent-7")
+			c.Expect(len(pack.Message.Fields), gs.Equals, 0)
+			c.Expect(pack.TrustMsgBytes, gs.IsTrue)
+		})
+
+		c.Specify("are skipped without host metadata", func() {
+			hf = newHostFields(nil, "", "")
+			hf.apply(pack)
+			c.Expect(len(pack.Message.Fields), gs.Equals, 0)
+		})
+	})
+}
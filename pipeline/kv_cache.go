@@ -0,0 +1,285 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"heka/message"
+)
+
+// Settings of the process-wide key/value cache, from the [hekad.kv_cache]
+// subsection.
+type KVCacheConfig struct {
+	// Maximum number of entries. The least recently used entries are evicted
+	// to make room for new ones. Defaults to 100000.
+	MaxEntries uint `toml:"max_entries"`
+	// Maximum total bytes of the keys and values. Defaults to 64MiB.
+	MaxBytes uint64 `toml:"max_bytes"`
+	// Whether the entries are saved under BaseDir when hekad stops, and
+	// loaded again when it starts.
+	Persist bool `toml:"persist"`
+	// Seconds between saves while running, if persisting. Zero only saves
+	// when hekad stops.
+	SaveInterval uint `toml:"save_interval"`
+}
+
+// Validate fills in the defaults.
+func (c *KVCacheConfig) Validate() error {
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 100000
+	}
+	if c.MaxBytes == 0 {
+		c.MaxBytes = 64 * 1024 * 1024
+	}
+	return nil
+}
+
+// A size bounded key/value cache shared by all of a hekad process's plugins,
+// so that enrichment and deduplication state can be kept once rather than by
+// each plugin. Entries can expire. Keys are shared by every plugin, so
+// plugins should prefix theirs, e.g. with the plugin name, unless they mean
+// to share them. Safe for concurrent use.
+type KVCache struct {
+	conf  KVCacheConfig
+	path  string
+	lock  sync.Mutex
+	items map[string]*list.Element
+	// Most recently used at the front.
+	lru   *list.List
+	bytes uint64
+	// Counters for the report.
+	hits, misses, evictions, expirations int64
+	// Replaced by tests.
+	now func() time.Time
+}
+
+type kvCacheEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+	// Expiry time in nanoseconds since the epoch, zero if it doesn't expire.
+	Expires int64 `json:"expires,omitempty"`
+}
+
+func (e *kvCacheEntry) size() uint64 {
+	return uint64(len(e.Key) + len(e.Value))
+}
+
+// NewKVCache returns an empty cache with the validated settings. If path
+// isn't empty the cache is loaded from and saved to that file.
+func NewKVCache(conf KVCacheConfig, path string) *KVCache {
+	return &KVCache{
+		conf:  conf,
+		path:  path,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+		now:   time.Now,
+	}
+}
+
+// Get returns the value of key, or false if it isn't cached or has expired.
+func (c *KVCache) Get(key string) (value []byte, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem := c.live(key)
+	if elem == nil {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*kvCacheEntry).Value, true
+}
+
+// Set caches value for key, replacing any value it had. A ttl of zero means
+// the entry doesn't expire, though it can still be evicted.
+func (c *KVCache) Set(key string, value []byte, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.set(key, value, ttl)
+}
+
+// Add caches value for key only if the key isn't already cached, returning
+// whether it was added. Deduplicating plugins can use it to check for and
+// record a key in one step.
+func (c *KVCache) Add(key string, value []byte, ttl time.Duration) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.live(key) != nil {
+		return false
+	}
+	c.set(key, value, ttl)
+	return true
+}
+
+// Delete removes key from the cache.
+func (c *KVCache) Delete(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem := c.items[key]; elem != nil {
+		c.remove(elem)
+	}
+}
+
+// Len returns the number of entries, including expired ones not yet
+// removed.
+func (c *KVCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lru.Len()
+}
+
+// Returns key's entry, removing it if it has expired.
+func (c *KVCache) live(key string) *list.Element {
+	elem := c.items[key]
+	if elem == nil {
+		return nil
+	}
+	if expires := elem.Value.(*kvCacheEntry).Expires; expires > 0 &&
+		c.now().UnixNano() >= expires {
+
+		c.remove(elem)
+		c.expirations++
+		return nil
+	}
+	return elem
+}
+
+func (c *KVCache) set(key string, value []byte, ttl time.Duration) {
+	entry := &kvCacheEntry{Key: key, Value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.Expires = c.now().Add(ttl).UnixNano()
+	}
+	if entry.size() > c.conf.MaxBytes {
+		// It would evict everything and still not fit.
+		if elem := c.items[key]; elem != nil {
+			c.remove(elem)
+		}
+		return
+	}
+	if elem := c.items[key]; elem != nil {
+		c.remove(elem)
+	}
+	c.items[key] = c.lru.PushFront(entry)
+	c.bytes += entry.size()
+	for uint(c.lru.Len()) > c.conf.MaxEntries || c.bytes > c.conf.MaxBytes {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+func (c *KVCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*kvCacheEntry)
+	delete(c.items, entry.Key)
+	c.bytes -= entry.size()
+}
+
+// Load reads the cache's file, if it has one, adding its unexpired entries.
+// A missing file isn't an error.
+func (c *KVCache) Load() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var entries []*kvCacheEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("can't decode %s: %s", c.path, err)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := c.now().UnixNano()
+	// Saved most recently used first.
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Expires > 0 && now >= entry.Expires {
+			continue
+		}
+		var ttl time.Duration
+		if entry.Expires > 0 {
+			ttl = time.Duration(entry.Expires - now)
+		}
+		c.set(entry.Key, entry.Value, ttl)
+	}
+	return nil
+}
+
+// Save writes the unexpired entries to the cache's file, if it has one.
+func (c *KVCache) Save() error {
+	if c.path == "" {
+		return nil
+	}
+	c.lock.Lock()
+	now := c.now().UnixNano()
+	entries := make([]*kvCacheEntry, 0, c.lru.Len())
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*kvCacheEntry)
+		if entry.Expires == 0 || now < entry.Expires {
+			entries = append(entries, entry)
+		}
+	}
+	data, err := json.Marshal(entries)
+	c.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// Saves the cache every interval until stop is closed.
+func (c *KVCache) saveEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := c.Save(); err != nil {
+				LogError.Printf("Can't save the KV cache: %s", err)
+			}
+		}
+	}
+}
+
+// ReportMsg adds the cache's size and counters to a report message.
+func (c *KVCache) ReportMsg(msg *message.Message) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	message.NewIntField(msg, "Entries", c.lru.Len(), "count")
+	message.NewInt64Field(msg, "Bytes", int64(c.bytes), "B")
+	message.NewInt64Field(msg, "Hits", c.hits, "count")
+	message.NewInt64Field(msg, "Misses", c.misses, "count")
+	message.NewInt64Field(msg, "Evictions", c.evictions, "count")
+	message.NewInt64Field(msg, "Expirations", c.expirations, "count")
+}
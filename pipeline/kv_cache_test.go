@@ -0,0 +1,133 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+)
+
+func KVCacheSpec(c gs.Context) {
+	c.Specify("A KVCache", func() {
+		now := time.Unix(1400000000, 0)
+		conf := KVCacheConfig{MaxEntries: 3, MaxBytes: 100}
+		cache := NewKVCache(conf, "")
+		cache.now = func() time.Time { return now }
+
+		c.Specify("gets what was set", func() {
+			_, ok := cache.Get("a")
+			c.Expect(ok, gs.IsFalse)
+			cache.Set("a", []byte("one"), 0)
+			value, ok := cache.Get("a")
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(string(value), gs.Equals, "one")
+			cache.Set("a", []byte("two"), 0)
+			value, _ = cache.Get("a")
+			c.Expect(string(value), gs.Equals, "two")
+			cache.Delete("a")
+			_, ok = cache.Get("a")
+			c.Expect(ok, gs.IsFalse)
+		})
+
+		c.Specify("expires entries", func() {
+			cache.Set("a", []byte("one"), time.Minute)
+			now = now.Add(59 * time.Second)
+			_, ok := cache.Get("a")
+			c.Expect(ok, gs.IsTrue)
+			now = now.Add(time.Second)
+			_, ok = cache.Get("a")
+			c.Expect(ok, gs.IsFalse)
+			c.Expect(cache.Len(), gs.Equals, 0)
+		})
+
+		c.Specify("only adds missing keys", func() {
+			c.Expect(cache.Add("a", []byte("one"), time.Minute), gs.IsTrue)
+			c.Expect(cache.Add("a", []byte("two"), time.Minute), gs.IsFalse)
+			value, _ := cache.Get("a")
+			c.Expect(string(value), gs.Equals, "one")
+			now = now.Add(time.Minute)
+			c.Expect(cache.Add("a", []byte("two"), 0), gs.IsTrue)
+		})
+
+		c.Specify("evicts the least recently used entries", func() {
+			cache.Set("a", []byte("1"), 0)
+			cache.Set("b", []byte("2"), 0)
+			cache.Set("c", []byte("3"), 0)
+			cache.Get("a")
+			cache.Set("d", []byte("4"), 0)
+			c.Expect(cache.Len(), gs.Equals, 3)
+			_, ok := cache.Get("b")
+			c.Expect(ok, gs.IsFalse)
+			_, ok = cache.Get("a")
+			c.Expect(ok, gs.IsTrue)
+
+			c.Specify("to stay under the byte limit", func() {
+				cache.Set("e", make([]byte, 98), 0)
+				c.Expect(cache.Len(), gs.Equals, 1)
+				cache.Set("f", make([]byte, 100), 0)
+				_, ok = cache.Get("f")
+				c.Expect(ok, gs.IsFalse)
+				_, ok = cache.Get("e")
+				c.Expect(ok, gs.IsTrue)
+			})
+
+			msg := new(message.Message)
+			cache.ReportMsg(msg)
+			evictions, _ := msg.GetFieldValue("Evictions")
+			c.Expect(evictions.(int64) > 0, gs.IsTrue)
+		})
+
+		c.Specify("saves and loads its unexpired entries", func() {
+			tmpDir, err := ioutil.TempDir("", "kv-cache-tests")
+			c.Assume(err, gs.IsNil)
+			defer os.RemoveAll(tmpDir)
+			path := filepath.Join(tmpDir, "kv_cache.json")
+			cache = NewKVCache(conf, path)
+			cache.now = func() time.Time { return now }
+			c.Expect(cache.Load(), gs.IsNil)
+			cache.Set("a", []byte("1"), 0)
+			cache.Set("b", []byte("2"), time.Minute)
+			cache.Set("c", []byte("3"), time.Hour)
+			cache.Get("a")
+			c.Expect(cache.Save(), gs.IsNil)
+
+			loaded := NewKVCache(conf, path)
+			now = now.Add(time.Minute)
+			loaded.now = func() time.Time { return now }
+			c.Expect(loaded.Load(), gs.IsNil)
+			c.Expect(loaded.Len(), gs.Equals, 2)
+			value, _ := loaded.Get("a")
+			c.Expect(string(value), gs.Equals, "1")
+			// The TTL carries on from where it was.
+			now = now.Add(59 * time.Minute)
+			_, ok := loaded.Get("c")
+			c.Expect(ok, gs.IsFalse)
+		})
+	})
+
+	c.Specify("Globals share one KVCache between pipelines", func() {
+		globals := DefaultGlobals()
+		globals.Cache = &KVCacheConfig{MaxEntries: 5}
+		c.Expect(globals.usedKVCache() == nil, gs.IsTrue)
+		cache := globals.KVCache()
+		c.Expect(cache.conf.MaxBytes, gs.Equals, uint64(64*1024*1024))
+		c.Expect(globals.PipelineGlobals("other").KVCache() == cache, gs.IsTrue)
+	})
+}
@@ -0,0 +1,225 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"heka/message"
+)
+
+// Settings for an output's delivery latency objective.
+type LatencySloConfig struct {
+	// Most the p99 latency, from message timestamp to delivery, may be, as a
+	// duration such as "30s". Required.
+	Budget string
+	// How long the p99 must stay over budget before a violation message is
+	// emitted. Defaults to 5m.
+	Sustain string
+	// Length of the windows the percentiles are computed over. Defaults to
+	// 1m.
+	Window string
+}
+
+// Upper bounds of the latency histogram buckets. Latencies past the last
+// fall in an extra overflow bucket.
+var latencyBuckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second,
+	30 * time.Second, time.Minute, 2 * time.Minute, 5 * time.Minute,
+	10 * time.Minute, 30 * time.Minute, time.Hour,
+}
+
+type latencyHistogram struct {
+	counts [21]int64
+	total  int64
+}
+
+func (hist *latencyHistogram) add(latency time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && latency > latencyBuckets[i] {
+		i++
+	}
+	hist.counts[i]++
+	hist.total++
+}
+
+// Returns the upper bound of the bucket holding the given percentile, or
+// twice the last bound for the overflow bucket.
+func (hist *latencyHistogram) percentile(p float64) time.Duration {
+	if hist.total == 0 {
+		return 0
+	}
+	rank := int64(float64(hist.total)*p/100 + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, count := range hist.counts {
+		if seen += count; seen >= rank {
+			if i < len(latencyBuckets) {
+				return latencyBuckets[i]
+			}
+			break
+		}
+	}
+	return 2 * latencyBuckets[len(latencyBuckets)-1]
+}
+
+// Tracks how long messages take to be delivered by an output, and whether
+// that's within its latency objective.
+type latencyTracker struct {
+	runner         *foRunner
+	budget         time.Duration
+	sustain        time.Duration
+	window         time.Duration
+	lock           sync.Mutex
+	current        latencyHistogram
+	last           latencyHistogram
+	windowStart    time.Time
+	violatingSince time.Time
+	count          int64
+	violationCount int64
+	now            func() time.Time
+	emit           func(p99 time.Duration, since time.Time)
+}
+
+func newLatencyTracker(config *LatencySloConfig, runner *foRunner) (
+	*latencyTracker, error) {
+
+	lt := &latencyTracker{
+		runner:  runner,
+		sustain: 5 * time.Minute,
+		window:  time.Minute,
+		now:     time.Now,
+	}
+	lt.emit = lt.inject
+	if config != nil {
+		var err error
+		if config.Budget == "" {
+			return nil, fmt.Errorf("latency_slo budget must be set")
+		}
+		if lt.budget, err = time.ParseDuration(config.Budget); err != nil {
+			return nil, fmt.Errorf("can't parse latency_slo budget: %s", err)
+		}
+		if config.Sustain != "" {
+			if lt.sustain, err = time.ParseDuration(config.Sustain); err != nil {
+				return nil, fmt.Errorf("can't parse latency_slo sustain: %s", err)
+			}
+		}
+		if config.Window != "" {
+			if lt.window, err = time.ParseDuration(config.Window); err != nil {
+				return nil, fmt.Errorf("can't parse latency_slo window: %s", err)
+			}
+		}
+		if lt.budget <= 0 || lt.window <= 0 || lt.sustain < 0 {
+			return nil, fmt.Errorf("latency_slo durations must be positive")
+		}
+	}
+	lt.windowStart = lt.now()
+	return lt, nil
+}
+
+// Records the delivery of a pack's message.
+func (lt *latencyTracker) observe(pack *PipelinePack) {
+	ts := pack.Message.GetTimestamp()
+	if ts == 0 {
+		return
+	}
+	lt.lock.Lock()
+	defer lt.lock.Unlock()
+	now := lt.now()
+	lt.roll(now)
+	latency := now.Sub(time.Unix(0, ts))
+	if latency < 0 {
+		latency = 0
+	}
+	lt.current.add(latency)
+	lt.count++
+}
+
+// Starts a new window if the current one is over, checking the finished
+// one's p99 against the budget. Expects the lock to be held.
+func (lt *latencyTracker) roll(now time.Time) {
+	if now.Sub(lt.windowStart) < lt.window {
+		return
+	}
+	lt.last = lt.current
+	lt.current = latencyHistogram{}
+	start := lt.windowStart
+	lt.windowStart = now
+	if lt.budget == 0 {
+		return
+	}
+	p99 := lt.last.percentile(99)
+	if p99 <= lt.budget {
+		lt.violatingSince = time.Time{}
+		return
+	}
+	if lt.violatingSince.IsZero() {
+		lt.violatingSince = start
+	}
+	if now.Sub(lt.violatingSince) >= lt.sustain {
+		lt.violationCount++
+		lt.emit(p99, lt.violatingSince)
+	}
+}
+
+// Injects a `heka.latency-slo-violation` message. The output's own goroutine
+// mustn't wait on the router, so it's sent from another.
+func (lt *latencyTracker) inject(p99 time.Duration, since time.Time) {
+	pConfig := lt.runner.pConfig
+	name := lt.runner.name
+	budget := lt.budget
+	go func() {
+		pack, err := pConfig.PipelinePack(0)
+		if err != nil {
+			lt.runner.LogError(fmt.Errorf("can't send latency violation: %s", err))
+			return
+		}
+		msg := pack.Message
+		msg.SetType("heka.latency-slo-violation")
+		msg.SetLogger(HEKA_DAEMON)
+		message.NewStringField(msg, "output", name)
+		message.NewInt64Field(msg, "P99", int64(p99/time.Millisecond), "ms")
+		message.NewInt64Field(msg, "Budget", int64(budget/time.Millisecond), "ms")
+		message.NewInt64Field(msg, "Since", since.UnixNano(), "ns")
+		msg.SetPayload(fmt.Sprintf("%s p99 delivery latency %s over its %s budget since %s",
+			name, p99, budget, since.Format(time.RFC3339)))
+		pack.EncodeMsgBytes()
+		pConfig.router.inChan <- pack
+	}()
+}
+
+// Adds the latency percentiles of the last complete window to a plugin
+// report message.
+func (lt *latencyTracker) report(msg *message.Message) {
+	lt.lock.Lock()
+	defer lt.lock.Unlock()
+	lt.roll(lt.now())
+	for _, p := range []float64{50, 90, 99} {
+		message.NewInt64Field(msg, fmt.Sprintf("LatencyP%d", int(p)),
+			int64(lt.last.percentile(p)/time.Millisecond), "ms")
+	}
+	message.NewInt64Field(msg, "LatencyCount", lt.count, "count")
+	if lt.budget > 0 {
+		message.NewInt64Field(msg, "LatencySloViolationCount", lt.violationCount,
+			"count")
+	}
+}
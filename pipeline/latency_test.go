@@ -0,0 +1,124 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"time"
+
+	"heka/message"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func LatencySpec(c gs.Context) {
+	pConfig := NewPipelineConfig(nil)
+
+	c.Specify("A latency histogram", func() {
+		hist := new(latencyHistogram)
+
+		c.Specify("is empty at first", func() {
+			c.Expect(hist.percentile(99), gs.Equals, time.Duration(0))
+		})
+
+		c.Specify("reports bucket bounds for percentiles", func() {
+			for i := 0; i < 98; i++ {
+				hist.add(3 * time.Millisecond)
+			}
+			hist.add(time.Second)
+			hist.add(3 * time.Hour)
+			c.Expect(hist.percentile(50), gs.Equals, 5*time.Millisecond)
+			c.Expect(hist.percentile(99), gs.Equals, time.Second)
+			c.Expect(hist.percentile(100), gs.Equals, 2*time.Hour)
+		})
+	})
+
+	c.Specify("A latency tracker", func() {
+		runner := &foRunner{pConfig: pConfig}
+		runner.name = "SlowOutput"
+		config := &LatencySloConfig{
+			Budget:  "1s",
+			Sustain: "2m",
+		}
+		now := time.Now()
+		var violations []time.Duration
+		newTracker := func() *latencyTracker {
+			lt, err := newLatencyTracker(config, runner)
+			c.Assume(err, gs.IsNil)
+			lt.now = func() time.Time { return now }
+			lt.windowStart = now
+			lt.emit = func(p99 time.Duration, since time.Time) {
+				violations = append(violations, p99)
+			}
+			return lt
+		}
+		deliver := func(lt *latencyTracker, latency time.Duration) {
+			pack := NewPipelinePack(nil)
+			pack.Message.SetTimestamp(now.Add(-latency).UnixNano())
+			lt.observe(pack)
+		}
+
+		c.Specify("reports the last window's percentiles", func() {
+			lt := newTracker()
+			deliver(lt, 30*time.Millisecond)
+			now = now.Add(time.Minute)
+			msg := new(message.Message)
+			lt.report(msg)
+			p99, _ := msg.GetFieldValue("LatencyP99")
+			c.Expect(p99, gs.Equals, int64(50))
+			count, _ := msg.GetFieldValue("LatencyCount")
+			c.Expect(count, gs.Equals, int64(1))
+		})
+
+		c.Specify("emits violations once over budget for long enough", func() {
+			lt := newTracker()
+			for i := 0; i < 2; i++ {
+				deliver(lt, 3*time.Second)
+				now = now.Add(time.Minute)
+			}
+			c.Expect(len(violations), gs.Equals, 0)
+			deliver(lt, 3*time.Second)
+			c.Assume(len(violations), gs.Equals, 1)
+			c.Expect(violations[0], gs.Equals, 5*time.Second)
+		})
+
+		c.Specify("starts over when a window is within budget", func() {
+			lt := newTracker()
+			deliver(lt, 3*time.Second)
+			now = now.Add(time.Minute)
+			deliver(lt, 10*time.Millisecond)
+			now = now.Add(time.Minute)
+			deliver(lt, 3*time.Second)
+			now = now.Add(time.Minute)
+			deliver(lt, 3*time.Second)
+			c.Expect(len(violations), gs.Equals, 0)
+		})
+
+		c.Specify("only tracks latency without a budget", func() {
+			lt, err := newLatencyTracker(nil, runner)
+			c.Assume(err, gs.IsNil)
+			c.Expect(lt.budget, gs.Equals, time.Duration(0))
+		})
+
+		c.Specify("rejects bad settings", func() {
+			config.Budget = ""
+			_, err := newLatencyTracker(config, runner)
+			c.Expect(err, gs.Not(gs.IsNil))
+			config.Budget = "1s"
+			config.Window = "0s"
+			_, err = newLatencyTracker(config, runner)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,209 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+var ErrReusePortUnsupported = errors.New("reuse_port is not supported on this platform")
+
+var ErrSocketOptionsUnsupported = errors.New(
+	"socket buffer, tos and ipv6_only settings are not supported on this platform")
+
+// Socket settings shared by the listening inputs, from their `socket` config
+// subsection. The zero value leaves everything at the system defaults.
+type SocketConfig struct {
+	// Address family listened on, "ipv4" or "ipv6". Defaults to whatever
+	// the address implies, a wildcard address such as ":5565" or "[::]:5565"
+	// being listened on over both.
+	Family string `toml:"family"`
+	// Whether an IPv6 socket accepts IPv6 connections only, rather than
+	// IPv4 ones too. Unset means dual-stack unless the family or network is
+	// IPv6 only.
+	IPv6Only *bool `toml:"ipv6_only"`
+	// Name of the network interface multicast groups are joined on. Only
+	// for UDP inputs listening on a multicast address, which otherwise join
+	// on the system's default interface.
+	MulticastInterface string `toml:"multicast_interface"`
+	// SO_RCVBUF and SO_SNDBUF sizes in bytes, 0 meaning the system default.
+	RecvBufferSize int `toml:"recv_buffer_size"`
+	SendBufferSize int `toml:"send_buffer_size"`
+	// IP type of service (IPv4) or traffic class (IPv6) of the packets sent.
+	Tos int `toml:"tos"`
+}
+
+// Validate checks that the settings are usable.
+func (c *SocketConfig) Validate() error {
+	switch c.Family {
+	case "", "ipv4", "ipv6":
+	default:
+		return fmt.Errorf("unknown family '%s', must be 'ipv4' or 'ipv6'", c.Family)
+	}
+	if c.Family == "ipv4" && c.IPv6Only != nil {
+		return errors.New("ipv6_only can't be used with family 'ipv4'")
+	}
+	if c.RecvBufferSize < 0 || c.SendBufferSize < 0 {
+		return errors.New("socket buffer sizes can't be negative")
+	}
+	if c.Tos < 0 || c.Tos > 255 {
+		return errors.New("tos must be between 0 and 255")
+	}
+	return nil
+}
+
+// Network returns the network, e.g. "tcp" or "udp", restricted to the
+// configured family.
+func (c *SocketConfig) Network(network string) (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	if c.Family == "" {
+		return network, nil
+	}
+	suffix := "4"
+	if c.Family == "ipv6" {
+		suffix = "6"
+	}
+	base := strings.TrimRight(network, "46")
+	if base != "tcp" && base != "udp" {
+		return "", fmt.Errorf("family can't be used with network '%s'", network)
+	}
+	if base != network && base+suffix != network {
+		return "", fmt.Errorf("family '%s' conflicts with network '%s'", c.Family, network)
+	}
+	return base + suffix, nil
+}
+
+func (c *SocketConfig) setsOptions() bool {
+	return c.IPv6Only != nil || c.RecvBufferSize > 0 || c.SendBufferSize > 0 || c.Tos > 0
+}
+
+// Applies the settings to a socket of the given network, e.g. "tcp6".
+func (c *SocketConfig) control(network string, rc syscall.RawConn) error {
+	var sockErr error
+	if err := rc.Control(func(fd uintptr) {
+		sockErr = setSocketOptions(fd, strings.HasSuffix(network, "6"), c)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
+
+func (c *SocketConfig) listenConfig(reusePort bool) *net.ListenConfig {
+	lc := &net.ListenConfig{}
+	if reusePort || c.setsOptions() {
+		lc.Control = func(network, address string, rc syscall.RawConn) error {
+			if reusePort {
+				var sockErr error
+				if err := rc.Control(func(fd uintptr) {
+					sockErr = setReusePort(fd)
+				}); err != nil {
+					return err
+				}
+				if sockErr != nil {
+					return sockErr
+				}
+			}
+			if c.setsOptions() {
+				return c.control(network, rc)
+			}
+			return nil
+		}
+	}
+	return lc
+}
+
+// Listen announces on the local network address like net.Listen, with the
+// socket settings applied. If reusePort is true the socket is opened with
+// SO_REUSEPORT set, allowing another process (e.g. a newly upgraded hekad)
+// to listen on the same address at the same time, with the kernel spreading
+// new connections between them.
+func (c *SocketConfig) Listen(network, address string, reusePort bool) (net.Listener, error) {
+	if c.MulticastInterface != "" {
+		return nil, errors.New("multicast_interface can only be used with UDP")
+	}
+	return c.listenConfig(reusePort).Listen(context.Background(), network, address)
+}
+
+// ListenPacket is the packet oriented equivalent of Listen. A UDP multicast
+// address joins its group, on the configured interface if there is one,
+// and any number of sockets may listen on it regardless of reusePort.
+func (c *SocketConfig) ListenPacket(network, address string, reusePort bool) (
+	net.PacketConn, error) {
+
+	if !strings.HasPrefix(network, "udp") {
+		if c.MulticastInterface != "" {
+			return nil, errors.New("multicast_interface can only be used with UDP")
+		}
+		return c.listenConfig(reusePort).ListenPacket(context.Background(), network, address)
+	}
+	udpAddr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if udpAddr.IP == nil || !udpAddr.IP.IsMulticast() {
+		if c.MulticastInterface != "" {
+			return nil, fmt.Errorf("multicast_interface set, but %s isn't a multicast address",
+				address)
+		}
+		return c.listenConfig(reusePort).ListenPacket(context.Background(), network, address)
+	}
+
+	var iface *net.Interface
+	if c.MulticastInterface != "" {
+		if iface, err = net.InterfaceByName(c.MulticastInterface); err != nil {
+			return nil, fmt.Errorf("multicast_interface: %s", err)
+		}
+	}
+	conn, err := net.ListenMulticastUDP(network, iface, udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	// The group's socket is already bound, too late for ipv6_only.
+	opts := *c
+	opts.IPv6Only = nil
+	if opts.setsOptions() {
+		network = "udp4"
+		if udpAddr.IP.To4() == nil {
+			network = "udp6"
+		}
+		rc, err := conn.SyscallConn()
+		if err == nil {
+			err = opts.control(network, rc)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Listen announces on the local network address like net.Listen, see
+// SocketConfig.Listen.
+func Listen(network, address string, reusePort bool) (net.Listener, error) {
+	return new(SocketConfig).Listen(network, address, reusePort)
+}
+
+// ListenPacket is the packet oriented equivalent of Listen.
+func ListenPacket(network, address string, reusePort bool) (net.PacketConn, error) {
+	return new(SocketConfig).ListenPacket(network, address, reusePort)
+}
@@ -0,0 +1,112 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"net"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func SocketSpec(c gs.Context) {
+	c.Specify("A SocketConfig", func() {
+		conf := new(SocketConfig)
+
+		c.Specify("restricts networks to its family", func() {
+			network, err := conf.Network("tcp")
+			c.Expect(err, gs.IsNil)
+			c.Expect(network, gs.Equals, "tcp")
+			conf.Family = "ipv6"
+			network, err = conf.Network("udp")
+			c.Expect(err, gs.IsNil)
+			c.Expect(network, gs.Equals, "udp6")
+			network, err = conf.Network("tcp6")
+			c.Expect(err, gs.IsNil)
+			c.Expect(network, gs.Equals, "tcp6")
+			_, err = conf.Network("tcp4")
+			c.Expect(err.Error(), gs.Equals, "family 'ipv6' conflicts with network 'tcp4'")
+			_, err = conf.Network("unixgram")
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("rejects bad settings", func() {
+			conf.Family = "ipx"
+			c.Expect(conf.Validate(), gs.Not(gs.IsNil))
+			conf.Family = "ipv4"
+			only := true
+			conf.IPv6Only = &only
+			c.Expect(conf.Validate(), gs.Not(gs.IsNil))
+			conf.IPv6Only = nil
+			conf.Tos = 256
+			c.Expect(conf.Validate(), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("listens with the buffer sizes and tos set", func() {
+			conf.RecvBufferSize = 1 << 16
+			conf.SendBufferSize = 1 << 16
+			conf.Tos = 0x10
+			listener, err := conf.Listen("tcp", "127.0.0.1:0", false)
+			c.Expect(err, gs.IsNil)
+			listener.Close()
+			packetConn, err := conf.ListenPacket("udp", "127.0.0.1:0", false)
+			c.Expect(err, gs.IsNil)
+			packetConn.Close()
+		})
+
+		c.Specify("only joins multicast groups on an interface", func() {
+			conf.MulticastInterface = "lo"
+			_, err := conf.ListenPacket("udp", "127.0.0.1:0", false)
+			c.Expect(err, gs.Not(gs.IsNil))
+			_, err = conf.Listen("tcp", "127.0.0.1:0", false)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("listens on IPv6 wildcard addresses", func() {
+			// Skipped where there's no IPv6.
+			probe, err := net.Listen("tcp6", "[::1]:0")
+			if err != nil {
+				return
+			}
+			probe.Close()
+
+			dialV4 := func(listener net.Listener) error {
+				_, port, _ := net.SplitHostPort(listener.Addr().String())
+				conn, err := net.DialTimeout("tcp4", net.JoinHostPort("127.0.0.1", port),
+					time.Second)
+				if err == nil {
+					conn.Close()
+				}
+				return err
+			}
+
+			c.Specify("over both families by default", func() {
+				listener, err := conf.Listen("tcp", "[::]:0", false)
+				c.Assume(err, gs.IsNil)
+				defer listener.Close()
+				c.Expect(dialV4(listener), gs.IsNil)
+			})
+
+			c.Specify("over IPv6 only if asked to", func() {
+				only := true
+				conf.IPv6Only = &only
+				listener, err := conf.Listen("tcp", "[::]:0", false)
+				c.Assume(err, gs.IsNil)
+				defer listener.Close()
+				c.Expect(dialV4(listener), gs.Not(gs.IsNil))
+			})
+		})
+	})
+}
@@ -0,0 +1,66 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+func setReusePort(fd uintptr) error {
+	return unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+}
+
+func setSocketOptions(fd uintptr, ipv6 bool, c *SocketConfig) error {
+	sock := int(fd)
+	if c.RecvBufferSize > 0 {
+		if err := unix.SetsockoptInt(sock, unix.SOL_SOCKET, unix.SO_RCVBUF,
+			c.RecvBufferSize); err != nil {
+			return fmt.Errorf("can't set recv_buffer_size: %s", err)
+		}
+	}
+	if c.SendBufferSize > 0 {
+		if err := unix.SetsockoptInt(sock, unix.SOL_SOCKET, unix.SO_SNDBUF,
+			c.SendBufferSize); err != nil {
+			return fmt.Errorf("can't set send_buffer_size: %s", err)
+		}
+	}
+	if c.Tos > 0 {
+		var err error
+		if ipv6 {
+			err = unix.SetsockoptInt(sock, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, c.Tos)
+		} else {
+			err = unix.SetsockoptInt(sock, unix.IPPROTO_IP, unix.IP_TOS, c.Tos)
+		}
+		if err != nil {
+			return fmt.Errorf("can't set tos: %s", err)
+		}
+	}
+	if c.IPv6Only != nil && ipv6 {
+		only := 0
+		if *c.IPv6Only {
+			only = 1
+		}
+		if err := unix.SetsockoptInt(sock, unix.IPPROTO_IPV6, unix.IPV6_V6ONLY,
+			only); err != nil {
+			return fmt.Errorf("can't set ipv6_only: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"heka/message"
+)
+
+// Metadata key of the comma separated names of the plugins that injected a
+// pack's message and the messages it was derived from, oldest first.
+const INJECT_CHAIN_METADATA = "heka.inject_chain"
+
+// Returned by PipelinePack when a message has already been re-injected
+// MaxMsgLoops times.
+type MsgLoopsError uint
+
+func (e MsgLoopsError) Error() string {
+	return fmt.Sprintf("exceeded MaxMsgLoops = %d", uint(e))
+}
+
+// Records that the named plugin is injecting the pack's message while
+// processing src, extending src's inject chain, so that the plugins involved
+// can be named if the messages end up looping.
+func (p *PipelinePack) TraceInjection(src *PipelinePack, injector string) {
+	chain, _ := src.GetMetadata(INJECT_CHAIN_METADATA)
+	if chain != "" {
+		chain += ","
+	}
+	p.SetMetadata(INJECT_CHAIN_METADATA, chain+injector)
+}
+
+// The inject chains of the last injected packs matched by a filter, by loop
+// count. A filter injecting a pack from PipelinePack(src.MsgLoopCount) gets
+// one with the next loop count, which says which of them was its source, so
+// the messages of Go filters, which don't call TraceInjection, can be traced
+// too.
+type receivedChains struct {
+	lock   sync.Mutex
+	chains map[uint]string
+}
+
+func newReceivedChains() *receivedChains {
+	return &receivedChains{chains: make(map[uint]string)}
+}
+
+// Records the chain of a pack matched by the filter. Packs from inputs have
+// no chain to record.
+func (rc *receivedChains) record(pack *PipelinePack) {
+	if pack.MsgLoopCount == 0 {
+		return
+	}
+	chain, _ := pack.GetMetadata(INJECT_CHAIN_METADATA)
+	rc.lock.Lock()
+	rc.chains[pack.MsgLoopCount] = chain
+	rc.lock.Unlock()
+}
+
+// Traces a pack the filter is injecting, unless the filter already did so
+// itself, from the last pack it matched with the previous loop count.
+func (rc *receivedChains) trace(pack *PipelinePack, injector string) {
+	chain, _ := pack.GetMetadata(INJECT_CHAIN_METADATA)
+	if strings.HasSuffix(","+chain, ","+injector) {
+		return
+	}
+	rc.lock.Lock()
+	src := rc.chains[pack.MsgLoopCount-1]
+	rc.lock.Unlock()
+	if src != "" {
+		src += ","
+	}
+	pack.SetMetadata(INJECT_CHAIN_METADATA, src+injector)
+}
+
+// Returns the names of the plugins that injected the pack's message and the
+// messages it was derived from, see TraceInjection.
+func (p *PipelinePack) InjectChain() []string {
+	chain, ok := p.GetMetadata(INJECT_CHAIN_METADATA)
+	if !ok || chain == "" {
+		return nil
+	}
+	return strings.Split(chain, ",")
+}
+
+// Returns the part of an inject chain that repeats, ending with the last
+// plugin and starting from its previous appearance, or nil if no plugin
+// appears twice.
+func loopCycle(chain []string) []string {
+	last := len(chain) - 1
+	for i := last - 1; i >= 0; i-- {
+		if chain[i] == chain[last] {
+			return chain[i:]
+		}
+	}
+	return nil
+}
+
+// Limits the message loop diagnostics sent for a given chain.
+type loopReporter struct {
+	lock     sync.Mutex
+	interval time.Duration
+	sent     map[string]time.Time
+	now      func() time.Time
+}
+
+func newLoopReporter() *loopReporter {
+	return &loopReporter{
+		interval: time.Minute,
+		sent:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Tells if a diagnostic for the chain is due.
+func (lr *loopReporter) due(chain string) bool {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+	now := lr.now()
+	if last, ok := lr.sent[chain]; ok && now.Sub(last) < lr.interval {
+		return false
+	}
+	// Forget chains that have settled down.
+	for c, last := range lr.sent {
+		if now.Sub(last) >= lr.interval {
+			delete(lr.sent, c)
+		}
+	}
+	lr.sent[chain] = now
+	return true
+}
+
+// Called by filters when PipelinePack refuses them a pack with a
+// MsgLoopsError while they're processing src. Logs and injects a
+// `heka.message-loop` message naming the chain of plugins that injected the
+// message, and the cycle they form, at most once a minute for each chain.
+func (self *PipelineConfig) ReportMessageLoop(src *PipelinePack, injector string) {
+	chain := append(src.InjectChain(), injector)
+	key := strings.Join(chain, ",")
+	if !self.loops.due(key) {
+		return
+	}
+	cycle := loopCycle(chain)
+	var payload string
+	if cycle != nil {
+		payload = fmt.Sprintf("message loop exceeded MaxMsgLoops = %d, cycle: %s",
+			self.Globals.MaxMsgLoops, strings.Join(cycle, " -> "))
+	} else {
+		payload = fmt.Sprintf("message chain exceeded MaxMsgLoops = %d: %s",
+			self.Globals.MaxMsgLoops, strings.Join(chain, " -> "))
+	}
+	LogError.Printf("Plugin '%s' error: %s", injector, payload)
+	loopCount := int(src.MsgLoopCount)
+
+	// The filter's own goroutine mustn't wait for a pack or on the router,
+	// and this one mustn't keep waiting once hekad is stopping.
+	go func() {
+		pack, err := self.pipelinePack(0, self.diagnosticsStop)
+		if err != nil {
+			LogError.Printf("Can't send message loop diagnostic: %s", err)
+			return
+		}
+		msg := pack.Message
+		msg.SetType("heka.message-loop")
+		msg.SetLogger(HEKA_DAEMON)
+		msg.SetPayload(payload)
+		message.NewStringField(msg, "plugin", injector)
+		f := message.NewFieldInit("chain", message.Field_STRING, "")
+		for _, name := range chain {
+			f.AddValue(name)
+		}
+		msg.AddField(f)
+		if cycle != nil {
+			message.NewStringField(msg, "cycle", strings.Join(cycle, " -> "))
+		}
+		message.NewIntField(msg, "MsgLoopCount", loopCount, "count")
+		pack.EncodeMsgBytes()
+		select {
+		case self.router.inChan <- pack:
+		case <-self.diagnosticsStop:
+			pack.recycle()
+		case <-self.Globals.abortChan:
+			pack.recycle()
+		}
+	}()
+}
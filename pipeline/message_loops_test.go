@@ -0,0 +1,142 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func MessageLoopsSpec(c gs.Context) {
+	pConfig := NewPipelineConfig(nil)
+	pConfig.Globals.MaxMsgLoops = 3
+
+	// Follows a message around a loop of filters.
+	inject := func(src *PipelinePack, names ...string) *PipelinePack {
+		for _, name := range names {
+			pack, err := pConfig.PipelinePack(src.MsgLoopCount)
+			if err != nil {
+				_, loops := err.(MsgLoopsError)
+				c.Assume(loops, gs.IsTrue)
+				pConfig.ReportMessageLoop(src, name)
+				return nil
+			}
+			pack.TraceInjection(src, name)
+			src = pack
+		}
+		return src
+	}
+
+	c.Specify("Injected packs", func() {
+		for i := 0; i < 8; i++ {
+			pConfig.injectRecycleChan <- NewPipelinePack(pConfig.injectRecycleChan)
+		}
+		input := NewPipelinePack(nil)
+
+		c.Specify("carry the chain of plugins that injected them", func() {
+			c.Expect(len(input.InjectChain()), gs.Equals, 0)
+			pack := inject(input, "SplitFilter", "EnrichFilter")
+			c.Expect(pack, gs.Not(gs.IsNil))
+			chain := pack.InjectChain()
+			c.Expect(len(chain), gs.Equals, 2)
+			c.Expect(chain[0], gs.Equals, "SplitFilter")
+			c.Expect(chain[1], gs.Equals, "EnrichFilter")
+		})
+
+		c.Specify("name the cycle when they loop", func() {
+			pack := inject(input, "AFilter", "BFilter", "AFilter", "BFilter")
+			c.Expect(pack, gs.IsNil)
+			var diag *PipelinePack
+			select {
+			case diag = <-pConfig.router.inChan:
+			case <-time.After(time.Second):
+			}
+			c.Assume(diag, gs.Not(gs.IsNil))
+			msg := diag.Message
+			c.Expect(msg.GetType(), gs.Equals, "heka.message-loop")
+			cycle, _ := msg.GetFieldValue("cycle")
+			c.Expect(cycle, gs.Equals, "BFilter -> AFilter -> BFilter")
+			chain := msg.FindFirstField("chain").GetValueString()
+			c.Expect(len(chain), gs.Equals, 4)
+			plugin, _ := msg.GetFieldValue("plugin")
+			c.Expect(plugin, gs.Equals, "BFilter")
+
+			c.Specify("but only once a minute", func() {
+				inject(input, "AFilter", "BFilter", "AFilter", "BFilter")
+				select {
+				case <-pConfig.router.inChan:
+					c.Expect(true, gs.IsFalse)
+				case <-time.After(50 * time.Millisecond):
+				}
+			})
+		})
+	})
+
+	c.Specify("Packs injected by filters that don't trace them", func() {
+		received := newReceivedChains()
+		src := NewPipelinePack(nil)
+		src.MsgLoopCount = 2
+		src.SetMetadata(INJECT_CHAIN_METADATA, "AFilter,BFilter")
+		received.record(src)
+
+		c.Specify("carry the chain of the pack they came from", func() {
+			pack := NewPipelinePack(nil)
+			pack.MsgLoopCount = 3
+			received.trace(pack, "GoFilter")
+			chain := pack.InjectChain()
+			c.Expect(len(chain), gs.Equals, 3)
+			c.Expect(chain[2], gs.Equals, "GoFilter")
+		})
+
+		c.Specify("start a chain if they didn't come from one", func() {
+			pack := NewPipelinePack(nil)
+			pack.MsgLoopCount = 1
+			received.trace(pack, "GoFilter")
+			c.Expect(len(pack.InjectChain()), gs.Equals, 1)
+		})
+
+		c.Specify("aren't traced twice", func() {
+			pack := NewPipelinePack(nil)
+			pack.MsgLoopCount = 3
+			pack.TraceInjection(src, "SandboxFilter")
+			received.trace(pack, "SandboxFilter")
+			c.Expect(len(pack.InjectChain()), gs.Equals, 3)
+		})
+	})
+
+	c.Specify("A message loop diagnostic isn't waited on once stopping", func() {
+		pConfig.diagnosticsStop = make(chan struct{})
+		src := NewPipelinePack(nil)
+		src.MsgLoopCount = 3
+		pConfig.ReportMessageLoop(src, "StuckFilter")
+		close(pConfig.diagnosticsStop)
+		time.Sleep(50 * time.Millisecond)
+		pConfig.injectRecycleChan <- NewPipelinePack(pConfig.injectRecycleChan)
+		select {
+		case <-pConfig.router.inChan:
+			c.Expect("diagnostic", gs.Equals, "not sent")
+		case <-time.After(50 * time.Millisecond):
+		}
+		c.Expect(len(pConfig.injectRecycleChan), gs.Equals, 1)
+	})
+
+	c.Specify("A loop cycle", func() {
+		c.Expect(len(loopCycle([]string{"A", "B", "C"})), gs.Equals, 0)
+		cycle := loopCycle([]string{"A", "B", "C", "B"})
+		c.Expect(len(cycle), gs.Equals, 3)
+		c.Expect(cycle[0], gs.Equals, "B")
+	})
+}
@@ -0,0 +1,179 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"heka/message"
+)
+
+const (
+	// Type given to oversize messages by the "route" policy by default.
+	defaultOversizeType = "heka.oversize"
+	// Field holding a truncated message's original size in bytes.
+	truncatedField = "Truncated"
+	// Field holding a routed message's original type.
+	originalTypeField = "OriginalType"
+	// Room left for the truncated field when cutting down a payload.
+	truncatedFieldSize = 32
+)
+
+// An input or decoder's limit on the size of the encoded messages it hands
+// to the router, and what's done with the messages that exceed it.
+type messageSizeLimit struct {
+	// Zero means the global max_message_size.
+	maxSize uint32
+	// "drop", "truncate", "route" or "chunk".
+	policy       string
+	oversizeType string
+	// Number of oversize messages found, accessed atomically.
+	oversizeCount int64
+}
+
+// Returns nil if neither a size nor a policy is set, leaving the messages
+// unchecked.
+func newMessageSizeLimit(maxSize uint32, policy, oversizeType string) (
+	*messageSizeLimit, error) {
+
+	if maxSize == 0 && policy == "" {
+		return nil, nil
+	}
+	l := &messageSizeLimit{
+		maxSize:      maxSize,
+		policy:       policy,
+		oversizeType: oversizeType,
+	}
+	switch policy {
+	case "":
+		l.policy = "drop"
+	case "drop", "truncate", "chunk":
+	case "route":
+		if l.oversizeType == "" {
+			l.oversizeType = defaultOversizeType
+		}
+	default:
+		return nil, fmt.Errorf(
+			"oversize_policy must be 'drop', 'truncate', 'route' or 'chunk', got '%s'",
+			policy)
+	}
+	if l.oversizeType != "" && l.policy != "route" {
+		return nil, fmt.Errorf("oversize_type requires the 'route' oversize_policy")
+	}
+	return l, nil
+}
+
+func (l *messageSizeLimit) max() int {
+	if l.maxSize == 0 {
+		return int(message.MAX_MESSAGE_SIZE)
+	}
+	return int(l.maxSize)
+}
+
+// Applies the policy if the pack's message is oversize, re-encoding it if
+// it's changed, and hands what's to be delivered in its place to deliver.
+// That's just the pack itself unless it's split into chunks, each but the
+// last of which is put in a pack from newPack, taken only once the chunk
+// before it has been delivered. The pack's MsgBytes must be up to date.
+// Returns an error if the pack should be dropped, in which case it's up to
+// the caller to recycle it.
+func (l *messageSizeLimit) apply(pack *PipelinePack, newPack func() *PipelinePack,
+	deliver func(*PipelinePack)) error {
+
+	size := len(pack.MsgBytes)
+	max := l.max()
+	if size <= max {
+		deliver(pack)
+		return nil
+	}
+	atomic.AddInt64(&l.oversizeCount, 1)
+	msg := pack.Message
+	switch l.policy {
+	case "chunk":
+		return chunkPack(pack, max, newPack, deliver)
+	case "truncate":
+		payload := msg.GetPayload()
+		keep := len(payload) - (size - max) - truncatedFieldSize
+		if keep < 0 {
+			return fmt.Errorf("message of %d bytes exceeds the %d byte limit "+
+				"and can't be truncated", size, max)
+		}
+		for keep > 0 && !utf8.RuneStart(payload[keep]) {
+			keep--
+		}
+		msg.SetPayload(payload[:keep])
+		message.NewInt64Field(msg, truncatedField, int64(size), "B")
+	case "route":
+		message.NewStringField(msg, originalTypeField, msg.GetType())
+		msg.SetType(l.oversizeType)
+	default:
+		return fmt.Errorf("message of %d bytes exceeds the %d byte limit and "+
+			"was dropped", size, max)
+	}
+	pack.TrustMsgBytes = false
+	if err := pack.EncodeMsgBytes(); err != nil {
+		return fmt.Errorf("encoding message: %s", err)
+	}
+	if l.policy == "truncate" && len(pack.MsgBytes) > max {
+		return fmt.Errorf("message of %d bytes exceeds the %d byte limit "+
+			"even when truncated", size, max)
+	}
+	deliver(pack)
+	return nil
+}
+
+// Splits the pack's message into chunks of at most max bytes, one per pack,
+// to be put back together by a ChunkReassemblyDecoder. Packs are borrowed one
+// at a time as the chunks are delivered, so that the pack supply can't run
+// dry waiting on chunks that haven't been sent yet. The pack itself carries
+// the last chunk, and isn't delivered if anything goes wrong before then.
+func chunkPack(pack *PipelinePack, max int, newPack func() *PipelinePack,
+	deliver func(*PipelinePack)) error {
+
+	chunks, err := message.ChunkMessage(pack.Message, max)
+	if err != nil {
+		return err
+	}
+	last := len(chunks) - 1
+	for i, chunk := range chunks {
+		p := pack
+		if i < last {
+			if p = newPack(); p == nil {
+				// Aborting.
+				return errors.New("no pack available for message chunk")
+			}
+			p.Signer = pack.Signer
+			pack.CopyMetadata(p)
+		}
+		p.Message = chunk
+		p.TrustMsgBytes = false
+		if err = p.EncodeMsgBytes(); err != nil {
+			if p != pack {
+				p.recycle()
+			}
+			return fmt.Errorf("encoding message chunk: %s", err)
+		}
+		deliver(p)
+	}
+	return nil
+}
+
+// Returns how many oversize messages have been found.
+func (l *messageSizeLimit) count() int64 {
+	return atomic.LoadInt64(&l.oversizeCount)
+}
@@ -0,0 +1,167 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"strings"
+
+	"heka/message"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func MessageSizeSpec(c gs.Context) {
+	c.Specify("A message size limit", func() {
+		newPack := func(payloadSize int) *PipelinePack {
+			pack := NewPipelinePack(nil)
+			pack.Message.SetType("test")
+			pack.Message.SetPayload(strings.Repeat("x", payloadSize))
+			err := pack.EncodeMsgBytes()
+			c.Assume(err, gs.IsNil)
+			return pack
+		}
+		var delivered []*PipelinePack
+		deliver := func(pack *PipelinePack) {
+			delivered = append(delivered, pack)
+		}
+
+		c.Specify("isn't made without a size or policy", func() {
+			l, err := newMessageSizeLimit(0, "", "")
+			c.Expect(err, gs.IsNil)
+			c.Expect(l == nil, gs.IsTrue)
+		})
+
+		c.Specify("rejects bad settings", func() {
+			_, err := newMessageSizeLimit(1024, "shrink", "")
+			c.Expect(err, gs.Not(gs.IsNil))
+			_, err = newMessageSizeLimit(1024, "drop", "big")
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("passes messages within the limit untouched", func() {
+			l, err := newMessageSizeLimit(1024, "", "")
+			c.Assume(err, gs.IsNil)
+			pack := newPack(500)
+			err = l.apply(pack, nil, deliver)
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(delivered), gs.Equals, 1)
+			c.Expect(pack.TrustMsgBytes, gs.IsTrue)
+			c.Expect(l.count(), gs.Equals, int64(0))
+		})
+
+		c.Specify("drops oversize messages by default", func() {
+			l, err := newMessageSizeLimit(1024, "", "")
+			c.Assume(err, gs.IsNil)
+			err = l.apply(newPack(2000), nil, deliver)
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(l.count(), gs.Equals, int64(1))
+		})
+
+		c.Specify("truncates the payload and marks the message", func() {
+			l, err := newMessageSizeLimit(1024, "truncate", "")
+			c.Assume(err, gs.IsNil)
+			pack := newPack(2000)
+			size := len(pack.MsgBytes)
+			err = l.apply(pack, nil, deliver)
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(pack.MsgBytes) <= 1024, gs.IsTrue)
+			c.Expect(len(pack.Message.GetPayload()) < 1024, gs.IsTrue)
+			original, ok := pack.Message.GetFieldValue("Truncated")
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(original, gs.Equals, int64(size))
+		})
+
+		c.Specify("doesn't split a character when truncating", func() {
+			l, err := newMessageSizeLimit(1024, "truncate", "")
+			c.Assume(err, gs.IsNil)
+			pack := NewPipelinePack(nil)
+			pack.Message.SetPayload(strings.Repeat("é", 1000))
+			c.Assume(pack.EncodeMsgBytes(), gs.IsNil)
+			err = l.apply(pack, nil, deliver)
+			c.Expect(err, gs.IsNil)
+			payload := pack.Message.GetPayload()
+			c.Expect(payload, gs.Equals, strings.Repeat("é", len(payload)/2))
+		})
+
+		c.Specify("drops messages too big without their payload", func() {
+			l, err := newMessageSizeLimit(1024, "truncate", "")
+			c.Assume(err, gs.IsNil)
+			pack := newPack(0)
+			pack.Message.SetLogger(strings.Repeat("y", 2000))
+			pack.TrustMsgBytes = false
+			c.Assume(pack.EncodeMsgBytes(), gs.IsNil)
+			err = l.apply(pack, nil, deliver)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("routes oversize messages to their own type", func() {
+			l, err := newMessageSizeLimit(1024, "route", "")
+			c.Assume(err, gs.IsNil)
+			pack := newPack(2000)
+			err = l.apply(pack, nil, deliver)
+			c.Expect(err, gs.IsNil)
+			c.Expect(pack.Message.GetType(), gs.Equals, "heka.oversize")
+			typ, _ := pack.Message.GetFieldValue("OriginalType")
+			c.Expect(typ, gs.Equals, "test")
+			c.Expect(len(pack.Message.GetPayload()), gs.Equals, 2000)
+			c.Expect(pack.TrustMsgBytes, gs.IsTrue)
+		})
+
+		c.Specify("splits oversize messages into chunks", func() {
+			l, err := newMessageSizeLimit(1024, "chunk", "")
+			c.Assume(err, gs.IsNil)
+			// A single spare pack is enough, as each chunk is delivered
+			// before the next pack is taken.
+			pool := make(chan *PipelinePack, 1)
+			pool <- NewPipelinePack(pool)
+			pack := newPack(2000)
+			var seqs []int
+			err = l.apply(pack, func() *PipelinePack {
+				select {
+				case p := <-pool:
+					return p
+				default:
+					return nil
+				}
+			}, func(p *PipelinePack) {
+				c.Expect(len(p.MsgBytes) <= 1024, gs.IsTrue)
+				c.Expect(p.TrustMsgBytes, gs.IsTrue)
+				_, seq, total, ok := message.ChunkInfo(p.Message)
+				c.Expect(ok, gs.IsTrue)
+				c.Expect(total, gs.Equals, 3)
+				seqs = append(seqs, seq)
+				delivered = append(delivered, p)
+				if p != pack {
+					p.recycle()
+				}
+			})
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(seqs), gs.Equals, 3)
+			for i, seq := range seqs {
+				c.Expect(seq, gs.Equals, i)
+			}
+			c.Expect(delivered[2] == pack, gs.IsTrue)
+			c.Expect(len(pool), gs.Equals, 1)
+		})
+
+		c.Specify("delivers nothing more when aborting", func() {
+			l, err := newMessageSizeLimit(1024, "chunk", "")
+			c.Assume(err, gs.IsNil)
+			err = l.apply(newPack(3000), func() *PipelinePack { return nil }, deliver)
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(len(delivered), gs.Equals, 0)
+		})
+	})
+}
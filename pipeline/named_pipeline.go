@@ -0,0 +1,69 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// A decoder and processor chain defined once, in a `[pipeline.<name>]`
+// config section, for any number of inputs to use through their `pipeline`
+// setting.
+type NamedPipelineConfig struct {
+	Decoder    string   `toml:"decoder"`
+	Processors []string `toml:"processors"`
+}
+
+// Loads the named pipelines of a config file's `pipeline` section. A name
+// may only be defined once across all of the config files.
+func (self *PipelineConfig) preloadNamedPipelines(conf toml.Primitive) error {
+	var pipelines map[string]*NamedPipelineConfig
+	if err := toml.PrimitiveDecode(conf, &pipelines); err != nil {
+		return fmt.Errorf("can't decode pipeline config: %s", err)
+	}
+	if self.namedPipelines == nil {
+		self.namedPipelines = make(map[string]*NamedPipelineConfig)
+	}
+	for name, pipeline := range pipelines {
+		if _, ok := self.namedPipelines[name]; ok {
+			return fmt.Errorf("pipeline '%s' is defined more than once", name)
+		}
+		LogInfo.Printf("Pre-loading: [%s.%s]\n", NAMED_PIPELINES, name)
+		self.namedPipelines[name] = pipeline
+	}
+	return nil
+}
+
+// Fills in an input's decoder and processors from its named pipeline, if it
+// has one. The input's own decoder takes the place of the pipeline's, and
+// its own processors run after the pipeline's.
+func (self *PipelineConfig) applyNamedPipeline(input *CommonInputConfig) error {
+	if input.Pipeline == "" {
+		return nil
+	}
+	pipeline, ok := self.namedPipelines[input.Pipeline]
+	if !ok {
+		return fmt.Errorf("specifies undefined pipeline %s", input.Pipeline)
+	}
+	if input.Decoder == "" {
+		input.Decoder = pipeline.Decoder
+	}
+	processors := make([]string, 0, len(pipeline.Processors)+len(input.Processors))
+	processors = append(processors, pipeline.Processors...)
+	input.Processors = append(processors, input.Processors...)
+	return nil
+}
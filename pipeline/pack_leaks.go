@@ -0,0 +1,125 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Longest stretch of a leaked pack's payload that's logged.
+const leakPayloadLen = 80
+
+// Debug mode scanner, finding packs that haven't been recycled within the
+// deadline of being taken from their recycle channel, or failing a record of
+// that of being injected, so packs dropped before they're ever injected are
+// caught too. Each leak is logged once, with the plugin that
+// injected the pack, the plugins it was handed to and a summary of its
+// message, to track down plugins that forget to call Recycle.
+type leakDetector struct {
+	trackers []*DiagnosticTracker
+	deadline time.Duration
+	globals  *GlobalConfigStruct
+	// Borrow or injection times of the packs already logged.
+	reported map[*PipelinePack]time.Time
+	// Number of leaked packs found, accessed atomically.
+	count int64
+}
+
+func newLeakDetector(globals *GlobalConfigStruct,
+	trackers ...*DiagnosticTracker) *leakDetector {
+
+	return &leakDetector{
+		trackers: trackers,
+		deadline: globals.PackLeakDeadline,
+		globals:  globals,
+		reported: make(map[*PipelinePack]time.Time),
+	}
+}
+
+// Scans the packs twice per deadline, at most every 30 seconds, until stop is
+// closed.
+func (l *leakDetector) run(stop chan struct{}) {
+	interval := l.deadline / 2
+	if interval > 30*time.Second {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			l.scan(now)
+		}
+	}
+}
+
+// Logs the packs found leaked as of now that haven't been logged yet, and
+// returns how many there were.
+func (l *leakDetector) scan(now time.Time) (found int) {
+	for _, tracker := range l.trackers {
+		for _, pack := range tracker.packs {
+			borrower, borrowed := pack.diagnostics.Borrower()
+			injector, injected := pack.diagnostics.Injector()
+			since := borrowed
+			if since.IsZero() {
+				since = injected
+			}
+			if since.IsZero() {
+				delete(l.reported, pack)
+				continue
+			}
+			if now.Sub(since) < l.deadline || l.reported[pack].Equal(since) {
+				continue
+			}
+			l.reported[pack] = since
+			found++
+			origin := fmt.Sprintf("injected by '%s'", injector)
+			if !borrowed.IsZero() {
+				if injector == "" {
+					origin = fmt.Sprintf("taken by '%s', never injected", borrower)
+				} else {
+					origin = fmt.Sprintf("taken by '%s', %s", borrower, origin)
+				}
+			}
+			holders := strings.Join(pack.diagnostics.PluginNames(), ", ")
+			if holders == "" {
+				holders = "no plugins"
+			}
+			l.globals.LogMessage("Diagnostics", fmt.Sprintf(
+				"(%s) Pack leaked: %s %s ago, held by %s with %d references. "+
+					"Message: %s", tracker.ChannelName, origin, now.Sub(since),
+				holders, atomic.LoadInt32(&pack.RefCount), leakSummary(pack)))
+		}
+	}
+	atomic.AddInt64(&l.count, int64(found))
+	return found
+}
+
+// Summarizes a leaked pack's message. The message isn't locked, so this is
+// only fit for debugging.
+func leakSummary(pack *PipelinePack) string {
+	msg := pack.Message
+	payload := msg.GetPayload()
+	if len(payload) > leakPayloadLen {
+		payload = payload[:leakPayloadLen] + "..."
+	}
+	return fmt.Sprintf("Type=%q Logger=%q Uuid=%s Payload=%q", msg.GetType(),
+		msg.GetLogger(), msg.GetUuidString(), payload)
+}
@@ -0,0 +1,97 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"strings"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func PackLeakSpec(c gs.Context) {
+	globals := DefaultGlobals()
+	globals.PackLeakDeadline = time.Minute
+	pool := make(chan *PipelinePack, 2)
+	tracker := NewDiagnosticTracker("input", globals)
+	packs := []*PipelinePack{NewPipelinePack(pool), NewPipelinePack(pool)}
+	for _, pack := range packs {
+		tracker.AddPack(pack)
+	}
+	detector := newLeakDetector(globals, tracker)
+	filter := &iRunner{pRunnerBase: pRunnerBase{name: "forgetful"}}
+
+	c.Specify("A leakDetector", func() {
+		packs[0].diagnostics.SetInjector("TcpInput")
+		packs[0].diagnostics.AddStamp(filter)
+		packs[0].Message.SetType("test")
+
+		c.Specify("ignores packs injected within the deadline", func() {
+			c.Expect(detector.scan(time.Now()), gs.Equals, 0)
+		})
+
+		c.Specify("reports each leaked pack once", func() {
+			later := time.Now().Add(2 * time.Minute)
+			c.Expect(detector.scan(later), gs.Equals, 1)
+			c.Expect(detector.scan(later), gs.Equals, 0)
+			c.Expect(detector.count, gs.Equals, int64(1))
+
+			// Recycled and injected again, it can leak again.
+			packs[0].Zero()
+			c.Expect(detector.scan(later), gs.Equals, 0)
+			packs[0].diagnostics.SetInjector("TcpInput")
+			c.Expect(detector.scan(later.Add(2*time.Minute)), gs.Equals, 1)
+		})
+
+		c.Specify("times the leak from when the pack was borrowed", func() {
+			packs[0].diagnostics.SetBorrower("TcpInput")
+			_, borrowed := packs[0].diagnostics.Borrower()
+			c.Expect(detector.scan(borrowed.Add(30*time.Second)), gs.Equals, 0)
+			c.Expect(detector.scan(borrowed.Add(2*time.Minute)), gs.Equals, 1)
+		})
+
+		c.Specify("summarizes the leaked message", func() {
+			packs[0].Message.SetPayload(strings.Repeat("x", 100))
+			summary := leakSummary(packs[0])
+			c.Expect(strings.HasPrefix(summary, `Type="test" Logger="" Uuid=`), gs.IsTrue)
+			c.Expect(strings.HasSuffix(summary, strings.Repeat("x", 80)+`..."`), gs.IsTrue)
+		})
+	})
+
+	c.Specify("A recycled pack forgets its injector", func() {
+		packs[1].diagnostics.SetInjector("TcpInput")
+		name, injected := packs[1].diagnostics.Injector()
+		c.Expect(name, gs.Equals, "TcpInput")
+		c.Expect(injected.IsZero(), gs.IsFalse)
+		packs[1].Zero()
+		name, injected = packs[1].diagnostics.Injector()
+		c.Expect(name, gs.Equals, "")
+		c.Expect(injected.IsZero(), gs.IsTrue)
+	})
+
+	c.Specify("A borrowed pack that's never injected is reported", func() {
+		packs[1].diagnostics.SetBorrower("LogstreamerInput")
+		name, borrowed := packs[1].diagnostics.Borrower()
+		c.Expect(name, gs.Equals, "LogstreamerInput")
+		c.Expect(detector.scan(borrowed.Add(2*time.Minute)), gs.Equals, 1)
+
+		// Recycled, it forgets its borrower and is no longer a leak.
+		packs[1].Zero()
+		name, borrowed = packs[1].diagnostics.Borrower()
+		c.Expect(name, gs.Equals, "")
+		c.Expect(borrowed.IsZero(), gs.IsTrue)
+		c.Expect(detector.scan(time.Now().Add(4*time.Minute)), gs.Equals, 0)
+	})
+}
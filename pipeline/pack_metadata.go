@@ -0,0 +1,73 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+// A pack's metadata is a set of string values that travel with the pack
+// from one pipeline stage to the next, e.g. routing hints, the identity a
+// client authenticated as or a trace id, without becoming part of the
+// message. It's never encoded into MsgBytes, so it doesn't survive leaving
+// hekad or being written to a queue buffer, and it's cleared when the pack
+// is recycled. Inputs and decoders set it before the pack is routed, after
+// which it's shared by every filter and output the pack is handed to.
+
+// Sets a metadata value on the pack.
+func (p *PipelinePack) SetMetadata(key, value string) {
+	p.metaLock.Lock()
+	if p.metadata == nil {
+		p.metadata = make(map[string]string)
+	}
+	p.metadata[key] = value
+	p.metaLock.Unlock()
+}
+
+// Returns a metadata value, ok is false if the pack has none for the key.
+func (p *PipelinePack) GetMetadata(key string) (value string, ok bool) {
+	p.metaLock.RLock()
+	value, ok = p.metadata[key]
+	p.metaLock.RUnlock()
+	return
+}
+
+// Removes a metadata value from the pack.
+func (p *PipelinePack) DeleteMetadata(key string) {
+	p.metaLock.Lock()
+	delete(p.metadata, key)
+	p.metaLock.Unlock()
+}
+
+// Returns a copy of all of the pack's metadata.
+func (p *PipelinePack) Metadata() map[string]string {
+	p.metaLock.RLock()
+	defer p.metaLock.RUnlock()
+	metadata := make(map[string]string, len(p.metadata))
+	for key, value := range p.metadata {
+		metadata[key] = value
+	}
+	return metadata
+}
+
+// Copies the pack's metadata onto dst, for packs carrying messages derived
+// from this pack's, replacing any values dst already has for the same keys.
+func (p *PipelinePack) CopyMetadata(dst *PipelinePack) {
+	for key, value := range p.Metadata() {
+		dst.SetMetadata(key, value)
+	}
+}
+
+func (p *PipelinePack) clearMetadata() {
+	p.metaLock.Lock()
+	p.metadata = nil
+	p.metaLock.Unlock()
+}
@@ -0,0 +1,65 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func PackMetadataSpec(c gs.Context) {
+	c.Specify("A pack's metadata", func() {
+		pool := make(chan *PipelinePack, 1)
+		pack := NewPipelinePack(pool)
+		pack.SetMetadata("trace_id", "abc123")
+		pack.SetMetadata("identity", "edge-1")
+
+		c.Specify("is set and read", func() {
+			value, ok := pack.GetMetadata("trace_id")
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(value, gs.Equals, "abc123")
+			pack.DeleteMetadata("trace_id")
+			_, ok = pack.GetMetadata("trace_id")
+			c.Expect(ok, gs.IsFalse)
+			c.Expect(len(pack.Metadata()), gs.Equals, 1)
+		})
+
+		c.Specify("isn't encoded with the message", func() {
+			c.Expect(pack.EncodeMsgBytes(), gs.IsNil)
+			c.Expect(len(pack.Message.Fields), gs.Equals, 0)
+			decoded := NewPipelinePack(nil)
+			decoded.MsgBytes = pack.MsgBytes
+			decoder := new(ProtobufDecoder)
+			decoder.sampleDenominator = 1
+			_, err := decoder.Decode(decoded)
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(decoded.Metadata()), gs.Equals, 0)
+		})
+
+		c.Specify("is copied to derived packs", func() {
+			derived := NewPipelinePack(nil)
+			derived.SetMetadata("identity", "other")
+			pack.CopyMetadata(derived)
+			value, _ := derived.GetMetadata("identity")
+			c.Expect(value, gs.Equals, "edge-1")
+			c.Expect(len(derived.Metadata()), gs.Equals, 2)
+		})
+
+		c.Specify("is cleared when the pack is recycled", func() {
+			pack.recycle()
+			recycled := <-pool
+			c.Expect(len(recycled.Metadata()), gs.Equals, 0)
+		})
+	})
+}
@@ -0,0 +1,183 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// How often the input pack pool is checked, at most.
+var starvationPollInterval = 100 * time.Millisecond
+
+// Holder named for outstanding packs that aren't stamped with any plugin,
+// i.e. those still held by inputs or waiting on the router's channel.
+const unstampedHolder = "(inputs)"
+
+// A plugin holding outstanding packs, as found by DiagnosticTracker.Holders.
+type PackHolder struct {
+	Name string
+	// Outstanding packs stamped as handed to the plugin.
+	Packs int
+	// Sum of those packs' RefCounts, how many Recycle calls they're waiting
+	// on across all of their holders.
+	Refs int
+}
+
+// Holders ranks the plugins holding the tracker's outstanding packs, most
+// packs first. poolFree is the number of packs currently in the pool, so
+// the packs held but not yet stamped can be accounted for.
+func (d *DiagnosticTracker) Holders(poolFree int) []PackHolder {
+	byName := make(map[string]*PackHolder)
+	stamped := 0
+	for _, pack := range d.packs {
+		names := pack.diagnostics.PluginNames()
+		if len(names) == 0 {
+			continue
+		}
+		stamped++
+		refs := int(atomic.LoadInt32(&pack.RefCount))
+		for _, name := range names {
+			holder, ok := byName[name]
+			if !ok {
+				holder = &PackHolder{Name: name}
+				byName[name] = holder
+			}
+			holder.Packs++
+			holder.Refs += refs
+		}
+	}
+	holders := make([]PackHolder, 0, len(byName)+1)
+	for _, holder := range byName {
+		holders = append(holders, *holder)
+	}
+	if n := len(d.packs) - poolFree - stamped; n > 0 {
+		holders = append(holders, PackHolder{Name: unstampedHolder, Packs: n, Refs: n})
+	}
+	sort.Sort(packHolders(holders))
+	return holders
+}
+
+type packHolders []PackHolder
+
+func (h packHolders) Len() int      { return len(h) }
+func (h packHolders) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h packHolders) Less(i, j int) bool {
+	if h[i].Packs != h[j].Packs {
+		return h[i].Packs > h[j].Packs
+	}
+	return h[i].Name < h[j].Name
+}
+
+// Formats holders as "name:packs" pairs, as used in the input report.
+func formatPackHolders(holders []PackHolder) string {
+	var buf bytes.Buffer
+	for i, holder := range holders {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "%s:%d", holder.Name, holder.Packs)
+	}
+	return buf.String()
+}
+
+// Watches the input pack pool, and reports which plugins hold its packs
+// whenever it's stayed empty for longer than the threshold, since inputs
+// are then blocked waiting on InputRecycleChan.
+type starvationMonitor struct {
+	pool      chan *PipelinePack
+	tracker   *DiagnosticTracker
+	threshold time.Duration
+	globals   *GlobalConfigStruct
+	// Number of times the pool has been starved, accessed atomically.
+	count int64
+	// Total time spent starved in nanoseconds, accessed atomically.
+	starved int64
+}
+
+func newStarvationMonitor(pool chan *PipelinePack, tracker *DiagnosticTracker,
+	globals *GlobalConfigStruct) *starvationMonitor {
+
+	return &starvationMonitor{
+		pool:      pool,
+		tracker:   tracker,
+		threshold: globals.PackStarvationThreshold,
+		globals:   globals,
+	}
+}
+
+// Returns the plugins holding packs from the pool, most packs first.
+func (m *starvationMonitor) holders() []PackHolder {
+	return m.tracker.Holders(len(m.pool))
+}
+
+// Polls the pool until stop is closed. Does nothing if the threshold is zero.
+func (m *starvationMonitor) run(stop chan struct{}) {
+	if m.threshold <= 0 {
+		return
+	}
+	interval := starvationPollInterval
+	if m.threshold/4 < interval {
+		interval = m.threshold / 4
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var emptySince time.Time
+	reported := false
+	for {
+		var now time.Time
+		select {
+		case <-stop:
+			return
+		case now = <-ticker.C:
+		}
+		if len(m.pool) > 0 {
+			if reported {
+				starved := now.Sub(emptySince)
+				atomic.AddInt64(&m.starved, int64(starved))
+				m.globals.LogMessage("Diagnostics", fmt.Sprintf(
+					"Input packs available again after %s.", starved))
+			}
+			emptySince = time.Time{}
+			reported = false
+			continue
+		}
+		if emptySince.IsZero() {
+			emptySince = now
+			continue
+		}
+		if !reported && now.Sub(emptySince) >= m.threshold {
+			reported = true
+			atomic.AddInt64(&m.count, 1)
+			m.logHolders(now.Sub(emptySince))
+		}
+	}
+}
+
+func (m *starvationMonitor) logHolders(empty time.Duration) {
+	g := m.globals
+	g.LogMessage("Diagnostics", fmt.Sprintf(
+		"Input pack pool has been empty for %s, inputs are waiting for packs.",
+		empty))
+	g.LogMessage("Diagnostics", "Plugin names and quantities of outstanding packs:")
+	for _, holder := range m.holders() {
+		g.LogMessage("Diagnostics", fmt.Sprintf("\t%s: %d packs, %d references",
+			holder.Name, holder.Packs, holder.Refs))
+	}
+}
@@ -0,0 +1,114 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"sync/atomic"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func PackStarvationSpec(c gs.Context) {
+	globals := DefaultGlobals()
+	pool := make(chan *PipelinePack, 4)
+	tracker := NewDiagnosticTracker("input", globals)
+	packs := make([]*PipelinePack, 4)
+	for i := range packs {
+		packs[i] = NewPipelinePack(pool)
+		tracker.AddPack(packs[i])
+	}
+	slow := &iRunner{pRunnerBase: pRunnerBase{name: "slow"}}
+	fast := &iRunner{pRunnerBase: pRunnerBase{name: "fast"}}
+
+	c.Specify("A DiagnosticTracker", func() {
+		c.Specify("ranks the holders of outstanding packs", func() {
+			packs[0].diagnostics.Stamp(slow)
+			packs[0].diagnostics.AddStamp(fast)
+			packs[0].RefCount = 2
+			packs[1].diagnostics.Stamp(slow)
+			// packs[2] is held by an input, packs[3] is in the pool.
+			holders := tracker.Holders(1)
+			c.Expect(len(holders), gs.Equals, 3)
+			c.Expect(holders[0], gs.Equals, PackHolder{Name: "slow", Packs: 2, Refs: 3})
+			c.Expect(holders[1], gs.Equals, PackHolder{Name: "(inputs)", Packs: 1, Refs: 1})
+			c.Expect(holders[2], gs.Equals, PackHolder{Name: "fast", Packs: 1, Refs: 2})
+			c.Expect(formatPackHolders(holders), gs.Equals, "slow:2, (inputs):1, fast:1")
+		})
+
+		c.Specify("finds no holders when every pack is in the pool", func() {
+			c.Expect(len(tracker.Holders(4)), gs.Equals, 0)
+		})
+	})
+
+	c.Specify("A starvationMonitor", func() {
+		starvationPollInterval = time.Millisecond
+		globals.PackStarvationThreshold = 20 * time.Millisecond
+		monitor := newStarvationMonitor(pool, tracker, globals)
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			monitor.run(stop)
+			close(done)
+		}()
+
+		c.Specify("counts each time the pool stays empty too long", func() {
+			packs[0].diagnostics.Stamp(slow)
+			time.Sleep(50 * time.Millisecond)
+			c.Expect(atomic.LoadInt64(&monitor.count), gs.Equals, int64(1))
+
+			pool <- packs[1]
+			time.Sleep(10 * time.Millisecond)
+			c.Expect(atomic.LoadInt64(&monitor.starved) > 0, gs.IsTrue)
+			<-pool
+			time.Sleep(50 * time.Millisecond)
+			c.Expect(atomic.LoadInt64(&monitor.count), gs.Equals, int64(2))
+		})
+
+		c.Specify("ignores a pool that's emptied only briefly", func() {
+			for _, pack := range packs {
+				pool <- pack
+			}
+			time.Sleep(10 * time.Millisecond)
+			<-pool
+			<-pool
+			<-pool
+			<-pool
+			time.Sleep(5 * time.Millisecond)
+			pool <- packs[0]
+			time.Sleep(30 * time.Millisecond)
+			c.Expect(atomic.LoadInt64(&monitor.count), gs.Equals, int64(0))
+		})
+
+		close(stop)
+		<-done
+		starvationPollInterval = 100 * time.Millisecond
+	})
+
+	c.Specify("A disabled starvationMonitor returns at once", func() {
+		globals.PackStarvationThreshold = 0
+		monitor := newStarvationMonitor(pool, tracker, globals)
+		done := make(chan struct{})
+		go func() {
+			monitor.run(make(chan struct{}))
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			c.Expect("monitor still running", gs.Equals, "")
+		}
+	})
+}
@@ -29,6 +29,14 @@ type PacketTracking struct {
 	// Plugins the packet has been handed to.
 	lastPlugins []PluginRunner
 
+	// Plugin that injected the packet and when, and the plugin that took it
+	// from its recycle channel and when, only recorded when pack leak
+	// detection is enabled.
+	injector string
+	injected time.Time
+	borrower string
+	borrowed time.Time
+
 	// RWMutex to gate attribute access.
 	rwmutex sync.RWMutex
 }
@@ -68,6 +76,56 @@ func (p *PacketTracking) Reset() {
 	p.rwmutex.Unlock()
 }
 
+// SetInjector records the plugin injecting the packet into the router, and
+// the time. Unlike the stamps it's kept until the packet is recycled.
+func (p *PacketTracking) SetInjector(name string) {
+	p.rwmutex.Lock()
+	p.injector = name
+	p.injected = time.Now()
+	p.rwmutex.Unlock()
+}
+
+// Injector returns the plugin that injected the packet and when, or a zero
+// time if that wasn't recorded.
+func (p *PacketTracking) Injector() (name string, injected time.Time) {
+	p.rwmutex.RLock()
+	name, injected = p.injector, p.injected
+	p.rwmutex.RUnlock()
+	return
+}
+
+// SetBorrower records the plugin that took the packet from its recycle
+// channel, and the time. Like the injector it's kept until the packet is
+// recycled.
+func (p *PacketTracking) SetBorrower(name string) {
+	p.rwmutex.Lock()
+	p.borrower = name
+	p.borrowed = time.Now()
+	p.rwmutex.Unlock()
+}
+
+// Borrower returns the plugin that took the packet from its recycle channel
+// and when, or a zero time if that wasn't recorded.
+func (p *PacketTracking) Borrower() (name string, borrowed time.Time) {
+	p.rwmutex.RLock()
+	name, borrowed = p.borrower, p.borrowed
+	p.rwmutex.RUnlock()
+	return
+}
+
+// Resets the stamps and the recorded injector and borrower, for when the
+// packet is recycled.
+func (p *PacketTracking) resetAll() {
+	p.rwmutex.Lock()
+	p.lastPlugins = p.lastPlugins[:0]
+	p.LastAccess = time.Now()
+	p.injector = ""
+	p.injected = time.Time{}
+	p.borrower = ""
+	p.borrowed = time.Time{}
+	p.rwmutex.Unlock()
+}
+
 // PluginNames returns the names of the plugins that have last accessed the
 // packet.
 func (p *PacketTracking) PluginNames() (names []string) {
@@ -60,6 +60,66 @@ type GlobalConfigStruct struct {
 	abortChan             chan struct{}
 	FullBufferMaxRetries  uint
 	exitCode              int
+	// How long to wait for in-flight messages and output buffers to drain
+	// after the inputs stop during shutdown. Zero disables draining.
+	ShutdownDrainTimeout time.Duration
+	// How long the input pack pool can stay empty before the plugins
+	// holding its packs are reported. Zero disables the check.
+	PackStarvationThreshold time.Duration
+	// How long after being injected a pack can go unrecycled before it's
+	// logged as leaked. Zero disables leak detection.
+	PackLeakDeadline time.Duration
+	// Maximum sustained rate of messages per second that filters and
+	// outputs can inject in total. Zero means unlimited.
+	MaxInjectRate uint
+	// Maximum sustained bytes per second sent by the outputs sharing the
+	// global egress limit, and the burst they can send after being idle.
+	// Zero means unlimited.
+	MaxEgressBytesPerSec uint64
+	EgressBurstBytes     uint64
+	// Maximum bytes of the records that splitters and decoders panicked on
+	// kept under BaseDir/quarantine. Zero keeps none.
+	QuarantineMaxSize uint64
+	// Decoder and splitter of the inputs, and encoder of the outputs, that
+	// don't set one.
+	DefaultDecoder  string
+	DefaultSplitter string
+	DefaultEncoder  string
+	// Regular expressions matching the config keys whose values are
+	// redacted wherever plugin configs are shown, nil for
+	// DefaultRedactPatterns.
+	RedactPatterns []string
+	// Tenancy settings, nil if tenant quotas aren't in use.
+	Tenancy *TenancyConfig
+	// Cluster coordination settings, nil if singleton inputs aren't in use.
+	Cluster *ClusterConfig
+	// Gossip mesh settings, nil if this node doesn't join a mesh.
+	Gossip *GossipConfig
+	// Checkpoint storage settings, nil to keep checkpoints under BaseDir.
+	Checkpoints *CheckpointConfig
+	// Key/value cache settings, nil for the defaults.
+	Cache *KVCacheConfig
+	// Admin API settings, nil if the admin API isn't served.
+	Admin *AdminConfig
+	// Config watch settings, nil if config changes aren't watched for.
+	ConfigWatch *ConfigWatchConfig
+	// Host metadata settings, nil if messages aren't enriched with it.
+	HostMetadata *HostMetadataConfig
+	// Host metadata loaded as HostMetadata says, added to injected messages.
+	HostInfo *HostMetadata
+	// Version of hekad, as gossiped to the rest of the mesh.
+	Version string
+	// Name of the pipeline, when hekad runs several, otherwise empty.
+	Pipeline string
+	// Globals of the whole process, holding the shutdown state shared by all
+	// of its pipelines, nil if these are they.
+	parent *GlobalConfigStruct
+	// The process-wide key/value cache, created on first use.
+	kvCache     *KVCache
+	kvCacheLock sync.Mutex
+	// The process-wide counters and gauges, created on first use.
+	counters     *Counters
+	countersLock sync.Mutex
 }
 
 // Creates a GlobalConfigStruct object populated w/ default values.
@@ -78,9 +138,118 @@ func DefaultGlobals() (globals *GlobalConfigStruct) {
 		sigChan:               make(chan os.Signal, 1),
 		Hostname:              hostname,
 		abortChan:             make(chan struct{}),
+		// Inputs waiting this long for a pack are likely stuck.
+		PackStarvationThreshold: 5 * time.Second,
 	}
 }
 
+// PipelineGlobals returns a copy of the globals for the named pipeline, one
+// of several run by RunPipelines. Shutting down from any copy shuts them all
+// down. Input positions and singleton leases are kept apart from other
+// pipelines by the name.
+func (g *GlobalConfigStruct) PipelineGlobals(name string) *GlobalConfigStruct {
+	return &GlobalConfigStruct{
+		MaxMsgProcessDuration:   g.MaxMsgProcessDuration,
+		PoolSize:                g.PoolSize,
+		PluginChanSize:          g.PluginChanSize,
+		MaxMsgLoops:             g.MaxMsgLoops,
+		MaxMsgProcessInject:     g.MaxMsgProcessInject,
+		MaxMsgTimerInject:       g.MaxMsgTimerInject,
+		MaxInjectRate:           g.MaxInjectRate,
+		MaxEgressBytesPerSec:    g.MaxEgressBytesPerSec,
+		EgressBurstBytes:        g.EgressBurstBytes,
+		QuarantineMaxSize:       g.QuarantineMaxSize,
+		DefaultDecoder:          g.DefaultDecoder,
+		DefaultSplitter:         g.DefaultSplitter,
+		DefaultEncoder:          g.DefaultEncoder,
+		RedactPatterns:          g.RedactPatterns,
+		MaxPackIdle:             g.MaxPackIdle,
+		BaseDir:                 filepath.Join(g.BaseDir, "pipelines", name),
+		ShareDir:                g.ShareDir,
+		SampleDenominator:       g.SampleDenominator,
+		sigChan:                 g.sigChan,
+		Hostname:                g.Hostname,
+		abortChan:               g.abortChan,
+		FullBufferMaxRetries:    g.FullBufferMaxRetries,
+		ShutdownDrainTimeout:    g.ShutdownDrainTimeout,
+		PackStarvationThreshold: g.PackStarvationThreshold,
+		PackLeakDeadline:        g.PackLeakDeadline,
+		Tenancy:                 g.Tenancy,
+		Cluster:                 g.Cluster,
+		Gossip:                  g.Gossip,
+		Checkpoints:             g.Checkpoints,
+		Cache:                   g.Cache,
+		Admin:                   g.Admin,
+		ConfigWatch:             g.ConfigWatch,
+		HostMetadata:            g.HostMetadata,
+		HostInfo:                g.HostInfo,
+		Version:                 g.Version,
+		Pipeline:                name,
+		parent:                  g.root(),
+	}
+}
+
+// Returns the globals holding the shutdown state.
+func (g *GlobalConfigStruct) root() *GlobalConfigStruct {
+	if g.parent != nil {
+		return g.parent
+	}
+	return g
+}
+
+// KVCache returns the key/value cache shared by all of the process's
+// plugins, in every pipeline. It's loaded from BaseDir/kv_cache.json when
+// first used, if it's persisted.
+func (g *GlobalConfigStruct) KVCache() *KVCache {
+	root := g.root()
+	root.kvCacheLock.Lock()
+	defer root.kvCacheLock.Unlock()
+	if root.kvCache == nil {
+		var conf KVCacheConfig
+		if root.Cache != nil {
+			conf = *root.Cache
+		}
+		conf.Validate()
+		var path string
+		if conf.Persist {
+			path = filepath.Join(root.BaseDir, "kv_cache.json")
+		}
+		root.kvCache = NewKVCache(conf, path)
+		if err := root.kvCache.Load(); err != nil {
+			LogError.Printf("Can't load the KV cache: %s", err)
+		}
+	}
+	return root.kvCache
+}
+
+// Returns the key/value cache if it's been used, otherwise nil.
+func (g *GlobalConfigStruct) usedKVCache() *KVCache {
+	root := g.root()
+	root.kvCacheLock.Lock()
+	defer root.kvCacheLock.Unlock()
+	return root.kvCache
+}
+
+// Counters returns the counters and gauges shared by all of the process's
+// plugins, in every pipeline.
+func (g *GlobalConfigStruct) Counters() *Counters {
+	root := g.root()
+	root.countersLock.Lock()
+	defer root.countersLock.Unlock()
+	if root.counters == nil {
+		root.counters = NewCounters()
+	}
+	return root.counters
+}
+
+// Returns the counters if they've been used, otherwise nil.
+func (g *GlobalConfigStruct) usedCounters() *Counters {
+	root := g.root()
+	root.countersLock.Lock()
+	defer root.countersLock.Unlock()
+	return root.counters
+}
+
 func (g *GlobalConfigStruct) SigChan() chan os.Signal {
 	return g.sigChan
 }
@@ -91,6 +260,7 @@ func (g *GlobalConfigStruct) SigChan() chan os.Signal {
 // work so that the caller won't end up blocking part of the shutdown
 // sequence
 func (g *GlobalConfigStruct) ShutDown(exitCode int) {
+	g = g.root()
 	g.shutdownOnce.Do(func() {
 		g.exitCode = exitCode
 		go func() {
@@ -101,6 +271,7 @@ func (g *GlobalConfigStruct) ShutDown(exitCode int) {
 
 func (g *GlobalConfigStruct) IsShuttingDown() (stopping bool) {
 	// So simple, no need for overhead of defer
+	g = g.root()
 	g.stoppingMutex.RLock()
 	stopping = g.stopping
 	g.stoppingMutex.RUnlock()
@@ -108,6 +279,7 @@ func (g *GlobalConfigStruct) IsShuttingDown() (stopping bool) {
 }
 
 func (g *GlobalConfigStruct) stop() {
+	g = g.root()
 	g.stoppingMutex.Lock()
 	g.stopping = true
 	g.stoppingMutex.Unlock()
@@ -182,6 +354,13 @@ type PipelinePack struct {
 	BufferedPack bool
 	// Used to send delivery result error back to the buffered plugin.
 	DelivErrChan chan error
+	// Tenant this pack's in flight bytes are charged to, if any.
+	tenant      *tenantState
+	tenantBytes int
+	// Values passed between pipeline stages alongside the message, see
+	// SetMetadata.
+	metadata map[string]string
+	metaLock sync.RWMutex
 }
 
 // Returns a new PipelinePack pointer that will recycle itself onto the
@@ -208,8 +387,11 @@ func (p *PipelinePack) Zero() {
 	p.RefCount = 1
 	p.MsgLoopCount = 0
 	p.Signer = ""
-	p.diagnostics.Reset()
+	p.diagnostics.resetAll()
 	p.TrustMsgBytes = false
+	p.tenant = nil
+	p.tenantBytes = 0
+	p.clearMetadata()
 	if p.BufferedPack {
 		p.QueueCursor = ""
 	}
@@ -222,6 +404,9 @@ func (p *PipelinePack) Zero() {
 func (p *PipelinePack) recycle() {
 	cnt := atomic.AddInt32(&p.RefCount, -1)
 	if cnt == 0 {
+		if p.tenant != nil {
+			p.tenant.release(p.tenantBytes)
+		}
 		p.Zero()
 		p.RecycleChan <- p
 	}
@@ -262,20 +447,142 @@ func (p *PipelinePack) EncodeMsgBytes() error {
 // pools, and starts all the runners. Then it listens for signals and drives
 // the shutdown process when that is triggered.
 func Run(config *PipelineConfig) (exitCode int) {
+	return RunPipelines([]*PipelineConfig{config})
+}
+
+// RunPipelines is Run for several isolated pipelines in the one process, each
+// with its own router, pack pools and plugins. The pipelines' globals should
+// come from PipelineGlobals, so that they share signal handling and shutdown:
+// all of the pipelines run until hekad is told to stop or any one of them
+// triggers a shutdown.
+func RunPipelines(configs []*PipelineConfig) (exitCode int) {
 	LogInfo.Println("Starting hekad...")
 
-	var outputsWg sync.WaitGroup
-	var err error
+	var startFailed bool
+	for _, config := range configs {
+		if config.Globals.Pipeline != "" {
+			LogInfo.Printf("Starting pipeline '%s'", config.Globals.Pipeline)
+		}
+		if !config.start() {
+			startFailed = true
+		}
+	}
+	globals := configs[0].Globals
+
+	if globals.Admin != nil {
+		if admin, err := startAdmin(globals.Admin, configs); err != nil {
+			LogError.Printf("Can't start admin API: %s", err)
+		} else {
+			defer admin.stop()
+		}
+	}
+
+	// Everything's running, let systemd know if we're a notify service.
+	if !startFailed {
+		if _, err := sdNotify("READY=1"); err != nil {
+			LogError.Printf("Can't notify systemd of readiness: %s", err)
+		}
+	}
+	if interval := sdWatchdogInterval(); interval > 0 {
+		watchdogStop := make(chan struct{})
+		defer close(watchdogStop)
+		go sdWatchdog(configs, interval, watchdogStop)
+	}
+	if conf := globals.Cache; conf != nil && conf.Persist && conf.SaveInterval > 0 {
+		saveStop := make(chan struct{})
+		defer close(saveStop)
+		go globals.KVCache().saveEvery(time.Duration(conf.SaveInterval)*time.Second,
+			saveStop)
+	}
+	if globals.ConfigWatch != nil {
+		watchStop := make(chan struct{})
+		defer close(watchStop)
+		go watchConfig(globals.ConfigWatch, watchStop)
+	}
+
+	// wait for sigint
+	signal.Notify(globals.sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP,
+		SIGUSR1, SIGUSR2)
+
+	for !globals.IsShuttingDown() {
+		select {
+		case sig := <-globals.sigChan:
+			switch sig {
+			case syscall.SIGHUP:
+				LogInfo.Println("Reload initiated.")
+				if err := notify.Post(RELOAD, nil); err != nil {
+					LogError.Println("Error sending reload event: ", err)
+				}
+			case syscall.SIGINT, syscall.SIGTERM:
+				LogInfo.Println("Shutdown initiated.")
+				globals.stop()
+				sdNotify("STOPPING=1")
+			case SIGUSR1:
+				LogInfo.Println("Queue report initiated.")
+				for _, config := range configs {
+					go config.allReportsStdout()
+				}
+			case SIGUSR2:
+				LogInfo.Println("Sandbox abort initiated.")
+				go func() {
+					for _, config := range configs {
+						if sandboxAbort(config) {
+							break
+						}
+					}
+				}()
+			}
+		}
+	}
+
+	var stopWg sync.WaitGroup
+	for _, config := range configs {
+		stopWg.Add(1)
+		go func(config *PipelineConfig) {
+			config.stop()
+			stopWg.Done()
+		}(config)
+	}
+	stopWg.Wait()
 
+	if cache := globals.usedKVCache(); cache != nil {
+		if err := cache.Save(); err != nil {
+			LogError.Printf("Can't save the KV cache: %s", err)
+		}
+	}
+	LogInfo.Println("Shutdown complete.")
+	return globals.root().exitCode
+}
+
+// Starts the pipeline's plugins, router and pack pools, returning false if a
+// plugin that can't be stopped failed to start.
+func (config *PipelineConfig) start() bool {
+	var err error
+	startFailed := false
 	globals := config.Globals
 
+	// Outputs are linked to their shadows before any of them starts, so the
+	// shadows' goroutines see the links.
+	shadowErrs := make(map[string]error)
 	for name, output := range config.OutputRunners {
-		outputsWg.Add(1)
-		if err = output.Start(config, &outputsWg); err != nil {
+		if runner, ok := output.(*foRunner); ok && runner.config.Shadow != "" {
+			if err = runner.startShadow(); err != nil {
+				shadowErrs[name] = err
+			}
+		}
+	}
+
+	for name, output := range config.OutputRunners {
+		config.outputsWg.Add(1)
+		if err = shadowErrs[name]; err == nil {
+			err = output.Start(config, &config.outputsWg)
+		}
+		if err != nil {
 			LogError.Printf("Output '%s' failed to start: %s", name, err)
-			outputsWg.Done()
+			config.outputsWg.Done()
 			if !output.IsStoppable() {
 				globals.ShutDown(1)
+				startFailed = true
 			}
 			continue
 		}
@@ -289,6 +596,7 @@ func Run(config *PipelineConfig) (exitCode int) {
 			config.filtersWg.Done()
 			if !filter.IsStoppable() {
 				globals.ShutDown(1)
+				startFailed = true
 			}
 			continue
 		}
@@ -318,8 +626,23 @@ func Run(config *PipelineConfig) (exitCode int) {
 
 	go inputTracker.Run()
 	go injectTracker.Run()
+	config.starvation = newStarvationMonitor(config.inputRecycleChan, inputTracker,
+		globals)
+	config.diagnosticsStop = make(chan struct{})
+	go config.starvation.run(config.diagnosticsStop)
+	if globals.PackLeakDeadline > 0 {
+		LogInfo.Printf("Pack leak detection enabled, with a %s deadline.",
+			globals.PackLeakDeadline)
+		go newLeakDetector(globals, inputTracker, injectTracker).run(config.diagnosticsStop)
+	}
 	config.router.Start()
 
+	if globals.Gossip != nil {
+		if config.gossip, err = startGossip(config); err != nil {
+			LogError.Printf("Can't join gossip mesh: %s", err)
+		}
+	}
+
 	for name, input := range config.InputRunners {
 		config.inputsWg.Add(1)
 		if err = input.Start(config, &config.inputsWg); err != nil {
@@ -327,37 +650,19 @@ func Run(config *PipelineConfig) (exitCode int) {
 			config.inputsWg.Done()
 			if !input.IsStoppable() {
 				globals.ShutDown(1)
+				startFailed = true
 			}
 			continue
 		}
 		LogInfo.Println("Input started:", name)
 	}
+	return !startFailed
+}
 
-	// wait for sigint
-	signal.Notify(globals.sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP,
-		SIGUSR1, SIGUSR2)
-
-	for !globals.IsShuttingDown() {
-		select {
-		case sig := <-globals.sigChan:
-			switch sig {
-			case syscall.SIGHUP:
-				LogInfo.Println("Reload initiated.")
-				if err := notify.Post(RELOAD, nil); err != nil {
-					LogError.Println("Error sending reload event: ", err)
-				}
-			case syscall.SIGINT, syscall.SIGTERM:
-				LogInfo.Println("Shutdown initiated.")
-				globals.stop()
-			case SIGUSR1:
-				LogInfo.Println("Queue report initiated.")
-				go config.allReportsStdout()
-			case SIGUSR2:
-				LogInfo.Println("Sandbox abort initiated.")
-				go sandboxAbort(config)
-			}
-		}
-	}
+// Stops the pipeline's plugins in order, inputs first, draining it if so
+// configured.
+func (config *PipelineConfig) stop() {
+	globals := config.Globals
 
 	config.inputsLock.Lock()
 	for _, input := range config.InputRunners {
@@ -367,6 +672,20 @@ func Run(config *PipelineConfig) (exitCode int) {
 	config.inputsLock.Unlock()
 	config.inputsWg.Wait()
 
+	if globals.ShutdownDrainTimeout > 0 {
+		LogInfo.Printf("Draining pipeline for up to %s", globals.ShutdownDrainTimeout)
+		drainStart := time.Now()
+		if pending := config.drain(globals.ShutdownDrainTimeout); len(pending) == 0 {
+			LogInfo.Printf("Pipeline drained in %s", time.Since(drainStart))
+		} else {
+			LogError.Printf("Drain deadline of %s reached, undelivered:",
+				globals.ShutdownDrainTimeout)
+			for _, desc := range pending {
+				LogError.Printf("    %s", desc)
+			}
+		}
+	}
+
 	config.allDecodersLock.Lock()
 	LogInfo.Println("Waiting for decoders shutdown")
 	for _, decoder := range config.allDecoders {
@@ -395,7 +714,7 @@ func Run(config *PipelineConfig) (exitCode int) {
 		config.router.RemoveOutputMatcher() <- output.MatchRunner()
 		LogInfo.Printf("Stop message sent to output '%s'", output.Name())
 	}
-	outputsWg.Wait()
+	config.outputsWg.Wait()
 
 	for name, encoder := range config.allEncoders {
 		if stopper, ok := encoder.(NeedsStopping); ok {
@@ -403,12 +722,16 @@ func Run(config *PipelineConfig) (exitCode int) {
 			stopper.Stop()
 		}
 	}
+	config.stopProcessors()
 
-	LogInfo.Println("Shutdown complete.")
-	return globals.exitCode
+	if config.gossip != nil {
+		config.gossip.stop()
+	}
+	close(config.diagnosticsStop)
 }
 
-func sandboxAbort(config *PipelineConfig) {
+// Aborts sandboxes if the pipeline appears wedged, returning true if it did.
+func sandboxAbort(config *PipelineConfig) bool {
 	// This should only be run when the router isn't processing messages, so we
 	// try to inject a new message and exit if successful. Far from perfect,
 	// but protects in most cases.
@@ -441,7 +764,7 @@ func sandboxAbort(config *PipelineConfig) {
 	if !doSave {
 		msg := "Can't save sandboxes while router is processing messages, use regular shutdown."
 		LogError.Println(msg)
-		return
+		return false
 	}
 
 	// If we got this far the router is presumably wedged and we'll go ahead
@@ -452,4 +775,5 @@ func sandboxAbort(config *PipelineConfig) {
 	config.allReportsStdout()
 	config.Globals.ShutDown(1)
 	close(config.Globals.abortChan)
+	return true
 }
@@ -85,8 +85,40 @@ type Encoder interface {
 	Encode(pack *PipelinePack) (output []byte, err error)
 }
 
-// Can be implemented by Encoders to tell Heka that the Encoder needs to
-// perform some clean-up at shutdown time.
+// Can be implemented by Encoders that transform bytes, such as compressing
+// them, so they can follow another encoder in an output's encoder_chain.
+type WrapperEncoder interface {
+	// Transform the output of the previous encoder in the chain.
+	EncodeBytes(input []byte) (output []byte, err error)
+}
+
+// Can be implemented by Encoders to declare the media type of what they
+// produce, e.g. "application/json", so that it can be checked against the
+// types their outputs accept.
+type ContentTypeEncoder interface {
+	ContentType() string
+}
+
+// Can be implemented by Outputs that only work with some types of encoded
+// data, to list the media types they accept. Types may end in "/*", e.g.
+// "text/*".
+type ContentTypeAcceptor interface {
+	AcceptedContentTypes() []string
+}
+
+// Heka Processor plugin interface. Processors make simple changes to the
+// messages of the inputs listing them in their `processors` setting, in the
+// input's delivery path, so that they're applied without a filter and a
+// trip through the router.
+type Processor interface {
+	// Modify the pack's message in place. Returning false drops the message
+	// rather than routing it. An error is logged and the message passed on to
+	// the rest of the chain, unless it's also dropped.
+	Process(pack *PipelinePack) (keep bool, err error)
+}
+
+// Can be implemented by Encoders and Processors to tell Heka that the
+// plugin needs to perform some clean-up at shutdown time.
 type NeedsStopping interface {
 	Stop()
 }
@@ -89,7 +89,6 @@ func NewPluginMaker(name string, pConfig *PipelineConfig, tomlSection toml.Primi
 		return nil, fmt.Errorf("No registered plugin type: %s", maker.commonConfig.Typ)
 	}
 	maker.constructor = constructor
-	maker.plugin = maker.makePlugin() // Only used to generate config structs.
 
 	// Extract plugin category and any category-specific common (i.e. Heka
 	// defined) configuration.
@@ -98,6 +97,25 @@ func NewPluginMaker(name string, pConfig *PipelineConfig, tomlSection toml.Primi
 		return nil, errors.New("Unrecognized plugin category")
 	}
 
+	// Map any deprecated option names to their replacements.
+	if pConfig != nil {
+		var migrated bool
+		maker.tomlSection, migrated, err = pConfig.migrateOptions(name,
+			maker.commonConfig.Typ, maker.category, tomlSection)
+		if err != nil {
+			return nil, fmt.Errorf("can't migrate config for '%s': %s", name, err)
+		}
+		if migrated {
+			if err = toml.PrimitiveDecode(maker.tomlSection, &maker.commonConfig); err != nil {
+				return nil, fmt.Errorf("can't decode common config for '%s': %s", name, err)
+			}
+			if maker.commonConfig.Typ == "" {
+				maker.commonConfig.Typ = name
+			}
+		}
+	}
+	maker.plugin = maker.makePlugin() // Only used to generate config structs.
+
 	maker.prepCommonTypedConfig = maker.OrigPrepCommonTypedConfig
 	_, err = maker.prepCommonTypedConfig()
 	if err != nil {
@@ -132,6 +150,14 @@ func (m *pluginMaker) OrigPrepCommonTypedConfig() (interface{}, error) {
 		}
 		err = toml.PrimitiveDecode(m.tomlSection, &commonFO)
 		commonTypedConfig = commonFO
+	case "Decoder":
+		commonDecoder := CommonDecoderConfig{}
+		err = toml.PrimitiveDecode(m.tomlSection, &commonDecoder)
+		commonTypedConfig = commonDecoder
+	case "Processor":
+		commonProcessor := CommonProcessorConfig{}
+		err = toml.PrimitiveDecode(m.tomlSection, &commonProcessor)
+		commonTypedConfig = commonProcessor
 	case "Splitter":
 		commonSplitter := CommonSplitterConfig{}
 		err = toml.PrimitiveDecode(m.tomlSection, &commonSplitter)
@@ -319,6 +345,43 @@ func (m *pluginMaker) makeSplitterRunner(name string, config interface{}, splitt
 	return sr, nil
 }
 
+// Returns the decoder's message size limit, nil if it has none of its own,
+// or no config to have one in.
+func (m *pluginMaker) decoderSizeLimit() (*messageSizeLimit, error) {
+	if m.prepCommonTypedConfig == nil {
+		return nil, nil
+	}
+	commonConfig, err := m.prepCommonTypedConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Can't prep common typed config: %s", err.Error())
+	}
+	commonDecoder := commonConfig.(CommonDecoderConfig)
+	size, err := newMessageSizeLimit(commonDecoder.MaxMessageSize,
+		commonDecoder.OversizePolicy, commonDecoder.OversizeType)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' %s", m.name, err)
+	}
+	return size, nil
+}
+
+// Returns the processor's message matcher, or nil if it processes all
+// messages.
+func (m *pluginMaker) processorMatcher() (*message.MatcherSpecification, error) {
+	commonConfig, err := m.prepCommonTypedConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Can't prep common typed config: %s", err.Error())
+	}
+	commonProcessor := commonConfig.(CommonProcessorConfig)
+	if commonProcessor.Matcher == "" {
+		return nil, nil
+	}
+	matcher, err := message.CreateMatcherSpecification(commonProcessor.Matcher)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' invalid message_matcher: %s", m.name, err)
+	}
+	return matcher, nil
+}
+
 func (m *pluginMaker) makeInputRunner(name string, config interface{}, input Input,
 	defaultTick uint) (InputRunner, error) {
 
@@ -327,6 +390,9 @@ func (m *pluginMaker) makeInputRunner(name string, config interface{}, input Inp
 		return nil, fmt.Errorf("Can't prep common typed config: %s", err.Error())
 	}
 	commonInput := commonConfig.(CommonInputConfig)
+	if err = m.pConfig.applyNamedPipeline(&commonInput); err != nil {
+		return nil, fmt.Errorf("'%s' %s", m.name, err)
+	}
 	if commonInput.Ticker == 0 {
 		commonInput.Ticker = defaultTick
 	}
@@ -356,21 +422,49 @@ func (m *pluginMaker) makeInputRunner(name string, config interface{}, input Inp
 		decoder := getAttr(config, "Decoder", "")
 		commonInput.Decoder = decoder.(string)
 	}
+	commonInput.Decoder = withDefault(commonInput.Decoder, m.pConfig.Globals.DefaultDecoder)
 	if commonInput.Splitter == "" {
 		splitter := getAttr(config, "Splitter", "")
 		commonInput.Splitter = splitter.(string)
 	}
+	commonInput.Splitter = withDefault(commonInput.Splitter,
+		m.pConfig.Globals.DefaultSplitter)
 	runner := NewInputRunner(name, input, commonInput)
+	// A synchronous decoder's size limit takes the place of the input's.
+	if commonInput.Decoder != "" {
+		m.pConfig.makersLock.RLock()
+		dMaker, ok := m.pConfig.DecoderMakers[commonInput.Decoder].(*pluginMaker)
+		m.pConfig.makersLock.RUnlock()
+		if ok {
+			ir := runner.(*iRunner)
+			if ir.decoderSize, err = dMaker.decoderSizeLimit(); err != nil {
+				return nil, err
+			}
+		}
+	}
 	return runner, nil
 }
 
+// Returns the name of the decoder, splitter or encoder a plugin uses, given
+// the one it's configured with and the global default: the default if it has
+// none, and none if it's configured with "none".
+func withDefault(name, globalDefault string) string {
+	switch name {
+	case "":
+		return globalDefault
+	case "none":
+		return ""
+	}
+	return name
+}
+
 // MakeRunner returns a new, unstarted PluginRunner wrapped around a new,
 // configured plugin instance. If name is provided, then the Runner will be
 // given the specified name; if name is an empty string, the plugin name will
 // be used.
 // todo xx 这里才是runner初始化的地方
 func (m *pluginMaker) MakeRunner(name string) (PluginRunner, error) {
-	if m.category == "Encoder" {
+	if m.category == "Encoder" || m.category == "Processor" {
 		return nil, fmt.Errorf("%s plugins don't support PluginRunners", m.category)
 	}
 
@@ -387,6 +481,9 @@ func (m *pluginMaker) MakeRunner(name string) (PluginRunner, error) {
 
 	if m.category == "Decoder" {
 		runner = NewDecoderRunner(name, plugin.(Decoder), m.pConfig.Globals.PluginChanSize)
+		if runner.(*dRunner).size, err = m.decoderSizeLimit(); err != nil {
+			return nil, err
+		}
 		return runner, nil
 	}
 
@@ -458,9 +555,10 @@ func (m *pluginMaker) MakeRunner(name string) (PluginRunner, error) {
 				return nil, err
 			}
 		}
-		if commonFO.Encoder == "" {
+		if commonFO.Encoder == "" && len(commonFO.EncoderChain) == 0 {
 			encoder := getAttr(config, "Encoder", "")
-			commonFO.Encoder = encoder.(string)
+			commonFO.Encoder = withDefault(encoder.(string),
+				m.pConfig.Globals.DefaultEncoder)
 		}
 	}
 
@@ -0,0 +1,100 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"github.com/BurntSushi/toml"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func PluginMakerSpec(c gs.Context) {
+	RegisterPlugin("FooOutput", func() interface{} {
+		return new(FooOutput)
+	})
+	globals := DefaultGlobals()
+	globals.DefaultDecoder = "ProtobufDecoder"
+	globals.DefaultSplitter = "HekaFramingSplitter"
+	globals.DefaultEncoder = "ProtobufEncoder"
+	pConfig := NewPipelineConfig(globals)
+
+	makeRunner := func(name, section string) PluginRunner {
+		var configFile ConfigFile
+		_, err := toml.Decode(section, &configFile)
+		c.Assume(err, gs.IsNil)
+		maker, err := NewPluginMaker(name, pConfig, configFile[name])
+		c.Assume(err, gs.IsNil)
+		runner, err := maker.MakeRunner("")
+		c.Assume(err, gs.IsNil)
+		return runner
+	}
+
+	c.Specify("The global defaults", func() {
+		c.Specify("are used by inputs that don't set their own", func() {
+			ir := makeRunner("StatAccumInput", "[StatAccumInput]").(*iRunner)
+			c.Expect(ir.config.Decoder, gs.Equals, "ProtobufDecoder")
+			c.Expect(ir.config.Splitter, gs.Equals, "HekaFramingSplitter")
+		})
+
+		c.Specify("are overridden by the inputs' settings", func() {
+			ir := makeRunner("StatAccumInput", `[StatAccumInput]
+			decoder = "none"
+			splitter = "TokenSplitter"
+			`).(*iRunner)
+			c.Expect(ir.config.Decoder, gs.Equals, "")
+			c.Expect(ir.config.Splitter, gs.Equals, "TokenSplitter")
+		})
+
+		c.Specify("are used by outputs that don't set an encoder", func() {
+			or := makeRunner("FooOutput", `[FooOutput]
+			message_matcher = "TRUE"
+			`).(*foRunner)
+			c.Expect(or.config.Encoder, gs.Equals, "ProtobufEncoder")
+		})
+
+		c.Specify("aren't used by outputs with an encoder chain", func() {
+			or := makeRunner("FooOutput", `[FooOutput]
+			message_matcher = "TRUE"
+			encoder_chain = ["ProtobufEncoder", "GzipEncoder"]
+			`).(*foRunner)
+			c.Expect(or.config.Encoder, gs.Equals, "")
+		})
+	})
+
+	c.Specify("A decoder's message size limit", func() {
+		var configFile ConfigFile
+		_, err := toml.Decode(`[SizedDecoder]
+		type = "ProtobufDecoder"
+		max_message_size = 1000
+		`, &configFile)
+		c.Assume(err, gs.IsNil)
+		maker, err := NewPluginMaker("SizedDecoder", pConfig, configFile["SizedDecoder"])
+		c.Assume(err, gs.IsNil)
+		pConfig.DecoderMakers["SizedDecoder"] = maker
+
+		c.Specify("is worked out when its input's runner is made", func() {
+			ir := makeRunner("StatAccumInput", `[StatAccumInput]
+			decoder = "SizedDecoder"
+			`).(*iRunner)
+			c.Assume(ir.decoderSize, gs.Not(gs.IsNil))
+			c.Expect(ir.decoderSize.maxSize, gs.Equals, uint32(1000))
+		})
+
+		c.Specify("is no limit without a config", func() {
+			size, err := (&pluginMaker{name: "Bare"}).decoderSizeLimit()
+			c.Expect(err, gs.IsNil)
+			c.Expect(size, gs.IsNil)
+		})
+	})
+}
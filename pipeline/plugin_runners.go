@@ -67,6 +67,7 @@ type pRunnerBase struct {
 	h         PluginHelper
 	leakCount int
 	maker     PluginMaker
+	status    runnerStatus
 }
 
 func (pr *pRunnerBase) Name() string {
@@ -117,14 +118,26 @@ type DeliverFunc func(pack *PipelinePack)
 type Deliverer interface {
 	Deliver(pack *PipelinePack)
 	DeliverFunc() DeliverFunc
+	// SetPackDecorator registers a function that will be given each pack
+	// after decoding has completed, just before router injection.
+	SetPackDecorator(decorator func(*PipelinePack))
 	Done()
 }
 
+// Deliverers that need to account for every record, such as those
+// acknowledging records to their sender, can implement RecordDropper to be
+// told when a splitter drops a record rather than delivering it.
+type RecordDropper interface {
+	DropRecord()
+}
+
 type deliverer struct {
-	deliver DeliverFunc
-	dRunner DecoderRunner
-	decoder Decoder
-	pConfig *PipelineConfig
+	deliver    DeliverFunc
+	dRunner    DecoderRunner
+	decoder    Decoder
+	processors *processorChain
+	pConfig    *PipelineConfig
+	decorator  func(*PipelinePack)
 }
 
 func (d *deliverer) Deliver(pack *PipelinePack) {
@@ -135,6 +148,21 @@ func (d *deliverer) DeliverFunc() DeliverFunc {
 	return d.deliver
 }
 
+func (d *deliverer) SetPackDecorator(decorator func(*PipelinePack)) {
+	d.decorator = decorator
+	if dr, ok := d.dRunner.(*dRunner); ok {
+		dr.packDecorator = decorator
+	}
+}
+
+// decorate applies the registered pack decorator, if any.
+func (d *deliverer) decorate(pack *PipelinePack) {
+	if d.decorator != nil {
+		d.decorator(pack)
+		pack.TrustMsgBytes = false
+	}
+}
+
 func (d *deliverer) Done() {
 	if d.dRunner != nil {
 		d.pConfig.StopDecoderRunner(d.dRunner)
@@ -150,6 +178,7 @@ func (d *deliverer) Done() {
 		}
 		d.pConfig.allSyncDecodersLock.Unlock()
 	}
+	d.processors.release(d.pConfig)
 }
 
 // Heka PluginRunner for Input plugins.
@@ -214,6 +243,10 @@ type iRunner struct {
 	canExit            bool
 	shutdownWanters    []WantsDecoderRunnerShutdown
 	shutdownLock       sync.Mutex
+	skew               *clockSkew
+	size               *messageSizeLimit
+	// The decoder's own message size limit, nil if it has none.
+	decoderSize *messageSizeLimit
 }
 
 func (ir *iRunner) Ticker() (ticker <-chan time.Time) {
@@ -302,6 +335,40 @@ func (ir *iRunner) Start(h PluginHelper, wg *sync.WaitGroup) (err error) {
 			return fmt.Errorf("no registered '%s' decoder", ir.config.Decoder)
 		}
 	}
+
+	for _, name := range ir.config.Processors {
+		ir.pConfig.makersLock.RLock()
+		maker, ok := ir.pConfig.makers["Processor"][name]
+		ir.pConfig.makersLock.RUnlock()
+		if !ok {
+			return fmt.Errorf("%s specifies undefined processor %s", ir.name, name)
+		}
+		if pm, ok := maker.(*pluginMaker); ok {
+			if _, err = pm.processorMatcher(); err != nil {
+				return err
+			}
+		}
+	}
+
+	ir.size, err = newMessageSizeLimit(ir.config.MaxMessageSize,
+		ir.config.OversizePolicy, ir.config.OversizeType)
+	if err != nil {
+		return fmt.Errorf("%s %s", ir.name, err)
+	}
+
+	if ir.config.ClockSkew != nil {
+		if ir.skew, err = newClockSkew(ir.config.ClockSkew); err != nil {
+			return fmt.Errorf("%s %s", ir.name, err)
+		}
+	}
+
+	if ir.config.Singleton {
+		if ir.pConfig.elector == nil {
+			return fmt.Errorf("%s is a singleton but cluster coordination isn't configured",
+				ir.name)
+		}
+		ir.input = newSingletonInput(ir, ir.pConfig.elector)
+	}
 	go ir.Starter(h, wg)
 	return
 }
@@ -319,6 +386,8 @@ func (ir *iRunner) Starter(h PluginHelper, wg *sync.WaitGroup) {
 		return
 	}
 
+	ir.status.set(RunnerRunning, nil)
+	var lastErr error
 	for !globals.IsShuttingDown() {
 
 		// ir.Input().Run() shouldn't return unless error or shutdown.
@@ -337,6 +406,7 @@ func (ir *iRunner) Starter(h PluginHelper, wg *sync.WaitGroup) {
 		} else {
 			// Plugin exited by returning an error.
 			ir.LogError(err)
+			lastErr = err
 
 			// If we don't support restart, just stop here.
 			recon, ok := ir.plugin.(Restarting)
@@ -346,16 +416,13 @@ func (ir *iRunner) Starter(h PluginHelper, wg *sync.WaitGroup) {
 
 			// Otherwise we'll execute the Retry config.
 			recon.CleanupForRestart()
-			if ir.maker == nil {
-				ir.pConfig.makersLock.RLock()
-				ir.maker = ir.pConfig.makers["Input"][ir.name]
-				ir.pConfig.makersLock.RUnlock()
-			}
+			ir.status.set(RunnerRetrying, err)
 
 		initLoop:
 			if err = rh.Wait(); err != nil {
 				// We've used up our retry attempts, exit.
 				ir.LogError(err)
+				lastErr = err
 				break
 			}
 			if globals.IsShuttingDown() {
@@ -366,22 +433,24 @@ func (ir *iRunner) Starter(h PluginHelper, wg *sync.WaitGroup) {
 
 			// If we've not been created elsewhere, call the plugin's Init().
 			if !ir.transient {
-				var config interface{}
-				if config, err = ir.maker.PrepConfig(); err != nil {
-					// We couldn't reInit the plugin, do a mini-retry loop.
-					ir.LogError(err)
-					goto initLoop
-				}
-				if err = ir.plugin.Init(config); err != nil {
+				if err = ir.reinitPlugin(); err != nil {
 					// We couldn't reInit the plugin, do a mini-retry loop.
 					ir.LogError(err)
 					goto initLoop
 				}
 			}
-
+			ir.status.set(RunnerRunning, nil)
 		}
 	}
 
+	if ir.IsStoppable() && !globals.IsShuttingDown() {
+		if lastErr != nil {
+			ir.status.set(RunnerTerminated, lastErr)
+		} else {
+			ir.status.set(RunnerStopped, nil)
+		}
+		ir.pConfig.recordEnded("Input", ir)
+	}
 	ir.Unregister(ir.pConfig)
 
 	// If we're not a stoppable input, trigger Heka shutdown.
@@ -390,6 +459,24 @@ func (ir *iRunner) Starter(h PluginHelper, wg *sync.WaitGroup) {
 	}
 }
 
+// Calls the plugin's Init() again with a freshly prepared config, so it can be
+// run again after exiting.
+func (ir *iRunner) reinitPlugin() error {
+	if ir.transient {
+		return errors.New("transient inputs can't be reinitialized")
+	}
+	if ir.maker == nil {
+		ir.pConfig.makersLock.RLock()
+		ir.maker = ir.pConfig.makers["Input"][ir.name]
+		ir.pConfig.makersLock.RUnlock()
+	}
+	config, err := ir.maker.PrepConfig()
+	if err != nil {
+		return err
+	}
+	return ir.plugin.Init(config)
+}
+
 func (ir *iRunner) Unregister(pConfig *PipelineConfig) error {
 	// Send shutdown signal to any decoders that need it.
 	if len(ir.shutdownWanters) > 0 {
@@ -404,15 +491,99 @@ func (ir *iRunner) Unregister(pConfig *PipelineConfig) error {
 
 // todo xx 关联消息
 func (ir *iRunner) Inject(pack *PipelinePack) error {
+	return ir.inject(pack, ir.size)
+}
+
+// Injects the pack, checking it against the given message size limit, which
+// is either the input's or that of its decoder. Packs decoded asynchronously
+// are injected here too, so that every message the input produces gets its
+// tenant, host fields and clock skew check, and is subject to the tenant
+// quotas.
+func (ir *iRunner) inject(pack *PipelinePack, size *messageSizeLimit) error {
+	ir.stampTenant(pack)
+	ir.pConfig.hostFields.apply(pack)
+	if ir.pConfig.Globals.PackLeakDeadline > 0 {
+		pack.diagnostics.SetInjector(ir.name)
+	}
+	if ir.skew != nil {
+		ir.skew.apply(pack)
+	}
 	if err := pack.EncodeMsgBytes(); err != nil {
 		err = fmt.Errorf("encoding message: %s", err.Error())
 		ir.LogError(err)
 		pack.recycle()
 		return err
 	}
+	if size == nil {
+		return ir.route(pack)
+	}
+	var routeErr error
+	err := size.apply(pack, ir.newPack, func(p *PipelinePack) {
+		if e := ir.route(p); e != nil {
+			routeErr = e
+		}
+	})
+	if err != nil {
+		ir.LogError(err)
+		pack.recycle()
+		return err
+	}
+	return routeErr
+}
+
+func (ir *iRunner) route(pack *PipelinePack) error {
+	if tenants := ir.pConfig.tenants; tenants != nil && !tenants.Admit(pack) {
+		pack.recycle()
+		return ErrTenantQuota
+	}
 	return ir.pConfig.router.Inject(pack) // todo xx 发送消息 路由
 }
 
+// Fetches a pack from the input supply for a message chunk, nil if aborting.
+func (ir *iRunner) newPack() *PipelinePack {
+	select {
+	case pack := <-ir.pConfig.inputRecycleChan:
+		if ir.pConfig.Globals.PackLeakDeadline > 0 {
+			pack.diagnostics.SetBorrower(ir.name)
+		}
+		return pack
+	case <-ir.pConfig.Globals.abortChan:
+		return nil
+	}
+}
+
+// Sets the message's tenant field from the input's `tenant` and
+// `tenant_from_field` settings, replacing any tenant supplied by the client.
+// With tenancy enabled, an input with neither setting has no trusted tenant
+// source, so any tenant supplied by the client is removed instead.
+func (ir *iRunner) stampTenant(pack *PipelinePack) {
+	field := "Tenant"
+	if ir.pConfig.tenants != nil {
+		field = ir.pConfig.tenants.Field()
+	}
+	if ir.config.Tenant == "" && ir.config.TenantFromField == "" {
+		if ir.pConfig.tenants == nil || pack.Message.FindFirstField(field) == nil {
+			return
+		}
+	}
+	tenant := ir.config.Tenant
+	if ir.config.TenantFromField != "" {
+		if val, ok := pack.Message.GetFieldValue(ir.config.TenantFromField); ok {
+			if s, ok := val.(string); ok && s != "" {
+				tenant = s
+			}
+		}
+	}
+	msg := pack.Message
+	for f := msg.FindFirstField(field); f != nil; f = msg.FindFirstField(field) {
+		msg.DeleteField(f)
+	}
+	if tenant != "" {
+		message.NewStringField(msg, field, tenant)
+	}
+	pack.TrustMsgBytes = false
+}
+
 func (ir *iRunner) LogError(err error) {
 	LogError.Printf("Input '%s' error: %s", ir.name, err)
 }
@@ -421,15 +592,28 @@ func (ir *iRunner) LogMessage(msg string) {
 	LogInfo.Printf("Input '%s': %s", ir.name, msg)
 }
 
-func (ir *iRunner) getDeliverFunc(token string) (DeliverFunc, DecoderRunner, Decoder) {
+func (ir *iRunner) getDeliverFunc(token string, decorate func(*PipelinePack)) (
+	DeliverFunc, DecoderRunner, Decoder, *processorChain) {
+
 	var deliver DeliverFunc
+	if decorate == nil {
+		decorate = func(*PipelinePack) {}
+	}
+	processors, err := ir.newProcessorChain(token)
+	if err != nil {
+		ir.LogError(err)
+		return nil, nil, nil, nil
+	}
 	decoderName := ir.config.Decoder
 	// If no decoder is specified we just inject into the router.
 	if decoderName == "" {
 		deliver = func(pack *PipelinePack) {
-			ir.Inject(pack)
+			decorate(pack)
+			if processors.process(pack) {
+				ir.Inject(pack)
+			}
 		}
-		return deliver, nil, nil
+		return deliver, nil, nil, processors
 	}
 
 	ir.pConfig.makersLock.RLock()
@@ -437,7 +621,8 @@ func (ir *iRunner) getDeliverFunc(token string) (DeliverFunc, DecoderRunner, Dec
 	ir.pConfig.makersLock.RUnlock()
 	if !ok {
 		ir.LogError(fmt.Errorf("decoder '%s' not registered", decoderName))
-		return nil, nil, nil
+		processors.release(ir.pConfig)
+		return nil, nil, nil, nil
 	}
 
 	var fullName string
@@ -452,11 +637,22 @@ func (ir *iRunner) getDeliverFunc(token string) (DeliverFunc, DecoderRunner, Dec
 	if !ir.syncDecode {
 		dr, _ := ir.pConfig.DecoderRunner(decoderName, fullName)
 		dr.SetFailureHandling(ir.logDecodeFailures, ir.sendDecodeFailures)
+		if d, ok := dr.(*dRunner); ok {
+			// Decoded packs go through the same injection as those decoded
+			// synchronously, but skip Inject so the decoder's size limit
+			// applies.
+			d.inject = ir.inject
+			if d.size == nil {
+				d.size = ir.size
+			}
+			d.processors = processors
+		}
 		inChan := dr.InChan()
 		deliver = func(pack *PipelinePack) {
+			pack.diagnostics.Stamp(dr)
 			inChan <- pack
 		}
-		return deliver, dr, nil
+		return deliver, dr, nil, processors
 	}
 
 	// Synchronous decode means create a decoder instance and call Decode
@@ -474,16 +670,25 @@ func (ir *iRunner) getDeliverFunc(token string) (DeliverFunc, DecoderRunner, Dec
 		ir.shutdownLock.Unlock()
 	}
 
-	ir.pConfig.allSyncDecodersLock.Lock()
-	ir.pConfig.allSyncDecoders = append(ir.pConfig.allSyncDecoders, ReportingDecoder{
+	// The decoder's own size limit takes the place of the input's.
+	size := ir.size
+	if ir.decoderSize != nil {
+		size = ir.decoderSize
+	}
+
+	reporting := ReportingDecoder{
 		name:    fullName,
 		decoder: decoder,
-	})
+		panics:  new(int64),
+	}
+	ir.pConfig.allSyncDecodersLock.Lock()
+	ir.pConfig.allSyncDecoders = append(ir.pConfig.allSyncDecoders, reporting)
 	ir.pConfig.allSyncDecodersLock.Unlock()
 	// See if the decoder sets TrustMsgBytes for us.
 	_, trustMsgBytes := decoder.(EncodesMsgBytes)
 	deliver = func(pack *PipelinePack) {
-		packs, err := decoder.Decode(pack)
+		packs, err := safeDecode(decoder, pack, fullName, ir.pConfig.quarantine,
+			reporting.panics)
 		if err != nil {
 			errMsg := err.Error()
 			e := fmt.Errorf("decoding: %s", errMsg)
@@ -494,31 +699,31 @@ func (ir *iRunner) getDeliverFunc(token string) (DeliverFunc, DecoderRunner, Dec
 				pack.recycle()
 				return
 			}
-			if err = AddDecodeFailureFields(pack.Message, errMsg); err != nil {
+			if err = setDecodeFailure(pack, fullName, err); err != nil {
 				ir.LogError(err)
 			}
-			pack.TrustMsgBytes = false
-			ir.Inject(pack)
+			decorate(pack)
+			if processors.process(pack) {
+				ir.inject(pack, size)
+			}
 			return
 		}
 		for _, p := range packs {
 			if !trustMsgBytes {
 				p.TrustMsgBytes = false
 			}
-			ir.Inject(p)
+			decorate(p)
+			if processors.process(p) {
+				ir.inject(p, size)
+			}
 		}
 	}
-	return deliver, nil, decoder
+	return deliver, nil, decoder, processors
 }
 
 func (ir *iRunner) NewDeliverer(token string) Deliverer {
-	deliver, dRunner, decoder := ir.getDeliverFunc(token)
-	d := &deliverer{
-		deliver: deliver,
-		dRunner: dRunner,
-		decoder: decoder,
-		pConfig: ir.pConfig,
-	}
+	d := &deliverer{pConfig: ir.pConfig}
+	d.deliver, d.dRunner, d.decoder, d.processors = ir.getDeliverFunc(token, d.decorate)
 	return d
 }
 
@@ -528,7 +733,7 @@ func (ir *iRunner) Deliver(pack *PipelinePack) {
 		// first `getDeliverFunc` call has returned.
 		ir.delivererLock.Lock()
 		ir.delivererOnce.Do(func() {
-			ir.deliver, _, _ = ir.getDeliverFunc("")
+			ir.deliver, _, _, _ = ir.getDeliverFunc("", nil)
 		})
 		ir.delivererLock.Unlock()
 	}
@@ -555,6 +760,8 @@ func (ir *iRunner) NewSplitterRunner(token string) SplitterRunner {
 	srInterface, _ := maker.MakeRunner(name)
 	sr := srInterface.(*sRunner)
 	sr.ir = ir
+	sr.quarantine = ir.pConfig.quarantine
+	sr.trackBorrows = ir.pConfig.Globals.PackLeakDeadline > 0
 	ir.pConfig.allSplittersLock.Lock()
 	ir.pConfig.allSplitters = append(ir.pConfig.allSplitters, sr)
 	ir.pConfig.allSplittersLock.Unlock()
@@ -595,6 +802,18 @@ type dRunner struct {
 	sendFailure  bool
 	encodes      bool
 	globals      *GlobalConfigStruct
+	// Applied to each decoded pack before router injection.
+	packDecorator func(*PipelinePack)
+	// The inject of the input the decoder is running for, if any, through
+	// which decoded packs are stamped, checked and routed.
+	inject func(*PipelinePack, *messageSizeLimit) error
+	// The decoder's message size limit, or failing that the input's.
+	size       *messageSizeLimit
+	quarantine *Quarantine
+	// The input's processors, run on each decoded pack after the decorator.
+	processors *processorChain
+	// Number of times the decoder has panicked, accessed atomically.
+	panics int64
 }
 
 // Creates and returns a new (but not yet started) DecoderRunner for the
@@ -621,6 +840,7 @@ func (dr *dRunner) Start(h PluginHelper, wg *sync.WaitGroup) {
 	pConfig := h.PipelineConfig()
 	dr.router = pConfig.router
 	dr.globals = pConfig.Globals
+	dr.quarantine = pConfig.quarantine
 	if wanter, ok := dr.decoder.(WantsDecoderRunner); ok {
 		wanter.SetDecoderRunner(dr)
 	}
@@ -634,7 +854,8 @@ func (dr *dRunner) start(h PluginHelper, wg *sync.WaitGroup) {
 		err   error
 	)
 	for pack = range dr.inChan {
-		if packs, err = dr.decoder.Decode(pack); packs != nil {
+		packs, err = safeDecode(dr.decoder, pack, dr.name, dr.quarantine, &dr.panics)
+		if packs != nil {
 			for _, p := range packs {
 				dr.deliver(p)
 			}
@@ -644,10 +865,9 @@ func (dr *dRunner) start(h PluginHelper, wg *sync.WaitGroup) {
 					dr.LogError(err)
 				}
 				if dr.sendFailure {
-					if err = AddDecodeFailureFields(pack.Message, err.Error()); err != nil {
+					if err = setDecodeFailure(pack, dr.name, err); err != nil {
 						dr.LogError(err)
 					}
-					pack.TrustMsgBytes = false
 					dr.deliver(pack)
 					continue
 				}
@@ -664,7 +884,24 @@ func (dr *dRunner) start(h PluginHelper, wg *sync.WaitGroup) {
 }
 
 func (dr *dRunner) deliver(pack *PipelinePack) {
-	if !dr.encodes || !pack.TrustMsgBytes {
+	if dr.packDecorator != nil {
+		dr.packDecorator(pack)
+		pack.TrustMsgBytes = false
+	}
+	if !dr.processors.process(pack) {
+		return
+	}
+	if !dr.encodes {
+		pack.TrustMsgBytes = false
+	}
+	if dr.inject != nil {
+		dr.inject(pack, dr.size)
+		return
+	}
+	if dr.globals.PackLeakDeadline > 0 {
+		pack.diagnostics.SetInjector(dr.name)
+	}
+	if !pack.TrustMsgBytes {
 		err := pack.EncodeMsgBytes()
 		if err != nil {
 			err = fmt.Errorf("encoding message: %s", err.Error())
@@ -673,7 +910,17 @@ func (dr *dRunner) deliver(pack *PipelinePack) {
 			return
 		}
 	}
-	dr.router.Inject(pack)
+	if dr.size == nil {
+		dr.router.Inject(pack)
+		return
+	}
+	err := dr.size.apply(pack, dr.NewPack, func(p *PipelinePack) {
+		dr.router.Inject(p)
+	})
+	if err != nil {
+		dr.LogError(err)
+		pack.recycle()
+	}
 }
 
 func (dr *dRunner) InChan() chan *PipelinePack {
@@ -688,6 +935,9 @@ func (dr *dRunner) NewPack() *PipelinePack {
 	var pack *PipelinePack
 	select {
 	case pack = <-dr.h.PipelineConfig().inputRecycleChan:
+		if dr.globals.PackLeakDeadline > 0 {
+			pack.diagnostics.SetBorrower(dr.name)
+		}
 	case <-dr.globals.abortChan:
 	}
 	return pack // Might be nil if we're aborting.
@@ -859,6 +1109,18 @@ type foRunner struct {
 	lastErr      error
 	bufReader    *BufferReader
 	stopChan     chan bool
+	shadow       *ShadowTracker  // output only, compares with its shadow
+	shadowOf     *ShadowTracker  // output only, set if this is a shadow
+	breaker      *circuitBreaker // output only
+	latency      *latencyTracker // output only
+	injectLimit  *injectLimit
+	egressLimit  *egressLimit // output only
+	// Filter only, set if this is an additional instance of another filter,
+	// sharing its matcher.
+	instanceOf *foRunner
+	// Filter only, the inject chains of the packs it matched, to trace the
+	// packs it injects.
+	received *receivedChains
 }
 
 const pluginPoolSize = 2
@@ -910,6 +1172,20 @@ func NewFORunner(name string, plugin Plugin, config CommonFOConfig,
 		runner.capacity = int(config.Buffering.MaxBufferSize) * 90 / 100
 	}
 
+	if config.CircuitBreaker != nil {
+		if _, ok := plugin.(Output); !ok {
+			return nil, fmt.Errorf("'%s' can't have a circuit_breaker, only outputs can",
+				name)
+		}
+		if !runner.useBuffering {
+			return nil, fmt.Errorf("'%s' circuit_breaker requires use_buffering", name)
+		}
+		var err error
+		if runner.breaker, err = newCircuitBreaker(config.CircuitBreaker, runner); err != nil {
+			return nil, err
+		}
+	}
+
 	var matchChan chan *PipelinePack
 	if runner.useBuffering {
 		runner.inChan = make(chan *PipelinePack, pluginPoolSize)
@@ -933,15 +1209,47 @@ func NewFORunner(name string, plugin Plugin, config CommonFOConfig,
 		return nil, fmt.Errorf("Can't create message matcher for '%s': %s", name, err)
 	}
 	runner.matcher = matcher
+	if config.MaxMessageAge != "" {
+		if matcher.maxAge, err = time.ParseDuration(config.MaxMessageAge); err != nil {
+			return nil, fmt.Errorf("'%s' can't parse max_message_age: %s", name, err)
+		}
+		if matcher.maxAge <= 0 {
+			return nil, fmt.Errorf("'%s' max_message_age must be positive", name)
+		}
+	}
 
 	if config.CanExit != nil && *config.CanExit {
 		runner.canExit = true
 	}
 
+	runner.injectLimit = newInjectLimit("max_inject_rate of '"+name+"'",
+		config.MaxInjectRate)
+
+	if config.MaxEgressBytesPerSec != 0 || config.SharedEgressLimit {
+		_, isOutput := plugin.(Output)
+		if _, ok := plugin.(OldOutput); ok {
+			isOutput = true
+		}
+		if !isOutput {
+			return nil, fmt.Errorf("'%s' can't have an egress limit, only outputs can",
+				name)
+		}
+		runner.egressLimit = newEgressLimit(config)
+	} else if config.EgressBurstBytes != 0 {
+		return nil, fmt.Errorf("'%s' egress_burst_bytes requires max_egress_bytes_per_sec",
+			name)
+	}
+
 	if config.UseFraming != nil && *config.UseFraming {
 		runner.useFraming = true
 	}
 
+	switch config.FramingVersion {
+	case 0, 1, 2:
+	default:
+		return nil, fmt.Errorf("'%s' framing_version must be 1 or 2", name)
+	}
+
 	if _, ok := plugin.(OldFilter); ok {
 		runner.kind = foFilter
 	} else if _, ok := plugin.(OldOutput); ok {
@@ -955,6 +1263,56 @@ func NewFORunner(name string, plugin Plugin, config CommonFOConfig,
 			name)
 		return nil, err
 	}
+	if runner.kind == foFilter {
+		runner.received = newReceivedChains()
+		matcher.chains = runner.received
+	}
+
+	// Delivery latency is only known for outputs that don't run their own
+	// message loop.
+	if _, ok := plugin.(Output); ok {
+		var err error
+		if runner.latency, err = newLatencyTracker(config.LatencySlo, runner); err != nil {
+			return nil, fmt.Errorf("'%s' %s", name, err)
+		}
+	} else if config.LatencySlo != nil {
+		return nil, fmt.Errorf("'%s' can't have a latency_slo, only outputs can", name)
+	}
+
+	if len(config.EncoderChain) > 0 {
+		if runner.kind != foOutput {
+			return nil, fmt.Errorf("'%s' can't have an encoder_chain, only outputs can",
+				name)
+		}
+		if config.Encoder != "" {
+			return nil, fmt.Errorf("'%s' can't have both an encoder and an encoder_chain",
+				name)
+		}
+	}
+
+	if config.Instances > 1 {
+		if runner.kind != foFilter {
+			return nil, fmt.Errorf("'%s' can't have instances, only filters can", name)
+		}
+		if runner.useBuffering {
+			return nil, fmt.Errorf("'%s' can't use buffering with more than one instance",
+				name)
+		}
+	} else if config.ShardBy != "" {
+		return nil, fmt.Errorf("'%s' shard_by requires more than one instance", name)
+	}
+
+	if config.Shadow != "" {
+		if runner.kind != foOutput {
+			return nil, fmt.Errorf("'%s' can't have a shadow, only outputs can", name)
+		}
+		if runner.config.ShadowPercent == 0 {
+			runner.config.ShadowPercent = 100
+		}
+		if runner.config.ShadowPercent < 0 || runner.config.ShadowPercent > 100 {
+			return nil, fmt.Errorf("'%s' shadow_percent must be between 0 and 100", name)
+		}
+	}
 
 	return runner, nil
 }
@@ -1030,6 +1388,15 @@ func (foRunner *foRunner) Start(h PluginHelper, wg *sync.WaitGroup) (err error)
 				foRunner.config.Encoder)
 		}
 		foRunner.encoder = encoder
+	} else if len(foRunner.config.EncoderChain) > 0 {
+		if foRunner.encoder, err = foRunner.makeEncoderChain(); err != nil {
+			return err
+		}
+	}
+	if foRunner.kind == foOutput {
+		if err = foRunner.checkContentType(); err != nil {
+			return err
+		}
 	}
 
 	var bufFeeder *BufferFeeder
@@ -1043,7 +1410,7 @@ func (foRunner *foRunner) Start(h PluginHelper, wg *sync.WaitGroup) (err error)
 
 	foRunner.stopChan = make(chan bool)
 
-	if foRunner.matcher != nil {
+	if foRunner.matcher != nil && foRunner.instanceOf == nil {
 		foRunner.matcher.bufFeeder = bufFeeder
 		foRunner.matcher.globals = foRunner.pConfig.Globals
 		foRunner.matcher.stopChan = foRunner.stopChan
@@ -1127,6 +1494,9 @@ func (foRunner *foRunner) channelLoop(plugin MessageProcessor, h PluginHelper,
 			for !foRunner.pConfig.Globals.IsShuttingDown() {
 				err := plugin.ProcessMessage(pack)
 				if err == nil {
+					if foRunner.latency != nil {
+						foRunner.latency.observe(pack)
+					}
 					pack.recycle()
 					break RetryLoop // Bumps us back to the outer loop.
 				}
@@ -1172,7 +1542,7 @@ func (foRunner *foRunner) Starter(plugin MessageProcessor, h PluginHelper,
 	defer wg.Done()
 
 	globals := foRunner.pConfig.Globals
-	if foRunner.matcher != nil {
+	if foRunner.matcher != nil && foRunner.instanceOf == nil {
 		foRunner.matcher.Start(globals.SampleDenominator)
 	}
 
@@ -1223,6 +1593,7 @@ func (foRunner *foRunner) Starter(plugin MessageProcessor, h PluginHelper,
 
 		// Prepare returned an error. Log the error and try again.
 		foRunner.LogError(err)
+		foRunner.status.set(RunnerRetrying, err)
 		if globals.IsShuttingDown() {
 			foRunner.lastErr = err
 			return
@@ -1239,6 +1610,7 @@ func (foRunner *foRunner) Starter(plugin MessageProcessor, h PluginHelper,
 		}
 	}
 
+	foRunner.status.set(RunnerRunning, nil)
 	for !globals.IsShuttingDown() {
 		if foRunner.useBuffering {
 			err = foRunner.bufferLoop(plugin, h, tickReceiver)
@@ -1276,6 +1648,7 @@ func (foRunner *foRunner) Starter(plugin MessageProcessor, h PluginHelper,
 			break
 		}
 		recon.CleanupForRestart()
+		foRunner.status.set(RunnerRetrying, foRunner.lastErr)
 		if foRunner.maker == nil {
 			var makers map[string]PluginMaker
 			foRunner.pConfig.makersLock.RLock()
@@ -1322,6 +1695,7 @@ func (foRunner *foRunner) Starter(plugin MessageProcessor, h PluginHelper,
 			foRunner.LogError(err)
 			goto initLoop
 		}
+		foRunner.status.set(RunnerRunning, nil)
 	}
 }
 
@@ -1370,6 +1744,16 @@ func (foRunner *foRunner) exit() {
 	// If we're stoppable we unregister the plugin and, if necessary, send a
 	// termination message.
 	foRunner.LogMessage("has stopped, exiting plugin without shutting down.")
+	if foRunner.lastErr != nil {
+		foRunner.status.set(RunnerTerminated, foRunner.lastErr)
+	} else {
+		foRunner.status.set(RunnerStopped, nil)
+	}
+	category := "Filter"
+	if foRunner.kind == foOutput {
+		category = "Output"
+	}
+	foRunner.pConfig.recordEnded(category, foRunner)
 	foRunner.Unregister(foRunner.pConfig)
 
 	// A TerminatedError means the plugin was terminated, and has generated
@@ -1484,13 +1868,14 @@ func (foRunner *foRunner) OldStarter(helper PluginHelper, wg *sync.WaitGroup) {
 		return
 	}
 
-	if foRunner.matcher != nil {
+	if foRunner.matcher != nil && foRunner.instanceOf == nil {
 		foRunner.matcher.Start(globals.SampleDenominator)
 	}
 
 	// Handle the cleanup
 	defer foRunner.exit()
 
+	foRunner.status.set(RunnerRunning, nil)
 	for !globals.IsShuttingDown() {
 		if foRunner.useBuffering {
 			// Only returns if there's an error or we're shutting down.
@@ -1528,6 +1913,7 @@ func (foRunner *foRunner) OldStarter(helper PluginHelper, wg *sync.WaitGroup) {
 			break
 		}
 		recon.CleanupForRestart()
+		foRunner.status.set(RunnerRetrying, foRunner.lastErr)
 		if foRunner.maker == nil {
 			var makers map[string]PluginMaker
 			foRunner.pConfig.makersLock.RLock()
@@ -1561,6 +1947,7 @@ func (foRunner *foRunner) OldStarter(helper PluginHelper, wg *sync.WaitGroup) {
 			foRunner.LogError(err)
 			goto initLoop
 		}
+		foRunner.status.set(RunnerRunning, nil)
 	}
 }
 
@@ -1610,12 +1997,20 @@ func (foRunner *foRunner) Inject(pack *PipelinePack) bool {
 	}
 	// Make sure we're not creating an obvious infinite routing loop.
 	spec := foRunner.MatchRunner().MatcherSpecification()
-	match := spec.Match(pack.Message)
+	match := spec.MatchSigned(pack.Message, pack.Signer)
 	if match {
 		foRunner.LogError(errors.New("attempted to Inject a message to itself"))
 		pack.recycle()
 		return false
 	}
+	now := time.Now()
+	if !foRunner.injectLimit.allow(now, foRunner.LogError) ||
+		!foRunner.h.PipelineConfig().injectLimit.allow(now, foRunner.LogError) {
+
+		pack.recycle()
+		return false
+	}
+	foRunner.h.PipelineConfig().hostFields.apply(pack)
 	// Make sure the pack's MsgBytes is populated.
 	err := pack.EncodeMsgBytes()
 	if err != nil {
@@ -1623,6 +2018,12 @@ func (foRunner *foRunner) Inject(pack *PipelinePack) bool {
 		pack.recycle()
 		return false
 	}
+	if foRunner.h.PipelineConfig().Globals.PackLeakDeadline > 0 {
+		pack.diagnostics.SetInjector(foRunner.name)
+	}
+	if foRunner.received != nil {
+		foRunner.received.trace(pack, foRunner.name)
+	}
 	// Do the actual injection in a separate goroutine so we free up the
 	// caller; this prevents deadlocks when the caller's InChan is backed up,
 	// backing up the router, which would block us here.
@@ -1701,11 +2102,26 @@ func (foRunner *foRunner) Encode(pack *PipelinePack) (output []byte, err error)
 	if encoded, err = foRunner.encoder.Encode(pack); err != nil || encoded == nil {
 		return
 	}
-	if foRunner.useFraming {
+	if foRunner.shadow != nil {
+		foRunner.shadow.record(pack, encoded, false)
+	}
+	if foRunner.shadowOf != nil {
+		foRunner.shadowOf.record(pack, encoded, true)
+	}
+	if foRunner.useFraming && foRunner.config.FramingVersion == 2 {
+		client.CreateHekaStreamV2(encoded, &output, nil)
+	} else if foRunner.useFraming {
 		client.CreateHekaStream(encoded, &output, nil)
 	} else {
 		output = encoded
 	}
+	if foRunner.egressLimit != nil {
+		var global *byteBucket
+		if foRunner.h != nil {
+			global = foRunner.h.PipelineConfig().egressBucket
+		}
+		foRunner.egressLimit.wait(len(output), global, foRunner.stopChan)
+	}
 	return
 }
 
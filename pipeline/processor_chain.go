@@ -0,0 +1,197 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"heka/message"
+)
+
+// One of the processors of an input's processor chain, with its counters.
+type processorStage struct {
+	name      string
+	processor Processor
+	// Messages not matching this are passed on without being processed.
+	matcher *message.MatcherSpecification
+	// Accessed atomically.
+	processed int64
+	skipped   int64
+	dropped   int64
+	failures  int64
+	panics    int64
+}
+
+func (s *processorStage) reportMsg(msg *message.Message) {
+	message.NewInt64Field(msg, "ProcessMessageCount", atomic.LoadInt64(&s.processed),
+		"count")
+	message.NewInt64Field(msg, "SkipMessageCount", atomic.LoadInt64(&s.skipped), "count")
+	message.NewInt64Field(msg, "DropMessageCount", atomic.LoadInt64(&s.dropped), "count")
+	message.NewInt64Field(msg, "ProcessMessageFailures", atomic.LoadInt64(&s.failures),
+		"count")
+	message.NewInt64Field(msg, "PanicCount", atomic.LoadInt64(&s.panics), "count")
+}
+
+// Runs the messages of one of an input's deliverers through the processors
+// of the input's `processors` setting, in turn. A nil chain passes messages
+// through untouched.
+type processorChain struct {
+	stages     []*processorStage
+	quarantine *Quarantine
+	logError   func(error)
+}
+
+// Instantiates a Processor of the specified name, as a stage of a chain.
+func (self *PipelineConfig) makeProcessor(baseName, fullName string) (
+	*processorStage, error) {
+
+	self.makersLock.RLock()
+	maker, ok := self.makers["Processor"][baseName]
+	if !ok {
+		self.makersLock.RUnlock()
+		return nil, fmt.Errorf("no registered '%s' processor", baseName)
+	}
+	plugin, _, err := maker.Make()
+	self.makersLock.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("error creating processor '%s': %s", fullName, err)
+	}
+	stage := &processorStage{name: fullName}
+	if stage.processor, ok = plugin.(Processor); !ok {
+		return nil, fmt.Errorf("'%s' doesn't implement the Processor interface", baseName)
+	}
+	if pm, ok := maker.(*pluginMaker); ok {
+		if stage.matcher, err = pm.processorMatcher(); err != nil {
+			return nil, err
+		}
+	}
+	if wantsName, ok := stage.processor.(WantsName); ok {
+		wantsName.SetName(fullName)
+	}
+	return stage, nil
+}
+
+// Creates the processors of the input's chain for a deliverer, each named
+// after the input, its position in the chain and the deliverer's token, if
+// there is one. Returns nil if the input has no processors.
+func (ir *iRunner) newProcessorChain(token string) (*processorChain, error) {
+	if len(ir.config.Processors) == 0 {
+		return nil, nil
+	}
+	chain := &processorChain{
+		quarantine: ir.pConfig.quarantine,
+		logError:   ir.LogError,
+	}
+	for i, name := range ir.config.Processors {
+		fullName := fmt.Sprintf("%s-%d-%s", ir.name, i, name)
+		if token != "" {
+			fullName = fmt.Sprintf("%s-%s", fullName, token)
+		}
+		stage, err := ir.pConfig.makeProcessor(name, fullName)
+		if err != nil {
+			stopProcessors(chain.stages)
+			return nil, err
+		}
+		chain.stages = append(chain.stages, stage)
+	}
+	ir.pConfig.allProcessorsLock.Lock()
+	for _, stage := range chain.stages {
+		ir.pConfig.allProcessors[stage.name] = stage
+	}
+	ir.pConfig.allProcessorsLock.Unlock()
+	return chain, nil
+}
+
+// Runs the pack through the chain, returning false if one of the processors
+// dropped its message, in which case the pack has been recycled.
+func (c *processorChain) process(pack *PipelinePack) bool {
+	if c == nil {
+		return true
+	}
+	for _, stage := range c.stages {
+		if !c.run(stage, pack) {
+			pack.recycle()
+			return false
+		}
+	}
+	pack.TrustMsgBytes = false
+	return true
+}
+
+// Runs a single processor on the pack, if it matches the processor's
+// matcher. A processor that panics has the message quarantined and dropped.
+func (c *processorChain) run(stage *processorStage, pack *PipelinePack) (keep bool) {
+	if stage.matcher != nil && !stage.matcher.MatchSigned(pack.Message, pack.Signer) {
+		atomic.AddInt64(&stage.skipped, 1)
+		return true
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddInt64(&stage.panics, 1)
+			c.logError(c.quarantine.Recovered(stage.name, packRaw(pack), r))
+			keep = false
+		}
+	}()
+	atomic.AddInt64(&stage.processed, 1)
+	var err error
+	if keep, err = stage.processor.Process(pack); err != nil {
+		atomic.AddInt64(&stage.failures, 1)
+		c.logError(fmt.Errorf("processor '%s': %s", stage.name, err))
+	}
+	if !keep {
+		atomic.AddInt64(&stage.dropped, 1)
+	}
+	return keep
+}
+
+// Unregisters the chain's processors, stopping those that need it. Those
+// already unregistered have been stopped at shutdown.
+func (c *processorChain) release(pConfig *PipelineConfig) {
+	if c == nil {
+		return
+	}
+	var released []*processorStage
+	pConfig.allProcessorsLock.Lock()
+	for _, stage := range c.stages {
+		if pConfig.allProcessors[stage.name] == stage {
+			delete(pConfig.allProcessors, stage.name)
+			released = append(released, stage)
+		}
+	}
+	pConfig.allProcessorsLock.Unlock()
+	stopProcessors(released)
+}
+
+func stopProcessors(stages []*processorStage) {
+	for _, stage := range stages {
+		if stopper, ok := stage.processor.(NeedsStopping); ok {
+			stopper.Stop()
+		}
+	}
+}
+
+// Unregisters and stops the processors of all of the inputs' chains, at
+// shutdown.
+func (self *PipelineConfig) stopProcessors() {
+	self.allProcessorsLock.Lock()
+	stages := make([]*processorStage, 0, len(self.allProcessors))
+	for name, stage := range self.allProcessors {
+		stages = append(stages, stage)
+		delete(self.allProcessors, name)
+	}
+	self.allProcessorsLock.Unlock()
+	stopProcessors(stages)
+}
@@ -0,0 +1,236 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+type chainUpperProcessor struct {
+	stopped bool
+}
+
+func (p *chainUpperProcessor) Init(config interface{}) error {
+	return nil
+}
+
+func (p *chainUpperProcessor) Process(pack *PipelinePack) (bool, error) {
+	payload := pack.Message.GetPayload()
+	switch payload {
+	case "drop":
+		return false, nil
+	case "fail":
+		return true, errors.New("failed")
+	case "panic":
+		panic("boom")
+	}
+	pack.Message.SetPayload(strings.ToUpper(payload))
+	return true, nil
+}
+
+func (p *chainUpperProcessor) Stop() {
+	p.stopped = true
+}
+
+type chainSuffixProcessor struct{}
+
+func (p *chainSuffixProcessor) Init(config interface{}) error {
+	return nil
+}
+
+func (p *chainSuffixProcessor) Process(pack *PipelinePack) (bool, error) {
+	pack.Message.SetPayload(pack.Message.GetPayload() + "!")
+	return true, nil
+}
+
+func ProcessorChainSpec(c gs.Context) {
+	RegisterPlugin("ChainUpperProcessor", func() interface{} {
+		return new(chainUpperProcessor)
+	})
+	RegisterPlugin("ChainSuffixProcessor", func() interface{} {
+		return new(chainSuffixProcessor)
+	})
+	pConfig := NewPipelineConfig(nil)
+	c.Assume(pConfig.RegisterDefault("ChainUpperProcessor"), gs.IsNil)
+	c.Assume(pConfig.RegisterDefault("ChainSuffixProcessor"), gs.IsNil)
+	ir := &iRunner{
+		pRunnerBase: pRunnerBase{name: "in"},
+		pConfig:     pConfig,
+	}
+	ir.config.Processors = []string{"ChainUpperProcessor", "ChainSuffixProcessor"}
+	recycleChan := make(chan *PipelinePack, 1)
+	pack := NewPipelinePack(recycleChan)
+
+	c.Specify("A processor chain", func() {
+		chain, err := ir.newProcessorChain("conn")
+		c.Assume(err, gs.IsNil)
+		c.Expect(len(pConfig.allProcessors), gs.Equals, 2)
+		_, ok := pConfig.allProcessors["in-1-ChainSuffixProcessor-conn"]
+		c.Expect(ok, gs.IsTrue)
+
+		c.Specify("runs the processors in order", func() {
+			pack.Message.SetPayload("hi")
+			c.Expect(chain.process(pack), gs.IsTrue)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "HI!")
+			c.Expect(chain.stages[0].processed, gs.Equals, int64(1))
+		})
+
+		c.Specify("recycles dropped messages", func() {
+			pack.Message.SetPayload("drop")
+			c.Expect(chain.process(pack), gs.IsFalse)
+			c.Expect(len(recycleChan), gs.Equals, 1)
+			c.Expect(chain.stages[0].dropped, gs.Equals, int64(1))
+			c.Expect(chain.stages[1].processed, gs.Equals, int64(0))
+		})
+
+		c.Specify("carries on after an error", func() {
+			pack.Message.SetPayload("fail")
+			c.Expect(chain.process(pack), gs.IsTrue)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "fail!")
+			c.Expect(chain.stages[0].failures, gs.Equals, int64(1))
+		})
+
+		c.Specify("quarantines and drops messages a processor panics on", func() {
+			dir, err := ioutil.TempDir("", "processors")
+			c.Assume(err, gs.IsNil)
+			defer os.RemoveAll(dir)
+			chain.quarantine = NewQuarantine(dir, 64*1024)
+			pack.Message.SetPayload("panic")
+			c.Expect(chain.process(pack), gs.IsFalse)
+			c.Expect(chain.stages[0].panics, gs.Equals, int64(1))
+			raws, _ := filepath.Glob(filepath.Join(dir, "*.raw"))
+			c.Expect(len(raws), gs.Equals, 1)
+		})
+
+		c.Specify("stops and unregisters its processors when released", func() {
+			chain.release(pConfig)
+			c.Expect(len(pConfig.allProcessors), gs.Equals, 0)
+			c.Expect(chain.stages[0].processor.(*chainUpperProcessor).stopped, gs.IsTrue)
+		})
+	})
+
+	c.Specify("A guarded processor", func() {
+		guardedToml := `[guarded]
+		type = "ChainUpperProcessor"
+		message_matcher = "Type == 'shout'"
+		`
+		var configFile ConfigFile
+		_, err := toml.Decode(guardedToml, &configFile)
+		c.Assume(err, gs.IsNil)
+		maker, err := NewPluginMaker("guarded", pConfig, configFile["guarded"])
+		c.Assume(err, gs.IsNil)
+		pConfig.makers["Processor"]["guarded"] = maker
+		ir.config.Processors = []string{"guarded"}
+		chain, err := ir.newProcessorChain("")
+		c.Assume(err, gs.IsNil)
+
+		c.Specify("only processes matching messages", func() {
+			pack.Message.SetPayload("hi")
+			c.Expect(chain.process(pack), gs.IsTrue)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "hi")
+			c.Expect(chain.stages[0].skipped, gs.Equals, int64(1))
+			c.Expect(chain.stages[0].processed, gs.Equals, int64(0))
+
+			pack.Message.SetType("shout")
+			c.Expect(chain.process(pack), gs.IsTrue)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "HI")
+			c.Expect(chain.stages[0].processed, gs.Equals, int64(1))
+		})
+
+		c.Specify("can match on the verified signer", func() {
+			signedToml := "[signed]\ntype = \"ChainUpperProcessor\"\nmessage_matcher = \"Signer == 'ops'\"\n"
+			_, err = toml.Decode(signedToml, &configFile)
+			c.Assume(err, gs.IsNil)
+			maker, err = NewPluginMaker("signed", pConfig, configFile["signed"])
+			c.Assume(err, gs.IsNil)
+			pConfig.makers["Processor"]["signed"] = maker
+			ir.config.Processors = []string{"signed"}
+			chain, err = ir.newProcessorChain("")
+			c.Assume(err, gs.IsNil)
+
+			pack.Message.SetPayload("hi")
+			c.Expect(chain.process(pack), gs.IsTrue)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "hi")
+
+			pack.Signer = "ops"
+			c.Expect(chain.process(pack), gs.IsTrue)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "HI")
+		})
+
+		c.Specify("fails on a bad matcher", func() {
+			badToml := "[bad]\ntype = \"ChainUpperProcessor\"\nmessage_matcher = \"Type ==\"\n"
+			_, err = toml.Decode(badToml, &configFile)
+			c.Assume(err, gs.IsNil)
+			maker, err = NewPluginMaker("bad", pConfig, configFile["bad"])
+			c.Assume(err, gs.IsNil)
+			pConfig.makers["Processor"]["bad"] = maker
+			ir.config.Processors = []string{"bad"}
+			_, err = ir.newProcessorChain("")
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+
+	c.Specify("An input's processors", func() {
+		c.Specify("run before routing", func() {
+			deliver, _, _, chain := ir.getDeliverFunc("", nil)
+			c.Assume(chain, gs.Not(gs.IsNil))
+			pack.Message.SetPayload("hi")
+			deliver(pack)
+			routed := <-pConfig.router.InChan()
+			c.Expect(routed.Message.GetPayload(), gs.Equals, "HI!")
+			chain.release(pConfig)
+		})
+
+		c.Specify("are unregistered with their deliverer", func() {
+			d := ir.NewDeliverer("conn")
+			c.Expect(len(pConfig.allProcessors), gs.Equals, 2)
+			d.Done()
+			c.Expect(len(pConfig.allProcessors), gs.Equals, 0)
+		})
+
+		c.Specify("can come from a named pipeline", func() {
+			pConfig := NewPipelineConfig(nil)
+			err := pConfig.PreloadFromConfigFile(filepath.Join(".", "testsupport",
+				"config_test_named_pipelines.toml"))
+			c.Assume(err, gs.IsNil)
+			c.Assume(pConfig.LoadConfig(), gs.IsNil)
+			ir := pConfig.InputRunners["StatAccumInput"].(*iRunner)
+			c.Expect(ir.config.Decoder, gs.Equals, "ProtobufDecoder")
+			c.Expect(strings.Join(ir.config.Processors, ","), gs.Equals,
+				"upper,suffix,suffix")
+		})
+
+		c.Specify("can't come from an undefined pipeline", func() {
+			pConfig := NewPipelineConfig(nil)
+			err := pConfig.PreloadFromConfigFile(filepath.Join(".", "testsupport",
+				"config_bad_named_pipelines.toml"))
+			c.Assume(err, gs.IsNil)
+			c.Expect(pConfig.LoadConfig(), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("must be registered", func() {
+			ir.config.Processors = []string{"NoSuchProcessor"}
+			_, err := ir.newProcessorChain("")
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
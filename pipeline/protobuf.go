@@ -125,6 +125,10 @@ func (p *ProtobufEncoder) Init(config interface{}) error {
 	return nil
 }
 
+func (p *ProtobufEncoder) ContentType() string {
+	return "application/x-protobuf"
+}
+
 func (p *ProtobufEncoder) Encode(pack *PipelinePack) (output []byte, err error) {
 	atomic.AddInt64(&p.processMessageCount, 1)
 	var startTime time.Time
@@ -0,0 +1,156 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Size cap on the quarantine that hekad uses unless `max_quarantine_size` is
+// set, in bytes.
+const DefaultQuarantineMaxSize = 16 * 1024 * 1024
+
+var quarantineNameRe = regexp.MustCompile(`\W`)
+
+// Error returned in place of the results of a splitter or decoder that
+// panicked on a record. The record is skipped and the stream carries on.
+type RecordPanicError struct {
+	Plugin string
+	Value  interface{}
+	// Path of the file holding the record's raw bytes, empty if it wasn't
+	// quarantined.
+	Path string
+	// Why the record wasn't quarantined, if it wasn't.
+	Err error
+}
+
+func (e *RecordPanicError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("%s panicked on a record, quarantined to %s: %v", e.Plugin,
+			e.Path, e.Value)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s panicked on a record, not quarantined (%s): %v", e.Plugin,
+			e.Err, e.Value)
+	}
+	return fmt.Sprintf("%s panicked on a record: %v", e.Plugin, e.Value)
+}
+
+// Keeps the raw bytes of the records that splitters and decoders panicked
+// on in a directory, for offline analysis. Each record is written to a .raw
+// file along with a .txt file holding the panic and its stack trace. Once
+// the files reach the size cap further records aren't kept, so that a
+// producer sending nothing but malformed records can't fill the disk. A nil
+// Quarantine keeps nothing.
+type Quarantine struct {
+	dir     string
+	maxSize int64
+	lock    sync.Mutex
+	// Size of the files in dir, counted on the first write.
+	size   int64
+	loaded bool
+}
+
+// NewQuarantine returns a quarantine in dir holding at most maxSize bytes, or
+// nil if maxSize is 0. The directory is only created once a record is
+// quarantined.
+func NewQuarantine(dir string, maxSize uint64) *Quarantine {
+	if maxSize == 0 {
+		return nil
+	}
+	return &Quarantine{dir: dir, maxSize: int64(maxSize)}
+}
+
+// Recovered handles the value recovered from a panic of the named plugin
+// while it was handling raw, quarantining raw and returning the error to
+// report in place of the plugin's results. It must be called from the
+// deferred function that recovered, for the stack trace to show where the
+// panic happened.
+func (q *Quarantine) Recovered(plugin string, raw []byte, value interface{}) *RecordPanicError {
+	e := &RecordPanicError{Plugin: plugin, Value: value}
+	if q != nil {
+		e.Path, e.Err = q.add(plugin, raw, value, debug.Stack())
+	}
+	return e
+}
+
+func (q *Quarantine) add(plugin string, raw []byte, value interface{}, stack []byte) (
+	string, error) {
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if !q.loaded {
+		if err := os.MkdirAll(q.dir, 0700); err != nil {
+			return "", err
+		}
+		files, err := ioutil.ReadDir(q.dir)
+		if err != nil {
+			return "", err
+		}
+		for _, fi := range files {
+			q.size += fi.Size()
+		}
+		q.loaded = true
+	}
+	now := time.Now()
+	info := fmt.Sprintf("plugin: %s\ntime: %s\nsize: %d\npanic: %v\n\n%s", plugin,
+		now.UTC().Format(time.RFC3339Nano), len(raw), value, stack)
+	size := int64(len(raw) + len(info))
+	if q.size+size > q.maxSize {
+		return "", fmt.Errorf("quarantine is full, %d bytes", q.size)
+	}
+	base := filepath.Join(q.dir, fmt.Sprintf("%s-%d",
+		quarantineNameRe.ReplaceAllString(plugin, "_"), now.UnixNano()))
+	if err := ioutil.WriteFile(base+".raw", raw, 0600); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(base+".txt", []byte(info), 0600); err != nil {
+		os.Remove(base + ".raw")
+		return "", err
+	}
+	q.size += size
+	return base + ".raw", nil
+}
+
+// Returns the raw record a pack was made from, for quarantining.
+func packRaw(pack *PipelinePack) []byte {
+	if len(pack.MsgBytes) > 0 {
+		return append([]byte(nil), pack.MsgBytes...)
+	}
+	return []byte(pack.Message.GetPayload())
+}
+
+// Decodes the pack, turning a panic of the decoder into a decode error of
+// class "panic" once the pack's raw record has been quarantined.
+func safeDecode(decoder Decoder, pack *PipelinePack, name string, q *Quarantine,
+	panics *int64) (packs []*PipelinePack, err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddInt64(panics, 1)
+			packs = nil
+			err = NewDecodeError("panic", -1, q.Recovered(name, packRaw(pack), r))
+		}
+	}()
+	return decoder.Decode(pack)
+}
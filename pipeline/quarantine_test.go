@@ -0,0 +1,182 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	ts "heka/pipeline/testsupport"
+)
+
+// Splits lines, panicking on those containing "bad".
+type panickySplitter struct{}
+
+func (s *panickySplitter) Init(config interface{}) error {
+	return nil
+}
+
+func (s *panickySplitter) FindRecord(buf []byte) (int, []byte) {
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 {
+		return 0, nil
+	}
+	if bytes.Contains(buf[:i], []byte("bad")) {
+		var fields map[string]string
+		fields["line"] = string(buf[:i])
+	}
+	return i + 1, buf[:i+1]
+}
+
+type panickyDecoder struct{}
+
+func (d *panickyDecoder) Init(config interface{}) error {
+	return nil
+}
+
+func (d *panickyDecoder) Decode(pack *PipelinePack) ([]*PipelinePack, error) {
+	panic("can't decode " + pack.Message.GetPayload())
+}
+
+// Reads one chunk at a time.
+type chunkReader [][]byte
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(*r) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, (*r)[0])
+	*r = (*r)[1:]
+	return n, nil
+}
+
+func QuarantineSpec(c gs.Context) {
+	t := &ts.SimpleT{}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tmpDir, err := ioutil.TempDir("", "quarantine-tests")
+	c.Assume(err, gs.IsNil)
+	defer os.RemoveAll(tmpDir)
+	dir := filepath.Join(tmpDir, "quarantine")
+	files := func() []string {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*"))
+		return matches
+	}
+
+	c.Specify("A Quarantine", func() {
+		q := NewQuarantine(dir, 64*1024)
+
+		c.Specify("keeps the record and the panic", func() {
+			e := q.Recovered("TcpInput-TokenSplitter", []byte("bad record"), "oops")
+			c.Expect(e.Err, gs.IsNil)
+			c.Expect(strings.HasPrefix(filepath.Base(e.Path), "TcpInput_TokenSplitter-"),
+				gs.IsTrue)
+			raw, err := ioutil.ReadFile(e.Path)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(raw), gs.Equals, "bad record")
+			info, err := ioutil.ReadFile(strings.TrimSuffix(e.Path, ".raw") + ".txt")
+			c.Expect(err, gs.IsNil)
+			c.Expect(strings.Contains(string(info), "panic: oops"), gs.IsTrue)
+			c.Expect(len(files()), gs.Equals, 2)
+		})
+
+		c.Specify("stops keeping records at its size cap", func() {
+			big := bytes.Repeat([]byte("x"), 40*1024)
+			c.Expect(q.Recovered("a", big, "oops").Path, gs.Not(gs.Equals), "")
+			e := q.Recovered("a", big, "oops")
+			c.Expect(e.Path, gs.Equals, "")
+			c.Expect(e.Err, gs.Not(gs.IsNil))
+			c.Expect(len(files()), gs.Equals, 2)
+
+			c.Specify("counting the files already there", func() {
+				q = NewQuarantine(dir, 64*1024)
+				c.Expect(q.Recovered("a", big, "oops").Path, gs.Equals, "")
+			})
+		})
+
+		c.Specify("keeps nothing with no size", func() {
+			q = NewQuarantine(dir, 0)
+			e := q.Recovered("a", []byte("bad"), "oops")
+			c.Expect(e.Path, gs.Equals, "")
+			c.Expect(e.Err, gs.IsNil)
+			c.Expect(len(files()), gs.Equals, 0)
+		})
+	})
+
+	c.Specify("A SplitterRunner whose splitter panics", func() {
+		sr := NewSplitterRunner("TestSplitter", &panickySplitter{}, CommonSplitterConfig{})
+		sr.quarantine = NewQuarantine(dir, 64*1024)
+		ir := NewMockInputRunner(ctrl)
+		sr.SetInputRunner(ir)
+		packSupply := make(chan *PipelinePack, 1)
+		packSupply <- NewPipelinePack(packSupply)
+		ir.EXPECT().InChan().Return(packSupply).AnyTimes()
+		ir.EXPECT().Name().Return("TestInput").AnyTimes()
+		var payloads []string
+		del := NewMockDeliverer(ctrl)
+		delCall := del.EXPECT().Deliver(gomock.Any()).AnyTimes()
+		delCall.Do(func(pack *PipelinePack) {
+			payloads = append(payloads, pack.Message.GetPayload())
+			pack.Recycle(nil)
+		})
+
+		c.Specify("quarantines the data and carries on with the stream", func() {
+			reader := &chunkReader{[]byte("one\n"), []byte("bad\n"), []byte("two\n")}
+			err := sr.SplitStream(reader, del)
+			c.Expect(err, gs.Equals, io.EOF)
+			c.Expect(len(payloads), gs.Equals, 2)
+			c.Expect(payloads[0], gs.Equals, "one\n")
+			c.Expect(payloads[1], gs.Equals, "two\n")
+			c.Expect(sr.panics, gs.Equals, int64(1))
+			raw, _ := ioutil.ReadFile(files()[0])
+			c.Expect(string(raw), gs.Equals, "bad\n")
+		})
+
+		c.Specify("skips the rest of the bytes split", func() {
+			n, err := sr.SplitBytes([]byte("one\nbad\ntwo\n"), del)
+			c.Expect(err, gs.IsNil)
+			c.Expect(n, gs.Equals, 12)
+			c.Expect(len(payloads), gs.Equals, 1)
+			c.Expect(sr.panics, gs.Equals, int64(1))
+		})
+	})
+
+	c.Specify("A panicking decoder", func() {
+		pack := NewPipelinePack(nil)
+		pack.Message.SetPayload("bad payload")
+		var panics int64
+		q := NewQuarantine(dir, 64*1024)
+
+		c.Specify("fails to decode with a panic error", func() {
+			packs, err := safeDecode(&panickyDecoder{}, pack, "TestDecoder", q, &panics)
+			c.Expect(len(packs), gs.Equals, 0)
+			decodeErr, ok := err.(*DecodeError)
+			c.Assume(ok, gs.IsTrue)
+			c.Expect(decodeErr.Class, gs.Equals, "panic")
+			c.Expect(panics, gs.Equals, int64(1))
+			panicErr := decodeErr.Err.(*RecordPanicError)
+			c.Expect(panicErr.Value, gs.Equals, "can't decode bad payload")
+			raw, _ := ioutil.ReadFile(panicErr.Path)
+			c.Expect(string(raw), gs.Equals, "bad payload")
+		})
+	})
+}
@@ -25,6 +25,7 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -83,6 +84,28 @@ func NewBufferSet(queueDir, queueName string, config *QueueBufferConfig,
 	globals := pConfig.Globals
 	queueName = _wordre.ReplaceAllString(queueName, "_")
 	queue := globals.PrependBaseDir(filepath.Join(queueDir, queueName))
+	bf, br, err := newBufferSet(queue, runner.Name(), config, pConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	br.runner = runner
+	return bf, br, nil
+}
+
+// NewSpool returns the feeder and reader for a disk queue that isn't attached
+// to an output, such as an input's spool of received records. Records are
+// read with the reader's NextRecord, the reader's position is only persisted
+// once records have been passed to UpdateCursor, and both must be closed when
+// no longer needed.
+func NewSpool(queue, name string, config *QueueBufferConfig,
+	pConfig *PipelineConfig) (*BufferFeeder, *BufferReader, error) {
+
+	return newBufferSet(queue, name, config, pConfig)
+}
+
+func newBufferSet(queue, name string, config *QueueBufferConfig,
+	pConfig *PipelineConfig) (*BufferFeeder, *BufferReader, error) {
+
 	if !fileExists(queue) {
 		err := os.MkdirAll(queue, 0766)
 		if err != nil {
@@ -112,8 +135,9 @@ func NewBufferSet(queueDir, queueName string, config *QueueBufferConfig,
 		return nil, nil, fmt.Errorf("can't create BufferFeeder: %s", err)
 	}
 
-	br, err := NewBufferReader(queue, config, queueSize, runner, pConfig)
+	br, err := newBufferReader(queue, name, config, queueSize, pConfig)
 	if err != nil {
+		bf.Close()
 		return nil, nil, fmt.Errorf("can't create BufferReader: %s", err)
 	}
 
@@ -162,6 +186,16 @@ func NewBufferFeeder(queue string, config *QueueBufferConfig, queueSize *BufferS
 	return bf, nil
 }
 
+// Close closes the current queue file.
+func (bf *BufferFeeder) Close() error {
+	if bf.writeFile == nil {
+		return nil
+	}
+	err := bf.writeFile.Close()
+	bf.writeFile = nil
+	return err
+}
+
 func (bf *BufferFeeder) RollQueue() (err error) {
 	if bf.writeFile != nil {
 		bf.writeFile.Close()
@@ -231,6 +265,8 @@ type BufferReader struct {
 	checkpointFile     *os.File
 	queue              string
 	queueSize          *BufferSize
+	// Protects cursorId and cursorOffset so they can be read while draining.
+	cursorLock sync.Mutex
 }
 
 type BufferSender interface {
@@ -240,11 +276,21 @@ type BufferSender interface {
 func NewBufferReader(queue string, config *QueueBufferConfig, queueSize *BufferSize,
 	runner *foRunner, pConfig *PipelineConfig) (*BufferReader, error) {
 
+	br, err := newBufferReader(queue, runner.Name(), config, queueSize, pConfig)
+	if err != nil {
+		return nil, err
+	}
+	br.runner = runner
+	return br, nil
+}
+
+func newBufferReader(queue, name string, config *QueueBufferConfig,
+	queueSize *BufferSize, pConfig *PipelineConfig) (*BufferReader, error) {
+
 	br := &BufferReader{
 		queue:     queue,
 		config:    config,
 		queueSize: queueSize,
-		runner:    runner,
 	}
 
 	pConfig.makersLock.RLock()
@@ -254,7 +300,7 @@ func NewBufferReader(queue string, config *QueueBufferConfig, queueSize *BufferS
 		pConfig.makersLock.RUnlock()
 		return nil, errors.New("no registered `HekaFramingSplitter`.")
 	}
-	splitterName := fmt.Sprintf("%s-buffer-splitter", runner.Name())
+	splitterName := fmt.Sprintf("%s-buffer-splitter", name)
 	sRunner, err := maker.MakeRunner(splitterName)
 	pConfig.makersLock.RUnlock()
 	if err != nil {
@@ -343,6 +389,8 @@ func (br *BufferReader) getFileFromId(id uint) (file *os.File, foundId uint,
 }
 
 func (br *BufferReader) updateCursor(queueCursor string) error {
+	br.cursorLock.Lock()
+	defer br.cursorLock.Unlock()
 	id, offset, err := parseQueueCursor([]byte(queueCursor))
 	if err != nil {
 		return fmt.Errorf("can't parse queue cursor '%s': %s", queueCursor, err)
@@ -399,6 +447,52 @@ func (br *BufferReader) updateCursor(queueCursor string) error {
 	return nil
 }
 
+// UpdateCursor records that everything up to and including the record with
+// the given queue cursor has been handled.
+func (br *BufferReader) UpdateCursor(queueCursor string) error {
+	return br.updateCursor(queueCursor)
+}
+
+// Close writes out the current checkpoint and closes the queue files.
+func (br *BufferReader) Close() error {
+	err := br.writeCheckpoint(fmt.Sprintf("%d %d", br.cursorId, br.cursorOffset))
+	if br.checkpointFile != nil {
+		br.checkpointFile.Close()
+		br.checkpointFile = nil
+	}
+	if br.readFile != nil {
+		br.readFile.Close()
+		br.readFile = nil
+	}
+	return err
+}
+
+// UnackedBytes returns the number of bytes in the queue that haven't yet been
+// acknowledged via a cursor update.
+func (br *BufferReader) UnackedBytes() uint64 {
+	br.cursorLock.Lock()
+	id, offset := br.cursorId, br.cursorOffset
+	br.cursorLock.Unlock()
+
+	var size int64
+	if matches, err := filepath.Glob(filepath.Join(br.queue, "*.log")); err == nil {
+		for _, fn := range matches {
+			fileId, err := extractBufferId(fn)
+			if err != nil || fileId < id {
+				continue
+			}
+			if fileInfo, err := os.Stat(fn); err == nil {
+				size += fileInfo.Size()
+			}
+		}
+	}
+	size -= offset
+	if size < 0 {
+		return 0
+	}
+	return uint64(size)
+}
+
 func (br *BufferReader) writeCheckpoint(queueCursor string) error {
 	var err error
 	if br.checkpointFile == nil {
@@ -434,18 +528,9 @@ func (br *BufferReader) NewStreamOutput(sender MessageProcessor, packSupply chan
 	}
 
 	defer func() {
-		err := br.writeCheckpoint(fmt.Sprintf("%d %d", br.cursorId, br.cursorOffset))
-		if err != nil {
+		if err := br.Close(); err != nil {
 			br.runner.LogError(fmt.Errorf("can't write buffer checkpoint: %s", err))
 		}
-		if br.checkpointFile != nil {
-			br.checkpointFile.Close()
-			br.checkpointFile = nil
-		}
-		if br.readFile != nil {
-			br.readFile.Close()
-			br.readFile = nil
-		}
 	}()
 
 	rh, _ := NewRetryHelper(RetryOptions{
@@ -516,10 +601,41 @@ func (br *BufferReader) NewStreamOutput(sender MessageProcessor, packSupply chan
 			rh.Reset()
 			resetNeeded = false
 		}
+		if br.skipStale(pack) {
+			pack.recycle()
+			pack = nil
+			continue
+		}
 
 	sendLoop:
 		for {
+			if breaker := br.runner.breaker; breaker != nil {
+				if wait := breaker.wait(); wait > 0 {
+					// Open, so the record stays buffered until it's time
+					// to probe.
+					timer := time.NewTimer(wait)
+					select {
+					case <-stopChan:
+						timer.Stop()
+						atomic.AddInt64(&br.runner.dropMessageCount, 1)
+						pack.recycle()
+						return nil
+					case <-tickChan:
+						timer.Stop()
+						if e := br.runTimerEvent(tickerPlugin); e != nil {
+							atomic.AddInt64(&br.runner.dropMessageCount, 1)
+							pack.recycle()
+							return e
+						}
+					case <-timer.C:
+					}
+					continue
+				}
+			}
 			err = sender.ProcessMessage(pack)
+			if br.runner.breaker != nil {
+				br.runner.breaker.record(err == nil)
+			}
 			if err != nil {
 				switch err.(type) {
 				case PluginExitError:
@@ -536,6 +652,9 @@ func (br *BufferReader) NewStreamOutput(sender MessageProcessor, packSupply chan
 				}
 			} else {
 				atomic.AddInt64(&br.runner.processMessageCount, 1)
+				if br.runner.latency != nil {
+					br.runner.latency.observe(pack)
+				}
 				pack.recycle()
 				break sendLoop
 			}
@@ -569,18 +688,9 @@ func (br *BufferReader) StreamOutput(sender BufferSender,
 	packSupply chan *PipelinePack, stopChan chan bool) error {
 
 	defer func() {
-		err := br.writeCheckpoint(fmt.Sprintf("%d %d", br.cursorId, br.cursorOffset))
-		if err != nil {
+		if err := br.Close(); err != nil {
 			br.runner.LogError(fmt.Errorf("can't write buffer checkpoint: %s", err))
 		}
-		if br.checkpointFile != nil {
-			br.checkpointFile.Close()
-			br.checkpointFile = nil
-		}
-		if br.readFile != nil {
-			br.readFile.Close()
-			br.readFile = nil
-		}
 	}()
 
 	rh, _ := NewRetryHelper(RetryOptions{
@@ -643,6 +753,10 @@ func (br *BufferReader) StreamOutput(sender BufferSender,
 			rh.Reset()
 			resetNeeded = false
 		}
+		if br.skipStale(pack) {
+			// The pack is reused for the next record.
+			continue
+		}
 		for {
 			if err = sender.SendRecord(pack); err == nil {
 				if resetNeeded {
@@ -664,6 +778,16 @@ func (br *BufferReader) StreamOutput(sender BufferSender,
 	}
 }
 
+// Skips past the pack's buffered record if its message has grown older than
+// the plugin's max_message_age while it waited in the queue.
+func (br *BufferReader) skipStale(pack *PipelinePack) bool {
+	if br.runner.matcher == nil || !br.runner.matcher.stale(pack) {
+		return false
+	}
+	br.runner.UpdateCursor(pack.QueueCursor)
+	return true
+}
+
 func (br *BufferReader) NextRecord(pack *PipelinePack) error {
 	if br.readFile == nil {
 		err := br.initReadFile()
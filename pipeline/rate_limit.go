@@ -0,0 +1,275 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Token bucket allowing a sustained rate of events per second, with bursts
+// of up to one second's worth. A nil bucket allows everything.
+type tokenBucket struct {
+	rate       float64
+	lock       sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+}
+
+// Returns nil, i.e. no limit, for a zero rate.
+func newTokenBucket(perSec uint, now time.Time) *tokenBucket {
+	if perSec == 0 {
+		return nil
+	}
+	return &tokenBucket{
+		rate:       float64(perSec),
+		tokens:     float64(perSec),
+		lastRefill: now,
+	}
+}
+
+// Consumes a token if one is available.
+func (b *tokenBucket) take(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	// Concurrent callers can pass times slightly out of order.
+	if elapsed := now.Sub(b.lastRefill); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+		b.lastRefill = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RateLimit allows a sustained rate of events per second, with bursts of up
+// to one second's worth, for plugins limiting their own work. A nil limit
+// allows everything.
+type RateLimit struct {
+	bucket *tokenBucket
+}
+
+// Returns nil, i.e. no limit, for a zero rate.
+func NewRateLimit(perSec uint) *RateLimit {
+	if perSec == 0 {
+		return nil
+	}
+	return &RateLimit{bucket: newTokenBucket(perSec, time.Now())}
+}
+
+// Allow consumes one event's worth of the limit, returning false if there's
+// none left just now.
+func (l *RateLimit) Allow() bool {
+	return l == nil || l.bucket.take(time.Now())
+}
+
+// Limits the rate at which filters and outputs inject messages, from the
+// global max_inject_rate or a plugin's own. A nil limit allows everything.
+type injectLimit struct {
+	name   string
+	bucket *tokenBucket
+	// Accessed atomically.
+	drops int64
+}
+
+func newInjectLimit(name string, perSec uint) *injectLimit {
+	if perSec == 0 {
+		return nil
+	}
+	return &injectLimit{name: name, bucket: newTokenBucket(perSec, time.Now())}
+}
+
+// Tells if another message can be injected now. Refusals are counted, and
+// the first and every thousandth logged, so that a plugin injecting in a
+// tight loop doesn't flood the log as well.
+func (l *injectLimit) allow(now time.Time, logger func(error)) bool {
+	if l == nil || l.bucket.take(now) {
+		return true
+	}
+	if drops := atomic.AddInt64(&l.drops, 1); drops == 1 || drops%1000 == 0 {
+		logger(fmt.Errorf("%s exceeded, %d injected messages dropped so far",
+			l.name, drops))
+	}
+	return false
+}
+
+func (l *injectLimit) count() int64 {
+	if l == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&l.drops)
+}
+
+// Token bucket of bytes, shaping the bandwidth outputs use. Sends bigger
+// than the burst run the bucket into debt rather than being refused, so that
+// the sustained rate holds whatever the record sizes. A nil bucket allows
+// everything.
+type byteBucket struct {
+	rate       float64
+	burst      float64
+	lock       sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+}
+
+// Returns nil, i.e. no limit, for a zero rate. The burst defaults to one
+// second's worth.
+func newByteBucket(perSec, burst uint64, now time.Time) *byteBucket {
+	if perSec == 0 {
+		return nil
+	}
+	if burst == 0 {
+		burst = perSec
+	}
+	return &byteBucket{
+		rate:       float64(perSec),
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		lastRefill: now,
+	}
+}
+
+// Takes the tokens for n bytes, returning how long to wait before sending
+// them.
+func (b *byteBucket) reserve(n int, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if elapsed := now.Sub(b.lastRefill); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.lastRefill = now
+	}
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Limits the bytes per second an output sends, from its own
+// max_egress_bytes_per_sec and, if it shares the global limit, hekad's. A nil
+// limit allows everything.
+type egressLimit struct {
+	own    *byteBucket
+	shared bool
+	// Nanoseconds spent waiting, accessed atomically.
+	throttled int64
+}
+
+func newEgressLimit(config CommonFOConfig) *egressLimit {
+	if config.MaxEgressBytesPerSec == 0 && !config.SharedEgressLimit {
+		return nil
+	}
+	return &egressLimit{
+		own: newByteBucket(config.MaxEgressBytesPerSec, config.EgressBurstBytes,
+			time.Now()),
+		shared: config.SharedEgressLimit,
+	}
+}
+
+// Waits until n more bytes can be sent, or stop is closed.
+func (l *egressLimit) wait(n int, global *byteBucket, stop <-chan bool) {
+	if l == nil {
+		return
+	}
+	now := time.Now()
+	delay := l.own.reserve(n, now)
+	if l.shared {
+		if d := global.reserve(n, now); d > delay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return
+	}
+	atomic.AddInt64(&l.throttled, int64(delay))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-stop:
+	}
+}
+
+// Milliseconds spent waiting so far.
+func (l *egressLimit) throttledMs() int64 {
+	if l == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&l.throttled) / int64(time.Millisecond)
+}
+
+// Limits the bytes per second a plugin reads or sends, for plugins shaping
+// their own traffic. A nil limiter allows everything.
+type ByteRateLimiter struct {
+	bucket *byteBucket
+}
+
+// NewByteRateLimiter returns nil, i.e. no limit, for a zero rate. The burst
+// is one second's worth.
+func NewByteRateLimiter(perSec uint64) *ByteRateLimiter {
+	if perSec == 0 {
+		return nil
+	}
+	return &ByteRateLimiter{bucket: newByteBucket(perSec, 0, time.Now())}
+}
+
+// Reserve takes the tokens for n bytes, returning how long to wait before
+// using them.
+func (l *ByteRateLimiter) Reserve(n int) time.Duration {
+	if l == nil {
+		return 0
+	}
+	return l.bucket.reserve(n, time.Now())
+}
+
+// Limits events, such as a client's messages, to a sustained rate per
+// second, with bursts of up to one second's worth. A nil limiter allows
+// everything.
+type MessageRateLimiter struct {
+	bucket *tokenBucket
+}
+
+// NewMessageRateLimiter returns nil, i.e. no limit, for a zero rate.
+func NewMessageRateLimiter(perSec uint) *MessageRateLimiter {
+	if perSec == 0 {
+		return nil
+	}
+	return &MessageRateLimiter{bucket: newTokenBucket(perSec, time.Now())}
+}
+
+// Allow consumes the allowance for one event, returning false if there's
+// none left for now.
+func (l *MessageRateLimiter) Allow() bool {
+	if l == nil {
+		return true
+	}
+	return l.bucket.take(time.Now())
+}
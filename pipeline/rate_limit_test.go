@@ -0,0 +1,137 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func RateLimitSpec(c gs.Context) {
+	now := time.Now()
+
+	c.Specify("A token bucket", func() {
+		bucket := newTokenBucket(10, now)
+
+		c.Specify("allows a second's worth of burst", func() {
+			for i := 0; i < 10; i++ {
+				c.Expect(bucket.take(now), gs.IsTrue)
+			}
+			c.Expect(bucket.take(now), gs.IsFalse)
+		})
+
+		c.Specify("refills at its rate", func() {
+			for bucket.take(now) {
+			}
+			now = now.Add(250 * time.Millisecond)
+			for i := 0; i < 2; i++ {
+				c.Expect(bucket.take(now), gs.IsTrue)
+			}
+			c.Expect(bucket.take(now), gs.IsFalse)
+			// Idle time doesn't build up more than the burst.
+			now = now.Add(time.Hour)
+			for i := 0; i < 10; i++ {
+				c.Expect(bucket.take(now), gs.IsTrue)
+			}
+			c.Expect(bucket.take(now), gs.IsFalse)
+		})
+
+		c.Specify("is unlimited with no rate", func() {
+			c.Expect(newTokenBucket(0, now), gs.IsNil)
+			var none *tokenBucket
+			c.Expect(none.take(now), gs.IsTrue)
+		})
+	})
+
+	c.Specify("An inject limit", func() {
+		limit := newInjectLimit("max_inject_rate", 2)
+		var logged []error
+		logger := func(err error) { logged = append(logged, err) }
+
+		c.Specify("counts and logs what it refuses", func() {
+			for i := 0; i < 2000; i++ {
+				limit.allow(now, logger)
+			}
+			c.Expect(limit.count(), gs.Equals, int64(1998))
+			c.Expect(len(logged), gs.Equals, 2)
+		})
+
+		c.Specify("is unlimited with no rate", func() {
+			limit = newInjectLimit("max_inject_rate", 0)
+			for i := 0; i < 100; i++ {
+				c.Expect(limit.allow(now, logger), gs.IsTrue)
+			}
+			c.Expect(limit.count(), gs.Equals, int64(0))
+		})
+	})
+
+	c.Specify("A byte bucket", func() {
+		bucket := newByteBucket(1000, 2000, now)
+
+		c.Specify("allows its burst without waiting", func() {
+			c.Expect(bucket.reserve(1500, now), gs.Equals, time.Duration(0))
+			c.Expect(bucket.reserve(500, now), gs.Equals, time.Duration(0))
+			c.Expect(bucket.reserve(250, now), gs.Equals, 250*time.Millisecond)
+		})
+
+		c.Specify("goes into debt for sends bigger than the burst", func() {
+			c.Expect(bucket.reserve(5000, now), gs.Equals, 3*time.Second)
+			now = now.Add(3 * time.Second)
+			c.Expect(bucket.reserve(100, now), gs.Equals, 100*time.Millisecond)
+		})
+
+		c.Specify("defaults its burst to a second's worth", func() {
+			bucket = newByteBucket(1000, 0, now)
+			now = now.Add(time.Hour)
+			c.Expect(bucket.reserve(1000, now), gs.Equals, time.Duration(0))
+			c.Expect(bucket.reserve(10, now), gs.Equals, 10*time.Millisecond)
+		})
+
+		c.Specify("is unlimited with no rate", func() {
+			c.Expect(newByteBucket(0, 0, now) == nil, gs.IsTrue)
+			var none *byteBucket
+			c.Expect(none.reserve(1<<30, now), gs.Equals, time.Duration(0))
+		})
+	})
+
+	c.Specify("An egress limit", func() {
+		c.Specify("waits for the slower of its own and the global bucket", func() {
+			limit := newEgressLimit(CommonFOConfig{MaxEgressBytesPerSec: 1 << 20,
+				SharedEgressLimit: true})
+			global := newByteBucket(1000, 100, time.Now())
+			start := time.Now()
+			limit.wait(100, global, nil)
+			c.Expect(time.Since(start) < 20*time.Millisecond, gs.IsTrue)
+			limit.wait(50, global, nil)
+			c.Expect(time.Since(start) >= 40*time.Millisecond, gs.IsTrue)
+			c.Expect(limit.throttledMs() >= 40, gs.IsTrue)
+		})
+
+		c.Specify("stops waiting when stopped", func() {
+			limit := newEgressLimit(CommonFOConfig{MaxEgressBytesPerSec: 1,
+				EgressBurstBytes: 1})
+			stop := make(chan bool)
+			close(stop)
+			start := time.Now()
+			limit.wait(3600, nil, stop)
+			c.Expect(time.Since(start) < time.Second, gs.IsTrue)
+		})
+
+		c.Specify("is nil without limits", func() {
+			c.Expect(newEgressLimit(CommonFOConfig{}) == nil, gs.IsTrue)
+		})
+	})
+}
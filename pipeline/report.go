@@ -40,6 +40,8 @@ type ReportingPlugin interface {
 type ReportingDecoder struct {
 	name    string
 	decoder Decoder
+	// Number of times the decoder has panicked, accessed atomically.
+	panics *int64
 }
 
 // Given a PluginRunner and a Message struct, this function will populate the
@@ -70,6 +72,9 @@ func PopulateReportMsg(pr PluginRunner, msg *message.Message) (err error) {
 		message.NewIntField(msg, "InChanCapacity", cap(dRunner.InChan()), "count")
 		message.NewIntField(msg, "InChanLength", len(dRunner.InChan()), "count")
 	}
+	if fo, ok := pr.(*foRunner); ok && fo.matcher != nil && fo.matcher.maxAge > 0 {
+		message.NewInt64Field(msg, "StaleDropCount", fo.matcher.StaleCount(), "count")
+	}
 	msg.SetType("heka.plugin-report")
 	return
 }
@@ -88,6 +93,14 @@ func (pc *PipelineConfig) reports(reportChan chan *PipelinePack) {
 	msg = pack.Message
 	message.NewIntField(msg, "InChanCapacity", cap(pc.inputRecycleChan), "count")
 	message.NewIntField(msg, "InChanLength", len(pc.inputRecycleChan), "count")
+	if pc.starvation != nil {
+		message.NewInt64Field(msg, "StarvationCount",
+			atomic.LoadInt64(&pc.starvation.count), "count")
+		message.NewInt64Field(msg, "StarvedDuration",
+			atomic.LoadInt64(&pc.starvation.starved), "ns")
+		message.NewStringField(msg, "PackHolders",
+			formatPackHolders(pc.starvation.holders()))
+	}
 	msg.SetLogger(HEKA_DAEMON)
 	msg.SetType("heka.input-report")
 	message.NewStringField(msg, "name", "inputRecycleChan")
@@ -116,6 +129,49 @@ func (pc *PipelineConfig) reports(reportChan chan *PipelinePack) {
 	message.NewStringField(msg, "key", "globals")
 	reportChan <- pack
 
+	if warnings := pc.ConfigWarnings(); len(warnings) > 0 {
+		pack = <-pc.reportRecycleChan
+		msg = pack.Message
+		message.NewIntField(msg, "WarningCount", len(warnings), "count")
+		if f, e = message.NewField("Warnings", warnings[0].Message, ""); e == nil {
+			for _, w := range warnings[1:] {
+				f.AddValue(w.Message)
+			}
+			msg.AddField(f)
+		}
+		msg.SetLogger(HEKA_DAEMON)
+		msg.SetType("heka.config-warning-report")
+		message.NewStringField(msg, "name", "ConfigWarnings")
+		message.NewStringField(msg, "key", "globals")
+		reportChan <- pack
+	}
+
+	if pc.tenants != nil {
+		pc.tenants.reports(pc.reportRecycleChan, reportChan)
+	}
+
+	if cache := pc.Globals.usedKVCache(); cache != nil {
+		pack = <-pc.reportRecycleChan
+		msg = pack.Message
+		cache.ReportMsg(msg)
+		msg.SetLogger(HEKA_DAEMON)
+		msg.SetType("heka.kv-cache-report")
+		message.NewStringField(msg, "name", "KVCache")
+		message.NewStringField(msg, "key", "globals")
+		reportChan <- pack
+	}
+
+	if counters := pc.Globals.usedCounters(); counters != nil {
+		pack = <-pc.reportRecycleChan
+		msg = pack.Message
+		counters.ReportMsg(msg)
+		msg.SetLogger(HEKA_DAEMON)
+		msg.SetType("heka.counters-report")
+		message.NewStringField(msg, "name", "Counters")
+		message.NewStringField(msg, "key", "globals")
+		reportChan <- pack
+	}
+
 	getReport := func(runner PluginRunner) (pack *PipelinePack) {
 		pack = <-pc.reportRecycleChan
 		if err = PopulateReportMsg(runner, pack.Message); err != nil {
@@ -141,6 +197,12 @@ func (pc *PipelineConfig) reports(reportChan chan *PipelinePack) {
 		if runner.SynchronousDecode() {
 			message.NewStringField(pack.Message, "SynchronousDecode", "true")
 		}
+		if ir, ok := runner.(*iRunner); ok && ir.skew != nil {
+			message.NewInt64Field(pack.Message, "SkewedCount", ir.skew.count(), "count")
+		}
+		if ir, ok := runner.(*iRunner); ok && ir.size != nil {
+			message.NewInt64Field(pack.Message, "OversizeCount", ir.size.count(), "count")
+		}
 		reportChan <- pack
 	}
 	pc.inputsLock.Unlock()
@@ -149,6 +211,13 @@ func (pc *PipelineConfig) reports(reportChan chan *PipelinePack) {
 		pack = getReport(runner)
 		message.NewStringField(pack.Message, "name", runner.Name())
 		message.NewStringField(pack.Message, "key", "decoders")
+		if dr, ok := runner.(*dRunner); ok {
+			if dr.size != nil {
+				message.NewInt64Field(pack.Message, "OversizeCount", dr.size.count(), "count")
+			}
+			message.NewInt64Field(pack.Message, "PanicCount", atomic.LoadInt64(&dr.panics),
+				"count")
+		}
 		reportChan <- pack
 	}
 
@@ -158,6 +227,10 @@ func (pc *PipelineConfig) reports(reportChan chan *PipelinePack) {
 		message.NewStringField(pack.Message, "key", "decoders")
 		pack.Message.SetLogger(HEKA_DAEMON)
 		pack.Message.SetType("heka.plugin-report")
+		if reportingDecoder.panics != nil {
+			message.NewInt64Field(pack.Message, "PanicCount",
+				atomic.LoadInt64(reportingDecoder.panics), "count")
+		}
 
 		reportChan <- pack
 	}
@@ -168,6 +241,10 @@ func (pc *PipelineConfig) reports(reportChan chan *PipelinePack) {
 		message.NewStringField(pack.Message, "key", "splitters")
 		pack.Message.SetLogger(HEKA_DAEMON)
 		pack.Message.SetType("heka.plugin-report")
+		if sr, ok := runner.(*sRunner); ok {
+			message.NewInt64Field(pack.Message, "PanicCount", atomic.LoadInt64(&sr.panics),
+				"count")
+		}
 
 		if reporter, hasReports := runner.Splitter().(ReportingPlugin); hasReports {
 			if err = reporter.ReportMsg(msg); err != nil {
@@ -196,11 +273,34 @@ func (pc *PipelineConfig) reports(reportChan chan *PipelinePack) {
 		reportChan <- pack
 	}
 
+	pc.allProcessorsLock.RLock()
+	for name, stage := range pc.allProcessors {
+		pack = <-pc.reportRecycleChan
+		msg = pack.Message
+		msg.SetType("heka.plugin-report")
+		message.NewStringField(msg, "name", name)
+		message.NewStringField(msg, "key", "processors")
+		stage.reportMsg(msg)
+		if reporter, ok := stage.processor.(ReportingPlugin); ok {
+			if err = reporter.ReportMsg(msg); err != nil {
+				if f, e = message.NewField("Error", err.Error(), ""); e == nil {
+					msg.AddField(f)
+				}
+			}
+		}
+		reportChan <- pack
+	}
+	pc.allProcessorsLock.RUnlock()
+
 	pc.filtersLock.Lock()
 	for name, runner := range pc.FilterRunners {
 		pack = getReport(runner)
 		message.NewStringField(pack.Message, "name", name)
 		message.NewStringField(pack.Message, "key", "filters")
+		if fo, ok := runner.(*foRunner); ok && fo.injectLimit != nil {
+			message.NewInt64Field(pack.Message, "InjectRateDropCount",
+				fo.injectLimit.count(), "count")
+		}
 		reportChan <- pack
 	}
 	pc.filtersLock.Unlock()
@@ -209,6 +309,22 @@ func (pc *PipelineConfig) reports(reportChan chan *PipelinePack) {
 		pack = getReport(runner)
 		message.NewStringField(pack.Message, "name", name)
 		message.NewStringField(pack.Message, "key", "outputs")
+		if fo, ok := runner.(*foRunner); ok {
+			if fo.injectLimit != nil {
+				message.NewInt64Field(pack.Message, "InjectRateDropCount",
+					fo.injectLimit.count(), "count")
+			}
+			if fo.breaker != nil {
+				fo.breaker.report(pack.Message)
+			}
+			if fo.latency != nil {
+				fo.latency.report(pack.Message)
+			}
+			if fo.egressLimit != nil {
+				message.NewInt64Field(pack.Message, "EgressThrottledMs",
+					fo.egressLimit.throttledMs(), "ms")
+			}
+		}
 		reportChan <- pack
 	}
 	close(reportChan)
@@ -311,10 +427,25 @@ func (pc *PipelineConfig) AllReportsMsg() {
 	} else {
 		pc.router.InChan() <- mempack
 	}
+
+	clusterPack, e := pc.clusterReportMsg()
+	if e != nil {
+		LogError.Printf("generating heka.cluster-report message: %s\n", e.Error())
+	} else if clusterPack != nil {
+		if err := clusterPack.EncodeMsgBytes(); err != nil {
+			LogError.Printf("encoding heka.cluster-report message: %s\n", err.Error())
+			clusterPack.recycle()
+		} else {
+			pc.router.InChan() <- clusterPack
+		}
+	}
 }
 
 func (pc *PipelineConfig) allReportsStdout() {
 	report_type, msg_payload := pc.allReportsData()
+	if pc.Globals.Pipeline != "" {
+		report_type = fmt.Sprintf("%s (pipeline '%s')", report_type, pc.Globals.Pipeline)
+	}
 	pc.log(pc.FormatTextReport(report_type, msg_payload))
 }
 
@@ -333,7 +464,8 @@ func (pc *PipelineConfig) FormatTextReport(report_type, payload string) string {
 	json.Unmarshal([]byte(payload), &m)
 
 	fullReport := make([]string, 0)
-	categories := []string{"globals", "inputs", "splitters", "decoders", "filters", "outputs", "encoders"}
+	categories := []string{"globals", "inputs", "splitters", "decoders", "filters", "outputs", "encoders",
+		"processors"}
 	for _, cat := range categories {
 		fullReport = append(fullReport, fmt.Sprintf("\n====%s====", strings.Title(cat)))
 		catReports, ok := m[cat]
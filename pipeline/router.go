@@ -209,6 +209,8 @@ func (self *messageRouter) Start() {
 	LogInfo.Println("MessageRouter started.")
 }
 
+var ErrMatchRunnerClosed = errors.New("plugin is shutting down")
+
 // Encapsulates the mechanics of testing messages against a specific plugin's
 // message_matcher value.
 type MatchRunner struct {
@@ -225,6 +227,16 @@ type MatchRunner struct {
 	bufFeeder     *BufferFeeder
 	globals       *GlobalConfigStruct
 	retry         *RetryHelper
+	shadow        *ShadowTracker
+	maxAge        time.Duration
+	staleCount    int64
+	// Held for reading by Deliver calls, so the runner can wait them out
+	// before closing the channels they send on.
+	deliverLock sync.RWMutex
+	// Set if the matcher is shared by several instances of a filter.
+	dispatch *instanceDispatcher
+	// Filters only, where the inject chains of matched packs are recorded.
+	chains *receivedChains
 }
 
 // Creates and returns a new MatchRunner if possible, or a relevant error if
@@ -317,7 +329,7 @@ func (mr *MatchRunner) run(sampleDenom int) {
 		if counter == random {
 			startTime = time.Now()
 
-			match = mr.spec.Match(pack.Message)
+			match = mr.spec.MatchSigned(pack.Message, pack.Signer)
 
 			duration = time.Since(startTime).Nanoseconds()
 			mr.reportLock.Lock()
@@ -330,12 +342,26 @@ func (mr *MatchRunner) run(sampleDenom int) {
 				counter = 0
 			}
 		} else {
-			match = mr.spec.Match(pack.Message)
+			match = mr.spec.MatchSigned(pack.Message, pack.Signer)
 			counter++
 		}
 
+		if match && mr.stale(pack) {
+			pack.recycle()
+			continue
+		}
+		if match && mr.chains != nil {
+			mr.chains.record(pack)
+		}
+		if match && mr.dispatch != nil {
+			mr.dispatch.deliver(pack)
+			continue
+		}
 		if match {
 			pack.diagnostics.AddStamp(mr.pluginRunner)
+			if mr.shadow != nil {
+				mr.shadow.copy(pack)
+			}
 			err := mr.deliver(pack)
 			if err != nil {
 				mr.pluginRunner.LogError(fmt.Errorf("can't deliver matched message: %s",
@@ -345,9 +371,16 @@ func (mr *MatchRunner) run(sampleDenom int) {
 			pack.recycle()
 		}
 	}
+	// Close has set closing, so once any Deliver calls in progress have
+	// finished no more will send.
+	mr.deliverLock.Lock()
+	mr.deliverLock.Unlock()
 	if mr.matchChan != nil {
 		close(mr.matchChan)
 	}
+	if mr.dispatch != nil {
+		mr.dispatch.close()
+	}
 	if mr.stopChan != nil {
 		close(mr.stopChan)
 	}
@@ -361,6 +394,41 @@ func (mr *MatchRunner) Start(sampleDenom int) {
 	go mr.run(sampleDenom)
 }
 
+// Deliver hands a pack straight to the runner's plugin, by way of its disk
+// queue if it's buffered, as if the pack had matched. It's for outputs such
+// as TeeOutput that pass messages on to others. The caller must hold a
+// reference to the pack on the runner's behalf, which is released if the
+// runner has shut down.
+func (mr *MatchRunner) Deliver(pack *PipelinePack) error {
+	mr.deliverLock.RLock()
+	defer mr.deliverLock.RUnlock()
+	if atomic.LoadInt32(&mr.closing) != 0 {
+		pack.recycle()
+		return ErrMatchRunnerClosed
+	}
+	return mr.deliver(pack)
+}
+
+// Reports whether the pack's message is older than the plugin's
+// max_message_age, counting it as dropped if so.
+func (mr *MatchRunner) stale(pack *PipelinePack) bool {
+	if mr.maxAge == 0 {
+		return false
+	}
+	ts := pack.Message.GetTimestamp()
+	if ts == 0 || time.Since(time.Unix(0, ts)) <= mr.maxAge {
+		return false
+	}
+	atomic.AddInt64(&mr.staleCount, 1)
+	return true
+}
+
+// Returns how many messages have been dropped for being older than the
+// plugin's max_message_age.
+func (mr *MatchRunner) StaleCount() int64 {
+	return atomic.LoadInt64(&mr.staleCount)
+}
+
 func (mr *MatchRunner) deliver(pack *PipelinePack) error {
 	if mr.bufFeeder != nil {
 		err := mr.bufFeeder.QueueRecord(pack)
@@ -390,5 +458,7 @@ func (mr *MatchRunner) deliver(pack *PipelinePack) error {
 		mr.matchChan <- pack
 		return nil
 	}
+	// Nothing will take the pack, so its reference is let go of here.
+	pack.recycle()
 	return errors.New("no queue buffer or match chan for delivery")
 }
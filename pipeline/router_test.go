@@ -0,0 +1,98 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func MatchRunnerSpec(c gs.Context) {
+	recycleChan := make(chan *PipelinePack, 2)
+
+	c.Specify("A MatchRunner with a max_message_age", func() {
+		matchChan := make(chan *PipelinePack, 2)
+		mr, err := NewMatchRunner("TRUE", "", nil, 2, matchChan)
+		c.Assume(err, gs.IsNil)
+		mr.maxAge = time.Minute
+		mr.Start(1)
+		defer mr.Close()
+
+		newPack := func(age time.Duration) *PipelinePack {
+			pack := NewPipelinePack(recycleChan)
+			pack.Message.SetTimestamp(time.Now().Add(-age).UnixNano())
+			pack.RefCount = 1
+			return pack
+		}
+
+		c.Specify("drops stale messages", func() {
+			stale, fresh := newPack(time.Hour), newPack(time.Second)
+			mr.inChan <- stale
+			mr.inChan <- fresh
+			c.Expect(<-matchChan, gs.Equals, fresh)
+			c.Expect(<-recycleChan, gs.Equals, stale)
+			c.Expect(mr.StaleCount(), gs.Equals, int64(1))
+		})
+
+		c.Specify("passes messages without timestamps", func() {
+			pack := newPack(0)
+			pack.Message.SetTimestamp(0)
+			mr.inChan <- pack
+			c.Expect(<-matchChan, gs.Equals, pack)
+			c.Expect(mr.StaleCount(), gs.Equals, int64(0))
+		})
+	})
+
+	c.Specify("A MatchRunner with nowhere to deliver to recycles the pack", func() {
+		mr, err := NewMatchRunner("TRUE", "", nil, 2, nil)
+		c.Assume(err, gs.IsNil)
+		pack := NewPipelinePack(recycleChan)
+		pack.RefCount = 1
+		c.Expect(mr.Deliver(pack), gs.Not(gs.IsNil))
+		c.Expect(len(recycleChan), gs.Equals, 1)
+		c.Expect(<-recycleChan, gs.Equals, pack)
+	})
+
+	c.Specify("A closed MatchRunner refuses deliveries", func() {
+		matchChan := make(chan *PipelinePack, 100)
+		mr, err := NewMatchRunner("TRUE", "", nil, 2, matchChan)
+		c.Assume(err, gs.IsNil)
+		mr.Start(1)
+		recycleChan := make(chan *PipelinePack, 100)
+		delivered := make(chan error, 100)
+		for i := 0; i < 100; i++ {
+			go func() {
+				pack := NewPipelinePack(recycleChan)
+				pack.RefCount = 1
+				delivered <- mr.Deliver(pack)
+			}()
+		}
+		mr.Close()
+		refused := 0
+		for i := 0; i < 100; i++ {
+			if err := <-delivered; err != nil {
+				c.Expect(err, gs.Equals, ErrMatchRunnerClosed)
+				refused++
+			}
+		}
+		matched := 0
+		for range matchChan {
+			matched++
+		}
+		c.Expect(matched+refused, gs.Equals, 100)
+		c.Expect(len(recycleChan), gs.Equals, refused)
+	})
+}
@@ -0,0 +1,239 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Syslog severities of the level names applications log with.
+var severityLevels = map[string]int32{
+	"emerg":         0,
+	"emergency":     0,
+	"panic":         0,
+	"alert":         1,
+	"crit":          2,
+	"critical":      2,
+	"fatal":         2,
+	"err":           3,
+	"error":         3,
+	"severe":        3,
+	"warn":          4,
+	"warning":       4,
+	"notice":        5,
+	"info":          6,
+	"information":   6,
+	"informational": 6,
+	"debug":         7,
+	"trace":         7,
+	"verbose":       7,
+	"fine":          7,
+	"finer":         7,
+	"finest":        7,
+}
+
+var (
+	// The request line and status of Common and Combined Log Format lines.
+	httpStatusRegex = regexp.MustCompile(`"[A-Z]+ [^ "]+ HTTP/\d(?:\.\d)?" (\d{3}) `)
+	// Java, JavaScript, Python and Go stack traces.
+	stackTraceRegex = regexp.MustCompile(`(?m)^\s+at \S+\(.*\)\s*$|` +
+		`Traceback \(most recent call last\):|^goroutine \d+ \[|^panic: |` +
+		`^Exception in thread `)
+)
+
+// Config of a SeverityInferrer, shared by the decoders that infer messages'
+// severities.
+type SeverityInferrerConfig struct {
+	// Whether a syslog priority, "<PRI>", starting the payload is used.
+	SyslogPriority bool `toml:"syslog_priority"`
+	// Whether level names, such as "ERROR" or "level=warn", are used.
+	LevelTokens bool `toml:"level_tokens"`
+	// Whether the statuses of HTTP access log lines are used.
+	HttpStatus bool `toml:"http_status"`
+	// Whether payloads with stack traces are given at least error severity.
+	StackTraces bool `toml:"stack_traces"`
+	// How much of the payload is searched for level names and the HTTP
+	// status. Stack traces are searched for in the whole payload.
+	ScanBytes int `toml:"scan_bytes"`
+}
+
+// Returns the config with every heuristic enabled.
+func NewSeverityInferrerConfig() SeverityInferrerConfig {
+	return SeverityInferrerConfig{
+		SyslogPriority: true,
+		LevelTokens:    true,
+		HttpStatus:     true,
+		StackTraces:    true,
+		ScanBytes:      512,
+	}
+}
+
+// Infers the severities of free-form log lines from their contents, so that
+// messages from applications whose logs aren't parsed can still be routed by
+// their Severity.
+type SeverityInferrer struct {
+	conf SeverityInferrerConfig
+}
+
+func NewSeverityInferrer(conf SeverityInferrerConfig) *SeverityInferrer {
+	return &SeverityInferrer{conf: conf}
+}
+
+// Parses a syslog priority starting a payload.
+func syslogPriority(payload string) (int32, bool) {
+	if len(payload) < 3 || payload[0] != '<' {
+		return 0, false
+	}
+	end := strings.IndexByte(payload, '>')
+	if end < 2 || end > 4 {
+		return 0, false
+	}
+	pri, err := strconv.Atoi(payload[1:end])
+	if err != nil || pri > 191 {
+		return 0, false
+	}
+	return int32(pri & 7), true
+}
+
+// Whether the text before a word is a level's key, e.g. `level=` or
+// `"severity": "`.
+func levelKey(before string) bool {
+	i := len(before)
+	sep := false
+	for i > 0 && strings.IndexByte(`"' :=`, before[i-1]) >= 0 {
+		if before[i-1] == '=' || before[i-1] == ':' {
+			sep = true
+		}
+		i--
+	}
+	if !sep {
+		return false
+	}
+	key := strings.ToLower(before[:i])
+	return strings.HasSuffix(key, "level") || strings.HasSuffix(key, "lvl") ||
+		strings.HasSuffix(key, "severity")
+}
+
+// Syslog severity of a numeric level: a syslog severity itself, or one of
+// the levels of bunyan and pino.
+func numericLevel(s string) (int32, bool) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+	switch {
+	case n >= 0 && n <= 7:
+		return int32(n), true
+	case n == 10 || n == 20:
+		return 7, true
+	case n == 30:
+		return 6, true
+	case n == 40:
+		return 4, true
+	case n == 50:
+		return 3, true
+	case n == 60:
+		return 2, true
+	}
+	return 0, false
+}
+
+// Finds a level in a payload. Levels given as a key's value win, then
+// bracketed or upper case level names, the first found in each case. Lower
+// case level names in running text aren't used, since they're as likely to
+// be part of a sentence as a level.
+func levelToken(text string) (int32, bool) {
+	var found int32
+	ok := false
+	for i := 0; i < len(text); {
+		c := text[i]
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(text) {
+			c = text[j]
+			if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+				break
+			}
+			j++
+		}
+		word := text[i:j]
+		if i > 0 && (text[i-1] == '_' || text[i-1] == '.' || text[i-1] == '-') ||
+			j < len(text) && (text[j] == '_' || text[j] == '.' && j+1 < len(text) &&
+				text[j+1] != ' ') {
+			// Part of an identifier or a dotted name.
+			i = j
+			continue
+		}
+		if levelKey(text[:i]) {
+			if sev, ok := severityLevels[strings.ToLower(word)]; ok {
+				return sev, true
+			}
+			if sev, ok := numericLevel(word); ok {
+				return sev, true
+			}
+		}
+		if !ok {
+			if sev, known := severityLevels[strings.ToLower(word)]; known {
+				bracketed := i > 0 && j < len(text) &&
+					strings.IndexByte("[(<", text[i-1]) >= 0 &&
+					strings.IndexByte("])>", text[j]) >= 0
+				if bracketed || word == strings.ToUpper(word) {
+					found, ok = sev, true
+				}
+			}
+		}
+		i = j
+	}
+	return found, ok
+}
+
+// Returns the severity the payload is inferred to have, if any heuristic
+// finds one.
+func (si *SeverityInferrer) Infer(payload string) (severity int32, ok bool) {
+	conf := &si.conf
+	head := payload
+	if conf.ScanBytes > 0 && len(head) > conf.ScanBytes {
+		head = head[:conf.ScanBytes]
+	}
+	if conf.SyslogPriority {
+		severity, ok = syslogPriority(payload)
+	}
+	if !ok && conf.LevelTokens {
+		severity, ok = levelToken(head)
+	}
+	if !ok && conf.HttpStatus {
+		if m := httpStatusRegex.FindStringSubmatch(head); m != nil {
+			switch m[1][0] {
+			case '5':
+				severity = 3
+			case '4':
+				severity = 4
+			default:
+				severity = 6
+			}
+			ok = true
+		}
+	}
+	if conf.StackTraces && (!ok || severity > 3) && stackTraceRegex.MatchString(payload) {
+		severity, ok = 3, true
+	}
+	return severity, ok
+}
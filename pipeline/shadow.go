@@ -0,0 +1,217 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Most samples awaiting comparison at once. Past this no more are taken
+// until some have been compared or swept away.
+const maxShadowPending = 10000
+
+// How many of the latest divergent message UUIDs are kept for reporting.
+const maxShadowDivergent = 10
+
+// Comparison counts between an output and its shadow.
+type ShadowStats struct {
+	// Messages copied to the shadow.
+	Sampled int64
+	// Samples encoded by both outputs.
+	Compared int64
+	// Compared samples whose encoded output differed.
+	Diverged int64
+	// Samples encoded by the primary but not the shadow within the wait.
+	MissingShadow int64
+	// Samples encoded by the shadow but not the primary within the wait.
+	MissingPrimary int64
+	// Samples encoded by neither within the wait.
+	Unencoded int64
+	// Messages not sampled because too many were awaiting comparison.
+	Skipped int64
+	// Samples still awaiting comparison.
+	Pending int64
+	// UUIDs of the latest divergent messages.
+	Divergent []string
+}
+
+// A sampled message's checksums, filled in as each output encodes it.
+type shadowSample struct {
+	taken                 time.Time
+	primary, shadow       []byte
+	hasPrimary, hasShadow bool
+}
+
+// Copies a percentage of the messages an output matches to a shadow output,
+// and compares checksums of what each of them encodes.
+type ShadowTracker struct {
+	Primary string
+	Shadow  string
+	percent float64
+	runner  OutputRunner
+	lock    sync.Mutex
+	pending map[string]*shadowSample
+	stats   ShadowStats
+}
+
+func newShadowTracker(primary, shadow string, percent float64,
+	runner OutputRunner) *ShadowTracker {
+
+	return &ShadowTracker{
+		Primary: primary,
+		Shadow:  shadow,
+		percent: percent,
+		runner:  runner,
+		pending: make(map[string]*shadowSample),
+	}
+}
+
+// Passes the pack on to the shadow if it's sampled, before the primary's
+// matcher delivers it.
+func (st *ShadowTracker) copy(pack *PipelinePack) {
+	if st.percent < 100 && rand.Float64()*100 >= st.percent {
+		return
+	}
+	id := pack.Message.GetUuidString()
+	if id == "" {
+		return
+	}
+	st.lock.Lock()
+	if len(st.pending) >= maxShadowPending {
+		st.stats.Skipped++
+		st.lock.Unlock()
+		return
+	}
+	st.pending[id] = &shadowSample{taken: time.Now()}
+	st.stats.Sampled++
+	st.lock.Unlock()
+
+	pack.diagnostics.AddStamp(st.runner)
+	atomic.AddInt32(&pack.RefCount, 1)
+	if err := st.runner.MatchRunner().Deliver(pack); err != nil {
+		st.runner.LogError(fmt.Errorf("can't deliver shadow copy: %s", err))
+	}
+}
+
+// Records the checksum of a sample's encoding by one of the outputs.
+func (st *ShadowTracker) record(pack *PipelinePack, encoded []byte, shadow bool) {
+	id := pack.Message.GetUuidString()
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	sample, ok := st.pending[id]
+	if !ok {
+		return
+	}
+	sum := sha1.Sum(encoded)
+	if shadow {
+		sample.shadow, sample.hasShadow = sum[:], true
+	} else {
+		sample.primary, sample.hasPrimary = sum[:], true
+	}
+	if !sample.hasPrimary || !sample.hasShadow {
+		return
+	}
+	delete(st.pending, id)
+	st.stats.Compared++
+	if !bytes.Equal(sample.primary, sample.shadow) {
+		st.stats.Diverged++
+		st.stats.Divergent = append(st.stats.Divergent, id)
+		if len(st.stats.Divergent) > maxShadowDivergent {
+			st.stats.Divergent = st.stats.Divergent[1:]
+		}
+	}
+}
+
+// Sweep gives up on the samples that have waited longer than maxWait to be
+// encoded by both outputs, counting what's missing.
+func (st *ShadowTracker) Sweep(maxWait time.Duration) {
+	cutoff := time.Now().Add(-maxWait)
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	for id, sample := range st.pending {
+		if sample.taken.After(cutoff) {
+			continue
+		}
+		switch {
+		case sample.hasPrimary:
+			st.stats.MissingShadow++
+		case sample.hasShadow:
+			st.stats.MissingPrimary++
+		default:
+			st.stats.Unencoded++
+		}
+		delete(st.pending, id)
+	}
+}
+
+// Stats returns the comparison counts so far.
+func (st *ShadowTracker) Stats() ShadowStats {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	stats := st.stats
+	stats.Pending = int64(len(st.pending))
+	stats.Divergent = append([]string(nil), st.stats.Divergent...)
+	return stats
+}
+
+// Links an output to its shadow, as set by the output's `shadow` option.
+// Called before any output starts, as the shadow's goroutine reads the link.
+func (foRunner *foRunner) startShadow() error {
+	name := foRunner.config.Shadow
+	if name == foRunner.name {
+		return fmt.Errorf("'%s' can't shadow itself", name)
+	}
+	shadow, err := foRunner.pConfig.shadowRunner(name)
+	if err != nil {
+		return err
+	}
+	tracker := newShadowTracker(foRunner.name, name, foRunner.config.ShadowPercent,
+		shadow)
+	foRunner.shadow = tracker
+	shadow.shadowOf = tracker
+	foRunner.matcher.shadow = tracker
+	foRunner.pConfig.shadowsLock.Lock()
+	foRunner.pConfig.shadows[foRunner.name] = tracker
+	foRunner.pConfig.shadowsLock.Unlock()
+	return nil
+}
+
+// Looks up the runner of the output named as a shadow.
+func (self *PipelineConfig) shadowRunner(name string) (*foRunner, error) {
+	runner, ok := self.Output(name)
+	if !ok {
+		return nil, fmt.Errorf("no shadow output named '%s'", name)
+	}
+	shadow, ok := runner.(*foRunner)
+	if !ok {
+		return nil, fmt.Errorf("'%s' can't be used as a shadow", name)
+	}
+	return shadow, nil
+}
+
+// ShadowTracker returns the tracker comparing the named output with its
+// shadow, if it has one.
+func (self *PipelineConfig) ShadowTracker(output string) (*ShadowTracker, bool) {
+	self.shadowsLock.RLock()
+	defer self.shadowsLock.RUnlock()
+	tracker, ok := self.shadows[output]
+	return tracker, ok
+}
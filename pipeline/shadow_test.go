@@ -0,0 +1,109 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"time"
+
+	"github.com/pborman/uuid"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func ShadowSpec(c gs.Context) {
+	pConfig := NewPipelineConfig(nil)
+
+	c.Specify("A shadow tracker", func() {
+		matchChan := make(chan *PipelinePack, 2)
+		mr, err := NewMatchRunner("FALSE", "", nil, 2, matchChan)
+		c.Assume(err, gs.IsNil)
+		shadow := &foRunner{matcher: mr}
+		shadow.name = "Shadow"
+		tracker := newShadowTracker("Primary", "Shadow", 100, shadow)
+
+		newPack := func() *PipelinePack {
+			pack := NewPipelinePack(pConfig.InjectRecycleChan())
+			pack.Message.SetUuid(uuid.NewRandom())
+			pack.RefCount = 1
+			return pack
+		}
+
+		c.Specify("copies sampled messages to the shadow", func() {
+			pack := newPack()
+			tracker.copy(pack)
+			c.Expect(<-matchChan, gs.Equals, pack)
+			c.Expect(pack.RefCount, gs.Equals, int32(2))
+			c.Expect(tracker.Stats().Pending, gs.Equals, int64(1))
+		})
+
+		c.Specify("counts matching and divergent encodings", func() {
+			same, differs := newPack(), newPack()
+			tracker.copy(same)
+			tracker.copy(differs)
+			tracker.record(same, []byte("a"), false)
+			tracker.record(same, []byte("a"), true)
+			tracker.record(differs, []byte("a"), false)
+			tracker.record(differs, []byte("b"), true)
+			stats := tracker.Stats()
+			c.Expect(stats.Sampled, gs.Equals, int64(2))
+			c.Expect(stats.Compared, gs.Equals, int64(2))
+			c.Expect(stats.Diverged, gs.Equals, int64(1))
+			c.Expect(stats.Pending, gs.Equals, int64(0))
+			c.Assume(len(stats.Divergent), gs.Equals, 1)
+			c.Expect(stats.Divergent[0], gs.Equals, differs.Message.GetUuidString())
+		})
+
+		c.Specify("ignores messages it didn't sample", func() {
+			tracker.record(newPack(), []byte("a"), false)
+			c.Expect(tracker.Stats().Compared, gs.Equals, int64(0))
+		})
+
+		c.Specify("sweeps away samples not encoded in time", func() {
+			onlyPrimary, onlyShadow, neither := newPack(), newPack(), newPack()
+			tracker.copy(onlyPrimary)
+			<-matchChan
+			tracker.copy(onlyShadow)
+			<-matchChan
+			tracker.copy(neither)
+			tracker.record(onlyPrimary, []byte("a"), false)
+			tracker.record(onlyShadow, []byte("a"), true)
+
+			tracker.Sweep(time.Hour)
+			c.Expect(tracker.Stats().Pending, gs.Equals, int64(3))
+			tracker.Sweep(0)
+			stats := tracker.Stats()
+			c.Expect(stats.Pending, gs.Equals, int64(0))
+			c.Expect(stats.MissingShadow, gs.Equals, int64(1))
+			c.Expect(stats.MissingPrimary, gs.Equals, int64(1))
+			c.Expect(stats.Unencoded, gs.Equals, int64(1))
+		})
+
+		c.Specify("samples only the configured percentage", func() {
+			tracker = newShadowTracker("Primary", "Shadow", 0.0001, shadow)
+			for i := 0; i < 100; i++ {
+				tracker.copy(newPack())
+			}
+			c.Expect(tracker.Stats().Sampled < 2, gs.IsTrue)
+		})
+
+		c.Specify("is looked up by primary output", func() {
+			pConfig.shadows["Primary"] = tracker
+			found, ok := pConfig.ShadowTracker("Primary")
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(found, gs.Equals, tracker)
+			_, ok = pConfig.ShadowTracker("Shadow")
+			c.Expect(ok, gs.IsFalse)
+		})
+	})
+}
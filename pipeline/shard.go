@@ -0,0 +1,176 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShardGroup shares out work items, such as files or partitions found by
+// discovery, among the hekad nodes that have joined a named group. Each item
+// is owned by exactly one live member, chosen by rendezvous hashing, so that
+// only the items of a member that joins or leaves change hands.
+type ShardGroup struct {
+	elector *leaderElector
+	name    string
+	// Prefix of the group's member keys.
+	prefix string
+	// Protects members, the sorted names of the live members.
+	lock     sync.RWMutex
+	members  []string
+	changes  chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// JoinShardGroup makes this node a member of the named shard group, which
+// requires cluster coordination to be configured. Until the node's membership
+// has registered it owns no items.
+func (self *PipelineConfig) JoinShardGroup(name string) (*ShardGroup, error) {
+	elector, ok := self.elector.(*leaderElector)
+	if !ok {
+		return nil, errors.New("shard groups require cluster coordination to be configured")
+	}
+	g := &ShardGroup{
+		elector:  elector,
+		name:     name,
+		prefix:   elector.prefix + "shards/" + name + "/",
+		changes:  make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+	g.wg.Add(1)
+	go g.run()
+	return g, nil
+}
+
+// Keeps this node registered as a member, and the member list up to date.
+func (g *ShardGroup) run() {
+	defer g.wg.Done()
+	key := "shards/" + g.name + "/" + g.elector.node
+	ticker := time.NewTicker(g.elector.interval)
+	defer ticker.Stop()
+	for {
+		lost, err := g.elector.Campaign(key, g.stopChan)
+		if err != nil {
+			g.setMembers(nil)
+			return
+		}
+		g.refresh()
+	registered:
+		for {
+			select {
+			case <-g.stopChan:
+				if err = g.elector.Resign(key); err != nil {
+					LogError.Printf("Can't leave shard group '%s': %s", g.name, err)
+				}
+				g.setMembers(nil)
+				return
+			case <-lost:
+				LogError.Printf("Lost membership of shard group '%s', rejoining", g.name)
+				g.refresh()
+				break registered
+			case <-ticker.C:
+				g.refresh()
+			}
+		}
+	}
+}
+
+// Reloads the member list from the coordination service.
+func (g *ShardGroup) refresh() {
+	keys, err := g.elector.lock.list(g.prefix)
+	if err != nil {
+		LogError.Printf("Can't list members of shard group '%s': %s", g.name, err)
+		return
+	}
+	members := make([]string, 0, len(keys))
+	for _, key := range keys {
+		members = append(members, strings.TrimPrefix(key, g.prefix))
+	}
+	sort.Strings(members)
+	g.setMembers(members)
+}
+
+// Replaces the member list, signalling a change if it's different.
+func (g *ShardGroup) setMembers(members []string) {
+	g.lock.Lock()
+	changed := len(members) != len(g.members)
+	for i := 0; !changed && i < len(members); i++ {
+		changed = members[i] != g.members[i]
+	}
+	g.members = members
+	g.lock.Unlock()
+	if changed {
+		select {
+		case g.changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Members returns the names of the group's live members.
+func (g *ShardGroup) Members() []string {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	members := make([]string, len(g.members))
+	copy(members, g.members)
+	return members
+}
+
+// Owns returns true if the item should be handled by this node.
+func (g *ShardGroup) Owns(item string) bool {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return shardOwner(g.members, item) == g.elector.node
+}
+
+// Changes returns a channel that receives a value whenever the group's
+// membership changes, after which items may have changed hands.
+func (g *ShardGroup) Changes() <-chan struct{} {
+	return g.changes
+}
+
+// Leave gives up this node's membership, handing its items to the other
+// members.
+func (g *ShardGroup) Leave() {
+	close(g.stopChan)
+	g.wg.Wait()
+}
+
+// Returns the member with the highest hash of its name combined with the
+// item's, or "" if there are no members.
+func shardOwner(members []string, item string) (owner string) {
+	var highest uint64
+	for _, member := range members {
+		h := fnv.New64a()
+		h.Write([]byte(member))
+		h.Write([]byte{0})
+		h.Write([]byte(item))
+		// Mix the bits, FNV alone spreads similar names poorly.
+		score := h.Sum64()
+		score ^= score >> 33
+		score *= 0xff51afd7ed558ccd
+		score ^= score >> 33
+		if owner == "" || score > highest {
+			owner, highest = member, score
+		}
+	}
+	return owner
+}
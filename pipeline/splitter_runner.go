@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/pborman/uuid"
@@ -60,6 +61,12 @@ type sRunner struct {
 	unframer        UnframingSplitter
 	ir              InputRunner
 	packDecorator   func(*PipelinePack)
+	quarantine      *Quarantine
+	// Whether to record the input as the borrower of the packs it takes,
+	// for pack leak detection.
+	trackBorrows bool
+	// Number of times the splitter has panicked, accessed atomically.
+	panics int64
 }
 
 func NewSplitterRunner(name string, splitter Splitter,
@@ -219,7 +226,7 @@ func (sr *sRunner) GetRecordFromStream(r io.Reader) (bytesRead int, record []byt
 	}
 
 	sr.readPos += bytesRead
-	bytesRead, record = sr.splitter.FindRecord(sr.buf[sr.scanPos:sr.readPos])
+	bytesRead, record, _ = sr.findRecord(sr.buf[sr.scanPos:sr.readPos])
 	sr.scanPos += bytesRead
 	if len(record) == 0 {
 		// If the record is empty and we've reached EOF, we will not find any
@@ -250,13 +257,47 @@ func (sr *sRunner) GetRecordFromStream(r io.Reader) (bytesRead int, record []byt
 	return bytesRead, record, err
 }
 
+// Finds the next record in buf. If the splitter panics, the whole of buf is
+// quarantined and skipped, and the error says so.
+func (sr *sRunner) findRecord(buf []byte) (n int, record []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddInt64(&sr.panics, 1)
+			err = sr.quarantine.Recovered(sr.name, append([]byte(nil), buf...), r)
+			sr.LogError(err)
+			n, record = len(buf), nil
+		}
+	}()
+	n, record = sr.splitter.FindRecord(buf)
+	return n, record, nil
+}
+
+// Unframes the record, quarantining it and returning nil if the splitter
+// panics.
+func (sr *sRunner) unframeRecord(record []byte, pack *PipelinePack) (unframed []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddInt64(&sr.panics, 1)
+			sr.LogError(sr.quarantine.Recovered(sr.name, append([]byte(nil), record...), r))
+			unframed = nil
+		}
+	}()
+	return sr.unframer.UnframeRecord(record, pack)
+}
+
 func (sr *sRunner) DeliverRecord(record []byte, del Deliverer) {
 	unframed := record
 	pack := <-sr.ir.InChan()
+	if sr.trackBorrows {
+		pack.diagnostics.SetBorrower(sr.ir.Name())
+	}
 	if sr.unframer != nil {
-		unframed = sr.unframer.UnframeRecord(record, pack)
+		unframed = sr.unframeRecord(record, pack)
 		if unframed == nil {
 			pack.recycle()
+			if dropper, ok := del.(RecordDropper); ok {
+				dropper.DropRecord()
+			}
 			return
 		}
 	}
@@ -291,11 +332,15 @@ func (sr *sRunner) SplitBytes(data []byte, del Deliverer) (int, error) {
 	var (
 		n      int
 		record []byte
+		err    error
 	)
 	seekPos := 0
 	dataLen := len(data)
 	for true {
-		n, record = sr.Splitter().FindRecord(data[seekPos:])
+		if n, record, err = sr.findRecord(data[seekPos:]); err != nil {
+			// The rest of the data has been quarantined.
+			return dataLen, nil
+		}
 		recordLen := uint32(len(record))
 		if recordLen == 0 {
 			// Checks if there is remaining unsplitted data
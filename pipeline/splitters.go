@@ -17,15 +17,19 @@ package pipeline
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/subtle"
 	"errors"
 	"fmt"
 	"hash"
 	"regexp"
+	"time"
 
+	"github.com/gogo/protobuf/proto"
 	"heka/message"
 )
 
@@ -237,38 +241,86 @@ func (r *RegexSplitter) FindRecord(buf []byte) (bytesRead int, record []byte) {
 // Heka Message signer object.
 type Signer struct {
 	HmacKey string `toml:"hmac_key"`
+	// Base64 encoded Ed25519 public key, used to verify messages signed with
+	// the ED25519 hash function.
+	Ed25519PublicKey string `toml:"ed25519_public_key"`
+	// Optional RFC 3339 timestamp after which this key version is no longer
+	// accepted, so an old key can be retired once a rotation has completed.
+	Expires string `toml:"expires"`
+
+	publicKey ed25519.PublicKey
+	expires   time.Time
 }
 
-// Returns true if the provided message is unsigned or has a valid signature
-// from one of the provided signers.
+// Verification results, used as the value of the signature status field
+// of every message when a HekaFramingSplitter's verification policy is "tag".
+const (
+	signatureValid    = "valid"
+	signatureUnsigned = "unsigned"
+	signatureInvalid  = "invalid"
+)
+
+// Checks the provided message against the provided signers, returning
+// signatureUnsigned, signatureInvalid, or signatureValid.
 func authenticateMessage(signers map[string]Signer, header *message.Header,
-	msg []byte) bool {
+	msg []byte) string {
 
 	digest := header.GetHmac()
-	if digest != nil {
-		var key string
-		signer := fmt.Sprintf("%s_%d", header.GetHmacSigner(),
-			header.GetHmacKeyVersion())
-		if s, ok := signers[signer]; ok {
-			key = s.HmacKey
-		} else {
-			return false
-		}
+	if digest == nil {
+		return signatureUnsigned
+	}
+	signer := fmt.Sprintf("%s_%d", header.GetHmacSigner(),
+		header.GetHmacKeyVersion())
+	s, ok := signers[signer]
+	if !ok {
+		return signatureInvalid
+	}
+	if !s.expires.IsZero() && time.Now().After(s.expires) {
+		return signatureInvalid
+	}
 
-		var hm hash.Hash
-		switch header.GetHmacHashFunction() {
-		case message.Header_MD5:
-			hm = hmac.New(md5.New, []byte(key))
-		case message.Header_SHA1:
-			hm = hmac.New(sha1.New, []byte(key))
+	var hm hash.Hash
+	switch header.GetHmacHashFunction() {
+	case message.Header_MD5:
+		if FipsMode() {
+			return signatureInvalid
 		}
-		hm.Write(msg)
-		expectedDigest := hm.Sum(nil)
-		if subtle.ConstantTimeCompare(digest, expectedDigest) != 1 {
-			return false
+		hm = hmac.New(md5.New, []byte(s.HmacKey))
+	case message.Header_SHA1:
+		hm = hmac.New(sha1.New, []byte(s.HmacKey))
+	case message.Header_SHA256:
+		hm = hmac.New(sha256.New, []byte(s.HmacKey))
+	case message.Header_ED25519:
+		if s.publicKey == nil || !ed25519.Verify(s.publicKey, msg, digest) {
+			return signatureInvalid
 		}
+		return signatureValid
+	default:
+		return signatureInvalid
 	}
-	return true
+	hm.Write(msg)
+	expectedDigest := hm.Sum(nil)
+	if subtle.ConstantTimeCompare(digest, expectedDigest) != 1 {
+		return signatureInvalid
+	}
+	return signatureValid
+}
+
+// Prepends a protobuf encoded field to the provided encoded message. Repeated
+// protobuf fields may appear anywhere in the encoding, so the result decodes
+// as the original message with the new field at the front of its `fields`
+// list, ahead of any same-named field the sender may have included.
+func prependEncodedField(msgBytes []byte, field *message.Field) ([]byte, error) {
+	fieldBytes, err := proto.Marshal(field)
+	if err != nil {
+		return nil, err
+	}
+	lenBytes := proto.EncodeVarint(uint64(len(fieldBytes)))
+	tagged := make([]byte, 0, 1+len(lenBytes)+len(fieldBytes)+len(msgBytes))
+	tagged = append(tagged, 0x52) // field number 10, length delimited
+	tagged = append(tagged, lenBytes...)
+	tagged = append(tagged, fieldBytes...)
+	return append(tagged, msgBytes...), nil
 }
 
 type HekaFramingSplitter struct {
@@ -282,6 +334,14 @@ type HekaFramingSplitterConfig struct {
 	Signers     map[string]Signer `toml:"signer"`
 	UseMsgBytes bool              `toml:"use_message_bytes"`
 	SkipAuth    bool              `toml:"skip_authentication"`
+	// How to treat unsigned or incorrectly signed messages: "pass" delivers
+	// unsigned messages and drops incorrectly signed ones, "tag" delivers
+	// every message with a field recording the verification result, correctly
+	// signed ones included, and "reject" drops both. Defaults to "pass".
+	VerificationPolicy string `toml:"verification_policy"`
+	// Name of the field added to messages when the verification policy is
+	// "tag". Defaults to "SignatureStatus".
+	SignatureStatusField string `toml:"signature_status_field"`
 }
 
 func (h *HekaFramingSplitter) SetSplitterRunner(sr SplitterRunner) {
@@ -290,26 +350,82 @@ func (h *HekaFramingSplitter) SetSplitterRunner(sr SplitterRunner) {
 
 func (h *HekaFramingSplitter) ConfigStruct() interface{} {
 	return &HekaFramingSplitterConfig{
-		UseMsgBytes: true,
+		UseMsgBytes:          true,
+		VerificationPolicy:   "pass",
+		SignatureStatusField: "SignatureStatus",
 	}
 }
 
 func (h *HekaFramingSplitter) Init(config interface{}) error {
 	h.HekaFramingSplitterConfig = config.(*HekaFramingSplitterConfig)
+	switch h.VerificationPolicy {
+	case "":
+		h.VerificationPolicy = "pass"
+	case "pass", "tag", "reject":
+	default:
+		return fmt.Errorf("invalid verification_policy: %s", h.VerificationPolicy)
+	}
+	for name, s := range h.Signers {
+		if s.HmacKey == "" && s.Ed25519PublicKey == "" {
+			return fmt.Errorf("signer '%s' requires an hmac_key or ed25519_public_key",
+				name)
+		}
+		if s.Ed25519PublicKey != "" {
+			if FipsMode() {
+				return fmt.Errorf("signer '%s': ed25519 isn't allowed in FIPS mode",
+					name)
+			}
+			key, err := message.DecodeEd25519PublicKey(s.Ed25519PublicKey)
+			if err != nil {
+				return fmt.Errorf("signer '%s': %s", name, err)
+			}
+			s.publicKey = key
+		}
+		if s.Expires != "" {
+			expires, err := time.Parse(time.RFC3339, s.Expires)
+			if err != nil {
+				return fmt.Errorf("signer '%s': invalid expires: %s", name, err)
+			}
+			s.expires = expires
+		}
+		h.Signers[name] = s
+	}
 	h.header = &message.Header{}
 	return nil
 }
 
+// FindRecord returns the next record in buf. Invalid records are skipped
+// over one record separator at a time, in a loop rather than by recursing, so
+// that corrupted input can't grow the stack.
 func (h *HekaFramingSplitter) FindRecord(buf []byte) (bytesRead int, record []byte) {
-	bytesRead = bytes.IndexByte(buf, message.RECORD_SEPARATOR)
+	var invalid bool
+	for {
+		if bytesRead, record, invalid = h.findRecord(buf, bytesRead); !invalid {
+			return bytesRead, record
+		}
+		bytesRead++ // advance over the invalid record's separator
+	}
+}
+
+// Finds the record whose record separator is the first at or after offset.
+// If that record is invalid, invalid is returned along with the position of
+// its separator, so that the caller can look again from the next byte.
+func (h *HekaFramingSplitter) findRecord(buf []byte, offset int) (bytesRead int,
+	record []byte, invalid bool) {
+
+	bytesRead = bytes.IndexByte(buf[offset:], message.RECORD_SEPARATOR)
 	if bytesRead == -1 {
 		bytesRead = len(buf)
 		return // read more data to find the start of the next message
 	}
+	bytesRead += offset
 
 	if len(buf) < bytesRead+message.HEADER_DELIMITER_SIZE {
 		return // read more data to get the header length byte
 	}
+	if buf[bytesRead+1] == 0 {
+		return h.findRecordV2(buf, bytesRead)
+	}
 	headerLength := int(buf[bytesRead+1])
 	headerEnd := bytesRead + headerLength + message.HEADER_FRAMING_SIZE
 	if len(buf) < headerEnd {
@@ -320,39 +436,121 @@ func (h *HekaFramingSplitter) FindRecord(buf []byte) (bytesRead int, record []by
 	if err != nil {
 		h.sr.LogError(err)
 	}
-	if h.header.MessageLength != nil || decoded {
-		messageEnd := headerEnd + int(h.header.GetMessageLength())
-		if len(buf) < messageEnd {
-			return // read more data to get the remainder of the message
-		}
-		record = buf[bytesRead:messageEnd]
-		bytesRead = messageEnd
-		h.header.Reset()
-	} else {
-		var n int
-		bytesRead++                               // advance over the current record separator
-		n, record = h.FindRecord(buf[bytesRead:]) // header was invalid, look again
-		bytesRead += n
+	if h.header.MessageLength == nil && !decoded {
+		return bytesRead, nil, true // header was invalid, look again
 	}
-	return bytesRead, record
+	messageEnd := headerEnd + int(h.header.GetMessageLength())
+	if len(buf) < messageEnd {
+		return // read more data to get the remainder of the message
+	}
+	record = buf[bytesRead:messageEnd]
+	h.header.Reset()
+	return messageEnd, record, false
+}
+
+// Finds a v2 framed record, checking it against its checksum, given the
+// position of its record separator. A record that fails the check is
+// reported as invalid, to be skipped by looking again from the next byte, so
+// that the records overlapping its corrupted length are still found.
+func (h *HekaFramingSplitter) findRecordV2(buf []byte, start int) (bytesRead int,
+	record []byte, invalid bool) {
+
+	bytesRead = start
+	headerStart := start + message.FRAME_V2_MAGIC_SIZE + 1
+	if len(buf) < headerStart {
+		return // read more data to get the magic and the header length byte
+	}
+	if !bytes.HasPrefix(buf[start:], message.FRAME_V2_MAGIC) {
+		return start, nil, true
+	}
+	headerEnd := headerStart + int(buf[headerStart-1]) + 1
+	msgStart := headerEnd + message.FRAME_V2_CHECKSUM_SIZE
+	if len(buf) < msgStart {
+		return // read more data to get the remainder of the header
+	}
+	decoded, err := message.DecodeHeader(buf[headerStart:headerEnd], h.header)
+	if err != nil {
+		h.sr.LogError(err)
+	}
+	messageEnd := msgStart + int(h.header.GetMessageLength())
+	h.header.Reset()
+	if !decoded {
+		return start, nil, true
+	}
+	if len(buf) < messageEnd {
+		return // read more data to get the remainder of the message
+	}
+	record = buf[start:messageEnd]
+	if _, _, ok := message.SplitFramedRecord(record); !ok {
+		h.sr.LogError(errors.New("record checksum mismatch, resynchronizing"))
+		return start, nil, true
+	}
+	return messageEnd, record, false
 }
 
 func (h *HekaFramingSplitter) UnframeRecord(framed []byte, pack *PipelinePack) []byte {
-	headerLen := int(framed[1]) + message.HEADER_FRAMING_SIZE
-	unframed := framed[headerLen:]
-	if !h.SkipAuth && headerLen > message.UUID_SIZE {
-		header := &message.Header{}
-		decoded, err := message.DecodeHeader(framed[2:headerLen], header)
-		if err != nil {
-			h.sr.LogError(err)
+	headerBytes, unframed, _ := message.SplitFramedRecord(framed)
+	if h.SkipAuth {
+		return unframed
+	}
+	// A header with no room for a signature can't be signed, so with the
+	// default policy there's no need to decode it.
+	if h.VerificationPolicy == "pass" &&
+		len(headerBytes)+message.HEADER_DELIMITER_SIZE <= message.UUID_SIZE {
+		return unframed
+	}
+
+	header := &message.Header{}
+	decoded, err := message.DecodeHeader(headerBytes, header)
+	if err != nil {
+		h.sr.LogError(err)
+	}
+	status := signatureInvalid
+	if decoded {
+		status = authenticateMessage(h.Signers, header, unframed)
+	}
+	switch status {
+	case signatureValid:
+		pack.Signer = header.GetHmacSigner()
+		if h.VerificationPolicy != "tag" {
+			return unframed
+		}
+	case signatureUnsigned:
+		if h.VerificationPolicy == "reject" {
+			return nil
 		}
-		if decoded && authenticateMessage(h.Signers, header, unframed) {
-			pack.Signer = header.GetHmacSigner()
-		} else {
+		if h.VerificationPolicy == "pass" {
+			return unframed
+		}
+	case signatureInvalid:
+		if h.VerificationPolicy != "tag" {
 			return nil
 		}
 	}
-	return unframed
+	return h.tagRecord(unframed, pack, status)
+}
+
+// Records the verification status on the message, either by adding a field
+// to the encoded message bytes or, if the record is going to end up in the
+// payload, directly to the pack's message.
+func (h *HekaFramingSplitter) tagRecord(unframed []byte, pack *PipelinePack,
+	status string) []byte {
+
+	field, err := message.NewField(h.SignatureStatusField, status, "")
+	if err != nil {
+		h.sr.LogError(err)
+		return nil
+	}
+	if !h.UseMsgBytes {
+		pack.Message.AddField(field)
+		return unframed
+	}
+	tagged, err := prependEncodedField(unframed, field)
+	if err != nil {
+		h.sr.LogError(err)
+		return nil
+	}
+	return tagged
 }
 
 func init() {
@@ -17,12 +17,17 @@ package pipeline
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
 	"io"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
+	"heka/client"
 	"heka/message"
 	ts "heka/pipeline/testsupport"
 	gs "github.com/rafrombrc/gospec/src/gospec"
@@ -424,9 +429,82 @@ func HekaFramingSpec(c gs.Context) {
 			c.Expect(string(record), gs.Equals, string(b[5:]))
 		})
 
+		c.Specify("with v2 framing", func() {
+			frame := func(payload string) []byte {
+				msg := ts.GetTestMessage()
+				msg.SetPayload(payload)
+				mbytes, _ := proto.Marshal(msg)
+				var framed []byte
+				c.Assume(client.CreateHekaStreamV2(mbytes, &framed, nil), gs.IsNil)
+				return framed
+			}
+			first, second, third := frame("first"), frame("second"), frame("third")
+			v1 := []byte("\x1e\x02\x08\x3e\x1f\x0a\x10\x90\x1d\x56\x27\xec\x49\x4c\x8f\xba\x8e\x84\x9b\xaa\xf7\xa6\xf6\x10\xa6\x97\x8a\x8f\xb6\xc1\xae\x8e\x13\x1a\x09\x68\x65\x6b\x61\x62\x65\x6e\x63\x68\x28\x06\x3a\x03\x30\x2e\x38\x40\xbf\xe5\x01\x4a\x0a\x74\x72\x69\x6e\x6b\x2d\x78\x32\x33\x30")
+			err := splitter.Init(config)
+			c.Assume(err, gs.IsNil)
+			pack := NewPipelinePack(make(chan *PipelinePack, 1))
+
+			c.Specify("splits v1 and v2 records", func() {
+				var b []byte
+				b = append(append(append(b, first...), v1...), second...)
+				reader := bytes.NewReader(b)
+				for _, expected := range [][]byte{first, v1, second} {
+					_, record, err := sRunner.GetRecordFromStream(reader)
+					c.Expect(err, gs.IsNil)
+					c.Expect(string(record), gs.Equals, string(expected))
+				}
+
+				msg := new(message.Message)
+				unframed := splitter.UnframeRecord(first, pack)
+				c.Assume(proto.Unmarshal(unframed, msg), gs.IsNil)
+				c.Expect(msg.GetPayload(), gs.Equals, "first")
+			})
+
+			c.Specify("skips a corrupted record and resyncs", func() {
+				corrupted := append([]byte{}, second...)
+				corrupted[len(corrupted)-2] ^= 0xff
+				var b []byte
+				b = append(append(append(b, first...), corrupted...), third...)
+				reader := bytes.NewReader(b)
+				_, record, err := sRunner.GetRecordFromStream(reader)
+				c.Expect(err, gs.IsNil)
+				c.Expect(string(record), gs.Equals, string(first))
+				_, record, err = sRunner.GetRecordFromStream(reader)
+				c.Expect(err, gs.IsNil)
+				c.Expect(string(record), gs.Equals, string(third))
+			})
+
+			c.Specify("resyncs when a corrupted length overlaps the next record", func() {
+				corrupted := append([]byte{}, second...)
+				// Claim more message bytes than there are, swallowing the
+				// start of the next record.
+				c.Assume(corrupted[7], gs.Equals, byte(len(second)-
+					message.FRAME_V2_FRAMING_SIZE-int(corrupted[5])))
+				corrupted[7] += 20
+				var b []byte
+				b = append(append(append(b, first...), corrupted...), third...)
+				reader := bytes.NewReader(b)
+				_, record, err := sRunner.GetRecordFromStream(reader)
+				c.Expect(err, gs.IsNil)
+				c.Expect(string(record), gs.Equals, string(first))
+				_, record, err = sRunner.GetRecordFromStream(reader)
+				c.Expect(err, gs.IsNil)
+				c.Expect(string(record), gs.Equals, string(third))
+			})
+
+			c.Specify("resyncs past a long run of bad record separators", func() {
+				b := bytes.Repeat([]byte{message.RECORD_SEPARATOR, 0, 'X', 'X', 'X'},
+					200000)
+				b = append(b, third...)
+				n, record := splitter.FindRecord(b)
+				c.Expect(n, gs.Equals, len(b))
+				c.Expect(string(record), gs.Equals, string(third))
+			})
+		})
+
 		c.Specify("using authentication", func() {
 			key := "testkey"
-			config.Signers = map[string]Signer{"test_1": {key}}
+			config.Signers = map[string]Signer{"test_1": {HmacKey: key}}
 			signer := "test"
 			recycleChan := make(chan *PipelinePack, 1)
 			pack := NewPipelinePack(recycleChan)
@@ -510,6 +588,217 @@ func HekaFramingSpec(c gs.Context) {
 				// to true, but `gs.IsNil` doesn't work here.
 				c.Expect(string(unframed), gs.Equals, "")
 			})
+
+			c.Specify("doesn't auth MD5 signed message in FIPS mode", func() {
+				SetFipsMode(true)
+				defer SetFipsMode(false)
+				err := splitter.Init(config)
+				c.Assume(err, gs.IsNil)
+
+				header.SetHmacHashFunction(message.Header_MD5)
+				header.SetHmacSigner(signer)
+				header.SetHmacKeyVersion(uint32(1))
+				hm := hmac.New(md5.New, []byte(key))
+				hm.Write(mbytes)
+				header.SetHmac(hm.Sum(nil))
+				hbytes, _ := proto.Marshal(header)
+
+				framed := encodeMessage(hbytes, mbytes)
+				unframed := splitter.UnframeRecord(framed, pack)
+				c.Expect(pack.Signer, gs.Equals, "")
+				c.Expect(string(unframed), gs.Equals, "")
+			})
+
+			c.Specify("authenticates SHA256 signed message", func() {
+				err := splitter.Init(config)
+				c.Assume(err, gs.IsNil)
+
+				header.SetHmacHashFunction(message.Header_SHA256)
+				header.SetHmacSigner(signer)
+				header.SetHmacKeyVersion(uint32(1))
+				hm := hmac.New(sha256.New, []byte(key))
+				hm.Write(mbytes)
+				header.SetHmac(hm.Sum(nil))
+				hbytes, _ := proto.Marshal(header)
+
+				framed := encodeMessage(hbytes, mbytes)
+				unframed := splitter.UnframeRecord(framed, pack)
+				c.Expect(pack.Signer, gs.Equals, "test")
+				c.Expect(string(unframed), gs.Equals, string(mbytes))
+			})
+
+			c.Specify("using Ed25519 signatures", func() {
+				pub, priv, err := ed25519.GenerateKey(nil)
+				c.Assume(err, gs.IsNil)
+				config.Signers["test_2"] = Signer{
+					Ed25519PublicKey: base64.StdEncoding.EncodeToString(pub),
+				}
+
+				c.Specify("is refused in FIPS mode", func() {
+					SetFipsMode(true)
+					defer SetFipsMode(false)
+					c.Expect(splitter.Init(config), gs.Not(gs.IsNil))
+				})
+
+				err = splitter.Init(config)
+				c.Assume(err, gs.IsNil)
+
+				header.SetHmacHashFunction(message.Header_ED25519)
+				header.SetHmacSigner(signer)
+				header.SetHmacKeyVersion(uint32(2))
+
+				c.Specify("authenticates a valid signature", func() {
+					header.SetHmac(ed25519.Sign(priv, mbytes))
+					hbytes, _ := proto.Marshal(header)
+
+					framed := encodeMessage(hbytes, mbytes)
+					unframed := splitter.UnframeRecord(framed, pack)
+					c.Expect(pack.Signer, gs.Equals, "test")
+					c.Expect(string(unframed), gs.Equals, string(mbytes))
+				})
+
+				c.Specify("doesn't auth an invalid signature", func() {
+					header.SetHmac(ed25519.Sign(priv, []byte("some bytes")))
+					hbytes, _ := proto.Marshal(header)
+
+					framed := encodeMessage(hbytes, mbytes)
+					unframed := splitter.UnframeRecord(framed, pack)
+					c.Expect(pack.Signer, gs.Equals, "")
+					c.Expect(string(unframed), gs.Equals, "")
+				})
+
+				c.Specify("doesn't auth a signer with only an hmac key", func() {
+					header.SetHmacKeyVersion(uint32(1))
+					header.SetHmac(ed25519.Sign(priv, mbytes))
+					hbytes, _ := proto.Marshal(header)
+
+					framed := encodeMessage(hbytes, mbytes)
+					unframed := splitter.UnframeRecord(framed, pack)
+					c.Expect(pack.Signer, gs.Equals, "")
+					c.Expect(string(unframed), gs.Equals, "")
+				})
+			})
+
+			c.Specify("rotating keys", func() {
+				newKey := "newtestkey"
+				config.Signers["test_2"] = Signer{HmacKey: newKey}
+				sign := func(version uint32, k string) []byte {
+					header.SetHmacHashFunction(message.Header_SHA256)
+					header.SetHmacSigner(signer)
+					header.SetHmacKeyVersion(version)
+					hm := hmac.New(sha256.New, []byte(k))
+					hm.Write(mbytes)
+					header.SetHmac(hm.Sum(nil))
+					hbytes, _ := proto.Marshal(header)
+					return encodeMessage(hbytes, mbytes)
+				}
+
+				c.Specify("accepts overlapping key versions", func() {
+					err := splitter.Init(config)
+					c.Assume(err, gs.IsNil)
+
+					unframed := splitter.UnframeRecord(sign(1, key), pack)
+					c.Expect(string(unframed), gs.Equals, string(mbytes))
+					pack.Signer = ""
+					unframed = splitter.UnframeRecord(sign(2, newKey), pack)
+					c.Expect(pack.Signer, gs.Equals, "test")
+					c.Expect(string(unframed), gs.Equals, string(mbytes))
+				})
+
+				c.Specify("doesn't auth an expired key version", func() {
+					config.Signers["test_1"] = Signer{HmacKey: key,
+						Expires: time.Now().Add(-time.Hour).Format(time.RFC3339)}
+					err := splitter.Init(config)
+					c.Assume(err, gs.IsNil)
+
+					unframed := splitter.UnframeRecord(sign(1, key), pack)
+					c.Expect(pack.Signer, gs.Equals, "")
+					c.Expect(string(unframed), gs.Equals, "")
+					unframed = splitter.UnframeRecord(sign(2, newKey), pack)
+					c.Expect(pack.Signer, gs.Equals, "test")
+					c.Expect(string(unframed), gs.Equals, string(mbytes))
+				})
+
+				c.Specify("fails to init with an invalid expiry", func() {
+					config.Signers["test_1"] = Signer{HmacKey: key, Expires: "tomorrow"}
+					err := splitter.Init(config)
+					c.Expect(err, gs.Not(gs.IsNil))
+				})
+			})
+
+			c.Specify("with a verification policy", func() {
+				unsignedHeader := &message.Header{}
+				unsignedHeader.SetMessageLength(uint32(len(mbytes)))
+				hbytes, _ := proto.Marshal(unsignedHeader)
+				unsigned := encodeMessage(hbytes, mbytes)
+
+				header.SetHmacHashFunction(message.Header_MD5)
+				header.SetHmacSigner(signer)
+				header.SetHmacKeyVersion(uint32(1))
+				header.SetHmac([]byte("not a real digest"))
+				hbytes, _ = proto.Marshal(header)
+				badlySigned := encodeMessage(hbytes, mbytes)
+
+				c.Specify("passes unsigned messages by default", func() {
+					err := splitter.Init(config)
+					c.Assume(err, gs.IsNil)
+					unframed := splitter.UnframeRecord(unsigned, pack)
+					c.Expect(string(unframed), gs.Equals, string(mbytes))
+				})
+
+				c.Specify("rejects unsigned messages", func() {
+					config.VerificationPolicy = "reject"
+					err := splitter.Init(config)
+					c.Assume(err, gs.IsNil)
+					unframed := splitter.UnframeRecord(unsigned, pack)
+					c.Expect(string(unframed), gs.Equals, "")
+				})
+
+				validHeader := &message.Header{}
+				validHeader.SetMessageLength(uint32(len(mbytes)))
+				validHeader.SetHmacHashFunction(message.Header_SHA256)
+				validHeader.SetHmacSigner(signer)
+				validHeader.SetHmacKeyVersion(uint32(1))
+				hm := hmac.New(sha256.New, []byte(key))
+				hm.Write(mbytes)
+				validHeader.SetHmac(hm.Sum(nil))
+				hbytes, _ = proto.Marshal(validHeader)
+				signed := encodeMessage(hbytes, mbytes)
+
+				c.Specify("tags every message with its signature status", func() {
+					config.VerificationPolicy = "tag"
+					err := splitter.Init(config)
+					c.Assume(err, gs.IsNil)
+
+					for record, status := range map[string]string{
+						string(unsigned):    "unsigned",
+						string(badlySigned): "invalid",
+						string(signed):      "valid",
+					} {
+						pack.Signer = ""
+						unframed := splitter.UnframeRecord([]byte(record), pack)
+						if status == "valid" {
+							c.Expect(pack.Signer, gs.Equals, signer)
+						} else {
+							c.Expect(pack.Signer, gs.Equals, "")
+						}
+						decoded := &message.Message{}
+						err = proto.Unmarshal(unframed, decoded)
+						c.Expect(err, gs.IsNil)
+						c.Expect(decoded.GetPayload(), gs.Equals, msg.GetPayload())
+						val, ok := decoded.GetFieldValue("SignatureStatus")
+						c.Expect(ok, gs.IsTrue)
+						c.Expect(val, gs.Equals, status)
+						c.Expect(len(decoded.Fields), gs.Equals, len(msg.Fields)+1)
+					}
+				})
+
+				c.Specify("fails to init with an unknown policy", func() {
+					config.VerificationPolicy = "maybe"
+					err := splitter.Init(config)
+					c.Expect(err, gs.Not(gs.IsNil))
+				})
+			})
 		})
 	})
 }
@@ -0,0 +1,185 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// Writes a dump of the state of the pipelines to a timestamped file under
+// base_dir/dumps, for diagnosing problems that come and go without having to
+// stop hekad. Returns the file's path.
+func writeStateDump(configs []*PipelineConfig) (string, error) {
+	now := time.Now()
+	dir := filepath.Join(configs[0].Globals.root().BaseDir, "dumps")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("hekad-state-%s.txt",
+		now.UTC().Format("20060102T150405.000Z")))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if err = dumpState(file, configs, now); err != nil {
+		return path, err
+	}
+	return path, file.Sync()
+}
+
+// Writes the state dump. The reports come last, since calling into a wedged
+// plugin for its report can block, and everything before them is flushed
+// first so that the rest of the dump isn't lost if it does.
+func dumpState(dest io.Writer, configs []*PipelineConfig, now time.Time) error {
+	w := bufio.NewWriter(dest)
+	globals := configs[0].Globals.root()
+	fmt.Fprintln(w, "Heka state dump")
+	fmt.Fprintf(w, "Time: %s\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "Version: %s\n", globals.Version)
+	fmt.Fprintf(w, "Hostname: %s\n", globals.Hostname)
+	fmt.Fprintf(w, "Pid: %d\n", os.Getpid())
+	fmt.Fprintf(w, "Goroutines: %d\n", runtime.NumGoroutine())
+
+	for _, pc := range configs {
+		if pc.Globals.Pipeline != "" {
+			fmt.Fprintf(w, "\n========[pipeline %s]========\n", pc.Globals.Pipeline)
+		}
+		fmt.Fprintf(w, "Config hash: %s\n", pc.configHash())
+		pc.dumpChannels(w)
+		pc.dumpBuffers(w)
+		pc.dumpConfig(w)
+	}
+
+	fmt.Fprintln(w, "\n========[goroutines]========")
+	w.Write(goroutineStacks())
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, pc := range configs {
+		if pc.Globals.Pipeline != "" {
+			fmt.Fprintf(w, "\n========[pipeline %s]========\n", pc.Globals.Pipeline)
+		}
+		fmt.Fprintln(w, pc.FormatTextReport(pc.allReportsData()))
+	}
+	return w.Flush()
+}
+
+// Returns the SHA-256 digest of the config files the pipeline was loaded
+// from, after environment variable substitution, so dumps from different
+// hosts can be checked for running the same config.
+func (pc *PipelineConfig) configHash() string {
+	if pc.configDigest == nil {
+		return "none"
+	}
+	return "sha256:" + hex.EncodeToString(pc.configDigest.Sum(nil))
+}
+
+// Writes the effective config of each plugin, with its secrets redacted.
+func (pc *PipelineConfig) dumpConfig(w io.Writer) {
+	fmt.Fprintln(w, "\n====Config====")
+	errs, err := pc.writeEffectiveConfig(w, pc.allMakers())
+	for _, e := range errs {
+		fmt.Fprintln(w, e)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "Can't write config: %s\n", err)
+	}
+}
+
+// Writes the length and capacity of each of the pipeline's channels.
+func (pc *PipelineConfig) dumpChannels(w io.Writer) {
+	fmt.Fprintln(w, "\n====Channels====")
+	dumpChan := func(name string, length, capacity int) {
+		fmt.Fprintf(w, "%s: %d/%d\n", name, length, capacity)
+	}
+	dumpChan("inputRecycleChan", len(pc.inputRecycleChan), cap(pc.inputRecycleChan))
+	dumpChan("injectRecycleChan", len(pc.injectRecycleChan), cap(pc.injectRecycleChan))
+	dumpChan("Router", len(pc.router.inChan), cap(pc.router.inChan))
+
+	pc.allDecodersLock.RLock()
+	for _, runner := range pc.allDecoders {
+		dumpChan(runner.Name(), len(runner.InChan()), cap(runner.InChan()))
+	}
+	pc.allDecodersLock.RUnlock()
+
+	for _, fo := range pc.foRunners() {
+		dumpChan(fo.name, len(fo.inChan), cap(fo.inChan))
+		if fo.matcher != nil && fo.instanceOf == nil {
+			dumpChan(fo.name+" matcher", len(fo.matcher.inChan), cap(fo.matcher.inChan))
+		}
+	}
+}
+
+// Writes the disk buffer usage of the pipeline's filters and outputs.
+func (pc *PipelineConfig) dumpBuffers(w io.Writer) {
+	fmt.Fprintln(w, "\n====Buffers====")
+	for _, fo := range pc.foRunners() {
+		if !fo.useBuffering || fo.bufReader == nil {
+			continue
+		}
+		br := fo.bufReader
+		fmt.Fprintf(w, "%s: %d bytes queued, max_buffer_size %d, full_action %q\n",
+			fo.name, br.queueSize.Get(), br.config.MaxBufferSize, br.config.FullAction)
+	}
+}
+
+// Returns the pipeline's filter and output runners, sorted by name.
+func (pc *PipelineConfig) foRunners() []*foRunner {
+	var runners []*foRunner
+	pc.filtersLock.RLock()
+	for _, runner := range pc.FilterRunners {
+		if fo, ok := runner.(*foRunner); ok {
+			runners = append(runners, fo)
+		}
+	}
+	pc.filtersLock.RUnlock()
+	pc.outputsLock.RLock()
+	for _, runner := range pc.OutputRunners {
+		if fo, ok := runner.(*foRunner); ok {
+			runners = append(runners, fo)
+		}
+	}
+	pc.outputsLock.RUnlock()
+	sort.Sort(foRunnersByName(runners))
+	return runners
+}
+
+type foRunnersByName []*foRunner
+
+func (r foRunnersByName) Len() int           { return len(r) }
+func (r foRunnersByName) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r foRunnersByName) Less(i, j int) bool { return r[i].name < r[j].name }
+
+// Returns the stack traces of all goroutines.
+func goroutineStacks() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,91 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func StateDumpSpec(c gs.Context) {
+	baseDir, err := ioutil.TempDir("", "state-dump")
+	c.Assume(err, gs.IsNil)
+	defer os.RemoveAll(baseDir)
+	globals := DefaultGlobals()
+	globals.BaseDir = baseDir
+	pConfig := NewPipelineConfig(globals)
+	pConfig.reportRecycleChan <- NewPipelinePack(pConfig.reportRecycleChan)
+	pConfig.FilterRunners["CounterFilter"] = &foRunner{
+		pRunnerBase: pRunnerBase{name: "CounterFilter"},
+		inChan:      make(chan *PipelinePack, 10),
+		matcher:     &MatchRunner{inChan: make(chan *PipelinePack, 5)},
+	}
+
+	c.Specify("A state dump", func() {
+		dump := func() string {
+			path, err := writeStateDump([]*PipelineConfig{pConfig})
+			c.Assume(err, gs.IsNil)
+			c.Expect(filepath.Dir(path), gs.Equals, filepath.Join(baseDir, "dumps"))
+			contents, err := ioutil.ReadFile(path)
+			c.Assume(err, gs.IsNil)
+			return string(contents)
+		}
+
+		c.Specify("is written under base_dir", func() {
+			contents := dump()
+			c.Expect(strings.HasPrefix(contents, "Heka state dump\n"), gs.IsTrue)
+			c.Expect(strings.Contains(contents, "Config hash: none\n"), gs.IsTrue)
+			c.Expect(strings.Contains(contents, "inputRecycleChan: 0/100\n"), gs.IsTrue)
+			c.Expect(strings.Contains(contents, "CounterFilter: 0/10\n"), gs.IsTrue)
+			c.Expect(strings.Contains(contents, "CounterFilter matcher: 0/5\n"), gs.IsTrue)
+			c.Expect(strings.Contains(contents, "====Config====\n"), gs.IsTrue)
+			c.Expect(strings.Contains(contents, "goroutine "), gs.IsTrue)
+			c.Expect(strings.Contains(contents, "[heka.all-report]"), gs.IsTrue)
+		})
+
+		c.Specify("includes the config hash", func() {
+			err := pConfig.PreloadFromConfigFile(filepath.Join(".", "testsupport",
+				"config_test_instances.toml"))
+			c.Assume(err, gs.IsNil)
+			c.Expect(strings.Contains(dump(), "Config hash: sha256:"), gs.IsTrue)
+		})
+
+		c.Specify("is written when the admin API is posted to", func() {
+			handler := &adminHandler{configs: []*PipelineConfig{pConfig}}
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/dump", nil)
+			handler.ServeHTTP(recorder, req)
+			c.Expect(recorder.Code, gs.Equals, http.StatusMethodNotAllowed)
+
+			recorder = httptest.NewRecorder()
+			req, _ = http.NewRequest("POST", "/dump", nil)
+			handler.ServeHTTP(recorder, req)
+			c.Assume(recorder.Code, gs.Equals, http.StatusOK)
+			var resp map[string]string
+			c.Assume(json.Unmarshal(recorder.Body.Bytes(), &resp), gs.IsNil)
+			c.Expect(filepath.Dir(resp["path"]), gs.Equals, filepath.Join(baseDir, "dumps"))
+			contents, err := ioutil.ReadFile(resp["path"])
+			c.Assume(err, gs.IsNil)
+			c.Expect(strings.HasPrefix(string(contents), "Heka state dump\n"), gs.IsTrue)
+		})
+	})
+}
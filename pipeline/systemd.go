@@ -0,0 +1,111 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Sends a state notification (e.g. "READY=1") to systemd. Returns false w/o
+// an error if hekad isn't running as a systemd `Type=notify` service.
+func sdNotify(state string) (sent bool, err error) {
+	socketAddr := os.Getenv("NOTIFY_SOCKET")
+	if socketAddr == "" {
+		return false, nil
+	}
+	addr := &net.UnixAddr{Name: socketAddr, Net: "unixgram"}
+	if socketAddr[0] == '@' {
+		// Abstract socket.
+		addr.Name = "\x00" + socketAddr[1:]
+	}
+	conn, err := net.DialUnix(addr.Net, nil, addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Returns the interval within which systemd expects watchdog pings, or zero
+// if the watchdog isn't enabled for this process.
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Liveness check used to decide whether or not to ping the systemd
+// watchdog. The pipeline is considered wedged if the router hasn't processed
+// any messages since the last check while both pack pools are exhausted,
+// i.e. messages are stuck somewhere and no new ones can enter.
+type livenessCheck struct {
+	pc        *PipelineConfig
+	lastCount int64
+}
+
+func (l *livenessCheck) alive() bool {
+	count := atomic.LoadInt64(&l.pc.router.processMessageCount)
+	progressed := count != l.lastCount
+	l.lastCount = count
+	return progressed || len(l.pc.inputRecycleChan) > 0 ||
+		len(l.pc.injectRecycleChan) > 0
+}
+
+// Pings the systemd watchdog at half the required interval for as long as
+// every pipeline passes its liveness check, until stopChan is closed. Once
+// pings stop, systemd will consider hekad hung and restart it.
+func sdWatchdog(configs []*PipelineConfig, interval time.Duration,
+	stopChan chan struct{}) {
+
+	checks := make([]*livenessCheck, len(configs))
+	for i, pc := range configs {
+		checks[i] = &livenessCheck{pc: pc}
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			wedged := false
+			for _, check := range checks {
+				// Every check runs, to keep their counts current.
+				if !check.alive() {
+					wedged = true
+				}
+			}
+			if wedged {
+				LogError.Println("Pipeline appears wedged, skipping systemd watchdog ping")
+				continue
+			}
+			if _, err := sdNotify("WATCHDOG=1"); err != nil {
+				LogError.Printf("Can't ping systemd watchdog: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func SystemdSpec(c gs.Context) {
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	c.Specify("sdNotify", func() {
+		c.Specify("is a no-op w/o NOTIFY_SOCKET", func() {
+			os.Unsetenv("NOTIFY_SOCKET")
+			sent, err := sdNotify("READY=1")
+			c.Expect(err, gs.IsNil)
+			c.Expect(sent, gs.IsFalse)
+		})
+
+		if runtime.GOOS != "windows" {
+			c.Specify("sends the state to the notify socket", func() {
+				tmpDir, err := ioutil.TempDir("", "systemd-tests")
+				c.Assume(err, gs.IsNil)
+				defer os.RemoveAll(tmpDir)
+				sockPath := filepath.Join(tmpDir, "notify.sock")
+				conn, err := net.ListenUnixgram("unixgram",
+					&net.UnixAddr{Name: sockPath, Net: "unixgram"})
+				c.Assume(err, gs.IsNil)
+				defer conn.Close()
+
+				os.Setenv("NOTIFY_SOCKET", sockPath)
+				sent, err := sdNotify("READY=1")
+				c.Expect(err, gs.IsNil)
+				c.Expect(sent, gs.IsTrue)
+
+				buf := make([]byte, 64)
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				n, err := conn.Read(buf)
+				c.Expect(err, gs.IsNil)
+				c.Expect(string(buf[:n]), gs.Equals, "READY=1")
+			})
+		}
+	})
+
+	c.Specify("sdWatchdogInterval", func() {
+		os.Setenv("WATCHDOG_USEC", "30000000")
+		os.Unsetenv("WATCHDOG_PID")
+		c.Expect(sdWatchdogInterval(), gs.Equals, 30*time.Second)
+
+		os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+		c.Expect(sdWatchdogInterval(), gs.Equals, 30*time.Second)
+
+		os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+		c.Expect(sdWatchdogInterval(), gs.Equals, time.Duration(0))
+
+		os.Unsetenv("WATCHDOG_USEC")
+		os.Unsetenv("WATCHDOG_PID")
+		c.Expect(sdWatchdogInterval(), gs.Equals, time.Duration(0))
+	})
+
+	c.Specify("The liveness check", func() {
+		globals := DefaultGlobals()
+		globals.PoolSize = 1
+		pConfig := NewPipelineConfig(globals)
+		check := &livenessCheck{pc: pConfig}
+		pack := NewPipelinePack(pConfig.inputRecycleChan)
+
+		c.Specify("passes while packs are available", func() {
+			pConfig.inputRecycleChan <- pack
+			c.Expect(check.alive(), gs.IsTrue)
+			c.Expect(check.alive(), gs.IsTrue)
+		})
+
+		c.Specify("passes while the router makes progress", func() {
+			pConfig.router.processMessageCount = 5
+			c.Expect(check.alive(), gs.IsTrue)
+			c.Expect(check.alive(), gs.IsFalse)
+			pConfig.router.processMessageCount = 6
+			c.Expect(check.alive(), gs.IsTrue)
+		})
+	})
+}
@@ -0,0 +1,219 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+)
+
+// Returned by InputRunner.Inject when a message is dropped because its
+// tenant is over quota.
+var ErrTenantQuota = errors.New("tenant quota exceeded")
+
+// Name of the tenant state shared by tenants seen after MaxTenants distinct
+// unlisted tenants have already been tracked.
+const overflowTenant = "*"
+
+// Limits applied to the messages of a single tenant. Zero means unlimited.
+type TenantQuota struct {
+	// Maximum sustained rate of messages per second, with bursts of up to
+	// one second's worth allowed.
+	MaxMsgsPerSec uint `toml:"max_msgs_per_sec"`
+	// Maximum total size of the tenant's messages that may be in flight
+	// (i.e. injected into the router but not yet fully processed) at once.
+	MaxBufferBytes uint64 `toml:"max_buffer_bytes"`
+}
+
+// Tenancy settings, from the `[hekad.tenancy]` config section.
+type TenancyConfig struct {
+	// Message field holding the tenant name. Defaults to "Tenant".
+	Field string `toml:"field"`
+	// Quota for any tenant that isn't listed in Tenants.
+	Default TenantQuota `toml:"default"`
+	// Per-tenant quotas, keyed by tenant name.
+	Tenants map[string]TenantQuota `toml:"tenants"`
+	// Maximum number of distinct unlisted tenants tracked individually,
+	// beyond which they share a single "*" tenant. Defaults to 1024.
+	MaxTenants int `toml:"max_tenants"`
+	// Tenant charged for messages that have no tenant. Defaults to
+	// "untagged".
+	UntaggedTenant string `toml:"untagged_tenant"`
+}
+
+type tenantState struct {
+	name   string
+	quota  TenantQuota
+	bucket *tokenBucket
+	// Accessed atomically.
+	bufferBytes int64
+	accepted    int64
+	rateDrops   int64
+	bufferDrops int64
+}
+
+// Called when a pack charged to this tenant is recycled.
+func (ts *tenantState) release(size int) {
+	atomic.AddInt64(&ts.bufferBytes, -int64(size))
+}
+
+// TenantRegistry enforces per-tenant quotas on messages that inputs have
+// tagged with a tenant name, and tracks per-tenant metrics.
+type TenantRegistry struct {
+	field      string
+	untagged   string
+	conf       *TenancyConfig
+	maxTenants int
+	lock       sync.RWMutex
+	tenants    map[string]*tenantState
+	unlisted   int
+	now        func() time.Time
+}
+
+func NewTenantRegistry(conf *TenancyConfig) *TenantRegistry {
+	tr := &TenantRegistry{
+		field:      conf.Field,
+		untagged:   conf.UntaggedTenant,
+		conf:       conf,
+		maxTenants: conf.MaxTenants,
+		tenants:    make(map[string]*tenantState),
+		now:        time.Now,
+	}
+	if tr.field == "" {
+		tr.field = "Tenant"
+	}
+	if tr.untagged == "" {
+		tr.untagged = "untagged"
+	}
+	if tr.maxTenants <= 0 {
+		tr.maxTenants = 1024
+	}
+	return tr
+}
+
+// Field returns the name of the message field that holds the tenant name.
+func (tr *TenantRegistry) Field() string {
+	return tr.field
+}
+
+func (tr *TenantRegistry) newState(name string, quota TenantQuota) *tenantState {
+	ts := &tenantState{name: name, quota: quota}
+	ts.bucket = newTokenBucket(quota.MaxMsgsPerSec, tr.now())
+	tr.tenants[name] = ts
+	return ts
+}
+
+func (tr *TenantRegistry) state(name string) *tenantState {
+	tr.lock.RLock()
+	ts, ok := tr.tenants[name]
+	tr.lock.RUnlock()
+	if ok {
+		return ts
+	}
+
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	if ts, ok = tr.tenants[name]; ok {
+		return ts
+	}
+	if quota, listed := tr.conf.Tenants[name]; listed {
+		return tr.newState(name, quota)
+	}
+	if tr.unlisted >= tr.maxTenants {
+		if ts, ok = tr.tenants[overflowTenant]; ok {
+			return ts
+		}
+		return tr.newState(overflowTenant, tr.conf.Default)
+	}
+	tr.unlisted++
+	return tr.newState(name, tr.conf.Default)
+}
+
+// Admit charges the pack to its tenant, or to the untagged tenant if it has
+// none, returning false if doing so would exceed the tenant's quota. The
+// pack's MsgBytes must already be encoded.
+func (tr *TenantRegistry) Admit(pack *PipelinePack) bool {
+	if pack.tenant != nil {
+		// Already charged, e.g. when a pack is re-injected.
+		return true
+	}
+	tenantName := tr.untagged
+	if name, ok := pack.Message.GetFieldValue(tr.field); ok {
+		if s, ok := name.(string); ok && s != "" {
+			tenantName = s
+		}
+	}
+	ts := tr.state(tenantName)
+	// The buffer space is reserved first, so that a pack dropped for it
+	// doesn't use up a rate limit token too.
+	size := len(pack.MsgBytes)
+	if max := ts.quota.MaxBufferBytes; max > 0 {
+		if atomic.AddInt64(&ts.bufferBytes, int64(size)) > int64(max) {
+			ts.release(size)
+			atomic.AddInt64(&ts.bufferDrops, 1)
+			return false
+		}
+	} else {
+		atomic.AddInt64(&ts.bufferBytes, int64(size))
+	}
+	if !ts.bucket.take(tr.now()) {
+		ts.release(size)
+		atomic.AddInt64(&ts.rateDrops, 1)
+		return false
+	}
+	pack.tenant = ts
+	pack.tenantBytes = size
+	atomic.AddInt64(&ts.accepted, 1)
+	return true
+}
+
+// Generates a report message for each known tenant, using packs from the
+// provided recycle channel.
+func (tr *TenantRegistry) reports(recycleChan, reportChan chan *PipelinePack) {
+
+	tr.lock.RLock()
+	names := make([]string, 0, len(tr.tenants))
+	for name := range tr.tenants {
+		names = append(names, name)
+	}
+	tr.lock.RUnlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		tr.lock.RLock()
+		ts := tr.tenants[name]
+		tr.lock.RUnlock()
+		pack := <-recycleChan
+		msg := pack.Message
+		message.NewInt64Field(msg, "ProcessMessageCount",
+			atomic.LoadInt64(&ts.accepted), "count")
+		message.NewInt64Field(msg, "RateDropCount",
+			atomic.LoadInt64(&ts.rateDrops), "count")
+		message.NewInt64Field(msg, "BufferDropCount",
+			atomic.LoadInt64(&ts.bufferDrops), "count")
+		message.NewInt64Field(msg, "BufferBytes",
+			atomic.LoadInt64(&ts.bufferBytes), "B")
+		msg.SetLogger(HEKA_DAEMON)
+		msg.SetType("heka.tenant-report")
+		message.NewStringField(msg, "name", name)
+		message.NewStringField(msg, "key", "tenants")
+		reportChan <- pack
+	}
+}
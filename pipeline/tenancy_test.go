@@ -0,0 +1,212 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+)
+
+func TenancySpec(c gs.Context) {
+	recycleChan := make(chan *PipelinePack, 10)
+	newPack := func(tenant string, size int) *PipelinePack {
+		pack := NewPipelinePack(recycleChan)
+		if tenant != "" {
+			message.NewStringField(pack.Message, "Tenant", tenant)
+		}
+		pack.MsgBytes = make([]byte, size)
+		return pack
+	}
+
+	c.Specify("A TenantRegistry", func() {
+		conf := &TenancyConfig{
+			Default: TenantQuota{MaxMsgsPerSec: 2},
+			Tenants: map[string]TenantQuota{
+				"acme": {MaxBufferBytes: 100},
+			},
+		}
+		now := time.Unix(1000, 0)
+		tr := NewTenantRegistry(conf)
+		tr.now = func() time.Time { return now }
+
+		c.Specify("charges packs w/o a tenant to the untagged tenant", func() {
+			c.Expect(tr.Admit(newPack("", 10)), gs.IsTrue)
+			c.Expect(tr.Admit(newPack("", 10)), gs.IsTrue)
+			c.Expect(tr.Admit(newPack("", 10)), gs.IsFalse)
+			c.Expect(len(tr.tenants), gs.Equals, 1)
+			ts := tr.tenants["untagged"]
+			c.Expect(ts.accepted, gs.Equals, int64(2))
+			c.Expect(ts.rateDrops, gs.Equals, int64(1))
+		})
+
+		c.Specify("charges untagged packs to a configured tenant", func() {
+			conf.UntaggedTenant = "acme"
+			tr = NewTenantRegistry(conf)
+			c.Expect(tr.Admit(newPack("", 60)), gs.IsTrue)
+			c.Expect(tr.Admit(newPack("acme", 60)), gs.IsFalse)
+			c.Expect(tr.tenants["acme"].bufferBytes, gs.Equals, int64(60))
+		})
+
+		c.Specify("rate limits tenants", func() {
+			c.Expect(tr.Admit(newPack("other", 10)), gs.IsTrue)
+			c.Expect(tr.Admit(newPack("other", 10)), gs.IsTrue)
+			c.Expect(tr.Admit(newPack("other", 10)), gs.IsFalse)
+			// Tenants are limited independently.
+			c.Expect(tr.Admit(newPack("another", 10)), gs.IsTrue)
+
+			now = now.Add(500 * time.Millisecond)
+			c.Expect(tr.Admit(newPack("other", 10)), gs.IsTrue)
+			c.Expect(tr.Admit(newPack("other", 10)), gs.IsFalse)
+
+			ts := tr.tenants["other"]
+			c.Expect(ts.accepted, gs.Equals, int64(3))
+			c.Expect(ts.rateDrops, gs.Equals, int64(2))
+		})
+
+		c.Specify("limits in flight bytes until packs are recycled", func() {
+			first := newPack("acme", 60)
+			c.Expect(tr.Admit(first), gs.IsTrue)
+			c.Expect(tr.Admit(newPack("acme", 60)), gs.IsFalse)
+			ts := tr.tenants["acme"]
+			c.Expect(ts.bufferBytes, gs.Equals, int64(60))
+			c.Expect(ts.bufferDrops, gs.Equals, int64(1))
+
+			first.recycle()
+			c.Expect(ts.bufferBytes, gs.Equals, int64(0))
+			c.Expect(first.tenant == nil, gs.IsTrue)
+			c.Expect(tr.Admit(newPack("acme", 60)), gs.IsTrue)
+		})
+
+		c.Specify("doesn't charge buffer drops to the rate limit", func() {
+			conf.Tenants["acme"] = TenantQuota{MaxMsgsPerSec: 2, MaxBufferBytes: 100}
+			c.Expect(tr.Admit(newPack("acme", 60)), gs.IsTrue)
+			for i := 0; i < 3; i++ {
+				c.Expect(tr.Admit(newPack("acme", 60)), gs.IsFalse)
+			}
+			// The second token is still there for a pack that fits.
+			c.Expect(tr.Admit(newPack("acme", 10)), gs.IsTrue)
+			ts := tr.tenants["acme"]
+			c.Expect(ts.bufferDrops, gs.Equals, int64(3))
+			c.Expect(ts.rateDrops, gs.Equals, int64(0))
+			c.Expect(tr.Admit(newPack("acme", 10)), gs.IsFalse)
+			c.Expect(ts.rateDrops, gs.Equals, int64(1))
+			c.Expect(ts.bufferBytes, gs.Equals, int64(70))
+		})
+
+		c.Specify("shares state between tenants beyond max_tenants", func() {
+			tr.maxTenants = 1
+			c.Expect(tr.Admit(newPack("one", 10)), gs.IsTrue)
+			c.Expect(tr.Admit(newPack("two", 10)), gs.IsTrue)
+			c.Expect(tr.Admit(newPack("three", 10)), gs.IsTrue)
+			c.Expect(tr.Admit(newPack("three", 10)), gs.IsFalse)
+			c.Expect(len(tr.tenants), gs.Equals, 2)
+			c.Expect(tr.tenants[overflowTenant].accepted, gs.Equals, int64(2))
+		})
+
+		c.Specify("generates per-tenant reports", func() {
+			tr.Admit(newPack("acme", 10))
+			reportRecycle := make(chan *PipelinePack, 1)
+			reportChan := make(chan *PipelinePack, 1)
+			reportRecycle <- NewPipelinePack(reportRecycle)
+			go tr.reports(reportRecycle, reportChan)
+			pack := <-reportChan
+			c.Expect(pack.Message.GetType(), gs.Equals, "heka.tenant-report")
+			name, _ := pack.Message.GetFieldValue("name")
+			c.Expect(name, gs.Equals, "acme")
+			count, _ := pack.Message.GetFieldValue("ProcessMessageCount")
+			c.Expect(count, gs.Equals, int64(1))
+			bytes, _ := pack.Message.GetFieldValue("BufferBytes")
+			c.Expect(bytes, gs.Equals, int64(10))
+		})
+	})
+
+	c.Specify("An InputRunner", func() {
+		globals := DefaultGlobals()
+		globals.Tenancy = &TenancyConfig{}
+		pConfig := NewPipelineConfig(globals)
+		ir := &iRunner{pConfig: pConfig}
+
+		c.Specify("stamps its configured tenant over a client supplied one", func() {
+			ir.config.Tenant = "acme"
+			pack := newPack("spoofed", 10)
+			pack.TrustMsgBytes = true
+			ir.stampTenant(pack)
+			c.Expect(len(pack.Message.FindAllFields("Tenant")), gs.Equals, 1)
+			tenant, _ := pack.Message.GetFieldValue("Tenant")
+			c.Expect(tenant, gs.Equals, "acme")
+			c.Expect(pack.TrustMsgBytes, gs.IsFalse)
+		})
+
+		c.Specify("takes its tenant from another field", func() {
+			ir.config.Tenant = "fallback"
+			ir.config.TenantFromField = "Topic"
+			pack := newPack("", 10)
+			message.NewStringField(pack.Message, "Topic", "acme-logs")
+			ir.stampTenant(pack)
+			tenant, _ := pack.Message.GetFieldValue("Tenant")
+			c.Expect(tenant, gs.Equals, "acme-logs")
+
+			pack = newPack("", 10)
+			ir.stampTenant(pack)
+			tenant, _ = pack.Message.GetFieldValue("Tenant")
+			c.Expect(tenant, gs.Equals, "fallback")
+		})
+
+		c.Specify("stamps and limits packs from its async decoder", func() {
+			globals.Tenancy.Default = TenantQuota{MaxMsgsPerSec: 1}
+			pConfig = NewPipelineConfig(globals)
+			ir.pConfig = pConfig
+			ir.config.Tenant = "acme"
+			dr := NewDecoderRunner("decoder", new(ProtobufDecoder), 1).(*dRunner)
+			dr.inject = ir.inject
+			routed := pConfig.router.inChan
+
+			dr.deliver(newPack("spoofed", 10))
+			pack := <-routed
+			tenant, _ := pack.Message.GetFieldValue("Tenant")
+			c.Expect(tenant, gs.Equals, "acme")
+			// Over the tenant's rate, so it's dropped.
+			dr.deliver(newPack("", 10))
+			c.Expect(len(routed), gs.Equals, 0)
+			c.Expect(len(recycleChan), gs.Equals, 1)
+		})
+
+		c.Specify("removes a client supplied tenant w/o tenant settings", func() {
+			pack := newPack("spoofed", 10)
+			pack.TrustMsgBytes = true
+			ir.stampTenant(pack)
+			c.Expect(pack.Message.FindFirstField("Tenant") == nil, gs.IsTrue)
+			c.Expect(pack.TrustMsgBytes, gs.IsFalse)
+		})
+
+		c.Specify("trusts the tenant field when told to take it from there", func() {
+			ir.config.TenantFromField = "Tenant"
+			pack := newPack("acme", 10)
+			ir.stampTenant(pack)
+			tenant, _ := pack.Message.GetFieldValue("Tenant")
+			c.Expect(tenant, gs.Equals, "acme")
+		})
+
+		c.Specify("leaves messages alone w/o tenancy", func() {
+			ir.pConfig = NewPipelineConfig(nil)
+			pack := newPack("client", 10)
+			ir.stampTenant(pack)
+			tenant, _ := pack.Message.GetFieldValue("Tenant")
+			c.Expect(tenant, gs.Equals, "client")
+		})
+	})
+}
@@ -0,0 +1,115 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cactus/gostrftime"
+
+	"heka/message"
+)
+
+// Strftime formats t like the strftime function, with the ISO 8601 week
+// date conversions added: %G for the week-based year, %V for the week of
+// that year (01-53) and %u for the day of the week (1-7, Monday being 1).
+func Strftime(format string, t time.Time) string {
+	if !strings.ContainsAny(format, "GVu") {
+		return gostrftime.Strftime(format, t)
+	}
+	var buf strings.Builder
+	year, week := t.ISOWeek()
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			buf.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'G':
+			buf.WriteString(strconv.Itoa(year))
+		case 'V':
+			fmt.Fprintf(&buf, "%02d", week)
+		case 'u':
+			weekday := int(t.Weekday())
+			if weekday == 0 {
+				weekday = 7
+			}
+			buf.WriteString(strconv.Itoa(weekday))
+		default:
+			// Left for gostrftime, "%%" included.
+			buf.WriteByte('%')
+			buf.WriteByte(format[i])
+		}
+	}
+	return gostrftime.Strftime(buf.String(), t)
+}
+
+// LoadTimezone returns the location of an IANA time zone name, "UTC" for an
+// empty name, or the local time zone for "Local".
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone '%s': %s", name, err)
+	}
+	return loc, nil
+}
+
+// Derives time partition strings, such as the "2015/07/08/15" directory of
+// an hourly partition, from message timestamps in a time zone, so that
+// partitioned outputs all do their date math the same way.
+type TimePartitioner struct {
+	format string
+	loc    *time.Location
+}
+
+// NewTimePartitioner returns a partitioner for a Strftime format, such as
+// "%Y/%m/%d/%H" or "%G-W%V", in the time zone LoadTimezone loads.
+func NewTimePartitioner(format, timezone string) (*TimePartitioner, error) {
+	if format == "" {
+		return nil, errors.New("empty time partition format")
+	}
+	loc, err := LoadTimezone(timezone)
+	if err != nil {
+		return nil, err
+	}
+	return &TimePartitioner{format: format, loc: loc}, nil
+}
+
+// Format returns the partition of t.
+func (p *TimePartitioner) Format(t time.Time) string {
+	return Strftime(p.format, t.In(p.loc))
+}
+
+// Partition returns the partition of the message's timestamp, or of the
+// current time if the message has none.
+func (p *TimePartitioner) Partition(msg *message.Message) string {
+	if msg.Timestamp == nil {
+		return p.Format(time.Now())
+	}
+	return p.Format(time.Unix(0, msg.GetTimestamp()))
+}
+
+// Location returns the partitioner's time zone.
+func (p *TimePartitioner) Location() *time.Location {
+	return p.loc
+}
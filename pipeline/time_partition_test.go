@@ -0,0 +1,75 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"time"
+
+	"heka/message"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func TimePartitionSpec(c gs.Context) {
+	// A Sunday, in ISO week 53 of 2015.
+	ts := time.Date(2016, 1, 3, 23, 30, 0, 0, time.UTC)
+
+	c.Specify("Strftime", func() {
+		c.Specify("formats ISO 8601 week dates", func() {
+			c.Expect(Strftime("%G-W%V-%u", ts), gs.Equals, "2015-W53-7")
+			c.Expect(Strftime("%G-W%V-%u", ts.Add(time.Hour)), gs.Equals, "2016-W01-1")
+		})
+
+		c.Specify("leaves the other conversions to strftime", func() {
+			c.Expect(Strftime("%Y/%m/%d/%H", ts), gs.Equals, "2016/01/03/23")
+			c.Expect(Strftime("100%% %V", ts), gs.Equals, "100% 53")
+		})
+	})
+
+	c.Specify("A TimePartitioner", func() {
+		msg := new(message.Message)
+		msg.SetTimestamp(ts.UnixNano())
+
+		c.Specify("partitions by the message timestamp in UTC by default", func() {
+			p, err := NewTimePartitioner("%Y/%m/%d/%H", "")
+			c.Assume(err, gs.IsNil)
+			c.Expect(p.Partition(msg), gs.Equals, "2016/01/03/23")
+			c.Expect(p.Location(), gs.Equals, time.UTC)
+		})
+
+		c.Specify("partitions in a time zone", func() {
+			p, err := NewTimePartitioner("%Y/%m/%d/%H", "Europe/Berlin")
+			c.Assume(err, gs.IsNil)
+			c.Expect(p.Partition(msg), gs.Equals, "2016/01/04/00")
+			p, err = NewTimePartitioner("%G/W%V", "Europe/Berlin")
+			c.Assume(err, gs.IsNil)
+			c.Expect(p.Partition(msg), gs.Equals, "2016/W01")
+		})
+
+		c.Specify("uses the current time for messages without a timestamp", func() {
+			p, err := NewTimePartitioner("%Y", "")
+			c.Assume(err, gs.IsNil)
+			c.Expect(p.Partition(new(message.Message)), gs.Equals,
+				time.Now().UTC().Format("2006"))
+		})
+
+		c.Specify("fails for an unknown time zone or an empty format", func() {
+			_, err := NewTimePartitioner("%Y", "Atlantis/Capital")
+			c.Expect(err, gs.Not(gs.IsNil))
+			_, err = NewTimePartitioner("", "UTC")
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
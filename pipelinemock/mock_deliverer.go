@@ -47,6 +47,14 @@ func (_mr *_MockDelivererRecorder) DeliverFunc() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeliverFunc")
 }
 
+func (_m *MockDeliverer) SetPackDecorator(_param0 func(*pipeline.PipelinePack)) {
+	_m.ctrl.Call(_m, "SetPackDecorator", _param0)
+}
+
+func (_mr *_MockDelivererRecorder) SetPackDecorator(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetPackDecorator", arg0)
+}
+
 func (_m *MockDeliverer) Done() {
 	_m.ctrl.Call(_m, "Done")
 }
@@ -23,10 +23,28 @@ func TestAllSpecs(t *testing.T) {
 	r := gospec.NewRunner()
 	r.Parallel = false
 
+	r.AddSpec(Base64DecoderSpec)
+	r.AddSpec(Base64EncoderSpec)
+	r.AddSpec(ChunkReassemblyDecoderSpec)
+	r.AddSpec(CompressionEncoderSpec)
+	r.AddSpec(CronSpec)
+	r.AddSpec(DecompressionDecoderSpec)
+	r.AddSpec(GzipEncoderSpec)
+	r.AddSpec(HexDecoderSpec)
+	r.AddSpec(HexEncoderSpec)
+	r.AddSpec(JsonProcessorSpec)
 	r.AddSpec(LoadFromConfigSpec)
+	r.AddSpec(SamplingOutputSpec)
 	r.AddSpec(ScribbleDecoderSpec)
+	r.AddSpec(ShadowCompareFilterSpec)
 	r.AddSpec(PayloadEncoderSpec)
+	r.AddSpec(RedactProcessorSpec)
 	r.AddSpec(RstEncoderSpec)
+	r.AddSpec(ScheduleInputSpec)
+	r.AddSpec(SeverityDecoderSpec)
+	r.AddSpec(StdinInputSpec)
+	r.AddSpec(StdoutOutputSpec)
+	r.AddSpec(TeeOutputSpec)
 
 	gospec.MainGoTest(r, t)
 }
@@ -0,0 +1,496 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package amqp1
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"heka/plugins/tcp"
+)
+
+// Connection settings shared by the AMQP 1.0 input and output.
+type AMQP1ConnConfig struct {
+	// Broker URL, "amqp://[user:password@]host[:port]", or "amqps://..." for
+	// TLS. Ports default to 5672 and 5671.
+	URL string `toml:"url"`
+	// Credentials for SASL PLAIN, overriding the URL's. Without any the
+	// connection authenticates as ANONYMOUS.
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	Tls      tcp.TlsConfig
+	// Host name sent in the open frame, for brokers hosting several
+	// namespaces. Defaults to the URL's host.
+	Hostname string `toml:"hostname"`
+	// Seconds of silence after which each end considers the connection
+	// dead. Defaults to 60.
+	IdleTimeout uint `toml:"idle_timeout"`
+	// Seconds to wait for the broker to connect or answer. Defaults to 10.
+	Timeout uint `toml:"timeout"`
+}
+
+// Protocol headers that start the SASL and AMQP layers.
+var (
+	saslHeader = []byte{'A', 'M', 'Q', 'P', 3, 1, 0, 0}
+	amqpHeader = []byte{'A', 'M', 'Q', 'P', 0, 1, 0, 0}
+)
+
+const (
+	frameTypeAMQP = 0
+	frameTypeSASL = 1
+	// Max frame size offered, and assumed until the broker's open.
+	maxFrameSize = 256 * 1024
+	// Session windows, large enough to leave flow control to the links.
+	sessionWindow = math32Max
+	math32Max     = 1<<31 - 1
+)
+
+// A frame received.
+type frame struct {
+	ftype   byte
+	channel uint16
+	// The performative, nil for an empty heart-beat frame.
+	body    *described
+	payload []byte
+}
+
+// Parsed connection settings.
+type connParams struct {
+	address  string
+	tlsConf  *tls.Config
+	username string
+	password string
+	hostname string
+	idle     time.Duration
+	timeout  time.Duration
+}
+
+// Checks the connection settings, returning the dial parameters.
+func parseConnConfig(conf *AMQP1ConnConfig) (*connParams, error) {
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, fmt.Errorf("bad url: %s", err)
+	}
+	p := &connParams{
+		username: conf.Username,
+		password: conf.Password,
+		hostname: conf.Hostname,
+		idle:     time.Duration(conf.IdleTimeout) * time.Second,
+		timeout:  time.Duration(conf.Timeout) * time.Second,
+	}
+	port := "5672"
+	switch u.Scheme {
+	case "amqp":
+	case "amqps":
+		port = "5671"
+		if p.tlsConf, err = tcp.CreateGoTlsConfig(&conf.Tls); err != nil {
+			return nil, fmt.Errorf("TLS init error: %s", err)
+		}
+		if p.tlsConf.ServerName == "" {
+			p.tlsConf.ServerName = u.Hostname()
+		}
+	default:
+		return nil, fmt.Errorf("url '%s' isn't amqp:// or amqps://", conf.URL)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("url '%s' has no host", conf.URL)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	p.address = net.JoinHostPort(u.Hostname(), port)
+	if p.hostname == "" {
+		p.hostname = u.Hostname()
+	}
+	if p.username == "" && u.User != nil {
+		p.username = u.User.Username()
+		p.password, _ = u.User.Password()
+	}
+	return p, nil
+}
+
+// A connection with one session, and one link on it. Frames may be sent
+// from several goroutines, but only one may receive.
+type amqpConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	writeLock sync.Mutex
+	writer    *bufio.Writer
+	// The broker's max frame size, and how long it may be silent.
+	maxFrame    uint32
+	readTimeout time.Duration
+	timeout     time.Duration
+	// The session's next-outgoing-id and incoming-window, from the broker's
+	// begin.
+	remoteNextOutgoing uint32
+	remoteWindow       uint32
+	closeOnce          sync.Once
+	closed             chan bool
+}
+
+// Connects, authenticates and opens the connection and its session.
+func dialAMQP(p *connParams, containerId string) (c *amqpConn, err error) {
+	dialer := &net.Dialer{Timeout: p.timeout}
+	var conn net.Conn
+	if p.tlsConf != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", p.address, p.tlsConf)
+	} else {
+		conn, err = dialer.Dial("tcp", p.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c = &amqpConn{
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		writer:   bufio.NewWriter(conn),
+		maxFrame: maxFrameSize,
+		timeout:  p.timeout,
+		closed:   make(chan bool),
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+	conn.SetDeadline(time.Now().Add(p.timeout))
+	if err = c.sasl(p); err != nil {
+		return nil, err
+	}
+	if err = c.exchangeHeader(amqpHeader); err != nil {
+		return nil, err
+	}
+
+	open := &described{code: descOpen, value: []interface{}{
+		containerId, p.hostname, uint32(maxFrameSize), uint16(0),
+		uint32(p.idle / time.Millisecond),
+	}}
+	if err = c.send(0, open, nil); err != nil {
+		return nil, err
+	}
+	reply, err := c.expect(descOpen)
+	if err != nil {
+		return nil, err
+	}
+	if max := toUint32(reply.body.field(2)); max >= 512 && max < maxFrameSize {
+		c.maxFrame = max
+	}
+	if idle := toUint32(reply.body.field(4)); idle > 0 {
+		// Heart-beat at half the broker's timeout.
+		go c.beat(time.Duration(idle) * time.Millisecond / 2)
+	}
+	if p.idle > 0 {
+		c.readTimeout = p.idle
+	}
+
+	begin := &described{code: descBegin, value: []interface{}{
+		nil, uint32(0), uint32(sessionWindow), uint32(sessionWindow),
+	}}
+	if err = c.send(0, begin, nil); err != nil {
+		return nil, err
+	}
+	if reply, err = c.expect(descBegin); err != nil {
+		return nil, err
+	}
+	c.remoteNextOutgoing = toUint32(reply.body.field(1))
+	c.remoteWindow = toUint32(reply.body.field(2))
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// Sends a protocol header and checks the broker answers with the same.
+func (c *amqpConn) exchangeHeader(header []byte) error {
+	c.writer.Write(header)
+	if err := c.writer.Flush(); err != nil {
+		return err
+	}
+	reply := make([]byte, 8)
+	if _, err := io.ReadFull(c.reader, reply); err != nil {
+		return fmt.Errorf("no protocol header: %s", err)
+	}
+	if !bytes.Equal(reply, header) {
+		return fmt.Errorf("broker answered protocol header %q with %q", header, reply)
+	}
+	return nil
+}
+
+// Authenticates with SASL PLAIN, or ANONYMOUS without credentials.
+func (c *amqpConn) sasl(p *connParams) error {
+	if err := c.exchangeHeader(saslHeader); err != nil {
+		return err
+	}
+	f, err := c.receive()
+	if err != nil {
+		return err
+	}
+	if f.body == nil || f.body.code != descSaslMechanisms {
+		return errors.New("expected sasl-mechanisms frame")
+	}
+	offered := make(map[string]bool)
+	switch mechs := f.body.field(0).(type) {
+	case symbol:
+		offered[string(mechs)] = true
+	case []interface{}:
+		for _, mech := range mechs {
+			offered[toString(mech)] = true
+		}
+	}
+	mechanism, response := "ANONYMOUS", []byte(nil)
+	if p.username != "" {
+		mechanism = "PLAIN"
+		response = []byte("\x00" + p.username + "\x00" + p.password)
+	}
+	if !offered[mechanism] {
+		return fmt.Errorf("broker doesn't offer SASL %s", mechanism)
+	}
+	init := &described{code: descSaslInit, value: []interface{}{
+		symbol(mechanism), response, p.hostname,
+	}}
+	if err = c.sendFrame(frameTypeSASL, 0, init, nil); err != nil {
+		return err
+	}
+	if f, err = c.receive(); err != nil {
+		return err
+	}
+	if f.body == nil || f.body.code != descSaslOutcome {
+		return errors.New("expected sasl-outcome frame")
+	}
+	if code, _ := f.body.field(0).(uint8); code != 0 {
+		return fmt.Errorf("SASL %s authentication failed, code %d", mechanism, code)
+	}
+	return nil
+}
+
+// Sends an empty frame at each interval, until the connection's closed.
+func (c *amqpConn) beat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.writeLock.Lock()
+			c.writer.Write([]byte{0, 0, 0, 8, 2, frameTypeAMQP, 0, 0})
+			err := c.writer.Flush()
+			c.writeLock.Unlock()
+			if err != nil {
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// Encodes a frame.
+func encodeFrame(buf *bytes.Buffer, ftype byte, channel uint16, body *described,
+	payload []byte) {
+
+	start := buf.Len()
+	buf.Write([]byte{0, 0, 0, 0, 2, ftype})
+	binary.Write(buf, binary.BigEndian, channel)
+	encodeValue(buf, body)
+	buf.Write(payload)
+	binary.BigEndian.PutUint32(buf.Bytes()[start:], uint32(buf.Len()-start))
+}
+
+func (c *amqpConn) sendFrame(ftype byte, channel uint16, body *described,
+	payload []byte) error {
+
+	var buf bytes.Buffer
+	encodeFrame(&buf, ftype, channel, body, payload)
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.writer.Write(buf.Bytes())
+	return c.writer.Flush()
+}
+
+// Sends a performative on the session's channel.
+func (c *amqpConn) send(channel uint16, body *described, payload []byte) error {
+	return c.sendFrame(frameTypeAMQP, channel, body, payload)
+}
+
+// Sends a message as a delivery on the link, split into as many transfer
+// frames as the broker's max frame size needs, returning how many it took.
+func (c *amqpConn) transfer(handle, deliveryId uint32, msg []byte) (int, error) {
+	first := true
+	frames := 0
+	for {
+		fields := []interface{}{handle}
+		if first {
+			tag := make([]byte, 4)
+			binary.BigEndian.PutUint32(tag, deliveryId)
+			fields = append(fields, deliveryId, tag, uint32(0), false)
+		} else {
+			fields = append(fields, nil, nil, nil, nil)
+		}
+		var head bytes.Buffer
+		encodeValue(&head, &described{code: descTransfer,
+			value: append(fields, true)})
+		// Allowing for the frame header.
+		room := int(c.maxFrame) - head.Len() - 8
+		more := len(msg) > room
+		chunk := msg
+		if more {
+			chunk = msg[:room]
+		}
+		transfer := &described{code: descTransfer, value: append(fields, more)}
+		if err := c.send(0, transfer, chunk); err != nil {
+			return frames, err
+		}
+		frames++
+		if !more {
+			return frames, nil
+		}
+		msg, first = msg[room:], false
+	}
+}
+
+// Reads the next frame, skipping heart-beats, failing if the broker's been
+// silent for longer than the idle timeout.
+func (c *amqpConn) receive() (*frame, error) {
+	for {
+		if c.readTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+		}
+		head := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, head); err != nil {
+			return nil, err
+		}
+		size := binary.BigEndian.Uint32(head)
+		doff := int(head[4]) * 4
+		if size < 8 || doff < 8 || uint32(doff) > size || size > maxFrameSize {
+			return nil, fmt.Errorf("bad frame header % x", head)
+		}
+		data := make([]byte, size-8)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		data = data[doff-8:]
+		if len(data) == 0 {
+			continue
+		}
+		f := &frame{ftype: head[5], channel: binary.BigEndian.Uint16(head[6:])}
+		body, payload, err := decodeOne(data)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode frame: %s", err)
+		}
+		var ok bool
+		if f.body, ok = body.(*described); !ok {
+			return nil, fmt.Errorf("frame body is a %T, not a performative", body)
+		}
+		f.payload = payload
+		return f, nil
+	}
+}
+
+// Receives the next frame, failing unless it's the performative given. A
+// close or detach is reported with its error.
+func (c *amqpConn) expect(code uint64) (*frame, error) {
+	f, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	if f.body.code != code {
+		if err = closeError(f); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("expected performative 0x%02x, got 0x%02x", code,
+			f.body.code)
+	}
+	return f, nil
+}
+
+// Attaches the link, returning the broker's attach.
+func (c *amqpConn) attach(name string, receiver bool, source, target interface{},
+	sndSettleMode uint8) (*frame, error) {
+
+	fields := []interface{}{name, uint32(0), receiver, sndSettleMode, uint8(0),
+		source, target, nil, nil}
+	if !receiver {
+		// The initial delivery-count.
+		fields = append(fields, uint32(0))
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := c.send(0, &described{code: descAttach, value: fields}, nil); err != nil {
+		return nil, err
+	}
+	reply, err := c.expect(descAttach)
+	if err != nil {
+		return nil, err
+	}
+	// A broker refusing a link attaches it without a terminus, then
+	// detaches it with the reason.
+	terminus := reply.body.field(6)
+	if receiver {
+		terminus = reply.body.field(5)
+	}
+	if terminus == nil {
+		f, err := c.expect(descDetach)
+		if err == nil {
+			err = closeError(f)
+		}
+		if err == nil {
+			err = errors.New("broker refused the link")
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Returns the error a close, end or detach frame reports, nil for other
+// frames.
+func closeError(f *frame) error {
+	var kind string
+	var condition interface{}
+	switch f.body.code {
+	case descClose:
+		kind, condition = "connection", f.body.field(0)
+	case descEnd:
+		kind, condition = "session", f.body.field(0)
+	case descDetach:
+		kind, condition = "link", f.body.field(2)
+	default:
+		return nil
+	}
+	if cond, ok := condition.(*described); ok && cond.code == descError {
+		desc := toString(cond.field(1))
+		if desc != "" {
+			desc = ": " + desc
+		}
+		return fmt.Errorf("broker closed the %s, %s%s", kind, toString(cond.field(0)),
+			desc)
+	}
+	return fmt.Errorf("broker closed the %s", kind)
+}
+
+// Closes the connection, after telling the broker.
+func (c *amqpConn) close() {
+	c.closeOnce.Do(func() {
+		c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.send(0, &described{code: descClose, value: []interface{}{}}, nil)
+		close(c.closed)
+		c.conn.Close()
+	})
+}
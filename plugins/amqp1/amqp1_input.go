@@ -0,0 +1,340 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package amqp1
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type AMQP1InputConfig struct {
+	AMQP1ConnConfig
+	// Queue or topic subscription received from.
+	Address string `toml:"address"`
+	// Most messages the broker may send before they're settled. Defaults to
+	// 100.
+	Prefetch uint `toml:"prefetch"`
+	Splitter string
+}
+
+// A message received, with the sections of it that are used.
+type incoming struct {
+	deliveryId    uint32
+	settled       bool
+	messageId     string
+	subject       string
+	contentType   string
+	creationTime  time.Time
+	appProperties map[interface{}]interface{}
+	body          []byte
+}
+
+// Input plugin that receives messages from an AMQP 1.0 queue or topic
+// subscription, accepting each message once it's been delivered to the
+// router.
+type AMQP1Input struct {
+	conf     *AMQP1InputConfig
+	name     string
+	params   *connParams
+	stopChan chan bool
+
+	// Accessed atomically, for the reports.
+	processMessageCount    int64
+	processMessageFailures int64
+}
+
+func (i *AMQP1Input) ConfigStruct() interface{} {
+	return &AMQP1InputConfig{
+		AMQP1ConnConfig: AMQP1ConnConfig{IdleTimeout: 60, Timeout: 10},
+		Prefetch:        100,
+		Splitter:        "NullSplitter",
+	}
+}
+
+func (i *AMQP1Input) SetName(name string) {
+	i.name = name
+}
+
+func (i *AMQP1Input) Init(config interface{}) (err error) {
+	i.conf = config.(*AMQP1InputConfig)
+	if i.params, err = parseConnConfig(&i.conf.AMQP1ConnConfig); err != nil {
+		return err
+	}
+	if i.conf.Address == "" {
+		return errors.New("address must be set")
+	}
+	if i.conf.Prefetch == 0 {
+		return errors.New("prefetch must be greater than 0")
+	}
+	i.stopChan = make(chan bool)
+	return nil
+}
+
+// Decodes the sections of a message's payload.
+func decodeMessage(in *incoming, data []byte) error {
+	var body []byte
+	for len(data) > 0 {
+		v, rest, err := decodeOne(data)
+		if err != nil {
+			return err
+		}
+		data = rest
+		section, ok := v.(*described)
+		if !ok {
+			return fmt.Errorf("message section is a %T", v)
+		}
+		switch section.code {
+		case descProperties:
+			if id := section.field(0); id != nil {
+				in.messageId = fmt.Sprint(id)
+				if b, ok := id.([]byte); ok {
+					in.messageId = string(b)
+				}
+			}
+			in.subject = toString(section.field(3))
+			in.contentType = toString(section.field(6))
+			in.creationTime, _ = section.field(8).(time.Time)
+		case descApplicationProperties:
+			in.appProperties, _ = section.value.(map[interface{}]interface{})
+		case descData:
+			b, _ := section.value.([]byte)
+			body = append(body, b...)
+		case descAmqpValue:
+			switch value := section.value.(type) {
+			case []byte:
+				body = value
+			case string:
+				body = []byte(value)
+			default:
+				return fmt.Errorf("message body is a %T", value)
+			}
+		}
+	}
+	in.body = body
+	return nil
+}
+
+// Adds an application property as a field of the closest type.
+func addPropertyField(msg *message.Message, name string, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+	case string:
+		message.NewStringField(msg, name, v)
+	case symbol:
+		message.NewStringField(msg, name, string(v))
+	case bool, float64, int64:
+		if f, err := message.NewField(name, v, ""); err == nil {
+			msg.AddField(f)
+		}
+	case float32:
+		addPropertyField(msg, name, float64(v))
+	case int8:
+		message.NewInt64Field(msg, name, int64(v), "")
+	case int16:
+		message.NewInt64Field(msg, name, int64(v), "")
+	case int32:
+		message.NewInt64Field(msg, name, int64(v), "")
+	case uint8:
+		message.NewInt64Field(msg, name, int64(v), "")
+	case uint16:
+		message.NewInt64Field(msg, name, int64(v), "")
+	case uint32:
+		message.NewInt64Field(msg, name, int64(v), "")
+	case uint64:
+		message.NewInt64Field(msg, name, int64(v), "")
+	case time.Time:
+		message.NewTimestampField(msg, name, v)
+	default:
+		message.NewStringField(msg, name, fmt.Sprint(v))
+	}
+}
+
+func (i *AMQP1Input) Run(ir InputRunner, h PluginHelper) (err error) {
+	conn, err := dialAMQP(i.params, fmt.Sprintf("heka-%s-%d", i.name, os.Getpid()))
+	if err != nil {
+		return fmt.Errorf("can't connect to %s: %s", i.params.address, err)
+	}
+	defer conn.close()
+	source := &described{code: descSource, value: []interface{}{i.conf.Address}}
+	target := &described{code: descTarget, value: []interface{}{}}
+	attach, err := conn.attach(i.name+"-receiver", true, source, target, 0)
+	if err != nil {
+		return fmt.Errorf("can't attach to '%s': %s", i.conf.Address, err)
+	}
+
+	// The session's next incoming transfer id, and the link's delivery count
+	// and credit left.
+	nextIncomingId := conn.remoteNextOutgoing
+	deliveryCount := toUint32(attach.body.field(9))
+	credit := uint32(0)
+	grant := func() error {
+		credit = uint32(i.conf.Prefetch)
+		return conn.send(0, &described{code: descFlow, value: []interface{}{
+			nextIncomingId, uint32(sessionWindow), uint32(0), uint32(sessionWindow),
+			uint32(0), deliveryCount, credit,
+		}}, nil)
+	}
+	if err = grant(); err != nil {
+		return fmt.Errorf("can't grant link credit: %s", err)
+	}
+
+	hostname := h.PipelineConfig().Hostname()
+	sRunner := ir.NewSplitterRunner("")
+	defer sRunner.Done()
+	var in *incoming
+	if !sRunner.UseMsgBytes() {
+		sRunner.SetPackDecorator(func(pack *PipelinePack) {
+			pack.Message.SetType("heka.amqp1")
+			pack.Message.SetLogger(i.name)
+			pack.Message.SetHostname(hostname)
+			message.NewStringField(pack.Message, "Address", i.conf.Address)
+			if in.messageId != "" {
+				message.NewStringField(pack.Message, "MessageId", in.messageId)
+			}
+			if in.subject != "" {
+				message.NewStringField(pack.Message, "Subject", in.subject)
+			}
+			if in.contentType != "" {
+				message.NewStringField(pack.Message, "ContentType", in.contentType)
+			}
+			if !in.creationTime.IsZero() {
+				pack.Message.SetTimestamp(in.creationTime.UnixNano())
+			}
+			for name, value := range in.appProperties {
+				if name, ok := name.(string); ok {
+					addPropertyField(pack.Message, name, value)
+				}
+			}
+		})
+	}
+
+	frames := make(chan *frame)
+	errChan := make(chan error, 1)
+	go func() {
+		for {
+			f, err := conn.receive()
+			if err == nil {
+				err = closeError(f)
+			}
+			if err != nil {
+				errChan <- err
+				return
+			}
+			select {
+			case frames <- f:
+			case <-conn.closed:
+				return
+			}
+		}
+	}()
+
+	// A delivery split across several transfer frames, until the last.
+	var partial *incoming
+	var payload []byte
+	for {
+		var f *frame
+		select {
+		case f = <-frames:
+		case err = <-errChan:
+			return fmt.Errorf("connection to %s failed: %s", i.params.address, err)
+		case <-i.stopChan:
+			return nil
+		}
+		if f.body.code != descTransfer {
+			continue
+		}
+		nextIncomingId++
+		if partial == nil {
+			partial = &incoming{
+				deliveryId: toUint32(f.body.field(1)),
+				settled:    toBool(f.body.field(4)),
+			}
+			deliveryCount++
+			if credit > 0 {
+				credit--
+			}
+		}
+		payload = append(payload, f.payload...)
+		if toBool(f.body.field(10)) {
+			// Aborted by the broker.
+			partial, payload = nil, nil
+			continue
+		}
+		if toBool(f.body.field(5)) {
+			continue
+		}
+		in, partial = partial, nil
+		err = decodeMessage(in, payload)
+		payload = nil
+
+		atomic.AddInt64(&i.processMessageCount, 1)
+		accepted := &described{code: descAccepted, value: []interface{}{}}
+		var outcome interface{} = accepted
+		if err == nil {
+			var n int
+			n, err = sRunner.SplitBytes(in.body, nil)
+			if err == nil && n > 0 && n != len(in.body) {
+				ir.LogError(fmt.Errorf("extra data dropped in message %d", in.deliveryId))
+			}
+		}
+		if err != nil {
+			// Delivery failed, so the broker redelivers it or dead letters it.
+			atomic.AddInt64(&i.processMessageFailures, 1)
+			ir.LogError(fmt.Errorf("modified message %d: %s", in.deliveryId, err))
+			outcome = &described{code: descModified, value: []interface{}{true}}
+		}
+		if !in.settled {
+			disposition := &described{code: descDisposition, value: []interface{}{
+				true, in.deliveryId, in.deliveryId, true, outcome,
+			}}
+			if err = conn.send(0, disposition, nil); err != nil {
+				return fmt.Errorf("can't settle message %d: %s", in.deliveryId, err)
+			}
+		}
+		if credit <= uint32(i.conf.Prefetch)/2 {
+			if err = grant(); err != nil {
+				return fmt.Errorf("can't grant link credit: %s", err)
+			}
+		}
+	}
+}
+
+func (i *AMQP1Input) Stop() {
+	close(i.stopChan)
+}
+
+func (i *AMQP1Input) CleanupForRestart() {
+	i.stopChan = make(chan bool)
+}
+
+func (i *AMQP1Input) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "ProcessMessageCount",
+		atomic.LoadInt64(&i.processMessageCount), "count")
+	message.NewInt64Field(msg, "ProcessMessageFailures",
+		atomic.LoadInt64(&i.processMessageFailures), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("AMQP1Input", func() interface{} {
+		return new(AMQP1Input)
+	})
+}
@@ -0,0 +1,149 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package amqp1
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func AMQP1InputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("An AMQP1Input", func() {
+		broker := newAMQPBroker()
+		defer broker.close()
+		broker.configure(func() { broker.queue = []string{"one", "two"} })
+
+		input := new(AMQP1Input)
+		input.SetName("AMQP1")
+		config := input.ConfigStruct().(*AMQP1InputConfig)
+		config.URL = broker.url()
+		config.Address = "logs"
+		config.Timeout = 1
+
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		ir := pipelinemock.NewMockInputRunner(ctrl)
+		delivered := make(chan *PipelinePack, 2)
+		var splitErr error
+
+		run := func() chan error {
+			h.EXPECT().PipelineConfig().Return(pConfig)
+			sr := pipelinemock.NewMockSplitterRunner(ctrl)
+			ir.EXPECT().NewSplitterRunner("").Return(sr)
+			sr.EXPECT().UseMsgBytes().Return(false)
+			var decorate func(*PipelinePack)
+			sr.EXPECT().SetPackDecorator(gomock.Any()).Do(func(f func(*PipelinePack)) {
+				decorate = f
+			})
+			sr.EXPECT().SplitBytes(gomock.Any(), nil).Do(func(data []byte, del Deliverer) {
+				pack := NewPipelinePack(nil)
+				pack.Message.SetPayload(string(data))
+				decorate(pack)
+				delivered <- pack
+			}).Return(0, splitErr).Times(2)
+			sr.EXPECT().Done()
+
+			c.Assume(input.Init(config), gs.IsNil)
+			done := make(chan error, 1)
+			go func() {
+				done <- input.Run(ir, h)
+			}()
+			return done
+		}
+
+		c.Specify("delivers messages and accepts them", func() {
+			done := run()
+			pack := <-delivered
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "one")
+			c.Expect(pack.Message.GetType(), gs.Equals, "heka.amqp1")
+			c.Expect(pack.Message.GetLogger(), gs.Equals, "AMQP1")
+			c.Expect(pack.Message.GetTimestamp(), gs.Equals,
+				time.Unix(1428773426, 0).UnixNano())
+			value, _ := pack.Message.GetFieldValue("Address")
+			c.Expect(value, gs.Equals, "logs")
+			value, _ = pack.Message.GetFieldValue("MessageId")
+			c.Expect(value, gs.Equals, "m0")
+			value, _ = pack.Message.GetFieldValue("Subject")
+			c.Expect(value, gs.Equals, "logs")
+			value, _ = pack.Message.GetFieldValue("ContentType")
+			c.Expect(value, gs.Equals, "text/plain")
+			value, _ = pack.Message.GetFieldValue("priority")
+			c.Expect(value, gs.Equals, int64(4))
+			value, _ = pack.Message.GetFieldValue("region")
+			c.Expect(value, gs.Equals, "eu")
+			pack = <-delivered
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "two")
+
+			events := "OPEN ANONYMOUS,ATTACH receiver logs,FLOW 100,ACCEPTED 0,ACCEPTED 1"
+			c.Expect(waitReceived(broker, events), gs.Equals, events)
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+			c.Expect(waitReceived(broker, events+",CLOSE"), gs.Equals, events+",CLOSE")
+		})
+
+		c.Specify("assembles messages split across frames", func() {
+			big := strings.Repeat("x", 2000)
+			broker.configure(func() {
+				broker.maxFrame = 512
+				broker.queue[0] = big
+			})
+			config.Prefetch = 2
+			done := run()
+			c.Expect((<-delivered).Message.GetPayload(), gs.Equals, big)
+			<-delivered
+			events := "OPEN ANONYMOUS,ATTACH receiver logs,FLOW 2,ACCEPTED 0,FLOW 2," +
+				"ACCEPTED 1,FLOW 2"
+			c.Expect(waitReceived(broker, events), gs.Equals, events)
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+		})
+
+		c.Specify("modifies messages it can't deliver", func() {
+			splitErr = errors.New("no good")
+			ir.EXPECT().LogError(gomock.Any()).Times(2)
+			done := run()
+			<-delivered
+			<-delivered
+			events := "OPEN ANONYMOUS,ATTACH receiver logs,FLOW 100,MODIFIED 0,MODIFIED 1"
+			c.Expect(waitReceived(broker, events), gs.Equals, events)
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+		})
+
+		c.Specify("fails when the link's refused", func() {
+			broker.configure(func() { broker.refuse = true })
+			c.Assume(input.Init(config), gs.IsNil)
+			err := input.Run(ir, h)
+			c.Expect(err.Error(), gs.Equals, "can't attach to 'logs': broker closed "+
+				"the link, amqp:not-found: no such queue")
+		})
+
+		c.Specify("needs an address", func() {
+			config.Address = ""
+			c.Expect(input.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
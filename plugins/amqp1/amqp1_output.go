@@ -0,0 +1,450 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package amqp1
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type AMQP1OutputConfig struct {
+	AMQP1ConnConfig
+	// Queue or topic sent to.
+	Address string `toml:"address"`
+	// Content type of the messages. Defaults to "application/octet-stream".
+	ContentType string `toml:"content_type"`
+	// Subject property of the messages, used for routing by some brokers.
+	Subject string `toml:"subject"`
+	// Whether brokers should keep the messages on disk.
+	Persistent bool `toml:"persistent"`
+	// Application properties added to the messages.
+	ApplicationProperties map[string]string `toml:"application_properties"`
+	// Most messages sent without the broker accepting them. Defaults to 100.
+	MaxUnconfirmed uint `toml:"max_unconfirmed"`
+	// Seconds between waits for the outcomes of the messages sent. Defaults
+	// to 1.
+	TickerInterval uint `toml:"ticker_interval"`
+}
+
+// A message sent that the broker hasn't settled yet.
+type outgoing struct {
+	msg        []byte
+	cursor     string
+	deliveryId uint32
+	settled    bool
+	// Whether it's still to be sent over the current connection, as it's
+	// new or the broker released it.
+	resend bool
+}
+
+// Output plugin that sends messages to an AMQP 1.0 queue or topic, waiting
+// for the broker to accept them. Unsettled messages are sent again when the
+// output reconnects.
+type AMQP1Output struct {
+	conf   *AMQP1OutputConfig
+	name   string
+	params *connParams
+	or     OutputRunner
+
+	// The connection, the error it failed with, and the link and session
+	// flow control, with the messages sent and not yet settled in order.
+	// The cursor is the last settled message's, dirty until it's updated.
+	lock           sync.Mutex
+	changed        *sync.Cond
+	conn           *amqpConn
+	connErr        error
+	credit         uint32
+	window         uint32
+	deliveryCount  uint32
+	nextDeliveryId uint32
+	nextOutgoingId uint32
+	pending        []*outgoing
+	cursor         string
+	dirty          bool
+
+	// Accessed atomically, for the reports.
+	messagesSent     int64
+	messagesRejected int64
+	messagesResent   int64
+	reconnects       int64
+}
+
+func (o *AMQP1Output) ConfigStruct() interface{} {
+	return &AMQP1OutputConfig{
+		AMQP1ConnConfig: AMQP1ConnConfig{IdleTimeout: 60, Timeout: 10},
+		ContentType:     "application/octet-stream",
+		MaxUnconfirmed:  100,
+		TickerInterval:  1,
+	}
+}
+
+func (o *AMQP1Output) SetName(name string) {
+	o.name = name
+}
+
+func (o *AMQP1Output) Init(config interface{}) (err error) {
+	o.conf = config.(*AMQP1OutputConfig)
+	if o.params, err = parseConnConfig(&o.conf.AMQP1ConnConfig); err != nil {
+		return err
+	}
+	if o.conf.Address == "" {
+		return errors.New("address must be set")
+	}
+	if o.conf.MaxUnconfirmed == 0 {
+		return errors.New("max_unconfirmed must be greater than 0")
+	}
+	o.changed = sync.NewCond(&o.lock)
+	return nil
+}
+
+func (o *AMQP1Output) Prepare(or OutputRunner, h PluginHelper) error {
+	if or.Encoder() == nil {
+		return errors.New("an encoder must be specified")
+	}
+	o.or = or
+	return nil
+}
+
+// Returns the AMQP message carrying the body in a data section.
+func (o *AMQP1Output) encodeMessage(body []byte, messageId string) []byte {
+	var buf bytes.Buffer
+	if o.conf.Persistent {
+		encodeValue(&buf, &described{code: descHeader, value: []interface{}{true}})
+	}
+	var id, subject interface{}
+	if messageId != "" {
+		id = messageId
+	}
+	if o.conf.Subject != "" {
+		subject = o.conf.Subject
+	}
+	encodeValue(&buf, &described{code: descProperties, value: []interface{}{
+		id, nil, nil, subject, nil, nil, symbol(o.conf.ContentType),
+	}})
+	if len(o.conf.ApplicationProperties) > 0 {
+		props := make(map[interface{}]interface{}, len(o.conf.ApplicationProperties))
+		for name, value := range o.conf.ApplicationProperties {
+			props[name] = value
+		}
+		encodeValue(&buf, &described{code: descApplicationProperties, value: props})
+	}
+	encodeValue(&buf, &described{code: descData, value: body})
+	return buf.Bytes()
+}
+
+// Reads the flow and disposition frames of the connection, until it fails.
+func (o *AMQP1Output) readFrames(conn *amqpConn) {
+	for {
+		f, err := conn.receive()
+		if err == nil {
+			err = closeError(f)
+		}
+		if err != nil {
+			conn.close()
+			o.lock.Lock()
+			if o.conn == conn {
+				o.connErr = err
+				o.changed.Broadcast()
+			}
+			o.lock.Unlock()
+			return
+		}
+		switch f.body.code {
+		case descFlow:
+			o.flow(f.body)
+		case descDisposition:
+			if toBool(f.body.field(0)) {
+				o.disposition(f.body)
+			}
+		}
+	}
+}
+
+// Updates the link credit and session window the broker's given.
+func (o *AMQP1Output) flow(flow *described) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if nextIncoming, ok := flow.field(0).(uint32); ok {
+		o.window = nextIncoming + toUint32(flow.field(1)) - o.nextOutgoingId
+	}
+	if flow.field(4) != nil {
+		// The broker's count may lag behind deliveries in flight.
+		o.credit = toUint32(flow.field(5)) + toUint32(flow.field(6)) - o.deliveryCount
+	}
+	o.changed.Broadcast()
+}
+
+// Settles the pending messages a disposition is for, by their outcome.
+func (o *AMQP1Output) disposition(disp *described) {
+	first := toUint32(disp.field(1))
+	last := first
+	if disp.field(2) != nil {
+		last = toUint32(disp.field(2))
+	}
+	state, _ := disp.field(4).(*described)
+	if state == nil || state.code == descReceived {
+		return
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for _, out := range o.pending {
+		if out.settled || out.resend || out.deliveryId-first > last-first {
+			continue
+		}
+		switch state.code {
+		case descAccepted:
+			atomic.AddInt64(&o.messagesSent, 1)
+			out.settled = true
+		case descRejected:
+			atomic.AddInt64(&o.messagesRejected, 1)
+			reason := "no reason given"
+			if cond, ok := state.field(0).(*described); ok {
+				reason = fmt.Sprintf("%s: %s", toString(cond.field(0)),
+					toString(cond.field(1)))
+			}
+			o.or.LogError(fmt.Errorf("broker rejected message, %s", reason))
+			out.settled = true
+		default:
+			// Released or modified, it can be sent again.
+			out.resend = true
+		}
+	}
+	n := 0
+	for n < len(o.pending) && o.pending[n].settled {
+		n++
+	}
+	if n > 0 {
+		o.cursor = o.pending[n-1].cursor
+		o.dirty = true
+		o.pending = o.pending[n:]
+	}
+	o.changed.Broadcast()
+}
+
+// Waits until the condition holds, the connection fails or the timeout
+// passes, with the lock held.
+func (o *AMQP1Output) waitFor(cond func() bool, what string) error {
+	deadline := time.Now().Add(o.params.timeout)
+	timer := time.AfterFunc(o.params.timeout, func() {
+		o.lock.Lock()
+		o.changed.Broadcast()
+		o.lock.Unlock()
+	})
+	defer timer.Stop()
+	for !cond() {
+		if o.connErr != nil {
+			return fmt.Errorf("connection failed: %s", o.connErr)
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("timed out waiting for %s", what)
+		}
+		o.changed.Wait()
+	}
+	return nil
+}
+
+// Sends a pending message as a new delivery, once the broker's given credit
+// for it.
+func (o *AMQP1Output) transfer(out *outgoing) error {
+	o.lock.Lock()
+	err := o.waitFor(func() bool { return o.credit > 0 && o.window > 0 }, "link credit")
+	if err != nil {
+		o.lock.Unlock()
+		return err
+	}
+	conn := o.conn
+	out.deliveryId, out.resend = o.nextDeliveryId, false
+	o.nextDeliveryId++
+	o.deliveryCount++
+	o.credit--
+	o.lock.Unlock()
+
+	frames, err := conn.transfer(0, out.deliveryId, out.msg)
+	o.lock.Lock()
+	o.nextOutgoingId += uint32(frames)
+	o.window -= uint32(frames)
+	o.lock.Unlock()
+	if err != nil {
+		conn.close()
+	}
+	return err
+}
+
+// Returns an open connection, connecting and sending the unsettled messages
+// again if the last one failed.
+func (o *AMQP1Output) connect() error {
+	o.lock.Lock()
+	conn, connErr := o.conn, o.connErr
+	o.lock.Unlock()
+	if conn != nil && connErr == nil {
+		return nil
+	}
+	if conn != nil {
+		o.or.LogError(fmt.Errorf("connection to %s failed: %s", o.params.address,
+			connErr))
+		atomic.AddInt64(&o.reconnects, 1)
+	}
+	conn, err := dialAMQP(o.params, fmt.Sprintf("heka-%s-%d", o.name, os.Getpid()))
+	if err != nil {
+		return fmt.Errorf("can't connect to %s: %s", o.params.address, err)
+	}
+	target := &described{code: descTarget, value: []interface{}{o.conf.Address}}
+	source := &described{code: descSource, value: []interface{}{}}
+	// Unsettled, so that the broker settles each message with its outcome.
+	if _, err = conn.attach(o.name+"-sender", false, source, target, 0); err != nil {
+		conn.close()
+		return fmt.Errorf("can't attach to '%s': %s", o.conf.Address, err)
+	}
+
+	o.lock.Lock()
+	o.conn, o.connErr = conn, nil
+	o.credit, o.deliveryCount, o.nextDeliveryId = 0, 0, 0
+	o.nextOutgoingId, o.window = 0, conn.remoteWindow
+	// Their delivery ids were the last connection's.
+	for _, out := range o.pending {
+		out.resend = true
+	}
+	o.lock.Unlock()
+	go o.readFrames(conn)
+	return o.resend()
+}
+
+// Sends the messages the broker released, or that weren't sent over the
+// current connection, again.
+func (o *AMQP1Output) resend() error {
+	o.lock.Lock()
+	var released []*outgoing
+	for _, out := range o.pending {
+		if out.resend {
+			released = append(released, out)
+		}
+	}
+	o.lock.Unlock()
+	for _, out := range released {
+		if err := o.transfer(out); err != nil {
+			return err
+		}
+		atomic.AddInt64(&o.messagesResent, 1)
+	}
+	return nil
+}
+
+// Waits until at most max messages are unsettled, and advances the cursor
+// past the settled messages.
+func (o *AMQP1Output) waitSettled(max int) error {
+	o.lock.Lock()
+	err := o.waitFor(func() bool { return len(o.pending) <= max }, "message outcomes")
+	cursor, dirty := o.cursor, o.dirty
+	o.dirty = false
+	o.lock.Unlock()
+	if dirty {
+		o.or.UpdateCursor(cursor)
+	}
+	return err
+}
+
+func (o *AMQP1Output) ProcessMessage(pack *PipelinePack) error {
+	if err := o.connect(); err != nil {
+		return NewRetryMessageError("%s", err)
+	}
+	if err := o.resend(); err != nil {
+		return NewRetryMessageError("%s", err)
+	}
+	if err := o.waitSettled(int(o.conf.MaxUnconfirmed) - 1); err != nil {
+		return NewRetryMessageError("%s", err)
+	}
+	body, err := o.or.Encode(pack)
+	if err != nil {
+		return fmt.Errorf("can't encode: %s", err)
+	}
+	if body == nil {
+		return nil
+	}
+	out := &outgoing{
+		msg:    o.encodeMessage(body, pack.Message.GetUuidString()),
+		cursor: pack.QueueCursor,
+		resend: true,
+	}
+	o.lock.Lock()
+	o.pending = append(o.pending, out)
+	o.lock.Unlock()
+	if err = o.transfer(out); err != nil {
+		// Sent again once reconnected.
+		o.or.LogError(fmt.Errorf("can't send: %s", err))
+	}
+	return nil
+}
+
+func (o *AMQP1Output) TimerEvent() error {
+	o.lock.Lock()
+	pending := len(o.pending)
+	o.lock.Unlock()
+	if pending == 0 {
+		return nil
+	}
+	err := o.connect()
+	if err == nil {
+		err = o.resend()
+	}
+	if err == nil {
+		err = o.waitSettled(0)
+	}
+	if err != nil {
+		o.or.LogError(err)
+	}
+	return nil
+}
+
+func (o *AMQP1Output) CleanUp() {
+	o.lock.Lock()
+	conn := o.conn
+	o.lock.Unlock()
+	if conn == nil {
+		return
+	}
+	if err := o.waitSettled(0); err != nil {
+		o.or.LogError(fmt.Errorf("messages may not have been sent: %s", err))
+	}
+	conn.close()
+}
+
+func (o *AMQP1Output) ReportMsg(msg *message.Message) error {
+	o.lock.Lock()
+	pending := len(o.pending)
+	o.lock.Unlock()
+	message.NewInt64Field(msg, "MessagesSent", atomic.LoadInt64(&o.messagesSent),
+		"count")
+	message.NewInt64Field(msg, "MessagesRejected",
+		atomic.LoadInt64(&o.messagesRejected), "count")
+	message.NewInt64Field(msg, "MessagesResent",
+		atomic.LoadInt64(&o.messagesResent), "count")
+	message.NewInt64Field(msg, "Unconfirmed", int64(pending), "count")
+	message.NewInt64Field(msg, "Reconnects", atomic.LoadInt64(&o.reconnects), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("AMQP1Output", func() interface{} {
+		return new(AMQP1Output)
+	})
+}
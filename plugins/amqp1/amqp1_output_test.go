@@ -0,0 +1,148 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package amqp1
+
+import (
+	"strings"
+
+	"github.com/pborman/uuid"
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func AMQP1OutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("An AMQP1Output", func() {
+		broker := newAMQPBroker()
+		defer broker.close()
+
+		output := new(AMQP1Output)
+		output.SetName("AMQP1")
+		config := output.ConfigStruct().(*AMQP1OutputConfig)
+		config.URL = broker.url()
+		config.Address = "logs"
+		config.Subject = "heka"
+		config.Persistent = true
+		config.ApplicationProperties = map[string]string{"source": "heka"}
+		config.Timeout = 1
+
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		or.EXPECT().Encoder().Return(new(ProtobufEncoder)).AnyTimes()
+		or.EXPECT().LogError(gomock.Any()).AnyTimes()
+		// Outcomes may come in before or after the next message's sent.
+		var cursor string
+		or.EXPECT().UpdateCursor(gomock.Any()).Do(func(c string) {
+			cursor = c
+		}).AnyTimes()
+
+		send := func(body, cursor string) error {
+			pack := NewPipelinePack(pConfig.InputRecycleChan())
+			pack.QueueCursor = cursor
+			pack.Message.SetUuid(uuid.NewRandom())
+			or.EXPECT().Encode(pack).Return([]byte(body), nil)
+			return output.ProcessMessage(pack)
+		}
+		c.Assume(output.Init(config), gs.IsNil)
+		c.Assume(output.Prepare(or, h), gs.IsNil)
+
+		c.Specify("sends messages and advances past the accepted ones", func() {
+			c.Expect(send("one", "c1"), gs.IsNil)
+			c.Expect(send("two", "c2"), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c2")
+			c.Expect(broker.received(), gs.Equals,
+				"OPEN ANONYMOUS,ATTACH sender logs,SEND one,SEND two")
+			broker.lock.Lock()
+			in := broker.messages[0]
+			broker.lock.Unlock()
+			c.Expect(in.subject, gs.Equals, "heka")
+			c.Expect(in.contentType, gs.Equals, "application/octet-stream")
+			c.Expect(len(in.messageId), gs.Equals, 36)
+			c.Expect(in.appProperties["source"], gs.Equals, "heka")
+			c.Expect(output.messagesSent, gs.Equals, int64(2))
+			output.CleanUp()
+			events := "OPEN ANONYMOUS,ATTACH sender logs,SEND one,SEND two,CLOSE"
+			c.Expect(waitReceived(broker, events), gs.Equals, events)
+		})
+
+		c.Specify("splits big messages across frames", func() {
+			broker.configure(func() { broker.maxFrame = 512 })
+			body := strings.Repeat("x", 2000)
+			c.Expect(send(body, "c1"), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			broker.lock.Lock()
+			c.Expect(string(broker.messages[0].body), gs.Equals, body)
+			broker.lock.Unlock()
+		})
+
+		c.Specify("waits for outcomes when too many are outstanding", func() {
+			config.MaxUnconfirmed = 1
+			c.Expect(send("one", "c1"), gs.IsNil)
+			c.Expect(send("two", "c2"), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(len(output.pending) <= 1, gs.IsTrue)
+		})
+
+		c.Specify("sends unsettled messages again after reconnecting", func() {
+			broker.configure(func() { broker.dropAfter = 1 })
+			c.Expect(send("one", "c1"), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "")
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(broker.received(), gs.Equals, "OPEN ANONYMOUS,ATTACH sender logs,"+
+				"SEND one,OPEN ANONYMOUS,ATTACH sender logs,SEND one")
+			c.Expect(output.reconnects, gs.Equals, int64(1))
+		})
+
+		c.Specify("sends released messages again", func() {
+			broker.configure(func() { broker.release = "one" })
+			c.Expect(send("one", "c1"), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(broker.received(), gs.Equals,
+				"OPEN ANONYMOUS,ATTACH sender logs,SEND one,SEND one")
+			c.Expect(output.messagesResent, gs.Equals, int64(1))
+		})
+
+		c.Specify("drops a rejected message", func() {
+			broker.configure(func() { broker.reject = "bad" })
+			c.Expect(send("bad", "c1"), gs.IsNil)
+			c.Expect(send("good", "c2"), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c2")
+			c.Expect(output.messagesRejected, gs.Equals, int64(1))
+			c.Expect(output.messagesSent, gs.Equals, int64(1))
+		})
+
+		c.Specify("retries while the broker's unreachable", func() {
+			broker.close()
+			pack := NewPipelinePack(pConfig.InputRecycleChan())
+			err := output.ProcessMessage(pack)
+			_, ok := err.(RetryMessageError)
+			c.Expect(ok, gs.IsTrue)
+		})
+	})
+}
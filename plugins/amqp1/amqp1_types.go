@@ -0,0 +1,558 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package amqp1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Codes of the AMQP 1.0 type system's encodings.
+const (
+	typeDescribed  = 0x00
+	typeNull       = 0x40
+	typeTrue       = 0x41
+	typeFalse      = 0x42
+	typeUint0      = 0x43
+	typeUlong0     = 0x44
+	typeList0      = 0x45
+	typeUbyte      = 0x50
+	typeByte       = 0x51
+	typeSmallUint  = 0x52
+	typeSmallUlong = 0x53
+	typeSmallInt   = 0x54
+	typeSmallLong  = 0x55
+	typeBoolean    = 0x56
+	typeUshort     = 0x60
+	typeShort      = 0x61
+	typeUint       = 0x70
+	typeInt        = 0x71
+	typeFloat      = 0x72
+	typeChar       = 0x73
+	typeDecimal32  = 0x74
+	typeUlong      = 0x80
+	typeLong       = 0x81
+	typeDouble     = 0x82
+	typeTimestamp  = 0x83
+	typeDecimal64  = 0x84
+	typeDecimal128 = 0x94
+	typeUuid       = 0x98
+	typeVbin8      = 0xa0
+	typeStr8       = 0xa1
+	typeSym8       = 0xa3
+	typeVbin32     = 0xb0
+	typeStr32      = 0xb1
+	typeSym32      = 0xb3
+	typeList8      = 0xc0
+	typeMap8       = 0xc1
+	typeList32     = 0xd0
+	typeMap32      = 0xd1
+	typeArray8     = 0xe0
+	typeArray32    = 0xf0
+)
+
+// Descriptor codes of the performatives, SASL frames and other composite
+// types used.
+const (
+	descOpen        = 0x10
+	descBegin       = 0x11
+	descAttach      = 0x12
+	descFlow        = 0x13
+	descTransfer    = 0x14
+	descDisposition = 0x15
+	descDetach      = 0x16
+	descEnd         = 0x17
+	descClose       = 0x18
+	descError       = 0x1d
+	descReceived    = 0x23
+	descAccepted    = 0x24
+	descRejected    = 0x25
+	descReleased    = 0x26
+	descModified    = 0x27
+	descSource      = 0x28
+	descTarget      = 0x29
+
+	descSaslMechanisms = 0x40
+	descSaslInit       = 0x41
+	descSaslChallenge  = 0x42
+	descSaslResponse   = 0x43
+	descSaslOutcome    = 0x44
+
+	descHeader                = 0x70
+	descDeliveryAnnotations   = 0x71
+	descMessageAnnotations    = 0x72
+	descProperties            = 0x73
+	descApplicationProperties = 0x74
+	descData                  = 0x75
+	descAmqpSequence          = 0x76
+	descAmqpValue             = 0x77
+	descFooter                = 0x78
+)
+
+// An AMQP symbol, as distinct from a string.
+type symbol string
+
+// A value with a numeric descriptor, such as a performative, whose fields
+// are the value's list.
+type described struct {
+	code  uint64
+	value interface{}
+}
+
+// Returns a list field of the described value, nil if it's absent.
+func (d *described) field(i int) interface{} {
+	list, ok := d.value.([]interface{})
+	if !ok || i >= len(list) {
+		return nil
+	}
+	return list[i]
+}
+
+// Encodes the values in the AMQP type system. Lists are []interface{},
+// maps are map[interface{}]interface{} and timestamps are time.Time.
+func encodeValue(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(typeNull)
+	case bool:
+		if v {
+			buf.WriteByte(typeTrue)
+		} else {
+			buf.WriteByte(typeFalse)
+		}
+	case uint8:
+		buf.WriteByte(typeUbyte)
+		buf.WriteByte(v)
+	case uint16:
+		buf.WriteByte(typeUshort)
+		binary.Write(buf, binary.BigEndian, v)
+	case uint32:
+		switch {
+		case v == 0:
+			buf.WriteByte(typeUint0)
+		case v < 256:
+			buf.WriteByte(typeSmallUint)
+			buf.WriteByte(byte(v))
+		default:
+			buf.WriteByte(typeUint)
+			binary.Write(buf, binary.BigEndian, v)
+		}
+	case uint64:
+		switch {
+		case v == 0:
+			buf.WriteByte(typeUlong0)
+		case v < 256:
+			buf.WriteByte(typeSmallUlong)
+			buf.WriteByte(byte(v))
+		default:
+			buf.WriteByte(typeUlong)
+			binary.Write(buf, binary.BigEndian, v)
+		}
+	case int32:
+		if v >= -128 && v < 128 {
+			buf.WriteByte(typeSmallInt)
+			buf.WriteByte(byte(v))
+		} else {
+			buf.WriteByte(typeInt)
+			binary.Write(buf, binary.BigEndian, v)
+		}
+	case int64:
+		if v >= -128 && v < 128 {
+			buf.WriteByte(typeSmallLong)
+			buf.WriteByte(byte(v))
+		} else {
+			buf.WriteByte(typeLong)
+			binary.Write(buf, binary.BigEndian, v)
+		}
+	case float64:
+		buf.WriteByte(typeDouble)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case time.Time:
+		buf.WriteByte(typeTimestamp)
+		binary.Write(buf, binary.BigEndian, v.UnixNano()/int64(time.Millisecond))
+	case string:
+		encodeVariable(buf, typeStr8, typeStr32, []byte(v))
+	case symbol:
+		encodeVariable(buf, typeSym8, typeSym32, []byte(v))
+	case []byte:
+		encodeVariable(buf, typeVbin8, typeVbin32, v)
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteByte(typeList0)
+			return
+		}
+		var items bytes.Buffer
+		for _, item := range v {
+			encodeValue(&items, item)
+		}
+		encodeCompound(buf, typeList8, typeList32, len(v), items.Bytes())
+	case map[interface{}]interface{}:
+		var items bytes.Buffer
+		for key, value := range v {
+			encodeValue(&items, key)
+			encodeValue(&items, value)
+		}
+		encodeCompound(buf, typeMap8, typeMap32, 2*len(v), items.Bytes())
+	case *described:
+		buf.WriteByte(typeDescribed)
+		encodeValue(buf, v.code)
+		encodeValue(buf, v.value)
+	default:
+		panic(fmt.Sprintf("can't encode %T as AMQP", v))
+	}
+}
+
+// Encodes a string, symbol or binary in its short form if it fits.
+func encodeVariable(buf *bytes.Buffer, short, long byte, data []byte) {
+	if len(data) < 256 {
+		buf.WriteByte(short)
+		buf.WriteByte(byte(len(data)))
+	} else {
+		buf.WriteByte(long)
+		binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	}
+	buf.Write(data)
+}
+
+// Encodes a list or map of count encoded items, in its short form if it fits.
+// The size includes the count's bytes.
+func encodeCompound(buf *bytes.Buffer, short, long byte, count int, items []byte) {
+	if len(items)+1 < 256 && count < 256 {
+		buf.WriteByte(short)
+		buf.WriteByte(byte(len(items) + 1))
+		buf.WriteByte(byte(count))
+	} else {
+		buf.WriteByte(long)
+		binary.Write(buf, binary.BigEndian, uint32(len(items)+4))
+		binary.Write(buf, binary.BigEndian, uint32(count))
+	}
+	buf.Write(items)
+}
+
+var errTruncated = errors.New("truncated AMQP value")
+
+// Decodes AMQP values from a buffer.
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) byte() (byte, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// Reads the size, or count, of a variable width or compound value,
+// width bytes long.
+func (d *decoder) size(width int) (int, error) {
+	b, err := d.next(width)
+	if err != nil {
+		return 0, err
+	}
+	if width == 1 {
+		return int(b[0]), nil
+	}
+	n := binary.BigEndian.Uint32(b)
+	if n > uint32(len(d.data)) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+// Decodes the next value. Arrays are decoded as lists, and values of types
+// that aren't used, such as decimals, as nil.
+func (d *decoder) decode() (interface{}, error) {
+	code, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	if code == typeDescribed {
+		descriptor, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		switch desc := descriptor.(type) {
+		case uint64:
+			return &described{code: desc, value: value}, nil
+		default:
+			// Symbolic descriptors aren't used here.
+			return value, nil
+		}
+	}
+	return d.decodeCode(code)
+}
+
+// Decodes a value of the encoding's code, whose constructor's been read.
+func (d *decoder) decodeCode(code byte) (interface{}, error) {
+	fixed := func(n int) ([]byte, error) { return d.next(n) }
+	switch code {
+	case typeNull:
+		return nil, nil
+	case typeTrue:
+		return true, nil
+	case typeFalse:
+		return false, nil
+	case typeUint0:
+		return uint32(0), nil
+	case typeUlong0:
+		return uint64(0), nil
+	case typeList0:
+		return []interface{}{}, nil
+	case typeBoolean:
+		b, err := d.byte()
+		return b != 0, err
+	case typeUbyte:
+		b, err := d.byte()
+		return b, err
+	case typeByte:
+		b, err := d.byte()
+		return int8(b), err
+	case typeSmallUint:
+		b, err := d.byte()
+		return uint32(b), err
+	case typeSmallUlong:
+		b, err := d.byte()
+		return uint64(b), err
+	case typeSmallInt:
+		b, err := d.byte()
+		return int32(int8(b)), err
+	case typeSmallLong:
+		b, err := d.byte()
+		return int64(int8(b)), err
+	case typeUshort:
+		b, err := fixed(2)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.Uint16(b), nil
+	case typeShort:
+		b, err := fixed(2)
+		if err != nil {
+			return nil, err
+		}
+		return int16(binary.BigEndian.Uint16(b)), nil
+	case typeUint, typeInt, typeFloat, typeChar, typeDecimal32:
+		b, err := fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		n := binary.BigEndian.Uint32(b)
+		switch code {
+		case typeUint:
+			return n, nil
+		case typeInt:
+			return int32(n), nil
+		case typeFloat:
+			return math.Float32frombits(n), nil
+		case typeChar:
+			return rune(n), nil
+		}
+		return nil, nil
+	case typeUlong, typeLong, typeDouble, typeTimestamp, typeDecimal64:
+		b, err := fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		n := binary.BigEndian.Uint64(b)
+		switch code {
+		case typeUlong:
+			return n, nil
+		case typeLong:
+			return int64(n), nil
+		case typeDouble:
+			return math.Float64frombits(n), nil
+		case typeTimestamp:
+			ms := int64(n)
+			return time.Unix(ms/1000, ms%1000*int64(time.Millisecond)).UTC(), nil
+		}
+		return nil, nil
+	case typeDecimal128:
+		_, err := fixed(16)
+		return nil, err
+	case typeUuid:
+		b, err := fixed(16)
+		if err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+	case typeVbin8, typeStr8, typeSym8, typeVbin32, typeStr32, typeSym32:
+		width := 1
+		if code&0xf0 == 0xb0 {
+			width = 4
+		}
+		n, err := d.size(width)
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		switch code {
+		case typeStr8, typeStr32:
+			return string(b), nil
+		case typeSym8, typeSym32:
+			return symbol(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case typeList8, typeMap8, typeArray8, typeList32, typeMap32, typeArray32:
+		width := 1
+		if code >= typeList32 && code != typeArray8 {
+			width = 4
+		}
+		if _, err := d.size(width); err != nil {
+			return nil, err
+		}
+		count, err := d.size(width)
+		if err != nil {
+			return nil, err
+		}
+		if count > len(d.data)-d.pos && code != typeArray8 && code != typeArray32 {
+			return nil, errTruncated
+		}
+		switch code {
+		case typeArray8, typeArray32:
+			return d.decodeArray(count)
+		case typeMap8, typeMap32:
+			m := make(map[interface{}]interface{}, count/2)
+			for i := 0; i < count/2; i++ {
+				key, err := d.decode()
+				if err != nil {
+					return nil, err
+				}
+				value, err := d.decode()
+				if err != nil {
+					return nil, err
+				}
+				m[mapKey(key)] = value
+			}
+			return m, nil
+		}
+		list := make([]interface{}, count)
+		for i := range list {
+			if list[i], err = d.decode(); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unknown AMQP type code 0x%02x", code)
+}
+
+// Decodes the elements of an array, which share one constructor.
+func (d *decoder) decodeArray(count int) (interface{}, error) {
+	code, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	var descriptor interface{}
+	if code == typeDescribed {
+		if descriptor, err = d.decode(); err != nil {
+			return nil, err
+		}
+		if code, err = d.byte(); err != nil {
+			return nil, err
+		}
+	}
+	if count > len(d.data)-d.pos && code != typeNull && code != typeTrue &&
+		code != typeFalse && code != typeUint0 && code != typeUlong0 {
+
+		return nil, errTruncated
+	}
+	list := make([]interface{}, count)
+	for i := range list {
+		value, err := d.decodeCode(code)
+		if err != nil {
+			return nil, err
+		}
+		if desc, ok := descriptor.(uint64); ok {
+			value = &described{code: desc, value: value}
+		}
+		list[i] = value
+	}
+	return list, nil
+}
+
+// Returns a decoded value usable as a map key, a string for the keys that
+// aren't comparable.
+func mapKey(key interface{}) interface{} {
+	switch key.(type) {
+	case []byte, []interface{}, map[interface{}]interface{}, *described:
+		return fmt.Sprint(key)
+	}
+	return key
+}
+
+// Decodes one value from data, returning it and the bytes after it.
+func decodeOne(data []byte) (interface{}, []byte, error) {
+	d := &decoder{data: data}
+	v, err := d.decode()
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, data[d.pos:], nil
+}
+
+// Conversions of decoded fields, zero if they're absent or another type.
+
+func toUint32(v interface{}) uint32 {
+	switch v := v.(type) {
+	case uint32:
+		return v
+	case uint16:
+		return uint32(v)
+	case uint8:
+		return uint32(v)
+	case uint64:
+		return uint32(v)
+	}
+	return 0
+}
+
+func toBool(v interface{}) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+// Returns the string of a string or symbol field.
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case symbol:
+		return string(v)
+	}
+	return ""
+}
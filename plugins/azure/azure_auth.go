@@ -0,0 +1,157 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package azure
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	httpPlugin "heka/plugins/http"
+)
+
+// Azure Active Directory service principal settings, from an output's `aad`
+// subsection.
+type AADConfig struct {
+	TenantId     string `toml:"tenant_id"`
+	ClientId     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	// Base URL of the token endpoints. Defaults to
+	// "https://login.microsoftonline.com", the public cloud's.
+	AuthorityHost string `toml:"authority_host"`
+}
+
+// Fetches access tokens for a resource with the client credentials grant,
+// caching each until shortly before it expires.
+type aadToken struct {
+	*httpPlugin.TokenCache
+	conf  *AADConfig
+	scope string
+}
+
+func newAADToken(conf *AADConfig, scope string, client *http.Client) (*aadToken, error) {
+	if conf.TenantId == "" || conf.ClientId == "" || conf.ClientSecret == "" {
+		return nil, errors.New("aad needs a tenant_id, client_id and client_secret")
+	}
+	if conf.AuthorityHost == "" {
+		conf.AuthorityHost = "https://login.microsoftonline.com"
+	}
+	a := &aadToken{conf: conf, scope: scope}
+	a.TokenCache = &httpPlugin.TokenCache{Client: client, NewRequest: a.newRequest}
+	return a, nil
+}
+
+// Returns a client credentials token request.
+func (a *aadToken) newRequest() (*http.Request, error) {
+	tokenUrl := fmt.Sprintf("%s/%s/oauth2/v2.0/token",
+		strings.TrimRight(a.conf.AuthorityHost, "/"), url.PathEscape(a.conf.TenantId))
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {a.conf.ClientId},
+		"client_secret": {a.conf.ClientSecret},
+		"scope":         {a.scope},
+	}
+	req, err := http.NewRequest("POST", tokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// Splits an Azure connection string, e.g. "Endpoint=sb://...;
+// SharedAccessKeyName=...;SharedAccessKey=...", into its settings.
+func parseConnectionString(s string) (map[string]string, error) {
+	settings := make(map[string]string)
+	for _, part := range strings.Split(s, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		// Keys are base64, so the value runs to the end of the part.
+		i := strings.Index(part, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("malformed connection string setting '%s'", part)
+		}
+		settings[part[:i]] = part[i+1:]
+	}
+	return settings, nil
+}
+
+// Returns a Service Bus shared access signature for the resource, valid
+// until the expiry, for an Authorization header.
+func serviceBusSAS(resource, keyName, key string, expiry time.Time) string {
+	encoded := url.QueryEscape(resource)
+	se := fmt.Sprintf("%d", expiry.Unix())
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(encoded + "\n" + se))
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s", encoded,
+		url.QueryEscape(sig), se, url.QueryEscape(keyName))
+}
+
+// Signs a Blob service request with a storage account's shared key. The
+// request's x-ms-date and other x-ms headers must already be set.
+func signSharedKey(req *http.Request, account string, key []byte) {
+	h := req.Header
+	length := h.Get("Content-Length")
+	if req.ContentLength > 0 {
+		length = fmt.Sprintf("%d", req.ContentLength)
+	}
+	var buf strings.Builder
+	for _, s := range []string{req.Method, h.Get("Content-Encoding"),
+		h.Get("Content-Language"), length, h.Get("Content-MD5"), h.Get("Content-Type"),
+		"", h.Get("If-Modified-Since"), h.Get("If-Match"), h.Get("If-None-Match"),
+		h.Get("If-Unmodified-Since"), h.Get("Range")} {
+
+		buf.WriteString(s)
+		buf.WriteByte('\n')
+	}
+
+	var names []string
+	for name := range h {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s:%s\n", name, strings.TrimSpace(h.Get(name)))
+	}
+
+	buf.WriteString("/" + account + req.URL.EscapedPath())
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for name := range query {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := query[name]
+		sort.Strings(values)
+		fmt.Fprintf(&buf, "\n%s:%s", strings.ToLower(name), strings.Join(values, ","))
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(buf.String()))
+	h.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", account,
+		base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+}
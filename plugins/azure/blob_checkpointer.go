@@ -0,0 +1,157 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package azure
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Keeps each checkpoint in a block blob of a container, satisfying
+// `pipeline.Checkpointer`. Compare and set uses conditional writes.
+type blobCheckpointer struct {
+	blobs  *blobClient
+	prefix string
+}
+
+func checkBlobKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return fmt.Errorf("invalid checkpoint key '%s'", key)
+	}
+	return nil
+}
+
+// Returns the checkpoint's content and ETag, or nil if there's no such blob.
+func (b *blobCheckpointer) get(key string) ([]byte, string, error) {
+	if err := checkBlobKey(key); err != nil {
+		return nil, "", err
+	}
+	resp, body, err := b.blobs.request("GET", b.prefix+key, "", nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if body == nil {
+			body = []byte{}
+		}
+		return body, resp.Header.Get("ETag"), nil
+	case http.StatusNotFound:
+		return nil, "", nil
+	}
+	return nil, "", blobError(resp, body)
+}
+
+// Stores the checkpoint, returning false if the request's conditions failed.
+func (b *blobCheckpointer) put(key string, value []byte, header http.Header) (bool, error) {
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("x-ms-blob-type", "BlockBlob")
+	header.Set("Content-Type", "text/plain")
+	resp, body, err := b.blobs.request("PUT", b.prefix+key, "", value, header)
+	if err != nil {
+		return false, err
+	}
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusOK:
+		return true, nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return false, nil
+	}
+	return false, blobError(resp, body)
+}
+
+func (b *blobCheckpointer) Get(key string) ([]byte, error) {
+	value, _, err := b.get(key)
+	return value, err
+}
+
+func (b *blobCheckpointer) Set(key string, value []byte) error {
+	if err := checkBlobKey(key); err != nil {
+		return err
+	}
+	_, err := b.put(key, value, nil)
+	return err
+}
+
+func (b *blobCheckpointer) CompareAndSet(key string, old, value []byte) (bool, error) {
+	header := make(http.Header)
+	if old == nil {
+		if err := checkBlobKey(key); err != nil {
+			return false, err
+		}
+		header.Set("If-None-Match", "*")
+	} else {
+		current, etag, err := b.get(key)
+		if err != nil || current == nil || !bytes.Equal(current, old) {
+			return false, err
+		}
+		header.Set("If-Match", etag)
+	}
+	return b.put(key, value, header)
+}
+
+func (b *blobCheckpointer) Delete(key string) error {
+	if err := checkBlobKey(key); err != nil {
+		return err
+	}
+	resp, body, err := b.blobs.request("DELETE", b.prefix+key, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNotFound {
+		return blobError(resp, body)
+	}
+	return nil
+}
+
+func (b *blobCheckpointer) List() ([]string, error) {
+	var keys []string
+	marker := ""
+	for {
+		query := "restype=container&comp=list&prefix=" + url.QueryEscape(b.prefix)
+		if marker != "" {
+			query += "&marker=" + url.QueryEscape(marker)
+		}
+		resp, body, err := b.blobs.request("GET", "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, blobError(resp, body)
+		}
+		var result struct {
+			Names      []string `xml:"Blobs>Blob>Name"`
+			NextMarker string
+		}
+		if err = xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("can't decode blob listing: %s", err)
+		}
+		for _, name := range result.Names {
+			keys = append(keys, strings.TrimPrefix(name, b.prefix))
+		}
+		if marker = result.NextMarker; marker == "" {
+			break
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
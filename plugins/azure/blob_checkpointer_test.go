@@ -0,0 +1,152 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package azure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+// A test Blob service holding the blobs of one container in memory, with
+// their ETags.
+type blobServer struct {
+	*httptest.Server
+	lock  sync.Mutex
+	blobs map[string]string
+	etags map[string]int
+}
+
+func newBlobServer() *blobServer {
+	s := &blobServer{blobs: make(map[string]string), etags: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *blobServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/checkpoints")
+	name = strings.TrimPrefix(name, "/")
+	value, exists := s.blobs[name]
+	etag := fmt.Sprintf(`"%d"`, s.etags[name])
+	switch {
+	case name == "" && r.URL.Query().Get("comp") == "list":
+		var names []string
+		for n := range s.blobs {
+			if strings.HasPrefix(n, r.URL.Query().Get("prefix")) {
+				names = append(names, n)
+			}
+		}
+		sort.Strings(names)
+		fmt.Fprint(w, "<EnumerationResults><Blobs>")
+		for _, n := range names {
+			fmt.Fprintf(w, "<Blob><Name>%s</Name></Blob>", n)
+		}
+		fmt.Fprint(w, "</Blobs><NextMarker/></EnumerationResults>")
+	case r.Method == "GET":
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, value)
+	case r.Method == "PUT":
+		if r.Header.Get("If-None-Match") == "*" && exists ||
+			r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != etag {
+
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		s.blobs[name] = string(body)
+		s.etags[name]++
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "DELETE":
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// Returns a checkpointer keeping its checkpoints on the server.
+func (s *blobServer) checkpointer(prefix string) *blobCheckpointer {
+	blobs, err := newBlobClient(&BlobStorageConfig{Endpoint: s.URL,
+		Container: "checkpoints", SasToken: "sig=abc"}, 0)
+	if err != nil {
+		panic(err)
+	}
+	return &blobCheckpointer{blobs: blobs, prefix: prefix}
+}
+
+func BlobCheckpointerSpec(c gs.Context) {
+	c.Specify("A blob checkpointer", func() {
+		server := newBlobServer()
+		defer server.Close()
+		cp := server.checkpointer("heka/")
+
+		c.Specify("sets and gets checkpoints", func() {
+			value, err := cp.Get("kafka/in")
+			c.Expect(err, gs.IsNil)
+			c.Expect(value == nil, gs.IsTrue)
+			c.Assume(cp.Set("kafka/in", []byte("42")), gs.IsNil)
+			value, err = cp.Get("kafka/in")
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(value), gs.Equals, "42")
+			c.Expect(server.blobs["heka/kafka/in"], gs.Equals, "42")
+		})
+
+		c.Specify("compares and sets", func() {
+			ok, err := cp.CompareAndSet("a", nil, []byte("1"))
+			c.Expect(err, gs.IsNil)
+			c.Expect(ok, gs.IsTrue)
+			ok, _ = cp.CompareAndSet("a", nil, []byte("2"))
+			c.Expect(ok, gs.IsFalse)
+			ok, _ = cp.CompareAndSet("a", []byte("3"), []byte("4"))
+			c.Expect(ok, gs.IsFalse)
+			ok, err = cp.CompareAndSet("a", []byte("1"), []byte("5"))
+			c.Expect(err, gs.IsNil)
+			c.Expect(ok, gs.IsTrue)
+			value, _ := cp.Get("a")
+			c.Expect(string(value), gs.Equals, "5")
+		})
+
+		c.Specify("deletes and lists checkpoints", func() {
+			c.Assume(cp.Set("b/2", []byte("x")), gs.IsNil)
+			c.Assume(cp.Set("a", []byte("x")), gs.IsNil)
+			server.blobs["other/c"] = "x"
+			keys, err := cp.List()
+			c.Expect(err, gs.IsNil)
+			c.Expect(strings.Join(keys, ","), gs.Equals, "a,b/2")
+			c.Expect(cp.Delete("a"), gs.IsNil)
+			c.Expect(cp.Delete("a"), gs.IsNil)
+			keys, _ = cp.List()
+			c.Expect(strings.Join(keys, ","), gs.Equals, "b/2")
+		})
+
+		c.Specify("rejects bad keys", func() {
+			c.Expect(cp.Set("/a", []byte("x")), gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,199 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package azure
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Storage account and container settings of a Blob service client.
+type BlobStorageConfig struct {
+	// Storage account's connection string, as shown in the Azure portal.
+	// Sets the account, account key and endpoint.
+	ConnectionString string `toml:"connection_string"`
+	// Storage account name, for an endpoint of
+	// "https://<account>.blob.core.windows.net".
+	Account string `toml:"account"`
+	// Blob service's base URL, overriding the one derived from the account.
+	Endpoint  string `toml:"endpoint"`
+	Container string `toml:"container"`
+	// Account key, base64 encoded, signing the requests with Shared Key.
+	AccountKey string `toml:"account_key"`
+	// Shared access signature query string, instead of an account key.
+	SasToken string `toml:"sas_token"`
+	// Service principal authenticating with Azure AD, instead of a key.
+	AAD *AADConfig `toml:"aad"`
+}
+
+// Version of the Blob service REST API the clients speak.
+const blobApiVersion = "2019-12-12"
+
+// Client for the blobs of one container.
+type blobClient struct {
+	containerUrl string
+	account      string
+	key          []byte
+	sasToken     string
+	aad          *aadToken
+	client       *http.Client
+	now          func() time.Time
+}
+
+func newBlobClient(conf *BlobStorageConfig, timeout time.Duration) (b *blobClient,
+	err error) {
+
+	account, accountKey, sasToken := conf.Account, conf.AccountKey, conf.SasToken
+	endpoint := conf.Endpoint
+	if conf.ConnectionString != "" {
+		settings, err := parseConnectionString(conf.ConnectionString)
+		if err != nil {
+			return nil, err
+		}
+		if account == "" {
+			account = settings["AccountName"]
+		}
+		if accountKey == "" {
+			accountKey = settings["AccountKey"]
+		}
+		if sasToken == "" {
+			sasToken = settings["SharedAccessSignature"]
+		}
+		if endpoint == "" {
+			endpoint = settings["BlobEndpoint"]
+		}
+		if endpoint == "" && settings["EndpointSuffix"] != "" {
+			protocol := settings["DefaultEndpointsProtocol"]
+			if protocol == "" {
+				protocol = "https"
+			}
+			endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, account,
+				settings["EndpointSuffix"])
+		}
+	}
+	if endpoint == "" {
+		if account == "" {
+			return nil, errors.New("an account, endpoint or connection_string must be set")
+		}
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	}
+	if conf.Container == "" {
+		return nil, errors.New("container must be set")
+	}
+
+	b = &blobClient{
+		containerUrl: strings.TrimRight(endpoint, "/") + "/" + url.PathEscape(conf.Container),
+		account:      account,
+		client:       &http.Client{Timeout: timeout},
+		now:          time.Now,
+	}
+	switch {
+	case conf.AAD != nil:
+		if b.aad, err = newAADToken(conf.AAD, "https://storage.azure.com/.default",
+			b.client); err != nil {
+			return nil, err
+		}
+	case accountKey != "":
+		if account == "" {
+			return nil, errors.New("signing with an account_key needs the account")
+		}
+		if b.key, err = base64.StdEncoding.DecodeString(accountKey); err != nil {
+			return nil, fmt.Errorf("can't decode account_key: %s", err)
+		}
+	case sasToken != "":
+		b.sasToken = strings.TrimPrefix(sasToken, "?")
+	default:
+		return nil, errors.New("an account_key, sas_token or aad settings must be set")
+	}
+	return b, nil
+}
+
+// Escapes a blob name for its URL, leaving the slashes of virtual
+// directories.
+func escapeBlobName(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// Sends a request for the blob, or for the container if blob is empty, and
+// returns the response with its body read.
+func (b *blobClient) request(method, blob, query string, body []byte,
+	header http.Header) (*http.Response, []byte, error) {
+
+	reqUrl := b.containerUrl
+	if blob != "" {
+		reqUrl += "/" + escapeBlobName(blob)
+	}
+	if b.sasToken != "" {
+		if query != "" {
+			query += "&"
+		}
+		query += b.sasToken
+	}
+	if query != "" {
+		reqUrl += "?" + query
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, reqUrl, bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set("x-ms-date", b.now().UTC().Format(http.TimeFormat))
+		req.Header.Set("x-ms-version", blobApiVersion)
+		if b.key != nil {
+			signSharedKey(req, b.account, b.key)
+		} else if b.aad != nil {
+			token, err := b.aad.Get()
+			if err != nil {
+				return nil, nil, fmt.Errorf("can't get Azure AD token: %s", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := b.client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && b.aad != nil && attempt == 0 {
+			// The token may have been revoked, try a fresh one.
+			b.aad.Invalidate()
+			continue
+		}
+		return resp, respBody, nil
+	}
+}
+
+// Returns an error for a response the blob service failed.
+func blobError(resp *http.Response, body []byte) error {
+	return fmt.Errorf("blob service responded %s: %s", resp.Status,
+		strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,285 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package azure
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type AzureBlobOutputConfig struct {
+	// Storage account's connection string, as shown in the Azure portal.
+	// Sets the account, account key and endpoint.
+	ConnectionString string `toml:"connection_string"`
+	// Storage account name, for an endpoint of
+	// "https://<account>.blob.core.windows.net".
+	Account string `toml:"account"`
+	// Blob service's base URL, overriding the one derived from the account.
+	Endpoint  string `toml:"endpoint"`
+	Container string `toml:"container"`
+	// Account key, base64 encoded, signing the requests with Shared Key.
+	AccountKey string `toml:"account_key"`
+	// Shared access signature query string, instead of an account key.
+	SasToken string `toml:"sas_token"`
+	// Service principal authenticating with Azure AD, instead of a key.
+	AAD *AADConfig `toml:"aad"`
+	// Start of the blobs' names, which are followed by the time the blob was
+	// started. Defaults to the plugin's name and a "-".
+	BlobPrefix string `toml:"blob_prefix"`
+	// End of the blobs' names. Defaults to ".log".
+	BlobSuffix string `toml:"blob_suffix"`
+	// Content type the blobs are served with. Defaults to
+	// "application/octet-stream".
+	ContentType string `toml:"content_type"`
+	// Size of the buffered data, in bytes, that's uploaded as a block.
+	// Defaults to 4MiB.
+	BlockSize uint `toml:"block_size"`
+	// Size in bytes at which a new blob is started. Defaults to 1GiB.
+	MaxBlobSize uint64 `toml:"max_blob_size"`
+	// Seconds after which a new blob is started. Defaults to 3600.
+	MaxBlobAge uint `toml:"max_blob_age"`
+	// Seconds between uploads of whatever data is buffered. Defaults to 60.
+	TickerInterval uint `toml:"ticker_interval"`
+	// Seconds each request may take. Defaults to 60.
+	Timeout uint `toml:"timeout"`
+}
+
+// Most blocks a block blob can have.
+const maxBlobBlocks = 50000
+
+// Output plugin that writes the messages it matches to block blobs in an
+// Azure Storage container, appending a block of their encoded form each time
+// enough are buffered, and rolling over to a new blob by size and age.
+type AzureBlobOutput struct {
+	conf   *AzureBlobOutputConfig
+	or     OutputRunner
+	blobs  *blobClient
+	prefix string
+	now    func() time.Time
+
+	buf []byte
+	// The current blob's name, committed block ids and size, and when it was
+	// started.
+	blob    string
+	blocks  []string
+	size    int64
+	started time.Time
+	// Cursor of the last buffered message, and whether any messages have been
+	// buffered since the cursor was last advanced.
+	cursor string
+	dirty  bool
+
+	// Accessed atomically, for the reports.
+	bufferedBytes  int64
+	blocksWritten  int64
+	blobsStarted   int64
+	uploadFailures int64
+}
+
+func (o *AzureBlobOutput) ConfigStruct() interface{} {
+	return &AzureBlobOutputConfig{
+		BlobSuffix:     ".log",
+		ContentType:    "application/octet-stream",
+		BlockSize:      4 * 1024 * 1024,
+		MaxBlobSize:    1024 * 1024 * 1024,
+		MaxBlobAge:     3600,
+		TickerInterval: 60,
+		Timeout:        60,
+	}
+}
+
+func (o *AzureBlobOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*AzureBlobOutputConfig)
+	conf := o.conf
+	storage := &BlobStorageConfig{
+		ConnectionString: conf.ConnectionString,
+		Account:          conf.Account,
+		Endpoint:         conf.Endpoint,
+		Container:        conf.Container,
+		AccountKey:       conf.AccountKey,
+		SasToken:         conf.SasToken,
+		AAD:              conf.AAD,
+	}
+	if o.blobs, err = newBlobClient(storage,
+		time.Duration(conf.Timeout)*time.Second); err != nil {
+		return err
+	}
+	if conf.BlockSize == 0 || conf.BlockSize > 100*1024*1024 {
+		return errors.New("block_size must be from 1 to 104857600")
+	}
+	if conf.MaxBlobSize == 0 {
+		return errors.New("max_blob_size must be greater than 0")
+	}
+	if conf.TickerInterval == 0 {
+		return errors.New("ticker_interval must be greater than 0")
+	}
+	if o.now == nil {
+		o.now = time.Now
+	}
+	o.blobs.now = o.now
+	return nil
+}
+
+func (o *AzureBlobOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	if or.Encoder() == nil {
+		return errors.New("an encoder must be specified")
+	}
+	o.or = or
+	if o.prefix = o.conf.BlobPrefix; o.prefix == "" {
+		o.prefix = or.Name() + "-"
+	}
+	return nil
+}
+
+// Makes a Blob service request for the current blob.
+func (o *AzureBlobOutput) request(method, query string, body []byte,
+	header http.Header) error {
+
+	resp, respBody, err := o.blobs.request(method, o.blob, query, body, header)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return blobError(resp, respBody)
+	}
+	return nil
+}
+
+// Tells if the current blob is big or old enough to be replaced.
+func (o *AzureBlobOutput) rotationDue() bool {
+	if uint64(o.size) >= o.conf.MaxBlobSize || len(o.blocks) >= maxBlobBlocks {
+		return true
+	}
+	age := time.Duration(o.conf.MaxBlobAge) * time.Second
+	return age > 0 && o.now().Sub(o.started) >= age
+}
+
+// Uploads the buffered data as a block of the current blob, or of a new one
+// if it's due, and commits it, advancing the cursor past it.
+func (o *AzureBlobOutput) flush() error {
+	if len(o.buf) == 0 {
+		return nil
+	}
+	if o.blob == "" || o.rotationDue() {
+		o.blob = o.prefix + o.now().UTC().Format("20060102T150405.000000Z") +
+			o.conf.BlobSuffix
+		o.blocks = nil
+		o.size = 0
+		o.started = o.now()
+		atomic.AddInt64(&o.blobsStarted, 1)
+	}
+
+	// Ids must all be the same length within a blob.
+	id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", len(o.blocks))))
+	if err := o.request("PUT", "comp=block&blockid="+url.QueryEscape(id), o.buf,
+		nil); err != nil {
+
+		atomic.AddInt64(&o.uploadFailures, 1)
+		return fmt.Errorf("can't upload block to '%s': %s", o.blob, err)
+	}
+	blockList := struct {
+		XMLName xml.Name `xml:"BlockList"`
+		Latest  []string `xml:"Latest"`
+	}{Latest: append(o.blocks, id)}
+	body, _ := xml.Marshal(blockList)
+	header := make(http.Header)
+	header.Set("Content-Type", "application/xml")
+	header.Set("x-ms-blob-content-type", o.conf.ContentType)
+	if err := o.request("PUT", "comp=blocklist", append([]byte(xml.Header), body...),
+		header); err != nil {
+
+		atomic.AddInt64(&o.uploadFailures, 1)
+		return fmt.Errorf("can't commit block of '%s': %s", o.blob, err)
+	}
+
+	o.blocks = blockList.Latest
+	o.size += int64(len(o.buf))
+	o.buf = o.buf[:0]
+	atomic.StoreInt64(&o.bufferedBytes, 0)
+	atomic.AddInt64(&o.blocksWritten, 1)
+	if o.dirty {
+		o.or.UpdateCursor(o.cursor)
+		o.dirty = false
+	}
+	return nil
+}
+
+func (o *AzureBlobOutput) ProcessMessage(pack *PipelinePack) error {
+	if uint(len(o.buf)) >= o.conf.BlockSize {
+		// The last upload failed, don't buffer any more until it succeeds.
+		if err := o.flush(); err != nil {
+			return NewRetryMessageError("%s", err)
+		}
+	}
+	record, err := o.or.Encode(pack)
+	if err != nil {
+		return fmt.Errorf("can't encode: %s", err)
+	}
+	if record == nil {
+		return nil
+	}
+	o.buf = append(o.buf, record...)
+	atomic.StoreInt64(&o.bufferedBytes, int64(len(o.buf)))
+	o.cursor = pack.QueueCursor
+	o.dirty = true
+	if uint(len(o.buf)) >= o.conf.BlockSize {
+		if err = o.flush(); err != nil {
+			o.or.LogError(err)
+		}
+	}
+	return nil
+}
+
+func (o *AzureBlobOutput) TimerEvent() error {
+	if err := o.flush(); err != nil {
+		o.or.LogError(err)
+	}
+	return nil
+}
+
+func (o *AzureBlobOutput) CleanUp() {
+	if err := o.flush(); err != nil {
+		o.or.LogError(fmt.Errorf("can't upload the buffered data: %s", err))
+	}
+}
+
+// Satisfies the `pipeline.ReportingPlugin` interface to provide plugin state
+// information to the Heka report and dashboard.
+func (o *AzureBlobOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "BufferedBytes",
+		atomic.LoadInt64(&o.bufferedBytes), "B")
+	message.NewInt64Field(msg, "BlocksWritten",
+		atomic.LoadInt64(&o.blocksWritten), "count")
+	message.NewInt64Field(msg, "BlobsStarted",
+		atomic.LoadInt64(&o.blobsStarted), "count")
+	message.NewInt64Field(msg, "UploadFailures",
+		atomic.LoadInt64(&o.uploadFailures), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("AzureBlobOutput", func() interface{} {
+		return new(AzureBlobOutput)
+	})
+}
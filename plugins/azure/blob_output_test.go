@@ -0,0 +1,192 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package azure
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func AzureBlobOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("An AzureBlobOutput", func() {
+		var requests []received
+		status := http.StatusCreated
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				requests = append(requests, received{r.Method, r.URL.Path,
+					r.URL.RawQuery, r.Header, string(body)})
+				w.WriteHeader(status)
+			}))
+		defer server.Close()
+
+		output := new(AzureBlobOutput)
+		config := output.ConfigStruct().(*AzureBlobOutputConfig)
+		config.ConnectionString = "DefaultEndpointsProtocol=https;AccountName=acct;" +
+			"AccountKey=c2VjcmV0a2V5;EndpointSuffix=core.windows.net"
+		config.Endpoint = server.URL
+		config.Container = "logs"
+		config.BlockSize = 4
+		now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+		output.now = func() time.Time { return now }
+
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		or.EXPECT().Name().Return("Blob").AnyTimes()
+		or.EXPECT().Encoder().Return(new(ProtobufEncoder)).AnyTimes()
+		or.EXPECT().LogError(gomock.Any()).AnyTimes()
+
+		send := func(record, cursor string) error {
+			pack := NewPipelinePack(pConfig.InputRecycleChan())
+			pack.QueueCursor = cursor
+			or.EXPECT().Encode(pack).Return([]byte(record), nil)
+			return output.ProcessMessage(pack)
+		}
+		blockId := func(n string) string {
+			return base64.StdEncoding.EncodeToString([]byte(n))
+		}
+
+		c.Specify("appends a block once block_size is buffered", func() {
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(send("ab", "1"), gs.IsNil)
+			c.Expect(len(requests), gs.Equals, 0)
+			or.EXPECT().UpdateCursor("2")
+			c.Expect(send("cd", "2"), gs.IsNil)
+
+			c.Assume(len(requests), gs.Equals, 2)
+			put := requests[0]
+			c.Expect(put.method, gs.Equals, "PUT")
+			c.Expect(put.path, gs.Equals, "/logs/Blob-20150601T120000.000000Z.log")
+			c.Expect(put.query, gs.Equals, "comp=block&blockid="+
+				strings.Replace(blockId("00000000"), "=", "%3D", -1))
+			c.Expect(put.body, gs.Equals, "abcd")
+			c.Expect(put.header.Get("x-ms-version"), gs.Equals, blobApiVersion)
+			c.Expect(strings.HasPrefix(put.header.Get("Authorization"), "SharedKey acct:"),
+				gs.IsTrue)
+			commit := requests[1]
+			c.Expect(commit.query, gs.Equals, "comp=blocklist")
+			c.Expect(strings.Contains(commit.body,
+				"<BlockList><Latest>"+blockId("00000000")+"</Latest></BlockList>"), gs.IsTrue)
+			c.Expect(commit.header.Get("x-ms-blob-content-type"), gs.Equals,
+				"application/octet-stream")
+
+			c.Specify("committing the earlier blocks with the next", func() {
+				or.EXPECT().UpdateCursor("3")
+				c.Expect(send("e", "3"), gs.IsNil)
+				c.Expect(output.TimerEvent(), gs.IsNil)
+				c.Assume(len(requests), gs.Equals, 4)
+				c.Expect(requests[2].path, gs.Equals, put.path)
+				c.Expect(strings.Contains(requests[3].body,
+					"<Latest>"+blockId("00000000")+"</Latest><Latest>"+
+						blockId("00000001")+"</Latest>"), gs.IsTrue)
+			})
+
+			c.Specify("starting a new blob once max_blob_age has passed", func() {
+				or.EXPECT().UpdateCursor("3")
+				now = now.Add(time.Hour)
+				c.Expect(send("e", "3"), gs.IsNil)
+				c.Expect(output.TimerEvent(), gs.IsNil)
+				c.Assume(len(requests), gs.Equals, 4)
+				c.Expect(requests[2].path, gs.Equals,
+					"/logs/Blob-20150601T130000.000000Z.log")
+				c.Expect(output.blobsStarted, gs.Equals, int64(2))
+			})
+		})
+
+		c.Specify("starts a new blob once max_blob_size is reached", func() {
+			config.MaxBlobSize = 4
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			or.EXPECT().UpdateCursor(gomock.Any()).AnyTimes()
+			c.Expect(send("abcd", ""), gs.IsNil)
+			now = now.Add(time.Second)
+			c.Expect(send("efgh", ""), gs.IsNil)
+			c.Assume(len(requests), gs.Equals, 4)
+			c.Expect(requests[2].path, gs.Equals, "/logs/Blob-20150601T120001.000000Z.log")
+		})
+
+		c.Specify("stops buffering while it can't upload", func() {
+			status = http.StatusInternalServerError
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(send("abcd", ""), gs.IsNil)
+			// Retried without being encoded.
+			pack := NewPipelinePack(pConfig.InputRecycleChan())
+			err := output.ProcessMessage(pack)
+			_, retry := err.(RetryMessageError)
+			c.Expect(retry, gs.IsTrue)
+			c.Expect(output.bufferedBytes, gs.Equals, int64(4))
+			c.Expect(output.uploadFailures, gs.Equals, int64(2))
+		})
+
+		c.Specify("authenticates with a shared access signature", func() {
+			config.ConnectionString = ""
+			config.SasToken = "?sv=2019-12-12&sig=abc"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			or.EXPECT().UpdateCursor("")
+			c.Expect(send("abcd", ""), gs.IsNil)
+			c.Assume(len(requests), gs.Equals, 2)
+			c.Expect(strings.HasSuffix(requests[1].query, "&sv=2019-12-12&sig=abc"),
+				gs.IsTrue)
+			c.Expect(requests[1].header.Get("Authorization"), gs.Equals, "")
+		})
+
+		c.Specify("rejects", func() {
+			c.Specify("a config without a container", func() {
+				config.Container = ""
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("a config without credentials", func() {
+				config.ConnectionString = ""
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("an account key that isn't base64", func() {
+				config.AccountKey = "not base64!"
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+		})
+	})
+
+	c.Specify("A Shared Key signature", func() {
+		req, err := http.NewRequest("PUT", "https://acct.blob.core.windows.net/logs/"+
+			"a%20b.log?comp=block&blockid=MDAwMDAwMDA%3D", strings.NewReader("abc"))
+		c.Assume(err, gs.IsNil)
+		req.Header.Set("x-ms-date", "Mon, 01 Jun 2015 12:00:00 GMT")
+		req.Header.Set("x-ms-version", blobApiVersion)
+		key, _ := base64.StdEncoding.DecodeString("c2VjcmV0a2V5")
+		signSharedKey(req, "acct", key)
+		c.Expect(req.Header.Get("Authorization"), gs.Equals,
+			"SharedKey acct:YfK3ZJjyKrmwxOdAyq2yILQAoj7J2tKNUsWLsRKUGHk=")
+	})
+}
@@ -0,0 +1,403 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type AzureEventHubsInputConfig struct {
+	// Namespace's connection string, as shown in the Azure portal. Sets the
+	// namespace, shared access key and, if it has an EntityPath, the event
+	// hub.
+	ConnectionString string `toml:"connection_string"`
+	// Namespace name, for a namespace host of
+	// "<namespace>.servicebus.windows.net".
+	Namespace string `toml:"namespace"`
+	EventHub  string `toml:"event_hub"`
+	// Shared access policy the input authenticates with.
+	SharedAccessKeyName string `toml:"shared_access_key_name"`
+	SharedAccessKey     string `toml:"shared_access_key"`
+	// Service principal authenticating with Azure AD, instead of a shared
+	// access key.
+	AAD *AADConfig `toml:"aad"`
+	// "host:port" of the namespace's Kafka endpoint. Defaults to port 9093
+	// of the namespace host.
+	Address string `toml:"address"`
+	// Consumer group the checkpoints are kept for. Defaults to "$Default".
+	ConsumerGroup string `toml:"consumer_group"`
+	// Partitions consumed. Defaults to all of the event hub's.
+	Partitions []int32 `toml:"partitions"`
+	// Where partitions without a checkpoint are read from, "earliest" or
+	// "latest". Defaults to "earliest".
+	StartFrom string `toml:"start_from"`
+	// Container the checkpoints are kept in. Defaults to Heka's checkpoint
+	// storage.
+	Checkpoint *BlobStorageConfig `toml:"checkpoint"`
+	// Prefix of the checkpoint blobs' names.
+	CheckpointPrefix string `toml:"checkpoint_prefix"`
+	// Seconds between checkpoint writes. Defaults to 10.
+	CheckpointInterval uint `toml:"checkpoint_interval"`
+	Splitter           string
+}
+
+// Provides Azure AD tokens for SASL/OAUTHBEARER.
+type aadTokenProvider struct {
+	token *aadToken
+}
+
+func (a aadTokenProvider) Token() (*sarama.AccessToken, error) {
+	token, err := a.token.Get()
+	if err != nil {
+		return nil, err
+	}
+	return &sarama.AccessToken{Token: token}, nil
+}
+
+// Input plugin that consumes the partitions of an Azure event hub, through
+// the namespace's Kafka endpoint, keeping a checkpoint of each partition's
+// offset in blob storage.
+type AzureEventHubsInput struct {
+	conf         *AzureEventHubsInputConfig
+	name         string
+	host         string
+	saramaConfig *sarama.Config
+	checkpointer Checkpointer
+	// Creates the consumer, replaced by the tests.
+	newConsumer func(addrs []string, config *sarama.Config) (sarama.Consumer, error)
+	stopChan    chan bool
+
+	// The offsets after the last events delivered from each partition, and
+	// whether they've changed since they were checkpointed.
+	lock    sync.Mutex
+	offsets map[int32]int64
+	dirty   map[int32]bool
+
+	// Accessed atomically, for the reports.
+	processMessageCount    int64
+	processMessageFailures int64
+	checkpointFailures     int64
+}
+
+func (i *AzureEventHubsInput) ConfigStruct() interface{} {
+	return &AzureEventHubsInputConfig{
+		ConsumerGroup:      "$Default",
+		StartFrom:          "earliest",
+		CheckpointInterval: 10,
+		Splitter:           "NullSplitter",
+	}
+}
+
+func (i *AzureEventHubsInput) SetName(name string) {
+	i.name = name
+}
+
+func (i *AzureEventHubsInput) Init(config interface{}) (err error) {
+	i.conf = config.(*AzureEventHubsInputConfig)
+	conf := i.conf
+	password := conf.ConnectionString
+	if conf.ConnectionString != "" {
+		settings, err := parseConnectionString(conf.ConnectionString)
+		if err != nil {
+			return err
+		}
+		if endpoint, err := url.Parse(settings["Endpoint"]); err == nil {
+			i.host = endpoint.Host
+		}
+		if conf.EventHub == "" {
+			conf.EventHub = settings["EntityPath"]
+		}
+	}
+	if i.host == "" {
+		if conf.Namespace == "" {
+			return errors.New("a namespace or connection_string must be set")
+		}
+		i.host = conf.Namespace + ".servicebus.windows.net"
+	}
+	if conf.EventHub == "" {
+		return errors.New("event_hub must be set")
+	}
+	if conf.Address == "" {
+		conf.Address = net.JoinHostPort(i.host, "9093")
+	}
+	if conf.StartFrom != "earliest" && conf.StartFrom != "latest" {
+		return fmt.Errorf("start_from must be 'earliest' or 'latest', got '%s'",
+			conf.StartFrom)
+	}
+	if conf.CheckpointInterval == 0 {
+		return errors.New("checkpoint_interval must be greater than 0")
+	}
+
+	sc := sarama.NewConfig()
+	sc.ClientID = i.name
+	// The Kafka endpoint speaks the 1.0 protocol and up.
+	sc.Version = sarama.V1_0_0_0
+	sc.Net.TLS.Enable = true
+	sc.Net.SASL.Enable = true
+	sc.Net.SASL.Version = sarama.SASLHandshakeV0
+	if conf.AAD != nil {
+		token, err := newAADToken(conf.AAD, fmt.Sprintf("https://%s/.default", i.host),
+			&http.Client{Timeout: 30 * time.Second})
+		if err != nil {
+			return err
+		}
+		sc.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+		sc.Net.SASL.TokenProvider = aadTokenProvider{token}
+	} else {
+		if password == "" {
+			if conf.SharedAccessKeyName == "" || conf.SharedAccessKey == "" {
+				return errors.New("a shared access key or aad settings must be set")
+			}
+			password = fmt.Sprintf("Endpoint=sb://%s/;SharedAccessKeyName=%s;"+
+				"SharedAccessKey=%s", i.host, conf.SharedAccessKeyName,
+				conf.SharedAccessKey)
+		}
+		sc.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		sc.Net.SASL.User = "$ConnectionString"
+		sc.Net.SASL.Password = password
+	}
+	sc.Consumer.Return.Errors = true
+	i.saramaConfig = sc
+
+	if conf.Checkpoint != nil {
+		blobs, err := newBlobClient(conf.Checkpoint, 30*time.Second)
+		if err != nil {
+			return fmt.Errorf("checkpoint: %s", err)
+		}
+		i.checkpointer = &blobCheckpointer{blobs: blobs, prefix: conf.CheckpointPrefix}
+	}
+	if i.newConsumer == nil {
+		i.newConsumer = sarama.NewConsumer
+	}
+	i.offsets = make(map[int32]int64)
+	i.dirty = make(map[int32]bool)
+	i.stopChan = make(chan bool)
+	return nil
+}
+
+// Returns the key of a partition's checkpoint.
+func (i *AzureEventHubsInput) checkpointKey(partition int32) string {
+	return fmt.Sprintf("eventhubs/%s/%s/%s/%d", i.host, i.conf.EventHub,
+		i.conf.ConsumerGroup, partition)
+}
+
+// Returns the offset a partition is read from, its checkpoint if it has one.
+func (i *AzureEventHubsInput) startOffset(partition int32) (int64, error) {
+	value, err := i.checkpointer.Get(i.checkpointKey(partition))
+	if err != nil {
+		return 0, fmt.Errorf("can't read checkpoint of partition %d: %s", partition, err)
+	}
+	if value != nil {
+		offset, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad checkpoint %q for partition %d", value, partition)
+		}
+		return offset, nil
+	}
+	if i.conf.StartFrom == "latest" {
+		return sarama.OffsetNewest, nil
+	}
+	return sarama.OffsetOldest, nil
+}
+
+// Writes the checkpoints of the partitions that have moved on since the last
+// write.
+func (i *AzureEventHubsInput) writeCheckpoints(ir InputRunner) {
+	i.lock.Lock()
+	offsets := make(map[int32]int64, len(i.dirty))
+	for partition := range i.dirty {
+		offsets[partition] = i.offsets[partition]
+	}
+	i.dirty = make(map[int32]bool)
+	i.lock.Unlock()
+
+	for partition, offset := range offsets {
+		err := i.checkpointer.Set(i.checkpointKey(partition),
+			[]byte(strconv.FormatInt(offset, 10)))
+		if err != nil {
+			atomic.AddInt64(&i.checkpointFailures, 1)
+			ir.LogError(fmt.Errorf("can't checkpoint partition %d: %s", partition, err))
+			i.lock.Lock()
+			i.dirty[partition] = true
+			i.lock.Unlock()
+		}
+	}
+}
+
+// Delivers a partition's events until its consumer is closed.
+func (i *AzureEventHubsInput) consume(ir InputRunner, pc sarama.PartitionConsumer,
+	partition int32, hostname string, errChan chan error) {
+
+	sRunner := ir.NewSplitterRunner(strconv.Itoa(int(partition)))
+	defer sRunner.Done()
+	var event *sarama.ConsumerMessage
+	if !sRunner.UseMsgBytes() {
+		sRunner.SetPackDecorator(func(pack *PipelinePack) {
+			pack.Message.SetType("heka.eventhubs")
+			pack.Message.SetLogger(i.name)
+			pack.Message.SetHostname(hostname)
+			message.NewStringField(pack.Message, "EventHub", i.conf.EventHub)
+			message.NewInt64Field(pack.Message, "Partition", int64(partition), "")
+			message.NewInt64Field(pack.Message, "Offset", event.Offset, "")
+			if len(event.Key) > 0 {
+				message.NewStringField(pack.Message, "Key", string(event.Key))
+			}
+			if !event.Timestamp.IsZero() {
+				message.NewTimestampField(pack.Message, "EnqueuedTime", event.Timestamp)
+			}
+		})
+	}
+
+	messages, errs := pc.Messages(), pc.Errors()
+	for messages != nil {
+		var ok bool
+		select {
+		case event, ok = <-messages:
+			if !ok {
+				messages = nil
+				continue
+			}
+			atomic.AddInt64(&i.processMessageCount, 1)
+			n, err := sRunner.SplitBytes(event.Value, nil)
+			if err != nil {
+				ir.LogError(fmt.Errorf("processing event from partition %d: %s",
+					partition, err))
+			} else if n > 0 && n != len(event.Value) {
+				ir.LogError(fmt.Errorf("extra data dropped in event from partition %d",
+					partition))
+			}
+			i.lock.Lock()
+			i.offsets[partition] = event.Offset + 1
+			i.dirty[partition] = true
+			i.lock.Unlock()
+
+		case cErr, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if cErr.Err == sarama.ErrOffsetOutOfRange {
+				// The checkpointed events have expired from the event hub.
+				if err := i.checkpointer.Delete(i.checkpointKey(partition)); err != nil {
+					ir.LogError(err)
+				}
+				select {
+				case errChan <- fmt.Errorf("partition %d's checkpoint is out of range, "+
+					"removed it", partition):
+				default:
+				}
+				continue
+			}
+			atomic.AddInt64(&i.processMessageFailures, 1)
+			ir.LogError(fmt.Errorf("partition %d: %s", partition, cErr.Err))
+		}
+	}
+}
+
+func (i *AzureEventHubsInput) Run(ir InputRunner, h PluginHelper) (err error) {
+	pConfig := h.PipelineConfig()
+	if i.checkpointer == nil {
+		i.checkpointer = pConfig.Checkpointer()
+	}
+	consumer, err := i.newConsumer([]string{i.conf.Address}, i.saramaConfig)
+	if err != nil {
+		return fmt.Errorf("can't connect to %s: %s", i.conf.Address, err)
+	}
+	defer consumer.Close()
+	partitions := i.conf.Partitions
+	if len(partitions) == 0 {
+		if partitions, err = consumer.Partitions(i.conf.EventHub); err != nil {
+			return fmt.Errorf("can't list the partitions of '%s': %s", i.conf.EventHub,
+				err)
+		}
+	}
+
+	var pcs []sarama.PartitionConsumer
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(partitions))
+	defer func() {
+		for _, pc := range pcs {
+			pc.AsyncClose()
+		}
+		wg.Wait()
+		i.writeCheckpoints(ir)
+	}()
+	hostname := pConfig.Hostname()
+	for _, partition := range partitions {
+		offset, err := i.startOffset(partition)
+		if err != nil {
+			return err
+		}
+		pc, err := consumer.ConsumePartition(i.conf.EventHub, partition, offset)
+		if err != nil {
+			return fmt.Errorf("can't consume partition %d: %s", partition, err)
+		}
+		pcs = append(pcs, pc)
+		wg.Add(1)
+		go func(partition int32) {
+			i.consume(ir, pc, partition, hostname, errChan)
+			wg.Done()
+		}(partition)
+	}
+
+	ticker := time.NewTicker(time.Duration(i.conf.CheckpointInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			i.writeCheckpoints(ir)
+		case err = <-errChan:
+			return err
+		case <-i.stopChan:
+			return nil
+		}
+	}
+}
+
+func (i *AzureEventHubsInput) Stop() {
+	close(i.stopChan)
+}
+
+func (i *AzureEventHubsInput) CleanupForRestart() {
+	i.stopChan = make(chan bool)
+}
+
+func (i *AzureEventHubsInput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "ProcessMessageCount",
+		atomic.LoadInt64(&i.processMessageCount), "count")
+	message.NewInt64Field(msg, "ProcessMessageFailures",
+		atomic.LoadInt64(&i.processMessageFailures), "count")
+	message.NewInt64Field(msg, "CheckpointFailures",
+		atomic.LoadInt64(&i.checkpointFailures), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("AzureEventHubsInput", func() interface{} {
+		return new(AzureEventHubsInput)
+	})
+}
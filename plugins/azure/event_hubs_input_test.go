@@ -0,0 +1,154 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package azure
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func AzureEventHubsInputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("An AzureEventHubsInput", func() {
+		input := new(AzureEventHubsInput)
+		input.SetName("EventHubs")
+		config := input.ConfigStruct().(*AzureEventHubsInputConfig)
+		config.ConnectionString = "Endpoint=sb://ns.servicebus.windows.net/;" +
+			"SharedAccessKeyName=listen;SharedAccessKey=c2VjcmV0=;EntityPath=logs"
+
+		c.Specify("authenticates to the Kafka endpoint", func() {
+			c.Assume(input.Init(config), gs.IsNil)
+			c.Expect(config.Address, gs.Equals, "ns.servicebus.windows.net:9093")
+			sasl := input.saramaConfig.Net.SASL
+			c.Expect(input.saramaConfig.Net.TLS.Enable, gs.IsTrue)
+			c.Expect(string(sasl.Mechanism), gs.Equals, sarama.SASLTypePlaintext)
+			c.Expect(sasl.User, gs.Equals, "$ConnectionString")
+			c.Expect(sasl.Password, gs.Equals, config.ConnectionString)
+
+			c.Specify("with a separate shared access key", func() {
+				config.ConnectionString = ""
+				config.Namespace = "ns"
+				config.SharedAccessKeyName = "listen"
+				config.SharedAccessKey = "c2VjcmV0="
+				c.Assume(input.Init(config), gs.IsNil)
+				c.Expect(input.saramaConfig.Net.SASL.Password, gs.Equals,
+					"Endpoint=sb://ns.servicebus.windows.net/;"+
+						"SharedAccessKeyName=listen;SharedAccessKey=c2VjcmV0=")
+			})
+
+			c.Specify("with Azure AD", func() {
+				config.AAD = &AADConfig{TenantId: "t", ClientId: "c", ClientSecret: "s"}
+				c.Assume(input.Init(config), gs.IsNil)
+				sasl := input.saramaConfig.Net.SASL
+				c.Expect(string(sasl.Mechanism), gs.Equals, sarama.SASLTypeOAuth)
+				c.Expect(sasl.TokenProvider.(aadTokenProvider).token.scope, gs.Equals,
+					"https://ns.servicebus.windows.net/.default")
+			})
+		})
+
+		c.Specify("consumes the partitions from their checkpoints", func() {
+			server := newBlobServer()
+			defer server.Close()
+			checkpointer := server.checkpointer("")
+			ckey := "eventhubs/ns.servicebus.windows.net/logs/$Default/"
+			c.Assume(checkpointer.Set(ckey+"0", []byte("7")), gs.IsNil)
+
+			consumer := mocks.NewConsumer(t, nil)
+			consumer.SetTopicMetadata(map[string][]int32{"logs": {0, 1}})
+			pc0 := consumer.ExpectConsumePartition("logs", 0, 7)
+			consumer.ExpectConsumePartition("logs", 1, sarama.OffsetOldest)
+			input.newConsumer = func(addrs []string, config *sarama.Config) (
+				sarama.Consumer, error) {
+
+				c.Expect(addrs[0], gs.Equals, "ns.servicebus.windows.net:9093")
+				return consumer, nil
+			}
+			c.Assume(input.Init(config), gs.IsNil)
+			input.checkpointer = checkpointer
+
+			pConfig := NewPipelineConfig(nil)
+			h := pipelinemock.NewMockPluginHelper(ctrl)
+			h.EXPECT().PipelineConfig().Return(pConfig)
+			ir := pipelinemock.NewMockInputRunner(ctrl)
+			ir.EXPECT().LogError(gomock.Any()).AnyTimes()
+			delivered := make(chan []byte, 2)
+			for _, token := range []string{"0", "1"} {
+				sr := pipelinemock.NewMockSplitterRunner(ctrl)
+				ir.EXPECT().NewSplitterRunner(token).Return(sr)
+				sr.EXPECT().UseMsgBytes().Return(false)
+				sr.EXPECT().SetPackDecorator(gomock.Any())
+				sr.EXPECT().SplitBytes(gomock.Any(), nil).Return(1, nil).Do(
+					func(data []byte, del Deliverer) { delivered <- data }).AnyTimes()
+				sr.EXPECT().Done()
+			}
+
+			pc0.YieldMessage(&sarama.ConsumerMessage{Value: []byte("a")})
+			done := make(chan error)
+			go func() {
+				done <- input.Run(ir, h)
+			}()
+			select {
+			case data := <-delivered:
+				c.Expect(string(data), gs.Equals, "a")
+			case <-time.After(time.Second):
+				c.Expect("delivered", gs.Equals, "timed out")
+			}
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+
+			// The mock's first offset is 1.
+			value, _ := checkpointer.Get(ckey + "0")
+			c.Expect(string(value), gs.Equals, "2")
+			value, _ = checkpointer.Get(ckey + "1")
+			c.Expect(value == nil, gs.IsTrue)
+		})
+
+		c.Specify("rejects", func() {
+			c.Specify("a config without an event hub", func() {
+				config.ConnectionString = ""
+				config.Namespace = "ns"
+				c.Expect(input.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("a config without credentials", func() {
+				config.ConnectionString = ""
+				config.Namespace = "ns"
+				config.EventHub = "logs"
+				c.Expect(input.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("an unknown start_from", func() {
+				config.StartFrom = "middle"
+				c.Expect(input.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("a checkpoint container without credentials", func() {
+				config.Checkpoint = &BlobStorageConfig{Account: "acct",
+					Container: "checkpoints"}
+				c.Expect(input.Init(config), gs.Not(gs.IsNil))
+			})
+		})
+	})
+}
@@ -0,0 +1,384 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package azure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type AzureEventHubsRestOutputConfig struct {
+	// Namespace's connection string, as shown in the Azure portal. Sets the
+	// endpoint, shared access key and, if it has an EntityPath, the event hub.
+	ConnectionString string `toml:"connection_string"`
+	// Namespace name, for an endpoint of
+	// "https://<namespace>.servicebus.windows.net".
+	Namespace string `toml:"namespace"`
+	// Namespace's base URL, overriding the one derived from the namespace.
+	Endpoint string `toml:"endpoint"`
+	EventHub string `toml:"event_hub"`
+	// Shared access policy signing the requests.
+	SharedAccessKeyName string `toml:"shared_access_key_name"`
+	SharedAccessKey     string `toml:"shared_access_key"`
+	// Service principal authenticating with Azure AD, instead of a shared
+	// access key.
+	AAD *AADConfig `toml:"aad"`
+	// Header name, or field name wrapped in "Fields[]", whose value is the
+	// events' partition key, keeping the events with the same value in order
+	// on the same partition. Defaults to none, spreading the events over the
+	// partitions.
+	PartitionKey string `toml:"partition_key"`
+	// Largest number of events sent in one request. Defaults to 100.
+	MaxBatchCount uint `toml:"max_batch_count"`
+	// Largest size of the events sent in one request, in bytes. Defaults to
+	// 1000000, the limit of the standard tier being 1MiB.
+	MaxBatchBytes uint `toml:"max_batch_bytes"`
+	// Seconds between sends of whatever events are batched. Defaults to 1.
+	TickerInterval uint `toml:"ticker_interval"`
+	// Seconds each request may take. Defaults to 30.
+	Timeout uint `toml:"timeout"`
+}
+
+// Lifetime of the shared access signatures the output makes.
+const sasLifetime = time.Hour
+
+// The events batched for one partition key.
+type eventBatch struct {
+	key    string
+	events [][]byte
+	size   int
+}
+
+// Output plugin that sends the messages it matches to an Azure event hub, as
+// events of their encoded form, over the Event Hubs REST API.
+type AzureEventHubsRestOutput struct {
+	conf     *AzureEventHubsRestOutputConfig
+	or       OutputRunner
+	client   *http.Client
+	hubUrl   string
+	aad      *aadToken
+	key      func(msg *message.Message) (string, bool)
+	batches  map[string]*eventBatch
+	batched  int
+	sas      string
+	sasUntil time.Time
+	// Cursor of the last batched message, and whether any messages have been
+	// batched since the cursor was last advanced.
+	cursor string
+	dirty  bool
+	// Whether a send has failed, stopping batching until the next succeeds.
+	failing bool
+
+	// Accessed atomically, for the reports.
+	eventsSent    int64
+	requestsSent  int64
+	sendFailures  int64
+	batchedEvents int64
+}
+
+func (o *AzureEventHubsRestOutput) ConfigStruct() interface{} {
+	return &AzureEventHubsRestOutputConfig{
+		MaxBatchCount:  100,
+		MaxBatchBytes:  1000000,
+		TickerInterval: 1,
+		Timeout:        30,
+	}
+}
+
+func (o *AzureEventHubsRestOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*AzureEventHubsRestOutputConfig)
+	conf := o.conf
+	endpoint := conf.Endpoint
+	if conf.ConnectionString != "" {
+		settings, err := parseConnectionString(conf.ConnectionString)
+		if err != nil {
+			return err
+		}
+		if endpoint == "" {
+			// The "sb://" endpoints are served over HTTPS too.
+			endpoint = strings.Replace(settings["Endpoint"], "sb://", "https://", 1)
+		}
+		if conf.SharedAccessKeyName == "" {
+			conf.SharedAccessKeyName = settings["SharedAccessKeyName"]
+			conf.SharedAccessKey = settings["SharedAccessKey"]
+		}
+		if conf.EventHub == "" {
+			conf.EventHub = settings["EntityPath"]
+		}
+	}
+	if endpoint == "" {
+		if conf.Namespace == "" {
+			return errors.New("a namespace, endpoint or connection_string must be set")
+		}
+		endpoint = fmt.Sprintf("https://%s.servicebus.windows.net", conf.Namespace)
+	}
+	if conf.EventHub == "" {
+		return errors.New("event_hub must be set")
+	}
+	o.hubUrl = strings.TrimRight(endpoint, "/") + "/" + url.PathEscape(conf.EventHub)
+
+	o.client = &http.Client{Timeout: time.Duration(conf.Timeout) * time.Second}
+	if conf.AAD != nil {
+		if o.aad, err = newAADToken(conf.AAD, "https://eventhubs.azure.net/.default",
+			o.client); err != nil {
+			return err
+		}
+	} else if conf.SharedAccessKeyName == "" || conf.SharedAccessKey == "" {
+		return errors.New("a shared access key or aad settings must be set")
+	}
+
+	if conf.PartitionKey != "" {
+		if o.key, err = MessageKey(conf.PartitionKey); err != nil {
+			return fmt.Errorf("can't use partition_key '%s': %s", conf.PartitionKey, err)
+		}
+	}
+	if conf.MaxBatchCount == 0 {
+		return errors.New("max_batch_count must be greater than 0")
+	}
+	if conf.TickerInterval == 0 {
+		return errors.New("ticker_interval must be greater than 0")
+	}
+	o.batches = make(map[string]*eventBatch)
+	return nil
+}
+
+func (o *AzureEventHubsRestOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	if or.Encoder() == nil {
+		return errors.New("an encoder must be specified")
+	}
+	o.or = or
+	return nil
+}
+
+// Returns the Authorization header value for the next request.
+func (o *AzureEventHubsRestOutput) auth() (string, error) {
+	if o.aad != nil {
+		token, err := o.aad.Get()
+		if err != nil {
+			return "", fmt.Errorf("can't get Azure AD token: %s", err)
+		}
+		return "Bearer " + token, nil
+	}
+	if now := time.Now(); o.sas == "" || now.After(o.sasUntil) {
+		expiry := now.Add(sasLifetime)
+		o.sas = serviceBusSAS(o.hubUrl, o.conf.SharedAccessKeyName,
+			o.conf.SharedAccessKey, expiry)
+		o.sasUntil = expiry.Add(-5 * time.Minute)
+	}
+	return o.sas, nil
+}
+
+// Sends the batch's events in one request. Events that aren't UTF-8 text
+// can't be carried in a JSON batch, so those and batches of one event are
+// sent as the request's body.
+func (o *AzureEventHubsRestOutput) send(batch *eventBatch) error {
+	var body []byte
+	header := make(http.Header)
+	var props []byte
+	if batch.key != "" {
+		props, _ = json.Marshal(map[string]string{"PartitionKey": batch.key})
+	}
+	if len(batch.events) == 1 {
+		body = batch.events[0]
+		header.Set("Content-Type", "application/atom+xml;type=entry;charset=utf-8")
+		if props != nil {
+			header.Set("BrokerProperties", string(props))
+		}
+	} else {
+		type event struct {
+			Body             string
+			BrokerProperties json.RawMessage `json:",omitempty"`
+		}
+		events := make([]event, len(batch.events))
+		for i, e := range batch.events {
+			events[i] = event{Body: string(e), BrokerProperties: props}
+		}
+		body, _ = json.Marshal(events)
+		header.Set("Content-Type", "application/vnd.microsoft.servicebus.json")
+	}
+
+	for attempt := 0; ; attempt++ {
+		auth, err := o.auth()
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest("POST",
+			o.hubUrl+"/messages?timeout=60&api-version=2014-01", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set("Authorization", auth)
+		resp, err := o.client.Do(req)
+		atomic.AddInt64(&o.requestsSent, 1)
+		if err != nil {
+			return err
+		}
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized && o.aad != nil && attempt == 0 {
+			// The token may have been revoked, try a fresh one.
+			o.aad.Invalidate()
+			continue
+		}
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("event hub responded %s: %s", resp.Status,
+				strings.TrimSpace(string(respBody)))
+		}
+		atomic.AddInt64(&o.eventsSent, int64(len(batch.events)))
+		return nil
+	}
+}
+
+// Sends a batch and forgets it once it's sent.
+func (o *AzureEventHubsRestOutput) sendBatch(batch *eventBatch) error {
+	if err := o.send(batch); err != nil {
+		atomic.AddInt64(&o.sendFailures, 1)
+		o.failing = true
+		return fmt.Errorf("can't send %d events: %s", len(batch.events), err)
+	}
+	delete(o.batches, batch.key)
+	o.batched -= len(batch.events)
+	atomic.StoreInt64(&o.batchedEvents, int64(o.batched))
+	o.failing = false
+	return nil
+}
+
+// Sends all the batched events, in order of partition key, and advances the
+// cursor once they're all sent.
+func (o *AzureEventHubsRestOutput) flush() error {
+	keys := make([]string, 0, len(o.batches))
+	for key := range o.batches {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := o.sendBatch(o.batches[key]); err != nil {
+			return err
+		}
+	}
+	if o.dirty {
+		o.or.UpdateCursor(o.cursor)
+		o.dirty = false
+	}
+	return nil
+}
+
+// Returns the space an event takes in a JSON batch.
+func batchedSize(event []byte) int {
+	body, _ := json.Marshal(string(event))
+	// Allowing for the event's other members.
+	return len(body) + 64
+}
+
+func (o *AzureEventHubsRestOutput) ProcessMessage(pack *PipelinePack) error {
+	if o.failing {
+		// Don't batch any more until the failed sends succeed.
+		if err := o.flush(); err != nil {
+			return NewRetryMessageError("%s", err)
+		}
+	}
+	event, err := o.or.Encode(pack)
+	if err != nil {
+		return fmt.Errorf("can't encode: %s", err)
+	}
+	if event == nil {
+		return nil
+	}
+	var key string
+	if o.key != nil {
+		key, _ = o.key(pack.Message)
+	}
+	text := utf8.Valid(event)
+	size := len(event)
+	if text {
+		size = batchedSize(event)
+	}
+	batch, ok := o.batches[key]
+	if ok && (uint(batch.size+size) > o.conf.MaxBatchBytes || !text) {
+
+		if err = o.sendBatch(batch); err != nil {
+			o.or.LogError(err)
+			return NewRetryMessageError("%s", err)
+		}
+		ok = false
+	}
+	if !ok {
+		batch = &eventBatch{key: key}
+		o.batches[key] = batch
+	}
+	// Copy the event, the encoder may reuse its buffer.
+	batch.events = append(batch.events, append([]byte(nil), event...))
+	batch.size += size
+	o.batched++
+	atomic.StoreInt64(&o.batchedEvents, int64(o.batched))
+	o.cursor = pack.QueueCursor
+	o.dirty = true
+
+	if uint(len(batch.events)) >= o.conf.MaxBatchCount || !text {
+		if err = o.sendBatch(batch); err != nil {
+			o.or.LogError(err)
+		}
+	}
+	return nil
+}
+
+func (o *AzureEventHubsRestOutput) TimerEvent() error {
+	if err := o.flush(); err != nil {
+		o.or.LogError(err)
+	}
+	return nil
+}
+
+func (o *AzureEventHubsRestOutput) CleanUp() {
+	if err := o.flush(); err != nil {
+		o.or.LogError(fmt.Errorf("can't send the batched events: %s", err))
+	}
+}
+
+// Satisfies the `pipeline.ReportingPlugin` interface to provide plugin state
+// information to the Heka report and dashboard.
+func (o *AzureEventHubsRestOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "EventsSent",
+		atomic.LoadInt64(&o.eventsSent), "count")
+	message.NewInt64Field(msg, "RequestsSent",
+		atomic.LoadInt64(&o.requestsSent), "count")
+	message.NewInt64Field(msg, "SendFailures",
+		atomic.LoadInt64(&o.sendFailures), "count")
+	message.NewInt64Field(msg, "BatchedEvents",
+		atomic.LoadInt64(&o.batchedEvents), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("AzureEventHubsRestOutput", func() interface{} {
+		return new(AzureEventHubsRestOutput)
+	})
+}
@@ -0,0 +1,222 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package azure
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+// A request received by a test server.
+type received struct {
+	method string
+	path   string
+	query  string
+	header http.Header
+	body   string
+}
+
+func AzureEventHubsRestOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("An AzureEventHubsRestOutput", func() {
+		var requests []received
+		status := http.StatusCreated
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				requests = append(requests, received{r.Method, r.URL.Path,
+					r.URL.RawQuery, r.Header, string(body)})
+				w.WriteHeader(status)
+			}))
+		defer server.Close()
+
+		output := new(AzureEventHubsRestOutput)
+		config := output.ConfigStruct().(*AzureEventHubsRestOutputConfig)
+		config.ConnectionString = "Endpoint=sb://ns.servicebus.windows.net/;" +
+			"SharedAccessKeyName=send;SharedAccessKey=c2VjcmV0=;EntityPath=logs"
+		config.Endpoint = server.URL
+		config.PartitionKey = "Hostname"
+		config.MaxBatchCount = 3
+
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		or.EXPECT().Encoder().Return(new(ProtobufEncoder)).AnyTimes()
+		or.EXPECT().LogError(gomock.Any()).AnyTimes()
+
+		send := func(hostname, event, cursor string) error {
+			pack := NewPipelinePack(pConfig.InputRecycleChan())
+			pack.Message.SetHostname(hostname)
+			pack.QueueCursor = cursor
+			or.EXPECT().Encode(pack).Return([]byte(event), nil)
+			return output.ProcessMessage(pack)
+		}
+
+		c.Specify("batches events by partition key", func() {
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(send("web1", "a", "1"), gs.IsNil)
+			c.Expect(send("web2", "b", "2"), gs.IsNil)
+			c.Expect(send("web1", "c", "3"), gs.IsNil)
+			c.Expect(len(requests), gs.Equals, 0)
+			or.EXPECT().UpdateCursor("3")
+			c.Expect(output.TimerEvent(), gs.IsNil)
+
+			c.Assume(len(requests), gs.Equals, 2)
+			req := requests[0]
+			c.Expect(req.method, gs.Equals, "POST")
+			c.Expect(req.path, gs.Equals, "/logs/messages")
+			c.Expect(req.header.Get("Content-Type"), gs.Equals,
+				"application/vnd.microsoft.servicebus.json")
+			c.Expect(strings.HasPrefix(req.header.Get("Authorization"),
+				"SharedAccessSignature sr="), gs.IsTrue)
+			c.Expect(strings.HasSuffix(req.header.Get("Authorization"), "&skn=send"),
+				gs.IsTrue)
+			var events []struct {
+				Body             string
+				BrokerProperties map[string]string
+			}
+			c.Assume(json.Unmarshal([]byte(req.body), &events), gs.IsNil)
+			c.Assume(len(events), gs.Equals, 2)
+			c.Expect(events[1].Body, gs.Equals, "c")
+			c.Expect(events[1].BrokerProperties["PartitionKey"], gs.Equals, "web1")
+
+			// A batch of one is sent as the body.
+			req = requests[1]
+			c.Expect(req.body, gs.Equals, "b")
+			c.Expect(req.header.Get("BrokerProperties"), gs.Equals,
+				`{"PartitionKey":"web2"}`)
+		})
+
+		c.Specify("sends a batch once max_batch_count events are batched", func() {
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			for i := 0; i < 3; i++ {
+				c.Expect(send("web1", "a", ""), gs.IsNil)
+			}
+			c.Expect(len(requests), gs.Equals, 1)
+			c.Expect(output.eventsSent, gs.Equals, int64(3))
+		})
+
+		c.Specify("sends events that aren't text on their own", func() {
+			config.PartitionKey = ""
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(send("", "a", ""), gs.IsNil)
+			c.Expect(send("", "\x1e\x02\x08\xff", ""), gs.IsNil)
+			c.Assume(len(requests), gs.Equals, 2)
+			c.Expect(requests[0].body, gs.Equals, "a")
+			c.Expect(requests[1].body, gs.Equals, "\x1e\x02\x08\xff")
+			c.Expect(requests[1].header.Get("BrokerProperties"), gs.Equals, "")
+		})
+
+		c.Specify("stops batching while it can't send", func() {
+			status = http.StatusServiceUnavailable
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			for i := 0; i < 3; i++ {
+				c.Expect(send("web1", "a", ""), gs.IsNil)
+			}
+			// Retried without being encoded.
+			pack := NewPipelinePack(pConfig.InputRecycleChan())
+			err := output.ProcessMessage(pack)
+			_, retry := err.(RetryMessageError)
+			c.Expect(retry, gs.IsTrue)
+			c.Expect(output.batched, gs.Equals, 3)
+			c.Expect(output.sendFailures, gs.Equals, int64(2))
+
+			status = http.StatusCreated
+			or.EXPECT().UpdateCursor("")
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(output.eventsSent, gs.Equals, int64(3))
+		})
+
+		c.Specify("authenticates with Azure AD", func() {
+			var tokenForms []string
+			aadServer := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					c.Expect(r.URL.Path, gs.Equals, "/tenant/oauth2/v2.0/token")
+					r.ParseForm()
+					tokenForms = append(tokenForms, r.PostForm.Encode())
+					w.Write([]byte(`{"access_token":"tok","expires_in":3600}`))
+				}))
+			defer aadServer.Close()
+			config.ConnectionString = ""
+			config.EventHub = "logs"
+			config.AAD = &AADConfig{TenantId: "tenant", ClientId: "id",
+				ClientSecret: "secret", AuthorityHost: aadServer.URL}
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			or.EXPECT().UpdateCursor("1")
+			c.Expect(send("web1", "a", "1"), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+
+			c.Assume(len(tokenForms), gs.Equals, 1)
+			c.Expect(strings.Contains(tokenForms[0],
+				"scope=https%3A%2F%2Feventhubs.azure.net%2F.default"), gs.IsTrue)
+			c.Assume(len(requests), gs.Equals, 1)
+			c.Expect(requests[0].header.Get("Authorization"), gs.Equals, "Bearer tok")
+
+			c.Specify("fetching a new token when it's rejected", func() {
+				status = http.StatusUnauthorized
+				c.Expect(send("web1", "a", "2"), gs.IsNil)
+				c.Expect(output.TimerEvent(), gs.IsNil)
+				c.Expect(len(tokenForms), gs.Equals, 2)
+				c.Expect(len(requests), gs.Equals, 3)
+				c.Expect(output.sendFailures, gs.Equals, int64(1))
+			})
+		})
+
+		c.Specify("rejects", func() {
+			c.Specify("a config without an event hub", func() {
+				config.ConnectionString = ""
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("a config without credentials", func() {
+				config.ConnectionString = ""
+				config.EventHub = "logs"
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("an unknown partition key", func() {
+				config.PartitionKey = "Fields[status"
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+		})
+	})
+
+	c.Specify("A Service Bus shared access signature", func() {
+		sas := serviceBusSAS("https://ns.servicebus.windows.net/logs", "send",
+			"c2VjcmV0=", time.Unix(1433160000, 0))
+		c.Expect(sas, gs.Equals, "SharedAccessSignature "+
+			"sr=https%3A%2F%2Fns.servicebus.windows.net%2Flogs&"+
+			"sig=A%2FEmapMes9CKL%2FwDLFHFU00IGbxLypA89U%2BbcYphB%2Fc%3D&"+
+			"se=1433160000&skn=send")
+	})
+}
@@ -0,0 +1,64 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	. "heka/pipeline"
+)
+
+type Base64DecoderConfig struct {
+	// Expect the URL and filename safe alphabet.
+	UrlSafe bool `toml:"url_safe"`
+}
+
+// Replaces a message's base64 encoded payload with the bytes it encodes.
+type Base64Decoder struct {
+	encoding *base64.Encoding
+}
+
+func (bd *Base64Decoder) ConfigStruct() interface{} {
+	return new(Base64DecoderConfig)
+}
+
+func (bd *Base64Decoder) Init(config interface{}) (err error) {
+	conf := config.(*Base64DecoderConfig)
+	bd.encoding = base64.StdEncoding
+	if conf.UrlSafe {
+		bd.encoding = base64.URLEncoding
+	}
+	// Padding is stripped before decoding, it's often missing in transit.
+	bd.encoding = bd.encoding.WithPadding(base64.NoPadding)
+	return
+}
+
+func (bd *Base64Decoder) Decode(pack *PipelinePack) (packs []*PipelinePack, err error) {
+	var output []byte
+	payload := strings.TrimRight(strings.TrimSpace(pack.Message.GetPayload()), "=")
+	if output, err = bd.encoding.DecodeString(payload); err != nil {
+		return nil, fmt.Errorf("can't decode base64 payload: %s", err)
+	}
+	pack.Message.SetPayload(string(output))
+	return []*PipelinePack{pack}, nil
+}
+
+func init() {
+	RegisterPlugin("Base64Decoder", func() interface{} {
+		return new(Base64Decoder)
+	})
+}
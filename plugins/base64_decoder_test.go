@@ -0,0 +1,58 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"heka/pipeline"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func Base64DecoderSpec(c gs.Context) {
+
+	c.Specify("A Base64Decoder", func() {
+		decoder := new(Base64Decoder)
+		config := decoder.ConfigStruct().(*Base64DecoderConfig)
+		pack := pipeline.NewPipelinePack(make(chan *pipeline.PipelinePack, 1))
+		binary := string([]byte{0xfb, 0xff, 'h', 'i'})
+
+		c.Specify("decodes padded and unpadded payloads", func() {
+			c.Assume(decoder.Init(config), gs.IsNil)
+			for _, payload := range []string{"+/9oaQ==", "+/9oaQ", " +/9oaQ==\n"} {
+				pack.Message.SetPayload(payload)
+				packs, err := decoder.Decode(pack)
+				c.Expect(err, gs.IsNil)
+				c.Expect(len(packs), gs.Equals, 1)
+				c.Expect(pack.Message.GetPayload(), gs.Equals, binary)
+			}
+		})
+
+		c.Specify("honors url_safe", func() {
+			config.UrlSafe = true
+			c.Assume(decoder.Init(config), gs.IsNil)
+			pack.Message.SetPayload("-_9oaQ==")
+			_, err := decoder.Decode(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, binary)
+		})
+
+		c.Specify("fails on invalid payloads", func() {
+			c.Assume(decoder.Init(config), gs.IsNil)
+			pack.Message.SetPayload("not base64!")
+			_, err := decoder.Decode(pack)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,72 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"encoding/base64"
+	"heka/pipeline"
+)
+
+// Base64 encodes the bytes produced by the previous encoder in an output's
+// encoder_chain, or the protobuf encoded message when used on its own.
+type Base64Encoder struct {
+	config   *Base64EncoderConfig
+	encoding *base64.Encoding
+}
+
+type Base64EncoderConfig struct {
+	// Use the URL and filename safe alphabet.
+	UrlSafe        bool `toml:"url_safe"`
+	AppendNewlines bool `toml:"append_newlines"`
+}
+
+func (be *Base64Encoder) ConfigStruct() interface{} {
+	return new(Base64EncoderConfig)
+}
+
+func (be *Base64Encoder) Init(config interface{}) (err error) {
+	be.config = config.(*Base64EncoderConfig)
+	be.encoding = base64.StdEncoding
+	if be.config.UrlSafe {
+		be.encoding = base64.URLEncoding
+	}
+	return
+}
+
+func (be *Base64Encoder) ContentType() string {
+	return "text/plain"
+}
+
+func (be *Base64Encoder) Encode(pack *pipeline.PipelinePack) (output []byte, err error) {
+	return be.EncodeBytes(pack.MsgBytes)
+}
+
+func (be *Base64Encoder) EncodeBytes(input []byte) (output []byte, err error) {
+	l := be.encoding.EncodedLen(len(input))
+	if be.config.AppendNewlines {
+		output = make([]byte, l+1)
+		output[l] = '\n'
+	} else {
+		output = make([]byte, l)
+	}
+	be.encoding.Encode(output, input)
+	return
+}
+
+func init() {
+	pipeline.RegisterPlugin("Base64Encoder", func() interface{} {
+		return new(Base64Encoder)
+	})
+}
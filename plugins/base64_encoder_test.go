@@ -0,0 +1,55 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"heka/pipeline"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func Base64EncoderSpec(c gs.Context) {
+
+	c.Specify("A Base64Encoder", func() {
+		encoder := new(Base64Encoder)
+		config := encoder.ConfigStruct().(*Base64EncoderConfig)
+		input := []byte{0xfb, 0xff, 'h', 'i'}
+
+		c.Specify("works with default config options", func() {
+			c.Assume(encoder.Init(config), gs.IsNil)
+			output, err := encoder.EncodeBytes(input)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(output), gs.Equals, "+/9oaQ==")
+		})
+
+		c.Specify("honors url_safe and append_newlines", func() {
+			config.UrlSafe = true
+			config.AppendNewlines = true
+			c.Assume(encoder.Init(config), gs.IsNil)
+			output, err := encoder.EncodeBytes(input)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(output), gs.Equals, "-_9oaQ==\n")
+		})
+
+		c.Specify("encodes the message bytes on its own", func() {
+			c.Assume(encoder.Init(config), gs.IsNil)
+			pack := pipeline.NewPipelinePack(make(chan *pipeline.PipelinePack, 1))
+			pack.MsgBytes = input
+			output, err := encoder.Encode(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(output), gs.Equals, "+/9oaQ==")
+		})
+	})
+}
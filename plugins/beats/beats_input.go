@@ -0,0 +1,368 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package beats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pborman/uuid"
+	"heka/message"
+	. "heka/pipeline"
+	"heka/plugins/tcp"
+)
+
+type BeatsInputConfig struct {
+	// Address listened on, e.g. ":5044".
+	Address string `toml:"address"`
+	UseTls  bool   `toml:"use_tls"`
+	Tls     tcp.TlsConfig
+	// Event key whose value becomes the payload. Defaults to "message".
+	PayloadKey string `toml:"payload_key"`
+	// Largest frame, or uncompressed compressed frame, accepted in bytes.
+	// Defaults to 16MiB.
+	MaxFrameSize uint `toml:"max_frame_size"`
+	// Seconds a client may send nothing before it's disconnected. Defaults
+	// to 60.
+	ClientInactivityTimeout uint `toml:"client_inactivity_timeout"`
+	// Seconds between the ACKs telling a client its window's still being
+	// delivered. Defaults to 5.
+	KeepaliveInterval uint `toml:"keepalive_interval"`
+	// Subsection of listening socket settings, such as the address family
+	// and buffer sizes.
+	Socket SocketConfig `toml:"socket"`
+}
+
+// Input plugin that receives events from Beats agents such as filebeat and
+// winlogbeat, speaking versions 1 and 2 of the lumberjack protocol that
+// logstash's beats input does. Each window of events is acknowledged once
+// all of its events have been delivered, with compressed frames inflated.
+type BeatsInput struct {
+	conf     *BeatsInputConfig
+	ir       InputRunner
+	listener net.Listener
+	stopChan chan bool
+	wg       sync.WaitGroup
+	lock     sync.Mutex
+	conns    map[net.Conn]bool
+
+	// Accessed atomically, for the reports.
+	processMessageCount    int64
+	processMessageFailures int64
+}
+
+func (i *BeatsInput) ConfigStruct() interface{} {
+	return &BeatsInputConfig{
+		Address:                 ":5044",
+		Tls:                     tcp.TlsConfig{PreferServerCiphers: true},
+		PayloadKey:              "message",
+		MaxFrameSize:            16 * 1024 * 1024,
+		ClientInactivityTimeout: 60,
+		KeepaliveInterval:       5,
+	}
+}
+
+func (i *BeatsInput) Init(config interface{}) (err error) {
+	i.conf = config.(*BeatsInputConfig)
+	if i.conf.MaxFrameSize == 0 {
+		return errors.New("max_frame_size must be greater than 0")
+	}
+	if i.conf.KeepaliveInterval == 0 {
+		return errors.New("keepalive_interval must be greater than 0")
+	}
+	network, err := i.conf.Socket.Network("tcp")
+	if err != nil {
+		return err
+	}
+	if i.listener, err = i.conf.Socket.Listen(network, i.conf.Address, false); err != nil {
+		return fmt.Errorf("can't listen on %s: %s", i.conf.Address, err)
+	}
+	if i.conf.UseTls {
+		listener, err := tcp.NewTlsListener(i.listener, &i.conf.Tls)
+		if err != nil {
+			i.listener.Close()
+			return err
+		}
+		i.listener = listener
+	}
+	i.stopChan = make(chan bool)
+	i.conns = make(map[net.Conn]bool)
+	return nil
+}
+
+func (i *BeatsInput) Run(ir InputRunner, h PluginHelper) error {
+	i.ir = ir
+	for {
+		conn, err := i.listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				ir.LogError(fmt.Errorf("accept failed: %s", err))
+				continue
+			}
+			break
+		}
+		i.lock.Lock()
+		select {
+		case <-i.stopChan:
+			conn.Close()
+		default:
+			i.conns[conn] = true
+			i.wg.Add(1)
+			go i.handleConnection(conn)
+		}
+		i.lock.Unlock()
+	}
+	i.wg.Wait()
+	return nil
+}
+
+// A client's connection, with the state of the window being delivered that
+// the keepalive ACKs need.
+type beatsConn struct {
+	conn    net.Conn
+	lock    sync.Mutex
+	version byte
+	// Sequence number of the window's last delivered event.
+	seq uint32
+	// Whether some of the window's events have yet to be acknowledged.
+	pending bool
+}
+
+func (c *beatsConn) ack(seq uint32, done bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.seq = seq
+	c.pending = !done
+	if !done {
+		return nil
+	}
+	_, err := c.conn.Write(ackFrame(c.version, seq))
+	return err
+}
+
+func (c *beatsConn) startWindow(version byte) {
+	c.lock.Lock()
+	c.version = version
+	c.seq = 0
+	c.pending = true
+	c.lock.Unlock()
+}
+
+// Sends an ACK of the events delivered so far, so the client doesn't time
+// out waiting for a window that takes long to deliver.
+func (c *beatsConn) keepalive() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.pending {
+		c.conn.Write(ackFrame(c.version, c.seq))
+	}
+}
+
+// Reads a connection's frames, delivering their events, until it's closed
+// or sends something that isn't a lumberjack frame.
+func (i *BeatsInput) handleConnection(conn net.Conn) {
+	bc := &beatsConn{conn: conn}
+	done := make(chan bool)
+	defer func() {
+		close(done)
+		conn.Close()
+		i.lock.Lock()
+		delete(i.conns, conn)
+		i.lock.Unlock()
+		i.wg.Done()
+	}()
+	go func() {
+		ticker := time.NewTicker(time.Duration(i.conf.KeepaliveInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				bc.keepalive()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	raddr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(raddr)
+	if err != nil {
+		host = raddr
+	}
+	r := newLumberjackReader(conn, int(i.conf.MaxFrameSize))
+	timeout := time.Duration(i.conf.ClientInactivityTimeout) * time.Second
+	var window, received uint32
+	for {
+		if timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+		f, err := r.next()
+		if err != nil {
+			if err != io.EOF && !i.stopped() {
+				atomic.AddInt64(&i.processMessageFailures, 1)
+				i.ir.LogError(fmt.Errorf("connection from %s failed: %s", raddr, err))
+			}
+			return
+		}
+		if f.kind == frameWindow {
+			window, received = f.window, 0
+			bc.startWindow(f.version)
+			continue
+		}
+		if window == 0 {
+			// Without a window each event is acknowledged on its own.
+			bc.startWindow(f.version)
+		}
+		var pack *PipelinePack
+		select {
+		case pack = <-i.ir.InChan():
+		case <-i.stopChan:
+			return
+		}
+		i.populate(pack, f.event, host)
+		i.ir.Deliver(pack)
+		atomic.AddInt64(&i.processMessageCount, 1)
+		received++
+		if err = bc.ack(f.seq, received >= window); err != nil {
+			return
+		}
+	}
+}
+
+func (i *BeatsInput) stopped() bool {
+	select {
+	case <-i.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns the string at a dotted path of the event, e.g. "host.name".
+func eventString(event map[string]interface{}, keys ...string) (string, bool) {
+	var v interface{} = event
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		v = m[key]
+	}
+	s, ok := v.(string)
+	return s, ok && s != ""
+}
+
+// Fills in the message of an event, its keys becoming fields but for the
+// payload and timestamp, with objects and arrays as nested fields.
+func (i *BeatsInput) populate(pack *PipelinePack, event map[string]interface{},
+	host string) {
+
+	msg := pack.Message
+	msg.SetUuid(uuid.NewRandom())
+	msg.SetType("heka.beats")
+	msg.SetLogger(i.ir.Name())
+	timestamp := time.Now()
+	if s, ok := eventString(event, "@timestamp"); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			timestamp = t
+		}
+	}
+	msg.SetTimestamp(timestamp.UnixNano())
+	// Beats 7 name the agent's host "host.name", earlier ones "beat.hostname".
+	for _, path := range [][]string{{"host", "name"}, {"agent", "hostname"},
+		{"beat", "hostname"}} {
+
+		if s, ok := eventString(event, path...); ok {
+			host = s
+			break
+		}
+	}
+	msg.SetHostname(host)
+	payloadKey := ""
+	if payload, ok := event[i.conf.PayloadKey].(string); ok {
+		msg.SetPayload(payload)
+		payloadKey = i.conf.PayloadKey
+	}
+
+	names := make([]string, 0, len(event))
+	for name := range event {
+		if name != payloadKey && name != "@timestamp" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var err error
+		switch t := event[name].(type) {
+		case nil:
+			continue
+		case string:
+			message.NewStringField(msg, name, t)
+		case bool, json.Number:
+			var value interface{} = t
+			if n, ok := t.(json.Number); ok {
+				if value, err = n.Int64(); err != nil {
+					value, err = n.Float64()
+				}
+			}
+			var field *message.Field
+			if err == nil {
+				if field, err = message.NewField(name, value, ""); err == nil {
+					msg.AddField(field)
+				}
+			}
+		default:
+			err = message.NewNestedFieldOnMessage(msg, name, t)
+		}
+		if err != nil {
+			i.ir.LogError(fmt.Errorf("can't add '%s' field: %s", name, err))
+		}
+	}
+}
+
+func (i *BeatsInput) Stop() {
+	i.lock.Lock()
+	close(i.stopChan)
+	i.listener.Close()
+	for conn := range i.conns {
+		conn.Close()
+	}
+	i.lock.Unlock()
+}
+
+func (i *BeatsInput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "ProcessMessageCount",
+		atomic.LoadInt64(&i.processMessageCount), "count")
+	message.NewInt64Field(msg, "ProcessMessageFailures",
+		atomic.LoadInt64(&i.processMessageFailures), "count")
+	i.lock.Lock()
+	conns := len(i.conns)
+	i.lock.Unlock()
+	message.NewInt64Field(msg, "Connections", int64(conns), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("BeatsInput", func() interface{} {
+		return new(BeatsInput)
+	})
+}
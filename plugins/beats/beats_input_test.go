@@ -0,0 +1,167 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package beats
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func BeatsInputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A BeatsInput", func() {
+		input := new(BeatsInput)
+		config := input.ConfigStruct().(*BeatsInputConfig)
+		config.Address = "127.0.0.1:0"
+
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		ir := pipelinemock.NewMockInputRunner(ctrl)
+		recycleChan := make(chan *PipelinePack, 10)
+		delivered := make(chan *PipelinePack, 10)
+
+		run := func(packs int) (net.Conn, chan error) {
+			for i := 0; i < packs; i++ {
+				recycleChan <- NewPipelinePack(recycleChan)
+			}
+			ir.EXPECT().Name().Return("Beats").AnyTimes()
+			ir.EXPECT().InChan().Return(recycleChan).AnyTimes()
+			ir.EXPECT().Deliver(gomock.Any()).Do(func(pack *PipelinePack) {
+				delivered <- pack
+			}).AnyTimes()
+			c.Assume(input.Init(config), gs.IsNil)
+			done := make(chan error, 1)
+			go func() {
+				done <- input.Run(ir, h)
+			}()
+			conn, err := net.Dial("tcp", input.listener.Addr().String())
+			c.Assume(err, gs.IsNil)
+			return conn, done
+		}
+
+		readAck := func(conn net.Conn) string {
+			conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+			ack := make([]byte, 6)
+			if _, err := io.ReadFull(conn, ack); err != nil {
+				return err.Error()
+			}
+			return fmt.Sprintf("%q", ack)
+		}
+
+		c.Specify("delivers events and acknowledges their window", func() {
+			conn, done := run(10)
+			defer conn.Close()
+			conn.Write(windowFrame('2', 2))
+			conn.Write(jsonFrame(1, map[string]interface{}{
+				"@timestamp": "2017-07-14T02:40:00.123Z",
+				"message":    "GET /",
+				"offset":     1234,
+				"ratio":      0.5,
+				"source":     "/var/log/nginx/access.log",
+				"host":       map[string]interface{}{"name": "web1"},
+				"tags":       []string{"nginx"},
+				"ok":         true,
+			}))
+			conn.Write(compressedFrame('2', jsonFrame(2, map[string]interface{}{
+				"message": "GET /favicon.ico",
+				"beat":    map[string]interface{}{"hostname": "web2"},
+			})))
+
+			pack := <-delivered
+			msg := pack.Message
+			c.Expect(msg.GetPayload(), gs.Equals, "GET /")
+			c.Expect(msg.GetType(), gs.Equals, "heka.beats")
+			c.Expect(msg.GetLogger(), gs.Equals, "Beats")
+			c.Expect(msg.GetHostname(), gs.Equals, "web1")
+			c.Expect(msg.GetTimestamp(), gs.Equals,
+				time.Date(2017, 7, 14, 2, 40, 0, 123e6, time.UTC).UnixNano())
+			value, _ := msg.GetFieldValue("offset")
+			c.Expect(value, gs.Equals, int64(1234))
+			value, _ = msg.GetFieldValue("ratio")
+			c.Expect(value, gs.Equals, 0.5)
+			value, _ = msg.GetFieldValue("ok")
+			c.Expect(value, gs.Equals, true)
+			value, _ = msg.GetFieldValue("source")
+			c.Expect(value, gs.Equals, "/var/log/nginx/access.log")
+			value, _ = msg.GetFieldPath("tags.0")
+			c.Expect(value, gs.Equals, "nginx")
+			c.Expect(msg.FindFirstField("message") == nil, gs.IsTrue)
+			c.Expect(msg.FindFirstField("@timestamp") == nil, gs.IsTrue)
+
+			pack = <-delivered
+			c.Expect(pack.Message.GetHostname(), gs.Equals, "web2")
+			c.Expect(readAck(conn), gs.Equals, `"2A\x00\x00\x00\x02"`)
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+			c.Expect(input.processMessageCount, gs.Equals, int64(2))
+		})
+
+		c.Specify("sends keepalives while a window's delivered", func() {
+			config.KeepaliveInterval = 1
+			conn, done := run(1)
+			defer conn.Close()
+			conn.Write(windowFrame('2', 2))
+			conn.Write(jsonFrame(1, map[string]interface{}{"message": "one"}))
+			conn.Write(jsonFrame(2, map[string]interface{}{"message": "two"}))
+			<-delivered
+			c.Expect(readAck(conn), gs.Equals, `"2A\x00\x00\x00\x01"`)
+			recycleChan <- NewPipelinePack(recycleChan)
+			<-delivered
+			c.Expect(readAck(conn), gs.Equals, `"2A\x00\x00\x00\x02"`)
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+		})
+
+		c.Specify("delivers version 1 events", func() {
+			conn, done := run(10)
+			defer conn.Close()
+			conn.Write(dataFrame(7, "line", "hello", "host", "web1"))
+			pack := <-delivered
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "")
+			value, _ := pack.Message.GetFieldValue("line")
+			c.Expect(value, gs.Equals, "hello")
+			c.Expect(pack.Message.GetHostname(), gs.Equals, "127.0.0.1")
+			c.Expect(readAck(conn), gs.Equals, `"1A\x00\x00\x00\a"`)
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+		})
+
+		c.Specify("drops clients that send garbage", func() {
+			ir.EXPECT().LogError(gomock.Any())
+			conn, done := run(10)
+			defer conn.Close()
+			conn.Write([]byte("GET / HTTP/1.1\r\n"))
+			c.Expect(readAck(conn), gs.Equals, "EOF")
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+			c.Expect(input.processMessageFailures, gs.Equals, int64(1))
+		})
+
+		c.Specify("checks its settings", func() {
+			config.MaxFrameSize = 0
+			c.Expect(input.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,215 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package beats
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Frame types of the lumberjack protocol.
+const (
+	frameWindow     = 'W'
+	frameJson       = 'J'
+	frameData       = 'D'
+	frameCompressed = 'C'
+	frameAck        = 'A'
+)
+
+var errFrameTooBig = errors.New("frame is too big")
+
+// A window size or event frame.
+type lumberjackFrame struct {
+	version byte
+	kind    byte
+	// The window size of a window frame.
+	window uint32
+	// The sequence number and event of a JSON or data frame.
+	seq   uint32
+	event map[string]interface{}
+}
+
+// Reads the frames of lumberjack protocol versions 1 and 2, reading the
+// frames within compressed frames as if they'd been sent on their own.
+type lumberjackReader struct {
+	r   *bufio.Reader
+	max int
+	// The frames of the compressed frame being read, if any.
+	inner *bufio.Reader
+}
+
+func newLumberjackReader(r io.Reader, max int) *lumberjackReader {
+	return &lumberjackReader{r: bufio.NewReader(r), max: max}
+}
+
+// Returns the next window size or event frame. io.EOF means the connection
+// was closed between frames.
+func (l *lumberjackReader) next() (*lumberjackFrame, error) {
+	for {
+		r := l.r
+		if l.inner != nil {
+			r = l.inner
+		}
+		f, err := l.readFrame(r)
+		if err == io.EOF && l.inner != nil {
+			l.inner = nil
+			continue
+		}
+		if err != nil || f != nil {
+			return f, err
+		}
+	}
+}
+
+// Reads a frame, returning a nil frame if it was a compressed frame whose
+// frames l.inner now reads.
+func (l *lumberjackReader) readFrame(r *bufio.Reader) (*lumberjackFrame, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header[:1]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, header[1:]); err != nil {
+		return nil, unexpected(err)
+	}
+	f := &lumberjackFrame{version: header[0], kind: header[1]}
+	if f.version != '1' && f.version != '2' {
+		return nil, fmt.Errorf("unsupported protocol version %q", f.version)
+	}
+	switch f.kind {
+	case frameWindow:
+		var err error
+		f.window, err = readUint32(r)
+		return f, err
+	case frameJson:
+		if f.version != '2' {
+			break
+		}
+		var err error
+		if f.seq, err = readUint32(r); err != nil {
+			return nil, err
+		}
+		data, err := l.readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err = decoder.Decode(&f.event); err != nil {
+			return nil, fmt.Errorf("bad event %d: %s", f.seq, err)
+		}
+		if f.event == nil {
+			return nil, fmt.Errorf("bad event %d: not an object", f.seq)
+		}
+		return f, nil
+	case frameData:
+		return f, l.readData(r, f)
+	case frameCompressed:
+		if r == l.inner {
+			return nil, errors.New("compressed frame within a compressed frame")
+		}
+		data, err := l.readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("bad compressed frame: %s", err)
+		}
+		inflated, err := ioutil.ReadAll(io.LimitReader(zr, int64(l.max)+1))
+		if err != nil {
+			return nil, fmt.Errorf("bad compressed frame: %s", err)
+		}
+		if len(inflated) > l.max {
+			return nil, errFrameTooBig
+		}
+		l.inner = bufio.NewReader(bytes.NewReader(inflated))
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported frame type %q", f.kind)
+}
+
+// Reads a version 1 data frame's key/value pairs.
+func (l *lumberjackReader) readData(r *bufio.Reader, f *lumberjackFrame) (err error) {
+	if f.seq, err = readUint32(r); err != nil {
+		return err
+	}
+	pairs, err := readUint32(r)
+	if err != nil {
+		return err
+	}
+	// Each pair takes at least 8 bytes.
+	if int64(pairs)*8 > int64(l.max) {
+		return errFrameTooBig
+	}
+	f.event = make(map[string]interface{}, pairs)
+	for i := uint32(0); i < pairs; i++ {
+		key, err := l.readBytes(r)
+		if err != nil {
+			return err
+		}
+		value, err := l.readBytes(r)
+		if err != nil {
+			return err
+		}
+		f.event[string(key)] = string(value)
+	}
+	return nil
+}
+
+// Reads a length prefixed byte string.
+func (l *lumberjackReader) readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if int64(n) > int64(l.max) {
+		return nil, errFrameTooBig
+	}
+	b := make([]byte, n)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return nil, unexpected(err)
+	}
+	return b, nil
+}
+
+func readUint32(r io.Reader) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, unexpected(err)
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+// A frame ending early is an unexpected end, even at a field's boundary.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Returns the ACK frame acknowledging the events up to seq.
+func ackFrame(version byte, seq uint32) []byte {
+	b := []byte{version, frameAck, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[2:], seq)
+	return b
+}
@@ -0,0 +1,138 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package beats
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func appendUint32(b []byte, n uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], n)
+	return append(b, buf[:]...)
+}
+
+func windowFrame(version byte, n uint32) []byte {
+	return appendUint32([]byte{version, frameWindow}, n)
+}
+
+func jsonFrame(seq uint32, event interface{}) []byte {
+	data, _ := json.Marshal(event)
+	b := appendUint32([]byte{'2', frameJson}, seq)
+	b = appendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+func dataFrame(seq uint32, pairs ...string) []byte {
+	b := appendUint32([]byte{'1', frameData}, seq)
+	b = appendUint32(b, uint32(len(pairs)/2))
+	for _, s := range pairs {
+		b = appendUint32(b, uint32(len(s)))
+		b = append(b, s...)
+	}
+	return b
+}
+
+func compressedFrame(version byte, frames ...[]byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	for _, f := range frames {
+		zw.Write(f)
+	}
+	zw.Close()
+	b := appendUint32([]byte{version, frameCompressed}, uint32(buf.Len()))
+	return append(b, buf.Bytes()...)
+}
+
+func readFrames(data []byte, max int) ([]*lumberjackFrame, error) {
+	r := newLumberjackReader(bytes.NewReader(data), max)
+	var frames []*lumberjackFrame
+	for {
+		f, err := r.next()
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, f)
+	}
+}
+
+func LumberjackSpec(c gs.Context) {
+	c.Specify("The lumberjack protocol", func() {
+		c.Specify("reads version 2 frames", func() {
+			var data []byte
+			data = append(data, windowFrame('2', 3)...)
+			data = append(data, jsonFrame(1, map[string]interface{}{"message": "one",
+				"offset": 10})...)
+			data = append(data, compressedFrame('2',
+				jsonFrame(2, map[string]interface{}{"message": "two"}),
+				jsonFrame(3, map[string]interface{}{"message": "three"}))...)
+			frames, err := readFrames(data, 1024)
+			c.Expect(err.Error(), gs.Equals, "EOF")
+			c.Expect(len(frames), gs.Equals, 4)
+			c.Expect(frames[0].kind, gs.Equals, byte(frameWindow))
+			c.Expect(frames[0].window, gs.Equals, uint32(3))
+			c.Expect(frames[1].seq, gs.Equals, uint32(1))
+			c.Expect(frames[1].event["message"], gs.Equals, "one")
+			c.Expect(frames[1].event["offset"], gs.Equals, json.Number("10"))
+			c.Expect(frames[3].seq, gs.Equals, uint32(3))
+			c.Expect(frames[3].event["message"], gs.Equals, "three")
+		})
+
+		c.Specify("reads version 1 frames", func() {
+			var data []byte
+			data = append(data, windowFrame('1', 1)...)
+			data = append(data, compressedFrame('1',
+				dataFrame(1, "line", "hello", "host", "web1"))...)
+			frames, err := readFrames(data, 1024)
+			c.Expect(err.Error(), gs.Equals, "EOF")
+			c.Expect(len(frames), gs.Equals, 2)
+			c.Expect(frames[1].version, gs.Equals, byte('1'))
+			c.Expect(frames[1].event["line"], gs.Equals, "hello")
+			c.Expect(frames[1].event["host"], gs.Equals, "web1")
+		})
+
+		c.Specify("refuses bad frames", func() {
+			for data, expected := range map[string]string{
+				"3W\x00\x00\x00\x01":                     `unsupported protocol version '3'`,
+				"2X":                                     `unsupported frame type 'X'`,
+				"1J\x00\x00\x00\x01":                     `unsupported frame type 'J'`,
+				"2W\x00\x00":                             "unexpected EOF",
+				"2":                                      "unexpected EOF",
+				"2J\x00\x00\x00\x01\x00\x00\x00\x04null": "bad event 1: not an object",
+				"2J\x00\x00\x00\x01\xff\xff\xff\xff":     "frame is too big",
+				"1D\x00\x00\x00\x01\xff\xff\xff\xff":     "frame is too big",
+				"2C\x00\x00\x00\x02xx":                   "bad compressed frame: zlib: invalid header",
+			} {
+				_, err := readFrames([]byte(data), 1024)
+				c.Expect(err.Error(), gs.Equals, expected)
+			}
+			_, err := readFrames(compressedFrame('2', compressedFrame('2')), 1024)
+			c.Expect(err.Error(), gs.Equals, "compressed frame within a compressed frame")
+			_, err = readFrames(compressedFrame('2', make([]byte, 2000)), 1024)
+			c.Expect(err, gs.Equals, errFrameTooBig)
+		})
+
+		c.Specify("makes ACK frames", func() {
+			c.Expect(fmt.Sprintf("%q", ackFrame('2', 258)), gs.Equals,
+				`"2A\x00\x00\x01\x02"`)
+		})
+	})
+}
@@ -0,0 +1,366 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package benchmark
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"heka/message"
+	. "heka/pipeline"
+)
+
+// Number of latency samples kept for computing percentiles.
+const latencySamples = 10000
+
+// Shortest wait for a message's scheduled send time that's worth sleeping for.
+const minWait = time.Millisecond
+
+// Input plugin that synthesizes messages at a configurable rate, for
+// measuring how much traffic a Heka config can handle.
+type BenchmarkInput struct {
+	conf     *BenchmarkInputConfig
+	pConfig  *PipelineConfig
+	duration time.Duration
+	corpus   []string
+	payload  string
+	rand     *rand.Rand
+	stopChan chan struct{}
+	now      func() time.Time
+
+	// Protects the run statistics, which are read by ReportMsg.
+	lock      sync.Mutex
+	started   time.Time
+	finished  time.Time
+	sent      int64
+	sentBytes int64
+	latencies *latencyStats
+}
+
+type BenchmarkInputConfig struct {
+	// Messages per second to generate, 0 to generate them as quickly as the
+	// pipeline accepts them.
+	Rate uint `toml:"rate"`
+	// Stop after generating this many messages, 0 for no limit.
+	MessageCount int64 `toml:"message_count"`
+	// Stop after running for this long, e.g. "5m". Empty for no limit.
+	Duration string `toml:"duration"`
+	// Type of the generated messages.
+	MessageType string `toml:"message_type"`
+	// Size of each generated payload in bytes. Ignored if a payload corpus is
+	// specified.
+	PayloadSize uint `toml:"payload_size"`
+	// File whose lines are used as message payloads, in order, starting over
+	// at the beginning when the end is reached. Relative paths are relative
+	// to the share_dir.
+	PayloadCorpus string `toml:"payload_corpus"`
+	// Number of string fields added to each message.
+	FieldCount uint `toml:"field_count"`
+	// Number of distinct values each field takes.
+	FieldCardinality uint `toml:"field_cardinality"`
+	// Seed for the random field values, 0 to use a different seed each run.
+	Seed int64 `toml:"seed"`
+	// Shut Heka down once the message count or duration has been reached.
+	ShutdownWhenDone bool `toml:"shutdown_when_done"`
+}
+
+func (b *BenchmarkInput) ConfigStruct() interface{} {
+	return &BenchmarkInputConfig{
+		MessageType:      "heka.benchmark",
+		PayloadSize:      100,
+		FieldCardinality: 100,
+	}
+}
+
+func (b *BenchmarkInput) SetPipelineConfig(pConfig *PipelineConfig) {
+	b.pConfig = pConfig
+}
+
+func (b *BenchmarkInput) Init(config interface{}) (err error) {
+	b.conf = config.(*BenchmarkInputConfig)
+	if b.conf.Duration != "" {
+		if b.duration, err = time.ParseDuration(b.conf.Duration); err != nil {
+			return fmt.Errorf("can't parse duration '%s': %s", b.conf.Duration, err)
+		}
+	}
+	if b.conf.ShutdownWhenDone && b.conf.MessageCount == 0 && b.duration == 0 {
+		return errors.New("shutdown_when_done requires a message_count or duration")
+	}
+	if b.conf.FieldCount > 0 && b.conf.FieldCardinality == 0 {
+		return errors.New("field_cardinality must be greater than 0")
+	}
+
+	if b.conf.PayloadCorpus != "" {
+		path := b.pConfig.Globals.PrependShareDir(b.conf.PayloadCorpus)
+		if b.corpus, err = loadCorpus(path); err != nil {
+			return err
+		}
+	} else {
+		b.payload = makePayload(int(b.conf.PayloadSize))
+	}
+
+	seed := b.conf.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	b.rand = rand.New(rand.NewSource(seed))
+	b.stopChan = make(chan struct{})
+	b.now = time.Now
+	b.latencies = newLatencyStats(b.rand)
+	return nil
+}
+
+// Reads the non-empty lines of the corpus file.
+func loadCorpus(path string) (corpus []string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't open payload corpus: %s", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), int(message.MAX_RECORD_SIZE))
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			corpus = append(corpus, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading payload corpus: %s", err)
+	}
+	if len(corpus) == 0 {
+		return nil, fmt.Errorf("payload corpus '%s' is empty", path)
+	}
+	return corpus, nil
+}
+
+// Generates a printable payload of the given size.
+func makePayload(size int) string {
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 "
+	payload := make([]byte, size)
+	for i := range payload {
+		payload[i] = chars[i%len(chars)]
+	}
+	return string(payload)
+}
+
+// Populates the message for the nth generated message.
+func (b *BenchmarkInput) fill(msg *message.Message, logger string, n int64) {
+	msg.SetUuid(uuid.NewRandom())
+	msg.SetTimestamp(b.now().UnixNano())
+	msg.SetType(b.conf.MessageType)
+	msg.SetLogger(logger)
+	msg.SetHostname(b.pConfig.Hostname())
+	msg.SetPid(int32(os.Getpid()))
+	if b.corpus != nil {
+		msg.SetPayload(b.corpus[n%int64(len(b.corpus))])
+	} else {
+		msg.SetPayload(b.payload)
+	}
+	for i := uint(0); i < b.conf.FieldCount; i++ {
+		value := fmt.Sprintf("value%d", b.rand.Intn(int(b.conf.FieldCardinality)))
+		message.NewStringField(msg, fmt.Sprintf("field%d", i), value)
+	}
+}
+
+func (b *BenchmarkInput) Run(ir InputRunner, h PluginHelper) error {
+	var interval time.Duration
+	if b.conf.Rate > 0 {
+		interval = time.Second / time.Duration(b.conf.Rate)
+	}
+	packSupply := ir.InChan()
+	logger := ir.Name()
+
+	b.lock.Lock()
+	b.started = b.now()
+	b.lock.Unlock()
+	var deadline time.Time
+	if b.duration > 0 {
+		deadline = b.started.Add(b.duration)
+	}
+
+	stopped := false
+genLoop:
+	for n := int64(0); b.conf.MessageCount == 0 || n < b.conf.MessageCount; n++ {
+		// Latency is measured from when each message was due to be sent, so
+		// that time spent waiting on a backed up pipeline is included even
+		// when the target rate isn't being kept up with.
+		due := b.now()
+		if interval > 0 {
+			due = b.started.Add(time.Duration(n) * interval)
+		}
+		if !deadline.IsZero() && !due.Before(deadline) {
+			break
+		}
+		// Short waits are skipped, sending the message slightly early, since
+		// timer overshoot would otherwise dominate the latency at high rates.
+		if wait := due.Sub(b.now()); wait >= minWait {
+			select {
+			case <-time.After(wait):
+			case <-b.stopChan:
+				stopped = true
+				break genLoop
+			}
+		}
+		var pack *PipelinePack
+		select {
+		case pack = <-packSupply:
+		case <-b.stopChan:
+			stopped = true
+			break genLoop
+		}
+
+		b.fill(pack.Message, logger, n)
+		size := len(pack.Message.GetPayload())
+		ir.Deliver(pack)
+		latency := b.now().Sub(due)
+		if latency < 0 {
+			latency = 0
+		}
+
+		b.lock.Lock()
+		b.sent++
+		b.sentBytes += int64(size)
+		b.latencies.add(latency)
+		b.lock.Unlock()
+	}
+
+	b.lock.Lock()
+	b.finished = b.now()
+	b.lock.Unlock()
+	ir.LogMessage(b.summary())
+
+	if !stopped && b.conf.ShutdownWhenDone {
+		h.PipelineConfig().Globals.ShutDown(0)
+	}
+	// Wait to be stopped, so that finishing the run doesn't look like the
+	// input failed.
+	if !stopped {
+		<-b.stopChan
+	}
+	return nil
+}
+
+func (b *BenchmarkInput) Stop() {
+	close(b.stopChan)
+}
+
+// Returns the time spent generating messages so far.
+func (b *BenchmarkInput) elapsed() time.Duration {
+	if b.started.IsZero() {
+		return 0
+	}
+	if b.finished.IsZero() {
+		return b.now().Sub(b.started)
+	}
+	return b.finished.Sub(b.started)
+}
+
+// Describes the throughput and latency of the run.
+func (b *BenchmarkInput) summary() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	elapsed := b.elapsed()
+	var msgRate, byteRate float64
+	if secs := elapsed.Seconds(); secs > 0 {
+		msgRate = float64(b.sent) / secs
+		byteRate = float64(b.sentBytes) / secs / (1024 * 1024)
+	}
+	l := b.latencies
+	return fmt.Sprintf("Benchmark finished: %d messages (%d payload bytes) in %s, "+
+		"%.1f msg/s, %.2f MiB/s; latency p50=%s p90=%s p99=%s max=%s",
+		b.sent, b.sentBytes, elapsed, msgRate, byteRate, l.percentile(50),
+		l.percentile(90), l.percentile(99), l.max)
+}
+
+func (b *BenchmarkInput) ReportMsg(msg *message.Message) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	toMicros := func(d time.Duration) int64 {
+		return int64(d / time.Microsecond)
+	}
+	message.NewInt64Field(msg, "SentMessageCount", b.sent, "count")
+	message.NewInt64Field(msg, "SentBytes", b.sentBytes, "B")
+	var msgRate float64
+	if secs := b.elapsed().Seconds(); secs > 0 {
+		msgRate = float64(b.sent) / secs
+	}
+	if field, err := message.NewField("MessageRate", msgRate, "count/s"); err == nil {
+		msg.AddField(field)
+	}
+	l := b.latencies
+	message.NewInt64Field(msg, "LatencyP50", toMicros(l.percentile(50)), "us")
+	message.NewInt64Field(msg, "LatencyP99", toMicros(l.percentile(99)), "us")
+	message.NewInt64Field(msg, "LatencyMax", toMicros(l.max), "us")
+	return nil
+}
+
+// Keeps a uniform random sample of the observed latencies, along with the
+// maximum.
+type latencyStats struct {
+	samples []time.Duration
+	count   int64
+	max     time.Duration
+	rand    *rand.Rand
+}
+
+func newLatencyStats(r *rand.Rand) *latencyStats {
+	return &latencyStats{
+		samples: make([]time.Duration, 0, latencySamples),
+		rand:    r,
+	}
+}
+
+func (l *latencyStats) add(d time.Duration) {
+	l.count++
+	if d > l.max {
+		l.max = d
+	}
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+	// Reservoir sampling, so every observation is equally likely to be kept.
+	if i := l.rand.Int63n(l.count); i < latencySamples {
+		l.samples[i] = d
+	}
+}
+
+// Returns the latency below which the given percentage of the samples fall.
+func (l *latencyStats) percentile(p float64) time.Duration {
+	if len(l.samples) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(l.samples))
+	copy(sorted, l.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(p / 100 * float64(len(sorted)))
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func init() {
+	RegisterPlugin("BenchmarkInput", func() interface{} {
+		return new(BenchmarkInput)
+	})
+}
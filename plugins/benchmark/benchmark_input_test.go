@@ -0,0 +1,156 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package benchmark
+
+import (
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func BenchInputSpec(c gs.Context) {
+	t := &pipeline_ts.SimpleT{}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pConfig := NewPipelineConfig(nil)
+	ir := pipelinemock.NewMockInputRunner(ctrl)
+	h := pipelinemock.NewMockPluginHelper(ctrl)
+
+	c.Specify("A BenchmarkInput", func() {
+		input := new(BenchmarkInput)
+		input.SetPipelineConfig(pConfig)
+		config := input.ConfigStruct().(*BenchmarkInputConfig)
+		config.Seed = 1
+
+		packSupply := make(chan *PipelinePack, 1)
+		packSupply <- NewPipelinePack(packSupply)
+		ir.EXPECT().InChan().Return(packSupply).AnyTimes()
+		ir.EXPECT().Name().Return("bench").AnyTimes()
+
+		var delivered []*message.Message
+		ir.EXPECT().Deliver(gomock.Any()).AnyTimes().Do(func(pack *PipelinePack) {
+			delivered = append(delivered, message.CopyMessage(pack.Message))
+			pack.Recycle(nil)
+		})
+		var summary string
+		ir.EXPECT().LogMessage(gomock.Any()).AnyTimes().Do(func(msg string) {
+			summary = msg
+		})
+
+		c.Specify("generates the configured number of messages", func() {
+			config.MessageCount = 20
+			config.PayloadSize = 10
+			config.FieldCount = 2
+			config.FieldCardinality = 3
+			err := input.Init(config)
+			c.Assume(err, gs.IsNil)
+
+			done := make(chan error)
+			go func() {
+				done <- input.Run(ir, h)
+			}()
+			time.Sleep(10 * time.Millisecond)
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+
+			c.Expect(len(delivered), gs.Equals, 20)
+			values := make(map[string]bool)
+			for _, msg := range delivered {
+				c.Expect(msg.GetType(), gs.Equals, "heka.benchmark")
+				c.Expect(msg.GetLogger(), gs.Equals, "bench")
+				c.Expect(len(msg.GetPayload()), gs.Equals, 10)
+				c.Expect(len(msg.Fields), gs.Equals, 2)
+				value, _ := msg.GetFieldValue("field1")
+				values[value.(string)] = true
+			}
+			c.Expect(len(values) <= 3, gs.IsTrue)
+			c.Expect(strings.HasPrefix(summary, "Benchmark finished: 20 messages (200 payload bytes)"),
+				gs.IsTrue)
+		})
+
+		c.Specify("cycles through a payload corpus", func() {
+			config.MessageCount = 3
+			config.PayloadCorpus = "corpus.txt"
+			pConfig.Globals.ShareDir, _ = filepath.Abs("testsupport")
+			err := input.Init(config)
+			c.Assume(err, gs.IsNil)
+
+			done := make(chan error)
+			go func() {
+				done <- input.Run(ir, h)
+			}()
+			time.Sleep(10 * time.Millisecond)
+			input.Stop()
+			<-done
+
+			c.Expect(len(delivered), gs.Equals, 3)
+			c.Expect(delivered[0].GetPayload(), gs.Equals, "first line")
+			c.Expect(delivered[1].GetPayload(), gs.Equals, "second line")
+			c.Expect(delivered[2].GetPayload(), gs.Equals, "first line")
+		})
+
+		c.Specify("stops at the end of its duration", func() {
+			config.Rate = 1000
+			config.Duration = "20ms"
+			err := input.Init(config)
+			c.Assume(err, gs.IsNil)
+
+			done := make(chan error)
+			go func() {
+				done <- input.Run(ir, h)
+			}()
+			time.Sleep(50 * time.Millisecond)
+			input.Stop()
+			<-done
+			c.Expect(len(delivered) > 0, gs.IsTrue)
+			c.Expect(len(delivered) <= 20, gs.IsTrue)
+			c.Expect(summary, gs.Not(gs.Equals), "")
+		})
+
+		c.Specify("requires a limit when shutting down when done", func() {
+			config.ShutdownWhenDone = true
+			err := input.Init(config)
+			c.Expect(err.Error(), gs.Equals,
+				"shutdown_when_done requires a message_count or duration")
+		})
+	})
+
+	c.Specify("Latency stats", func() {
+		l := newLatencyStats(rand.New(rand.NewSource(1)))
+		for i := 1; i <= 100; i++ {
+			l.add(time.Duration(i) * time.Millisecond)
+		}
+		c.Expect(l.percentile(50), gs.Equals, 51*time.Millisecond)
+		c.Expect(l.percentile(99), gs.Equals, 100*time.Millisecond)
+		c.Expect(l.max, gs.Equals, 100*time.Millisecond)
+
+		c.Specify("keep a bounded sample", func() {
+			for i := 0; i < 2*latencySamples; i++ {
+				l.add(time.Millisecond)
+			}
+			c.Expect(len(l.samples), gs.Equals, latencySamples)
+			c.Expect(l.count, gs.Equals, int64(2*latencySamples+100))
+		})
+	})
+}
@@ -0,0 +1,537 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package cassandra
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+	"heka/plugins/tcp"
+)
+
+type CassandraOutputConfig struct {
+	// Contact points, "host:port". The first reachable one is used to
+	// discover the others. Defaults to "127.0.0.1:9042".
+	Hosts    []string `toml:"hosts"`
+	Keyspace string   `toml:"keyspace"`
+	Table    string   `toml:"table"`
+	// Message header or field written to each column, by column name.
+	Columns map[string]string `toml:"columns"`
+	// Seconds rows live for, 0 for ever, and a message field overriding it.
+	Ttl      uint   `toml:"ttl"`
+	TtlField string `toml:"ttl_field"`
+	// Consistency level of the writes. Defaults to "LOCAL_QUORUM".
+	Consistency string `toml:"consistency"`
+	// Login for the PasswordAuthenticator.
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	UseTls   bool   `toml:"use_tls"`
+	Tls      tcp.TlsConfig
+	// Most rows written in a batch, and also the most buffered before
+	// they're written. Defaults to 100.
+	BatchSize uint `toml:"batch_size"`
+	// Whether rows are written to the node owning their partition, in
+	// batches of a single partition. Defaults to true.
+	TokenAware bool `toml:"token_aware"`
+	// Seconds to connect or to get a response. Defaults to 10.
+	Timeout uint `toml:"timeout"`
+	// Seconds between writing the rows buffered. Defaults to 1.
+	TickerInterval uint `toml:"ticker_interval"`
+}
+
+// A row waiting to be written, the values bound to the insert statement.
+type cassandraRow struct {
+	values [][]byte
+	key    []byte
+}
+
+// Output plugin that inserts messages as rows of a Cassandra or ScyllaDB
+// table, with a prepared statement binding columns to message headers and
+// fields. Rows are buffered and written in unlogged batches, grouped by
+// partition and sent to the node owning it.
+type CassandraOutput struct {
+	conf        *CassandraOutputConfig
+	tlsConf     *tls.Config
+	or          OutputRunner
+	consistency uint16
+	query       string
+	// Message header or field bound to each of the query's markers.
+	names []string
+	stmt  *preparedStatement
+
+	// Connections by node, the contact node's being used for the rows of
+	// nodes which can't be reached.
+	contact     string
+	conns       map[string]*cqlConn
+	unreachable map[string]bool
+	ring        tokenRing
+
+	rows   []*cassandraRow
+	cursor string
+
+	// Accessed atomically, for the reports.
+	rowsWritten   int64
+	batchesSent   int64
+	writeFailures int64
+	rowsDropped   int64
+	waiting       int64
+}
+
+func (o *CassandraOutput) ConfigStruct() interface{} {
+	return &CassandraOutputConfig{
+		Hosts:          []string{"127.0.0.1:9042"},
+		Consistency:    "LOCAL_QUORUM",
+		BatchSize:      100,
+		TokenAware:     true,
+		Timeout:        10,
+		TickerInterval: 1,
+	}
+}
+
+// Quotes an identifier, so that its case is kept.
+func quoteIdent(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+func (o *CassandraOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*CassandraOutputConfig)
+	if len(o.conf.Hosts) == 0 {
+		return errors.New("hosts must be set")
+	}
+	if o.conf.Keyspace == "" || o.conf.Table == "" {
+		return errors.New("keyspace and table must be set")
+	}
+	if len(o.conf.Columns) == 0 {
+		return errors.New("columns must be set")
+	}
+	if o.conf.BatchSize == 0 || o.conf.BatchSize > 65535 {
+		return errors.New("batch_size must be between 1 and 65535")
+	}
+	var ok bool
+	if o.consistency, ok = consistencies[strings.ToUpper(o.conf.Consistency)]; !ok {
+		return fmt.Errorf("unknown consistency '%s'", o.conf.Consistency)
+	}
+	if o.conf.UseTls {
+		if o.tlsConf, err = tcp.CreateGoTlsConfig(&o.conf.Tls); err != nil {
+			return fmt.Errorf("TLS init error: %s", err)
+		}
+	}
+
+	columns := make([]string, 0, len(o.conf.Columns))
+	for column := range o.conf.Columns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	quoted := make([]string, len(columns))
+	markers := make([]string, len(columns))
+	o.names = make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdent(column)
+		markers[i] = "?"
+		o.names[i] = o.conf.Columns[column]
+	}
+	o.query = fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES (%s)",
+		quoteIdent(o.conf.Keyspace), quoteIdent(o.conf.Table),
+		strings.Join(quoted, ","), strings.Join(markers, ","))
+	if o.conf.Ttl > 0 || o.conf.TtlField != "" {
+		o.query += " USING TTL ?"
+	}
+	o.stmt, o.contact, o.ring = nil, "", nil
+	o.conns = make(map[string]*cqlConn)
+	o.unreachable = make(map[string]bool)
+	return nil
+}
+
+func (o *CassandraOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	o.or = or
+	return nil
+}
+
+// Returns the value of a message header or field.
+func messageValue(msg *message.Message, name string) (interface{}, bool) {
+	switch name {
+	case "Type":
+		return msg.GetType(), true
+	case "Logger":
+		return msg.GetLogger(), true
+	case "Hostname":
+		return msg.GetHostname(), true
+	case "Payload":
+		return msg.GetPayload(), true
+	case "EnvVersion":
+		return msg.GetEnvVersion(), true
+	case "Severity":
+		return int64(msg.GetSeverity()), true
+	case "Pid":
+		return int64(msg.GetPid()), true
+	case "Uuid":
+		return msg.GetUuidString(), true
+	case "Timestamp":
+		return time.Unix(0, msg.GetTimestamp()).UTC(), true
+	}
+	f := msg.FindFirstField(name)
+	if f == nil {
+		return nil, false
+	}
+	return fieldValue(f), true
+}
+
+// Returns a field's value: a single value, or for collection columns an
+// array of multiple values.
+func fieldValue(f *message.Field) interface{} {
+	var values []interface{}
+	switch f.GetValueType() {
+	case message.Field_STRING:
+		for _, v := range f.ValueString {
+			values = append(values, v)
+		}
+	case message.Field_BYTES:
+		for _, v := range f.ValueBytes {
+			values = append(values, v)
+		}
+	case message.Field_INTEGER:
+		for _, v := range f.ValueInteger {
+			values = append(values, v)
+		}
+	case message.Field_DOUBLE:
+		for _, v := range f.ValueDouble {
+			values = append(values, v)
+		}
+	case message.Field_BOOL:
+		for _, v := range f.ValueBool {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// Returns the row of a message, with the values of the columns the message
+// has the headers or fields of.
+func (o *CassandraOutput) row(msg *message.Message) (*cassandraRow, error) {
+	columns := o.stmt.columns
+	if len(columns) < len(o.names) {
+		return nil, errors.New("statement has fewer columns than the query")
+	}
+	r := &cassandraRow{values: make([][]byte, len(columns))}
+	for i, name := range o.names {
+		v, ok := messageValue(msg, name)
+		if !ok {
+			continue
+		}
+		if t, ok := v.(time.Time); ok && (columns[i].typ.id == typeVarchar ||
+			columns[i].typ.id == typeAscii) {
+			v = t.Format(time.RFC3339Nano)
+		}
+		var err error
+		if r.values[i], err = marshalValue(columns[i].typ, v); err != nil {
+			return nil, fmt.Errorf("%s: %s", columns[i].name, err)
+		}
+	}
+	if len(columns) > len(o.names) {
+		ttl := int64(o.conf.Ttl)
+		if o.conf.TtlField != "" {
+			if v, ok := msg.GetFieldValue(o.conf.TtlField); ok {
+				var err error
+				if ttl, err = toInt(v); err != nil || ttl < 0 {
+					return nil, fmt.Errorf("%s: bad TTL '%v'", o.conf.TtlField, v)
+				}
+			}
+		}
+		var err error
+		if r.values[len(o.names)], err = marshalValue(columns[len(o.names)].typ,
+			ttl); err != nil {
+			return nil, fmt.Errorf("TTL: %s", err)
+		}
+	}
+	for _, i := range o.stmt.pkIndexes {
+		if i >= len(r.values) || r.values[i] == nil {
+			return nil, fmt.Errorf("message has no value for the partition key")
+		}
+	}
+	r.key = routingKey(r.values, o.stmt.pkIndexes)
+	return r, nil
+}
+
+// Connects to the first reachable contact point and prepares the insert
+// statement there, discovering the token ring if writes are token aware.
+func (o *CassandraOutput) connect() (err error) {
+	if o.contact != "" {
+		return nil
+	}
+	timeout := time.Duration(o.conf.Timeout) * time.Second
+	var c *cqlConn
+	for _, host := range o.conf.Hosts {
+		if c, err = dialCql(host, o.tlsConf, timeout, o.conf.Username,
+			o.conf.Password); err == nil {
+			o.contact = host
+			break
+		}
+		err = fmt.Errorf("can't connect to %s: %s", host, err)
+	}
+	if c == nil {
+		return err
+	}
+	stmt, err := c.prepare(o.query)
+	if err != nil {
+		c.Close()
+		o.contact = ""
+		return fmt.Errorf("can't prepare '%s': %s", o.query, err)
+	}
+	o.stmt = stmt
+	o.conns[o.contact] = c
+	o.unreachable = make(map[string]bool)
+	if o.conf.TokenAware {
+		o.ring = o.discoverRing(c)
+	}
+	return nil
+}
+
+// Returns the ring of the contact node's cluster, or nil if it can't be
+// read, in which case every row is written to the contact node.
+func (o *CassandraOutput) discoverRing(c *cqlConn) tokenRing {
+	_, port, err := net.SplitHostPort(o.contact)
+	if err != nil {
+		return nil
+	}
+	local, err := c.query("SELECT rpc_address, tokens FROM system.local", consistencies["ONE"])
+	if err != nil {
+		o.or.LogError(fmt.Errorf("can't read the token ring: %s", err))
+		return nil
+	}
+	peers, err := c.query("SELECT rpc_address, tokens FROM system.peers", consistencies["ONE"])
+	if err != nil {
+		o.or.LogError(fmt.Errorf("can't read the token ring: %s", err))
+		return nil
+	}
+	ring := newTokenRing(append(local, peers...), port)
+	// Nodes are addressed as the contact node was when it's among them. A
+	// node listening on every interface reports 0.0.0.0.
+	host, _, _ := net.SplitHostPort(o.contact)
+	for i := range ring {
+		if h, _, _ := net.SplitHostPort(ring[i].host); h == host || h == "0.0.0.0" {
+			ring[i].host = o.contact
+		}
+	}
+	return ring
+}
+
+// Closes the connection to a node, and if it's the contact node's every
+// connection, so that the next write connects again.
+func (o *CassandraOutput) disconnect(host string) {
+	if host != o.contact {
+		if c := o.conns[host]; c != nil {
+			c.Close()
+			delete(o.conns, host)
+		}
+		return
+	}
+	for h, c := range o.conns {
+		c.Close()
+		delete(o.conns, h)
+	}
+	o.contact = ""
+	o.ring = nil
+}
+
+// Returns the node rows are written to and its connection, which is the
+// contact node's if the owner can't be reached.
+func (o *CassandraOutput) conn(owner string) (string, *cqlConn) {
+	if owner == "" || o.unreachable[owner] {
+		return o.contact, o.conns[o.contact]
+	}
+	if c := o.conns[owner]; c != nil {
+		return owner, c
+	}
+	c, err := dialCql(owner, o.tlsConf, time.Duration(o.conf.Timeout)*time.Second,
+		o.conf.Username, o.conf.Password)
+	if err != nil {
+		o.or.LogError(fmt.Errorf("can't connect to %s, writing through %s: %s",
+			owner, o.contact, err))
+		o.unreachable[owner] = true
+		return o.contact, o.conns[o.contact]
+	}
+	o.conns[owner] = c
+	return owner, c
+}
+
+// Writes the rows buffered, in batches of rows of the same partition, and
+// moves the cursor past them once none are left. Rows a node rejects as
+// invalid are dropped; the others are kept to be written again.
+func (o *CassandraOutput) flush() error {
+	if len(o.rows) == 0 {
+		return nil
+	}
+	if err := o.connect(); err != nil {
+		atomic.AddInt64(&o.writeFailures, 1)
+		return err
+	}
+
+	type group struct {
+		owner string
+		rows  []int
+	}
+	var groups []*group
+	byKey := make(map[string]*group)
+	for i, r := range o.rows {
+		var owner string
+		if o.ring != nil && r.key != nil {
+			owner = o.ring.owner(murmur3Token(r.key))
+		}
+		k := owner + "\x00" + string(r.key)
+		g := byKey[k]
+		if g == nil {
+			g = &group{owner: owner}
+			byKey[k] = g
+			groups = append(groups, g)
+		}
+		g.rows = append(g.rows, i)
+	}
+
+	done := make([]bool, len(o.rows))
+	var lastErr error
+	for _, g := range groups {
+		for start := 0; start < len(g.rows); start += int(o.conf.BatchSize) {
+			end := start + int(o.conf.BatchSize)
+			if end > len(g.rows) {
+				end = len(g.rows)
+			}
+			if o.contact == "" {
+				// The contact node went away, the rest being written on
+				// the next flush.
+				break
+			}
+			host, c := o.conn(g.owner)
+			values := make([][][]byte, 0, end-start)
+			for _, i := range g.rows[start:end] {
+				values = append(values, o.rows[i].values)
+			}
+			err := c.execute(o.stmt, values, o.consistency)
+			if e, ok := err.(*cqlError); ok && e.permanent() {
+				atomic.AddInt64(&o.rowsDropped, int64(len(values)))
+				o.or.LogError(fmt.Errorf("%d rows dropped: %s", len(values), err))
+			} else if err != nil {
+				atomic.AddInt64(&o.writeFailures, 1)
+				lastErr = fmt.Errorf("can't write %d rows to %s: %s", len(values), host, err)
+				if _, ok := err.(*cqlError); !ok {
+					o.disconnect(host)
+				}
+				continue
+			} else {
+				atomic.AddInt64(&o.rowsWritten, int64(len(values)))
+				atomic.AddInt64(&o.batchesSent, 1)
+			}
+			for _, i := range g.rows[start:end] {
+				done[i] = true
+			}
+		}
+	}
+
+	rows := o.rows[:0]
+	for i, r := range o.rows {
+		if !done[i] {
+			rows = append(rows, r)
+		}
+	}
+	for i := len(rows); i < len(o.rows); i++ {
+		o.rows[i] = nil
+	}
+	o.rows = rows
+	atomic.StoreInt64(&o.waiting, int64(len(o.rows)))
+	if len(o.rows) == 0 {
+		o.or.UpdateCursor(o.cursor)
+		return nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("%d rows not written", len(o.rows))
+	}
+	return lastErr
+}
+
+func (o *CassandraOutput) ProcessMessage(pack *PipelinePack) error {
+	if len(o.rows) >= int(o.conf.BatchSize) {
+		if err := o.flush(); err != nil {
+			return NewRetryMessageError("%s", err)
+		}
+	}
+	if o.stmt == nil {
+		if err := o.connect(); err != nil {
+			atomic.AddInt64(&o.writeFailures, 1)
+			return NewRetryMessageError("%s", err)
+		}
+	}
+	r, err := o.row(pack.Message)
+	if err != nil {
+		atomic.AddInt64(&o.rowsDropped, 1)
+		if len(o.rows) == 0 {
+			o.or.UpdateCursor(pack.QueueCursor)
+		} else {
+			o.cursor = pack.QueueCursor
+		}
+		return fmt.Errorf("can't build row: %s", err)
+	}
+	o.rows = append(o.rows, r)
+	o.cursor = pack.QueueCursor
+	atomic.StoreInt64(&o.waiting, int64(len(o.rows)))
+	if len(o.rows) >= int(o.conf.BatchSize) {
+		if err = o.flush(); err != nil {
+			// Written with the next message or tick.
+			o.or.LogError(err)
+		}
+	}
+	return nil
+}
+
+func (o *CassandraOutput) TimerEvent() error {
+	if err := o.flush(); err != nil {
+		o.or.LogError(err)
+	}
+	return nil
+}
+
+func (o *CassandraOutput) CleanUp() {
+	if err := o.flush(); err != nil {
+		o.or.LogError(fmt.Errorf("rows may not have been written: %s", err))
+	}
+	if o.contact != "" {
+		o.disconnect(o.contact)
+	}
+}
+
+func (o *CassandraOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "RowsWritten", atomic.LoadInt64(&o.rowsWritten), "count")
+	message.NewInt64Field(msg, "BatchesSent", atomic.LoadInt64(&o.batchesSent), "count")
+	message.NewInt64Field(msg, "WriteFailures", atomic.LoadInt64(&o.writeFailures),
+		"count")
+	message.NewInt64Field(msg, "RowsDropped", atomic.LoadInt64(&o.rowsDropped), "count")
+	message.NewInt64Field(msg, "Waiting", atomic.LoadInt64(&o.waiting), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("CassandraOutput", func() interface{} {
+		return new(CassandraOutput)
+	})
+}
@@ -0,0 +1,419 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package cassandra
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+// A write request the server received, a batch of one or more rows.
+type cqlWrite struct {
+	batch       bool
+	consistency uint16
+	rows        [][][]byte
+}
+
+// A node that prepares the insert statement as having the given columns,
+// and records the rows it's asked to write.
+type cqlServer struct {
+	listener  net.Listener
+	columns   []cqlColumn
+	pkIndexes []int
+	tokens    []string
+
+	lock     sync.Mutex
+	password string
+	prepares []string
+	writes   []*cqlWrite
+	// Error codes the next writes fail with.
+	failures []uint32
+	// Whether the next write is of a statement the node has forgotten.
+	forget bool
+}
+
+func newCqlServer(columns []cqlColumn, pkIndexes []int) *cqlServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := &cqlServer{listener: listener, columns: columns, pkIndexes: pkIndexes,
+		tokens: []string{"-3074457345618258603", "3074457345618258602"}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *cqlServer) configure(f func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f()
+}
+
+func (s *cqlServer) received() []*cqlWrite {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*cqlWrite(nil), s.writes...)
+}
+
+func errorBody(code uint32, msg string) []byte {
+	return appendString(appendInt(nil, int32(code)), msg)
+}
+
+// Reads the values of a row, nil being unset ones.
+func readValues(r *cqlReader) [][]byte {
+	var values [][]byte
+	for n := r.short(); n > 0 && r.err == nil; n-- {
+		values = append(values, r.bytes())
+	}
+	return values
+}
+
+func (s *cqlServer) serve(conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, frameHeaderSz)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[5:]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		op, resp := s.handle(header[4], &cqlReader{b: body})
+		frame := append([]byte{responseFlag | protoVersion, 0, header[2], header[3], op},
+			appendInt(nil, int32(len(resp)))...)
+		if _, err := conn.Write(append(frame, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *cqlServer) handle(op byte, r *cqlReader) (byte, []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch op {
+	case opStartup:
+		if s.password != "" {
+			return opAuthenticate, appendString(nil,
+				"org.apache.cassandra.auth.PasswordAuthenticator")
+		}
+		return opReady, nil
+	case opAuthResponse:
+		if string(r.bytes()) != "\x00heka\x00"+s.password {
+			return opError, errorBody(errBadCredentials, "bad credentials")
+		}
+		return opAuthSuccess, appendInt(nil, -1)
+	case opQuery:
+		query := string(r.next(int(r.int())))
+		resp := appendInt(nil, resultRows)
+		resp = appendInt(appendInt(resp, 1), 2)
+		resp = appendString(appendString(resp, "system"), "local")
+		resp = appendShort(appendString(resp, "rpc_address"), typeInet)
+		resp = appendShort(appendString(resp, "tokens"), typeSet)
+		resp = appendShort(resp, typeVarchar)
+		if strings.Contains(query, "system.peers") {
+			return opResult, appendInt(resp, 0)
+		}
+		resp = appendValue(appendInt(resp, 1), []byte{127, 0, 0, 1})
+		set := appendInt(nil, int32(len(s.tokens)))
+		for _, t := range s.tokens {
+			set = appendValue(set, []byte(t))
+		}
+		return opResult, appendValue(resp, set)
+	case opPrepare:
+		s.prepares = append(s.prepares, string(r.next(int(r.int()))))
+		resp := appendShortBytes(appendInt(nil, resultPrepared), []byte("stmt"))
+		resp = appendInt(appendInt(resp, 1), int32(len(s.columns)))
+		resp = appendInt(resp, int32(len(s.pkIndexes)))
+		for _, i := range s.pkIndexes {
+			resp = appendShort(resp, uint16(i))
+		}
+		resp = appendString(appendString(resp, "logs"), "events")
+		for _, c := range s.columns {
+			resp = appendShort(appendString(resp, c.name), c.typ.id)
+			for _, e := range c.typ.elems {
+				resp = appendShort(resp, e.id)
+			}
+		}
+		return opResult, appendInt(appendInt(resp, 4), 0)
+	}
+
+	w := &cqlWrite{batch: op == opBatch}
+	if op == opExecute {
+		r.shortBytes()
+		w.consistency = r.short()
+		r.byte()
+		w.rows = [][][]byte{readValues(r)}
+	} else {
+		r.byte()
+		for n := r.short(); n > 0 && r.err == nil; n-- {
+			r.byte()
+			r.shortBytes()
+			w.rows = append(w.rows, readValues(r))
+		}
+		w.consistency = r.short()
+	}
+	if s.forget {
+		s.forget = false
+		return opError, appendShortBytes(errorBody(errUnprepared, "unprepared"),
+			[]byte("stmt"))
+	}
+	if len(s.failures) > 0 {
+		code := s.failures[0]
+		s.failures = s.failures[1:]
+		return opError, errorBody(code, "failed")
+	}
+	s.writes = append(s.writes, w)
+	return opResult, appendInt(nil, resultVoid)
+}
+
+func CassandraOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A CassandraOutput", func() {
+		columns := []cqlColumn{
+			{"host", cqlType{id: typeVarchar}},
+			{"msg", cqlType{id: typeVarchar}},
+			{"severity", cqlType{id: typeInt}},
+			{"tags", cqlType{id: typeSet, elems: []cqlType{{id: typeVarchar}}}},
+			{"ts", cqlType{id: typeTimestamp}},
+		}
+		server := newCqlServer(columns, []int{0})
+		defer server.listener.Close()
+
+		output := new(CassandraOutput)
+		config := output.ConfigStruct().(*CassandraOutputConfig)
+		config.Hosts = []string{server.listener.Addr().String()}
+		config.Keyspace = "logs"
+		config.Table = "events"
+		config.Columns = map[string]string{
+			"host":     "Hostname",
+			"msg":      "Payload",
+			"severity": "Severity",
+			"tags":     "tags",
+			"ts":       "Timestamp",
+		}
+		config.BatchSize = 3
+
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		var cursor string
+		or.EXPECT().UpdateCursor(gomock.Any()).Do(func(c string) {
+			cursor = c
+		}).AnyTimes()
+
+		newPack := func(hostname, payload, queueCursor string) *PipelinePack {
+			pack := NewPipelinePack(nil)
+			pack.Message.SetTimestamp(time.Unix(1500000000, 0).UnixNano())
+			pack.Message.SetHostname(hostname)
+			pack.Message.SetPayload(payload)
+			pack.Message.SetSeverity(3)
+			pack.QueueCursor = queueCursor
+			return pack
+		}
+
+		c.Specify("writes batches of rows of the same partition", func() {
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			pack := newPack("web1", "one", "c1")
+			field, _ := message.NewField("tags", "a", "")
+			field.AddValue("b")
+			pack.Message.AddField(field)
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("web2", "two", "c2")), gs.IsNil)
+			c.Expect(len(server.received()), gs.Equals, 0)
+			c.Expect(output.ProcessMessage(newPack("web1", "three", "c3")), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c3")
+
+			c.Expect(server.prepares, gs.ContainsExactly, []string{`INSERT INTO "logs".` +
+				`"events" ("host","msg","severity","tags","ts") VALUES (?,?,?,?,?)`})
+			writes := server.received()
+			c.Expect(len(writes), gs.Equals, 2)
+			c.Expect(writes[0].batch, gs.IsTrue)
+			c.Expect(writes[0].consistency, gs.Equals, consistencies["LOCAL_QUORUM"])
+			c.Expect(len(writes[0].rows), gs.Equals, 2)
+			row := writes[0].rows[0]
+			c.Expect(string(row[0]), gs.Equals, "web1")
+			c.Expect(string(row[1]), gs.Equals, "one")
+			c.Expect(binary.BigEndian.Uint32(row[2]), gs.Equals, uint32(3))
+			c.Expect(string(row[3]), gs.Equals, "\x00\x00\x00\x02\x00\x00\x00\x01a"+
+				"\x00\x00\x00\x01b")
+			c.Expect(binary.BigEndian.Uint64(row[4]), gs.Equals, uint64(1500000000000))
+			c.Expect(string(writes[0].rows[1][1]), gs.Equals, "three")
+			c.Expect(writes[0].rows[1][3] == nil, gs.IsTrue)
+			c.Expect(writes[1].batch, gs.IsFalse)
+			c.Expect(string(writes[1].rows[0][0]), gs.Equals, "web2")
+			c.Expect(output.rowsWritten, gs.Equals, int64(3))
+			output.CleanUp()
+		})
+
+		c.Specify("binds the TTL", func() {
+			server.columns = append(columns, cqlColumn{"[ttl]", cqlType{id: typeInt}})
+			config.Ttl = 3600
+			config.TtlField = "ttl"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("web1", "one", "c1")), gs.IsNil)
+			pack := newPack("web2", "two", "c2")
+			message.NewInt64Field(pack.Message, "ttl", 60, "")
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c2")
+
+			c.Expect(strings.HasSuffix(server.prepares[0], " USING TTL ?"), gs.IsTrue)
+			writes := server.received()
+			c.Expect(len(writes), gs.Equals, 2)
+			c.Expect(binary.BigEndian.Uint32(writes[0].rows[0][5]), gs.Equals, uint32(3600))
+			c.Expect(binary.BigEndian.Uint32(writes[1].rows[0][5]), gs.Equals, uint32(60))
+			output.CleanUp()
+		})
+
+		c.Specify("prepares the statement again when a node forgets it", func() {
+			server.configure(func() { server.forget = true })
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("web1", "one", "c1")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(len(server.prepares), gs.Equals, 2)
+			c.Expect(len(server.received()), gs.Equals, 1)
+			output.CleanUp()
+		})
+
+		c.Specify("writes rows again after a failure", func() {
+			or.EXPECT().LogError(gomock.Any())
+			server.configure(func() { server.failures = []uint32{0x1001} })
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("web1", "one", "c1")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "")
+			c.Expect(output.waiting, gs.Equals, int64(1))
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(len(server.received()), gs.Equals, 1)
+			c.Expect(output.writeFailures, gs.Equals, int64(1))
+			output.CleanUp()
+		})
+
+		c.Specify("drops rows the node rejects", func() {
+			or.EXPECT().LogError(gomock.Any())
+			server.configure(func() { server.failures = []uint32{errInvalid} })
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("web1", "one", "c1")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(output.rowsDropped, gs.Equals, int64(1))
+			c.Expect(len(server.received()), gs.Equals, 0)
+			output.CleanUp()
+		})
+
+		c.Specify("drops messages without a partition key", func() {
+			config.Columns["host"] = "node"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("web1", "one", "c1")), gs.Not(gs.IsNil))
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(output.rowsDropped, gs.Equals, int64(1))
+			output.CleanUp()
+		})
+
+		c.Specify("retries messages while it can't connect", func() {
+			server.listener.Close()
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			err := output.ProcessMessage(newPack("web1", "one", "c1"))
+			_, ok := err.(RetryMessageError)
+			c.Expect(ok, gs.IsTrue)
+		})
+
+		c.Specify("authenticates with a password", func() {
+			server.configure(func() { server.password = "secret" })
+			config.Username = "heka"
+			config.Password = "secret"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("web1", "one", "c1")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			output.CleanUp()
+
+			config.Password = "wrong"
+			c.Assume(output.Init(config), gs.IsNil)
+			err := output.ProcessMessage(newPack("web1", "two", "c2"))
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("checks its settings", func() {
+			config.Consistency = "SOME"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.Consistency = "one"
+			config.BatchSize = 0
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.BatchSize = 10
+			config.Table = ""
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+
+	c.Specify("Token awareness", func() {
+		c.Specify("hashes keys as the Murmur3Partitioner does", func() {
+			c.Expect(murmur3Token([]byte("hello")), gs.Equals, int64(-3758069500696749310))
+			c.Expect(murmur3Token([]byte("hello, world")), gs.Equals,
+				int64(3760413751763713166))
+			c.Expect(murmur3Token([]byte("\xe9\x80\xff")), gs.Equals,
+				int64(5878431250222690542))
+		})
+
+		c.Specify("builds composite partition keys", func() {
+			values := [][]byte{[]byte("ab"), []byte("x"), []byte("c")}
+			c.Expect(string(routingKey(values, []int{1})), gs.Equals, "x")
+			c.Expect(string(routingKey(values, []int{0, 2})), gs.Equals,
+				"\x00\x02ab\x00\x00\x01c\x00")
+			values[2] = nil
+			c.Expect(routingKey(values, []int{0, 2}) == nil, gs.IsTrue)
+		})
+
+		c.Specify("finds the node owning a token", func() {
+			ring := tokenRing{{-100, "a"}, {0, "b"}, {100, "c"}}
+			c.Expect(ring.owner(-200), gs.Equals, "a")
+			c.Expect(ring.owner(-100), gs.Equals, "a")
+			c.Expect(ring.owner(1), gs.Equals, "c")
+			c.Expect(ring.owner(101), gs.Equals, "a")
+		})
+	})
+}
@@ -0,0 +1,505 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package cassandra
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Version 4 of the CQL native protocol, which Cassandra 2.2 and later and
+// ScyllaDB speak.
+const (
+	protoVersion  = 0x04
+	responseFlag  = 0x80
+	maxFrameSize  = 256 * 1024 * 1024
+	frameHeaderSz = 9
+)
+
+// Opcodes.
+const (
+	opError         = 0x00
+	opStartup       = 0x01
+	opReady         = 0x02
+	opAuthenticate  = 0x03
+	opQuery         = 0x07
+	opResult        = 0x08
+	opPrepare       = 0x09
+	opExecute       = 0x0a
+	opBatch         = 0x0d
+	opAuthChallenge = 0x0e
+	opAuthResponse  = 0x0f
+	opAuthSuccess   = 0x10
+)
+
+// Result kinds.
+const (
+	resultVoid     = 0x0001
+	resultRows     = 0x0002
+	resultPrepared = 0x0004
+)
+
+// Error codes the output treats specially.
+const (
+	errBadCredentials = 0x0100
+	errSyntax         = 0x2000
+	errUnauthorized   = 0x2100
+	errInvalid        = 0x2200
+	errConfig         = 0x2300
+	errUnprepared     = 0x2500
+)
+
+var consistencies = map[string]uint16{
+	"ANY":          0x00,
+	"ONE":          0x01,
+	"TWO":          0x02,
+	"THREE":        0x03,
+	"QUORUM":       0x04,
+	"ALL":          0x05,
+	"LOCAL_QUORUM": 0x06,
+	"EACH_QUORUM":  0x07,
+	"LOCAL_ONE":    0x0a,
+}
+
+// An ERROR response.
+type cqlError struct {
+	code    uint32
+	message string
+}
+
+func (e *cqlError) Error() string {
+	return fmt.Sprintf("CQL error 0x%04x: %s", e.code, e.message)
+}
+
+// Whether sending the request again, to any node, would fail the same way.
+func (e *cqlError) permanent() bool {
+	switch e.code {
+	case errSyntax, errUnauthorized, errInvalid, errConfig:
+		return true
+	}
+	return false
+}
+
+func appendShort(b []byte, n uint16) []byte {
+	return append(b, byte(n>>8), byte(n))
+}
+
+func appendInt(b []byte, n int32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendShort(b, uint16(len(s))), s...)
+}
+
+func appendLongString(b []byte, s string) []byte {
+	return append(appendInt(b, int32(len(s))), s...)
+}
+
+func appendShortBytes(b []byte, v []byte) []byte {
+	return append(appendShort(b, uint16(len(v))), v...)
+}
+
+// Appends a [bytes] value, nil being sent as "unset" so that it leaves no
+// tombstone.
+func appendValue(b []byte, v []byte) []byte {
+	if v == nil {
+		return appendInt(b, -2)
+	}
+	return append(appendInt(b, int32(len(v))), v...)
+}
+
+// Reads the body of a frame, remembering the first error.
+type cqlReader struct {
+	b   []byte
+	err error
+}
+
+func (r *cqlReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b) {
+		r.err = errors.New("truncated CQL frame")
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *cqlReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *cqlReader) short() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *cqlReader) int() int32 {
+	if b := r.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *cqlReader) string() string {
+	return string(r.next(int(r.short())))
+}
+
+func (r *cqlReader) shortBytes() []byte {
+	return r.next(int(r.short()))
+}
+
+// Reads a [bytes] value, which is nil if null.
+func (r *cqlReader) bytes() []byte {
+	n := r.int()
+	if n < 0 {
+		return nil
+	}
+	return r.next(int(n))
+}
+
+// A column type, with its element types if it's a collection.
+type cqlType struct {
+	id    uint16
+	elems []cqlType
+}
+
+// Type option ids.
+const (
+	typeCustom    = 0x0000
+	typeAscii     = 0x0001
+	typeBigint    = 0x0002
+	typeBlob      = 0x0003
+	typeBoolean   = 0x0004
+	typeCounter   = 0x0005
+	typeDecimal   = 0x0006
+	typeDouble    = 0x0007
+	typeFloat     = 0x0008
+	typeInt       = 0x0009
+	typeTimestamp = 0x000b
+	typeUuid      = 0x000c
+	typeVarchar   = 0x000d
+	typeVarint    = 0x000e
+	typeTimeuuid  = 0x000f
+	typeInet      = 0x0010
+	typeDate      = 0x0011
+	typeTime      = 0x0012
+	typeSmallint  = 0x0013
+	typeTinyint   = 0x0014
+	typeList      = 0x0020
+	typeMap       = 0x0021
+	typeSet       = 0x0022
+	typeUdt       = 0x0030
+	typeTuple     = 0x0031
+)
+
+func (r *cqlReader) option() cqlType {
+	t := cqlType{id: r.short()}
+	switch t.id {
+	case typeCustom:
+		r.string()
+	case typeList, typeSet:
+		t.elems = []cqlType{r.option()}
+	case typeMap:
+		t.elems = []cqlType{r.option(), r.option()}
+	case typeUdt:
+		r.string()
+		r.string()
+		for n := r.short(); n > 0 && r.err == nil; n-- {
+			r.string()
+			t.elems = append(t.elems, r.option())
+		}
+	case typeTuple:
+		for n := r.short(); n > 0 && r.err == nil; n-- {
+			t.elems = append(t.elems, r.option())
+		}
+	}
+	return t
+}
+
+type cqlColumn struct {
+	name string
+	typ  cqlType
+}
+
+// Reads the metadata of a PREPARED or ROWS result, returning its columns and
+// for PREPARED the indexes of the partition key's columns.
+func (r *cqlReader) metadata(prepared bool) (columns []cqlColumn, pkIndexes []int) {
+	flags := r.int()
+	count := int(r.int())
+	if prepared {
+		for n := r.int(); n > 0 && r.err == nil; n-- {
+			pkIndexes = append(pkIndexes, int(r.short()))
+		}
+	}
+	if flags&0x0002 != 0 {
+		// Paging state.
+		r.bytes()
+	}
+	if flags&0x0004 != 0 {
+		return nil, pkIndexes
+	}
+	global := flags&0x0001 != 0
+	if global {
+		r.string()
+		r.string()
+	}
+	for i := 0; i < count && r.err == nil; i++ {
+		if !global {
+			r.string()
+			r.string()
+		}
+		columns = append(columns, cqlColumn{name: r.string(), typ: r.option()})
+	}
+	return columns, pkIndexes
+}
+
+// A connection to a node, making one request at a time.
+type cqlConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+	stream  uint16
+	// Ids of the statements prepared on this node.
+	prepared map[string]bool
+}
+
+// Connects, and authenticates with the PasswordAuthenticator if the node asks
+// to.
+func dialCql(address string, tlsConf *tls.Config, timeout time.Duration,
+	username, password string) (*cqlConn, error) {
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: timeout}
+	if tlsConf != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConf)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &cqlConn{
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+		timeout:  timeout,
+		prepared: make(map[string]bool),
+	}
+	body := appendShort(nil, 1)
+	body = appendString(appendString(body, "CQL_VERSION"), "3.0.0")
+	op, _, err := c.request(opStartup, body)
+	if err == nil && op == opAuthenticate {
+		token := append(append([]byte{0}, username...), 0)
+		token = append(token, password...)
+		body = append(appendInt(nil, int32(len(token))), token...)
+		op, _, err = c.request(opAuthResponse, body)
+		if err == nil && op == opAuthChallenge {
+			err = errors.New("unsupported authentication challenge")
+		} else if err == nil && op == opAuthSuccess {
+			op = opReady
+		}
+	}
+	if err == nil && op != opReady {
+		err = fmt.Errorf("unexpected startup response 0x%02x", op)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *cqlConn) Close() error {
+	return c.conn.Close()
+}
+
+// Sends a request and returns the response's opcode and body, or the error
+// an ERROR response carries.
+func (c *cqlConn) request(op byte, body []byte) (byte, []byte, error) {
+	c.stream = (c.stream + 1) & 0x7fff
+	frame := make([]byte, frameHeaderSz, frameHeaderSz+len(body))
+	frame[0] = protoVersion
+	binary.BigEndian.PutUint16(frame[2:], c.stream)
+	frame[4] = op
+	binary.BigEndian.PutUint32(frame[5:], uint32(len(body)))
+	frame = append(frame, body...)
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(frame); err != nil {
+		return 0, nil, err
+	}
+	header := make([]byte, frameHeaderSz)
+	for {
+		if _, err := io.ReadFull(c.r, header); err != nil {
+			return 0, nil, err
+		}
+		if header[0] != responseFlag|protoVersion {
+			return 0, nil, fmt.Errorf("unsupported protocol version 0x%02x", header[0])
+		}
+		length := binary.BigEndian.Uint32(header[5:])
+		if length > maxFrameSize {
+			return 0, nil, fmt.Errorf("frame of %d bytes is too big", length)
+		}
+		resp := make([]byte, length)
+		if _, err := io.ReadFull(c.r, resp); err != nil {
+			return 0, nil, err
+		}
+		if binary.BigEndian.Uint16(header[2:]) != c.stream {
+			// A late response to a request that timed out.
+			continue
+		}
+		if header[1]&0x01 != 0 {
+			return 0, nil, errors.New("compressed frames aren't supported")
+		}
+		if header[1]&0x08 != 0 {
+			// Skip the warnings.
+			r := &cqlReader{b: resp}
+			for n := r.short(); n > 0 && r.err == nil; n-- {
+				r.string()
+			}
+			if r.err != nil {
+				return 0, nil, r.err
+			}
+			resp = r.b
+		}
+		if header[4] == opError {
+			r := &cqlReader{b: resp}
+			e := &cqlError{code: uint32(r.int()), message: r.string()}
+			if r.err != nil {
+				return 0, nil, r.err
+			}
+			return opError, resp, e
+		}
+		return header[4], resp, nil
+	}
+}
+
+// A statement prepared from a query.
+type preparedStatement struct {
+	query     string
+	id        []byte
+	columns   []cqlColumn
+	pkIndexes []int
+}
+
+func (c *cqlConn) prepare(query string) (*preparedStatement, error) {
+	op, resp, err := c.request(opPrepare, appendLongString(nil, query))
+	if err != nil {
+		return nil, err
+	}
+	r := &cqlReader{b: resp}
+	if op != opResult || r.int() != resultPrepared {
+		return nil, errors.New("unexpected response to PREPARE")
+	}
+	stmt := &preparedStatement{query: query, id: append([]byte(nil), r.shortBytes()...)}
+	stmt.columns, stmt.pkIndexes = r.metadata(true)
+	if r.err != nil {
+		return nil, r.err
+	}
+	c.prepared[string(stmt.id)] = true
+	return stmt, nil
+}
+
+// Returns the query parameters of a request without bound values.
+func queryParameters(consistency uint16) []byte {
+	return append(appendShort(nil, consistency), 0)
+}
+
+// Runs a query and returns the rows of its result.
+func (c *cqlConn) query(query string, consistency uint16) ([][][]byte, error) {
+	body := append(appendLongString(nil, query), queryParameters(consistency)...)
+	op, resp, err := c.request(opQuery, body)
+	if err != nil {
+		return nil, err
+	}
+	r := &cqlReader{b: resp}
+	if op != opResult {
+		return nil, errors.New("unexpected response to QUERY")
+	}
+	if r.int() != resultRows {
+		return nil, nil
+	}
+	columns, _ := r.metadata(false)
+	var rows [][][]byte
+	for n := r.int(); n > 0 && r.err == nil; n-- {
+		row := make([][]byte, len(columns))
+		for i := range row {
+			row[i] = r.bytes()
+		}
+		rows = append(rows, row)
+	}
+	return rows, r.err
+}
+
+// Executes a prepared statement once with each of the rows of values, in an
+// unlogged batch if there's more than one. Statements the node has forgotten
+// are prepared again.
+func (c *cqlConn) execute(stmt *preparedStatement, rows [][][]byte,
+	consistency uint16) error {
+
+	if !c.prepared[string(stmt.id)] {
+		if _, err := c.prepare(stmt.query); err != nil {
+			return err
+		}
+	}
+	var op byte
+	var body []byte
+	if len(rows) == 1 {
+		op = opExecute
+		body = appendShortBytes(nil, stmt.id)
+		body = appendShort(body, consistency)
+		body = append(body, 0x01|0x02) // values, skip result metadata
+		body = appendShort(body, uint16(len(rows[0])))
+		for _, v := range rows[0] {
+			body = appendValue(body, v)
+		}
+	} else {
+		op = opBatch
+		body = appendShort([]byte{1}, uint16(len(rows))) // unlogged
+		for _, row := range rows {
+			body = appendShortBytes(append(body, 1), stmt.id)
+			body = appendShort(body, uint16(len(row)))
+			for _, v := range row {
+				body = appendValue(body, v)
+			}
+		}
+		body = append(appendShort(body, consistency), 0)
+	}
+
+	_, _, err := c.request(op, body)
+	if e, ok := err.(*cqlError); ok && e.code == errUnprepared {
+		delete(c.prepared, string(stmt.id))
+		if _, err = c.prepare(stmt.query); err != nil {
+			return err
+		}
+		_, _, err = c.request(op, body)
+	}
+	return err
+}
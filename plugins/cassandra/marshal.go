@@ -0,0 +1,220 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package cassandra
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// Number of days from the epoch the date type counts from, 2^31.
+const dateEpoch = 1 << 31
+
+func toInt(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%v isn't an integer", v)
+		}
+		return int64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case time.Time:
+		return v.UnixNano() / 1e6, nil
+	}
+	n, err := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("'%v' isn't an integer", v)
+	}
+	return n, nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	}
+	f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+	if err != nil {
+		return 0, fmt.Errorf("'%v' isn't a number", v)
+	}
+	return f, nil
+}
+
+func toBytes(v interface{}) []byte {
+	if b, ok := v.([]byte); ok {
+		return b
+	}
+	return []byte(fmt.Sprint(v))
+}
+
+// Returns the serialized value of v in a column of type t, or an error if the
+// type can't hold it.
+func marshalValue(t cqlType, v interface{}) ([]byte, error) {
+	switch t.id {
+	case typeAscii, typeVarchar, typeBlob, typeCustom:
+		return toBytes(v), nil
+	case typeBoolean:
+		var b bool
+		switch v := v.(type) {
+		case bool:
+			b = v
+		default:
+			var err error
+			if b, err = strconv.ParseBool(fmt.Sprint(v)); err != nil {
+				return nil, fmt.Errorf("'%v' isn't a boolean", v)
+			}
+		}
+		if b {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case typeBigint, typeCounter, typeTimestamp:
+		if s, ok := v.(string); ok && t.id == typeTimestamp {
+			if ts, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				v = ts
+			}
+		}
+		n, err := toInt(v)
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(n))
+		return b, nil
+	case typeInt, typeSmallint, typeTinyint, typeDate:
+		n, err := toInt(v)
+		if err != nil {
+			return nil, err
+		}
+		switch t.id {
+		case typeInt:
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, fmt.Errorf("%d is out of an int's range", n)
+			}
+			b := make([]byte, 4)
+			binary.BigEndian.PutUint32(b, uint32(n))
+			return b, nil
+		case typeSmallint:
+			if n < math.MinInt16 || n > math.MaxInt16 {
+				return nil, fmt.Errorf("%d is out of a smallint's range", n)
+			}
+			return []byte{byte(n >> 8), byte(n)}, nil
+		case typeTinyint:
+			if n < math.MinInt8 || n > math.MaxInt8 {
+				return nil, fmt.Errorf("%d is out of a tinyint's range", n)
+			}
+			return []byte{byte(n)}, nil
+		}
+		// Dates are given as milliseconds from the epoch, as Heka's
+		// timestamps are.
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(dateEpoch+n/86400000))
+		return b, nil
+	case typeDouble:
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, math.Float64bits(f))
+		return b, nil
+	case typeFloat:
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, math.Float32bits(float32(f)))
+		return b, nil
+	case typeUuid, typeTimeuuid:
+		if b, ok := v.([]byte); ok && len(b) == 16 {
+			return b, nil
+		}
+		u := uuid.Parse(fmt.Sprint(v))
+		if u == nil {
+			return nil, fmt.Errorf("'%v' isn't a UUID", v)
+		}
+		return []byte(u), nil
+	case typeInet:
+		ip := net.ParseIP(fmt.Sprint(v))
+		if ip == nil {
+			return nil, fmt.Errorf("'%v' isn't an IP address", v)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4, nil
+		}
+		return ip, nil
+	case typeVarint:
+		n, ok := new(big.Int).SetString(fmt.Sprint(v), 10)
+		if !ok {
+			return nil, fmt.Errorf("'%v' isn't an integer", v)
+		}
+		return varintBytes(n), nil
+	case typeList, typeSet:
+		values, ok := v.([]interface{})
+		if !ok {
+			values = []interface{}{v}
+		}
+		b := appendInt(nil, int32(len(values)))
+		for _, e := range values {
+			m, err := marshalValue(t.elems[0], e)
+			if err != nil {
+				return nil, err
+			}
+			b = appendValue(b, m)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("columns of type 0x%04x aren't supported", t.id)
+}
+
+// Encodes a big integer in two's complement, in as few bytes as it needs.
+func varintBytes(n *big.Int) []byte {
+	if n.Sign() >= 0 {
+		b := n.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+	// The two's complement of -n is 2^(8k) - |n|, for k bytes.
+	abs := new(big.Int).Neg(n)
+	k := len(abs.Bytes()) + 1
+	c := new(big.Int).Lsh(big.NewInt(1), uint(8*k))
+	b := c.Sub(c, abs).Bytes()
+	for len(b) > 1 && b[0] == 0xff && b[1]&0x80 != 0 {
+		b = b[1:]
+	}
+	return b
+}
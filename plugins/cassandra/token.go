@@ -0,0 +1,165 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package cassandra
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// Returns the token the Murmur3Partitioner places a partition key at: the
+// first half of its x64 128 bit MurmurHash3. Like Cassandra's implementation
+// it sign extends the bytes of the tail.
+func murmur3Token(data []byte) int64 {
+	const (
+		c1 = 0x87c37b91114253d5
+		c2 = 0x4cf5ad432745937f
+	)
+	var h1, h2 uint64
+	n := len(data) / 16 * 16
+	for i := 0; i < n; i += 16 {
+		k1 := binary.LittleEndian.Uint64(data[i:])
+		k2 := binary.LittleEndian.Uint64(data[i+8:])
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+		h1 = bits.RotateLeft64(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+		h2 = bits.RotateLeft64(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	var k1, k2 uint64
+	tail := data[n:]
+	for i := len(tail) - 1; i >= 8; i-- {
+		k2 ^= uint64(int64(int8(tail[i]))) << (uint(i-8) * 8)
+	}
+	if len(tail) > 8 {
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+	}
+	low := len(tail)
+	if low > 8 {
+		low = 8
+	}
+	for i := low - 1; i >= 0; i-- {
+		k1 ^= uint64(int64(int8(tail[i]))) << (uint(i) * 8)
+	}
+	if len(tail) > 0 {
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+	}
+
+	h1 ^= uint64(len(data))
+	h2 ^= uint64(len(data))
+	h1 += h2
+	h2 += h1
+	h1 = fmix64(h1)
+	h2 = fmix64(h2)
+	h1 += h2
+
+	token := int64(h1)
+	if token == math.MinInt64 {
+		return math.MaxInt64
+	}
+	return token
+}
+
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+// Returns the serialized partition key of a row of values: the key's value
+// if it has a single column, otherwise each component's length, value and a
+// zero end of component byte. Nil if a component is missing.
+func routingKey(values [][]byte, pkIndexes []int) []byte {
+	if len(pkIndexes) == 0 {
+		return nil
+	}
+	if len(pkIndexes) == 1 {
+		return values[pkIndexes[0]]
+	}
+	var key []byte
+	for _, i := range pkIndexes {
+		if values[i] == nil {
+			return nil
+		}
+		key = appendShortBytes(key, values[i])
+		key = append(key, 0)
+	}
+	return key
+}
+
+type tokenOwner struct {
+	token int64
+	host  string
+}
+
+// The token ring, mapping tokens to the nodes owning them.
+type tokenRing []tokenOwner
+
+// Builds a ring from the rows of a `SELECT rpc_address, tokens` of the
+// system.local and system.peers tables. Nodes are addressed on port.
+func newTokenRing(rows [][][]byte, port string) tokenRing {
+	var ring tokenRing
+	for _, row := range rows {
+		if len(row) < 2 || (len(row[0]) != 4 && len(row[0]) != 16) {
+			continue
+		}
+		host := net.JoinHostPort(net.IP(row[0]).String(), port)
+		r := &cqlReader{b: row[1]}
+		for n := r.int(); n > 0 && r.err == nil; n-- {
+			t, err := strconv.ParseInt(string(r.bytes()), 10, 64)
+			if err == nil {
+				ring = append(ring, tokenOwner{token: t, host: host})
+			}
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].token < ring[j].token })
+	return ring
+}
+
+// Returns the node owning a token, which is that of the first token not less
+// than it, wrapping around the ring.
+func (ring tokenRing) owner(token int64) string {
+	if len(ring) == 0 {
+		return ""
+	}
+	i := sort.Search(len(ring), func(i int) bool { return ring[i].token >= token })
+	if i == len(ring) {
+		i = 0
+	}
+	return ring[i].host
+}
@@ -0,0 +1,371 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package chatops
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+	"heka/plugins/tcp"
+)
+
+type ChatOutputConfig struct {
+	// "slack", "teams" or "generic".
+	Service string `toml:"service"`
+	// Webhook posted to, for channels without their own webhook.
+	WebhookUrl string `toml:"webhook_url"`
+	// Webhooks of channels, by channel name.
+	Webhooks map[string]string `toml:"webhooks"`
+	// Slack bot token, posting with the Web API instead of webhooks so that
+	// alerts with the same dedup key can be threaded.
+	Token string `toml:"token"`
+	// Slack Web API base URL. Defaults to "https://slack.com/api".
+	ApiUrl string `toml:"api_url"`
+	// Field naming the channel an alert is posted to.
+	ChannelField string `toml:"channel_field"`
+	// Channel of alerts without a channel_field field.
+	Channel string `toml:"channel"`
+	// Templates of the alert's text and title, with %Field% replaced by the
+	// message's headers and fields. Text defaults to "%Payload%".
+	Text  string `toml:"text"`
+	Title string `toml:"title"`
+	// Template of the key identifying repeats of an alert, which are throttled
+	// and threaded together. Defaults to the alert's text.
+	DedupKey string `toml:"dedup_key"`
+	// Seconds in which only the first of an alert's repeats is posted.
+	// Defaults to 300.
+	Throttle uint `toml:"throttle"`
+	// Seconds after an alert's first post that repeats are replied to in
+	// its thread. Defaults to 86400.
+	ThreadExpiry uint `toml:"thread_expiry"`
+	// Seconds a request may take. Defaults to 10.
+	Timeout uint `toml:"timeout"`
+	Tls     tcp.TlsConfig
+}
+
+// Where an alert was last posted, and how many of its repeats have been
+// throttled since.
+type alertState struct {
+	lastPosted time.Time
+	suppressed int
+	// The Slack thread repeats are replied to.
+	threadTs      string
+	threadStarted time.Time
+}
+
+type alertKey struct {
+	channel string
+	key     string
+}
+
+// Output plugin that posts alerts to Slack, Microsoft Teams or a generic JSON
+// webhook, rendering their text from templates. Alerts are routed to
+// channels by a field, repeats of an alert within the throttle period are
+// counted rather than posted, and with a Slack token repeats are replied to
+// in the first alert's thread.
+type ChatOutput struct {
+	conf   *ChatOutputConfig
+	or     OutputRunner
+	client *http.Client
+	alerts map[alertKey]*alertState
+
+	// Accessed atomically, for the reports.
+	alertsPosted    int64
+	alertsThrottled int64
+	postFailures    int64
+}
+
+func (o *ChatOutput) ConfigStruct() interface{} {
+	return &ChatOutputConfig{
+		Service:      "slack",
+		ApiUrl:       "https://slack.com/api",
+		Text:         "%Payload%",
+		Throttle:     300,
+		ThreadExpiry: 86400,
+		Timeout:      10,
+	}
+}
+
+func (o *ChatOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*ChatOutputConfig)
+	switch o.conf.Service {
+	case "slack":
+		if o.conf.Token != "" && o.conf.Channel == "" && o.conf.ChannelField == "" {
+			return errors.New("posting with a token needs channel or channel_field")
+		}
+	case "teams", "generic":
+		if o.conf.Token != "" {
+			return fmt.Errorf("tokens are only for Slack, not %s", o.conf.Service)
+		}
+	default:
+		return fmt.Errorf("unknown service '%s'", o.conf.Service)
+	}
+	if o.conf.Token == "" && o.conf.WebhookUrl == "" && len(o.conf.Webhooks) == 0 {
+		return errors.New("webhook_url, webhooks or token must be set")
+	}
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if transport.TLSClientConfig, err = tcp.CreateGoTlsConfig(&o.conf.Tls); err != nil {
+		return fmt.Errorf("TLS init error: %s", err)
+	}
+	o.client = &http.Client{Transport: transport,
+		Timeout: time.Duration(o.conf.Timeout) * time.Second}
+	o.alerts = make(map[alertKey]*alertState)
+	return nil
+}
+
+func (o *ChatOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	o.or = or
+	return nil
+}
+
+// Returns the template substitutions of a message: its headers, and its
+// fields' first values.
+func substitutions(msg *message.Message) map[string]string {
+	subs := map[string]string{
+		"Type":     msg.GetType(),
+		"Logger":   msg.GetLogger(),
+		"Hostname": msg.GetHostname(),
+		"Payload":  msg.GetPayload(),
+		"Severity": strconv.Itoa(int(msg.GetSeverity())),
+		"Pid":      strconv.Itoa(int(msg.GetPid())),
+		"Uuid":     msg.GetUuidString(),
+	}
+	for _, f := range msg.Fields {
+		if v := f.GetValue(); v != nil {
+			subs[f.GetName()] = fmt.Sprint(v)
+		}
+	}
+	return subs
+}
+
+// A refused post, which posting again won't help.
+type refusedError struct {
+	error
+}
+
+func (o *ChatOutput) ProcessMessage(pack *PipelinePack) error {
+	msg := pack.Message
+	subs := substitutions(msg)
+	text := InterpolateString(o.conf.Text, subs)
+	title := ""
+	if o.conf.Title != "" {
+		title = InterpolateString(o.conf.Title, subs)
+	}
+	channel := o.conf.Channel
+	if o.conf.ChannelField != "" {
+		if v, ok := msg.GetFieldValue(o.conf.ChannelField); ok {
+			channel = fmt.Sprint(v)
+		}
+	}
+	key := alertKey{channel: channel, key: text}
+	if o.conf.DedupKey != "" {
+		key.key = InterpolateString(o.conf.DedupKey, subs)
+	}
+
+	now := time.Now()
+	state := o.alerts[key]
+	if state != nil && now.Sub(state.lastPosted) < time.Duration(o.conf.Throttle)*time.Second {
+		state.suppressed++
+		atomic.AddInt64(&o.alertsThrottled, 1)
+		o.or.UpdateCursor(pack.QueueCursor)
+		return nil
+	}
+	if state == nil {
+		state = new(alertState)
+	}
+	if state.suppressed > 0 {
+		text += fmt.Sprintf("\n(%d similar alerts suppressed)", state.suppressed)
+	}
+	threadTs := ""
+	if state.threadTs != "" &&
+		now.Sub(state.threadStarted) < time.Duration(o.conf.ThreadExpiry)*time.Second {
+
+		threadTs = state.threadTs
+	}
+
+	var err error
+	var ts string
+	if o.conf.Token != "" {
+		ts, err = o.postSlackApi(channel, title, text, threadTs)
+	} else {
+		err = o.postWebhook(channel, title, text, key.key, msg.GetSeverity())
+	}
+	if err != nil {
+		if _, ok := err.(refusedError); ok {
+			o.or.UpdateCursor(pack.QueueCursor)
+			return err
+		}
+		atomic.AddInt64(&o.postFailures, 1)
+		return NewRetryMessageError("%s", err)
+	}
+	atomic.AddInt64(&o.alertsPosted, 1)
+	state.lastPosted = now
+	state.suppressed = 0
+	if threadTs == "" && ts != "" {
+		state.threadTs = ts
+		state.threadStarted = now
+	}
+	o.remember(key, state, now)
+	o.or.UpdateCursor(pack.QueueCursor)
+	return nil
+}
+
+// Keeps an alert's state, forgetting alerts no longer throttled or threaded
+// once there are many.
+func (o *ChatOutput) remember(key alertKey, state *alertState, now time.Time) {
+	o.alerts[key] = state
+	if len(o.alerts) < 1000 {
+		return
+	}
+	throttle := time.Duration(o.conf.Throttle) * time.Second
+	expiry := time.Duration(o.conf.ThreadExpiry) * time.Second
+	for k, s := range o.alerts {
+		if now.Sub(s.lastPosted) >= throttle && now.Sub(s.threadStarted) >= expiry {
+			delete(o.alerts, k)
+		}
+	}
+}
+
+// Posts JSON, returning the response's body.
+func (o *ChatOutput) post(url string, body interface{}) ([]byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, refusedError{err}
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return nil, refusedError{err}
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if o.conf.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+o.conf.Token)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("post failed: %s", err)
+	}
+	defer resp.Body.Close()
+	text, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode >= 300 {
+		err = fmt.Errorf("post failed: %s: %s", resp.Status, bytes.TrimSpace(text))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusTooManyRequests {
+
+			return nil, refusedError{err}
+		}
+		return nil, err
+	}
+	return text, err
+}
+
+func (o *ChatOutput) postWebhook(channel, title, text, key string, severity int32) error {
+	url := o.conf.WebhookUrl
+	if webhook, ok := o.conf.Webhooks[channel]; ok {
+		url = webhook
+	}
+	if url == "" {
+		return refusedError{fmt.Errorf("no webhook for channel '%s'", channel)}
+	}
+	var body interface{}
+	switch o.conf.Service {
+	case "slack":
+		if title != "" {
+			text = "*" + title + "*\n" + text
+		}
+		body = map[string]interface{}{"text": text}
+	case "teams":
+		summary := title
+		if summary == "" {
+			summary = text
+		}
+		card := map[string]interface{}{
+			"@type":    "MessageCard",
+			"@context": "http://schema.org/extensions",
+			"summary":  summary,
+			"text":     text,
+		}
+		if title != "" {
+			card["title"] = title
+		}
+		body = card
+	default:
+		body = map[string]interface{}{
+			"title":     title,
+			"text":      text,
+			"channel":   channel,
+			"dedup_key": key,
+			"severity":  severity,
+		}
+	}
+	_, err := o.post(url, body)
+	return err
+}
+
+// Posts with Slack's chat.postMessage, returning the message's ts.
+func (o *ChatOutput) postSlackApi(channel, title, text, threadTs string) (string, error) {
+	if title != "" {
+		text = "*" + title + "*\n" + text
+	}
+	body := map[string]interface{}{"channel": channel, "text": text}
+	if threadTs != "" {
+		body["thread_ts"] = threadTs
+	}
+	data, err := o.post(o.conf.ApiUrl+"/chat.postMessage", body)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+		Ts    string `json:"ts"`
+	}
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return "", fmt.Errorf("bad Slack response: %s", err)
+	}
+	if !resp.Ok {
+		err = fmt.Errorf("Slack refused the post: %s", resp.Error)
+		if resp.Error == "ratelimited" {
+			return "", err
+		}
+		return "", refusedError{err}
+	}
+	return resp.Ts, nil
+}
+
+func (o *ChatOutput) CleanUp() {}
+
+func (o *ChatOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "AlertsPosted", atomic.LoadInt64(&o.alertsPosted), "count")
+	message.NewInt64Field(msg, "AlertsThrottled",
+		atomic.LoadInt64(&o.alertsThrottled), "count")
+	message.NewInt64Field(msg, "PostFailures", atomic.LoadInt64(&o.postFailures), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("ChatOutput", func() interface{} {
+		return new(ChatOutput)
+	})
+}
@@ -0,0 +1,213 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package chatops
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+type post struct {
+	path string
+	auth string
+	body map[string]interface{}
+}
+
+func ChatOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A ChatOutput", func() {
+		var lock sync.Mutex
+		var posts []post
+		status := http.StatusOK
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+			r *http.Request) {
+
+			lock.Lock()
+			defer lock.Unlock()
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			posts = append(posts, post{r.URL.Path, r.Header.Get("Authorization"), body})
+			w.WriteHeader(status)
+			if r.URL.Path == "/api/chat.postMessage" {
+				fmt.Fprintf(w, `{"ok":true,"ts":"1500000000.%06d"}`, len(posts))
+			}
+		}))
+		defer server.Close()
+		received := func() []post {
+			lock.Lock()
+			defer lock.Unlock()
+			return append([]post(nil), posts...)
+		}
+
+		output := new(ChatOutput)
+		config := output.ConfigStruct().(*ChatOutputConfig)
+		config.WebhookUrl = server.URL + "/hooks/default"
+		config.Webhooks = map[string]string{"#db": server.URL + "/hooks/db"}
+		config.ChannelField = "channel"
+		config.Text = "%Hostname%: %Payload% (%status%)"
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		var cursor string
+		or.EXPECT().UpdateCursor(gomock.Any()).Do(func(c string) {
+			cursor = c
+		}).AnyTimes()
+
+		newPack := func(payload, channel, queueCursor string) *PipelinePack {
+			pack := NewPipelinePack(nil)
+			pack.Message.SetHostname("web1")
+			pack.Message.SetSeverity(2)
+			pack.Message.SetPayload(payload)
+			if channel != "" {
+				message.NewStringField(pack.Message, "channel", channel)
+			}
+			message.NewInt64Field(pack.Message, "status", 500, "")
+			pack.QueueCursor = queueCursor
+			return pack
+		}
+
+		c.Specify("posts templated alerts to the channel's webhook", func() {
+			config.Title = "Alert from %Hostname%"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("disk full", "#db", "c1")), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("cpu hot", "", "c2")), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c2")
+			p := received()
+			c.Expect(len(p), gs.Equals, 2)
+			c.Expect(p[0].path, gs.Equals, "/hooks/db")
+			c.Expect(p[0].body["text"], gs.Equals, "*Alert from web1*\nweb1: disk full (500)")
+			c.Expect(p[1].path, gs.Equals, "/hooks/default")
+		})
+
+		c.Specify("throttles repeated alerts", func() {
+			config.DedupKey = "%Hostname%"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("one", "", "c1")), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("two", "", "c2")), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("three", "", "c3")), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c3")
+			c.Expect(len(received()), gs.Equals, 1)
+			c.Expect(output.alertsThrottled, gs.Equals, int64(2))
+
+			// Once the throttle period's over the count of repeats is posted.
+			for _, state := range output.alerts {
+				state.lastPosted = state.lastPosted.Add(-time.Hour)
+			}
+			c.Expect(output.ProcessMessage(newPack("four", "", "c4")), gs.IsNil)
+			p := received()
+			c.Expect(len(p), gs.Equals, 2)
+			c.Expect(p[1].body["text"], gs.Equals,
+				"web1: four (500)\n(2 similar alerts suppressed)")
+		})
+
+		c.Specify("threads repeats with a Slack token", func() {
+			config.Token = "xoxb-secret"
+			config.ApiUrl = server.URL + "/api"
+			config.Channel = "#alerts"
+			config.DedupKey = "%Hostname%"
+			config.Throttle = 0
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("one", "", "c1")), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("two", "", "c2")), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("three", "#db", "c3")), gs.IsNil)
+			p := received()
+			c.Expect(len(p), gs.Equals, 3)
+			c.Expect(p[0].auth, gs.Equals, "Bearer xoxb-secret")
+			c.Expect(p[0].body["channel"], gs.Equals, "#alerts")
+			c.Expect(p[0].body["thread_ts"], gs.Equals, nil)
+			c.Expect(p[1].body["thread_ts"], gs.Equals, "1500000000.000001")
+			c.Expect(p[2].body["channel"], gs.Equals, "#db")
+			c.Expect(p[2].body["thread_ts"], gs.Equals, nil)
+		})
+
+		c.Specify("posts Teams message cards", func() {
+			config.Service = "teams"
+			config.Title = "%Hostname%"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("disk full", "", "c1")), gs.IsNil)
+			body := received()[0].body
+			c.Expect(body["@type"], gs.Equals, "MessageCard")
+			c.Expect(body["title"], gs.Equals, "web1")
+			c.Expect(body["text"], gs.Equals, "web1: disk full (500)")
+		})
+
+		c.Specify("posts generic JSON", func() {
+			config.Service = "generic"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("disk full", "#db", "c1")), gs.IsNil)
+			body := received()[0].body
+			c.Expect(body["channel"], gs.Equals, "#db")
+			c.Expect(body["dedup_key"], gs.Equals, "web1: disk full (500)")
+			c.Expect(body["severity"], gs.Equals, float64(2))
+		})
+
+		c.Specify("retries alerts it can't post", func() {
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			lock.Lock()
+			status = http.StatusBadGateway
+			lock.Unlock()
+			err := output.ProcessMessage(newPack("one", "", "c1"))
+			_, ok := err.(RetryMessageError)
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(cursor, gs.Equals, "")
+			// A failed post doesn't count towards the throttle.
+			lock.Lock()
+			status = http.StatusOK
+			lock.Unlock()
+			c.Expect(output.ProcessMessage(newPack("one", "", "c1")), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+
+			lock.Lock()
+			status = http.StatusNotFound
+			lock.Unlock()
+			err = output.ProcessMessage(newPack("two", "", "c2"))
+			_, ok = err.(RetryMessageError)
+			c.Expect(ok, gs.IsFalse)
+			c.Expect(cursor, gs.Equals, "c2")
+		})
+
+		c.Specify("checks its settings", func() {
+			config.Service = "irc"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.Service = "teams"
+			config.Token = "xoxb"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.Service = "slack"
+			config.Token = ""
+			config.WebhookUrl = ""
+			config.Webhooks = nil
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,187 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+
+	"github.com/gogo/protobuf/proto"
+)
+
+type ChunkReassemblyDecoderConfig struct {
+	// How long to wait for the rest of a message's chunks once the first one
+	// has arrived. Defaults to "1m".
+	Timeout string `toml:"timeout"`
+	// Most messages that can be waiting on chunks at once, beyond which the
+	// oldest is given up on. Defaults to 1000.
+	MaxPending int `toml:"max_pending"`
+	// Most chunks a message can be split into. Chunks claiming more are
+	// rejected, rather than setting aside room for that many. Defaults to
+	// 1000.
+	MaxChunks int `toml:"max_chunks"`
+}
+
+// The chunks of a message received so far.
+type chunkSet struct {
+	chunks   []*message.Message
+	received int
+	started  time.Time
+}
+
+// Decodes protobuf encoded Heka messages like a ProtobufDecoder, and puts
+// the chunks of messages split up by an input or decoder's "chunk"
+// oversize_policy back together, delivering each message once all of its
+// chunks have arrived.
+type ChunkReassemblyDecoder struct {
+	timeout    time.Duration
+	maxPending int
+	maxChunks  int
+	lock       sync.Mutex
+	pending    map[string]*chunkSet
+	// Ids of the pending messages, oldest first.
+	order        []string
+	joinedCount  int64
+	expiredCount int64
+	now          func() time.Time
+}
+
+func (cd *ChunkReassemblyDecoder) ConfigStruct() interface{} {
+	return &ChunkReassemblyDecoderConfig{
+		Timeout:    "1m",
+		MaxPending: 1000,
+		MaxChunks:  1000,
+	}
+}
+
+func (cd *ChunkReassemblyDecoder) Init(config interface{}) (err error) {
+	conf := config.(*ChunkReassemblyDecoderConfig)
+	if cd.timeout, err = time.ParseDuration(conf.Timeout); err != nil {
+		return fmt.Errorf("can't parse timeout: %s", err)
+	}
+	if conf.MaxPending < 1 {
+		return fmt.Errorf("max_pending must be at least 1")
+	}
+	if conf.MaxChunks < 1 {
+		return fmt.Errorf("max_chunks must be at least 1")
+	}
+	cd.maxPending = conf.MaxPending
+	cd.maxChunks = conf.MaxChunks
+	cd.pending = make(map[string]*chunkSet)
+	if cd.now == nil {
+		cd.now = time.Now
+	}
+	return
+}
+
+func (cd *ChunkReassemblyDecoder) Decode(pack *PipelinePack) (
+	packs []*PipelinePack, err error) {
+
+	if err = proto.Unmarshal(pack.MsgBytes, pack.Message); err != nil {
+		return nil, err
+	}
+	pack.TrustMsgBytes = true
+	id, seq, total, ok := message.ChunkInfo(pack.Message)
+	if !ok {
+		return []*PipelinePack{pack}, nil
+	}
+	if total > cd.maxChunks {
+		return nil, fmt.Errorf("chunk %d of '%s' claims %d chunks, more than "+
+			"max_chunks (%d)", seq, id, total, cd.maxChunks)
+	}
+
+	cd.lock.Lock()
+	defer cd.lock.Unlock()
+	now := cd.now()
+	cd.expire(now)
+	set, ok := cd.pending[id]
+	if !ok {
+		if len(cd.order) >= cd.maxPending {
+			cd.drop(cd.order[0])
+			cd.expiredCount++
+		}
+		set = &chunkSet{chunks: make([]*message.Message, total), started: now}
+		cd.pending[id] = set
+		cd.order = append(cd.order, id)
+	}
+	if total != len(set.chunks) {
+		return nil, fmt.Errorf("chunk %d of '%s' claims %d chunks, expected %d",
+			seq, id, total, len(set.chunks))
+	}
+	if set.chunks[seq] == nil {
+		set.received++
+	}
+	set.chunks[seq] = pack.Message
+	if set.received < total {
+		// The pack is recycled, its message is kept.
+		pack.Message = new(message.Message)
+		return nil, nil
+	}
+
+	cd.drop(id)
+	msg, err := message.JoinChunks(set.chunks)
+	if err != nil {
+		return nil, fmt.Errorf("joining chunks of '%s': %s", id, err)
+	}
+	cd.joinedCount++
+	pack.Message = msg
+	pack.TrustMsgBytes = false
+	return []*PipelinePack{pack}, nil
+}
+
+// Gives up on the messages whose chunks haven't all arrived in time.
+func (cd *ChunkReassemblyDecoder) expire(now time.Time) {
+	for len(cd.order) > 0 {
+		set := cd.pending[cd.order[0]]
+		if now.Sub(set.started) < cd.timeout {
+			return
+		}
+		cd.drop(cd.order[0])
+		cd.expiredCount++
+	}
+}
+
+func (cd *ChunkReassemblyDecoder) drop(id string) {
+	delete(cd.pending, id)
+	for i, pendingId := range cd.order {
+		if pendingId == id {
+			cd.order = append(cd.order[:i], cd.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (cd *ChunkReassemblyDecoder) EncodesMsgBytes() bool {
+	return true
+}
+
+func (cd *ChunkReassemblyDecoder) ReportMsg(msg *message.Message) error {
+	cd.lock.Lock()
+	defer cd.lock.Unlock()
+	message.NewIntField(msg, "PendingMessages", len(cd.pending), "count")
+	message.NewInt64Field(msg, "JoinedMessages", cd.joinedCount, "count")
+	message.NewInt64Field(msg, "ExpiredMessages", cd.expiredCount, "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("ChunkReassemblyDecoder", func() interface{} {
+		return new(ChunkReassemblyDecoder)
+	})
+}
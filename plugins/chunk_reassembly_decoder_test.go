@@ -0,0 +1,97 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"strings"
+	"time"
+
+	"heka/message"
+	"heka/pipeline"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pborman/uuid"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func ChunkReassemblyDecoderSpec(c gs.Context) {
+
+	c.Specify("A ChunkReassemblyDecoder", func() {
+		decoder := new(ChunkReassemblyDecoder)
+		now := time.Now()
+		decoder.now = func() time.Time { return now }
+		config := decoder.ConfigStruct().(*ChunkReassemblyDecoderConfig)
+		c.Assume(decoder.Init(config), gs.IsNil)
+
+		msg := &message.Message{}
+		msg.SetUuid(uuid.NewRandom())
+		msg.SetType("stacktrace")
+		msg.SetPayload(strings.Repeat("at frame\n", 300))
+		chunks, err := message.ChunkMessage(msg, 1024)
+		c.Assume(err, gs.IsNil)
+		c.Assume(len(chunks) > 2, gs.IsTrue)
+
+		decode := func(m *message.Message) ([]*pipeline.PipelinePack, error) {
+			pack := pipeline.NewPipelinePack(nil)
+			pack.MsgBytes, err = proto.Marshal(m)
+			c.Assume(err, gs.IsNil)
+			return decoder.Decode(pack)
+		}
+
+		c.Specify("passes plain messages through", func() {
+			packs, err := decode(msg)
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(packs), gs.Equals, 1)
+			c.Expect(packs[0].Message.Equals(msg), gs.IsTrue)
+		})
+
+		c.Specify("delivers a message once all of its chunks arrive", func() {
+			// Out of order.
+			chunks[0], chunks[1] = chunks[1], chunks[0]
+			for _, chunk := range chunks[:len(chunks)-1] {
+				packs, err := decode(chunk)
+				c.Expect(err, gs.IsNil)
+				c.Expect(len(packs), gs.Equals, 0)
+			}
+			packs, err := decode(chunks[len(chunks)-1])
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(packs), gs.Equals, 1)
+			c.Expect(packs[0].Message.Equals(msg), gs.IsTrue)
+			c.Expect(packs[0].TrustMsgBytes, gs.IsFalse)
+			c.Expect(len(decoder.pending), gs.Equals, 0)
+		})
+
+		c.Specify("rejects chunks claiming more than max_chunks", func() {
+			decoder.maxChunks = len(chunks) - 1
+			packs, err := decode(chunks[0])
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(len(packs), gs.Equals, 0)
+			c.Expect(len(decoder.pending), gs.Equals, 0)
+		})
+
+		c.Specify("gives up on incomplete messages", func() {
+			decode(chunks[0])
+			c.Expect(len(decoder.pending), gs.Equals, 1)
+			now = now.Add(2 * time.Minute)
+			decode(chunks[1])
+			c.Expect(decoder.expiredCount, gs.Equals, int64(1))
+			// The late chunk starts over rather than completing the message.
+			for _, chunk := range chunks[2:] {
+				packs, _ := decode(chunk)
+				c.Expect(len(packs), gs.Equals, 0)
+			}
+		})
+	})
+}
@@ -0,0 +1,192 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Leading bytes identifying compressed data, for auto-detection.
+var (
+	gzipMagic   = []byte{0x1f, 0x8b}
+	zstdMagic   = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+)
+
+// Guesses the codec data was compressed with from its leading bytes. Snappy
+// is only recognized in its framed format, since the block format has no
+// magic bytes.
+func detectCodec(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(data, zstdMagic):
+		return "zstd"
+	case bytes.HasPrefix(data, snappyMagic):
+		return "snappy"
+	case len(data) >= 2 && data[0] == 0x78:
+		// A zlib header for deflate with the default window, whose second
+		// byte is the compression level and a checksum.
+		switch data[1] {
+		case 0x01, 0x5e, 0x9c, 0xda:
+			return "zlib"
+		}
+	}
+	return ""
+}
+
+// Compresses byte slices with one codec. Safe for concurrent use.
+type compressor struct {
+	codec string
+	lock  sync.Mutex
+	buf   bytes.Buffer
+	// gzip and zlib writers are reused, guarded by lock.
+	gzipWriter *gzip.Writer
+	zlibWriter *zlib.Writer
+	zstdWriter *zstd.Encoder
+}
+
+// Creates a compressor for "gzip", "zlib", "snappy" or "zstd" data. A level
+// of zero means the codec's default, snappy has no levels.
+func newCompressor(codec string, level int) (c *compressor, err error) {
+	c = &compressor{codec: codec}
+	switch codec {
+	case "gzip", "zlib":
+		if level == 0 {
+			level = 6
+		}
+		if level < gzip.BestSpeed || level > gzip.BestCompression {
+			return nil, fmt.Errorf("%s compression_level must be between %d and %d",
+				codec, gzip.BestSpeed, gzip.BestCompression)
+		}
+		if codec == "gzip" {
+			c.gzipWriter, err = gzip.NewWriterLevel(&c.buf, level)
+		} else {
+			c.zlibWriter, err = zlib.NewWriterLevel(&c.buf, level)
+		}
+	case "snappy":
+	case "zstd":
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		c.zstdWriter, err = zstd.NewWriter(nil, opts...)
+	default:
+		return nil, fmt.Errorf("unknown codec '%s'", codec)
+	}
+	return
+}
+
+func (c *compressor) compress(input []byte) ([]byte, error) {
+	switch c.codec {
+	case "snappy":
+		return snappy.Encode(nil, input), nil
+	case "zstd":
+		return c.zstdWriter.EncodeAll(input, nil), nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.buf.Reset()
+	var w io.WriteCloser
+	if c.gzipWriter != nil {
+		c.gzipWriter.Reset(&c.buf)
+		w = c.gzipWriter
+	} else {
+		c.zlibWriter.Reset(&c.buf)
+		w = c.zlibWriter
+	}
+	if _, err := w.Write(input); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	output := make([]byte, c.buf.Len())
+	copy(output, c.buf.Bytes())
+	return output, nil
+}
+
+// Decompresses byte slices, refusing to produce more than maxSize bytes so
+// that a small malicious input can't exhaust memory. Safe for concurrent use.
+type decompressor struct {
+	maxSize    int
+	zstdReader *zstd.Decoder
+}
+
+func newDecompressor(maxSize int) (*decompressor, error) {
+	zstdReader, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderMaxMemory(uint64(maxSize)))
+	if err != nil {
+		return nil, err
+	}
+	return &decompressor{maxSize: maxSize, zstdReader: zstdReader}, nil
+}
+
+func (d *decompressor) decompress(codec string, input []byte) ([]byte, error) {
+	var r io.Reader
+	switch codec {
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(input))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	case "zlib":
+		zr, err := zlib.NewReader(bytes.NewReader(input))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case "snappy":
+		if !bytes.HasPrefix(input, snappyMagic) {
+			n, err := snappy.DecodedLen(input)
+			if err != nil {
+				return nil, err
+			}
+			if n > d.maxSize {
+				return nil, fmt.Errorf("decompressed size %d exceeds %d", n, d.maxSize)
+			}
+			return snappy.Decode(nil, input)
+		}
+		r = snappy.NewReader(bytes.NewReader(input))
+	case "zstd":
+		output, err := d.zstdReader.DecodeAll(input, nil)
+		if err == nil && len(output) > d.maxSize {
+			err = fmt.Errorf("decompressed size exceeds %d", d.maxSize)
+		}
+		return output, err
+	default:
+		return nil, fmt.Errorf("unknown codec '%s'", codec)
+	}
+	output, err := ioutil.ReadAll(io.LimitReader(r, int64(d.maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(output) > d.maxSize {
+		return nil, fmt.Errorf("decompressed size exceeds %d", d.maxSize)
+	}
+	return output, nil
+}
@@ -0,0 +1,70 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"heka/pipeline"
+)
+
+// Compresses the bytes produced by the previous encoder in an output's
+// encoder_chain, or the protobuf encoded message when used on its own, with
+// gzip, zlib, snappy or zstd.
+type CompressionEncoder struct {
+	compressor *compressor
+}
+
+var compressionContentTypes = map[string]string{
+	"gzip":   "application/gzip",
+	"zlib":   "application/zlib",
+	"snappy": "application/x-snappy-framed",
+	"zstd":   "application/zstd",
+}
+
+type CompressionEncoderConfig struct {
+	// One of "gzip", "zlib", "snappy" or "zstd", defaults to "gzip".
+	Codec string `toml:"codec"`
+	// Codec specific, zero for the codec's default.
+	CompressionLevel int `toml:"compression_level"`
+}
+
+func (ce *CompressionEncoder) ConfigStruct() interface{} {
+	return &CompressionEncoderConfig{
+		Codec: "gzip",
+	}
+}
+
+func (ce *CompressionEncoder) Init(config interface{}) (err error) {
+	conf := config.(*CompressionEncoderConfig)
+	ce.compressor, err = newCompressor(conf.Codec, conf.CompressionLevel)
+	return
+}
+
+func (ce *CompressionEncoder) ContentType() string {
+	return compressionContentTypes[ce.compressor.codec]
+}
+
+func (ce *CompressionEncoder) Encode(pack *pipeline.PipelinePack) (output []byte, err error) {
+	return ce.EncodeBytes(pack.MsgBytes)
+}
+
+func (ce *CompressionEncoder) EncodeBytes(input []byte) (output []byte, err error) {
+	return ce.compressor.compress(input)
+}
+
+func init() {
+	pipeline.RegisterPlugin("CompressionEncoder", func() interface{} {
+		return new(CompressionEncoder)
+	})
+}
@@ -0,0 +1,69 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"strings"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func CompressionEncoderSpec(c gs.Context) {
+
+	c.Specify("A CompressionEncoder", func() {
+		encoder := new(CompressionEncoder)
+		config := encoder.ConfigStruct().(*CompressionEncoderConfig)
+		input := []byte(strings.Repeat("compress me ", 100))
+		decompressor, err := newDecompressor(1 << 20)
+		c.Assume(err, gs.IsNil)
+
+		for _, codec := range []string{"gzip", "zlib", "snappy", "zstd"} {
+			codec := codec
+			c.Specify("round trips "+codec, func() {
+				config.Codec = codec
+				c.Assume(encoder.Init(config), gs.IsNil)
+				output, err := encoder.EncodeBytes(input)
+				c.Expect(err, gs.IsNil)
+				c.Expect(len(output) < len(input), gs.IsTrue)
+				if codec != "snappy" {
+					// Snappy blocks can't be detected.
+					c.Expect(detectCodec(output), gs.Equals, codec)
+				}
+				decompressed, err := decompressor.decompress(codec, output)
+				c.Expect(err, gs.IsNil)
+				c.Expect(string(decompressed), gs.Equals, string(input))
+			})
+		}
+
+		c.Specify("honors compression_level", func() {
+			config.Codec = "zstd"
+			config.CompressionLevel = 19
+			c.Assume(encoder.Init(config), gs.IsNil)
+			output, err := encoder.EncodeBytes(input)
+			c.Expect(err, gs.IsNil)
+			decompressed, err := decompressor.decompress("zstd", output)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(decompressed), gs.Equals, string(input))
+		})
+
+		c.Specify("rejects bad settings", func() {
+			config.Codec = "lzma"
+			c.Expect(encoder.Init(config), gs.Not(gs.IsNil))
+			config.Codec = "zlib"
+			config.CompressionLevel = 12
+			c.Expect(encoder.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
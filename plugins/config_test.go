@@ -331,6 +331,10 @@ DashboardOutput:
 ====Encoders====
 NONE
 
+
+====Processors====
+NONE
+
 ========
 `
 
@@ -0,0 +1,256 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A parsed cron expression.
+type CronSchedule interface {
+	// Next returns the first scheduled time after t, or the zero time if
+	// there isn't one within the next five years.
+	Next(t time.Time) time.Time
+}
+
+// Runs at a fixed interval, from "@every <duration>", at multiples of the
+// interval since the Unix epoch.
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	d := time.Duration(e)
+	return t.Truncate(d).Add(d)
+}
+
+// Matches against a bit set of allowed values for each field.
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	loc                                   *time.Location
+}
+
+type cronField struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	cronSeconds = cronField{0, 59, nil}
+	cronMinutes = cronField{0, 59, nil}
+	cronHours   = cronField{0, 23, nil}
+	cronDoms    = cronField{1, 31, nil}
+	cronMonths  = cronField{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Sunday may be given as 0 or 7.
+	cronDows = cronField{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// Set in a field's bits when it was given as "*" or "?", for working out
+// whether day of month or day of week restricts the schedule.
+const cronStar = 1 << 63
+
+// ParseCronSchedule parses a cron expression of five fields (minute, hour,
+// day of month, month, day of week) or six with a leading seconds field, or
+// one of the descriptors @yearly, @monthly, @weekly, @daily, @hourly, or
+// "@every <duration>". Fields are matched in the given location.
+func ParseCronSchedule(spec string, loc *time.Location) (CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("can't parse '%s': %s", spec, err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("'%s' is more often than once a second", spec)
+		}
+		return everySchedule(d), nil
+	}
+	if strings.HasPrefix(spec, "@") {
+		expanded, ok := cronDescriptors[spec]
+		if !ok {
+			return nil, fmt.Errorf("unknown schedule descriptor '%s'", spec)
+		}
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("'%s' should have 5 or 6 fields, has %d", spec,
+			len(fields))
+	}
+	s := &cronSchedule{loc: loc}
+	var err error
+	for i, target := range []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&s.second, cronSeconds}, {&s.minute, cronMinutes}, {&s.hour, cronHours},
+		{&s.dom, cronDoms}, {&s.month, cronMonths}, {&s.dow, cronDows},
+	} {
+		if *target.bits, err = parseCronField(fields[i], target.field); err != nil {
+			return nil, fmt.Errorf("can't parse '%s': %s", spec, err)
+		}
+	}
+	// Fold Sunday as 7 into 0.
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// Parses a comma separated list of values, ranges, and steps.
+func parseCronField(expr string, field cronField) (bits uint64, err error) {
+	for _, part := range strings.Split(expr, ",") {
+		var step uint = 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || n == 0 {
+				return 0, fmt.Errorf("bad step in '%s'", part)
+			}
+			step, part = uint(n), part[:i]
+		}
+		var lo, hi uint
+		switch {
+		case part == "*" || part == "?":
+			lo, hi = field.min, field.max
+			if step == 1 {
+				bits |= cronStar
+			}
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			if lo, err = parseCronValue(bounds[0], field); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(bounds[1], field); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("range '%s' is backwards", part)
+			}
+		default:
+			if lo, err = parseCronValue(part, field); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if step > 1 {
+				// "n/step" runs from n to the end of the field's range.
+				hi = field.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(s string, field cronField) (uint, error) {
+	if v, ok := field.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("bad value '%s'", s)
+	}
+	if uint(n) < field.min || uint(n) > field.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", n, field.min, field.max)
+	}
+	return uint(n), nil
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	orig := t.Location()
+	t = t.In(s.loc).Truncate(time.Second).Add(time.Second)
+	yearLimit := t.Year() + 5
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+	for s.month&(1<<uint(t.Month())) == 0 {
+		t = s.after(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc))
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+	for !s.dayMatches(t) {
+		t = s.after(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc))
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		// Stepping by the clock rather than with time.Date, which can land
+		// back where it started across a daylight saving change.
+		t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute -
+			time.Duration(t.Second())*time.Second)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+	for s.second&(1<<uint(t.Second())) == 0 {
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+	return t.In(orig)
+}
+
+// Returns the candidate, or if a daylight saving change has put it at or
+// before t the first hour after it.
+func (s *cronSchedule) after(t, candidate time.Time) time.Time {
+	for !candidate.After(t) {
+		candidate = candidate.Add(time.Hour)
+	}
+	return candidate
+}
+
+// As in cron, if both day of month and day of week are restricted a day
+// matching either will do.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.dom&cronStar != 0 || s.dow&cronStar != 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,103 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func CronSpec(c gs.Context) {
+	// Returns the first scheduled time after the given one, all in UTC.
+	next := func(spec, after string) string {
+		s, err := ParseCronSchedule(spec, time.UTC)
+		c.Assume(err, gs.IsNil)
+		t, err := time.Parse(time.RFC3339, after)
+		c.Assume(err, gs.IsNil)
+		return s.Next(t).Format(time.RFC3339)
+	}
+
+	c.Specify("A cron schedule", func() {
+		c.Specify("fires on each matching minute", func() {
+			c.Expect(next("*/15 * * * *", "2015-03-01T10:07:30Z"), gs.Equals,
+				"2015-03-01T10:15:00Z")
+			c.Expect(next("*/15 * * * *", "2015-03-01T10:45:00Z"), gs.Equals,
+				"2015-03-01T11:00:00Z")
+		})
+
+		c.Specify("supports a seconds field", func() {
+			c.Expect(next("30 * * * * *", "2015-03-01T10:07:30Z"), gs.Equals,
+				"2015-03-01T10:08:30Z")
+		})
+
+		c.Specify("rolls over into the next year", func() {
+			c.Expect(next("0 9 1 jan *", "2015-03-01T00:00:00Z"), gs.Equals,
+				"2016-01-01T09:00:00Z")
+		})
+
+		c.Specify("matches either restricted day field", func() {
+			// 2015-03-02 is a Monday, the 13th a Friday.
+			c.Expect(next("0 0 13 * fri", "2015-03-01T00:00:00Z"), gs.Equals,
+				"2015-03-06T00:00:00Z")
+			c.Expect(next("0 0 13 * *", "2015-03-01T00:00:00Z"), gs.Equals,
+				"2015-03-13T00:00:00Z")
+			c.Expect(next("0 0 * * 1-5", "2015-02-28T12:00:00Z"), gs.Equals,
+				"2015-03-02T00:00:00Z")
+		})
+
+		c.Specify("treats Sunday as 0 or 7", func() {
+			c.Expect(next("0 0 * * 7", "2015-03-02T00:00:00Z"), gs.Equals,
+				"2015-03-08T00:00:00Z")
+		})
+
+		c.Specify("expands descriptors", func() {
+			c.Expect(next("@daily", "2015-03-01T10:07:30Z"), gs.Equals,
+				"2015-03-02T00:00:00Z")
+			c.Expect(next("@every 5m", "2015-03-01T10:07:30Z"), gs.Equals,
+				"2015-03-01T10:10:00Z")
+		})
+
+		c.Specify("never fires on an impossible date", func() {
+			s, err := ParseCronSchedule("0 0 30 feb *", time.UTC)
+			c.Assume(err, gs.IsNil)
+			c.Expect(s.Next(time.Now()).IsZero(), gs.IsTrue)
+		})
+
+		c.Specify("matches in its time zone", func() {
+			loc, err := time.LoadLocation("America/New_York")
+			c.Assume(err, gs.IsNil)
+			s, err := ParseCronSchedule("0 9 * * *", loc)
+			c.Assume(err, gs.IsNil)
+			// Before and after the switch to daylight saving time.
+			t, _ := time.Parse(time.RFC3339, "2015-03-07T15:00:00Z")
+			t = s.Next(t)
+			c.Expect(t.UTC().Format(time.RFC3339), gs.Equals, "2015-03-08T13:00:00Z")
+			c.Expect(s.Next(t).UTC().Format(time.RFC3339), gs.Equals,
+				"2015-03-09T13:00:00Z")
+			t, _ = time.Parse(time.RFC3339, "2015-03-06T15:00:00Z")
+			c.Expect(s.Next(t).UTC().Format(time.RFC3339), gs.Equals,
+				"2015-03-07T14:00:00Z")
+		})
+
+		c.Specify("rejects bad expressions", func() {
+			for _, spec := range []string{"* * * *", "60 * * * *", "* * * 13 *",
+				"5-1 * * * *", "*/0 * * * *", "@fortnightly", "@every 1ms"} {
+				_, err := ParseCronSchedule(spec, time.UTC)
+				c.Expect(err, gs.Not(gs.IsNil))
+			}
+		})
+	})
+}
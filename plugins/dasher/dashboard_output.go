@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"mime"
+	"net"
 	"net/http"
 	"os"
 	"path"
@@ -33,6 +34,7 @@ import (
 	"heka/message"
 	. "heka/pipeline"
 	httpPlugin "heka/plugins/http"
+	"heka/plugins/tcp"
 )
 
 //go:embed ui/*
@@ -59,6 +61,13 @@ type DashboardOutputConfig struct {
 	MessageMatcher string
 	// Custom http headers
 	Headers http.Header
+	// Authentication required of HTTP clients, defaults to none.
+	Auth httpPlugin.HttpAuthConfig `toml:"auth"`
+	// Set to true if the HTTP interface should be served over TLS. Requires
+	// additional Tls config section.
+	UseTls bool `toml:"use_tls"`
+	// Subsection for TLS configuration.
+	Tls tcp.TlsConfig
 }
 
 func (self *DashboardOutput) ConfigStruct() interface{} {
@@ -67,7 +76,8 @@ func (self *DashboardOutput) ConfigStruct() interface{} {
 		StaticDirectory:  "ui",
 		WorkingDirectory: "dashboard",
 		TickerInterval:   uint(5),
-		MessageMatcher:   "Type == 'heka.all-report' || Type == 'heka.sandbox-terminated' || Type == 'heka.sandbox-output'",
+		MessageMatcher:   "Type == 'heka.all-report' || Type == 'heka.cluster-report' || Type == 'heka.sandbox-terminated' || Type == 'heka.sandbox-output'",
+		Tls:              tcp.TlsConfig{PreferServerCiphers: true},
 	}
 }
 
@@ -78,6 +88,7 @@ type DashboardOutput struct {
 	dataDirectory    string
 	server           *http.Server
 	handler          http.Handler
+	tlsConf          *tcp.TlsConfig
 	pConfig          *PipelineConfig
 	starterFunc      func(output *DashboardOutput) error
 }
@@ -198,9 +209,19 @@ func (self *DashboardOutput) Init(config interface{}) (err error) {
 	if self.handler == nil {
 		self.handler = self
 	}
+	auth, err := httpPlugin.NewHttpAuthenticator(&conf.Auth)
+	if err != nil {
+		return fmt.Errorf("DashboardOutput: %s", err)
+	}
+	if err = conf.Auth.CheckListener(conf.UseTls, &conf.Tls); err != nil {
+		return fmt.Errorf("DashboardOutput: %s", err)
+	}
+	if conf.UseTls {
+		self.tlsConf = &conf.Tls
+	}
 	self.server = &http.Server{
 		Addr:         conf.Address,
-		Handler:      httpPlugin.CustomHeadersHandler(self.handler, conf.Headers),
+		Handler:      httpPlugin.CustomHeadersHandler(auth.Handler(self.handler), conf.Headers),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
@@ -241,6 +262,9 @@ func (self *DashboardOutput) Run(or OutputRunner, h PluginHelper) (err error) {
 						self.dataDirectory, err))
 				}
 				sbxsLock.Unlock()
+			case "heka.cluster-report":
+				fn := filepath.Join(self.dataDirectory, "heka_cluster_report.json")
+				overwriteFile(fn, msg.GetPayload())
 			case "heka.sandbox-output":
 				tmp, _ := msg.GetFieldValue("payload_type")
 				if payloadType, ok := tmp.(string); ok {
@@ -341,7 +365,17 @@ func (self *DashboardOutput) Run(or OutputRunner, h PluginHelper) (err error) {
 }
 
 func defaultStarter(output *DashboardOutput) error {
-	return output.server.ListenAndServe()
+	if output.tlsConf == nil {
+		return output.server.ListenAndServe()
+	}
+	listener, err := net.Listen("tcp", output.server.Addr)
+	if err != nil {
+		return err
+	}
+	if listener, err = tcp.NewTlsListener(listener, output.tlsConf); err != nil {
+		return err
+	}
+	return output.server.Serve(listener)
 }
 
 func overwriteFile(filename, s string) (err error) {
@@ -27,6 +27,7 @@ import (
 	"heka/pipeline"
 	pipeline_ts "heka/pipeline/testsupport"
 	"heka/pipelinemock"
+	httpPlugin "heka/plugins/http"
 	plugins_ts "heka/plugins/testsupport"
 	"github.com/rafrombrc/gomock/gomock"
 	gs "github.com/rafrombrc/gospec/src/gospec"
@@ -133,6 +134,32 @@ func DashboardOutputSpec(c gs.Context) {
 					c.Expect(eq, gs.IsTrue)
 				})
 
+				c.Specify("requires authentication when configured", func() {
+					config.Auth.Type = "basic"
+					config.Auth.Users = map[string]httpPlugin.HttpAuthUser{
+						"viewer": {Password: "viewpass"},
+					}
+					err = dashboardOutput.Init(config)
+					c.Assume(err, gs.IsNil)
+					ts.Config = dashboardOutput.server
+
+					startOutput()
+
+					inChan <- pack
+					<-startedChan
+					resp, err := http.Get(ts.URL)
+					c.Assume(err, gs.IsNil)
+					resp.Body.Close()
+					c.Expect(resp.StatusCode, gs.Equals, 401)
+
+					req, _ := http.NewRequest("GET", ts.URL, nil)
+					req.SetBasicAuth("viewer", "viewpass")
+					resp, err = http.DefaultClient.Do(req)
+					c.Assume(err, gs.IsNil)
+					resp.Body.Close()
+					c.Expect(resp.StatusCode, gs.Equals, 200)
+				})
+
 				close(inChan)
 				c.Expect(<-errChan, gs.IsNil)
 
@@ -0,0 +1,50 @@
+define(
+  [
+    "underscore",
+    "backbone",
+    "adapters/base_adapter"
+  ],
+  function(_, Backbone, BaseAdapter) {
+    "use strict";
+
+    /**
+    * Adapter for retrieving the gossip mesh cluster report.
+    *
+    * Consumes `/data/heka_cluster_report.json`.
+    *
+    * @class ClusterReportAdapter
+    * @extends BaseAdapter
+    *
+    * @constructor
+    */
+    var ClusterReportAdapter = function() {
+      /**
+      * Mesh member collection to be filled by the adapter.
+      *
+      * @property {Backbone.Collection} membersCollection
+      */
+      this.membersCollection = new Backbone.Collection();
+    };
+
+    _.extend(ClusterReportAdapter.prototype, new BaseAdapter(), {
+      /**
+      * Fills membersCollection with data fetched from the server.
+      *
+      * @method fill
+      */
+      fill: function() {
+        this.fetch("data/heka_cluster_report.json", function(response) {
+          var members = _.map(response.Members || [], function(member) {
+            return _.extend({ Local: member.Name === response.Node }, member);
+          });
+
+          this.membersCollection.set(members);
+        }.bind(this));
+
+        this.pollForUpdates(5000);
+      }
+    });
+
+    return ClusterReportAdapter;
+  }
+);
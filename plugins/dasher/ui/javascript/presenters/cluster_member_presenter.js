@@ -0,0 +1,86 @@
+define(
+  [
+    "underscore",
+    "moment"
+  ],
+  function(_, moment) {
+    "use strict";
+
+    /**
+    * Presents a gossip mesh member from the cluster report for use in a view.
+    *
+    * @class ClusterMemberPresenter
+    *
+    * @constructor
+    *
+    * @param {Backbone.Model} member Member to be presented
+    */
+    var ClusterMemberPresenter = function (member) {
+      _.extend(this, member.attributes);
+    };
+
+    _.extend(ClusterMemberPresenter.prototype, {
+      /**
+      * Format how long the member's hekad has been running.
+      *
+      * @method uptime
+      * @return {String} Uptime e.g. 3 days
+      */
+      uptime: function() {
+        if (!this.StartTime) {
+          return "";
+        }
+
+        return moment(this.StartTime / 1e6).fromNow(true);
+      },
+
+      /**
+      * Format the router's message rate.
+      *
+      * @method messageRate
+      * @return {String} Rate e.g. 1520.3/s
+      */
+      messageRate: function() {
+        return (this.ProcessMessageRate || 0).toFixed(1) + "/s";
+      },
+
+      /**
+      * Format the free input pool packs.
+      *
+      * @method inputPool
+      * @return {String} Free packs out of the pool size e.g. 97 / 100
+      */
+      inputPool: function() {
+        return this.InputPoolFree + " / " + this.PoolSize;
+      },
+
+      /**
+      * Format the heap in use.
+      *
+      * @method heap
+      * @return {String} Heap in megabytes e.g. 12.5 MB
+      */
+      heap: function() {
+        return ((this.HeapAlloc || 0) / 1048576).toFixed(1) + " MB";
+      },
+
+      /**
+      * CSS class for the member's row, highlighting members in trouble.
+      *
+      * @method stateClass
+      * @return {String} Bootstrap table row class
+      */
+      stateClass: function() {
+        if (this.State === "left") {
+          return "danger";
+        } else if (this.State === "suspect") {
+          return "warning";
+        }
+
+        return "";
+      }
+    });
+
+    return ClusterMemberPresenter;
+  }
+);
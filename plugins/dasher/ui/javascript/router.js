@@ -9,9 +9,10 @@ define(
     "views/sandboxes/sandbox_output_cbuf_show",
     "views/sandboxes/sandbox_output_txt_show",
     "views/health/plugins_show",
-    "views/termination_report/termination_report_index"
+    "views/termination_report/termination_report_index",
+    "views/cluster_report/cluster_report_index"
   ],
-  function($, Backbone, PluginsAdapter, SandboxesAdapter, HealthIndex, SandboxesIndex, SandboxOutputCbufShow, SandboxOutputTxtShow, PluginsShow, TerminationReportIndex) {
+  function($, Backbone, PluginsAdapter, SandboxesAdapter, HealthIndex, SandboxesIndex, SandboxOutputCbufShow, SandboxOutputTxtShow, PluginsShow, TerminationReportIndex, ClusterReportIndex) {
     "use strict";
 
     /**
@@ -34,6 +35,8 @@ define(
     *
     * - `/#termination_report`
     *
+    * - `/#cluster`
+    *
     * @class Router
     *
     * @constructor
@@ -53,7 +56,9 @@ define(
         "sandboxes/:sandboxName/outputs/:shortFileName": "showSandboxOutput",
         "sandboxes/:sandboxName/outputs/:shortFileName/embed": "showSandboxOutput",
 
-        "termination_report": "showTerminationReportIndex"
+        "termination_report": "showTerminationReportIndex",
+
+        "cluster": "showClusterReportIndex"
       },
 
       /**
@@ -161,6 +166,15 @@ define(
         this._switch(new TerminationReportIndex());
       },
 
+      /**
+      * Loads and navigates to the gossip mesh cluster report.
+      *
+      * @method showClusterReportIndex
+      */
+      showClusterReportIndex: function() {
+        this._switch(new ClusterReportIndex());
+      },
+
       /**
       * Destroys the previous view and switches to the new one.
       *
@@ -0,0 +1,45 @@
+define(
+  [
+    "views/base_view",
+    "hgn!templates/cluster_report/cluster_report_index",
+    "adapters/cluster_report_adapter",
+    "presenters/cluster_member_presenter"
+  ],
+  function(BaseView, ClusterReportIndexTemplate, ClusterReportAdapter, ClusterMemberPresenter) {
+    "use strict";
+
+    /**
+    * Index view for the gossip mesh members. This is a top level view that's loaded by the
+    * router.
+    *
+    * @class ClusterReportIndex
+    * @extends BaseView
+    *
+    * @constructor
+    */
+    var ClusterReportIndex = BaseView.extend({
+      presenter: ClusterMemberPresenter,
+      template: ClusterReportIndexTemplate,
+
+      initialize: function() {
+        this.adapter = new ClusterReportAdapter();
+        this.collection = this.adapter.membersCollection;
+
+        this.listenTo(this.collection, "add remove reset change", this.render, this);
+
+        this.adapter.fill();
+      },
+
+      /**
+      * Stops polling for updates before being destroyed.
+      *
+      * @method beforeDestroy
+      */
+      beforeDestroy: function() {
+        this.adapter.stopPollingForUpdates();
+      }
+    });
+
+    return ClusterReportIndex;
+  }
+);
@@ -0,0 +1,77 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"fmt"
+
+	. "heka/pipeline"
+)
+
+type DecompressionDecoderConfig struct {
+	// One of "gzip", "zlib", "snappy", "zstd" or "auto", which detects the
+	// codec from the payload's leading bytes. Defaults to "auto".
+	Codec string `toml:"codec"`
+	// Largest decompressed payload allowed, in bytes.
+	MaxSize uint32 `toml:"max_size"`
+}
+
+// Replaces a message's compressed payload with its decompressed contents.
+type DecompressionDecoder struct {
+	codec        string
+	decompressor *decompressor
+}
+
+func (dd *DecompressionDecoder) ConfigStruct() interface{} {
+	return &DecompressionDecoderConfig{
+		Codec:   "auto",
+		MaxSize: 1 << 24,
+	}
+}
+
+func (dd *DecompressionDecoder) Init(config interface{}) (err error) {
+	conf := config.(*DecompressionDecoderConfig)
+	switch conf.Codec {
+	case "auto", "gzip", "zlib", "snappy", "zstd":
+	default:
+		return fmt.Errorf("unknown codec '%s'", conf.Codec)
+	}
+	dd.codec = conf.Codec
+	dd.decompressor, err = newDecompressor(int(conf.MaxSize))
+	return
+}
+
+func (dd *DecompressionDecoder) Decode(pack *PipelinePack) (packs []*PipelinePack, err error) {
+	payload := []byte(pack.Message.GetPayload())
+	codec := dd.codec
+	if codec == "auto" {
+		if codec = detectCodec(payload); codec == "" {
+			// Not compressed, passed through as it is.
+			return []*PipelinePack{pack}, nil
+		}
+	}
+	var output []byte
+	if output, err = dd.decompressor.decompress(codec, payload); err != nil {
+		return nil, fmt.Errorf("can't decompress %s payload: %s", codec, err)
+	}
+	pack.Message.SetPayload(string(output))
+	return []*PipelinePack{pack}, nil
+}
+
+func init() {
+	RegisterPlugin("DecompressionDecoder", func() interface{} {
+		return new(DecompressionDecoder)
+	})
+}
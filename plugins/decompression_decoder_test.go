@@ -0,0 +1,101 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"bytes"
+	"heka/pipeline"
+	"strings"
+
+	"github.com/golang/snappy"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func DecompressionDecoderSpec(c gs.Context) {
+
+	c.Specify("A DecompressionDecoder", func() {
+		decoder := new(DecompressionDecoder)
+		config := decoder.ConfigStruct().(*DecompressionDecoderConfig)
+		pack := pipeline.NewPipelinePack(make(chan *pipeline.PipelinePack, 1))
+		payload := strings.Repeat("uncompressed ", 100)
+		compress := func(codec string, input string) string {
+			compressor, err := newCompressor(codec, 0)
+			c.Assume(err, gs.IsNil)
+			output, err := compressor.compress([]byte(input))
+			c.Assume(err, gs.IsNil)
+			return string(output)
+		}
+		decode := func() error {
+			packs, err := decoder.Decode(pack)
+			if err == nil {
+				c.Expect(len(packs), gs.Equals, 1)
+			}
+			return err
+		}
+
+		c.Specify("detects the codec", func() {
+			c.Assume(decoder.Init(config), gs.IsNil)
+			for _, codec := range []string{"gzip", "zlib", "zstd"} {
+				pack.Message.SetPayload(compress(codec, payload))
+				c.Expect(decode(), gs.IsNil)
+				c.Expect(pack.Message.GetPayload(), gs.Equals, payload)
+			}
+
+			var framed bytes.Buffer
+			w := snappy.NewBufferedWriter(&framed)
+			w.Write([]byte(payload))
+			w.Close()
+			pack.Message.SetPayload(framed.String())
+			c.Expect(decode(), gs.IsNil)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, payload)
+		})
+
+		c.Specify("passes uncompressed payloads through", func() {
+			c.Assume(decoder.Init(config), gs.IsNil)
+			pack.Message.SetPayload(payload)
+			c.Expect(decode(), gs.IsNil)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, payload)
+		})
+
+		c.Specify("decodes snappy blocks when told to", func() {
+			config.Codec = "snappy"
+			c.Assume(decoder.Init(config), gs.IsNil)
+			pack.Message.SetPayload(compress("snappy", payload))
+			c.Expect(decode(), gs.IsNil)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, payload)
+
+			pack.Message.SetPayload(payload)
+			c.Expect(decode(), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("enforces max_size", func() {
+			config.MaxSize = 100
+			c.Assume(decoder.Init(config), gs.IsNil)
+			for _, codec := range []string{"gzip", "zlib", "zstd"} {
+				pack.Message.SetPayload(compress(codec, payload))
+				c.Expect(decode(), gs.Not(gs.IsNil))
+			}
+			config.Codec = "snappy"
+			c.Assume(decoder.Init(config), gs.IsNil)
+			pack.Message.SetPayload(compress("snappy", payload))
+			c.Expect(decode(), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("rejects unknown codecs", func() {
+			config.Codec = "lzma"
+			c.Expect(decoder.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
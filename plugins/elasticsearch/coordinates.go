@@ -18,8 +18,8 @@ package elasticsearch
 import (
 	"bytes"
 	"fmt"
-	"github.com/cactus/gostrftime"
 	"heka/message"
+	"heka/pipeline"
 	"strconv"
 	"strings"
 	"time"
@@ -32,6 +32,8 @@ type ElasticSearchCoordinates struct {
 	Type                 string
 	Id                   string
 	ESIndexFromTimestamp bool
+	// Time zone the date patterns are interpolated in. Defaults to UTC.
+	Location *time.Location
 }
 
 // Renders the coordinates of the ElasticSearch document as JSON.
@@ -99,11 +101,16 @@ func interpolateFlag(e *ElasticSearchCoordinates, m *message.Message, name strin
 				} else {
 					var t time.Time
 					if e.ESIndexFromTimestamp && m.Timestamp != nil {
-						t = time.Unix(0, *m.Timestamp).UTC()
+						t = time.Unix(0, *m.Timestamp)
 					} else {
-						t = time.Now().UTC()
+						t = time.Now()
 					}
-					iSlice[i] = strings.Replace(iSlice[i], element[:elEnd+1], gostrftime.Strftime(elVal, t), -1)
+					if e.Location != nil {
+						t = t.In(e.Location)
+					} else {
+						t = t.UTC()
+					}
+					iSlice[i] = strings.Replace(iSlice[i], element[:elEnd+1], pipeline.Strftime(elVal, t), -1)
 				}
 			}
 			if iSlice[i] == elVal {
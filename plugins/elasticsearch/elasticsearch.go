@@ -102,6 +102,10 @@ type ElasticSearchOutputConfig struct {
 	ConnectTimeout uint32 `toml:"connect_timeout"`
 	// Whether or not to buffer records to disk before sending to ElasticSearch.
 	UseBuffering bool `toml:"use_buffering"`
+	// Optional subsection looking up the nodes to index to in DNS SRV records
+	// or Consul, in place of the server's host. Requests are spread over the
+	// nodes found. Only supported for HTTP and HTTPS servers.
+	Discovery *DiscoveryConfig `toml:"discovery"`
 }
 
 func (o *ElasticSearchOutput) ConfigStruct() interface{} {
@@ -137,10 +141,22 @@ func (o *ElasticSearchOutput) Init(config interface{}) (err error) {
 				}
 			}
 
-			o.bulkIndexer = NewHttpBulkIndexer(scheme, serverUrl.Host, serverUrl.Path,
+			indexer := NewHttpBulkIndexer(scheme, serverUrl.Host, serverUrl.Path,
 				o.conf.FlushCount, o.conf.Username, o.conf.Password, o.conf.HTTPTimeout,
 				o.conf.HTTPDisableKeepalives, o.conf.ConnectTimeout, tlsConf)
+			if o.conf.Discovery != nil {
+				if err = o.conf.Discovery.Validate(); err != nil {
+					return fmt.Errorf("discovery: %s", err)
+				}
+				if indexer.Resolver, err = NewEndpointResolver(o.conf.Discovery); err != nil {
+					return fmt.Errorf("discovery: %s", err)
+				}
+			}
+			o.bulkIndexer = indexer
 		case "udp":
+			if o.conf.Discovery != nil {
+				return errors.New("discovery requires an `http` or `https` server URL")
+			}
 			o.bulkIndexer = NewUDPBulkIndexer(serverUrl.Host, o.conf.FlushCount)
 		default:
 			err = errors.New("Server URL must specify one of `udp`, `http`, or `https`.")
@@ -151,6 +167,11 @@ func (o *ElasticSearchOutput) Init(config interface{}) (err error) {
 	return
 }
 
+// The bulk API takes newline delimited JSON.
+func (o *ElasticSearchOutput) AcceptedContentTypes() []string {
+	return []string{"application/x-ndjson", "application/json"}
+}
+
 func (o *ElasticSearchOutput) Prepare(or OutputRunner, h PluginHelper) error {
 	if or.Encoder() == nil {
 		return errors.New("Encoder must be specified.")
@@ -345,6 +366,10 @@ type HttpBulkIndexer struct {
 	username string
 	// Optional password for HTTP authentication
 	password string
+	// Optional resolver of the nodes used in place of Domain.
+	Resolver *EndpointResolver
+	// Index of the discovered node the next request is sent to.
+	nextNode int
 }
 
 func NewHttpBulkIndexer(protocol string, domain string, path string, maxCount int,
@@ -389,7 +414,17 @@ func (h *HttpBulkIndexer) Index(body []byte) (err error, retry bool) {
 		return nil, false
 	}
 
-	url := fmt.Sprintf("%s://%s%s%s", h.Protocol, h.Domain, h.Path, "/_bulk")
+	domain := h.Domain
+	if h.Resolver != nil {
+		nodes, _, err := h.Resolver.Endpoints()
+		if len(nodes) == 0 {
+			return fmt.Errorf("Can't discover nodes: %s", err), true
+		}
+		domain = nodes[h.nextNode%len(nodes)]
+		h.nextNode++
+	}
+
+	url := fmt.Sprintf("%s://%s%s%s", h.Protocol, domain, h.Path, "/_bulk")
 
 	// Creating ElasticSearch Bulk HTTP request
 	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
@@ -273,6 +273,9 @@ type ESJsonEncoderConfig struct {
 	// When formating the Index use the Timestamp from the Message instead of
 	// time of processing. Defaults to false.
 	ESIndexFromTimestamp bool `toml:"es_index_from_timestamp"`
+	// Time zone the index name's date patterns are interpolated in, e.g.
+	// "Europe/Berlin" or "Local". Defaults to UTC.
+	ESIndexTimezone string `toml:"es_index_timezone"`
 	// Document ID to use. Defaults to "".
 	Id string
 	// Fields to which formatting will not be applied.
@@ -318,11 +321,16 @@ func (e *ESJsonEncoder) Init(config interface{}) (err error) {
 	e.timestampFormat = conf.Timestamp
 	e.rawBytesFields = conf.RawBytesFields
    	e.replaceDotsWith = conf.ReplaceDotsWith
+	loc, err := LoadTimezone(conf.ESIndexTimezone)
+	if err != nil {
+		return err
+	}
 	e.coord = &ElasticSearchCoordinates{
 		Index:                conf.Index,
 		Type:                 conf.TypeName,
 		ESIndexFromTimestamp: conf.ESIndexFromTimestamp,
 		Id:                   conf.Id,
+		Location:             loc,
 	}
 	e.fieldMappings = conf.FieldMappings
 	e.dynamicFields = conf.DynamicFields
@@ -349,6 +357,11 @@ func (e *ESJsonEncoder) Init(config interface{}) (err error) {
 	return
 }
 
+// Bulk API requests are newline delimited JSON.
+func (e *ESJsonEncoder) ContentType() string {
+	return "application/x-ndjson"
+}
+
 func (e *ESJsonEncoder) Encode(pack *PipelinePack) (output []byte, err error) {
 	m := pack.Message
 	buf := bytes.Buffer{}
@@ -445,6 +458,9 @@ type ESLogstashV0EncoderConfig struct {
 	// When formating the Index use the Timestamp from the Message instead of
 	// time of processing. Defaults to false.
 	ESIndexFromTimestamp bool `toml:"es_index_from_timestamp"`
+	// Time zone the index name's date patterns are interpolated in, e.g.
+	// "Europe/Berlin" or "Local". Defaults to UTC.
+	ESIndexTimezone string `toml:"es_index_timezone"`
 	// Document ID to use. Defaults to "".
 	Id string
 	// Fields to which formatting will not be applied.
@@ -480,11 +496,16 @@ func (e *ESLogstashV0Encoder) Init(config interface{}) (err error) {
 	e.timestampFormat = conf.Timestamp
 	e.useMessageType = conf.UseMessageType
    	e.replaceDotsWith = conf.ReplaceDotsWith
+	loc, err := LoadTimezone(conf.ESIndexTimezone)
+	if err != nil {
+		return err
+	}
 	e.coord = &ElasticSearchCoordinates{
 		Index:                conf.Index,
 		Type:                 conf.TypeName,
 		ESIndexFromTimestamp: conf.ESIndexFromTimestamp,
 		Id:                   conf.Id,
+		Location:             loc,
 	}
 	e.dynamicFields = conf.DynamicFields
 
@@ -510,6 +531,11 @@ func (e *ESLogstashV0Encoder) Init(config interface{}) (err error) {
 	return
 }
 
+// Bulk API requests are newline delimited JSON.
+func (e *ESLogstashV0Encoder) ContentType() string {
+	return "application/x-ndjson"
+}
+
 func (e *ESLogstashV0Encoder) Encode(pack *PipelinePack) (output []byte, err error) {
 	m := pack.Message
 	buf := bytes.Buffer{}
@@ -141,6 +141,22 @@ func ESEncodersSpec(c gs.Context) {
 			c.Expect(interpolatedType, gs.Equals, "TEST")
 		})
 
+		c.Specify("should interpolate the message timestamp in a time zone", func() {
+			loc, err := time.LoadLocation("America/Los_Angeles")
+			c.Assume(err, gs.IsNil)
+			msg := new(message.Message)
+			pack.Message.Copy(msg)
+			msg.SetTimestamp(time.Date(2015, 1, 1, 3, 0, 0, 0, time.UTC).UnixNano())
+			coord := &ElasticSearchCoordinates{ESIndexFromTimestamp: true}
+			index, err := interpolateFlag(coord, msg, "heka-%{%Y.%m.%d}-%{%G.W%V}")
+			c.Expect(err, gs.IsNil)
+			c.Expect(index, gs.Equals, "heka-2015.01.01-2015.W01")
+			coord.Location = loc
+			index, err = interpolateFlag(coord, msg, "heka-%{%Y.%m.%d}-%{%G.W%V}")
+			c.Expect(err, gs.IsNil)
+			c.Expect(index, gs.Equals, "heka-2014.12.31-2015.W01")
+		})
+
 		c.Specify("should interpolate from message field", func() {
 			id := "%{idField}"
 			interpolatedId, err := interpolateFlag(&ElasticSearchCoordinates{},
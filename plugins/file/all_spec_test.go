@@ -23,8 +23,10 @@ func TestAllSpecs(t *testing.T) {
 	r := gospec.NewRunner()
 	r.Parallel = false
 
+	r.AddSpec(ArchiveOutputSpec)
 	r.AddSpec(FileOutputSpec)
 	r.AddSpec(FilePollingInputSpec)
+	r.AddSpec(FifoInputSpec)
 
 	gospec.MainGoTest(r, t)
 }
@@ -0,0 +1,261 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package file
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type ArchiveOutputConfig struct {
+	// Directory the archives are written to, relative to base_dir if it
+	// isn't absolute. Defaults to "archive".
+	Path string `toml:"path"`
+	// Start of the archives' file names, which are followed by the time the
+	// archive was started. Defaults to the plugin's name.
+	FilePrefix string `toml:"file_prefix"`
+	// Number of records in each block of the index. Defaults to 1000.
+	IndexInterval uint `toml:"index_interval"`
+	// Size in bytes at which a new archive is started. Defaults to 1GiB.
+	MaxFileSize uint64 `toml:"max_file_size"`
+	// Seconds after which a new archive is started. Defaults to 0, i.e.
+	// only by size.
+	MaxFileAge uint `toml:"max_file_age"`
+	// Seconds between flushes of the records written to disk. Defaults to 1.
+	TickerInterval uint `toml:"ticker_interval"`
+	// Must be a ProtobufEncoder.
+	Encoder string
+}
+
+// Output plugin that archives messages as files of framed Heka protobuf
+// records, each with a sidecar index of the offsets and timestamp ranges of
+// blocks of its records, so that readers can seek to the part of a large
+// archive they want.
+type ArchiveOutput struct {
+	conf   *ArchiveOutputConfig
+	or     OutputRunner
+	dir    string
+	prefix string
+	now    func() time.Time
+
+	file    *os.File
+	writer  *bufio.Writer
+	index   *os.File
+	indexer *ArchiveIndexer
+	size    int64
+	opened  time.Time
+	// Cursor of the last record written, and whether any records have been
+	// written since the last flush.
+	cursor string
+	dirty  bool
+
+	// Accessed atomically, for the reports.
+	recordCount int64
+	fileCount   int64
+}
+
+func (o *ArchiveOutput) ConfigStruct() interface{} {
+	return &ArchiveOutputConfig{
+		Path:           "archive",
+		IndexInterval:  1000,
+		MaxFileSize:    1024 * 1024 * 1024,
+		TickerInterval: 1,
+		Encoder:        "ProtobufEncoder",
+	}
+}
+
+func (o *ArchiveOutput) Init(config interface{}) error {
+	o.conf = config.(*ArchiveOutputConfig)
+	if o.conf.IndexInterval == 0 {
+		return errors.New("index_interval must be greater than 0")
+	}
+	if o.conf.MaxFileSize == 0 {
+		return errors.New("max_file_size must be greater than 0")
+	}
+	if o.now == nil {
+		o.now = time.Now
+	}
+	return nil
+}
+
+func (o *ArchiveOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	if _, ok := or.Encoder().(*ProtobufEncoder); !ok {
+		return errors.New("encoder must be a ProtobufEncoder")
+	}
+	or.SetUseFraming(true)
+	o.or = or
+	o.dir = h.PipelineConfig().Globals.PrependBaseDir(o.conf.Path)
+	if o.prefix = o.conf.FilePrefix; o.prefix == "" {
+		o.prefix = or.Name()
+	}
+	return os.MkdirAll(o.dir, 0755)
+}
+
+// Starts a new archive and its index.
+func (o *ArchiveOutput) openArchive() (err error) {
+	now := o.now()
+	name := fmt.Sprintf("%s-%s.pb", o.prefix, now.UTC().Format("20060102T150405.000000Z"))
+	path := filepath.Join(o.dir, name)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if o.file, err = os.OpenFile(path, flags, 0644); err != nil {
+		return err
+	}
+	if o.index, err = os.OpenFile(path+ARCHIVE_INDEX_SUFFIX, flags, 0644); err == nil {
+		_, err = fmt.Fprintln(o.index, ARCHIVE_INDEX_HEADER)
+	}
+	if err != nil {
+		o.file.Close()
+		o.file = nil
+		if o.index != nil {
+			o.index.Close()
+		}
+		return err
+	}
+	o.writer = bufio.NewWriter(o.file)
+	o.indexer = NewArchiveIndexer(0, int(o.conf.IndexInterval))
+	o.size = 0
+	o.opened = now
+	atomic.AddInt64(&o.fileCount, 1)
+	return nil
+}
+
+// Flushes the written records to disk and advances the cursor past them.
+func (o *ArchiveOutput) flush() error {
+	if err := o.writer.Flush(); err != nil {
+		return err
+	}
+	if o.dirty {
+		o.or.UpdateCursor(o.cursor)
+		o.dirty = false
+	}
+	return nil
+}
+
+// Adds a block to the index, once its records are on disk.
+func (o *ArchiveOutput) writeBlock(block ArchiveBlock) error {
+	if err := o.flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(o.index, block)
+	return err
+}
+
+// Indexes any remaining records and closes the archive.
+func (o *ArchiveOutput) closeArchive() (err error) {
+	if block, ok := o.indexer.Pending(); ok {
+		err = o.writeBlock(block)
+	} else {
+		err = o.flush()
+	}
+	if e := o.index.Close(); err == nil {
+		err = e
+	}
+	if e := o.file.Close(); err == nil {
+		err = e
+	}
+	o.file = nil
+	return err
+}
+
+// Tells if the current archive is big or old enough to be replaced.
+func (o *ArchiveOutput) rotationDue() bool {
+	if uint64(o.size) >= o.conf.MaxFileSize {
+		return true
+	}
+	age := time.Duration(o.conf.MaxFileAge) * time.Second
+	return age > 0 && o.now().Sub(o.opened) >= age
+}
+
+func (o *ArchiveOutput) ProcessMessage(pack *PipelinePack) error {
+	if o.file != nil && o.rotationDue() {
+		if err := o.closeArchive(); err != nil {
+			o.or.LogError(fmt.Errorf("closing archive: %s", err))
+		}
+	}
+	if o.file == nil {
+		if err := o.openArchive(); err != nil {
+			return NewRetryMessageError("can't start an archive: %s", err)
+		}
+	}
+
+	record, err := o.or.Encode(pack)
+	if err != nil {
+		return fmt.Errorf("can't encode: %s", err)
+	}
+	if _, err = o.writer.Write(record); err != nil {
+		// Start over in a new archive rather than after a partial record.
+		o.closeArchive()
+		return NewRetryMessageError("writing archive: %s", err)
+	}
+	o.size += int64(len(record))
+	o.cursor = pack.QueueCursor
+	o.dirty = true
+	atomic.AddInt64(&o.recordCount, 1)
+	if block, ok := o.indexer.Add(len(record), pack.Message.GetTimestamp()); ok {
+		if err = o.writeBlock(block); err != nil {
+			o.or.LogError(fmt.Errorf("writing archive index: %s", err))
+		}
+	}
+	return nil
+}
+
+func (o *ArchiveOutput) TimerEvent() error {
+	if o.file == nil {
+		return nil
+	}
+	var err error
+	if o.rotationDue() {
+		err = o.closeArchive()
+	} else {
+		err = o.flush()
+	}
+	if err != nil {
+		o.or.LogError(err)
+	}
+	return nil
+}
+
+func (o *ArchiveOutput) CleanUp() {
+	if o.file == nil {
+		return
+	}
+	if err := o.closeArchive(); err != nil {
+		o.or.LogError(fmt.Errorf("closing archive: %s", err))
+	}
+}
+
+// Satisfies the `pipeline.ReportingPlugin` interface to provide plugin state
+// information to the Heka report and dashboard.
+func (o *ArchiveOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "RecordCount",
+		atomic.LoadInt64(&o.recordCount), "count")
+	message.NewInt64Field(msg, "FileCount",
+		atomic.LoadInt64(&o.fileCount), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("ArchiveOutput", func() interface{} {
+		return new(ArchiveOutput)
+	})
+}
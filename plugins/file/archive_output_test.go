@@ -0,0 +1,148 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/client"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func ArchiveOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("An ArchiveOutput", func() {
+		tmpDir, err := ioutil.TempDir("", "archive-output-tests")
+		c.Assume(err, gs.IsNil)
+		defer os.RemoveAll(tmpDir)
+
+		output := new(ArchiveOutput)
+		config := output.ConfigStruct().(*ArchiveOutputConfig)
+		config.Path = tmpDir
+		config.IndexInterval = 2
+		now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+		output.now = func() time.Time { return now }
+
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		h.EXPECT().PipelineConfig().Return(pConfig).AnyTimes()
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		or.EXPECT().Name().Return("Archive").AnyTimes()
+		or.EXPECT().Encoder().Return(new(ProtobufEncoder)).AnyTimes()
+		or.EXPECT().SetUseFraming(true).AnyTimes()
+		or.EXPECT().LogError(gomock.Any()).AnyTimes()
+
+		// The msg's v1 framed record, 1 second apart for each one sent.
+		encoder := client.NewProtobufEncoder(nil)
+		msg := pipeline_ts.GetTestMessage()
+		var sent int
+		send := func(count int) {
+			for i := 0; i < count; i++ {
+				pack := NewPipelinePack(pConfig.InputRecycleChan())
+				msg.SetTimestamp(now.Add(time.Duration(sent) * time.Second).UnixNano())
+				pack.Message = msg
+				var record []byte
+				c.Assume(encoder.EncodeMessageStream(msg, &record), gs.IsNil)
+				or.EXPECT().Encode(pack).Return(record, nil)
+				c.Expect(output.ProcessMessage(pack), gs.IsNil)
+				sent++
+			}
+		}
+		archives := func() []string {
+			paths, _ := filepath.Glob(filepath.Join(tmpDir, "Archive-*.pb"))
+			sort.Strings(paths)
+			return paths
+		}
+
+		c.Assume(output.Init(config), gs.IsNil)
+		c.Assume(output.Prepare(or, h), gs.IsNil)
+
+		c.Specify("indexes blocks of records", func() {
+			or.EXPECT().UpdateCursor(gomock.Any()).AnyTimes()
+			send(5)
+			output.CleanUp()
+			paths := archives()
+			c.Assume(len(paths), gs.Equals, 1)
+			c.Expect(filepath.Base(paths[0]), gs.Equals,
+				"Archive-20150601T120000.000000Z.pb")
+			blocks, err := ReadArchiveIndex(paths[0])
+			c.Assume(err, gs.IsNil)
+			c.Assume(len(blocks), gs.Equals, 3)
+			c.Expect(blocks[1].Records, gs.Equals, 2)
+			c.Expect(blocks[1].MinTime, gs.Equals, now.Add(2*time.Second).UnixNano())
+			c.Expect(blocks[1].MaxTime, gs.Equals, now.Add(3*time.Second).UnixNano())
+			c.Expect(blocks[2].Records, gs.Equals, 1)
+			info, err := os.Stat(paths[0])
+			c.Assume(err, gs.IsNil)
+			c.Expect(blocks[2].End, gs.Equals, info.Size())
+		})
+
+		c.Specify("advances the cursor once the records are flushed", func() {
+			pack := NewPipelinePack(pConfig.InputRecycleChan())
+			pack.QueueCursor = "7"
+			or.EXPECT().Encode(pack).Return([]byte("\x1e\x02\x08\x00\x1f"), nil)
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			or.EXPECT().UpdateCursor("7")
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+		})
+
+		c.Specify("starts a new archive", func() {
+			or.EXPECT().UpdateCursor(gomock.Any()).AnyTimes()
+
+			c.Specify("once max_file_size is reached", func() {
+				output.conf.MaxFileSize = 1
+				send(1)
+				now = now.Add(time.Millisecond)
+				send(1)
+				output.CleanUp()
+				c.Expect(len(archives()), gs.Equals, 2)
+			})
+
+			c.Specify("once max_file_age has passed", func() {
+				output.conf.MaxFileAge = 60
+				send(1)
+				now = now.Add(time.Minute)
+				c.Expect(output.TimerEvent(), gs.IsNil)
+				send(1)
+				output.CleanUp()
+				paths := archives()
+				c.Assume(len(paths), gs.Equals, 2)
+				blocks, _ := ReadArchiveIndex(paths[0])
+				c.Expect(len(blocks), gs.Equals, 1)
+			})
+		})
+	})
+
+	c.Specify("An ArchiveOutput without a ProtobufEncoder is rejected", func() {
+		output := new(ArchiveOutput)
+		c.Assume(output.Init(output.ConfigStruct()), gs.IsNil)
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		or.EXPECT().Encoder().Return(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		c.Expect(output.Prepare(or, h), gs.Not(gs.IsNil))
+	})
+}
@@ -0,0 +1,213 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"heka/pipeline"
+)
+
+// How often a stopping FifoInput retries waking up readers that are blocked
+// waiting for a writer.
+var fifoUnblockInterval = 100 * time.Millisecond
+
+// Input plugin that reads from one or more named pipes, reopening each one
+// whenever its last writer closes it.
+type FifoInput struct {
+	conf     *FifoInputConfig
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	hostname string
+
+	// Protects files, which holds the currently open pipes.
+	lock  sync.Mutex
+	files map[string]*os.File
+}
+
+type FifoInputConfig struct {
+	// Paths of the named pipes to read from.
+	Paths []string `toml:"paths"`
+	// Create any of the named pipes that don't exist.
+	Create bool `toml:"create"`
+	// Permissions of created named pipes (default "600").
+	Perm string `toml:"perm"`
+}
+
+func (fi *FifoInput) ConfigStruct() interface{} {
+	return &FifoInputConfig{
+		Perm: "600",
+	}
+}
+
+func (fi *FifoInput) Init(config interface{}) error {
+	fi.conf = config.(*FifoInputConfig)
+	if runtime.GOOS == "windows" {
+		return errors.New("named pipes aren't supported on Windows")
+	}
+	if len(fi.conf.Paths) == 0 {
+		return errors.New("at least one path must be specified")
+	}
+	perm, err := strconv.ParseUint(fi.conf.Perm, 8, 32)
+	if err != nil {
+		return fmt.Errorf("can't parse perm '%s': %s", fi.conf.Perm, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range fi.conf.Paths {
+		if seen[path] {
+			return fmt.Errorf("duplicate path '%s'", path)
+		}
+		seen[path] = true
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) && fi.conf.Create {
+			if err = mkfifo(path, uint32(perm)); err != nil {
+				return fmt.Errorf("can't create named pipe '%s': %s", path, err)
+			}
+			// Mkfifo is subject to the umask.
+			if err = os.Chmod(path, os.FileMode(perm)); err != nil {
+				return fmt.Errorf("can't set permissions of '%s': %s", path, err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("can't stat '%s': %s", path, err)
+		}
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("'%s' isn't a named pipe", path)
+		}
+	}
+
+	fi.stopChan = make(chan struct{})
+	fi.files = make(map[string]*os.File)
+	return nil
+}
+
+func (fi *FifoInput) Run(ir pipeline.InputRunner, h pipeline.PluginHelper) error {
+	fi.hostname = h.PipelineConfig().Hostname()
+	for _, path := range fi.conf.Paths {
+		fi.wg.Add(1)
+		go fi.read(ir, path)
+	}
+	<-fi.stopChan
+
+	// Readers waiting for a writer to show up need waking before they'll
+	// notice that we're stopping.
+	done := make(chan struct{})
+	go func() {
+		fi.wg.Wait()
+		close(done)
+	}()
+	for {
+		fi.unblock()
+		select {
+		case <-done:
+			return nil
+		case <-time.After(fifoUnblockInterval):
+		}
+	}
+}
+
+func (fi *FifoInput) stopping() bool {
+	select {
+	case <-fi.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reads from the named pipe until the input is stopped, reopening it each
+// time all of its writers have closed it.
+func (fi *FifoInput) read(ir pipeline.InputRunner, path string) {
+	defer fi.wg.Done()
+	sRunner := ir.NewSplitterRunner(path)
+	if !sRunner.UseMsgBytes() {
+		sRunner.SetPackDecorator(func(pack *pipeline.PipelinePack) {
+			pack.Message.SetType("heka.fifo")
+			pack.Message.SetLogger(path)
+			pack.Message.SetHostname(fi.hostname)
+		})
+	}
+	defer sRunner.Done()
+
+	for !fi.stopping() {
+		// Blocks until there's a writer.
+		f, err := os.OpenFile(path, os.O_RDONLY, 0)
+		if err != nil {
+			ir.LogError(fmt.Errorf("can't open '%s': %s", path, err))
+			select {
+			case <-time.After(time.Second):
+			case <-fi.stopChan:
+			}
+			continue
+		}
+		fi.lock.Lock()
+		if fi.stopping() {
+			fi.lock.Unlock()
+			f.Close()
+			return
+		}
+		fi.files[path] = f
+		fi.lock.Unlock()
+
+		for err == nil {
+			err = sRunner.SplitStream(f, nil)
+		}
+		if err != io.EOF && !fi.stopping() {
+			ir.LogError(fmt.Errorf("error reading '%s': %s", path, err))
+		}
+
+		fi.lock.Lock()
+		delete(fi.files, path)
+		fi.lock.Unlock()
+		f.Close()
+	}
+}
+
+// Closes any open pipes, and briefly opens each of the others for writing so
+// that readers blocked in open return.
+func (fi *FifoInput) unblock() {
+	fi.lock.Lock()
+	defer fi.lock.Unlock()
+	for _, path := range fi.conf.Paths {
+		if f, ok := fi.files[path]; ok {
+			f.Close()
+			delete(fi.files, path)
+			continue
+		}
+		// Fails with ENXIO if nobody's waiting to read, which is fine.
+		if w, err := openNonblocking(path); err == nil {
+			w.Close()
+		}
+	}
+}
+
+func (fi *FifoInput) Stop() {
+	close(fi.stopChan)
+}
+
+func init() {
+	pipeline.RegisterPlugin("FifoInput", func() interface{} {
+		return new(FifoInput)
+	})
+}
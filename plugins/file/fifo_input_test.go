@@ -0,0 +1,123 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package file
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func FifoInputSpec(c gs.Context) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tmpDir, err := ioutil.TempDir("", "fifo-input-tests")
+	c.Assume(err, gs.IsNil)
+	defer os.RemoveAll(tmpDir)
+	fifoPath := filepath.Join(tmpDir, "app.fifo")
+	pConfig := NewPipelineConfig(nil)
+	fifoUnblockInterval = 10 * time.Millisecond
+
+	c.Specify("A FifoInput", func() {
+		input := new(FifoInput)
+		config := input.ConfigStruct().(*FifoInputConfig)
+		config.Paths = []string{fifoPath}
+
+		c.Specify("requires an existing named pipe unless create is set", func() {
+			err := input.Init(config)
+			c.Expect(err, gs.Not(gs.IsNil))
+
+			err = ioutil.WriteFile(fifoPath, []byte{}, 0644)
+			c.Assume(err, gs.IsNil)
+			err = input.Init(config)
+			c.Expect(err.Error(), gs.Equals, "'"+fifoPath+"' isn't a named pipe")
+		})
+
+		c.Specify("creates the named pipe", func() {
+			config.Create = true
+			err := input.Init(config)
+			c.Assume(err, gs.IsNil)
+			info, err := os.Stat(fifoPath)
+			c.Assume(err, gs.IsNil)
+			c.Expect(info.Mode()&os.ModeNamedPipe != 0, gs.IsTrue)
+			c.Expect(info.Mode().Perm(), gs.Equals, os.FileMode(0600))
+
+			ir := pipelinemock.NewMockInputRunner(ctrl)
+			h := pipelinemock.NewMockPluginHelper(ctrl)
+			sr := pipelinemock.NewMockSplitterRunner(ctrl)
+			h.EXPECT().PipelineConfig().Return(pConfig)
+			ir.EXPECT().NewSplitterRunner(fifoPath).Return(sr)
+			sr.EXPECT().UseMsgBytes().Return(false)
+			sr.EXPECT().SetPackDecorator(gomock.Any())
+			sr.EXPECT().Done()
+
+			dataChan := make(chan string, 10)
+			splitCall := sr.EXPECT().SplitStream(gomock.Any(), nil).AnyTimes()
+			splitCall.Do(func(r io.Reader, del Deliverer) {
+				data, _ := ioutil.ReadAll(r)
+				if len(data) > 0 {
+					dataChan <- string(data)
+				}
+			})
+			splitCall.Return(io.EOF)
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- input.Run(ir, h)
+			}()
+			write := func(data string) *os.File {
+				w, err := os.OpenFile(fifoPath, os.O_WRONLY, 0)
+				c.Assume(err, gs.IsNil)
+				_, err = w.Write([]byte(data))
+				c.Assume(err, gs.IsNil)
+				return w
+			}
+
+			c.Specify("and reopens it after each writer closes", func() {
+				write("first\n").Close()
+				c.Expect(<-dataChan, gs.Equals, "first\n")
+				write("second\n").Close()
+				c.Expect(<-dataChan, gs.Equals, "second\n")
+
+				// We're now blocked waiting for another writer.
+				input.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+			})
+
+			c.Specify("and stops while a writer has it open", func() {
+				w := write("partial")
+				defer w.Close()
+				time.Sleep(10 * time.Millisecond)
+				input.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+				c.Expect(<-dataChan, gs.Equals, "partial")
+			})
+		})
+	})
+}
@@ -24,7 +24,6 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/cactus/gostrftime"
 	. "heka/pipeline"
 	"heka/plugins"
 	"github.com/rafrombrc/go-notify"
@@ -54,6 +53,8 @@ type FileOutput struct {
 	timerChan  <-chan time.Time
 	rotateChan chan time.Time
 	closing    chan struct{}
+	// Names the rotated files.
+	partitioner *TimePartitioner
 }
 
 // ConfigStruct for FileOutput plugin.
@@ -73,6 +74,10 @@ type FileOutputConfig struct {
 	// (default 0, i.e. disabled). Set to 0 to disable.
 	RotationInterval uint32 `toml:"rotation_interval"`
 
+	// Time zone the rotated file names' timestamps are in, e.g. "UTC" or
+	// "Europe/Paris" (default "Local").
+	PathTimezone string `toml:"path_timezone"`
+
 	// Interval at which accumulated file data should be written to disk, in
 	// milliseconds (default 1000, i.e. 1 second). Set to 0 to disable.
 	FlushInterval uint32 `toml:"flush_interval"`
@@ -107,6 +112,7 @@ func (o *FileOutput) ConfigStruct() interface{} {
 	return &FileOutputConfig{
 		Perm:             "644",
 		RotationInterval: 0,
+		PathTimezone:     "Local",
 		FlushInterval:    1000,
 		FlushCount:       1,
 		FlushOperator:    "AND",
@@ -156,6 +162,9 @@ func (o *FileOutput) Init(config interface{}) (err error) {
 		o.path = o.Path
 	case 1, 4, 12, 24:
 		// RotationInterval value is allowed
+		if o.partitioner, err = NewTimePartitioner(o.Path, conf.PathTimezone); err != nil {
+			return fmt.Errorf("FileOutput '%s' can't use `path_timezone`: %s", o.Path, err)
+		}
 		o.startRotateNotifier()
 	default:
 		err = fmt.Errorf("Parameter 'rotation_interval' must be one of: 0, 1, 4, 12, 24.")
@@ -181,7 +190,7 @@ func (o *FileOutput) startRotateNotifier() {
 	until := next.Sub(now)
 	after := time.After(until)
 
-	o.path = gostrftime.Strftime(o.FileOutputConfig.Path, now)
+	o.path = o.partitioner.Format(now)
 
 	go func() {
 		ok := true
@@ -359,7 +368,7 @@ func (o *FileOutput) committer(or OutputRunner, errChan chan error) {
 			}
 		case rotateTime := <-o.rotateChan:
 			o.file.Close()
-			o.path = gostrftime.Strftime(o.FileOutputConfig.Path, rotateTime)
+			o.path = o.partitioner.Format(rotateTime)
 			if err = o.openFile(); err != nil {
 				close(o.closing)
 				err = fmt.Errorf("unable to open rotated file '%s': %s", o.path, err)
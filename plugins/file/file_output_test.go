@@ -143,6 +143,32 @@ func FileOutputSpec(c gs.Context) {
 
 		})
 
+		c.Specify("names rotated files in path_timezone", func() {
+			config.Path = "%Y-%m-%d-%H-W%V"
+			config.RotationInterval = 1
+			config.PathTimezone = "Asia/Kolkata"
+			loc, err := time.LoadLocation(config.PathTimezone)
+			c.Assume(err, gs.IsNil)
+
+			err = fileOutput.Init(config)
+			c.Assume(err, gs.IsNil)
+			defer os.Remove(fileOutput.path)
+			defer fileOutput.file.Close()
+			close(fileOutput.closing)
+
+			now := time.Now().In(loc)
+			_, week := now.ISOWeek()
+			c.Expect(fileOutput.path, gs.Equals,
+				fmt.Sprintf("%s-W%02d", now.Format("2006-01-02-15"), week))
+		})
+
+		c.Specify("won't rotate files in an unknown path_timezone", func() {
+			config.Path = "%Y-%m-%d"
+			config.RotationInterval = 24
+			config.PathTimezone = "Nowhere/Special"
+			c.Expect(fileOutput.Init(config), gs.Not(gs.IsNil))
+		})
+
 		c.Specify("processes incoming messages", func() {
 			err := fileOutput.Init(config)
 			c.Assume(err, gs.IsNil)
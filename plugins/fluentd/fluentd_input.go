@@ -0,0 +1,319 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package fluentd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pborman/uuid"
+	"heka/message"
+	. "heka/pipeline"
+	"heka/plugins/tcp"
+)
+
+type FluentdForwardInputConfig struct {
+	// Address listened on, e.g. ":24224".
+	Address string `toml:"address"`
+	UseTls  bool   `toml:"use_tls"`
+	Tls     tcp.TlsConfig
+	// Key clients must prove they know, requiring the handshake if it's set.
+	SharedKey string `toml:"shared_key"`
+	// Hostname sent in the handshake. Defaults to Heka's hostname.
+	SelfHostname string `toml:"self_hostname"`
+	// Usernames and passwords of the clients accepted, as well as the shared
+	// key.
+	Users map[string]string `toml:"users"`
+	// Record keys whose value becomes the payload, the first found winning.
+	// Defaults to "message" and "log".
+	PayloadKeys []string `toml:"payload_keys"`
+	// Largest message, or uncompressed chunk of entries, accepted in bytes.
+	// Defaults to 16MiB.
+	MaxChunkSize uint `toml:"max_chunk_size"`
+	// Seconds the handshake may take. Defaults to 10.
+	Timeout uint `toml:"timeout"`
+	// Subsection of listening socket settings, such as the address family
+	// and buffer sizes.
+	Socket SocketConfig `toml:"socket"`
+}
+
+// Input plugin that receives events from fluentd and fluent-bit forward
+// outputs, speaking the forward protocol with its optional shared key and
+// user authentication. Chunks are acknowledged once their events have been
+// delivered, for the clients that ask for it.
+type FluentdForwardInput struct {
+	conf     *FluentdForwardInputConfig
+	ir       InputRunner
+	auth     *forwardAuth
+	hostname string
+	listener net.Listener
+	stopChan chan bool
+	wg       sync.WaitGroup
+	lock     sync.Mutex
+	conns    map[net.Conn]bool
+
+	// Accessed atomically, for the reports.
+	processMessageCount    int64
+	processMessageFailures int64
+}
+
+func (i *FluentdForwardInput) ConfigStruct() interface{} {
+	return &FluentdForwardInputConfig{
+		Address:      ":24224",
+		Tls:          tcp.TlsConfig{PreferServerCiphers: true},
+		PayloadKeys:  []string{"message", "log"},
+		MaxChunkSize: 16 * 1024 * 1024,
+		Timeout:      10,
+	}
+}
+
+func (i *FluentdForwardInput) Init(config interface{}) (err error) {
+	i.conf = config.(*FluentdForwardInputConfig)
+	if len(i.conf.Users) > 0 && i.conf.SharedKey == "" {
+		return errors.New("users need shared_key to be set")
+	}
+	if i.conf.MaxChunkSize == 0 {
+		return errors.New("max_chunk_size must be greater than 0")
+	}
+	network, err := i.conf.Socket.Network("tcp")
+	if err != nil {
+		return err
+	}
+	if i.listener, err = i.conf.Socket.Listen(network, i.conf.Address, false); err != nil {
+		return fmt.Errorf("can't listen on %s: %s", i.conf.Address, err)
+	}
+	if i.conf.UseTls {
+		listener, err := tcp.NewTlsListener(i.listener, &i.conf.Tls)
+		if err != nil {
+			i.listener.Close()
+			return err
+		}
+		i.listener = listener
+	}
+	i.stopChan = make(chan bool)
+	i.conns = make(map[net.Conn]bool)
+	return nil
+}
+
+func (i *FluentdForwardInput) Run(ir InputRunner, h PluginHelper) error {
+	i.ir = ir
+	if i.hostname = i.conf.SelfHostname; i.hostname == "" {
+		i.hostname = h.PipelineConfig().Hostname()
+	}
+	if i.conf.SharedKey != "" {
+		i.auth = &forwardAuth{sharedKey: i.conf.SharedKey, hostname: i.hostname,
+			users: i.conf.Users}
+	}
+	for {
+		conn, err := i.listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				ir.LogError(fmt.Errorf("accept failed: %s", err))
+				continue
+			}
+			break
+		}
+		i.lock.Lock()
+		select {
+		case <-i.stopChan:
+			conn.Close()
+		default:
+			i.conns[conn] = true
+			i.wg.Add(1)
+			go i.handleConnection(conn)
+		}
+		i.lock.Unlock()
+	}
+	i.wg.Wait()
+	return nil
+}
+
+// Reads a connection's messages, delivering their events, until it's closed
+// or sends something that isn't a forward protocol message.
+func (i *FluentdForwardInput) handleConnection(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		i.lock.Lock()
+		delete(i.conns, conn)
+		i.lock.Unlock()
+		i.wg.Done()
+	}()
+	raddr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(raddr)
+	if err != nil {
+		host = raddr
+	}
+	r := newMsgpackReader(conn, int(i.conf.MaxChunkSize))
+	if i.auth != nil {
+		conn.SetDeadline(time.Now().Add(time.Duration(i.conf.Timeout) * time.Second))
+		if host, err = i.auth.serverHandshake(conn, r); err != nil {
+			i.ir.LogError(fmt.Errorf("client %s rejected: %s", raddr, err))
+			return
+		}
+		conn.SetDeadline(time.Time{})
+	}
+
+	for {
+		v, err := r.read()
+		if err != nil {
+			if err != io.EOF && !i.stopped() {
+				i.ir.LogError(fmt.Errorf("connection from %s failed: %s", raddr, err))
+			}
+			return
+		}
+		msg, err := parseForward(v, int(i.conf.MaxChunkSize))
+		if err != nil {
+			atomic.AddInt64(&i.processMessageFailures, 1)
+			i.ir.LogError(fmt.Errorf("bad message from %s: %s", raddr, err))
+			return
+		}
+		for _, entry := range msg.entries {
+			var pack *PipelinePack
+			select {
+			case pack = <-i.ir.InChan():
+			case <-i.stopChan:
+				return
+			}
+			i.populate(pack, msg.tag, entry, host)
+			i.ir.Deliver(pack)
+			atomic.AddInt64(&i.processMessageCount, 1)
+		}
+		if chunk, ok := msg.chunk(); ok {
+			if err = writeValue(conn, map[string]interface{}{"ack": chunk}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (i *FluentdForwardInput) stopped() bool {
+	select {
+	case <-i.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// Fills in the message of an event, its record's values becoming fields
+// but for the payload, with maps and arrays as nested fields.
+func (i *FluentdForwardInput) populate(pack *PipelinePack, tag string,
+	entry forwardEntry, host string) {
+
+	msg := pack.Message
+	msg.SetUuid(uuid.NewRandom())
+	msg.SetTimestamp(entry.time.UnixNano())
+	msg.SetType("heka.fluentd")
+	msg.SetLogger(i.ir.Name())
+	msg.SetHostname(host)
+	message.NewStringField(msg, "Tag", tag)
+	payloadKey := ""
+	for _, key := range i.conf.PayloadKeys {
+		if payload, ok := toString(entry.record[key]); ok {
+			msg.SetPayload(payload)
+			payloadKey = key
+			break
+		}
+	}
+	names := make([]string, 0, len(entry.record))
+	for name := range entry.record {
+		if name != payloadKey {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var err error
+		switch t := entry.record[name].(type) {
+		case nil:
+			continue
+		case []byte:
+			message.NewStringField(msg, name, string(t))
+		case uint64:
+			message.NewStringField(msg, name, strconv.FormatUint(t, 10))
+		case map[string]interface{}, []interface{}:
+			err = message.NewNestedFieldOnMessage(msg, name, jsonValue(t))
+		case time.Time:
+			message.NewTimestampField(msg, name, t)
+		default:
+			var field *message.Field
+			if field, err = message.NewField(name, t, ""); err == nil {
+				msg.AddField(field)
+			}
+		}
+		if err != nil {
+			i.ir.LogError(fmt.Errorf("can't add '%s' field: %s", name, err))
+		}
+	}
+}
+
+// Returns the decoded value with its bin values as strings and its times
+// as RFC 3339 strings, so it can be encoded as JSON.
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []byte:
+		return string(t)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, e := range t {
+			a[i] = jsonValue(e)
+		}
+		return a
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[k] = jsonValue(e)
+		}
+		return m
+	}
+	return v
+}
+
+func (i *FluentdForwardInput) Stop() {
+	i.lock.Lock()
+	close(i.stopChan)
+	i.listener.Close()
+	for conn := range i.conns {
+		conn.Close()
+	}
+	i.lock.Unlock()
+}
+
+func (i *FluentdForwardInput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "ProcessMessageCount",
+		atomic.LoadInt64(&i.processMessageCount), "count")
+	message.NewInt64Field(msg, "ProcessMessageFailures",
+		atomic.LoadInt64(&i.processMessageFailures), "count")
+	i.lock.Lock()
+	conns := len(i.conns)
+	i.lock.Unlock()
+	message.NewInt64Field(msg, "Connections", int64(conns), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("FluentdForwardInput", func() interface{} {
+		return new(FluentdForwardInput)
+	})
+}
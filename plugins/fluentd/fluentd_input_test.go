@@ -0,0 +1,170 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package fluentd
+
+import (
+	"net"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func FluentdForwardInputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A FluentdForwardInput", func() {
+		input := new(FluentdForwardInput)
+		config := input.ConfigStruct().(*FluentdForwardInputConfig)
+		config.Address = "127.0.0.1:0"
+
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		ir := pipelinemock.NewMockInputRunner(ctrl)
+		recycleChan := make(chan *PipelinePack, 10)
+		for i := 0; i < 10; i++ {
+			recycleChan <- NewPipelinePack(recycleChan)
+		}
+		delivered := make(chan *PipelinePack, 10)
+		eventTime := time.Unix(1500000000, 5)
+
+		run := func() (net.Conn, chan error) {
+			h.EXPECT().PipelineConfig().Return(pConfig).AnyTimes()
+			ir.EXPECT().Name().Return("Fluentd").AnyTimes()
+			ir.EXPECT().InChan().Return(recycleChan).AnyTimes()
+			ir.EXPECT().Deliver(gomock.Any()).Do(func(pack *PipelinePack) {
+				delivered <- pack
+			}).AnyTimes()
+			c.Assume(input.Init(config), gs.IsNil)
+			done := make(chan error, 1)
+			go func() {
+				done <- input.Run(ir, h)
+			}()
+			conn, err := net.Dial("tcp", input.listener.Addr().String())
+			c.Assume(err, gs.IsNil)
+			return conn, done
+		}
+
+		c.Specify("delivers events", func() {
+			conn, done := run()
+			defer conn.Close()
+			writeValue(conn, []interface{}{"app.web", eventTime, map[string]interface{}{
+				"log":    "GET /",
+				"status": 200,
+				"bytes":  []byte("raw"),
+				"kubernetes": map[string]interface{}{
+					"pod": "web-1",
+				},
+				"latency": 0.25,
+				"ok":      true,
+				"nothing": nil,
+			}})
+			pack := <-delivered
+			msg := pack.Message
+			c.Expect(msg.GetPayload(), gs.Equals, "GET /")
+			c.Expect(msg.GetType(), gs.Equals, "heka.fluentd")
+			c.Expect(msg.GetLogger(), gs.Equals, "Fluentd")
+			c.Expect(msg.GetHostname(), gs.Equals, "127.0.0.1")
+			c.Expect(msg.GetTimestamp(), gs.Equals, eventTime.UnixNano())
+			value, _ := msg.GetFieldValue("Tag")
+			c.Expect(value, gs.Equals, "app.web")
+			value, _ = msg.GetFieldValue("status")
+			c.Expect(value, gs.Equals, int64(200))
+			value, _ = msg.GetFieldValue("bytes")
+			c.Expect(value, gs.Equals, "raw")
+			value, _ = msg.GetFieldPath("kubernetes.pod")
+			c.Expect(value, gs.Equals, "web-1")
+			value, _ = msg.GetFieldValue("latency")
+			c.Expect(value, gs.Equals, 0.25)
+			value, _ = msg.GetFieldValue("ok")
+			c.Expect(value, gs.Equals, true)
+			c.Expect(msg.FindFirstField("log") == nil, gs.IsTrue)
+			c.Expect(msg.FindFirstField("nothing") == nil, gs.IsTrue)
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+			c.Expect(input.processMessageCount, gs.Equals, int64(1))
+		})
+
+		c.Specify("acknowledges chunks once they're delivered", func() {
+			conn, done := run()
+			defer conn.Close()
+			var entries []byte
+			for _, log := range []string{"one", "two"} {
+				entries = appendValue(entries, []interface{}{eventTime,
+					map[string]interface{}{"message": log}})
+			}
+			writeValue(conn, []interface{}{"app", gzipped(entries), map[string]interface{}{
+				"size": 2, "chunk": "Y2h1bms=", "compressed": "gzip"}})
+			c.Expect((<-delivered).Message.GetPayload(), gs.Equals, "one")
+			c.Expect((<-delivered).Message.GetPayload(), gs.Equals, "two")
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			ack, err := newMsgpackReader(conn, 1024).read()
+			c.Expect(err, gs.IsNil)
+			c.Expect(ack.(map[string]interface{})["ack"], gs.Equals, "Y2h1bms=")
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+		})
+
+		c.Specify("drops clients that send garbage", func() {
+			ir.EXPECT().LogError(gomock.Any())
+			conn, done := run()
+			defer conn.Close()
+			writeValue(conn, "hello")
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, err := conn.Read(make([]byte, 1))
+			c.Expect(err, gs.Not(gs.IsNil))
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+			c.Expect(input.processMessageFailures, gs.Equals, int64(1))
+		})
+
+		c.Specify("authenticates clients", func() {
+			config.SharedKey = "secret"
+			config.SelfHostname = "aggregator"
+			config.Users = map[string]string{"alice": "pass"}
+			conn, done := run()
+			defer conn.Close()
+			client := &forwardAuth{sharedKey: "secret", hostname: "web1",
+				username: "alice", password: "pass"}
+			c.Expect(client.clientHandshake(conn, newMsgpackReader(conn, 1024)), gs.IsNil)
+			writeValue(conn, []interface{}{"app", eventTime,
+				map[string]interface{}{"message": "hi"}})
+			pack := <-delivered
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "hi")
+			c.Expect(pack.Message.GetHostname(), gs.Equals, "web1")
+
+			ir.EXPECT().LogError(gomock.Any())
+			other, err := net.Dial("tcp", input.listener.Addr().String())
+			c.Assume(err, gs.IsNil)
+			defer other.Close()
+			client.password = "wrong"
+			err = client.clientHandshake(other, newMsgpackReader(other, 1024))
+			c.Expect(err.Error(), gs.Equals,
+				"server refused authentication: username/password mismatch")
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+		})
+
+		c.Specify("checks its settings", func() {
+			config.Users = map[string]string{"alice": "pass"}
+			c.Expect(input.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
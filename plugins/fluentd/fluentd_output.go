@@ -0,0 +1,397 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package fluentd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+	"heka/plugins/tcp"
+)
+
+type FluentdForwardOutputConfig struct {
+	// Address of the fluentd or fluent-bit forward input, "host:port".
+	Address string `toml:"address"`
+	UseTls  bool   `toml:"use_tls"`
+	Tls     tcp.TlsConfig
+	// Key shared with the server, doing the handshake if it's set.
+	SharedKey string `toml:"shared_key"`
+	// Hostname sent in the handshake. Defaults to Heka's hostname.
+	SelfHostname string `toml:"self_hostname"`
+	// Login for servers with user authentication.
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// Tag of the events, for messages without a tag_field field. Defaults to
+	// "heka".
+	Tag string `toml:"tag"`
+	// Message field holding the event's tag. Defaults to "Tag".
+	TagField string `toml:"tag_field"`
+	// Record key of the payload, or of the encoder's output if there's an
+	// encoder. Defaults to "message".
+	PayloadKey string `toml:"payload_key"`
+	// Whether records get the message's type, logger, hostname, severity
+	// and pid.
+	IncludeHeaders bool `toml:"include_headers"`
+	// Whether the server acknowledges each chunk before the queue cursor
+	// moves past it. Defaults to true.
+	RequireAckResponse bool `toml:"require_ack_response"`
+	// Seconds to wait for a chunk's acknowledgement. Defaults to 60.
+	AckResponseTimeout uint `toml:"ack_response_timeout"`
+	// Most events sent in a chunk. Defaults to 100.
+	FlushCount uint `toml:"flush_count"`
+	// Whether chunks are sent gzipped.
+	Compress bool `toml:"compress"`
+	// Seconds to connect and do the handshake, or send a chunk. Defaults to
+	// 10.
+	Timeout uint `toml:"timeout"`
+	// Whether TCP keep alives are sent on the connection. Defaults to
+	// true.
+	KeepAlive bool `toml:"keep_alive"`
+	// Seconds between keep alives. Defaults to 15.
+	KeepAlivePeriod uint `toml:"keep_alive_period"`
+	// Seconds sent data may go unacknowledged by the server's TCP stack
+	// before the connection is dropped, 0 for the system default. Linux
+	// only.
+	TcpUserTimeout uint `toml:"tcp_user_timeout"`
+	// Seconds between sending the events waiting. Defaults to 1.
+	TickerInterval uint `toml:"ticker_interval"`
+}
+
+// Output plugin that forwards messages as events to a fluentd or fluent-bit
+// forward input, in PackedForward chunks of events with the same tag. With
+// require_ack_response each chunk's sent until the server acknowledges it,
+// and only then does the queue cursor move past it.
+type FluentdForwardOutput struct {
+	conf         *FluentdForwardOutputConfig
+	tlsConf      *tls.Config
+	dialer       *net.Dialer
+	or           OutputRunner
+	auth         *forwardAuth
+	conn         net.Conn
+	reader       *msgpackReader
+	hasConnected bool
+
+	// The encoded entries waiting to be sent, all with the same tag, and the
+	// cursor of the last one's message.
+	tag     string
+	entries []byte
+	count   int
+	cursor  string
+
+	// Accessed atomically, for the reports.
+	messagesSent int64
+	chunksSent   int64
+	sendFailures int64
+	reconnects   int64
+	waiting      int64
+}
+
+func (o *FluentdForwardOutput) ConfigStruct() interface{} {
+	return &FluentdForwardOutputConfig{
+		Tag:                "heka",
+		TagField:           "Tag",
+		PayloadKey:         "message",
+		RequireAckResponse: true,
+		AckResponseTimeout: 60,
+		FlushCount:         100,
+		Timeout:            10,
+		KeepAlive:          true,
+		KeepAlivePeriod:    15,
+		TickerInterval:     1,
+	}
+}
+
+func (o *FluentdForwardOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*FluentdForwardOutputConfig)
+	if o.conf.Address == "" {
+		return errors.New("address must be set")
+	}
+	if o.conf.Username != "" && o.conf.SharedKey == "" {
+		return errors.New("username needs shared_key to be set")
+	}
+	if o.conf.FlushCount == 0 {
+		return errors.New("flush_count must be greater than 0")
+	}
+	if o.conf.UseTls {
+		if o.tlsConf, err = tcp.CreateGoTlsConfig(&o.conf.Tls); err != nil {
+			return fmt.Errorf("TLS init error: %s", err)
+		}
+	}
+	if o.dialer, err = TcpDialer(time.Duration(o.conf.TcpUserTimeout) * time.Second); err != nil {
+		return err
+	}
+	o.dialer.Timeout = time.Duration(o.conf.Timeout) * time.Second
+	if o.conf.KeepAlive {
+		o.dialer.KeepAlive = time.Duration(o.conf.KeepAlivePeriod) * time.Second
+	} else {
+		// A negative period turns keep alives off.
+		o.dialer.KeepAlive = -1
+	}
+	return nil
+}
+
+func (o *FluentdForwardOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	o.or = or
+	if o.conf.SharedKey != "" {
+		hostname := o.conf.SelfHostname
+		if hostname == "" {
+			hostname = h.PipelineConfig().Hostname()
+		}
+		o.auth = &forwardAuth{sharedKey: o.conf.SharedKey, hostname: hostname,
+			username: o.conf.Username, password: o.conf.Password}
+	}
+	return nil
+}
+
+// Returns a field's value for a record: a nested field's structured value,
+// a single value, or an array of multiple values.
+func fieldValue(f *message.Field) interface{} {
+	if f.IsNested() {
+		if v, err := f.NestedValue(); err == nil {
+			return v
+		}
+	}
+	var values []interface{}
+	switch f.GetValueType() {
+	case message.Field_STRING:
+		for _, v := range f.ValueString {
+			values = append(values, v)
+		}
+	case message.Field_BYTES:
+		for _, v := range f.ValueBytes {
+			values = append(values, v)
+		}
+	case message.Field_INTEGER:
+		for _, v := range f.ValueInteger {
+			values = append(values, v)
+		}
+	case message.Field_DOUBLE:
+		for _, v := range f.ValueDouble {
+			values = append(values, v)
+		}
+	case message.Field_BOOL:
+		for _, v := range f.ValueBool {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// Returns a message's tag and record, which is nil if the encoder
+// produced nothing.
+func (o *FluentdForwardOutput) record(pack *PipelinePack) (string, map[string]interface{},
+	error) {
+
+	msg := pack.Message
+	tag := o.conf.Tag
+	record := make(map[string]interface{})
+	encoded := o.or.Encoder() != nil
+	if encoded {
+		body, err := o.or.Encode(pack)
+		if err != nil {
+			return "", nil, err
+		}
+		if body == nil {
+			return "", nil, nil
+		}
+		record[o.conf.PayloadKey] = string(body)
+	} else if msg.Payload != nil {
+		record[o.conf.PayloadKey] = msg.GetPayload()
+	}
+	for _, f := range msg.Fields {
+		if f.GetName() == o.conf.TagField && f.GetValueType() == message.Field_STRING &&
+			len(f.ValueString) > 0 {
+			tag = f.ValueString[0]
+			continue
+		}
+		if !encoded {
+			record[f.GetName()] = fieldValue(f)
+		}
+	}
+	if o.conf.IncludeHeaders {
+		record["type"] = msg.GetType()
+		record["logger"] = msg.GetLogger()
+		record["hostname"] = msg.GetHostname()
+		record["severity"] = int64(msg.GetSeverity())
+		record["pid"] = int64(msg.GetPid())
+	}
+	return tag, record, nil
+}
+
+// Connects, doing the handshake, if the output isn't connected.
+func (o *FluentdForwardOutput) connect() error {
+	if o.conn != nil {
+		return nil
+	}
+	timeout := time.Duration(o.conf.Timeout) * time.Second
+	var conn net.Conn
+	var err error
+	if o.tlsConf != nil {
+		conn, err = tls.DialWithDialer(o.dialer, "tcp", o.conf.Address, o.tlsConf)
+	} else {
+		conn, err = o.dialer.Dial("tcp", o.conf.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("can't connect to %s: %s", o.conf.Address, err)
+	}
+	// The server only sends the handshake and acknowledgements.
+	reader := newMsgpackReader(conn, 64*1024)
+	if o.auth != nil {
+		conn.SetDeadline(time.Now().Add(timeout))
+		if err = o.auth.clientHandshake(conn, reader); err != nil {
+			conn.Close()
+			return fmt.Errorf("handshake with %s failed: %s", o.conf.Address, err)
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	if o.hasConnected {
+		atomic.AddInt64(&o.reconnects, 1)
+	}
+	o.conn, o.reader, o.hasConnected = conn, reader, true
+	return nil
+}
+
+func (o *FluentdForwardOutput) disconnect() {
+	if o.conn != nil {
+		o.conn.Close()
+		o.conn, o.reader = nil, nil
+	}
+}
+
+// Sends the entries waiting as a chunk, waiting for its acknowledgement if
+// it's required, and moves the cursor past them once they're sent.
+func (o *FluentdForwardOutput) flush() error {
+	if o.count == 0 {
+		return nil
+	}
+	if err := o.connect(); err != nil {
+		atomic.AddInt64(&o.sendFailures, 1)
+		return err
+	}
+	option := map[string]interface{}{"size": o.count}
+	data := o.entries
+	if o.conf.Compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		gz.Close()
+		data = buf.Bytes()
+		option["compressed"] = "gzip"
+	}
+	var chunk string
+	if o.conf.RequireAckResponse {
+		chunk = base64.StdEncoding.EncodeToString(randomBytes(16))
+		option["chunk"] = chunk
+	}
+
+	o.conn.SetWriteDeadline(time.Now().Add(time.Duration(o.conf.Timeout) * time.Second))
+	err := writeValue(o.conn, []interface{}{o.tag, data, option})
+	if err == nil && chunk != "" {
+		o.conn.SetReadDeadline(time.Now().Add(
+			time.Duration(o.conf.AckResponseTimeout) * time.Second))
+		var v interface{}
+		if v, err = o.reader.read(); err == nil {
+			response, _ := v.(map[string]interface{})
+			if ack, _ := toString(response["ack"]); ack != chunk {
+				err = fmt.Errorf("got ack %v for chunk %s", response["ack"], chunk)
+			}
+		}
+	}
+	if err != nil {
+		// Sent again, on a new connection.
+		o.disconnect()
+		atomic.AddInt64(&o.sendFailures, 1)
+		return fmt.Errorf("can't send %d messages: %s", o.count, err)
+	}
+
+	atomic.AddInt64(&o.messagesSent, int64(o.count))
+	atomic.AddInt64(&o.chunksSent, 1)
+	atomic.StoreInt64(&o.waiting, 0)
+	o.entries, o.count = o.entries[:0], 0
+	o.or.UpdateCursor(o.cursor)
+	return nil
+}
+
+func (o *FluentdForwardOutput) ProcessMessage(pack *PipelinePack) error {
+	tag, record, err := o.record(pack)
+	if err != nil {
+		return fmt.Errorf("can't encode: %s", err)
+	}
+	if record == nil {
+		return nil
+	}
+	// A chunk's events all have the same tag.
+	if o.count > 0 && (tag != o.tag || o.count >= int(o.conf.FlushCount)) {
+		if err = o.flush(); err != nil {
+			return NewRetryMessageError("%s", err)
+		}
+	}
+	o.tag = tag
+	o.entries = appendValue(o.entries, []interface{}{
+		time.Unix(0, pack.Message.GetTimestamp()), record})
+	o.count++
+	o.cursor = pack.QueueCursor
+	atomic.StoreInt64(&o.waiting, int64(o.count))
+	if o.count >= int(o.conf.FlushCount) {
+		if err = o.flush(); err != nil {
+			// Sent with the next message or tick.
+			o.or.LogError(err)
+		}
+	}
+	return nil
+}
+
+func (o *FluentdForwardOutput) TimerEvent() error {
+	if err := o.flush(); err != nil {
+		o.or.LogError(err)
+	}
+	return nil
+}
+
+func (o *FluentdForwardOutput) CleanUp() {
+	if err := o.flush(); err != nil {
+		o.or.LogError(fmt.Errorf("messages may not have been sent: %s", err))
+	}
+	o.disconnect()
+}
+
+func (o *FluentdForwardOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "MessagesSent", atomic.LoadInt64(&o.messagesSent),
+		"count")
+	message.NewInt64Field(msg, "ChunksSent", atomic.LoadInt64(&o.chunksSent), "count")
+	message.NewInt64Field(msg, "SendFailures", atomic.LoadInt64(&o.sendFailures),
+		"count")
+	message.NewInt64Field(msg, "Reconnects", atomic.LoadInt64(&o.reconnects), "count")
+	message.NewInt64Field(msg, "Waiting", atomic.LoadInt64(&o.waiting), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("FluentdForwardOutput", func() interface{} {
+		return new(FluentdForwardOutput)
+	})
+}
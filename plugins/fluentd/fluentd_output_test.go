@@ -0,0 +1,278 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package fluentd
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+	"heka/plugins"
+)
+
+// A forward input that records the messages it receives, acknowledging
+// them unless it's told to drop some.
+type forwardServer struct {
+	listener net.Listener
+	auth     *forwardAuth
+
+	lock     sync.Mutex
+	messages []*forwardMessage
+	drop     int
+	conns    int
+}
+
+func newForwardServer(auth *forwardAuth) *forwardServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := &forwardServer{listener: listener, auth: auth}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *forwardServer) serve(conn net.Conn) {
+	defer conn.Close()
+	s.lock.Lock()
+	s.conns++
+	s.lock.Unlock()
+	r := newMsgpackReader(conn, 1<<20)
+	if s.auth != nil {
+		if _, err := s.auth.serverHandshake(conn, r); err != nil {
+			return
+		}
+	}
+	for {
+		v, err := r.read()
+		if err != nil {
+			return
+		}
+		m, err := parseForward(v, 1<<20)
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		drop := s.drop > 0
+		if drop {
+			s.drop--
+		} else {
+			s.messages = append(s.messages, m)
+		}
+		s.lock.Unlock()
+		if drop {
+			return
+		}
+		if chunk, ok := m.chunk(); ok {
+			writeValue(conn, map[string]interface{}{"ack": chunk})
+		}
+	}
+}
+
+func (s *forwardServer) received() []*forwardMessage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*forwardMessage(nil), s.messages...)
+}
+
+func (s *forwardServer) configure(f func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f()
+}
+
+func FluentdForwardOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A FluentdForwardOutput", func() {
+		server := newForwardServer(nil)
+		defer server.listener.Close()
+
+		output := new(FluentdForwardOutput)
+		config := output.ConfigStruct().(*FluentdForwardOutputConfig)
+		config.Address = server.listener.Addr().String()
+		config.FlushCount = 2
+
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		var cursor string
+		or.EXPECT().UpdateCursor(gomock.Any()).Do(func(c string) {
+			cursor = c
+		}).AnyTimes()
+
+		newPack := func(payload, tag, queueCursor string) *PipelinePack {
+			pack := NewPipelinePack(nil)
+			pack.Message.SetType("test")
+			pack.Message.SetTimestamp(time.Unix(1500000000, 5).UnixNano())
+			pack.Message.SetPayload(payload)
+			if tag != "" {
+				message.NewStringField(pack.Message, "Tag", tag)
+			}
+			message.NewInt64Field(pack.Message, "status", 200, "")
+			message.NewNestedFieldOnMessage(pack.Message, "kubernetes",
+				map[string]interface{}{"pod": "web-1"})
+			pack.QueueCursor = queueCursor
+			return pack
+		}
+
+		c.Specify("sends chunks once they're acknowledged", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("one", "", "c1")), gs.IsNil)
+			c.Expect(len(server.received()), gs.Equals, 0)
+			c.Expect(output.ProcessMessage(newPack("two", "", "c2")), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c2")
+
+			received := server.received()
+			c.Expect(len(received), gs.Equals, 1)
+			m := received[0]
+			c.Expect(m.tag, gs.Equals, "heka")
+			c.Expect(len(m.entries), gs.Equals, 2)
+			c.Expect(m.option["size"], gs.Equals, int64(2))
+			entry := m.entries[1]
+			c.Expect(entry.time.Equal(time.Unix(1500000000, 5)), gs.IsTrue)
+			c.Expect(entry.record["message"], gs.Equals, "two")
+			c.Expect(entry.record["status"], gs.Equals, int64(200))
+			c.Expect(entry.record["kubernetes"].(map[string]interface{})["pod"],
+				gs.Equals, "web-1")
+			c.Expect(entry.record["type"], gs.Equals, nil)
+			output.CleanUp()
+		})
+
+		c.Specify("sends a chunk for each tag", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			config.FlushCount = 10
+			config.Compress = true
+			config.IncludeHeaders = true
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			for i, tag := range []string{"app.a", "app.a", "app.b"} {
+				c.Expect(output.ProcessMessage(newPack("x", tag, strconv.Itoa(i))), gs.IsNil)
+			}
+			c.Expect(cursor, gs.Equals, "1")
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "2")
+
+			received := server.received()
+			c.Expect(len(received), gs.Equals, 2)
+			c.Expect(received[0].tag, gs.Equals, "app.a")
+			c.Expect(len(received[0].entries), gs.Equals, 2)
+			c.Expect(received[0].option["compressed"], gs.Equals, "gzip")
+			c.Expect(received[1].tag, gs.Equals, "app.b")
+			record := received[1].entries[0].record
+			c.Expect(record["type"], gs.Equals, "test")
+			c.Expect(record["Tag"], gs.Equals, nil)
+			output.CleanUp()
+		})
+
+		c.Specify("sends chunks again on a new connection", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			or.EXPECT().LogError(gomock.Any())
+			server.configure(func() { server.drop = 1 })
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("one", "", "c1")), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("two", "", "c2")), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "")
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c2")
+			c.Expect(len(server.received()), gs.Equals, 1)
+			c.Expect(output.reconnects, gs.Equals, int64(1))
+			output.CleanUp()
+		})
+
+		c.Specify("retries messages while it can't send", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			or.EXPECT().LogError(gomock.Any())
+			server.listener.Close()
+			config.FlushCount = 1
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("one", "", "c1")), gs.IsNil)
+			err := output.ProcessMessage(newPack("two", "", "c2"))
+			_, ok := err.(RetryMessageError)
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(output.waiting, gs.Equals, int64(1))
+		})
+
+		c.Specify("sends the encoder's output", func() {
+			encoder := new(plugins.PayloadEncoder)
+			encoder.Init(encoder.ConfigStruct())
+			or.EXPECT().Encoder().Return(encoder).AnyTimes()
+			or.EXPECT().Encode(gomock.Any()).Return([]byte("encoded"), nil).AnyTimes()
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("one", "app.web", "c1")), gs.IsNil)
+			output.CleanUp()
+			received := server.received()
+			c.Expect(len(received), gs.Equals, 1)
+			c.Expect(received[0].tag, gs.Equals, "app.web")
+			record := received[0].entries[0].record
+			c.Expect(record["message"], gs.Equals, "encoded")
+			c.Expect(len(record), gs.Equals, 1)
+		})
+
+		c.Specify("authenticates with the shared key", func() {
+			authServer := newForwardServer(&forwardAuth{sharedKey: "secret",
+				hostname: "aggregator", users: map[string]string{"alice": "pass"}})
+			defer authServer.listener.Close()
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			config.Address = authServer.listener.Addr().String()
+			config.SharedKey = "secret"
+			config.SelfHostname = "web1"
+			config.Username = "alice"
+			config.Password = "pass"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("one", "", "c1")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(len(authServer.received()), gs.Equals, 1)
+
+			or.EXPECT().LogError(gomock.Any())
+			output.disconnect()
+			config.Password = "wrong"
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("two", "", "c2")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+		})
+
+		c.Specify("checks its settings", func() {
+			config.Username = "alice"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.Username = ""
+			config.FlushCount = 0
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,325 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package fluentd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"time"
+)
+
+// An event: its time and record.
+type forwardEntry struct {
+	time   time.Time
+	record map[string]interface{}
+}
+
+// A forward protocol message, with the tag of its entries and its options,
+// such as the "chunk" id to acknowledge.
+type forwardMessage struct {
+	tag     string
+	entries []forwardEntry
+	option  map[string]interface{}
+}
+
+// Returns the string or bin value as bytes, and whether it was either.
+func toBytes(v interface{}) ([]byte, bool) {
+	switch t := v.(type) {
+	case string:
+		return []byte(t), true
+	case []byte:
+		return t, true
+	}
+	return nil, false
+}
+
+// Returns the string or bin value as a string, and whether it was either.
+func toString(v interface{}) (string, bool) {
+	b, ok := toBytes(v)
+	return string(b), ok
+}
+
+func parseTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case int64:
+		return time.Unix(t, 0), nil
+	case uint64:
+		return time.Unix(int64(t), 0), nil
+	case float64:
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	return time.Time{}, fmt.Errorf("bad event time %v", v)
+}
+
+func parseEntry(v interface{}) (forwardEntry, error) {
+	a, ok := v.([]interface{})
+	if !ok || len(a) < 2 {
+		return forwardEntry{}, errors.New("entry isn't a [time, record] array")
+	}
+	t, err := parseTime(a[0])
+	if err != nil {
+		return forwardEntry{}, err
+	}
+	record, ok := a[1].(map[string]interface{})
+	if !ok {
+		return forwardEntry{}, errors.New("record isn't a map")
+	}
+	return forwardEntry{t, record}, nil
+}
+
+// Parses the entries of a PackedForward message, gzipped in a
+// CompressedPackedForward message, of at most max bytes uncompressed.
+func parseEntries(data []byte, compressed bool, max int) ([]forwardEntry, error) {
+	if compressed {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("can't decompress entries: %s", err)
+		}
+		// Gzip streams can be concatenated, gzip.Reader reads them all.
+		if data, err = ioutil.ReadAll(io.LimitReader(gz, int64(max)+1)); err != nil {
+			return nil, fmt.Errorf("can't decompress entries: %s", err)
+		}
+		if len(data) > max {
+			return nil, errors.New("entries are too big")
+		}
+	}
+	var entries []forwardEntry
+	d := newMsgpackReader(bytes.NewReader(data), max)
+	for {
+		v, err := d.read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad entry: %s", err)
+		}
+		entry, err := parseEntry(v)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Parses a message in any of the protocol's modes: Message, [tag, time,
+// record, option], Forward, [tag, [[time, record], ...], option], and
+// PackedForward, [tag, entries, option], with the entries concatenated,
+// gzipped if the option's "compressed" is "gzip".
+func parseForward(v interface{}, max int) (*forwardMessage, error) {
+	a, ok := v.([]interface{})
+	if !ok || len(a) < 2 {
+		return nil, errors.New("message isn't an array")
+	}
+	m := new(forwardMessage)
+	if m.tag, ok = toString(a[0]); !ok {
+		return nil, errors.New("tag isn't a string")
+	}
+	optionAt := 2
+	if _, ok := a[1].([]interface{}); !ok {
+		if _, ok := toBytes(a[1]); !ok {
+			// Message mode.
+			optionAt = 3
+		}
+	}
+	if len(a) > optionAt && a[optionAt] != nil {
+		if m.option, ok = a[optionAt].(map[string]interface{}); !ok {
+			return nil, errors.New("option isn't a map")
+		}
+	}
+
+	switch entries := a[1].(type) {
+	case []interface{}:
+		for _, e := range entries {
+			entry, err := parseEntry(e)
+			if err != nil {
+				return nil, err
+			}
+			m.entries = append(m.entries, entry)
+		}
+	case string, []byte:
+		data, _ := toBytes(entries)
+		compression, _ := toString(m.option["compressed"])
+		if compression != "" && compression != "gzip" && compression != "text" {
+			return nil, fmt.Errorf("unsupported compression '%s'", compression)
+		}
+		var err error
+		if m.entries, err = parseEntries(data, compression == "gzip", max); err != nil {
+			return nil, err
+		}
+	default:
+		entry, err := parseEntry(a[1:])
+		if err != nil {
+			return nil, err
+		}
+		m.entries = []forwardEntry{entry}
+	}
+	return m, nil
+}
+
+// Returns the id of the chunk the message asks to be acknowledged.
+func (m *forwardMessage) chunk() (string, bool) {
+	return toString(m.option["chunk"])
+}
+
+// Returns the hex SHA-512 digest of the parts.
+func digest(parts ...[]byte) string {
+	h := sha512.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func writeValue(conn net.Conn, v interface{}) error {
+	_, err := conn.Write(appendValue(nil, v))
+	return err
+}
+
+// Shared key authentication settings: the key and the hostname sent with
+// proofs of knowing it, with the users a server accepts, and the username
+// and password a client logs in as.
+type forwardAuth struct {
+	sharedKey string
+	hostname  string
+	users     map[string]string
+	username  string
+	password  string
+}
+
+// Authenticates a client, returning the hostname it gave. The server sends
+// HELO with a nonce and, if it has users, a salt for the password digest.
+// The client answers PING with its hostname, a salt, and the digests of the
+// shared key and its password, and the server's PONG says whether they
+// match, proving it knows the shared key too.
+func (a *forwardAuth) serverHandshake(conn net.Conn, r *msgpackReader) (string, error) {
+	nonce := randomBytes(16)
+	authSalt := []byte{}
+	if len(a.users) > 0 {
+		authSalt = randomBytes(16)
+	}
+	err := writeValue(conn, []interface{}{"HELO", map[string]interface{}{
+		"nonce":     nonce,
+		"auth":      authSalt,
+		"keepalive": true,
+	}})
+	if err != nil {
+		return "", err
+	}
+	v, err := r.read()
+	if err != nil {
+		return "", err
+	}
+	ping, ok := v.([]interface{})
+	if !ok || len(ping) < 6 {
+		return "", errors.New("expected PING")
+	}
+	var parts [6][]byte
+	for i := range parts {
+		if parts[i], ok = toBytes(ping[i]); !ok {
+			return "", errors.New("bad PING")
+		}
+	}
+	if string(parts[0]) != "PING" {
+		return "", errors.New("expected PING")
+	}
+	hostname, salt := parts[1], parts[2]
+	var reason string
+	switch {
+	case string(hostname) == a.hostname:
+		reason = "same hostname between input and output: invalid configuration"
+	case string(parts[3]) != digest(salt, hostname, nonce, []byte(a.sharedKey)):
+		reason = "shared_key mismatch"
+	case len(a.users) > 0:
+		password, ok := a.users[string(parts[4])]
+		if !ok || string(parts[5]) != digest(authSalt, parts[4], []byte(password)) {
+			reason = "username/password mismatch"
+		}
+	}
+	pong := []interface{}{"PONG", reason == "", reason, "", ""}
+	if reason == "" {
+		pong[3] = a.hostname
+		pong[4] = digest(salt, []byte(a.hostname), nonce, []byte(a.sharedKey))
+	}
+	if err = writeValue(conn, pong); err != nil {
+		return "", err
+	}
+	if reason != "" {
+		return "", fmt.Errorf("authentication failed: %s", reason)
+	}
+	return string(hostname), nil
+}
+
+// Authenticates with a server, the other side of serverHandshake.
+func (a *forwardAuth) clientHandshake(conn net.Conn, r *msgpackReader) error {
+	v, err := r.read()
+	if err != nil {
+		return err
+	}
+	helo, ok := v.([]interface{})
+	if !ok || len(helo) < 2 || helo[0] != "HELO" {
+		return errors.New("expected HELO")
+	}
+	options, _ := helo[1].(map[string]interface{})
+	nonce, _ := toBytes(options["nonce"])
+	authSalt, _ := toBytes(options["auth"])
+	salt := []byte(hex.EncodeToString(randomBytes(16)))
+	var username, password string
+	if len(authSalt) > 0 {
+		username = a.username
+		password = digest(authSalt, []byte(a.username), []byte(a.password))
+	}
+	err = writeValue(conn, []interface{}{"PING", a.hostname, string(salt),
+		digest(salt, []byte(a.hostname), nonce, []byte(a.sharedKey)), username, password})
+	if err != nil {
+		return err
+	}
+	if v, err = r.read(); err != nil {
+		return err
+	}
+	pong, ok := v.([]interface{})
+	if !ok || len(pong) < 5 || pong[0] != "PONG" {
+		return errors.New("expected PONG")
+	}
+	if authenticated, _ := pong[1].(bool); !authenticated {
+		reason, _ := toString(pong[2])
+		return fmt.Errorf("server refused authentication: %s", reason)
+	}
+	serverHostname, _ := toBytes(pong[3])
+	serverDigest, _ := toString(pong[4])
+	if serverDigest != digest(salt, serverHostname, nonce, []byte(a.sharedKey)) {
+		return errors.New("server's shared_key digest doesn't match")
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package fluentd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func decodeValue(data []byte, max int) (interface{}, error) {
+	return newMsgpackReader(bytes.NewReader(data), max).read()
+}
+
+func gzipped(data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	gz.Close()
+	return buf.Bytes()
+}
+
+// Does the handshake over a pipe, returning the hostname the server got
+// and both ends' errors.
+func handshake(server, client *forwardAuth) (string, error, error) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	var hostname string
+	var serverErr error
+	done := make(chan bool)
+	go func() {
+		hostname, serverErr = server.serverHandshake(serverConn,
+			newMsgpackReader(serverConn, 1024))
+		// The client may still be reading a PONG it won't get.
+		serverConn.Close()
+		close(done)
+	}()
+	clientErr := client.clientHandshake(clientConn, newMsgpackReader(clientConn, 1024))
+	<-done
+	return hostname, serverErr, clientErr
+}
+
+func ForwardSpec(c gs.Context) {
+	eventTime := time.Unix(1500000000, 5)
+
+	c.Specify("MessagePack", func() {
+		c.Specify("encodes values", func() {
+			encoded := appendValue(nil, map[string]interface{}{
+				"b": []interface{}{true, nil},
+				"a": 1,
+			})
+			c.Expect(fmt.Sprintf("% x", encoded), gs.Equals,
+				"82 a1 61 01 a1 62 92 c3 c0")
+			c.Expect(fmt.Sprintf("% x", appendValue(nil, 300)), gs.Equals, "cd 01 2c")
+			c.Expect(fmt.Sprintf("% x", appendValue(nil, -1)), gs.Equals, "ff")
+			c.Expect(fmt.Sprintf("% x", appendValue(nil, -200)), gs.Equals, "d1 ff 38")
+			c.Expect(fmt.Sprintf("% x", appendValue(nil, 1.5)), gs.Equals,
+				"cb 3f f8 00 00 00 00 00 00")
+			c.Expect(fmt.Sprintf("% x", appendValue(nil, eventTime)), gs.Equals,
+				"d7 00 59 68 2f 00 00 00 00 05")
+			c.Expect(fmt.Sprintf("% x", appendValue(nil, []byte{1}))[:5], gs.Equals,
+				"c4 01")
+			c.Expect(fmt.Sprintf("% x", appendValue(nil, strings.Repeat("x", 40)))[:5],
+				gs.Equals, "d9 28")
+		})
+
+		c.Specify("decodes what it encodes", func() {
+			values := []interface{}{
+				nil, true, false, int64(0), int64(127), int64(-32), int64(-33),
+				int64(255), int64(65536), int64(1) << 40, int64(-1) << 40,
+				uint64(1) << 63, 1.5, "", strings.Repeat("x", 300),
+				[]byte(strings.Repeat("y", 70000)), eventTime,
+			}
+			for _, v := range values {
+				decoded, err := decodeValue(appendValue(nil, v), 1<<20)
+				c.Expect(err, gs.IsNil)
+				if t, ok := v.(time.Time); ok {
+					c.Expect(decoded.(time.Time).Equal(t), gs.IsTrue)
+					continue
+				}
+				c.Expect(fmt.Sprintf("%#v", decoded), gs.Equals, fmt.Sprintf("%#v", v))
+			}
+			long := make([]interface{}, 20)
+			for i := range long {
+				long[i] = int64(i)
+			}
+			decoded, err := decodeValue(appendValue(nil, map[string]interface{}{
+				"long": long}), 1024)
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(decoded.(map[string]interface{})["long"].([]interface{})),
+				gs.Equals, 20)
+			// Float32 and integer keys.
+			decoded, err = decodeValue([]byte{0x81, 0x07, 0xca, 0x3f, 0xc0, 0, 0}, 1024)
+			c.Expect(err, gs.IsNil)
+			c.Expect(decoded.(map[string]interface{})["7"], gs.Equals, 1.5)
+		})
+
+		c.Specify("refuses values that are too big", func() {
+			_, err := decodeValue(appendValue(nil, strings.Repeat("x", 100)), 50)
+			c.Expect(err, gs.Equals, errTooBig)
+			// A huge length with no data after it.
+			_, err = decodeValue([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, 1024)
+			c.Expect(err, gs.Equals, errTooBig)
+			_, err = decodeValue(bytes.Repeat([]byte{0x91}, 200), 1024)
+			c.Expect(err.Error(), gs.Equals, "values are nested too deeply")
+		})
+
+		c.Specify("reports truncated values", func() {
+			_, err := newMsgpackReader(bytes.NewReader(nil), 1024).read()
+			c.Expect(err.Error(), gs.Equals, "EOF")
+			_, err = decodeValue([]byte{0x92, 0x01}, 1024)
+			c.Expect(err.Error(), gs.Equals, "unexpected EOF")
+			_, err = decodeValue([]byte{0xc1}, 1024)
+			c.Expect(err.Error(), gs.Equals, "bad MessagePack type 0xc1")
+			_, err = decodeValue([]byte{0xd4, 0x05, 0x00}, 1024)
+			c.Expect(err.Error(), gs.Equals, "unsupported extension type 5")
+		})
+	})
+
+	c.Specify("The forward protocol", func() {
+		record := map[string]interface{}{"log": "hi"}
+
+		c.Specify("parses Message mode", func() {
+			m, err := parseForward([]interface{}{"app.web", eventTime, record,
+				map[string]interface{}{"chunk": "abc"}}, 1024)
+			c.Expect(err, gs.IsNil)
+			c.Expect(m.tag, gs.Equals, "app.web")
+			c.Expect(len(m.entries), gs.Equals, 1)
+			c.Expect(m.entries[0].time.Equal(eventTime), gs.IsTrue)
+			c.Expect(m.entries[0].record["log"], gs.Equals, "hi")
+			chunk, ok := m.chunk()
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(chunk, gs.Equals, "abc")
+
+			m, err = parseForward([]interface{}{"app", int64(1500000000), record}, 1024)
+			c.Expect(err, gs.IsNil)
+			c.Expect(m.entries[0].time.Unix(), gs.Equals, int64(1500000000))
+			_, ok = m.chunk()
+			c.Expect(ok, gs.IsFalse)
+		})
+
+		c.Specify("parses Forward mode", func() {
+			m, err := parseForward([]interface{}{"app", []interface{}{
+				[]interface{}{eventTime, record},
+				[]interface{}{int64(1), map[string]interface{}{"log": "there"}},
+			}}, 1024)
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(m.entries), gs.Equals, 2)
+			c.Expect(m.entries[1].record["log"], gs.Equals, "there")
+		})
+
+		c.Specify("parses PackedForward mode", func() {
+			var entries []byte
+			for i := 0; i < 3; i++ {
+				entries = appendValue(entries, []interface{}{eventTime, record})
+			}
+			m, err := parseForward([]interface{}{"app", entries,
+				map[string]interface{}{"size": 3}}, 1024)
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(m.entries), gs.Equals, 3)
+
+			// Concatenated gzip streams, as fluentd's compressed chunks are.
+			compressed := append(gzipped(entries[:len(entries)/3]),
+				gzipped(entries[len(entries)/3:])...)
+			m, err = parseForward([]interface{}{"app", compressed,
+				map[string]interface{}{"compressed": "gzip"}}, 1024)
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(m.entries), gs.Equals, 3)
+
+			_, err = parseForward([]interface{}{"app", gzipped(make([]byte, 2000)),
+				map[string]interface{}{"compressed": "gzip"}}, 1024)
+			c.Expect(err.Error(), gs.Equals, "entries are too big")
+			_, err = parseForward([]interface{}{"app", entries,
+				map[string]interface{}{"compressed": "zstd"}}, 1024)
+			c.Expect(err.Error(), gs.Equals, "unsupported compression 'zstd'")
+		})
+
+		c.Specify("refuses bad messages", func() {
+			for _, v := range []interface{}{
+				"app",
+				[]interface{}{int64(1), eventTime, record},
+				[]interface{}{"app", eventTime, "record"},
+				[]interface{}{"app", "not msgpack \xc1"},
+				[]interface{}{"app", []interface{}{int64(1)}},
+				[]interface{}{"app", eventTime, record, "option"},
+			} {
+				_, err := parseForward(v, 1024)
+				c.Expect(err, gs.Not(gs.IsNil))
+			}
+		})
+
+		c.Specify("digests the handshake's parts", func() {
+			c.Expect(digest([]byte("salt"), []byte("client"), []byte("nonce"),
+				[]byte("secret")), gs.Equals,
+				"1be50de88fcdae1f5a9ec876b6dec05a03596b2d7d5659d9dbbdc6bc667ccbac"+
+					"885295aee591cc7189d951779e7667fc849666b14de832ed73f8434db768409c")
+		})
+
+		c.Specify("authenticates with the shared key", func() {
+			server := &forwardAuth{sharedKey: "secret", hostname: "aggregator"}
+			client := &forwardAuth{sharedKey: "secret", hostname: "web1"}
+			hostname, serverErr, clientErr := handshake(server, client)
+			c.Expect(serverErr, gs.IsNil)
+			c.Expect(clientErr, gs.IsNil)
+			c.Expect(hostname, gs.Equals, "web1")
+
+			client.sharedKey = "wrong"
+			_, serverErr, clientErr = handshake(server, client)
+			c.Expect(serverErr.Error(), gs.Equals, "authentication failed: shared_key mismatch")
+			c.Expect(clientErr.Error(), gs.Equals,
+				"server refused authentication: shared_key mismatch")
+		})
+
+		c.Specify("authenticates users", func() {
+			server := &forwardAuth{sharedKey: "secret", hostname: "aggregator",
+				users: map[string]string{"alice": "pass"}}
+			client := &forwardAuth{sharedKey: "secret", hostname: "web1",
+				username: "alice", password: "pass"}
+			_, serverErr, clientErr := handshake(server, client)
+			c.Expect(serverErr, gs.IsNil)
+			c.Expect(clientErr, gs.IsNil)
+
+			client.password = "wrong"
+			_, serverErr, clientErr = handshake(server, client)
+			c.Expect(serverErr.Error(), gs.Equals,
+				"authentication failed: username/password mismatch")
+			c.Expect(clientErr, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("checks the server knows the shared key", func() {
+			serverConn, clientConn := net.Pipe()
+			defer serverConn.Close()
+			defer clientConn.Close()
+			go func() {
+				r := newMsgpackReader(serverConn, 1024)
+				writeValue(serverConn, []interface{}{"HELO",
+					map[string]interface{}{"nonce": []byte("nonce")}})
+				r.read()
+				writeValue(serverConn, []interface{}{"PONG", true, "", "fake", "digest"})
+			}()
+			client := &forwardAuth{sharedKey: "secret", hostname: "web1"}
+			err := client.clientHandshake(clientConn, newMsgpackReader(clientConn, 1024))
+			c.Expect(err.Error(), gs.Equals, "server's shared_key digest doesn't match")
+		})
+	})
+}
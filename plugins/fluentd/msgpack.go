@@ -0,0 +1,365 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package fluentd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Deepest nesting of arrays and maps decoded.
+const maxDepth = 100
+
+// MessagePack extension type of fluentd's EventTime.
+const eventTimeType = 0
+
+var errTooBig = errors.New("value is too big")
+
+// Reads MessagePack values, each of at most max bytes. Maps are decoded as
+// map[string]interface{}, with other keys formatted as strings, str as
+// string, bin as []byte, integers as int64, or uint64 if they're too big,
+// floats as float64 and EventTime extensions as time.Time.
+type msgpackReader struct {
+	r   *bufio.Reader
+	max int
+	// Bytes left of the value being read.
+	left int
+}
+
+func newMsgpackReader(r io.Reader, max int) *msgpackReader {
+	return &msgpackReader{r: bufio.NewReader(r), max: max}
+}
+
+// Reads the next value, returning io.EOF if the stream ends before it.
+func (d *msgpackReader) read() (interface{}, error) {
+	if _, err := d.r.Peek(1); err != nil {
+		return nil, err
+	}
+	d.left = d.max
+	v, err := d.value(0)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return v, err
+}
+
+func (d *msgpackReader) take(n int) ([]byte, error) {
+	if n > d.left {
+		return nil, errTooBig
+	}
+	d.left -= n
+	b := make([]byte, n)
+	_, err := io.ReadFull(d.r, b)
+	return b, err
+}
+
+// Reads a big-endian unsigned integer of n bytes.
+func (d *msgpackReader) uint(n int) (uint64, error) {
+	b, err := d.take(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (d *msgpackReader) length(n int) (int, error) {
+	u, err := d.uint(n)
+	if err != nil {
+		return 0, err
+	}
+	if u > uint64(d.left) {
+		return 0, errTooBig
+	}
+	return int(u), nil
+}
+
+func (d *msgpackReader) value(depth int) (interface{}, error) {
+	b, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.mapOf(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.arrayOf(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.take(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.length(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if u > math.MaxInt64 {
+			return u, err
+		}
+		return int64(u), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		u, err := d.uint(1 << (c - 0xd0))
+		switch c {
+		case 0xd0:
+			return int64(int8(u)), err
+		case 0xd1:
+			return int64(int16(u)), err
+		case 0xd2:
+			return int64(int32(u)), err
+		}
+		return int64(u), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayOf(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(n, depth)
+	}
+	return nil, fmt.Errorf("bad MessagePack type 0x%x", c)
+}
+
+func (d *msgpackReader) str(n int) (interface{}, error) {
+	b, err := d.take(n)
+	return string(b), err
+}
+
+func (d *msgpackReader) ext(n int) (interface{}, error) {
+	b, err := d.take(n + 1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] != eventTimeType || n != 8 {
+		return nil, fmt.Errorf("unsupported extension type %d", int8(b[0]))
+	}
+	return time.Unix(int64(binary.BigEndian.Uint32(b[1:5])),
+		int64(binary.BigEndian.Uint32(b[5:9]))), nil
+}
+
+func (d *msgpackReader) arrayOf(n, depth int) (interface{}, error) {
+	if depth == maxDepth {
+		return nil, errors.New("values are nested too deeply")
+	}
+	// Each element takes a byte at least, so n's bounded by what's left.
+	if n > d.left {
+		return nil, errTooBig
+	}
+	a := make([]interface{}, 0, minInt(n, 1024))
+	for ; n > 0; n-- {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func (d *msgpackReader) mapOf(n, depth int) (interface{}, error) {
+	if depth == maxDepth {
+		return nil, errors.New("values are nested too deeply")
+	}
+	if n > d.left/2 {
+		return nil, errTooBig
+	}
+	m := make(map[string]interface{}, minInt(n, 1024))
+	for ; n > 0; n-- {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		switch key := k.(type) {
+		case string:
+			m[key] = v
+		case []byte:
+			m[string(key)] = v
+		default:
+			m[fmt.Sprint(key)] = v
+		}
+	}
+	return m, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Appends the MessagePack encoding of the value, which may be nil, a bool,
+// an int, int64, uint64 or float64, a string, a []byte, a time.Time, encoded
+// as an EventTime, or a []interface{} or map[string]interface{} of them.
+// Anything else is encoded as its fmt.Sprint string. Maps are encoded with
+// their keys sorted.
+func appendValue(b []byte, v interface{}) []byte {
+	switch t := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if t {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		return appendInt(b, int64(t))
+	case int64:
+		return appendInt(b, t)
+	case uint64:
+		if t > math.MaxInt64 {
+			return appendUint(append(b, 0xcf), t, 8)
+		}
+		return appendInt(b, int64(t))
+	case float64:
+		return appendUint(append(b, 0xcb), math.Float64bits(t), 8)
+	case string:
+		return append(appendLength(b, len(t), 0xa0, 0xd9), t...)
+	case []byte:
+		return append(appendLength(b, len(t), 0, 0xc4), t...)
+	case time.Time:
+		b = append(b, 0xd7, eventTimeType)
+		b = appendUint(b, uint64(t.Unix()), 4)
+		return appendUint(b, uint64(t.Nanosecond()), 4)
+	case []interface{}:
+		b = appendHeader(b, len(t), 0x90, 0xdc)
+		for _, e := range t {
+			b = appendValue(b, e)
+		}
+		return b
+	case map[string]interface{}:
+		b = appendHeader(b, len(t), 0x80, 0xde)
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b = appendValue(appendValue(b, k), t[k])
+		}
+		return b
+	}
+	return appendValue(b, fmt.Sprint(v))
+}
+
+func appendInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		return append(b, byte(i))
+	case i >= -32 && i < 0:
+		return append(b, byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		return append(b, 0xcc, byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		return appendUint(append(b, 0xcd), uint64(i), 2)
+	case i >= 0 && i <= math.MaxUint32:
+		return appendUint(append(b, 0xce), uint64(i), 4)
+	case i >= 0:
+		return appendUint(append(b, 0xcf), uint64(i), 8)
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return appendUint(append(b, 0xd1), uint64(i), 2)
+	case i >= math.MinInt32:
+		return appendUint(append(b, 0xd2), uint64(i), 4)
+	}
+	return appendUint(append(b, 0xd3), uint64(i), 8)
+}
+
+// Appends the low n bytes of u, big-endian.
+func appendUint(b []byte, u uint64, n int) []byte {
+	for shift := uint(8 * (n - 1)); n > 0; n, shift = n-1, shift-8 {
+		b = append(b, byte(u>>shift))
+	}
+	return b
+}
+
+// Appends a str or bin length: with the fix type if it's set and the length
+// fits, or the 8 bit type, or the 16 and 32 bit types that follow it.
+func appendLength(b []byte, n int, fix, type8 byte) []byte {
+	switch {
+	case fix != 0 && n < 32:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, type8, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint(append(b, type8+1), uint64(n), 2)
+	}
+	return appendUint(append(b, type8+2), uint64(n), 4)
+}
+
+// Appends an array or map header: with the fix type if the length fits, or
+// the 16 and 32 bit types.
+func appendHeader(b []byte, n int, fix, type16 byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return appendUint(append(b, type16), uint64(n), 2)
+	}
+	return appendUint(append(b, type16+1), uint64(n), 4)
+}
@@ -0,0 +1,153 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package gcp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	httpPlugin "heka/plugins/http"
+)
+
+// Compute Engine metadata server's token endpoint for the instance's
+// default service account.
+const metadataTokenUrl = "http://metadata.google.internal/computeMetadata/v1/" +
+	"instance/service-accounts/default/token"
+
+// The fields of a service account key file that sign the token requests.
+type serviceAccountKey struct {
+	Type        string `json:"type"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenUri    string `json:"token_uri"`
+}
+
+// Fetches OAuth2 access tokens for a scope, either with a service account
+// key's signed JWT assertion or from the metadata server, caching each until
+// shortly before it expires.
+type googleToken struct {
+	*httpPlugin.TokenCache
+	scope    string
+	email    string
+	key      *rsa.PrivateKey
+	tokenUri string
+}
+
+// Returns a token source for the service account key file, or for the
+// instance's service account if the file name is empty.
+func newGoogleToken(keyFile, scope string, client *http.Client) (*googleToken, error) {
+	g := &googleToken{scope: scope, tokenUri: metadataTokenUrl}
+	g.TokenCache = &httpPlugin.TokenCache{Client: client, NewRequest: g.newRequest}
+	if keyFile == "" {
+		return g, nil
+	}
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't read credentials_file: %s", err)
+	}
+	var sa serviceAccountKey
+	if err = json.Unmarshal(data, &sa); err != nil {
+		return nil, fmt.Errorf("can't decode credentials_file '%s': %s", keyFile, err)
+	}
+	if sa.Type != "service_account" || sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, fmt.Errorf("credentials_file '%s' isn't a service account key",
+			keyFile)
+	}
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("credentials_file '%s' has no PEM private key", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("can't parse the private key: %s", err)
+		}
+	}
+	var ok bool
+	if g.key, ok = parsed.(*rsa.PrivateKey); !ok {
+		return nil, errors.New("the private key isn't an RSA key")
+	}
+	g.email = sa.ClientEmail
+	g.tokenUri = sa.TokenUri
+	if g.tokenUri == "" {
+		g.tokenUri = "https://oauth2.googleapis.com/token"
+	}
+	return g, nil
+}
+
+// Returns an RS256 signed JWT asserting the service account's identity, for
+// the jwt-bearer grant.
+func (g *googleToken) assertion(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   g.email,
+		"scope": g.scope,
+		"aud":   g.tokenUri,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, g.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+// Returns a token request, signed with the service account key if there is
+// one and otherwise for the metadata server.
+func (g *googleToken) newRequest() (*http.Request, error) {
+	if g.key == nil {
+		tokenUrl := g.tokenUri + "?scopes=" + url.QueryEscape(g.scope)
+		req, err := http.NewRequest("GET", tokenUrl, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		return req, nil
+	}
+	assertion, err := g.assertion(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("can't sign token request: %s", err)
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequest("POST", g.tokenUri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
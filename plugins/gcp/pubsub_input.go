@@ -0,0 +1,542 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+// OAuth2 scope of the Pub/Sub API.
+const pubsubScope = "https://www.googleapis.com/auth/pubsub"
+
+// Most ack ids sent in one acknowledge or modifyAckDeadline request.
+const maxAckIds = 1000
+
+type GooglePubSubInputConfig struct {
+	// Project the subscription belongs to, unless the subscription is given
+	// as "projects/<project>/subscriptions/<name>".
+	Project      string `toml:"project"`
+	Subscription string `toml:"subscription"`
+	// Service account key file. Defaults to the GOOGLE_APPLICATION_CREDENTIALS
+	// environment variable's, or the Compute Engine instance's service
+	// account.
+	CredentialsFile string `toml:"credentials_file"`
+	// Base URL of the Pub/Sub API. Defaults to "https://pubsub.googleapis.com",
+	// or the emulator at PUBSUB_EMULATOR_HOST if that's set.
+	Endpoint string `toml:"endpoint"`
+	// Most messages asked for by one pull. Defaults to 100.
+	MaxMessages uint `toml:"max_messages"`
+	// Flow control: pulling pauses while this many messages, or this many
+	// bytes of message data, are waiting for their delivery to be acked.
+	// Default to 1000 and 100MiB.
+	MaxOutstandingMessages uint `toml:"max_outstanding_messages"`
+	MaxOutstandingBytes    uint `toml:"max_outstanding_bytes"`
+	// Seconds the ack deadlines of outstanding messages are extended by,
+	// before they run out. Defaults to 60.
+	AckDeadline uint `toml:"ack_deadline"`
+	// Seconds each API request may take, pulls included. Defaults to 90.
+	Timeout  uint `toml:"timeout"`
+	Splitter string
+}
+
+// A message received from a pull.
+type receivedMessage struct {
+	AckId string `json:"ackId"`
+	// Set only for subscriptions with a dead letter policy.
+	DeliveryAttempt int64 `json:"deliveryAttempt"`
+	Message         struct {
+		Data        []byte            `json:"data"`
+		Attributes  map[string]string `json:"attributes"`
+		MessageId   string            `json:"messageId"`
+		PublishTime time.Time         `json:"publishTime"`
+		OrderingKey string            `json:"orderingKey"`
+	} `json:"message"`
+}
+
+// Input plugin that pulls messages from a Google Cloud Pub/Sub subscription,
+// acking each once it's been delivered to the router.
+type GooglePubSubInput struct {
+	conf     *GooglePubSubInputConfig
+	name     string
+	subsUrl  string
+	token    *googleToken
+	client   *http.Client
+	stopChan chan bool
+
+	// Messages pulled that haven't been acked or nacked, with their sizes and
+	// the number of each ordering key's. Delivery of an ordering key is
+	// suspended from a nack until its outstanding messages are redelivered.
+	lock             sync.Mutex
+	capacity         *sync.Cond
+	stopping         bool
+	outstanding      map[string]int
+	outstandingBytes int
+	keyCounts        map[string]int
+	failedKeys       map[string]bool
+	acks, nacks      []string
+
+	// Accessed atomically, for the reports.
+	processMessageCount    int64
+	processMessageFailures int64
+	nackCount              int64
+	requestFailures        int64
+}
+
+func (i *GooglePubSubInput) ConfigStruct() interface{} {
+	return &GooglePubSubInputConfig{
+		MaxMessages:            100,
+		MaxOutstandingMessages: 1000,
+		MaxOutstandingBytes:    100 * 1024 * 1024,
+		AckDeadline:            60,
+		Timeout:                90,
+		Splitter:               "NullSplitter",
+	}
+}
+
+func (i *GooglePubSubInput) SetName(name string) {
+	i.name = name
+}
+
+func (i *GooglePubSubInput) Init(config interface{}) (err error) {
+	i.conf = config.(*GooglePubSubInputConfig)
+	conf := i.conf
+	subscription := conf.Subscription
+	if subscription == "" {
+		return errors.New("subscription must be set")
+	}
+	if !strings.HasPrefix(subscription, "projects/") {
+		if conf.Project == "" {
+			return errors.New("project must be set, or a full subscription path")
+		}
+		subscription = fmt.Sprintf("projects/%s/subscriptions/%s", conf.Project,
+			subscription)
+	}
+	if conf.MaxMessages == 0 || conf.MaxOutstandingMessages == 0 ||
+		conf.MaxOutstandingBytes == 0 {
+
+		return errors.New("max_messages and the max_outstanding settings must be " +
+			"greater than 0")
+	}
+	if conf.AckDeadline < 10 || conf.AckDeadline > 600 {
+		return errors.New("ack_deadline must be from 10 to 600 seconds")
+	}
+	i.client = &http.Client{Timeout: time.Duration(conf.Timeout) * time.Second}
+
+	endpoint := conf.Endpoint
+	if emulator := os.Getenv("PUBSUB_EMULATOR_HOST"); endpoint == "" && emulator != "" {
+		// The emulator doesn't authenticate.
+		endpoint = "http://" + emulator
+	} else {
+		if endpoint == "" {
+			endpoint = "https://pubsub.googleapis.com"
+		}
+		keyFile := conf.CredentialsFile
+		if keyFile == "" {
+			keyFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		}
+		if i.token, err = newGoogleToken(keyFile, pubsubScope, i.client); err != nil {
+			return err
+		}
+	}
+	i.subsUrl = strings.TrimRight(endpoint, "/") + "/v1/" + subscription
+
+	i.capacity = sync.NewCond(&i.lock)
+	i.outstanding = make(map[string]int)
+	i.keyCounts = make(map[string]int)
+	i.failedKeys = make(map[string]bool)
+	i.stopChan = make(chan bool)
+	return nil
+}
+
+// An error response of the API, permanent unless it's for a request the
+// service couldn't serve just then.
+type pubsubError struct {
+	status    string
+	body      string
+	permanent bool
+}
+
+func (e *pubsubError) Error() string {
+	return fmt.Sprintf("Pub/Sub responded %s: %s", e.status, e.body)
+}
+
+// Posts a JSON request to one of the subscription's methods, decoding the
+// response into result if it isn't nil.
+func (i *GooglePubSubInput) call(ctx context.Context, method string,
+	params, result interface{}) error {
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", i.subsUrl+":"+method,
+			bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if i.token != nil {
+			token, err := i.token.Get()
+			if err != nil {
+				return fmt.Errorf("can't get access token: %s", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := i.client.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && i.token != nil && attempt == 0 {
+			// The token may have been revoked, try a fresh one.
+			i.token.Invalidate()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			code := resp.StatusCode
+			return &pubsubError{
+				status: resp.Status,
+				body:   strings.TrimSpace(string(respBody)),
+				permanent: code >= 400 && code < 500 && code != http.StatusRequestTimeout &&
+					code != http.StatusTooManyRequests,
+			}
+		}
+		if result == nil {
+			return nil
+		}
+		if err = json.Unmarshal(respBody, result); err != nil {
+			return fmt.Errorf("can't decode %s response: %s", method, err)
+		}
+		return nil
+	}
+}
+
+// Sends the ack ids to the method in batches the API accepts.
+func (i *GooglePubSubInput) callAckIds(ctx context.Context, ir InputRunner,
+	method string, ackIds []string, deadline uint) {
+
+	for len(ackIds) > 0 {
+		n := len(ackIds)
+		if n > maxAckIds {
+			n = maxAckIds
+		}
+		params := map[string]interface{}{"ackIds": ackIds[:n]}
+		if method == "modifyAckDeadline" {
+			params["ackDeadlineSeconds"] = deadline
+		}
+		if err := i.call(ctx, method, params, nil); err != nil {
+			atomic.AddInt64(&i.requestFailures, 1)
+			ir.LogError(fmt.Errorf("%s of %d messages failed: %s", method, n, err))
+		}
+		ackIds = ackIds[n:]
+	}
+}
+
+// Settles an outstanding message, queueing its ack or nack and freeing its
+// share of the flow control limits.
+func (i *GooglePubSubInput) settle(msg *receivedMessage, ack bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if ack {
+		i.acks = append(i.acks, msg.AckId)
+	} else {
+		i.nacks = append(i.nacks, msg.AckId)
+		atomic.AddInt64(&i.nackCount, 1)
+	}
+	i.outstandingBytes -= i.outstanding[msg.AckId]
+	delete(i.outstanding, msg.AckId)
+	if key := msg.Message.OrderingKey; key != "" {
+		if i.keyCounts[key]--; i.keyCounts[key] <= 0 {
+			delete(i.keyCounts, key)
+			delete(i.failedKeys, key)
+		}
+	}
+	i.capacity.Broadcast()
+}
+
+// Sends the queued acks and nacks, and extends the deadlines of the
+// outstanding messages if extend is set.
+func (i *GooglePubSubInput) flush(ctx context.Context, ir InputRunner, extend bool) {
+	i.lock.Lock()
+	acks, nacks := i.acks, i.nacks
+	i.acks, i.nacks = nil, nil
+	var leased []string
+	if extend {
+		leased = make([]string, 0, len(i.outstanding))
+		for ackId := range i.outstanding {
+			leased = append(leased, ackId)
+		}
+	}
+	i.lock.Unlock()
+
+	i.callAckIds(ctx, ir, "acknowledge", acks, 0)
+	// A zero deadline makes the messages available for redelivery at once.
+	i.callAckIds(ctx, ir, "modifyAckDeadline", nacks, 0)
+	i.callAckIds(ctx, ir, "modifyAckDeadline", leased, i.conf.AckDeadline)
+}
+
+// Sends the acks and nacks every second, and extends the outstanding
+// messages' deadlines when half of the last extension has passed, until the
+// context is done.
+func (i *GooglePubSubInput) lease(ctx context.Context, ir InputRunner) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	extendEvery := time.Duration(i.conf.AckDeadline) * time.Second / 2
+	lastExtended := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			extend := time.Since(lastExtended) >= extendEvery
+			if extend {
+				lastExtended = time.Now()
+			}
+			i.flush(ctx, ir, extend)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Pulls messages while the flow control limits allow, until the context is
+// done or a request fails permanently.
+func (i *GooglePubSubInput) pull(ctx context.Context, ir InputRunner,
+	received chan<- *receivedMessage, errChan chan<- error) {
+
+	maxOutstanding := int(i.conf.MaxOutstandingMessages)
+	for {
+		i.lock.Lock()
+		for !i.stopping && (len(i.outstanding) >= maxOutstanding ||
+			i.outstandingBytes >= int(i.conf.MaxOutstandingBytes)) {
+
+			i.capacity.Wait()
+		}
+		stopping := i.stopping
+		n := maxOutstanding - len(i.outstanding)
+		i.lock.Unlock()
+		if stopping {
+			return
+		}
+		if n > int(i.conf.MaxMessages) {
+			n = int(i.conf.MaxMessages)
+		}
+
+		var result struct {
+			ReceivedMessages []*receivedMessage `json:"receivedMessages"`
+		}
+		err := i.call(ctx, "pull", map[string]interface{}{"maxMessages": n}, &result)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				// A long poll that nothing arrived for.
+				continue
+			}
+			atomic.AddInt64(&i.requestFailures, 1)
+			if psErr, ok := err.(*pubsubError); ok && psErr.permanent {
+				errChan <- fmt.Errorf("can't pull: %s", err)
+				return
+			}
+			ir.LogError(fmt.Errorf("pull failed: %s", err))
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		i.lock.Lock()
+		for _, msg := range result.ReceivedMessages {
+			i.outstanding[msg.AckId] = len(msg.Message.Data)
+			i.outstandingBytes += len(msg.Message.Data)
+			if key := msg.Message.OrderingKey; key != "" {
+				i.keyCounts[key]++
+			}
+		}
+		i.lock.Unlock()
+		// The channel holds as many messages as may be outstanding, so this
+		// never blocks.
+		for _, msg := range result.ReceivedMessages {
+			received <- msg
+		}
+	}
+}
+
+// Delivers a message, then queues its ack, or its nack if it can be delivered
+// again later.
+func (i *GooglePubSubInput) deliver(ir InputRunner, sRunner SplitterRunner,
+	msg *receivedMessage) {
+
+	key := msg.Message.OrderingKey
+	i.lock.Lock()
+	suspended := key != "" && i.failedKeys[key]
+	i.lock.Unlock()
+	if suspended {
+		// Redelivered after the message it follows.
+		i.settle(msg, false)
+		return
+	}
+
+	atomic.AddInt64(&i.processMessageCount, 1)
+	data := msg.Message.Data
+	n, err := sRunner.SplitBytes(data, nil)
+	if err != nil {
+		atomic.AddInt64(&i.processMessageFailures, 1)
+		if msg.DeliveryAttempt == 0 {
+			// Without a dead letter policy it'd be redelivered forever.
+			ir.LogError(fmt.Errorf("dropped message %s: %s", msg.Message.MessageId, err))
+			i.settle(msg, true)
+			return
+		}
+		ir.LogError(fmt.Errorf("nacked message %s, delivery attempt %d: %s",
+			msg.Message.MessageId, msg.DeliveryAttempt, err))
+		if key != "" {
+			i.lock.Lock()
+			i.failedKeys[key] = true
+			i.lock.Unlock()
+		}
+		i.settle(msg, false)
+		return
+	}
+	if n > 0 && n != len(data) {
+		ir.LogError(fmt.Errorf("extra data dropped in message %s", msg.Message.MessageId))
+	}
+	i.settle(msg, true)
+}
+
+func (i *GooglePubSubInput) Run(ir InputRunner, h PluginHelper) (err error) {
+	hostname := h.PipelineConfig().Hostname()
+	subscription := i.subsUrl[strings.Index(i.subsUrl, "/v1/")+4:]
+	sRunner := ir.NewSplitterRunner("")
+	defer sRunner.Done()
+	var current *receivedMessage
+	if !sRunner.UseMsgBytes() {
+		sRunner.SetPackDecorator(func(pack *PipelinePack) {
+			pack.Message.SetType("heka.pubsub")
+			pack.Message.SetLogger(i.name)
+			pack.Message.SetHostname(hostname)
+			msg := current.Message
+			message.NewStringField(pack.Message, "Subscription", subscription)
+			message.NewStringField(pack.Message, "MessageId", msg.MessageId)
+			if !msg.PublishTime.IsZero() {
+				message.NewTimestampField(pack.Message, "PublishTime", msg.PublishTime)
+			}
+			if msg.OrderingKey != "" {
+				message.NewStringField(pack.Message, "OrderingKey", msg.OrderingKey)
+			}
+			if current.DeliveryAttempt > 0 {
+				message.NewInt64Field(pack.Message, "DeliveryAttempt",
+					current.DeliveryAttempt, "count")
+			}
+			for name, value := range msg.Attributes {
+				message.NewStringField(pack.Message, name, value)
+			}
+		})
+	}
+
+	i.lock.Lock()
+	i.stopping = false
+	i.lock.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan *receivedMessage, i.conf.MaxOutstandingMessages)
+	errChan := make(chan error, 1)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		i.pull(ctx, ir, received, errChan)
+		wg.Done()
+	}()
+	go func() {
+		i.lease(ctx, ir)
+		wg.Done()
+	}()
+
+	defer func() {
+		cancel()
+		i.lock.Lock()
+		i.stopping = true
+		i.capacity.Broadcast()
+		i.lock.Unlock()
+		wg.Wait()
+		// Hand back what wasn't delivered, and send the last acks.
+		close(received)
+		for msg := range received {
+			i.settle(msg, false)
+		}
+		i.flush(context.Background(), ir, false)
+	}()
+
+	for {
+		select {
+		case current = <-received:
+			i.deliver(ir, sRunner, current)
+		case err = <-errChan:
+			return err
+		case <-i.stopChan:
+			return nil
+		}
+	}
+}
+
+func (i *GooglePubSubInput) Stop() {
+	close(i.stopChan)
+}
+
+func (i *GooglePubSubInput) CleanupForRestart() {
+	i.stopChan = make(chan bool)
+}
+
+func (i *GooglePubSubInput) ReportMsg(msg *message.Message) error {
+	i.lock.Lock()
+	outstanding, outstandingBytes := len(i.outstanding), i.outstandingBytes
+	i.lock.Unlock()
+	message.NewInt64Field(msg, "ProcessMessageCount",
+		atomic.LoadInt64(&i.processMessageCount), "count")
+	message.NewInt64Field(msg, "ProcessMessageFailures",
+		atomic.LoadInt64(&i.processMessageFailures), "count")
+	message.NewInt64Field(msg, "NackCount", atomic.LoadInt64(&i.nackCount), "count")
+	message.NewInt64Field(msg, "RequestFailures",
+		atomic.LoadInt64(&i.requestFailures), "count")
+	message.NewInt64Field(msg, "OutstandingMessages", int64(outstanding), "count")
+	message.NewInt64Field(msg, "OutstandingBytes", int64(outstandingBytes), "B")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("GooglePubSubInput", func() interface{} {
+		return new(GooglePubSubInput)
+	})
+}
@@ -0,0 +1,341 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package gcp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+// A test Pub/Sub service for the subscription "projects/p/subscriptions/s",
+// recording the requests it gets.
+type pubsubServer struct {
+	*httptest.Server
+	lock        sync.Mutex
+	queue       []map[string]interface{}
+	maxMessages []int
+	acks        []string
+	nacks       []string
+	pullStatus  int
+	auth        string
+}
+
+func newPubsubServer() *pubsubServer {
+	s := &pubsubServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Queues a message for the pulls.
+func (s *pubsubServer) publish(ackId, data, key string, attempt int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	msg := map[string]interface{}{"ackId": ackId, "message": map[string]interface{}{
+		"data":        base64.StdEncoding.EncodeToString([]byte(data)),
+		"messageId":   "id-" + ackId,
+		"publishTime": "2015-06-01T12:00:00.5Z",
+		"orderingKey": key,
+		"attributes":  map[string]string{"origin": "test"},
+	}}
+	if attempt > 0 {
+		msg["deliveryAttempt"] = attempt
+	}
+	s.queue = append(s.queue, msg)
+}
+
+func (s *pubsubServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var params struct {
+		MaxMessages        int      `json:"maxMessages"`
+		AckIds             []string `json:"ackIds"`
+		AckDeadlineSeconds *int     `json:"ackDeadlineSeconds"`
+	}
+	json.NewDecoder(r.Body).Decode(&params)
+	s.auth = r.Header.Get("Authorization")
+	switch r.URL.Path {
+	case "/v1/projects/p/subscriptions/s:pull":
+		if s.pullStatus != 0 {
+			w.WriteHeader(s.pullStatus)
+			fmt.Fprint(w, `{"error": {"status": "NOT_FOUND"}}`)
+			return
+		}
+		s.maxMessages = append(s.maxMessages, params.MaxMessages)
+		n := params.MaxMessages
+		if n > len(s.queue) {
+			n = len(s.queue)
+		}
+		if n == 0 {
+			// Hold the long poll a little.
+			s.lock.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			s.lock.Lock()
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"receivedMessages": s.queue[:n]})
+		s.queue = s.queue[n:]
+	case "/v1/projects/p/subscriptions/s:acknowledge":
+		s.acks = append(s.acks, params.AckIds...)
+		fmt.Fprint(w, "{}")
+	case "/v1/projects/p/subscriptions/s:modifyAckDeadline":
+		if *params.AckDeadlineSeconds == 0 {
+			s.nacks = append(s.nacks, params.AckIds...)
+		}
+		fmt.Fprint(w, "{}")
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Returns the acks and nacks the server has received.
+func (s *pubsubServer) settled() (acks, nacks string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return strings.Join(s.acks, ","), strings.Join(s.nacks, ",")
+}
+
+func GooglePubSubInputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A GooglePubSubInput", func() {
+		server := newPubsubServer()
+		defer server.Close()
+		os.Setenv("PUBSUB_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+		defer os.Unsetenv("PUBSUB_EMULATOR_HOST")
+
+		input := new(GooglePubSubInput)
+		input.SetName("PubSub")
+		config := input.ConfigStruct().(*GooglePubSubInputConfig)
+		config.Project = "p"
+		config.Subscription = "s"
+
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		ir := pipelinemock.NewMockInputRunner(ctrl)
+		delivered := make(chan *PipelinePack, 10)
+		var splitErr error
+
+		// Runs the input, with a splitter that sends the decorated packs it'd
+		// deliver to the delivered channel, and returns splitErr.
+		run := func() chan error {
+			h.EXPECT().PipelineConfig().Return(pConfig)
+			sr := pipelinemock.NewMockSplitterRunner(ctrl)
+			ir.EXPECT().NewSplitterRunner("").Return(sr)
+			sr.EXPECT().UseMsgBytes().Return(false)
+			var decorate func(*PipelinePack)
+			sr.EXPECT().SetPackDecorator(gomock.Any()).Do(func(f func(*PipelinePack)) {
+				decorate = f
+			})
+			sr.EXPECT().SplitBytes(gomock.Any(), nil).Do(func(data []byte, del Deliverer) {
+				pack := NewPipelinePack(nil)
+				pack.Message.SetPayload(string(data))
+				decorate(pack)
+				delivered <- pack
+			}).Return(0, splitErr).AnyTimes()
+			sr.EXPECT().Done()
+
+			done := make(chan error, 1)
+			go func() {
+				done <- input.Run(ir, h)
+			}()
+			return done
+		}
+		// Waits for the server to have the acks and nacks.
+		waitSettled := func(acks, nacks string) {
+			for start := time.Now(); time.Since(start) < 3*time.Second; {
+				if a, n := server.settled(); a == acks && n == nacks {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			a, n := server.settled()
+			c.Expect(a, gs.Equals, acks)
+			c.Expect(n, gs.Equals, nacks)
+		}
+
+		c.Specify("delivers messages and acks them", func() {
+			server.publish("a1", "hello", "", 0)
+			c.Assume(input.Init(config), gs.IsNil)
+			c.Expect(input.token == nil, gs.IsTrue)
+			done := run()
+			pack := <-delivered
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "hello")
+			c.Expect(pack.Message.GetType(), gs.Equals, "heka.pubsub")
+			c.Expect(pack.Message.GetLogger(), gs.Equals, "PubSub")
+			value, _ := pack.Message.GetFieldValue("Subscription")
+			c.Expect(value, gs.Equals, "projects/p/subscriptions/s")
+			value, _ = pack.Message.GetFieldValue("MessageId")
+			c.Expect(value, gs.Equals, "id-a1")
+			value, _ = pack.Message.GetFieldValue("origin")
+			c.Expect(value, gs.Equals, "test")
+			c.Expect(pack.Message.FindFirstField("PublishTime") != nil, gs.IsTrue)
+			c.Expect(pack.Message.FindFirstField("DeliveryAttempt") == nil, gs.IsTrue)
+			waitSettled("a1", "")
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+		})
+
+		c.Specify("limits the outstanding messages", func() {
+			config.MaxOutstandingMessages = 2
+			for _, id := range []string{"a1", "a2", "a3"} {
+				server.publish(id, id, "", 0)
+			}
+			c.Assume(input.Init(config), gs.IsNil)
+			done := run()
+			for n := 0; n < 3; n++ {
+				<-delivered
+			}
+			waitSettled("a1,a2,a3", "")
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+			server.lock.Lock()
+			for _, max := range server.maxMessages {
+				c.Expect(max <= 2, gs.IsTrue)
+			}
+			server.lock.Unlock()
+		})
+
+		c.Specify("when a delivery fails", func() {
+			splitErr = errors.New("no good")
+			ir.EXPECT().LogError(gomock.Any())
+
+			c.Specify("drops it without a dead letter policy", func() {
+				server.publish("a1", "x", "", 0)
+				c.Assume(input.Init(config), gs.IsNil)
+				done := run()
+				<-delivered
+				waitSettled("a1", "")
+				input.Stop()
+				c.Expect(<-done, gs.IsNil)
+			})
+
+			c.Specify("nacks it and the rest of its ordering key", func() {
+				server.publish("a1", "x", "k", 3)
+				server.publish("a2", "y", "k", 1)
+				server.publish("a3", "z", "other", 1)
+				ir.EXPECT().LogError(gomock.Any())
+				c.Assume(input.Init(config), gs.IsNil)
+				done := run()
+				pack := <-delivered
+				value, _ := pack.Message.GetFieldValue("DeliveryAttempt")
+				c.Expect(value, gs.Equals, int64(3))
+				pack = <-delivered
+				c.Expect(pack.Message.GetPayload(), gs.Equals, "z")
+				waitSettled("", "a1,a2,a3")
+				input.Stop()
+				c.Expect(<-done, gs.IsNil)
+				c.Expect(len(input.failedKeys), gs.Equals, 0)
+			})
+		})
+
+		c.Specify("stops on a permanent error", func() {
+			server.pullStatus = http.StatusNotFound
+			c.Assume(input.Init(config), gs.IsNil)
+			err := <-run()
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(strings.Contains(err.Error(), "404"), gs.IsTrue)
+		})
+
+		c.Specify("authenticates with a service account key", func() {
+			os.Unsetenv("PUBSUB_EMULATOR_HOST")
+			key, err := rsa.GenerateKey(rand.Reader, 1024)
+			c.Assume(err, gs.IsNil)
+			tokenServer := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					r.ParseForm()
+					parts := strings.Split(r.Form.Get("assertion"), ".")
+					c.Assume(len(parts), gs.Equals, 3)
+					claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+					c.Expect(strings.Contains(string(claims), `"iss":"heka@p.iam"`),
+						gs.IsTrue)
+					sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+					digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+					if rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:],
+						sig) != nil {
+
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					fmt.Fprint(w, `{"access_token": "tok", "expires_in": 3600}`)
+				}))
+			defer tokenServer.Close()
+
+			der, _ := x509.MarshalPKCS8PrivateKey(key)
+			keyJson, _ := json.Marshal(map[string]string{
+				"type":         "service_account",
+				"client_email": "heka@p.iam",
+				"private_key": string(pem.EncodeToMemory(
+					&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+				"token_uri": tokenServer.URL,
+			})
+			dir, _ := ioutil.TempDir("", "pubsub")
+			defer os.RemoveAll(dir)
+			config.CredentialsFile = filepath.Join(dir, "key.json")
+			c.Assume(ioutil.WriteFile(config.CredentialsFile, keyJson, 0600), gs.IsNil)
+			config.Endpoint = server.URL
+
+			server.publish("a1", "hello", "", 0)
+			c.Assume(input.Init(config), gs.IsNil)
+			done := run()
+			<-delivered
+			waitSettled("a1", "")
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+			c.Expect(server.auth, gs.Equals, "Bearer tok")
+		})
+
+		c.Specify("rejects", func() {
+			c.Specify("a config without a subscription", func() {
+				config.Subscription = ""
+				c.Expect(input.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("a subscription name without a project", func() {
+				config.Project = ""
+				c.Expect(input.Init(config), gs.Not(gs.IsNil))
+				config.Subscription = "projects/p/subscriptions/s"
+				c.Expect(input.Init(config), gs.IsNil)
+			})
+
+			c.Specify("an ack deadline out of range", func() {
+				config.AckDeadline = 5
+				c.Expect(input.Init(config), gs.Not(gs.IsNil))
+			})
+		})
+	})
+}
@@ -185,8 +185,22 @@ func (ld *GeoIpDecoder) Decode(pack *PipelinePack) (packs []*PipelinePack, err e
 	return
 }
 
+// Adds the GeoIP field as part of an input's processor chain, taking the
+// same settings as the decoder.
+type GeoIpProcessor struct {
+	GeoIpDecoder
+}
+
+func (gp *GeoIpProcessor) Process(pack *PipelinePack) (keep bool, err error) {
+	_, err = gp.Decode(pack)
+	return true, err
+}
+
 func init() {
 	RegisterPlugin("GeoIpDecoder", func() interface{} {
 		return new(GeoIpDecoder)
 	})
+	RegisterPlugin("GeoIpProcessor", func() interface{} {
+		return new(GeoIpProcessor)
+	})
 }
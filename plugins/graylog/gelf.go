@@ -0,0 +1,161 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package graylog
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"heka/message"
+)
+
+// Returns the additional field name for a Heka field name, with the
+// characters GELF doesn't allow replaced by underscores. Graylog refuses
+// "_id", so an "id" field becomes "_id_".
+func gelfFieldName(name string) string {
+	b := []byte("_")
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9',
+			ch == '_', ch == '.', ch == '-':
+			b = append(b, ch)
+		default:
+			b = append(b, '_')
+		}
+	}
+	if string(b) == "_id" {
+		return "_id_"
+	}
+	return string(b)
+}
+
+// Adds a value as additional fields, flattening objects into "_a_b" fields
+// the way Graylog's own inputs do. GELF values are strings or numbers, so
+// booleans become strings and arrays are JSON encoded.
+func addGelfValue(gelf map[string]interface{}, name string, v interface{}) {
+	switch t := v.(type) {
+	case nil:
+	case string, int64, float64:
+		gelf[name] = t
+	case bool:
+		if t {
+			gelf[name] = "true"
+		} else {
+			gelf[name] = "false"
+		}
+	case []byte:
+		if utf8.Valid(t) {
+			gelf[name] = string(t)
+		}
+	case map[string]interface{}:
+		for key, value := range t {
+			addGelfValue(gelf, name+gelfFieldName(key), value)
+		}
+	default:
+		if data, err := json.Marshal(t); err == nil {
+			gelf[name] = string(data)
+		}
+	}
+}
+
+// Returns a field's value: a nested field's structured value, a single
+// value, or an array of multiple values.
+func fieldValue(f *message.Field) interface{} {
+	if f.IsNested() {
+		if v, err := f.NestedValue(); err == nil {
+			return v
+		}
+	}
+	var values []interface{}
+	switch f.GetValueType() {
+	case message.Field_STRING:
+		for _, v := range f.ValueString {
+			values = append(values, v)
+		}
+	case message.Field_BYTES:
+		for _, v := range f.ValueBytes {
+			values = append(values, v)
+		}
+	case message.Field_INTEGER:
+		for _, v := range f.ValueInteger {
+			values = append(values, v)
+		}
+	case message.Field_DOUBLE:
+		for _, v := range f.ValueDouble {
+			values = append(values, v)
+		}
+	case message.Field_BOOL:
+		for _, v := range f.ValueBool {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// Returns the GELF 1.1 message for a Heka message, the payload's first line
+// as the short message and the whole payload as the full message if it has
+// more than one line. The message's severity is its syslog level, and its
+// type, logger, pid, uuid and fields are additional fields, with the static
+// fields overriding them.
+func gelfMessage(msg *message.Message, payload string,
+	staticFields map[string]string) map[string]interface{} {
+
+	host := msg.GetHostname()
+	if host == "" {
+		host = "unknown"
+	}
+	short := strings.TrimRight(payload, "\r\n")
+	if i := strings.IndexAny(short, "\r\n"); i >= 0 {
+		short = short[:i]
+	}
+	if strings.TrimSpace(short) == "" {
+		// Graylog refuses messages without a short message.
+		short = "-"
+	}
+	gelf := map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": short,
+		"timestamp":     float64(msg.GetTimestamp()/1e3) / 1e6,
+		"level":         msg.GetSeverity(),
+	}
+	if short != payload && payload != "" {
+		gelf["full_message"] = payload
+	}
+	if t := msg.GetType(); t != "" {
+		gelf["_type"] = t
+	}
+	if logger := msg.GetLogger(); logger != "" {
+		gelf["_logger"] = logger
+	}
+	if msg.Pid != nil {
+		gelf["_pid"] = int64(msg.GetPid())
+	}
+	if msg.Uuid != nil {
+		gelf["_uuid"] = msg.GetUuidString()
+	}
+	for _, f := range msg.Fields {
+		addGelfValue(gelf, gelfFieldName(f.GetName()), fieldValue(f))
+	}
+	for name, value := range staticFields {
+		gelf[gelfFieldName(name)] = value
+	}
+	return gelf
+}
@@ -0,0 +1,253 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package graylog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+	"heka/plugins/tcp"
+)
+
+type GelfOutputConfig struct {
+	// "tcp" or "http". Defaults to "tcp".
+	Protocol string `toml:"protocol"`
+	// "host:port" of a GELF TCP input, or the URL of a GELF HTTP input.
+	Address string `toml:"address"`
+	UseTls  bool   `toml:"use_tls"`
+	Tls     tcp.TlsConfig
+	// "gzip" or "deflate" to compress HTTP request bodies.
+	Compression string `toml:"compression"`
+	// Additional fields added to every message, e.g. an environment.
+	StaticFields map[string]string `toml:"static_fields"`
+	// Seconds to connect, or to send a message. Defaults to 10.
+	Timeout uint `toml:"timeout"`
+}
+
+// Output plugin that sends messages to Graylog as GELF 1.1 messages, over
+// TCP with each message null terminated or as HTTP requests, optionally
+// compressed. The message's severity becomes the GELF level and its fields
+// become additional fields, nested fields flattened as Graylog does.
+type GelfOutput struct {
+	conf    *GelfOutputConfig
+	or      OutputRunner
+	tlsConf *tls.Config
+	url     *url.URL
+	client  *http.Client
+	conn    net.Conn
+
+	// Accessed atomically, for the reports.
+	messagesSent int64
+	sendFailures int64
+	dropped      int64
+}
+
+func (o *GelfOutput) ConfigStruct() interface{} {
+	return &GelfOutputConfig{
+		Protocol: "tcp",
+		Timeout:  10,
+	}
+}
+
+func (o *GelfOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*GelfOutputConfig)
+	if o.conf.Address == "" {
+		return errors.New("address must be set")
+	}
+	timeout := time.Duration(o.conf.Timeout) * time.Second
+	switch o.conf.Protocol {
+	case "tcp":
+		if o.conf.Compression != "" {
+			return errors.New("GELF over TCP can't be compressed")
+		}
+		if o.conf.UseTls {
+			if o.tlsConf, err = tcp.CreateGoTlsConfig(&o.conf.Tls); err != nil {
+				return fmt.Errorf("TLS init error: %s", err)
+			}
+		}
+	case "http":
+		if o.url, err = url.Parse(o.conf.Address); err != nil {
+			return fmt.Errorf("can't parse URL '%s': %s", o.conf.Address, err)
+		}
+		if o.url.Scheme != "http" && o.url.Scheme != "https" {
+			return errors.New("address must be an http or https URL")
+		}
+		switch o.conf.Compression {
+		case "", "gzip", "deflate":
+		default:
+			return fmt.Errorf("unknown compression '%s'", o.conf.Compression)
+		}
+		o.client = &http.Client{Timeout: timeout}
+		if o.url.Scheme == "https" {
+			transport := &http.Transport{}
+			if transport.TLSClientConfig, err = tcp.CreateGoTlsConfig(&o.conf.Tls); err != nil {
+				return fmt.Errorf("TLS init error: %s", err)
+			}
+			o.client.Transport = transport
+		}
+	default:
+		return fmt.Errorf("unknown protocol '%s'", o.conf.Protocol)
+	}
+	return nil
+}
+
+func (o *GelfOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	o.or = or
+	return nil
+}
+
+func (o *GelfOutput) ProcessMessage(pack *PipelinePack) error {
+	payload := pack.Message.GetPayload()
+	if o.or.Encoder() != nil {
+		body, err := o.or.Encode(pack)
+		if err != nil || body == nil {
+			o.or.UpdateCursor(pack.QueueCursor)
+			if err != nil {
+				atomic.AddInt64(&o.dropped, 1)
+				return fmt.Errorf("can't encode: %s", err)
+			}
+			return nil
+		}
+		payload = string(body)
+	}
+	data, err := json.Marshal(gelfMessage(pack.Message, payload, o.conf.StaticFields))
+	if err != nil {
+		o.or.UpdateCursor(pack.QueueCursor)
+		atomic.AddInt64(&o.dropped, 1)
+		return fmt.Errorf("can't encode GELF message: %s", err)
+	}
+	if o.conf.Protocol == "tcp" {
+		err = o.write(data)
+	} else {
+		err = o.post(data)
+	}
+	if err != nil {
+		if _, ok := err.(refusedError); ok {
+			o.or.UpdateCursor(pack.QueueCursor)
+			atomic.AddInt64(&o.dropped, 1)
+			return err
+		}
+		atomic.AddInt64(&o.sendFailures, 1)
+		return NewRetryMessageError("%s", err)
+	}
+	atomic.AddInt64(&o.messagesSent, 1)
+	o.or.UpdateCursor(pack.QueueCursor)
+	return nil
+}
+
+// Writes a null terminated message, connecting first if needed.
+func (o *GelfOutput) write(data []byte) (err error) {
+	timeout := time.Duration(o.conf.Timeout) * time.Second
+	if o.conn == nil {
+		dialer := &net.Dialer{Timeout: timeout}
+		if o.tlsConf != nil {
+			o.conn, err = tls.DialWithDialer(dialer, "tcp", o.conf.Address, o.tlsConf)
+		} else {
+			o.conn, err = dialer.Dial("tcp", o.conf.Address)
+		}
+		if err != nil {
+			o.conn = nil
+			return fmt.Errorf("can't connect to %s: %s", o.conf.Address, err)
+		}
+	}
+	o.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err = o.conn.Write(append(data, 0)); err != nil {
+		o.conn.Close()
+		o.conn = nil
+		return fmt.Errorf("can't send to %s: %s", o.conf.Address, err)
+	}
+	return nil
+}
+
+// A request Graylog refused, which sending again won't help.
+type refusedError struct {
+	error
+}
+
+func (o *GelfOutput) post(data []byte) error {
+	var body bytes.Buffer
+	var w io.WriteCloser
+	switch o.conf.Compression {
+	case "gzip":
+		w = gzip.NewWriter(&body)
+	case "deflate":
+		w = zlib.NewWriter(&body)
+	}
+	if w != nil {
+		w.Write(data)
+		w.Close()
+	} else {
+		body.Write(data)
+	}
+	req, err := http.NewRequest("POST", o.url.String(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.conf.Compression != "" {
+		req.Header.Set("Content-Encoding", o.conf.Compression)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	text, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("request failed: %s: %s", resp.Status, bytes.TrimSpace(text))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusTooManyRequests {
+
+		return refusedError{err}
+	}
+	return err
+}
+
+func (o *GelfOutput) CleanUp() {
+	if o.conn != nil {
+		o.conn.Close()
+		o.conn = nil
+	}
+}
+
+func (o *GelfOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "MessagesSent", atomic.LoadInt64(&o.messagesSent), "count")
+	message.NewInt64Field(msg, "SendFailures", atomic.LoadInt64(&o.sendFailures), "count")
+	message.NewInt64Field(msg, "Dropped", atomic.LoadInt64(&o.dropped), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("GelfOutput", func() interface{} {
+		return new(GelfOutput)
+	})
+}
@@ -0,0 +1,214 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package graylog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func GelfOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newPack := func() *PipelinePack {
+		pack := NewPipelinePack(nil)
+		msg := pack.Message
+		msg.SetUuid([]byte("0123456789abcdef"))
+		msg.SetType("app.error")
+		msg.SetLogger("app")
+		msg.SetHostname("web1")
+		msg.SetSeverity(3)
+		msg.SetPid(42)
+		msg.SetTimestamp(time.Unix(1500000000, 123456789).UnixNano())
+		msg.SetPayload("boom\n  at main.go:10\n")
+		message.NewInt64Field(msg, "status", 500, "")
+		message.NewStringField(msg, "user id", "alice")
+		message.NewStringField(msg, "id", "x1")
+		f, _ := message.NewField("cached", true, "")
+		msg.AddField(f)
+		message.NewNestedFieldOnMessage(msg, "kubernetes", map[string]interface{}{
+			"pod":    "web-1",
+			"labels": map[string]interface{}{"app": "web"},
+			"ports":  []interface{}{80, 443},
+		})
+		pack.QueueCursor = "c1"
+		return pack
+	}
+
+	c.Specify("A GELF message", func() {
+		gelf := gelfMessage(newPack().Message, "boom\n  at main.go:10\n",
+			map[string]string{"env": "prod"})
+		c.Expect(gelf["version"], gs.Equals, "1.1")
+		c.Expect(gelf["host"], gs.Equals, "web1")
+		c.Expect(gelf["short_message"], gs.Equals, "boom")
+		c.Expect(gelf["full_message"], gs.Equals, "boom\n  at main.go:10\n")
+		c.Expect(gelf["timestamp"], gs.Equals, 1500000000.123456)
+		c.Expect(gelf["level"], gs.Equals, int32(3))
+		c.Expect(gelf["_type"], gs.Equals, "app.error")
+		c.Expect(gelf["_logger"], gs.Equals, "app")
+		c.Expect(gelf["_pid"], gs.Equals, int64(42))
+		c.Expect(gelf["_status"], gs.Equals, int64(500))
+		c.Expect(gelf["_user_id"], gs.Equals, "alice")
+		c.Expect(gelf["_id_"], gs.Equals, "x1")
+		c.Expect(gelf["_id"], gs.Equals, nil)
+		c.Expect(gelf["_cached"], gs.Equals, "true")
+		c.Expect(gelf["_kubernetes_pod"], gs.Equals, "web-1")
+		c.Expect(gelf["_kubernetes_labels_app"], gs.Equals, "web")
+		c.Expect(gelf["_kubernetes_ports"], gs.Equals, "[80,443]")
+		c.Expect(gelf["_env"], gs.Equals, "prod")
+
+		gelf = gelfMessage(new(message.Message), "", nil)
+		c.Expect(gelf["short_message"], gs.Equals, "-")
+		c.Expect(gelf["host"], gs.Equals, "unknown")
+		c.Expect(gelf["full_message"], gs.Equals, nil)
+	})
+
+	c.Specify("A GelfOutput", func() {
+		output := new(GelfOutput)
+		config := output.ConfigStruct().(*GelfOutputConfig)
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		or.EXPECT().Encoder().Return(nil).AnyTimes()
+		var cursor string
+		or.EXPECT().UpdateCursor(gomock.Any()).Do(func(c string) {
+			cursor = c
+		}).AnyTimes()
+
+		c.Specify("sends null terminated messages over TCP", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			c.Assume(err, gs.IsNil)
+			defer listener.Close()
+			received := make(chan map[string]interface{}, 2)
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					data, err := r.ReadBytes(0)
+					if err != nil {
+						return
+					}
+					var gelf map[string]interface{}
+					json.Unmarshal(data[:len(data)-1], &gelf)
+					received <- gelf
+				}
+			}()
+			config.Address = listener.Addr().String()
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack()), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack()), gs.IsNil)
+			gelf := <-received
+			c.Expect(gelf["short_message"], gs.Equals, "boom")
+			c.Expect(gelf["_status"], gs.Equals, float64(500))
+			c.Expect((<-received)["host"], gs.Equals, "web1")
+			c.Expect(cursor, gs.Equals, "c1")
+			output.CleanUp()
+		})
+
+		c.Specify("retries messages while it can't connect", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			c.Assume(err, gs.IsNil)
+			config.Address = listener.Addr().String()
+			listener.Close()
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			err = output.ProcessMessage(newPack())
+			_, ok := err.(RetryMessageError)
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(cursor, gs.Equals, "")
+		})
+
+		c.Specify("posts compressed messages over HTTP", func() {
+			var lock sync.Mutex
+			var encoding string
+			var gelf map[string]interface{}
+			status := http.StatusAccepted
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+				r *http.Request) {
+
+				lock.Lock()
+				defer lock.Unlock()
+				encoding = r.Header.Get("Content-Encoding")
+				gz, err := gzip.NewReader(r.Body)
+				if err == nil {
+					data, _ := ioutil.ReadAll(gz)
+					json.Unmarshal(data, &gelf)
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+			config.Protocol = "http"
+			config.Address = server.URL + "/gelf"
+			config.Compression = "gzip"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack()), gs.IsNil)
+			lock.Lock()
+			c.Expect(encoding, gs.Equals, "gzip")
+			c.Expect(gelf["_kubernetes_pod"], gs.Equals, "web-1")
+			c.Expect(cursor, gs.Equals, "c1")
+
+			cursor = ""
+			status = http.StatusServiceUnavailable
+			lock.Unlock()
+			err := output.ProcessMessage(newPack())
+			_, ok := err.(RetryMessageError)
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(cursor, gs.Equals, "")
+
+			lock.Lock()
+			status = http.StatusBadRequest
+			lock.Unlock()
+			err = output.ProcessMessage(newPack())
+			_, ok = err.(RetryMessageError)
+			c.Expect(ok, gs.IsFalse)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(output.dropped, gs.Equals, int64(1))
+		})
+
+		c.Specify("checks its settings", func() {
+			config.Address = "graylog:12201"
+			config.Compression = "gzip"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.Protocol = "udp"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.Protocol = "http"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.Address = "http://graylog:12201/gelf"
+			config.Compression = "zstd"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
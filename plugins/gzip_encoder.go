@@ -0,0 +1,49 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"heka/pipeline"
+)
+
+// A CompressionEncoder that always uses gzip.
+type GzipEncoder struct {
+	CompressionEncoder
+}
+
+type GzipEncoderConfig struct {
+	// Between 1 (fastest) and 9 (smallest), defaults to 6.
+	CompressionLevel int `toml:"compression_level"`
+}
+
+func (ge *GzipEncoder) ConfigStruct() interface{} {
+	return &GzipEncoderConfig{
+		CompressionLevel: 6,
+	}
+}
+
+func (ge *GzipEncoder) Init(config interface{}) (err error) {
+	conf := config.(*GzipEncoderConfig)
+	return ge.CompressionEncoder.Init(&CompressionEncoderConfig{
+		Codec:            "gzip",
+		CompressionLevel: conf.CompressionLevel,
+	})
+}
+
+func init() {
+	pipeline.RegisterPlugin("GzipEncoder", func() interface{} {
+		return new(GzipEncoder)
+	})
+}
@@ -0,0 +1,64 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"bytes"
+	"compress/gzip"
+	"heka/pipeline"
+	"io/ioutil"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func GzipEncoderSpec(c gs.Context) {
+
+	c.Specify("A GzipEncoder", func() {
+		encoder := new(GzipEncoder)
+		config := encoder.ConfigStruct().(*GzipEncoderConfig)
+		gunzip := func(input []byte) string {
+			reader, err := gzip.NewReader(bytes.NewReader(input))
+			c.Assume(err, gs.IsNil)
+			output, err := ioutil.ReadAll(reader)
+			c.Assume(err, gs.IsNil)
+			return string(output)
+		}
+
+		c.Specify("compresses the previous encoder's output", func() {
+			c.Assume(encoder.Init(config), gs.IsNil)
+			output, err := encoder.EncodeBytes([]byte("first"))
+			c.Expect(err, gs.IsNil)
+			c.Expect(gunzip(output), gs.Equals, "first")
+			// The output isn't clobbered by the next call.
+			_, err = encoder.EncodeBytes([]byte("second"))
+			c.Expect(err, gs.IsNil)
+			c.Expect(gunzip(output), gs.Equals, "first")
+		})
+
+		c.Specify("compresses the message bytes on its own", func() {
+			c.Assume(encoder.Init(config), gs.IsNil)
+			pack := pipeline.NewPipelinePack(make(chan *pipeline.PipelinePack, 1))
+			pack.MsgBytes = []byte("protobuf")
+			output, err := encoder.Encode(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(gunzip(output), gs.Equals, "protobuf")
+		})
+
+		c.Specify("rejects bad compression levels", func() {
+			config.CompressionLevel = 10
+			c.Expect(encoder.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,47 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	. "heka/pipeline"
+)
+
+// Replaces a message's hex encoded payload, in either case, with the bytes it
+// encodes.
+type HexDecoder struct{}
+
+func (hd *HexDecoder) Init(config interface{}) (err error) {
+	return
+}
+
+func (hd *HexDecoder) Decode(pack *PipelinePack) (packs []*PipelinePack, err error) {
+	var output []byte
+	payload := strings.TrimSpace(pack.Message.GetPayload())
+	if output, err = hex.DecodeString(payload); err != nil {
+		return nil, fmt.Errorf("can't decode hex payload: %s", err)
+	}
+	pack.Message.SetPayload(string(output))
+	return []*PipelinePack{pack}, nil
+}
+
+func init() {
+	RegisterPlugin("HexDecoder", func() interface{} {
+		return new(HexDecoder)
+	})
+}
@@ -0,0 +1,47 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"heka/pipeline"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func HexDecoderSpec(c gs.Context) {
+
+	c.Specify("A HexDecoder", func() {
+		decoder := new(HexDecoder)
+		c.Assume(decoder.Init(nil), gs.IsNil)
+		pack := pipeline.NewPipelinePack(make(chan *pipeline.PipelinePack, 1))
+
+		c.Specify("decodes either case", func() {
+			for _, payload := range []string{"fbff6869", "FBFF6869\n"} {
+				pack.Message.SetPayload(payload)
+				packs, err := decoder.Decode(pack)
+				c.Expect(err, gs.IsNil)
+				c.Expect(len(packs), gs.Equals, 1)
+				c.Expect(pack.Message.GetPayload(), gs.Equals,
+					string([]byte{0xfb, 0xff, 'h', 'i'}))
+			}
+		})
+
+		c.Specify("fails on invalid payloads", func() {
+			pack.Message.SetPayload("fbf")
+			_, err := decoder.Decode(pack)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,70 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"bytes"
+	"encoding/hex"
+	"heka/pipeline"
+)
+
+// Hex encodes the bytes produced by the previous encoder in an output's
+// encoder_chain, or the protobuf encoded message when used on its own.
+type HexEncoder struct {
+	config *HexEncoderConfig
+}
+
+type HexEncoderConfig struct {
+	Uppercase      bool `toml:"uppercase"`
+	AppendNewlines bool `toml:"append_newlines"`
+}
+
+func (he *HexEncoder) ConfigStruct() interface{} {
+	return new(HexEncoderConfig)
+}
+
+func (he *HexEncoder) Init(config interface{}) (err error) {
+	he.config = config.(*HexEncoderConfig)
+	return
+}
+
+func (he *HexEncoder) ContentType() string {
+	return "text/plain"
+}
+
+func (he *HexEncoder) Encode(pack *pipeline.PipelinePack) (output []byte, err error) {
+	return he.EncodeBytes(pack.MsgBytes)
+}
+
+func (he *HexEncoder) EncodeBytes(input []byte) (output []byte, err error) {
+	l := hex.EncodedLen(len(input))
+	if he.config.AppendNewlines {
+		output = make([]byte, l+1)
+		output[l] = '\n'
+	} else {
+		output = make([]byte, l)
+	}
+	hex.Encode(output, input)
+	if he.config.Uppercase {
+		copy(output, bytes.ToUpper(output[:l]))
+	}
+	return
+}
+
+func init() {
+	pipeline.RegisterPlugin("HexEncoder", func() interface{} {
+		return new(HexEncoder)
+	})
+}
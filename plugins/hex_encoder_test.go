@@ -0,0 +1,44 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func HexEncoderSpec(c gs.Context) {
+
+	c.Specify("A HexEncoder", func() {
+		encoder := new(HexEncoder)
+		config := encoder.ConfigStruct().(*HexEncoderConfig)
+		input := []byte{0xfb, 0xff, 'h', 'i'}
+
+		c.Specify("works with default config options", func() {
+			c.Assume(encoder.Init(config), gs.IsNil)
+			output, err := encoder.EncodeBytes(input)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(output), gs.Equals, "fbff6869")
+		})
+
+		c.Specify("honors uppercase and append_newlines", func() {
+			config.Uppercase = true
+			config.AppendNewlines = true
+			c.Assume(encoder.Init(config), gs.IsNil)
+			output, err := encoder.EncodeBytes(input)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(output), gs.Equals, "FBFF6869\n")
+		})
+	})
+}
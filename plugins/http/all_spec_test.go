@@ -23,9 +23,14 @@ func TestAllSpecs(t *testing.T) {
 	r := gospec.NewRunner()
 	r.Parallel = false
 
+	r.AddSpec(HttpAuthSpec)
 	r.AddSpec(HttpInputSpec)
 	r.AddSpec(HttpListenInputSpec)
 	r.AddSpec(HttpOutputSpec)
+	r.AddSpec(HttpPollerSpec)
+	r.AddSpec(IngestSpec)
+	r.AddSpec(JsonPathSpec)
+	r.AddSpec(TokenCacheSpec)
 
 	gospec.MainGoTest(r, t)
 }
@@ -0,0 +1,233 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package http
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"heka/plugins/tcp"
+)
+
+// Roles that can be granted to an authenticated client. An admin may do
+// anything a read-only client can.
+const (
+	RoleRead  = "read"
+	RoleAdmin = "admin"
+)
+
+// Authentication settings for HTTP endpoints, usually provided as an `auth`
+// subsection of a plugin's config.
+type HttpAuthConfig struct {
+	// One of "basic", "bearer", or "tls". Empty means no authentication.
+	Type string `toml:"type"`
+	// Basic auth users, keyed by username.
+	Users map[string]HttpAuthUser `toml:"users"`
+	// Bearer tokens, keyed by a name that identifies the token holder.
+	Tokens map[string]HttpAuthToken `toml:"tokens"`
+	// TLS client certificate name patterns (see TcpInput's `allowed_peers`),
+	// keyed by the role that matching clients are granted. Only certificates
+	// verified against the listener's client CAs are considered.
+	Peers map[string][]string `toml:"peers"`
+}
+
+type HttpAuthUser struct {
+	Password string `toml:"password"`
+	// Defaults to "read".
+	Role string `toml:"role"`
+}
+
+type HttpAuthToken struct {
+	Token string `toml:"token"`
+	// Defaults to "read".
+	Role string `toml:"role"`
+}
+
+// HttpAuthenticator wraps HTTP handlers so that requests are only served to
+// authenticated clients holding a sufficient role.
+type HttpAuthenticator struct {
+	conf      *HttpAuthConfig
+	peerRoles map[string]*tcp.PeerAuthorizer
+}
+
+func checkRole(role string) (string, error) {
+	switch role {
+	case "":
+		return RoleRead, nil
+	case RoleRead, RoleAdmin:
+		return role, nil
+	}
+	return "", fmt.Errorf("invalid role: %s", role)
+}
+
+// NewHttpAuthenticator validates the provided config, filling in default
+// roles, and returns an authenticator that uses it.
+func NewHttpAuthenticator(conf *HttpAuthConfig) (auth *HttpAuthenticator, err error) {
+	auth = &HttpAuthenticator{conf: conf}
+	switch conf.Type {
+	case "":
+	case "basic":
+		if len(conf.Users) == 0 {
+			return nil, fmt.Errorf("basic auth requires at least one user")
+		}
+		for name, user := range conf.Users {
+			if user.Role, err = checkRole(user.Role); err != nil {
+				return nil, fmt.Errorf("user '%s': %s", name, err)
+			}
+			conf.Users[name] = user
+		}
+	case "bearer":
+		if len(conf.Tokens) == 0 {
+			return nil, fmt.Errorf("bearer auth requires at least one token")
+		}
+		for name, token := range conf.Tokens {
+			if token.Token == "" {
+				return nil, fmt.Errorf("token '%s' is empty", name)
+			}
+			if token.Role, err = checkRole(token.Role); err != nil {
+				return nil, fmt.Errorf("token '%s': %s", name, err)
+			}
+			conf.Tokens[name] = token
+		}
+	case "tls":
+		if len(conf.Peers) == 0 {
+			return nil, fmt.Errorf("tls auth requires at least one peers entry")
+		}
+		auth.peerRoles = make(map[string]*tcp.PeerAuthorizer)
+		for role, patterns := range conf.Peers {
+			if _, err = checkRole(role); err != nil || role == "" {
+				return nil, fmt.Errorf("peers: invalid role: %s", role)
+			}
+			if len(patterns) == 0 {
+				continue
+			}
+			if auth.peerRoles[role], err = tcp.NewPeerAuthorizer(patterns, nil,
+				nil); err != nil {
+
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid auth type: %s", conf.Type)
+	}
+	return auth, nil
+}
+
+// CheckListener returns an error if the auth type can't be enforced by a
+// listener with the given TLS settings, i.e. "tls" auth on a listener that
+// doesn't verify client certificates against a client CA.
+func (c *HttpAuthConfig) CheckListener(useTls bool, tlsConf *tcp.TlsConfig) error {
+	if c.Type == "tls" && (!useTls || !tcp.VerifiesClients(tlsConf)) {
+		return fmt.Errorf("tls auth requires use_tls, a client_cafile and " +
+			"client_auth = \"RequireAndVerifyClientCert\"")
+	}
+	return nil
+}
+
+func secretsMatch(given, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// Authenticate returns the role granted to the request's client, or false if
+// the client couldn't be authenticated.
+func (a *HttpAuthenticator) Authenticate(r *http.Request) (role string, ok bool) {
+	switch a.conf.Type {
+	case "":
+		return RoleAdmin, true
+	case "basic":
+		username, password, found := r.BasicAuth()
+		if !found {
+			return "", false
+		}
+		if user, exists := a.conf.Users[username]; exists &&
+			secretsMatch(password, user.Password) {
+
+			return user.Role, true
+		}
+	case "bearer":
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			return "", false
+		}
+		given := strings.TrimSpace(header[len("Bearer "):])
+		for _, token := range a.conf.Tokens {
+			if secretsMatch(given, token.Token) {
+				return token.Role, true
+			}
+		}
+	case "tls":
+		// Only a chain the handshake verified against the client CAs says
+		// anything about who the client is.
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 ||
+			len(r.TLS.VerifiedChains[0]) == 0 {
+
+			return "", false
+		}
+		leaf := r.TLS.VerifiedChains[0][0]
+		state := tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{leaf},
+			VerifiedChains:   [][]*x509.Certificate{r.TLS.VerifiedChains[0]},
+		}
+		// Check the most privileged role first.
+		for _, role := range []string{RoleAdmin, RoleRead} {
+			if pa, exists := a.peerRoles[role]; exists {
+				if _, err := pa.Authorize(state); err == nil {
+					return role, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// RequiredRole returns the role needed to serve a request. Requests that
+// only read state need the read role, anything else requires admin.
+func RequiredRole(r *http.Request) string {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return RoleRead
+	}
+	return RoleAdmin
+}
+
+// Handler wraps the provided handler, responding with a 401 to clients that
+// can't be authenticated and a 403 to those lacking the required role.
+func (a *HttpAuthenticator) Handler(h http.Handler) http.Handler {
+	if a.conf.Type == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, ok := a.Authenticate(r)
+		if !ok {
+			switch a.conf.Type {
+			case "basic":
+				w.Header().Set("WWW-Authenticate", `Basic realm="heka"`)
+			case "bearer":
+				w.Header().Set("WWW-Authenticate", `Bearer realm="heka"`)
+			}
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		if RequiredRole(r) == RoleAdmin && role != RoleAdmin {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,160 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/plugins/tcp"
+)
+
+func HttpAuthSpec(c gs.Context) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+	serve := func(auth *HttpAuthenticator, req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		auth.Handler(okHandler).ServeHTTP(rec, req)
+		return rec
+	}
+
+	c.Specify("An HttpAuthenticator", func() {
+		conf := &HttpAuthConfig{}
+
+		c.Specify("allows everything w/o an auth type", func() {
+			auth, err := NewHttpAuthenticator(conf)
+			c.Assume(err, gs.IsNil)
+			req, _ := http.NewRequest("POST", "/", nil)
+			c.Expect(serve(auth, req).Code, gs.Equals, 200)
+		})
+
+		c.Specify("rejects an unknown auth type", func() {
+			conf.Type = "digest"
+			_, err := NewHttpAuthenticator(conf)
+			c.Expect(err.Error(), gs.Equals, "invalid auth type: digest")
+		})
+
+		c.Specify("using basic auth", func() {
+			conf.Type = "basic"
+			conf.Users = map[string]HttpAuthUser{
+				"viewer": {Password: "viewpass"},
+				"ops":    {Password: "opspass", Role: "admin"},
+			}
+			auth, err := NewHttpAuthenticator(conf)
+			c.Assume(err, gs.IsNil)
+
+			c.Specify("requires credentials", func() {
+				req, _ := http.NewRequest("GET", "/", nil)
+				rec := serve(auth, req)
+				c.Expect(rec.Code, gs.Equals, 401)
+				c.Expect(rec.Header().Get("WWW-Authenticate"), gs.Equals,
+					`Basic realm="heka"`)
+			})
+
+			c.Specify("rejects a bad password", func() {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.SetBasicAuth("viewer", "opspass")
+				c.Expect(serve(auth, req).Code, gs.Equals, 401)
+			})
+
+			c.Specify("defaults users to read-only", func() {
+				req, _ := http.NewRequest("GET", "/", nil)
+				req.SetBasicAuth("viewer", "viewpass")
+				c.Expect(serve(auth, req).Code, gs.Equals, 200)
+				req, _ = http.NewRequest("POST", "/", nil)
+				req.SetBasicAuth("viewer", "viewpass")
+				c.Expect(serve(auth, req).Code, gs.Equals, 403)
+			})
+
+			c.Specify("allows admins to modify", func() {
+				req, _ := http.NewRequest("POST", "/", nil)
+				req.SetBasicAuth("ops", "opspass")
+				c.Expect(serve(auth, req).Code, gs.Equals, 200)
+			})
+		})
+
+		c.Specify("rejects an invalid role", func() {
+			conf.Type = "basic"
+			conf.Users = map[string]HttpAuthUser{"ops": {Password: "x", Role: "root"}}
+			_, err := NewHttpAuthenticator(conf)
+			c.Expect(err.Error(), gs.Equals, "user 'ops': invalid role: root")
+		})
+
+		c.Specify("using bearer tokens", func() {
+			conf.Type = "bearer"
+			conf.Tokens = map[string]HttpAuthToken{
+				"deploy": {Token: "s3cr3t", Role: "admin"},
+			}
+			auth, err := NewHttpAuthenticator(conf)
+			c.Assume(err, gs.IsNil)
+
+			req, _ := http.NewRequest("DELETE", "/", nil)
+			c.Expect(serve(auth, req).Code, gs.Equals, 401)
+			req.Header.Set("Authorization", "Bearer wrong")
+			c.Expect(serve(auth, req).Code, gs.Equals, 401)
+			req.Header.Set("Authorization", "Bearer s3cr3t")
+			c.Expect(serve(auth, req).Code, gs.Equals, 200)
+		})
+
+		c.Specify("using TLS client certificates", func() {
+			conf.Type = "tls"
+			conf.Peers = map[string][]string{
+				"admin": {"ops.example.com"},
+				"read":  {"*.example.com"},
+			}
+			auth, err := NewHttpAuthenticator(conf)
+			c.Assume(err, gs.IsNil)
+			withCert := func(req *http.Request, cn string) {
+				cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+				chain := []*x509.Certificate{cert}
+				req.TLS = &tls.ConnectionState{
+					PeerCertificates: chain,
+					VerifiedChains:   [][]*x509.Certificate{chain},
+				}
+			}
+
+			req, _ := http.NewRequest("PUT", "/", nil)
+			c.Expect(serve(auth, req).Code, gs.Equals, 401)
+			withCert(req, "ops.example.com")
+			c.Expect(serve(auth, req).Code, gs.Equals, 200)
+			withCert(req, "dev.example.com")
+			c.Expect(serve(auth, req).Code, gs.Equals, 403)
+			req.Method = "GET"
+			c.Expect(serve(auth, req).Code, gs.Equals, 200)
+			withCert(req, "dev.example.org")
+			c.Expect(serve(auth, req).Code, gs.Equals, 401)
+
+			// A certificate the handshake didn't verify is ignored.
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ops.example.com"}}
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+			c.Expect(serve(auth, req).Code, gs.Equals, 401)
+		})
+
+		c.Specify("refuses tls auth without client verification", func() {
+			conf.Type = "tls"
+			tlsConf := &tcp.TlsConfig{ClientAuth: "RequireAnyClientCert"}
+			c.Expect(conf.CheckListener(false, tlsConf), gs.Not(gs.IsNil))
+			c.Expect(conf.CheckListener(true, tlsConf), gs.Not(gs.IsNil))
+			tlsConf.ClientAuth = "RequireAndVerifyClientCert"
+			tlsConf.ClientCAs = "ca.pem"
+			c.Expect(conf.CheckListener(true, tlsConf), gs.IsNil)
+		})
+	})
+}
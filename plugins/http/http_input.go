@@ -27,6 +27,7 @@ import (
 
 	"heka/message"
 	. "heka/pipeline"
+	"heka/plugins/tcp"
 	"github.com/pborman/uuid"
 )
 
@@ -49,6 +50,13 @@ type HttpInput struct {
 	hostname        string
 	packSupply      chan *PipelinePack
 	customUserAgent bool
+	httpClient      *http.Client
+	pConfig         *PipelineConfig
+	recordsPath     jsonPath
+	checkpointPath  jsonPath
+	cursorPath      jsonPath
+	oauth2          *TokenCache
+	state           map[string]*pollState
 }
 
 // Http Input config struct
@@ -72,6 +80,21 @@ type HttpInputConfig struct {
 	SuccessSeverity int32 `toml:"success_severity"`
 	// Severity level of errors and unsuccessful requests. Default is 1 (alert)
 	ErrorSeverity int32 `toml:"error_severity"`
+	// Subsection for TLS configuration, used for https URLs.
+	Tls tcp.TlsConfig
+	// JSONPath of the records in each response, each of which is delivered
+	// as its own message. By default the whole response is one message.
+	RecordsPath string `toml:"records_path"`
+	// JSONPath, relative to a record, of the value to checkpoint. The value
+	// from the last record is saved and interpolated as %Checkpoint% into
+	// the URLs and body of later requests.
+	CheckpointPath string `toml:"checkpoint_path"`
+	// Checkpoint used before any has been saved.
+	InitialCheckpoint string `toml:"initial_checkpoint"`
+	// Subsection for following paginated responses.
+	Pagination *HttpPaginationConfig
+	// Subsection for authenticating with OAuth2 client credentials.
+	OAuth2 *OAuth2Config `toml:"oauth2"`
 }
 
 func (hi *HttpInput) SetName(name string) {
@@ -108,6 +131,71 @@ func (hi *HttpInput) Init(config interface{}) error {
 		hi.customUserAgent = true
 	}
 
+	hi.httpClient = &http.Client{}
+	for _, url := range hi.urls {
+		if !strings.HasPrefix(url, "https") {
+			continue
+		}
+		transport := &http.Transport{}
+		var err error
+		if transport.TLSClientConfig, err = tcp.CreateGoTlsConfig(&hi.conf.Tls); err != nil {
+			return fmt.Errorf("TLS init error: %s", err.Error())
+		}
+		hi.httpClient.Transport = transport
+		break
+	}
+
+	var err error
+	if hi.conf.RecordsPath != "" {
+		if hi.recordsPath, err = compileJsonPath(hi.conf.RecordsPath); err != nil {
+			return fmt.Errorf("records_path: %s", err)
+		}
+	}
+	if hi.conf.CheckpointPath != "" {
+		if hi.checkpointPath, err = compileJsonPath(hi.conf.CheckpointPath); err != nil {
+			return fmt.Errorf("checkpoint_path: %s", err)
+		}
+	}
+	if pages := hi.conf.Pagination; pages != nil {
+		if pages.MaxPages == 0 {
+			pages.MaxPages = 100
+		}
+		switch pages.Type {
+		case "cursor":
+			if pages.CursorPath == "" {
+				return fmt.Errorf("cursor pagination requires a cursor_path")
+			}
+			if hi.cursorPath, err = compileJsonPath(pages.CursorPath); err != nil {
+				return fmt.Errorf("cursor_path: %s", err)
+			}
+			if pages.CursorParam == "" {
+				pages.CursorParam = "cursor"
+			}
+		case "link":
+		case "offset":
+			if hi.recordsPath == nil {
+				return fmt.Errorf("offset pagination requires a records_path")
+			}
+			if pages.OffsetParam == "" {
+				pages.OffsetParam = "offset"
+			}
+			if pages.LimitParam == "" {
+				pages.LimitParam = "limit"
+			}
+			if pages.PageSize == 0 {
+				pages.PageSize = 100
+			}
+		default:
+			return fmt.Errorf("unknown pagination type '%s'", pages.Type)
+		}
+	}
+	if hi.conf.OAuth2 != nil {
+		if hi.conf.OAuth2.TokenUrl == "" {
+			return fmt.Errorf("oauth2 requires a token_url")
+		}
+		hi.oauth2 = newOAuth2Token(hi.conf.OAuth2, hi.httpClient)
+	}
+
 	return nil
 }
 
@@ -140,13 +228,10 @@ func (hi *HttpInput) makePackDecorator(respData ResponseData) func(*PipelinePack
 	return packDecorator
 }
 
-func (hi *HttpInput) fetchUrl(url string, sRunner SplitterRunner) {
-	responseTimeStart := time.Now()
-	httpClient := &http.Client{}
-	req, err := http.NewRequest(hi.conf.Method, url, strings.NewReader(hi.conf.Body))
+func (hi *HttpInput) newRequest(url, body string) (*http.Request, error) {
+	req, err := http.NewRequest(hi.conf.Method, url, strings.NewReader(body))
 	if err != nil {
-		hi.ir.LogError(fmt.Errorf("can't create HTTP request for %s: %s", url, err.Error()))
-		return
+		return nil, err
 	}
 	// HTTP Basic Auth
 	if hi.conf.Username != "" {
@@ -159,17 +244,32 @@ func (hi *HttpInput) fetchUrl(url string, sRunner SplitterRunner) {
 	if !hi.customUserAgent {
 		req.Header.Add("User-Agent", "Heka")
 	}
-	resp, err := httpClient.Do(req)
+	return req, nil
+}
+
+// Delivers a message reporting a failed request.
+func (hi *HttpInput) deliverError(url string, err error) {
+	pack := <-hi.ir.InChan()
+	pack.Message.SetUuid(uuid.NewRandom())
+	pack.Message.SetTimestamp(time.Now().UnixNano())
+	pack.Message.SetType("heka.httpinput.error")
+	pack.Message.SetPayload(err.Error())
+	pack.Message.SetSeverity(hi.conf.ErrorSeverity)
+	pack.Message.SetLogger(url)
+	hi.ir.Deliver(pack)
+}
+
+func (hi *HttpInput) fetchUrl(url string, sRunner SplitterRunner) {
+	responseTimeStart := time.Now()
+	req, err := hi.newRequest(url, hi.conf.Body)
+	if err != nil {
+		hi.ir.LogError(fmt.Errorf("can't create HTTP request for %s: %s", url, err.Error()))
+		return
+	}
+	resp, err := hi.httpClient.Do(req)
 	responseTime := time.Since(responseTimeStart)
 	if err != nil {
-		pack := <-hi.ir.InChan()
-		pack.Message.SetUuid(uuid.NewRandom())
-		pack.Message.SetTimestamp(time.Now().UnixNano())
-		pack.Message.SetType("heka.httpinput.error")
-		pack.Message.SetPayload(err.Error())
-		pack.Message.SetSeverity(hi.conf.ErrorSeverity)
-		pack.Message.SetLogger(url)
-		hi.ir.Deliver(pack)
+		hi.deliverError(url, err)
 		return
 	}
 	contentLength, _ := strconv.Atoi(resp.Header.Get("Content-Length"))
@@ -197,6 +297,12 @@ func (hi *HttpInput) Run(ir InputRunner, h PluginHelper) (err error) {
 	hi.ir = ir
 	hi.sRunners = make([]SplitterRunner, len(hi.urls))
 	hi.hostname = h.Hostname()
+	if hi.saving() {
+		hi.pConfig = h.PipelineConfig()
+		hi.loadState()
+	} else {
+		hi.state = make(map[string]*pollState)
+	}
 
 	for i, _ := range hi.urls {
 		token := strconv.Itoa(i)
@@ -215,7 +321,11 @@ func (hi *HttpInput) Run(ir InputRunner, h PluginHelper) (err error) {
 		case <-ticker:
 			for i, url := range hi.urls {
 				sRunner := hi.sRunners[i]
-				hi.fetchUrl(url, sRunner)
+				if hi.polling() {
+					hi.pollUrl(url, sRunner)
+				} else {
+					hi.fetchUrl(url, sRunner)
+				}
 			}
 		case <-hi.stopChan:
 			return nil
@@ -17,13 +17,12 @@
 package http
 
 import (
-	"crypto/tls"
-	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"heka/message"
 	. "heka/pipeline"
@@ -39,6 +38,12 @@ type HttpListenInput struct {
 	starterFunc func(hli *HttpListenInput) error
 	hekaPid     int32
 	hostname    string
+	limiter     *ConnLimiter
+	ingest      *ingestHandler
+	// Transport metadata written to messages, nil if none is, and the
+	// deliverer writing it once they're decoded.
+	connFields *ConnFields
+	deliverer  Deliverer
 }
 
 // HTTP Listen Input config struct
@@ -57,20 +62,43 @@ type HttpListenInputConfig struct {
 	UseTls bool `toml:"use_tls"`
 	// Subsection for TLS configuration.
 	Tls TlsConfig
+	// Set to true if the listening socket should be opened with SO_REUSEPORT,
+	// so that another hekad can listen on the same address during an upgrade.
+	ReusePort bool `toml:"reuse_port"`
+	// Subsection of listening socket settings, such as the address family
+	// and buffer sizes.
+	Socket SocketConfig `toml:"socket"`
+	// Subsection of connection limits, such as the maximum number of
+	// connections per client. Each request counts as one message.
+	Limits ConnLimitConfig `toml:"limits"`
+	// Seconds a client has to send a request's headers. Defaults to 10.
+	ReadHeaderTimeout uint `toml:"read_header_timeout"`
+	// Subsection enabling the authenticated bulk ingestion endpoint, which
+	// accepts batches of events as NDJSON or protobuf.
+	Ingest *IngestConfig `toml:"ingest"`
+	// Subsection choosing the transport metadata, such as the client's
+	// address and the TLS version, written to each message's fields.
+	ConnectionFields ConnFieldsConfig `toml:"connection_fields"`
 }
 
 func (hli *HttpListenInput) ConfigStruct() interface{} {
 	config := &HttpListenInputConfig{
-		Address:        "127.0.0.1:8325",
-		Headers:        make(http.Header),
-		RequestHeaders: []string{},
+		Address:           "127.0.0.1:8325",
+		Headers:           make(http.Header),
+		RequestHeaders:    []string{},
+		ReadHeaderTimeout: 10,
+		ConnectionFields:  ConnFieldsConfig{Prefix: "Conn"},
 	}
 	config.Tls = TlsConfig{PreferServerCiphers: true}
 	return config
 }
 
 func defaultStarter(hli *HttpListenInput) (err error) {
-	hli.listener, err = net.Listen("tcp", hli.conf.Address)
+	network, err := hli.conf.Socket.Network("tcp")
+	if err == nil {
+		hli.listener, err = hli.conf.Socket.Listen(network, hli.conf.Address,
+			hli.conf.ReusePort)
+	}
 	if err != nil {
 		return fmt.Errorf("Listener [%s] start fail: %s",
 			hli.conf.Address, err.Error())
@@ -78,6 +106,7 @@ func defaultStarter(hli *HttpListenInput) (err error) {
 		hli.ir.LogMessage(fmt.Sprintf("Listening on %s",
 			hli.conf.Address))
 	}
+	hli.listener = hli.limiter.Listener(hli.listener)
 
 	if hli.conf.UseTls {
 		if err = hli.setupTls(&hli.conf.Tls); err != nil {
@@ -94,12 +123,9 @@ func defaultStarter(hli *HttpListenInput) (err error) {
 }
 
 func (hli *HttpListenInput) setupTls(tomlConf *TlsConfig) (err error) {
-	if tomlConf.CertFile == "" || tomlConf.KeyFile == "" {
-		return errors.New("TLS config requires both cert_file and key_file value.")
-	}
-	var goConf *tls.Config
-	if goConf, err = CreateGoTlsConfig(tomlConf); err == nil {
-		hli.listener = tls.NewListener(hli.listener, goConf)
+	var listener net.Listener
+	if listener, err = NewTlsListener(hli.listener, tomlConf); err == nil {
+		hli.listener = listener
 	}
 	return
 }
@@ -112,7 +138,32 @@ func (hli *HttpListenInput) makeField(name string, value string) (field *message
 	return
 }
 
+// Returns the transport metadata of a request.
+func requestConnMetadata(req *http.Request) *ConnMetadata {
+	md := &ConnMetadata{Protocol: req.Proto}
+	md.SetRemote(req.RemoteAddr)
+	if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		md.SetLocal(addr.String())
+	}
+	md.SetTls(req.TLS)
+	return md
+}
+
+// Returns a splitter pack decorator stashing the request's metadata in each
+// pack, for the deliverer to write once the pack is decoded, or nil if no
+// metadata is wanted.
+func (hli *HttpListenInput) connFieldsDecorator(req *http.Request) func(*PipelinePack) {
+	if hli.connFields == nil {
+		return nil
+	}
+	md := requestConnMetadata(req)
+	return func(pack *PipelinePack) {
+		hli.connFields.Stash(pack, md)
+	}
+}
+
 func (hli *HttpListenInput) makePackDecorator(req *http.Request) func(*PipelinePack) {
+	stash := hli.connFieldsDecorator(req)
 	packDecorator := func(pack *PipelinePack) {
 		pack.Message.SetType("heka.httpdata.request")
 		pack.Message.SetPid(hli.hekaPid)
@@ -168,6 +219,9 @@ func (hli *HttpListenInput) makePackDecorator(req *http.Request) func(*PipelineP
 				}
 			}
 		}
+		if stash != nil {
+			stash(pack)
+		}
 	}
 	return packDecorator
 }
@@ -175,6 +229,17 @@ func (hli *HttpListenInput) makePackDecorator(req *http.Request) func(*PipelineP
 func (hli *HttpListenInput) RequestHandler(w http.ResponseWriter, req *http.Request) {
 	var err error
 
+	if hli.conf.Limits.ClientMessageRate > 0 {
+		host, _, e := net.SplitHostPort(req.RemoteAddr)
+		if e != nil {
+			host = req.RemoteAddr
+		}
+		if !hli.limiter.AllowMessage(host) {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+	}
+
 	if hli.conf.AuthType == "Basic" {
 		if hli.conf.Username != "" && hli.conf.Password != "" {
 			user, pass, ok := req.BasicAuth()
@@ -197,8 +262,10 @@ func (hli *HttpListenInput) RequestHandler(w http.ResponseWriter, req *http.Requ
 		sRunner := hli.ir.NewSplitterRunner(req.RemoteAddr)
 		if !sRunner.UseMsgBytes() {
 			sRunner.SetPackDecorator(hli.makePackDecorator(req))
+		} else if stash := hli.connFieldsDecorator(req); stash != nil {
+			sRunner.SetPackDecorator(stash)
 		}
-		err = sRunner.SplitStreamNullSplitterToEOF(req.Body, nil)
+		err = sRunner.SplitStreamNullSplitterToEOF(req.Body, hli.deliverer)
 		if err != nil && err != io.EOF {
 			hli.ir.LogError(fmt.Errorf("receiving request body: %s", err.Error()))
 		}
@@ -209,15 +276,37 @@ func (hli *HttpListenInput) RequestHandler(w http.ResponseWriter, req *http.Requ
 
 func (hli *HttpListenInput) Init(config interface{}) (err error) {
 	hli.conf = config.(*HttpListenInputConfig)
+	if hli.connFields, err = NewConnFields(hli.conf.ConnectionFields); err != nil {
+		return err
+	}
 	if hli.starterFunc == nil {
 		hli.starterFunc = defaultStarter
 	}
 	hli.stopChan = make(chan bool, 1)
 
-	handler := http.HandlerFunc(hli.RequestHandler)
+	var handler http.Handler = http.HandlerFunc(hli.RequestHandler)
+	if hli.conf.Ingest != nil {
+		if hli.ingest, err = newIngestHandler(hli.conf.Ingest, hli); err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle(hli.conf.Ingest.Path, hli.ingest)
+		mux.HandleFunc(hli.conf.Ingest.OpenApiPath, hli.ingest.serveOpenApi)
+		mux.Handle("/", handler)
+		handler = mux
+	}
 	hli.server = &http.Server{
-		Handler: CustomHeadersHandler(handler, hli.conf.Headers),
+		Handler:           CustomHeadersHandler(handler, hli.conf.Headers),
+		ReadHeaderTimeout: time.Duration(hli.conf.ReadHeaderTimeout) * time.Second,
 	}
+	if hli.conf.Limits.IdleTimeout > 0 {
+		// Requests must be read, and kept alive connections reused, within
+		// the idle timeout.
+		idle := time.Duration(hli.conf.Limits.IdleTimeout) * time.Second
+		hli.server.ReadTimeout = idle
+		hli.server.IdleTimeout = idle
+	}
+	hli.limiter = NewConnLimiter(hli.conf.Limits)
 	hli.hekaPid = int32(os.Getpid())
 	return nil
 }
@@ -226,6 +315,11 @@ func (hli *HttpListenInput) Run(ir InputRunner, h PluginHelper) (err error) {
 	hli.ir = ir
 	var hostname, _ = os.Hostname()
 	hli.hostname = hostname
+	if hli.connFields != nil {
+		hli.deliverer = ir.NewDeliverer("")
+		hli.deliverer.SetPackDecorator(hli.connFields.StashedDecorator())
+		defer hli.deliverer.Done()
+	}
 	err = hli.starterFunc(hli)
 	if err != nil {
 		return err
@@ -236,6 +330,14 @@ func (hli *HttpListenInput) Run(ir InputRunner, h PluginHelper) (err error) {
 	return nil
 }
 
+func (hli *HttpListenInput) ReportMsg(msg *message.Message) error {
+	hli.limiter.ReportMsg(msg)
+	if hli.ingest != nil {
+		hli.ingest.reportMsg(msg)
+	}
+	return nil
+}
+
 func (hli *HttpListenInput) Stop() {
 	if hli.listener != nil {
 		hli.listener.Close()
@@ -27,6 +27,7 @@ import (
 	"reflect"
 	"strings"
 
+	"heka/message"
 	. "heka/pipeline"
 	pipeline_ts "heka/pipeline/testsupport"
 	"heka/pipelinemock"
@@ -259,6 +260,33 @@ func HttpListenInputSpec(c gs.Context) {
 			c.Expect(resp.StatusCode, gs.Equals, 200)
 		})
 
+		c.Specify("Refuses requests over the client message rate", func() {
+			config.Limits.ClientMessageRate = 1
+
+			err := httpListenInput.Init(config)
+			c.Assume(err, gs.IsNil)
+			ts.Config = httpListenInput.server
+			ts.Listener = httpListenInput.limiter.Listener(ts.Listener)
+
+			splitCall.Return(io.EOF)
+			startInput()
+			<-startedChan
+
+			resp, err := http.Get(ts.URL)
+			c.Assume(err, gs.IsNil)
+			resp.Body.Close()
+			c.Expect(resp.StatusCode, gs.Equals, 200)
+			resp, err = http.Get(ts.URL)
+			c.Assume(err, gs.IsNil)
+			resp.Body.Close()
+			c.Expect(resp.StatusCode, gs.Equals, http.StatusTooManyRequests)
+
+			msg := new(message.Message)
+			httpListenInput.ReportMsg(msg)
+			throttled, _ := msg.GetFieldValue("ThrottledMessages")
+			c.Expect(throttled, gs.Equals, int64(1))
+		})
+
 		c.Specify("Test Basic Auth", func() {
 			config.AuthType = "Basic"
 			config.Username = "foo"
@@ -325,4 +353,65 @@ func HttpListenInputSpec(c gs.Context) {
 		c.Expect(err, gs.IsNil)
 
 	})
+
+	c.Specify("A HttpListenInput writes connection fields to decoded messages", func() {
+		startedChan := make(chan bool, 1)
+		defer close(startedChan)
+		ts := httptest.NewUnstartedServer(nil)
+		httpListenInput.starterFunc = func(hli *HttpListenInput) error {
+			ts.StartTLS()
+			startedChan <- true
+			return nil
+		}
+		config.ConnectionFields.Fields = []string{"remote_addr", "tls_version", "protocol"}
+		err := httpListenInput.Init(config)
+		c.Assume(err, gs.IsNil)
+		ts.Config = httpListenInput.server
+
+		mockDeliverer := pipelinemock.NewMockDeliverer(ctrl)
+		decChan := make(chan func(*PipelinePack), 2)
+		feedDecorator := func(decorator func(*PipelinePack)) {
+			decChan <- decorator
+		}
+		ith.MockInputRunner.EXPECT().NewDeliverer("").Return(mockDeliverer)
+		mockDeliverer.EXPECT().SetPackDecorator(gomock.Any()).Do(feedDecorator)
+		mockDeliverer.EXPECT().Done()
+		ith.MockInputRunner.EXPECT().NewSplitterRunner(gomock.Any()).Return(
+			ith.MockSplitterRunner)
+		ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(false)
+		ith.MockSplitterRunner.EXPECT().Done()
+		ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any()).Do(feedDecorator)
+		splitCall := ith.MockSplitterRunner.EXPECT().SplitStreamNullSplitterToEOF(
+			gomock.Any(), mockDeliverer)
+		splitCall.Return(io.EOF)
+		startInput()
+		<-startedChan
+		stashedDec := <-decChan
+
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true,
+				MaxVersion: tls.VersionTLS12},
+		}}
+		resp, err := client.Get(ts.URL)
+		c.Assume(err, gs.IsNil)
+		resp.Body.Close()
+		c.Assume(resp.StatusCode, gs.Equals, 200)
+
+		(<-decChan)(ith.Pack)
+		// Decoding replaces the message.
+		ith.Pack.Message = new(message.Message)
+		message.NewStringField(ith.Pack.Message, "ConnTlsVersion", "TLS 1.3")
+		stashedDec(ith.Pack)
+		fieldValue, _ := ith.Pack.Message.GetFieldValue("ConnRemoteAddr")
+		c.Expect(fieldValue, gs.Equals, "127.0.0.1")
+		fieldValue, _ = ith.Pack.Message.GetFieldValue("ConnTlsVersion")
+		c.Expect(fieldValue, gs.Equals, "TLS 1.2")
+		c.Expect(len(ith.Pack.Message.FindAllFields("ConnTlsVersion")), gs.Equals, 1)
+		fieldValue, _ = ith.Pack.Message.GetFieldValue("ConnProtocol")
+		c.Expect(fieldValue, gs.Equals, "HTTP/1.1")
+
+		ts.Close()
+		httpListenInput.Stop()
+		c.Expect(<-errChan, gs.IsNil)
+	})
 }
@@ -0,0 +1,356 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	. "heka/pipeline"
+)
+
+// Pagination settings, from the input's `pagination` subsection.
+type HttpPaginationConfig struct {
+	// How the next page is found: "cursor" (a value in each response, passed
+	// back as a query parameter), "link" (the response's `Link: <...>;
+	// rel="next"` header), or "offset" (counting records).
+	Type string `toml:"type"`
+	// JSONPath of the next page's cursor in each response, for "cursor".
+	CursorPath string `toml:"cursor_path"`
+	// Query parameter carrying the cursor. Defaults to "cursor".
+	CursorParam string `toml:"cursor_param"`
+	// If true, the latest cursor is saved and the next poll starts from it
+	// rather than from the first page, for APIs whose cursors lead on to
+	// newer records.
+	Resume bool `toml:"resume"`
+	// Query parameters carrying the offset and page size, for "offset".
+	// Default to "offset" and "limit".
+	OffsetParam string `toml:"offset_param"`
+	LimitParam  string `toml:"limit_param"`
+	// Records requested per page, for "offset". Defaults to 100.
+	PageSize uint `toml:"page_size"`
+	// Most pages fetched per poll. Defaults to 100.
+	MaxPages uint `toml:"max_pages"`
+}
+
+// OAuth2 client credentials grant settings, from the input's `oauth2`
+// subsection.
+type OAuth2Config struct {
+	// URL of the authorization server's token endpoint.
+	TokenUrl     string   `toml:"token_url"`
+	ClientId     string   `toml:"client_id"`
+	ClientSecret string   `toml:"client_secret"`
+	Scopes       []string `toml:"scopes"`
+	// Extra form parameters for the token request, e.g. "audience".
+	Params map[string]string `toml:"params"`
+}
+
+// Returns a token cache fetching access tokens with the client credentials
+// grant.
+func newOAuth2Token(conf *OAuth2Config, client *http.Client) *TokenCache {
+	return &TokenCache{Client: client, NewRequest: func() (*http.Request, error) {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		if len(conf.Scopes) > 0 {
+			form.Set("scope", strings.Join(conf.Scopes, " "))
+		}
+		for key, value := range conf.Params {
+			form.Set(key, value)
+		}
+		req, err := http.NewRequest("POST", conf.TokenUrl, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(url.QueryEscape(conf.ClientId), url.QueryEscape(conf.ClientSecret))
+		return req, nil
+	}}
+}
+
+// Where a URL's polling has got to, saved between runs.
+type pollState struct {
+	// Value from the last record, interpolated as %Checkpoint%.
+	Checkpoint string `json:",omitempty"`
+	// Latest cursor, when resuming cursor pagination.
+	Cursor string `json:",omitempty"`
+}
+
+var (
+	linkNextRe    = regexp.MustCompile(`<([^>]*)>\s*;[^,]*rel="?next"?`)
+	stateFileName = regexp.MustCompile("\\W")
+)
+
+// Returns true if the input needs to look inside the responses, rather than
+// just passing each one on whole.
+func (hi *HttpInput) polling() bool {
+	return hi.recordsPath != nil || hi.conf.Pagination != nil ||
+		hi.checkpointPath != nil
+}
+
+// Returns true if polling state needs saving between runs.
+func (hi *HttpInput) saving() bool {
+	return hi.checkpointPath != nil ||
+		(hi.conf.Pagination != nil && hi.conf.Pagination.Resume)
+}
+
+// Returns the key the polling state is checkpointed under.
+func (hi *HttpInput) stateKey() string {
+	return "http_input/" + stateFileName.ReplaceAllString(hi.name, "_")
+}
+
+// Loads the state saved by earlier runs, keyed by URL.
+func (hi *HttpInput) loadState() {
+	hi.state = make(map[string]*pollState)
+	cp := hi.pConfig.Checkpointer()
+	// Earlier versions kept the state in a file of their own.
+	name := stateFileName.ReplaceAllString(hi.name, "_")
+	legacy := hi.pConfig.Globals.PrependBaseDir(filepath.Join("http_input", name+".json"))
+	if err := MigrateCheckpointFile(cp, hi.stateKey(), legacy); err != nil {
+		hi.ir.LogError(fmt.Errorf("can't migrate saved polling state: %s", err))
+	}
+	data, err := cp.Get(hi.stateKey())
+	if err != nil {
+		hi.ir.LogError(fmt.Errorf("can't load saved polling state: %s", err))
+		return
+	}
+	if data == nil {
+		return
+	}
+	if err = json.Unmarshal(data, &hi.state); err != nil {
+		hi.ir.LogError(fmt.Errorf("can't decode saved polling state: %s", err))
+		hi.state = make(map[string]*pollState)
+	}
+}
+
+func (hi *HttpInput) saveState() {
+	data, err := json.Marshal(hi.state)
+	if err == nil {
+		err = hi.pConfig.Checkpointer().Set(hi.stateKey(), data)
+	}
+	if err != nil {
+		hi.ir.LogError(fmt.Errorf("can't save polling state: %s", err))
+	}
+}
+
+// Fills in a URL or body template. Only the known placeholders are
+// replaced, so that escapes such as "%20" are left alone.
+func expandTemplate(template, checkpoint string, escape bool) string {
+	if escape {
+		checkpoint = url.QueryEscape(checkpoint)
+	}
+	now := time.Now().UTC()
+	return strings.NewReplacer(
+		"%Checkpoint%", checkpoint,
+		"%Now%", now.Format(time.RFC3339),
+		"%NowUnix%", strconv.FormatInt(now.Unix(), 10),
+	).Replace(template)
+}
+
+// Returns the URL with the query parameters set.
+func withParams(rawUrl string, params map[string]string) (string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Makes the request, retrying once with a fresh token if the server rejects
+// the OAuth2 token it was sent.
+func (hi *HttpInput) doRequest(rawUrl, body string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := hi.newRequest(rawUrl, body)
+		if err != nil {
+			return nil, err
+		}
+		if hi.oauth2 != nil {
+			token, err := hi.oauth2.Get()
+			if err != nil {
+				return nil, fmt.Errorf("can't get OAuth2 token: %s", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := hi.httpClient.Do(req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized ||
+			hi.oauth2 == nil || attempt > 0 {
+			return resp, err
+		}
+		resp.Body.Close()
+		hi.oauth2.Invalidate()
+	}
+}
+
+// Returns the string form of a JSON value, for cursors and checkpoints.
+func jsonString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		data, _ := json.Marshal(t)
+		return string(data)
+	}
+}
+
+// Polls a URL, following its pages and delivering each record as a message.
+func (hi *HttpInput) pollUrl(template string, sRunner SplitterRunner) {
+	state, ok := hi.state[template]
+	if !ok {
+		state = &pollState{Checkpoint: hi.conf.InitialCheckpoint}
+		hi.state[template] = state
+	}
+	pageUrl := expandTemplate(template, state.Checkpoint, true)
+	body := expandTemplate(hi.conf.Body, state.Checkpoint, false)
+
+	pages := hi.conf.Pagination
+	maxPages := uint(1)
+	var offset int
+	var err error
+	if pages != nil {
+		maxPages = pages.MaxPages
+		switch {
+		case pages.Type == "cursor" && pages.Resume && state.Cursor != "":
+			pageUrl, err = withParams(pageUrl,
+				map[string]string{pages.CursorParam: state.Cursor})
+		case pages.Type == "offset":
+			pageUrl, err = withParams(pageUrl, map[string]string{
+				pages.OffsetParam: "0",
+				pages.LimitParam:  strconv.FormatUint(uint64(pages.PageSize), 10),
+			})
+		}
+		if err != nil {
+			hi.ir.LogError(fmt.Errorf("bad URL %s: %s", pageUrl, err))
+			return
+		}
+	}
+
+	for page := uint(0); page < maxPages && pageUrl != ""; page++ {
+		start := time.Now()
+		resp, err := hi.doRequest(pageUrl, body)
+		if err != nil {
+			hi.deliverError(pageUrl, err)
+			return
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			hi.deliverError(pageUrl, err)
+			return
+		}
+		respData := ResponseData{
+			Size:       len(data),
+			Time:       time.Since(start).Seconds(),
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Proto:      resp.Proto,
+			Url:        pageUrl,
+		}
+		if !sRunner.UseMsgBytes() {
+			sRunner.SetPackDecorator(hi.makePackDecorator(respData))
+		}
+		if resp.StatusCode != http.StatusOK {
+			// Pass the error response on whole, and try again next poll.
+			sRunner.DeliverRecord(data, nil)
+			return
+		}
+
+		var doc interface{}
+		if hi.recordsPath != nil || hi.checkpointPath != nil ||
+			(pages != nil && pages.Type == "cursor") {
+			if err = json.Unmarshal(data, &doc); err != nil {
+				hi.ir.LogError(fmt.Errorf("can't decode JSON response from %s: %s",
+					pageUrl, err))
+				return
+			}
+		}
+
+		var records []interface{}
+		if hi.recordsPath != nil {
+			records = hi.recordsPath.Find(doc)
+			for _, record := range records {
+				recordData, err := json.Marshal(record)
+				if err != nil {
+					continue
+				}
+				sRunner.DeliverRecord(recordData, nil)
+			}
+		} else {
+			records = []interface{}{doc}
+			sRunner.DeliverRecord(data, nil)
+		}
+		if hi.checkpointPath != nil && len(records) > 0 {
+			if found := hi.checkpointPath.Find(records[len(records)-1]); len(found) > 0 {
+				state.Checkpoint = jsonString(found[0])
+			}
+		}
+
+		next := ""
+		if pages != nil {
+			switch pages.Type {
+			case "cursor":
+				var cursor string
+				if found := hi.cursorPath.Find(doc); len(found) > 0 {
+					cursor = jsonString(found[0])
+				}
+				if cursor != "" {
+					if pages.Resume {
+						state.Cursor = cursor
+					}
+					next, err = withParams(pageUrl,
+						map[string]string{pages.CursorParam: cursor})
+				}
+			case "link":
+				if m := linkNextRe.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+					var base, ref *url.URL
+					if base, err = url.Parse(pageUrl); err == nil {
+						if ref, err = url.Parse(m[1]); err == nil {
+							next = base.ResolveReference(ref).String()
+						}
+					}
+				}
+			case "offset":
+				if uint(len(records)) >= pages.PageSize {
+					offset += len(records)
+					next, err = withParams(pageUrl,
+						map[string]string{pages.OffsetParam: strconv.Itoa(offset)})
+				}
+			}
+			if err != nil {
+				hi.ir.LogError(fmt.Errorf("can't find next page after %s: %s",
+					pageUrl, err))
+				next = ""
+			}
+		}
+		if hi.saving() {
+			hi.saveState()
+		}
+		pageUrl = next
+	}
+}
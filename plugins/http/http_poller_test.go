@@ -0,0 +1,283 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package http
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func HttpPollerSpec(c gs.Context) {
+	t := &pipeline_ts.SimpleT{}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tmpDir, err := ioutil.TempDir("", "http-poller-tests")
+	c.Assume(err, gs.IsNil)
+	defer os.RemoveAll(tmpDir)
+	globals := DefaultGlobals()
+	globals.BaseDir = tmpDir
+	pConfig := NewPipelineConfig(globals)
+
+	c.Specify("A polling HttpInput", func() {
+		httpInput := &HttpInput{name: "poller"}
+		ir := pipelinemock.NewMockInputRunner(ctrl)
+		helper := pipelinemock.NewMockPluginHelper(ctrl)
+		sRunner := pipelinemock.NewMockSplitterRunner(ctrl)
+
+		tickChan := make(chan time.Time)
+		ir.EXPECT().Ticker().Return(tickChan).AnyTimes()
+		ir.EXPECT().NewSplitterRunner("0").Return(sRunner).AnyTimes()
+		helper.EXPECT().Hostname().Return("hekatests.example.com").AnyTimes()
+		helper.EXPECT().PipelineConfig().Return(pConfig).AnyTimes()
+		sRunner.EXPECT().UseMsgBytes().Return(false).AnyTimes()
+		sRunner.EXPECT().SetPackDecorator(gomock.Any()).AnyTimes()
+		sRunner.EXPECT().Done().AnyTimes()
+
+		records := make(chan string, 20)
+		deliverCall := sRunner.EXPECT().DeliverRecord(gomock.Any(), nil).AnyTimes()
+		deliverCall.Do(func(record []byte, del Deliverer) {
+			records <- string(record)
+		})
+
+		var requests []string
+		var handler http.HandlerFunc
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+			r *http.Request) {
+			requests = append(requests, r.URL.RequestURI())
+			handler(w, r)
+		}))
+		defer server.Close()
+
+		config := httpInput.ConfigStruct().(*HttpInputConfig)
+
+		runOutputChan := make(chan error, 1)
+		poll := func() {
+			err := httpInput.Init(config)
+			c.Assume(err, gs.IsNil)
+			go func() {
+				runOutputChan <- httpInput.Run(ir, helper)
+			}()
+			tickChan <- time.Now()
+		}
+		stop := func() {
+			// Sending a second tick waits for the first poll to finish.
+			tickChan <- time.Now()
+			httpInput.Stop()
+			c.Expect(<-runOutputChan, gs.IsNil)
+		}
+
+		c.Specify("splits responses into records", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"data": {"items": [{"id": 1}, {"id": 2}]}}`)
+			}
+			config.Url = server.URL + "/items"
+			config.RecordsPath = "$.data.items[*]"
+			poll()
+			c.Expect(<-records, gs.Equals, `{"id":1}`)
+			c.Expect(<-records, gs.Equals, `{"id":2}`)
+			stop()
+		})
+
+		c.Specify("follows cursors", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("after") == "" {
+					fmt.Fprint(w, `{"items": [{"id": 1}], "next": "abc"}`)
+				} else {
+					fmt.Fprint(w, `{"items": [{"id": 2}], "next": null}`)
+				}
+			}
+			config.Url = server.URL + "/items"
+			config.RecordsPath = "$.items[*]"
+			config.Pagination = &HttpPaginationConfig{
+				Type:        "cursor",
+				CursorPath:  "$.next",
+				CursorParam: "after",
+			}
+			poll()
+			c.Expect(<-records, gs.Equals, `{"id":1}`)
+			c.Expect(<-records, gs.Equals, `{"id":2}`)
+			stop()
+			c.Expect(requests[1], gs.Equals, "/items?after=abc")
+		})
+
+		c.Specify("follows link headers", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("page") == "" {
+					w.Header().Set("Link", `</items?page=2>; rel="next", </items>; rel="first"`)
+					fmt.Fprint(w, `[{"id": 1}]`)
+				} else {
+					fmt.Fprint(w, `[{"id": 2}]`)
+				}
+			}
+			config.Url = server.URL + "/items"
+			config.RecordsPath = "$[*]"
+			config.Pagination = &HttpPaginationConfig{Type: "link"}
+			poll()
+			c.Expect(<-records, gs.Equals, `{"id":1}`)
+			c.Expect(<-records, gs.Equals, `{"id":2}`)
+			stop()
+			c.Expect(requests[1], gs.Equals, "/items?page=2")
+		})
+
+		c.Specify("pages by offset until a short page", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+				if offset < 4 {
+					fmt.Fprintf(w, `[{"id": %d}, {"id": %d}]`, offset, offset+1)
+				} else {
+					fmt.Fprintf(w, `[{"id": %d}]`, offset)
+				}
+			}
+			config.Url = server.URL + "/items"
+			config.RecordsPath = "$[*]"
+			config.Pagination = &HttpPaginationConfig{Type: "offset", PageSize: 2}
+			poll()
+			for i := 0; i < 5; i++ {
+				c.Expect(<-records, gs.Equals, fmt.Sprintf(`{"id":%d}`, i))
+			}
+			stop()
+			c.Expect(len(requests), gs.Equals, 6)
+			c.Expect(requests[0], gs.Equals, "/items?limit=2&offset=0")
+			c.Expect(requests[2], gs.Equals, "/items?limit=2&offset=4")
+		})
+
+		c.Specify("stops at max_pages", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"items": [{"id": 1}], "next": "more"}`)
+			}
+			config.Url = server.URL + "/items"
+			config.RecordsPath = "$.items[*]"
+			config.Pagination = &HttpPaginationConfig{
+				Type:       "cursor",
+				CursorPath: "$.next",
+				MaxPages:   3,
+			}
+			poll()
+			stop()
+			// Two polls, of three pages each.
+			c.Expect(len(requests), gs.Equals, 6)
+			c.Expect(len(records), gs.Equals, 6)
+		})
+
+		c.Specify("persists checkpoints across restarts", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+				fmt.Fprintf(w, `[{"id": %d}, {"id": %d}]`, since+1, since+2)
+			}
+			config.Url = server.URL + "/items?since=%Checkpoint%"
+			config.RecordsPath = "$[*]"
+			config.CheckpointPath = "$.id"
+			config.InitialCheckpoint = "10"
+			poll()
+			stop()
+			c.Expect(requests[0], gs.Equals, "/items?since=10")
+			c.Expect(requests[1], gs.Equals, "/items?since=12")
+
+			_, err := os.Stat(tmpDir + "/checkpoints/http_input/poller")
+			c.Expect(err, gs.IsNil)
+
+			httpInput = &HttpInput{name: "poller"}
+			poll()
+			stop()
+			c.Expect(requests[2], gs.Equals, "/items?since=14")
+		})
+
+		c.Specify("migrates state files from earlier versions", func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `[{"id": 21}]`)
+			}
+			config.Url = server.URL + "/items?since=%Checkpoint%"
+			config.RecordsPath = "$[*]"
+			config.CheckpointPath = "$.id"
+			legacy := tmpDir + "/http_input/poller.json"
+			err := os.MkdirAll(tmpDir+"/http_input", 0755)
+			c.Assume(err, gs.IsNil)
+			state := fmt.Sprintf(`{"%s": {"Checkpoint": "20"}}`, config.Url)
+			err = ioutil.WriteFile(legacy, []byte(state), 0644)
+			c.Assume(err, gs.IsNil)
+			poll()
+			stop()
+			c.Expect(requests[0], gs.Equals, "/items?since=20")
+			_, err = os.Stat(legacy)
+			c.Expect(os.IsNotExist(err), gs.IsTrue)
+		})
+
+		c.Specify("authenticates with OAuth2 client credentials", func() {
+			tokens := 0
+			tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+				r *http.Request) {
+				user, pass, _ := r.BasicAuth()
+				r.ParseForm()
+				if user != "client" || pass != "secret" ||
+					r.Form.Get("grant_type") != "client_credentials" ||
+					r.Form.Get("scope") != "read write" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				tokens++
+				fmt.Fprintf(w, `{"access_token": "token%d", "expires_in": 3600}`, tokens)
+			}))
+			defer tokenServer.Close()
+
+			// The first token is rejected, as if it had been revoked.
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer token2" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(w, `[{"id": 1}]`)
+			}
+			config.Url = server.URL + "/items"
+			config.RecordsPath = "$[*]"
+			config.OAuth2 = &OAuth2Config{
+				TokenUrl:     tokenServer.URL,
+				ClientId:     "client",
+				ClientSecret: "secret",
+				Scopes:       []string{"read", "write"},
+			}
+			poll()
+			c.Expect(<-records, gs.Equals, `{"id":1}`)
+			stop()
+			// The second poll reuses the cached token.
+			c.Expect(tokens, gs.Equals, 2)
+			c.Expect(len(requests), gs.Equals, 3)
+		})
+
+		c.Specify("rejects bad configurations", func() {
+			config.Url = server.URL
+			config.Pagination = &HttpPaginationConfig{Type: "offset"}
+			c.Expect(httpInput.Init(config), gs.Not(gs.IsNil))
+			config.Pagination = &HttpPaginationConfig{Type: "cursor"}
+			c.Expect(httpInput.Init(config), gs.Not(gs.IsNil))
+			config.Pagination = &HttpPaginationConfig{Type: "pages"}
+			c.Expect(httpInput.Init(config), gs.Not(gs.IsNil))
+			config.Pagination = nil
+			config.RecordsPath = "items"
+			c.Expect(httpInput.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,572 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package http
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pborman/uuid"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+// Content types of the ingest endpoint's batch bodies.
+const (
+	ingestNdjson   = "application/x-ndjson"
+	ingestProtobuf = "application/x-protobuf"
+)
+
+// Settings of the bulk ingestion endpoint, from an HttpListenInput's
+// `ingest` config subsection.
+type IngestConfig struct {
+	// Path of the endpoint. Defaults to "/v1/ingest".
+	Path string `toml:"path"`
+	// Path the endpoint's OpenAPI description is served at. Defaults to
+	// "/v1/openapi.json".
+	OpenApiPath string `toml:"openapi_path"`
+	// API keys, sent in the X-API-Key header, keyed by a name that
+	// identifies the key holder.
+	ApiKeys map[string]IngestApiKey `toml:"api_keys"`
+	// Secret of HS256 signed JSON Web Tokens, sent as bearer tokens.
+	JwtSecret string `toml:"jwt_secret"`
+	// PEM file holding the public key or certificate of RS256 or ES256
+	// signed JSON Web Tokens, if jwt_secret isn't set.
+	JwtPublicKeyFile string `toml:"jwt_public_key_file"`
+	// Required "iss" and "aud" claims of the tokens, if set.
+	JwtIssuer   string `toml:"jwt_issuer"`
+	JwtAudience string `toml:"jwt_audience"`
+	// Events per second each API key, or token subject, may send. Zero
+	// means no limit.
+	RateLimit uint `toml:"rate_limit"`
+	// Maximum number of events in a batch. Defaults to 1000.
+	MaxBatchEvents uint `toml:"max_batch_events"`
+	// Maximum size of a batch body, in bytes. Defaults to 10MiB.
+	MaxBodyBytes uint `toml:"max_body_bytes"`
+}
+
+type IngestApiKey struct {
+	Key string `toml:"key"`
+	// Overrides the endpoint's rate_limit for this key.
+	RateLimit uint `toml:"rate_limit"`
+}
+
+// Serves the bulk ingestion endpoint, authenticating clients, rate limiting
+// them and injecting their events as messages.
+type ingestHandler struct {
+	conf     *IngestConfig
+	hli      *HttpListenInput
+	jwt      *jwtVerifier
+	lock     sync.Mutex
+	limiters map[string]*MessageRateLimiter
+	// Accessed atomically.
+	accepted     int64
+	rejected     int64
+	throttled    int64
+	unauthorized int64
+}
+
+func newIngestHandler(conf *IngestConfig, hli *HttpListenInput) (*ingestHandler, error) {
+	if conf.Path == "" {
+		conf.Path = "/v1/ingest"
+	}
+	if conf.OpenApiPath == "" {
+		conf.OpenApiPath = "/v1/openapi.json"
+	}
+	if conf.MaxBatchEvents == 0 {
+		conf.MaxBatchEvents = 1000
+	}
+	if conf.MaxBodyBytes == 0 {
+		conf.MaxBodyBytes = 10 << 20
+	}
+	for name, key := range conf.ApiKeys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("ingest API key '%s' is empty", name)
+		}
+	}
+	ih := &ingestHandler{conf: conf, hli: hli, limiters: make(map[string]*MessageRateLimiter)}
+	if conf.JwtSecret != "" || conf.JwtPublicKeyFile != "" {
+		var err error
+		if ih.jwt, err = newJwtVerifier(conf.JwtSecret, conf.JwtPublicKeyFile,
+			conf.JwtIssuer, conf.JwtAudience); err != nil {
+
+			return nil, err
+		}
+	} else if len(conf.ApiKeys) == 0 {
+		return nil, errors.New("ingest requires api_keys or a JWT key")
+	}
+	return ih, nil
+}
+
+// Returns the identity of the request's client, and its rate limit, or
+// false if the client couldn't be authenticated.
+func (ih *ingestHandler) authenticate(req *http.Request) (identity string, rate uint,
+	ok bool) {
+
+	if given := req.Header.Get("X-API-Key"); given != "" {
+		for name, key := range ih.conf.ApiKeys {
+			if subtle.ConstantTimeCompare([]byte(given), []byte(key.Key)) == 1 {
+				rate = key.RateLimit
+				if rate == 0 {
+					rate = ih.conf.RateLimit
+				}
+				return name, rate, true
+			}
+		}
+		return "", 0, false
+	}
+	header := req.Header.Get("Authorization")
+	if ih.jwt == nil || !strings.HasPrefix(header, "Bearer ") {
+		return "", 0, false
+	}
+	claims, err := ih.jwt.Verify(strings.TrimSpace(header[len("Bearer "):]))
+	if err != nil {
+		return "", 0, false
+	}
+	return "jwt:" + claims.Subject, ih.conf.RateLimit, true
+}
+
+func (ih *ingestHandler) limiter(identity string, rate uint) *MessageRateLimiter {
+	ih.lock.Lock()
+	defer ih.lock.Unlock()
+	l, ok := ih.limiters[identity]
+	if !ok {
+		l = NewMessageRateLimiter(rate)
+		ih.limiters[identity] = l
+	}
+	return l
+}
+
+// Outcome of one of a batch's events.
+type ingestError struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+type ingestResponse struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Errors   []ingestError `json:"errors,omitempty"`
+}
+
+func writeIngestResponse(w http.ResponseWriter, status int, resp *ingestResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Responds to a request that's rejected as a whole.
+func ingestFail(w http.ResponseWriter, status int, msg string) {
+	writeIngestResponse(w, status, &ingestResponse{
+		Errors: []ingestError{{Index: -1, Status: status, Error: msg}},
+	})
+}
+
+func (ih *ingestHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		ingestFail(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	identity, rate, ok := ih.authenticate(req)
+	if !ok {
+		atomic.AddInt64(&ih.unauthorized, 1)
+		if ih.jwt != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="heka"`)
+		}
+		ingestFail(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != ingestNdjson && mediaType != ingestProtobuf {
+		ingestFail(w, http.StatusUnsupportedMediaType, fmt.Sprintf(
+			"content type must be %s or %s", ingestNdjson, ingestProtobuf))
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body,
+		int64(ih.conf.MaxBodyBytes)))
+	req.Body.Close()
+	if err != nil {
+		ingestFail(w, http.StatusRequestEntityTooLarge, fmt.Sprintf(
+			"body exceeds %d bytes", ih.conf.MaxBodyBytes))
+		return
+	}
+
+	var events []*message.Message
+	var resp ingestResponse
+	if mediaType == ingestNdjson {
+		events, resp.Errors = parseNdjsonEvents(body)
+	} else if events, err = parseProtobufEvents(body); err != nil {
+		ingestFail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(events) > int(ih.conf.MaxBatchEvents) {
+		ingestFail(w, http.StatusRequestEntityTooLarge, fmt.Sprintf(
+			"batch exceeds %d events", ih.conf.MaxBatchEvents))
+		return
+	}
+
+	limiter := ih.limiter(identity, rate)
+	remoteAddr, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remoteAddr = req.RemoteAddr
+	}
+	md := requestConnMetadata(req)
+	ir := ih.hli.ir
+	throttled := 0
+	for i, msg := range events {
+		if msg == nil {
+			continue
+		}
+		if !limiter.Allow() {
+			resp.Errors = append(resp.Errors, ingestError{Index: i,
+				Status: http.StatusTooManyRequests, Error: "rate limit exceeded"})
+			throttled++
+			continue
+		}
+		ih.fillDefaults(msg, identity, remoteAddr)
+		ih.hli.connFields.Write(msg, md)
+		pack := <-ir.InChan()
+		msg.Copy(pack.Message)
+		if err = ir.Inject(pack); err != nil {
+			resp.Errors = append(resp.Errors, ingestError{Index: i,
+				Status: http.StatusUnprocessableEntity, Error: err.Error()})
+			continue
+		}
+		resp.Accepted++
+	}
+	resp.Rejected = len(resp.Errors)
+	atomic.AddInt64(&ih.accepted, int64(resp.Accepted))
+	atomic.AddInt64(&ih.rejected, int64(resp.Rejected))
+	atomic.AddInt64(&ih.throttled, int64(throttled))
+
+	status := http.StatusOK
+	switch {
+	case resp.Rejected == 0:
+	case resp.Accepted > 0:
+		status = http.StatusMultiStatus
+	case throttled == resp.Rejected:
+		w.Header().Set("Retry-After", "1")
+		status = http.StatusTooManyRequests
+	default:
+		status = http.StatusBadRequest
+	}
+	writeIngestResponse(w, status, &resp)
+}
+
+// Fills in the headers an event didn't set, and records where it came from.
+func (ih *ingestHandler) fillDefaults(msg *message.Message, identity, remoteAddr string) {
+	if msg.Uuid == nil {
+		msg.SetUuid(uuid.NewRandom())
+	}
+	if msg.Timestamp == nil {
+		msg.SetTimestamp(time.Now().UnixNano())
+	}
+	if msg.Type == nil {
+		msg.SetType("heka.ingest")
+	}
+	if msg.Logger == nil {
+		msg.SetLogger(ih.hli.ir.Name())
+	}
+	if msg.Severity == nil {
+		msg.SetSeverity(6)
+	}
+	if msg.Hostname == nil {
+		msg.SetHostname(ih.hli.hostname)
+	}
+	if msg.Pid == nil {
+		msg.SetPid(ih.hli.hekaPid)
+	}
+	message.NewStringField(msg, "IngestIdentity", identity)
+	message.NewStringField(msg, "RemoteAddr", remoteAddr)
+}
+
+// An NDJSON event.
+type ingestEvent struct {
+	Uuid       string                 `json:"uuid"`
+	Timestamp  json.RawMessage        `json:"timestamp"`
+	Type       *string                `json:"type"`
+	Logger     *string                `json:"logger"`
+	Severity   *int32                 `json:"severity"`
+	Payload    *string                `json:"payload"`
+	EnvVersion *string                `json:"env_version"`
+	Pid        *int32                 `json:"pid"`
+	Hostname   *string                `json:"hostname"`
+	Fields     map[string]interface{} `json:"fields"`
+}
+
+// Parses an NDJSON body, one event per non-blank line. The events that
+// can't be parsed are nil, with an error for each.
+func parseNdjsonEvents(body []byte) (events []*message.Message, errs []ingestError) {
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		msg, err := parseNdjsonEvent(line)
+		if err != nil {
+			errs = append(errs, ingestError{Index: len(events),
+				Status: http.StatusBadRequest, Error: err.Error()})
+		}
+		events = append(events, msg)
+	}
+	return events, errs
+}
+
+func parseNdjsonEvent(line []byte) (*message.Message, error) {
+	var event ingestEvent
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&event); err != nil {
+		return nil, fmt.Errorf("can't parse event: %s", err)
+	}
+	msg := new(message.Message)
+	if event.Uuid != "" {
+		id := uuid.Parse(event.Uuid)
+		if id == nil {
+			return nil, fmt.Errorf("invalid uuid '%s'", event.Uuid)
+		}
+		msg.SetUuid(id)
+	}
+	if len(event.Timestamp) > 0 {
+		ts, err := parseIngestTimestamp(event.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		msg.SetTimestamp(ts)
+	}
+	msg.Type = event.Type
+	msg.Logger = event.Logger
+	msg.Severity = event.Severity
+	msg.Payload = event.Payload
+	msg.EnvVersion = event.EnvVersion
+	msg.Pid = event.Pid
+	msg.Hostname = event.Hostname
+	if err := addIngestFields(msg, "", event.Fields); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Parses an RFC 3339 timestamp, or a number of seconds since the epoch,
+// into nanoseconds.
+func parseIngestTimestamp(raw json.RawMessage) (int64, error) {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp '%s'", s)
+		}
+		return t.UnixNano(), nil
+	}
+	var secs float64
+	if err := json.Unmarshal(raw, &secs); err != nil {
+		return 0, errors.New("timestamp must be an RFC 3339 string or a number")
+	}
+	return int64(secs * float64(time.Second)), nil
+}
+
+// Adds an event's fields, flattening nested objects into field names made
+// of their keys joined by dots. Arrays become multi-valued fields, and must
+// hold values of a single type.
+func addIngestFields(msg *message.Message, prefix string, fields map[string]interface{}) error {
+	for key, value := range fields {
+		name := prefix + key
+		var field *message.Field
+		var err error
+		switch v := value.(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			if err = addIngestFields(msg, name+".", v); err != nil {
+				return err
+			}
+			continue
+		case []interface{}:
+			if len(v) == 0 {
+				continue
+			}
+			if field, err = message.NewField(name, v[0], ""); err == nil {
+				for _, elem := range v[1:] {
+					if err = field.AddValue(elem); err != nil {
+						break
+					}
+				}
+			}
+		default:
+			field, err = message.NewField(name, v, "")
+		}
+		if err != nil {
+			return fmt.Errorf("field '%s': unsupported value", name)
+		}
+		msg.AddField(field)
+	}
+	return nil
+}
+
+// Parses a protobuf body, a series of Heka messages each preceded by its
+// length as a varint, i.e. protobuf's delimited format.
+func parseProtobufEvents(body []byte) (events []*message.Message, err error) {
+	for len(body) > 0 {
+		size, n := binary.Uvarint(body)
+		if n <= 0 || uint64(len(body)-n) < size {
+			return nil, fmt.Errorf("truncated message at event %d", len(events))
+		}
+		msg := new(message.Message)
+		if err = proto.Unmarshal(body[n:n+int(size)], msg); err != nil {
+			return nil, fmt.Errorf("can't decode event %d: %s", len(events), err)
+		}
+		if msg.Uuid != nil && len(msg.Uuid) != message.UUID_SIZE {
+			return nil, fmt.Errorf("invalid uuid in event %d", len(events))
+		}
+		events = append(events, msg)
+		body = body[n+int(size):]
+	}
+	return events, nil
+}
+
+// Serves an OpenAPI 3.0 description of the endpoint.
+func (ih *ingestHandler) serveOpenApi(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ih.openApi())
+}
+
+type jsonObject map[string]interface{}
+
+func (ih *ingestHandler) openApi() jsonObject {
+	str := jsonObject{"type": "string"}
+	integer := jsonObject{"type": "integer"}
+	errorRef := jsonObject{"$ref": "#/components/schemas/IngestResponse"}
+	response := func(desc string) jsonObject {
+		return jsonObject{"description": desc, "content": jsonObject{
+			"application/json": jsonObject{"schema": errorRef}}}
+	}
+	var security []jsonObject
+	schemes := jsonObject{}
+	if len(ih.conf.ApiKeys) > 0 {
+		schemes["apiKey"] = jsonObject{"type": "apiKey", "in": "header", "name": "X-API-Key"}
+		security = append(security, jsonObject{"apiKey": []string{}})
+	}
+	if ih.jwt != nil {
+		schemes["bearer"] = jsonObject{"type": "http", "scheme": "bearer",
+			"bearerFormat": "JWT"}
+		security = append(security, jsonObject{"bearer": []string{}})
+	}
+	return jsonObject{
+		"openapi": "3.0.3",
+		"info": jsonObject{
+			"title":   "Heka ingest API",
+			"version": "1",
+			"description": fmt.Sprintf("Accepts batches of at most %d events, "+
+				"and %d bytes.", ih.conf.MaxBatchEvents, ih.conf.MaxBodyBytes),
+		},
+		"paths": jsonObject{
+			ih.conf.Path: jsonObject{"post": jsonObject{
+				"summary":  "Ingest a batch of events",
+				"security": security,
+				"requestBody": jsonObject{"required": true, "content": jsonObject{
+					ingestNdjson: jsonObject{
+						"schema":      jsonObject{"$ref": "#/components/schemas/Event"},
+						"description": "One event per line.",
+					},
+					ingestProtobuf: jsonObject{
+						"schema": jsonObject{"type": "string", "format": "binary"},
+						"description": "Heka messages, each preceded by its " +
+							"varint encoded length.",
+					},
+				}},
+				"responses": jsonObject{
+					"200": response("All events were accepted."),
+					"207": response("Some events were accepted, the others are " +
+						"listed in errors."),
+					"400": response("No events were accepted."),
+					"401": response("Authentication failed."),
+					"413": response("The batch is too large."),
+					"415": response("The content type isn't supported."),
+					"429": response("The rate limit was exceeded for every event."),
+				},
+			}},
+		},
+		"components": jsonObject{
+			"securitySchemes": schemes,
+			"schemas": jsonObject{
+				"Event": jsonObject{
+					"type":                 "object",
+					"additionalProperties": false,
+					"properties": jsonObject{
+						"uuid": jsonObject{"type": "string", "format": "uuid"},
+						"timestamp": jsonObject{"oneOf": []jsonObject{
+							{"type": "string", "format": "date-time"},
+							{"type": "number", "description": "Seconds since the epoch."},
+						}},
+						"type":        str,
+						"logger":      str,
+						"severity":    jsonObject{"type": "integer", "minimum": 0, "maximum": 7},
+						"payload":     str,
+						"env_version": str,
+						"pid":         integer,
+						"hostname":    str,
+						"fields": jsonObject{"type": "object", "description": "Nested " +
+							"objects are flattened into dotted field names."},
+					},
+				},
+				"IngestResponse": jsonObject{
+					"type": "object",
+					"properties": jsonObject{
+						"accepted": integer,
+						"rejected": integer,
+						"errors": jsonObject{"type": "array", "items": jsonObject{
+							"type": "object",
+							"properties": jsonObject{
+								"index": jsonObject{"type": "integer", "description": "Index " +
+									"of the event in the batch, or -1 for the whole batch."},
+								"status": integer,
+								"error":  str,
+							},
+						}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (ih *ingestHandler) reportMsg(msg *message.Message) {
+	message.NewInt64Field(msg, "IngestAccepted", atomic.LoadInt64(&ih.accepted), "count")
+	message.NewInt64Field(msg, "IngestRejected", atomic.LoadInt64(&ih.rejected), "count")
+	message.NewInt64Field(msg, "IngestThrottled", atomic.LoadInt64(&ih.throttled), "count")
+	message.NewInt64Field(msg, "IngestUnauthorized", atomic.LoadInt64(&ih.unauthorized),
+		"count")
+}
@@ -0,0 +1,309 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package http
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+// Returns an HS256 signed token holding claims.
+func signTestJwt(secret, claims string) string {
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func IngestSpec(c gs.Context) {
+	t := &pipeline_ts.SimpleT{}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("An HttpListenInput with ingest enabled", func() {
+		pConfig := NewPipelineConfig(nil)
+		inChan := make(chan *PipelinePack, 10)
+		for i := 0; i < cap(inChan); i++ {
+			inChan <- NewPipelinePack(pConfig.InputRecycleChan())
+		}
+		var injected []*message.Message
+		ir := pipelinemock.NewMockInputRunner(ctrl)
+		ir.EXPECT().InChan().Return(inChan).AnyTimes()
+		ir.EXPECT().Name().Return("HttpListenInput").AnyTimes()
+		ir.EXPECT().Inject(gomock.Any()).Do(func(pack *PipelinePack) {
+			injected = append(injected, pack.Message)
+		}).Return(nil).AnyTimes()
+
+		hli := new(HttpListenInput)
+		config := hli.ConfigStruct().(*HttpListenInputConfig)
+		config.Ingest = &IngestConfig{
+			ApiKeys: map[string]IngestApiKey{
+				"web":     {Key: "webkey"},
+				"limited": {Key: "limitedkey", RateLimit: 2},
+			},
+			JwtSecret:      "jwtsecret",
+			JwtIssuer:      "auth.example.com",
+			MaxBatchEvents: 5,
+		}
+		err := hli.Init(config)
+		c.Assume(err, gs.IsNil)
+		hli.ir = ir
+		hli.hostname = "collector"
+
+		post := func(contentType string, body []byte, auth map[string]string) (
+			*httptest.ResponseRecorder, ingestResponse) {
+
+			req := httptest.NewRequest("POST", "/v1/ingest", bytes.NewReader(body))
+			req.RemoteAddr = "10.1.2.3:4567"
+			req.Header.Set("Content-Type", contentType)
+			for key, value := range auth {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			hli.server.Handler.ServeHTTP(w, req)
+			var resp ingestResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			return w, resp
+		}
+		apiKey := map[string]string{"X-API-Key": "webkey"}
+
+		c.Specify("injects NDJSON events", func() {
+			body := `{"type": "app.log", "payload": "one", "timestamp": "2015-06-01T12:00:00Z",` +
+				` "fields": {"status": 200, "user": {"id": "u1"}, "tags": ["a", "b"]}}
+
+{"payload": "two", "timestamp": 1433160000.5, "severity": 3}
+`
+			w, resp := post("application/x-ndjson", []byte(body), apiKey)
+			c.Expect(w.Code, gs.Equals, http.StatusOK)
+			c.Expect(resp.Accepted, gs.Equals, 2)
+			c.Expect(resp.Rejected, gs.Equals, 0)
+			c.Assume(len(injected), gs.Equals, 2)
+
+			msg := injected[0]
+			c.Expect(msg.GetType(), gs.Equals, "app.log")
+			c.Expect(msg.GetPayload(), gs.Equals, "one")
+			c.Expect(msg.GetTimestamp(), gs.Equals,
+				time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC).UnixNano())
+			c.Expect(msg.GetLogger(), gs.Equals, "HttpListenInput")
+			c.Expect(msg.GetHostname(), gs.Equals, "collector")
+			c.Expect(msg.GetSeverity(), gs.Equals, int32(6))
+			c.Expect(len(msg.GetUuid()), gs.Equals, message.UUID_SIZE)
+			status, _ := msg.GetFieldValue("status")
+			c.Expect(status, gs.Equals, float64(200))
+			user, _ := msg.GetFieldValue("user.id")
+			c.Expect(user, gs.Equals, "u1")
+			tags := msg.FindFirstField("tags")
+			c.Assume(tags, gs.Not(gs.IsNil))
+			c.Expect(len(tags.GetValueString()), gs.Equals, 2)
+			identity, _ := msg.GetFieldValue("IngestIdentity")
+			c.Expect(identity, gs.Equals, "web")
+			remote, _ := msg.GetFieldValue("RemoteAddr")
+			c.Expect(remote, gs.Equals, "10.1.2.3")
+
+			msg = injected[1]
+			c.Expect(msg.GetType(), gs.Equals, "heka.ingest")
+			c.Expect(msg.GetSeverity(), gs.Equals, int32(3))
+			c.Expect(msg.GetTimestamp(), gs.Equals, int64(1433160000500000000))
+		})
+
+		c.Specify("writes connection fields over the events' own", func() {
+			hli.connFields, err = NewConnFields(ConnFieldsConfig{Prefix: "Conn",
+				Fields: []string{"remote_port", "protocol"}})
+			c.Assume(err, gs.IsNil)
+			body := `{"payload": "one", "fields": {"ConnProtocol": "SPDY/3"}}`
+			w, _ := post("application/x-ndjson", []byte(body), apiKey)
+			c.Expect(w.Code, gs.Equals, http.StatusOK)
+			c.Assume(len(injected), gs.Equals, 1)
+			port, _ := injected[0].GetFieldValue("ConnRemotePort")
+			c.Expect(port, gs.Equals, int64(4567))
+			protocol, _ := injected[0].GetFieldValue("ConnProtocol")
+			c.Expect(protocol, gs.Equals, "HTTP/1.1")
+		})
+
+		c.Specify("reports the events it can't parse", func() {
+			body := "{\"payload\": \"ok\"}\n{\"bogus\": 1}\nnot json\n"
+			w, resp := post("application/x-ndjson", []byte(body), apiKey)
+			c.Expect(w.Code, gs.Equals, http.StatusMultiStatus)
+			c.Expect(resp.Accepted, gs.Equals, 1)
+			c.Expect(resp.Rejected, gs.Equals, 2)
+			c.Assume(len(resp.Errors), gs.Equals, 2)
+			c.Expect(resp.Errors[0].Index, gs.Equals, 1)
+			c.Expect(resp.Errors[0].Status, gs.Equals, http.StatusBadRequest)
+			c.Expect(resp.Errors[1].Index, gs.Equals, 2)
+			c.Expect(len(injected), gs.Equals, 1)
+
+			c.Specify("and fails batches with no good events", func() {
+				w, resp = post("application/x-ndjson", []byte("[]\n"), apiKey)
+				c.Expect(w.Code, gs.Equals, http.StatusBadRequest)
+				c.Expect(resp.Rejected, gs.Equals, 1)
+			})
+		})
+
+		c.Specify("injects protobuf events", func() {
+			var body []byte
+			for _, payload := range []string{"first", "second"} {
+				msg := new(message.Message)
+				msg.SetType("pb")
+				msg.SetPayload(payload)
+				b, err := proto.Marshal(msg)
+				c.Assume(err, gs.IsNil)
+				size := make([]byte, binary.MaxVarintLen64)
+				body = append(body, size[:binary.PutUvarint(size, uint64(len(b)))]...)
+				body = append(body, b...)
+			}
+			w, resp := post("application/x-protobuf", body, apiKey)
+			c.Expect(w.Code, gs.Equals, http.StatusOK)
+			c.Expect(resp.Accepted, gs.Equals, 2)
+			c.Assume(len(injected), gs.Equals, 2)
+			c.Expect(injected[1].GetPayload(), gs.Equals, "second")
+			c.Expect(injected[1].GetType(), gs.Equals, "pb")
+
+			c.Specify("and rejects truncated bodies", func() {
+				w, _ = post("application/x-protobuf", body[:len(body)-2], apiKey)
+				c.Expect(w.Code, gs.Equals, http.StatusBadRequest)
+			})
+		})
+
+		c.Specify("requires authentication", func() {
+			w, _ := post("application/x-ndjson", []byte("{}\n"), nil)
+			c.Expect(w.Code, gs.Equals, http.StatusUnauthorized)
+			c.Expect(w.Header().Get("WWW-Authenticate"), gs.Not(gs.Equals), "")
+			w, _ = post("application/x-ndjson", []byte("{}\n"),
+				map[string]string{"X-API-Key": "wrong"})
+			c.Expect(w.Code, gs.Equals, http.StatusUnauthorized)
+			c.Expect(len(injected), gs.Equals, 0)
+
+			msg := new(message.Message)
+			hli.ReportMsg(msg)
+			unauthorized, _ := msg.GetFieldValue("IngestUnauthorized")
+			c.Expect(unauthorized, gs.Equals, int64(2))
+		})
+
+		c.Specify("accepts JSON Web Tokens", func() {
+			exp := time.Now().Add(time.Hour).Unix()
+			token := signTestJwt("jwtsecret", fmt.Sprintf(
+				`{"sub": "svc", "iss": "auth.example.com", "exp": %d}`, exp))
+			w, _ := post("application/x-ndjson", []byte("{}\n"),
+				map[string]string{"Authorization": "Bearer " + token})
+			c.Expect(w.Code, gs.Equals, http.StatusOK)
+			c.Assume(len(injected), gs.Equals, 1)
+			identity, _ := injected[0].GetFieldValue("IngestIdentity")
+			c.Expect(identity, gs.Equals, "jwt:svc")
+
+			c.Specify("but not expired, badly signed or foreign ones", func() {
+				for _, token := range []string{
+					signTestJwt("jwtsecret", fmt.Sprintf(
+						`{"sub": "svc", "iss": "auth.example.com", "exp": %d}`,
+						time.Now().Add(-time.Hour).Unix())),
+					signTestJwt("othersecret", `{"sub": "svc", "iss": "auth.example.com"}`),
+					signTestJwt("jwtsecret", `{"sub": "svc", "iss": "evil.example.com"}`),
+				} {
+					w, _ = post("application/x-ndjson", []byte("{}\n"),
+						map[string]string{"Authorization": "Bearer " + token})
+					c.Expect(w.Code, gs.Equals, http.StatusUnauthorized)
+				}
+				c.Expect(len(injected), gs.Equals, 1)
+			})
+		})
+
+		c.Specify("rate limits each key", func() {
+			limited := map[string]string{"X-API-Key": "limitedkey"}
+			w, resp := post("application/x-ndjson", []byte("{}\n{}\n{}\n"), limited)
+			c.Expect(w.Code, gs.Equals, http.StatusMultiStatus)
+			c.Expect(resp.Accepted, gs.Equals, 2)
+			c.Assume(len(resp.Errors), gs.Equals, 1)
+			c.Expect(resp.Errors[0].Index, gs.Equals, 2)
+			c.Expect(resp.Errors[0].Status, gs.Equals, http.StatusTooManyRequests)
+
+			w, resp = post("application/x-ndjson", []byte("{}\n"), limited)
+			c.Expect(w.Code, gs.Equals, http.StatusTooManyRequests)
+			c.Expect(w.Header().Get("Retry-After"), gs.Equals, "1")
+
+			// Other keys have their own limits.
+			w, _ = post("application/x-ndjson", []byte("{}\n"), apiKey)
+			c.Expect(w.Code, gs.Equals, http.StatusOK)
+
+			msg := new(message.Message)
+			hli.ReportMsg(msg)
+			throttled, _ := msg.GetFieldValue("IngestThrottled")
+			c.Expect(throttled, gs.Equals, int64(2))
+			accepted, _ := msg.GetFieldValue("IngestAccepted")
+			c.Expect(accepted, gs.Equals, int64(3))
+		})
+
+		c.Specify("rejects", func() {
+			c.Specify("other content types", func() {
+				w, _ := post("text/plain", []byte("{}\n"), apiKey)
+				c.Expect(w.Code, gs.Equals, http.StatusUnsupportedMediaType)
+			})
+
+			c.Specify("oversized batches", func() {
+				body := strings.Repeat("{}\n", 6)
+				w, _ := post("application/x-ndjson", []byte(body), apiKey)
+				c.Expect(w.Code, gs.Equals, http.StatusRequestEntityTooLarge)
+				c.Expect(len(injected), gs.Equals, 0)
+			})
+
+			c.Specify("other methods", func() {
+				req := httptest.NewRequest("GET", "/v1/ingest", nil)
+				w := httptest.NewRecorder()
+				hli.server.Handler.ServeHTTP(w, req)
+				c.Expect(w.Code, gs.Equals, http.StatusMethodNotAllowed)
+			})
+		})
+
+		c.Specify("describes the endpoint with OpenAPI", func() {
+			req := httptest.NewRequest("GET", "/v1/openapi.json", nil)
+			w := httptest.NewRecorder()
+			hli.server.Handler.ServeHTTP(w, req)
+			c.Expect(w.Code, gs.Equals, http.StatusOK)
+			var doc struct {
+				OpenApi string                 `json:"openapi"`
+				Paths   map[string]interface{} `json:"paths"`
+			}
+			c.Assume(json.Unmarshal(w.Body.Bytes(), &doc), gs.IsNil)
+			c.Expect(doc.OpenApi, gs.Equals, "3.0.3")
+			_, ok := doc.Paths["/v1/ingest"]
+			c.Expect(ok, gs.IsTrue)
+		})
+	})
+
+	c.Specify("Ingest needs a way to authenticate", func() {
+		hli := new(HttpListenInput)
+		config := hli.ConfigStruct().(*HttpListenInputConfig)
+		config.Ingest = &IngestConfig{}
+		c.Expect(hli.Init(config), gs.Not(gs.IsNil))
+	})
+}
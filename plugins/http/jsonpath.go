@@ -0,0 +1,164 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package http
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// One step of a JSONPath: a member name, an array index, or a wildcard
+// matching every member or element. Recursive steps match at any depth.
+type jsonPathStep struct {
+	name      string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool
+}
+
+// A compiled JSONPath expression, supporting the `$` root, `.name` and
+// `['name']` members, `[n]` indexes (negative from the end), `*` and `[*]`
+// wildcards, and `..name` recursive descent.
+type jsonPath []jsonPathStep
+
+func compileJsonPath(expr string) (jsonPath, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("JSONPath '%s' must start with '$'", expr)
+	}
+	var path jsonPath
+	rest := expr[1:]
+	for rest != "" {
+		var step jsonPathStep
+		if strings.HasPrefix(rest, "..") {
+			step.recursive = true
+			rest = rest[2:]
+			if !strings.HasPrefix(rest, "[") {
+				rest = "." + rest
+			}
+		}
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty member name in JSONPath '%s'", expr)
+			}
+			step.name, rest = rest[:end], rest[end:]
+			step.wildcard = step.name == "*"
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed '[' in JSONPath '%s'", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				step.wildcard = true
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') &&
+				inner[len(inner)-1] == inner[0]:
+				step.name = inner[1 : len(inner)-1]
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("bad subscript '[%s]' in JSONPath '%s'",
+						inner, expr)
+				}
+				step.index, step.isIndex = n, true
+			}
+		default:
+			return nil, fmt.Errorf("unexpected '%s' in JSONPath '%s'", rest, expr)
+		}
+		path = append(path, step)
+	}
+	return path, nil
+}
+
+// Find returns the values in the decoded JSON document matched by the path.
+func (p jsonPath) Find(doc interface{}) []interface{} {
+	values := []interface{}{doc}
+	for _, step := range p {
+		var next []interface{}
+		for _, v := range values {
+			if step.recursive {
+				next = step.matchDeep(v, next)
+			} else {
+				next = step.match(v, next)
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// Appends the children of v matched by the step.
+func (s jsonPathStep) match(v interface{}, found []interface{}) []interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			for _, key := range sortedKeys(t) {
+				found = append(found, t[key])
+			}
+		} else if child, ok := t[s.name]; ok && !s.isIndex {
+			found = append(found, child)
+		}
+	case []interface{}:
+		if s.wildcard {
+			found = append(found, t...)
+		} else if s.isIndex {
+			i := s.index
+			if i < 0 {
+				i += len(t)
+			}
+			if i >= 0 && i < len(t) {
+				found = append(found, t[i])
+			}
+		}
+	}
+	return found
+}
+
+// Appends the descendants of v, at any depth, matched by the step.
+func (s jsonPathStep) matchDeep(v interface{}, found []interface{}) []interface{} {
+	found = s.match(v, found)
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(t) {
+			found = s.matchDeep(t[key], found)
+		}
+	case []interface{}:
+		for _, child := range t {
+			found = s.matchDeep(child, found)
+		}
+	}
+	return found
+}
+
+// Object members are visited in key order, so that matches come out in the
+// same order every time.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
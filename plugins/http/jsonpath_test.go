@@ -0,0 +1,88 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package http
+
+import (
+	"encoding/json"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func JsonPathSpec(c gs.Context) {
+	var doc interface{}
+	err := json.Unmarshal([]byte(`{
+		"store": {
+			"books": [
+				{"title": "Sayings", "price": 8.95},
+				{"title": "Sword", "price": 12.99, "isbn": "0-553"}
+			],
+			"bicycle": {"color": "red", "price": 19.95}
+		},
+		"odd key": true
+	}`), &doc)
+	c.Assume(err, gs.IsNil)
+
+	find := func(expr string) []interface{} {
+		path, err := compileJsonPath(expr)
+		c.Assume(err, gs.IsNil)
+		return path.Find(doc)
+	}
+
+	c.Specify("A JSONPath", func() {
+		c.Specify("matches the root", func() {
+			c.Expect(len(find("$")), gs.Equals, 1)
+		})
+
+		c.Specify("matches members and indexes", func() {
+			found := find("$.store.books[1].title")
+			c.Assume(len(found), gs.Equals, 1)
+			c.Expect(found[0], gs.Equals, "Sword")
+			found = find("$['odd key']")
+			c.Assume(len(found), gs.Equals, 1)
+			c.Expect(found[0], gs.Equals, true)
+		})
+
+		c.Specify("counts negative indexes from the end", func() {
+			found := find("$.store.books[-1].isbn")
+			c.Assume(len(found), gs.Equals, 1)
+			c.Expect(found[0], gs.Equals, "0-553")
+		})
+
+		c.Specify("expands wildcards", func() {
+			c.Expect(len(find("$.store.books[*]")), gs.Equals, 2)
+			c.Expect(len(find("$.store.*")), gs.Equals, 2)
+		})
+
+		c.Specify("descends recursively", func() {
+			found := find("$..price")
+			c.Assume(len(found), gs.Equals, 3)
+			// Object members are visited in key order.
+			c.Expect(found[0], gs.Equals, 19.95)
+			c.Expect(found[1], gs.Equals, 8.95)
+		})
+
+		c.Specify("matches nothing when a step is missing", func() {
+			c.Expect(len(find("$.store.cars[0]")), gs.Equals, 0)
+			c.Expect(len(find("$.store.books[5]")), gs.Equals, 0)
+		})
+
+		c.Specify("rejects bad expressions", func() {
+			for _, expr := range []string{"store", "$.", "$[0", "$[x]", "$!"} {
+				_, err := compileJsonPath(expr)
+				c.Expect(err, gs.Not(gs.IsNil))
+			}
+		})
+	})
+}
@@ -0,0 +1,205 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package http
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// How far clocks may disagree when checking a token's validity period.
+const jwtLeeway = time.Minute
+
+// Verifies JSON Web Tokens signed with HS256 using a shared secret, or with
+// RS256 or ES256 using a public key.
+type jwtVerifier struct {
+	secret    []byte
+	publicKey crypto.PublicKey
+	issuer    string
+	audience  string
+	// Replaced by tests.
+	now func() time.Time
+}
+
+// The registered claims that are checked.
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+}
+
+// A token's audience, which may be a single string or an array of them.
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = multiple
+	return nil
+}
+
+// Returns a verifier using the secret or, if that's empty, the PEM encoded
+// public key or certificate in publicKeyFile. The issuer and audience, if
+// not empty, must be those of the tokens.
+func newJwtVerifier(secret, publicKeyFile, issuer, audience string) (*jwtVerifier, error) {
+	v := &jwtVerifier{issuer: issuer, audience: audience, now: time.Now}
+	if secret != "" {
+		v.secret = []byte(secret)
+		return v, nil
+	}
+	data, err := ioutil.ReadFile(publicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't read JWT public key: %s", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in '%s'", publicKeyFile)
+	}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse JWT certificate: %s", err)
+		}
+		v.publicKey = cert.PublicKey
+	} else if v.publicKey, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		return nil, fmt.Errorf("can't parse JWT public key: %s", err)
+	}
+	switch v.publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("JWT public key must be an RSA or ECDSA key")
+	}
+	return v, nil
+}
+
+// Verify checks a token's signature and claims, returning the claims if the
+// token is valid.
+func (v *jwtVerifier) Verify(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJwtPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("bad token header: %s", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("bad token signature encoding")
+	}
+	if err = v.checkSignature(header.Alg, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	claims := new(jwtClaims)
+	if err = decodeJwtPart(parts[1], claims); err != nil {
+		return nil, fmt.Errorf("bad token claims: %s", err)
+	}
+	now := v.now()
+	if claims.ExpiresAt != nil && now.After(jwtTime(*claims.ExpiresAt).Add(jwtLeeway)) {
+		return nil, errors.New("token expired")
+	}
+	if claims.NotBefore != nil && now.Add(jwtLeeway).Before(jwtTime(*claims.NotBefore)) {
+		return nil, errors.New("token not valid yet")
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, errors.New("wrong token issuer")
+	}
+	if v.audience != "" {
+		found := false
+		for _, aud := range claims.Audience {
+			if aud == v.audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("wrong token audience")
+		}
+	}
+	return claims, nil
+}
+
+func (v *jwtVerifier) checkSignature(alg, signed string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch key := v.publicKey.(type) {
+	case nil:
+		if alg != "HS256" {
+			return fmt.Errorf("unsupported token algorithm '%s'", alg)
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return errors.New("bad token signature")
+		}
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return fmt.Errorf("unsupported token algorithm '%s'", alg)
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return errors.New("bad token signature")
+		}
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			return fmt.Errorf("unsupported token algorithm '%s'", alg)
+		}
+		if len(sig) != 64 {
+			return errors.New("bad token signature")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return errors.New("bad token signature")
+		}
+	}
+	return nil
+}
+
+func decodeJwtPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Converts a NumericDate, in seconds since the epoch, to a time.
+func jwtTime(secs float64) time.Time {
+	return time.Unix(0, int64(secs*float64(time.Second)))
+}
@@ -0,0 +1,114 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Lifetime assumed for tokens whose response has no expires_in.
+	defaultTokenLifetime = time.Hour
+	// Most a token is renewed ahead of its expiry, so it doesn't expire in
+	// flight.
+	maxTokenRenewal = 5 * time.Minute
+	// Least time a token is cached for, however short its lifetime, so that
+	// a misbehaving token endpoint isn't asked for one on every request.
+	minTokenLifetime = 10 * time.Second
+)
+
+// TokenCache fetches OAuth2 access tokens with the request NewRequest
+// returns, caching each until shortly before it expires.
+type TokenCache struct {
+	// Returns a new token request, e.g. a client credentials grant.
+	NewRequest func() (*http.Request, error)
+	Client     *http.Client
+	lock       sync.Mutex
+	token      string
+	expiry     time.Time
+}
+
+// Returns how long a token with the given expires_in is cached for. It's
+// renewed a tenth of its lifetime early, up to five minutes, but is always
+// kept for at least ten seconds.
+func tokenLifetime(expiresIn int64) time.Duration {
+	if expiresIn <= 0 {
+		return defaultTokenLifetime - maxTokenRenewal
+	}
+	lifetime := time.Duration(expiresIn) * time.Second
+	renewal := lifetime / 10
+	if renewal > maxTokenRenewal {
+		renewal = maxTokenRenewal
+	}
+	lifetime -= renewal
+	if lifetime < minTokenLifetime {
+		lifetime = minTokenLifetime
+	}
+	return lifetime
+}
+
+// Get returns a valid access token, fetching a new one if need be.
+func (t *TokenCache) Get() (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.token != "" && time.Now().Before(t.expiry) {
+		return t.token, nil
+	}
+
+	req, err := t.NewRequest()
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s: %s", resp.Status,
+			strings.TrimSpace(string(body)))
+	}
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("can't decode token response: %s", err)
+	}
+	if result.AccessToken == "" {
+		return "", errors.New("token response has no access_token")
+	}
+	t.token = result.AccessToken
+	t.expiry = time.Now().Add(tokenLifetime(result.ExpiresIn))
+	return t.token, nil
+}
+
+// Invalidate forgets the cached token, after the server has rejected it.
+func (t *TokenCache) Invalidate() {
+	t.lock.Lock()
+	t.token = ""
+	t.lock.Unlock()
+}
@@ -0,0 +1,78 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func TokenCacheSpec(c gs.Context) {
+	c.Specify("A TokenCache", func() {
+		tokens := 0
+		expiresIn := "3600"
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+			r *http.Request) {
+			tokens++
+			fmt.Fprintf(w, `{"access_token": "token%d", "expires_in": %s}`, tokens,
+				expiresIn)
+		}))
+		defer server.Close()
+		cache := &TokenCache{Client: server.Client(), NewRequest: func() (*http.Request,
+			error) {
+			return http.NewRequest("POST", server.URL, nil)
+		}}
+
+		c.Specify("reuses a token until it's invalidated", func() {
+			token, err := cache.Get()
+			c.Expect(err, gs.IsNil)
+			c.Expect(token, gs.Equals, "token1")
+			token, _ = cache.Get()
+			c.Expect(token, gs.Equals, "token1")
+			cache.Invalidate()
+			token, _ = cache.Get()
+			c.Expect(token, gs.Equals, "token2")
+		})
+
+		c.Specify("keeps short-lived tokens for a while", func() {
+			for _, expiresIn = range []string{"0", "1", "60"} {
+				cache.Invalidate()
+				before := tokens
+				cache.Get()
+				cache.Get()
+				c.Expect(tokens, gs.Equals, before+1)
+			}
+		})
+
+		c.Specify("renews tokens ahead of their expiry", func() {
+			c.Expect(tokenLifetime(0), gs.Equals, 55*time.Minute)
+			c.Expect(tokenLifetime(-1), gs.Equals, 55*time.Minute)
+			c.Expect(tokenLifetime(1), gs.Equals, 10*time.Second)
+			c.Expect(tokenLifetime(60), gs.Equals, 54*time.Second)
+			c.Expect(tokenLifetime(300), gs.Equals, 270*time.Second)
+			c.Expect(tokenLifetime(3600), gs.Equals, 55*time.Minute)
+		})
+
+		c.Specify("reports failed token requests", func() {
+			expiresIn = `0, "x": }`
+			_, err := cache.Get()
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
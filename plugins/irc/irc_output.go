@@ -41,19 +41,36 @@ type IrcOutputConfig struct {
 	Nick     string   `toml:"nick"`
 	Ident    string   `toml:"ident"`
 	Password string   `toml:"password"`
+	// SASL mechanism used to authenticate, "PLAIN" or "EXTERNAL" (with the
+	// TLS client certificate). SASL isn't used if empty.
+	SaslMechanism string `toml:"sasl_mechanism"`
+	// SASL PLAIN account name and password. The login defaults to the nick.
+	SaslLogin    string `toml:"sasl_login"`
+	SaslPassword string `toml:"sasl_password"`
+	// Channels to join, each optionally followed by a space and its key.
 	Channels []string `toml:"channels"`
 	Timeout  uint     `toml:"timeout"`
 	UseTLS   bool     `toml:"use_tls"`
 	// Subsection for TLS configuration.
 	Tls tcp.TlsConfig
 	// This controls the size of the OutQueue and Backlog queue for messages.
-	QueueSize    int  `toml:"queue_size"`
+	QueueSize int `toml:"queue_size"`
+	// Size of each channel's backlog of messages waiting to be replayed once
+	// the channel is (re)joined. Defaults to QueueSize.
+	BacklogSize int `toml:"backlog_size"`
+	// Number of seconds after which backlogged messages are too old to be
+	// replayed. No limit if 0.
+	ReplayMaxAge uint `toml:"replay_max_age"`
 	RejoinOnKick bool `toml:"rejoin_on_kick"`
 	// Default interval at which Irc messages will be sent is minimum of 2
 	// seconds between messages.
 	TickerInterval uint `toml:"ticker_interval"`
 	// Number of seconds to wait before reconnect
 	TimeBeforeReconnect uint `toml:"time_before_reconnect"`
+	// The wait doubles after every failed reconnect, up to this many seconds.
+	MaxReconnectInterval uint `toml:"max_reconnect_interval"`
+	// Max number of failed reconnects before giving up. No limit if 0.
+	MaxReconnectAttempts uint `toml:"max_reconnect_attempts"`
 	// Number of seconds to wait before attempting to rejoin a channel
 	TimeBeforeRejoin uint `toml:"time_before_rejoin"`
 	// Max number of attempts to rejoin an irc channel before giving up
@@ -66,9 +83,10 @@ func (output *IrcOutput) ConfigStruct() interface{} {
 		Timeout:             10,
 		QueueSize:           100,
 		TickerInterval:      uint(2),
-		TimeBeforeReconnect: uint(3),
-		TimeBeforeRejoin:    uint(3),
-		MaxJoinRetries:      uint(3),
+		TimeBeforeReconnect:  uint(3),
+		MaxReconnectInterval: uint(300),
+		TimeBeforeRejoin:     uint(3),
+		MaxJoinRetries:       uint(3),
 	}
 }
 
@@ -94,11 +112,30 @@ type IrcMsg struct {
 	Output     []byte
 	IrcChannel string
 	Idx        int
+	// When the message was queued, to tell if it's too old to replay.
+	Queued time.Time
 }
 
 func (output *IrcOutput) Init(config interface{}) error {
 	conf := config.(*IrcOutputConfig)
 	output.IrcOutputConfig = conf
+	switch conf.SaslMechanism {
+	case "":
+	case "PLAIN":
+		if conf.SaslPassword == "" {
+			return errors.New("SASL PLAIN needs a sasl_password")
+		}
+	case "EXTERNAL":
+		if !conf.UseTLS || conf.Tls.CertFile == "" {
+			return errors.New("SASL EXTERNAL needs use_tls and a TLS cert_file")
+		}
+	default:
+		return fmt.Errorf("Unsupported SASL mechanism: %s", conf.SaslMechanism)
+	}
+	if conf.BacklogSize == 0 {
+		conf.BacklogSize = conf.QueueSize
+	}
+
 	conn, err := output.InitIrcCon(conf)
 	if err != nil {
 		return fmt.Errorf("Error setting up Irc Connection: %s", err)
@@ -121,7 +158,7 @@ func (output *IrcOutput) Init(config interface{}) error {
 	output.OutQueue = make(IrcMsgQueue, output.QueueSize)
 	output.BacklogQueues = make([]IrcMsgQueue, numChannels)
 	for queue := range output.BacklogQueues {
-		output.BacklogQueues[queue] = make(IrcMsgQueue, output.QueueSize)
+		output.BacklogQueues[queue] = make(IrcMsgQueue, output.BacklogSize)
 	}
 	output.die = make(chan bool)
 	output.killProcessing = make(chan bool)
@@ -179,7 +216,7 @@ func (output *IrcOutput) Run(runner pipeline.OutputRunner,
 			// then we need to drop the message and log an error.
 			sentAny := false
 			for i, ircChannel := range output.Channels {
-				ircMsg := IrcMsg{outgoing, ircChannel, i}
+				ircMsg := IrcMsg{outgoing, ircChannel, i, time.Now()}
 				select {
 				case output.OutQueue <- ircMsg:
 					sentAny = true
@@ -292,7 +329,8 @@ func (output *IrcOutput) updateJoinListAll(status int32) {
 // sendFromOutQueue attempts to send a message to the irc channel specified in
 // the ircMsg struct. If sending fails due to not being in the irc channel, it
 // will put the message into that irc channel's backlog queue. If the queue is
-// full it will drop the message and log an error.
+// full it will drop the oldest message and log an error, so that the most
+// recent messages are the ones replayed.
 // It returns whether or not a message was successfully delivered to an
 // irc channel.
 func sendFromOutQueue(output *IrcOutput, ircMsg *IrcMsg) bool {
@@ -306,39 +344,59 @@ func sendFromOutQueue(output *IrcOutput, ircMsg *IrcMsg) bool {
 		// Get the proper Channel for the backlog
 		idx := ircMsg.Idx
 		backlogQueue := output.BacklogQueues[idx]
-		select {
-		// try to put the message into the backlog queue
-		case backlogQueue <- *ircMsg:
-
-		default:
+		for {
+			select {
+			// try to put the message into the backlog queue
+			case backlogQueue <- *ircMsg:
+				return false
+			default:
+			}
 			// Failed to put, which means the backlog for this Irc
-			// channel is full. So drop it and log a message.
+			// channel is full. So drop the oldest and log a message.
+			select {
+			case <-backlogQueue:
+			default:
+			}
 			output.runner.LogError(
 				fmt.Errorf("%s Channel: %s.",
 					ErrBacklogQueueFull, ircMsg.IrcChannel))
 		}
-		return false
+	}
+}
+
+// nextReplayable takes the next message from a backlog queue, dropping those
+// older than ReplayMaxAge. It returns whether there was one to take.
+func (output *IrcOutput) nextReplayable(queue IrcMsgQueue) (ircMsg IrcMsg, ok bool) {
+	maxAge := time.Second * time.Duration(output.ReplayMaxAge)
+	for {
+		select {
+		case ircMsg, ok = <-queue:
+		default:
+			// No backed up messages for this irc channel
+			return ircMsg, false
+		}
+		if !ok || maxAge == 0 || time.Since(ircMsg.Queued) <= maxAge {
+			return
+		}
+		output.runner.LogError(fmt.Errorf("%s Channel: %s.",
+			ErrBacklogMsgExpired, ircMsg.IrcChannel))
 	}
 }
 
 // sendFromBacklogQueue attempts to send a message from the first backlog queue
-// which has a message in it. It returns whether or not a message was
-// successfully delivered to an irc channel.
+// which has a message in it that isn't too old to replay. It returns whether
+// or not a message was successfully delivered to an irc channel.
 func sendFromBacklogQueue(output *IrcOutput) bool {
 
-	var ircMsg IrcMsg
 	// No messages in the out queue, so lets try the backlog queue
 	for i, queue := range output.BacklogQueues {
 		if atomic.LoadInt32(&output.JoinedChannels[i]) != JOINED {
 			continue
 		}
-		select {
-		case ircMsg = <-queue:
+		if ircMsg, ok := output.nextReplayable(queue); ok {
 			if output.Privmsg(&ircMsg) {
 				return true
 			}
-		default:
-			// No backed up messages for this irc channel
 		}
 	}
 	return false
@@ -425,15 +483,37 @@ func registerCallbacks(output *IrcOutput) {
 	output.Conn.AddCallback(ERROR, func(event *irc.Event) {
 		output.updateJoinListAll(NOTJOINED)
 		output.runner.LogMessage(DisconnectMsg)
-		timer := time.NewTimer(time.Second * time.Duration(output.TimeBeforeReconnect))
-		<-timer.C
-		err := output.Conn.Reconnect()
-		if err != nil {
+		wait := time.Second * time.Duration(output.TimeBeforeReconnect)
+		maxWait := time.Second * time.Duration(output.MaxReconnectInterval)
+		for attempt := uint(1); ; attempt++ {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-output.killProcessing:
+				// We're shutting down, so there's no point reconnecting.
+				timer.Stop()
+				return
+			}
+			err := output.Conn.Reconnect()
+			if err == nil {
+				break
+			}
 			output.runner.LogError(fmt.Errorf(ErrReconnecting, err))
-			output.Conn.ClearCallback(ERROR)
-			output.die <- true
-			return
+			if attempt == output.MaxReconnectAttempts {
+				output.Conn.ClearCallback(ERROR)
+				output.die <- true
+				return
+			}
+			// Back off, so a server that's down isn't hammered.
+			if wait *= 2; wait == 0 {
+				wait = time.Second
+			}
+			if wait > maxWait {
+				wait = maxWait
+			}
 		}
+		// Messages for channels we haven't rejoined yet wait in their
+		// backlogs, and are replayed once we have.
 		output.runner.LogMessage(ReconnectedMsg)
 	})
 
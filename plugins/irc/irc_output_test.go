@@ -66,6 +66,25 @@ func IrcOutputSpec(c gs.Context) {
 		pack := NewPipelinePack(pipelineConfig.InputRecycleChan())
 		pack.Message = msg
 
+		c.Specify("checks its SASL settings", func() {
+			config.SaslMechanism = "SCRAM-SHA-256"
+			c.Expect(ircOutput.Init(config), gs.Not(gs.IsNil))
+			config.SaslMechanism = "EXTERNAL"
+			c.Expect(ircOutput.Init(config), gs.Not(gs.IsNil))
+			config.SaslMechanism = "PLAIN"
+			c.Expect(ircOutput.Init(config), gs.Not(gs.IsNil))
+			config.SaslPassword = "secret"
+			c.Expect(ircOutput.Init(config), gs.IsNil)
+
+			conn, err := NewIrcConn(config)
+			c.Assume(err, gs.IsNil)
+			ircConn := conn.(*irc.Connection)
+			c.Expect(ircConn.UseSASL, gs.IsTrue)
+			c.Expect(ircConn.SASLMech, gs.Equals, "PLAIN")
+			c.Expect(ircConn.SASLLogin, gs.Equals, "heka_bot")
+			c.Expect(ircConn.SASLPassword, gs.Equals, "secret")
+		})
+
 		c.Specify("requires an encoder", func() {
 			err := ircOutput.Init(config)
 			c.Assume(err, gs.IsNil)
@@ -173,6 +192,9 @@ func IrcOutputSpec(c gs.Context) {
 				// it. This is where we drop it since we cant send, and the
 				// BacklogQueue is already full.
 				tickChan <- time.Now()
+				// The second tick is only taken once the first is handled, so
+				// the OutQueue is empty again.
+				tickChan <- time.Now()
 
 				// Now we want to also cause the OutQueue to drop a message.
 				// We don't have to wait for it to arrive in the OutQueue like we do above
@@ -217,8 +239,33 @@ func IrcOutputSpec(c gs.Context) {
 				c.Expect(mockIrcConn.quit, gs.IsTrue)
 			})
 
+			c.Specify("keeps trying to reconnect", func() {
+				config.TimeBeforeReconnect = 0
+				config.MaxReconnectInterval = 0
+				err := ircOutput.Init(config)
+				c.Assume(err, gs.IsNil)
+				mockIrcConn.failReconnects = 2
+
+				outTestHelper.MockOutputRunner.EXPECT().LogMessage(DisconnectMsg)
+				outTestHelper.MockOutputRunner.EXPECT().LogError(
+					fmt.Errorf(ErrReconnecting, mockErrFailReconnect)).Times(2)
+				outTestHelper.MockOutputRunner.EXPECT().LogMessage(ReconnectedMsg)
+
+				startOutput()
+
+				ircOutput.Conn.Disconnect()
+				c.Expect(<-mockIrcConn.connected, gs.IsFalse)
+				c.Expect(<-mockIrcConn.connected, gs.IsTrue)
+
+				close(inChan)
+				wg.Wait()
+
+				c.Expect(mockIrcConn.quit, gs.IsTrue)
+			})
+
 			c.Specify("logs an error and exits from Run() when it cannot reconnect", func() {
 				config.TimeBeforeReconnect = 0
+				config.MaxReconnectAttempts = 1
 
 				err := ircOutput.Init(config)
 				c.Assume(err, gs.IsNil)
@@ -245,6 +292,90 @@ func IrcOutputSpec(c gs.Context) {
 				close(inChan)
 			})
 
+			// Parts the channel and sends a message, which then waits in the
+			// channel's backlog.
+			backlogMessage := func(ircChan string) IrcMsg {
+				ircOutput.Conn.Part(ircChan)
+				inChan <- pack
+				p := <-ircOutput.OutQueue
+				ircOutput.OutQueue <- p
+				tickChan <- time.Now()
+				return <-ircOutput.BacklogQueues[0]
+			}
+
+			c.Specify("replays backlogged messages once it rejoins", func() {
+				config.ReplayMaxAge = 60
+				err := ircOutput.Init(config)
+				c.Assume(err, gs.IsNil)
+				ircChan := ircOutput.Channels[0]
+
+				startOutput()
+
+				ircOutput.BacklogQueues[0] <- backlogMessage(ircChan)
+				ircOutput.Join(ircChan)
+				tickChan <- time.Now()
+				<-mockIrcConn.delivered
+
+				close(inChan)
+				wg.Wait()
+
+				msgs := mockIrcConn.msgs[ircChan]
+				c.Expect(len(msgs), gs.Equals, 1)
+				c.Expect(msgs[0], gs.Equals, string(*msg.Payload))
+			})
+
+			c.Specify("drops backlogged messages too old to replay", func() {
+				config.ReplayMaxAge = 60
+				err := ircOutput.Init(config)
+				c.Assume(err, gs.IsNil)
+				ircChan := ircOutput.Channels[0]
+
+				outTestHelper.MockOutputRunner.EXPECT().LogError(
+					fmt.Errorf("%s Channel: %s.", ErrBacklogMsgExpired, ircChan))
+
+				startOutput()
+
+				ircMsg := backlogMessage(ircChan)
+				ircMsg.Queued = ircMsg.Queued.Add(-time.Hour)
+				ircOutput.BacklogQueues[0] <- ircMsg
+				ircOutput.Join(ircChan)
+				tickChan <- time.Now()
+				// The second tick is only taken once the first is handled.
+				tickChan <- time.Now()
+
+				close(inChan)
+				wg.Wait()
+
+				c.Expect(len(mockIrcConn.msgs[ircChan]), gs.Equals, 0)
+			})
+
+			c.Specify("keeps the newest messages when the backlog is full", func() {
+				config.BacklogSize = 1
+				err := ircOutput.Init(config)
+				c.Assume(err, gs.IsNil)
+				ircChan := ircOutput.Channels[0]
+
+				outTestHelper.MockOutputRunner.EXPECT().LogError(
+					fmt.Errorf("%s Channel: %s.", ErrBacklogQueueFull, ircChan))
+
+				startOutput()
+
+				ircMsg := backlogMessage(ircChan)
+				ircMsg.Output = []byte("old")
+				ircOutput.BacklogQueues[0] <- ircMsg
+				inChan <- pack
+				p := <-ircOutput.OutQueue
+				ircOutput.OutQueue <- p
+				tickChan <- time.Now()
+				tickChan <- time.Now()
+
+				ircMsg = <-ircOutput.BacklogQueues[0]
+				c.Expect(string(ircMsg.Output), gs.Equals, string(*msg.Payload))
+
+				close(inChan)
+				wg.Wait()
+			})
+
 			c.Specify("when kicked from an irc channel", func() {
 
 				c.Specify("rejoins when configured to do so", func() {
@@ -46,6 +46,7 @@ const (
 var (
 	ErrOutQueueFull        = errors.New("Dropped message. OutQueue is full.")
 	ErrBacklogQueueFull    = errors.New("Dropped message. BacklogQueue is full.")
+	ErrBacklogMsgExpired   = errors.New("Dropped message. Too old to replay.")
 	ErrBannedFromServer    = errors.New("Banned from irc server. Exiting plugin.")
 	ErrNoJoinableChannels  = errors.New("No joinable channels. Exiting plugin.")
 	ErrReconnecting        = "Error reconnecting: %s"
@@ -102,5 +103,14 @@ func NewIrcConn(config *IrcOutputConfig) (IrcConnection, error) {
 	conn.Password = config.Password
 	conn.Timeout = time.Duration(config.Timeout) * time.Second
 	conn.VerboseCallbackHandler = config.VerboseIRCLogging
+	if config.SaslMechanism != "" {
+		conn.UseSASL = true
+		conn.SASLMech = config.SaslMechanism
+		conn.SASLLogin = config.SaslLogin
+		if conn.SASLLogin == "" {
+			conn.SASLLogin = config.Nick
+		}
+		conn.SASLPassword = config.SaslPassword
+	}
 	return conn, nil
 }
@@ -29,7 +29,9 @@ type MockIrcConnection struct {
 	Error          chan error
 
 	failReconnect bool
-	failJoin      bool
+	// Number of reconnects that fail before one succeeds.
+	failReconnects int
+	failJoin       bool
 	// These are used in the tests to allow the test to wait for specific
 	// actions to finish so we don't have race conditions
 	connected chan bool
@@ -97,6 +99,10 @@ func (conn *MockIrcConnection) Reconnect() error {
 	if conn.failReconnect {
 		return mockErrFailReconnect
 	}
+	if conn.failReconnects > 0 {
+		conn.failReconnects--
+		return mockErrFailReconnect
+	}
 	conn.Connect(conn.server)
 	return nil
 }
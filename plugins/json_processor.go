@@ -0,0 +1,118 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type JsonProcessorConfig struct {
+	// Prefix added to the names of the fields created.
+	FieldPrefix string `toml:"field_prefix"`
+	// Put between the keys of nested objects in field names. Defaults to ".".
+	Separator string `toml:"separator"`
+	// Whether the payload is cleared once it's been parsed.
+	RemovePayload bool `toml:"remove_payload"`
+}
+
+// Parses payloads holding a JSON object into message fields, nested objects
+// being flattened into field names made of their keys. Arrays of strings,
+// numbers or booleans become multi-valued fields, and other arrays fields
+// holding their JSON. Nulls are skipped.
+type JsonProcessor struct {
+	conf *JsonProcessorConfig
+}
+
+func (jp *JsonProcessor) ConfigStruct() interface{} {
+	return &JsonProcessorConfig{Separator: "."}
+}
+
+func (jp *JsonProcessor) Init(config interface{}) error {
+	jp.conf = config.(*JsonProcessorConfig)
+	return nil
+}
+
+func (jp *JsonProcessor) Process(pack *PipelinePack) (keep bool, err error) {
+	var obj map[string]interface{}
+	if err = json.Unmarshal([]byte(pack.Message.GetPayload()), &obj); err != nil {
+		return true, fmt.Errorf("can't parse payload: %s", err)
+	}
+	if err = jp.addFields(pack.Message, jp.conf.FieldPrefix, obj); err != nil {
+		return true, err
+	}
+	if jp.conf.RemovePayload {
+		pack.Message.SetPayload("")
+	}
+	return true, nil
+}
+
+func (jp *JsonProcessor) addFields(msg *message.Message, prefix string,
+	obj map[string]interface{}) error {
+
+	for key, value := range obj {
+		name := prefix + key
+		if value == nil {
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			if err := jp.addFields(msg, name+jp.conf.Separator, nested); err != nil {
+				return err
+			}
+			continue
+		}
+		field, err := jsonField(name, value)
+		if err != nil {
+			return fmt.Errorf("field '%s': %s", name, err)
+		}
+		msg.AddField(field)
+	}
+	return nil
+}
+
+// Makes a field of a JSON value other than an object.
+func jsonField(name string, value interface{}) (*message.Field, error) {
+	arr, ok := value.([]interface{})
+	if !ok {
+		return message.NewField(name, value, "")
+	}
+	if len(arr) > 0 {
+		if field, err := message.NewField(name, arr[0], ""); err == nil {
+			for _, v := range arr[1:] {
+				if field.AddValue(v) != nil {
+					field = nil
+					break
+				}
+			}
+			if field != nil {
+				return field, nil
+			}
+		}
+	}
+	encoded, err := json.Marshal(arr)
+	if err != nil {
+		return nil, err
+	}
+	return message.NewField(name, string(encoded), "json")
+}
+
+func init() {
+	RegisterPlugin("JsonProcessor", func() interface{} {
+		return new(JsonProcessor)
+	})
+}
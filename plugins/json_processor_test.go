@@ -0,0 +1,75 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+)
+
+func JsonProcessorSpec(c gs.Context) {
+	c.Specify("A JsonProcessor", func() {
+		processor := new(JsonProcessor)
+		config := processor.ConfigStruct().(*JsonProcessorConfig)
+		pack := NewPipelinePack(make(chan *PipelinePack, 1))
+		pack.Message.SetPayload(`{"user": "bob", "status": 200, "ok": true,
+			"tags": ["a", "b"], "mixed": [1, "x"], "req": {"path": "/", "q": {"id": 3}},
+			"gone": null}`)
+
+		c.Specify("turns the payload's keys into fields", func() {
+			c.Assume(processor.Init(config), gs.IsNil)
+			keep, err := processor.Process(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(keep, gs.IsTrue)
+			msg := pack.Message
+			val, _ := msg.GetFieldValue("user")
+			c.Expect(val, gs.Equals, "bob")
+			val, _ = msg.GetFieldValue("status")
+			c.Expect(val, gs.Equals, float64(200))
+			val, _ = msg.GetFieldValue("ok")
+			c.Expect(val, gs.Equals, true)
+			val, _ = msg.GetFieldValue("req.path")
+			c.Expect(val, gs.Equals, "/")
+			val, _ = msg.GetFieldValue("req.q.id")
+			c.Expect(val, gs.Equals, float64(3))
+			c.Expect(len(msg.FindFirstField("tags").GetValueString()), gs.Equals, 2)
+			val, _ = msg.GetFieldValue("mixed")
+			c.Expect(val, gs.Equals, `[1,"x"]`)
+			c.Expect(msg.FindFirstField("gone"), gs.IsNil)
+			c.Expect(msg.GetPayload() == "", gs.IsFalse)
+		})
+
+		c.Specify("uses the prefix and separator, and removes the payload", func() {
+			config.FieldPrefix = "j_"
+			config.Separator = "_"
+			config.RemovePayload = true
+			c.Assume(processor.Init(config), gs.IsNil)
+			_, err := processor.Process(pack)
+			c.Expect(err, gs.IsNil)
+			val, _ := pack.Message.GetFieldValue("j_req_q_id")
+			c.Expect(val, gs.Equals, float64(3))
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "")
+		})
+
+		c.Specify("keeps messages it can't parse", func() {
+			c.Assume(processor.Init(config), gs.IsNil)
+			pack.Message.SetPayload("not json")
+			keep, err := processor.Process(pack)
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(keep, gs.IsTrue)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "not json")
+		})
+	})
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -61,11 +62,17 @@ type KafkaInputConfig struct {
 	MaxWaitTime      uint32 `toml:"max_wait_time"`
 	OffsetMethod     string `toml:"offset_method"` // Manual, Newest, Oldest
 	EventBufferSize  int    `toml:"event_buffer_size"`
+	// Milliseconds between checkpoint writes with the Manual offset method.
+	CheckpointInterval uint `toml:"checkpoint_interval"`
+	// Number of messages after which the checkpoint is written, even if the
+	// interval hasn't passed.
+	CheckpointCount uint `toml:"checkpoint_count"`
 }
 
 type KafkaInput struct {
 	processMessageCount    int64
 	processMessageFailures int64
+	checkpointFailures     int64
 
 	config             *KafkaInputConfig
 	saramaConfig       *sarama.Config
@@ -73,10 +80,15 @@ type KafkaInput struct {
 	partitionConsumer  sarama.PartitionConsumer
 	pConfig            *pipeline.PipelineConfig
 	ir                 pipeline.InputRunner
-	checkpointFile     *os.File
+	checkpointer       pipeline.Checkpointer
 	stopChan           chan bool
 	name               string
+	checkpointKey      string
 	checkpointFilename string
+	// The next offset to consume, waiting to be checkpointed, and how many
+	// messages it's ahead of the stored checkpoint. Only touched by Run.
+	unsavedOffset int64
+	unsavedCount  uint
 }
 
 func (k *KafkaInput) ConfigStruct() interface{} {
@@ -96,30 +108,53 @@ func (k *KafkaInput) ConfigStruct() interface{} {
 		MaxWaitTime:                250,
 		OffsetMethod:               "Manual",
 		EventBufferSize:            16,
+		CheckpointInterval:         1000,
+		CheckpointCount:            500,
 	}
 }
 
-func fileExists(path string) bool {
-	_, err := os.Stat(path)
-	if err == nil {
-		return true
+func (k *KafkaInput) writeCheckpoint(offset int64) error {
+	return k.checkpointer.Set(k.checkpointKey, []byte(strconv.FormatInt(offset, 10)))
+}
+
+// Records the next offset to consume, writing the checkpoint once
+// checkpoint_count messages have gone by without one.
+func (k *KafkaInput) updateCheckpoint(offset int64) {
+	k.unsavedOffset = offset
+	k.unsavedCount++
+	if k.unsavedCount >= k.config.CheckpointCount {
+		k.flushCheckpoint()
 	}
-	return false
 }
 
-func (k *KafkaInput) writeCheckpoint(offset int64) (err error) {
-	if k.checkpointFile == nil {
-		if k.checkpointFile, err = os.OpenFile(k.checkpointFilename,
-			os.O_WRONLY|os.O_SYNC|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
-			return
-		}
+// Writes the checkpoint if it's behind. A failed write is logged and left
+// to be retried by the next flush, rather than stopping the input.
+func (k *KafkaInput) flushCheckpoint() {
+	if k.unsavedCount == 0 {
+		return
 	}
-	k.checkpointFile.Seek(0, 0)
-	err = binary.Write(k.checkpointFile, binary.LittleEndian, &offset)
-	return
+	if err := k.writeCheckpoint(k.unsavedOffset); err != nil {
+		atomic.AddInt64(&k.checkpointFailures, 1)
+		k.ir.LogError(fmt.Errorf("writing checkpoint: %s", err))
+		return
+	}
+	k.unsavedCount = 0
 }
 
-func readCheckpoint(filename string) (offset int64, err error) {
+// Returns the checkpointed offset, or false if there's none.
+func (k *KafkaInput) readCheckpoint() (offset int64, ok bool, err error) {
+	value, err := k.checkpointer.Get(k.checkpointKey)
+	if value == nil || err != nil {
+		return 0, false, err
+	}
+	if offset, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+		return 0, false, fmt.Errorf("bad checkpoint %q", value)
+	}
+	return offset, true, nil
+}
+
+// Reads the offset earlier versions kept in a binary file of their own.
+func readCheckpointFile(filename string) (offset int64, err error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return
@@ -129,6 +164,22 @@ func readCheckpoint(filename string) (offset int64, err error) {
 	return
 }
 
+// Moves an offset from an earlier version's checkpoint file into the
+// checkpointer.
+func (k *KafkaInput) migrateCheckpointFile() error {
+	offset, err := readCheckpointFile(k.checkpointFilename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	value := []byte(strconv.FormatInt(offset, 10))
+	if _, err = k.checkpointer.CompareAndSet(k.checkpointKey, nil, value); err != nil {
+		return err
+	}
+	return os.Remove(k.checkpointFilename)
+}
+
 func (k *KafkaInput) SetPipelineConfig(pConfig *pipeline.PipelineConfig) {
 	k.pConfig = pConfig
 }
@@ -145,6 +196,12 @@ func (k *KafkaInput) Init(config interface{}) (err error) {
 	if len(k.config.Group) == 0 {
 		k.config.Group = k.config.Id
 	}
+	if k.config.CheckpointInterval == 0 {
+		return errors.New("checkpoint_interval must be greater than 0")
+	}
+	if k.config.CheckpointCount == 0 {
+		return errors.New("checkpoint_count must be greater than 0")
+	}
 
 	k.saramaConfig = sarama.NewConfig()
 	k.saramaConfig.ClientID = k.config.Id
@@ -168,35 +225,34 @@ func (k *KafkaInput) Init(config interface{}) (err error) {
 	k.saramaConfig.Consumer.Fetch.Min = k.config.MinFetchSize
 	k.saramaConfig.Consumer.Fetch.Max = k.config.MaxMessageSize
 	k.saramaConfig.Consumer.MaxWaitTime = time.Duration(k.config.MaxWaitTime) * time.Millisecond
+	name := fmt.Sprintf("%s.%s.%d", k.name, k.config.Topic, k.config.Partition)
+	k.checkpointer = k.pConfig.Checkpointer()
+	k.checkpointKey = "kafka/" + name
 	k.checkpointFilename = k.pConfig.Globals.PrependBaseDir(filepath.Join("kafka",
-		fmt.Sprintf("%s.%s.%d.offset.bin", k.name, k.config.Topic, k.config.Partition)))
+		name+".offset.bin"))
+	if err = k.migrateCheckpointFile(); err != nil {
+		return fmt.Errorf("migrating checkpoint file: %s", err)
+	}
 
 	var offset int64
 	switch k.config.OffsetMethod {
 	case "Manual":
-		if fileExists(k.checkpointFilename) {
-			if offset, err = readCheckpoint(k.checkpointFilename); err != nil {
-				return fmt.Errorf("readCheckpoint %s", err)
-			}
-		} else {
-			if err = os.MkdirAll(filepath.Dir(k.checkpointFilename), 0766); err != nil {
-				return err
-			}
+		var ok bool
+		if offset, ok, err = k.readCheckpoint(); err != nil {
+			return fmt.Errorf("readCheckpoint %s", err)
+		}
+		if !ok {
 			offset = sarama.OffsetOldest
 		}
 	case "Newest":
 		offset = sarama.OffsetNewest
-		if fileExists(k.checkpointFilename) {
-			if err = os.Remove(k.checkpointFilename); err != nil {
-				return err
-			}
+		if err = k.checkpointer.Delete(k.checkpointKey); err != nil {
+			return err
 		}
 	case "Oldest":
 		offset = sarama.OffsetOldest
-		if fileExists(k.checkpointFilename) {
-			if err = os.Remove(k.checkpointFilename); err != nil {
-				return err
-			}
+		if err = k.checkpointer.Delete(k.checkpointKey); err != nil {
+			return err
 		}
 	default:
 		return fmt.Errorf("invalid offset_method: %s", k.config.OffsetMethod)
@@ -228,13 +284,21 @@ func (k *KafkaInput) Run(ir pipeline.InputRunner, h pipeline.PluginHelper) (err
 	defer func() {
 		k.partitionConsumer.Close()
 		k.consumer.Close()
-		if k.checkpointFile != nil {
-			k.checkpointFile.Close()
-		}
 		sRunner.Done()
 	}()
 	k.ir = ir
 	k.stopChan = make(chan bool)
+	k.unsavedCount = 0
+	// Whatever's been consumed is checkpointed on the way out.
+	defer k.flushCheckpoint()
+
+	var tickChan <-chan time.Time
+	if k.config.OffsetMethod == "Manual" {
+		ticker := time.NewTicker(time.Duration(k.config.CheckpointInterval) *
+			time.Millisecond)
+		defer ticker.Stop()
+		tickChan = ticker.C
+	}
 
 	var (
 		hostname = k.pConfig.Hostname()
@@ -276,11 +340,12 @@ func (k *KafkaInput) Run(ir pipeline.InputRunner, h pipeline.PluginHelper) (err
 			}
 
 			if k.config.OffsetMethod == "Manual" {
-				if err = k.writeCheckpoint(event.Offset + 1); err != nil {
-					return err
-				}
+				k.updateCheckpoint(event.Offset + 1)
 			}
 
+		case <-tickChan:
+			k.flushCheckpoint()
+
 		case cError, ok = <-cErrChan:
 			if !ok {
 				// Don't exit until the eventChan is closed.
@@ -289,12 +354,9 @@ func (k *KafkaInput) Run(ir pipeline.InputRunner, h pipeline.PluginHelper) (err
 			}
 			if cError.Err == sarama.ErrOffsetOutOfRange {
 				ir.LogError(fmt.Errorf(
-					"removing the out of range checkpoint file and stopping"))
-				if k.checkpointFile != nil {
-					k.checkpointFile.Close()
-					k.checkpointFile = nil
-				}
-				if err := os.Remove(k.checkpointFilename); err != nil {
+					"removing the out of range checkpoint and stopping"))
+				k.unsavedCount = 0
+				if err := k.checkpointer.Delete(k.checkpointKey); err != nil {
 					ir.LogError(err)
 				}
 				return err
@@ -317,6 +379,8 @@ func (k *KafkaInput) ReportMsg(msg *message.Message) error {
 		atomic.LoadInt64(&k.processMessageCount), "count")
 	message.NewInt64Field(msg, "ProcessMessageFailures",
 		atomic.LoadInt64(&k.processMessageFailures), "count")
+	message.NewInt64Field(msg, "CheckpointFailures",
+		atomic.LoadInt64(&k.checkpointFailures), "count")
 	return nil
 }
 
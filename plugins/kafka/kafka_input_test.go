@@ -16,6 +16,7 @@
 package kafka
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -151,9 +152,8 @@ func TestReceivePayloadMessage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	filename := filepath.Join(tmpDir, "kafka", "test.test.0.offset.bin")
-	if o, err := readCheckpoint(filename); err != nil {
-		t.Errorf("Could not read the checkpoint file: %s", filename)
+	if o, ok, err := ki.readCheckpoint(); err != nil || !ok {
+		t.Errorf("Could not read the checkpoint: %v", err)
 	} else {
 		if o != 1 {
 			t.Errorf("Incorrect offset Expected: 1 Received: %d", o)
@@ -242,3 +242,101 @@ func TestReceiveProtobufMessage(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestMigrateCheckpointFile(t *testing.T) {
+	tmpDir, tmpErr := ioutil.TempDir("", "kafkainput-tests")
+	if tmpErr != nil {
+		t.Errorf("Unable to create a temporary directory: %s", tmpErr)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pConfig := NewPipelineConfig(nil)
+	pConfig.Globals.BaseDir = tmpDir
+	ki := new(KafkaInput)
+	ki.checkpointer = pConfig.Checkpointer()
+	ki.checkpointKey = "kafka/test.test.0"
+	ki.checkpointFilename = filepath.Join(tmpDir, "kafka", "test.test.0.offset.bin")
+	if err := os.MkdirAll(filepath.Dir(ki.checkpointFilename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The little endian int64 offset earlier versions wrote.
+	offset := []byte{42, 0, 0, 0, 0, 0, 0, 0}
+	if err := ioutil.WriteFile(ki.checkpointFilename, offset, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ki.migrateCheckpointFile(); err != nil {
+		t.Fatal(err)
+	}
+	if o, ok, err := ki.readCheckpoint(); err != nil || !ok {
+		t.Errorf("Could not read the checkpoint: %v", err)
+	} else if o != 42 {
+		t.Errorf("Incorrect offset Expected: 42 Received: %d", o)
+	}
+	if _, err := os.Stat(ki.checkpointFilename); !os.IsNotExist(err) {
+		t.Errorf("Checkpoint file wasn't removed")
+	}
+}
+
+// Fails every Set while failing is true.
+type flakyCheckpointer struct {
+	Checkpointer
+	failing bool
+}
+
+func (f *flakyCheckpointer) Set(key string, value []byte) error {
+	if f.failing {
+		return errors.New("store unavailable")
+	}
+	return f.Checkpointer.Set(key, value)
+}
+
+func TestBatchedCheckpoints(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tmpDir, tmpErr := ioutil.TempDir("", "kafkainput-tests")
+	if tmpErr != nil {
+		t.Errorf("Unable to create a temporary directory: %s", tmpErr)
+	}
+	defer func() {
+		os.RemoveAll(tmpDir)
+		ctrl.Finish()
+	}()
+
+	pConfig := NewPipelineConfig(nil)
+	pConfig.Globals.BaseDir = tmpDir
+	ki := new(KafkaInput)
+	ki.SetPipelineConfig(pConfig)
+	ki.config = ki.ConfigStruct().(*KafkaInputConfig)
+	ki.config.CheckpointCount = 3
+	checkpointer := &flakyCheckpointer{Checkpointer: pConfig.Checkpointer()}
+	ki.checkpointer = checkpointer
+	ki.checkpointKey = "kafka/test.test.0"
+	mockIR := pipelinemock.NewMockInputRunner(ctrl)
+	ki.ir = mockIR
+
+	ki.updateCheckpoint(1)
+	ki.updateCheckpoint(2)
+	if _, ok, _ := ki.readCheckpoint(); ok {
+		t.Errorf("Checkpoint written before checkpoint_count messages")
+	}
+	ki.updateCheckpoint(3)
+	if o, _, _ := ki.readCheckpoint(); o != 3 {
+		t.Errorf("Incorrect offset Expected: 3 Received: %d", o)
+	}
+
+	// A failed write is logged and retried by the next flush.
+	checkpointer.failing = true
+	mockIR.EXPECT().LogError(gomock.Any()).Times(2)
+	ki.updateCheckpoint(4)
+	ki.updateCheckpoint(5)
+	ki.updateCheckpoint(6)
+	ki.flushCheckpoint()
+	checkpointer.failing = false
+	ki.flushCheckpoint()
+	if o, _, _ := ki.readCheckpoint(); o != 6 {
+		t.Errorf("Incorrect offset Expected: 6 Received: %d", o)
+	}
+	if ki.checkpointFailures != 2 {
+		t.Errorf("Expected 2 checkpoint failures, got %d", ki.checkpointFailures)
+	}
+}
@@ -64,6 +64,10 @@ type KafkaOutputConfig struct {
 	MaxBufferedBytes           uint32 `toml:"max_buffered_bytes"`
 	BackPressureThresholdBytes uint32 `toml:"back_pressure_threshold_bytes"`
 	MaxMessageBytes            uint32 `toml:"max_message_bytes"`
+
+	// Optional subsection looking up the brokers in DNS SRV records or
+	// Consul, in place of addrs.
+	Discovery *pipeline.DiscoveryConfig `toml:"discovery"`
 }
 
 var fieldRegex = regexp.MustCompile("^Fields\\[([^\\]]*)\\](?:\\[(\\d+)\\])?(?:\\[(\\d+)\\])?$")
@@ -207,6 +211,20 @@ func (k *KafkaOutput) SetPipelineConfig(pConfig *pipeline.PipelineConfig) {
 
 func (k *KafkaOutput) Init(config interface{}) (err error) {
 	k.config = config.(*KafkaOutputConfig)
+	if k.config.Discovery != nil {
+		// The brokers found are only used to bootstrap the client, which
+		// keeps track of the cluster's brokers itself from then on.
+		if err = k.config.Discovery.Validate(); err != nil {
+			return fmt.Errorf("discovery: %s", err)
+		}
+		var resolver *pipeline.EndpointResolver
+		if resolver, err = pipeline.NewEndpointResolver(k.config.Discovery); err != nil {
+			return fmt.Errorf("discovery: %s", err)
+		}
+		if k.config.Addrs, _, err = resolver.Endpoints(); err != nil {
+			return fmt.Errorf("discovery: %s", err)
+		}
+	}
 	if len(k.config.Addrs) == 0 {
 		return errors.New("addrs must have at least one entry")
 	}
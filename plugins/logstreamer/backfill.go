@@ -0,0 +1,141 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package logstreamer
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ls "heka/logstreamer"
+	"heka/message"
+	p "heka/pipeline"
+)
+
+// Backfill profile, from the `backfill` config subsection. Logstreams that
+// are behind, reading files older than their newest, take turns at a bounded
+// rate, those with the oldest files first, while logstreams tailing their
+// newest file are read at full speed.
+type BackfillConfig struct {
+	// Bytes per second all the backfilling logstreams together may read.
+	// Zero means no limit.
+	MaxBytesPerSec uint64 `toml:"max_bytes_per_sec"`
+	// Maximum number of logstreams backfilling at once. Defaults to 1.
+	MaxStreams uint `toml:"max_streams"`
+}
+
+// Hands out the backfill turns, and keeps the backfill metrics.
+type backfiller struct {
+	limiter    *p.ByteRateLimiter
+	maxStreams int
+	lock       sync.Mutex
+	active     map[string]bool
+	// Logstreams waiting for a turn, with the modification times of the files
+	// they're behind on.
+	waiting map[string]time.Time
+	// Accessed atomically.
+	bytes     int64
+	records   int64
+	throttled int64
+	completed int64
+}
+
+func newBackfiller(conf *BackfillConfig) *backfiller {
+	if conf.MaxStreams == 0 {
+		conf.MaxStreams = 1
+	}
+	return &backfiller{
+		limiter:    p.NewByteRateLimiter(conf.MaxBytesPerSec),
+		maxStreams: int(conf.MaxStreams),
+		active:     make(map[string]bool),
+		waiting:    make(map[string]time.Time),
+	}
+}
+
+// Tells whether the named logstream, behind on a file last modified at
+// mtime, may backfill now. Turns go to the logstreams with the oldest files
+// first, so a logstream is kept waiting while another one with an older file
+// is.
+func (b *backfiller) acquire(name string, mtime time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.active[name] {
+		return true
+	}
+	b.waiting[name] = mtime
+	if len(b.active) >= b.maxStreams {
+		return false
+	}
+	for other, t := range b.waiting {
+		if other != name && t.Before(mtime) {
+			return false
+		}
+	}
+	delete(b.waiting, name)
+	b.active[name] = true
+	return true
+}
+
+// Gives up the named logstream's turn, or its place in the queue for one.
+func (b *backfiller) release(name string, completed bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.active[name] && completed {
+		atomic.AddInt64(&b.completed, 1)
+	}
+	delete(b.active, name)
+	delete(b.waiting, name)
+}
+
+// Counts a backfilled record of n bytes, returning how long to wait before
+// reading more.
+func (b *backfiller) count(n int) time.Duration {
+	atomic.AddInt64(&b.records, 1)
+	atomic.AddInt64(&b.bytes, int64(n))
+	delay := b.limiter.Reserve(n)
+	if delay > 0 {
+		atomic.AddInt64(&b.throttled, int64(delay))
+	}
+	return delay
+}
+
+func (b *backfiller) reportMsg(msg *message.Message) {
+	b.lock.Lock()
+	active, waiting := len(b.active), len(b.waiting)
+	b.lock.Unlock()
+	message.NewInt64Field(msg, "BackfillingLogstreams", int64(active), "count")
+	message.NewInt64Field(msg, "BackfillWaitingLogstreams", int64(waiting), "count")
+	message.NewInt64Field(msg, "BackfillCompletedLogstreams",
+		atomic.LoadInt64(&b.completed), "count")
+	message.NewInt64Field(msg, "BackfillRecords", atomic.LoadInt64(&b.records), "count")
+	message.NewInt64Field(msg, "BackfillBytes", atomic.LoadInt64(&b.bytes), "B")
+	message.NewInt64Field(msg, "BackfillThrottledMs",
+		atomic.LoadInt64(&b.throttled)/int64(time.Millisecond), "ms")
+}
+
+// Returns the modification time of the file a logstream is behind on, or the
+// zero time, i.e. the oldest, if it can't be found.
+func backfillFileTime(stream *ls.Logstream) time.Time {
+	fname, _ := stream.ReportPosition()
+	if fname == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(fname)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
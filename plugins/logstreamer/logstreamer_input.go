@@ -34,7 +34,8 @@ type LogstreamerInputConfig struct {
 	Hostname string
 	// Log base directory to run log regex under
 	LogDirectory string `toml:"log_directory"`
-	// Journal base directory for saving journal files
+	// Journal base directory for saving journal files. If unset positions
+	// are kept by the pipeline's checkpointer instead.
 	JournalDirectory string `toml:"journal_directory"`
 	// File match for regular expression
 	FileMatch string `toml:"file_match"`
@@ -56,6 +57,12 @@ type LogstreamerInputConfig struct {
 	Splitter string
 	// Whether to ignore previous logfiles while initial scan
 	InitialTail bool `toml:"initial_tail"`
+	// Name of a shard group whose members share out the logstreams between
+	// them, each reading only those it owns.
+	ShardGroup string `toml:"shard_group"`
+	// Rate limits the logstreams that are reading files older than their
+	// newest, if set.
+	Backfill *BackfillConfig `toml:"backfill"`
 }
 
 type LogstreamerInput struct {
@@ -65,8 +72,11 @@ type LogstreamerInput struct {
 	rescanInterval     time.Duration
 	checkDataInterval  time.Duration
 	plugins            map[string]*LogstreamInput
-	stopLogstreamChans []chan chan bool
+	stopLogstreamChans map[string]chan chan bool
 	stopChan           chan bool
+	shardGroup         string
+	shards             *p.ShardGroup
+	backfill           *backfiller
 	parser             string
 	delimiter          string
 	delimiterLocation  string
@@ -81,18 +91,29 @@ func (li *LogstreamerInput) SetPipelineConfig(pConfig *p.PipelineConfig) {
 }
 
 func (li *LogstreamerInput) ConfigStruct() interface{} {
-	baseDir := li.pConfig.Globals.BaseDir
 	return &LogstreamerInputConfig{
 		RescanInterval:    "1m",
 		CheckDataInterval: "250ms",
 		OldestDuration:    "720h",
 		LogDirectory:      "/var/log",
-		JournalDirectory:  filepath.Join(baseDir, "logstreamer"),
 		Splitter:          "TokenSplitter",
 		InitialTail:       false,
 	}
 }
 
+// Keeps logstream positions in the pipeline's checkpointer.
+type checkpointPositions struct {
+	cp p.Checkpointer
+}
+
+func (c checkpointPositions) LoadPosition(name string) ([]byte, error) {
+	return c.cp.Get("logstreamer/" + name)
+}
+
+func (c checkpointPositions) SavePosition(name string, position []byte) error {
+	return c.cp.Set("logstreamer/"+name, position)
+}
+
 func (li *LogstreamerInput) SetName(name string) {
 	li.pluginName = name
 }
@@ -105,8 +126,13 @@ func (li *LogstreamerInput) Init(config interface{}) (err error) {
 	)
 	conf := config.(*LogstreamerInputConfig)
 
-	// Setup the journal dir.
-	if err = os.MkdirAll(conf.JournalDirectory, 0744); err != nil {
+	// Setup the journal dir, if positions aren't checkpointed.
+	journalDir := conf.JournalDirectory
+	if journalDir == "" {
+		// Where earlier versions kept the journals, read for positions the
+		// checkpointer doesn't have yet.
+		journalDir = filepath.Join(li.pConfig.Globals.BaseDir, "logstreamer")
+	} else if err = os.MkdirAll(journalDir, 0744); err != nil {
 		return err
 	}
 
@@ -158,10 +184,13 @@ func (li *LogstreamerInput) Init(config interface{}) (err error) {
 	li.logstreamSetLock.Lock()
 	defer li.logstreamSetLock.Unlock()
 	li.logstreamSet, err = ls.NewLogstreamSet(sp, oldest, conf.LogDirectory,
-		conf.JournalDirectory, conf.InitialTail)
+		journalDir, conf.InitialTail)
 	if err != nil {
 		return
 	}
+	if conf.JournalDirectory == "" {
+		li.logstreamSet.SetPositionStore(checkpointPositions{li.pConfig.Checkpointer()})
+	}
 	// Initial scan for logstreams
 	plugins, errs = li.logstreamSet.ScanForLogstreams()
 	if errs.IsError() {
@@ -174,6 +203,10 @@ func (li *LogstreamerInput) Init(config interface{}) (err error) {
 		li.hostName = conf.Hostname
 	}
 
+	if conf.Backfill != nil {
+		li.backfill = newBackfiller(conf.Backfill)
+	}
+
 	// Create all our initial logstream plugins for the logstreams found
 	for _, name := range plugins {
 		stream, ok := li.logstreamSet.GetLogstream(name)
@@ -181,9 +214,11 @@ func (li *LogstreamerInput) Init(config interface{}) (err error) {
 			continue
 		}
 		li.plugins[name] = NewLogstreamInput(stream, name, li.hostName, li.checkDataInterval)
+		li.plugins[name].backfill = li.backfill
 	}
-	li.stopLogstreamChans = make([]chan chan bool, 0, len(plugins))
+	li.stopLogstreamChans = make(map[string]chan chan bool)
 	li.stopChan = make(chan bool)
+	li.shardGroup = conf.ShardGroup
 	return
 }
 
@@ -195,10 +230,43 @@ func (li *LogstreamerInput) startLogstreamInput(logstream *LogstreamInput, i int
 	token := strconv.Itoa(i)
 	deliverer := ir.NewDeliverer(token)
 	sRunner := ir.NewSplitterRunner(token)
-	li.stopLogstreamChans = append(li.stopLogstreamChans, stop)
+	li.stopLogstreamChans[logstream.loggerIdent] = stop
 	go logstream.Run(ir, h, stop, deliverer, sRunner)
 }
 
+// Stops the named LogstreamInput and waits for it to finish.
+func (li *LogstreamerInput) stopLogstreamInput(name string) {
+	ret := make(chan bool)
+	li.stopLogstreamChans[name] <- ret
+	<-ret
+	delete(li.stopLogstreamChans, name)
+}
+
+// Returns true if this hekad should read the named logstream.
+func (li *LogstreamerInput) ownsLogstream(name string) bool {
+	return li.shards == nil || li.shards.Owns(name)
+}
+
+// Starts the logstreams this hekad has come to own, picking up from wherever
+// their previous owner saved their position, and stops those it no longer
+// owns.
+func (li *LogstreamerInput) rebalance(i *int, ir p.InputRunner, h p.PluginHelper) {
+	for name, lsi := range li.plugins {
+		_, running := li.stopLogstreamChans[name]
+		owned := li.ownsLogstream(name)
+		if running && !owned {
+			li.stopLogstreamInput(name)
+		} else if !running && owned {
+			if err := lsi.stream.ReloadPosition(); err != nil {
+				ir.LogError(fmt.Errorf("Can't reload position of logstream %s: %s",
+					name, err))
+			}
+			*i++
+			li.startLogstreamInput(lsi, *i, ir, h)
+		}
+	}
+}
+
 // Main Logstreamer Input runner. This runner kicks off all the other
 // logstream inputs, and handles rescanning for updates to the filesystem that
 // might affect file visibility for the logstream inputs.
@@ -209,12 +277,26 @@ func (li *LogstreamerInput) Run(ir p.InputRunner, h p.PluginHelper) (err error)
 		newstreams []string
 	)
 
+	var shardChanges <-chan struct{}
+	if li.shardGroup != "" {
+		if li.shards, err = li.pConfig.JoinShardGroup(li.shardGroup); err != nil {
+			return err
+		}
+		defer li.shards.Leave()
+		shardChanges = li.shards.Changes()
+	}
+
 	// Kick off all the current logstreams we know of
 	i := 0
-	for _, logstream := range li.plugins {
+	li.logstreamSetLock.Lock()
+	for name, logstream := range li.plugins {
+		if !li.ownsLogstream(name) {
+			continue
+		}
 		i++
 		li.startLogstreamInput(logstream, i, ir, h)
 	}
+	li.logstreamSetLock.Unlock()
 
 	ok = true
 	rescan := time.Tick(li.rescanInterval) //todo xx 这个是干啥的，为啥要rescan
@@ -223,12 +305,12 @@ func (li *LogstreamerInput) Run(ir p.InputRunner, h p.PluginHelper) (err error)
 		select {
 		case <-li.stopChan:
 			ok = false
-			returnChans := make([]chan bool, len(li.stopLogstreamChans))
+			returnChans := make([]chan bool, 0, len(li.stopLogstreamChans))
 			// Send out all the stop signals
-			for i, ch := range li.stopLogstreamChans {
+			for _, ch := range li.stopLogstreamChans {
 				ret := make(chan bool)
 				ch <- ret
-				returnChans[i] = ret
+				returnChans = append(returnChans, ret)
 			}
 
 			// Wait for all the stops
@@ -253,11 +335,19 @@ func (li *LogstreamerInput) Run(ir p.InputRunner, h p.PluginHelper) (err error)
 				}
 
 				lsi := NewLogstreamInput(stream, name, li.hostName, li.checkDataInterval)
+				lsi.backfill = li.backfill
 				li.plugins[name] = lsi
+				if !li.ownsLogstream(name) {
+					continue
+				}
 				i++
 				li.startLogstreamInput(lsi, i, ir, h)
 			}
 			li.logstreamSetLock.Unlock()
+		case <-shardChanges:
+			li.logstreamSetLock.Lock()
+			li.rebalance(&i, ir, h)
+			li.logstreamSetLock.Unlock()
 		}
 	}
 	return nil
@@ -280,6 +370,9 @@ type LogstreamInput struct {
 	stopChan            chan chan bool
 	deliverer           p.Deliverer
 	sRunner             p.SplitterRunner
+	// Shared with the other logstreams, nil if there's no backfill profile.
+	backfill    *backfiller
+	backfilling bool
 }
 
 func NewLogstreamInput(stream *ls.Logstream, loggerIdent,
@@ -302,6 +395,7 @@ func (lsi *LogstreamInput) Run(ir p.InputRunner, h p.PluginHelper, stopChan chan
 	}
 
 	lsi.ir = ir
+	lsi.stopped = nil
 	lsi.stopChan = stopChan
 	lsi.deliverer = deliverer
 	lsi.sRunner = sRunner
@@ -315,8 +409,11 @@ func (lsi *LogstreamInput) Run(ir p.InputRunner, h p.PluginHelper, stopChan chan
 		// Clear our error
 		err = nil
 
-		// Attempt to read and deliver as many as we can.
-		err = lsi.deliverRecords()
+		// Attempt to read and deliver as many as we can, unless we're behind
+		// and have to wait for our turn to backfill.
+		if lsi.backfillTurn() {
+			err = lsi.deliverRecords()
+		}
 		// Save our position if the stream hasn't done so for us.
 		if err != io.EOF {
 			lsi.stream.SavePosition()
@@ -341,6 +438,10 @@ func (lsi *LogstreamInput) Run(ir p.InputRunner, h p.PluginHelper, stopChan chan
 			continue
 		}
 	}
+	if lsi.backfill != nil {
+		lsi.backfill.release(lsi.loggerIdent, false)
+		lsi.backfilling = false
+	}
 	close(lsi.stopped)
 	deliverer.Done()
 	sRunner.Done()
@@ -373,6 +474,9 @@ func (lsi *LogstreamInput) deliverRecords() (err error) {
 		}
 		if n > 0 {
 			lsi.stream.FlushBuffer(n)
+			if lsi.backfilling && !lsi.throttleBackfill(n) {
+				return
+			}
 		}
 		if len(record) > 0 {
 			if lsi.prevMsgWasTruncated == false {
@@ -394,6 +498,43 @@ func (lsi *LogstreamInput) deliverRecords() (err error) {
 	return err
 }
 
+// Tells whether the logstream may read now: if it's tailing its newest file,
+// or it's behind and has a backfill turn.
+func (lsi *LogstreamInput) backfillTurn() bool {
+	if lsi.backfill == nil {
+		return true
+	}
+	if !lsi.stream.Backfilling() {
+		if lsi.backfilling {
+			lsi.backfill.release(lsi.loggerIdent, true)
+			lsi.backfilling = false
+		}
+		return true
+	}
+	lsi.backfilling = lsi.backfill.acquire(lsi.loggerIdent, backfillFileTime(lsi.stream))
+	return lsi.backfilling
+}
+
+// Counts n backfilled bytes and waits out the backfill rate limit, ending
+// the turn early once the logstream has caught up to its newest file.
+// Returns false if the logstream was stopped while waiting.
+func (lsi *LogstreamInput) throttleBackfill(n int) bool {
+	if delay := lsi.backfill.count(n); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case lsi.stopped = <-lsi.stopChan:
+			return false
+		case <-timer.C:
+		}
+	}
+	if !lsi.stream.Backfilling() {
+		lsi.backfill.release(lsi.loggerIdent, true)
+		lsi.backfilling = false
+	}
+	return true
+}
+
 func (lsi *LogstreamInput) packDecorator(pack *p.PipelinePack) {
 	pack.Message.SetType("logfile")
 	pack.Message.SetHostname(lsi.hostName)
@@ -421,6 +562,15 @@ func (li *LogstreamerInput) ReportMsg(msg *message.Message) error {
 			message.NewInt64Field(msg, fmt.Sprintf("%s-bytes", name), bytes, "count")
 		}
 	}
+	if li.backfill != nil {
+		li.backfill.reportMsg(msg)
+	}
+	if li.shards != nil {
+		message.NewInt64Field(msg, "ShardMembers", int64(len(li.shards.Members())),
+			"count")
+		message.NewInt64Field(msg, "OwnedLogstreams", int64(len(li.stopLogstreamChans)),
+			"count")
+	}
 	return nil
 }
 
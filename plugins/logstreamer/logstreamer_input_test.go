@@ -25,6 +25,7 @@ import (
 	"time"
 
 	ls "heka/logstreamer"
+	"heka/message"
 	. "heka/pipeline"
 	pipeline_ts "heka/pipeline/testsupport"
 	"heka/pipelinemock"
@@ -37,6 +38,7 @@ func TestAllSpecs(t *testing.T) {
 	r := gs.NewRunner()
 	r.Parallel = false
 
+	r.AddSpec(BackfillerSpec)
 	r.AddSpec(LogstreamerInputSpec)
 
 	gs.MainGoTest(r, t)
@@ -167,6 +169,20 @@ func LogstreamerInputSpec(c gs.Context) {
 			})
 		})
 
+		c.Specify("with a backfill profile", func() {
+			lsiConfig.Backfill = &BackfillConfig{MaxBytesPerSec: 1000}
+			err := lsInput.Init(lsiConfig)
+			c.Expect(err, gs.IsNil)
+			c.Expect(lsInput.backfill.maxStreams, gs.Equals, 1)
+			lsi := lsInput.plugins["logfile"]
+			c.Assume(lsi, gs.Not(gs.IsNil))
+			c.Expect(lsi.backfill, gs.Equals, lsInput.backfill)
+			// No position yet, so it starts on the oldest of its files.
+			c.Expect(lsi.stream.Backfilling(), gs.IsTrue)
+			c.Expect(lsi.backfillTurn(), gs.IsTrue)
+			c.Expect(lsInput.backfill.active["logfile"], gs.IsTrue)
+		})
+
 		c.Specify("with a translation map", func() {
 			lsiConfig.Translation = make(ls.SubmatchTranslationMap)
 			lsiConfig.Translation["Seq"] = make(ls.MatchTranslationMap)
@@ -188,3 +204,49 @@ func LogstreamerInputSpec(c gs.Context) {
 		})
 	})
 }
+
+func BackfillerSpec(c gs.Context) {
+	c.Specify("A backfiller", func() {
+		b := newBackfiller(&BackfillConfig{MaxStreams: 2})
+		now := time.Now()
+
+		c.Specify("gives turns to the logstreams with the oldest files first", func() {
+			c.Expect(b.acquire("a", now), gs.IsTrue)
+			c.Expect(b.acquire("b", now.Add(-time.Hour)), gs.IsTrue)
+			c.Expect(b.acquire("c", now.Add(-2*time.Hour)), gs.IsFalse)
+			c.Expect(b.acquire("d", now.Add(-3*time.Hour)), gs.IsFalse)
+			// Turns are kept until they're released.
+			c.Expect(b.acquire("a", now), gs.IsTrue)
+
+			b.release("a", true)
+			c.Expect(b.acquire("c", now.Add(-2*time.Hour)), gs.IsFalse)
+			c.Expect(b.acquire("d", now.Add(-3*time.Hour)), gs.IsTrue)
+			b.release("b", false)
+			c.Expect(b.acquire("c", now.Add(-2*time.Hour)), gs.IsTrue)
+			c.Expect(b.completed, gs.Equals, int64(1))
+		})
+
+		c.Specify("stops a released logstream from holding up the queue", func() {
+			c.Expect(b.acquire("a", now), gs.IsTrue)
+			c.Expect(b.acquire("b", now), gs.IsTrue)
+			c.Expect(b.acquire("c", now.Add(-time.Hour)), gs.IsFalse)
+			b.release("c", false)
+			b.release("a", true)
+			c.Expect(b.acquire("d", now), gs.IsTrue)
+		})
+
+		c.Specify("limits the rate of the backfilled bytes", func() {
+			b = newBackfiller(&BackfillConfig{MaxBytesPerSec: 100})
+			c.Expect(b.count(100), gs.Equals, time.Duration(0))
+			delay := b.count(50)
+			c.Expect(delay > 400*time.Millisecond && delay <= 500*time.Millisecond, gs.IsTrue)
+
+			msg := new(message.Message)
+			b.reportMsg(msg)
+			records, _ := msg.GetFieldValue("BackfillRecords")
+			c.Expect(records, gs.Equals, int64(2))
+			bytes, _ := msg.GetFieldValue("BackfillBytes")
+			c.Expect(bytes, gs.Equals, int64(150))
+		})
+	})
+}
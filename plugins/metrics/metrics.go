@@ -0,0 +1,211 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"heka/message"
+)
+
+// Name of the nested field holding a message's metrics.
+const MetricsField = "metrics"
+
+// A metric sample, as carried by the messages the MetricsBridgeFilter
+// injects. Influx-style backends write it as the field Field of measurement
+// Name, and others as a series named from both.
+type Metric struct {
+	Name  string  `json:"name"`
+	Field string  `json:"field,omitempty"`
+	Value float64 `json:"value"`
+	// Milliseconds since the epoch, which JSON numbers hold exactly.
+	Timestamp int64             `json:"timestamp"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// Time returns the metric's timestamp.
+func (m *Metric) Time() time.Time {
+	return time.Unix(0, m.Timestamp*int64(time.Millisecond))
+}
+
+// Adds metrics to a message, as its metrics nested field.
+func AddMetrics(msg *message.Message, metrics []Metric) error {
+	return message.NewNestedFieldOnMessage(msg, MetricsField, metrics)
+}
+
+// Returns the metrics of a message, or nil if it has none.
+func MessageMetrics(msg *message.Message) ([]Metric, error) {
+	f := msg.FindFirstField(MetricsField)
+	if f == nil {
+		return nil, nil
+	}
+	if !f.IsNested() {
+		return nil, errors.New("metrics field isn't a nested field")
+	}
+	var metrics []Metric
+	if err := json.Unmarshal([]byte(f.ValueString[0]), &metrics); err != nil {
+		return nil, fmt.Errorf("bad metrics field: %s", err)
+	}
+	return metrics, nil
+}
+
+// Parses a line of Graphite's plaintext protocol, "name value [timestamp]",
+// whose name may have tags, "name;tag=value;...". Lines without a timestamp,
+// or with one of -1, get the default.
+func ParseGraphiteLine(line string, defaultTime time.Time) (name string,
+	tags map[string]string, value float64, ts time.Time, err error) {
+
+	parts := strings.Fields(line)
+	if len(parts) != 2 && len(parts) != 3 {
+		return "", nil, 0, ts, fmt.Errorf("malformed metric line: '%s'", line)
+	}
+	if value, err = strconv.ParseFloat(parts[1], 64); err != nil {
+		return "", nil, 0, ts, fmt.Errorf("invalid value: '%s'", line)
+	}
+	ts = defaultTime
+	if len(parts) == 3 && parts[2] != "-1" {
+		secs, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || secs < 0 {
+			return "", nil, 0, ts, fmt.Errorf("invalid timestamp: '%s'", line)
+		}
+		ts = time.Unix(0, int64(secs*1e9))
+	}
+
+	name = parts[0]
+	if i := strings.IndexByte(name, ';'); i >= 0 {
+		tags = make(map[string]string)
+		for _, tag := range strings.Split(name[i+1:], ";") {
+			kv := strings.SplitN(tag, "=", 2)
+			if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+				return "", nil, 0, ts, fmt.Errorf("invalid tag '%s': '%s'", tag, line)
+			}
+			tags[kv[0]] = kv[1]
+		}
+		name = name[:i]
+	}
+	if name == "" {
+		return "", nil, 0, ts, fmt.Errorf("metric has no name: '%s'", line)
+	}
+	return name, tags, value, ts, nil
+}
+
+// A template mapping the dot separated parts of Graphite names to a
+// measurement, field and tags, as InfluxDB's Graphite templates do.
+type Template struct {
+	filter []string
+	parts  []string
+	tags   map[string]string
+}
+
+// Parses a template, "[filter ]template[ tag=value,...]". The template's parts
+// are "measurement", "field", a tag name or empty to skip the name's part,
+// and the last may be "measurement*" or "field*" to take the rest of the
+// name. The filter's parts may be "*", and it matches names starting with
+// parts that match them.
+func ParseTemplate(s string) (*Template, error) {
+	words := strings.Fields(s)
+	if len(words) == 0 || len(words) > 3 {
+		return nil, fmt.Errorf("malformed template '%s'", s)
+	}
+	t := &Template{}
+	if len(words) == 3 || (len(words) == 2 && !strings.Contains(words[1], "=")) {
+		t.filter = strings.Split(words[0], ".")
+		words = words[1:]
+	}
+	t.parts = strings.Split(words[0], ".")
+	for i, p := range t.parts {
+		if strings.HasSuffix(p, "*") && i != len(t.parts)-1 {
+			return nil, fmt.Errorf("'%s' isn't the last part of template '%s'", p, s)
+		}
+		if p == "*" || strings.Contains(strings.TrimSuffix(p, "*"), "*") {
+			return nil, fmt.Errorf("malformed template '%s'", s)
+		}
+	}
+	if len(words) == 2 {
+		t.tags = make(map[string]string)
+		for _, tag := range strings.Split(words[1], ",") {
+			kv := strings.SplitN(tag, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("invalid tag '%s' in template '%s'", tag, s)
+			}
+			t.tags[kv[0]] = kv[1]
+		}
+	}
+	return t, nil
+}
+
+// Whether the template applies to a name's parts.
+func (t *Template) Matches(parts []string) bool {
+	if len(t.filter) > len(parts) {
+		return false
+	}
+	for i, f := range t.filter {
+		if f != "*" && f != parts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Applies the template to a name's parts, adding the tags it finds. The
+// measurement is the whole name if the template has none.
+func (t *Template) Apply(parts []string, sep string, tags map[string]string) (
+	measurement, field string) {
+
+	var ms, fs []string
+	for i, p := range t.parts {
+		if i >= len(parts) {
+			break
+		}
+		switch p {
+		case "":
+		case "measurement":
+			ms = append(ms, parts[i])
+		case "measurement*":
+			ms = append(ms, parts[i:]...)
+		case "field":
+			fs = append(fs, parts[i])
+		case "field*":
+			fs = append(fs, parts[i:]...)
+		default:
+			if v, ok := tags[p]; ok {
+				tags[p] = v + sep + parts[i]
+			} else {
+				tags[p] = parts[i]
+			}
+		}
+	}
+	for k, v := range t.tags {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+	if len(ms) == 0 {
+		ms = parts
+	}
+	return strings.Join(ms, sep), strings.Join(fs, sep)
+}
+
+// Whether a value can be written to every backend, which NaNs and infinities
+// can't.
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
@@ -0,0 +1,239 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type MetricsBridgeFilterConfig struct {
+	// Type of the messages injected. Defaults to "heka.metrics".
+	MessageType string `toml:"message_type"`
+	// Graphite templates, the first whose filter matches a name being used.
+	// Names no template matches are kept whole.
+	Templates []string `toml:"templates"`
+	// Separator joining the parts of measurements, fields and tags made from
+	// several parts. Defaults to ".".
+	Separator string `toml:"separator"`
+	// Tags added to every metric that doesn't have them.
+	Tags map[string]string `toml:"tags"`
+	// Tag the message's hostname is added as, if it's set.
+	HostnameTag string `toml:"hostname_tag"`
+	// Most metrics in a message injected. Defaults to 1000.
+	MaxMetrics uint `toml:"max_metrics"`
+	// Defaults to the StatAccumInput's messages.
+	MessageMatcher string `toml:"message_matcher"`
+}
+
+// Filter that converts statmetric messages, with Graphite plaintext lines in
+// their payload or stats in their fields, into messages carrying the metrics
+// in a normalized form, which encoders for the various metrics backends can
+// write without knowing where they came from.
+type MetricsBridgeFilter struct {
+	conf      *MetricsBridgeFilterConfig
+	templates []*Template
+	fr        FilterRunner
+	h         PluginHelper
+
+	// Accessed atomically, for the reports.
+	metricsConverted int64
+	badLines         int64
+	messagesInjected int64
+}
+
+func (f *MetricsBridgeFilter) ConfigStruct() interface{} {
+	return &MetricsBridgeFilterConfig{
+		MessageType:    "heka.metrics",
+		Separator:      ".",
+		MaxMetrics:     1000,
+		MessageMatcher: "Type == 'heka.statmetric'",
+	}
+}
+
+func (f *MetricsBridgeFilter) Init(config interface{}) error {
+	f.conf = config.(*MetricsBridgeFilterConfig)
+	if f.conf.MessageType == "" {
+		return errors.New("message_type must be set")
+	}
+	if f.conf.MaxMetrics == 0 {
+		return errors.New("max_metrics must be greater than 0")
+	}
+	f.templates = make([]*Template, len(f.conf.Templates))
+	for i, s := range f.conf.Templates {
+		t, err := ParseTemplate(s)
+		if err != nil {
+			return err
+		}
+		f.templates[i] = t
+	}
+	return nil
+}
+
+func (f *MetricsBridgeFilter) Prepare(fr FilterRunner, h PluginHelper) error {
+	f.fr = fr
+	f.h = h
+	return nil
+}
+
+// Returns the metric of a sample, with the measurement, field and tags of
+// the first template matching its name.
+func (f *MetricsBridgeFilter) metric(msg *message.Message, name string,
+	tags map[string]string, value float64, ts time.Time) Metric {
+
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	m := Metric{Name: name, Value: value, Timestamp: ts.UnixNano() / 1e6}
+	parts := strings.Split(name, ".")
+	for _, t := range f.templates {
+		if t.Matches(parts) {
+			m.Name, m.Field = t.Apply(parts, f.conf.Separator, tags)
+			break
+		}
+	}
+	for k, v := range f.conf.Tags {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+	if f.conf.HostnameTag != "" && msg.GetHostname() != "" {
+		if _, ok := tags[f.conf.HostnameTag]; !ok {
+			tags[f.conf.HostnameTag] = msg.GetHostname()
+		}
+	}
+	if len(tags) > 0 {
+		m.Tags = tags
+	}
+	return m
+}
+
+// Returns the metrics of a statmetric message: those of the Graphite lines
+// of its payload, or if it has none those of its numeric fields, timestamped
+// by its "timestamp" field.
+func (f *MetricsBridgeFilter) metrics(msg *message.Message) ([]Metric, error) {
+	defaultTime := time.Unix(0, msg.GetTimestamp())
+	var metrics []Metric
+	var lineErr error
+	for _, line := range strings.Split(msg.GetPayload(), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, tags, value, ts, err := ParseGraphiteLine(line, defaultTime)
+		if err != nil || !finite(value) {
+			atomic.AddInt64(&f.badLines, 1)
+			if err != nil {
+				lineErr = err
+			}
+			continue
+		}
+		metrics = append(metrics, f.metric(msg, name, tags, value, ts))
+	}
+	if metrics != nil || lineErr != nil {
+		return metrics, lineErr
+	}
+
+	if v, ok := msg.GetFieldValue("timestamp"); ok {
+		if secs, ok := v.(int64); ok {
+			defaultTime = time.Unix(secs, 0)
+		}
+	}
+	for _, field := range msg.Fields {
+		if field.GetName() == "timestamp" || field.IsNested() {
+			continue
+		}
+		var value float64
+		switch field.GetValueType() {
+		case message.Field_INTEGER:
+			value = float64(field.ValueInteger[0])
+		case message.Field_DOUBLE:
+			value = field.ValueDouble[0]
+		default:
+			continue
+		}
+		if !finite(value) {
+			continue
+		}
+		metrics = append(metrics, f.metric(msg, field.GetName(), nil, value, defaultTime))
+	}
+	return metrics, nil
+}
+
+// Injects messages carrying metrics, at most max_metrics in each.
+func (f *MetricsBridgeFilter) inject(src *PipelinePack, metrics []Metric) error {
+	for len(metrics) > 0 {
+		n := len(metrics)
+		if n > int(f.conf.MaxMetrics) {
+			n = int(f.conf.MaxMetrics)
+		}
+		pack, err := f.h.PipelinePack(src.MsgLoopCount)
+		if err != nil {
+			return err
+		}
+		msg := pack.Message
+		msg.SetType(f.conf.MessageType)
+		msg.SetLogger(f.fr.Name())
+		msg.SetHostname(src.Message.GetHostname())
+		msg.SetTimestamp(src.Message.GetTimestamp())
+		if err = AddMetrics(msg, metrics[:n]); err != nil {
+			pack.Recycle(nil)
+			return err
+		}
+		if !f.fr.Inject(pack) {
+			return errors.New("can't inject metrics message")
+		}
+		atomic.AddInt64(&f.messagesInjected, 1)
+		metrics = metrics[n:]
+	}
+	return nil
+}
+
+func (f *MetricsBridgeFilter) ProcessMessage(pack *PipelinePack) error {
+	metrics, err := f.metrics(pack.Message)
+	if err == nil || metrics != nil {
+		atomic.AddInt64(&f.metricsConverted, int64(len(metrics)))
+		if injectErr := f.inject(pack, metrics); injectErr != nil {
+			err = injectErr
+		}
+	}
+	f.fr.UpdateCursor(pack.QueueCursor)
+	if err != nil {
+		return fmt.Errorf("metrics of '%s' message: %s", pack.Message.GetType(), err)
+	}
+	return nil
+}
+
+func (f *MetricsBridgeFilter) CleanUp() {}
+
+func (f *MetricsBridgeFilter) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "MetricsConverted", atomic.LoadInt64(&f.metricsConverted),
+		"count")
+	message.NewInt64Field(msg, "BadLines", atomic.LoadInt64(&f.badLines), "count")
+	message.NewInt64Field(msg, "MessagesInjected", atomic.LoadInt64(&f.messagesInjected),
+		"count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("MetricsBridgeFilter", func() interface{} {
+		return new(MetricsBridgeFilter)
+	})
+}
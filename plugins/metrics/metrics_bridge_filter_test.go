@@ -0,0 +1,232 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package metrics
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func MetricsSpec(c gs.Context) {
+	now := time.Unix(1400000000, 0)
+
+	c.Specify("ParseGraphiteLine", func() {
+		c.Specify("parses plaintext lines", func() {
+			name, tags, value, ts, err := ParseGraphiteLine("stats.web.hits 42.5 1500000000",
+				now)
+			c.Expect(err, gs.IsNil)
+			c.Expect(name, gs.Equals, "stats.web.hits")
+			c.Expect(tags == nil, gs.IsTrue)
+			c.Expect(value, gs.Equals, 42.5)
+			c.Expect(ts.Unix(), gs.Equals, int64(1500000000))
+		})
+
+		c.Specify("parses tags", func() {
+			name, tags, _, _, err := ParseGraphiteLine("cpu;host=a;dc=east 1", now)
+			c.Expect(err, gs.IsNil)
+			c.Expect(name, gs.Equals, "cpu")
+			c.Expect(len(tags), gs.Equals, 2)
+			c.Expect(tags["host"], gs.Equals, "a")
+			c.Expect(tags["dc"], gs.Equals, "east")
+		})
+
+		c.Specify("uses the default time", func() {
+			_, _, _, ts, err := ParseGraphiteLine("a 1 -1", now)
+			c.Expect(err, gs.IsNil)
+			c.Expect(ts.Equal(now), gs.IsTrue)
+			_, _, _, ts, err = ParseGraphiteLine("a 1", now)
+			c.Expect(err, gs.IsNil)
+			c.Expect(ts.Equal(now), gs.IsTrue)
+		})
+
+		c.Specify("rejects malformed lines", func() {
+			for _, line := range []string{"a", "a b", "a 1 x", "a;b 1", ";a=b 1",
+				"a 1 2 3"} {
+				_, _, _, _, err := ParseGraphiteLine(line, now)
+				c.Expect(err, gs.Not(gs.IsNil))
+			}
+		})
+	})
+
+	c.Specify("A Template", func() {
+		parts := strings.Split("servers.web01.cpu.user", ".")
+
+		c.Specify("maps parts to tags, measurement and field", func() {
+			t, err := ParseTemplate("servers.* .host.measurement.field region=us")
+			c.Assume(err, gs.IsNil)
+			c.Expect(t.Matches(parts), gs.IsTrue)
+			tags := make(map[string]string)
+			measurement, field := t.Apply(parts, ".", tags)
+			c.Expect(measurement, gs.Equals, "cpu")
+			c.Expect(field, gs.Equals, "user")
+			c.Expect(tags["host"], gs.Equals, "web01")
+			c.Expect(tags["region"], gs.Equals, "us")
+		})
+
+		c.Specify("takes the rest of the name", func() {
+			t, err := ParseTemplate("..measurement*")
+			c.Assume(err, gs.IsNil)
+			measurement, field := t.Apply(parts, "_", make(map[string]string))
+			c.Expect(measurement, gs.Equals, "cpu_user")
+			c.Expect(field, gs.Equals, "")
+		})
+
+		c.Specify("only matches names its filter matches", func() {
+			t, err := ParseTemplate("hosts.* host.measurement")
+			c.Assume(err, gs.IsNil)
+			c.Expect(t.Matches(parts), gs.IsFalse)
+			c.Expect(t.Matches([]string{"hosts"}), gs.IsFalse)
+		})
+
+		c.Specify("is rejected if malformed", func() {
+			for _, s := range []string{"", "measurement*.host", "a.*", "a b c=d e",
+				"measurement =x"} {
+				_, err := ParseTemplate(s)
+				c.Expect(err, gs.Not(gs.IsNil))
+			}
+		})
+	})
+}
+
+func MetricsBridgeFilterSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A MetricsBridgeFilter", func() {
+		filter := new(MetricsBridgeFilter)
+		config := filter.ConfigStruct().(*MetricsBridgeFilterConfig)
+		fr := pipelinemock.NewMockFilterRunner(ctrl)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		fr.EXPECT().Name().Return("MetricsBridge").AnyTimes()
+		fr.EXPECT().UpdateCursor(gomock.Any()).AnyTimes()
+
+		recycleChan := make(chan *PipelinePack, 10)
+		h.EXPECT().PipelinePack(gomock.Any()).Return(NewPipelinePack(recycleChan),
+			nil).AnyTimes()
+		var injected [][]Metric
+		fr.EXPECT().Inject(gomock.Any()).Do(func(pack *PipelinePack) {
+			c.Expect(pack.Message.GetType(), gs.Equals, "heka.metrics")
+			c.Expect(pack.Message.GetLogger(), gs.Equals, "MetricsBridge")
+			metrics, err := MessageMetrics(pack.Message)
+			c.Expect(err, gs.IsNil)
+			injected = append(injected, metrics)
+			pack.Message = new(message.Message)
+		}).Return(true).AnyTimes()
+
+		pack := NewPipelinePack(recycleChan)
+		pack.Message.SetType("heka.statmetric")
+		pack.Message.SetHostname("web01")
+		pack.Message.SetTimestamp(unixNano(1400000000))
+
+		prepare := func() {
+			c.Assume(filter.Init(config), gs.IsNil)
+			c.Assume(filter.Prepare(fr, h), gs.IsNil)
+		}
+
+		c.Specify("converts the Graphite lines of the payload", func() {
+			config.Templates = []string{"stats.* .measurement.field"}
+			config.Tags = map[string]string{"env": "prod"}
+			config.HostnameTag = "host"
+			prepare()
+			pack.Message.SetPayload("stats.web.hits 5 1400000010\n\n" +
+				"mem;env=dev 1024\n")
+			c.Expect(filter.ProcessMessage(pack), gs.IsNil)
+			c.Assume(len(injected), gs.Equals, 1)
+			metrics := injected[0]
+			c.Assume(len(metrics), gs.Equals, 2)
+			c.Expect(metrics[0].Name, gs.Equals, "web")
+			c.Expect(metrics[0].Field, gs.Equals, "hits")
+			c.Expect(metrics[0].Value, gs.Equals, 5.0)
+			c.Expect(metrics[0].Timestamp, gs.Equals, int64(1400000010000))
+			c.Expect(metrics[0].Tags["env"], gs.Equals, "prod")
+			c.Expect(metrics[0].Tags["host"], gs.Equals, "web01")
+			c.Expect(metrics[1].Name, gs.Equals, "mem")
+			c.Expect(metrics[1].Field, gs.Equals, "")
+			c.Expect(metrics[1].Timestamp, gs.Equals, int64(1400000000000))
+			c.Expect(metrics[1].Tags["env"], gs.Equals, "dev")
+		})
+
+		c.Specify("converts the numeric fields of a message without a payload", func() {
+			prepare()
+			f, _ := message.NewField("timestamp", int64(1400000020), "")
+			pack.Message.AddField(f)
+			f, _ = message.NewField("stats.counts.hits", int64(3), "")
+			pack.Message.AddField(f)
+			f, _ = message.NewField("stats.timers.load.mean", 2.5, "")
+			pack.Message.AddField(f)
+			f, _ = message.NewField("note", "not a number", "")
+			pack.Message.AddField(f)
+			f, _ = message.NewField("bad", math.NaN(), "")
+			pack.Message.AddField(f)
+			c.Expect(filter.ProcessMessage(pack), gs.IsNil)
+			c.Assume(len(injected), gs.Equals, 1)
+			metrics := injected[0]
+			c.Assume(len(metrics), gs.Equals, 2)
+			c.Expect(metrics[0].Name, gs.Equals, "stats.counts.hits")
+			c.Expect(metrics[0].Value, gs.Equals, 3.0)
+			c.Expect(metrics[0].Timestamp, gs.Equals, int64(1400000020000))
+			c.Expect(metrics[1].Name, gs.Equals, "stats.timers.load.mean")
+			c.Expect(metrics[1].Tags == nil, gs.IsTrue)
+		})
+
+		c.Specify("splits metrics across messages", func() {
+			config.MaxMetrics = 2
+			prepare()
+			pack.Message.SetPayload("a 1\nb 2\nc 3\nd 4\ne 5\n")
+			c.Expect(filter.ProcessMessage(pack), gs.IsNil)
+			c.Assume(len(injected), gs.Equals, 3)
+			c.Expect(len(injected[0]), gs.Equals, 2)
+			c.Expect(len(injected[2]), gs.Equals, 1)
+			c.Expect(injected[2][0].Name, gs.Equals, "e")
+		})
+
+		c.Specify("keeps the good lines of a payload with bad ones", func() {
+			prepare()
+			pack.Message.SetPayload("a 1\nbogus\nb inf\nc 3\n")
+			c.Expect(filter.ProcessMessage(pack), gs.Not(gs.IsNil))
+			c.Assume(len(injected), gs.Equals, 1)
+			c.Expect(len(injected[0]), gs.Equals, 2)
+			msg := new(message.Message)
+			c.Expect(filter.ReportMsg(msg), gs.IsNil)
+			bad, ok := msg.GetFieldValue("BadLines")
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(bad, gs.Equals, int64(2))
+		})
+
+		c.Specify("doesn't inject anything without metrics", func() {
+			prepare()
+			c.Expect(filter.ProcessMessage(pack), gs.IsNil)
+			c.Expect(len(injected), gs.Equals, 0)
+		})
+
+		c.Specify("rejects a bad template", func() {
+			config.Templates = []string{"a.measurement*.b"}
+			c.Expect(filter.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
+
+func unixNano(secs int64) int64 {
+	return time.Unix(secs, 0).UnixNano()
+}
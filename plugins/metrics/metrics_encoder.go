@@ -0,0 +1,194 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "heka/pipeline"
+)
+
+type MetricsEncoderConfig struct {
+	// "influx", "graphite" or "prometheus".
+	Format string `toml:"format"`
+	// Field key of influx metrics which have no field. Defaults to "value".
+	DefaultField string `toml:"default_field"`
+	// Separator joining the names and fields of graphite and prometheus
+	// metrics. Defaults to "." for graphite and "_" for prometheus.
+	Separator string `toml:"separator"`
+}
+
+// Encodes the metrics of the MetricsBridgeFilter's messages in the line
+// format of a metrics backend: InfluxDB's line protocol, which VictoriaMetrics
+// also takes, Graphite's tagged plaintext protocol or Prometheus's text
+// exposition format.
+type MetricsEncoder struct {
+	conf   *MetricsEncoderConfig
+	encode func(buf *bytes.Buffer, m *Metric)
+}
+
+func (e *MetricsEncoder) ConfigStruct() interface{} {
+	return &MetricsEncoderConfig{
+		Format:       "influx",
+		DefaultField: "value",
+	}
+}
+
+func (e *MetricsEncoder) Init(config interface{}) error {
+	e.conf = config.(*MetricsEncoderConfig)
+	switch e.conf.Format {
+	case "influx":
+		if e.conf.DefaultField == "" {
+			return fmt.Errorf("default_field must be set")
+		}
+		e.encode = e.influx
+	case "graphite":
+		if e.conf.Separator == "" {
+			e.conf.Separator = "."
+		}
+		e.encode = e.graphite
+	case "prometheus":
+		if e.conf.Separator == "" {
+			e.conf.Separator = "_"
+		}
+		e.encode = e.prometheus
+	default:
+		return fmt.Errorf("unknown format '%s'", e.conf.Format)
+	}
+	return nil
+}
+
+func sortedKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxKeyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	graphiteEscaper          = strings.NewReplacer(" ", "_", ";", "_", "~", "_")
+	promValueEscaper         = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (e *MetricsEncoder) influx(buf *bytes.Buffer, m *Metric) {
+	buf.WriteString(influxMeasurementEscaper.Replace(m.Name))
+	for _, k := range sortedKeys(m.Tags) {
+		if m.Tags[k] == "" {
+			continue
+		}
+		buf.WriteByte(',')
+		buf.WriteString(influxKeyEscaper.Replace(k))
+		buf.WriteByte('=')
+		buf.WriteString(influxKeyEscaper.Replace(m.Tags[k]))
+	}
+	field := m.Field
+	if field == "" {
+		field = e.conf.DefaultField
+	}
+	fmt.Fprintf(buf, " %s=%s %d\n", influxKeyEscaper.Replace(field),
+		formatValue(m.Value), m.Timestamp*1e6)
+}
+
+func (e *MetricsEncoder) graphite(buf *bytes.Buffer, m *Metric) {
+	buf.WriteString(graphiteEscaper.Replace(m.Name))
+	if m.Field != "" {
+		buf.WriteString(e.conf.Separator)
+		buf.WriteString(graphiteEscaper.Replace(m.Field))
+	}
+	for _, k := range sortedKeys(m.Tags) {
+		if m.Tags[k] == "" {
+			continue
+		}
+		buf.WriteByte(';')
+		buf.WriteString(graphiteEscaper.Replace(k))
+		buf.WriteByte('=')
+		buf.WriteString(graphiteEscaper.Replace(m.Tags[k]))
+	}
+	fmt.Fprintf(buf, " %s %d\n", formatValue(m.Value), m.Timestamp/1e3)
+}
+
+// Replaces the characters Prometheus doesn't allow in metric names, or if
+// label is set in label names, with underscores.
+func promName(s string, label bool) string {
+	b := []byte(s)
+	for i, c := range b {
+		ok := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(i > 0 && c >= '0' && c <= '9') || (!label && c == ':')
+		if !ok {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func (e *MetricsEncoder) prometheus(buf *bytes.Buffer, m *Metric) {
+	name := m.Name
+	if m.Field != "" {
+		name += e.conf.Separator + m.Field
+	}
+	buf.WriteString(promName(name, false))
+	first := true
+	for _, k := range sortedKeys(m.Tags) {
+		if m.Tags[k] == "" {
+			continue
+		}
+		if first {
+			buf.WriteByte('{')
+			first = false
+		} else {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, `%s="%s"`, promName(k, true), promValueEscaper.Replace(m.Tags[k]))
+	}
+	if !first {
+		buf.WriteByte('}')
+	}
+	fmt.Fprintf(buf, " %s %d\n", formatValue(m.Value), m.Timestamp)
+}
+
+// All of the formats are line based text.
+func (e *MetricsEncoder) ContentType() string {
+	return "text/plain"
+}
+
+func (e *MetricsEncoder) Encode(pack *PipelinePack) (output []byte, err error) {
+	metrics, err := MessageMetrics(pack.Message)
+	if err != nil || len(metrics) == 0 {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	for i := range metrics {
+		e.encode(buf, &metrics[i])
+	}
+	return buf.Bytes(), nil
+}
+
+func init() {
+	RegisterPlugin("MetricsEncoder", func() interface{} {
+		return new(MetricsEncoder)
+	})
+}
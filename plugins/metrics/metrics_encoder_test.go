@@ -0,0 +1,71 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package metrics
+
+import (
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+)
+
+func MetricsEncoderSpec(c gs.Context) {
+	c.Specify("A MetricsEncoder", func() {
+		encoder := new(MetricsEncoder)
+		config := encoder.ConfigStruct().(*MetricsEncoderConfig)
+		pack := NewPipelinePack(make(chan *PipelinePack, 1))
+		metrics := []Metric{
+			{Name: "cpu load", Field: "user", Value: 0.5, Timestamp: 1400000000123,
+				Tags: map[string]string{"host": "web01", "dc": "us,east"}},
+			{Name: "requests", Value: 12, Timestamp: 1400000001000},
+		}
+		c.Assume(AddMetrics(pack.Message, metrics), gs.IsNil)
+
+		encode := func() string {
+			c.Assume(encoder.Init(config), gs.IsNil)
+			output, err := encoder.Encode(pack)
+			c.Expect(err, gs.IsNil)
+			return string(output)
+		}
+
+		c.Specify("writes influx line protocol", func() {
+			c.Expect(encode(), gs.Equals,
+				`cpu\ load,dc=us\,east,host=web01 user=0.5 1400000000123000000`+"\n"+
+					"requests value=12 1400000001000000000\n")
+		})
+
+		c.Specify("writes tagged graphite lines", func() {
+			config.Format = "graphite"
+			c.Expect(encode(), gs.Equals,
+				"cpu_load.user;dc=us,east;host=web01 0.5 1400000000\n"+
+					"requests 12 1400000001\n")
+		})
+
+		c.Specify("writes prometheus text", func() {
+			config.Format = "prometheus"
+			c.Expect(encode(), gs.Equals,
+				`cpu_load_user{dc="us,east",host="web01"} 0.5 1400000000123`+"\n"+
+					"requests 12 1400000001000\n")
+		})
+
+		c.Specify("skips messages without metrics", func() {
+			pack.Message.DeleteField(pack.Message.FindFirstField(MetricsField))
+			c.Expect(encode(), gs.Equals, "")
+		})
+
+		c.Specify("rejects unknown formats", func() {
+			config.Format = "opentsdb"
+			c.Expect(encoder.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
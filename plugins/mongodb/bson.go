@@ -0,0 +1,318 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package mongodb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BSON element types.
+const (
+	bsonDouble    = 0x01
+	bsonString    = 0x02
+	bsonDocument  = 0x03
+	bsonArray     = 0x04
+	bsonBinary    = 0x05
+	bsonObjectId  = 0x07
+	bsonBool      = 0x08
+	bsonDatetime  = 0x09
+	bsonNull      = 0x0a
+	bsonInt32     = 0x10
+	bsonTimestamp = 0x11
+	bsonInt64     = 0x12
+	bsonDecimal   = 0x13
+)
+
+// Binary subtype of UUIDs.
+const bsonUuidSubtype = 0x04
+
+// An element of a document, whose order matters to commands.
+type docElem struct {
+	key   string
+	value interface{}
+}
+
+// A document with its keys in order.
+type doc []docElem
+
+// A binary value of a subtype other than generic.
+type binaryValue struct {
+	subtype byte
+	data    []byte
+}
+
+func appendInt32(b []byte, n int32) []byte {
+	return append(b, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+}
+
+func appendInt64(b []byte, n int64) []byte {
+	return append(appendInt32(b, int32(n)), byte(n>>32), byte(n>>40), byte(n>>48),
+		byte(n>>56))
+}
+
+func appendCstring(b []byte, s string) ([]byte, error) {
+	if strings.IndexByte(s, 0) >= 0 {
+		return nil, fmt.Errorf("key '%s' has a null byte", s)
+	}
+	return append(append(b, s...), 0), nil
+}
+
+// Appends the element of a value, of any of the types BSON documents are
+// built from.
+func appendElem(b []byte, key string, v interface{}) (_ []byte, err error) {
+	var typ byte
+	switch v.(type) {
+	case float64:
+		typ = bsonDouble
+	case string:
+		typ = bsonString
+	case doc, map[string]interface{}:
+		typ = bsonDocument
+	case []interface{}:
+		typ = bsonArray
+	case []byte, binaryValue:
+		typ = bsonBinary
+	case bool:
+		typ = bsonBool
+	case time.Time:
+		typ = bsonDatetime
+	case nil:
+		typ = bsonNull
+	case int32, int:
+		typ = bsonInt32
+	case int64:
+		typ = bsonInt64
+	default:
+		return nil, fmt.Errorf("can't encode %T '%s'", v, key)
+	}
+	if b, err = appendCstring(append(b, typ), key); err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case float64:
+		var f [8]byte
+		binary.LittleEndian.PutUint64(f[:], math.Float64bits(v))
+		b = append(b, f[:]...)
+	case string:
+		b = append(append(appendInt32(b, int32(len(v)+1)), v...), 0)
+	case doc:
+		return appendDoc(b, v)
+	case map[string]interface{}:
+		return appendDoc(b, mapDoc(v))
+	case []interface{}:
+		d := make(doc, len(v))
+		for i, e := range v {
+			d[i] = docElem{strconv.Itoa(i), e}
+		}
+		return appendDoc(b, d)
+	case []byte:
+		b = append(append(appendInt32(b, int32(len(v))), 0), v...)
+	case binaryValue:
+		b = append(append(appendInt32(b, int32(len(v.data))), v.subtype), v.data...)
+	case bool:
+		if v {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+	case time.Time:
+		b = appendInt64(b, v.UnixNano()/1e6)
+	case int:
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return nil, fmt.Errorf("%d is too big for '%s'", v, key)
+		}
+		b = appendInt32(b, int32(v))
+	case int32:
+		b = appendInt32(b, v)
+	case int64:
+		b = appendInt64(b, v)
+	}
+	return b, nil
+}
+
+// Returns a map's elements, ordered by key.
+func mapDoc(m map[string]interface{}) doc {
+	d := make(doc, 0, len(m))
+	for k, v := range m {
+		d = append(d, docElem{k, v})
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i].key < d[j].key })
+	return d
+}
+
+func appendDoc(b []byte, d doc) (_ []byte, err error) {
+	start := len(b)
+	b = append(b, 0, 0, 0, 0)
+	for _, e := range d {
+		if b, err = appendElem(b, e.key, e.value); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, 0)
+	binary.LittleEndian.PutUint32(b[start:], uint32(len(b)-start))
+	return b, nil
+}
+
+func marshalDoc(d doc) ([]byte, error) {
+	return appendDoc(nil, d)
+}
+
+var errTruncatedBson = errors.New("truncated BSON document")
+
+// Decodes a document into a map, with arrays as slices, object IDs and
+// decimals as their bytes and timestamps as uint64s.
+func unmarshalDoc(b []byte) (map[string]interface{}, error) {
+	m, rest, err := readDoc(b, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing bytes after BSON document")
+	}
+	return m.(map[string]interface{}), nil
+}
+
+func readDoc(b []byte, array bool) (interface{}, []byte, error) {
+	if len(b) < 5 {
+		return nil, nil, errTruncatedBson
+	}
+	n := int(binary.LittleEndian.Uint32(b))
+	if n < 5 || n > len(b) || b[n-1] != 0 {
+		return nil, nil, errTruncatedBson
+	}
+	body, rest := b[4:n-1], b[n:]
+	m := make(map[string]interface{})
+	var values []interface{}
+	for len(body) > 0 {
+		typ := body[0]
+		end := 1
+		for end < len(body) && body[end] != 0 {
+			end++
+		}
+		if end == len(body) {
+			return nil, nil, errTruncatedBson
+		}
+		key := string(body[1:end])
+		var v interface{}
+		var err error
+		if v, body, err = readValue(typ, body[end+1:]); err != nil {
+			return nil, nil, err
+		}
+		if array {
+			values = append(values, v)
+		} else {
+			m[key] = v
+		}
+	}
+	if array {
+		return values, rest, nil
+	}
+	return m, rest, nil
+}
+
+func readValue(typ byte, b []byte) (interface{}, []byte, error) {
+	fixed := func(n int) ([]byte, []byte, error) {
+		if len(b) < n {
+			return nil, nil, errTruncatedBson
+		}
+		return b[:n], b[n:], nil
+	}
+	switch typ {
+	case bsonDouble:
+		v, rest, err := fixed(8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(v)), rest, nil
+	case bsonString:
+		if len(b) < 4 {
+			return nil, nil, errTruncatedBson
+		}
+		n := int(int32(binary.LittleEndian.Uint32(b)))
+		if n < 1 || 4+n > len(b) {
+			return nil, nil, errTruncatedBson
+		}
+		return string(b[4 : 4+n-1]), b[4+n:], nil
+	case bsonDocument, bsonArray:
+		return readDoc(b, typ == bsonArray)
+	case bsonBinary:
+		if len(b) < 5 {
+			return nil, nil, errTruncatedBson
+		}
+		n := int(int32(binary.LittleEndian.Uint32(b)))
+		if n < 0 || 5+n > len(b) {
+			return nil, nil, errTruncatedBson
+		}
+		return b[5 : 5+n], b[5+n:], nil
+	case bsonObjectId:
+		return fixed(12)
+	case bsonBool:
+		v, rest, err := fixed(1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return v[0] != 0, rest, nil
+	case bsonDatetime:
+		v, rest, err := fixed(8)
+		if err != nil {
+			return nil, nil, err
+		}
+		ms := int64(binary.LittleEndian.Uint64(v))
+		return time.Unix(0, ms*1e6).UTC(), rest, nil
+	case bsonNull:
+		return nil, b, nil
+	case bsonInt32:
+		v, rest, err := fixed(4)
+		if err != nil {
+			return nil, nil, err
+		}
+		return int32(binary.LittleEndian.Uint32(v)), rest, nil
+	case bsonTimestamp:
+		v, rest, err := fixed(8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return binary.LittleEndian.Uint64(v), rest, nil
+	case bsonInt64:
+		v, rest, err := fixed(8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return int64(binary.LittleEndian.Uint64(v)), rest, nil
+	case bsonDecimal:
+		return fixed(16)
+	}
+	return nil, nil, fmt.Errorf("unsupported BSON type 0x%02x", typ)
+}
+
+// Returns a number of a decoded document as an int64.
+func docInt(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
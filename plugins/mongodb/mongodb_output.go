@@ -0,0 +1,550 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package mongodb
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cactus/gostrftime"
+	"heka/message"
+	. "heka/pipeline"
+	"heka/plugins/tcp"
+)
+
+// Code of duplicate key errors, which inserts sent again get.
+const duplicateKeyCode = 11000
+
+type MongoDBOutputConfig struct {
+	// Members of the replica set or mongos routers, "host:port". Writes go
+	// to the primary. Defaults to "127.0.0.1:27017".
+	Hosts    []string `toml:"hosts"`
+	Database string   `toml:"database"`
+	// Collection documents are inserted into. %{Name} is replaced by the
+	// message header or field Name, and anything else in %{} is a strftime
+	// format of the message's timestamp. Defaults to "heka".
+	Collection string `toml:"collection"`
+	// Whether inserts stop at the first document that fails. Defaults to
+	// true.
+	Ordered bool `toml:"ordered"`
+	// Write concern: "majority", a number of members or a tag set. The
+	// server's default if it's empty.
+	WriteConcern string `toml:"write_concern"`
+	// Whether writes must be journaled.
+	Journal bool `toml:"journal"`
+	// Milliseconds to wait for the write concern.
+	WtimeoutMs uint `toml:"wtimeout_ms"`
+	// SCRAM login.
+	Username      string `toml:"username"`
+	Password      string `toml:"password"`
+	AuthSource    string `toml:"auth_source"`
+	AuthMechanism string `toml:"auth_mechanism"`
+	UseTls        bool   `toml:"use_tls"`
+	Tls           tcp.TlsConfig
+	// Most documents inserted at once, and also the most buffered before
+	// they're inserted. Defaults to 1000.
+	BatchSize uint `toml:"batch_size"`
+	// Seconds to connect or to get a reply. Defaults to 10.
+	Timeout uint `toml:"timeout"`
+	// Seconds between inserting the documents buffered. Defaults to 1.
+	TickerInterval uint `toml:"ticker_interval"`
+}
+
+// A document waiting to be inserted.
+type pendingDoc struct {
+	collection string
+	data       []byte
+}
+
+// Output plugin that inserts messages as documents into MongoDB collections
+// named from the messages, with bulk inserts under a configurable write
+// concern. Inserts failing for a transient reason, such as a primary
+// stepping down, are retried until they succeed.
+type MongoDBOutput struct {
+	conf         *MongoDBOutputConfig
+	tlsConf      *tls.Config
+	or           OutputRunner
+	writeConcern doc
+	conn         *mongoConn
+
+	docs   []pendingDoc
+	cursor string
+
+	// Accessed atomically, for the reports.
+	docsInserted  int64
+	duplicates    int64
+	docsDropped   int64
+	insertsSent   int64
+	writeFailures int64
+	waiting       int64
+}
+
+func (o *MongoDBOutput) ConfigStruct() interface{} {
+	return &MongoDBOutputConfig{
+		Hosts:          []string{"127.0.0.1:27017"},
+		Collection:     "heka",
+		Ordered:        true,
+		AuthSource:     "admin",
+		AuthMechanism:  "SCRAM-SHA-256",
+		BatchSize:      1000,
+		Timeout:        10,
+		TickerInterval: 1,
+	}
+}
+
+func (o *MongoDBOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*MongoDBOutputConfig)
+	if len(o.conf.Hosts) == 0 {
+		return errors.New("hosts must be set")
+	}
+	if o.conf.Database == "" || strings.ContainsAny(o.conf.Database, "/\\. \"$") {
+		return errors.New("database must be set to a valid database name")
+	}
+	if o.conf.Collection == "" {
+		return errors.New("collection must be set")
+	}
+	if o.conf.BatchSize == 0 {
+		return errors.New("batch_size must be greater than 0")
+	}
+	switch o.conf.AuthMechanism {
+	case "SCRAM-SHA-256":
+	case "SCRAM-SHA-1":
+		// Its password digest is MD5.
+		if FipsMode() {
+			return errors.New("auth_mechanism 'SCRAM-SHA-1' isn't allowed in FIPS mode")
+		}
+	default:
+		return fmt.Errorf("unknown auth_mechanism '%s'", o.conf.AuthMechanism)
+	}
+	if o.conf.UseTls {
+		if o.tlsConf, err = tcp.CreateGoTlsConfig(&o.conf.Tls); err != nil {
+			return fmt.Errorf("TLS init error: %s", err)
+		}
+	}
+
+	o.writeConcern = nil
+	if w := o.conf.WriteConcern; w != "" {
+		if n, err := strconv.ParseInt(w, 10, 32); err == nil {
+			o.writeConcern = append(o.writeConcern, docElem{"w", int32(n)})
+		} else {
+			o.writeConcern = append(o.writeConcern, docElem{"w", w})
+		}
+	}
+	if o.conf.Journal {
+		o.writeConcern = append(o.writeConcern, docElem{"j", true})
+	}
+	if o.conf.WtimeoutMs > 0 {
+		o.writeConcern = append(o.writeConcern, docElem{"wtimeout",
+			int64(o.conf.WtimeoutMs)})
+	}
+	return nil
+}
+
+func (o *MongoDBOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	o.or = or
+	return nil
+}
+
+// Returns the value of a message header, or a string of a field's.
+func headerValue(msg *message.Message, name string) (string, bool) {
+	switch name {
+	case "Type":
+		return msg.GetType(), true
+	case "Logger":
+		return msg.GetLogger(), true
+	case "Hostname":
+		return msg.GetHostname(), true
+	case "EnvVersion":
+		return msg.GetEnvVersion(), true
+	case "Severity":
+		return strconv.Itoa(int(msg.GetSeverity())), true
+	case "Pid":
+		return strconv.Itoa(int(msg.GetPid())), true
+	case "Uuid":
+		return msg.GetUuidString(), true
+	}
+	if v, ok := msg.GetFieldValue(name); ok {
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// Returns the name of a message's collection.
+func (o *MongoDBOutput) collection(msg *message.Message) (string, error) {
+	parts := strings.Split(o.conf.Collection, "%{")
+	for i := 1; i < len(parts); i++ {
+		end := strings.Index(parts[i], "}")
+		if end < 0 {
+			parts[i] = "%{" + parts[i]
+			continue
+		}
+		name := parts[i][:end]
+		v, ok := headerValue(msg, name)
+		if !ok {
+			v = gostrftime.Strftime(name, time.Unix(0, msg.GetTimestamp()).UTC())
+		}
+		parts[i] = v + parts[i][end+1:]
+	}
+	name := strings.Join(parts, "")
+	if name == "" || strings.ContainsAny(name, "$\x00") || strings.HasPrefix(name, "system.") {
+		return "", fmt.Errorf("'%s' isn't a valid collection name", name)
+	}
+	return name, nil
+}
+
+// Returns a field's value: a single value, or an array of multiple values.
+func fieldValue(f *message.Field) interface{} {
+	var values []interface{}
+	switch f.GetValueType() {
+	case message.Field_STRING:
+		for _, v := range f.ValueString {
+			values = append(values, v)
+		}
+	case message.Field_BYTES:
+		for _, v := range f.ValueBytes {
+			values = append(values, v)
+		}
+	case message.Field_INTEGER:
+		for _, v := range f.ValueInteger {
+			values = append(values, v)
+		}
+	case message.Field_DOUBLE:
+		for _, v := range f.ValueDouble {
+			values = append(values, v)
+		}
+	case message.Field_BOOL:
+		for _, v := range f.ValueBool {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// Converts a decoded JSON value to one that can be written as BSON, with
+// integers as int64s.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonValue(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+	}
+	return v
+}
+
+// Returns the BSON document of a message, with the message's UUID as its _id
+// so that inserting it again is harmless. Without an encoder the document has
+// the message's headers and its fields in a "Fields" subdocument, otherwise
+// it's the encoder's output, a JSON object. Nil if the encoder produced
+// nothing.
+func (o *MongoDBOutput) document(pack *PipelinePack) ([]byte, error) {
+	msg := pack.Message
+	var d doc
+	if uuid := msg.GetUuid(); len(uuid) == 16 {
+		d = append(d, docElem{"_id", binaryValue{bsonUuidSubtype, uuid}})
+	}
+	if o.or.Encoder() != nil {
+		body, err := o.or.Encode(pack)
+		if err != nil {
+			return nil, err
+		}
+		if body == nil {
+			return nil, nil
+		}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var m map[string]interface{}
+		if err = dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("encoder output isn't a JSON object: %s", err)
+		}
+		if _, ok := m["_id"]; ok {
+			d = nil
+		}
+		d = append(d, mapDoc(jsonValue(m).(map[string]interface{}))...)
+		return marshalDoc(d)
+	}
+
+	fields := make(map[string]interface{}, len(msg.Fields))
+	for _, f := range msg.Fields {
+		fields[f.GetName()] = fieldValue(f)
+	}
+	d = append(d,
+		docElem{"Timestamp", time.Unix(0, msg.GetTimestamp())},
+		docElem{"Type", msg.GetType()},
+		docElem{"Logger", msg.GetLogger()},
+		docElem{"Hostname", msg.GetHostname()},
+		docElem{"Severity", msg.GetSeverity()},
+		docElem{"Pid", msg.GetPid()},
+		docElem{"EnvVersion", msg.GetEnvVersion()},
+		docElem{"Payload", msg.GetPayload()},
+		docElem{"Fields", fields},
+	)
+	return marshalDoc(d)
+}
+
+// Connects to the primary, found from the first member that can be reached,
+// and authenticates.
+func (o *MongoDBOutput) connect() (err error) {
+	if o.conn != nil {
+		return nil
+	}
+	timeout := time.Duration(o.conf.Timeout) * time.Second
+	for _, host := range o.conf.Hosts {
+		var c *mongoConn
+		if c, err = dialMongo(host, o.tlsConf, timeout); err != nil {
+			err = fmt.Errorf("can't connect to %s: %s", host, err)
+			continue
+		}
+		if !c.writable && c.primary != "" && c.primary != host {
+			c.Close()
+			host = c.primary
+			if c, err = dialMongo(host, o.tlsConf, timeout); err != nil {
+				err = fmt.Errorf("can't connect to primary %s: %s", host, err)
+				continue
+			}
+		}
+		if !c.writable {
+			c.Close()
+			err = fmt.Errorf("%s isn't the primary", host)
+			continue
+		}
+		if o.conf.Username != "" {
+			if err = c.authenticate(o.conf.AuthMechanism, o.conf.AuthSource,
+				o.conf.Username, o.conf.Password); err != nil {
+				c.Close()
+				return fmt.Errorf("can't authenticate to %s: %s", host, err)
+			}
+		}
+		o.conn = c
+		return nil
+	}
+	return err
+}
+
+func (o *MongoDBOutput) disconnect() {
+	if o.conn != nil {
+		o.conn.Close()
+		o.conn = nil
+	}
+}
+
+// Inserts documents into a collection, returning how many of them, from the
+// start, are done with: inserted, already there or dropped.
+func (o *MongoDBOutput) insert(collection string, docs [][]byte) (int, error) {
+	cmd := doc{{"insert", collection}, {"ordered", o.conf.Ordered}}
+	if len(o.writeConcern) > 0 {
+		cmd = append(cmd, docElem{"writeConcern", o.writeConcern})
+	}
+	cmd = append(cmd, docElem{"$db", o.conf.Database})
+	reply, err := o.conn.command(cmd, "documents", docs)
+	if err != nil {
+		atomic.AddInt64(&o.writeFailures, 1)
+		if e, ok := err.(*commandError); ok && !e.transient() {
+			atomic.AddInt64(&o.docsDropped, int64(len(docs)))
+			o.or.LogError(fmt.Errorf("%d documents dropped: %s", len(docs), err))
+			return len(docs), nil
+		}
+		return 0, err
+	}
+	atomic.AddInt64(&o.insertsSent, 1)
+	if wce, ok := reply["writeConcernError"].(map[string]interface{}); ok {
+		// The documents are written but may not be kept, so they're sent
+		// again.
+		atomic.AddInt64(&o.writeFailures, 1)
+		return 0, fmt.Errorf("write concern failed: %s", newCommandError(wce))
+	}
+
+	done := len(docs)
+	failed := 0
+	writeErrors, _ := reply["writeErrors"].([]interface{})
+	for _, we := range writeErrors {
+		e, _ := we.(map[string]interface{})
+		i, _ := docInt(e["index"])
+		if o.conf.Ordered {
+			// Those after the failed one weren't tried.
+			done = int(i) + 1
+		}
+		failed++
+		if code, _ := docInt(e["code"]); code == duplicateKeyCode {
+			atomic.AddInt64(&o.duplicates, 1)
+			continue
+		}
+		atomic.AddInt64(&o.docsDropped, 1)
+		o.or.LogError(fmt.Errorf("document dropped: %s", newCommandError(e)))
+	}
+	if n, ok := docInt(reply["n"]); ok {
+		atomic.AddInt64(&o.docsInserted, n)
+	} else {
+		atomic.AddInt64(&o.docsInserted, int64(done-failed))
+	}
+	return done, nil
+}
+
+// Inserts the documents buffered, in bulk inserts of those of the same
+// collection, and moves the cursor past them once none are left.
+func (o *MongoDBOutput) flush() error {
+	if len(o.docs) == 0 {
+		return nil
+	}
+	if err := o.connect(); err != nil {
+		atomic.AddInt64(&o.writeFailures, 1)
+		return err
+	}
+
+	var collections []string
+	byCollection := make(map[string][]int)
+	for i, d := range o.docs {
+		if _, ok := byCollection[d.collection]; !ok {
+			collections = append(collections, d.collection)
+		}
+		byCollection[d.collection] = append(byCollection[d.collection], i)
+	}
+	done := make([]bool, len(o.docs))
+	var lastErr error
+	for _, collection := range collections {
+		indexes := byCollection[collection]
+		for len(indexes) > 0 && o.conn != nil {
+			// As many as fit in a message.
+			var batch [][]byte
+			size := 1024 + len(collection)
+			for _, i := range indexes {
+				if len(batch) == int(o.conf.BatchSize) || len(batch) == o.conn.maxWriteBatch ||
+					(len(batch) > 0 && size+len(o.docs[i].data) > o.conn.maxMessageSize) {
+					break
+				}
+				batch = append(batch, o.docs[i].data)
+				size += len(o.docs[i].data)
+			}
+			n, err := o.insert(collection, batch)
+			for _, i := range indexes[:n] {
+				done[i] = true
+			}
+			indexes = indexes[n:]
+			if err != nil {
+				lastErr = fmt.Errorf("can't insert %d documents into %s: %s", len(batch),
+					collection, err)
+				o.disconnect()
+			}
+		}
+	}
+
+	docs := o.docs[:0]
+	for i, d := range o.docs {
+		if !done[i] {
+			docs = append(docs, d)
+		}
+	}
+	for i := len(docs); i < len(o.docs); i++ {
+		o.docs[i] = pendingDoc{}
+	}
+	o.docs = docs
+	atomic.StoreInt64(&o.waiting, int64(len(o.docs)))
+	if len(o.docs) == 0 {
+		o.or.UpdateCursor(o.cursor)
+		return nil
+	}
+	return lastErr
+}
+
+func (o *MongoDBOutput) ProcessMessage(pack *PipelinePack) error {
+	if len(o.docs) >= int(o.conf.BatchSize) {
+		if err := o.flush(); err != nil {
+			return NewRetryMessageError("%s", err)
+		}
+	}
+	collection, err := o.collection(pack.Message)
+	var data []byte
+	if err == nil {
+		data, err = o.document(pack)
+	}
+	if err == nil && len(data) > defaultMaxBsonSize {
+		err = fmt.Errorf("document of %d bytes is too big", len(data))
+	}
+	if err != nil || data == nil {
+		if err != nil {
+			atomic.AddInt64(&o.docsDropped, 1)
+		}
+		if len(o.docs) == 0 {
+			o.or.UpdateCursor(pack.QueueCursor)
+		} else {
+			o.cursor = pack.QueueCursor
+		}
+		if err != nil {
+			return fmt.Errorf("can't build document: %s", err)
+		}
+		return nil
+	}
+	o.docs = append(o.docs, pendingDoc{collection: collection, data: data})
+	o.cursor = pack.QueueCursor
+	atomic.StoreInt64(&o.waiting, int64(len(o.docs)))
+	if len(o.docs) >= int(o.conf.BatchSize) {
+		if err = o.flush(); err != nil {
+			// Inserted with the next message or tick.
+			o.or.LogError(err)
+		}
+	}
+	return nil
+}
+
+func (o *MongoDBOutput) TimerEvent() error {
+	if err := o.flush(); err != nil {
+		o.or.LogError(err)
+	}
+	return nil
+}
+
+func (o *MongoDBOutput) CleanUp() {
+	if err := o.flush(); err != nil {
+		o.or.LogError(fmt.Errorf("documents may not have been inserted: %s", err))
+	}
+	o.disconnect()
+}
+
+func (o *MongoDBOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "DocsInserted", atomic.LoadInt64(&o.docsInserted), "count")
+	message.NewInt64Field(msg, "Duplicates", atomic.LoadInt64(&o.duplicates), "count")
+	message.NewInt64Field(msg, "DocsDropped", atomic.LoadInt64(&o.docsDropped), "count")
+	message.NewInt64Field(msg, "InsertsSent", atomic.LoadInt64(&o.insertsSent), "count")
+	message.NewInt64Field(msg, "WriteFailures", atomic.LoadInt64(&o.writeFailures),
+		"count")
+	message.NewInt64Field(msg, "Waiting", atomic.LoadInt64(&o.waiting), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("MongoDBOutput", func() interface{} {
+		return new(MongoDBOutput)
+	})
+}
@@ -0,0 +1,496 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package mongodb
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"golang.org/x/crypto/pbkdf2"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+	"heka/plugins"
+)
+
+// An insert command the server received.
+type mongoInsert struct {
+	collection   string
+	ordered      bool
+	writeConcern map[string]interface{}
+	docs         []map[string]interface{}
+}
+
+// A mongod that records the documents it's asked to insert, and can be told
+// to fail.
+type mongoServer struct {
+	listener net.Listener
+
+	lock    sync.Mutex
+	primary string
+	// SCRAM-SHA-256 password of user "heka", if authentication is needed.
+	password      string
+	authenticated int
+	inserts       []*mongoInsert
+	// Replies the next inserts get instead of succeeding.
+	replies []doc
+}
+
+func newMongoServer() *mongoServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := &mongoServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *mongoServer) configure(f func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f()
+}
+
+func (s *mongoServer) received() []*mongoInsert {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*mongoInsert(nil), s.inserts...)
+}
+
+func (s *mongoServer) serve(conn net.Conn) {
+	defer conn.Close()
+	var scram map[string]string
+	for {
+		header := make([]byte, 16)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		msg := make([]byte, binary.LittleEndian.Uint32(header)-16)
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return
+		}
+		body, rest, err := readDoc(msg[5:], false)
+		if err != nil {
+			return
+		}
+		cmd := body.(map[string]interface{})
+		var seq []map[string]interface{}
+		if len(rest) > 0 && rest[0] == 1 {
+			end := 5 + bytes.IndexByte(rest[5:], 0) + 1
+			for docs := rest[end:]; len(docs) > 0; {
+				var d interface{}
+				if d, docs, err = readDoc(docs, false); err != nil {
+					return
+				}
+				seq = append(seq, d.(map[string]interface{}))
+			}
+		}
+		reply := s.handle(cmd, seq, &scram)
+		if reply[0].key != "ok" {
+			reply = append(reply, docElem{"ok", 1.0})
+		}
+		data, _ := marshalDoc(reply)
+		out := make([]byte, 16, 21+len(data))
+		binary.LittleEndian.PutUint32(out[8:], binary.LittleEndian.Uint32(header[4:]))
+		binary.LittleEndian.PutUint32(out[12:], opMsg)
+		out = append(append(appendInt32(out, 0), 0), data...)
+		binary.LittleEndian.PutUint32(out, uint32(len(out)))
+		if _, err = conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+func scramMac(key []byte, s string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(s))
+	return m.Sum(nil)
+}
+
+func (s *mongoServer) handle(cmd map[string]interface{}, seq []map[string]interface{},
+	scram *map[string]string) doc {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	failed := doc{{"ok", 0.0}, {"code", 13}, {"errmsg", "unauthorized"}}
+	switch {
+	case cmd["hello"] != nil:
+		if s.primary != "" {
+			return doc{{"isWritablePrimary", false}, {"primary", s.primary}}
+		}
+		return doc{{"isWritablePrimary", true}, {"maxWriteBatchSize", int32(100)}}
+	case cmd["saslStart"] != nil:
+		clientFirst := string(cmd["payload"].([]byte))[3:]
+		nonce := clientFirst[strings.Index(clientFirst, ",r=")+3:]
+		serverFirst := "r=" + nonce + "server,s=" +
+			base64.StdEncoding.EncodeToString([]byte("salt")) + ",i=4096"
+		*scram = map[string]string{"first": clientFirst + "," + serverFirst,
+			"nonce": nonce + "server"}
+		return doc{{"conversationId", int32(1)}, {"payload", []byte(serverFirst)},
+			{"done", false}}
+	case cmd["saslContinue"] != nil:
+		final := string(cmd["payload"].([]byte))
+		i := strings.Index(final, ",p=")
+		if *scram == nil || i < 0 {
+			return failed
+		}
+		salted := pbkdf2.Key([]byte(s.password), []byte("salt"), 4096, 32, sha256.New)
+		authMessage := (*scram)["first"] + "," + final[:i]
+		clientKey := scramMac(salted, "Client Key")
+		storedKey := sha256.Sum256(clientKey)
+		proof := scramMac(storedKey[:], authMessage)
+		for j := range proof {
+			proof[j] ^= clientKey[j]
+		}
+		if final[i+3:] != base64.StdEncoding.EncodeToString(proof) {
+			return failed
+		}
+		s.authenticated++
+		signature := scramMac(scramMac(salted, "Server Key"), authMessage)
+		return doc{{"conversationId", int32(1)}, {"payload",
+			[]byte("v=" + base64.StdEncoding.EncodeToString(signature))}, {"done", true}}
+	case cmd["insert"] != nil:
+		if s.password != "" && s.authenticated == 0 {
+			return failed
+		}
+		insert := &mongoInsert{docs: seq}
+		insert.collection, _ = cmd["insert"].(string)
+		insert.ordered, _ = cmd["ordered"].(bool)
+		insert.writeConcern, _ = cmd["writeConcern"].(map[string]interface{})
+		if len(s.replies) > 0 {
+			reply := s.replies[0]
+			s.replies = s.replies[1:]
+			if reply[0].key != "ok" {
+				s.inserts = append(s.inserts, insert)
+			}
+			return reply
+		}
+		s.inserts = append(s.inserts, insert)
+		return doc{{"n", int32(len(seq))}}
+	}
+	return doc{{"ok", 0.0}, {"code", 59}, {"errmsg", "no such command"}}
+}
+
+func MongoDBOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A MongoDBOutput", func() {
+		server := newMongoServer()
+		defer server.listener.Close()
+
+		output := new(MongoDBOutput)
+		config := output.ConfigStruct().(*MongoDBOutputConfig)
+		config.Hosts = []string{server.listener.Addr().String()}
+		config.Database = "logs"
+		config.Collection = "%{Type}-%{%Y.%m}"
+		config.BatchSize = 3
+
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		var cursor string
+		or.EXPECT().UpdateCursor(gomock.Any()).Do(func(c string) {
+			cursor = c
+		}).AnyTimes()
+
+		newPack := func(typ, payload, queueCursor string) *PipelinePack {
+			pack := NewPipelinePack(nil)
+			pack.Message.SetUuid([]byte("0123456789abcdef"))
+			pack.Message.SetTimestamp(time.Date(2017, 7, 14, 2, 40, 0, 0,
+				time.UTC).UnixNano())
+			pack.Message.SetType(typ)
+			pack.Message.SetPayload(payload)
+			pack.Message.SetSeverity(6)
+			message.NewInt64Field(pack.Message, "status", 200, "")
+			pack.QueueCursor = queueCursor
+			return pack
+		}
+
+		c.Specify("inserts documents into the collection of their message", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("nginx", "one", "c1")), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("app", "two", "c2")), gs.IsNil)
+			c.Expect(len(server.received()), gs.Equals, 0)
+			c.Expect(output.ProcessMessage(newPack("nginx", "three", "c3")), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c3")
+
+			inserts := server.received()
+			c.Expect(len(inserts), gs.Equals, 2)
+			c.Expect(inserts[0].collection, gs.Equals, "nginx-2017.07")
+			c.Expect(inserts[0].ordered, gs.IsTrue)
+			c.Expect(inserts[0].writeConcern == nil, gs.IsTrue)
+			c.Expect(len(inserts[0].docs), gs.Equals, 2)
+			d := inserts[0].docs[0]
+			c.Expect(string(d["_id"].([]byte)), gs.Equals, "0123456789abcdef")
+			c.Expect(d["Payload"], gs.Equals, "one")
+			c.Expect(d["Severity"], gs.Equals, int32(6))
+			c.Expect(d["Timestamp"].(time.Time).Equal(time.Date(2017, 7, 14, 2, 40, 0, 0,
+				time.UTC)), gs.IsTrue)
+			c.Expect(d["Fields"].(map[string]interface{})["status"], gs.Equals, int64(200))
+			c.Expect(inserts[0].docs[1]["Payload"], gs.Equals, "three")
+			c.Expect(inserts[1].collection, gs.Equals, "app-2017.07")
+			c.Expect(output.docsInserted, gs.Equals, int64(3))
+			output.CleanUp()
+		})
+
+		c.Specify("sends the write concern", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			config.WriteConcern = "majority"
+			config.Journal = true
+			config.WtimeoutMs = 500
+			config.Ordered = false
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("nginx", "one", "c1")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+
+			inserts := server.received()
+			c.Expect(len(inserts), gs.Equals, 1)
+			c.Expect(inserts[0].ordered, gs.IsFalse)
+			wc := inserts[0].writeConcern
+			c.Expect(wc["w"], gs.Equals, "majority")
+			c.Expect(wc["j"], gs.Equals, true)
+			c.Expect(wc["wtimeout"], gs.Equals, int64(500))
+
+			config.WriteConcern = "2"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Expect(output.writeConcern[0].value, gs.Equals, int32(2))
+			output.CleanUp()
+		})
+
+		c.Specify("goes on after a document an ordered insert fails at", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			or.EXPECT().LogError(gomock.Any())
+			server.configure(func() {
+				server.replies = []doc{{{"n", int32(1)}, {"writeErrors", []interface{}{
+					doc{{"index", int32(1)}, {"code", int32(121)},
+						{"errmsg", "failed validation"}}}}}}
+			})
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			for _, cur := range []string{"c1", "c2", "c3"} {
+				c.Expect(output.ProcessMessage(newPack("nginx", cur, cur)), gs.IsNil)
+			}
+			c.Expect(cursor, gs.Equals, "c3")
+			inserts := server.received()
+			c.Expect(len(inserts), gs.Equals, 2)
+			c.Expect(len(inserts[1].docs), gs.Equals, 1)
+			c.Expect(inserts[1].docs[0]["Payload"], gs.Equals, "c3")
+			c.Expect(output.docsInserted, gs.Equals, int64(2))
+			c.Expect(output.docsDropped, gs.Equals, int64(1))
+			output.CleanUp()
+		})
+
+		c.Specify("counts duplicates as already inserted", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			server.configure(func() {
+				server.replies = []doc{{{"n", int32(0)}, {"writeErrors", []interface{}{
+					doc{{"index", int32(0)}, {"code", int32(duplicateKeyCode)},
+						{"errmsg", "duplicate key"}}}}}}
+			})
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("nginx", "one", "c1")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(output.duplicates, gs.Equals, int64(1))
+			c.Expect(output.docsDropped, gs.Equals, int64(0))
+			output.CleanUp()
+		})
+
+		c.Specify("inserts documents again after transient errors", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			or.EXPECT().LogError(gomock.Any()).Times(2)
+			server.configure(func() {
+				server.replies = []doc{
+					{{"ok", 0.0}, {"code", int32(10107)}, {"errmsg", "not primary"}},
+					{{"n", int32(1)}, {"writeConcernError", doc{{"code", int32(64)},
+						{"errmsg", "waiting for replication timed out"}}}},
+				}
+			})
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("nginx", "one", "c1")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "")
+			c.Expect(output.waiting, gs.Equals, int64(1))
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(len(server.received()), gs.Equals, 2)
+			c.Expect(output.writeFailures, gs.Equals, int64(2))
+			output.CleanUp()
+		})
+
+		c.Specify("drops documents a command fails for", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			or.EXPECT().LogError(gomock.Any())
+			server.configure(func() {
+				server.replies = []doc{{{"ok", 0.0}, {"code", int32(73)},
+					{"errmsg", "invalid namespace"}}}
+			})
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("nginx", "one", "c1")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(output.docsDropped, gs.Equals, int64(1))
+			output.CleanUp()
+		})
+
+		c.Specify("retries messages while it can't connect", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			or.EXPECT().LogError(gomock.Any())
+			server.listener.Close()
+			config.BatchSize = 1
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("nginx", "one", "c1")), gs.IsNil)
+			err := output.ProcessMessage(newPack("nginx", "two", "c2"))
+			_, ok := err.(RetryMessageError)
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(output.waiting, gs.Equals, int64(1))
+		})
+
+		c.Specify("writes to the primary", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			primary := newMongoServer()
+			defer primary.listener.Close()
+			server.configure(func() { server.primary = primary.listener.Addr().String() })
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("nginx", "one", "c1")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(len(server.received()), gs.Equals, 0)
+			c.Expect(len(primary.received()), gs.Equals, 1)
+			output.CleanUp()
+		})
+
+		c.Specify("authenticates with SCRAM-SHA-256", func() {
+			or.EXPECT().Encoder().Return(nil).AnyTimes()
+			server.configure(func() { server.password = "secret" })
+			config.Username = "heka"
+			config.Password = "secret"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("nginx", "one", "c1")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			output.CleanUp()
+
+			or.EXPECT().LogError(gomock.Any())
+			config.Password = "wrong"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("nginx", "two", "c2")), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+		})
+
+		c.Specify("inserts the encoder's output", func() {
+			encoder := new(plugins.PayloadEncoder)
+			encoder.Init(encoder.ConfigStruct())
+			or.EXPECT().Encoder().Return(encoder).AnyTimes()
+			or.EXPECT().Encode(gomock.Any()).Return(
+				[]byte(`{"status":404,"ratio":0.5,"req":{"path":"/"}}`), nil)
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("nginx", "one", "c1")), gs.IsNil)
+			output.CleanUp()
+
+			inserts := server.received()
+			c.Expect(len(inserts), gs.Equals, 1)
+			d := inserts[0].docs[0]
+			c.Expect(len(d), gs.Equals, 4)
+			c.Expect(string(d["_id"].([]byte)), gs.Equals, "0123456789abcdef")
+			c.Expect(d["status"], gs.Equals, int64(404))
+			c.Expect(d["ratio"], gs.Equals, 0.5)
+			c.Expect(d["req"].(map[string]interface{})["path"], gs.Equals, "/")
+		})
+
+		c.Specify("checks its settings", func() {
+			config.Database = "a.b"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.Database = "logs"
+			config.AuthMechanism = "PLAIN"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.AuthMechanism = "SCRAM-SHA-1"
+			config.BatchSize = 0
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("only allows SCRAM-SHA-256 in FIPS mode", func() {
+			SetFipsMode(true)
+			defer SetFipsMode(false)
+			config.AuthMechanism = "SCRAM-SHA-1"
+			err := output.Init(config)
+			c.Assume(err, gs.Not(gs.IsNil))
+			c.Expect(err.Error(), gs.Equals,
+				"auth_mechanism 'SCRAM-SHA-1' isn't allowed in FIPS mode")
+			config.AuthMechanism = "SCRAM-SHA-256"
+			c.Expect(output.Init(config), gs.IsNil)
+		})
+	})
+
+	c.Specify("BSON documents", func() {
+		c.Specify("decode as they were encoded", func() {
+			ts := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+			data, err := marshalDoc(doc{{"s", "x"}, {"i", int32(-1)}, {"l", int64(1) << 40},
+				{"f", 1.5}, {"b", true}, {"n", nil}, {"t", ts}, {"bin", []byte{1, 2}},
+				{"a", []interface{}{"y", int64(2)}},
+				{"m", map[string]interface{}{"k": "v"}}})
+			c.Assume(err, gs.IsNil)
+			m, err := unmarshalDoc(data)
+			c.Assume(err, gs.IsNil)
+			c.Expect(m["s"], gs.Equals, "x")
+			c.Expect(m["i"], gs.Equals, int32(-1))
+			c.Expect(m["l"], gs.Equals, int64(1)<<40)
+			c.Expect(m["f"], gs.Equals, 1.5)
+			c.Expect(m["b"], gs.Equals, true)
+			c.Expect(m["n"], gs.IsNil)
+			c.Expect(m["t"].(time.Time).Equal(ts), gs.IsTrue)
+			c.Expect(len(m["bin"].([]byte)), gs.Equals, 2)
+			c.Expect(m["a"].([]interface{})[1], gs.Equals, int64(2))
+			c.Expect(m["m"].(map[string]interface{})["k"], gs.Equals, "v")
+		})
+
+		c.Specify("don't have keys with null bytes", func() {
+			_, err := marshalDoc(doc{{"a\x00b", 1}})
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,331 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package mongodb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// OP_MSG, the opcode of every command since MongoDB 3.6.
+const opMsg = 2013
+
+// Limits servers report, and their defaults.
+const (
+	defaultMaxBsonSize    = 16 * 1024 * 1024
+	defaultMaxMessageSize = 48000000
+	defaultMaxWriteBatch  = 100000
+)
+
+// Codes of errors which are worth retrying, on the same or a new primary.
+var transientCodes = map[int64]bool{
+	6:     true, // HostUnreachable
+	7:     true, // HostNotFound
+	89:    true, // NetworkTimeout
+	91:    true, // ShutdownInProgress
+	189:   true, // PrimarySteppedDown
+	262:   true, // ExceededTimeLimit
+	9001:  true, // SocketException
+	10107: true, // NotWritablePrimary
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotPrimaryNoSecondaryOk
+	13436: true, // NotPrimaryOrSecondary
+	64:    true, // WriteConcernFailed
+}
+
+// A command's failure, or a write concern's.
+type commandError struct {
+	code     int64
+	codeName string
+	message  string
+	labels   []string
+}
+
+func (e *commandError) Error() string {
+	if e.codeName != "" {
+		return fmt.Sprintf("%s (%d): %s", e.codeName, e.code, e.message)
+	}
+	return fmt.Sprintf("error %d: %s", e.code, e.message)
+}
+
+// Whether the command may succeed if it's sent again.
+func (e *commandError) transient() bool {
+	for _, l := range e.labels {
+		if l == "RetryableWriteError" {
+			return true
+		}
+	}
+	return transientCodes[e.code]
+}
+
+func newCommandError(reply map[string]interface{}) *commandError {
+	e := &commandError{}
+	e.code, _ = docInt(reply["code"])
+	e.codeName, _ = reply["codeName"].(string)
+	e.message, _ = reply["errmsg"].(string)
+	labels, _ := reply["errorLabels"].([]interface{})
+	for _, l := range labels {
+		if s, ok := l.(string); ok {
+			e.labels = append(e.labels, s)
+		}
+	}
+	return e
+}
+
+// A connection to a mongod or mongos, running one command at a time.
+type mongoConn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	timeout   time.Duration
+	requestId int32
+
+	// From the server's hello.
+	writable       bool
+	primary        string
+	maxBsonSize    int
+	maxMessageSize int
+	maxWriteBatch  int
+}
+
+func dialMongo(address string, tlsConf *tls.Config, timeout time.Duration) (*mongoConn,
+	error) {
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: timeout}
+	if tlsConf != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConf)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &mongoConn{conn: conn, r: bufio.NewReader(conn), timeout: timeout}
+	if err = c.hello(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *mongoConn) Close() error {
+	return c.conn.Close()
+}
+
+// Asks the server what it is, with the legacy isMaster if it doesn't know
+// hello.
+func (c *mongoConn) hello() error {
+	reply, err := c.command(doc{{"hello", 1}, {"$db", "admin"}}, "", nil)
+	if e, ok := err.(*commandError); ok && e.code == 59 {
+		reply, err = c.command(doc{{"isMaster", 1}, {"$db", "admin"}}, "", nil)
+	}
+	if err != nil {
+		return err
+	}
+	c.writable, _ = reply["isWritablePrimary"].(bool)
+	if ismaster, ok := reply["ismaster"].(bool); ok {
+		c.writable = ismaster
+	}
+	if msg, _ := reply["msg"].(string); msg == "isdbgrid" {
+		c.writable = true
+	}
+	c.primary, _ = reply["primary"].(string)
+	limit := func(key string, def int) int {
+		if n, ok := docInt(reply[key]); ok && n > 0 {
+			return int(n)
+		}
+		return def
+	}
+	c.maxBsonSize = limit("maxBsonObjectSize", defaultMaxBsonSize)
+	c.maxMessageSize = limit("maxMessageSizeBytes", defaultMaxMessageSize)
+	c.maxWriteBatch = limit("maxWriteBatchSize", defaultMaxWriteBatch)
+	return nil
+}
+
+// Runs a command, with the documents of a sequence if seqId isn't empty, and
+// returns its reply, or a commandError if it failed.
+func (c *mongoConn) command(cmd doc, seqId string, seq [][]byte) (map[string]interface{},
+	error) {
+
+	body, err := marshalDoc(cmd)
+	if err != nil {
+		return nil, err
+	}
+	c.requestId++
+	msg := make([]byte, 16, 16+5+len(body))
+	binary.LittleEndian.PutUint32(msg[4:], uint32(c.requestId))
+	binary.LittleEndian.PutUint32(msg[12:], opMsg)
+	msg = append(appendInt32(msg, 0), 0)
+	msg = append(msg, body...)
+	if seqId != "" {
+		start := len(msg)
+		msg = append(append(msg, 1, 0, 0, 0, 0), seqId...)
+		msg = append(msg, 0)
+		for _, d := range seq {
+			msg = append(msg, d...)
+		}
+		binary.LittleEndian.PutUint32(msg[start+1:], uint32(len(msg)-start-1))
+	}
+	binary.LittleEndian.PutUint32(msg, uint32(len(msg)))
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err = c.conn.Write(msg); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 16)
+	if _, err = io.ReadFull(c.r, header); err != nil {
+		return nil, err
+	}
+	length := int(binary.LittleEndian.Uint32(header))
+	if length < 21 || length > 2*defaultMaxMessageSize {
+		return nil, fmt.Errorf("bad reply length %d", length)
+	}
+	reply := make([]byte, length-16)
+	if _, err = io.ReadFull(c.r, reply); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(header[12:]) != opMsg {
+		return nil, errors.New("unexpected reply opcode")
+	}
+	if int32(binary.LittleEndian.Uint32(header[8:])) != c.requestId {
+		return nil, errors.New("reply to another request")
+	}
+	flags := binary.LittleEndian.Uint32(reply)
+	if flags&1 != 0 {
+		// The checksum, which TCP and TLS already check.
+		reply = reply[:len(reply)-4]
+	}
+	if reply[4] != 0 {
+		return nil, errors.New("reply has no body")
+	}
+	result, _, err := readDoc(reply[5:], false)
+	if err != nil {
+		return nil, err
+	}
+	m := result.(map[string]interface{})
+	if ok, _ := docInt(m["ok"]); ok != 1 {
+		return nil, newCommandError(m)
+	}
+	return m, nil
+}
+
+// Escapes a SCRAM username.
+func saslName(s string) string {
+	return strings.Replace(strings.Replace(s, "=", "=3D", -1), ",", "=2C", -1)
+}
+
+// Authenticates with SCRAM-SHA-256 or SCRAM-SHA-1 (RFC 5802), verifying the
+// server's signature.
+func (c *mongoConn) authenticate(mechanism, source, username, password string) error {
+	var newHash func() hash.Hash
+	switch mechanism {
+	case "SCRAM-SHA-256":
+		newHash = sha256.New
+	case "SCRAM-SHA-1":
+		newHash = sha1.New
+		h := md5.Sum([]byte(username + ":mongo:" + password))
+		password = hex.EncodeToString(h[:])
+	default:
+		return fmt.Errorf("unsupported auth_mechanism '%s'", mechanism)
+	}
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	clientNonce := base64.StdEncoding.EncodeToString(nonce)
+	clientFirst := "n=" + saslName(username) + ",r=" + clientNonce
+	reply, err := c.command(doc{{"saslStart", 1}, {"mechanism", mechanism},
+		{"payload", []byte("n,," + clientFirst)}, {"autoAuthorize", 1},
+		{"options", doc{{"skipEmptyExchange", true}}}, {"$db", source}}, "", nil)
+	if err != nil {
+		return err
+	}
+	serverFirst, _ := reply["payload"].([]byte)
+	attrs := make(map[string]string)
+	for _, a := range strings.Split(string(serverFirst), ",") {
+		if len(a) > 2 && a[1] == '=' {
+			attrs[a[:1]] = a[2:]
+		}
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return errors.New("bad SCRAM salt")
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < 1 {
+		return errors.New("bad SCRAM iteration count")
+	}
+	if !strings.HasPrefix(attrs["r"], clientNonce) {
+		return errors.New("bad SCRAM nonce")
+	}
+
+	mac := func(key []byte, s string) []byte {
+		m := hmac.New(newHash, key)
+		m.Write([]byte(s))
+		return m.Sum(nil)
+	}
+	salted := pbkdf2.Key([]byte(password), salt, iterations, newHash().Size(), newHash)
+	clientKey := mac(salted, "Client Key")
+	h := newHash()
+	h.Write(clientKey)
+	storedKey := h.Sum(nil)
+	withoutProof := "c=biws,r=" + attrs["r"]
+	authMessage := clientFirst + "," + string(serverFirst) + "," + withoutProof
+	proof := mac(storedKey, authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	final := withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)
+	reply, err = c.command(doc{{"saslContinue", 1}, {"conversationId",
+		reply["conversationId"]}, {"payload", []byte(final)}, {"$db", source}}, "", nil)
+	if err != nil {
+		return err
+	}
+	serverFinal, _ := reply["payload"].([]byte)
+	signature := "v=" + base64.StdEncoding.EncodeToString(
+		mac(mac(salted, "Server Key"), authMessage))
+	if !bytes.Equal(serverFinal, []byte(signature)) {
+		return errors.New("server's SCRAM signature doesn't match")
+	}
+	for done, _ := reply["done"].(bool); !done; done, _ = reply["done"].(bool) {
+		if reply, err = c.command(doc{{"saslContinue", 1}, {"conversationId",
+			reply["conversationId"]}, {"payload", []byte{}}, {"$db", source}},
+			"", nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
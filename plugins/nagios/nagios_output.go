@@ -16,12 +16,17 @@
 package nagios
 
 import (
+	"bytes"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"heka/message"
@@ -31,19 +36,26 @@ import (
 )
 
 // NagiosOutput can be configured to use the http client to submit the passive
-// checks directly to the nagios cgi, or pipe them to the send_nsca program.
-// To use send_nsca, one needs to provide the send_nsca_bin, and optionally
-// send_nsca_args config entries. To use http, one needs to provide Url, and
-// optionally username, password, and response_header_timeout.
+// checks directly to the nagios cgi or the Icinga2 API, or pipe them to the
+// send_nsca program of NSCA or NSCA-ng. To use send_nsca, one needs to provide
+// the send_nsca_bin, and optionally send_nsca_args config entries. To use
+// http, one needs to provide Url, and optionally username, password, and
+// response_header_timeout.
 type NagiosOutputConfig struct {
 	// Must match Nagios service's service_description attribute; if not
 	// specified in the config explicitly, the name of the output is used.
+	// May contain %Field% templates filled in from the message.
 	NagiosServiceDescription string `toml:"nagios_service_description"`
 
 	// Must match the hostname of the server in nagios. If not specified in
-	// the config explicitly, use the Hostname attribute of the message
+	// the config explicitly, use the Hostname attribute of the message. May
+	// contain %Field% templates filled in from the message.
 	NagiosHost string `toml:"nagios_host"`
 
+	// How checks are submitted: "cgi", "icinga2", "nsca" or "nsca-ng". If not
+	// specified, "nsca" is used when send_nsca_bin is set, else "cgi".
+	Mode string `toml:"mode"`
+
 	// SendNSCA tells the plugin to pipe the commands into a send_nsca program
 	// rather than submitting each command using the go http client. The
 	// timeout is in seconds.
@@ -51,7 +63,7 @@ type NagiosOutputConfig struct {
 	SendNscaArgs           []string `toml:"send_nsca_args"`
 	SendNscaTimeoutSeconds uint     `toml:"send_nsca_timeout"`
 
-	// URL to the Nagios cmd.cgi
+	// URL to the Nagios cmd.cgi, or the base URL of the Icinga2 API
 	Url string
 	// Nagios username
 	Username string
@@ -65,100 +77,214 @@ type NagiosOutputConfig struct {
 	UseTls bool `toml:"use_tls"`
 	// Subsection for TLS configuration.
 	Tls tcp.TlsConfig
+
+	// Number of checks submitted together, and the seconds between
+	// submitting those waiting.
+	BatchSize      uint `toml:"batch_size"`
+	TickerInterval uint `toml:"ticker_interval"`
 }
 
 func (n *NagiosOutput) ConfigStruct() interface{} {
 	return &NagiosOutputConfig{
-		Url: "http://localhost/cgi-bin/cmd.cgi",
+		Url:                    "http://localhost/cgi-bin/cmd.cgi",
 		ResponseHeaderTimeout:  2,
 		SendNscaTimeoutSeconds: 5,
+		BatchSize:              1,
+		TickerInterval:         1,
 	}
 }
 
+// A passive service check result.
+type nagiosCheck struct {
+	host               string
+	serviceDescription string
+	state              int
+	output             string
+	timestamp          time.Time
+}
+
 type NagiosOutput struct {
-	conf      *NagiosOutputConfig
-	client    *http.Client
-	submitter func(host, service_description, state, output string) (err error)
+	conf   *NagiosOutputConfig
+	or     OutputRunner
+	client *http.Client
+	// Submits checks, returning how many were submitted or dropped before
+	// any error.
+	submitter func(checks []nagiosCheck) (int, error)
+
+	// The checks waiting to be submitted, and the cursor of the last one's
+	// message.
+	checks []nagiosCheck
+	cursor string
+
+	// Accessed atomically, for the reports.
+	checksSubmitted int64
+	submitFailures  int64
+	checksRefused   int64
 }
 
 func (n *NagiosOutput) Init(config interface{}) (err error) {
 	n.conf = config.(*NagiosOutputConfig)
+	if n.conf.BatchSize == 0 {
+		return errors.New("batch_size must be greater than 0")
+	}
+	if n.conf.Mode == "" {
+		n.conf.Mode = "cgi"
+		if n.conf.SendNscaBin != "" {
+			n.conf.Mode = "nsca"
+		}
+	}
 
-	n.submitter = n.submitSendNsca
-	if n.conf.SendNscaBin == "" {
-		// HTTP is implied.
+	switch n.conf.Mode {
+	case "nsca", "nsca-ng":
+		if n.conf.SendNscaBin == "" {
+			return fmt.Errorf("%s mode needs send_nsca_bin", n.conf.Mode)
+		}
+		n.submitter = n.submitSendNsca
+		return
+	case "cgi":
 		n.submitter = n.submitHttp
+	case "icinga2":
+		n.submitter = n.submitIcinga
+	default:
+		return fmt.Errorf("unknown mode '%s'", n.conf.Mode)
+	}
 
-		rht := time.Duration(n.conf.ResponseHeaderTimeout) * time.Second
-		transport := &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			ResponseHeaderTimeout: rht,
-		}
-		if n.conf.UseTls {
-			var tlsConf *tls.Config
-			if tlsConf, err = tcp.CreateGoTlsConfig(&n.conf.Tls); err != nil {
-				return fmt.Errorf("TLS init error: %s", err)
-			}
-			transport.TLSClientConfig = tlsConf
-		}
-		n.client = &http.Client{
-			Transport: transport,
+	rht := time.Duration(n.conf.ResponseHeaderTimeout) * time.Second
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: rht,
+	}
+	if n.conf.UseTls {
+		var tlsConf *tls.Config
+		if tlsConf, err = tcp.CreateGoTlsConfig(&n.conf.Tls); err != nil {
+			return fmt.Errorf("TLS init error: %s", err)
 		}
+		transport.TLSClientConfig = tlsConf
+	}
+	n.client = &http.Client{
+		Transport: transport,
 	}
 	return
 }
 
-func (n *NagiosOutput) Run(or OutputRunner, h PluginHelper) (err error) {
-	inChan := or.InChan()
-
-	var (
-		pack    *PipelinePack
-		msg     *message.Message
-		payload string
-	)
+func (n *NagiosOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	n.or = or
+	return nil
+}
 
-	for pack = range inChan {
-		msg = pack.Message
-		payload = msg.GetPayload()
-		pos := strings.IndexAny(payload, ":")
-		state := "3" // UNKNOWN
-		if pos != -1 {
-			switch payload[:pos] {
-			case "OK":
-				state = "0"
-			case "WARNING":
-				state = "1"
-			case "CRITICAL":
-				state = "2"
-			}
+// Returns the template substitutions of a message: its headers, and its
+// fields' first values.
+func substitutions(msg *message.Message) map[string]string {
+	subs := map[string]string{
+		"Type":     msg.GetType(),
+		"Logger":   msg.GetLogger(),
+		"Hostname": msg.GetHostname(),
+	}
+	for _, f := range msg.Fields {
+		if v := f.GetValue(); v != nil {
+			subs[f.GetName()] = fmt.Sprint(v)
 		}
+	}
+	return subs
+}
 
-		host := n.conf.NagiosHost
-		if host == "" {
-			host = msg.GetHostname()
-		}
-		service_description := n.conf.NagiosServiceDescription
-		if service_description == "" {
-			service_description = msg.GetLogger()
+// Returns the check result of a message, whose payload is a state followed
+// by a colon and the plugin output.
+func (n *NagiosOutput) check(msg *message.Message) nagiosCheck {
+	payload := msg.GetPayload()
+	pos := strings.IndexAny(payload, ":")
+	state := 3 // UNKNOWN
+	if pos != -1 {
+		switch payload[:pos] {
+		case "OK":
+			state = 0
+		case "WARNING":
+			state = 1
+		case "CRITICAL":
+			state = 2
 		}
-		payload = payload[pos+1:]
+	}
 
-		err = n.submitter(host, service_description, state, payload)
-		if err != nil {
-			err = NewRetryMessageError(err.Error())
-			pack.Recycle(err)
-			continue
+	var subs map[string]string
+	host := n.conf.NagiosHost
+	if host == "" {
+		host = msg.GetHostname()
+	} else if strings.Contains(host, "%") {
+		subs = substitutions(msg)
+		host = InterpolateString(host, subs)
+	}
+	service_description := n.conf.NagiosServiceDescription
+	if service_description == "" {
+		service_description = msg.GetLogger()
+	} else if strings.Contains(service_description, "%") {
+		if subs == nil {
+			subs = substitutions(msg)
 		}
-		or.UpdateCursor(pack.QueueCursor)
-		pack.Recycle(nil)
+		service_description = InterpolateString(service_description, subs)
 	}
-	return
+	return nagiosCheck{
+		host:               host,
+		serviceDescription: service_description,
+		state:              state,
+		output:             payload[pos+1:],
+		timestamp:          time.Unix(0, msg.GetTimestamp()),
+	}
+}
+
+func (n *NagiosOutput) ProcessMessage(pack *PipelinePack) error {
+	n.checks = append(n.checks, n.check(pack.Message))
+	if uint(len(n.checks)) < n.conf.BatchSize {
+		n.cursor = pack.QueueCursor
+		return nil
+	}
+	if err := n.submit(); err != nil {
+		// The message is retried, with the checks before it still waiting.
+		n.checks = n.checks[:len(n.checks)-1]
+		return NewRetryMessageError("%s", err)
+	}
+	n.or.UpdateCursor(pack.QueueCursor)
+	return nil
 }
 
-func (n *NagiosOutput) submitSendNsca(host, service_description, state,
-	output string) (err error) {
+// Submits the checks waiting, keeping those not submitted if it fails.
+func (n *NagiosOutput) submit() error {
+	done, err := n.submitter(n.checks)
+	atomic.AddInt64(&n.checksSubmitted, int64(done))
+	n.checks = n.checks[:copy(n.checks, n.checks[done:])]
+	if err != nil {
+		atomic.AddInt64(&n.submitFailures, 1)
+	}
+	return err
+}
 
-	c := process.NewManagedCmd(n.conf.SendNscaBin, n.conf.SendNscaArgs,
+func (n *NagiosOutput) TimerEvent() error {
+	if len(n.checks) == 0 {
+		return nil
+	}
+	if err := n.submit(); err != nil {
+		n.or.LogError(fmt.Errorf("can't submit %d checks: %s", len(n.checks), err))
+		return nil
+	}
+	n.or.UpdateCursor(n.cursor)
+	return nil
+}
+
+func (n *NagiosOutput) CleanUp() {
+	if len(n.checks) > 0 {
+		if err := n.submit(); err != nil {
+			n.or.LogError(fmt.Errorf("%d checks not submitted: %s", len(n.checks), err))
+		}
+	}
+}
+
+func (n *NagiosOutput) submitSendNsca(checks []nagiosCheck) (done int, err error) {
+	args := n.conf.SendNscaArgs
+	if n.conf.Mode == "nsca-ng" {
+		// NSCA-ng's client takes external commands, which carry the
+		// check's time.
+		args = append(append([]string(nil), args...), "-C")
+	}
+	c := process.NewManagedCmd(n.conf.SendNscaBin, args,
 		time.Duration(n.conf.SendNscaTimeoutSeconds)*time.Second)
 
 	var cmdin io.WriteCloser
@@ -171,47 +297,134 @@ func (n *NagiosOutput) submitSendNsca(host, service_description, state,
 		return
 	}
 
-	if _, err = fmt.Fprintf(cmdin, "%s\t%s\t%v\t%s\n", host, service_description,
-		state, output); err != nil {
-		return
+	for _, check := range checks {
+		if n.conf.Mode == "nsca-ng" {
+			_, err = fmt.Fprintf(cmdin, "[%d] PROCESS_SERVICE_CHECK_RESULT;%s;%s;%d;%s\n",
+				check.timestamp.Unix(), check.host, check.serviceDescription, check.state,
+				strings.Replace(check.output, "\n", "\\n", -1))
+		} else {
+			_, err = fmt.Fprintf(cmdin, "%s\t%s\t%v\t%s\n", check.host,
+				check.serviceDescription, check.state, check.output)
+		}
+		if err != nil {
+			return
+		}
 	}
 
 	// close the input pipe to terminate send_nsca
 	cmdin.Close()
 
-	err = c.Wait()
-	return
+	if err = c.Wait(); err != nil {
+		return
+	}
+	return len(checks), nil
 }
 
-func (n *NagiosOutput) submitHttp(host, service_description, state,
-	output string) (err error) {
+func (n *NagiosOutput) submitHttp(checks []nagiosCheck) (done int, err error) {
+	for _, check := range checks {
+		data := url.Values{
+			"cmd_typ":          {"30"}, // PROCESS_SERVICE_CHECK_RESULT
+			"cmd_mod":          {"2"},  // CMDMODE_COMMIT
+			"host":             {check.host},
+			"service":          {check.serviceDescription},
+			"plugin_state":     {fmt.Sprint(check.state)},
+			"plugin_output":    {check.output},
+			"performance_data": {""},
+		}
 
-	data := url.Values{
-		"cmd_typ":          {"30"}, // PROCESS_SERVICE_CHECK_RESULT
-		"cmd_mod":          {"2"},  // CMDMODE_COMMIT
-		"host":             {host},
-		"service":          {service_description},
-		"plugin_state":     {state},
-		"plugin_output":    {output},
-		"performance_data": {""},
-	}
+		var (
+			req  *http.Request
+			resp *http.Response
+		)
+		req, err = http.NewRequest("POST", n.conf.Url, strings.NewReader(data.Encode()))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	var (
-		req  *http.Request
-		resp *http.Response
-	)
-	req, err = http.NewRequest("POST", n.conf.Url, strings.NewReader(data.Encode()))
-	if err != nil {
-		return
+		req.SetBasicAuth(n.conf.Username, n.conf.Password)
+		if resp, err = n.client.Do(req); err != nil {
+			return
+		}
+		if err = resp.Body.Close(); err != nil {
+			return
+		}
+		done++
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return
+}
 
-	req.SetBasicAuth(n.conf.Username, n.conf.Password)
-	if resp, err = n.client.Do(req); err != nil {
-		return
+// Submits checks with the Icinga2 API's process-check-result action. Checks
+// for services Icinga2 doesn't know are logged and dropped, since submitting
+// them again won't help.
+func (n *NagiosOutput) submitIcinga(checks []nagiosCheck) (done int, err error) {
+	endpoint := strings.TrimSuffix(n.conf.Url, "/") + "/v1/actions/process-check-result"
+	for _, check := range checks {
+		output, perfData := check.output, []string{}
+		if i := strings.Index(output, "|"); i >= 0 {
+			perfData = strings.Fields(output[i+1:])
+			output = strings.TrimSpace(output[:i])
+		}
+		body, _ := json.Marshal(map[string]interface{}{
+			"type":   "Service",
+			"filter": "host.name==h && service.name==s",
+			"filter_vars": map[string]string{
+				"h": check.host,
+				"s": check.serviceDescription,
+			},
+			"exit_status":      check.state,
+			"plugin_output":    output,
+			"performance_data": perfData,
+			"execution_end":    check.timestamp.Unix(),
+		})
+		req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+		if err != nil {
+			return done, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth(n.conf.Username, n.conf.Password)
+		resp, err := n.client.Do(req)
+		if err != nil {
+			return done, err
+		}
+		text, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		var result struct {
+			Results []struct {
+				Code   float64 `json:"code"`
+				Status string  `json:"status"`
+			} `json:"results"`
+		}
+		json.Unmarshal(text, &result)
+		switch {
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusUnauthorized ||
+			resp.StatusCode == http.StatusForbidden:
+
+			// Icinga2 or its credentials may be fixed, unlike the check.
+			return done, fmt.Errorf("Icinga2 API returned %s: %s", resp.Status,
+				bytes.TrimSpace(text))
+		case resp.StatusCode >= 300 || len(result.Results) == 0 ||
+			result.Results[0].Code >= 300:
+
+			atomic.AddInt64(&n.checksRefused, 1)
+			n.or.LogError(fmt.Errorf("Icinga2 refused check of %s!%s: %s %s",
+				check.host, check.serviceDescription, resp.Status, bytes.TrimSpace(text)))
+		}
+		done++
 	}
-	err = resp.Body.Close()
-	return
+	return done, nil
+}
+
+func (n *NagiosOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "ChecksSubmitted",
+		atomic.LoadInt64(&n.checksSubmitted), "count")
+	message.NewInt64Field(msg, "SubmitFailures", atomic.LoadInt64(&n.submitFailures),
+		"count")
+	message.NewInt64Field(msg, "ChecksRefused", atomic.LoadInt64(&n.checksRefused),
+		"count")
+	message.NewInt64Field(msg, "Waiting", int64(len(n.checks)), "count")
+	return nil
 }
 
 func init() {
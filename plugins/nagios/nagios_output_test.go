@@ -16,21 +16,25 @@ package nagios
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
 	"heka/pipeline"
 	pipeline_ts "heka/pipeline/testsupport"
 	"heka/pipelinemock"
-	"github.com/rafrombrc/gomock/gomock"
-	gs "github.com/rafrombrc/gospec/src/gospec"
 )
 
 func TestAllSpecs(t *testing.T) {
@@ -60,22 +64,26 @@ func NagiosOutputSpec(c gs.Context) {
 
 		mockOutputRunner := pipelinemock.NewMockOutputRunner(ctrl)
 		mockHelper := pipelinemock.NewMockPluginHelper(ctrl)
+		var cursor string
+		mockOutputRunner.EXPECT().UpdateCursor(gomock.Any()).Do(func(c string) {
+			cursor = c
+		}).AnyTimes()
 
-		inChan := make(chan *pipeline.PipelinePack)
-		recycleChan := make(chan *pipeline.PipelinePack, 1)
-
-		pack := pipeline.NewPipelinePack(recycleChan)
+		pack := pipeline.NewPipelinePack(nil)
 		msg := pipeline_ts.GetTestMessage()
 		pack.Message = msg
+		pack.QueueCursor = "c1"
 
 		var req *http.Request
-		var outputWg, reqWg sync.WaitGroup
+		var reqWg sync.WaitGroup
 
-		run := func() {
-			mockOutputRunner.EXPECT().InChan().Return(inChan)
-			mockOutputRunner.EXPECT().UpdateCursor("").AnyTimes()
-			output.Run(mockOutputRunner, mockHelper)
-			outputWg.Done()
+		run := func() error {
+			if err := output.Prepare(mockOutputRunner, mockHelper); err != nil {
+				return err
+			}
+			err := output.ProcessMessage(pack)
+			output.CleanUp()
+			return err
 		}
 
 		const payload = "something"
@@ -99,36 +107,189 @@ func NagiosOutputSpec(c gs.Context) {
 			c.Specify("sends a valid HTTP POST", func() {
 				err = output.Init(config)
 				c.Assume(err, gs.IsNil)
-				outputWg.Add(1)
-				go run()
 
 				msg.SetPayload("OK:" + payload)
 				reqWg.Add(1)
-				inChan <- pack
-				close(inChan)
-				outputWg.Wait()
+				c.Expect(run(), gs.IsNil)
 				reqWg.Wait()
 
 				c.Expect(req.FormValue("plugin_output"), gs.Equals, payload)
 				c.Expect(req.FormValue("plugin_state"), gs.Equals, "0")
+				c.Expect(cursor, gs.Equals, "c1")
 			})
 
 			c.Specify("correctly maps alternate state", func() {
 				err = output.Init(config)
 				c.Assume(err, gs.IsNil)
-				outputWg.Add(1)
-				go run()
 
 				msg.SetPayload("CRITICAL:" + payload)
 				reqWg.Add(1)
-				inChan <- pack
-				close(inChan)
-				outputWg.Wait()
+				c.Expect(run(), gs.IsNil)
 				reqWg.Wait()
 
 				c.Expect(req.FormValue("plugin_output"), gs.Equals, payload)
 				c.Expect(req.FormValue("plugin_state"), gs.Equals, "2")
 			})
+
+			c.Specify("fills in host and service templates", func() {
+				config.NagiosHost = "%Hostname%.example.com"
+				config.NagiosServiceDescription = "%Logger% %foo%"
+				err = output.Init(config)
+				c.Assume(err, gs.IsNil)
+
+				msg.SetPayload("OK:" + payload)
+				reqWg.Add(1)
+				c.Expect(run(), gs.IsNil)
+				reqWg.Wait()
+
+				c.Expect(req.FormValue("host"), gs.Equals, "my.host.name.example.com")
+				c.Expect(req.FormValue("service"), gs.Equals, "GoSpec bar")
+			})
+		})
+
+		c.Specify("using the Icinga2 API", func() {
+			var lock sync.Mutex
+			var bodies []map[string]interface{}
+			var path, user string
+			status := http.StatusOK
+			result := `{"results":[{"code":200.0,"status":"Successfully processed"}]}`
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+				r *http.Request) {
+
+				lock.Lock()
+				defer lock.Unlock()
+				path = r.URL.Path
+				user, _, _ = r.BasicAuth()
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				bodies = append(bodies, body)
+				w.WriteHeader(status)
+				fmt.Fprint(w, result)
+			}))
+			defer server.Close()
+			config.Mode = "icinga2"
+			config.Url = server.URL + "/"
+			config.Username = "heka"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(mockOutputRunner, mockHelper), gs.IsNil)
+
+			c.Specify("submits check results", func() {
+				msg.SetPayload("WARNING:disk 91% full | used=91%;90;95 free=9%")
+				c.Expect(output.ProcessMessage(pack), gs.IsNil)
+				c.Expect(cursor, gs.Equals, "c1")
+
+				lock.Lock()
+				defer lock.Unlock()
+				c.Expect(path, gs.Equals, "/v1/actions/process-check-result")
+				c.Expect(user, gs.Equals, "heka")
+				c.Expect(len(bodies), gs.Equals, 1)
+				body := bodies[0]
+				c.Expect(body["type"], gs.Equals, "Service")
+				vars := body["filter_vars"].(map[string]interface{})
+				c.Expect(vars["h"], gs.Equals, "my.host.name")
+				c.Expect(vars["s"], gs.Equals, "GoSpec")
+				c.Expect(body["exit_status"], gs.Equals, float64(1))
+				c.Expect(body["plugin_output"], gs.Equals, "disk 91% full")
+				perfData := body["performance_data"].([]interface{})
+				c.Expect(len(perfData), gs.Equals, 2)
+				c.Expect(perfData[1], gs.Equals, "free=9%")
+			})
+
+			c.Specify("retries checks while the API fails", func() {
+				lock.Lock()
+				status = http.StatusServiceUnavailable
+				lock.Unlock()
+				err := output.ProcessMessage(pack)
+				_, ok := err.(pipeline.RetryMessageError)
+				c.Expect(ok, gs.IsTrue)
+				c.Expect(cursor, gs.Equals, "")
+				c.Expect(len(output.checks), gs.Equals, 0)
+			})
+
+			c.Specify("drops checks for unknown services", func() {
+				mockOutputRunner.EXPECT().LogError(gomock.Any())
+				lock.Lock()
+				status = http.StatusNotFound
+				result = `{"error":404.0,"status":"No objects found."}`
+				lock.Unlock()
+				c.Expect(output.ProcessMessage(pack), gs.IsNil)
+				c.Expect(cursor, gs.Equals, "c1")
+				c.Expect(output.checksRefused, gs.Equals, int64(1))
+			})
+		})
+
+		c.Specify("batching checks", func() {
+			var lock sync.Mutex
+			var requests int
+			status := http.StatusOK
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+				r *http.Request) {
+
+				lock.Lock()
+				defer lock.Unlock()
+				requests++
+				w.WriteHeader(status)
+				fmt.Fprint(w, `{"results":[{"code":200.0}]}`)
+			}))
+			defer server.Close()
+			config.Mode = "icinga2"
+			config.Url = server.URL
+			config.BatchSize = 3
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(mockOutputRunner, mockHelper), gs.IsNil)
+			sent := func() int {
+				lock.Lock()
+				defer lock.Unlock()
+				return requests
+			}
+
+			c.Specify("submits them when the batch is full", func() {
+				for i := 0; i < 2; i++ {
+					pack.QueueCursor = fmt.Sprintf("c%d", i)
+					c.Expect(output.ProcessMessage(pack), gs.IsNil)
+				}
+				c.Expect(sent(), gs.Equals, 0)
+				c.Expect(cursor, gs.Equals, "")
+				pack.QueueCursor = "c2"
+				c.Expect(output.ProcessMessage(pack), gs.IsNil)
+				c.Expect(sent(), gs.Equals, 3)
+				c.Expect(cursor, gs.Equals, "c2")
+			})
+
+			c.Specify("submits them on ticks", func() {
+				c.Expect(output.ProcessMessage(pack), gs.IsNil)
+				c.Expect(output.TimerEvent(), gs.IsNil)
+				c.Expect(sent(), gs.Equals, 1)
+				c.Expect(cursor, gs.Equals, "c1")
+			})
+
+			c.Specify("keeps them while submitting fails", func() {
+				mockOutputRunner.EXPECT().LogError(gomock.Any())
+				lock.Lock()
+				status = http.StatusBadGateway
+				lock.Unlock()
+				c.Expect(output.ProcessMessage(pack), gs.IsNil)
+				c.Expect(output.TimerEvent(), gs.IsNil)
+				c.Expect(len(output.checks), gs.Equals, 1)
+				c.Expect(cursor, gs.Equals, "")
+
+				lock.Lock()
+				status = http.StatusOK
+				lock.Unlock()
+				c.Expect(output.TimerEvent(), gs.IsNil)
+				c.Expect(len(output.checks), gs.Equals, 0)
+				c.Expect(cursor, gs.Equals, "c1")
+			})
+		})
+
+		c.Specify("checks its settings", func() {
+			config.Mode = "nrpe"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.Mode = "nsca-ng"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.Mode = ""
+			config.BatchSize = 0
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
 		})
 
 		if runtime.GOOS != "windows" {
@@ -144,43 +305,61 @@ func NagiosOutputSpec(c gs.Context) {
 				}()
 				config.SendNscaBin = binPath
 				config.SendNscaArgs = []string{"arg1", "arg2"}
-				err := output.Init(config)
-				c.Assume(err, gs.IsNil)
-				outputWg.Add(1)
-				go run()
+				readLines := func() []string {
+					outFile, err := os.Open(outPath)
+					c.Assume(err, gs.IsNil)
+					defer outFile.Close()
+					var lines []string
+					scanner := bufio.NewScanner(outFile)
+					for scanner.Scan() {
+						lines = append(lines, scanner.Text())
+					}
+					return lines
+				}
 
 				c.Specify("sends args and the right data through", func() {
+					c.Assume(output.Init(config), gs.IsNil)
 					msg.SetPayload("OK:" + payload)
-					inChan <- pack
-					close(inChan)
-					outputWg.Wait()
+					c.Expect(run(), gs.IsNil)
 
-					outFile, err := os.Open(outPath)
-					c.Expect(err, gs.IsNil)
-					reader := bufio.NewReader(outFile)
-					line, _, err := reader.ReadLine()
-					c.Expect(err, gs.IsNil)
-					c.Expect(string(line), gs.Equals, strings.Join(config.SendNscaArgs, " "))
-					line, _, err = reader.ReadLine()
-					c.Expect(err, gs.IsNil)
-					c.Expect(string(line), gs.Equals, "my.host.name GoSpec 0 "+payload)
+					lines := readLines()
+					c.Expect(len(lines), gs.Equals, 2)
+					c.Expect(lines[0], gs.Equals, strings.Join(config.SendNscaArgs, " "))
+					c.Expect(lines[1], gs.Equals, "my.host.name GoSpec 0 "+payload)
 				})
 
 				c.Specify("correctly maps alternate state", func() {
+					c.Assume(output.Init(config), gs.IsNil)
 					msg.SetPayload("WARNING:" + payload)
-					inChan <- pack
-					close(inChan)
-					outputWg.Wait()
+					c.Expect(run(), gs.IsNil)
 
-					outFile, err := os.Open(outPath)
-					c.Expect(err, gs.IsNil)
-					reader := bufio.NewReader(outFile)
-					line, _, err := reader.ReadLine()
-					c.Expect(err, gs.IsNil)
-					c.Expect(string(line), gs.Equals, strings.Join(config.SendNscaArgs, " "))
-					line, _, err = reader.ReadLine()
-					c.Expect(err, gs.IsNil)
-					c.Expect(string(line), gs.Equals, "my.host.name GoSpec 1 "+payload)
+					lines := readLines()
+					c.Expect(len(lines), gs.Equals, 2)
+					c.Expect(lines[0], gs.Equals, strings.Join(config.SendNscaArgs, " "))
+					c.Expect(lines[1], gs.Equals, "my.host.name GoSpec 1 "+payload)
+				})
+
+				c.Specify("sends NSCA-ng external commands in batches", func() {
+					config.Mode = "nsca-ng"
+					config.BatchSize = 2
+					c.Assume(output.Init(config), gs.IsNil)
+					c.Assume(output.Prepare(mockOutputRunner, mockHelper), gs.IsNil)
+					msg.SetTimestamp(time.Unix(1500000000, 0).UnixNano())
+					msg.SetPayload("CRITICAL:" + payload)
+					c.Expect(output.ProcessMessage(pack), gs.IsNil)
+					message.NewStringField(msg, "service", "disk")
+					msg.SetPayload("OK:fine")
+					config.NagiosServiceDescription = "%service%"
+					c.Expect(output.ProcessMessage(pack), gs.IsNil)
+					c.Expect(cursor, gs.Equals, "c1")
+
+					lines := readLines()
+					c.Expect(len(lines), gs.Equals, 3)
+					c.Expect(lines[0], gs.Equals, "arg1 arg2")
+					c.Expect(lines[1], gs.Equals,
+						"[1500000000] PROCESS_SERVICE_CHECK_RESULT;my.host.name;GoSpec;2;"+payload)
+					c.Expect(lines[2], gs.Equals,
+						"[1500000000] PROCESS_SERVICE_CHECK_RESULT;my.host.name;disk;0;fine")
 				})
 			})
 		}
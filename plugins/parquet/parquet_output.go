@@ -0,0 +1,617 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package parquet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pborman/uuid"
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type ParquetColumnConfig struct {
+	// Column name.
+	Name string `toml:"name"`
+	// Header name, or field name wrapped in "Fields[]", the column's values
+	// come from. Defaults to the header of the column's name if there is one,
+	// otherwise to the field of that name.
+	Source string `toml:"source"`
+	// "string", "bytes", "int64", "double", "boolean" or "timestamp".
+	// Defaults to the header's type, or for fields to "string".
+	Type string `toml:"type"`
+}
+
+type ParquetOutputConfig struct {
+	// The files' columns. Defaults to the Timestamp, Type, Logger, Severity,
+	// Hostname and Payload headers.
+	Columns []ParquetColumnConfig `toml:"columns"`
+	// Message attributes the files are partitioned by, one directory level
+	// each: "date" or "hour" of the message's timestamp, or a header name, or
+	// field name wrapped in "Fields[]". "week" (ISO 8601, e.g. "2015-W23")
+	// and "month" partition by time too.
+	PartitionBy []string `toml:"partition_by"`
+	// Time zone of the time partitions, e.g. "America/New_York" or "Local".
+	// Defaults to UTC.
+	PartitionTimezone string `toml:"partition_timezone"`
+	// "none", "snappy", "gzip" or "zstd". Defaults to "snappy".
+	Compression string `toml:"compression"`
+	// "file" or "s3". Defaults to "file".
+	Destination string `toml:"destination"`
+	// For "file", the directory the files are written under, relative to
+	// base_dir if it isn't absolute. Defaults to "parquet".
+	Path string `toml:"path"`
+	// For "s3", the bucket, and the prefix of the objects' keys.
+	Bucket string `toml:"bucket"`
+	Prefix string `toml:"prefix"`
+	// For "s3", the endpoint URL, region and credentials, with the same
+	// defaults as the s3 checkpoint backend.
+	Endpoint        string `toml:"endpoint"`
+	Region          string `toml:"region"`
+	AccessKeyId     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+	// Number of buffered rows that triggers writing the files. Defaults to
+	// 100000.
+	FlushCount uint `toml:"flush_count"`
+	// Size of the buffered rows, in bytes, that triggers writing the files.
+	// Defaults to 64MiB.
+	FlushBytes uint `toml:"flush_bytes"`
+	// Seconds between writes of whatever rows are buffered. Defaults to 300.
+	TickerInterval uint `toml:"ticker_interval"`
+}
+
+// Hive's name for a partition whose value is missing.
+const defaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// Types of the headers usable as column sources.
+var headerTypes = map[string]string{
+	"Timestamp":  "timestamp",
+	"Type":       "string",
+	"Logger":     "string",
+	"Severity":   "int64",
+	"Payload":    "string",
+	"EnvVersion": "string",
+	"Pid":        "int64",
+	"Hostname":   "string",
+	"Uuid":       "string",
+}
+
+// A column's source and type.
+type columnSpec struct {
+	name  string
+	typ   string
+	field string
+	// Returns the header's value, for header sources.
+	header func(msg *message.Message) interface{}
+}
+
+func newColumnSpec(conf ParquetColumnConfig) (*columnSpec, error) {
+	if conf.Name == "" {
+		return nil, errors.New("columns need a name")
+	}
+	spec := &columnSpec{name: conf.Name, typ: conf.Type}
+	source := conf.Source
+	if source == "" {
+		source = conf.Name
+		if _, ok := headerTypes[source]; !ok {
+			source = "Fields[" + source + "]"
+		}
+	}
+	if l := len(source); l > 8 && strings.HasPrefix(source, "Fields[") &&
+		source[l-1] == ']' {
+
+		spec.field = source[7 : l-1]
+		if spec.typ == "" {
+			spec.typ = "string"
+		}
+	} else {
+		typ, ok := headerTypes[source]
+		if !ok {
+			return nil, fmt.Errorf("column '%s': unknown source '%s'", conf.Name, source)
+		}
+		if spec.typ == "" {
+			spec.typ = typ
+		}
+		spec.header = headerValue(source)
+	}
+	switch spec.typ {
+	case "string", "bytes", "int64", "double", "boolean", "timestamp":
+	default:
+		return nil, fmt.Errorf("column '%s': unknown type '%s'", conf.Name, spec.typ)
+	}
+	return spec, nil
+}
+
+func headerValue(name string) func(msg *message.Message) interface{} {
+	switch name {
+	case "Timestamp":
+		return func(msg *message.Message) interface{} {
+			return time.Unix(0, msg.GetTimestamp()).UTC()
+		}
+	case "Type":
+		return func(msg *message.Message) interface{} { return msg.GetType() }
+	case "Logger":
+		return func(msg *message.Message) interface{} { return msg.GetLogger() }
+	case "Severity":
+		return func(msg *message.Message) interface{} { return int64(msg.GetSeverity()) }
+	case "Payload":
+		return func(msg *message.Message) interface{} { return msg.GetPayload() }
+	case "EnvVersion":
+		return func(msg *message.Message) interface{} { return msg.GetEnvVersion() }
+	case "Pid":
+		return func(msg *message.Message) interface{} { return int64(msg.GetPid()) }
+	case "Hostname":
+		return func(msg *message.Message) interface{} { return msg.GetHostname() }
+	}
+	return func(msg *message.Message) interface{} {
+		if msg.GetUuid() == nil {
+			return nil
+		}
+		return msg.GetUuidString()
+	}
+}
+
+// Returns a new, empty column for the spec.
+func (spec *columnSpec) column() *column {
+	switch spec.typ {
+	case "string":
+		return newColumn(spec.name, typeByteArray, convertedUTF8)
+	case "bytes":
+		return newColumn(spec.name, typeByteArray, noConvertedType)
+	case "int64":
+		return newColumn(spec.name, typeInt64, noConvertedType)
+	case "double":
+		return newColumn(spec.name, typeDouble, noConvertedType)
+	case "boolean":
+		return newColumn(spec.name, typeBoolean, noConvertedType)
+	}
+	return newColumn(spec.name, typeInt64, convertedTimestampMicros)
+}
+
+// Returns the message's value for the column, or nil if it has none.
+func (spec *columnSpec) value(msg *message.Message) interface{} {
+	if spec.header != nil {
+		return spec.header(msg)
+	}
+	if spec.typ == "timestamp" {
+		t, err := msg.GetTimestampField(spec.field)
+		if err != nil {
+			return nil
+		}
+		return t
+	}
+	v, ok := msg.GetFieldValue(spec.field)
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+// Appends the message's value to the column, converted to the column's type,
+// or a null if it has none or it can't be converted.
+func (spec *columnSpec) append(col *column, msg *message.Message) {
+	switch v := spec.value(msg).(type) {
+	case nil:
+		col.appendNull()
+	case string:
+		switch spec.typ {
+		case "string", "bytes":
+			col.appendByteArray([]byte(v))
+		case "int64":
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				col.appendInt64(i)
+			} else {
+				col.appendNull()
+			}
+		case "double":
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				col.appendDouble(f)
+			} else {
+				col.appendNull()
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(v); err == nil {
+				col.appendBoolean(b)
+			} else {
+				col.appendNull()
+			}
+		default:
+			col.appendNull()
+		}
+	case []byte:
+		switch spec.typ {
+		case "string", "bytes":
+			col.appendByteArray(v)
+		default:
+			col.appendNull()
+		}
+	case int64:
+		switch spec.typ {
+		case "string":
+			col.appendByteArray([]byte(strconv.FormatInt(v, 10)))
+		case "int64":
+			col.appendInt64(v)
+		case "double":
+			col.appendDouble(float64(v))
+		default:
+			col.appendNull()
+		}
+	case float64:
+		switch spec.typ {
+		case "string":
+			col.appendByteArray([]byte(strconv.FormatFloat(v, 'g', -1, 64)))
+		case "double":
+			col.appendDouble(v)
+		default:
+			col.appendNull()
+		}
+	case bool:
+		switch spec.typ {
+		case "string":
+			col.appendByteArray([]byte(strconv.FormatBool(v)))
+		case "boolean":
+			col.appendBoolean(v)
+		default:
+			col.appendNull()
+		}
+	case time.Time:
+		switch spec.typ {
+		case "string":
+			col.appendByteArray([]byte(v.Format(time.RFC3339Nano)))
+		case "int64":
+			col.appendInt64(v.UnixNano())
+		case "timestamp":
+			col.appendInt64(v.UnixNano() / int64(time.Microsecond))
+		default:
+			col.appendNull()
+		}
+	default:
+		col.appendNull()
+	}
+}
+
+// Returns the directory name of a message's partition, Hive style.
+type partitioner func(msg *message.Message) string
+
+// The time partition keys, and the formats of their values.
+var timePartitionFormats = map[string]string{
+	"date":  "%Y-%m-%d",
+	"hour":  "%H",
+	"week":  "%G-W%V",
+	"month": "%Y-%m",
+}
+
+func newPartitioner(key, timezone string) (partitioner, error) {
+	if format, ok := timePartitionFormats[key]; ok {
+		tp, err := NewTimePartitioner(format, timezone)
+		if err != nil {
+			return nil, err
+		}
+		name := key + "="
+		return func(msg *message.Message) string {
+			return name + tp.Partition(msg)
+		}, nil
+	}
+	value, err := MessageKey(key)
+	if err != nil {
+		return nil, err
+	}
+	name := key
+	if strings.HasPrefix(key, "Fields[") {
+		name = key[7 : len(key)-1]
+	}
+	name = escapePartition(strings.ToLower(name)) + "="
+	return func(msg *message.Message) string {
+		if v, ok := value(msg); ok && v != "" {
+			return name + escapePartition(v)
+		}
+		return name + defaultPartition
+	}, nil
+}
+
+// Escapes the characters Hive escapes in partition names and values.
+func escapePartition(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c == 0x7f || strings.IndexByte("\"#%'*/:=?\\{[]^", c) >= 0 {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// The rows buffered for one partition.
+type partition struct {
+	dir  string
+	cols []*column
+	rows int
+}
+
+func (p *partition) size() (size int) {
+	for _, col := range p.cols {
+		size += col.size()
+	}
+	return size
+}
+
+// Where the files are written.
+type parquetStore interface {
+	store(name string, data []byte) error
+}
+
+type fileStore struct {
+	dir string
+}
+
+// Writes the file under a temporary name first, so that query engines never
+// see part of one, hidden files being ignored.
+func (f *fileStore) store(name string, data []byte) error {
+	dest := filepath.Join(f.dir, filepath.FromSlash(name))
+	dir, base := filepath.Split(dest)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "."+base+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+type s3Store struct {
+	client *S3Client
+	prefix string
+}
+
+func (s *s3Store) store(name string, data []byte) error {
+	header := make(http.Header)
+	header.Set("Content-Type", "application/octet-stream")
+	return s.client.PutObject(s.prefix+name, data, header)
+}
+
+// Output plugin that buffers the messages it matches as rows of Parquet files,
+// written to local disk or an S3 bucket in Hive style partitions, so that the
+// logs can be queried directly with Spark, Trino, DuckDB and the like.
+type ParquetOutput struct {
+	conf         *ParquetOutputConfig
+	or           OutputRunner
+	specs        []*columnSpec
+	partitioners []partitioner
+	compressor   *pageCompressor
+	store        parquetStore
+	createdBy    string
+	parts        map[string]*partition
+	// Cursor of the last buffered message.
+	cursor string
+	// Accessed atomically, for the reports.
+	bufferedRows  int64
+	bufferedBytes int64
+	filesWritten  int64
+	rowsWritten   int64
+	writeFailures int64
+}
+
+func (o *ParquetOutput) ConfigStruct() interface{} {
+	return &ParquetOutputConfig{
+		Compression:    "snappy",
+		Destination:    "file",
+		Path:           "parquet",
+		FlushCount:     100000,
+		FlushBytes:     64 * 1024 * 1024,
+		TickerInterval: 300,
+	}
+}
+
+func (o *ParquetOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*ParquetOutputConfig)
+	columns := o.conf.Columns
+	if len(columns) == 0 {
+		for _, name := range []string{"Timestamp", "Type", "Logger", "Severity",
+			"Hostname", "Payload"} {
+			columns = append(columns, ParquetColumnConfig{Name: name})
+		}
+	}
+	names := make(map[string]bool)
+	o.specs = make([]*columnSpec, len(columns))
+	for i, conf := range columns {
+		if names[conf.Name] {
+			return fmt.Errorf("duplicate column '%s'", conf.Name)
+		}
+		names[conf.Name] = true
+		if o.specs[i], err = newColumnSpec(conf); err != nil {
+			return err
+		}
+	}
+	o.partitioners = make([]partitioner, len(o.conf.PartitionBy))
+	for i, key := range o.conf.PartitionBy {
+		if o.partitioners[i], err = newPartitioner(key, o.conf.PartitionTimezone); err != nil {
+			return fmt.Errorf("can't partition by '%s': %s", key, err)
+		}
+	}
+	if o.compressor, err = newPageCompressor(o.conf.Compression); err != nil {
+		return err
+	}
+
+	switch o.conf.Destination {
+	case "file":
+		if o.conf.Path == "" {
+			return errors.New("path must be set")
+		}
+	case "s3":
+		if o.conf.Bucket == "" {
+			return errors.New("bucket must be set")
+		}
+		client := NewS3Client(o.conf.Endpoint, o.conf.Bucket, o.conf.Region,
+			o.conf.AccessKeyId, o.conf.SecretAccessKey)
+		o.store = &s3Store{client: client, prefix: o.conf.Prefix}
+	default:
+		return fmt.Errorf("destination must be 'file' or 's3', got '%s'",
+			o.conf.Destination)
+	}
+	if o.conf.FlushCount == 0 {
+		return errors.New("flush_count must be greater than 0")
+	}
+	if o.conf.TickerInterval == 0 {
+		return errors.New("ticker_interval must be greater than 0")
+	}
+	o.parts = make(map[string]*partition)
+	return nil
+}
+
+func (o *ParquetOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	o.or = or
+	globals := h.PipelineConfig().Globals
+	if o.store == nil {
+		o.store = &fileStore{dir: globals.PrependBaseDir(o.conf.Path)}
+	}
+	o.createdBy = "heka version " + globals.Version
+	return nil
+}
+
+// Tells if the buffered rows should be written.
+func (o *ParquetOutput) full() bool {
+	return atomic.LoadInt64(&o.bufferedRows) >= int64(o.conf.FlushCount) ||
+		atomic.LoadInt64(&o.bufferedBytes) >= int64(o.conf.FlushBytes)
+}
+
+// Buffers the message as a row of its partition.
+func (o *ParquetOutput) add(msg *message.Message) {
+	dirs := make([]string, len(o.partitioners))
+	for i, p := range o.partitioners {
+		dirs[i] = p(msg)
+	}
+	dir := path.Join(dirs...)
+	part, ok := o.parts[dir]
+	if !ok {
+		part = &partition{dir: dir, cols: make([]*column, len(o.specs))}
+		for i, spec := range o.specs {
+			part.cols[i] = spec.column()
+		}
+		o.parts[dir] = part
+	}
+	size := part.size()
+	for i, spec := range o.specs {
+		spec.append(part.cols[i], msg)
+	}
+	part.rows++
+	atomic.AddInt64(&o.bufferedRows, 1)
+	atomic.AddInt64(&o.bufferedBytes, int64(part.size()-size))
+}
+
+// Writes a file for each partition with buffered rows. Partitions whose file
+// couldn't be written stay buffered, for the next attempt, and the cursor
+// isn't advanced until they are all written.
+func (o *ParquetOutput) flush() error {
+	dirs := make([]string, 0, len(o.parts))
+	for dir := range o.parts {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		part := o.parts[dir]
+		buf := new(bytes.Buffer)
+		err := writeParquet(buf, part.cols, o.compressor, o.createdBy)
+		if err == nil {
+			name := fmt.Sprintf("part-%s-%s.parquet",
+				time.Now().UTC().Format("20060102T150405Z"), uuid.NewRandom())
+			err = o.store.store(path.Join(dir, name), buf.Bytes())
+		}
+		if err != nil {
+			atomic.AddInt64(&o.writeFailures, 1)
+			return fmt.Errorf("can't write parquet file for partition '%s': %s", dir, err)
+		}
+		delete(o.parts, dir)
+		atomic.AddInt64(&o.filesWritten, 1)
+		atomic.AddInt64(&o.rowsWritten, int64(part.rows))
+		atomic.AddInt64(&o.bufferedRows, -int64(part.rows))
+		atomic.AddInt64(&o.bufferedBytes, -int64(part.size()))
+	}
+	o.or.UpdateCursor(o.cursor)
+	return nil
+}
+
+func (o *ParquetOutput) ProcessMessage(pack *PipelinePack) error {
+	if o.full() {
+		// The last write failed, don't buffer any more until it succeeds.
+		if err := o.flush(); err != nil {
+			return NewRetryMessageError("%s", err)
+		}
+	}
+	o.add(pack.Message)
+	o.cursor = pack.QueueCursor
+	if o.full() {
+		if err := o.flush(); err != nil {
+			o.or.LogError(err)
+		}
+	}
+	return nil
+}
+
+func (o *ParquetOutput) TimerEvent() error {
+	if len(o.parts) == 0 {
+		return nil
+	}
+	if err := o.flush(); err != nil {
+		o.or.LogError(err)
+	}
+	return nil
+}
+
+func (o *ParquetOutput) CleanUp() {
+	if len(o.parts) == 0 {
+		return
+	}
+	if err := o.flush(); err != nil {
+		o.or.LogError(fmt.Errorf("can't write the buffered rows: %s", err))
+	}
+}
+
+// Satisfies the `pipeline.ReportingPlugin` interface to provide plugin state
+// information to the Heka report and dashboard.
+func (o *ParquetOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "BufferedRows",
+		atomic.LoadInt64(&o.bufferedRows), "count")
+	message.NewInt64Field(msg, "BufferedBytes",
+		atomic.LoadInt64(&o.bufferedBytes), "B")
+	message.NewInt64Field(msg, "FilesWritten",
+		atomic.LoadInt64(&o.filesWritten), "count")
+	message.NewInt64Field(msg, "RowsWritten",
+		atomic.LoadInt64(&o.rowsWritten), "count")
+	message.NewInt64Field(msg, "WriteFailures",
+		atomic.LoadInt64(&o.writeFailures), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("ParquetOutput", func() interface{} {
+		return new(ParquetOutput)
+	})
+}
@@ -0,0 +1,228 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package parquet
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+type failingStore struct{}
+
+func (failingStore) store(name string, data []byte) error {
+	return errors.New("disk full")
+}
+
+func ParquetOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A ParquetOutput", func() {
+		tmpDir, err := ioutil.TempDir("", "parquet-tests")
+		c.Assume(err, gs.IsNil)
+		defer os.RemoveAll(tmpDir)
+
+		output := new(ParquetOutput)
+		config := output.ConfigStruct().(*ParquetOutputConfig)
+		config.Columns = []ParquetColumnConfig{
+			{Name: "Timestamp"},
+			{Name: "Logger"},
+			{Name: "status", Type: "int64"},
+			{Name: "took", Source: "Fields[duration]", Type: "double"},
+		}
+		config.PartitionBy = []string{"date", "Logger"}
+		config.FlushCount = 3
+		pConfig := NewPipelineConfig(nil)
+		pConfig.Globals.BaseDir = tmpDir
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		h.EXPECT().PipelineConfig().Return(pConfig).AnyTimes()
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		or.EXPECT().LogError(gomock.Any()).AnyTimes()
+
+		ts := time.Date(2015, 6, 1, 12, 30, 0, 0, time.UTC)
+		send := func(logger string, status interface{}, cursor string) error {
+			pack := NewPipelinePack(pConfig.InputRecycleChan())
+			pack.Message.SetTimestamp(ts.UnixNano())
+			pack.Message.SetLogger(logger)
+			if status != nil {
+				f, _ := message.NewField("status", status, "")
+				pack.Message.AddField(f)
+			}
+			message.NewInt64Field(pack.Message, "duration", 250, "ms")
+			pack.QueueCursor = cursor
+			return output.ProcessMessage(pack)
+		}
+
+		// Returns the decoded files under dir.
+		files := func(dir string) []*readFile {
+			paths, _ := filepath.Glob(filepath.Join(tmpDir, "parquet", dir, "*.parquet"))
+			var read []*readFile
+			for _, path := range paths {
+				data, err := ioutil.ReadFile(path)
+				c.Assume(err, gs.IsNil)
+				read = append(read, readParquet(c, data))
+			}
+			return read
+		}
+
+		c.Specify("writes partitioned files once flush_count rows are buffered", func() {
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(send("web", "200", "1"), gs.IsNil)
+			c.Expect(send("db", int64(500), "2"), gs.IsNil)
+			c.Expect(len(files("date=2015-06-01/logger=web")), gs.Equals, 0)
+
+			or.EXPECT().UpdateCursor("3")
+			c.Expect(send("web", nil, "3"), gs.IsNil)
+			web := files("date=2015-06-01/logger=web")
+			c.Assume(len(web), gs.Equals, 1)
+			c.Expect(web[0].meta[3], gs.Equals, int64(2))
+			c.Expect(web[0].columns["Logger"][0], gs.Equals, "web")
+			c.Expect(web[0].columns["status"][0], gs.Equals, int64(200))
+			c.Expect(web[0].columns["status"][1], gs.IsNil)
+			c.Expect(web[0].columns["took"][1], gs.Equals, 250.0)
+			c.Expect(web[0].columns["Timestamp"][0], gs.Equals,
+				ts.UnixNano()/int64(time.Microsecond))
+			db := files("date=2015-06-01/logger=db")
+			c.Assume(len(db), gs.Equals, 1)
+			c.Expect(db[0].columns["status"][0], gs.Equals, int64(500))
+
+			hidden, _ := filepath.Glob(filepath.Join(tmpDir, "parquet", "*", "*", ".*"))
+			c.Expect(len(hidden), gs.Equals, 0)
+		})
+
+		c.Specify("writes what's buffered on its ticker", func() {
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(send("web", "200", "1"), gs.IsNil)
+			or.EXPECT().UpdateCursor("1")
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(len(files("date=2015-06-01/logger=web")), gs.Equals, 1)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(len(files("date=2015-06-01/logger=web")), gs.Equals, 1)
+		})
+
+		c.Specify("partitions by time in the configured time zone", func() {
+			config.PartitionBy = []string{"week", "date", "hour"}
+			config.PartitionTimezone = "Asia/Tokyo"
+			config.FlushCount = 1
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			or.EXPECT().UpdateCursor("1")
+			c.Expect(send("web", "200", "1"), gs.IsNil)
+			c.Expect(len(files("week=2015-W23/date=2015-06-01/hour=21")), gs.Equals, 1)
+		})
+
+		c.Specify("escapes partition values", func() {
+			config.PartitionBy = []string{"Fields[path]", "Hostname"}
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			pack := NewPipelinePack(pConfig.InputRecycleChan())
+			message.NewStringField(pack.Message, "path", "/a=b")
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			or.EXPECT().UpdateCursor("")
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(len(files("path=%2Fa%3Db/hostname=__HIVE_DEFAULT_PARTITION__")),
+				gs.Equals, 1)
+		})
+
+		c.Specify("stops buffering while it can't write", func() {
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			output.store = failingStore{}
+			for i := 0; i < 3; i++ {
+				c.Expect(send("web", "200", ""), gs.IsNil)
+			}
+			err := send("web", "200", "")
+			_, retry := err.(RetryMessageError)
+			c.Expect(retry, gs.IsTrue)
+			c.Expect(output.bufferedRows, gs.Equals, int64(3))
+			c.Expect(output.writeFailures, gs.Equals, int64(2))
+		})
+
+		c.Specify("uploads to s3", func() {
+			var keys []string
+			server := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == "PUT" {
+						keys = append(keys, r.URL.Path)
+					}
+				}))
+			defer server.Close()
+			config.Destination = "s3"
+			config.Endpoint = server.URL
+			config.Bucket = "logs"
+			config.Prefix = "heka/"
+			config.AccessKeyId = "key"
+			config.SecretAccessKey = "secret"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			or.EXPECT().UpdateCursor("3")
+			for i := 0; i < 3; i++ {
+				c.Expect(send("web", "200", "3"), gs.IsNil)
+			}
+			c.Assume(len(keys), gs.Equals, 1)
+			c.Expect(strings.HasPrefix(keys[0],
+				"/logs/heka/date=2015-06-01/logger=web/part-"), gs.IsTrue)
+			c.Expect(strings.HasSuffix(keys[0], ".parquet"), gs.IsTrue)
+		})
+
+		c.Specify("rejects", func() {
+			c.Specify("an unknown column type", func() {
+				config.Columns[2].Type = "decimal"
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("an unknown column source", func() {
+				config.Columns[2].Source = "Status"
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("duplicate columns", func() {
+				config.Columns[2].Name = "Logger"
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("an unknown partition key", func() {
+				config.PartitionBy = []string{"Status"}
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("an unknown partition time zone", func() {
+				config.PartitionTimezone = "Mars/Olympus_Mons"
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("s3 without a bucket", func() {
+				config.Destination = "s3"
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+		})
+	})
+}
@@ -0,0 +1,403 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Writes Parquet files with one row group of flat, optional columns, each
+// stored as a single PLAIN encoded data page. That's all that's needed for
+// files of log records, and keeps the writer small; query engines don't
+// mind, though they can't skip pages using statistics.
+
+const parquetMagic = "PAR1"
+
+// Parquet physical types.
+const (
+	typeBoolean   int32 = 0
+	typeInt64     int32 = 2
+	typeDouble    int32 = 5
+	typeByteArray int32 = 6
+)
+
+// Parquet converted types, or noConvertedType for none.
+const (
+	noConvertedType          int32 = -1
+	convertedUTF8            int32 = 0
+	convertedTimestampMicros int32 = 10
+)
+
+// Parquet encodings.
+const (
+	encodingPlain int32 = 0
+	encodingRLE   int32 = 3
+)
+
+// Parquet compression codecs.
+const (
+	codecUncompressed int32 = 0
+	codecSnappy       int32 = 1
+	codecGzip         int32 = 2
+	codecZstd         int32 = 6
+)
+
+const repetitionOptional int32 = 1
+
+// Thrift compact protocol field types.
+const (
+	thriftStop   byte = 0
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// Writes the thrift compact protocol encoding of the Parquet metadata
+// structs.
+type thriftWriter struct {
+	buf bytes.Buffer
+	// Id of the last field written in the current struct, and of those in
+	// the structs it's nested in.
+	last  int16
+	outer []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(zigzag(int64(id)))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
+
+// Starts a list field of n elements of the given type.
+func (t *thriftWriter) list(id int16, n int, elem byte) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		t.buf.WriteByte(0xf0 | elem)
+		t.varint(uint64(n))
+	}
+}
+
+// Starts a struct, the value of the field with the given id, or with an id
+// of zero, an element of a list.
+func (t *thriftWriter) begin(id int16) {
+	if id != 0 {
+		t.field(id, thriftStruct)
+	}
+	t.outer = append(t.outer, t.last)
+	t.last = 0
+}
+
+// Ends the current struct.
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(thriftStop)
+	if n := len(t.outer); n > 0 {
+		t.last = t.outer[n-1]
+		t.outer = t.outer[:n-1]
+	}
+}
+
+// One column's values, buffered until the file is written.
+type column struct {
+	name      string
+	ptype     int32
+	converted int32
+	// PLAIN encoded values, except booleans, which are bit packed when the
+	// page is written.
+	values bytes.Buffer
+	bools  []bool
+	// Whether each row has a value.
+	defined []bool
+}
+
+func newColumn(name string, ptype, converted int32) *column {
+	return &column{name: name, ptype: ptype, converted: converted}
+}
+
+func (c *column) appendNull() {
+	c.defined = append(c.defined, false)
+}
+
+func (c *column) appendInt64(v int64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(v))
+	c.values.Write(b[:])
+	c.defined = append(c.defined, true)
+}
+
+func (c *column) appendDouble(v float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	c.values.Write(b[:])
+	c.defined = append(c.defined, true)
+}
+
+func (c *column) appendBoolean(v bool) {
+	c.bools = append(c.bools, v)
+	c.defined = append(c.defined, true)
+}
+
+func (c *column) appendByteArray(v []byte) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(len(v)))
+	c.values.Write(b[:])
+	c.values.Write(v)
+	c.defined = append(c.defined, true)
+}
+
+// Returns about how many bytes the column's page will take.
+func (c *column) size() int {
+	return c.values.Len() + (len(c.bools)+len(c.defined))/8
+}
+
+// Returns the uncompressed content of the column's data page: the
+// definition levels, RLE encoded with a bit width of 1, then the values.
+func (c *column) page() []byte {
+	var levels thriftWriter
+	for i := 0; i < len(c.defined); {
+		run := 1
+		for i+run < len(c.defined) && c.defined[i+run] == c.defined[i] {
+			run++
+		}
+		levels.varint(uint64(run) << 1)
+		if c.defined[i] {
+			levels.buf.WriteByte(1)
+		} else {
+			levels.buf.WriteByte(0)
+		}
+		i += run
+	}
+
+	page := new(bytes.Buffer)
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(levels.buf.Len()))
+	page.Write(b[:])
+	page.Write(levels.buf.Bytes())
+	if c.ptype == typeBoolean {
+		packed := make([]byte, (len(c.bools)+7)/8)
+		for i, v := range c.bools {
+			if v {
+				packed[i/8] |= 1 << uint(i%8)
+			}
+		}
+		page.Write(packed)
+	} else {
+		page.Write(c.values.Bytes())
+	}
+	return page.Bytes()
+}
+
+// Compresses data pages with one Parquet codec.
+type pageCompressor struct {
+	codec int32
+	zstd  *zstd.Encoder
+}
+
+// Creates a compressor for "none", "snappy", "gzip" or "zstd".
+func newPageCompressor(name string) (*pageCompressor, error) {
+	switch name {
+	case "none":
+		return &pageCompressor{codec: codecUncompressed}, nil
+	case "snappy":
+		return &pageCompressor{codec: codecSnappy}, nil
+	case "gzip":
+		return &pageCompressor{codec: codecGzip}, nil
+	case "zstd":
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return &pageCompressor{codec: codecZstd, zstd: enc}, nil
+	}
+	return nil, fmt.Errorf("compression must be 'none', 'snappy', 'gzip' or 'zstd', got '%s'",
+		name)
+}
+
+func (p *pageCompressor) compress(data []byte) ([]byte, error) {
+	switch p.codec {
+	case codecSnappy:
+		// Parquet uses snappy's block format, not the framed one.
+		return snappy.Encode(nil, data), nil
+	case codecGzip:
+		buf := new(bytes.Buffer)
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case codecZstd:
+		return p.zstd.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
+
+// Metadata of a column chunk that's been written.
+type chunkMeta struct {
+	col              *column
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+// Writes a Parquet file holding the columns' values, which must all have
+// the same number of rows.
+func writeParquet(w io.Writer, cols []*column, comp *pageCompressor,
+	createdBy string) error {
+
+	var rows int
+	if len(cols) > 0 {
+		rows = len(cols[0].defined)
+	}
+	if _, err := io.WriteString(w, parquetMagic); err != nil {
+		return err
+	}
+	offset := int64(len(parquetMagic))
+	chunks := make([]chunkMeta, len(cols))
+	var totalSize int64
+
+	for i, col := range cols {
+		page := col.page()
+		compressed, err := comp.compress(page)
+		if err != nil {
+			return fmt.Errorf("compressing column '%s': %s", col.name, err)
+		}
+		var header thriftWriter
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(compressed)))
+		header.begin(5)
+		header.i32(1, int32(rows))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.end()
+		header.end()
+
+		if _, err = w.Write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if _, err = w.Write(compressed); err != nil {
+			return err
+		}
+		chunks[i] = chunkMeta{
+			col:              col,
+			offset:           offset,
+			uncompressedSize: int64(header.buf.Len() + len(page)),
+			compressedSize:   int64(header.buf.Len() + len(compressed)),
+		}
+		offset += chunks[i].compressedSize
+		totalSize += chunks[i].uncompressedSize
+	}
+
+	var meta thriftWriter
+	meta.i32(1, 1)
+	meta.list(2, len(cols)+1, thriftStruct)
+	meta.begin(0)
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(cols)))
+	meta.end()
+	for _, col := range cols {
+		meta.begin(0)
+		meta.i32(1, col.ptype)
+		meta.i32(3, repetitionOptional)
+		meta.binary(4, col.name)
+		if col.converted != noConvertedType {
+			meta.i32(6, col.converted)
+		}
+		meta.end()
+	}
+	meta.i64(3, int64(rows))
+	meta.list(4, 1, thriftStruct)
+	meta.begin(0)
+	meta.list(1, len(chunks), thriftStruct)
+	for _, chunk := range chunks {
+		meta.begin(0)
+		meta.i64(2, chunk.offset)
+		meta.begin(3)
+		meta.i32(1, chunk.col.ptype)
+		meta.list(2, 2, thriftI32)
+		meta.varint(zigzag(int64(encodingPlain)))
+		meta.varint(zigzag(int64(encodingRLE)))
+		meta.list(3, 1, thriftBinary)
+		meta.varint(uint64(len(chunk.col.name)))
+		meta.buf.WriteString(chunk.col.name)
+		meta.i32(4, comp.codec)
+		meta.i64(5, int64(rows))
+		meta.i64(6, chunk.uncompressedSize)
+		meta.i64(7, chunk.compressedSize)
+		meta.i64(9, chunk.offset)
+		meta.end()
+		meta.end()
+	}
+	meta.i64(2, totalSize)
+	meta.i64(3, int64(rows))
+	meta.end()
+	meta.binary(6, createdBy)
+	meta.end()
+
+	if _, err := w.Write(meta.buf.Bytes()); err != nil {
+		return err
+	}
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(meta.buf.Len()))
+	if _, err := w.Write(b[:]); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, parquetMagic)
+	return err
+}
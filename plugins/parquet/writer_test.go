@@ -0,0 +1,240 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+
+	"github.com/golang/snappy"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+// Decodes thrift compact protocol structs into maps of field ids to values,
+// which are int64s, []bytes, lists or structs.
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (t *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(t.data[t.pos:])
+	t.pos += n
+	return v
+}
+
+func (t *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case thriftI32, thriftI64:
+		v := t.uvarint()
+		return int64(v>>1) ^ -int64(v&1)
+	case thriftBinary:
+		n := int(t.uvarint())
+		t.pos += n
+		return t.data[t.pos-n : t.pos]
+	case thriftList:
+		head := t.data[t.pos]
+		t.pos++
+		n := int(head >> 4)
+		if n == 15 {
+			n = int(t.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = t.value(head & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return t.readStruct()
+	}
+	panic("unsupported thrift type")
+}
+
+func (t *thriftReader) readStruct() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		head := t.data[t.pos]
+		t.pos++
+		if head == thriftStop {
+			return fields
+		}
+		if delta := int16(head >> 4); delta != 0 {
+			last += delta
+		} else {
+			v := t.uvarint()
+			last = int16(int64(v>>1) ^ -int64(v&1))
+		}
+		fields[last] = t.value(head & 0x0f)
+	}
+}
+
+// A decoded Parquet file.
+type readFile struct {
+	meta    map[int16]interface{}
+	columns map[string][]interface{}
+}
+
+func readParquet(c gs.Context, data []byte) *readFile {
+	c.Assume(string(data[:4]), gs.Equals, parquetMagic)
+	c.Assume(string(data[len(data)-4:]), gs.Equals, parquetMagic)
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{data: data[len(data)-8-footerLen : len(data)-8]}
+	f := &readFile{meta: footer.readStruct(), columns: make(map[string][]interface{})}
+	c.Assume(footer.pos, gs.Equals, footerLen)
+
+	schema := f.meta[2].([]interface{})
+	rowGroup := f.meta[4].([]interface{})[0].(map[int16]interface{})
+	for i, chunk := range rowGroup[1].([]interface{}) {
+		meta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+		name := string(meta[3].([]interface{})[0].([]byte))
+		c.Assume(name, gs.Equals,
+			string(schema[i+1].(map[int16]interface{})[4].([]byte)))
+		pageReader := &thriftReader{data: data, pos: int(meta[9].(int64))}
+		header := pageReader.readStruct()
+		page := data[pageReader.pos : pageReader.pos+int(header[3].(int64))]
+		var err error
+		switch meta[4].(int64) {
+		case int64(codecSnappy):
+			page, err = snappy.Decode(nil, page)
+		case int64(codecGzip):
+			var r *gzip.Reader
+			if r, err = gzip.NewReader(bytes.NewReader(page)); err == nil {
+				page, err = ioutil.ReadAll(r)
+			}
+		}
+		c.Assume(err, gs.IsNil)
+		c.Assume(len(page), gs.Equals, int(header[2].(int64)))
+		rows := int(header[5].(map[int16]interface{})[1].(int64))
+		f.columns[name] = readPage(page, meta[1].(int64), rows)
+	}
+	return f
+}
+
+// Decodes a data page's values, with nils for nulls.
+func readPage(page []byte, ptype int64, rows int) []interface{} {
+	levelsLen := int(binary.LittleEndian.Uint32(page))
+	levels := &thriftReader{data: page[4 : 4+levelsLen]}
+	var defined []bool
+	for levels.pos < len(levels.data) {
+		run := int(levels.uvarint() >> 1)
+		value := levels.data[levels.pos] == 1
+		levels.pos++
+		for i := 0; i < run; i++ {
+			defined = append(defined, value)
+		}
+	}
+	values := page[4+levelsLen:]
+	decoded := make([]interface{}, rows)
+	var bit int
+	for i := 0; i < rows; i++ {
+		if !defined[i] {
+			continue
+		}
+		switch int32(ptype) {
+		case typeBoolean:
+			decoded[i] = values[bit/8]&(1<<uint(bit%8)) != 0
+			bit++
+		case typeInt64:
+			decoded[i] = int64(binary.LittleEndian.Uint64(values))
+			values = values[8:]
+		case typeDouble:
+			decoded[i] = math.Float64frombits(binary.LittleEndian.Uint64(values))
+			values = values[8:]
+		case typeByteArray:
+			n := int(binary.LittleEndian.Uint32(values))
+			decoded[i] = string(values[4 : 4+n])
+			values = values[4+n:]
+		}
+	}
+	return decoded
+}
+
+func WriterSpec(c gs.Context) {
+	c.Specify("A Parquet file", func() {
+		name := newColumn("name", typeByteArray, convertedUTF8)
+		count := newColumn("count", typeInt64, noConvertedType)
+		ratio := newColumn("ratio", typeDouble, noConvertedType)
+		ok := newColumn("ok", typeBoolean, noConvertedType)
+		cols := []*column{name, count, ratio, ok}
+		for i := 0; i < 20; i++ {
+			name.appendByteArray([]byte{'a' + byte(i)})
+			if i%3 == 0 {
+				count.appendNull()
+			} else {
+				count.appendInt64(int64(i))
+			}
+			ratio.appendDouble(float64(i) / 4)
+			ok.appendBoolean(i%2 == 0)
+		}
+
+		check := func(compression string) {
+			comp, err := newPageCompressor(compression)
+			c.Assume(err, gs.IsNil)
+			buf := new(bytes.Buffer)
+			c.Assume(writeParquet(buf, cols, comp, "heka test"), gs.IsNil)
+			f := readParquet(c, buf.Bytes())
+
+			c.Expect(f.meta[3], gs.Equals, int64(20))
+			c.Expect(string(f.meta[6].([]byte)), gs.Equals, "heka test")
+			schema := f.meta[2].([]interface{})
+			c.Expect(len(schema), gs.Equals, 5)
+			root := schema[0].(map[int16]interface{})
+			c.Expect(root[5], gs.Equals, int64(4))
+			c.Expect(schema[1].(map[int16]interface{})[6], gs.Equals,
+				int64(convertedUTF8))
+
+			c.Expect(f.columns["name"][7], gs.Equals, "h")
+			c.Expect(f.columns["count"][3], gs.IsNil)
+			c.Expect(f.columns["count"][4], gs.Equals, int64(4))
+			c.Expect(f.columns["ratio"][19], gs.Equals, 4.75)
+			c.Expect(f.columns["ok"][10], gs.Equals, true)
+			c.Expect(f.columns["ok"][11], gs.Equals, false)
+		}
+
+		c.Specify("round trips uncompressed", func() {
+			check("none")
+		})
+
+		c.Specify("round trips with snappy", func() {
+			check("snappy")
+		})
+
+		c.Specify("round trips with gzip", func() {
+			check("gzip")
+		})
+
+		c.Specify("with no rows is still valid", func() {
+			comp, _ := newPageCompressor("none")
+			buf := new(bytes.Buffer)
+			c.Assume(writeParquet(buf, []*column{newColumn("x", typeInt64,
+				noConvertedType)}, comp, "heka test"), gs.IsNil)
+			f := readParquet(c, buf.Bytes())
+			c.Expect(f.meta[3], gs.Equals, int64(0))
+		})
+	})
+
+	c.Specify("An unknown compression is rejected", func() {
+		_, err := newPageCompressor("lzo")
+		c.Expect(err, gs.Not(gs.IsNil))
+	})
+}
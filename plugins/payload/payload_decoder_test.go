@@ -313,6 +313,22 @@ func PayloadDecodersSpec(c gospec.Context) {
 			})
 		})
 
+		c.Specify("infers severities when asked to", func() {
+			conf.MatchRegex = `^(?P<Host>\S+) `
+			conf.MessageFields = MessageTemplate{"Hostname": "%Host%"}
+			conf.InferSeverity = true
+			err := decoder.Init(conf)
+			c.Assume(err, gs.IsNil)
+			dRunner := pipelinemock.NewMockDecoderRunner(ctrl)
+			decoder.SetDecoderRunner(dRunner)
+			pack.Message.SetPayload("web01 [WARN] disk nearly full")
+			_, err = decoder.Decode(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(pack.Message.GetHostname(), gs.Equals, "web01")
+			c.Expect(pack.Message.GetSeverity(), gs.Equals, int32(4))
+			pack.Zero()
+		})
+
 		c.Specify("reading test-severity.log", func() {
 			conf.MatchRegex = `severity: (?P<Severity>[a-zA-Z]+)`
 			conf.SeverityMap = map[string]int32{
@@ -51,6 +51,10 @@ type PayloadRegexDecoderConfig struct {
 
 	// Whether payloads that do not match the regex should be logged.
 	LogErrors bool `toml:"log_errors"`
+
+	// Whether the severity of messages whose severity isn't captured or set
+	// by the message_fields is inferred from their payloads.
+	InferSeverity bool `toml:"infer_severity"`
 }
 
 type PayloadRegexDecoder struct {
@@ -61,6 +65,7 @@ type PayloadRegexDecoder struct {
 	tzLocation      *time.Location
 	dRunner         DecoderRunner
 	logErrors       bool
+	inferrer        *SeverityInferrer
 }
 
 func (ld *PayloadRegexDecoder) ConfigStruct() interface{} {
@@ -98,6 +103,9 @@ func (ld *PayloadRegexDecoder) Init(config interface{}) (err error) {
 			conf.TimestampLocation, err)
 	}
 	ld.logErrors = conf.LogErrors
+	if conf.InferSeverity {
+		ld.inferrer = NewSeverityInferrer(NewSeverityInferrerConfig())
+	}
 	return
 }
 
@@ -149,7 +157,14 @@ func (ld *PayloadRegexDecoder) Decode(pack *PipelinePack) (packs []*PipelinePack
 	}
 
 	pdh.DecodeTimestamp(pack)
+	_, captured := captures["Severity"]
 	pdh.DecodeSeverity(pack)
+	if _, templated := ld.MessageFields["Severity"]; ld.inferrer != nil && !captured &&
+		!templated {
+		if severity, ok := ld.inferrer.Infer(pack.Message.GetPayload()); ok {
+			pack.Message.SetSeverity(severity)
+		}
+	}
 
 	// Update the new message fields based on the fields we should
 	// change and the capture parts
@@ -48,6 +48,10 @@ func (pe *PayloadEncoder) Init(config interface{}) (err error) {
 	return
 }
 
+func (pe *PayloadEncoder) ContentType() string {
+	return "text/plain"
+}
+
 func (pe *PayloadEncoder) Encode(pack *pipeline.PipelinePack) (output []byte, err error) {
 	payload := pack.Message.GetPayload()
 
@@ -26,6 +26,7 @@ func TestAllSpecs(t *testing.T) {
 	r.AddSpec(ProcessChainSpec)
 	r.AddSpec(ProcessInputSpec)
 	r.AddSpec(ProcessDirectoryInputSpec)
+	r.AddSpec(ExecOutputSpec)
 
 	gospec.MainGoTest(r, t)
 }
@@ -0,0 +1,247 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package process
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type ExecOutputConfig struct {
+	// Path to the executable to run.
+	Bin string
+	// Command arguments.
+	Args []string
+	// Environment variables, as "NAME=value". Defaults to hekad's own.
+	Env []string
+	// Working directory of the command. Defaults to hekad's own.
+	Directory string
+	// How each encoded message is delimited on the child's stdin: "newline"
+	// appends a newline if the record doesn't already end with one, "length"
+	// prefixes each with its length as a 4 byte big endian integer, and
+	// "none" writes records as they are, e.g. when use_framing is set.
+	// Defaults to "newline".
+	Framing string
+	// Seconds a write may block a stalled child before it's killed and
+	// restarted. Defaults to 0, waiting as long as it takes, so that a slow
+	// child holds messages back.
+	WriteTimeout uint `toml:"write_timeout"`
+	// Seconds given to the child to exit after its stdin is closed, at
+	// shutdown, before it's killed. Defaults to 5.
+	ShutdownTimeout uint `toml:"shutdown_timeout"`
+}
+
+// Output plugin that streams encoded messages to the stdin of a long running
+// child process, restarting it, with the output's retry backoff, whenever it
+// exits.
+type ExecOutput struct {
+	conf                *ExecOutputConfig
+	or                  OutputRunner
+	cmd                 *exec.Cmd
+	stdin               *os.File
+	exited              chan struct{}
+	exitErr             error
+	lock                sync.Mutex
+	processMessageCount int64
+	dropMessageCount    int64
+	restartCount        int64
+}
+
+func (eo *ExecOutput) ConfigStruct() interface{} {
+	return &ExecOutputConfig{
+		Framing:         "newline",
+		ShutdownTimeout: 5,
+	}
+}
+
+func (eo *ExecOutput) Init(config interface{}) error {
+	eo.conf = config.(*ExecOutputConfig)
+	if eo.conf.Bin == "" {
+		return fmt.Errorf("bin must be set")
+	}
+	switch eo.conf.Framing {
+	case "newline", "length", "none":
+	default:
+		return fmt.Errorf("unknown framing '%s'", eo.conf.Framing)
+	}
+	return nil
+}
+
+func (eo *ExecOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	eo.or = or
+	return nil
+}
+
+// Starts the child, with its stdout discarded and its stderr logged a line
+// at a time.
+func (eo *ExecOutput) start() error {
+	cmd := exec.Command(eo.conf.Bin, eo.conf.Args...)
+	cmd.Dir = eo.conf.Directory
+	if len(eo.conf.Env) > 0 {
+		cmd.Env = eo.conf.Env
+	}
+	// Our own pipe rather than cmd.StdinPipe, so writes can have deadlines.
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = r
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		r.Close()
+		w.Close()
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return err
+	}
+	r.Close()
+	eo.cmd = cmd
+	eo.stdin = w
+	eo.exited = make(chan struct{})
+	go func(exited chan struct{}) {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			eo.or.LogError(fmt.Errorf("%s: %s", eo.conf.Bin, scanner.Text()))
+		}
+		// Past an overlong line, so the child can't block on a full pipe.
+		io.Copy(ioutil.Discard, stderr)
+		eo.exitErr = cmd.Wait()
+		close(exited)
+	}(eo.exited)
+	return nil
+}
+
+// Kills the child if it's still running and waits for it to be reaped.
+func (eo *ExecOutput) stop(wait time.Duration) {
+	if eo.cmd == nil {
+		return
+	}
+	eo.stdin.Close()
+	timer := time.NewTimer(wait)
+	select {
+	case <-eo.exited:
+	case <-timer.C:
+		eo.cmd.Process.Kill()
+		<-eo.exited
+	}
+	timer.Stop()
+	eo.cmd = nil
+}
+
+// Returns the record as it's to be written, framed as configured.
+func (eo *ExecOutput) frame(record []byte) []byte {
+	switch eo.conf.Framing {
+	case "newline":
+		if len(record) == 0 || record[len(record)-1] != '\n' {
+			// Copying, the encoder may reuse the record's buffer.
+			record = append(record[:len(record):len(record)], '\n')
+		}
+	case "length":
+		framed := make([]byte, 4, 4+len(record))
+		binary.BigEndian.PutUint32(framed, uint32(len(record)))
+		record = append(framed, record...)
+	}
+	return record
+}
+
+func (eo *ExecOutput) ProcessMessage(pack *PipelinePack) error {
+	record, err := eo.or.Encode(pack)
+	if err != nil {
+		atomic.AddInt64(&eo.dropMessageCount, 1)
+		return fmt.Errorf("can't encode: %s", err)
+	}
+	if record == nil {
+		// The encoder doesn't want this one sent.
+		eo.or.UpdateCursor(pack.QueueCursor)
+		return nil
+	}
+
+	eo.lock.Lock()
+	defer eo.lock.Unlock()
+	if eo.cmd != nil {
+		select {
+		case <-eo.exited:
+			eo.or.LogError(fmt.Errorf("%s exited: %v", eo.conf.Bin, eo.exitErr))
+			eo.cmd = nil
+		default:
+		}
+	}
+	if eo.cmd == nil {
+		if err = eo.start(); err != nil {
+			return NewRetryMessageError("can't start %s: %s", eo.conf.Bin, err)
+		}
+		atomic.AddInt64(&eo.restartCount, 1)
+	}
+
+	if eo.conf.WriteTimeout > 0 {
+		eo.stdin.SetWriteDeadline(time.Now().Add(
+			time.Duration(eo.conf.WriteTimeout) * time.Second))
+	}
+	if _, err = eo.stdin.Write(eo.frame(record)); err != nil {
+		// A partly written record would garble the stream, so the child is
+		// restarted either way.
+		eo.stop(0)
+		if os.IsTimeout(err) {
+			return NewRetryMessageError("%s stalled, restarting it", eo.conf.Bin)
+		}
+		return NewRetryMessageError("writing to %s: %s", eo.conf.Bin, err)
+	}
+	atomic.AddInt64(&eo.processMessageCount, 1)
+	eo.or.UpdateCursor(pack.QueueCursor)
+	return nil
+}
+
+// Closes the child's stdin, giving it shutdown_timeout to finish up.
+func (eo *ExecOutput) CleanUp() {
+	eo.lock.Lock()
+	defer eo.lock.Unlock()
+	eo.stop(time.Duration(eo.conf.ShutdownTimeout) * time.Second)
+}
+
+// Satisfies the `pipeline.ReportingPlugin` interface to provide plugin state
+// information to the Heka report and dashboard.
+func (eo *ExecOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "ProcessMessageCount",
+		atomic.LoadInt64(&eo.processMessageCount), "count")
+	message.NewInt64Field(msg, "DropMessageCount",
+		atomic.LoadInt64(&eo.dropMessageCount), "count")
+	// The first start isn't a restart.
+	restarts := atomic.LoadInt64(&eo.restartCount) - 1
+	if restarts < 0 {
+		restarts = 0
+	}
+	message.NewInt64Field(msg, "RestartCount", restarts, "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("ExecOutput", func() interface{} {
+		return new(ExecOutput)
+	})
+}
@@ -0,0 +1,137 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package process
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func ExecOutputSpec(c gs.Context) {
+	t := &pipeline_ts.SimpleT{}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tmpDir, err := ioutil.TempDir("", "exec-output-tests")
+	c.Assume(err, gs.IsNil)
+	defer os.RemoveAll(tmpDir)
+	outPath := filepath.Join(tmpDir, "out")
+
+	c.Specify("An ExecOutput", func() {
+		output := new(ExecOutput)
+		config := output.ConfigStruct().(*ExecOutputConfig)
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		or.EXPECT().UpdateCursor(gomock.Any()).AnyTimes()
+		or.EXPECT().LogError(gomock.Any()).AnyTimes()
+
+		pack := NewPipelinePack(nil)
+		encodeCall := or.EXPECT().Encode(pack).AnyTimes()
+		send := func(record string) error {
+			encodeCall.Return([]byte(record), nil)
+			return output.ProcessMessage(pack)
+		}
+
+		// Waits for the child to write the expected output.
+		readOut := func(expected string) string {
+			var data []byte
+			for i := 0; i < 100; i++ {
+				data, _ = ioutil.ReadFile(outPath)
+				if len(data) >= len(expected) {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			return string(data)
+		}
+
+		config.Bin = "sh"
+		config.Args = []string{"-c", "cat >> " + outPath}
+
+		c.Specify("rejects a bad config", func() {
+			config.Framing = "chunked"
+			c.Expect(output.Init(config).Error(), gs.Equals, "unknown framing 'chunked'")
+			config.Bin = ""
+			c.Expect(output.Init(config).Error(), gs.Equals, "bin must be set")
+		})
+
+		c.Specify("writes newline delimited records", func() {
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, nil), gs.IsNil)
+			c.Expect(send("one"), gs.IsNil)
+			c.Expect(send("two\n"), gs.IsNil)
+			output.CleanUp()
+			c.Expect(readOut("one\ntwo\n"), gs.Equals, "one\ntwo\n")
+		})
+
+		c.Specify("writes length prefixed records", func() {
+			config.Framing = "length"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, nil), gs.IsNil)
+			c.Expect(send("abc"), gs.IsNil)
+			output.CleanUp()
+			c.Expect(readOut("1234abc"), gs.Equals, "\x00\x00\x00\x03abc")
+		})
+
+		c.Specify("restarts a child that exits", func() {
+			// Each child takes one line and exits.
+			config.Args = []string{"-c", "head -n 1 >> " + outPath}
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, nil), gs.IsNil)
+			c.Expect(send("one"), gs.IsNil)
+			readOut("one\n")
+			<-output.exited
+
+			// The exit may only be noticed when writing.
+			err := send("two")
+			if err != nil {
+				_, ok := err.(RetryMessageError)
+				c.Expect(ok, gs.IsTrue)
+				c.Expect(send("two"), gs.IsNil)
+			}
+			output.CleanUp()
+			c.Expect(readOut("one\ntwo\n"), gs.Equals, "one\ntwo\n")
+			c.Expect(output.restartCount, gs.Equals, int64(2))
+		})
+
+		c.Specify("restarts a stalled child", func() {
+			config.Args = []string{"-c", "exec sleep 10"}
+			config.WriteTimeout = 1
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, nil), gs.IsNil)
+			// More than a pipe's buffer.
+			err := send(string(bytes.Repeat([]byte("x"), 1<<20)))
+			c.Assume(err, gs.Not(gs.IsNil))
+			c.Expect(err.Error(), gs.Equals, "sh stalled, restarting it")
+			c.Expect(output.cmd, gs.IsNil)
+		})
+
+		c.Specify("retries when the command can't start", func() {
+			config.Bin = filepath.Join(tmpDir, "missing")
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, nil), gs.IsNil)
+			_, ok := send("one").(RetryMessageError)
+			c.Expect(ok, gs.IsTrue)
+		})
+	})
+}
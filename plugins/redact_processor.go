@@ -0,0 +1,110 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type RedactProcessorConfig struct {
+	// Regular expressions whose matches are replaced, in the payload and in
+	// the values of string fields.
+	Patterns []string `toml:"patterns"`
+	// Names of fields whose values are replaced whole.
+	Fields []string `toml:"fields"`
+	// What matches and redacted fields are replaced with. Defaults to
+	// "[REDACTED]".
+	Replacement string `toml:"replacement"`
+	// Whether the patterns are applied to the payload. Defaults to true.
+	RedactPayload bool `toml:"redact_payload"`
+}
+
+// Removes sensitive data, such as passwords, card numbers or email
+// addresses, from messages before they're routed.
+type RedactProcessor struct {
+	conf     *RedactProcessorConfig
+	patterns []*regexp.Regexp
+	fields   map[string]bool
+}
+
+func (rp *RedactProcessor) ConfigStruct() interface{} {
+	return &RedactProcessorConfig{
+		Replacement:   "[REDACTED]",
+		RedactPayload: true,
+	}
+}
+
+func (rp *RedactProcessor) Init(config interface{}) error {
+	rp.conf = config.(*RedactProcessorConfig)
+	if len(rp.conf.Patterns) == 0 && len(rp.conf.Fields) == 0 {
+		return errors.New("at least one of 'patterns' and 'fields' must be set")
+	}
+	rp.patterns = make([]*regexp.Regexp, len(rp.conf.Patterns))
+	for i, pattern := range rp.conf.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern '%s': %s", pattern, err)
+		}
+		rp.patterns[i] = re
+	}
+	rp.fields = make(map[string]bool, len(rp.conf.Fields))
+	for _, name := range rp.conf.Fields {
+		rp.fields[name] = true
+	}
+	return nil
+}
+
+func (rp *RedactProcessor) redact(s string) string {
+	for _, re := range rp.patterns {
+		s = re.ReplaceAllLiteralString(s, rp.conf.Replacement)
+	}
+	return s
+}
+
+func (rp *RedactProcessor) Process(pack *PipelinePack) (keep bool, err error) {
+	msg := pack.Message
+	if rp.conf.RedactPayload && len(rp.patterns) > 0 {
+		msg.SetPayload(rp.redact(msg.GetPayload()))
+	}
+	var redacted []*message.Field
+	for _, field := range msg.Fields {
+		if rp.fields[field.GetName()] {
+			redacted = append(redacted, field)
+			continue
+		}
+		if field.GetValueType() == message.Field_STRING {
+			for i, value := range field.ValueString {
+				field.ValueString[i] = rp.redact(value)
+			}
+		}
+	}
+	// Redacted fields are replaced by a string field, whatever their type.
+	for _, field := range redacted {
+		msg.DeleteField(field)
+		message.NewStringField(msg, field.GetName(), rp.conf.Replacement)
+	}
+	return true, nil
+}
+
+func init() {
+	RegisterPlugin("RedactProcessor", func() interface{} {
+		return new(RedactProcessor)
+	})
+}
@@ -0,0 +1,73 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+)
+
+func RedactProcessorSpec(c gs.Context) {
+	c.Specify("A RedactProcessor", func() {
+		processor := new(RedactProcessor)
+		config := processor.ConfigStruct().(*RedactProcessorConfig)
+		config.Patterns = []string{`\d{4}-\d{4}-\d{4}-\d{4}`}
+		config.Fields = []string{"password"}
+		pack := NewPipelinePack(make(chan *PipelinePack, 1))
+		msg := pack.Message
+		msg.SetPayload("card 1234-5678-9012-3456 declined")
+		message.NewStringField(msg, "card", "4321-8765-2109-6543")
+		message.NewStringField(msg, "password", "hunter2")
+		message.NewInt64Field(msg, "pin", 1234, "")
+
+		c.Specify("redacts matches and fields", func() {
+			c.Assume(processor.Init(config), gs.IsNil)
+			keep, err := processor.Process(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(keep, gs.IsTrue)
+			c.Expect(msg.GetPayload(), gs.Equals, "card [REDACTED] declined")
+			val, _ := msg.GetFieldValue("card")
+			c.Expect(val, gs.Equals, "[REDACTED]")
+			val, _ = msg.GetFieldValue("password")
+			c.Expect(val, gs.Equals, "[REDACTED]")
+			val, _ = msg.GetFieldValue("pin")
+			c.Expect(val, gs.Equals, int64(1234))
+		})
+
+		c.Specify("replaces non-string fields", func() {
+			config.Fields = []string{"pin"}
+			config.Replacement = "xxx"
+			config.RedactPayload = false
+			c.Assume(processor.Init(config), gs.IsNil)
+			_, err := processor.Process(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(msg.GetPayload(), gs.Equals, "card 1234-5678-9012-3456 declined")
+			val, _ := msg.GetFieldValue("pin")
+			c.Expect(val, gs.Equals, "xxx")
+		})
+
+		c.Specify("needs something to redact", func() {
+			config.Patterns = nil
+			config.Fields = nil
+			c.Expect(processor.Init(config), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("rejects bad patterns", func() {
+			config.Patterns = []string{"("}
+			c.Expect(processor.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
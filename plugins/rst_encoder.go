@@ -75,6 +75,10 @@ func (re *RstEncoder) writeField(buf *bytes.Buffer, name, typeName, repr string,
 	buf.WriteString("\n")
 }
 
+func (re *RstEncoder) ContentType() string {
+	return "text/plain"
+}
+
 func (re *RstEncoder) Encode(pack *pipeline.PipelinePack) (output []byte, err error) {
 	// Writing out the message attributes is easy.
 	buf := new(bytes.Buffer)
@@ -0,0 +1,357 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type SamplingOutputConfig struct {
+	// Name of the output the sampled messages are written to.
+	Output string
+	// "nth", "random" or "adaptive". Defaults to "nth".
+	Method string `toml:"method"`
+	// For "nth", every n-th message of each key is forwarded. Defaults to 10.
+	N uint `toml:"n"`
+	// For "random", the probability of forwarding each message. Defaults to
+	// 0.1.
+	Rate float64 `toml:"rate"`
+	// For "adaptive", the number of messages of each key forwarded per
+	// ticker interval. Defaults to 100.
+	KeyBudget uint `toml:"key_budget"`
+	// Header name, or field name wrapped in "Fields[]", the messages are
+	// counted and sampled by. Defaults to sampling all messages as one key.
+	KeyField string `toml:"key_field"`
+	// Number of keys tracked, the messages of any further keys being
+	// sampled together as "(other)". Defaults to 1000.
+	MaxKeys uint `toml:"max_keys"`
+	// Seconds between suppression reports, and adaptive rate updates.
+	// Defaults to 60.
+	TickerInterval uint `toml:"ticker_interval"`
+	// Messages with a severity up to this are always forwarded, -1 for none.
+	// Defaults to 4, keeping all warnings and errors.
+	PassSeverity int32 `toml:"pass_severity"`
+	// Messages matching this message matcher are always forwarded.
+	InterestingMatcher string `toml:"interesting_matcher"`
+}
+
+// Keys the messages are counted under without a key_field, when they don't
+// have the key_field, and once max_keys keys are being tracked.
+const (
+	samplingAllKey   = "(all)"
+	samplingNoKey    = "(none)"
+	samplingOtherKey = "(other)"
+)
+
+// Counts of one key's messages.
+type sampleKey struct {
+	// This ticker interval's. Messages that are always forwarded count as
+	// passed rather than sampled, and don't use up any of the key's budget.
+	seen       int64
+	passed     int64
+	sampled    int64
+	forwarded  int64
+	suppressed int64
+	// Probability of forwarding a message, for "adaptive".
+	rate float64
+}
+
+// Output plugin that forwards a sample of the messages it matches to another
+// output, to keep down the cost of shipping and storing verbose categories
+// of messages. It periodically injects a `heka.sampling-report` message with
+// the number of messages of each key it suppressed.
+type SamplingOutput struct {
+	conf   *SamplingOutputConfig
+	or     OutputRunner
+	h      PluginHelper
+	child  OutputRunner
+	key    func(msg *message.Message) (string, bool)
+	keys   map[string]*sampleKey
+	random func() float64
+	// Nil if there's no interesting_matcher.
+	interesting *message.MatcherSpecification
+	// Accessed atomically, for the reports.
+	passCount     int64
+	forwardCount  int64
+	suppressCount int64
+	failCount     int64
+}
+
+func (s *SamplingOutput) ConfigStruct() interface{} {
+	return &SamplingOutputConfig{
+		Method:         "nth",
+		N:              10,
+		Rate:           0.1,
+		KeyBudget:      100,
+		MaxKeys:        1000,
+		TickerInterval: 60,
+		PassSeverity:   4,
+	}
+}
+
+func (s *SamplingOutput) Init(config interface{}) (err error) {
+	s.conf = config.(*SamplingOutputConfig)
+	if s.conf.Output == "" {
+		return errors.New("output must be set")
+	}
+	switch s.conf.Method {
+	case "nth":
+		if s.conf.N == 0 {
+			return errors.New("n must be greater than 0")
+		}
+	case "random":
+		if s.conf.Rate <= 0 || s.conf.Rate > 1 {
+			return fmt.Errorf("rate must be greater than 0 and at most 1, got %g",
+				s.conf.Rate)
+		}
+	case "adaptive":
+		if s.conf.KeyBudget == 0 {
+			return errors.New("key_budget must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("method must be 'nth', 'random' or 'adaptive', got '%s'",
+			s.conf.Method)
+	}
+	if s.conf.TickerInterval == 0 {
+		return errors.New("ticker_interval must be greater than 0")
+	}
+	if s.conf.MaxKeys == 0 {
+		return errors.New("max_keys must be greater than 0")
+	}
+	if s.conf.KeyField != "" {
+		if s.key, err = MessageKey(s.conf.KeyField); err != nil {
+			return err
+		}
+	}
+	if s.conf.InterestingMatcher != "" {
+		s.interesting, err = message.CreateMatcherSpecification(s.conf.InterestingMatcher)
+		if err != nil {
+			return fmt.Errorf("invalid interesting_matcher: %s", err)
+		}
+	}
+	if s.random == nil {
+		s.random = rand.New(rand.NewSource(time.Now().UnixNano())).Float64
+	}
+	return nil
+}
+
+func (s *SamplingOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	if s.conf.Output == or.Name() {
+		return errors.New("can't sample to itself")
+	}
+	child, ok := h.PipelineConfig().Output(s.conf.Output)
+	if !ok {
+		return fmt.Errorf("no output named '%s'", s.conf.Output)
+	}
+	s.or = or
+	s.h = h
+	s.child = child
+	s.keys = make(map[string]*sampleKey)
+	return nil
+}
+
+// Returns the counts of the message's key.
+func (s *SamplingOutput) keyOf(msg *message.Message) *sampleKey {
+	name := samplingAllKey
+	if s.key != nil {
+		var ok bool
+		if name, ok = s.key(msg); !ok {
+			name = samplingNoKey
+		}
+	}
+	k, ok := s.keys[name]
+	if !ok {
+		if uint(len(s.keys)) >= s.conf.MaxKeys {
+			if k, ok = s.keys[samplingOtherKey]; ok {
+				return k
+			}
+			name = samplingOtherKey
+		}
+		k = &sampleKey{rate: 1}
+		s.keys[name] = k
+	}
+	return k
+}
+
+// Tells if the message counted in k should be forwarded.
+func (s *SamplingOutput) sample(k *sampleKey) bool {
+	switch s.conf.Method {
+	case "nth":
+		return (k.sampled-1)%int64(s.conf.N) == 0
+	case "random":
+		return s.random() < s.conf.Rate
+	}
+	// Adaptive, spreading the budget over the interval at the rate that
+	// would have used it up in the last one, but never going over it.
+	return k.forwarded-k.passed < int64(s.conf.KeyBudget) && s.random() < k.rate
+}
+
+// Tells if the message is always forwarded, going by its severity and the
+// interesting_matcher.
+func (s *SamplingOutput) passes(pack *PipelinePack) bool {
+	if pack.Message.GetSeverity() <= s.conf.PassSeverity {
+		return true
+	}
+	return s.interesting != nil && s.interesting.MatchSigned(pack.Message, pack.Signer)
+}
+
+func (s *SamplingOutput) ProcessMessage(pack *PipelinePack) error {
+	k := s.keyOf(pack.Message)
+	k.seen++
+	if s.passes(pack) {
+		k.passed++
+		atomic.AddInt64(&s.passCount, 1)
+	} else {
+		k.sampled++
+		if !s.sample(k) {
+			k.suppressed++
+			atomic.AddInt64(&s.suppressCount, 1)
+			s.or.UpdateCursor(pack.QueueCursor)
+			return nil
+		}
+	}
+
+	k.forwarded++
+	atomic.AddInt32(&pack.RefCount, 1)
+	if err := s.child.MatchRunner().Deliver(pack); err != nil {
+		atomic.AddInt64(&s.failCount, 1)
+		s.or.LogError(fmt.Errorf("can't deliver to '%s': %s", s.conf.Output, err))
+	} else {
+		atomic.AddInt64(&s.forwardCount, 1)
+	}
+	s.or.UpdateCursor(pack.QueueCursor)
+	return nil
+}
+
+// Reports the interval's suppression counts, then starts the next interval.
+func (s *SamplingOutput) TimerEvent() error {
+	names := make([]string, 0, len(s.keys))
+	var seen, passed, forwarded, suppressed int64
+	for name, k := range s.keys {
+		if k.seen == 0 {
+			// Forget keys that have gone quiet.
+			delete(s.keys, name)
+			continue
+		}
+		seen += k.seen
+		passed += k.passed
+		forwarded += k.forwarded
+		suppressed += k.suppressed
+		if k.suppressed > 0 {
+			names = append(names, name)
+		}
+	}
+	if suppressed > 0 {
+		// Most suppressed first.
+		sort.Slice(names, func(i, j int) bool {
+			si, sj := s.keys[names[i]].suppressed, s.keys[names[j]].suppressed
+			if si != sj {
+				return si > sj
+			}
+			return names[i] < names[j]
+		})
+		payload := new(bytes.Buffer)
+		payload.WriteString("Key\tSeen\tPassed\tForwarded\tSuppressed\n")
+		for _, name := range names {
+			k := s.keys[name]
+			fmt.Fprintf(payload, "%s\t%d\t%d\t%d\t%d\n", name, k.seen, k.passed,
+				k.forwarded, k.suppressed)
+		}
+		s.report(seen, passed, forwarded, suppressed, payload.String())
+	}
+
+	for _, k := range s.keys {
+		if s.conf.Method == "adaptive" {
+			k.rate = 1
+			if k.sampled > 0 {
+				k.rate = float64(s.conf.KeyBudget) / float64(k.sampled)
+			}
+			if k.rate > 1 {
+				k.rate = 1
+			}
+		}
+		k.seen, k.passed, k.sampled, k.forwarded, k.suppressed = 0, 0, 0, 0, 0
+	}
+	return nil
+}
+
+// Injects a `heka.sampling-report` message.
+func (s *SamplingOutput) report(seen, passed, forwarded, suppressed int64,
+	payload string) {
+
+	pack, err := s.h.PipelinePack(0)
+	if err != nil {
+		s.or.LogError(err)
+		return
+	}
+	msg := pack.Message
+	msg.SetType("heka.sampling-report")
+	msg.SetLogger(s.or.Name())
+	msg.SetPayload(payload)
+	message.NewStringField(msg, "Output", s.conf.Output)
+	message.NewStringField(msg, "Method", s.conf.Method)
+	message.NewInt64Field(msg, "Seen", seen, "count")
+	message.NewInt64Field(msg, "Passed", passed, "count")
+	message.NewInt64Field(msg, "Forwarded", forwarded, "count")
+	message.NewInt64Field(msg, "Suppressed", suppressed, "count")
+	message.NewIntField(msg, "Interval", int(s.conf.TickerInterval), "s")
+
+	// Outputs can't inject through their runner, so guard against routing
+	// the report back here.
+	if s.or.MatchRunner().MatcherSpecification().Match(msg) {
+		s.or.LogError(errors.New("message_matcher matches its own sampling reports"))
+		pack.Recycle(nil)
+		return
+	}
+	if err = pack.EncodeMsgBytes(); err != nil {
+		s.or.LogError(fmt.Errorf("encoding sampling report: %s", err))
+		pack.Recycle(nil)
+		return
+	}
+	router := s.h.PipelineConfig().Router()
+	// The router may be waiting on this output's channel.
+	go router.Inject(pack)
+}
+
+func (s *SamplingOutput) CleanUp() {}
+
+// Satisfies the `pipeline.ReportingPlugin` interface to provide plugin state
+// information to the Heka report and dashboard.
+func (s *SamplingOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "PassCount",
+		atomic.LoadInt64(&s.passCount), "count")
+	message.NewInt64Field(msg, "ForwardCount",
+		atomic.LoadInt64(&s.forwardCount), "count")
+	message.NewInt64Field(msg, "SuppressCount",
+		atomic.LoadInt64(&s.suppressCount), "count")
+	message.NewInt64Field(msg, "FailCount",
+		atomic.LoadInt64(&s.failCount), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("SamplingOutput", func() interface{} {
+		return new(SamplingOutput)
+	})
+}
@@ -0,0 +1,225 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"strings"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func SamplingOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A SamplingOutput", func() {
+		output := new(SamplingOutput)
+		config := output.ConfigStruct().(*SamplingOutputConfig)
+		config.Output = "StoreOutput"
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		h.EXPECT().PipelineConfig().Return(pConfig).AnyTimes()
+		h.EXPECT().PipelinePack(uint(0)).Return(
+			NewPipelinePack(pConfig.InjectRecycleChan()), nil).AnyTimes()
+		mr, err := NewMatchRunner("Type == 'app.log'", "", nil, 2, nil)
+		c.Assume(err, gs.IsNil)
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		or.EXPECT().Name().Return("Sampler").AnyTimes()
+		or.EXPECT().MatchRunner().Return(mr).AnyTimes()
+		or.EXPECT().UpdateCursor(gomock.Any()).AnyTimes()
+		or.EXPECT().LogError(gomock.Any()).AnyTimes()
+
+		childChan := make(chan *PipelinePack, 100)
+		childMatcher, err := NewMatchRunner("FALSE", "", nil, 100, childChan)
+		c.Assume(err, gs.IsNil)
+		child := pipelinemock.NewMockOutputRunner(ctrl)
+		child.EXPECT().MatchRunner().Return(childMatcher).AnyTimes()
+		pConfig.OutputRunners["StoreOutput"] = child
+
+		// Sends count messages from each of the loggers, returning how many
+		// were forwarded.
+		severity := int32(7)
+		send := func(count int, loggers ...string) int {
+			for i := 0; i < count; i++ {
+				for _, logger := range loggers {
+					pack := NewPipelinePack(pConfig.InputRecycleChan())
+					pack.Message.SetType("app.log")
+					pack.Message.SetLogger(logger)
+					pack.Message.SetSeverity(severity)
+					pack.RefCount = 1
+					c.Expect(output.ProcessMessage(pack), gs.IsNil)
+				}
+			}
+			forwarded := len(childChan)
+			for len(childChan) > 0 {
+				<-childChan
+			}
+			return forwarded
+		}
+
+		// Injected reports arrive asynchronously.
+		report := func() *message.Message {
+			c.Assume(output.TimerEvent(), gs.IsNil)
+			select {
+			case pack := <-pConfig.Router().InChan():
+				return pack.Message
+			case <-time.After(100 * time.Millisecond):
+				return nil
+			}
+		}
+
+		c.Specify("forwards every n-th message of each key", func() {
+			config.N = 5
+			config.KeyField = "Logger"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(send(10, "web", "db"), gs.Equals, 4)
+
+			msg := report()
+			c.Assume(msg, gs.Not(gs.IsNil))
+			c.Expect(msg.GetType(), gs.Equals, "heka.sampling-report")
+			suppressed, _ := msg.GetFieldValue("Suppressed")
+			c.Expect(suppressed, gs.Equals, int64(16))
+			lines := strings.Split(strings.TrimSpace(msg.GetPayload()), "\n")
+			c.Expect(len(lines), gs.Equals, 3)
+			c.Expect(lines[1], gs.Equals, "db\t10\t0\t2\t8")
+
+			c.Specify("but doesn't report quiet intervals", func() {
+				c.Expect(report(), gs.IsNil)
+			})
+		})
+
+		c.Specify("forwards with a probability", func() {
+			config.Method = "random"
+			config.Rate = 0.5
+			output.random = func() float64 { return 0.6 }
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(send(10, "web"), gs.Equals, 0)
+			output.random = func() float64 { return 0.4 }
+			c.Expect(send(10, "web"), gs.Equals, 10)
+		})
+
+		c.Specify("adapts each key's rate to its budget", func() {
+			config.Method = "adaptive"
+			config.KeyBudget = 10
+			config.KeyField = "Logger"
+			output.random = func() float64 { return 0.3 }
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			// The budget caps a new key's first interval.
+			c.Expect(send(40, "web"), gs.Equals, 10)
+			c.Expect(send(5, "db"), gs.Equals, 5)
+			report()
+			// Then web is sampled at 10 / 40.
+			c.Expect(send(40, "web"), gs.Equals, 0)
+			output.random = func() float64 { return 0.2 }
+			c.Expect(send(40, "web"), gs.Equals, 10)
+			c.Expect(send(5, "db"), gs.Equals, 5)
+		})
+
+		c.Specify("samples keys past max_keys together", func() {
+			config.N = 2
+			config.KeyField = "Logger"
+			config.MaxKeys = 2
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(send(2, "a", "b", "c", "d"), gs.Equals, 4)
+			msg := report()
+			c.Assume(msg, gs.Not(gs.IsNil))
+			c.Expect(strings.Contains(msg.GetPayload(), "(other)\t4\t0\t2\t2\n"), gs.IsTrue)
+		})
+
+		c.Specify("always forwards warnings and interesting messages", func() {
+			config.KeyField = "Logger"
+			config.InterestingMatcher = "Logger == 'audit'"
+
+			c.Specify("outside of the n-th count", func() {
+				c.Assume(output.Init(config), gs.IsNil)
+				c.Assume(output.Prepare(or, h), gs.IsNil)
+				severity = 3
+				c.Expect(send(10, "web"), gs.Equals, 10)
+				severity = 7
+				c.Expect(send(10, "web"), gs.Equals, 1)
+				c.Expect(send(5, "audit"), gs.Equals, 5)
+
+				msg := report()
+				c.Assume(msg, gs.Not(gs.IsNil))
+				passed, _ := msg.GetFieldValue("Passed")
+				c.Expect(passed, gs.Equals, int64(15))
+				lines := strings.Split(strings.TrimSpace(msg.GetPayload()), "\n")
+				c.Expect(len(lines), gs.Equals, 2)
+				c.Expect(lines[1], gs.Equals, "web\t20\t10\t11\t9")
+			})
+
+			c.Specify("without using up the budget", func() {
+				config.Method = "adaptive"
+				config.KeyBudget = 5
+				output.random = func() float64 { return 0 }
+				c.Assume(output.Init(config), gs.IsNil)
+				c.Assume(output.Prepare(or, h), gs.IsNil)
+				severity = 2
+				c.Expect(send(10, "web"), gs.Equals, 10)
+				severity = 7
+				c.Expect(send(10, "web"), gs.Equals, 5)
+			})
+		})
+
+		c.Specify("won't inject reports it would match", func() {
+			greedyMatcher, err := NewMatchRunner("TRUE", "", nil, 2, nil)
+			c.Assume(err, gs.IsNil)
+			greedy := pipelinemock.NewMockOutputRunner(ctrl)
+			greedy.EXPECT().Name().Return("Sampler").AnyTimes()
+			greedy.EXPECT().MatchRunner().Return(greedyMatcher).AnyTimes()
+			greedy.EXPECT().UpdateCursor(gomock.Any()).AnyTimes()
+			greedy.EXPECT().LogError(gomock.Any()).AnyTimes()
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(greedy, h), gs.IsNil)
+			send(2, "web")
+			c.Expect(report(), gs.IsNil)
+		})
+
+		c.Specify("rejects", func() {
+			c.Specify("an unknown method", func() {
+				config.Method = "head"
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("an invalid interesting_matcher", func() {
+				config.InterestingMatcher = "Logger =="
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("an unknown key_field", func() {
+				config.KeyField = "Severity"
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("an unknown output", func() {
+				config.Output = "NoOutput"
+				c.Assume(output.Init(config), gs.IsNil)
+				err := output.Prepare(or, h)
+				c.Expect(err.Error(), gs.Equals, "no output named 'NoOutput'")
+			})
+		})
+	})
+}
@@ -0,0 +1,244 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	"heka/message"
+	. "heka/pipeline"
+)
+
+var scheduleNameRe = regexp.MustCompile("\\W")
+
+type ScheduleInputConfig struct {
+	// Cron expression of when to fire, see ParseCronSchedule.
+	Schedule string `toml:"schedule"`
+	// IANA time zone the schedule is in, e.g. "Europe/Paris". Defaults to
+	// the local time zone.
+	Timezone string `toml:"timezone"`
+	// What to do about runs missed while hekad wasn't running: "skip" them,
+	// fire just the latest "once", or fire "all" of them. Defaults to "skip".
+	MissedRuns string `toml:"missed_runs"`
+	// Most missed runs fired when catching up under "all", the latest being
+	// kept. Defaults to 100.
+	MaxCatchup uint `toml:"max_catchup"`
+	// Values of the generated messages, as for the ScribbleDecoder, which may
+	// interpolate %ScheduledTime% and %Schedule%.
+	MessageFields MessageTemplate `toml:"message_fields"`
+}
+
+// Generates a message each time a cron style schedule comes round.
+type ScheduleInput struct {
+	conf     *ScheduleInputConfig
+	schedule CronSchedule
+	loc      *time.Location
+	pConfig  *PipelineConfig
+	ir       InputRunner
+	hostname string
+	stopChan chan struct{}
+}
+
+func (si *ScheduleInput) SetPipelineConfig(pConfig *PipelineConfig) {
+	si.pConfig = pConfig
+}
+
+func (si *ScheduleInput) ConfigStruct() interface{} {
+	return &ScheduleInputConfig{
+		MissedRuns: "skip",
+		MaxCatchup: 100,
+	}
+}
+
+func (si *ScheduleInput) Init(config interface{}) (err error) {
+	si.conf = config.(*ScheduleInputConfig)
+	if si.conf.Schedule == "" {
+		return fmt.Errorf("schedule must be set")
+	}
+	switch si.conf.MissedRuns {
+	case "skip", "once", "all":
+	default:
+		return fmt.Errorf("unknown missed_runs policy '%s'", si.conf.MissedRuns)
+	}
+	si.loc = time.Local
+	if si.conf.Timezone != "" {
+		if si.loc, err = time.LoadLocation(si.conf.Timezone); err != nil {
+			return fmt.Errorf("can't load timezone '%s': %s", si.conf.Timezone, err)
+		}
+	}
+	if si.schedule, err = ParseCronSchedule(si.conf.Schedule, si.loc); err != nil {
+		return err
+	}
+	si.stopChan = make(chan struct{})
+	return nil
+}
+
+// Returns the file recording the last scheduled time fired.
+func (si *ScheduleInput) stateFile() string {
+	name := scheduleNameRe.ReplaceAllString(si.ir.Name(), "_")
+	return si.pConfig.Globals.PrependBaseDir(filepath.Join("schedule_input", name))
+}
+
+// Returns the last scheduled time fired by an earlier run, or the zero time
+// if there isn't one.
+func (si *ScheduleInput) loadLast() time.Time {
+	data, err := ioutil.ReadFile(si.stateFile())
+	if err != nil {
+		return time.Time{}
+	}
+	last, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		si.ir.LogError(fmt.Errorf("can't parse last run time: %s", err))
+		return time.Time{}
+	}
+	return last
+}
+
+func (si *ScheduleInput) saveLast(last time.Time) {
+	path := si.stateFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		si.ir.LogError(fmt.Errorf("can't create state directory: %s", err))
+		return
+	}
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, []byte(last.Format(time.RFC3339Nano)), 0644)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		si.ir.LogError(fmt.Errorf("can't record last run time: %s", err))
+	}
+}
+
+// Returns the scheduled times after from, up to and including now, keeping
+// only the latest max of them.
+func (si *ScheduleInput) due(from, now time.Time, max uint) []time.Time {
+	var times []time.Time
+	for t := si.schedule.Next(from); !t.IsZero() && !t.After(now); t = si.schedule.Next(t) {
+		times = append(times, t)
+		if max > 0 && uint(len(times)) > max {
+			times = times[1:]
+		}
+	}
+	return times
+}
+
+func (si *ScheduleInput) Run(ir InputRunner, h PluginHelper) error {
+	si.ir = ir
+	si.hostname = h.Hostname()
+	now := time.Now()
+	last := si.loadLast()
+	if !last.IsZero() && si.conf.MissedRuns != "skip" {
+		missed := si.due(last, now, si.conf.MaxCatchup)
+		if si.conf.MissedRuns == "once" && len(missed) > 1 {
+			missed = missed[len(missed)-1:]
+		}
+		if len(missed) > 0 {
+			ir.LogMessage(fmt.Sprintf("Catching up on %d missed run(s)", len(missed)))
+		}
+		for _, t := range missed {
+			if !si.fire(t, true) {
+				return nil
+			}
+		}
+	}
+	last = now
+
+	for {
+		next := si.schedule.Next(last)
+		if next.IsZero() {
+			ir.LogError(fmt.Errorf("schedule '%s' never fires again", si.conf.Schedule))
+			<-si.stopChan
+			return nil
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-si.stopChan:
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		// Waking late, e.g. after the host was suspended, we fire the latest
+		// run on time and only fire the earlier ones under "all".
+		times := si.due(last, time.Now(), si.conf.MaxCatchup)
+		if len(times) == 0 {
+			// The clock went backwards.
+			continue
+		}
+		for i, t := range times {
+			if i < len(times)-1 && si.conf.MissedRuns != "all" {
+				continue
+			}
+			if !si.fire(t, i < len(times)-1) {
+				return nil
+			}
+		}
+		last = times[len(times)-1]
+	}
+}
+
+// Delivers the message for the scheduled time, returning false if the input
+// was stopped first.
+func (si *ScheduleInput) fire(t time.Time, missed bool) bool {
+	var pack *PipelinePack
+	select {
+	case pack = <-si.ir.InChan():
+	case <-si.stopChan:
+		return false
+	}
+	scheduled := t.In(si.loc).Format(time.RFC3339)
+	msg := pack.Message
+	msg.SetUuid(uuid.NewRandom())
+	msg.SetTimestamp(time.Now().UnixNano())
+	msg.SetHostname(si.hostname)
+	msg.SetType("heka.schedule")
+	msg.SetLogger(si.ir.Name())
+	subs := map[string]string{
+		"ScheduledTime": scheduled,
+		"Schedule":      si.conf.Schedule,
+	}
+	if err := si.conf.MessageFields.PopulateMessage(msg, subs); err != nil {
+		si.ir.LogError(fmt.Errorf("can't populate message: %s", err))
+		pack.Recycle(nil)
+		return true
+	}
+	message.NewStringField(msg, "ScheduledTime", scheduled)
+	if missed {
+		if field, err := message.NewField("Missed", true, ""); err == nil {
+			msg.AddField(field)
+		}
+	}
+	si.ir.Deliver(pack)
+	si.saveLast(t)
+	return true
+}
+
+func (si *ScheduleInput) Stop() {
+	close(si.stopChan)
+}
+
+func init() {
+	RegisterPlugin("ScheduleInput", func() interface{} {
+		return new(ScheduleInput)
+	})
+}
@@ -0,0 +1,196 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func ScheduleInputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tmpDir, err := ioutil.TempDir("", "schedule-input-tests")
+	c.Assume(err, gs.IsNil)
+	defer os.RemoveAll(tmpDir)
+	pConfig := NewPipelineConfig(nil)
+	pConfig.Globals.BaseDir = tmpDir
+
+	c.Specify("A ScheduleInput", func() {
+		input := new(ScheduleInput)
+		input.SetPipelineConfig(pConfig)
+		config := input.ConfigStruct().(*ScheduleInputConfig)
+
+		c.Specify("rejects a bad config", func() {
+			err := input.Init(config)
+			c.Expect(err.Error(), gs.Equals, "schedule must be set")
+
+			config.Schedule = "@hourly"
+			config.MissedRuns = "sometimes"
+			err = input.Init(config)
+			c.Expect(err.Error(), gs.Equals, "unknown missed_runs policy 'sometimes'")
+
+			config.MissedRuns = "skip"
+			config.Timezone = "Mars/Olympus_Mons"
+			c.Expect(input.Init(config), gs.Not(gs.IsNil))
+		})
+
+		ir := pipelinemock.NewMockInputRunner(ctrl)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		supply := make(chan *PipelinePack, 10)
+		for i := 0; i < 10; i++ {
+			supply <- NewPipelinePack(supply)
+		}
+		delivered := make(chan *PipelinePack, 10)
+		ir.EXPECT().Name().Return("ScheduleInput").AnyTimes()
+		ir.EXPECT().InChan().Return(supply).AnyTimes()
+		ir.EXPECT().LogMessage(gomock.Any()).AnyTimes()
+		h.EXPECT().Hostname().Return("somehost").AnyTimes()
+		deliverCall := ir.EXPECT().Deliver(gomock.Any()).AnyTimes()
+		deliverCall.Do(func(pack *PipelinePack) {
+			delivered <- pack
+		})
+		run := func() chan error {
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- input.Run(ir, h)
+			}()
+			return errChan
+		}
+		// Collects the deliveries made within the wait.
+		collect := func(wait time.Duration) (packs []*PipelinePack) {
+			timeout := time.After(wait)
+			for {
+				select {
+				case pack := <-delivered:
+					packs = append(packs, pack)
+				case <-timeout:
+					return packs
+				}
+			}
+		}
+
+		c.Specify("fires on its schedule", func() {
+			config.Schedule = "* * * * * *"
+			config.Timezone = "UTC"
+			config.MessageFields = MessageTemplate{
+				"Type":    "probe",
+				"Payload": "due at %ScheduledTime%",
+			}
+			err := input.Init(config)
+			c.Assume(err, gs.IsNil)
+			errChan := run()
+
+			var pack *PipelinePack
+			select {
+			case pack = <-delivered:
+			case <-time.After(2 * time.Second):
+			}
+			input.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+			c.Assume(pack, gs.Not(gs.IsNil))
+			c.Expect(pack.Message.GetType(), gs.Equals, "probe")
+			c.Expect(pack.Message.GetHostname(), gs.Equals, "somehost")
+			scheduled, _ := pack.Message.GetFieldValue("ScheduledTime")
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "due at "+scheduled.(string))
+			_, err = time.Parse(time.RFC3339, scheduled.(string))
+			c.Expect(err, gs.IsNil)
+			_, missed := pack.Message.GetFieldValue("Missed")
+			c.Expect(missed, gs.IsFalse)
+
+			// The run was recorded.
+			data, err := ioutil.ReadFile(filepath.Join(tmpDir, "schedule_input",
+				"ScheduleInput"))
+			c.Expect(err, gs.IsNil)
+			last, err := time.Parse(time.RFC3339Nano, string(data))
+			c.Expect(err, gs.IsNil)
+			c.Expect(last.Format(time.RFC3339), gs.Equals, scheduled.(string))
+		})
+
+		c.Specify("after being down for three runs", func() {
+			config.Schedule = "* * * * *"
+			last := time.Now().Add(-3*time.Minute - time.Second)
+			err := os.MkdirAll(filepath.Join(tmpDir, "schedule_input"), 0755)
+			c.Assume(err, gs.IsNil)
+			err = ioutil.WriteFile(filepath.Join(tmpDir, "schedule_input",
+				"ScheduleInput"), []byte(last.Format(time.RFC3339Nano)), 0644)
+			c.Assume(err, gs.IsNil)
+			missedPacks := func() (packs []*PipelinePack) {
+				for _, pack := range collect(100 * time.Millisecond) {
+					if _, ok := pack.Message.GetFieldValue("Missed"); ok {
+						packs = append(packs, pack)
+					}
+				}
+				return packs
+			}
+
+			c.Specify("skips the missed runs", func() {
+				err := input.Init(config)
+				c.Assume(err, gs.IsNil)
+				errChan := run()
+				c.Expect(len(missedPacks()), gs.Equals, 0)
+				input.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+			})
+
+			c.Specify("fires the latest missed run once", func() {
+				config.MissedRuns = "once"
+				err := input.Init(config)
+				c.Assume(err, gs.IsNil)
+				errChan := run()
+				c.Expect(len(missedPacks()), gs.Equals, 1)
+				input.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+			})
+
+			c.Specify("fires all of the missed runs", func() {
+				config.MissedRuns = "all"
+				err := input.Init(config)
+				c.Assume(err, gs.IsNil)
+				errChan := run()
+				packs := missedPacks()
+				input.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+				c.Assume(len(packs), gs.Equals, 3)
+				first, _ := packs[0].Message.GetFieldValue("ScheduledTime")
+				third, _ := packs[2].Message.GetFieldValue("ScheduledTime")
+				t1, _ := time.Parse(time.RFC3339, first.(string))
+				t3, _ := time.Parse(time.RFC3339, third.(string))
+				c.Expect(t3.Sub(t1), gs.Equals, 2*time.Minute)
+			})
+
+			c.Specify("fires no more than max_catchup missed runs", func() {
+				config.MissedRuns = "all"
+				config.MaxCatchup = 2
+				err := input.Init(config)
+				c.Assume(err, gs.IsNil)
+				errChan := run()
+				c.Expect(len(missedPacks()), gs.Equals, 2)
+				input.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,446 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package sentry
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pborman/uuid"
+	"heka/message"
+	. "heka/pipeline"
+	"heka/plugins/tcp"
+)
+
+type SentryOutputConfig struct {
+	// The project's DSN, e.g. "https://key@o1.ingest.sentry.io/42".
+	Dsn string `toml:"dsn"`
+	// Least severe severity sent, messages with a higher severity number
+	// being skipped. Defaults to 3, error.
+	MaxSeverity int32 `toml:"max_severity"`
+	// Fields whose values group events into issues, instead of Sentry's own
+	// grouping by message and exception.
+	FingerprintFields []string `toml:"fingerprint_fields"`
+	// Field whose value is the exception type, making the event an exception
+	// with the payload's first line as its value.
+	ExceptionTypeField string `toml:"exception_type_field"`
+	Release            string `toml:"release"`
+	Environment        string `toml:"environment"`
+	// Tags added to every event.
+	Tags map[string]string `toml:"tags"`
+	// Fields sent as tags, the other fields being sent as extra data.
+	TagFields []string `toml:"tag_fields"`
+	// Most events sent a minute, with bursts of as many, or 0 for no limit.
+	// Defaults to 60.
+	MaxEventsPerMinute uint `toml:"max_events_per_minute"`
+	// Seconds a request may take. Defaults to 10.
+	Timeout uint `toml:"timeout"`
+	Tls     tcp.TlsConfig
+}
+
+// A parsed DSN: the URL events are sent to and the keys authorizing them.
+type sentryDsn struct {
+	envelopeUrl string
+	publicKey   string
+	secretKey   string
+	// The sentry_client sent with the keys.
+	client string
+}
+
+func parseDsn(dsn string) (*sentryDsn, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse DSN: %s", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("DSN must be an http or https URL")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, errors.New("DSN has no public key")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	project := path[i+1:]
+	if _, err = strconv.ParseUint(project, 10, 64); err != nil {
+		return nil, errors.New("DSN has no project id")
+	}
+	d := &sentryDsn{
+		envelopeUrl: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host,
+			path[:i], project),
+		publicKey: u.User.Username(),
+	}
+	d.secretKey, _ = u.User.Password()
+	return d, nil
+}
+
+func (d *sentryDsn) authHeader(now time.Time) string {
+	header := fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, "+
+		"sentry_timestamp=%d, sentry_key=%s", d.client, now.Unix(), d.publicKey)
+	if d.secretKey != "" {
+		header += ", sentry_secret=" + d.secretKey
+	}
+	return header
+}
+
+// Token bucket allowing a number of events a minute.
+type minuteBucket struct {
+	perMinute  float64
+	lock       sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+}
+
+func (b *minuteBucket) take(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if elapsed := now.Sub(b.lastRefill); elapsed > 0 {
+		b.tokens += elapsed.Minutes() * b.perMinute
+		if b.tokens > b.perMinute {
+			b.tokens = b.perMinute
+		}
+		b.lastRefill = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Output plugin that sends error messages to Sentry as events, so that they
+// are grouped into issues. Events are rate limited, both by the output and
+// by Sentry's own rate limits, events over the limits being dropped rather
+// than retried as Sentry's SDKs do.
+type SentryOutput struct {
+	conf      *SentryOutputConfig
+	or        OutputRunner
+	dsn       *sentryDsn
+	client    *http.Client
+	bucket    *minuteBucket
+	tagFields map[string]bool
+	// When Sentry's rate limit ends, after it refuses an event.
+	limitedUntil time.Time
+
+	// Accessed atomically, for the reports.
+	eventsSent    int64
+	rateLimited   int64
+	sendFailures  int64
+	eventsSkipped int64
+}
+
+func (o *SentryOutput) ConfigStruct() interface{} {
+	return &SentryOutputConfig{
+		MaxSeverity:        3,
+		MaxEventsPerMinute: 60,
+		Timeout:            10,
+	}
+}
+
+func (o *SentryOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*SentryOutputConfig)
+	if o.conf.Dsn == "" {
+		return errors.New("dsn must be set")
+	}
+	if o.dsn, err = parseDsn(o.conf.Dsn); err != nil {
+		return err
+	}
+	transport := &http.Transport{}
+	if transport.TLSClientConfig, err = tcp.CreateGoTlsConfig(&o.conf.Tls); err != nil {
+		return fmt.Errorf("TLS init error: %s", err)
+	}
+	o.client = &http.Client{Transport: transport,
+		Timeout: time.Duration(o.conf.Timeout) * time.Second}
+	if o.conf.MaxEventsPerMinute > 0 {
+		o.bucket = &minuteBucket{perMinute: float64(o.conf.MaxEventsPerMinute),
+			tokens: float64(o.conf.MaxEventsPerMinute), lastRefill: time.Now()}
+	}
+	o.tagFields = make(map[string]bool)
+	for _, name := range o.conf.TagFields {
+		o.tagFields[name] = true
+	}
+	return nil
+}
+
+func (o *SentryOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	o.or = or
+	o.dsn.client = "heka/" + h.PipelineConfig().Globals.Version
+	return nil
+}
+
+// Returns the Sentry level of a syslog severity.
+func sentryLevel(severity int32) string {
+	switch {
+	case severity <= 2:
+		return "fatal"
+	case severity == 3:
+		return "error"
+	case severity == 4:
+		return "warning"
+	case severity <= 6:
+		return "info"
+	}
+	return "debug"
+}
+
+// Returns a field's value: a nested field's structured value, a single
+// value, or an array of multiple values.
+func fieldValue(f *message.Field) interface{} {
+	if f.IsNested() {
+		if v, err := f.NestedValue(); err == nil {
+			return v
+		}
+	}
+	var values []interface{}
+	switch f.GetValueType() {
+	case message.Field_STRING:
+		for _, v := range f.ValueString {
+			values = append(values, v)
+		}
+	case message.Field_BYTES:
+		for _, v := range f.ValueBytes {
+			values = append(values, v)
+		}
+	case message.Field_INTEGER:
+		for _, v := range f.ValueInteger {
+			values = append(values, v)
+		}
+	case message.Field_DOUBLE:
+		for _, v := range f.ValueDouble {
+			values = append(values, v)
+		}
+	case message.Field_BOOL:
+		for _, v := range f.ValueBool {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// Returns the event for a message, using the payload given.
+func (o *SentryOutput) event(msg *message.Message, payload string) map[string]interface{} {
+	id := msg.GetUuid()
+	if len(id) != 16 {
+		id = uuid.NewRandom()
+	}
+	event := map[string]interface{}{
+		"event_id":  hex.EncodeToString(id),
+		"timestamp": float64(msg.GetTimestamp()/1e3) / 1e6,
+		"level":     sentryLevel(msg.GetSeverity()),
+		"platform":  "other",
+	}
+	if logger := msg.GetLogger(); logger != "" {
+		event["logger"] = logger
+	}
+	if hostname := msg.GetHostname(); hostname != "" {
+		event["server_name"] = hostname
+	}
+	if o.conf.Release != "" {
+		event["release"] = o.conf.Release
+	}
+	if o.conf.Environment != "" {
+		event["environment"] = o.conf.Environment
+	}
+
+	firstLine := strings.TrimSpace(payload)
+	if i := strings.IndexAny(firstLine, "\r\n"); i >= 0 {
+		firstLine = strings.TrimSpace(firstLine[:i])
+	}
+	exceptionType := ""
+	if o.conf.ExceptionTypeField != "" {
+		if v, ok := msg.GetFieldValue(o.conf.ExceptionTypeField); ok {
+			exceptionType = fmt.Sprint(v)
+		}
+	}
+	if exceptionType != "" {
+		event["exception"] = map[string]interface{}{
+			"values": []interface{}{map[string]interface{}{
+				"type":  exceptionType,
+				"value": firstLine,
+			}},
+		}
+		if firstLine != payload {
+			event["message"] = map[string]interface{}{"formatted": payload}
+		}
+	} else {
+		event["message"] = map[string]interface{}{"formatted": payload}
+	}
+
+	tags := make(map[string]string)
+	for name, value := range o.conf.Tags {
+		tags[name] = value
+	}
+	extra := make(map[string]interface{})
+	if t := msg.GetType(); t != "" {
+		extra["type"] = t
+	}
+	if msg.Pid != nil {
+		extra["pid"] = msg.GetPid()
+	}
+	for _, f := range msg.Fields {
+		name := f.GetName()
+		if o.tagFields[name] {
+			// Sentry tag values are strings of at most 200 characters.
+			value := fmt.Sprint(fieldValue(f))
+			if len(value) > 200 {
+				value = value[:200]
+			}
+			tags[name] = value
+		} else if name != o.conf.ExceptionTypeField {
+			extra[name] = fieldValue(f)
+		}
+	}
+	if len(tags) > 0 {
+		event["tags"] = tags
+	}
+	if len(extra) > 0 {
+		event["extra"] = extra
+	}
+
+	if len(o.conf.FingerprintFields) > 0 {
+		fingerprint := make([]string, 0, len(o.conf.FingerprintFields))
+		for _, name := range o.conf.FingerprintFields {
+			v, _ := msg.GetFieldValue(name)
+			if v == nil {
+				fingerprint = append(fingerprint, "")
+			} else {
+				fingerprint = append(fingerprint, fmt.Sprint(v))
+			}
+		}
+		event["fingerprint"] = fingerprint
+	}
+	return event
+}
+
+func (o *SentryOutput) ProcessMessage(pack *PipelinePack) error {
+	msg := pack.Message
+	if msg.GetSeverity() > o.conf.MaxSeverity {
+		atomic.AddInt64(&o.eventsSkipped, 1)
+		o.or.UpdateCursor(pack.QueueCursor)
+		return nil
+	}
+	now := time.Now()
+	if now.Before(o.limitedUntil) || (o.bucket != nil && !o.bucket.take(now)) {
+		atomic.AddInt64(&o.rateLimited, 1)
+		o.or.UpdateCursor(pack.QueueCursor)
+		return nil
+	}
+	payload := msg.GetPayload()
+	if o.or.Encoder() != nil {
+		body, err := o.or.Encode(pack)
+		if err != nil || body == nil {
+			o.or.UpdateCursor(pack.QueueCursor)
+			if err != nil {
+				return fmt.Errorf("can't encode: %s", err)
+			}
+			return nil
+		}
+		payload = string(body)
+	}
+	err := o.send(o.event(msg, payload), now)
+	if err != nil {
+		if _, ok := err.(refusedError); ok {
+			o.or.UpdateCursor(pack.QueueCursor)
+			return err
+		}
+		atomic.AddInt64(&o.sendFailures, 1)
+		return NewRetryMessageError("%s", err)
+	}
+	o.or.UpdateCursor(pack.QueueCursor)
+	return nil
+}
+
+// An event Sentry refused, which sending again won't help.
+type refusedError struct {
+	error
+}
+
+// Sends an event in an envelope. Events Sentry refuses for its rate limits
+// are dropped, with no more sent until its Retry-After time.
+func (o *SentryOutput) send(event map[string]interface{}, now time.Time) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return refusedError{fmt.Errorf("can't encode event: %s", err)}
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `{"event_id":%q,"sent_at":%q}`+"\n", event["event_id"],
+		now.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&body, `{"type":"event","length":%d}`+"\n", len(data))
+	body.Write(data)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequest("POST", o.dsn.envelopeUrl, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", o.dsn.authHeader(now))
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		atomic.AddInt64(&o.eventsSent, 1)
+		return nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		io.Copy(ioutil.Discard, resp.Body)
+		wait := time.Minute
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(secs) * time.Second
+		}
+		o.limitedUntil = now.Add(wait)
+		atomic.AddInt64(&o.rateLimited, 1)
+		return nil
+	}
+	text, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("request failed: %s: %s", resp.Status, bytes.TrimSpace(text))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return refusedError{err}
+	}
+	return err
+}
+
+func (o *SentryOutput) CleanUp() {}
+
+func (o *SentryOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "EventsSent", atomic.LoadInt64(&o.eventsSent), "count")
+	message.NewInt64Field(msg, "RateLimited", atomic.LoadInt64(&o.rateLimited), "count")
+	message.NewInt64Field(msg, "SendFailures", atomic.LoadInt64(&o.sendFailures), "count")
+	message.NewInt64Field(msg, "EventsSkipped", atomic.LoadInt64(&o.eventsSkipped), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("SentryOutput", func() interface{} {
+		return new(SentryOutput)
+	})
+}
@@ -0,0 +1,74 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"errors"
+
+	. "heka/pipeline"
+)
+
+type SeverityDecoderConfig struct {
+	SeverityInferrerConfig
+	// Severity given to messages none is inferred for. Defaults to -1, which
+	// leaves them as they are.
+	DefaultSeverity int32 `toml:"default_severity"`
+	// Whether messages which already have a severity are left as they are.
+	KeepExisting bool `toml:"keep_existing"`
+}
+
+// Sets the severity of messages with free-form payloads from the level
+// names, syslog priority, HTTP status or stack traces found in them. Usually
+// used in a MultiDecoder after the decoder parsing the payload.
+type SeverityDecoder struct {
+	conf     *SeverityDecoderConfig
+	inferrer *SeverityInferrer
+}
+
+func (sd *SeverityDecoder) ConfigStruct() interface{} {
+	return &SeverityDecoderConfig{
+		SeverityInferrerConfig: NewSeverityInferrerConfig(),
+		DefaultSeverity:        -1,
+	}
+}
+
+func (sd *SeverityDecoder) Init(config interface{}) error {
+	sd.conf = config.(*SeverityDecoderConfig)
+	if sd.conf.DefaultSeverity < -1 || sd.conf.DefaultSeverity > 7 {
+		return errors.New("default_severity must be between -1 and 7")
+	}
+	sd.inferrer = NewSeverityInferrer(sd.conf.SeverityInferrerConfig)
+	return nil
+}
+
+func (sd *SeverityDecoder) Decode(pack *PipelinePack) (packs []*PipelinePack, err error) {
+	packs = []*PipelinePack{pack}
+	msg := pack.Message
+	if sd.conf.KeepExisting && msg.Severity != nil {
+		return
+	}
+	if severity, ok := sd.inferrer.Infer(msg.GetPayload()); ok {
+		msg.SetSeverity(severity)
+	} else if sd.conf.DefaultSeverity >= 0 {
+		msg.SetSeverity(sd.conf.DefaultSeverity)
+	}
+	return
+}
+
+func init() {
+	RegisterPlugin("SeverityDecoder", func() interface{} {
+		return new(SeverityDecoder)
+	})
+}
@@ -0,0 +1,100 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"strings"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+)
+
+func SeverityDecoderSpec(c gs.Context) {
+	c.Specify("A SeverityDecoder", func() {
+		decoder := new(SeverityDecoder)
+		config := decoder.ConfigStruct().(*SeverityDecoderConfig)
+		pack := NewPipelinePack(make(chan *PipelinePack, 1))
+
+		decode := func(payload string) int32 {
+			c.Assume(decoder.Init(config), gs.IsNil)
+			pack.Message.SetPayload(payload)
+			packs, err := decoder.Decode(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(packs), gs.Equals, 1)
+			return pack.Message.GetSeverity()
+		}
+
+		c.Specify("uses syslog priorities", func() {
+			c.Expect(decode("<11>Jan  1 00:00:00 host app: INFO started"), gs.Equals,
+				int32(3))
+		})
+
+		c.Specify("uses level names", func() {
+			cases := map[string]int32{
+				"2015-03-04 10:00:00 ERROR [main] connection refused":     3,
+				"2015-03-04T10:00:00Z [warn] retrying":                    4,
+				"ts=2015-03-04T10:00:00Z level=debug msg=\"hello ERROR\"": 7,
+				`{"time":"2015-03-04","level":"crit","msg":"boom"}`:       2,
+				`{"name":"app","level":50,"msg":"failed"}`:                3,
+				"Mar 04, 2015 10:00:00 AM Foo bar\nSEVERE: gave up":       3,
+				"<info> listening on :8080":                               6,
+			}
+			for payload, severity := range cases {
+				c.Expect(decode(payload), gs.Equals, severity)
+			}
+		})
+
+		c.Specify("doesn't use level names in running text", func() {
+			c.Expect(decode("the error_count is 0, no error occurred"), gs.Equals, int32(7))
+		})
+
+		c.Specify("uses HTTP statuses", func() {
+			line := `10.0.0.1 - - [04/Mar/2015:10:00:00 +0000] "GET /a HTTP/1.1" %s 12 "-" "curl"`
+			c.Expect(decode(strings.Replace(line, "%s", "503", 1)), gs.Equals, int32(3))
+			c.Expect(decode(strings.Replace(line, "%s", "404", 1)), gs.Equals, int32(4))
+			c.Expect(decode(strings.Replace(line, "%s", "200", 1)), gs.Equals, int32(6))
+		})
+
+		c.Specify("makes stack traces errors", func() {
+			c.Expect(decode("java.lang.NullPointerException: x\n"+
+				"\tat com.example.Foo.bar(Foo.java:10)\n"), gs.Equals, int32(3))
+			c.Expect(decode("INFO request failed\nTraceback (most recent call last):\n"+
+				"  File \"a.py\", line 1\n"), gs.Equals, int32(3))
+			c.Expect(decode("FATAL out of memory\ngoroutine 1 [running]:\n"), gs.Equals,
+				int32(2))
+		})
+
+		c.Specify("only uses the enabled heuristics", func() {
+			config.LevelTokens = false
+			c.Expect(decode("WARNING low disk"), gs.Equals, int32(7))
+		})
+
+		c.Specify("sets the default severity", func() {
+			config.DefaultSeverity = 6
+			c.Expect(decode("nothing to see"), gs.Equals, int32(6))
+		})
+
+		c.Specify("keeps existing severities if asked to", func() {
+			config.KeepExisting = true
+			pack.Message.SetSeverity(5)
+			c.Expect(decode("ERROR oops"), gs.Equals, int32(5))
+		})
+
+		c.Specify("rejects a bad default severity", func() {
+			config.DefaultSeverity = 8
+			c.Expect(decoder.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
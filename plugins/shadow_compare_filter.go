@@ -0,0 +1,126 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type ShadowCompareFilterConfig struct {
+	// Name of the primary output, the one with the `shadow` option set.
+	Output string
+	// Seconds a sampled message may wait to be encoded by both outputs
+	// before it's counted as missing from one of them. Defaults to 60.
+	MaxWait uint `toml:"max_wait"`
+	// Defaults to matching nothing, the comparisons come from the outputs.
+	MessageMatcher string `toml:"message_matcher"`
+	// Defaults to reporting every 60 seconds.
+	TickerInterval uint `toml:"ticker_interval"`
+}
+
+// Filter that periodically reports how the messages copied from an output to
+// its shadow compare between the two, as a `heka.shadow-compare` message.
+type ShadowCompareFilter struct {
+	conf    *ShadowCompareFilterConfig
+	tracker *ShadowTracker
+}
+
+func (s *ShadowCompareFilter) ConfigStruct() interface{} {
+	return &ShadowCompareFilterConfig{
+		MaxWait:        60,
+		MessageMatcher: "FALSE",
+		TickerInterval: 60,
+	}
+}
+
+func (s *ShadowCompareFilter) Init(config interface{}) error {
+	s.conf = config.(*ShadowCompareFilterConfig)
+	if s.conf.Output == "" {
+		return fmt.Errorf("output must be set")
+	}
+	return nil
+}
+
+func (s *ShadowCompareFilter) Run(fr FilterRunner, h PluginHelper) (err error) {
+	inChan := fr.InChan()
+	ticker := fr.Ticker()
+
+	var (
+		ok   = true
+		pack *PipelinePack
+	)
+	for ok {
+		select {
+		case pack, ok = <-inChan:
+			if !ok {
+				break
+			}
+			fr.UpdateCursor(pack.QueueCursor)
+			pack.Recycle(nil)
+		case <-ticker:
+			s.report(fr, h)
+		}
+	}
+	return
+}
+
+func (s *ShadowCompareFilter) report(fr FilterRunner, h PluginHelper) {
+	if s.tracker == nil {
+		// Looked up here, the outputs are started after the filters.
+		tracker, ok := h.PipelineConfig().ShadowTracker(s.conf.Output)
+		if !ok {
+			fr.LogError(fmt.Errorf("output '%s' has no shadow", s.conf.Output))
+			return
+		}
+		s.tracker = tracker
+	}
+	s.tracker.Sweep(time.Duration(s.conf.MaxWait) * time.Second)
+	stats := s.tracker.Stats()
+
+	pack, err := h.PipelinePack(0)
+	if err != nil {
+		fr.LogError(err)
+		return
+	}
+	msg := pack.Message
+	msg.SetLogger(fr.Name())
+	msg.SetType("heka.shadow-compare")
+	message.NewStringField(msg, "Primary", s.tracker.Primary)
+	message.NewStringField(msg, "Shadow", s.tracker.Shadow)
+	message.NewInt64Field(msg, "Sampled", stats.Sampled, "count")
+	message.NewInt64Field(msg, "Compared", stats.Compared, "count")
+	message.NewInt64Field(msg, "Diverged", stats.Diverged, "count")
+	message.NewInt64Field(msg, "MissingShadow", stats.MissingShadow, "count")
+	message.NewInt64Field(msg, "MissingPrimary", stats.MissingPrimary, "count")
+	message.NewInt64Field(msg, "Unencoded", stats.Unencoded, "count")
+	message.NewInt64Field(msg, "Skipped", stats.Skipped, "count")
+	message.NewInt64Field(msg, "Pending", stats.Pending, "count")
+	if len(stats.Divergent) > 0 {
+		msg.SetPayload(fmt.Sprintf("Latest divergent messages: %s",
+			strings.Join(stats.Divergent, ", ")))
+	}
+	fr.Inject(pack)
+}
+
+func init() {
+	RegisterPlugin("ShadowCompareFilter", func() interface{} {
+		return new(ShadowCompareFilter)
+	})
+}
@@ -0,0 +1,67 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func ShadowCompareFilterSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A ShadowCompareFilter", func() {
+		filter := new(ShadowCompareFilter)
+		config := filter.ConfigStruct().(*ShadowCompareFilterConfig)
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		h.EXPECT().PipelineConfig().Return(pConfig).AnyTimes()
+		fr := pipelinemock.NewMockFilterRunner(ctrl)
+
+		c.Specify("requires an output", func() {
+			c.Expect(filter.Init(config), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("logs an error for an output without a shadow", func() {
+			config.Output = "Primary"
+			c.Assume(filter.Init(config), gs.IsNil)
+
+			inChan := make(chan *PipelinePack)
+			tickChan := make(chan time.Time)
+			fr.EXPECT().InChan().Return(inChan)
+			fr.EXPECT().Ticker().Return(tickChan)
+			logged := make(chan error, 1)
+			fr.EXPECT().LogError(gomock.Any()).Do(func(err error) {
+				logged <- err
+			})
+
+			done := make(chan error)
+			go func() {
+				done <- filter.Run(fr, h)
+			}()
+			tickChan <- time.Now()
+			c.Expect((<-logged).Error(), gs.Equals, "output 'Primary' has no shadow")
+			close(inChan)
+			c.Expect(<-done, gs.IsNil)
+		})
+	})
+}
@@ -0,0 +1,138 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package snmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER tags of the ASN.1 and SNMP types traps are built from.
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagOid         = 0x06
+	tagSequence    = 0x30
+	tagCounter32   = 0x41
+	tagGauge32     = 0x42
+	tagTimeTicks   = 0x43
+	tagCounter64   = 0x46
+	tagTrapV2      = 0xa7
+)
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// Returns the length of the tag and length octets of a TLV with n octets of
+// content.
+func headerLength(n int) int {
+	return 1 + len(berLength(n))
+}
+
+// Encodes a TLV, its content being concatenated.
+func tlv(tag byte, content ...[]byte) []byte {
+	n := 0
+	for _, c := range content {
+		n += len(c)
+	}
+	b := make([]byte, 0, headerLength(n)+n)
+	b = append(append(b, tag), berLength(n)...)
+	for _, c := range content {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// Encodes a two's complement integer in as few octets as it needs.
+func berInteger(tag byte, v int64) []byte {
+	b := []byte{byte(v)}
+	for v>>7 != 0 && v>>7 != -1 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return tlv(tag, b)
+}
+
+// Encodes an unsigned integer, which needs a leading zero octet if its high
+// bit is set.
+func berUnsigned(tag byte, v uint64) []byte {
+	b := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return tlv(tag, b)
+}
+
+func berOctets(b []byte) []byte {
+	return tlv(tagOctetString, b)
+}
+
+// Parses an OID in dotted decimal notation, with or without a leading dot.
+func parseOid(s string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("OID '%s' has fewer than two arcs", s)
+	}
+	oid := make([]uint32, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad OID '%s'", s)
+		}
+		oid[i] = uint32(n)
+	}
+	if oid[0] > 2 || (oid[0] < 2 && oid[1] >= 40) {
+		return nil, fmt.Errorf("bad OID '%s'", s)
+	}
+	return oid, nil
+}
+
+func berOid(oid []uint32) []byte {
+	var b []byte
+	arc := func(n uint32) {
+		enc := []byte{byte(n & 0x7f)}
+		for n >>= 7; n > 0; n >>= 7 {
+			enc = append([]byte{0x80 | byte(n&0x7f)}, enc...)
+		}
+		b = append(b, enc...)
+	}
+	arc(oid[0]*40 + oid[1])
+	for _, n := range oid[2:] {
+		arc(n)
+	}
+	return tlv(tagOid, b)
+}
+
+// Orders OIDs lexicographically by arc, as SNMP agents list them.
+func oidLess(a, b []uint32) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,362 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package snmp
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+var (
+	// sysUpTime.0 and snmpTrapOID.0, the first variable bindings of every
+	// SNMPv2 trap.
+	sysUpTimeOid   = []uint32{1, 3, 6, 1, 2, 1, 1, 3, 0}
+	snmpTrapOidOid = []uint32{1, 3, 6, 1, 6, 3, 1, 1, 4, 1, 0}
+)
+
+// The largest UDP datagram traps may be sent in.
+const maxTrapSize = 65507
+
+type SnmpTrapOutputConfig struct {
+	// UDP address traps are sent to. Defaults to "127.0.0.1:162".
+	Address string `toml:"address"`
+	// "2c" or "3".
+	Version string `toml:"version"`
+	// SNMPv2c community. Defaults to "public".
+	Community string `toml:"community"`
+	// OID identifying the notification, and a field overriding it.
+	TrapOid      string `toml:"trap_oid"`
+	TrapOidField string `toml:"trap_oid_field"`
+	// OIDs of the variable bindings, by the message header or field whose
+	// value they're bound to.
+	Oids map[string]string `toml:"oids"`
+	// SNMP types of the values, by header or field name: "integer",
+	// "string", "counter32", "gauge32", "timeticks" or "counter64". Values
+	// without one are typed by their field's type.
+	Types map[string]string `toml:"types"`
+
+	// SNMPv3 user, and the hex engine ID traps are sent as.
+	User     string `toml:"user"`
+	EngineId string `toml:"engine_id"`
+	// "MD5" or "SHA", if traps are authenticated.
+	AuthProtocol   string `toml:"auth_protocol"`
+	AuthPassphrase string `toml:"auth_passphrase"`
+	// "AES", if traps are encrypted.
+	PrivProtocol   string `toml:"priv_protocol"`
+	PrivPassphrase string `toml:"priv_passphrase"`
+}
+
+// A variable binding, of an OID to a message header or field.
+type varBind struct {
+	oid  []uint32
+	name string
+	kind string
+}
+
+// Output plugin that sends SNMPv2c or SNMPv3 traps, binding OIDs to the values
+// of message headers and fields, for network operations centers that only
+// consume traps.
+type SnmpTrapOutput struct {
+	conf     *SnmpTrapOutputConfig
+	or       OutputRunner
+	trapOid  []uint32
+	bindings []varBind
+	usm      *usm
+	started  time.Time
+	conn     net.Conn
+	// Request IDs of the PDUs and, in SNMPv3, message IDs.
+	requestId int32
+
+	// Accessed atomically, for the reports.
+	trapsSent    int64
+	sendFailures int64
+	trapsDropped int64
+}
+
+func (o *SnmpTrapOutput) ConfigStruct() interface{} {
+	return &SnmpTrapOutputConfig{
+		Address:   "127.0.0.1:162",
+		Version:   "2c",
+		Community: "public",
+	}
+}
+
+func (o *SnmpTrapOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*SnmpTrapOutputConfig)
+	if o.conf.TrapOid == "" && o.conf.TrapOidField == "" {
+		return errors.New("trap_oid or trap_oid_field must be set")
+	}
+	if o.conf.TrapOid != "" {
+		if o.trapOid, err = parseOid(o.conf.TrapOid); err != nil {
+			return fmt.Errorf("trap_oid: %s", err)
+		}
+	}
+	o.bindings = make([]varBind, 0, len(o.conf.Oids))
+	for name, s := range o.conf.Oids {
+		b := varBind{name: name, kind: o.conf.Types[name]}
+		if b.oid, err = parseOid(s); err != nil {
+			return fmt.Errorf("oids: %s", err)
+		}
+		switch b.kind {
+		case "", "integer", "string", "counter32", "gauge32", "timeticks", "counter64":
+		default:
+			return fmt.Errorf("unknown type '%s' of '%s'", b.kind, name)
+		}
+		o.bindings = append(o.bindings, b)
+	}
+	sort.Slice(o.bindings, func(i, j int) bool {
+		return oidLess(o.bindings[i].oid, o.bindings[j].oid)
+	})
+
+	switch o.conf.Version {
+	case "2c":
+	case "3":
+		if o.conf.User == "" {
+			return errors.New("SNMPv3 needs a user")
+		}
+		engineId, err := hex.DecodeString(o.conf.EngineId)
+		if err != nil || len(engineId) < 5 || len(engineId) > 32 {
+			return errors.New("SNMPv3 needs an engine_id of 5 to 32 hex octets")
+		}
+		o.usm, err = newUsm(engineId, o.conf.User, o.conf.AuthProtocol,
+			o.conf.AuthPassphrase, o.conf.PrivProtocol, o.conf.PrivPassphrase)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown version '%s'", o.conf.Version)
+	}
+	o.started = time.Now()
+	o.requestId = rand.Int31()
+	return nil
+}
+
+func (o *SnmpTrapOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	o.or = or
+	return nil
+}
+
+// Returns the value of a message header or field.
+func messageValue(msg *message.Message, name string) (interface{}, bool) {
+	switch name {
+	case "Type":
+		return msg.GetType(), true
+	case "Logger":
+		return msg.GetLogger(), true
+	case "Hostname":
+		return msg.GetHostname(), true
+	case "Payload":
+		return msg.GetPayload(), true
+	case "Severity":
+		return int64(msg.GetSeverity()), true
+	case "Pid":
+		return int64(msg.GetPid()), true
+	case "Uuid":
+		return msg.GetUuidString(), true
+	case "Timestamp":
+		return msg.GetTimestamp(), true
+	}
+	return msg.GetFieldValue(name)
+}
+
+// Encodes a value as the SNMP type kind, or if kind is empty the type best
+// suited to the value.
+func encodeValue(v interface{}, kind string) ([]byte, error) {
+	if kind == "" {
+		switch v := v.(type) {
+		case int64:
+			if v >= math.MinInt32 && v <= math.MaxInt32 {
+				return berInteger(tagInteger, v), nil
+			}
+			if v > 0 {
+				return berUnsigned(tagCounter64, uint64(v)), nil
+			}
+		case bool:
+			// A TruthValue.
+			if v {
+				return berInteger(tagInteger, 1), nil
+			}
+			return berInteger(tagInteger, 2), nil
+		case []byte:
+			return berOctets(v), nil
+		}
+		return berOctets([]byte(fmt.Sprint(v))), nil
+	}
+	if kind == "string" {
+		if b, ok := v.([]byte); ok {
+			return berOctets(b), nil
+		}
+		return berOctets([]byte(fmt.Sprint(v))), nil
+	}
+
+	var n int64
+	switch v := v.(type) {
+	case int64:
+		n = v
+	case float64:
+		n = int64(v)
+	case bool:
+		n = 2
+		if v {
+			n = 1
+		}
+	default:
+		var err error
+		if n, err = strconv.ParseInt(fmt.Sprint(v), 10, 64); err != nil {
+			return nil, fmt.Errorf("'%v' isn't a number", v)
+		}
+	}
+	switch kind {
+	case "integer":
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, fmt.Errorf("%d is out of an integer's range", n)
+		}
+		return berInteger(tagInteger, n), nil
+	case "counter64":
+		if n < 0 {
+			return nil, fmt.Errorf("%d is out of a counter64's range", n)
+		}
+		return berUnsigned(tagCounter64, uint64(n)), nil
+	}
+	if n < 0 || n > math.MaxUint32 {
+		return nil, fmt.Errorf("%d is out of a %s's range", n, kind)
+	}
+	tag := map[string]byte{
+		"counter32": tagCounter32,
+		"gauge32":   tagGauge32,
+		"timeticks": tagTimeTicks,
+	}[kind]
+	return berUnsigned(tag, uint64(n)), nil
+}
+
+// Returns the trap PDU of a message, binding the OIDs of the message's
+// headers and fields. Those the message doesn't have are left out.
+func (o *SnmpTrapOutput) pdu(msg *message.Message, requestId int32) ([]byte, error) {
+	trapOid := o.trapOid
+	if o.conf.TrapOidField != "" {
+		if v, ok := msg.GetFieldValue(o.conf.TrapOidField); ok {
+			var err error
+			if trapOid, err = parseOid(fmt.Sprint(v)); err != nil {
+				return nil, fmt.Errorf("%s: %s", o.conf.TrapOidField, err)
+			}
+		}
+	}
+	if trapOid == nil {
+		return nil, fmt.Errorf("message has no %s field", o.conf.TrapOidField)
+	}
+
+	// Time since the output started, in hundredths of a second.
+	upTime := uint64(time.Since(o.started)/(10*time.Millisecond)) % (math.MaxUint32 + 1)
+	bindings := [][]byte{
+		tlv(tagSequence, berOid(sysUpTimeOid), berUnsigned(tagTimeTicks, upTime)),
+		tlv(tagSequence, berOid(snmpTrapOidOid), berOid(trapOid)),
+	}
+	for _, b := range o.bindings {
+		v, ok := messageValue(msg, b.name)
+		if !ok {
+			continue
+		}
+		value, err := encodeValue(v, b.kind)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", b.name, err)
+		}
+		bindings = append(bindings, tlv(tagSequence, berOid(b.oid), value))
+	}
+	return tlv(tagTrapV2, berInteger(tagInteger, int64(requestId)),
+		berInteger(tagInteger, 0), berInteger(tagInteger, 0),
+		tlv(tagSequence, bindings...)), nil
+}
+
+// Returns the trap of a message, in an SNMPv2c or SNMPv3 message.
+func (o *SnmpTrapOutput) trap(msg *message.Message) ([]byte, error) {
+	o.requestId = (o.requestId + 1) & math.MaxInt32
+	pdu, err := o.pdu(msg, o.requestId)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	if o.usm != nil {
+		if data, err = o.usm.message(int64(o.requestId), pdu); err != nil {
+			return nil, err
+		}
+	} else {
+		data = tlv(tagSequence, berInteger(tagInteger, 1),
+			berOctets([]byte(o.conf.Community)), pdu)
+	}
+	if len(data) > maxTrapSize {
+		return nil, fmt.Errorf("trap of %d bytes is too big", len(data))
+	}
+	return data, nil
+}
+
+func (o *SnmpTrapOutput) send(data []byte) (err error) {
+	if o.conn == nil {
+		if o.conn, err = net.Dial("udp", o.conf.Address); err != nil {
+			return err
+		}
+	}
+	if _, err = o.conn.Write(data); err != nil {
+		o.conn.Close()
+		o.conn = nil
+	}
+	return err
+}
+
+func (o *SnmpTrapOutput) ProcessMessage(pack *PipelinePack) error {
+	data, err := o.trap(pack.Message)
+	if err != nil {
+		atomic.AddInt64(&o.trapsDropped, 1)
+		o.or.UpdateCursor(pack.QueueCursor)
+		return fmt.Errorf("can't build trap: %s", err)
+	}
+	if err = o.send(data); err != nil {
+		atomic.AddInt64(&o.sendFailures, 1)
+		return NewRetryMessageError("can't send trap: %s", err)
+	}
+	atomic.AddInt64(&o.trapsSent, 1)
+	o.or.UpdateCursor(pack.QueueCursor)
+	return nil
+}
+
+func (o *SnmpTrapOutput) CleanUp() {
+	if o.conn != nil {
+		o.conn.Close()
+		o.conn = nil
+	}
+}
+
+func (o *SnmpTrapOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "TrapsSent", atomic.LoadInt64(&o.trapsSent), "count")
+	message.NewInt64Field(msg, "SendFailures", atomic.LoadInt64(&o.sendFailures), "count")
+	message.NewInt64Field(msg, "TrapsDropped", atomic.LoadInt64(&o.trapsDropped), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("SnmpTrapOutput", func() interface{} {
+		return new(SnmpTrapOutput)
+	})
+}
@@ -0,0 +1,295 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package snmp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+// A decoded TLV, with the TLVs it contains if it's constructed.
+type node struct {
+	tag      byte
+	content  []byte
+	children []node
+}
+
+func decode(b []byte) (n node, rest []byte) {
+	n.tag = b[0]
+	length, b := int(b[1]), b[2:]
+	if length&0x80 != 0 {
+		octets := length & 0x7f
+		length = 0
+		for _, o := range b[:octets] {
+			length = length<<8 | int(o)
+		}
+		b = b[octets:]
+	}
+	n.content, rest = b[:length], b[length:]
+	if n.tag&0x20 != 0 {
+		for c := n.content; len(c) > 0; {
+			var child node
+			child, c = decode(c)
+			n.children = append(n.children, child)
+		}
+	}
+	return n, rest
+}
+
+func (n node) integer() int64 {
+	v := int64(int8(n.content[0]))
+	for _, o := range n.content[1:] {
+		v = v<<8 | int64(o)
+	}
+	return v
+}
+
+func unhex(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
+
+func SnmpTrapOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("BER encoding", func() {
+		c.Expect(bytes.Equal(berInteger(tagInteger, 0), []byte{2, 1, 0}), gs.IsTrue)
+		c.Expect(bytes.Equal(berInteger(tagInteger, 128), []byte{2, 2, 0, 0x80}), gs.IsTrue)
+		c.Expect(bytes.Equal(berInteger(tagInteger, -129), []byte{2, 2, 0xff, 0x7f}),
+			gs.IsTrue)
+		c.Expect(bytes.Equal(berUnsigned(tagCounter32, 0xffffffff),
+			[]byte{0x41, 5, 0, 0xff, 0xff, 0xff, 0xff}), gs.IsTrue)
+		c.Expect(bytes.Equal(berLength(300), []byte{0x82, 1, 0x2c}), gs.IsTrue)
+
+		oid, err := parseOid(".1.3.6.1.4.1.8072")
+		c.Expect(err, gs.IsNil)
+		c.Expect(bytes.Equal(berOid(oid), unhex("06072b06010401bf08")), gs.IsTrue)
+		for _, bad := range []string{"1", "1.3.x", "3.1", "1.40"} {
+			_, err = parseOid(bad)
+			c.Expect(err, gs.Not(gs.IsNil))
+		}
+		c.Expect(oidLess([]uint32{1, 3, 6, 2}, []uint32{1, 3, 6, 10}), gs.IsTrue)
+		c.Expect(oidLess([]uint32{1, 3, 6, 1}, []uint32{1, 3, 6}), gs.IsFalse)
+	})
+
+	c.Specify("Localized keys match RFC 3414", func() {
+		engineId := unhex("000000000000000000000002")
+		c.Expect(hex.EncodeToString(passwordToKey(md5.New, "maplesyrup", engineId)),
+			gs.Equals, "526f5eed9fcce26f8964c2930787d82b")
+		c.Expect(hex.EncodeToString(passwordToKey(sha1.New, "maplesyrup", engineId)),
+			gs.Equals, "6695febc9288e36282235fc7151f128497b38f3f")
+	})
+
+	c.Specify("A SnmpTrapOutput", func() {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		c.Assume(err, gs.IsNil)
+		defer conn.Close()
+		receive := func() node {
+			buf := make([]byte, 65536)
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, _, err := conn.ReadFrom(buf)
+			c.Assume(err, gs.IsNil)
+			msg, rest := decode(buf[:n])
+			c.Expect(len(rest), gs.Equals, 0)
+			return msg
+		}
+
+		output := new(SnmpTrapOutput)
+		config := output.ConfigStruct().(*SnmpTrapOutputConfig)
+		config.Address = conn.LocalAddr().String()
+		config.TrapOid = "1.3.6.1.4.1.99999.0.1"
+		config.Oids = map[string]string{
+			"Payload":  "1.3.6.1.4.1.99999.1.2",
+			"Hostname": "1.3.6.1.4.1.99999.1.1",
+			"status":   "1.3.6.1.4.1.99999.1.3",
+			"bytes":    "1.3.6.1.4.1.99999.1.4",
+			"missing":  "1.3.6.1.4.1.99999.1.5",
+		}
+		config.Types = map[string]string{"bytes": "counter32"}
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		var cursor string
+		or.EXPECT().UpdateCursor(gomock.Any()).Do(func(c string) {
+			cursor = c
+		}).AnyTimes()
+
+		pack := NewPipelinePack(nil)
+		pack.Message.SetHostname("switch1")
+		pack.Message.SetPayload("link down")
+		message.NewInt64Field(pack.Message, "status", -1, "")
+		message.NewStringField(pack.Message, "bytes", "1024")
+		pack.QueueCursor = "c1"
+
+		checkPdu := func(pdu node) {
+			c.Expect(pdu.tag, gs.Equals, byte(tagTrapV2))
+			c.Expect(len(pdu.children), gs.Equals, 4)
+			bindings := pdu.children[3].children
+			c.Expect(len(bindings), gs.Equals, 6)
+			c.Expect(bindings[0].children[1].tag, gs.Equals, byte(tagTimeTicks))
+			oid, _ := parseOid(config.TrapOid)
+			c.Expect(bytes.Equal(bindings[1].children[1].content, berOid(oid)[2:]),
+				gs.IsTrue)
+			// Bound in order of their OIDs.
+			c.Expect(string(bindings[2].children[1].content), gs.Equals, "switch1")
+			c.Expect(string(bindings[3].children[1].content), gs.Equals, "link down")
+			c.Expect(bindings[4].children[1].integer(), gs.Equals, int64(-1))
+			c.Expect(bindings[5].children[1].tag, gs.Equals, byte(tagCounter32))
+			c.Expect(bindings[5].children[1].integer(), gs.Equals, int64(1024))
+		}
+
+		c.Specify("sends SNMPv2c traps", func() {
+			config.Community = "noc"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+
+			msg := receive()
+			c.Expect(msg.children[0].integer(), gs.Equals, int64(1))
+			c.Expect(string(msg.children[1].content), gs.Equals, "noc")
+			checkPdu(msg.children[2])
+			output.CleanUp()
+		})
+
+		c.Specify("takes the trap OID from a field", func() {
+			config.TrapOid = ""
+			config.TrapOidField = "trap"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			err := output.ProcessMessage(pack)
+			c.Expect(err, gs.Not(gs.IsNil))
+			_, ok := err.(RetryMessageError)
+			c.Expect(ok, gs.IsFalse)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(output.trapsDropped, gs.Equals, int64(1))
+
+			config.TrapOid = "1.3.6.1.4.1.99999.0.2"
+			message.NewStringField(pack.Message, "trap", config.TrapOid)
+			pack.QueueCursor = "c2"
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c2")
+			checkPdu(receive().children[2])
+		})
+
+		c.Specify("sends authenticated and encrypted SNMPv3 traps", func() {
+			config.Version = "3"
+			config.User = "heka"
+			config.EngineId = "8000000001020304"
+			config.AuthProtocol = "SHA"
+			config.AuthPassphrase = "authpassphrase"
+			config.PrivProtocol = "AES"
+			config.PrivPassphrase = "privpassphrase"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+
+			buf := make([]byte, 65536)
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, _, err := conn.ReadFrom(buf)
+			c.Assume(err, gs.IsNil)
+			raw := buf[:n]
+			msg, _ := decode(raw)
+			c.Expect(msg.children[0].integer(), gs.Equals, int64(3))
+			global := msg.children[1].children
+			c.Expect(global[2].content[0], gs.Equals, byte(3))
+			c.Expect(global[3].integer(), gs.Equals, int64(usmSecurityModel))
+			secParams, _ := decode(msg.children[2].content)
+			engineId := unhex(config.EngineId)
+			c.Expect(bytes.Equal(secParams.children[0].content, engineId), gs.IsTrue)
+			c.Expect(string(secParams.children[3].content), gs.Equals, "heka")
+
+			// The digest is of the message with zeroed authentication
+			// parameters.
+			authParams := secParams.children[4].content
+			c.Expect(len(authParams), gs.Equals, 12)
+			digest := append([]byte(nil), authParams...)
+			zeroed := append([]byte(nil), raw...)
+			i := bytes.Index(zeroed, digest)
+			copy(zeroed[i:i+12], make([]byte, 12))
+			mac := hmac.New(sha1.New, passwordToKey(sha1.New, "authpassphrase", engineId))
+			mac.Write(zeroed)
+			c.Expect(bytes.Equal(mac.Sum(nil)[:12], digest), gs.IsTrue)
+
+			iv := make([]byte, 8, aes.BlockSize)
+			binary.BigEndian.PutUint32(iv, uint32(secParams.children[1].integer()))
+			binary.BigEndian.PutUint32(iv[4:], uint32(secParams.children[2].integer()))
+			iv = append(iv, secParams.children[5].content...)
+			block, _ := aes.NewCipher(
+				passwordToKey(sha1.New, "privpassphrase", engineId)[:aes.BlockSize])
+			encrypted := msg.children[3].content
+			scoped := make([]byte, len(encrypted))
+			cipher.NewCFBDecrypter(block, iv).XORKeyStream(scoped, encrypted)
+			scopedPdu, _ := decode(scoped)
+			c.Expect(bytes.Equal(scopedPdu.children[0].content, engineId), gs.IsTrue)
+			checkPdu(scopedPdu.children[2])
+		})
+
+		c.Specify("checks its settings", func() {
+			config.TrapOid = "1.3.x"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.TrapOid = "1.3.6.1.4.1.99999.0.1"
+			config.Types["bytes"] = "float"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			delete(config.Types, "bytes")
+			config.Version = "1"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.Version = "3"
+			config.User = "heka"
+			config.EngineId = "80"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.EngineId = "8000000001020304"
+			config.PrivProtocol = "AES"
+			config.PrivPassphrase = "privpassphrase"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.AuthProtocol = "MD5"
+			config.AuthPassphrase = "short"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.AuthPassphrase = "authpassphrase"
+			c.Expect(output.Init(config), gs.IsNil)
+		})
+
+		c.Specify("refuses MD5 authentication in FIPS mode", func() {
+			SetFipsMode(true)
+			defer SetFipsMode(false)
+			config.Version = "3"
+			config.User = "heka"
+			config.EngineId = "8000000001020304"
+			config.AuthProtocol = "MD5"
+			config.AuthPassphrase = "authpassphrase"
+			err := output.Init(config)
+			c.Assume(err, gs.Not(gs.IsNil))
+			c.Expect(err.Error(), gs.Equals, "auth_protocol 'MD5' isn't allowed in FIPS mode")
+			config.AuthProtocol = "SHA"
+			c.Expect(output.Init(config), gs.IsNil)
+		})
+	})
+}
@@ -0,0 +1,172 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package snmp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"time"
+
+	"heka/pipeline"
+)
+
+// Security model number of the User-based Security Model (RFC 3414).
+const usmSecurityModel = 3
+
+// The User-based Security Model of SNMPv3, authenticating traps with
+// HMAC-MD5-96 or HMAC-SHA-96 and encrypting them with AES-128 (RFC 3826). As
+// the sender of traps Heka is the authoritative engine, so it is identified by
+// its own engine ID.
+type usm struct {
+	engineId []byte
+	user     string
+	boots    int64
+	started  time.Time
+	// Nil for noAuthNoPriv.
+	authHash func() hash.Hash
+	authKey  []byte
+	// Nil for authNoPriv.
+	privKey []byte
+	salt    uint64
+}
+
+func newUsm(engineId []byte, user, authProtocol, authPassphrase, privProtocol,
+	privPassphrase string) (*usm, error) {
+
+	u := &usm{
+		engineId: engineId,
+		user:     user,
+		boots:    1,
+		started:  time.Now(),
+	}
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	u.salt = binary.BigEndian.Uint64(salt)
+	switch authProtocol {
+	case "":
+	case "MD5":
+		if pipeline.FipsMode() {
+			return nil, fmt.Errorf("auth_protocol 'MD5' isn't allowed in FIPS mode")
+		}
+		u.authHash = md5.New
+	case "SHA":
+		u.authHash = sha1.New
+	default:
+		return nil, fmt.Errorf("unknown auth_protocol '%s'", authProtocol)
+	}
+	if u.authHash != nil {
+		if len(authPassphrase) < 8 {
+			return nil, fmt.Errorf("auth_passphrase must have at least 8 characters")
+		}
+		u.authKey = passwordToKey(u.authHash, authPassphrase, engineId)
+	}
+	switch privProtocol {
+	case "":
+	case "AES":
+		if u.authHash == nil {
+			return nil, fmt.Errorf("priv_protocol needs an auth_protocol")
+		}
+		if len(privPassphrase) < 8 {
+			return nil, fmt.Errorf("priv_passphrase must have at least 8 characters")
+		}
+		u.privKey = passwordToKey(u.authHash, privPassphrase, engineId)[:aes.BlockSize]
+	default:
+		return nil, fmt.Errorf("unknown priv_protocol '%s'", privProtocol)
+	}
+	return u, nil
+}
+
+// Localizes a passphrase's key to an engine, as specified by RFC 3414 A.2.
+func passwordToKey(newHash func() hash.Hash, password string, engineId []byte) []byte {
+	h := newHash()
+	pw := []byte(password)
+	buf := make([]byte, 64)
+	for i := 0; i < 1048576; i += len(buf) {
+		for j := range buf {
+			buf[j] = pw[(i+j)%len(pw)]
+		}
+		h.Write(buf)
+	}
+	key := h.Sum(nil)
+	h.Reset()
+	h.Write(key)
+	h.Write(engineId)
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+// Returns the message carrying a scoped PDU of the engine's context.
+func (u *usm) message(msgId int64, pdu []byte) ([]byte, error) {
+	engineTime := int64(time.Since(u.started) / time.Second)
+	data := tlv(tagSequence, berOctets(u.engineId), berOctets(nil), pdu)
+	flags := byte(0)
+	var privParams []byte
+	if u.privKey != nil {
+		flags |= 2
+		u.salt++
+		privParams = make([]byte, 8)
+		binary.BigEndian.PutUint64(privParams, u.salt)
+		iv := make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint32(iv, uint32(u.boots))
+		binary.BigEndian.PutUint32(iv[4:], uint32(engineTime))
+		copy(iv[8:], privParams)
+		block, err := aes.NewCipher(u.privKey)
+		if err != nil {
+			return nil, err
+		}
+		encrypted := make([]byte, len(data))
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(encrypted, data)
+		data = berOctets(encrypted)
+	}
+	var authParams []byte
+	if u.authHash != nil {
+		flags |= 1
+		authParams = make([]byte, 12)
+	}
+
+	prefix := bytes.Join([][]byte{berOctets(u.engineId),
+		berInteger(tagInteger, u.boots), berInteger(tagInteger, engineTime),
+		berOctets([]byte(u.user))}, nil)
+	secContent := bytes.Join([][]byte{prefix, berOctets(authParams),
+		berOctets(privParams)}, nil)
+	secParams := tlv(tagSequence, secContent)
+	head := append(berInteger(tagInteger, 3), tlv(tagSequence,
+		berInteger(tagInteger, msgId), berInteger(tagInteger, 65507),
+		berOctets([]byte{flags}), berInteger(tagInteger, usmSecurityModel))...)
+	content := bytes.Join([][]byte{head, berOctets(secParams), data}, nil)
+	msg := tlv(tagSequence, content)
+	if u.authHash == nil {
+		return msg, nil
+	}
+
+	// The digest is of the whole message with zeroed authentication
+	// parameters, which are then replaced by it.
+	offset := headerLength(len(content)) + len(head) + headerLength(len(secParams)) +
+		headerLength(len(secContent)) + len(prefix) + headerLength(len(authParams))
+	mac := hmac.New(u.authHash, u.authKey)
+	mac.Write(msg)
+	copy(msg[offset:offset+12], mac.Sum(nil))
+	return msg, nil
+}
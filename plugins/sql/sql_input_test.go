@@ -0,0 +1,227 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package sql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+// An in-memory table for the "heka_test" driver, whose queries all return
+// the rows with an id greater than their one parameter.
+var testTable = struct {
+	sync.Mutex
+	columns []string
+	rows    [][]driver.Value
+	args    []driver.Value
+}{}
+
+type testDriver struct{}
+
+func (testDriver) Open(name string) (driver.Conn, error) { return testConn{}, nil }
+
+type testConn struct{}
+
+func (testConn) Prepare(query string) (driver.Stmt, error) { return testStmt{}, nil }
+func (testConn) Close() error                              { return nil }
+func (testConn) Begin() (driver.Tx, error)                 { return nil, errors.New("no transactions") }
+
+type testStmt struct{}
+
+func (testStmt) Close() error  { return nil }
+func (testStmt) NumInput() int { return 1 }
+func (testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("read only")
+}
+
+func (testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	testTable.Lock()
+	defer testTable.Unlock()
+	testTable.args = append(testTable.args, args[0])
+	after, ok := args[0].(int64)
+	if !ok {
+		return nil, errors.New("id parameter should be an integer")
+	}
+	rows := &testRows{columns: testTable.columns}
+	for _, row := range testTable.rows {
+		if row[0].(int64) > after {
+			rows.rows = append(rows.rows, row)
+		}
+	}
+	return rows, nil
+}
+
+type testRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *testRows) Columns() []string { return r.columns }
+func (r *testRows) Close() error      { return nil }
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("heka_test", testDriver{})
+}
+
+func SqlInputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tmpDir, err := ioutil.TempDir("", "sql-input-tests")
+	c.Assume(err, gs.IsNil)
+	defer os.RemoveAll(tmpDir)
+	pConfig := NewPipelineConfig(nil)
+	pConfig.Globals.BaseDir = tmpDir
+
+	created := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	testTable.columns = []string{"id", "body", "created", "note"}
+	testTable.rows = [][]driver.Value{
+		{int64(1), []byte("first"), created, nil},
+		{int64(2), []byte("second"), created.Add(time.Minute), "late"},
+	}
+	testTable.args = nil
+
+	c.Specify("A SqlInput", func() {
+		input := new(SqlInput)
+		input.SetPipelineConfig(pConfig)
+		config := input.ConfigStruct().(*SqlInputConfig)
+		config.Driver = "heka_test"
+		config.Query = "SELECT id, body, created, note FROM t WHERE id > $1 ORDER BY id"
+		config.IncrementalColumn = "id"
+
+		c.Specify("rejects a bad config", func() {
+			config.Query = ""
+			err := input.Init(config)
+			c.Expect(err.Error(), gs.Equals, "query must be set")
+
+			config.Query = "SELECT 1"
+			config.Driver = "nosuchdb"
+			err = input.Init(config)
+			c.Expect(err.Error(), gs.Equals, "hekad was built without the 'nosuchdb' "+
+				"driver, rebuild with the 'nosuchdb' build tag")
+		})
+
+		ir := pipelinemock.NewMockInputRunner(ctrl)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		supply := make(chan *PipelinePack, 10)
+		for i := 0; i < 10; i++ {
+			supply <- NewPipelinePack(supply)
+		}
+		delivered := make(chan *PipelinePack, 10)
+		tickChan := make(chan time.Time)
+		ir.EXPECT().Name().Return("SqlInput").AnyTimes()
+		ir.EXPECT().InChan().Return(supply).AnyTimes()
+		ir.EXPECT().Ticker().Return(tickChan).AnyTimes()
+		h.EXPECT().Hostname().Return("somehost").AnyTimes()
+		deliverCall := ir.EXPECT().Deliver(gomock.Any()).AnyTimes()
+		deliverCall.Do(func(pack *PipelinePack) {
+			delivered <- pack
+		})
+		errs := make(chan error, 10)
+		logCall := ir.EXPECT().LogError(gomock.Any()).AnyTimes()
+		logCall.Do(func(err error) {
+			errs <- err
+		})
+
+		// Runs the input for the given number of polls.
+		run := func(polls int) {
+			err := input.Init(config)
+			c.Assume(err, gs.IsNil)
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- input.Run(ir, h)
+			}()
+			for i := 0; i < polls; i++ {
+				tickChan <- time.Now()
+			}
+			// The loop can't take another tick until the last poll is done.
+			// Stopping may cancel the poll that this one starts.
+			tickChan <- time.Now()
+			input.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		}
+
+		c.Specify("delivers a message per row", func() {
+			config.PayloadColumn = "body"
+			config.TimestampColumn = "created"
+			run(1)
+			c.Assume(len(delivered), gs.Equals, 2)
+			pack := <-delivered
+			msg := pack.Message
+			c.Expect(msg.GetType(), gs.Equals, "heka.sql")
+			c.Expect(msg.GetLogger(), gs.Equals, "SqlInput")
+			c.Expect(msg.GetHostname(), gs.Equals, "somehost")
+			c.Expect(msg.GetPayload(), gs.Equals, "first")
+			c.Expect(msg.GetTimestamp(), gs.Equals, created.UnixNano())
+			id, _ := msg.GetFieldValue("id")
+			c.Expect(id, gs.Equals, int64(1))
+			when, _ := msg.GetFieldValue("created")
+			c.Expect(when, gs.Equals, "2015-06-01T12:00:00Z")
+			_, ok := msg.GetFieldValue("body")
+			c.Expect(ok, gs.IsFalse)
+			_, ok = msg.GetFieldValue("note")
+			c.Expect(ok, gs.IsFalse)
+
+			note, _ := (<-delivered).Message.GetFieldValue("note")
+			c.Expect(note, gs.Equals, "late")
+		})
+
+		c.Specify("checkpoints the incremental column", func() {
+			config.InitialValue = "1"
+			run(2)
+			c.Expect(len(delivered), gs.Equals, 1)
+			c.Expect(testTable.args[0], gs.Equals, int64(1))
+			c.Expect(testTable.args[1], gs.Equals, int64(2))
+
+			c.Specify("across restarts", func() {
+				testTable.rows = append(testTable.rows,
+					[]driver.Value{int64(3), []byte("third"), created, nil})
+				input = new(SqlInput)
+				input.SetPipelineConfig(pConfig)
+				run(1)
+				c.Expect(len(delivered), gs.Equals, 2)
+				c.Expect(testTable.args[2], gs.Equals, int64(2))
+			})
+		})
+
+		c.Specify("reports a missing incremental column", func() {
+			config.IncrementalColumn = "seq"
+			run(1)
+			c.Expect(len(delivered), gs.Equals, 0)
+			c.Expect((<-errs).Error(), gs.Equals, "query results have no 'seq' column")
+		})
+	})
+}
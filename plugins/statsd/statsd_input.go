@@ -54,6 +54,9 @@ type StatsdInputConfig struct {
 	// sends a lots in single message of stats it's required to boost this value.
 	// Defaults to 512.
 	MaxMsgSize uint `toml:"max_msg_size"`
+	// Subsection of listening socket settings, such as the address family
+	// and buffer sizes.
+	Socket SocketConfig `toml:"socket"`
 }
 
 func (s *StatsdInput) ConfigStruct() interface{} {
@@ -66,11 +69,18 @@ func (s *StatsdInput) ConfigStruct() interface{} {
 
 func (s *StatsdInput) Init(config interface{}) error {
 	conf := config.(*StatsdInputConfig)
-	udpAddr, err := net.ResolveUDPAddr("udp", conf.Address)
+	network, err := conf.Socket.Network("udp")
+	if err != nil {
+		return err
+	}
+	udpAddr, err := net.ResolveUDPAddr(network, conf.Address)
 	if err != nil {
 		return fmt.Errorf("ResolveUDPAddr failed: %s\n", err.Error())
 	}
-	s.listener, err = net.ListenUDP("udp", udpAddr)
+	var conn net.PacketConn
+	if conn, err = conf.Socket.ListenPacket(network, udpAddr.String(), false); err == nil {
+		s.listener = conn.(*net.UDPConn)
+	}
 	if err != nil {
 		return fmt.Errorf("ListenUDP failed: %s\n", err.Error())
 	}
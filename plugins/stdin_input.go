@@ -0,0 +1,121 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	. "heka/pipeline"
+)
+
+// Input plugin that reads from hekad's standard input, so that hekad can be
+// used as a stage of a shell pipeline.
+type StdinInput struct {
+	conf         *StdinInputConfig
+	drainTimeout time.Duration
+	stopChan     chan struct{}
+	// Replaced by tests.
+	stdin io.Reader
+}
+
+type StdinInputConfig struct {
+	// So we can default to TokenSplitter.
+	Splitter string
+	// Whether to shut hekad down once stdin is closed. Defaults to true.
+	ShutdownOnEof bool `toml:"shutdown_on_eof"`
+	// How long to wait, once stdin is closed, for what was read from it to be
+	// processed before shutting down. Defaults to "30s".
+	EofDrainTimeout string `toml:"eof_drain_timeout"`
+}
+
+func (si *StdinInput) ConfigStruct() interface{} {
+	return &StdinInputConfig{
+		Splitter:        "TokenSplitter",
+		ShutdownOnEof:   true,
+		EofDrainTimeout: "30s",
+	}
+}
+
+func (si *StdinInput) Init(config interface{}) (err error) {
+	si.conf = config.(*StdinInputConfig)
+	if si.drainTimeout, err = time.ParseDuration(si.conf.EofDrainTimeout); err != nil {
+		return fmt.Errorf("can't parse eof_drain_timeout: %s", err)
+	}
+	if si.stdin == nil {
+		si.stdin = os.Stdin
+	}
+	si.stopChan = make(chan struct{})
+	return nil
+}
+
+func (si *StdinInput) Run(ir InputRunner, h PluginHelper) error {
+	sRunner := ir.NewSplitterRunner("")
+	defer sRunner.Done()
+	if !sRunner.UseMsgBytes() {
+		hostname := h.Hostname()
+		sRunner.SetPackDecorator(func(pack *PipelinePack) {
+			pack.Message.SetType("heka.stdin")
+			pack.Message.SetLogger(ir.Name())
+			pack.Message.SetHostname(hostname)
+		})
+	}
+
+	// Reads from stdin can't be interrupted, so a stop while one is blocked
+	// leaves the reader behind.
+	eof := make(chan error, 1)
+	go func() {
+		var err error
+		for err == nil {
+			err = sRunner.SplitStream(si.stdin, nil)
+		}
+		eof <- err
+	}()
+
+	select {
+	case <-si.stopChan:
+		return nil
+	case err := <-eof:
+		if err != io.EOF {
+			ir.LogError(fmt.Errorf("error reading stdin: %s", err))
+		}
+	}
+	if si.conf.ShutdownOnEof {
+		pConfig := h.PipelineConfig()
+		if si.drainTimeout > 0 {
+			for _, desc := range pConfig.Drain(si.drainTimeout) {
+				ir.LogError(fmt.Errorf("stdin closed, undelivered after %s: %s",
+					si.drainTimeout, desc))
+			}
+		}
+		ir.LogMessage("stdin closed, shutting down")
+		pConfig.Globals.ShutDown(0)
+	}
+	// Returning before being stopped would count as the input failing.
+	<-si.stopChan
+	return nil
+}
+
+func (si *StdinInput) Stop() {
+	close(si.stopChan)
+}
+
+func init() {
+	RegisterPlugin("StdinInput", func() interface{} {
+		return new(StdinInput)
+	})
+}
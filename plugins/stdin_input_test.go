@@ -0,0 +1,110 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func StdinInputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A StdinInput", func() {
+		pConfig := NewPipelineConfig(nil)
+		input := &StdinInput{stdin: strings.NewReader("one\ntwo\n")}
+		config := input.ConfigStruct().(*StdinInputConfig)
+
+		c.Specify("rejects a bad eof_drain_timeout", func() {
+			config.EofDrainTimeout = "soon"
+			c.Expect(input.Init(config), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("reading stdin", func() {
+			// The test pipeline's packs aren't all in their pools, so it
+			// never looks drained.
+			config.EofDrainTimeout = "0"
+			ir := pipelinemock.NewMockInputRunner(ctrl)
+			h := pipelinemock.NewMockPluginHelper(ctrl)
+			sr := pipelinemock.NewMockSplitterRunner(ctrl)
+			ir.EXPECT().Name().Return("StdinInput").AnyTimes()
+			ir.EXPECT().LogMessage(gomock.Any()).AnyTimes()
+			h.EXPECT().Hostname().Return("somehost").AnyTimes()
+			h.EXPECT().PipelineConfig().Return(pConfig).AnyTimes()
+			ir.EXPECT().NewSplitterRunner("").Return(sr)
+			sr.EXPECT().UseMsgBytes().Return(false)
+			sr.EXPECT().SetPackDecorator(gomock.Any())
+			sr.EXPECT().Done()
+
+			var read []byte
+			splitCall := sr.EXPECT().SplitStream(gomock.Any(), nil).AnyTimes()
+			splitCall.Do(func(r io.Reader, del Deliverer) {
+				data, _ := ioutil.ReadAll(r)
+				read = append(read, data...)
+			})
+			splitCall.Return(io.EOF)
+
+			run := func() chan error {
+				errChan := make(chan error, 1)
+				go func() {
+					errChan <- input.Run(ir, h)
+				}()
+				return errChan
+			}
+
+			c.Specify("shuts hekad down once stdin is closed", func() {
+				c.Assume(input.Init(config), gs.IsNil)
+				errChan := run()
+				select {
+				case sig := <-pConfig.Globals.SigChan():
+					c.Expect(sig, gs.Equals, os.Signal(syscall.SIGINT))
+				case <-time.After(2 * time.Second):
+					c.Expect("no shutdown", gs.Equals, "")
+				}
+				c.Expect(string(read), gs.Equals, "one\ntwo\n")
+				input.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+			})
+
+			c.Specify("waits to be stopped if shutdown_on_eof is off", func() {
+				config.ShutdownOnEof = false
+				c.Assume(input.Init(config), gs.IsNil)
+				errChan := run()
+				select {
+				case <-pConfig.Globals.SigChan():
+					c.Expect("shutdown", gs.Equals, "")
+				case <-errChan:
+					c.Expect("returned", gs.Equals, "")
+				case <-time.After(50 * time.Millisecond):
+				}
+				input.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+				c.Expect(string(read), gs.Equals, "one\ntwo\n")
+			})
+		})
+	})
+}
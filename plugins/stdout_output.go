@@ -0,0 +1,99 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	. "heka/pipeline"
+)
+
+// Output plugin that writes encoded messages to hekad's standard output, so
+// that hekad can be used as a stage of a shell pipeline. hekad's own log
+// moves to stderr, to keep it out of the output.
+type StdoutOutput struct {
+	conf *StdoutOutputConfig
+	// Replaced by tests.
+	stdout io.Writer
+}
+
+type StdoutOutputConfig struct {
+	// Whether Heka's stream framing is applied to the output, so that another
+	// hekad can read it with a HekaFramingSplitter. Defaults to true if a
+	// ProtobufEncoder is used, false otherwise.
+	UseFraming *bool `toml:"use_framing"`
+}
+
+func (so *StdoutOutput) ConfigStruct() interface{} {
+	return new(StdoutOutputConfig)
+}
+
+func (so *StdoutOutput) Init(config interface{}) error {
+	so.conf = config.(*StdoutOutputConfig)
+	if so.stdout == nil {
+		so.stdout = os.Stdout
+		if LogInfo.Writer() == os.Stdout {
+			LogInfo.SetOutput(os.Stderr)
+		}
+	}
+	return nil
+}
+
+func (so *StdoutOutput) Run(or OutputRunner, h PluginHelper) error {
+	enc := or.Encoder()
+	if enc == nil {
+		return errors.New("Encoder required.")
+	}
+	if so.conf.UseFraming == nil {
+		if _, ok := enc.(*ProtobufEncoder); ok {
+			or.SetUseFraming(true)
+		}
+	}
+
+	inChan := or.InChan()
+	w := bufio.NewWriter(so.stdout)
+	for pack := range inChan {
+		outBytes, err := or.Encode(pack)
+		if err != nil {
+			or.LogError(fmt.Errorf("Error encoding message: %s", err))
+		} else if outBytes != nil {
+			if _, err = w.Write(outBytes); err != nil {
+				pack.Recycle(err)
+				return fmt.Errorf("can't write to stdout: %s", err)
+			}
+		}
+		// Flush whenever there's nothing more to write for now, so that the
+		// next stage of the pipeline isn't kept waiting.
+		if len(inChan) == 0 {
+			if err = w.Flush(); err != nil {
+				pack.Recycle(err)
+				return fmt.Errorf("can't write to stdout: %s", err)
+			}
+		}
+		or.UpdateCursor(pack.QueueCursor)
+		pack.Recycle(nil)
+	}
+	return w.Flush()
+}
+
+func init() {
+	RegisterPlugin("StdoutOutput", func() interface{} {
+		return new(StdoutOutput)
+	})
+}
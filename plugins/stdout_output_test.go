@@ -0,0 +1,66 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"bytes"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func StdoutOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A StdoutOutput", func() {
+		var out bytes.Buffer
+		output := &StdoutOutput{stdout: &out}
+		config := output.ConfigStruct().(*StdoutOutputConfig)
+		c.Assume(output.Init(config), gs.IsNil)
+
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		inChan := make(chan *PipelinePack, 2)
+		or.EXPECT().InChan().Return(inChan).AnyTimes()
+		or.EXPECT().UpdateCursor(gomock.Any()).AnyTimes()
+
+		c.Specify("requires an encoder", func() {
+			or.EXPECT().Encoder().Return(nil)
+			c.Expect(output.Run(or, h), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("writes the encoded messages", func() {
+			encoder := new(PayloadEncoder)
+			encoder.Init(encoder.ConfigStruct())
+			or.EXPECT().Encoder().Return(encoder)
+			recycle := make(chan *PipelinePack, 2)
+			for _, payload := range []string{"one\n", "two\n"} {
+				pack := NewPipelinePack(recycle)
+				pack.Message.SetPayload(payload)
+				or.EXPECT().Encode(pack).Return([]byte(payload), nil)
+				inChan <- pack
+			}
+			close(inChan)
+			c.Expect(output.Run(or, h), gs.IsNil)
+			c.Expect(out.String(), gs.Equals, "one\ntwo\n")
+			c.Expect(len(recycle), gs.Equals, 2)
+		})
+	})
+}
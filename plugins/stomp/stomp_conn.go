@@ -0,0 +1,346 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"heka/plugins/tcp"
+)
+
+// Connection settings shared by the STOMP input and output.
+type StompConnConfig struct {
+	// Broker's "host:port".
+	Address string `toml:"address"`
+	UseTls  bool   `toml:"use_tls"`
+	Tls     tcp.TlsConfig
+	// Virtual host sent in the CONNECT frame's host header. Defaults to the
+	// address's host.
+	Vhost    string `toml:"vhost"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// Milliseconds between the heart-beats each end sends, 0 for none.
+	// Defaults to 10000.
+	Heartbeat uint `toml:"heartbeat"`
+	// Seconds to wait for the broker to connect or answer. Defaults to 10.
+	Timeout uint `toml:"timeout"`
+}
+
+// A header of a frame.
+type stompHeader struct {
+	name, value string
+}
+
+// A STOMP 1.2 frame.
+type stompFrame struct {
+	command string
+	header  []stompHeader
+	body    []byte
+}
+
+// Returns the value of the frame's first header of the name, which takes
+// precedence over any repeats.
+func (f *stompFrame) get(name string) string {
+	for _, h := range f.header {
+		if h.name == name {
+			return h.value
+		}
+	}
+	return ""
+}
+
+func (f *stompFrame) add(name, value string) {
+	f.header = append(f.header, stompHeader{name, value})
+}
+
+var (
+	headerEscaper = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n",
+		":", "\\c")
+	headerUnescaper = strings.NewReplacer("\\\\", "\\", "\\r", "\r", "\\n", "\n",
+		"\\c", ":")
+)
+
+// Encodes the frame, with a content-length header if it has a body. Headers
+// of CONNECT and CONNECTED frames aren't escaped, as 1.0 brokers expect.
+func (f *stompFrame) encode(w *bufio.Writer) error {
+	escape := f.command != "CONNECT" && f.command != "CONNECTED"
+	w.WriteString(f.command)
+	w.WriteByte('\n')
+	for _, h := range f.header {
+		if escape {
+			w.WriteString(headerEscaper.Replace(h.name))
+			w.WriteByte(':')
+			w.WriteString(headerEscaper.Replace(h.value))
+		} else {
+			w.WriteString(h.name)
+			w.WriteByte(':')
+			w.WriteString(h.value)
+		}
+		w.WriteByte('\n')
+	}
+	if len(f.body) > 0 {
+		w.WriteString("content-length:")
+		w.WriteString(strconv.Itoa(len(f.body)))
+		w.WriteByte('\n')
+	}
+	w.WriteByte('\n')
+	w.Write(f.body)
+	return w.WriteByte(0)
+}
+
+// Reads a line, without its EOL.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line[:len(line)-1], "\r"), nil
+}
+
+// Reads the next frame, skipping heart-beats. Bodies longer than maxBody
+// are an error.
+func readFrame(r *bufio.Reader, maxBody int) (*stompFrame, error) {
+	f := new(stompFrame)
+	for f.command == "" {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		f.command = line
+	}
+	unescape := f.command != "CONNECT" && f.command != "CONNECTED"
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("malformed %s header '%s'", f.command, line)
+		}
+		name, value := line[:i], line[i+1:]
+		if unescape {
+			name, value = headerUnescaper.Replace(name), headerUnescaper.Replace(value)
+		}
+		f.add(name, value)
+	}
+
+	if length := f.get("content-length"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bad content-length '%s'", length)
+		}
+		if n > maxBody {
+			return nil, fmt.Errorf("%s body of %d bytes is too large", f.command, n)
+		}
+		f.body = make([]byte, n+1)
+		if _, err = io.ReadFull(r, f.body); err != nil {
+			return nil, err
+		}
+		if f.body[n] != 0 {
+			return nil, errors.New("frame isn't NUL terminated")
+		}
+		f.body = f.body[:n]
+		return f, nil
+	}
+	var body bytes.Buffer
+	for {
+		chunk, err := r.ReadSlice(0)
+		if err == bufio.ErrBufferFull {
+			body.Write(chunk)
+		} else if err != nil {
+			return nil, err
+		} else {
+			body.Write(chunk[:len(chunk)-1])
+			break
+		}
+		if body.Len() > maxBody {
+			return nil, fmt.Errorf("%s body is too large", f.command)
+		}
+	}
+	f.body = body.Bytes()
+	return f, nil
+}
+
+// A connection to a STOMP broker. Frames may be sent from several
+// goroutines, but only one may receive.
+type stompConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	writeLock sync.Mutex
+	writer    *bufio.Writer
+	// How long the broker may be silent before the connection's considered
+	// dead, 0 for no limit.
+	readTimeout time.Duration
+	maxBody     int
+	closeOnce   sync.Once
+	closed      chan bool
+}
+
+// Connects and logs in, negotiating STOMP 1.2 and the heart-beats.
+func dialStomp(conf *StompConnConfig, tlsConf *tls.Config, maxBody int) (
+	*stompConn, error) {
+
+	timeout := time.Duration(conf.Timeout) * time.Second
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if tlsConf != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", conf.Address, tlsConf)
+	} else {
+		conn, err = dialer.Dial("tcp", conf.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &stompConn{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		writer:  bufio.NewWriter(conn),
+		maxBody: maxBody,
+		closed:  make(chan bool),
+	}
+
+	vhost := conf.Vhost
+	if vhost == "" {
+		vhost, _, _ = net.SplitHostPort(conf.Address)
+	}
+	connect := &stompFrame{command: "CONNECT"}
+	connect.add("accept-version", "1.2")
+	connect.add("host", vhost)
+	if conf.Username != "" {
+		connect.add("login", conf.Username)
+		connect.add("passcode", conf.Password)
+	}
+	connect.add("heart-beat", fmt.Sprintf("%d,%d", conf.Heartbeat, conf.Heartbeat))
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err = c.send(connect); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reply, err := readFrame(c.reader, maxBody)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("no CONNECTED frame: %s", err)
+	}
+	if reply.command == "ERROR" {
+		conn.Close()
+		return nil, fmt.Errorf("broker refused the connection: %s", frameError(reply))
+	}
+	if reply.command != "CONNECTED" {
+		conn.Close()
+		return nil, fmt.Errorf("expected CONNECTED frame, got %s", reply.command)
+	}
+	conn.SetDeadline(time.Time{})
+	if version := reply.get("version"); version != "1.2" {
+		conn.Close()
+		return nil, fmt.Errorf("broker speaks STOMP %s, not 1.2", version)
+	}
+
+	// Each end beats at the slower of the rate it offers and the other wants.
+	var sx, sy uint64
+	fmt.Sscanf(reply.get("heart-beat"), "%d,%d", &sx, &sy)
+	if conf.Heartbeat > 0 && sy > 0 {
+		interval := time.Duration(max(uint64(conf.Heartbeat), sy)) * time.Millisecond
+		go c.beat(interval)
+	}
+	if conf.Heartbeat > 0 && sx > 0 {
+		// Allowing for the beats' latency.
+		c.readTimeout = 2 * time.Duration(max(uint64(conf.Heartbeat), sx)) *
+			time.Millisecond
+	}
+	return c, nil
+}
+
+func max(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Sends an EOL heart-beat every interval until the connection's closed.
+func (c *stompConn) beat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.writeLock.Lock()
+			c.writer.WriteByte('\n')
+			err := c.writer.Flush()
+			c.writeLock.Unlock()
+			if err != nil {
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *stompConn) send(f *stompFrame) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	f.encode(c.writer)
+	return c.writer.Flush()
+}
+
+// Receives the next frame, failing if the broker's heart-beats stop.
+func (c *stompConn) receive() (*stompFrame, error) {
+	if c.readTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	return readFrame(c.reader, c.maxBody)
+}
+
+// Sends a DISCONNECT and closes the connection.
+func (c *stompConn) disconnect(timeout time.Duration) {
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	c.send(&stompFrame{command: "DISCONNECT"})
+	c.close()
+}
+
+func (c *stompConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
+}
+
+// Returns the error an ERROR frame reports.
+func frameError(f *stompFrame) string {
+	msg := f.get("message")
+	if body := strings.TrimSpace(string(f.body)); body != "" {
+		if msg != "" {
+			msg += ": "
+		}
+		msg += body
+	}
+	return msg
+}
@@ -0,0 +1,240 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+// A test broker, recording the frames its clients send. Subscribers get the
+// queued messages, and sends with a refused body get an ERROR.
+type stompBroker struct {
+	listener net.Listener
+	lock     sync.Mutex
+	frames   []*stompFrame
+	queue    []string
+	refuse   string
+	// Connections are closed, without receipts, after this many sends.
+	dropAfter int
+	conns     int
+}
+
+func newStompBroker() *stompBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	b := &stompBroker{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *stompBroker) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *stompBroker) close() {
+	b.listener.Close()
+}
+
+// Returns the commands, and for SENDs and ACKs their body or id, of the
+// frames received so far.
+func (b *stompBroker) received() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var parts []string
+	for _, f := range b.frames {
+		switch f.command {
+		case "SEND":
+			parts = append(parts, "SEND "+string(f.body))
+		case "ACK", "NACK":
+			parts = append(parts, f.command+" "+f.get("id"))
+		default:
+			parts = append(parts, f.command)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (b *stompBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	reader, writer := bufio.NewReader(conn), bufio.NewWriter(conn)
+	reply := func(f *stompFrame) {
+		f.encode(writer)
+		writer.Flush()
+	}
+	b.lock.Lock()
+	b.conns++
+	b.lock.Unlock()
+	sends := 0
+	for {
+		f, err := readFrame(reader, 1024)
+		if err != nil {
+			return
+		}
+		b.lock.Lock()
+		b.frames = append(b.frames, f)
+		b.lock.Unlock()
+		switch f.command {
+		case "CONNECT":
+			if f.get("passcode") == "wrong" {
+				reply(&stompFrame{command: "ERROR",
+					header: []stompHeader{{"message", "bad login"}}})
+				return
+			}
+			reply(&stompFrame{command: "CONNECTED", header: []stompHeader{
+				{"version", "1.2"}, {"heart-beat", "0,0"}}})
+		case "SUBSCRIBE":
+			b.lock.Lock()
+			queue := b.queue
+			b.queue = nil
+			b.lock.Unlock()
+			for n, body := range queue {
+				msg := &stompFrame{command: "MESSAGE", body: []byte(body)}
+				msg.add("subscription", f.get("id"))
+				msg.add("message-id", fmt.Sprintf("m%d", n))
+				msg.add("destination", f.get("destination"))
+				msg.add("ack", fmt.Sprintf("a%d", n))
+				msg.add("content-type", "text/plain")
+				msg.add("priority", "4")
+				reply(msg)
+			}
+		case "SEND":
+			sends++
+			b.lock.Lock()
+			refuse, dropAfter := b.refuse, b.dropAfter
+			b.lock.Unlock()
+			if dropAfter > 0 && sends > dropAfter {
+				b.lock.Lock()
+				b.dropAfter = 0
+				b.lock.Unlock()
+				return
+			}
+			if refuse != "" && string(f.body) == refuse {
+				reply(&stompFrame{command: "ERROR", header: []stompHeader{
+					{"receipt-id", f.get("receipt")}, {"message", "refused"}}})
+				return
+			}
+			reply(&stompFrame{command: "RECEIPT",
+				header: []stompHeader{{"receipt-id", f.get("receipt")}}})
+		case "DISCONNECT":
+			return
+		}
+	}
+}
+
+func StompConnSpec(c gs.Context) {
+	c.Specify("A STOMP frame", func() {
+		f := &stompFrame{command: "SEND", body: []byte("body\x00?")}
+		f.add("destination", "/queue/a:b")
+		f.add("note", "line\nbreak\\")
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		f.encode(w)
+		w.Flush()
+
+		c.Specify("is encoded with escaped headers and a content-length", func() {
+			c.Expect(buf.String(), gs.Equals, "SEND\ndestination:/queue/a\\cb\n"+
+				"note:line\\nbreak\\\\\ncontent-length:6\n\nbody\x00?\x00")
+		})
+
+		c.Specify("is decoded, after heart-beats", func() {
+			r := bufio.NewReader(strings.NewReader("\n\r\n" + buf.String() +
+				"\nMESSAGE\r\nack:1\r\n\r\nno length\x00"))
+			decoded, err := readFrame(r, 100)
+			c.Assume(err, gs.IsNil)
+			c.Expect(decoded.command, gs.Equals, "SEND")
+			c.Expect(decoded.get("destination"), gs.Equals, "/queue/a:b")
+			c.Expect(decoded.get("note"), gs.Equals, "line\nbreak\\")
+			c.Expect(string(decoded.body), gs.Equals, "body\x00?")
+			decoded, err = readFrame(r, 100)
+			c.Assume(err, gs.IsNil)
+			c.Expect(decoded.command, gs.Equals, "MESSAGE")
+			c.Expect(decoded.get("ack"), gs.Equals, "1")
+			c.Expect(string(decoded.body), gs.Equals, "no length")
+		})
+
+		c.Specify("with too large a body is refused", func() {
+			_, err := readFrame(bufio.NewReader(&buf), 3)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+
+	c.Specify("A STOMP connection", func() {
+		broker := newStompBroker()
+		defer broker.close()
+		conf := &StompConnConfig{Address: broker.addr(), Username: "heka",
+			Password: "secret", Heartbeat: 1000, Timeout: 5}
+
+		c.Specify("logs in", func() {
+			conn, err := dialStomp(conf, nil, 1024)
+			c.Assume(err, gs.IsNil)
+			conn.disconnect(time.Second)
+			broker.lock.Lock()
+			connect := broker.frames[0]
+			broker.lock.Unlock()
+			c.Expect(connect.get("accept-version"), gs.Equals, "1.2")
+			c.Expect(connect.get("login"), gs.Equals, "heka")
+			c.Expect(connect.get("host"), gs.Equals, "127.0.0.1")
+			c.Expect(connect.get("heart-beat"), gs.Equals, "1000,1000")
+		})
+
+		c.Specify("reports a refused login", func() {
+			conf.Password = "wrong"
+			_, err := dialStomp(conf, nil, 1024)
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(strings.Contains(err.Error(), "bad login"), gs.IsTrue)
+		})
+	})
+
+	c.Specify("The STOMP settings", func() {
+		config := new(StompOutput).ConfigStruct().(*StompOutputConfig)
+		_, err := toml.Decode(`
+			address = "broker:61613"
+			username = "heka"
+			destination = "/queue/logs"
+			[tls]
+			server_name = "broker"
+			[headers]
+			expires = "60000"
+		`, config)
+		c.Assume(err, gs.IsNil)
+
+		c.Specify("are decoded from the plugin's section", func() {
+			c.Expect(config.Address, gs.Equals, "broker:61613")
+			c.Expect(config.Username, gs.Equals, "heka")
+			c.Expect(config.Tls.ServerName, gs.Equals, "broker")
+			c.Expect(config.Heartbeat, gs.Equals, uint(10000))
+			c.Expect(config.Headers["expires"], gs.Equals, "60000")
+		})
+	})
+}
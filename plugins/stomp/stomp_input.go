@@ -0,0 +1,205 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package stomp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+	"heka/plugins/tcp"
+)
+
+type StompInputConfig struct {
+	StompConnConfig
+	// Queue or topic subscribed to, e.g. "/queue/logs".
+	Destination string `toml:"destination"`
+	// Extra SUBSCRIBE frame headers, for broker specific settings such as
+	// ActiveMQ's "activemq.prefetchSize".
+	SubscribeHeaders map[string]string `toml:"subscribe_headers"`
+	Splitter         string
+}
+
+// Headers of MESSAGE frames that aren't copied to message fields.
+var messageFrameHeaders = map[string]bool{
+	"destination":    true,
+	"message-id":     true,
+	"subscription":   true,
+	"ack":            true,
+	"content-length": true,
+	"content-type":   true,
+}
+
+// Input plugin that subscribes to a STOMP destination, acking each message
+// once it's been delivered to the router.
+type StompInput struct {
+	conf     *StompInputConfig
+	name     string
+	tlsConf  *tls.Config
+	stopChan chan bool
+
+	// Accessed atomically, for the reports.
+	processMessageCount    int64
+	processMessageFailures int64
+}
+
+func (i *StompInput) ConfigStruct() interface{} {
+	return &StompInputConfig{
+		StompConnConfig: StompConnConfig{Heartbeat: 10000, Timeout: 10},
+		Splitter:        "NullSplitter",
+	}
+}
+
+func (i *StompInput) SetName(name string) {
+	i.name = name
+}
+
+func (i *StompInput) Init(config interface{}) (err error) {
+	i.conf = config.(*StompInputConfig)
+	if i.conf.Address == "" {
+		return errors.New("address must be set")
+	}
+	if i.conf.Destination == "" {
+		return errors.New("destination must be set")
+	}
+	if i.conf.UseTls {
+		if i.tlsConf, err = tcp.CreateGoTlsConfig(&i.conf.Tls); err != nil {
+			return fmt.Errorf("TLS init error: %s", err)
+		}
+	}
+	i.stopChan = make(chan bool)
+	return nil
+}
+
+func (i *StompInput) Run(ir InputRunner, h PluginHelper) (err error) {
+	conn, err := dialStomp(&i.conf.StompConnConfig, i.tlsConf,
+		int(message.MAX_MESSAGE_SIZE))
+	if err != nil {
+		return fmt.Errorf("can't connect to %s: %s", i.conf.Address, err)
+	}
+	sub := &stompFrame{command: "SUBSCRIBE"}
+	sub.add("id", "0")
+	sub.add("destination", i.conf.Destination)
+	sub.add("ack", "client-individual")
+	for name, value := range i.conf.SubscribeHeaders {
+		sub.add(name, value)
+	}
+	if err = conn.send(sub); err != nil {
+		conn.close()
+		return fmt.Errorf("can't subscribe to '%s': %s", i.conf.Destination, err)
+	}
+
+	hostname := h.PipelineConfig().Hostname()
+	sRunner := ir.NewSplitterRunner("")
+	defer sRunner.Done()
+	var frame *stompFrame
+	if !sRunner.UseMsgBytes() {
+		sRunner.SetPackDecorator(func(pack *PipelinePack) {
+			pack.Message.SetType("heka.stomp")
+			pack.Message.SetLogger(i.name)
+			pack.Message.SetHostname(hostname)
+			message.NewStringField(pack.Message, "Destination", frame.get("destination"))
+			message.NewStringField(pack.Message, "MessageId", frame.get("message-id"))
+			if contentType := frame.get("content-type"); contentType != "" {
+				message.NewStringField(pack.Message, "ContentType", contentType)
+			}
+			seen := make(map[string]bool)
+			for _, h := range frame.header {
+				if !messageFrameHeaders[h.name] && !seen[h.name] {
+					message.NewStringField(pack.Message, h.name, h.value)
+					seen[h.name] = true
+				}
+			}
+		})
+	}
+
+	frames := make(chan *stompFrame)
+	errChan := make(chan error, 1)
+	go func() {
+		for {
+			f, err := conn.receive()
+			if err != nil {
+				errChan <- err
+				return
+			}
+			select {
+			case frames <- f:
+			case <-conn.closed:
+				return
+			}
+		}
+	}()
+	defer conn.disconnect(time.Duration(i.conf.Timeout) * time.Second)
+
+	for {
+		select {
+		case frame = <-frames:
+		case err = <-errChan:
+			return fmt.Errorf("connection to %s failed: %s", i.conf.Address, err)
+		case <-i.stopChan:
+			return nil
+		}
+		switch frame.command {
+		case "MESSAGE":
+		case "ERROR":
+			return fmt.Errorf("broker error: %s", frameError(frame))
+		default:
+			continue
+		}
+
+		atomic.AddInt64(&i.processMessageCount, 1)
+		ack := &stompFrame{command: "ACK"}
+		n, err := sRunner.SplitBytes(frame.body, nil)
+		if err != nil {
+			// Let the broker redeliver it, or dead letter it.
+			atomic.AddInt64(&i.processMessageFailures, 1)
+			ir.LogError(fmt.Errorf("nacked message %s: %s", frame.get("message-id"), err))
+			ack.command = "NACK"
+		} else if n > 0 && n != len(frame.body) {
+			ir.LogError(fmt.Errorf("extra data dropped in message %s",
+				frame.get("message-id")))
+		}
+		ack.add("id", frame.get("ack"))
+		if err = conn.send(ack); err != nil {
+			return fmt.Errorf("can't ack message %s: %s", frame.get("message-id"), err)
+		}
+	}
+}
+
+func (i *StompInput) Stop() {
+	close(i.stopChan)
+}
+
+func (i *StompInput) CleanupForRestart() {
+	i.stopChan = make(chan bool)
+}
+
+func (i *StompInput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "ProcessMessageCount",
+		atomic.LoadInt64(&i.processMessageCount), "count")
+	message.NewInt64Field(msg, "ProcessMessageFailures",
+		atomic.LoadInt64(&i.processMessageFailures), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("StompInput", func() interface{} {
+		return new(StompInput)
+	})
+}
@@ -0,0 +1,141 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package stomp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+// Waits up to a second for the broker to have received the frames.
+func waitReceived(broker *stompBroker, frames string) string {
+	for start := time.Now(); time.Since(start) < time.Second; {
+		if broker.received() == frames {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return broker.received()
+}
+
+func StompInputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A StompInput", func() {
+		broker := newStompBroker()
+		defer broker.close()
+		broker.queue = []string{"one", "two"}
+
+		input := new(StompInput)
+		input.SetName("Stomp")
+		config := input.ConfigStruct().(*StompInputConfig)
+		config.Address = broker.addr()
+		config.Destination = "/queue/logs"
+		config.SubscribeHeaders = map[string]string{"activemq.prefetchSize": "10"}
+
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		ir := pipelinemock.NewMockInputRunner(ctrl)
+		delivered := make(chan *PipelinePack, 2)
+		var splitErr error
+
+		run := func() chan error {
+			h.EXPECT().PipelineConfig().Return(pConfig)
+			sr := pipelinemock.NewMockSplitterRunner(ctrl)
+			ir.EXPECT().NewSplitterRunner("").Return(sr)
+			sr.EXPECT().UseMsgBytes().Return(false)
+			var decorate func(*PipelinePack)
+			sr.EXPECT().SetPackDecorator(gomock.Any()).Do(func(f func(*PipelinePack)) {
+				decorate = f
+			})
+			sr.EXPECT().SplitBytes(gomock.Any(), nil).Do(func(data []byte, del Deliverer) {
+				pack := NewPipelinePack(nil)
+				pack.Message.SetPayload(string(data))
+				decorate(pack)
+				delivered <- pack
+			}).Return(0, splitErr).Times(2)
+			sr.EXPECT().Done()
+
+			c.Assume(input.Init(config), gs.IsNil)
+			done := make(chan error, 1)
+			go func() {
+				done <- input.Run(ir, h)
+			}()
+			return done
+		}
+
+		c.Specify("delivers messages and acks them", func() {
+			done := run()
+			pack := <-delivered
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "one")
+			c.Expect(pack.Message.GetType(), gs.Equals, "heka.stomp")
+			c.Expect(pack.Message.GetLogger(), gs.Equals, "Stomp")
+			value, _ := pack.Message.GetFieldValue("Destination")
+			c.Expect(value, gs.Equals, "/queue/logs")
+			value, _ = pack.Message.GetFieldValue("MessageId")
+			c.Expect(value, gs.Equals, "m0")
+			value, _ = pack.Message.GetFieldValue("ContentType")
+			c.Expect(value, gs.Equals, "text/plain")
+			value, _ = pack.Message.GetFieldValue("priority")
+			c.Expect(value, gs.Equals, "4")
+			c.Expect(pack.Message.FindFirstField("ack") == nil, gs.IsTrue)
+			pack = <-delivered
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "two")
+
+			c.Expect(waitReceived(broker, "CONNECT,SUBSCRIBE,ACK a0,ACK a1"), gs.Equals,
+				"CONNECT,SUBSCRIBE,ACK a0,ACK a1")
+			broker.lock.Lock()
+			sub := broker.frames[1]
+			broker.lock.Unlock()
+			c.Expect(sub.get("ack"), gs.Equals, "client-individual")
+			c.Expect(sub.get("activemq.prefetchSize"), gs.Equals, "10")
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+			c.Expect(waitReceived(broker, "CONNECT,SUBSCRIBE,ACK a0,ACK a1,DISCONNECT"),
+				gs.Equals, "CONNECT,SUBSCRIBE,ACK a0,ACK a1,DISCONNECT")
+		})
+
+		c.Specify("nacks messages it can't deliver", func() {
+			splitErr = errors.New("no good")
+			ir.EXPECT().LogError(gomock.Any()).Times(2)
+			done := run()
+			<-delivered
+			<-delivered
+			c.Expect(waitReceived(broker, "CONNECT,SUBSCRIBE,NACK a0,NACK a1"), gs.Equals,
+				"CONNECT,SUBSCRIBE,NACK a0,NACK a1")
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+		})
+
+		c.Specify("fails when the broker goes away", func() {
+			config.Address = "127.0.0.1:1"
+			c.Assume(input.Init(config), gs.IsNil)
+			c.Expect(input.Run(ir, h), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("needs a destination", func() {
+			config.Destination = ""
+			c.Expect(input.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,340 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package stomp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+	"heka/plugins/tcp"
+)
+
+type StompOutputConfig struct {
+	StompConnConfig
+	// Queue or topic sent to, e.g. "/queue/logs".
+	Destination string `toml:"destination"`
+	// Content type of the messages. Defaults to "application/octet-stream".
+	ContentType string `toml:"content_type"`
+	// Whether brokers should keep the messages on disk, with a
+	// "persistent:true" header as ActiveMQ and Artemis expect.
+	Persistent bool `toml:"persistent"`
+	// Extra SEND frame headers.
+	Headers map[string]string `toml:"headers"`
+	// Most messages sent without the broker's receipt. Defaults to 100.
+	MaxUnconfirmed uint `toml:"max_unconfirmed"`
+	// Seconds between waits for the receipts of the messages sent. Defaults
+	// to 1.
+	TickerInterval uint `toml:"ticker_interval"`
+}
+
+// A message sent that the broker hasn't given a receipt for yet.
+type unconfirmed struct {
+	body   []byte
+	cursor string
+}
+
+// Output plugin that sends messages to a STOMP destination, asking for the
+// broker's receipt for each. Messages without one are sent again when the
+// output reconnects.
+type StompOutput struct {
+	conf    *StompOutputConfig
+	tlsConf *tls.Config
+	or      OutputRunner
+	conn    *stompConn
+
+	// The messages sent and not yet confirmed, in order, the id of the
+	// first, and the error that ended the connection they were sent on. The
+	// cursor is the last confirmed message's, dirty until it's been updated.
+	lock      sync.Mutex
+	confirmed *sync.Cond
+	pending   []unconfirmed
+	firstId   int64
+	connErr   error
+	cursor    string
+	dirty     bool
+
+	// Accessed atomically, for the reports.
+	messagesSent     int64
+	messagesRejected int64
+	reconnects       int64
+}
+
+func (o *StompOutput) ConfigStruct() interface{} {
+	return &StompOutputConfig{
+		StompConnConfig: StompConnConfig{Heartbeat: 10000, Timeout: 10},
+		ContentType:     "application/octet-stream",
+		MaxUnconfirmed:  100,
+		TickerInterval:  1,
+	}
+}
+
+func (o *StompOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*StompOutputConfig)
+	if o.conf.Address == "" {
+		return errors.New("address must be set")
+	}
+	if o.conf.Destination == "" {
+		return errors.New("destination must be set")
+	}
+	if o.conf.MaxUnconfirmed == 0 {
+		return errors.New("max_unconfirmed must be greater than 0")
+	}
+	if o.conf.UseTls {
+		if o.tlsConf, err = tcp.CreateGoTlsConfig(&o.conf.Tls); err != nil {
+			return fmt.Errorf("TLS init error: %s", err)
+		}
+	}
+	o.confirmed = sync.NewCond(&o.lock)
+	return nil
+}
+
+func (o *StompOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	if or.Encoder() == nil {
+		return errors.New("an encoder must be specified")
+	}
+	o.or = or
+	return nil
+}
+
+// Returns the SEND frame for a message, asking for a receipt with its id.
+func (o *StompOutput) sendFrame(body []byte, id int64) *stompFrame {
+	f := &stompFrame{command: "SEND", body: body}
+	f.add("destination", o.conf.Destination)
+	f.add("content-type", o.conf.ContentType)
+	if o.conf.Persistent {
+		f.add("persistent", "true")
+	}
+	for name, value := range o.conf.Headers {
+		f.add(name, value)
+	}
+	f.add("receipt", strconv.FormatInt(id, 10))
+	return f
+}
+
+// Reads the connection's receipts, confirming the messages up to each, until
+// it fails.
+func (o *StompOutput) readReceipts(conn *stompConn) {
+	for {
+		f, err := conn.receive()
+		if err == nil && f.command == "ERROR" {
+			err = fmt.Errorf("broker error: %s", frameError(f))
+			if receipt := f.get("receipt-id"); receipt != "" {
+				// The broker refused that message, and closes the connection.
+				err = fmt.Errorf("message refused, %s", err)
+				o.drop(receipt)
+			}
+		}
+		if err != nil {
+			conn.close()
+			o.lock.Lock()
+			if o.conn == conn {
+				o.connErr = err
+				o.confirmed.Broadcast()
+			}
+			o.lock.Unlock()
+			return
+		}
+		if f.command != "RECEIPT" {
+			continue
+		}
+		id, err := strconv.ParseInt(f.get("receipt-id"), 10, 64)
+		if err != nil {
+			continue
+		}
+		o.confirm(id)
+	}
+}
+
+// Forgets the messages up to the id, returning how many there were.
+// Receipts come in the order the frames were sent, so a receipt confirms the
+// messages before it too.
+func (o *StompOutput) confirm(id int64) int64 {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	n := id - o.firstId + 1
+	if n <= 0 || n > int64(len(o.pending)) {
+		return 0
+	}
+	o.cursor = o.pending[n-1].cursor
+	o.dirty = true
+	o.pending = o.pending[n:]
+	o.firstId = id + 1
+	atomic.AddInt64(&o.messagesSent, n)
+	o.confirmed.Broadcast()
+	return n
+}
+
+// Forgets the refused message and those before it.
+func (o *StompOutput) drop(receipt string) {
+	id, err := strconv.ParseInt(receipt, 10, 64)
+	if err != nil {
+		return
+	}
+	if o.confirm(id) > 0 {
+		atomic.AddInt64(&o.messagesSent, -1)
+		atomic.AddInt64(&o.messagesRejected, 1)
+	}
+}
+
+// Returns the connection, connecting and sending the unconfirmed messages
+// again if the last one failed.
+func (o *StompOutput) connect() (*stompConn, error) {
+	o.lock.Lock()
+	conn, connErr := o.conn, o.connErr
+	o.lock.Unlock()
+	if conn != nil && connErr == nil {
+		return conn, nil
+	}
+	if conn != nil {
+		o.or.LogError(fmt.Errorf("connection to %s failed: %s", o.conf.Address, connErr))
+		atomic.AddInt64(&o.reconnects, 1)
+	}
+	conn, err := dialStomp(&o.conf.StompConnConfig, o.tlsConf,
+		int(message.MAX_MESSAGE_SIZE))
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to %s: %s", o.conf.Address, err)
+	}
+	o.lock.Lock()
+	o.conn, o.connErr = conn, nil
+	pending, id := o.pending, o.firstId
+	o.lock.Unlock()
+	go o.readReceipts(conn)
+	for _, msg := range pending {
+		if err = conn.send(o.sendFrame(msg.body, id)); err != nil {
+			conn.close()
+			return nil, err
+		}
+		id++
+	}
+	return conn, nil
+}
+
+// Waits for the receipts of the messages sent, until the connection fails
+// or the timeout passes. Advances the cursor past the confirmed messages.
+func (o *StompOutput) waitConfirmed(max int) error {
+	deadline := time.Now().Add(time.Duration(o.conf.Timeout) * time.Second)
+	timer := time.AfterFunc(time.Duration(o.conf.Timeout)*time.Second, func() {
+		o.lock.Lock()
+		o.confirmed.Broadcast()
+		o.lock.Unlock()
+	})
+	defer timer.Stop()
+
+	o.lock.Lock()
+	var err error
+	for len(o.pending) > max && o.connErr == nil {
+		if !time.Now().Before(deadline) {
+			err = fmt.Errorf("no receipts for %d messages after %ds", len(o.pending),
+				o.conf.Timeout)
+			break
+		}
+		o.confirmed.Wait()
+	}
+	if err == nil && len(o.pending) > max {
+		err = fmt.Errorf("connection failed: %s", o.connErr)
+	}
+	cursor, dirty := o.cursor, o.dirty
+	o.dirty = false
+	o.lock.Unlock()
+	if dirty {
+		o.or.UpdateCursor(cursor)
+	}
+	return err
+}
+
+func (o *StompOutput) ProcessMessage(pack *PipelinePack) error {
+	conn, err := o.connect()
+	if err != nil {
+		return NewRetryMessageError("%s", err)
+	}
+	if err = o.waitConfirmed(int(o.conf.MaxUnconfirmed) - 1); err != nil {
+		return NewRetryMessageError("%s", err)
+	}
+	body, err := o.or.Encode(pack)
+	if err != nil {
+		return fmt.Errorf("can't encode: %s", err)
+	}
+	if body == nil {
+		return nil
+	}
+	// Copy the body, the encoder may reuse its buffer.
+	body = append([]byte(nil), body...)
+	o.lock.Lock()
+	id := o.firstId + int64(len(o.pending))
+	o.pending = append(o.pending, unconfirmed{body: body, cursor: pack.QueueCursor})
+	o.lock.Unlock()
+	if err = conn.send(o.sendFrame(body, id)); err != nil {
+		// Sent again once reconnected.
+		conn.close()
+		o.or.LogError(fmt.Errorf("can't send: %s", err))
+	}
+	return nil
+}
+
+func (o *StompOutput) TimerEvent() error {
+	o.lock.Lock()
+	pending := len(o.pending)
+	o.lock.Unlock()
+	if pending == 0 {
+		return nil
+	}
+	if _, err := o.connect(); err != nil {
+		o.or.LogError(err)
+		return nil
+	}
+	if err := o.waitConfirmed(0); err != nil {
+		o.or.LogError(err)
+	}
+	return nil
+}
+
+func (o *StompOutput) CleanUp() {
+	o.lock.Lock()
+	conn := o.conn
+	o.lock.Unlock()
+	if conn == nil {
+		return
+	}
+	if err := o.waitConfirmed(0); err != nil {
+		o.or.LogError(fmt.Errorf("messages may not have been sent: %s", err))
+	}
+	conn.disconnect(time.Duration(o.conf.Timeout) * time.Second)
+}
+
+func (o *StompOutput) ReportMsg(msg *message.Message) error {
+	o.lock.Lock()
+	pending := len(o.pending)
+	o.lock.Unlock()
+	message.NewInt64Field(msg, "MessagesSent", atomic.LoadInt64(&o.messagesSent),
+		"count")
+	message.NewInt64Field(msg, "MessagesRejected",
+		atomic.LoadInt64(&o.messagesRejected), "count")
+	message.NewInt64Field(msg, "Unconfirmed", int64(pending), "count")
+	message.NewInt64Field(msg, "Reconnects", atomic.LoadInt64(&o.reconnects), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("StompOutput", func() interface{} {
+		return new(StompOutput)
+	})
+}
@@ -0,0 +1,122 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package stomp
+
+import (
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func StompOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A StompOutput", func() {
+		broker := newStompBroker()
+		defer broker.close()
+
+		output := new(StompOutput)
+		config := output.ConfigStruct().(*StompOutputConfig)
+		config.Address = broker.addr()
+		config.Destination = "/queue/logs"
+		config.Persistent = true
+		config.Headers = map[string]string{"expires": "0"}
+
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		or.EXPECT().Encoder().Return(new(ProtobufEncoder)).AnyTimes()
+		or.EXPECT().LogError(gomock.Any()).AnyTimes()
+		// Receipts may come in before or after the next message's sent.
+		var cursor string
+		or.EXPECT().UpdateCursor(gomock.Any()).Do(func(c string) {
+			cursor = c
+		}).AnyTimes()
+
+		send := func(body, cursor string) error {
+			pack := NewPipelinePack(pConfig.InputRecycleChan())
+			pack.QueueCursor = cursor
+			or.EXPECT().Encode(pack).Return([]byte(body), nil)
+			return output.ProcessMessage(pack)
+		}
+		c.Assume(output.Init(config), gs.IsNil)
+		c.Assume(output.Prepare(or, h), gs.IsNil)
+
+		c.Specify("sends messages and advances past their receipts", func() {
+			c.Expect(send("one", "c1"), gs.IsNil)
+			c.Expect(send("two", "c2"), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c2")
+			c.Expect(broker.received(), gs.Equals, "CONNECT,SEND one,SEND two")
+			broker.lock.Lock()
+			f := broker.frames[1]
+			broker.lock.Unlock()
+			c.Expect(f.get("destination"), gs.Equals, "/queue/logs")
+			c.Expect(f.get("persistent"), gs.Equals, "true")
+			c.Expect(f.get("expires"), gs.Equals, "0")
+			c.Expect(f.get("content-type"), gs.Equals, "application/octet-stream")
+			c.Expect(f.get("receipt"), gs.Equals, "0")
+			output.CleanUp()
+			c.Expect(waitReceived(broker, "CONNECT,SEND one,SEND two,DISCONNECT"),
+				gs.Equals, "CONNECT,SEND one,SEND two,DISCONNECT")
+		})
+
+		c.Specify("waits for receipts when too many are outstanding", func() {
+			config.MaxUnconfirmed = 1
+			c.Expect(send("one", "c1"), gs.IsNil)
+			c.Expect(send("two", "c2"), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(len(output.pending) <= 1, gs.IsTrue)
+		})
+
+		c.Specify("sends unconfirmed messages again after reconnecting", func() {
+			broker.dropAfter = 1
+			c.Expect(send("one", "c1"), gs.IsNil)
+			c.Expect(send("two", "c2"), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c2")
+			c.Expect(broker.received(), gs.Equals,
+				"CONNECT,SEND one,SEND two,CONNECT,SEND two")
+			c.Expect(output.messagesSent, gs.Equals, int64(2))
+		})
+
+		c.Specify("drops a refused message", func() {
+			broker.refuse = "bad"
+			c.Expect(send("bad", "c1"), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c1")
+			c.Expect(output.messagesRejected, gs.Equals, int64(1))
+			c.Expect(len(output.pending), gs.Equals, 0)
+			c.Expect(send("good", "c2"), gs.IsNil)
+			c.Expect(output.TimerEvent(), gs.IsNil)
+			c.Expect(cursor, gs.Equals, "c2")
+			c.Expect(broker.received(), gs.Equals, "CONNECT,SEND bad,CONNECT,SEND good")
+		})
+
+		c.Specify("retries while the broker's unreachable", func() {
+			broker.close()
+			pack := NewPipelinePack(pConfig.InputRecycleChan())
+			err := output.ProcessMessage(pack)
+			_, ok := err.(RetryMessageError)
+			c.Expect(ok, gs.IsTrue)
+		})
+	})
+}
@@ -26,7 +26,10 @@ func TestAllSpecs(t *testing.T) {
 	r.AddSpec(TcpInputSpec)
 	r.AddSpec(TcpOutputSpec)
 	r.AddSpec(TlsSpec)
+	r.AddSpec(PeerAuthorizerSpec)
 	r.AddSpec(TcpInputSpecFailure)
+	r.AddSpec(HekaInputSpec)
+	r.AddSpec(HekaOutputSpec)
 
 	gospec.MainGoTest(r, t)
 }
@@ -0,0 +1,482 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package tcp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+// Input plugin that receives messages relayed by other hekads' HekaOutputs,
+// acknowledging them once they've been delivered, or once they've been
+// written to the sending source's spool if spooling is enabled.
+type HekaInput struct {
+	conf              *HekaInputConfig
+	listener          net.Listener
+	ackInterval       time.Duration
+	keepAliveDuration time.Duration
+	authorizer        *PeerAuthorizer
+	allowed           map[byte]bool
+	ir                InputRunner
+	wg                sync.WaitGroup
+	// Each source's spool, if spooling.
+	spools *spoolSet
+
+	// Protects conns, which holds the open client connections so they can
+	// be closed on shutdown, and stopped.
+	lock    sync.Mutex
+	conns   map[net.Conn]bool
+	stopped bool
+}
+
+type HekaInputConfig struct {
+	// String representation of the address on which to listen (e.g.
+	// "0.0.0.0:5566").
+	Address string `toml:"address"`
+	UseTls  bool   `toml:"use_tls"`
+	Tls     TlsConfig
+	// Maximum number of milliseconds an acknowledgement is held back in the
+	// hope of covering more records with it.
+	AckInterval uint `toml:"ack_interval"`
+	// Set to true if TCP Keep Alive should be used.
+	KeepAlive bool `toml:"keep_alive"`
+	// Integer indicating seconds between keep alives.
+	KeepAlivePeriod int `toml:"keep_alive_period"`
+	// Client certificate CN / SAN glob patterns that are allowed to connect
+	// over TLS. Empty means any client that isn't denied is allowed.
+	AllowedPeers []string `toml:"allowed_peers"`
+	// Client certificate CN / SAN glob patterns that are never allowed to
+	// connect over TLS.
+	DeniedPeers []string `toml:"denied_peers"`
+	// Name of the message field into which the authenticated TLS client
+	// identity is written. Defaults to "TlsPeer".
+	PeerIdentityField string `toml:"peer_identity_field"`
+	// Set to true to write received records to a spool for each source,
+	// keyed by the verified TLS client identity or else the client's IP
+	// address, acknowledging them once spooled and delivering them from the
+	// spools in turn.
+	UseSpool bool `toml:"use_spool"`
+	// Settings for each source's spool. The full action is ignored, records
+	// stop being acknowledged while a source's spool is full.
+	Spool QueueBufferConfig
+	// Number of records delivered from each source's spool before moving on
+	// to the next.
+	DrainQuantum uint `toml:"drain_quantum"`
+	// Maximum number of sources spooled for at once, beyond which new
+	// sources are turned away. Defaults to 1000.
+	MaxSpools uint `toml:"max_spools"`
+	// Stream compressions clients can use, of "none", "snappy", and "zstd".
+	// Each client gets the first it offers that's allowed. Defaults to all
+	// of them.
+	Compressions []string `toml:"compressions"`
+	// So we can default to using ProtobufDecoder.
+	Decoder string
+	// So we can default to using HekaFramingSplitter.
+	Splitter string
+	// Subsection of listening socket settings, such as the address family
+	// and buffer sizes.
+	Socket SocketConfig `toml:"socket"`
+}
+
+func (i *HekaInput) ConfigStruct() interface{} {
+	return &HekaInputConfig{
+		Address:           "localhost:5566",
+		AckInterval:       100,
+		PeerIdentityField: "TlsPeer",
+		Spool: QueueBufferConfig{
+			CursorUpdateCount: 50,
+			MaxFileSize:       128 * 1024 * 1024,
+		},
+		DrainQuantum: 10,
+		MaxSpools:    1000,
+		Compressions: []string{"none", "snappy", "zstd"},
+		Decoder:      "ProtobufDecoder",
+		Splitter:     "HekaFramingSplitter",
+		Tls:          TlsConfig{PreferServerCiphers: true},
+	}
+}
+
+func (i *HekaInput) Init(config interface{}) (err error) {
+	i.conf = config.(*HekaInputConfig)
+	if i.conf.AckInterval == 0 {
+		return errors.New("ack_interval must be greater than 0")
+	}
+	if i.conf.UseSpool && i.conf.DrainQuantum == 0 {
+		return errors.New("drain_quantum must be greater than 0")
+	}
+	if i.conf.UseSpool && i.conf.MaxSpools == 0 {
+		return errors.New("max_spools must be greater than 0")
+	}
+	if i.allowed, err = parseRelayAllowed(i.conf.Compressions); err != nil {
+		return err
+	}
+	if len(i.conf.AllowedPeers) > 0 || len(i.conf.DeniedPeers) > 0 {
+		if !i.conf.UseTls {
+			return errors.New("peer authorization settings require use_tls")
+		}
+		if !VerifiesClients(&i.conf.Tls) {
+			return errPeersUnverified
+		}
+		i.authorizer, err = NewPeerAuthorizer(i.conf.AllowedPeers,
+			i.conf.DeniedPeers, nil)
+		if err != nil {
+			return err
+		}
+	}
+	i.ackInterval = time.Duration(i.conf.AckInterval) * time.Millisecond
+	if i.conf.KeepAlivePeriod != 0 {
+		i.keepAliveDuration = time.Duration(i.conf.KeepAlivePeriod) * time.Second
+	}
+	network, err := i.conf.Socket.Network("tcp")
+	if err != nil {
+		return err
+	}
+	if i.listener, err = i.conf.Socket.Listen(network, i.conf.Address, false); err != nil {
+		return fmt.Errorf("can't listen on %s: %s", i.conf.Address, err)
+	}
+	if i.conf.UseTls {
+		var listener net.Listener
+		if listener, err = NewTlsListener(i.listener, &i.conf.Tls); err != nil {
+			i.listener.Close()
+			return err
+		}
+		i.listener = listener
+	}
+	i.conns = make(map[net.Conn]bool)
+	if i.conf.UseSpool {
+		i.spools = newSpoolSet("heka_input_spool", i.conf.Spool, i.conf.DrainQuantum,
+			i.conf.MaxSpools, i.peerDecorator)
+	}
+	return nil
+}
+
+func (i *HekaInput) Run(ir InputRunner, h PluginHelper) error {
+	i.ir = ir
+	if i.spools != nil {
+		i.spools.ir, i.spools.pConfig = ir, h.PipelineConfig()
+		// Whatever was left in the spools last time gets delivered first.
+		if err := i.spools.open(); err != nil {
+			i.listener.Close()
+			return err
+		}
+		i.wg.Add(1)
+		go func() {
+			defer i.wg.Done()
+			i.spools.drain()
+		}()
+	}
+	for {
+		conn, err := i.listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				ir.LogError(fmt.Errorf("accept failed: %s", err))
+				continue
+			}
+			break
+		}
+		if i.conf.KeepAlive {
+			if tcpConn, ok := conn.(*net.TCPConn); ok {
+				tcpConn.SetKeepAlive(true)
+				if i.keepAliveDuration != 0 {
+					tcpConn.SetKeepAlivePeriod(i.keepAliveDuration)
+				}
+			}
+		}
+		i.lock.Lock()
+		if i.stopped {
+			i.lock.Unlock()
+			conn.Close()
+			break
+		}
+		i.conns[conn] = true
+		i.lock.Unlock()
+		i.wg.Add(1)
+		go i.handleConnection(conn)
+	}
+	i.wg.Wait()
+	if i.spools != nil {
+		i.spools.close()
+	}
+	return nil
+}
+
+// Counts the records delivered or spooled over a connection, and signals the
+// connection's acknowledger when enough have built up to be worth
+// acknowledging straight away.
+type ackingDeliverer struct {
+	Deliverer
+	// The source's spool, if spooling.
+	spool     *sourceSpool
+	stopChan  chan struct{}
+	conn      net.Conn
+	ir        InputRunner
+	failed    bool
+	count     uint64
+	acked     uint64
+	threshold uint64
+	notify    chan struct{}
+}
+
+func (d *ackingDeliverer) Deliver(pack *PipelinePack) {
+	if d.spool != nil {
+		// Acknowledgements are cumulative, so nothing after a record that
+		// couldn't be spooled can be counted.
+		if d.failed {
+			pack.Recycle(nil)
+			return
+		}
+		if err := d.spool.write(pack, d.stopChan); err != nil {
+			d.failed = true
+			if err != ErrStopping {
+				d.ir.LogError(fmt.Errorf("can't spool record from %s: %s",
+					d.spool.key, err))
+			}
+			d.conn.Close()
+			return
+		}
+	} else {
+		d.Deliverer.Deliver(pack)
+	}
+	d.counted()
+}
+
+// Counts a record the splitter dropped, so it's still acknowledged and the
+// sender doesn't hold onto it.
+func (d *ackingDeliverer) DropRecord() {
+	if d.failed {
+		return
+	}
+	d.counted()
+}
+
+func (d *ackingDeliverer) counted() {
+	count := atomic.AddUint64(&d.count, 1)
+	if count-atomic.LoadUint64(&d.acked) >= d.threshold {
+		select {
+		case d.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (d *ackingDeliverer) Done() {
+	if d.Deliverer != nil {
+		d.Deliverer.Done()
+	}
+}
+
+func (i *HekaInput) handleConnection(conn net.Conn) {
+	raddr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(raddr)
+	if err != nil {
+		host = raddr
+	}
+	defer func() {
+		i.lock.Lock()
+		delete(i.conns, conn)
+		i.lock.Unlock()
+		conn.Close()
+		i.wg.Done()
+	}()
+
+	var peer *PeerIdentity
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if peer, err = i.tlsHandshake(tlsConn); err != nil {
+			i.ir.LogError(fmt.Errorf("TLS client %s rejected: %s", raddr, err))
+			return
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(relayHandshakeTimeout))
+	hello, err := readRelayHello(conn)
+	if err != nil {
+		i.ir.LogError(fmt.Errorf("handshake with %s failed: %s", raddr, err))
+		return
+	}
+	status, compression := negotiateRelay(hello, i.allowed)
+	if err = writeRelayReply(conn, hello.version, status, compression); err != nil ||
+		status != relayStatusOk {
+
+		i.ir.LogError(fmt.Errorf("handshake with %s failed: status %d", raddr, status))
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	reader, release, err := newRelayReader(conn, compression)
+	if err != nil {
+		i.ir.LogError(fmt.Errorf("can't read from %s: %s", raddr, err))
+		return
+	}
+	defer release()
+
+	deliverer := &ackingDeliverer{
+		conn:      conn,
+		ir:        i.ir,
+		threshold: uint64(hello.window/2) + 1,
+		notify:    make(chan struct{}, 1),
+	}
+	if i.spools != nil {
+		key, isPeer := host, false
+		if peer != nil {
+			key, isPeer = peer.String(), true
+		}
+		deliverer.stopChan = i.spools.stopChan
+		if deliverer.spool, err = i.spools.get(key, isPeer); err != nil {
+			i.ir.LogError(fmt.Errorf("can't open spool for %s: %s", key, err))
+			return
+		}
+	} else {
+		deliverer.Deliverer = i.ir.NewDeliverer(host)
+		if i.conf.PeerIdentityField != "" {
+			var identity string
+			if peer != nil {
+				identity = peer.String()
+			}
+			deliverer.SetPackDecorator(i.peerDecorator(identity))
+		}
+	}
+	sr := i.ir.NewSplitterRunner(host)
+	defer func() {
+		deliverer.Done()
+		sr.Done()
+	}()
+	if deliverer.spool != nil && !sr.UseMsgBytes() {
+		i.ir.LogError(errors.New("spooling requires a splitter that uses message bytes"))
+		return
+	}
+	if !sr.UseMsgBytes() {
+		name := i.ir.Name()
+		sr.SetPackDecorator(func(pack *PipelinePack) {
+			pack.Message.SetHostname(raddr)
+			pack.Message.SetType(name)
+		})
+	}
+
+	done := make(chan struct{})
+	ackDone := make(chan struct{})
+	if hello.window == 0 {
+		// The client doesn't want acknowledgements.
+		close(ackDone)
+	} else {
+		go func() {
+			sendRelayAcks(conn, deliverer, i.ackInterval,
+				time.Duration(hello.heartbeat)*time.Second, done)
+			close(ackDone)
+		}()
+	}
+	for err == nil {
+		err = sr.SplitStream(reader, deliverer)
+	}
+	close(done)
+	<-ackDone
+}
+
+// Acknowledges the records delivered over the connection, whenever the
+// deliverer says enough have built up or the interval has passed. If the
+// client asked for heartbeats, the latest acknowledgement is repeated when
+// none has been sent for the heartbeat interval.
+func sendRelayAcks(conn net.Conn, deliverer *ackingDeliverer, interval,
+	heartbeat time.Duration, done chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastSent := time.Now()
+	for {
+		stopping := false
+		select {
+		case <-deliverer.notify:
+		case <-ticker.C:
+		case <-done:
+			stopping = true
+		}
+		count := atomic.LoadUint64(&deliverer.count)
+		if count != atomic.LoadUint64(&deliverer.acked) ||
+			(heartbeat > 0 && time.Since(lastSent) >= heartbeat) {
+
+			if err := writeRelayAck(conn, count); err != nil {
+				return
+			}
+			atomic.StoreUint64(&deliverer.acked, count)
+			lastSent = time.Now()
+		}
+		if stopping {
+			return
+		}
+	}
+}
+
+// Completes the TLS handshake for a new connection and, if the client
+// presented a certificate, returns its authorized identity.
+func (i *HekaInput) tlsHandshake(conn *tls.Conn) (*PeerIdentity, error) {
+	conn.SetDeadline(time.Now().Add(relayHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	state := conn.ConnectionState()
+	if i.authorizer != nil {
+		return i.authorizer.Authorize(state)
+	}
+	// An unverified certificate could name anyone.
+	return VerifiedPeer(state), nil
+}
+
+// Returns a pack decorator that records the TLS client's identity on each
+// message received from it, or, given no identity, removes any the client
+// claims.
+func (i *HekaInput) peerDecorator(identity string) func(*PipelinePack) {
+	return func(pack *PipelinePack) {
+		if i.conf.PeerIdentityField != "" {
+			setTrustedField(pack.Message, i.conf.PeerIdentityField, identity)
+		}
+	}
+}
+
+// Reports the receive and delivery rates of each source, how much of its
+// spool has yet to be delivered, and how far behind delivery of its messages
+// is.
+func (i *HekaInput) ReportMsg(msg *message.Message) error {
+	if i.spools != nil {
+		i.spools.reportMsg(msg)
+	}
+	return nil
+}
+
+func (i *HekaInput) Stop() {
+	if i.spools != nil {
+		i.spools.stop()
+	}
+	i.listener.Close()
+	i.lock.Lock()
+	i.stopped = true
+	for conn := range i.conns {
+		conn.Close()
+	}
+	i.lock.Unlock()
+}
+
+func init() {
+	RegisterPlugin("HekaInput", func() interface{} {
+		return new(HekaInput)
+	})
+}
@@ -0,0 +1,508 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package tcp
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+	plugins_ts "heka/plugins/testsupport"
+)
+
+// Returns an encoded message with the given payload.
+func encodeRelayMessage(payload string) []byte {
+	msg := new(message.Message)
+	msg.SetUuid(make([]byte, 16))
+	msg.SetPayload(payload)
+	msgBytes, _ := proto.Marshal(msg)
+	return msgBytes
+}
+
+func HekaInputSpec(c gs.Context) {
+	t := &pipeline_ts.SimpleT{}
+	ctrl := gomock.NewController(t)
+
+	tmpDir, tmpErr := ioutil.TempDir("", "heka-input-tests")
+	defer func() {
+		ctrl.Finish()
+		tmpErr = os.RemoveAll(tmpDir)
+		c.Expect(tmpErr, gs.IsNil)
+	}()
+	globals := DefaultGlobals()
+	globals.BaseDir = tmpDir
+	pConfig := NewPipelineConfig(globals)
+	pConfig.RegisterDefault("HekaFramingSplitter")
+
+	ith := new(plugins_ts.InputTestHelper)
+	ith.MockHelper = pipelinemock.NewMockPluginHelper(ctrl)
+	ith.MockInputRunner = pipelinemock.NewMockInputRunner(ctrl)
+	ith.MockDeliverer = pipelinemock.NewMockDeliverer(ctrl)
+	ith.MockSplitterRunner = pipelinemock.NewMockSplitterRunner(ctrl)
+
+	ith.MockHelper.EXPECT().PipelineConfig().Return(pConfig).AnyTimes()
+
+	c.Specify("A HekaInput", func() {
+		input := new(HekaInput)
+		config := input.ConfigStruct().(*HekaInputConfig)
+		config.Address = "127.0.0.1:0"
+		err := input.Init(config)
+		c.Assume(err, gs.IsNil)
+
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- input.Run(ith.MockInputRunner, ith.MockHelper)
+		}()
+		dial := func(hello relayHello) (net.Conn, error) {
+			conn, err := net.Dial("tcp", input.listener.Addr().String())
+			if err != nil {
+				return nil, err
+			}
+			if err = writeRelayHello(conn, hello); err != nil {
+				return nil, err
+			}
+			_, err = readRelayReply(conn, hello)
+			return conn, err
+		}
+		decorators := make(chan func(*PipelinePack), 1)
+		ith.MockDeliverer.EXPECT().SetPackDecorator(gomock.Any()).Do(
+			func(decorator func(*PipelinePack)) {
+				decorators <- decorator
+			}).AnyTimes()
+
+		c.Specify("acknowledges delivered records", func() {
+			ith.MockInputRunner.EXPECT().Name().Return("relay")
+			ith.MockInputRunner.EXPECT().NewDeliverer("127.0.0.1").Return(ith.MockDeliverer)
+			ith.MockInputRunner.EXPECT().NewSplitterRunner("127.0.0.1").Return(
+				ith.MockSplitterRunner)
+			ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(false)
+			ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any())
+			ith.MockDeliverer.EXPECT().Deliver(gomock.Any()).Times(3)
+			ith.MockDeliverer.EXPECT().Done()
+			done := make(chan struct{})
+			ith.MockSplitterRunner.EXPECT().Done().Do(func() {
+				close(done)
+			})
+
+			payloads := make(chan string, 3)
+			splitCall := ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+				gomock.Any())
+			splitCall.Do(func(r io.Reader, del Deliverer) {
+				for {
+					payload, err := readRelayRecord(r)
+					if err != nil {
+						return
+					}
+					payloads <- payload
+					del.Deliver(nil)
+				}
+			})
+			splitCall.Return(io.EOF)
+
+			conn, err := dial(relayHello{relayVersion,
+				[]byte{relayCompressionZstd, relayCompressionSnappy}, 4, 0})
+			c.Assume(err, gs.IsNil)
+			writer, err := newRelayWriter(conn, relayCompressionZstd)
+			c.Assume(err, gs.IsNil)
+			for _, payload := range []string{"one", "two", "three"} {
+				writer.Write(frameRelayRecord(payload))
+			}
+			writer.Flush()
+			c.Expect(<-payloads, gs.Equals, "one")
+			c.Expect(<-payloads, gs.Equals, "two")
+			c.Expect(<-payloads, gs.Equals, "three")
+
+			count, err := readRelayAck(conn)
+			c.Expect(err, gs.IsNil)
+			c.Expect(count, gs.Equals, uint64(3))
+			conn.Close()
+			<-done
+
+			input.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		})
+
+		c.Specify("acknowledges records the splitter drops", func() {
+			ith.MockInputRunner.EXPECT().Name().Return("relay")
+			ith.MockInputRunner.EXPECT().NewDeliverer("127.0.0.1").Return(ith.MockDeliverer)
+			ith.MockInputRunner.EXPECT().NewSplitterRunner("127.0.0.1").Return(
+				ith.MockSplitterRunner)
+			ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(false)
+			ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any())
+			ith.MockDeliverer.EXPECT().Deliver(gomock.Any()).Times(2)
+			ith.MockDeliverer.EXPECT().Done()
+			done := make(chan struct{})
+			ith.MockSplitterRunner.EXPECT().Done().Do(func() {
+				close(done)
+			})
+
+			splitCall := ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+				gomock.Any())
+			splitCall.Do(func(r io.Reader, del Deliverer) {
+				for {
+					payload, err := readRelayRecord(r)
+					if err != nil {
+						return
+					}
+					if payload == "two" {
+						del.(RecordDropper).DropRecord()
+					} else {
+						del.Deliver(nil)
+					}
+				}
+			})
+			splitCall.Return(io.EOF)
+
+			conn, err := dial(relayHello{relayVersion, []byte{relayCompressionNone}, 4, 0})
+			c.Assume(err, gs.IsNil)
+			writer, err := newRelayWriter(conn, relayCompressionNone)
+			c.Assume(err, gs.IsNil)
+			for _, payload := range []string{"one", "two", "three"} {
+				writer.Write(frameRelayRecord(payload))
+			}
+			writer.Flush()
+
+			count, err := readRelayAck(conn)
+			c.Expect(err, gs.IsNil)
+			c.Expect(count, gs.Equals, uint64(3))
+			conn.Close()
+			<-done
+
+			input.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		})
+
+		c.Specify("rejects an unsupported protocol version", func() {
+			ith.MockInputRunner.EXPECT().LogError(gomock.Any())
+			conn, err := dial(relayHello{relayVersion + 1, []byte{relayCompressionNone}, 4, 0})
+			c.Expect(err.Error(), gs.Equals, "server only supports protocol version 3")
+			conn.Close()
+
+			input.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		})
+
+		c.Specify("accepts protocol version 1 hellos", func() {
+			ith.MockInputRunner.EXPECT().Name().Return("relay")
+			ith.MockInputRunner.EXPECT().NewDeliverer("127.0.0.1").Return(ith.MockDeliverer)
+			ith.MockInputRunner.EXPECT().NewSplitterRunner("127.0.0.1").Return(
+				ith.MockSplitterRunner)
+			ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(false)
+			ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any())
+			ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+				gomock.Any()).Return(io.EOF)
+			ith.MockDeliverer.EXPECT().Done()
+			done := make(chan struct{})
+			ith.MockSplitterRunner.EXPECT().Done().Do(func() {
+				close(done)
+			})
+
+			conn, err := dial(relayHello{1, []byte{relayCompressionSnappy}, 4, 0})
+			c.Expect(err, gs.IsNil)
+			conn.Close()
+			<-done
+
+			input.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		})
+
+		c.Specify("removes a peer identity claimed by an unverified client", func() {
+			ith.MockInputRunner.EXPECT().Name().Return("relay")
+			ith.MockInputRunner.EXPECT().NewDeliverer("127.0.0.1").Return(ith.MockDeliverer)
+			ith.MockInputRunner.EXPECT().NewSplitterRunner("127.0.0.1").Return(
+				ith.MockSplitterRunner)
+			ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(false)
+			ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any())
+			ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+				gomock.Any()).Return(io.EOF)
+			ith.MockDeliverer.EXPECT().Done()
+			done := make(chan struct{})
+			ith.MockSplitterRunner.EXPECT().Done().Do(func() {
+				close(done)
+			})
+
+			conn, err := dial(relayHello{relayVersion, []byte{relayCompressionNone}, 4, 0})
+			c.Assume(err, gs.IsNil)
+			conn.Close()
+			<-done
+
+			pack := NewPipelinePack(nil)
+			pack.Message = new(message.Message)
+			message.NewStringField(pack.Message, "TlsPeer", "admin.example.com")
+			(<-decorators)(pack)
+			c.Expect(pack.Message.FindFirstField("TlsPeer") == nil, gs.IsTrue)
+
+			input.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		})
+
+		c.Specify("repeats acknowledgements as heartbeats", func() {
+			ith.MockInputRunner.EXPECT().Name().Return("relay")
+			ith.MockInputRunner.EXPECT().NewDeliverer("127.0.0.1").Return(ith.MockDeliverer)
+			ith.MockInputRunner.EXPECT().NewSplitterRunner("127.0.0.1").Return(
+				ith.MockSplitterRunner)
+			ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(false)
+			ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any())
+			splitCall := ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+				gomock.Any())
+			splitCall.Do(func(r io.Reader, del Deliverer) {
+				ioutil.ReadAll(r)
+			})
+			splitCall.Return(io.EOF)
+			ith.MockDeliverer.EXPECT().Done()
+			done := make(chan struct{})
+			ith.MockSplitterRunner.EXPECT().Done().Do(func() {
+				close(done)
+			})
+
+			conn, err := dial(relayHello{relayVersion, []byte{relayCompressionNone}, 4, 1})
+			c.Assume(err, gs.IsNil)
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for i := 0; i < 2; i++ {
+				count, err := readRelayAck(conn)
+				c.Expect(err, gs.IsNil)
+				c.Expect(count, gs.Equals, uint64(0))
+			}
+			conn.Close()
+			<-done
+
+			input.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		})
+	})
+
+	c.Specify("A HekaInput limited to some compressions", func() {
+		input := new(HekaInput)
+		config := input.ConfigStruct().(*HekaInputConfig)
+		config.Address = "127.0.0.1:0"
+		config.Compressions = []string{"snappy"}
+		err := input.Init(config)
+		c.Assume(err, gs.IsNil)
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- input.Run(ith.MockInputRunner, ith.MockHelper)
+		}()
+
+		c.Specify("rejects hellos offering none of them", func() {
+			ith.MockInputRunner.EXPECT().LogError(gomock.Any())
+			conn, err := net.Dial("tcp", input.listener.Addr().String())
+			c.Assume(err, gs.IsNil)
+			hello := relayHello{relayVersion, []byte{relayCompressionZstd,
+				relayCompressionNone}, 4, 0}
+			c.Assume(writeRelayHello(conn, hello), gs.IsNil)
+			_, err = readRelayReply(conn, hello)
+			c.Expect(err.Error(), gs.Equals, "server doesn't allow the offered compressions")
+			conn.Close()
+
+			input.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		})
+
+		c.Specify("needs at least one", func() {
+			input.Stop()
+			<-errChan
+			config.Compressions = []string{}
+			err := new(HekaInput).Init(config)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+
+	c.Specify("A spooling HekaInput", func() {
+		input := new(HekaInput)
+		config := input.ConfigStruct().(*HekaInputConfig)
+		config.Address = "127.0.0.1:0"
+		config.UseSpool = true
+		config.DrainQuantum = 2
+		err := input.Init(config)
+		c.Assume(err, gs.IsNil)
+
+		supply := make(chan *PipelinePack, 10)
+		for i := 0; i < 10; i++ {
+			supply <- NewPipelinePack(supply)
+		}
+		ith.MockInputRunner.EXPECT().Name().Return("relay").AnyTimes()
+		ith.MockInputRunner.EXPECT().InChan().Return(supply).AnyTimes()
+		delivered := make(chan string, 10)
+		newDeliverer := func(key string) {
+			deliverer := pipelinemock.NewMockDeliverer(ctrl)
+			ith.MockInputRunner.EXPECT().NewDeliverer(key).Return(deliverer)
+			deliverer.EXPECT().SetPackDecorator(gomock.Any()).AnyTimes()
+			deliverer.EXPECT().Deliver(gomock.Any()).Do(func(pack *PipelinePack) {
+				delivered <- key + ":" + pack.Message.GetPayload()
+				pack.Recycle(nil)
+			}).AnyTimes()
+			deliverer.EXPECT().Done()
+		}
+		run := func() chan error {
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- input.Run(ith.MockInputRunner, ith.MockHelper)
+			}()
+			return errChan
+		}
+
+		c.Specify("takes turns delivering from each source's spool", func() {
+			newDeliverer("a")
+			newDeliverer("b")
+			// Fill the spools before anything is drained from them.
+			input.spools.ir = ith.MockInputRunner
+			input.spools.pConfig = pConfig
+			recycle := make(chan *PipelinePack, 1)
+			for _, record := range []string{"a1", "a2", "a3", "a4", "b1"} {
+				spool, err := input.spools.get(record[:1], false)
+				c.Assume(err, gs.IsNil)
+				pack := NewPipelinePack(recycle)
+				pack.MsgBytes = encodeRelayMessage(record)
+				c.Assume(spool.write(pack, input.spools.stopChan), gs.IsNil)
+				<-recycle
+			}
+
+			errChan := run()
+			var order []string
+			for i := 0; i < 5; i++ {
+				order = append(order, <-delivered)
+			}
+			c.Expect(order[0], gs.Equals, "a:a1")
+			c.Expect(order[1], gs.Equals, "a:a2")
+			c.Expect(order[2], gs.Equals, "b:b1")
+			c.Expect(order[3], gs.Equals, "a:a3")
+			c.Expect(order[4], gs.Equals, "a:a4")
+
+			msg := new(message.Message)
+			input.ReportMsg(msg)
+			received, _ := msg.GetFieldValue("a-ReceivedCount")
+			c.Expect(received, gs.Equals, int64(4))
+			deliveredCount, _ := msg.GetFieldValue("b-DeliveredCount")
+			c.Expect(deliveredCount, gs.Equals, int64(1))
+
+			input.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		})
+
+		c.Specify("turns away sources beyond max_spools", func() {
+			newDeliverer("a")
+			input.spools.ir = ith.MockInputRunner
+			input.spools.pConfig = pConfig
+			input.spools.maxSpools = 1
+			_, err := input.spools.get("a", false)
+			c.Expect(err, gs.IsNil)
+			_, err = input.spools.get("a", false)
+			c.Expect(err, gs.IsNil)
+			_, err = input.spools.get("b", false)
+			c.Expect(err, gs.Not(gs.IsNil))
+			input.spools.close()
+			input.listener.Close()
+			c.Expect(os.RemoveAll(input.spools.dir()), gs.IsNil)
+		})
+
+		c.Specify("keeps host and TLS client spools with the same key apart", func() {
+			input.spools.ir = ith.MockInputRunner
+			input.spools.pConfig = pConfig
+			decorators := make(chan func(*PipelinePack), 2)
+			for i := 0; i < 2; i++ {
+				deliverer := pipelinemock.NewMockDeliverer(ctrl)
+				ith.MockInputRunner.EXPECT().NewDeliverer("client.example.com").Return(
+					deliverer)
+				deliverer.EXPECT().SetPackDecorator(gomock.Any()).Do(
+					func(decorator func(*PipelinePack)) {
+						decorators <- decorator
+					})
+				deliverer.EXPECT().Done()
+			}
+			host, err := input.spools.get("client.example.com", false)
+			c.Assume(err, gs.IsNil)
+			peer, err := input.spools.get("client.example.com", true)
+			c.Assume(err, gs.IsNil)
+			c.Expect(peer != host, gs.IsTrue)
+			again, err := input.spools.get("client.example.com", false)
+			c.Expect(err, gs.IsNil)
+			c.Expect(again == host, gs.IsTrue)
+			c.Expect(len(input.spools.list()), gs.Equals, 2)
+
+			decorate := func() *message.Message {
+				pack := NewPipelinePack(nil)
+				pack.Message = new(message.Message)
+				message.NewStringField(pack.Message, "TlsPeer", "forged")
+				(<-decorators)(pack)
+				return pack.Message
+			}
+			c.Expect(decorate().FindFirstField("TlsPeer") == nil, gs.IsTrue)
+			identity, _ := decorate().GetFieldValue("TlsPeer")
+			c.Expect(identity, gs.Equals, "client.example.com")
+
+			input.spools.close()
+			input.listener.Close()
+			c.Expect(os.RemoveAll(input.spools.dir()), gs.IsNil)
+		})
+
+		c.Specify("acknowledges records once they're spooled", func() {
+			newDeliverer("127.0.0.1")
+			ith.MockInputRunner.EXPECT().NewSplitterRunner("127.0.0.1").Return(
+				ith.MockSplitterRunner)
+			ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(true).AnyTimes()
+			done := make(chan struct{})
+			ith.MockSplitterRunner.EXPECT().Done().Do(func() {
+				close(done)
+			})
+			recycle := make(chan *PipelinePack, 1)
+			splitCall := ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+				gomock.Any())
+			splitCall.Do(func(r io.Reader, del Deliverer) {
+				for {
+					msgBytes, err := readRelayRecord(r)
+					if err != nil {
+						return
+					}
+					pack := NewPipelinePack(recycle)
+					pack.MsgBytes = []byte(msgBytes)
+					del.Deliver(pack)
+					<-recycle
+				}
+			})
+			splitCall.Return(io.EOF)
+
+			errChan := run()
+			conn, err := net.Dial("tcp", input.listener.Addr().String())
+			c.Assume(err, gs.IsNil)
+			hello := relayHello{relayVersion, []byte{relayCompressionNone}, 4, 0}
+			c.Assume(writeRelayHello(conn, hello), gs.IsNil)
+			_, err = readRelayReply(conn, hello)
+			c.Assume(err, gs.IsNil)
+			for _, payload := range []string{"one", "two", "three"} {
+				conn.Write(frameRelayRecord(string(encodeRelayMessage(payload))))
+			}
+			count, err := readRelayAck(conn)
+			c.Expect(err, gs.IsNil)
+			c.Expect(count, gs.Equals, uint64(3))
+			c.Expect(<-delivered, gs.Equals, "127.0.0.1:one")
+			c.Expect(<-delivered, gs.Equals, "127.0.0.1:two")
+			c.Expect(<-delivered, gs.Equals, "127.0.0.1:three")
+			conn.Close()
+			<-done
+
+			input.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+		})
+	})
+}
@@ -0,0 +1,490 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package tcp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+// Output plugin that relays messages to another hekad's HekaInput, failing
+// over between the configured targets. Sent records are kept until the far
+// end acknowledges them, and only then is the buffer checkpoint advanced, so
+// nothing is lost if a target goes away or hekad restarts.
+type HekaOutput struct {
+	conf *HekaOutputConfig
+	// The compressions offered to the targets, most preferred first.
+	offers            []byte
+	ackTimeout        time.Duration
+	keepAliveDuration time.Duration
+	or                OutputRunner
+	resolver          *EndpointResolver
+	dialer            *net.Dialer
+
+	// The targets, which are looked up if discovery is configured.
+	targets []string
+	// Index into the targets of the next one to try connecting to, and of
+	// the one most recently connected to, or -1 if none has been.
+	current   int
+	connected int
+	conn      *relayConn
+	// Records sent but not yet acknowledged, oldest first.
+	pending []pendingRecord
+
+	processMessageCount int64
+	dropMessageCount    int64
+	resentMessageCount  int64
+	failoverCount       int64
+	pendingCount        int64
+	heartbeatFailures   int64
+}
+
+type HekaOutputConfig struct {
+	// Addresses of the HekaInputs to relay to, in order of preference. The
+	// next one is tried whenever the current one fails.
+	Targets []string `toml:"targets"`
+	UseTls  bool     `toml:"use_tls"`
+	Tls     TlsConfig
+	// Preferred stream compression, one of "none", "snappy", or "zstd",
+	// falling back to none if the target doesn't allow it, or "auto" to use
+	// the best the target allows.
+	Compression string `toml:"compression"`
+	// Maximum number of records that can be sent without having been
+	// acknowledged.
+	AckWindow uint `toml:"ack_window"`
+	// Seconds to wait for an acknowledgement when the window is full before
+	// giving up on the target.
+	AckTimeout uint `toml:"ack_timeout"`
+	// Interval in seconds at which acknowledgements are checked for when no
+	// messages are being sent.
+	TickerInterval uint `toml:"ticker_interval"`
+	// Set to true if TCP Keep Alive should be used.
+	KeepAlive bool `toml:"keep_alive"`
+	// Integer indicating seconds between keep alives.
+	KeepAlivePeriod int `toml:"keep_alive_period"`
+	// Seconds between the heartbeats the target is asked to send, 0 for
+	// none. Defaults to 10.
+	HeartbeatInterval uint `toml:"heartbeat_interval"`
+	// Number of heartbeats in a row that can be missed before the
+	// connection is given up on. Defaults to 3.
+	HeartbeatMisses uint `toml:"heartbeat_misses"`
+	// Seconds sent data may go unacknowledged by the target's TCP stack
+	// before the connection is dropped, 0 for the system default. Linux
+	// only.
+	TcpUserTimeout uint `toml:"tcp_user_timeout"`
+	// Defaults to true for HekaOutput.
+	UseBuffering *bool `toml:"use_buffering"`
+	Buffering    QueueBufferConfig
+	Encoder      string
+	// Optional subsection looking up the targets in DNS SRV records or
+	// Consul, in place of the targets setting.
+	Discovery *DiscoveryConfig `toml:"discovery"`
+}
+
+// A sent record, along with the buffer position to checkpoint once it has
+// been acknowledged.
+type pendingRecord struct {
+	record []byte
+	cursor string
+}
+
+// A connection to a target, along with its compressed stream and the
+// acknowledgements read from it.
+type relayConn struct {
+	conn        net.Conn
+	address     string
+	compression byte
+	writer      relayWriter
+	acks        chan uint64
+	done        chan struct{}
+	// Number of records sent over this connection that have been
+	// acknowledged.
+	acked uint64
+	// Interval of the heartbeats the target sends, 0 if it doesn't, and the
+	// nanosecond time of the latest acknowledgement or heartbeat, accessed
+	// atomically.
+	heartbeat time.Duration
+	lastAck   int64
+}
+
+func (o *HekaOutput) ConfigStruct() interface{} {
+	b := true
+	return &HekaOutputConfig{
+		Targets:           []string{"localhost:5566"},
+		Compression:       "none",
+		AckWindow:         1000,
+		AckTimeout:        30,
+		TickerInterval:    1,
+		HeartbeatInterval: 10,
+		HeartbeatMisses:   3,
+		Encoder:           "ProtobufEncoder",
+		UseBuffering:      &b,
+		Buffering: QueueBufferConfig{
+			CursorUpdateCount: 50,
+			MaxFileSize:       128 * 1024 * 1024,
+			FullAction:        "shutdown",
+		},
+	}
+}
+
+func (o *HekaOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*HekaOutputConfig)
+	if o.conf.Discovery != nil {
+		if err = o.conf.Discovery.Validate(); err != nil {
+			return fmt.Errorf("discovery: %s", err)
+		}
+		if o.resolver, err = NewEndpointResolver(o.conf.Discovery); err != nil {
+			return fmt.Errorf("discovery: %s", err)
+		}
+	} else if len(o.conf.Targets) == 0 {
+		return errors.New("at least one target must be specified")
+	} else {
+		o.targets = o.conf.Targets
+	}
+	if o.offers, err = relayOffers(o.conf.Compression); err != nil {
+		return err
+	}
+	if o.conf.AckWindow == 0 || o.conf.AckWindow > math.MaxUint16 {
+		return fmt.Errorf("ack_window must be between 1 and %d", math.MaxUint16)
+	}
+	if o.conf.HeartbeatInterval > math.MaxUint16 {
+		return fmt.Errorf("heartbeat_interval can't be more than %d", math.MaxUint16)
+	}
+	if o.conf.HeartbeatInterval > 0 && o.conf.HeartbeatMisses == 0 {
+		return errors.New("heartbeat_misses must be at least 1")
+	}
+	if o.dialer, err = TcpDialer(time.Duration(o.conf.TcpUserTimeout) * time.Second); err != nil {
+		return err
+	}
+	o.connected = -1
+	o.ackTimeout = time.Duration(o.conf.AckTimeout) * time.Second
+	if o.conf.KeepAlivePeriod != 0 {
+		o.keepAliveDuration = time.Duration(o.conf.KeepAlivePeriod) * time.Second
+	}
+	return nil
+}
+
+func (o *HekaOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	or.SetUseFraming(true)
+	o.or = or
+	return nil
+}
+
+func (o *HekaOutput) ProcessMessage(pack *PipelinePack) (err error) {
+	if o.resolver != nil {
+		o.updateTargets()
+	}
+	if o.conn != nil {
+		if err = o.checkHeartbeat(); err != nil {
+			address := o.conn.address
+			o.cleanupConn()
+			return NewRetryMessageError("%s: %s", address, err)
+		}
+	}
+	if o.conn == nil {
+		if err = o.connect(); err != nil {
+			return NewRetryMessageError("can't connect: %s", err)
+		}
+	}
+	// Make room in the window for this record.
+	if err = o.processAcks(len(o.pending) >= int(o.conf.AckWindow)); err != nil {
+		address := o.conn.address
+		o.cleanupConn()
+		return NewRetryMessageError("%s: %s", address, err)
+	}
+
+	record, err := o.or.Encode(pack)
+	if err != nil {
+		atomic.AddInt64(&o.dropMessageCount, 1)
+		return fmt.Errorf("can't encode: %s", err)
+	}
+	if err = o.conn.send(record); err != nil {
+		address := o.conn.address
+		o.cleanupConn()
+		return NewRetryMessageError("writing to %s: %s", address, err)
+	}
+	o.pending = append(o.pending, pendingRecord{record, pack.QueueCursor})
+	atomic.StoreInt64(&o.pendingCount, int64(len(o.pending)))
+	return nil
+}
+
+// Picks up acknowledgements when there's nothing to send, so the buffer
+// checkpoint doesn't lag behind.
+func (o *HekaOutput) TimerEvent() error {
+	if o.conn == nil {
+		return nil
+	}
+	err := o.checkHeartbeat()
+	if err == nil {
+		err = o.processAcks(false)
+	}
+	if err != nil {
+		o.or.LogError(fmt.Errorf("%s: %s", o.conn.address, err))
+		o.cleanupConn()
+	}
+	return nil
+}
+
+// Handles any acknowledgements that have arrived. If wait is true, waits up
+// to the ack timeout for at least one.
+func (o *HekaOutput) processAcks(wait bool) error {
+	var timeout <-chan time.Time
+	if wait {
+		timeout = time.After(o.ackTimeout)
+	}
+	for {
+		var count uint64
+		ok := true
+		select {
+		case count, ok = <-o.conn.acks:
+		default:
+			if !wait {
+				return nil
+			}
+			select {
+			case count, ok = <-o.conn.acks:
+			case <-timeout:
+				return errors.New("timed out waiting for acknowledgement")
+			}
+		}
+		if !ok {
+			return errors.New("connection closed")
+		}
+		if err := o.ack(count); err != nil {
+			return err
+		}
+		wait = false
+	}
+}
+
+// Fails if the target has missed too many heartbeats in a row, which means
+// the connection has died without that being noticed, e.g. because a NAT or
+// load balancer in between dropped it.
+func (o *HekaOutput) checkHeartbeat() error {
+	if o.conn.heartbeat == 0 {
+		return nil
+	}
+	last := time.Unix(0, atomic.LoadInt64(&o.conn.lastAck))
+	if time.Since(last) <= o.conn.heartbeat*time.Duration(o.conf.HeartbeatMisses) {
+		return nil
+	}
+	atomic.AddInt64(&o.heartbeatFailures, 1)
+	return fmt.Errorf("no heartbeat for %s", time.Since(last).Truncate(time.Second))
+}
+
+// Releases the records covered by an acknowledgement, and checkpoints the
+// newest of them.
+func (o *HekaOutput) ack(count uint64) error {
+	if count <= o.conn.acked {
+		return nil
+	}
+	n := count - o.conn.acked
+	if n > uint64(len(o.pending)) {
+		return fmt.Errorf("acknowledged %d records but only %d are pending", n,
+			len(o.pending))
+	}
+	o.conn.acked = count
+	cursor := o.pending[n-1].cursor
+	o.pending = o.pending[n:]
+	atomic.StoreInt64(&o.pendingCount, int64(len(o.pending)))
+	atomic.AddInt64(&o.processMessageCount, int64(n))
+	o.or.UpdateCursor(cursor)
+	return nil
+}
+
+// Picks up changes to the discovered targets. When they change, the
+// connection is moved to the first of the new ones, which the unacknowledged
+// records are resent to.
+func (o *HekaOutput) updateTargets() {
+	endpoints, changed, err := o.resolver.Endpoints()
+	if err != nil {
+		o.or.LogError(fmt.Errorf("discovery: %s", err))
+	}
+	if len(endpoints) == 0 || (o.targets != nil && !changed) {
+		return
+	}
+	if o.targets != nil {
+		o.or.LogMessage(fmt.Sprintf("targets changed to %s",
+			strings.Join(endpoints, ", ")))
+	}
+	o.targets = endpoints
+	o.current, o.connected = 0, -1
+	if o.conn != nil {
+		o.processAcks(false)
+		o.cleanupConn()
+	}
+}
+
+// Connects to the first working target, starting with the current one, and
+// resends any unacknowledged records.
+func (o *HekaOutput) connect() error {
+	if len(o.targets) == 0 {
+		return errors.New("no targets discovered")
+	}
+	var err error
+	for i := range o.targets {
+		idx := (o.current + i) % len(o.targets)
+		address := o.targets[idx]
+		if err = o.dial(address); err != nil {
+			err = fmt.Errorf("%s: %s", address, err)
+			continue
+		}
+		if err = o.resend(); err != nil {
+			o.cleanupConn()
+			err = fmt.Errorf("%s: resending: %s", address, err)
+			continue
+		}
+		if o.connected != -1 && idx != o.connected {
+			atomic.AddInt64(&o.failoverCount, 1)
+			o.or.LogMessage(fmt.Sprintf("failed over from %s to %s",
+				o.targets[o.connected], address))
+		}
+		o.current, o.connected = idx, idx
+		return nil
+	}
+	// Start with the next target on the next attempt.
+	o.current = (o.current + 1) % len(o.targets)
+	return err
+}
+
+func (o *HekaOutput) dial(address string) (err error) {
+	var goTlsConf *tls.Config
+	if o.conf.UseTls {
+		if goTlsConf, err = CreateGoTlsConfig(&o.conf.Tls); err != nil {
+			return fmt.Errorf("TLS init error: %s", err)
+		}
+	}
+	dial := func() (conn net.Conn, err error) {
+		if goTlsConf != nil {
+			conn, err = tls.DialWithDialer(o.dialer, "tcp", address, goTlsConf)
+		} else {
+			conn, err = o.dialer.Dial("tcp", address)
+		}
+		if err == nil && o.conf.KeepAlive {
+			if tcpConn, ok := conn.(*net.TCPConn); ok {
+				tcpConn.SetKeepAlive(true)
+				if o.keepAliveDuration != 0 {
+					tcpConn.SetKeepAlivePeriod(o.keepAliveDuration)
+				}
+			}
+		}
+		return conn, err
+	}
+	conn, compression, heartbeat, err := relayClientHandshake(dial, o.offers,
+		uint16(o.conf.AckWindow), uint16(o.conf.HeartbeatInterval))
+	if err != nil {
+		return err
+	}
+
+	writer, err := newRelayWriter(conn, compression)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	o.conn = &relayConn{
+		conn:        conn,
+		address:     address,
+		compression: compression,
+		writer:      writer,
+		acks:        make(chan uint64, 16),
+		done:        make(chan struct{}),
+		heartbeat:   time.Duration(heartbeat) * time.Second,
+		lastAck:     time.Now().UnixNano(),
+	}
+	go o.conn.readAcks()
+	return nil
+}
+
+// Resends the records that weren't acknowledged by the previous connection.
+func (o *HekaOutput) resend() error {
+	for _, p := range o.pending {
+		if err := o.conn.send(p.record); err != nil {
+			return err
+		}
+	}
+	atomic.AddInt64(&o.resentMessageCount, int64(len(o.pending)))
+	return nil
+}
+
+func (o *HekaOutput) cleanupConn() {
+	if o.conn != nil {
+		o.conn.close()
+		o.conn = nil
+	}
+}
+
+func (o *HekaOutput) CleanUp() {
+	o.cleanupConn()
+}
+
+func (c *relayConn) send(record []byte) error {
+	if _, err := c.writer.Write(record); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
+
+func (c *relayConn) readAcks() {
+	defer close(c.acks)
+	for {
+		count, err := readRelayAck(c.conn)
+		if err != nil {
+			return
+		}
+		atomic.StoreInt64(&c.lastAck, time.Now().UnixNano())
+		select {
+		case c.acks <- count:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *relayConn) close() {
+	close(c.done)
+	c.writer.Close()
+	c.conn.Close()
+}
+
+func (o *HekaOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "ProcessMessageCount",
+		atomic.LoadInt64(&o.processMessageCount), "count")
+	message.NewInt64Field(msg, "DropMessageCount",
+		atomic.LoadInt64(&o.dropMessageCount), "count")
+	message.NewInt64Field(msg, "ResentMessageCount",
+		atomic.LoadInt64(&o.resentMessageCount), "count")
+	message.NewInt64Field(msg, "FailoverCount",
+		atomic.LoadInt64(&o.failoverCount), "count")
+	message.NewInt64Field(msg, "PendingAckCount",
+		atomic.LoadInt64(&o.pendingCount), "count")
+	message.NewInt64Field(msg, "HeartbeatFailureCount",
+		atomic.LoadInt64(&o.heartbeatFailures), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("HekaOutput", func() interface{} {
+		return new(HekaOutput)
+	})
+}
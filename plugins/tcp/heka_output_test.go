@@ -0,0 +1,424 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package tcp
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/client"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	plugins_ts "heka/plugins/testsupport"
+)
+
+// Frames a payload the way the output runner would.
+func frameRelayRecord(payload string) []byte {
+	var record []byte
+	client.CreateHekaStream([]byte(payload), &record, nil)
+	return record
+}
+
+// Reads a framed record, returning its payload.
+func readRelayRecord(r io.Reader) (string, error) {
+	start := make([]byte, 2)
+	if _, err := io.ReadFull(r, start); err != nil {
+		return "", err
+	}
+	headerBytes := make([]byte, int(start[1])+1)
+	if _, err := io.ReadFull(r, headerBytes); err != nil {
+		return "", err
+	}
+	header := new(message.Header)
+	if err := proto.Unmarshal(headerBytes[:len(headerBytes)-1], header); err != nil {
+		return "", err
+	}
+	payload := make([]byte, header.GetMessageLength())
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+// A stand in for a HekaInput that acknowledges records on request.
+type testRelayServer struct {
+	listener    net.Listener
+	conn        net.Conn
+	reader      io.Reader
+	hello       relayHello
+	compression byte
+	// Protocol version spoken, set to act as an older HekaInput.
+	version byte
+}
+
+func newTestRelayServer() (*testRelayServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return &testRelayServer{listener: listener}, nil
+}
+
+func (s *testRelayServer) address() string {
+	return s.listener.Addr().String()
+}
+
+func (s *testRelayServer) accept() (err error) {
+	if s.conn, err = s.listener.Accept(); err != nil {
+		return err
+	}
+	if s.hello, err = readRelayHello(s.conn); err != nil {
+		return err
+	}
+	if s.version != 0 && s.hello.version > s.version {
+		s.conn.Write([]byte{s.version, relayStatusBadVersion})
+		s.conn.Close()
+		return s.accept()
+	}
+	if s.hello.version == 1 {
+		_, err = s.conn.Write([]byte{1, relayStatusOk})
+		s.compression = s.hello.offers[0]
+	} else {
+		allowed := map[byte]bool{relayCompressionNone: true, relayCompressionSnappy: true,
+			relayCompressionZstd: true}
+		var status byte
+		status, s.compression = negotiateRelay(s.hello, allowed)
+		err = writeRelayReply(s.conn, s.hello.version, status, s.compression)
+	}
+	if err != nil {
+		return err
+	}
+	s.reader, _, err = newRelayReader(s.conn, s.compression)
+	return err
+}
+
+func (s *testRelayServer) read(n int) (payloads []string, err error) {
+	for i := 0; i < n; i++ {
+		payload, err := readRelayRecord(s.reader)
+		if err != nil {
+			return payloads, err
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
+
+func (s *testRelayServer) close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.listener.Close()
+}
+
+func HekaOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A HekaOutput", func() {
+		output := new(HekaOutput)
+		config := output.ConfigStruct().(*HekaOutputConfig)
+		oth := plugins_ts.NewOutputTestHelper(ctrl)
+		oth.MockOutputRunner.EXPECT().SetUseFraming(true).AnyTimes()
+		oth.MockOutputRunner.EXPECT().LogError(gomock.Any()).AnyTimes()
+
+		server, err := newTestRelayServer()
+		c.Assume(err, gs.IsNil)
+		defer server.close()
+		config.Targets = []string{server.address()}
+
+		newPack := func(payload, cursor string) *PipelinePack {
+			pack := NewPipelinePack(nil)
+			pack.QueueCursor = cursor
+			oth.MockOutputRunner.EXPECT().Encode(pack).Return(
+				frameRelayRecord(payload), nil).AnyTimes()
+			return pack
+		}
+		// Runs timer events until the pending records drop to the expected
+		// number.
+		waitForAcks := func(pending int64) {
+			for i := 0; i < 100; i++ {
+				output.TimerEvent()
+				if atomic.LoadInt64(&output.pendingCount) == pending {
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		c.Specify("rejects an unknown compression", func() {
+			config.Compression = "lzma"
+			err := output.Init(config)
+			c.Expect(err.Error(), gs.Equals, "unsupported compression 'lzma'")
+		})
+
+		for _, compression := range []string{"none", "snappy", "zstd", "auto"} {
+			compression := compression
+			c.Specify("checkpoints acknowledged records using "+compression, func() {
+				config.Compression = compression
+				err := output.Init(config)
+				c.Assume(err, gs.IsNil)
+				output.Prepare(oth.MockOutputRunner, oth.MockHelper)
+
+				accepted := make(chan error, 1)
+				go func() {
+					accepted <- server.accept()
+				}()
+				for i, payload := range []string{"one", "two", "three"} {
+					cursor := string(rune('1' + i))
+					err = output.ProcessMessage(newPack(payload, cursor))
+					c.Expect(err, gs.IsNil)
+				}
+				c.Assume(<-accepted, gs.IsNil)
+				c.Expect(server.hello.window, gs.Equals, uint16(config.AckWindow))
+				if compression == "auto" {
+					c.Expect(server.compression, gs.Equals, relayCompressionZstd)
+				} else {
+					c.Expect(relayCompressionName(server.compression), gs.Equals, compression)
+				}
+				payloads, err := server.read(3)
+				c.Assume(err, gs.IsNil)
+				c.Expect(payloads[0], gs.Equals, "one")
+				c.Expect(payloads[2], gs.Equals, "three")
+
+				oth.MockOutputRunner.EXPECT().UpdateCursor("2")
+				writeRelayAck(server.conn, 2)
+				waitForAcks(1)
+				c.Expect(atomic.LoadInt64(&output.pendingCount), gs.Equals, int64(1))
+
+				oth.MockOutputRunner.EXPECT().UpdateCursor("3")
+				writeRelayAck(server.conn, 3)
+				waitForAcks(0)
+				c.Expect(atomic.LoadInt64(&output.processMessageCount), gs.Equals, int64(3))
+				output.CleanUp()
+			})
+		}
+
+		c.Specify("falls back to protocol version 1", func() {
+			server.version = 1
+			config.Compression = "snappy"
+			err := output.Init(config)
+			c.Assume(err, gs.IsNil)
+			output.Prepare(oth.MockOutputRunner, oth.MockHelper)
+
+			accepted := make(chan error, 1)
+			go func() {
+				accepted <- server.accept()
+			}()
+			c.Expect(output.ProcessMessage(newPack("one", "1")), gs.IsNil)
+			c.Assume(<-accepted, gs.IsNil)
+			c.Expect(server.hello.version, gs.Equals, byte(1))
+			c.Expect(server.compression, gs.Equals, relayCompressionSnappy)
+			payloads, err := server.read(1)
+			c.Assume(err, gs.IsNil)
+			c.Expect(payloads[0], gs.Equals, "one")
+			output.CleanUp()
+		})
+
+		c.Specify("reconnects when heartbeats are missed", func() {
+			config.HeartbeatInterval = 1
+			config.HeartbeatMisses = 1
+			err := output.Init(config)
+			c.Assume(err, gs.IsNil)
+			output.Prepare(oth.MockOutputRunner, oth.MockHelper)
+
+			accepted := make(chan error, 1)
+			go func() {
+				accepted <- server.accept()
+			}()
+			c.Expect(output.ProcessMessage(newPack("one", "1")), gs.IsNil)
+			c.Assume(<-accepted, gs.IsNil)
+			c.Expect(server.hello.heartbeat, gs.Equals, uint16(1))
+			c.Expect(output.conn.heartbeat, gs.Equals, time.Second)
+			// The server never sends a heartbeat.
+			for i := 0; i < 300 && output.conn != nil; i++ {
+				output.TimerEvent()
+				time.Sleep(10 * time.Millisecond)
+			}
+			c.Expect(output.conn == nil, gs.IsTrue)
+			c.Expect(atomic.LoadInt64(&output.heartbeatFailures), gs.Equals, int64(1))
+
+			go func() {
+				accepted <- server.accept()
+			}()
+			oth.MockOutputRunner.EXPECT().LogMessage(gomock.Any()).AnyTimes()
+			c.Expect(output.ProcessMessage(newPack("two", "2")), gs.IsNil)
+			c.Assume(<-accepted, gs.IsNil)
+			payloads, err := server.read(2)
+			c.Assume(err, gs.IsNil)
+			c.Expect(payloads[0], gs.Equals, "one")
+			c.Expect(payloads[1], gs.Equals, "two")
+			output.CleanUp()
+		})
+
+		c.Specify("doesn't expect heartbeats from a version 2 target", func() {
+			server.version = 2
+			config.HeartbeatInterval = 1
+			err := output.Init(config)
+			c.Assume(err, gs.IsNil)
+			output.Prepare(oth.MockOutputRunner, oth.MockHelper)
+
+			accepted := make(chan error, 1)
+			go func() {
+				accepted <- server.accept()
+			}()
+			c.Expect(output.ProcessMessage(newPack("one", "1")), gs.IsNil)
+			c.Assume(<-accepted, gs.IsNil)
+			c.Expect(server.hello.version, gs.Equals, byte(2))
+			c.Expect(output.conn.heartbeat, gs.Equals, time.Duration(0))
+			output.CleanUp()
+		})
+
+		c.Specify("rejects an out of range heartbeat interval", func() {
+			config.HeartbeatInterval = 70000
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("fails over and resends unacknowledged records", func() {
+			backup, err := newTestRelayServer()
+			c.Assume(err, gs.IsNil)
+			defer backup.close()
+			config.Targets = append(config.Targets, backup.address())
+			err = output.Init(config)
+			c.Assume(err, gs.IsNil)
+			output.Prepare(oth.MockOutputRunner, oth.MockHelper)
+
+			accepted := make(chan error, 1)
+			go func() {
+				accepted <- server.accept()
+			}()
+			c.Expect(output.ProcessMessage(newPack("one", "1")), gs.IsNil)
+			c.Expect(output.ProcessMessage(newPack("two", "2")), gs.IsNil)
+			c.Assume(<-accepted, gs.IsNil)
+			_, err = server.read(2)
+			c.Assume(err, gs.IsNil)
+			oth.MockOutputRunner.EXPECT().UpdateCursor("1")
+			writeRelayAck(server.conn, 1)
+			waitForAcks(1)
+			server.close()
+			// The output notices when the connection's acks stop.
+			for i := 0; i < 100 && output.conn != nil; i++ {
+				output.TimerEvent()
+				time.Sleep(10 * time.Millisecond)
+			}
+			c.Assume(output.conn, gs.IsNil)
+
+			go func() {
+				accepted <- backup.accept()
+			}()
+			oth.MockOutputRunner.EXPECT().LogMessage(gomock.Any())
+			pack := newPack("three", "3")
+			for i := 0; i < 100; i++ {
+				if err = output.ProcessMessage(pack); err == nil {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			c.Assume(err, gs.IsNil)
+			c.Assume(<-accepted, gs.IsNil)
+			payloads, err := backup.read(2)
+			c.Assume(err, gs.IsNil)
+			c.Expect(payloads[0], gs.Equals, "two")
+			c.Expect(payloads[1], gs.Equals, "three")
+			c.Expect(atomic.LoadInt64(&output.failoverCount), gs.Equals, int64(1))
+			c.Expect(atomic.LoadInt64(&output.resentMessageCount), gs.Equals, int64(1))
+
+			oth.MockOutputRunner.EXPECT().UpdateCursor("3")
+			writeRelayAck(backup.conn, 2)
+			waitForAcks(0)
+			c.Expect(atomic.LoadInt64(&output.pendingCount), gs.Equals, int64(0))
+			output.CleanUp()
+		})
+
+		c.Specify("moves to the targets discovery finds", func() {
+			backup, err := newTestRelayServer()
+			c.Assume(err, gs.IsNil)
+			defer backup.close()
+			var lock sync.Mutex
+			target := server.address()
+			consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+				req *http.Request) {
+				lock.Lock()
+				defer lock.Unlock()
+				host, port, _ := net.SplitHostPort(target)
+				fmt.Fprintf(w, `[{"Node": {"Address": "%s"}, "Service": {"Port": %s}}]`,
+					host, port)
+			}))
+			defer consul.Close()
+			config.Targets = nil
+			config.Discovery = &DiscoveryConfig{ConsulService: "aggregator",
+				ConsulAddress: consul.URL, RefreshInterval: 1}
+			err = output.Init(config)
+			c.Assume(err, gs.IsNil)
+			output.Prepare(oth.MockOutputRunner, oth.MockHelper)
+
+			accepted := make(chan error, 1)
+			go func() {
+				accepted <- server.accept()
+			}()
+			c.Expect(output.ProcessMessage(newPack("one", "1")), gs.IsNil)
+			c.Assume(<-accepted, gs.IsNil)
+			_, err = server.read(1)
+			c.Assume(err, gs.IsNil)
+
+			lock.Lock()
+			target = backup.address()
+			lock.Unlock()
+			time.Sleep(1100 * time.Millisecond)
+			go func() {
+				accepted <- backup.accept()
+			}()
+			oth.MockOutputRunner.EXPECT().LogMessage(gomock.Any())
+			c.Expect(output.ProcessMessage(newPack("two", "2")), gs.IsNil)
+			c.Assume(<-accepted, gs.IsNil)
+			payloads, err := backup.read(2)
+			c.Assume(err, gs.IsNil)
+			c.Expect(payloads[0], gs.Equals, "one")
+			c.Expect(payloads[1], gs.Equals, "two")
+			c.Expect(atomic.LoadInt64(&output.resentMessageCount), gs.Equals, int64(1))
+			output.CleanUp()
+		})
+
+		c.Specify("gives up on a target that doesn't acknowledge a full window", func() {
+			config.AckWindow = 1
+			config.AckTimeout = 1
+			err := output.Init(config)
+			c.Assume(err, gs.IsNil)
+			output.Prepare(oth.MockOutputRunner, oth.MockHelper)
+
+			accepted := make(chan error, 1)
+			go func() {
+				accepted <- server.accept()
+			}()
+			c.Expect(output.ProcessMessage(newPack("one", "1")), gs.IsNil)
+			c.Assume(<-accepted, gs.IsNil)
+			err = output.ProcessMessage(newPack("two", "2"))
+			_, ok := err.(RetryMessageError)
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(output.conn, gs.IsNil)
+			c.Expect(len(output.pending), gs.Equals, 1)
+		})
+	})
+}
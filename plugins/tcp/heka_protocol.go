@@ -0,0 +1,354 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package tcp
+
+// The relay protocol spoken between HekaOutput and HekaInput, and between
+// TcpOutput and TcpInput when they negotiate compression. A connection
+// starts with the client sending a hello. In version 1 of the protocol the
+// client picks the compression:
+//
+//     "HKRL" | 1 | compression (1 byte) | ack window (uint16)
+//
+// while in version 2 it offers those it can use, most preferred first:
+//
+//     "HKRL" | 2 | count (1 byte) | ack window (uint16) | compressions
+//
+// and version 3 adds the interval in seconds at which the client wants
+// heartbeats, 0 for none:
+//
+//     "HKRL" | 3 | count (1 byte) | ack window (uint16) | compressions |
+//     heartbeat interval (uint16)
+//
+// The server replies with its version and a status byte, 0 meaning the
+// hello was accepted, followed in version 2 by the compression it picked,
+// the first offered that it allows. A server rejects a hello of a version
+// newer than its own with its version, which the client can retry with.
+// Later versions must start with the same 8 bytes, so that older servers can
+// reject them. The client then sends Heka framed protobuf records, passed
+// through the negotiated stream compression. The server sends back
+// uncompressed acknowledgements, each a big endian uint64 holding the total
+// number of records it has received and delivered over the connection,
+// unless the ack window is 0. When heartbeats were asked for the server
+// repeats the latest acknowledgement whenever the heartbeat interval passes
+// without one having been sent, so that the client can tell a connection
+// that has silently died from one that's merely idle.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	relayMagic   = "HKRL"
+	relayVersion = 3
+
+	relayStatusOk                  = 0
+	relayStatusBadVersion          = 1
+	relayStatusBadCompression      = 2
+	relayHelloSize                 = 8
+	relayReplySize                 = 2
+	relayAckSize                   = 8
+	relayHandshakeTimeout          = 10 * time.Second
+	relayCompressionNone      byte = 0
+	relayCompressionSnappy    byte = 1
+	relayCompressionZstd      byte = 2
+)
+
+var relayCompressions = map[string]byte{
+	"none":   relayCompressionNone,
+	"snappy": relayCompressionSnappy,
+	"zstd":   relayCompressionZstd,
+}
+
+// Returns the wire value of the named compression.
+func parseRelayCompression(name string) (byte, error) {
+	compression, ok := relayCompressions[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported compression '%s'", name)
+	}
+	return compression, nil
+}
+
+// Returns the compressions a client offers for its compression setting:
+// "auto" offers all of them, best first, and anything else the named one,
+// falling back to none.
+func relayOffers(name string) ([]byte, error) {
+	if name == "auto" {
+		return []byte{relayCompressionZstd, relayCompressionSnappy,
+			relayCompressionNone}, nil
+	}
+	compression, err := parseRelayCompression(name)
+	if err != nil {
+		return nil, err
+	}
+	if compression == relayCompressionNone {
+		return []byte{compression}, nil
+	}
+	return []byte{compression, relayCompressionNone}, nil
+}
+
+// Returns the set of compressions a server allows from their names.
+func parseRelayAllowed(names []string) (map[byte]bool, error) {
+	if len(names) == 0 {
+		return nil, errors.New("at least one compression must be allowed")
+	}
+	allowed := make(map[byte]bool, len(names))
+	for _, name := range names {
+		compression, err := parseRelayCompression(name)
+		if err != nil {
+			return nil, err
+		}
+		allowed[compression] = true
+	}
+	return allowed, nil
+}
+
+func relayCompressionName(compression byte) string {
+	for name, c := range relayCompressions {
+		if c == compression {
+			return name
+		}
+	}
+	return fmt.Sprintf("unknown (%d)", compression)
+}
+
+type relayHello struct {
+	version byte
+	// The compressions offered, or in version 1 the one picked.
+	offers []byte
+	window uint16
+	// Seconds between the heartbeats asked for, from version 3.
+	heartbeat uint16
+}
+
+func writeRelayHello(w io.Writer, hello relayHello) error {
+	buf := make([]byte, relayHelloSize, relayHelloSize+len(hello.offers))
+	copy(buf, relayMagic)
+	buf[4] = hello.version
+	binary.BigEndian.PutUint16(buf[6:], hello.window)
+	if hello.version == 1 {
+		buf[5] = hello.offers[0]
+	} else {
+		buf[5] = byte(len(hello.offers))
+		buf = append(buf, hello.offers...)
+	}
+	if hello.version >= 3 {
+		buf = append(buf, byte(hello.heartbeat>>8), byte(hello.heartbeat))
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readRelayHello(r io.Reader) (hello relayHello, err error) {
+	buf := make([]byte, relayHelloSize)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return hello, err
+	}
+	if string(buf[:4]) != relayMagic {
+		return hello, errors.New("not a Heka relay client")
+	}
+	hello.version = buf[4]
+	hello.window = binary.BigEndian.Uint16(buf[6:])
+	switch hello.version {
+	case 1:
+		hello.offers = buf[5:6]
+	case 2, 3:
+		if buf[5] == 0 {
+			return hello, errors.New("no compressions offered")
+		}
+		hello.offers = make([]byte, buf[5])
+		if _, err = io.ReadFull(r, hello.offers); err == nil && hello.version == 3 {
+			if _, err = io.ReadFull(r, buf[:2]); err == nil {
+				hello.heartbeat = binary.BigEndian.Uint16(buf)
+			}
+		}
+	}
+	return hello, err
+}
+
+// Works out the server's answer to a hello: the status it replies with and,
+// if the hello is accepted, the compression used.
+func negotiateRelay(hello relayHello, allowed map[byte]bool) (status, compression byte) {
+	if hello.version < 1 || hello.version > relayVersion {
+		return relayStatusBadVersion, 0
+	}
+	for _, offer := range hello.offers {
+		if allowed[offer] {
+			return relayStatusOk, offer
+		}
+	}
+	return relayStatusBadCompression, 0
+}
+
+// Writes the server's reply to a hello of the given version.
+func writeRelayReply(w io.Writer, version, status, compression byte) error {
+	reply := []byte{relayVersion, status}
+	if version >= 2 && status == relayStatusOk {
+		reply = append(reply, compression)
+	}
+	_, err := w.Write(reply)
+	return err
+}
+
+// Error returned when the server rejects the hello's version.
+type relayVersionError struct {
+	server byte
+}
+
+func (e relayVersionError) Error() string {
+	return fmt.Sprintf("server only supports protocol version %d", e.server)
+}
+
+// Reads the server's reply to a hello, returning the compression it picked,
+// or an error if it rejected the hello.
+func readRelayReply(r io.Reader, hello relayHello) (byte, error) {
+	buf := make([]byte, relayReplySize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, err
+	}
+	switch buf[1] {
+	case relayStatusOk:
+		if hello.version == 1 {
+			return hello.offers[0], nil
+		}
+		if _, err := io.ReadFull(r, buf[:1]); err != nil {
+			return 0, err
+		}
+		for _, offer := range hello.offers {
+			if offer == buf[0] {
+				return offer, nil
+			}
+		}
+		return 0, fmt.Errorf("server picked compression %d, which wasn't offered", buf[0])
+	case relayStatusBadVersion:
+		return 0, relayVersionError{buf[0]}
+	case relayStatusBadCompression:
+		return 0, errors.New("server doesn't allow the offered compressions")
+	}
+	return 0, fmt.Errorf("hello rejected with status %d", buf[1])
+}
+
+// Connects with dial and sends the hello, offering the compressions and
+// asking for heartbeats, and returns the connection, the compression the
+// server picked and the heartbeat interval it will keep to, 0 if the server
+// doesn't send heartbeats. If the server speaks an older version of the
+// protocol, the hello is sent again over a new connection in its version.
+func relayClientHandshake(dial func() (net.Conn, error), offers []byte, window,
+	heartbeat uint16) (net.Conn, byte, uint16, error) {
+
+	hello := relayHello{relayVersion, offers, window, heartbeat}
+	for {
+		conn, err := dial()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		conn.SetDeadline(time.Now().Add(relayHandshakeTimeout))
+		var compression byte
+		if err = writeRelayHello(conn, hello); err == nil {
+			compression, err = readRelayReply(conn, hello)
+		}
+		if err == nil {
+			conn.SetDeadline(time.Time{})
+			if hello.version < 3 || window == 0 {
+				hello.heartbeat = 0
+			}
+			return conn, compression, hello.heartbeat, nil
+		}
+		conn.Close()
+		if ve, ok := err.(relayVersionError); ok && ve.server >= 1 &&
+			ve.server < hello.version {
+
+			hello.version = ve.server
+			if hello.version == 1 {
+				hello.offers = offers[:1]
+			}
+			continue
+		}
+		return nil, 0, 0, fmt.Errorf("handshake failed: %s", err)
+	}
+}
+
+func writeRelayAck(w io.Writer, count uint64) error {
+	buf := make([]byte, relayAckSize)
+	binary.BigEndian.PutUint64(buf, count)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readRelayAck(r io.Reader) (uint64, error) {
+	buf := make([]byte, relayAckSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+// Stream compressor whose output is flushed after each record, so records
+// aren't held back waiting for more data.
+type relayWriter interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+// Wraps an uncompressed stream so it satisfies relayWriter.
+type plainRelayWriter struct {
+	io.Writer
+}
+
+func (p plainRelayWriter) Flush() error {
+	return nil
+}
+
+func (p plainRelayWriter) Close() error {
+	return nil
+}
+
+func newRelayWriter(w io.Writer, compression byte) (relayWriter, error) {
+	switch compression {
+	case relayCompressionNone:
+		return plainRelayWriter{w}, nil
+	case relayCompressionSnappy:
+		return snappy.NewBufferedWriter(w), nil
+	case relayCompressionZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	}
+	return nil, fmt.Errorf("unknown compression %d", compression)
+}
+
+// Returns a reader decompressing the stream, and a function that releases
+// the decompressor's resources.
+func newRelayReader(r io.Reader, compression byte) (io.Reader, func(), error) {
+	switch compression {
+	case relayCompressionNone:
+		return r, func() {}, nil
+	case relayCompressionSnappy:
+		return snappy.NewReader(r), func() {}, nil
+	case relayCompressionZstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		return d, d.Close, nil
+	}
+	return nil, nil, fmt.Errorf("unknown compression %d", compression)
+}
@@ -0,0 +1,329 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package tcp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+// How long the spool drainer waits for more records when all of the spools
+// are empty, and how long a source waits for room in its full spool.
+var spoolPollInterval = 100 * time.Millisecond
+
+// Prefixes of spool directory names, distinguishing sources keyed by TLS
+// client identity from those keyed by host.
+const (
+	peerSpoolPrefix = "peer-"
+	hostSpoolPrefix = "host-"
+)
+
+var spoolNameRe = regexp.MustCompile("\\W")
+
+// Returns the name of a source's spool directory, which also keys the
+// source's spool in its spoolSet, so that a host can't share the spool of a
+// TLS client whose identity matches its address.
+func spoolName(key string, isPeer bool) string {
+	if isPeer {
+		return peerSpoolPrefix + url.QueryEscape(key)
+	}
+	return hostSpoolPrefix + url.QueryEscape(key)
+}
+
+// The records received from one source, waiting for their turn to be
+// delivered.
+type sourceSpool struct {
+	key       string
+	feeder    *BufferFeeder
+	reader    *BufferReader
+	deliverer Deliverer
+	// Serializes writes from the source's connections.
+	lock sync.Mutex
+
+	receivedCount  int64
+	deliveredCount int64
+	// Timestamp of the most recently delivered message.
+	deliveredTimestamp int64
+	// Counts and time as of the last report, for working out rates.
+	lastReceived  int64
+	lastDelivered int64
+	lastReport    time.Time
+}
+
+// Writes a record to the spool, waiting for room if the spool is full.
+func (s *sourceSpool) write(pack *PipelinePack, stopChan chan struct{}) error {
+	defer pack.Recycle(nil)
+	for {
+		s.lock.Lock()
+		err := s.feeder.QueueRecord(pack)
+		s.lock.Unlock()
+		if err == nil {
+			atomic.AddInt64(&s.receivedCount, 1)
+			return nil
+		}
+		if err != QueueIsFull {
+			return err
+		}
+		select {
+		case <-stopChan:
+			return ErrStopping
+		case <-time.After(spoolPollInterval):
+		}
+	}
+}
+
+// The spools of a spooling input, one for each source, from which the
+// sources' records are delivered in turn.
+type spoolSet struct {
+	// Directory under the base dir holding the spools of each input of the
+	// plugin type, e.g. "heka_input_spool".
+	dirName string
+	conf    QueueBufferConfig
+	quantum uint
+	// Most spools that get will create, so that sources can't fill the disk
+	// with spools by connecting from ever more addresses.
+	maxSpools uint
+	// Returns the pack decorator for the records of a source keyed by TLS
+	// client identity, or, given an empty key, of any other source.
+	peerDecorator func(key string) func(*PipelinePack)
+	ir            InputRunner
+	pConfig       *PipelineConfig
+	// Closed to stop draining, and to stop sources waiting for room.
+	stopChan chan struct{}
+	lock     sync.Mutex
+	// Keyed by spool name.
+	spools map[string]*sourceSpool
+}
+
+func newSpoolSet(dirName string, conf QueueBufferConfig, quantum, maxSpools uint,
+	peerDecorator func(string) func(*PipelinePack)) *spoolSet {
+
+	return &spoolSet{
+		dirName:       dirName,
+		conf:          conf,
+		quantum:       quantum,
+		maxSpools:     maxSpools,
+		peerDecorator: peerDecorator,
+		stopChan:      make(chan struct{}),
+		spools:        make(map[string]*sourceSpool),
+	}
+}
+
+// Returns the directory holding this input's spools.
+func (ss *spoolSet) dir() string {
+	name := spoolNameRe.ReplaceAllString(ss.ir.Name(), "_")
+	return ss.pConfig.Globals.PrependBaseDir(filepath.Join(ss.dirName, name))
+}
+
+// Opens the spools left behind by earlier runs.
+func (ss *spoolSet) open() error {
+	entries, err := ioutil.ReadDir(ss.dir())
+	if err != nil {
+		// Nothing's been spooled yet.
+		return nil
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		var escaped string
+		isPeer := strings.HasPrefix(name, peerSpoolPrefix)
+		if isPeer {
+			escaped = strings.TrimPrefix(name, peerSpoolPrefix)
+		} else if strings.HasPrefix(name, hostSpoolPrefix) {
+			escaped = strings.TrimPrefix(name, hostSpoolPrefix)
+		}
+		if !entry.IsDir() || escaped == "" {
+			continue
+		}
+		key, err := url.QueryUnescape(escaped)
+		if err != nil {
+			continue
+		}
+		// Spools left behind are always reopened so their records aren't
+		// stranded, even if there are more of them than are now allowed.
+		ss.lock.Lock()
+		if _, ok := ss.spools[spoolName(key, isPeer)]; !ok {
+			_, err = ss.create(key, isPeer)
+		}
+		ss.lock.Unlock()
+		if err != nil {
+			return fmt.Errorf("can't open spool for %s: %s", key, err)
+		}
+	}
+	return nil
+}
+
+// Returns the source's spool, creating it if need be.
+func (ss *spoolSet) get(key string, isPeer bool) (*sourceSpool, error) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	if s, ok := ss.spools[spoolName(key, isPeer)]; ok {
+		return s, nil
+	}
+	if uint(len(ss.spools)) >= ss.maxSpools {
+		return nil, fmt.Errorf("already spooling for max_spools (%d) sources",
+			ss.maxSpools)
+	}
+	return ss.create(key, isPeer)
+}
+
+// Creates the source's spool. Must be called with the lock held.
+func (ss *spoolSet) create(key string, isPeer bool) (*sourceSpool, error) {
+	name := spoolName(key, isPeer)
+	queue := filepath.Join(ss.dir(), name)
+	config := ss.conf
+	feeder, reader, err := NewSpool(queue, ss.ir.Name(), &config, ss.pConfig)
+	if err != nil {
+		return nil, err
+	}
+	s := &sourceSpool{
+		key:        key,
+		feeder:     feeder,
+		reader:     reader,
+		deliverer:  ss.ir.NewDeliverer(key),
+		lastReport: time.Now(),
+	}
+	if isPeer {
+		s.deliverer.SetPackDecorator(ss.peerDecorator(key))
+	} else {
+		s.deliverer.SetPackDecorator(ss.peerDecorator(""))
+	}
+	ss.spools[name] = s
+	return s, nil
+}
+
+// Returns the spools, ordered by key.
+func (ss *spoolSet) list() []*sourceSpool {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	spools := make([]*sourceSpool, 0, len(ss.spools))
+	for _, s := range ss.spools {
+		spools = append(spools, s)
+	}
+	sort.Slice(spools, func(a, b int) bool {
+		return spools[a].key < spools[b].key
+	})
+	return spools
+}
+
+func (ss *spoolSet) stop() {
+	close(ss.stopChan)
+}
+
+func (ss *spoolSet) close() {
+	for _, s := range ss.list() {
+		s.deliverer.Done()
+		if err := s.reader.Close(); err != nil {
+			ss.ir.LogError(fmt.Errorf("can't write spool checkpoint for %s: %s",
+				s.key, err))
+		}
+		s.feeder.Close()
+	}
+}
+
+// Delivers the spooled records until stopped, taking up to the drain quantum
+// from each source in turn so that a busy source can't hold up the others.
+func (ss *spoolSet) drain() {
+	packSupply := ss.ir.InChan()
+	for {
+		drained := false
+		for _, s := range ss.list() {
+			for n := uint(0); n < ss.quantum; n++ {
+				var pack *PipelinePack
+				select {
+				case pack = <-packSupply:
+				case <-ss.stopChan:
+					return
+				}
+				if err := s.reader.NextRecord(pack); err != nil {
+					pack.Recycle(nil)
+					if err != QueueNoRecord && err != QueueNeedData {
+						ss.ir.LogError(fmt.Errorf("can't read spool for %s: %s",
+							s.key, err))
+					}
+					break
+				}
+				cursor := pack.QueueCursor
+				atomic.StoreInt64(&s.deliveredTimestamp, pack.Message.GetTimestamp())
+				s.deliverer.Deliver(pack)
+				if err := s.reader.UpdateCursor(cursor); err != nil {
+					ss.ir.LogError(fmt.Errorf("can't update spool cursor for %s: %s",
+						s.key, err))
+				}
+				atomic.AddInt64(&s.deliveredCount, 1)
+				drained = true
+			}
+		}
+		if !drained {
+			select {
+			case <-ss.stopChan:
+				return
+			case <-time.After(spoolPollInterval):
+			}
+		}
+	}
+}
+
+// Adds each source's receive and delivery rates, spool size and delivery
+// lag to an input's report message.
+func (ss *spoolSet) reportMsg(msg *message.Message) {
+	now := time.Now()
+	for _, s := range ss.list() {
+		received := atomic.LoadInt64(&s.receivedCount)
+		delivered := atomic.LoadInt64(&s.deliveredCount)
+		s.lock.Lock()
+		var receiveRate, deliverRate float64
+		if secs := now.Sub(s.lastReport).Seconds(); secs > 0 {
+			receiveRate = float64(received-s.lastReceived) / secs
+			deliverRate = float64(delivered-s.lastDelivered) / secs
+		}
+		s.lastReceived, s.lastDelivered, s.lastReport = received, delivered, now
+		s.lock.Unlock()
+
+		message.NewInt64Field(msg, fmt.Sprintf("%s-ReceivedCount", s.key),
+			received, "count")
+		message.NewInt64Field(msg, fmt.Sprintf("%s-DeliveredCount", s.key),
+			delivered, "count")
+		spoolBytes := s.reader.UnackedBytes()
+		message.NewInt64Field(msg, fmt.Sprintf("%s-SpoolBytes", s.key),
+			int64(spoolBytes), "B")
+		var lag float64
+		if ts := atomic.LoadInt64(&s.deliveredTimestamp); spoolBytes > 0 && ts > 0 {
+			lag = now.Sub(time.Unix(0, ts)).Seconds()
+		}
+		if field, err := message.NewField(fmt.Sprintf("%s-DeliveryLag", s.key),
+			lag, "s"); err == nil {
+			msg.AddField(field)
+		}
+		if field, err := message.NewField(fmt.Sprintf("%s-ReceiveRate", s.key),
+			receiveRate, "count/s"); err == nil {
+			msg.AddField(field)
+		}
+		if field, err := message.NewField(fmt.Sprintf("%s-DeliveryRate", s.key),
+			deliverRate, "count/s"); err == nil {
+			msg.AddField(field)
+		}
+	}
+}
@@ -16,13 +16,17 @@
 package tcp
 
 import (
+	"bufio"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
+	"heka/message"
 	. "heka/pipeline"
 )
 
@@ -35,6 +39,19 @@ type TcpInput struct {
 	stopChan          chan bool
 	ir                InputRunner
 	config            *TcpInputConfig
+	authorizer        *PeerAuthorizer
+	// Compressions a TcpOutput may negotiate, nil if it can't.
+	allowed map[byte]bool
+	limiter *ConnLimiter
+	// Threshold of unacknowledged records at which an acknowledgement is sent
+	// straight away, as a function of the client's ack window, nil if the
+	// input doesn't acknowledge records.
+	ackThreshold func(window uint16) uint64
+	ackInterval  time.Duration
+	// Each source's spool, if spooling.
+	spools *spoolSet
+	// Transport metadata written to messages, nil if none is.
+	connFields *ConnFields
 }
 
 type TcpInputConfig struct {
@@ -49,6 +66,9 @@ type TcpInputConfig struct {
 	UseTls bool `toml:"use_tls"`
 	// Subsection for TLS configuration.
 	Tls TlsConfig
+	// Set to true if the listening socket should be opened with SO_REUSEPORT,
+	// so that another hekad can listen on the same address during an upgrade.
+	ReusePort bool `toml:"reuse_port"`
 	// Set to true if TCP Keep Alive should be used.
 	KeepAlive bool `toml:"keep_alive"`
 	// Integer indicating seconds between keep alives.
@@ -57,13 +77,76 @@ type TcpInputConfig struct {
 	Decoder string
 	// So we can default to using HekaFramingSplitter.
 	Splitter string
+	// Client certificate CN / SAN glob patterns that are allowed to connect
+	// over TLS. Empty means any client that isn't denied is allowed.
+	AllowedPeers []string `toml:"allowed_peers"`
+	// Client certificate CN / SAN glob patterns that are never allowed to
+	// connect over TLS.
+	DeniedPeers []string `toml:"denied_peers"`
+	// Map of tenant name to PEM CA file. If set, clients must present a
+	// certificate issued by one of these CAs, and are assigned the
+	// corresponding tenant.
+	TenantCAs map[string]string `toml:"tenant_cafiles"`
+	// Name of the message field into which the authenticated TLS client
+	// identity is written, e.g. "TlsPeer". Unset by default, since it costs
+	// every message a re-encode and replaces the field as set upstream.
+	PeerIdentityField string `toml:"peer_identity_field"`
+	// Name of the message field into which the authenticated TLS client's
+	// tenant is written, e.g. "TlsTenant". Unset by default.
+	PeerTenantField string `toml:"peer_tenant_field"`
+	// Stream compressions ("none", "snappy", "zstd") a TcpOutput may
+	// negotiate. Empty means connections are never checked for the
+	// negotiation's hello. Defaults to all of them.
+	Compressions []string `toml:"compressions"`
+	// Subsection of listening socket settings, such as the address family
+	// and buffer sizes.
+	Socket SocketConfig `toml:"socket"`
+	// Subsection of connection limits, such as the maximum number of
+	// connections per client.
+	Limits ConnLimitConfig `toml:"limits"`
+	// Acknowledgements sent to clients that ask for them in their hello:
+	// "none", "record" to acknowledge records as soon as they've been
+	// delivered, or spooled if spooling, or "window" to hold
+	// acknowledgements back for up to ack_interval, as HekaInput does.
+	// Defaults to "none".
+	Acks string `toml:"acks"`
+	// Maximum number of milliseconds an acknowledgement is held back in
+	// "window" mode, and how often heartbeats are checked for.
+	AckInterval uint `toml:"ack_interval"`
+	// Set to true to write received records to a spool for each source,
+	// keyed by the verified TLS client identity or else the client's IP
+	// address, acknowledging them once spooled and delivering them from the
+	// spools in turn.
+	UseSpool bool `toml:"use_spool"`
+	// Settings for each source's spool. The full action is ignored, records
+	// stop being read while a source's spool is full.
+	Spool QueueBufferConfig
+	// Number of records delivered from each source's spool before moving on
+	// to the next.
+	DrainQuantum uint `toml:"drain_quantum"`
+	// Maximum number of sources spooled for at once, beyond which new
+	// sources are turned away. Defaults to 1000.
+	MaxSpools uint `toml:"max_spools"`
+	// Subsection choosing the transport metadata, such as the client's
+	// address and the TLS version, written to each message's fields.
+	ConnectionFields ConnFieldsConfig `toml:"connection_fields"`
 }
 
 func (t *TcpInput) ConfigStruct() interface{} {
 	config := &TcpInputConfig{
-		Net:      "tcp",
-		Decoder:  "ProtobufDecoder",
-		Splitter: "HekaFramingSplitter",
+		Net:          "tcp",
+		Decoder:      "ProtobufDecoder",
+		Splitter:     "HekaFramingSplitter",
+		Compressions: []string{"none", "snappy", "zstd"},
+		Acks:         "none",
+		AckInterval:  100,
+		Spool: QueueBufferConfig{
+			CursorUpdateCount: 50,
+			MaxFileSize:       128 * 1024 * 1024,
+		},
+		DrainQuantum:     10,
+		MaxSpools:        1000,
+		ConnectionFields: ConnFieldsConfig{Prefix: "Conn"},
 	}
 	config.Tls = TlsConfig{PreferServerCiphers: true}
 	return config
@@ -72,11 +155,15 @@ func (t *TcpInput) ConfigStruct() interface{} {
 func (t *TcpInput) Init(config interface{}) error {
 	var err error
 	t.config = config.(*TcpInputConfig)
-	address, err := net.ResolveTCPAddr(t.config.Net, t.config.Address)
+	network, err := t.config.Socket.Network(t.config.Net)
+	if err != nil {
+		return err
+	}
+	address, err := net.ResolveTCPAddr(network, t.config.Address)
 	if err != nil {
 		return fmt.Errorf("ResolveTCPAddress failed: %s\n", err.Error())
 	}
-	t.listener, err = net.ListenTCP(t.config.Net, address)
+	t.listener, err = t.config.Socket.Listen(network, address.String(), t.config.ReusePort)
 	if err != nil {
 		return fmt.Errorf("ListenTCP failed: %s\n", err.Error())
 	}
@@ -87,10 +174,58 @@ func (t *TcpInput) Init(config interface{}) error {
 			t.listener.Close()
 		}
 	}()
+	t.limiter = NewConnLimiter(t.config.Limits)
+	t.listener = t.limiter.Listener(t.listener)
 	if t.config.UseTls {
 		if err = t.setupTls(&t.config.Tls); err != nil {
 			return err
 		}
+	} else if len(t.config.AllowedPeers) > 0 || len(t.config.DeniedPeers) > 0 ||
+		len(t.config.TenantCAs) > 0 {
+
+		return errors.New("peer authorization settings require use_tls")
+	}
+	if len(t.config.Compressions) > 0 {
+		if t.allowed, err = parseRelayAllowed(t.config.Compressions); err != nil {
+			return err
+		}
+	}
+	switch t.config.Acks {
+	case "", "none":
+	case "record":
+		t.ackThreshold = func(window uint16) uint64 { return 1 }
+	case "window":
+		t.ackThreshold = func(window uint16) uint64 { return uint64(window/2) + 1 }
+	default:
+		return fmt.Errorf("acks must be 'none', 'record' or 'window', not '%s'",
+			t.config.Acks)
+	}
+	if t.ackThreshold != nil {
+		if t.allowed == nil {
+			return errors.New("acks require compressions, clients ask for them " +
+				"in the compression negotiation's hello")
+		}
+		if t.config.AckInterval == 0 {
+			return errors.New("ack_interval must be greater than 0")
+		}
+		t.ackInterval = time.Duration(t.config.AckInterval) * time.Millisecond
+	}
+	if t.connFields, err = NewConnFields(t.config.ConnectionFields); err != nil {
+		return err
+	}
+	if t.config.UseSpool {
+		if t.connFields != nil {
+			return errors.New("connection_fields can't be used with use_spool, " +
+				"spooled records don't keep them")
+		}
+		if t.config.DrainQuantum == 0 {
+			return errors.New("drain_quantum must be greater than 0")
+		}
+		if t.config.MaxSpools == 0 {
+			return errors.New("max_spools must be greater than 0")
+		}
+		t.spools = newSpoolSet("tcp_input_spool", t.config.Spool, t.config.DrainQuantum,
+			t.config.MaxSpools, t.spoolPeerDecorator)
 	}
 	if t.config.KeepAlivePeriod != 0 {
 		t.keepAliveDuration = time.Duration(t.config.KeepAlivePeriod) * time.Second
@@ -101,16 +236,37 @@ func (t *TcpInput) Init(config interface{}) error {
 }
 
 func (t *TcpInput) setupTls(tomlConf *TlsConfig) (err error) {
-	if tomlConf.CertFile == "" || tomlConf.KeyFile == "" {
-		return errors.New("TLS config requires both cert_file and key_file value.")
+	if len(t.config.AllowedPeers) > 0 || len(t.config.DeniedPeers) > 0 ||
+		len(t.config.TenantCAs) > 0 {
+
+		t.authorizer, err = NewPeerAuthorizer(t.config.AllowedPeers,
+			t.config.DeniedPeers, t.config.TenantCAs)
+		if err != nil {
+			return err
+		}
+		// Tenant CAs do their own verification, but we still need the
+		// client to send us a certificate.
+		if t.authorizer.UsesTenants() {
+			if tomlConf.ClientAuth == "" {
+				tomlConf.ClientAuth = "RequireAnyClientCert"
+			}
+		} else if !VerifiesClients(tomlConf) {
+			return errPeersUnverified
+		}
 	}
-	var goConf *tls.Config
-	if goConf, err = CreateGoTlsConfig(tomlConf); err == nil {
-		t.listener = tls.NewListener(t.listener, goConf)
+	var listener net.Listener
+	if listener, err = NewTlsListener(t.listener, tomlConf); err == nil {
+		t.listener = listener
 	}
 	return
 }
 
+// A TCP connection, or one wrapping it, whose keep alives can be set.
+type keepAliveConn interface {
+	SetKeepAlive(keepalive bool) error
+	SetKeepAlivePeriod(d time.Duration) error
+}
+
 // Listen on the provided TCP connection, extracting messages from the incoming
 // data until the connection is closed or Stop is called on the input.
 func (t *TcpInput) handleConnection(conn net.Conn) {
@@ -120,16 +276,69 @@ func (t *TcpInput) handleConnection(conn net.Conn) {
 		host = raddr
 	}
 
-	deliverer := t.ir.NewDeliverer(host)
+	var peer *PeerIdentity
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if peer, err = t.handshake(tlsConn); err != nil {
+			t.ir.LogError(fmt.Errorf("TLS client %s rejected: %s", raddr, err))
+			conn.Close()
+			t.wg.Done()
+			return
+		}
+	}
+
+	var md *ConnMetadata
+	if t.connFields != nil {
+		md = NewConnMetadata(conn)
+	}
+	// Records are counted for acknowledgement, and spooled, by an acking
+	// deliverer, only needed if the input does either.
+	var (
+		acking *ackingDeliverer
+		inner  Deliverer
+	)
+	if t.spools != nil || t.ackThreshold != nil {
+		acking = &ackingDeliverer{conn: conn, ir: t.ir, notify: make(chan struct{}, 1)}
+	}
+	if t.spools != nil {
+		key, isPeer := host, false
+		if peer != nil {
+			key, isPeer = peerSpoolKey(peer), true
+		}
+		acking.stopChan = t.spools.stopChan
+		if acking.spool, err = t.spools.get(key, isPeer); err != nil {
+			t.ir.LogError(fmt.Errorf("can't open spool for %s: %s", key, err))
+			conn.Close()
+			t.wg.Done()
+			return
+		}
+		inner = acking
+	} else {
+		inner = t.ir.NewDeliverer(host)
+		if t.config.PeerIdentityField != "" || t.config.PeerTenantField != "" ||
+			t.connFields != nil {
+			inner.SetPackDecorator(t.packDecorator(peer, md))
+		}
+		if acking != nil {
+			acking.Deliverer = inner
+			inner = acking
+		}
+	}
+	deliverer, release := t.limiter.WrapDeliverer(inner, conn, t.stopChan)
 	sr := t.ir.NewSplitterRunner(host)
 
 	defer func() {
+		release()
 		conn.Close()
 		t.wg.Done()
 		deliverer.Done()
 		sr.Done()
 	}()
 
+	if t.spools != nil && !sr.UseMsgBytes() {
+		t.ir.LogError(errors.New("spooling requires a splitter that uses message bytes"))
+		return
+	}
+
 	if !sr.UseMsgBytes() {
 		name := t.ir.Name()
 		packDec := func(pack *PipelinePack) {
@@ -139,6 +348,52 @@ func (t *TcpInput) handleConnection(conn net.Conn) {
 		sr.SetPackDecorator(packDec)
 	}
 
+	var reader io.Reader = conn
+	if t.allowed != nil {
+		buffered := bufio.NewReader(conn)
+		reader = buffered
+		hello, compressed, release, stopped := t.negotiate(conn, buffered)
+		if stopped {
+			return
+		}
+		if compressed != nil {
+			defer release()
+			if md != nil {
+				// Set before any records are read, so decorating can't race it.
+				md.Protocol = fmt.Sprintf("relay/%d", hello.version)
+			}
+			if t.ackThreshold != nil && hello.window > 0 {
+				acking.threshold = t.ackThreshold(hello.window)
+				done := make(chan struct{})
+				ackDone := make(chan struct{})
+				go func() {
+					sendRelayAcks(conn, acking, t.ackInterval,
+						time.Duration(hello.heartbeat)*time.Second, done)
+					close(ackDone)
+				}()
+				defer func() {
+					close(done)
+					<-ackDone
+				}()
+			}
+			// The decompressor can't resume after a read deadline passes, so
+			// the connection is closed to stop reading instead.
+			conn.SetReadDeadline(time.Time{})
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-t.stopChan:
+					conn.Close()
+				case <-done:
+				}
+			}()
+			for sr.SplitStream(compressed, deliverer) == nil {
+			}
+			return
+		}
+	}
+
 	stopped := false
 	for !stopped {
 		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
@@ -146,7 +401,7 @@ func (t *TcpInput) handleConnection(conn net.Conn) {
 		case <-t.stopChan:
 			stopped = true
 		default:
-			err = sr.SplitStream(conn, deliverer)
+			err = sr.SplitStream(reader, deliverer)
 			if err != nil {
 				if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
 					// keep the connection open, we are just checking to see if
@@ -159,8 +414,161 @@ func (t *TcpInput) handleConnection(conn net.Conn) {
 	}
 }
 
+// Checks whether the connection starts with the hello of a client
+// negotiating compression and, if it does, replies to it. Returns the hello,
+// the decompressed stream and a function releasing its decompressor if one
+// was negotiated, or true if the connection should be dropped.
+func (t *TcpInput) negotiate(conn net.Conn, reader *bufio.Reader) (
+	hello relayHello, compressed io.Reader, release func(), stopped bool) {
+
+	var (
+		magic []byte
+		err   error
+	)
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if magic, err = reader.Peek(len(relayMagic)); err == nil {
+			break
+		}
+		if neterr, ok := err.(net.Error); !ok || !neterr.Timeout() {
+			// Let the splitter have what was sent before the error.
+			return hello, nil, nil, len(magic) == 0
+		}
+		select {
+		case <-t.stopChan:
+			return hello, nil, nil, true
+		default:
+		}
+	}
+	if string(magic) != relayMagic {
+		return hello, nil, nil, false
+	}
+
+	raddr := conn.RemoteAddr().String()
+	conn.SetDeadline(time.Now().Add(relayHandshakeTimeout))
+	if hello, err = readRelayHello(reader); err != nil {
+		t.ir.LogError(fmt.Errorf("bad hello from %s: %s", raddr, err))
+		return hello, nil, nil, true
+	}
+	status, compression := negotiateRelay(hello, t.allowed)
+	if err = writeRelayReply(conn, hello.version, status, compression); err != nil ||
+		status != relayStatusOk {
+
+		if err == nil {
+			err = fmt.Errorf("rejected with status %d", status)
+		}
+		t.ir.LogError(fmt.Errorf("hello from %s: %s", raddr, err))
+		return hello, nil, nil, true
+	}
+	conn.SetDeadline(time.Time{})
+	compressed, release, err = newRelayReader(reader, compression)
+	if err != nil {
+		t.ir.LogError(fmt.Errorf("hello from %s: %s", raddr, err))
+		return hello, nil, nil, true
+	}
+	return hello, compressed, release, false
+}
+
+// handshake completes the TLS handshake for a new connection and, if the
+// client presented a certificate, returns its authorized identity.
+func (t *TcpInput) handshake(conn *tls.Conn) (*PeerIdentity, error) {
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	state := conn.ConnectionState()
+	if t.authorizer != nil {
+		return t.authorizer.Authorize(state)
+	}
+	// An unverified certificate could name anyone.
+	return VerifiedPeer(state), nil
+}
+
+// Returns the deliverer pack decorator of a connection, recording the TLS
+// client's identity, or removing any claimed one if it has none, and the
+// connection's metadata, if that's wanted.
+func (t *TcpInput) packDecorator(peer *PeerIdentity, md *ConnMetadata) func(*PipelinePack) {
+	peerDecorator := t.peerDecorator(peer)
+	return func(pack *PipelinePack) {
+		peerDecorator(pack)
+		if md != nil {
+			t.connFields.Write(pack.Message, md)
+		}
+	}
+}
+
+// peerDecorator returns a pack decorator that records the TLS client's
+// identity on each message received over its connection. A nil peer, one
+// that isn't verified, has any identity and tenant its client claims in
+// those fields removed, as does a peer without a tenant its tenant.
+func (t *TcpInput) peerDecorator(peer *PeerIdentity) func(*PipelinePack) {
+	var identity, tenant string
+	if peer != nil {
+		identity, tenant = peer.String(), peer.Tenant
+	}
+	return func(pack *PipelinePack) {
+		if t.config.PeerIdentityField != "" {
+			setTrustedField(pack.Message, t.config.PeerIdentityField, identity)
+		}
+		if t.config.PeerTenantField != "" {
+			setTrustedField(pack.Message, t.config.PeerTenantField, tenant)
+		}
+	}
+}
+
+// Returns the spool key of a TLS client, its identity, prefixed with its
+// tenant and a slash if it has one.
+func peerSpoolKey(peer *PeerIdentity) string {
+	if peer.Tenant != "" {
+		return peer.Tenant + "/" + peer.String()
+	}
+	return peer.String()
+}
+
+// Returns the pack decorator for the records spooled from the TLS client
+// with the given spool key, or, for an empty key, from an unverified client.
+func (t *TcpInput) spoolPeerDecorator(key string) func(*PipelinePack) {
+	if key == "" {
+		return t.peerDecorator(nil)
+	}
+	peer := &PeerIdentity{CommonName: key}
+	if t.authorizer != nil && t.authorizer.UsesTenants() {
+		if i := strings.Index(key, "/"); i >= 0 {
+			peer = &PeerIdentity{CommonName: key[i+1:], Tenant: key[:i]}
+		}
+	}
+	return t.peerDecorator(peer)
+}
+
+// setTrustedField replaces any client supplied fields of the given name with a
+// single string field containing the provided value, so a client can't spoof
+// values that downstream plugins will use for authorization decisions. An
+// empty value leaves no field at all.
+func setTrustedField(msg *message.Message, name, value string) {
+	for f := msg.FindFirstField(name); f != nil; f = msg.FindFirstField(name) {
+		msg.DeleteField(f)
+	}
+	if value != "" {
+		message.NewStringField(msg, name, value)
+	}
+}
+
 func (t *TcpInput) Run(ir InputRunner, h PluginHelper) error {
 	t.ir = ir
+	if t.spools != nil {
+		t.spools.ir, t.spools.pConfig = ir, h.PipelineConfig()
+		// Whatever was left in the spools last time gets delivered first.
+		if err := t.spools.open(); err != nil {
+			t.listener.Close()
+			return err
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.spools.drain()
+		}()
+	}
 	var conn net.Conn
 	var e error
 	for {
@@ -173,7 +581,7 @@ func (t *TcpInput) Run(ir InputRunner, h PluginHelper) error {
 			}
 		}
 		if t.config.KeepAlive {
-			tcpConn, ok := conn.(*net.TCPConn)
+			tcpConn, ok := conn.(keepAliveConn)
 			if !ok {
 				return errors.New("KeepAlive only supported for TCP Connections.")
 			}
@@ -186,10 +594,24 @@ func (t *TcpInput) Run(ir InputRunner, h PluginHelper) error {
 		go t.handleConnection(conn)
 	}
 	t.wg.Wait()
+	if t.spools != nil {
+		t.spools.close()
+	}
+	return nil
+}
+
+func (t *TcpInput) ReportMsg(msg *message.Message) error {
+	t.limiter.ReportMsg(msg)
+	if t.spools != nil {
+		t.spools.reportMsg(msg)
+	}
 	return nil
 }
 
 func (t *TcpInput) Stop() {
+	if t.spools != nil {
+		t.spools.stop()
+	}
 	if err := t.listener.Close(); err != nil {
 		t.ir.LogError(fmt.Errorf("Error closing listener: %s", err))
 	}
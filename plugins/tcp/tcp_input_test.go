@@ -17,16 +17,23 @@ package tcp
 
 import (
 	"crypto/tls"
+	"encoding/pem"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"heka/message"
 	. "heka/pipeline"
 	pipeline_ts "heka/pipeline/testsupport"
 	"heka/pipelinemock"
 	plugins_ts "heka/plugins/testsupport"
+	"github.com/gogo/protobuf/proto"
 	"github.com/rafrombrc/gomock/gomock"
 	gs "github.com/rafrombrc/gospec/src/gospec"
 )
@@ -44,6 +51,31 @@ func (a *address) String() string {
 	return a.str
 }
 
+// Applies its pack decorator to each pack delivered, and then stops trusting
+// the pack's message bytes, as the pipeline's deliverers do.
+type decoratingDeliverer struct {
+	decorator func(*PipelinePack)
+	delivered chan *PipelinePack
+}
+
+func (d *decoratingDeliverer) Deliver(pack *PipelinePack) {
+	if d.decorator != nil {
+		d.decorator(pack)
+		pack.TrustMsgBytes = false
+	}
+	d.delivered <- pack
+}
+
+func (d *decoratingDeliverer) DeliverFunc() DeliverFunc {
+	return d.Deliver
+}
+
+func (d *decoratingDeliverer) SetPackDecorator(decorator func(*PipelinePack)) {
+	d.decorator = decorator
+}
+
+func (d *decoratingDeliverer) Done() {}
+
 func TcpInputSpec(c gs.Context) {
 	t := &pipeline_ts.SimpleT{}
 	ctrl := gomock.NewController(t)
@@ -128,6 +160,411 @@ func TcpInputSpec(c gs.Context) {
 			})
 		})
 
+		c.Specify("keeps message bytes trusted w/ the default config", func() {
+			defaults := tcpInput.ConfigStruct().(*TcpInputConfig)
+			defaults.Address = ith.AddrStr
+			c.Assume(tcpInput.Init(defaults), gs.IsNil)
+
+			deliverer := &decoratingDeliverer{delivered: make(chan *PipelinePack, 1)}
+			ith.MockInputRunner.EXPECT().Name().Return("mock_name")
+			ith.MockInputRunner.EXPECT().NewDeliverer(gomock.Any()).Return(deliverer)
+			ith.MockInputRunner.EXPECT().NewSplitterRunner(gomock.Any()).Return(
+				ith.MockSplitterRunner)
+			ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(false)
+			ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any())
+			ith.MockSplitterRunner.EXPECT().Done().Do(func() {
+				srDoneWG.Done()
+			})
+			splitCall := ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+				deliverer)
+			splitCall.Do(func(r io.Reader, del Deliverer) {
+				ioutil.ReadAll(r)
+				pack := NewPipelinePack(nil)
+				pack.TrustMsgBytes = true
+				del.Deliver(pack)
+			})
+			splitCall.Return(io.EOF)
+			srDoneWG.Add(1)
+			go func() {
+				errChan <- tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+			}()
+
+			outConn, err := net.Dial("tcp", ith.AddrStr)
+			c.Assume(err, gs.IsNil)
+			outConn.Write([]byte("THIS IS THE DATA"))
+			outConn.Close()
+			c.Expect((<-deliverer.delivered).TrustMsgBytes, gs.IsTrue)
+
+			tcpInput.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+			srDoneWG.Wait()
+		})
+
+		c.Specify("negotiating compression", func() {
+			config.Compressions = []string{"none", "zstd"}
+			err := tcpInput.Init(config)
+			c.Assume(err, gs.IsNil)
+
+			ith.MockInputRunner.EXPECT().Name().Return("mock_name")
+			ith.MockInputRunner.EXPECT().NewDeliverer(gomock.Any()).Return(ith.MockDeliverer)
+			ith.MockDeliverer.EXPECT().Done()
+			ith.MockInputRunner.EXPECT().NewSplitterRunner(gomock.Any()).Return(
+				ith.MockSplitterRunner)
+			ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(false)
+			ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any())
+			ith.MockSplitterRunner.EXPECT().Done().Do(func() {
+				srDoneWG.Done()
+			})
+			splitCall := ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+				ith.MockDeliverer)
+			splitCall.Do(func(r io.Reader, del Deliverer) {
+				recd, _ := ioutil.ReadAll(r)
+				bytesChan <- recd
+			})
+			splitCall.Return(io.EOF)
+			srDoneWG.Add(1)
+			go func() {
+				errChan <- tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+			}()
+
+			c.Specify("decompresses the stream of a TcpOutput", func() {
+				dial := func() (net.Conn, error) {
+					return net.Dial("tcp", ith.AddrStr)
+				}
+				offers := []byte{relayCompressionSnappy, relayCompressionZstd,
+					relayCompressionNone}
+				outConn, compression, _, err := relayClientHandshake(dial, offers, 0, 0)
+				c.Assume(err, gs.IsNil)
+				c.Expect(compression, gs.Equals, relayCompressionZstd)
+				writer, err := newRelayWriter(outConn, compression)
+				c.Assume(err, gs.IsNil)
+				data := []byte("THIS IS THE COMPRESSED DATA")
+				writer.Write(data)
+				writer.Close()
+				outConn.Close()
+
+				c.Expect(string(<-bytesChan), gs.Equals, string(data))
+				tcpInput.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+				srDoneWG.Wait()
+			})
+
+			c.Specify("passes other streams through as is", func() {
+				outConn, err := net.Dial("tcp", ith.AddrStr)
+				c.Assume(err, gs.IsNil)
+				data := []byte("THIS IS THE DATA")
+				outConn.Write(data)
+				outConn.Close()
+
+				c.Expect(string(<-bytesChan), gs.Equals, string(data))
+				tcpInput.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+				srDoneWG.Wait()
+			})
+		})
+
+		c.Specify("writes connection fields to decoded messages", func() {
+			config.Compressions = []string{"none"}
+			config.ConnectionFields = ConnFieldsConfig{Prefix: "Conn", Fields: []string{
+				"remote_addr", "local_port", "protocol", "tls_version"}}
+			c.Assume(tcpInput.Init(config), gs.IsNil)
+
+			decorators := make(chan func(*PipelinePack), 1)
+			ith.MockInputRunner.EXPECT().Name().Return("mock_name")
+			ith.MockInputRunner.EXPECT().NewDeliverer(gomock.Any()).Return(ith.MockDeliverer)
+			ith.MockDeliverer.EXPECT().SetPackDecorator(gomock.Any()).Do(
+				func(decorator func(*PipelinePack)) {
+					decorators <- decorator
+				})
+			ith.MockDeliverer.EXPECT().Done()
+			ith.MockInputRunner.EXPECT().NewSplitterRunner(gomock.Any()).Return(
+				ith.MockSplitterRunner)
+			ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(false)
+			ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any())
+			ith.MockSplitterRunner.EXPECT().Done().Do(func() {
+				srDoneWG.Done()
+			})
+			splitCall := ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+				ith.MockDeliverer)
+			splitCall.Do(func(r io.Reader, del Deliverer) {
+				recd, _ := ioutil.ReadAll(r)
+				bytesChan <- recd
+			})
+			splitCall.Return(io.EOF)
+			srDoneWG.Add(1)
+			go func() {
+				errChan <- tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+			}()
+
+			dial := func() (net.Conn, error) {
+				return net.Dial("tcp", ith.AddrStr)
+			}
+			outConn, _, _, err := relayClientHandshake(dial,
+				[]byte{relayCompressionNone}, 0, 0)
+			c.Assume(err, gs.IsNil)
+			outConn.Write([]byte("THIS IS THE DATA"))
+			outConn.Close()
+			<-bytesChan
+
+			pack := NewPipelinePack(nil)
+			pack.Message = new(message.Message)
+			message.NewStringField(pack.Message, "ConnRemoteAddr", "10.0.0.1")
+			(<-decorators)(pack)
+			addr, _ := pack.Message.GetFieldValue("ConnRemoteAddr")
+			c.Expect(addr, gs.Equals, "127.0.0.1")
+			c.Expect(len(pack.Message.FindAllFields("ConnRemoteAddr")), gs.Equals, 1)
+			port, _ := pack.Message.GetFieldValue("ConnLocalPort")
+			c.Expect(port, gs.Equals, int64(55565))
+			protocol, _ := pack.Message.GetFieldValue("ConnProtocol")
+			c.Expect(protocol, gs.Equals, fmt.Sprintf("relay/%d", relayVersion))
+			c.Expect(pack.Message.FindFirstField("ConnTlsVersion") == nil, gs.IsTrue)
+
+			tcpInput.Stop()
+			c.Expect(<-errChan, gs.IsNil)
+			srDoneWG.Wait()
+		})
+
+		c.Specify("removes peer fields claimed by unverified clients", func() {
+			config.PeerIdentityField = "TlsPeer"
+			config.PeerTenantField = "TlsTenant"
+
+			decorators := make(chan func(*PipelinePack), 1)
+			runServer := func() {
+				ith.MockInputRunner.EXPECT().Name().Return("mock_name")
+				ith.MockInputRunner.EXPECT().NewDeliverer(gomock.Any()).Return(
+					ith.MockDeliverer)
+				ith.MockDeliverer.EXPECT().SetPackDecorator(gomock.Any()).Do(
+					func(decorator func(*PipelinePack)) {
+						decorators <- decorator
+					})
+				ith.MockDeliverer.EXPECT().Done()
+				ith.MockInputRunner.EXPECT().NewSplitterRunner(gomock.Any()).Return(
+					ith.MockSplitterRunner)
+				ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(false)
+				ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any())
+				ith.MockSplitterRunner.EXPECT().Done().Do(func() {
+					srDoneWG.Done()
+				})
+				splitCall := ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+					ith.MockDeliverer)
+				splitCall.Do(func(r io.Reader, del Deliverer) {
+					recd, _ := ioutil.ReadAll(r)
+					bytesChan <- recd
+				})
+				splitCall.Return(io.EOF)
+				srDoneWG.Add(1)
+				go func() {
+					errChan <- tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+				}()
+			}
+
+			expectRemoved := func(outConn net.Conn) {
+				outConn.Write([]byte("THIS IS THE DATA"))
+				outConn.Close()
+				<-bytesChan
+
+				pack := NewPipelinePack(nil)
+				pack.Message = new(message.Message)
+				message.NewStringField(pack.Message, "TlsPeer", "admin.example.com")
+				message.NewStringField(pack.Message, "TlsTenant", "acme")
+				(<-decorators)(pack)
+				c.Expect(pack.Message.FindFirstField("TlsPeer") == nil, gs.IsTrue)
+				c.Expect(pack.Message.FindFirstField("TlsTenant") == nil, gs.IsTrue)
+
+				tcpInput.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+				srDoneWG.Wait()
+			}
+
+			c.Specify("over plain TCP", func() {
+				c.Assume(tcpInput.Init(config), gs.IsNil)
+				runServer()
+				outConn, err := net.Dial("tcp", ith.AddrStr)
+				c.Assume(err, gs.IsNil)
+				expectRemoved(outConn)
+			})
+
+			c.Specify("over TLS without a client certificate", func() {
+				config.UseTls = true
+				config.Tls = TlsConfig{
+					CertFile:   "./testsupport/cert.pem",
+					KeyFile:    "./testsupport/key.pem",
+					ClientAuth: "VerifyClientCertIfGiven",
+				}
+				c.Assume(tcpInput.Init(config), gs.IsNil)
+				runServer()
+				outConn, err := tls.Dial("tcp", ith.AddrStr,
+					&tls.Config{InsecureSkipVerify: true})
+				c.Assume(err, gs.IsNil)
+				expectRemoved(outConn)
+			})
+		})
+
+		c.Specify("acknowledging records", func() {
+			config.Compressions = []string{"none"}
+			config.AckInterval = 1000
+			delivered := make(chan string, 10)
+			expectConn := func(useMsgBytes bool) {
+				ith.MockInputRunner.EXPECT().Name().Return("mock_name").AnyTimes()
+				ith.MockInputRunner.EXPECT().NewSplitterRunner(gomock.Any()).Return(
+					ith.MockSplitterRunner)
+				ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(useMsgBytes).AnyTimes()
+				if !useMsgBytes {
+					ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any())
+				}
+				ith.MockSplitterRunner.EXPECT().Done().Do(func() {
+					srDoneWG.Done()
+				})
+				recycle := make(chan *PipelinePack, 1)
+				splitCall := ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+					gomock.Any())
+				splitCall.Do(func(r io.Reader, del Deliverer) {
+					for {
+						msgBytes, err := readRelayRecord(r)
+						if err != nil {
+							return
+						}
+						pack := NewPipelinePack(recycle)
+						pack.MsgBytes = []byte(msgBytes)
+						del.Deliver(pack)
+						<-recycle
+					}
+				})
+				splitCall.Return(io.EOF)
+			}
+			expectDeliveries := func(deliverer *pipelinemock.MockDeliverer) {
+				deliverer.EXPECT().Deliver(gomock.Any()).Do(func(pack *PipelinePack) {
+					msg := new(message.Message)
+					proto.Unmarshal(pack.MsgBytes, msg)
+					delivered <- msg.GetPayload()
+					pack.Recycle(nil)
+				}).AnyTimes()
+				deliverer.EXPECT().Done()
+			}
+			run := func() {
+				srDoneWG.Add(1)
+				go func() {
+					errChan <- tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+				}()
+			}
+			// Connects asking for acknowledgements, and sends the records.
+			send := func(window uint16, payloads ...string) net.Conn {
+				dial := func() (net.Conn, error) {
+					return net.Dial("tcp", ith.AddrStr)
+				}
+				outConn, _, _, err := relayClientHandshake(dial,
+					[]byte{relayCompressionNone}, window, 0)
+				c.Assume(err, gs.IsNil)
+				for _, payload := range payloads {
+					outConn.Write(frameRelayRecord(string(encodeRelayMessage(payload))))
+				}
+				outConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				return outConn
+			}
+			stop := func(outConn net.Conn) {
+				outConn.Close()
+				tcpInput.Stop()
+				c.Expect(<-errChan, gs.IsNil)
+				srDoneWG.Wait()
+			}
+
+			c.Specify("needs compressions to be negotiable", func() {
+				config.Acks = "record"
+				config.Compressions = []string{}
+				c.Expect(tcpInput.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("rejects unknown ack modes", func() {
+				config.Acks = "sometimes"
+				c.Expect(tcpInput.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("acknowledges each record once delivered", func() {
+				config.Acks = "record"
+				c.Assume(tcpInput.Init(config), gs.IsNil)
+				ith.MockInputRunner.EXPECT().NewDeliverer(gomock.Any()).Return(ith.MockDeliverer)
+				expectDeliveries(ith.MockDeliverer)
+				expectConn(false)
+				run()
+
+				outConn := send(8, "one", "two", "three")
+				var count uint64
+				for count < 3 {
+					acked, err := readRelayAck(outConn)
+					c.Assume(err, gs.IsNil)
+					c.Expect(acked > count, gs.IsTrue)
+					count = acked
+				}
+				c.Expect(count, gs.Equals, uint64(3))
+				c.Expect(<-delivered, gs.Equals, "one")
+				stop(outConn)
+			})
+
+			c.Specify("acknowledges a window's worth of records at once", func() {
+				config.Acks = "window"
+				c.Assume(tcpInput.Init(config), gs.IsNil)
+				ith.MockInputRunner.EXPECT().NewDeliverer(gomock.Any()).Return(ith.MockDeliverer)
+				expectDeliveries(ith.MockDeliverer)
+				expectConn(false)
+				run()
+
+				// Half the window and one more are acknowledged straight away,
+				// well before the ack interval passes.
+				start := time.Now()
+				outConn := send(4, "one", "two", "three")
+				count, err := readRelayAck(outConn)
+				c.Expect(err, gs.IsNil)
+				c.Expect(count, gs.Equals, uint64(3))
+				c.Expect(time.Since(start) < time.Second, gs.IsTrue)
+				stop(outConn)
+			})
+
+			c.Specify("acknowledges records once they're spooled", func() {
+				tmpDir, err := ioutil.TempDir("", "tcp-input-tests")
+				c.Assume(err, gs.IsNil)
+				defer os.RemoveAll(tmpDir)
+				globals := DefaultGlobals()
+				globals.BaseDir = tmpDir
+				spoolConfig := NewPipelineConfig(globals)
+				spoolConfig.RegisterDefault("HekaFramingSplitter")
+				ith.MockHelper.EXPECT().PipelineConfig().Return(spoolConfig)
+				supply := make(chan *PipelinePack, 2)
+				for i := 0; i < cap(supply); i++ {
+					supply <- NewPipelinePack(supply)
+				}
+				ith.MockInputRunner.EXPECT().InChan().Return(supply).AnyTimes()
+				ith.MockInputRunner.EXPECT().NewDeliverer("127.0.0.1").Return(
+					ith.MockDeliverer)
+				expectDeliveries(ith.MockDeliverer)
+				ith.MockDeliverer.EXPECT().SetPackDecorator(gomock.Any())
+
+				config.Acks = "record"
+				config.UseSpool = true
+				config.DrainQuantum = 10
+				config.MaxSpools = 10
+				config.Spool = QueueBufferConfig{CursorUpdateCount: 1,
+					MaxFileSize: 1024 * 1024}
+				c.Assume(tcpInput.Init(config), gs.IsNil)
+				expectConn(true)
+				run()
+
+				outConn := send(8, "one", "two")
+				var count uint64
+				for count < 2 {
+					count, err = readRelayAck(outConn)
+					c.Assume(err, gs.IsNil)
+				}
+				c.Expect(<-delivered, gs.Equals, "one")
+				c.Expect(<-delivered, gs.Equals, "two")
+
+				msg := new(message.Message)
+				tcpInput.ReportMsg(msg)
+				received, _ := msg.GetFieldValue("127.0.0.1-ReceivedCount")
+				c.Expect(received, gs.Equals, int64(2))
+				stop(outConn)
+			})
+		})
+
 		c.Specify("using TLS", func() {
 			config.UseTls = true
 
@@ -175,7 +612,13 @@ func TcpInputSpec(c gs.Context) {
 				err := tcpInput.Init(config)
 				c.Expect(err, gs.IsNil)
 
-				go startServer()
+				rejected := make(chan error, 1)
+				ith.MockInputRunner.EXPECT().LogError(gomock.Any()).Do(func(err error) {
+					rejected <- err
+				})
+				go func() {
+					errChan <- tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+				}()
 
 				clientConfig := &tls.Config{
 					InsecureSkipVerify: true,
@@ -185,13 +628,85 @@ func TcpInputSpec(c gs.Context) {
 				c.Expect(conn, gs.IsNil)
 				c.Expect(err, gs.Not(gs.IsNil))
 
-				<-bytesChan
+				err = <-rejected
+				c.Expect(strings.Contains(err.Error(), "rejected"), gs.IsTrue)
 
 				tcpInput.Stop()
 				err = <-errChan
 				c.Expect(err, gs.IsNil)
-				srDoneWG.Wait()
 			})
+
+			c.Specify("requires verified client certs for an allow list", func() {
+				config.Tls.ClientAuth = "RequireAnyClientCert"
+				config.AllowedPeers = []string{"nobody"}
+				err := tcpInput.Init(config)
+				c.Expect(err, gs.Equals, errPeersUnverified)
+			})
+
+			c.Specify("rejects client certs not on the allow list", func() {
+				tmpDir, _ := ioutil.TempDir("", "heka-tls")
+				defer os.RemoveAll(tmpDir)
+				ca, caKey := makeTestCert("Test CA", nil, true, nil, nil)
+				caFile := filepath.Join(tmpDir, "ca.pem")
+				ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+					Type: "CERTIFICATE", Bytes: ca.Raw}), 0644)
+				leaf, leafKey := makeTestCert("client.example.com", nil, false, ca, caKey)
+
+				config.Tls.ClientAuth = "RequireAndVerifyClientCert"
+				config.Tls.ClientCAs = caFile
+				config.AllowedPeers = []string{"nobody"}
+				err := tcpInput.Init(config)
+				c.Expect(err, gs.IsNil)
+
+				rejected := make(chan error, 1)
+				ith.MockInputRunner.EXPECT().LogError(gomock.Any()).Do(func(err error) {
+					rejected <- err
+				})
+				go func() {
+					errChan <- tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+				}()
+
+				clientConfig := &tls.Config{
+					InsecureSkipVerify: true,
+					Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw},
+						PrivateKey: leafKey}},
+				}
+				conn, err := tls.Dial("tcp", ith.AddrStr, clientConfig)
+				if err == nil {
+					conn.Close()
+				}
+
+				err = <-rejected
+				c.Expect(strings.HasSuffix(err.Error(),
+					"peer 'client.example.com' is not allowed"), gs.IsTrue)
+
+				tcpInput.Stop()
+				err = <-errChan
+				c.Expect(err, gs.IsNil)
+			})
+		})
+
+		c.Specify("requires TLS for peer authorization", func() {
+			config.AllowedPeers = []string{"foo"}
+			err := tcpInput.Init(config)
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(err.Error(), gs.Equals, "peer authorization settings require use_tls")
+		})
+
+		c.Specify("shares its address with another input w/ reuse_port", func() {
+			config.ReusePort = true
+			err := tcpInput.Init(config)
+			c.Assume(err, gs.IsNil)
+			defer tcpInput.listener.Close()
+
+			other := &TcpInput{}
+			err = other.Init(&TcpInputConfig{Net: "tcp", Address: ith.AddrStr,
+				ReusePort: true})
+			c.Expect(err, gs.IsNil)
+			other.listener.Close()
+
+			err = other.Init(&TcpInputConfig{Net: "tcp", Address: ith.AddrStr})
+			c.Expect(err, gs.Not(gs.IsNil))
 		})
 	})
 }
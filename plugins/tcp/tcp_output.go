@@ -42,6 +42,14 @@ type TcpOutput struct {
 	reportLock          sync.Mutex
 	or                  OutputRunner
 	pConfig             *PipelineConfig
+	resolver            *EndpointResolver
+	dialer              *net.Dialer
+	// Index of the discovered endpoint tried next.
+	nextEndpoint int
+	// The compressions offered, nil if compression isn't negotiated, and the
+	// compressing writer of the connection if it is.
+	offers []byte
+	writer relayWriter
 }
 
 // ConfigStruct for TcpOutput plugin.
@@ -61,6 +69,10 @@ type TcpOutputConfig struct {
 	KeepAlive bool `toml:"keep_alive"`
 	// Integer indicating seconds between keep alives.
 	KeepAlivePeriod int `toml:"keep_alive_period"`
+	// Seconds sent data may go unacknowledged by the target's TCP stack
+	// before the connection is dropped, 0 for the system default. Linux
+	// only.
+	TcpUserTimeout uint `toml:"tcp_user_timeout"`
 	// Number of successfully processed messages to re-establish the TCP
 	// connection after.  Defaults to 0 (never)
 	ReconnectAfter int64 `toml:"reconnect_after"`
@@ -71,6 +83,14 @@ type TcpOutputConfig struct {
 	// Defaults to true for TcpOutput.
 	UseBuffering *bool `toml:"use_buffering"`
 	Buffering    QueueBufferConfig
+	// Optional subsection looking up the endpoints to send to in DNS SRV
+	// records or Consul, in place of the address.
+	Discovery *DiscoveryConfig `toml:"discovery"`
+	// Stream compression negotiated with the TcpInput, "snappy" or "zstd",
+	// falling back to none if the input doesn't allow it, or "auto" to use
+	// the best the input allows. Defaults to "none", which sends the stream
+	// as is, without negotiating.
+	Compression string `toml:"compression"`
 }
 
 func (t *TcpOutput) ConfigStruct() interface{} {
@@ -84,6 +104,7 @@ func (t *TcpOutput) ConfigStruct() interface{} {
 	return &TcpOutputConfig{
 		Address:      "localhost:9125",
 		Encoder:      "ProtobufEncoder",
+		Compression:  "none",
 		UseBuffering: &b,
 		Buffering:    queueConfig,
 	}
@@ -104,13 +125,32 @@ func (t *TcpOutput) Init(config interface{}) (err error) {
 			return fmt.Errorf("Cannot combine local_address %s and use_tls config options",
 				t.localAddress)
 		}
-		t.localAddress, err = net.ResolveTCPAddr("tcp", t.conf.LocalAddress)
+		if t.localAddress, err = net.ResolveTCPAddr("tcp", t.conf.LocalAddress); err != nil {
+			return err
+		}
+	}
+	if t.dialer, err = TcpDialer(time.Duration(t.conf.TcpUserTimeout) * time.Second); err != nil {
+		return err
 	}
+	t.dialer.LocalAddr = t.localAddress
 
 	if t.conf.KeepAlivePeriod != 0 {
 		t.keepAliveDuration = time.Duration(t.conf.KeepAlivePeriod) * time.Second
 	}
 
+	if err == nil && t.conf.Compression != "none" && t.conf.Compression != "" {
+		if t.offers, err = relayOffers(t.conf.Compression); err != nil {
+			return err
+		}
+	}
+
+	if err == nil && t.conf.Discovery != nil {
+		if err = t.conf.Discovery.Validate(); err != nil {
+			return fmt.Errorf("discovery: %s", err)
+		}
+		t.resolver, err = NewEndpointResolver(t.conf.Discovery)
+	}
+
 	return
 }
 
@@ -130,6 +170,10 @@ func (t *TcpOutput) Prepare(or OutputRunner, h PluginHelper) (err error) {
 }
 
 func (t *TcpOutput) cleanupConn() {
+	if t.writer != nil {
+		t.writer.Close()
+		t.writer = nil
+	}
 	if t.connection != nil {
 		t.connection.Close()
 		t.connection = nil
@@ -141,6 +185,16 @@ func (t *TcpOutput) CleanUp() {
 }
 
 func (t *TcpOutput) ProcessMessage(pack *PipelinePack) (err error) {
+	if t.resolver != nil && t.connection != nil {
+		// Reconnect when the endpoints change, to move off of removed ones
+		// and spread the load onto new ones.
+		if _, changed, err := t.resolver.Endpoints(); err != nil {
+			t.or.LogError(fmt.Errorf("discovery: %s", err))
+		} else if changed {
+			t.cleanupConn()
+			t.nextEndpoint = 0
+		}
+	}
 	if t.connection == nil {
 		if err = t.connect(); err != nil {
 			// Explicitly set t.connection to nil because Go, see
@@ -160,7 +214,14 @@ func (t *TcpOutput) ProcessMessage(pack *PipelinePack) (err error) {
 		return fmt.Errorf("can't encode: %s", err)
 	}
 
-	if n, err = t.connection.Write(record); err != nil {
+	if t.writer != nil {
+		if n, err = t.writer.Write(record); err == nil {
+			err = t.writer.Flush()
+		}
+	} else {
+		n, err = t.connection.Write(record)
+	}
+	if err != nil {
 		t.cleanupConn()
 		err = NewRetryMessageError("writing to %s: %s", t.address, err)
 	} else if n != len(record) {
@@ -180,19 +241,45 @@ func (t *TcpOutput) ProcessMessage(pack *PipelinePack) (err error) {
 }
 
 func (t *TcpOutput) connect() (err error) {
-	dialer := &net.Dialer{LocalAddr: t.localAddress}
-
+	if t.resolver != nil {
+		endpoints, _, e := t.resolver.Endpoints()
+		if len(endpoints) == 0 {
+			return fmt.Errorf("discovery: %s", e)
+		}
+		if e != nil {
+			t.or.LogError(fmt.Errorf("discovery: %s", e))
+		}
+		t.address = endpoints[t.nextEndpoint%len(endpoints)]
+		// Move on to the next endpoint if this one doesn't work.
+		defer func() {
+			if err != nil {
+				t.nextEndpoint++
+			}
+		}()
+	}
+	var goTlsConf *tls.Config
 	if t.conf.UseTls {
-		var goTlsConf *tls.Config
 		if goTlsConf, err = CreateGoTlsConfig(&t.conf.Tls); err != nil {
 			return fmt.Errorf("TLS init error: %s", err)
 		}
-		// We should use DialWithDialer but its not in GOLANG release yet.
-		// https://code.google.com/p/go/source/detail?r=3d37606fb79393f22a69573afe31f0b0cd4866e3&name=default
-		// t.connection, err = tls.DialWithDialer(dialer, "tcp", t.address, goTlsConf)
-		t.connection, err = tls.Dial("tcp", t.address, goTlsConf)
+	}
+	dial := func() (net.Conn, error) {
+		if goTlsConf != nil {
+			return tls.DialWithDialer(t.dialer, "tcp", t.address, goTlsConf)
+		}
+		return t.dialer.Dial("tcp", t.address)
+	}
+	if t.offers == nil {
+		t.connection, err = dial()
 	} else {
-		t.connection, err = dialer.Dial("tcp", t.address)
+		// An ack window of 0, TcpInput doesn't acknowledge records.
+		var compression byte
+		t.connection, compression, _, err = relayClientHandshake(dial, t.offers, 0, 0)
+		if err == nil {
+			if t.writer, err = newRelayWriter(t.connection, compression); err != nil {
+				t.connection.Close()
+			}
+		}
 	}
 	if err == nil && t.conf.KeepAlive {
 		tcpConn, ok := t.connection.(*net.TCPConn)
@@ -18,8 +18,12 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
+
+	"heka/pipeline"
 )
 
 var ciphers map[string]uint16 = map[string]uint16{
@@ -36,6 +40,10 @@ var ciphers map[string]uint16 = map[string]uint16{
 	"ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
 	"ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
 	"ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
 }
 
 var tlsVersions map[string]uint16 = map[string]uint16{
@@ -43,6 +51,50 @@ var tlsVersions map[string]uint16 = map[string]uint16{
 	"TLS10": tls.VersionTLS10,
 	"TLS11": tls.VersionTLS11,
 	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// A tlsPreset is a named minimum version / cipher suite policy. Explicitly
+// configured `min_version` and `ciphers` values override the preset's.
+type tlsPreset struct {
+	minVersion string
+	ciphers    []string
+}
+
+var tlsPresets map[string]tlsPreset = map[string]tlsPreset{
+	// Go doesn't allow the TLS 1.3 cipher suites to be configured, and
+	// they're all AEAD ones.
+	"modern": {
+		minVersion: "TLS13",
+	},
+	"intermediate": {
+		minVersion: "TLS12",
+		ciphers: []string{
+			"ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+			"ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+			"ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+			"ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+			"ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+			"ECDHE_RSA_WITH_CHACHA20_POLY1305",
+		},
+	},
+	// "legacy" leaves Go's defaults in place.
+	"legacy": {},
+}
+
+// Cipher suites approved for use in FIPS mode (see NIST SP 800-52), in order
+// of preference.
+var fipsCipherNames []string = []string{
+	"ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	"ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	"ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	"ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	"ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	"RSA_WITH_AES_256_CBC_SHA",
+	"RSA_WITH_AES_128_CBC_SHA",
 }
 
 var clientAuthTypes map[string]tls.ClientAuthType = map[string]tls.ClientAuthType{
@@ -68,28 +120,73 @@ type TlsConfig struct {
 	MaxVersion             string `toml:"max_version"`
 	ClientCAs              string `toml:"client_cafile"`
 	RootCAs                string `toml:"root_cafile"`
+	// Named version / cipher policy, one of "modern", "intermediate", or
+	// "legacy".
+	Preset string `toml:"preset"`
+	// DER encoded OCSP response to staple to the default certificate.
+	OcspStapleFile string `toml:"ocsp_staple_file"`
+	// Set to true to pick up changes to the certificate, key, and OCSP files
+	// without a restart.
+	ReloadCerts bool `toml:"reload_certs"`
+	// Minimum number of seconds between checks for changed certificate
+	// files. Defaults to 60.
+	ReloadInterval uint `toml:"reload_interval"`
+	// Additional certificates served based on the SNI server name requested
+	// by the client, keyed by server name. Names may be of the form
+	// "*.example.com" to match any single-label subdomain.
+	Sni map[string]SniCertConfig `toml:"sni"`
+}
+
+// Certificate served for a single SNI server name.
+type SniCertConfig struct {
+	CertFile       string `toml:"cert_file"`
+	KeyFile        string `toml:"key_file"`
+	OcspStapleFile string `toml:"ocsp_staple_file"`
 }
 
 func CreateGoTlsConfig(tomlConf *TlsConfig) (goConf *tls.Config, err error) {
 	goConf = new(tls.Config)
 
+	var (
+		ok     bool
+		preset tlsPreset
+		store  *certStore
+	)
+	if tomlConf.Preset != "" {
+		if preset, ok = tlsPresets[tomlConf.Preset]; !ok {
+			return nil, fmt.Errorf("Invalid Preset: %s", tomlConf.Preset)
+		}
+	}
+
 	if tomlConf.CertFile != "" && tomlConf.KeyFile != "" {
-		var cert tls.Certificate
-		cert, err = tls.LoadX509KeyPair(tomlConf.CertFile, tomlConf.KeyFile)
-		if err != nil {
-			return
+		if store, err = newCertStore(tomlConf); err != nil {
+			return nil, err
 		}
-		goConf.Certificates = []tls.Certificate{cert}
-		goConf.NameToCertificate = make(map[string]*tls.Certificate)
-		goConf.NameToCertificate["default"] = &cert
+		if store.dynamic() {
+			// crypto/tls only asks GetCertificate when there are no
+			// Certificates or the client sent SNI, so Certificates is left
+			// empty for every client to get the current certificate.
+			goConf.GetCertificate = store.GetCertificate
+			goConf.GetClientCertificate = store.GetClientCertificate
+		} else {
+			cert := store.defaultCert.cert
+			goConf.Certificates = []tls.Certificate{*cert}
+			goConf.NameToCertificate = make(map[string]*tls.Certificate)
+			goConf.NameToCertificate["default"] = cert
+		}
+	} else if len(tomlConf.Sni) > 0 {
+		return nil, errors.New("SNI certificates require a default cert_file and key_file")
 	}
 	goConf.ServerName = tomlConf.ServerName
 
-	var ok bool
-	if tomlConf.MinVersion != "" {
-		goConf.MinVersion, ok = tlsVersions[tomlConf.MinVersion]
+	minVersion := tomlConf.MinVersion
+	if minVersion == "" {
+		minVersion = preset.minVersion
+	}
+	if minVersion != "" {
+		goConf.MinVersion, ok = tlsVersions[minVersion]
 		if !ok {
-			return nil, fmt.Errorf("Invalid MinVersion: %s", tomlConf.MinVersion)
+			return nil, fmt.Errorf("Invalid MinVersion: %s", minVersion)
 		}
 	}
 	if tomlConf.MaxVersion != "" {
@@ -109,7 +206,9 @@ func CreateGoTlsConfig(tomlConf *TlsConfig) (goConf *tls.Config, err error) {
 		}
 	}
 
-	if tomlConf.ClientCAs != "" {
+	if store != nil && store.clientCAs != nil {
+		goConf.ClientCAs = store.clientCAs.pool
+	} else if tomlConf.ClientCAs != "" {
 		if goConf.ClientCAs, err = certPoolFromFile(tomlConf.ClientCAs); err != nil {
 			return nil, err
 		}
@@ -138,16 +237,44 @@ func CreateGoTlsConfig(tomlConf *TlsConfig) (goConf *tls.Config, err error) {
 		copy(goConf.SessionTicketKey[:32], ticketKey[:])
 	}
 
+	cipherStrs := tomlConf.Ciphers
+	if len(cipherStrs) == 0 {
+		cipherStrs = preset.ciphers
+	}
 	var cipher uint16
-	for _, cipherStr := range tomlConf.Ciphers {
+	for _, cipherStr := range cipherStrs {
 		if cipher, ok = ciphers[cipherStr]; !ok {
 			return nil, fmt.Errorf("Invalid cipher string: %s", cipherStr)
 		}
 		goConf.CipherSuites = append(goConf.CipherSuites, cipher)
 	}
+
+	if pipeline.FipsMode() {
+		if err = restrictToFips(goConf, tomlConf); err != nil {
+			return nil, err
+		}
+	}
+	if store != nil && store.clientCAs != nil {
+		store.base = goConf
+		goConf.GetConfigForClient = store.GetConfigForClient
+	}
 	return
 }
 
+// NewTlsListener wraps the provided listener so that all accepted connections
+// are tunneled through TLS as specified by the provided configuration. Server
+// side TLS requires both a certificate and a key file.
+func NewTlsListener(listener net.Listener, tomlConf *TlsConfig) (net.Listener, error) {
+	if tomlConf.CertFile == "" || tomlConf.KeyFile == "" {
+		return nil, errors.New("TLS config requires both cert_file and key_file value.")
+	}
+	goConf, err := CreateGoTlsConfig(tomlConf)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(listener, goConf), nil
+}
+
 func certPoolFromFile(pemfile string) (*x509.CertPool, error) {
 	roots := x509.NewCertPool()
 	data, err := ioutil.ReadFile(pemfile)
@@ -159,3 +286,59 @@ func certPoolFromFile(pemfile string) (*x509.CertPool, error) {
 	}
 	return nil, fmt.Errorf("No PEM encoded certificates found in: %s\n", pemfile)
 }
+
+// restrictToFips limits a TLS config to FIPS approved protocol versions,
+// cipher suites, and curves. Explicitly configured values that aren't
+// approved are an error, while preset and default values are narrowed to the
+// approved subset.
+func restrictToFips(goConf *tls.Config, tomlConf *TlsConfig) error {
+	if goConf.MinVersion > tls.VersionTLS12 {
+		if tomlConf.MinVersion != "" {
+			return fmt.Errorf("MinVersion %s is not allowed in FIPS mode",
+				tomlConf.MinVersion)
+		}
+		return fmt.Errorf("Preset %s is not allowed in FIPS mode", tomlConf.Preset)
+	}
+	if goConf.MinVersion < tls.VersionTLS12 {
+		if tomlConf.MinVersion != "" {
+			return fmt.Errorf("MinVersion %s is not allowed in FIPS mode",
+				tomlConf.MinVersion)
+		}
+		goConf.MinVersion = tls.VersionTLS12
+	}
+	// Go doesn't allow the TLS 1.3 cipher suites to be configured, so they
+	// can't be restricted to the approved ones.
+	if tomlConf.MaxVersion != "" && goConf.MaxVersion != tls.VersionTLS12 {
+		return fmt.Errorf("MaxVersion %s is not allowed in FIPS mode",
+			tomlConf.MaxVersion)
+	}
+	goConf.MaxVersion = tls.VersionTLS12
+
+	approved := make(map[uint16]bool, len(fipsCipherNames))
+	for _, name := range fipsCipherNames {
+		approved[ciphers[name]] = true
+	}
+	if len(tomlConf.Ciphers) > 0 {
+		for _, name := range tomlConf.Ciphers {
+			if !approved[ciphers[name]] {
+				return fmt.Errorf("Cipher %s is not allowed in FIPS mode", name)
+			}
+		}
+	} else {
+		var suites []uint16
+		for _, suite := range goConf.CipherSuites {
+			if approved[suite] {
+				suites = append(suites, suite)
+			}
+		}
+		if len(suites) == 0 {
+			for _, name := range fipsCipherNames {
+				suites = append(suites, ciphers[name])
+			}
+		}
+		goConf.CipherSuites = suites
+	}
+	goConf.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384,
+		tls.CurveP521}
+	return nil
+}
@@ -0,0 +1,337 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package tcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rafrombrc/go-notify"
+	"heka/pipeline"
+)
+
+// Incremented on every reload notification, i.e. SIGHUP or a change to a
+// watched config, so that certificates are checked for changes at the next
+// handshake rather than waiting out the reload interval.
+var (
+	reloadGeneration int64
+	reloadListener   sync.Once
+)
+
+func listenForReloads() {
+	reloadListener.Do(func() {
+		reloads := make(chan interface{})
+		notify.Start(pipeline.RELOAD, reloads)
+		go func() {
+			for range reloads {
+				atomic.AddInt64(&reloadGeneration, 1)
+			}
+		}()
+	})
+}
+
+// Returns the modification times of files and the files their paths resolve
+// to. Kubernetes updates mounted Secrets by swapping a symlink to a new copy
+// of the files, which changes the resolved paths even if the modification
+// times are kept.
+func fileStates(paths []string) (modTimes []time.Time, targets []string, err error) {
+	modTimes = make([]time.Time, len(paths))
+	targets = make([]string, len(paths))
+	for i, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		modTimes[i] = fi.ModTime()
+		if targets[i], err = filepath.EvalSymlinks(path); err != nil {
+			return nil, nil, err
+		}
+	}
+	return modTimes, targets, nil
+}
+
+func statesEqual(modTimes, oldModTimes []time.Time, targets, oldTargets []string) bool {
+	for i, modTime := range modTimes {
+		if !modTime.Equal(oldModTimes[i]) || targets[i] != oldTargets[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// A certificate / key pair (plus optional OCSP staple) loaded from disk,
+// along with the file modification times seen at load time.
+type fileCert struct {
+	certFile string
+	keyFile  string
+	ocspFile string
+	cert     *tls.Certificate
+	modTimes []time.Time
+	targets  []string
+}
+
+func newFileCert(certFile, keyFile, ocspFile string) (*fileCert, error) {
+	fc := &fileCert{
+		certFile: certFile,
+		keyFile:  keyFile,
+		ocspFile: ocspFile,
+	}
+	if err := fc.load(); err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
+
+func (fc *fileCert) paths() []string {
+	paths := []string{fc.certFile, fc.keyFile}
+	if fc.ocspFile != "" {
+		paths = append(paths, fc.ocspFile)
+	}
+	return paths
+}
+
+func (fc *fileCert) load() error {
+	modTimes, targets, err := fileStates(fc.paths())
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(fc.certFile, fc.keyFile)
+	if err != nil {
+		return err
+	}
+	if fc.ocspFile != "" {
+		if cert.OCSPStaple, err = ioutil.ReadFile(fc.ocspFile); err != nil {
+			return fmt.Errorf("can't read OCSP staple: %s", err)
+		}
+	}
+	fc.cert = &cert
+	fc.modTimes = modTimes
+	fc.targets = targets
+	return nil
+}
+
+// changed returns true if any of the backing files have been modified since
+// they were last loaded.
+func (fc *fileCert) changed() bool {
+	modTimes, targets, err := fileStates(fc.paths())
+	if err != nil {
+		// A missing file is usually a rename in progress, try again later.
+		return false
+	}
+	return !statesEqual(modTimes, fc.modTimes, targets, fc.targets)
+}
+
+// A pool of CA certificates loaded from a PEM file, which is reloaded when
+// the file changes.
+type fileCAPool struct {
+	path     string
+	pool     *x509.CertPool
+	modTimes []time.Time
+	targets  []string
+}
+
+func newFileCAPool(path string) (*fileCAPool, error) {
+	fp := &fileCAPool{path: path}
+	if err := fp.load(); err != nil {
+		return nil, err
+	}
+	return fp, nil
+}
+
+func (fp *fileCAPool) load() error {
+	modTimes, targets, err := fileStates([]string{fp.path})
+	if err != nil {
+		return err
+	}
+	pool, err := certPoolFromFile(fp.path)
+	if err != nil {
+		return err
+	}
+	fp.pool = pool
+	fp.modTimes = modTimes
+	fp.targets = targets
+	return nil
+}
+
+func (fp *fileCAPool) changed() bool {
+	modTimes, targets, err := fileStates([]string{fp.path})
+	if err != nil {
+		return false
+	}
+	return !statesEqual(modTimes, fp.modTimes, targets, fp.targets)
+}
+
+// certStore provides a tls.Config's certificate callbacks, selecting a
+// certificate by SNI server name and reloading certificates from disk when
+// the underlying files change.
+type certStore struct {
+	lock        sync.RWMutex
+	reload      bool
+	interval    time.Duration
+	lastCheck   time.Time
+	generation  int64
+	defaultCert *fileCert
+	byName      map[string]*fileCert
+	// Set if the client CAs are reloaded, with the config they're served
+	// with, and its copy holding the current pool.
+	clientCAs *fileCAPool
+	base      *tls.Config
+	withCAs   *tls.Config
+}
+
+func newCertStore(tomlConf *TlsConfig) (store *certStore, err error) {
+	store = &certStore{
+		reload:   tomlConf.ReloadCerts,
+		interval: time.Duration(tomlConf.ReloadInterval) * time.Second,
+		byName:   make(map[string]*fileCert),
+	}
+	if store.interval == 0 {
+		store.interval = 60 * time.Second
+	}
+	store.defaultCert, err = newFileCert(tomlConf.CertFile, tomlConf.KeyFile,
+		tomlConf.OcspStapleFile)
+	if err != nil {
+		return nil, err
+	}
+	for name, sni := range tomlConf.Sni {
+		if sni.CertFile == "" || sni.KeyFile == "" {
+			return nil, fmt.Errorf("SNI entry '%s' requires both cert_file and key_file",
+				name)
+		}
+		var fc *fileCert
+		if fc, err = newFileCert(sni.CertFile, sni.KeyFile, sni.OcspStapleFile); err != nil {
+			return nil, fmt.Errorf("SNI entry '%s': %s", name, err)
+		}
+		store.byName[strings.ToLower(name)] = fc
+	}
+	if store.reload && tomlConf.ClientCAs != "" {
+		if store.clientCAs, err = newFileCAPool(tomlConf.ClientCAs); err != nil {
+			return nil, err
+		}
+	}
+	if store.reload {
+		listenForReloads()
+		store.generation = atomic.LoadInt64(&reloadGeneration)
+	}
+	store.lastCheck = time.Now()
+	return store, nil
+}
+
+// dynamic returns true if certificates need to be chosen at handshake time
+// rather than being fixed in the tls.Config.
+func (s *certStore) dynamic() bool {
+	return s.reload || len(s.byName) > 0
+}
+
+func (s *certStore) maybeReload() {
+	if !s.reload {
+		return
+	}
+	generation := atomic.LoadInt64(&reloadGeneration)
+	s.lock.RLock()
+	due := time.Since(s.lastCheck) >= s.interval || generation != s.generation
+	s.lock.RUnlock()
+	if !due {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if time.Since(s.lastCheck) < s.interval && generation == s.generation {
+		// Someone else got here first.
+		return
+	}
+	s.lastCheck = time.Now()
+	s.generation = generation
+	if s.clientCAs != nil && s.clientCAs.changed() {
+		if err := s.clientCAs.load(); err != nil {
+			pipeline.LogError.Printf("TLS client CA reload failed for '%s': %s",
+				s.clientCAs.path, err)
+		} else {
+			pipeline.LogInfo.Printf("TLS client CAs reloaded: %s", s.clientCAs.path)
+			s.withCAs = nil
+		}
+	}
+	fcs := []*fileCert{s.defaultCert}
+	for _, fc := range s.byName {
+		fcs = append(fcs, fc)
+	}
+	for _, fc := range fcs {
+		if !fc.changed() {
+			continue
+		}
+		// On failure we keep serving the previously loaded certificate.
+		if err := fc.load(); err != nil {
+			pipeline.LogError.Printf("TLS certificate reload failed for '%s': %s",
+				fc.certFile, err)
+			continue
+		}
+		pipeline.LogInfo.Printf("TLS certificate reloaded: %s", fc.certFile)
+	}
+}
+
+func (s *certStore) lookup(serverName string) *tls.Certificate {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if serverName != "" {
+		name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+		if fc, ok := s.byName[name]; ok {
+			return fc.cert
+		}
+		if i := strings.Index(name, "."); i > 0 {
+			if fc, ok := s.byName["*"+name[i:]]; ok {
+				return fc.cert
+			}
+		}
+	}
+	return s.defaultCert.cert
+}
+
+// GetCertificate satisfies the tls.Config.GetCertificate callback.
+func (s *certStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.maybeReload()
+	return s.lookup(hello.ServerName), nil
+}
+
+// GetConfigForClient satisfies the tls.Config.GetConfigForClient callback,
+// so that handshakes verify client certificates with the current client CAs.
+func (s *certStore) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	s.maybeReload()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.withCAs == nil {
+		s.withCAs = s.base.Clone()
+		s.withCAs.ClientCAs = s.clientCAs.pool
+		s.withCAs.GetConfigForClient = nil
+	}
+	return s.withCAs, nil
+}
+
+// GetClientCertificate satisfies the tls.Config.GetClientCertificate
+// callback so reloaded certificates are also used for outgoing connections.
+func (s *certStore) GetClientCertificate(*tls.CertificateRequestInfo) (
+	*tls.Certificate, error) {
+
+	s.maybeReload()
+	return s.lookup(""), nil
+}
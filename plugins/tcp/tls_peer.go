@@ -0,0 +1,191 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package tcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Authenticated identity of a TLS client, extracted from its certificate.
+type PeerIdentity struct {
+	// Subject common name of the client certificate.
+	CommonName string
+	// All of the certificate's names: the common name followed by any DNS,
+	// email, and URI subject alternative names.
+	Names []string
+	// Name of the tenant whose CA verified the client certificate, if tenant
+	// CAs are in use.
+	Tenant string
+}
+
+func newPeerIdentity(cert *x509.Certificate) *PeerIdentity {
+	id := &PeerIdentity{CommonName: cert.Subject.CommonName}
+	if id.CommonName != "" {
+		id.Names = append(id.Names, id.CommonName)
+	}
+	id.Names = append(id.Names, cert.DNSNames...)
+	id.Names = append(id.Names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		id.Names = append(id.Names, uri.String())
+	}
+	return id
+}
+
+// String returns the common name if there is one, otherwise the first
+// subject alternative name.
+func (id *PeerIdentity) String() string {
+	if id.CommonName != "" {
+		return id.CommonName
+	}
+	if len(id.Names) > 0 {
+		return id.Names[0]
+	}
+	return ""
+}
+
+// PeerAuthorizer decides whether or not a TLS client should be allowed to
+// connect, based on the names in its certificate and the CA that issued it.
+type PeerAuthorizer struct {
+	allowed     []string
+	denied      []string
+	tenantNames []string
+	tenantPools map[string]*x509.CertPool
+}
+
+// NewPeerAuthorizer creates a PeerAuthorizer. Allowed and denied entries are
+// glob patterns (e.g. "*.example.com") matched against the certificate's CN
+// and SANs; denied patterns take precedence. An empty allowed list allows any
+// name that isn't denied. tenantCAs maps tenant names to PEM CA files; if
+// provided, a client is only accepted if one of the tenant CAs verifies its
+// certificate.
+func NewPeerAuthorizer(allowed, denied []string, tenantCAs map[string]string) (
+	*PeerAuthorizer, error) {
+
+	pa := &PeerAuthorizer{
+		allowed:     allowed,
+		denied:      denied,
+		tenantPools: make(map[string]*x509.CertPool),
+	}
+	for _, pattern := range append(append([]string{}, allowed...), denied...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid peer pattern '%s': %s", pattern, err)
+		}
+	}
+	for tenant, caFile := range tenantCAs {
+		pool, err := certPoolFromFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("tenant '%s': %s", tenant, err)
+		}
+		pa.tenantPools[tenant] = pool
+		pa.tenantNames = append(pa.tenantNames, tenant)
+	}
+	// Check tenants in a stable order.
+	sort.Strings(pa.tenantNames)
+	return pa, nil
+}
+
+// UsesTenants returns true if tenant CAs have been configured.
+func (pa *PeerAuthorizer) UsesTenants() bool {
+	return len(pa.tenantNames) > 0
+}
+
+// matchesAny does case insensitive glob matching of names against patterns.
+func matchesAny(patterns, names []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, strings.ToLower(name)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var errPeersUnverified = errors.New("allowed_peers and denied_peers require " +
+	"client_auth = \"RequireAndVerifyClientCert\" and a client_cafile")
+
+// VerifiesClients returns true if conf makes a listener verify client
+// certificates against its client CAs, without which the names in them can't
+// be trusted.
+func VerifiesClients(conf *TlsConfig) bool {
+	return conf.ClientCAs != "" && (conf.ClientAuth == "RequireAndVerifyClientCert" ||
+		conf.ClientAuth == "VerifyClientCertIfGiven")
+}
+
+// Authorize checks the peer certificates from a completed TLS handshake,
+// returning the peer's identity if it is allowed to connect, or an error if
+// not. Unless tenant CAs are in use, which verify the certificate
+// themselves, only the leaf of a chain the handshake verified is trusted.
+func (pa *PeerAuthorizer) Authorize(state tls.ConnectionState) (*PeerIdentity, error) {
+	if len(state.PeerCertificates) == 0 {
+		return nil, errors.New("no client certificate presented")
+	}
+	if !pa.UsesTenants() {
+		id := VerifiedPeer(state)
+		if id == nil {
+			return nil, errors.New("client certificate isn't verified")
+		}
+		return pa.authorizeNames(id)
+	}
+
+	leaf := state.PeerCertificates[0]
+	id := newPeerIdentity(leaf)
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	for _, tenant := range pa.tenantNames {
+		opts := x509.VerifyOptions{
+			Roots:         pa.tenantPools[tenant],
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		if _, err := leaf.Verify(opts); err == nil {
+			id.Tenant = tenant
+			break
+		}
+	}
+	if id.Tenant == "" {
+		return nil, fmt.Errorf("certificate for '%s' not issued by any tenant CA", id)
+	}
+	return pa.authorizeNames(id)
+}
+
+// VerifiedPeer returns the identity in the leaf of the chain the handshake
+// verified, or nil if the client's certificate wasn't verified.
+func VerifiedPeer(state tls.ConnectionState) *PeerIdentity {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return newPeerIdentity(state.VerifiedChains[0][0])
+}
+
+// Checks a trusted identity against the allowed and denied patterns.
+func (pa *PeerAuthorizer) authorizeNames(id *PeerIdentity) (*PeerIdentity, error) {
+	if matchesAny(pa.denied, id.Names) {
+		return nil, fmt.Errorf("peer '%s' is denied", id)
+	}
+	if len(pa.allowed) > 0 && !matchesAny(pa.allowed, id.Names) {
+		return nil, fmt.Errorf("peer '%s' is not allowed", id)
+	}
+	return id, nil
+}
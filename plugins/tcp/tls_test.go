@@ -15,10 +15,24 @@
 package tcp
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
+	"encoding/pem"
+	"github.com/rafrombrc/go-notify"
 	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/pipeline"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 func TlsSpec(c gs.Context) {
@@ -123,5 +137,401 @@ func TlsSpec(c gs.Context) {
 			c.Expect(len(goConf.RootCAs.Subjects()), gs.Equals, 1)
 		})
 
+		c.Specify("applies a preset", func() {
+			tomlConf.Preset = "modern"
+			goConf, err = CreateGoTlsConfig(tomlConf)
+			c.Expect(err, gs.IsNil)
+			c.Expect(goConf.MinVersion, gs.Equals, uint16(tls.VersionTLS13))
+			c.Expect(len(goConf.CipherSuites), gs.Equals, 0)
+
+			tomlConf.Preset = "intermediate"
+			goConf, err = CreateGoTlsConfig(tomlConf)
+			c.Expect(err, gs.IsNil)
+			c.Expect(goConf.MinVersion, gs.Equals, uint16(tls.VersionTLS12))
+			c.Expect(len(goConf.CipherSuites), gs.Equals, 6)
+			for _, suite := range goConf.CipherSuites {
+				c.Expect(suite, gs.Not(gs.Equals), tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA)
+			}
+		})
+
+		c.Specify("explicit settings override a preset", func() {
+			tomlConf.Preset = "intermediate"
+			tomlConf.MinVersion = "TLS13"
+			tomlConf.Ciphers = []string{"ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+			goConf, err = CreateGoTlsConfig(tomlConf)
+			c.Expect(err, gs.IsNil)
+			c.Expect(goConf.MinVersion, gs.Equals, uint16(tls.VersionTLS13))
+			c.Expect(len(goConf.CipherSuites), gs.Equals, 1)
+		})
+
+		c.Specify("fails w/ invalid preset", func() {
+			tomlConf.Preset = "foo"
+			goConf, err = CreateGoTlsConfig(tomlConf)
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(err.Error(), gs.Equals, "Invalid Preset: foo")
+		})
+
+		c.Specify("in FIPS mode", func() {
+			pipeline.SetFipsMode(true)
+			defer pipeline.SetFipsMode(false)
+
+			c.Specify("defaults to approved versions, ciphers, and curves", func() {
+				goConf, err = CreateGoTlsConfig(tomlConf)
+				c.Expect(err, gs.IsNil)
+				c.Expect(goConf.MinVersion, gs.Equals, uint16(tls.VersionTLS12))
+				c.Expect(goConf.MaxVersion, gs.Equals, uint16(tls.VersionTLS12))
+				c.Expect(len(goConf.CipherSuites), gs.Equals, len(fipsCipherNames))
+				c.Expect(len(goConf.CurvePreferences), gs.Equals, 3)
+			})
+
+			c.Specify("narrows a preset to approved ciphers", func() {
+				tomlConf.Preset = "intermediate"
+				goConf, err = CreateGoTlsConfig(tomlConf)
+				c.Expect(err, gs.IsNil)
+				c.Expect(goConf.MinVersion, gs.Equals, uint16(tls.VersionTLS12))
+				for _, suite := range goConf.CipherSuites {
+					c.Expect(suite, gs.Not(gs.Equals), tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305)
+				}
+				c.Expect(len(goConf.CipherSuites), gs.Equals, 4)
+			})
+
+			c.Specify("fails w/ a TLS13 only preset", func() {
+				tomlConf.Preset = "modern"
+				goConf, err = CreateGoTlsConfig(tomlConf)
+				c.Expect(err.Error(), gs.Equals, "Preset modern is not allowed in FIPS mode")
+			})
+
+			c.Specify("fails w/ an unapproved cipher", func() {
+				tomlConf.Ciphers = []string{"ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+					"RSA_WITH_3DES_EDE_CBC_SHA"}
+				goConf, err = CreateGoTlsConfig(tomlConf)
+				c.Expect(err.Error(), gs.Equals,
+					"Cipher RSA_WITH_3DES_EDE_CBC_SHA is not allowed in FIPS mode")
+			})
+
+			c.Specify("fails w/ an unapproved min version", func() {
+				tomlConf.MinVersion = "TLS10"
+				goConf, err = CreateGoTlsConfig(tomlConf)
+				c.Expect(err.Error(), gs.Equals, "MinVersion TLS10 is not allowed in FIPS mode")
+			})
+
+			c.Specify("fails w/ TLS 1.3", func() {
+				tomlConf.MaxVersion = "TLS13"
+				goConf, err = CreateGoTlsConfig(tomlConf)
+				c.Expect(err.Error(), gs.Equals, "MaxVersion TLS13 is not allowed in FIPS mode")
+			})
+		})
+
+		c.Specify("selects SNI certificates by server name", func() {
+			tomlConf.CertFile = "./testsupport/cert.pem"
+			tomlConf.KeyFile = "./testsupport/key.pem"
+			tomlConf.Sni = map[string]SniCertConfig{
+				"*.example.com": {
+					CertFile: "./testsupport/both.pem",
+					KeyFile:  "./testsupport/both.pem",
+				},
+			}
+			goConf, err = CreateGoTlsConfig(tomlConf)
+			c.Expect(err, gs.IsNil)
+			c.Expect(goConf.GetCertificate, gs.Not(gs.IsNil))
+
+			defaultCert, err := goConf.GetCertificate(&tls.ClientHelloInfo{})
+			c.Expect(err, gs.IsNil)
+			sniCert, err := goConf.GetCertificate(&tls.ClientHelloInfo{
+				ServerName: "Foo.Example.com"})
+			c.Expect(err, gs.IsNil)
+			c.Expect(sniCert == defaultCert, gs.IsFalse)
+			otherCert, err := goConf.GetCertificate(&tls.ClientHelloInfo{
+				ServerName: "example.org"})
+			c.Expect(err, gs.IsNil)
+			c.Expect(otherCert == defaultCert, gs.IsTrue)
+		})
+
+		c.Specify("fails w/ SNI but no default certificate", func() {
+			tomlConf.Sni = map[string]SniCertConfig{
+				"foo": {CertFile: "./testsupport/both.pem"},
+			}
+			goConf, err = CreateGoTlsConfig(tomlConf)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("staples an OCSP response", func() {
+			tmpDir, _ := ioutil.TempDir("", "heka-tls")
+			defer os.RemoveAll(tmpDir)
+			ocspFile := filepath.Join(tmpDir, "ocsp.der")
+			ioutil.WriteFile(ocspFile, []byte("staple"), 0644)
+			tomlConf.CertFile = "./testsupport/cert.pem"
+			tomlConf.KeyFile = "./testsupport/key.pem"
+			tomlConf.OcspStapleFile = ocspFile
+			goConf, err = CreateGoTlsConfig(tomlConf)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(goConf.Certificates[0].OCSPStaple), gs.Equals, "staple")
+		})
+
+		// Handshakes with a server using conf, dialing its IP address so no
+		// SNI server name is sent, and returns the common name of the
+		// certificate it served and the server's handshake error.
+		handshake := func(conf *tls.Config, clientCerts []tls.Certificate) (string,
+			error) {
+
+			listener, err := tls.Listen("tcp", "127.0.0.1:0", conf)
+			c.Assume(err, gs.IsNil)
+			defer listener.Close()
+			serverErr := make(chan error, 1)
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					serverErr <- err
+					return
+				}
+				serverErr <- conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+			conn, err := tls.Dial("tcp", listener.Addr().String(),
+				&tls.Config{InsecureSkipVerify: true, Certificates: clientCerts})
+			if err != nil {
+				return "", err
+			}
+			defer conn.Close()
+			cn := conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+			return cn, <-serverErr
+		}
+		// Posts a reload notification and waits for it to be seen.
+		reload := func() {
+			generation := atomic.LoadInt64(&reloadGeneration)
+			c.Assume(notify.Post(pipeline.RELOAD, nil), gs.IsNil)
+			for atomic.LoadInt64(&reloadGeneration) == generation {
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		c.Specify("reloads changed certificates", func() {
+			tmpDir, _ := ioutil.TempDir("", "heka-tls")
+			defer os.RemoveAll(tmpDir)
+			certFile := filepath.Join(tmpDir, "cert.pem")
+			keyFile := filepath.Join(tmpDir, "key.pem")
+			stamp := time.Now()
+			writeCert := func(cn string, modified time.Time) {
+				cert, key := makeTestCert(cn, nil, false, nil, nil)
+				keyDer, _ := x509.MarshalECPrivateKey(key)
+				ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{
+					Type: "CERTIFICATE", Bytes: cert.Raw}), 0644)
+				ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{
+					Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+				os.Chtimes(certFile, modified, modified)
+				os.Chtimes(keyFile, modified, modified)
+			}
+			writeCert("first", stamp)
+			tomlConf.CertFile = certFile
+			tomlConf.KeyFile = keyFile
+			tomlConf.ReloadCerts = true
+
+			goConf, err = CreateGoTlsConfig(tomlConf)
+			c.Assume(err, gs.IsNil)
+			cn, err := handshake(goConf, nil)
+			c.Expect(err, gs.IsNil)
+			c.Expect(cn, gs.Equals, "first")
+
+			writeCert("second", stamp.Add(time.Minute))
+			reload()
+			cn, err = handshake(goConf, nil)
+			c.Expect(err, gs.IsNil)
+			c.Expect(cn, gs.Equals, "second")
+
+			// A broken file leaves the previous certificate in place.
+			ioutil.WriteFile(certFile, []byte("garbage"), 0644)
+			later := stamp.Add(2 * time.Minute)
+			os.Chtimes(certFile, later, later)
+			reload()
+			cn, err = handshake(goConf, nil)
+			c.Expect(err, gs.IsNil)
+			c.Expect(cn, gs.Equals, "second")
+		})
+
+		c.Specify("reloads a Kubernetes Secret mount when it's swapped", func() {
+			tmpDir, _ := ioutil.TempDir("", "heka-tls")
+			defer os.RemoveAll(tmpDir)
+			// Lays the files out as the kubelet does: in a directory of
+			// their own, reached through the ..data symlink. Returns a client
+			// certificate issued by the version's CA.
+			writeVersion := func(version string) []tls.Certificate {
+				dir := filepath.Join(tmpDir, version)
+				os.Mkdir(dir, 0755)
+				caCert, caKey := makeTestCert("CA "+version, nil, true, nil, nil)
+				cert, key := makeTestCert("server "+version, nil, false, caCert, caKey)
+				keyDer, _ := x509.MarshalECPrivateKey(key)
+				files := map[string]*pem.Block{
+					"tls.crt": {Type: "CERTIFICATE", Bytes: cert.Raw},
+					"tls.key": {Type: "EC PRIVATE KEY", Bytes: keyDer},
+					"ca.crt":  {Type: "CERTIFICATE", Bytes: caCert.Raw},
+				}
+				stamp := time.Unix(1400000000, 0)
+				for name, block := range files {
+					path := filepath.Join(dir, name)
+					ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600)
+					// Keep the times the same, only the symlink swap shows
+					// the change.
+					os.Chtimes(path, stamp, stamp)
+				}
+				link := filepath.Join(tmpDir, "..data_tmp")
+				os.Symlink(version, link)
+				os.Rename(link, filepath.Join(tmpDir, "..data"))
+				client, clientKey := makeTestCert("client", nil, false, caCert, caKey)
+				return []tls.Certificate{{Certificate: [][]byte{client.Raw},
+					PrivateKey: clientKey}}
+			}
+			v1Client := writeVersion("..v1")
+			for _, name := range []string{"tls.crt", "tls.key", "ca.crt"} {
+				os.Symlink(filepath.Join("..data", name), filepath.Join(tmpDir, name))
+			}
+			tomlConf.CertFile = filepath.Join(tmpDir, "tls.crt")
+			tomlConf.KeyFile = filepath.Join(tmpDir, "tls.key")
+			tomlConf.ClientCAs = filepath.Join(tmpDir, "ca.crt")
+			tomlConf.ClientAuth = "RequireAndVerifyClientCert"
+			tomlConf.ReloadCerts = true
+
+			goConf, err = CreateGoTlsConfig(tomlConf)
+			c.Assume(err, gs.IsNil)
+			cn, err := handshake(goConf, v1Client)
+			c.Expect(err, gs.IsNil)
+			c.Expect(cn, gs.Equals, "server ..v1")
+
+			v2Client := writeVersion("..v2")
+			// Nothing changes until the reload interval is up.
+			cn, err = handshake(goConf, v1Client)
+			c.Expect(err, gs.IsNil)
+			c.Expect(cn, gs.Equals, "server ..v1")
+
+			// The reload notification skips the rest of the interval.
+			reload()
+			cn, err = handshake(goConf, v2Client)
+			c.Expect(err, gs.IsNil)
+			c.Expect(cn, gs.Equals, "server ..v2")
+			// Clients of the old CA are no longer trusted.
+			_, err = handshake(goConf, v1Client)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+}
+
+// makeTestCert generates a certificate signed by the parent (or self-signed if
+// parent is nil), returning the certificate and its private key.
+func makeTestCert(cn string, dnsNames []string, isCA bool, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              dnsNames,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey,
+		parentKey)
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func PeerAuthorizerSpec(c gs.Context) {
+	clientCert, _ := makeTestCert("client.example.com", []string{"alt.example.org"},
+		false, nil, nil)
+	state := tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{clientCert},
+		VerifiedChains:   [][]*x509.Certificate{{clientCert}},
+	}
+
+	c.Specify("A PeerAuthorizer", func() {
+		c.Specify("allows any peer w/ no lists", func() {
+			pa, err := NewPeerAuthorizer(nil, nil, nil)
+			c.Expect(err, gs.IsNil)
+			id, err := pa.Authorize(state)
+			c.Expect(err, gs.IsNil)
+			c.Expect(id.String(), gs.Equals, "client.example.com")
+			c.Expect(len(id.Names), gs.Equals, 2)
+		})
+
+		c.Specify("rejects connections w/o a certificate", func() {
+			pa, _ := NewPeerAuthorizer(nil, nil, nil)
+			_, err := pa.Authorize(tls.ConnectionState{})
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("rejects certificates the handshake didn't verify", func() {
+			pa, _ := NewPeerAuthorizer([]string{"client.example.com"}, nil, nil)
+			_, err := pa.Authorize(tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{clientCert}})
+			c.Expect(err.Error(), gs.Equals, "client certificate isn't verified")
+		})
+
+		c.Specify("only trusts the verified leaf", func() {
+			other, _ := makeTestCert("other.example.com", nil, false, nil, nil)
+			pa, _ := NewPeerAuthorizer([]string{"other.example.com"}, nil, nil)
+			_, err := pa.Authorize(tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{other},
+				VerifiedChains:   [][]*x509.Certificate{{clientCert}},
+			})
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("matches the allow list against SANs", func() {
+			pa, _ := NewPeerAuthorizer([]string{"*.EXAMPLE.org"}, nil, nil)
+			_, err := pa.Authorize(state)
+			c.Expect(err, gs.IsNil)
+		})
+
+		c.Specify("rejects peers not on the allow list", func() {
+			pa, _ := NewPeerAuthorizer([]string{"other.example.com"}, nil, nil)
+			_, err := pa.Authorize(state)
+			c.Expect(err.Error(), gs.Equals, "peer 'client.example.com' is not allowed")
+		})
+
+		c.Specify("denies take precedence over allows", func() {
+			pa, _ := NewPeerAuthorizer([]string{"*"}, []string{"client.*"}, nil)
+			_, err := pa.Authorize(state)
+			c.Expect(err.Error(), gs.Equals, "peer 'client.example.com' is denied")
+		})
+
+		c.Specify("fails w/ an invalid pattern", func() {
+			_, err := NewPeerAuthorizer([]string{"[foo"}, nil, nil)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("assigns tenants by issuing CA", func() {
+			tmpDir, _ := ioutil.TempDir("", "heka-tls")
+			defer os.RemoveAll(tmpDir)
+			writeCA := func(name string, cert *x509.Certificate) string {
+				path := filepath.Join(tmpDir, name+".pem")
+				pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE",
+					Bytes: cert.Raw})
+				ioutil.WriteFile(path, pemBytes, 0644)
+				return path
+			}
+			caA, keyA := makeTestCert("Tenant A CA", nil, true, nil, nil)
+			caB, _ := makeTestCert("Tenant B CA", nil, true, nil, nil)
+			tenantCAs := map[string]string{
+				"a": writeCA("a", caA),
+				"b": writeCA("b", caB),
+			}
+			pa, err := NewPeerAuthorizer(nil, nil, tenantCAs)
+			c.Expect(err, gs.IsNil)
+			c.Expect(pa.UsesTenants(), gs.IsTrue)
+
+			leaf, _ := makeTestCert("agent1", nil, false, caA, keyA)
+			id, err := pa.Authorize(tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{leaf}})
+			c.Expect(err, gs.IsNil)
+			c.Expect(id.Tenant, gs.Equals, "a")
+
+			_, err = pa.Authorize(state)
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
 	})
 }
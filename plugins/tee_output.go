@@ -0,0 +1,121 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type TeeOutputConfig struct {
+	// Names of the outputs each message is written to, at least two.
+	Outputs []string
+	// If true, each of the outputs must have use_buffering set, so that one
+	// falling behind or failing doesn't hold up the others. Defaults to true.
+	RequireBuffering bool `toml:"require_buffering"`
+}
+
+// One of the outputs a TeeOutput writes to.
+type teeChild struct {
+	name         string
+	runner       OutputRunner
+	deliverCount int64
+	failCount    int64
+}
+
+// Output plugin that writes every message it matches to each of a set of
+// other outputs, e.g. to double write to an old and a new backend during a
+// migration. Each output delivers, buffers, and retries independently.
+type TeeOutput struct {
+	conf     *TeeOutputConfig
+	or       OutputRunner
+	children []*teeChild
+}
+
+func (t *TeeOutput) ConfigStruct() interface{} {
+	return &TeeOutputConfig{RequireBuffering: true}
+}
+
+func (t *TeeOutput) Init(config interface{}) error {
+	t.conf = config.(*TeeOutputConfig)
+	if len(t.conf.Outputs) < 2 {
+		return fmt.Errorf("outputs must name at least two outputs")
+	}
+	seen := make(map[string]bool)
+	for _, name := range t.conf.Outputs {
+		if seen[name] {
+			return fmt.Errorf("output '%s' is listed more than once", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func (t *TeeOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	t.or = or
+	pConfig := h.PipelineConfig()
+	t.children = make([]*teeChild, 0, len(t.conf.Outputs))
+	for _, name := range t.conf.Outputs {
+		if name == or.Name() {
+			return fmt.Errorf("can't tee to itself")
+		}
+		runner, ok := pConfig.Output(name)
+		if !ok {
+			return fmt.Errorf("no output named '%s'", name)
+		}
+		if t.conf.RequireBuffering && !runner.UsesBuffering() {
+			return fmt.Errorf("output '%s' must have use_buffering set", name)
+		}
+		t.children = append(t.children, &teeChild{name: name, runner: runner})
+	}
+	return nil
+}
+
+func (t *TeeOutput) ProcessMessage(pack *PipelinePack) error {
+	for _, child := range t.children {
+		atomic.AddInt32(&pack.RefCount, 1)
+		if err := child.runner.MatchRunner().Deliver(pack); err != nil {
+			atomic.AddInt64(&child.failCount, 1)
+			t.or.LogError(fmt.Errorf("can't deliver to '%s': %s", child.name, err))
+			continue
+		}
+		atomic.AddInt64(&child.deliverCount, 1)
+	}
+	t.or.UpdateCursor(pack.QueueCursor)
+	return nil
+}
+
+func (t *TeeOutput) CleanUp() {}
+
+// Satisfies the `pipeline.ReportingPlugin` interface to provide plugin state
+// information to the Heka report and dashboard.
+func (t *TeeOutput) ReportMsg(msg *message.Message) error {
+	for _, child := range t.children {
+		message.NewInt64Field(msg, child.name+"-DeliverCount",
+			atomic.LoadInt64(&child.deliverCount), "count")
+		message.NewInt64Field(msg, child.name+"-FailCount",
+			atomic.LoadInt64(&child.failCount), "count")
+	}
+	return nil
+}
+
+func init() {
+	RegisterPlugin("TeeOutput", func() interface{} {
+		return new(TeeOutput)
+	})
+}
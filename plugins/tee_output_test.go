@@ -0,0 +1,119 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package plugins
+
+import (
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/message"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+func TeeOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A TeeOutput", func() {
+		output := new(TeeOutput)
+		config := output.ConfigStruct().(*TeeOutputConfig)
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		h.EXPECT().PipelineConfig().Return(pConfig).AnyTimes()
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		or.EXPECT().Name().Return("Tee").AnyTimes()
+		or.EXPECT().UpdateCursor(gomock.Any()).AnyTimes()
+		or.EXPECT().LogError(gomock.Any()).AnyTimes()
+
+		// Adds an output whose deliveries arrive on the returned channel.
+		addChild := func(name string, buffered bool) (chan *PipelinePack,
+			*MatchRunner) {
+
+			matchChan := make(chan *PipelinePack, 2)
+			mr, err := NewMatchRunner("FALSE", "", nil, 2, matchChan)
+			c.Assume(err, gs.IsNil)
+			child := pipelinemock.NewMockOutputRunner(ctrl)
+			child.EXPECT().UsesBuffering().Return(buffered).AnyTimes()
+			child.EXPECT().MatchRunner().Return(mr).AnyTimes()
+			pConfig.OutputRunners[name] = child
+			return matchChan, mr
+		}
+		oldChan, _ := addChild("OldOutput", true)
+		newChan, newMatcher := addChild("NewOutput", true)
+		config.Outputs = []string{"OldOutput", "NewOutput"}
+
+		c.Specify("writes every message to each output", func() {
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			pack := NewPipelinePack(pConfig.InjectRecycleChan())
+			pack.Message.SetPayload("both")
+			pack.RefCount = 1
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			c.Expect(<-oldChan, gs.Equals, pack)
+			c.Expect(<-newChan, gs.Equals, pack)
+			// One for the tee, one for each output.
+			c.Expect(pack.RefCount, gs.Equals, int32(3))
+
+			msg := new(message.Message)
+			c.Expect(output.ReportMsg(msg), gs.IsNil)
+			count, _ := msg.GetFieldValue("NewOutput-DeliverCount")
+			c.Expect(count, gs.Equals, int64(1))
+		})
+
+		c.Specify("carries on when an output has shut down", func() {
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			newMatcher.Close()
+			pack := NewPipelinePack(pConfig.InjectRecycleChan())
+			pack.RefCount = 1
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			c.Expect(<-oldChan, gs.Equals, pack)
+			c.Expect(pack.RefCount, gs.Equals, int32(2))
+
+			msg := new(message.Message)
+			output.ReportMsg(msg)
+			count, _ := msg.GetFieldValue("NewOutput-FailCount")
+			c.Expect(count, gs.Equals, int64(1))
+		})
+
+		c.Specify("rejects", func() {
+			c.Specify("fewer than two outputs", func() {
+				config.Outputs = []string{"OldOutput"}
+				c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			})
+
+			c.Specify("an unknown output", func() {
+				config.Outputs = []string{"OldOutput", "NoOutput"}
+				c.Assume(output.Init(config), gs.IsNil)
+				err := output.Prepare(or, h)
+				c.Expect(err.Error(), gs.Equals, "no output named 'NoOutput'")
+			})
+
+			c.Specify("an unbuffered output, unless allowed", func() {
+				addChild("FastOutput", false)
+				config.Outputs = []string{"OldOutput", "FastOutput"}
+				c.Assume(output.Init(config), gs.IsNil)
+				err := output.Prepare(or, h)
+				c.Expect(err.Error(), gs.Equals,
+					"output 'FastOutput' must have use_buffering set")
+
+				config.RequireBuffering = false
+				c.Expect(output.Prepare(or, h), gs.IsNil)
+			})
+		})
+	})
+}
@@ -35,6 +35,10 @@ type UdpInput struct {
 	stopChan    chan struct{}
 	config      *UdpInputConfig
 	remote_addr string
+	remote_port int
+	local_port  int
+	// Transport metadata written to messages, nil if none is.
+	connFields *ConnFields
 }
 
 // ConfigStruct for NetworkInput plugins.
@@ -47,6 +51,15 @@ type UdpInputConfig struct {
 	Address string
 	// Set Hostname field from remote address
 	SetHostname bool `toml:"set_hostname"`
+	// Set to true if the socket should be opened with SO_REUSEPORT, so that
+	// another hekad can listen on the same address during an upgrade.
+	ReusePort bool `toml:"reuse_port"`
+	// Subsection of listening socket settings, such as the address family
+	// and buffer sizes.
+	Socket SocketConfig `toml:"socket"`
+	// Subsection choosing the transport metadata, such as the sender's
+	// address, written to each message's fields.
+	ConnectionFields ConnFieldsConfig `toml:"connection_fields"`
 }
 
 // Wrap ReadFrom into Read and set Hostname
@@ -57,12 +70,16 @@ type UdpInputReader struct {
 
 func (u *UdpInput) ConfigStruct() interface{} {
 	return &UdpInputConfig{
-		Net: "udp",
+		Net:              "udp",
+		ConnectionFields: ConnFieldsConfig{Prefix: "Conn"},
 	}
 }
 
 func (u *UdpInput) Init(config interface{}) (err error) {
 	u.config = config.(*UdpInputConfig)
+	if u.connFields, err = NewConnFields(u.config.ConnectionFields); err != nil {
+		return err
+	}
 
 	if u.config.Net == "unixgram" {
 		if runtime.GOOS == "windows" {
@@ -113,21 +130,34 @@ func (u *UdpInput) Init(config interface{}) (err error) {
 		}
 	} else {
 		// IP address
-		udpAddr, err := net.ResolveUDPAddr(u.config.Net, u.config.Address)
+		network, err := u.config.Socket.Network(u.config.Net)
+		if err != nil {
+			return err
+		}
+		udpAddr, err := net.ResolveUDPAddr(network, u.config.Address)
 		if err != nil {
 			return fmt.Errorf("ResolveUDPAddr failed: %s\n", err.Error())
 		}
-		u.listener, err = net.ListenUDP(u.config.Net, udpAddr)
+		var conn net.PacketConn
+		if conn, err = u.config.Socket.ListenPacket(network, udpAddr.String(),
+			u.config.ReusePort); err == nil {
+			u.listener = conn.(*net.UDPConn)
+		}
 		if err != nil {
 			return fmt.Errorf("ListenUDP failed: %s\n", err.Error())
 		}
-		if u.config.SetHostname {
+		if u.config.SetHostname || u.connFields != nil {
 			u.reader = UdpInputReader {
 				u.listener.(*net.UDPConn),
 				u,
 			}
 		}
 	}
+	if u.connFields != nil && u.listener.LocalAddr() != nil {
+		md := new(ConnMetadata)
+		md.SetLocal(u.listener.LocalAddr().String())
+		u.local_port = md.LocalPort
+	}
 	u.stopChan = make(chan struct{})
 	return
 }
@@ -138,12 +168,27 @@ func (u *UdpInput) Run(ir InputRunner, h PluginHelper) error {
 	ok := true
 	var err error
 
-	if !sr.UseMsgBytes() {
+	// The datagrams' metadata is stashed in their packs, and written to
+	// their messages by the deliverer once they're decoded.
+	var deliverer Deliverer
+	if u.connFields != nil {
+		deliverer = ir.NewDeliverer("")
+		deliverer.SetPackDecorator(u.connFields.StashedDecorator())
+		defer deliverer.Done()
+	}
+	useMsgBytes := sr.UseMsgBytes()
+	if !useMsgBytes || u.connFields != nil {
 		name := ir.Name()
 		packDec := func(pack *PipelinePack) {
-			pack.Message.SetType(name)
-			if u.config.SetHostname {
-				pack.Message.SetHostname(u.remote_addr)
+			if !useMsgBytes {
+				pack.Message.SetType(name)
+				if u.config.SetHostname {
+					pack.Message.SetHostname(u.remote_addr)
+				}
+			}
+			if u.connFields != nil {
+				u.connFields.Stash(pack, &ConnMetadata{RemoteAddr: u.remote_addr,
+					RemotePort: u.remote_port, LocalPort: u.local_port})
 			}
 		}
 		sr.SetPackDecorator(packDec)
@@ -154,10 +199,10 @@ func (u *UdpInput) Run(ir InputRunner, h PluginHelper) error {
 		case _, ok = <-u.stopChan:
 			break
 		default:
-			if u.config.SetHostname {
-				err = sr.SplitStream(u.reader, nil)
+			if u.reader.listener != nil {
+				err = sr.SplitStream(u.reader, deliverer)
 			} else {
-				err = sr.SplitStream(u.listener, nil)
+				err = sr.SplitStream(u.listener, deliverer)
 			}
 			// "use of closed" -> we're stopping.
 			if err != nil && !strings.Contains(err.Error(), "use of closed") {
@@ -186,8 +231,10 @@ func (r UdpInputReader) Read(p []byte) (n int, err error) {
 	n, addr, err := r.listener.ReadFromUDP(p)
 	if addr != nil {
 		r.input.remote_addr = addr.IP.String()
+		r.input.remote_port = addr.Port
 	} else {
 		r.input.remote_addr = ""
+		r.input.remote_port = 0
 	}
 	return n, err
 }
@@ -16,6 +16,7 @@
 package udp
 
 import (
+	"io"
 	"io/ioutil"
 	"net"
 	"path/filepath"
@@ -173,6 +174,70 @@ func UdpInputSpec(c gs.Context) {
 			})
 		}
 	})
+
+	c.Specify("A UdpInput writes connection fields to decoded messages", func() {
+		mockDeliverer := pipelinemock.NewMockDeliverer(ctrl)
+		udpInput := UdpInput{}
+		config := &UdpInputConfig{Net: "udp", Address: "127.0.0.1:55568"}
+		config.ConnectionFields = ConnFieldsConfig{Prefix: "Conn",
+			Fields: []string{"remote_addr", "remote_port", "local_port"}}
+		c.Assume(udpInput.Init(config), gs.IsNil)
+
+		var splitterDecorator, delivererDecorator func(*PipelinePack)
+		ith.MockInputRunner.EXPECT().Name().Return("mock_name")
+		ith.MockInputRunner.EXPECT().NewSplitterRunner("").Return(ith.MockSplitterRunner)
+		ith.MockInputRunner.EXPECT().NewDeliverer("").Return(mockDeliverer)
+		mockDeliverer.EXPECT().SetPackDecorator(gomock.Any()).Do(
+			func(decorator func(*PipelinePack)) {
+				delivererDecorator = decorator
+			})
+		mockDeliverer.EXPECT().Done()
+		ith.MockSplitterRunner.EXPECT().Done()
+		ith.MockSplitterRunner.EXPECT().GetRemainingData().AnyTimes()
+		ith.MockSplitterRunner.EXPECT().UseMsgBytes().Return(true)
+		ith.MockSplitterRunner.EXPECT().SetPackDecorator(gomock.Any()).Do(
+			func(decorator func(*PipelinePack)) {
+				splitterDecorator = decorator
+			})
+		packs := make(chan *PipelinePack, 1)
+		splitCall := ith.MockSplitterRunner.EXPECT().SplitStream(gomock.Any(),
+			mockDeliverer).AnyTimes()
+		splitCall.Do(func(r io.Reader, del Deliverer) {
+			recd := make([]byte, 65536)
+			if _, err := r.Read(recd); err != nil {
+				return
+			}
+			pack := NewPipelinePack(nil)
+			splitterDecorator(pack)
+			// Decoding replaces the message.
+			pack.Message = new(message.Message)
+			message.NewStringField(pack.Message, "ConnRemoteAddr", "10.0.0.1")
+			delivererDecorator(pack)
+			packs <- pack
+		})
+		done := make(chan error, 1)
+		go func() {
+			done <- udpInput.Run(ith.MockInputRunner, ith.MockHelper)
+		}()
+
+		conn, err := net.Dial("udp", config.Address)
+		c.Assume(err, gs.IsNil)
+		_, err = conn.Write([]byte("THIS IS THE DATA"))
+		c.Assume(err, gs.IsNil)
+		pack := <-packs
+
+		addr, _ := pack.Message.GetFieldValue("ConnRemoteAddr")
+		c.Expect(addr, gs.Equals, "127.0.0.1")
+		c.Expect(len(pack.Message.FindAllFields("ConnRemoteAddr")), gs.Equals, 1)
+		port, _ := pack.Message.GetFieldValue("ConnRemotePort")
+		c.Expect(port, gs.Equals, int64(conn.LocalAddr().(*net.UDPAddr).Port))
+		port, _ = pack.Message.GetFieldValue("ConnLocalPort")
+		c.Expect(port, gs.Equals, int64(55568))
+
+		conn.Close()
+		udpInput.Stop()
+		c.Expect(<-done, gs.IsNil)
+	})
 }
 
 func UdpInputSpecFailure(c gs.Context) {
@@ -185,3 +250,26 @@ func UdpInputSpecFailure(c gs.Context) {
 	c.Assume(err.Error(), gs.Equals, "ResolveUDPAddr failed: unknown network tcp\n")
 
 }
+
+func UdpInputMulticastSpec(c gs.Context) {
+	udpInput := UdpInput{}
+	config := &UdpInputConfig{Net: "udp", Address: "239.255.42.1:55567"}
+	config.Socket.MulticastInterface = "lo"
+	if runtime.GOOS == "darwin" {
+		config.Socket.MulticastInterface = "lo0"
+	}
+
+	c.Specify("A UdpInput joins a multicast group on the interface", func() {
+		err := udpInput.Init(config)
+		c.Expect(err, gs.IsNil)
+		udpInput.Stop()
+	})
+
+	c.Specify("A UdpInput won't set the multicast interface for other addresses", func() {
+		config.Address = "127.0.0.1:55567"
+		err := udpInput.Init(config)
+		c.Expect(err.Error(), gs.Equals, "ListenUDP failed: multicast_interface set, "+
+			"but 127.0.0.1:55567 isn't a multicast address\n")
+	})
+
+}
@@ -0,0 +1,177 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package zeromq
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type ZeroMQInputConfig struct {
+	ZeroMQConfig
+	// "PULL", or "SUB" to subscribe to publishers. Defaults to "PULL".
+	SocketType string `toml:"socket_type"`
+	// Topic prefixes a SUB socket subscribes to. Defaults to all topics.
+	Subscriptions []string `toml:"subscriptions"`
+	Splitter      string
+}
+
+// A message received, and the connection it came over.
+type zmqMessage struct {
+	frames [][]byte
+	conn   *zmtpConn
+}
+
+// Input plugin that receives messages on a ZeroMQ PULL or SUB socket,
+// binding or connecting its endpoints, with the connections optionally
+// encrypted with CURVE.
+type ZeroMQInput struct {
+	conf     *ZeroMQInputConfig
+	name     string
+	socket   *zmqSocket
+	messages chan zmqMessage
+	stopChan chan bool
+
+	// Accessed atomically, for the reports.
+	processMessageCount    int64
+	processMessageFailures int64
+}
+
+func (i *ZeroMQInput) ConfigStruct() interface{} {
+	return &ZeroMQInputConfig{
+		ZeroMQConfig: ZeroMQConfig{
+			Bind:                 true,
+			ReconnectInterval:    100,
+			ReconnectIntervalMax: 30000,
+			Timeout:              10,
+		},
+		SocketType:    "PULL",
+		Subscriptions: []string{""},
+		Splitter:      "NullSplitter",
+	}
+}
+
+func (i *ZeroMQInput) SetName(name string) {
+	i.name = name
+}
+
+func (i *ZeroMQInput) Init(config interface{}) (err error) {
+	i.conf = config.(*ZeroMQInputConfig)
+	if i.conf.SocketType != "PULL" && i.conf.SocketType != "SUB" {
+		return fmt.Errorf("socket_type '%s' isn't PULL or SUB", i.conf.SocketType)
+	}
+	if i.socket, err = newZmqSocket(i.conf.SocketType, &i.conf.ZeroMQConfig); err != nil {
+		return err
+	}
+	i.messages = make(chan zmqMessage)
+	i.stopChan = make(chan bool)
+	return nil
+}
+
+// Subscribes a SUB connection, then passes its messages to Run.
+func (i *ZeroMQInput) receive(c *zmtpConn) {
+	if i.conf.SocketType == "SUB" {
+		for _, topic := range i.conf.Subscriptions {
+			if err := c.send([][]byte{append([]byte{1}, topic...)}); err != nil {
+				return
+			}
+		}
+	}
+	for {
+		frames, err := c.receive()
+		if err != nil {
+			return
+		}
+		select {
+		case i.messages <- zmqMessage{frames, c}:
+		case <-i.stopChan:
+			return
+		}
+	}
+}
+
+func (i *ZeroMQInput) Run(ir InputRunner, h PluginHelper) (err error) {
+	if err = i.socket.start(i.receive, ir.LogError); err != nil {
+		return err
+	}
+	defer i.socket.close()
+
+	hostname := h.PipelineConfig().Hostname()
+	sRunner := ir.NewSplitterRunner("")
+	defer sRunner.Done()
+	var msg zmqMessage
+	if !sRunner.UseMsgBytes() {
+		sRunner.SetPackDecorator(func(pack *PipelinePack) {
+			pack.Message.SetType("heka.zeromq")
+			pack.Message.SetLogger(i.name)
+			pack.Message.SetHostname(hostname)
+			message.NewStringField(pack.Message, "RemoteAddress",
+				msg.conn.conn.RemoteAddr().String())
+			if i.conf.SocketType == "SUB" && len(msg.frames) > 1 {
+				message.NewStringField(pack.Message, "Topic", string(msg.frames[0]))
+			}
+			if msg.conn.peerKey != nil {
+				message.NewStringField(pack.Message, "CurveKey",
+					z85Encode(msg.conn.peerKey))
+			}
+		})
+	}
+
+	for {
+		select {
+		case msg = <-i.messages:
+		case <-i.stopChan:
+			return nil
+		}
+		// Multipart messages are delivered as their last frame.
+		body := msg.frames[len(msg.frames)-1]
+		atomic.AddInt64(&i.processMessageCount, 1)
+		n, err := sRunner.SplitBytes(body, nil)
+		if err != nil {
+			atomic.AddInt64(&i.processMessageFailures, 1)
+			ir.LogError(fmt.Errorf("message from %s dropped: %s",
+				msg.conn.conn.RemoteAddr(), err))
+		} else if n > 0 && n != len(body) {
+			ir.LogError(fmt.Errorf("extra data dropped in message from %s",
+				msg.conn.conn.RemoteAddr()))
+		}
+	}
+}
+
+func (i *ZeroMQInput) Stop() {
+	close(i.stopChan)
+}
+
+func (i *ZeroMQInput) CleanupForRestart() {
+	i.stopChan = make(chan bool)
+}
+
+func (i *ZeroMQInput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "ProcessMessageCount",
+		atomic.LoadInt64(&i.processMessageCount), "count")
+	message.NewInt64Field(msg, "ProcessMessageFailures",
+		atomic.LoadInt64(&i.processMessageFailures), "count")
+	message.NewInt64Field(msg, "Peers", int64(i.socket.peers()), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("ZeroMQInput", func() interface{} {
+		return new(ZeroMQInput)
+	})
+}
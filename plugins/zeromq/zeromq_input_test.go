@@ -0,0 +1,201 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package zeromq
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+)
+
+// Waits up to a second for the socket to be bound.
+func waitBound(s *zmqSocket) string {
+	for start := time.Now(); time.Since(start) < time.Second; {
+		if addr := s.boundAddr(); addr != "" {
+			return addr
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return ""
+}
+
+func ZeroMQInputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A ZeroMQInput", func() {
+		input := new(ZeroMQInput)
+		input.SetName("ZeroMQ")
+		config := input.ConfigStruct().(*ZeroMQInputConfig)
+		config.Endpoints = []string{"tcp://127.0.0.1:0"}
+
+		pConfig := NewPipelineConfig(nil)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		ir := pipelinemock.NewMockInputRunner(ctrl)
+		delivered := make(chan *PipelinePack, 2)
+		var splitErr error
+
+		run := func(messages int) chan error {
+			h.EXPECT().PipelineConfig().Return(pConfig)
+			sr := pipelinemock.NewMockSplitterRunner(ctrl)
+			ir.EXPECT().NewSplitterRunner("").Return(sr)
+			sr.EXPECT().UseMsgBytes().Return(false)
+			var decorate func(*PipelinePack)
+			sr.EXPECT().SetPackDecorator(gomock.Any()).Do(func(f func(*PipelinePack)) {
+				decorate = f
+			})
+			sr.EXPECT().SplitBytes(gomock.Any(), nil).Do(func(data []byte, del Deliverer) {
+				pack := NewPipelinePack(nil)
+				pack.Message.SetPayload(string(data))
+				decorate(pack)
+				delivered <- pack
+			}).Return(0, splitErr).Times(messages)
+			sr.EXPECT().Done()
+
+			c.Assume(input.Init(config), gs.IsNil)
+			done := make(chan error, 1)
+			go func() {
+				done <- input.Run(ir, h)
+			}()
+			return done
+		}
+
+		c.Specify("receives pushed messages", func() {
+			done := run(2)
+			addr := waitBound(input.socket)
+			c.Assume(addr, gs.Not(gs.Equals), "")
+			peer, err := dialPeer(addr, &zmqSecurity{mechanism: "NULL"}, "PUSH")
+			c.Assume(err, gs.IsNil)
+			defer peer.close()
+			c.Expect(peer.send([][]byte{[]byte("one")}), gs.IsNil)
+			c.Expect(peer.send([][]byte{[]byte("ignored"), []byte("two")}), gs.IsNil)
+
+			pack := <-delivered
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "one")
+			c.Expect(pack.Message.GetType(), gs.Equals, "heka.zeromq")
+			c.Expect(pack.Message.GetLogger(), gs.Equals, "ZeroMQ")
+			value, _ := pack.Message.GetFieldValue("RemoteAddress")
+			c.Expect(value, gs.Equals, peer.conn.LocalAddr().String())
+			c.Expect(pack.Message.FindFirstField("Topic") == nil, gs.IsTrue)
+			c.Expect(pack.Message.FindFirstField("CurveKey") == nil, gs.IsTrue)
+			pack = <-delivered
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "two")
+			c.Expect(input.socket.peers(), gs.Equals, 1)
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+		})
+
+		c.Specify("logs messages it can't deliver", func() {
+			splitErr = errors.New("no good")
+			ir.EXPECT().LogError(gomock.Any())
+			done := run(1)
+			peer, err := dialPeer(waitBound(input.socket), &zmqSecurity{mechanism: "NULL"},
+				"PUSH")
+			c.Assume(err, gs.IsNil)
+			defer peer.close()
+			c.Expect(peer.send([][]byte{[]byte("one")}), gs.IsNil)
+			<-delivered
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+			c.Expect(input.processMessageFailures, gs.Equals, int64(1))
+		})
+
+		c.Specify("subscribes to publishers", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			c.Assume(err, gs.IsNil)
+			defer listener.Close()
+			config.Endpoints = []string{"tcp://" + listener.Addr().String()}
+			config.Bind = false
+			config.SocketType = "SUB"
+			config.Subscriptions = []string{"logs", "metrics"}
+			done := run(1)
+
+			pub, err := acceptPeer(listener, &zmqSecurity{mechanism: "NULL"}, "PUB")
+			c.Assume(err, gs.IsNil)
+			defer pub.close()
+			for _, topic := range config.Subscriptions {
+				frames, err := pub.receive()
+				c.Expect(err, gs.IsNil)
+				c.Expect(string(frames[0]), gs.Equals, "\x01"+topic)
+			}
+			c.Expect(pub.send([][]byte{[]byte("logs.nginx"), []byte("one")}), gs.IsNil)
+			pack := <-delivered
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "one")
+			value, _ := pack.Message.GetFieldValue("Topic")
+			c.Expect(value, gs.Equals, "logs.nginx")
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+		})
+
+		c.Specify("accepts CURVE clients", func() {
+			config.CurveSecretKey = serverSecret
+			config.CurveClientKeys = []string{clientPublic}
+			done := run(1)
+			addr := waitBound(input.socket)
+
+			ir.EXPECT().LogError(gomock.Any())
+			_, err := dialPeer(addr, curveSecurity(serverSecret, serverPublic), "PUSH")
+			c.Expect(err, gs.Not(gs.IsNil))
+
+			peer, err := dialPeer(addr, curveSecurity(clientSecret, serverPublic), "PUSH")
+			c.Assume(err, gs.IsNil)
+			defer peer.close()
+			c.Expect(peer.send([][]byte{[]byte("secret")}), gs.IsNil)
+			pack := <-delivered
+			c.Expect(pack.Message.GetPayload(), gs.Equals, "secret")
+			value, _ := pack.Message.GetFieldValue("CurveKey")
+			c.Expect(value, gs.Equals, clientPublic)
+			input.Stop()
+			c.Expect(<-done, gs.IsNil)
+		})
+
+		c.Specify("checks its settings", func() {
+			config.SocketType = "PUSH"
+			c.Expect(input.Init(config), gs.Not(gs.IsNil))
+			config.SocketType = "PULL"
+			config.Endpoints = []string{"ipc:///tmp/heka"}
+			c.Expect(input.Init(config), gs.Not(gs.IsNil))
+			config.Endpoints = []string{"tcp://*:5555"}
+			c.Expect(input.Init(config), gs.IsNil)
+			config.Bind = false
+			c.Expect(input.Init(config), gs.Not(gs.IsNil))
+		})
+
+		c.Specify("decodes its config from TOML", func() {
+			_, err := toml.Decode(`
+endpoints = ["tcp://*:5556"]
+socket_type = "SUB"
+subscriptions = ["logs"]
+curve_secret_key = "JTKVSB%%)wK0E.X)V>+}o?pNmC{O&4W4b!Ni{Lh6"
+`, config)
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(config.Endpoints), gs.Equals, 1)
+			c.Expect(config.Bind, gs.IsTrue)
+			c.Expect(config.SocketType, gs.Equals, "SUB")
+			c.Expect(len(config.Subscriptions), gs.Equals, 1)
+			c.Expect(config.Subscriptions[0], gs.Equals, "logs")
+			c.Expect(config.CurveSecretKey, gs.Equals, serverSecret)
+			c.Expect(config.Timeout, gs.Equals, uint(10))
+		})
+	})
+}
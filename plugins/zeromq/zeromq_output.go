@@ -0,0 +1,262 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package zeromq
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	. "heka/pipeline"
+)
+
+type ZeroMQOutputConfig struct {
+	ZeroMQConfig
+	// "PUSH", or "PUB" to publish to subscribers. Defaults to "PUSH".
+	SocketType string `toml:"socket_type"`
+	// Topic sent as the first frame of each message, for subscribers to
+	// filter on.
+	Topic string `toml:"topic"`
+	// Most messages queued for each peer. Defaults to 1000.
+	SendHwm uint `toml:"send_hwm"`
+}
+
+// A connection and the messages queued for it, with the topic prefixes it
+// subscribes to if it's a subscriber.
+type zmqPeer struct {
+	conn          *zmtpConn
+	queue         chan [][]byte
+	lock          sync.Mutex
+	subscriptions [][]byte
+}
+
+// Returns whether the peer subscribes to the topic.
+func (p *zmqPeer) subscribed(topic []byte) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, prefix := range p.subscriptions {
+		if bytes.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies a subscription message, whose first byte is 1 to subscribe to
+// the prefix after it, and 0 to cancel the subscription.
+func (p *zmqPeer) subscribe(msg []byte) {
+	if len(msg) == 0 || msg[0] > 1 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	prefix := msg[1:]
+	for i, sub := range p.subscriptions {
+		if bytes.Equal(sub, prefix) {
+			if msg[0] == 0 {
+				p.subscriptions = append(p.subscriptions[:i], p.subscriptions[i+1:]...)
+			}
+			return
+		}
+	}
+	if msg[0] == 1 {
+		p.subscriptions = append(p.subscriptions, prefix)
+	}
+}
+
+// Output plugin that sends messages on a ZeroMQ PUSH or PUB socket, binding
+// or connecting its endpoints, with the connections optionally encrypted
+// with CURVE. A PUSH socket sends each message to the next peer with room
+// in its queue, retrying while none has, and a PUB socket queues each
+// message for all the subscribed peers, dropping it for those without
+// room.
+type ZeroMQOutput struct {
+	conf   *ZeroMQOutputConfig
+	socket *zmqSocket
+	or     OutputRunner
+
+	lock  sync.Mutex
+	peers []*zmqPeer
+	next  int
+
+	// Accessed atomically, for the reports.
+	messagesSent    int64
+	messagesDropped int64
+}
+
+func (o *ZeroMQOutput) ConfigStruct() interface{} {
+	return &ZeroMQOutputConfig{
+		ZeroMQConfig: ZeroMQConfig{
+			ReconnectInterval:    100,
+			ReconnectIntervalMax: 30000,
+			Timeout:              10,
+		},
+		SocketType: "PUSH",
+		SendHwm:    1000,
+	}
+}
+
+func (o *ZeroMQOutput) Init(config interface{}) (err error) {
+	o.conf = config.(*ZeroMQOutputConfig)
+	if o.conf.SocketType != "PUSH" && o.conf.SocketType != "PUB" {
+		return fmt.Errorf("socket_type '%s' isn't PUSH or PUB", o.conf.SocketType)
+	}
+	if o.conf.SendHwm == 0 {
+		return errors.New("send_hwm must be greater than 0")
+	}
+	o.socket, err = newZmqSocket(o.conf.SocketType, &o.conf.ZeroMQConfig)
+	return err
+}
+
+func (o *ZeroMQOutput) Prepare(or OutputRunner, h PluginHelper) error {
+	if or.Encoder() == nil {
+		return errors.New("an encoder must be specified")
+	}
+	o.or = or
+	return o.socket.start(o.serve, or.LogError)
+}
+
+// Sends a connection's queued messages, reading the subscriptions it sends,
+// until it fails.
+func (o *ZeroMQOutput) serve(c *zmtpConn) {
+	p := &zmqPeer{conn: c, queue: make(chan [][]byte, o.conf.SendHwm)}
+	o.lock.Lock()
+	o.peers = append(o.peers, p)
+	o.lock.Unlock()
+	defer func() {
+		o.lock.Lock()
+		for i, peer := range o.peers {
+			if peer == p {
+				o.peers = append(o.peers[:i], o.peers[i+1:]...)
+				break
+			}
+		}
+		o.lock.Unlock()
+		if dropped := len(p.queue); dropped > 0 {
+			atomic.AddInt64(&o.messagesDropped, int64(dropped))
+		}
+	}()
+
+	failed := make(chan bool)
+	go func() {
+		defer close(failed)
+		for {
+			frames, err := c.receive()
+			if err != nil {
+				return
+			}
+			if len(frames) == 1 {
+				p.subscribe(frames[0])
+			}
+		}
+	}()
+	for {
+		select {
+		case frames := <-p.queue:
+			if err := c.send(frames); err != nil {
+				c.close()
+				<-failed
+				atomic.AddInt64(&o.messagesDropped, 1)
+				return
+			}
+			atomic.AddInt64(&o.messagesSent, 1)
+		case <-failed:
+			return
+		}
+	}
+}
+
+func (o *ZeroMQOutput) ProcessMessage(pack *PipelinePack) error {
+	body, err := o.or.Encode(pack)
+	if err != nil {
+		return fmt.Errorf("can't encode: %s", err)
+	}
+	if body == nil {
+		return nil
+	}
+	// Copy the body, the encoder may reuse its buffer.
+	frames := [][]byte{append([]byte(nil), body...)}
+	if o.conf.Topic != "" {
+		frames = append([][]byte{[]byte(o.conf.Topic)}, frames...)
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.conf.SocketType == "PUB" {
+		for _, p := range o.peers {
+			if !p.subscribed(frames[0]) {
+				continue
+			}
+			select {
+			case p.queue <- frames:
+			default:
+				atomic.AddInt64(&o.messagesDropped, 1)
+			}
+		}
+		return nil
+	}
+	for n := 0; n < len(o.peers); n++ {
+		p := o.peers[(o.next+n)%len(o.peers)]
+		select {
+		case p.queue <- frames:
+			o.next = (o.next + n + 1) % len(o.peers)
+			return nil
+		default:
+		}
+	}
+	if len(o.peers) == 0 {
+		return NewRetryMessageError("no peers connected")
+	}
+	return NewRetryMessageError("all peers' queues are full")
+}
+
+// Returns how many messages are queued for the peers.
+func (o *ZeroMQOutput) queued() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	n := 0
+	for _, p := range o.peers {
+		n += len(p.queue)
+	}
+	return n
+}
+
+func (o *ZeroMQOutput) CleanUp() {
+	// Give the peers a chance to be sent the messages queued for them.
+	deadline := time.Now().Add(time.Duration(o.conf.Timeout) * time.Second)
+	for o.queued() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	o.socket.close()
+}
+
+func (o *ZeroMQOutput) ReportMsg(msg *message.Message) error {
+	message.NewInt64Field(msg, "MessagesSent", atomic.LoadInt64(&o.messagesSent),
+		"count")
+	message.NewInt64Field(msg, "MessagesDropped",
+		atomic.LoadInt64(&o.messagesDropped), "count")
+	message.NewInt64Field(msg, "Peers", int64(o.socket.peers()), "count")
+	return nil
+}
+
+func init() {
+	RegisterPlugin("ZeroMQOutput", func() interface{} {
+		return new(ZeroMQOutput)
+	})
+}
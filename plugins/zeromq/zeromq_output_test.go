@@ -0,0 +1,218 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package zeromq
+
+import (
+	"net"
+	"time"
+
+	"github.com/rafrombrc/gomock/gomock"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	. "heka/pipeline"
+	pipeline_ts "heka/pipeline/testsupport"
+	"heka/pipelinemock"
+	"heka/plugins"
+)
+
+// Waits up to a second for the socket to have the number of peers.
+func waitPeers(s *zmqSocket, n int) int {
+	for start := time.Now(); time.Since(start) < time.Second; {
+		if s.peers() == n {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return s.peers()
+}
+
+func ZeroMQOutputSpec(c gs.Context) {
+	t := new(pipeline_ts.SimpleT)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c.Specify("A ZeroMQOutput", func() {
+		null := &zmqSecurity{mechanism: "NULL"}
+		output := new(ZeroMQOutput)
+		config := output.ConfigStruct().(*ZeroMQOutputConfig)
+
+		or := pipelinemock.NewMockOutputRunner(ctrl)
+		h := pipelinemock.NewMockPluginHelper(ctrl)
+		encoder := new(plugins.PayloadEncoder)
+		encoder.Init(encoder.ConfigStruct())
+		or.EXPECT().Encoder().Return(encoder).AnyTimes()
+		or.EXPECT().Encode(gomock.Any()).Return([]byte("payload"), nil).AnyTimes()
+		pack := NewPipelinePack(nil)
+		pack.Message.SetPayload("payload")
+
+		c.Specify("pushes messages round robin", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			c.Assume(err, gs.IsNil)
+			defer listener.Close()
+			config.Endpoints = []string{"tcp://" + listener.Addr().String()}
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			defer output.CleanUp()
+
+			// It's connected, but the handshake waits for the peer.
+			err = output.ProcessMessage(pack)
+			_, ok := err.(RetryMessageError)
+			c.Expect(ok, gs.IsTrue)
+			c.Expect(err.Error(), gs.Equals, "no peers connected")
+			first, err := acceptPeer(listener, null, "PULL")
+			c.Assume(err, gs.IsNil)
+			defer first.close()
+			c.Assume(waitPeers(output.socket, 1), gs.Equals, 1)
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			frames, err := first.receive()
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(frames[0]), gs.Equals, "payload")
+
+			// It reconnects once the first peer's gone.
+			first.close()
+			second, err := acceptPeer(listener, null, "PULL")
+			c.Assume(err, gs.IsNil)
+			defer second.close()
+			c.Assume(waitPeers(output.socket, 1), gs.Equals, 1)
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			frames, err = second.receive()
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(frames[0]), gs.Equals, "payload")
+		})
+
+		c.Specify("spreads messages over its peers", func() {
+			config.Endpoints = []string{"tcp://127.0.0.1:0"}
+			config.Bind = true
+			config.Topic = "logs"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			defer output.CleanUp()
+			addr := output.socket.boundAddr()
+			first, err := dialPeer(addr, null, "PULL")
+			c.Assume(err, gs.IsNil)
+			defer first.close()
+			second, err := dialPeer(addr, null, "PULL")
+			c.Assume(err, gs.IsNil)
+			defer second.close()
+			c.Assume(waitPeers(output.socket, 2), gs.Equals, 2)
+
+			for i := 0; i < 4; i++ {
+				c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			}
+			for _, peer := range []*zmtpConn{first, second, first, second} {
+				frames, err := peer.receive()
+				c.Expect(err, gs.IsNil)
+				c.Expect(len(frames), gs.Equals, 2)
+				c.Expect(string(frames[0]), gs.Equals, "logs")
+			}
+		})
+
+		c.Specify("retries when the peers' queues are full", func() {
+			config.Endpoints = []string{"tcp://127.0.0.1:0"}
+			config.Bind = true
+			config.SendHwm = 1
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			defer output.CleanUp()
+			peer, err := dialPeer(output.socket.boundAddr(), null, "PULL")
+			c.Assume(err, gs.IsNil)
+			defer peer.close()
+			c.Assume(waitPeers(output.socket, 1), gs.Equals, 1)
+
+			// The peer never reads, so sends block once the socket buffers
+			// fill up, and then the queue.
+			var retryErr error
+			for start := time.Now(); retryErr == nil && time.Since(start) < 5*time.Second; {
+				retryErr = output.ProcessMessage(pack)
+			}
+			c.Expect(retryErr, gs.Not(gs.IsNil))
+			c.Expect(retryErr.Error(), gs.Equals, "all peers' queues are full")
+		})
+
+		c.Specify("publishes to subscribers", func() {
+			config.Endpoints = []string{"tcp://127.0.0.1:0"}
+			config.Bind = true
+			config.SocketType = "PUB"
+			config.Topic = "logs.nginx"
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			defer output.CleanUp()
+			addr := output.socket.boundAddr()
+			logs, err := dialPeer(addr, null, "SUB")
+			c.Assume(err, gs.IsNil)
+			defer logs.close()
+			metrics, err := dialPeer(addr, null, "SUB")
+			c.Assume(err, gs.IsNil)
+			defer metrics.close()
+			c.Assume(logs.send([][]byte{[]byte("\x01logs")}), gs.IsNil)
+			c.Assume(metrics.send([][]byte{[]byte("\x01metrics")}), gs.IsNil)
+			for start := time.Now(); time.Since(start) < time.Second; {
+				output.lock.Lock()
+				subscribed := 0
+				for _, p := range output.peers {
+					p.lock.Lock()
+					subscribed += len(p.subscriptions)
+					p.lock.Unlock()
+				}
+				output.lock.Unlock()
+				if subscribed == 2 {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			frames, err := logs.receive()
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(frames[0]), gs.Equals, "logs.nginx")
+			c.Expect(string(frames[1]), gs.Equals, "payload")
+			metrics.conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			_, err = metrics.receive()
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("encrypts with CURVE", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			c.Assume(err, gs.IsNil)
+			defer listener.Close()
+			config.Endpoints = []string{"tcp://" + listener.Addr().String()}
+			config.CurveSecretKey = clientSecret
+			config.CurveServerKey = serverPublic
+			c.Assume(output.Init(config), gs.IsNil)
+			c.Assume(output.Prepare(or, h), gs.IsNil)
+			defer output.CleanUp()
+			peer, err := acceptPeer(listener, curveSecurity(serverSecret, ""), "PULL")
+			c.Assume(err, gs.IsNil)
+			defer peer.close()
+			c.Expect(z85Encode(peer.peerKey), gs.Equals, clientPublic)
+			c.Assume(waitPeers(output.socket, 1), gs.Equals, 1)
+			c.Expect(output.ProcessMessage(pack), gs.IsNil)
+			frames, err := peer.receive()
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(frames[0]), gs.Equals, "payload")
+		})
+
+		c.Specify("checks its settings", func() {
+			config.Endpoints = []string{"tcp://127.0.0.1:5555"}
+			config.SocketType = "SUB"
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.SocketType = "PUB"
+			config.SendHwm = 0
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+			config.SendHwm = 10
+			config.CurveServerKey = serverPublic
+			c.Expect(output.Init(config), gs.Not(gs.IsNil))
+		})
+	})
+}
@@ -0,0 +1,252 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package zeromq
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Socket settings shared by the ZeroMQ input and output.
+type ZeroMQConfig struct {
+	// Endpoints bound or connected to, "tcp://host:port", with "*" as the
+	// host to bind all interfaces.
+	Endpoints []string `toml:"endpoints"`
+	// Whether the endpoints are bound, rather than connected to.
+	Bind bool `toml:"bind"`
+	// The socket's CURVE secret key, in Z85. Connections are encrypted
+	// only if it's set.
+	CurveSecretKey string `toml:"curve_secret_key"`
+	// The CURVE server's public key, making the socket a CURVE client.
+	// Without it the socket's the CURVE server.
+	CurveServerKey string `toml:"curve_server_key"`
+	// Public keys of the clients a CURVE server accepts, any if it's empty.
+	CurveClientKeys []string `toml:"curve_client_keys"`
+	// Milliseconds before reconnecting to an endpoint, doubling after each
+	// failure up to reconnect_interval_max. Defaults to 100 and 30000.
+	ReconnectInterval    uint `toml:"reconnect_interval"`
+	ReconnectIntervalMax uint `toml:"reconnect_interval_max"`
+	// Seconds the handshake and each send may take. Defaults to 10.
+	Timeout uint `toml:"timeout"`
+}
+
+// A socket of some type, binding or connecting its endpoints and handing
+// each connection to handle once it's done its handshake.
+type zmqSocket struct {
+	socketType string
+	conf       *ZeroMQConfig
+	sec        *zmqSecurity
+	addresses  []string
+	// Called in a goroutine for each connection, which is closed once it
+	// returns.
+	handle   func(c *zmtpConn)
+	logError func(error)
+
+	stopChan  chan bool
+	wg        sync.WaitGroup
+	lock      sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]bool
+	ready     int
+}
+
+// Checks the socket settings, returning the socket.
+func newZmqSocket(socketType string, conf *ZeroMQConfig) (*zmqSocket, error) {
+	if len(conf.Endpoints) == 0 {
+		return nil, errors.New("endpoints must be set")
+	}
+	s := &zmqSocket{socketType: socketType, conf: conf}
+	for _, endpoint := range conf.Endpoints {
+		if !strings.HasPrefix(endpoint, "tcp://") {
+			return nil, fmt.Errorf("endpoint '%s' isn't tcp://host:port", endpoint)
+		}
+		address := strings.TrimPrefix(endpoint, "tcp://")
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("bad endpoint '%s': %s", endpoint, err)
+		}
+		if host == "*" {
+			if !conf.Bind {
+				return nil, fmt.Errorf("can't connect to '%s'", endpoint)
+			}
+			host = ""
+		}
+		s.addresses = append(s.addresses, net.JoinHostPort(host, port))
+	}
+	var err error
+	if s.sec, err = newZmqSecurity(conf.CurveSecretKey, conf.CurveServerKey,
+		conf.CurveClientKeys); err != nil {
+		return nil, err
+	}
+	if conf.ReconnectInterval == 0 {
+		return nil, errors.New("reconnect_interval must be greater than 0")
+	}
+	return s, nil
+}
+
+// Binds or connects the endpoints.
+func (s *zmqSocket) start(handle func(c *zmtpConn), logError func(error)) error {
+	s.handle, s.logError = handle, logError
+	s.lock.Lock()
+	s.stopChan = make(chan bool)
+	s.conns = make(map[net.Conn]bool)
+	s.listeners = nil
+	s.lock.Unlock()
+	for _, address := range s.addresses {
+		if !s.conf.Bind {
+			s.wg.Add(1)
+			go s.connect(address)
+			continue
+		}
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			s.close()
+			return fmt.Errorf("can't bind %s: %s", address, err)
+		}
+		s.lock.Lock()
+		s.listeners = append(s.listeners, listener)
+		s.lock.Unlock()
+		s.wg.Add(1)
+		go s.accept(listener)
+	}
+	return nil
+}
+
+// The address of the first endpoint bound, with its port if it was 0.
+func (s *zmqSocket) boundAddr() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.listeners) == 0 {
+		return ""
+	}
+	return s.listeners[0].Addr().String()
+}
+
+func (s *zmqSocket) accept(listener net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				continue
+			}
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(conn)
+		}()
+	}
+}
+
+// Connects the address, reconnecting whenever the connection fails, until
+// the socket's closed.
+func (s *zmqSocket) connect(address string) {
+	defer s.wg.Done()
+	min := time.Duration(s.conf.ReconnectInterval) * time.Millisecond
+	max := time.Duration(s.conf.ReconnectIntervalMax) * time.Millisecond
+	if max < min {
+		max = min
+	}
+	interval := min
+	failing := false
+	dialer := &net.Dialer{Timeout: time.Duration(s.conf.Timeout) * time.Second}
+	for {
+		conn, err := dialer.Dial("tcp", address)
+		if err == nil {
+			if s.serve(conn) {
+				interval, failing = min, false
+			}
+		} else if !failing {
+			// Only the first failure's logged, until a connection works.
+			s.logError(fmt.Errorf("can't connect to %s: %s", address, err))
+			failing = true
+		}
+		select {
+		case <-s.stopChan:
+			return
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > max {
+			interval = max
+		}
+	}
+}
+
+// Does a connection's handshake and hands it over, returning whether the
+// handshake worked.
+func (s *zmqSocket) serve(conn net.Conn) bool {
+	s.lock.Lock()
+	select {
+	case <-s.stopChan:
+		s.lock.Unlock()
+		conn.Close()
+		return false
+	default:
+	}
+	s.conns[conn] = true
+	s.lock.Unlock()
+	defer func() {
+		conn.Close()
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+	}()
+
+	c, err := newZmtpConn(conn, s.sec, s.socketType,
+		time.Duration(s.conf.Timeout)*time.Second)
+	if err != nil {
+		s.logError(fmt.Errorf("handshake with %s failed: %s", conn.RemoteAddr(), err))
+		return false
+	}
+	s.lock.Lock()
+	s.ready++
+	s.lock.Unlock()
+	s.handle(c)
+	s.lock.Lock()
+	s.ready--
+	s.lock.Unlock()
+	return true
+}
+
+// Returns how many connections have done their handshake.
+func (s *zmqSocket) peers() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.ready
+}
+
+// Closes the listeners and connections, waiting for the handlers to return.
+func (s *zmqSocket) close() {
+	s.lock.Lock()
+	select {
+	case <-s.stopChan:
+	default:
+		close(s.stopChan)
+	}
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+}
@@ -0,0 +1,364 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package zeromq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"heka/message"
+)
+
+// ZMTP 3.0 frame flags.
+const (
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+)
+
+// The socket types each socket type may be connected to.
+var compatibleSockets = map[string]string{
+	"PUSH": "PULL",
+	"PULL": "PUSH",
+	"PUB":  "SUB",
+	"SUB":  "PUB",
+}
+
+// A ZMTP 3.0 connection, once its security handshake is done. Messages may
+// be sent from several goroutines, but only one may receive.
+type zmtpConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	writeLock sync.Mutex
+	writer    *bufio.Writer
+	timeout   time.Duration
+	// Encrypts and decrypts the messages of CURVE connections.
+	curve *curveCodec
+	// The peer's metadata, such as its Socket-Type, and its CURVE public
+	// key, if it's a CURVE client.
+	peerMeta map[string]string
+	peerKey  []byte
+}
+
+// Greets the peer and does the security handshake, as the given socket
+// type.
+func newZmtpConn(conn net.Conn, sec *zmqSecurity, socketType string,
+	timeout time.Duration) (c *zmtpConn, err error) {
+
+	c = &zmtpConn{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		writer:  bufio.NewWriter(conn),
+		timeout: timeout,
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+	if err = c.greet(sec); err != nil {
+		return nil, err
+	}
+	meta := map[string]string{"Socket-Type": socketType}
+	switch {
+	case sec.mechanism == "NULL":
+		err = c.nullHandshake(meta)
+	case sec.server:
+		err = c.curveServerHandshake(sec, meta)
+	default:
+		err = c.curveClientHandshake(sec, meta)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if peerType := c.peerMeta["Socket-Type"]; peerType != compatibleSockets[socketType] {
+		c.sendError("Invalid socket type")
+		return nil, fmt.Errorf("%s socket can't talk to a %s socket", socketType,
+			peerType)
+	}
+	return c, nil
+}
+
+// Exchanges the greetings, checking the peer uses the same mechanism.
+func (c *zmtpConn) greet(sec *zmqSecurity) error {
+	greeting := make([]byte, 64)
+	greeting[0], greeting[9] = 0xff, 0x7f
+	greeting[10], greeting[11] = 3, 0
+	copy(greeting[12:32], sec.mechanism)
+	if sec.server {
+		greeting[32] = 1
+	}
+	c.writer.Write(greeting)
+	if err := c.writer.Flush(); err != nil {
+		return err
+	}
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(c.reader, peer); err != nil {
+		return fmt.Errorf("no greeting: %s", err)
+	}
+	if peer[0] != 0xff || peer[9] != 0x7f {
+		return errors.New("peer doesn't speak ZMTP")
+	}
+	if peer[10] < 3 {
+		return fmt.Errorf("peer speaks ZMTP %d.%d, not 3.0", peer[10], peer[11])
+	}
+	mechanism := string(bytes.TrimRight(peer[12:32], "\x00"))
+	if mechanism != sec.mechanism {
+		return fmt.Errorf("peer uses the %s mechanism, not %s", mechanism,
+			sec.mechanism)
+	}
+	if sec.mechanism == "CURVE" && (peer[32] == 1) == sec.server {
+		return errors.New("both peers are CURVE servers, or both clients")
+	}
+	return nil
+}
+
+// Exchanges READY commands with the socket's metadata.
+func (c *zmtpConn) nullHandshake(meta map[string]string) error {
+	if err := c.sendCommand("READY", encodeMetadata(meta)); err != nil {
+		return err
+	}
+	data, err := c.expectCommand("READY")
+	if err != nil {
+		return err
+	}
+	c.peerMeta, err = parseMetadata(data)
+	return err
+}
+
+// Reads a frame, returning its flags and body.
+func (c *zmtpConn) readFrame() (byte, []byte, error) {
+	flags, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var size uint64
+	if flags&flagLong != 0 {
+		head := make([]byte, 8)
+		if _, err = io.ReadFull(c.reader, head); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(head)
+	} else {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b)
+	}
+	// Leaving room for the CURVE overhead.
+	if size > uint64(message.MAX_RECORD_SIZE)+64 {
+		return 0, nil, fmt.Errorf("frame of %d bytes is too big", size)
+	}
+	body := make([]byte, size)
+	if _, err = io.ReadFull(c.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+// Buffers a frame, to be sent with the next flush.
+func (c *zmtpConn) writeFrame(flags byte, body []byte) {
+	if len(body) > 255 {
+		c.writer.WriteByte(flags | flagLong)
+		binary.Write(c.writer, binary.BigEndian, uint64(len(body)))
+	} else {
+		c.writer.WriteByte(flags)
+		c.writer.WriteByte(byte(len(body)))
+	}
+	c.writer.Write(body)
+}
+
+// Returns a command's body.
+func encodeCommand(name string, data []byte) []byte {
+	body := make([]byte, 0, 1+len(name)+len(data))
+	body = append(body, byte(len(name)))
+	body = append(body, name...)
+	return append(body, data...)
+}
+
+// Returns a command's name and data.
+func parseCommand(body []byte) (string, []byte, error) {
+	if len(body) == 0 || len(body) < 1+int(body[0]) {
+		return "", nil, errors.New("truncated command")
+	}
+	return string(body[1 : 1+body[0]]), body[1+body[0]:], nil
+}
+
+func (c *zmtpConn) sendCommand(name string, data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.writeFrame(flagCommand, encodeCommand(name, data))
+	return c.writer.Flush()
+}
+
+// Tells the peer why the handshake failed, before the connection's closed.
+func (c *zmtpConn) sendError(reason string) {
+	data := append([]byte{byte(len(reason))}, reason...)
+	c.sendCommand("ERROR", data)
+}
+
+// Reads the next frame, failing unless it's the command given. An ERROR
+// command is reported with its reason.
+func (c *zmtpConn) expectCommand(name string) ([]byte, error) {
+	flags, body, err := c.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	if flags&flagCommand == 0 {
+		return nil, fmt.Errorf("expected %s command, got a message", name)
+	}
+	got, data, err := parseCommand(body)
+	if err != nil {
+		return nil, err
+	}
+	if got == "ERROR" {
+		reason := ""
+		if len(data) > 0 && len(data) >= 1+int(data[0]) {
+			reason = string(data[1 : 1+data[0]])
+		}
+		return nil, fmt.Errorf("peer refused the connection: %s", reason)
+	}
+	if got != name {
+		return nil, fmt.Errorf("expected %s command, got %s", name, got)
+	}
+	return data, nil
+}
+
+// Encodes metadata properties, in name order.
+func encodeMetadata(meta map[string]string) []byte {
+	names := make([]string, 0, len(meta))
+	for name := range meta {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.WriteByte(byte(len(name)))
+		buf.WriteString(name)
+		binary.Write(&buf, binary.BigEndian, uint32(len(meta[name])))
+		buf.WriteString(meta[name])
+	}
+	return buf.Bytes()
+}
+
+// Parses metadata properties. Names are case insensitive, and returned
+// in the canonical form, e.g. "Socket-Type".
+func parseMetadata(data []byte) (map[string]string, error) {
+	meta := make(map[string]string)
+	for len(data) > 0 {
+		n := int(data[0])
+		if len(data) < 1+n+4 {
+			return nil, errors.New("truncated metadata")
+		}
+		name := string(data[1 : 1+n])
+		size := binary.BigEndian.Uint32(data[1+n:])
+		data = data[1+n+4:]
+		if uint64(len(data)) < uint64(size) {
+			return nil, errors.New("truncated metadata")
+		}
+		meta[canonicalName(name)] = string(data[:size])
+		data = data[size:]
+	}
+	return meta, nil
+}
+
+func canonicalName(name string) string {
+	parts := strings.Split(strings.ToLower(name), "-")
+	for i, part := range parts {
+		if part != "" {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Sends a message of one or more frames.
+func (c *zmtpConn) send(frames [][]byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	for i, frame := range frames {
+		var flags byte
+		if i < len(frames)-1 {
+			flags = flagMore
+		}
+		if c.curve != nil {
+			// Encrypted frames are sent as MESSAGE commands, with the flags
+			// inside the box.
+			c.writeFrame(0, c.curve.encrypt(flags, frame))
+		} else {
+			c.writeFrame(flags, frame)
+		}
+	}
+	return c.writer.Flush()
+}
+
+// Receives the next message. The SUBSCRIBE and CANCEL commands of ZMTP 3.1
+// peers are returned as the subscription messages of ZMTP 3.0, and other
+// commands are skipped.
+func (c *zmtpConn) receive() ([][]byte, error) {
+	var frames [][]byte
+	for {
+		flags, body, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		command := flags&flagCommand != 0
+		if c.curve != nil {
+			if command {
+				if name, _, err := parseCommand(body); err != nil || name != "MESSAGE" {
+					return nil, errors.New("expected MESSAGE command")
+				}
+			}
+			if flags, body, err = c.curve.decrypt(body); err != nil {
+				return nil, err
+			}
+			command = flags&curveFlagCommand != 0
+		}
+		if command {
+			name, data, err := parseCommand(body)
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "SUBSCRIBE":
+				return [][]byte{append([]byte{1}, data...)}, nil
+			case "CANCEL":
+				return [][]byte{append([]byte{0}, data...)}, nil
+			case "ERROR":
+				return nil, errors.New("peer sent an error")
+			}
+			continue
+		}
+		frames = append(frames, body)
+		if flags&flagMore == 0 {
+			return frames, nil
+		}
+		if len(frames) > 1024 {
+			return nil, errors.New("message has too many frames")
+		}
+	}
+}
+
+func (c *zmtpConn) close() {
+	c.conn.Close()
+}
@@ -0,0 +1,365 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package zeromq
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+	"heka/pipeline"
+)
+
+// Flags inside a CURVE MESSAGE box.
+const (
+	curveFlagMore    = 0x01
+	curveFlagCommand = 0x02
+)
+
+// The security mechanism of a socket's connections, and its CURVE keys.
+type zmqSecurity struct {
+	// "NULL" or "CURVE".
+	mechanism string
+	// Whether the socket's the CURVE server, authenticating its clients.
+	server bool
+	public *[32]byte
+	secret *[32]byte
+	// The server's public key, for CURVE clients.
+	serverKey *[32]byte
+	// The client keys a CURVE server accepts, any if it's empty.
+	clientKeys map[[32]byte]bool
+}
+
+// Returns the security settings for the CURVE keys given, which are Z85
+// encoded. Without a secret key the socket uses the NULL mechanism, and
+// without a server key it's a CURVE server. CURVE's primitives aren't FIPS
+// approved, so its keys are refused in FIPS mode.
+func newZmqSecurity(secretKey, serverKey string, clientKeys []string) (
+	*zmqSecurity, error) {
+
+	if pipeline.FipsMode() && (secretKey != "" || serverKey != "") {
+		return nil, errors.New("CURVE security isn't allowed in FIPS mode")
+	}
+	if secretKey == "" {
+		if serverKey != "" || len(clientKeys) > 0 {
+			return nil, errors.New("CURVE keys need curve_secret_key to be set")
+		}
+		return &zmqSecurity{mechanism: "NULL"}, nil
+	}
+	sec := &zmqSecurity{mechanism: "CURVE", server: serverKey == ""}
+	var err error
+	if sec.secret, err = decodeKey(secretKey); err != nil {
+		return nil, fmt.Errorf("bad curve_secret_key: %s", err)
+	}
+	sec.public = new([32]byte)
+	curve25519.ScalarBaseMult(sec.public, sec.secret)
+	if !sec.server {
+		if sec.serverKey, err = decodeKey(serverKey); err != nil {
+			return nil, fmt.Errorf("bad curve_server_key: %s", err)
+		}
+		if len(clientKeys) > 0 {
+			return nil, errors.New("curve_client_keys are only for CURVE servers")
+		}
+	}
+	for _, key := range clientKeys {
+		k, err := decodeKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("bad curve_client_keys key '%s': %s", key, err)
+		}
+		if sec.clientKeys == nil {
+			sec.clientKeys = make(map[[32]byte]bool)
+		}
+		sec.clientKeys[*k] = true
+	}
+	return sec, nil
+}
+
+const z85Chars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-:+=^!/*?&<>()[]{}@%$#"
+
+// Encodes data whose length is a multiple of 4 in Z85, as ZeroMQ prints
+// CURVE keys.
+func z85Encode(data []byte) string {
+	out := make([]byte, 0, len(data)*5/4)
+	for i := 0; i+4 <= len(data); i += 4 {
+		value := binary.BigEndian.Uint32(data[i:])
+		var chunk [5]byte
+		for j := 4; j >= 0; j-- {
+			chunk[j] = z85Chars[value%85]
+			value /= 85
+		}
+		out = append(out, chunk[:]...)
+	}
+	return string(out)
+}
+
+func z85Decode(s string) ([]byte, error) {
+	if len(s)%5 != 0 {
+		return nil, errors.New("Z85 length isn't a multiple of 5")
+	}
+	out := make([]byte, 0, len(s)*4/5)
+	for i := 0; i < len(s); i += 5 {
+		var value uint64
+		for j := 0; j < 5; j++ {
+			digit := strings.IndexByte(z85Chars, s[i+j])
+			if digit < 0 {
+				return nil, fmt.Errorf("'%c' isn't a Z85 character", s[i+j])
+			}
+			value = value*85 + uint64(digit)
+		}
+		if value > 0xffffffff {
+			return nil, errors.New("Z85 value out of range")
+		}
+		out = append(out, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+	}
+	return out, nil
+}
+
+// Decodes a 40 character Z85 key.
+func decodeKey(s string) (*[32]byte, error) {
+	data, err := z85Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 32 {
+		return nil, errors.New("keys are 40 Z85 characters")
+	}
+	key := new([32]byte)
+	copy(key[:], data)
+	return key, nil
+}
+
+// Returns a 24 byte nonce of a 16 byte prefix and an 8 byte counter, or of
+// an 8 byte prefix and 16 random bytes.
+func shortNonce(prefix string, n uint64) *[24]byte {
+	nonce := new([24]byte)
+	copy(nonce[:], prefix)
+	binary.BigEndian.PutUint64(nonce[16:], n)
+	return nonce
+}
+
+func longNonce(prefix string, random []byte) *[24]byte {
+	nonce := new([24]byte)
+	copy(nonce[:], prefix)
+	copy(nonce[8:], random)
+	return nonce
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Encrypts and decrypts the MESSAGE commands of a CURVE connection, with
+// the key shared by the short-term keys.
+type curveCodec struct {
+	key        [32]byte
+	sendPrefix string
+	recvPrefix string
+	// The next nonce sent, and the last one received.
+	sendNonce uint64
+	recvNonce uint64
+}
+
+// Returns a MESSAGE command carrying the frame.
+func (cc *curveCodec) encrypt(flags byte, frame []byte) []byte {
+	nonce := shortNonce(cc.sendPrefix, cc.sendNonce)
+	cc.sendNonce++
+	var boxFlags byte
+	if flags&flagMore != 0 {
+		boxFlags = curveFlagMore
+	}
+	plain := make([]byte, 0, 1+len(frame))
+	plain = append(append(plain, boxFlags), frame...)
+	out := append(encodeCommand("MESSAGE", nil), nonce[16:]...)
+	return box.SealAfterPrecomputation(out, plain, nonce, &cc.key)
+}
+
+// Returns the flags and frame of a MESSAGE command, with the flags'
+// MORE bit where a frame's flags have it.
+func (cc *curveCodec) decrypt(body []byte) (byte, []byte, error) {
+	if len(body) < 8+8+box.Overhead+1 || string(body[:8]) != "\x07MESSAGE" {
+		return 0, nil, errors.New("bad MESSAGE command")
+	}
+	n := binary.BigEndian.Uint64(body[8:16])
+	if n <= cc.recvNonce {
+		return 0, nil, errors.New("MESSAGE nonce was reused")
+	}
+	plain, ok := box.OpenAfterPrecomputation(nil, body[16:],
+		shortNonce(cc.recvPrefix, n), &cc.key)
+	if !ok {
+		return 0, nil, errors.New("can't decrypt MESSAGE")
+	}
+	cc.recvNonce = n
+	flags := plain[0] & curveFlagCommand
+	if plain[0]&curveFlagMore != 0 {
+		flags |= flagMore
+	}
+	return flags, plain[1:], nil
+}
+
+// The CURVE handshake of a client: HELLO, WELCOME, INITIATE and READY.
+func (c *zmtpConn) curveClientHandshake(sec *zmqSecurity, meta map[string]string) error {
+	cnPublic, cnSecret, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	hello := append([]byte{1, 0}, make([]byte, 72)...)
+	hello = append(hello, cnPublic[:]...)
+	hello = append(hello, shortNonce("", 1)[16:]...)
+	hello = box.Seal(hello, make([]byte, 64), shortNonce("CurveZMQHELLO---", 1),
+		sec.serverKey, cnSecret)
+	if err = c.sendCommand("HELLO", hello); err != nil {
+		return err
+	}
+
+	welcome, err := c.expectCommand("WELCOME")
+	if err != nil {
+		return err
+	}
+	if len(welcome) != 16+144 {
+		return errors.New("bad WELCOME command")
+	}
+	plain, ok := box.Open(nil, welcome[16:], longNonce("WELCOME-", welcome[:16]),
+		sec.serverKey, cnSecret)
+	if !ok {
+		return errors.New("can't open WELCOME, is curve_server_key right?")
+	}
+	snPublic := new([32]byte)
+	copy(snPublic[:], plain[:32])
+	cookie := plain[32:]
+
+	vouchNonce := randomBytes(16)
+	vouch := box.Seal(vouchNonce, append(cnPublic[:], sec.serverKey[:]...),
+		longNonce("VOUCH---", vouchNonce), snPublic, sec.secret)
+	plain = append(append(append([]byte{}, sec.public[:]...), vouch...),
+		encodeMetadata(meta)...)
+	initiate := append(append([]byte{}, cookie...), shortNonce("", 2)[16:]...)
+	initiate = box.Seal(initiate, plain, shortNonce("CurveZMQINITIATE", 2), snPublic,
+		cnSecret)
+	if err = c.sendCommand("INITIATE", initiate); err != nil {
+		return err
+	}
+
+	ready, err := c.expectCommand("READY")
+	if err != nil {
+		return err
+	}
+	if len(ready) < 8+box.Overhead {
+		return errors.New("bad READY command")
+	}
+	n := binary.BigEndian.Uint64(ready)
+	if plain, ok = box.Open(nil, ready[8:], shortNonce("CurveZMQREADY---", n),
+		snPublic, cnSecret); !ok {
+
+		return errors.New("can't open READY")
+	}
+	if c.peerMeta, err = parseMetadata(plain); err != nil {
+		return err
+	}
+	c.curve = &curveCodec{sendPrefix: "CurveZMQMESSAGEC",
+		recvPrefix: "CurveZMQMESSAGES", sendNonce: 3, recvNonce: n}
+	box.Precompute(&c.curve.key, snPublic, cnSecret)
+	return nil
+}
+
+// The CURVE handshake of a server, which only accepts the allowed client
+// keys.
+func (c *zmtpConn) curveServerHandshake(sec *zmqSecurity, meta map[string]string) error {
+	hello, err := c.expectCommand("HELLO")
+	if err != nil {
+		return err
+	}
+	if len(hello) != 2+72+32+8+80 || hello[0] != 1 {
+		return errors.New("bad HELLO command")
+	}
+	cnPublic := new([32]byte)
+	copy(cnPublic[:], hello[74:106])
+	n := binary.BigEndian.Uint64(hello[106:114])
+	if _, ok := box.Open(nil, hello[114:], shortNonce("CurveZMQHELLO---", n),
+		cnPublic, sec.secret); !ok {
+
+		return errors.New("can't open HELLO, is the client's curve_server_key right?")
+	}
+
+	snPublic, snSecret, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	var cookieKey [32]byte
+	copy(cookieKey[:], randomBytes(32))
+	cookieNonce := randomBytes(16)
+	cookie := secretbox.Seal(cookieNonce, append(cnPublic[:], snSecret[:]...),
+		longNonce("COOKIE--", cookieNonce), &cookieKey)
+	welcomeNonce := randomBytes(16)
+	welcome := box.Seal(welcomeNonce, append(snPublic[:], cookie...),
+		longNonce("WELCOME-", welcomeNonce), cnPublic, sec.secret)
+	if err = c.sendCommand("WELCOME", welcome); err != nil {
+		return err
+	}
+
+	initiate, err := c.expectCommand("INITIATE")
+	if err != nil {
+		return err
+	}
+	if len(initiate) < 96+8+box.Overhead+128 {
+		return errors.New("bad INITIATE command")
+	}
+	cookiePlain, ok := secretbox.Open(nil, initiate[16:96],
+		longNonce("COOKIE--", initiate[:16]), &cookieKey)
+	if !ok || !bytes.Equal(cookiePlain[:32], cnPublic[:]) {
+		return errors.New("bad INITIATE cookie")
+	}
+	n = binary.BigEndian.Uint64(initiate[96:104])
+	plain, ok := box.Open(nil, initiate[104:], shortNonce("CurveZMQINITIATE", n),
+		cnPublic, snSecret)
+	if !ok {
+		return errors.New("can't open INITIATE")
+	}
+	clientKey := new([32]byte)
+	copy(clientKey[:], plain[:32])
+	vouch := plain[32:128]
+	vouchPlain, ok := box.Open(nil, vouch[16:], longNonce("VOUCH---", vouch[:16]),
+		clientKey, snSecret)
+	if !ok || !bytes.Equal(vouchPlain, append(cnPublic[:], sec.public[:]...)) {
+		return errors.New("bad INITIATE vouch")
+	}
+	if sec.clientKeys != nil && !sec.clientKeys[*clientKey] {
+		c.sendError("Unauthorized client key")
+		return fmt.Errorf("client key %s isn't allowed", z85Encode(clientKey[:]))
+	}
+	if c.peerMeta, err = parseMetadata(plain[128:]); err != nil {
+		return err
+	}
+	c.peerKey = clientKey[:]
+
+	ready := box.Seal(shortNonce("", 1)[16:], encodeMetadata(meta),
+		shortNonce("CurveZMQREADY---", 1), cnPublic, snSecret)
+	if err = c.sendCommand("READY", ready); err != nil {
+		return err
+	}
+	c.curve = &curveCodec{sendPrefix: "CurveZMQMESSAGES",
+		recvPrefix: "CurveZMQMESSAGEC", sendNonce: 2, recvNonce: n}
+	box.Precompute(&c.curve.key, cnPublic, snSecret)
+	return nil
+}
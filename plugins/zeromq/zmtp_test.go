@@ -0,0 +1,278 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package zeromq
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"heka/pipeline"
+)
+
+// The key pairs of libzmq's CURVE tests.
+const (
+	serverPublic = "rq:rM>}U?@Lns47E1%kR.o@n%FcmmsL/@{H8]yf7"
+	serverSecret = "JTKVSB%%)wK0E.X)V>+}o?pNmC{O&4W4b!Ni{Lh6"
+	clientPublic = "Yne@$w-vo<fVvi]a<NY6T1ed:M$fCG*[IaLV{hID"
+	clientSecret = "D:)Q[IlAW!ahhC2ac:9*A}h:p?([4%wOTJ%JR%cs"
+)
+
+// Opens a connection to the listener and does the handshake, as a socket
+// of the type given.
+func dialPeer(address string, sec *zmqSecurity, socketType string) (*zmtpConn, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newZmtpConn(conn, sec, socketType, time.Second)
+	if err != nil {
+		conn.Close()
+	}
+	return c, err
+}
+
+// Accepts a connection and does the handshake, as a socket of the type
+// given.
+func acceptPeer(listener net.Listener, sec *zmqSecurity, socketType string) (
+	*zmtpConn, error) {
+
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	c, err := newZmtpConn(conn, sec, socketType, time.Second)
+	if err != nil {
+		conn.Close()
+	}
+	return c, err
+}
+
+// Connects a pair of sockets, returning the connections and the errors of
+// their handshakes.
+func connPair(serverSec, clientSec *zmqSecurity, serverType, clientType string) (
+	server, client *zmtpConn, serverErr, clientErr error) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer listener.Close()
+	done := make(chan bool)
+	go func() {
+		server, serverErr = acceptPeer(listener, serverSec, serverType)
+		close(done)
+	}()
+	client, clientErr = dialPeer(listener.Addr().String(), clientSec, clientType)
+	<-done
+	return
+}
+
+func curveSecurity(secret, server string, clients ...string) *zmqSecurity {
+	sec, err := newZmqSecurity(secret, server, clients)
+	if err != nil {
+		panic(err)
+	}
+	return sec
+}
+
+func ZmtpSpec(c gs.Context) {
+	null := &zmqSecurity{mechanism: "NULL"}
+
+	c.Specify("Z85", func() {
+		c.Specify("encodes the spec's example", func() {
+			data := []byte{0x86, 0x4f, 0xd2, 0x6f, 0xb5, 0x59, 0xf7, 0x5b}
+			c.Expect(z85Encode(data), gs.Equals, "HelloWorld")
+			decoded, err := z85Decode("HelloWorld")
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(decoded), gs.Equals, string(data))
+		})
+
+		c.Specify("rejects bad keys", func() {
+			_, err := decodeKey("HelloWorld")
+			c.Expect(err, gs.Not(gs.IsNil))
+			_, err = decodeKey(strings.Repeat("~", 40))
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("derives libzmq's public keys from their secret keys", func() {
+			sec := curveSecurity(serverSecret, "")
+			c.Expect(z85Encode(sec.public[:]), gs.Equals, serverPublic)
+			sec = curveSecurity(clientSecret, serverPublic)
+			c.Expect(z85Encode(sec.public[:]), gs.Equals, clientPublic)
+			c.Expect(sec.server, gs.IsFalse)
+		})
+	})
+
+	c.Specify("Metadata", func() {
+		data := encodeMetadata(map[string]string{"Socket-Type": "PUSH", "Identity": ""})
+		c.Expect(fmt.Sprintf("%q", encodeCommand("READY", data)), gs.Equals,
+			`"\x05READY\bIdentity\x00\x00\x00\x00\vSocket-Type\x00\x00\x00\x04PUSH"`)
+		meta, err := parseMetadata(data[:13])
+		c.Expect(err, gs.IsNil)
+		c.Expect(meta["Identity"], gs.Equals, "")
+		meta, err = parseMetadata([]byte("\x0bsocket-type\x00\x00\x00\x03SUB"))
+		c.Expect(meta["Socket-Type"], gs.Equals, "SUB")
+		_, err = parseMetadata(data[:len(data)-1])
+		c.Expect(err, gs.Not(gs.IsNil))
+	})
+
+	c.Specify("A NULL connection", func() {
+		c.Specify("sends the greeting", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			c.Assume(err, gs.IsNil)
+			defer listener.Close()
+			go dialPeer(listener.Addr().String(), null, "PUSH")
+			conn, err := listener.Accept()
+			c.Assume(err, gs.IsNil)
+			defer conn.Close()
+			greeting := make([]byte, 64)
+			_, err = conn.Read(greeting)
+			c.Expect(err, gs.IsNil)
+			c.Expect(fmt.Sprintf("% x", greeting[:16]), gs.Equals,
+				"ff 00 00 00 00 00 00 00 00 7f 03 00 4e 55 4c 4c")
+			c.Expect(strings.Trim(string(greeting[16:]), "\x00"), gs.Equals, "")
+		})
+
+		c.Specify("sends multipart messages", func() {
+			server, client, serverErr, clientErr := connPair(null, null, "PULL", "PUSH")
+			c.Assume(serverErr, gs.IsNil)
+			c.Assume(clientErr, gs.IsNil)
+			defer server.close()
+			defer client.close()
+			c.Expect(server.peerMeta["Socket-Type"], gs.Equals, "PUSH")
+			long := strings.Repeat("x", 1000)
+			c.Expect(client.send([][]byte{[]byte("topic"), []byte(long)}), gs.IsNil)
+			frames, err := server.receive()
+			c.Expect(err, gs.IsNil)
+			c.Expect(len(frames), gs.Equals, 2)
+			c.Expect(string(frames[0]), gs.Equals, "topic")
+			c.Expect(string(frames[1]), gs.Equals, long)
+		})
+
+		c.Specify("refuses incompatible sockets", func() {
+			_, _, serverErr, clientErr := connPair(null, null, "PUSH", "PUSH")
+			c.Expect(serverErr.Error(), gs.Equals, "PUSH socket can't talk to a PUSH socket")
+			c.Expect(clientErr, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("refuses CURVE peers", func() {
+			_, _, serverErr, _ := connPair(null, curveSecurity(clientSecret, serverPublic),
+				"PULL", "PUSH")
+			c.Expect(serverErr.Error(), gs.Equals,
+				"peer uses the CURVE mechanism, not NULL")
+		})
+	})
+
+	c.Specify("A CURVE connection", func() {
+		serverSec := curveSecurity(serverSecret, "")
+		clientSec := curveSecurity(clientSecret, serverPublic)
+
+		c.Specify("encrypts messages both ways", func() {
+			server, client, serverErr, clientErr := connPair(serverSec, clientSec,
+				"PUB", "SUB")
+			c.Assume(serverErr, gs.IsNil)
+			c.Assume(clientErr, gs.IsNil)
+			defer server.close()
+			defer client.close()
+			c.Expect(z85Encode(server.peerKey), gs.Equals, clientPublic)
+			c.Expect(client.peerMeta["Socket-Type"], gs.Equals, "PUB")
+
+			c.Expect(client.send([][]byte{[]byte("\x01logs")}), gs.IsNil)
+			frames, err := server.receive()
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(frames[0]), gs.Equals, "\x01logs")
+			long := strings.Repeat("y", 1000)
+			for i := 0; i < 3; i++ {
+				c.Expect(server.send([][]byte{[]byte("logs"), []byte(long)}), gs.IsNil)
+				frames, err = client.receive()
+				c.Expect(err, gs.IsNil)
+				c.Expect(len(frames), gs.Equals, 2)
+				c.Expect(string(frames[1]), gs.Equals, long)
+			}
+		})
+
+		c.Specify("accepts only the allowed client keys", func() {
+			serverSec = curveSecurity(serverSecret, "", serverPublic)
+			_, _, serverErr, clientErr := connPair(serverSec, clientSec, "PULL", "PUSH")
+			c.Expect(serverErr.Error(), gs.Equals,
+				"client key "+clientPublic+" isn't allowed")
+			c.Expect(clientErr.Error(), gs.Equals,
+				"peer refused the connection: Unauthorized client key")
+
+			serverSec = curveSecurity(serverSecret, "", clientPublic)
+			_, _, serverErr, clientErr = connPair(serverSec, clientSec, "PULL", "PUSH")
+			c.Expect(serverErr, gs.IsNil)
+			c.Expect(clientErr, gs.IsNil)
+		})
+
+		c.Specify("fails with the wrong server key", func() {
+			clientSec = curveSecurity(clientSecret, clientPublic)
+			_, _, serverErr, clientErr := connPair(serverSec, clientSec, "PULL", "PUSH")
+			c.Expect(serverErr, gs.Not(gs.IsNil))
+			c.Expect(clientErr, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("fails when both ends are servers", func() {
+			_, _, serverErr, _ := connPair(serverSec, serverSec, "PULL", "PUSH")
+			c.Expect(serverErr.Error(), gs.Equals,
+				"both peers are CURVE servers, or both clients")
+		})
+
+		c.Specify("rejects replayed messages", func() {
+			sender := &curveCodec{sendPrefix: "CurveZMQMESSAGEC", sendNonce: 3}
+			receiver := &curveCodec{recvPrefix: "CurveZMQMESSAGEC", recvNonce: 2}
+			msg := sender.encrypt(flagMore, []byte("one"))
+			flags, frame, err := receiver.decrypt(msg)
+			c.Expect(err, gs.IsNil)
+			c.Expect(flags, gs.Equals, byte(flagMore))
+			c.Expect(string(frame), gs.Equals, "one")
+			_, _, err = receiver.decrypt(msg)
+			c.Expect(err.Error(), gs.Equals, "MESSAGE nonce was reused")
+			msg = sender.encrypt(0, []byte("two"))
+			msg[len(msg)-1] ^= 1
+			_, _, err = receiver.decrypt(msg)
+			c.Expect(err.Error(), gs.Equals, "can't decrypt MESSAGE")
+		})
+	})
+
+	c.Specify("The security settings", func() {
+		_, err := newZmqSecurity("", serverPublic, nil)
+		c.Expect(err, gs.Not(gs.IsNil))
+		_, err = newZmqSecurity(clientSecret, serverPublic, []string{clientPublic})
+		c.Expect(err, gs.Not(gs.IsNil))
+		_, err = newZmqSecurity(serverSecret, "", []string{"nope"})
+		c.Expect(err, gs.Not(gs.IsNil))
+
+		c.Specify("refuse CURVE keys in FIPS mode", func() {
+			pipeline.SetFipsMode(true)
+			defer pipeline.SetFipsMode(false)
+			for _, keys := range [][2]string{
+				{serverSecret, ""},
+				{clientSecret, serverPublic},
+				{"", serverPublic},
+			} {
+				_, err := newZmqSecurity(keys[0], keys[1], nil)
+				c.Assume(err, gs.Not(gs.IsNil))
+				c.Expect(err.Error(), gs.Equals, "CURVE security isn't allowed in FIPS mode")
+			}
+			sec, err := newZmqSecurity("", "", nil)
+			c.Expect(err, gs.IsNil)
+			c.Expect(sec.mechanism, gs.Equals, "NULL")
+		})
+	})
+}
@@ -0,0 +1,207 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package sandbox
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"heka/message"
+	"heka/pipeline"
+)
+
+// Settings of a sandbox filter's HTTP client, from its `http_client` config
+// subsection. Without one the filter can't make requests at all.
+type HttpClientConfig struct {
+	// URLs requests may be made to, along with anything under their paths,
+	// e.g. "https://users.internal/api/".
+	AllowedUrls []string `toml:"allowed_urls"`
+	// Methods requests may use. Defaults to GET only.
+	AllowedMethods []string `toml:"allowed_methods"`
+	// Milliseconds a request may take, including reading the response.
+	// Defaults to 1000.
+	Timeout uint `toml:"timeout"`
+	// Maximum size of a response body, bigger ones are an error. Defaults to
+	// 64KiB.
+	MaxResponseSize uint `toml:"max_response_size"`
+	// Maximum requests per second, ones over the limit failing rather than
+	// waiting. Defaults to 10, zero isn't allowed.
+	MaxRequestRate uint `toml:"max_request_rate"`
+}
+
+// A sandbox filter's HTTP client, making requests only to the allowed URLs
+// with the allowed methods, so that scripts can enrich messages from
+// internal APIs without being given general network access.
+type HttpClient struct {
+	allowed  []*url.URL
+	methods  map[string]bool
+	maxSize  int64
+	limit    *pipeline.RateLimit
+	client   *http.Client
+	requests int64
+	failures int64
+	limited  int64
+}
+
+func NewHttpClient(conf *HttpClientConfig) (*HttpClient, error) {
+	if len(conf.AllowedUrls) == 0 {
+		return nil, errors.New("http_client: allowed_urls must be set")
+	}
+	c := &HttpClient{methods: make(map[string]bool)}
+	for _, s := range conf.AllowedUrls {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("http_client: invalid allowed url '%s': %s", s, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("http_client: allowed url '%s' must be an http or "+
+				"https URL without credentials, a query or a fragment", s)
+		}
+		c.allowed = append(c.allowed, u)
+	}
+	methods := conf.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{"GET"}
+	}
+	for _, m := range methods {
+		c.methods[strings.ToUpper(m)] = true
+	}
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = 1000
+	}
+	c.maxSize = int64(conf.MaxResponseSize)
+	if c.maxSize == 0 {
+		c.maxSize = 64 * 1024
+	}
+	rate := conf.MaxRequestRate
+	if rate == 0 {
+		rate = 10
+	}
+	c.limit = pipeline.NewRateLimit(rate)
+	c.client = &http.Client{
+		Timeout: time.Duration(timeout) * time.Millisecond,
+		// Redirects have to stay within the allowed URLs too.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return c.checkUrl(req.URL)
+		},
+	}
+	return c, nil
+}
+
+// Returns an error unless u is one of the allowed URLs or under one's path.
+func (c *HttpClient) checkUrl(u *url.URL) error {
+	if u.User == nil && !hasDotSegment(u.Path) {
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		for _, a := range c.allowed {
+			if u.Scheme != a.Scheme || !strings.EqualFold(u.Host, a.Host) {
+				continue
+			}
+			prefix := a.EscapedPath()
+			if prefix == "" || prefix == "/" || path == prefix ||
+				(strings.HasPrefix(path, prefix) &&
+					(strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/')) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("url '%s' isn't allowed", u.Redacted())
+}
+
+// Tells if a path has "." or ".." segments, which could step outside an
+// allowed path once the server resolves them.
+func hasDotSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// Request makes a request, if its method and URL are allowed, returning the
+// status code and body of the response. Headers are added to the request.
+func (c *HttpClient) Request(method, rawurl string, body []byte,
+	headers map[string]string) (status int, respBody []byte, err error) {
+
+	defer func() {
+		if err != nil {
+			atomic.AddInt64(&c.failures, 1)
+		}
+	}()
+	method = strings.ToUpper(method)
+	if !c.methods[method] {
+		return 0, nil, fmt.Errorf("method '%s' isn't allowed", method)
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err = c.checkUrl(u); err != nil {
+		return 0, nil, err
+	}
+	if !c.limit.Allow() {
+		atomic.AddInt64(&c.limited, 1)
+		return 0, nil, errors.New("request rate limit exceeded")
+	}
+	atomic.AddInt64(&c.requests, 1)
+
+	var reader io.Reader
+	if len(body) > 0 {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err = ioutil.ReadAll(io.LimitReader(resp.Body, c.maxSize+1))
+	if err != nil {
+		return 0, nil, err
+	}
+	if int64(len(respBody)) > c.maxSize {
+		return 0, nil, fmt.Errorf("response is bigger than %d bytes", c.maxSize)
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// ReportMsg adds the request counters to the filter's report message.
+func (c *HttpClient) ReportMsg(msg *message.Message) {
+	message.NewInt64Field(msg, "HttpRequests", atomic.LoadInt64(&c.requests), "count")
+	message.NewInt64Field(msg, "HttpFailures", atomic.LoadInt64(&c.failures), "count")
+	message.NewInt64Field(msg, "HttpRateLimited", atomic.LoadInt64(&c.limited), "count")
+}
@@ -0,0 +1,123 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2026
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   agent (agent@local)
+#
+# ***** END LICENSE BLOCK *****/
+
+package sandbox
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		switch r.URL.Path {
+		case "/api/big":
+			w.Write([]byte(strings.Repeat("x", 100)))
+		case "/api/escape":
+			http.Redirect(w, r, "/admin", http.StatusFound)
+		default:
+			fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.Path, r.Header.Get("X-Test"))
+		}
+	}))
+}
+
+func TestHttpClientConfig(t *testing.T) {
+	for _, allowed := range []string{"", "ftp://host/", "http://user:pw@host/",
+		"http:///path", "http://host/?q=1"} {
+		conf := &HttpClientConfig{}
+		if allowed != "" {
+			conf.AllowedUrls = []string{allowed}
+		}
+		if _, err := NewHttpClient(conf); err == nil {
+			t.Errorf("allowed url '%s' should be refused", allowed)
+		}
+	}
+}
+
+func TestHttpClientAllowlist(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	client, err := NewHttpClient(&HttpClientConfig{
+		AllowedUrls:     []string{server.URL + "/api"},
+		MaxResponseSize: 50,
+		MaxRequestRate:  100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, body, err := client.Request("get", server.URL+"/api/users?id=1", nil,
+		map[string]string{"X-Test": "yes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 200 || string(body) != "GET /api/users yes" {
+		t.Errorf("unexpected response %d '%s'", status, body)
+	}
+
+	for _, u := range []string{
+		server.URL + "/admin",
+		server.URL + "/apiary",
+		server.URL + "/api/../admin",
+		server.URL + "/api/%2e%2e/admin",
+		strings.Replace(server.URL, "http:", "https:", 1) + "/api/",
+		"http://user@" + server.URL[len("http://"):] + "/api/",
+	} {
+		if _, _, err = client.Request("GET", u, nil, nil); err == nil {
+			t.Errorf("url '%s' should be refused", u)
+		}
+	}
+	if _, _, err = client.Request("POST", server.URL+"/api/users", []byte("x"),
+		nil); err == nil {
+		t.Error("POST should be refused")
+	}
+	if _, _, err = client.Request("GET", server.URL+"/api/escape", nil,
+		nil); err == nil {
+		t.Error("redirect outside the allowed urls should be refused")
+	}
+	if _, _, err = client.Request("GET", server.URL+"/api/big", nil,
+		nil); err == nil {
+		t.Error("response over the size limit should be refused")
+	}
+}
+
+func TestHttpClientRateLimit(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	client, err := NewHttpClient(&HttpClientConfig{
+		AllowedUrls:    []string{server.URL},
+		AllowedMethods: []string{"GET", "POST"},
+		MaxRequestRate: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, body, err := client.Request("POST", server.URL+"/", nil,
+			nil); err != nil || string(body) != "POST / " {
+			t.Errorf("request %d failed: %v '%s'", i, err, body)
+		}
+	}
+	if _, _, err = client.Request("POST", server.URL+"/", nil, nil); err == nil {
+		t.Error("request over the rate limit should fail")
+	}
+	if client.requests != 2 || client.limited != 1 || client.failures != 1 {
+		t.Errorf("unexpected counts %d %d %d", client.requests, client.limited,
+			client.failures)
+	}
+}
@@ -0,0 +1,100 @@
+-- This Source Code Form is subject to the terms of the Mozilla Public
+-- License, v. 2.0. If a copy of the MPL was not distributed with this
+-- file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+--[[
+Graphs Heka's decode failure rates by decoder and error class, using the
+`heka.decode_failure` messages sent by inputs and decoders with
+`send_decode_failures = true`. A graph is output for each decoder, with a
+column for each error class it has reported, along with a table of the most
+recent failure of each decoder.
+
+Config:
+
+- sec_per_row (uint, optional, default 60)
+    Sets the size of each bucket (resolution in seconds) in the sliding
+    window.
+
+- rows (uint, optional, default 1440)
+    Sets the size of the sliding window i.e., 1440 rows representing 60
+    seconds per row is a 24 sliding hour window with 1 minute resolution.
+
+- max_classes (uint, optional, default 8)
+    Sets the number of error class columns kept for each decoder. Failures of
+    any further classes are counted in the last column, "other".
+
+*Example Heka Configuration*
+
+.. code-block:: ini
+
+    [HekaDecodeFailures]
+    type = "SandboxFilter"
+    filename = "lua_filters/heka_decode_failures.lua"
+    ticker_interval = 60
+    preserve_data = false
+    message_matcher = "Type == 'heka.decode_failure'"
+--]]
+
+require "circular_buffer"
+require "string"
+require "table"
+
+local rows          = read_config("rows") or 1440
+local sec_per_row   = read_config("sec_per_row") or 60
+local max_classes   = read_config("max_classes") or 8
+
+local decoders = {}
+
+local function find_decoder(name)
+    local d = decoders[name]
+    if not d then
+        local cb = circular_buffer.new(rows, max_classes, sec_per_row)
+        cb:set_header(max_classes, "other")
+        d = {cbuf = cb, classes = {}, count = 0, last = nil}
+        decoders[name] = d
+    end
+    return d
+end
+
+local function find_column(d, class)
+    local col = d.classes[class]
+    if col then return col end
+
+    if d.count < max_classes - 1 then
+        d.count = d.count + 1
+        col = d.cbuf:set_header(d.count, class)
+    else
+        col = max_classes
+    end
+    d.classes[class] = col
+    return col
+end
+
+function process_message()
+    local name = read_message("Fields[decoder]")
+    if type(name) ~= "string" then return -1, "missing decoder name" end
+
+    local ts = read_message("Timestamp")
+    local class = read_message("Fields[decode_error_class]") or "decode"
+    local d = find_decoder(name)
+    d.cbuf:add(ts, find_column(d, class), 1)
+    local err = read_message("Fields[decode_error]") or ""
+    d.last = {ts, class, (string.gsub(err, "[\t\n]", " "))}
+    return 0
+end
+
+function timer_event(ns)
+    local names = {}
+    for name, d in pairs(decoders) do
+        inject_payload("cbuf", name, d.cbuf)
+        names[#names+1] = name
+    end
+    table.sort(names)
+
+    add_to_payload("Decoder\tTimestamp\tClass\tError\n")
+    for i, name in ipairs(names) do
+        local last = decoders[name].last
+        add_to_payload(string.format("%s\t%d\t%s\t%s\n", name, last[1], last[2], last[3]))
+    end
+    inject_payload("tsv", "Last Failures")
+end
@@ -652,6 +652,97 @@ func go_lua_inject_message(ptr unsafe.Pointer, payload *C.char,
 		C.GoString(payload_type), C.GoString(payload_name))
 }
 
+//export go_lua_cache_get
+func go_lua_cache_get(ptr unsafe.Pointer, key *C.char, key_len C.int) (unsafe.Pointer,
+	int) {
+
+	var lsb *LuaSandbox = (*LuaSandbox)(ptr)
+	if lsb.cache == nil {
+		return unsafe.Pointer(nil), 0
+	}
+	value, ok := lsb.cache.Get(C.GoStringN(key, key_len))
+	if !ok {
+		return unsafe.Pointer(nil), 0
+	}
+	cs := C.CString(string(value)) // freed by the caller
+	return unsafe.Pointer(cs), len(value)
+}
+
+//export go_lua_cache_set
+func go_lua_cache_set(ptr unsafe.Pointer, key *C.char, key_len C.int, value *C.char,
+	value_len C.int, ttl C.double, add C.int) int {
+
+	var lsb *LuaSandbox = (*LuaSandbox)(ptr)
+	if lsb.cache == nil {
+		return 0
+	}
+	k := C.GoStringN(key, key_len)
+	v := []byte(C.GoStringN(value, value_len))
+	d := time.Duration(float64(ttl) * float64(time.Second))
+	if add != 0 {
+		if lsb.cache.Add(k, v, d) {
+			return 1
+		}
+		return 0
+	}
+	lsb.cache.Set(k, v, d)
+	return 1
+}
+
+//export go_lua_cache_delete
+func go_lua_cache_delete(ptr unsafe.Pointer, key *C.char, key_len C.int) {
+	var lsb *LuaSandbox = (*LuaSandbox)(ptr)
+	if lsb.cache != nil {
+		lsb.cache.Delete(C.GoStringN(key, key_len))
+	}
+}
+
+//export go_lua_counter_add
+func go_lua_counter_add(ptr unsafe.Pointer, name *C.char, name_len C.int,
+	value C.double, gauge C.int) *C.char {
+
+	var lsb *LuaSandbox = (*LuaSandbox)(ptr)
+	if lsb.counters == nil {
+		return nil
+	}
+	var err error
+	n := C.GoStringN(name, name_len)
+	if gauge != 0 {
+		err = lsb.counters.Set(n, float64(value))
+	} else {
+		err = lsb.counters.Add(n, float64(value))
+	}
+	if err != nil {
+		return C.CString(err.Error()) // freed by the caller
+	}
+	return nil
+}
+
+//export go_lua_http_request
+func go_lua_http_request(ptr unsafe.Pointer, method, rawurl, body *C.char,
+	body_len C.int, headers *C.char, headers_len C.int) (int, unsafe.Pointer, int,
+	*C.char) {
+
+	var lsb *LuaSandbox = (*LuaSandbox)(ptr)
+	if lsb.http == nil {
+		return 0, unsafe.Pointer(nil), 0, C.CString("no http_client is configured")
+	}
+	// The headers come as "name: value" lines.
+	h := make(map[string]string)
+	for _, line := range strings.Split(C.GoStringN(headers, headers_len), "\n") {
+		if i := strings.Index(line, ": "); i > 0 {
+			h[line[:i]] = line[i+2:]
+		}
+	}
+	status, resp, err := lsb.http.Request(C.GoString(method), C.GoString(rawurl),
+		[]byte(C.GoStringN(body, body_len)), h)
+	if err != nil {
+		return 0, unsafe.Pointer(nil), 0, C.CString(err.Error()) // freed by the caller
+	}
+	cs := C.CString(string(resp)) // freed by the caller
+	return status, unsafe.Pointer(cs), len(resp), nil
+}
+
 type LuaSandbox struct {
 	lsb           *C.lua_sandbox
 	pack          *pipeline.PipelinePack
@@ -661,6 +752,9 @@ type LuaSandbox struct {
 	messageCopied bool
 	globals       *pipeline.GlobalConfigStruct
 	sbConfig      *sandbox.SandboxConfig
+	cache         *pipeline.KVCache
+	counters      *pipeline.Counters
+	http          *sandbox.HttpClient
 }
 
 func CreateLuaSandbox(conf *sandbox.SandboxConfig) (sandbox.Sandbox, error) {
@@ -705,6 +799,9 @@ func CreateLuaSandbox(conf *sandbox.SandboxConfig) (sandbox.Sandbox, error) {
 	}
 	lsb.config = conf.Config
 	lsb.globals = conf.Globals
+	lsb.cache = conf.KVCache
+	lsb.counters = conf.Counters
+	lsb.http = conf.Http
 	return lsb, nil
 }
 
@@ -476,6 +476,177 @@ int inject_payload(lua_State* lua)
     return 0;
 }
 
+////////////////////////////////////////////////////////////////////////////////
+int cache_get(lua_State* lua)
+{
+    void* luserdata = lua_touserdata(lua, lua_upvalueindex(1));
+    if (NULL == luserdata) {
+        luaL_error(lua, "cache_get() invalid lightuserdata");
+    }
+    lua_sandbox* lsb = (lua_sandbox*)luserdata;
+
+    if (lua_gettop(lua) != 1) {
+        luaL_error(lua, "cache_get() must have a single argument");
+    }
+    size_t len;
+    const char* key = luaL_checklstring(lua, 1, &len);
+
+    struct go_lua_cache_get_return gr;
+    // Cast away constness of the Lua string, the value is not modified
+    // and it will save a copy.
+    gr = go_lua_cache_get(lsb_get_parent(lsb), (char*)key, (int)len);
+    if (gr.r0 == NULL) {
+        lua_pushnil(lua);
+    } else {
+        lua_pushlstring(lua, gr.r0, gr.r1);
+        free(gr.r0);
+    }
+    return 1;
+}
+
+////////////////////////////////////////////////////////////////////////////////
+static int cache_store(lua_State* lua, const char* fn, int add)
+{
+    void* luserdata = lua_touserdata(lua, lua_upvalueindex(1));
+    if (NULL == luserdata) {
+        luaL_error(lua, "%s invalid lightuserdata", fn);
+    }
+    lua_sandbox* lsb = (lua_sandbox*)luserdata;
+
+    int n = lua_gettop(lua);
+    if (n < 2 || n > 3) {
+        luaL_error(lua, "%s takes a key, a value and an optional ttl", fn);
+    }
+    size_t key_len, value_len;
+    const char* key = luaL_checklstring(lua, 1, &key_len);
+    double ttl = luaL_optnumber(lua, 3, 0);
+    luaL_argcheck(lua, ttl >= 0, 3, "ttl must be >= 0");
+
+    void* parent = lsb_get_parent(lsb);
+    if (!add && lua_isnil(lua, 2)) {
+        go_lua_cache_delete(parent, (char*)key, (int)key_len);
+        return 0;
+    }
+    const char* value = luaL_checklstring(lua, 2, &value_len);
+    int stored = go_lua_cache_set(parent, (char*)key, (int)key_len,
+                                  (char*)value, (int)value_len, ttl, add);
+    if (add) {
+        lua_pushboolean(lua, stored);
+        return 1;
+    }
+    return 0;
+}
+
+////////////////////////////////////////////////////////////////////////////////
+int cache_set(lua_State* lua)
+{
+    return cache_store(lua, "cache_set()", 0);
+}
+
+////////////////////////////////////////////////////////////////////////////////
+int cache_add(lua_State* lua)
+{
+    return cache_store(lua, "cache_add()", 1);
+}
+
+////////////////////////////////////////////////////////////////////////////////
+static int counter_update(lua_State* lua, const char* fn, int gauge)
+{
+    void* luserdata = lua_touserdata(lua, lua_upvalueindex(1));
+    if (NULL == luserdata) {
+        luaL_error(lua, "%s invalid lightuserdata", fn);
+    }
+    lua_sandbox* lsb = (lua_sandbox*)luserdata;
+
+    int n = lua_gettop(lua);
+    if (n < 1 + gauge || n > 2) {
+        luaL_error(lua, "%s takes a name and a %s", fn,
+                   gauge ? "value" : "optional delta");
+    }
+    size_t len;
+    const char* name = luaL_checklstring(lua, 1, &len);
+    double value = gauge ? luaL_checknumber(lua, 2) : luaL_optnumber(lua, 2, 1);
+
+    char* err = go_lua_counter_add(lsb_get_parent(lsb), (char*)name, (int)len,
+                                   value, gauge);
+    if (err != NULL) {
+        lua_pushfstring(lua, "%s %s", fn, err);
+        free(err);
+        lua_error(lua);
+    }
+    return 0;
+}
+
+////////////////////////////////////////////////////////////////////////////////
+int counter_add(lua_State* lua)
+{
+    return counter_update(lua, "counter_add()", 0);
+}
+
+////////////////////////////////////////////////////////////////////////////////
+int gauge_set(lua_State* lua)
+{
+    return counter_update(lua, "gauge_set()", 1);
+}
+
+////////////////////////////////////////////////////////////////////////////////
+int http_request(lua_State* lua)
+{
+    void* luserdata = lua_touserdata(lua, lua_upvalueindex(1));
+    if (NULL == luserdata) {
+        luaL_error(lua, "http_request() invalid lightuserdata");
+    }
+    lua_sandbox* lsb = (lua_sandbox*)luserdata;
+
+    int n = lua_gettop(lua);
+    if (n < 2 || n > 4) {
+        luaL_error(lua, "http_request() takes a method, a url, an optional body "
+                   "and optional headers");
+    }
+    const char* method = luaL_checkstring(lua, 1);
+    const char* url = luaL_checkstring(lua, 2);
+    size_t body_len;
+    const char* body = luaL_optlstring(lua, 3, "", &body_len);
+
+    // Join the headers into "name: value" lines.
+    int count = 0;
+    if (n == 4 && !lua_isnil(lua, 4)) {
+        luaL_checktype(lua, 4, LUA_TTABLE);
+        lua_pushnil(lua);
+        while (lua_next(lua, 4) != 0) {
+            if (lua_type(lua, -2) != LUA_TSTRING || !lua_isstring(lua, -1)) {
+                luaL_error(lua, "http_request() headers must be strings");
+            }
+            luaL_checkstack(lua, 2, "http_request() too many headers");
+            lua_pushfstring(lua, "%s: %s\n", lua_tostring(lua, -2),
+                            lua_tostring(lua, -1));
+            lua_replace(lua, -2);
+            lua_insert(lua, -2); // keep the key on top for lua_next
+            ++count;
+        }
+    }
+    lua_concat(lua, count);
+    size_t headers_len;
+    const char* headers = lua_tolstring(lua, -1, &headers_len);
+
+    struct go_lua_http_request_return gr;
+    // Cast away constness of the Lua strings, they are not modified
+    // and it will save a copy.
+    gr = go_lua_http_request(lsb_get_parent(lsb), (char*)method, (char*)url,
+                             (char*)body, (int)body_len, (char*)headers,
+                             (int)headers_len);
+    if (gr.r3 != NULL) {
+        lua_pushnil(lua);
+        lua_pushstring(lua, gr.r3);
+        free(gr.r3);
+        return 2;
+    }
+    lua_pushinteger(lua, gr.r0);
+    lua_pushlstring(lua, gr.r1, gr.r2);
+    free(gr.r1);
+    return 2;
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 int sandbox_init(lua_sandbox* lsb, const char* data_file, const char* plugin_type)
 {
@@ -486,11 +657,20 @@ int sandbox_init(lua_sandbox* lsb, const char* data_file, const char* plugin_typ
 
     lsb_add_function(lsb, &read_config, "read_config");
     lsb_add_function(lsb, &lsb_decode_protobuf, "decode_message");
+    lsb_add_function(lsb, &cache_get, "cache_get");
+    lsb_add_function(lsb, &cache_set, "cache_set");
+    lsb_add_function(lsb, &cache_add, "cache_add");
+    lsb_add_function(lsb, &counter_add, "counter_add");
+    lsb_add_function(lsb, &gauge_set, "gauge_set");
 
     if (strcmp(plugin_type, "input") == 0) {
         lsb_add_function(lsb, &inject_message, "inject_message");
     }
 
+    if (strlen(plugin_type) == 0 || strcmp(plugin_type, "filter") == 0) {
+        lsb_add_function(lsb, &http_request, "http_request");
+    }
+
     if (strcmp(plugin_type, "output") == 0) {
         lsb_add_function(lsb, &read_message, "read_message");
         lsb_add_function(lsb, &read_next_field, "read_next_field");
@@ -79,6 +79,62 @@ int read_next_field(lua_State* lua);
 */
 int inject_message(lua_State* lua);
 
+/**
+* Looks up a key in the key/value cache shared by all plugins.
+*
+* @param lua Pointer to the Lua state.
+*
+* @return int Returns one value on the stack, the string value or nil.
+*/
+int cache_get(lua_State* lua);
+
+/**
+* Stores a value in the key/value cache, with an optional ttl in seconds. A
+* nil value removes the key.
+*
+* @param lua Pointer to the Lua state.
+*
+* @return int Returns zero values on the stack.
+*/
+int cache_set(lua_State* lua);
+
+/**
+* Stores a value in the key/value cache only if the key isn't already there.
+*
+* @param lua Pointer to the Lua state.
+*
+* @return int Returns one value on the stack, true if the value was stored.
+*/
+int cache_add(lua_State* lua);
+
+/**
+* Adds a delta, 1 by default, to a counter shared by all plugins.
+*
+* @param lua Pointer to the Lua state.
+*
+* @return int Returns zero values on the stack.
+*/
+int counter_add(lua_State* lua);
+
+/**
+* Sets a gauge shared by all plugins.
+*
+* @param lua Pointer to the Lua state.
+*
+* @return int Returns zero values on the stack.
+*/
+int gauge_set(lua_State* lua);
+
+/**
+* Makes an HTTP request to one of the URLs the filter's http_client allows.
+*
+* @param lua Pointer to the Lua state.
+*
+* @return int Returns two values on the stack, the status code and the
+*         response body, or nil and an error message.
+*/
+int http_request(lua_State* lua);
+
 /**
  * Initializes the sandbox and sets up the above callbacks.
  *
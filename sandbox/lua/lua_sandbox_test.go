@@ -15,6 +15,8 @@
 package lua_test
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -922,6 +924,110 @@ func TestReadConfig(t *testing.T) {
 	sb.Destroy("")
 }
 
+func TestKVCache(t *testing.T) {
+	var sbc SandboxConfig
+	sbc.ScriptFilename = "./testsupport/kv_cache.lua"
+	sbc.MemoryLimit = 32767
+	sbc.InstructionLimit = 1000
+	sbc.KVCache = pipeline.NewKVCache(pipeline.KVCacheConfig{MaxEntries: 10,
+		MaxBytes: 1024}, "")
+	sbc.KVCache.Set("shared", []byte("from go"), 0)
+	pack := getTestPack()
+	sb, err := lua.CreateLuaSandbox(&sbc)
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	err = sb.Init("")
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	r := sb.ProcessMessage(pack)
+	if r != 0 {
+		t.Errorf("ProcessMessage should return 0, received %d %s", r, sb.LastError())
+	}
+	if value, _ := sbc.KVCache.Get("payload"); string(value) != pack.Message.GetPayload() {
+		t.Errorf("payload not cached, got '%s'", value)
+	}
+	r = sb.ProcessMessage(pack)
+	if r != -1 {
+		t.Errorf("ProcessMessage should return -1 for a duplicate, received %d", r)
+	}
+	sb.TimerEvent(time.Now().UnixNano())
+	if _, ok := sbc.KVCache.Get("shared"); ok {
+		t.Errorf("shared key not deleted")
+	}
+	sb.Destroy("")
+}
+
+func TestCounters(t *testing.T) {
+	var sbc SandboxConfig
+	sbc.ScriptFilename = "./testsupport/counters.lua"
+	sbc.MemoryLimit = 32767
+	sbc.InstructionLimit = 1000
+	sbc.Counters = pipeline.NewCounters()
+	pack := getTestPack()
+	sb, err := lua.CreateLuaSandbox(&sbc)
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	err = sb.Init("")
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	for i := 0; i < 2; i++ {
+		r := sb.ProcessMessage(pack)
+		if r != 0 {
+			t.Errorf("ProcessMessage should return 0, received %d %s", r, sb.LastError())
+		}
+	}
+	if value, _ := sbc.Counters.Value("messages"); value != 2 {
+		t.Errorf("messages should be 2, got %g", value)
+	}
+	size := float64(2 * len(pack.Message.GetPayload()))
+	if value, _ := sbc.Counters.Value("payload_bytes"); value != size {
+		t.Errorf("payload_bytes should be %g, got %g", size, value)
+	}
+	sb.TimerEvent(5e9)
+	if value, _ := sbc.Counters.Value("last_timer"); value != 5 {
+		t.Errorf("last_timer should be 5, got %g", value)
+	}
+	sb.Destroy("")
+}
+
+func TestHttpRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		w.Write([]byte("user " + r.Header.Get("X-User")))
+	}))
+	defer server.Close()
+	var sbc SandboxConfig
+	sbc.ScriptFilename = "./testsupport/http_request.lua"
+	sbc.MemoryLimit = 32767
+	sbc.InstructionLimit = 1000
+	sbc.Config = map[string]interface{}{"base_url": server.URL}
+	var err error
+	sbc.Http, err = NewHttpClient(&HttpClientConfig{
+		AllowedUrls: []string{server.URL + "/api/"},
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	pack := getTestPack()
+	sb, err := lua.CreateLuaSandbox(&sbc)
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	err = sb.Init("")
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	r := sb.ProcessMessage(pack)
+	if r != 0 {
+		t.Errorf("ProcessMessage should return 0, received %d %s", r, sb.LastError())
+	}
+	sb.Destroy("")
+}
+
 func TestCJson(t *testing.T) {
 	var sbc SandboxConfig
 	sbc.ScriptFilename = "./testsupport/cjson.lua"
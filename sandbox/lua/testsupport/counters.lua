@@ -0,0 +1,15 @@
+-- This Source Code Form is subject to the terms of the Mozilla Public
+-- License, v. 2.0. If a copy of the MPL was not distributed with this
+-- file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+function process_message ()
+    counter_add("messages")
+    counter_add("payload_bytes", #read_message("Payload"))
+    if pcall(counter_add, "messages", -1) then error("decreased a counter") end
+    if pcall(gauge_set, "messages", 1) then error("set a counter") end
+    return 0
+end
+
+function timer_event(ns)
+    gauge_set("last_timer", ns / 1e9)
+end
@@ -0,0 +1,17 @@
+-- This Source Code Form is subject to the terms of the Mozilla Public
+-- License, v. 2.0. If a copy of the MPL was not distributed with this
+-- file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+require "circular_buffer"
+require "cjson"
+
+count = 0
+messages = circular_buffer.new(2, 1, 60)
+local MESSAGES = messages:set_header(1, "Messages")
+
+function process_message()
+    count = count + 1
+    local per_minute = messages:add(read_message("Timestamp"), MESSAGES, 1)
+    inject_payload("json", "state", cjson.encode({count, per_minute}))
+    return 0
+end
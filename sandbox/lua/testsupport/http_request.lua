@@ -0,0 +1,19 @@
+-- This Source Code Form is subject to the terms of the Mozilla Public
+-- License, v. 2.0. If a copy of the MPL was not distributed with this
+-- file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+local base = read_config("base_url")
+
+function process_message ()
+    local status, body = http_request("GET", base .. "/api/user", nil,
+                                      {["X-User"] = read_message("Logger")})
+    if status ~= 200 then error("status " .. tostring(status)) end
+    if body ~= "user GoSpec" then error("body " .. body) end
+
+    local ok, err = http_request("GET", base .. "/admin")
+    if ok ~= nil or not err then error("request outside the allowed urls") end
+    return 0
+end
+
+function timer_event(ns)
+end
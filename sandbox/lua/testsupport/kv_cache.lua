@@ -0,0 +1,21 @@
+-- This Source Code Form is subject to the terms of the Mozilla Public
+-- License, v. 2.0. If a copy of the MPL was not distributed with this
+-- file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+function process_message ()
+    if not cache_add("seen:" .. read_message("Uuid"), "1", 60) then
+        return -1, "duplicate"
+    end
+
+    local shared = cache_get("shared")
+    if shared ~= "from go" then error("shared " .. tostring(shared)) end
+
+    if cache_get("missing") ~= nil then error("missing") end
+
+    cache_set("payload", read_message("Payload"), 0.5)
+    return 0
+end
+
+function timer_event()
+    cache_set("shared", nil)
+end
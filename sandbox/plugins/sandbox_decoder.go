@@ -73,6 +73,8 @@ func (s *SandboxDecoder) Init(config interface{}) (err error) {
 	globals := s.pConfig.Globals
 	s.sbc.ScriptFilename = globals.PrependShareDir(s.sbc.ScriptFilename)
 	s.sbc.PluginType = "decoder"
+	s.sbc.KVCache = s.pConfig.KVCache()
+	s.sbc.Counters = s.pConfig.Counters()
 	s.sampleDenominator = globals.SampleDenominator
 
 	s.tz = time.UTC
@@ -157,6 +159,11 @@ func (s *SandboxDecoder) SetDecoderRunner(dr pipeline.DecoderRunner) {
 	if err == nil {
 		s.preservationFile = filepath.Join(s.pConfig.Globals.PrependBaseDir(DATA_DIR),
 			dr.Name()+DATA_EXT)
+		if s.sbc.PreserveData {
+			err = loadPreservation(s.pConfig, s.preservationFile)
+		}
+	}
+	if err == nil {
 		if s.sbc.PreserveData && fileExists(s.preservationFile) {
 			err = s.sb.Init(s.preservationFile)
 		} else {
@@ -271,6 +278,9 @@ func (s *SandboxDecoder) destroy() error {
 	if s.sb != nil {
 		if s.sbc.PreserveData {
 			err = s.sb.Destroy(s.preservationFile)
+			if err == nil {
+				err = savePreservation(s.pConfig, s.preservationFile)
+			}
 		} else {
 			err = s.sb.Destroy("")
 		}
@@ -83,7 +83,9 @@ func (s *SandboxEncoder) ConfigStruct() interface{} {
 }
 
 // Implements WantsName interface so we'll have access to the plugin name
-// before the Init method is called.
+// before the Init method is called. Each output gets its own instance, named
+// for the output and the encoder, so the name also keeps each instance's
+// preserved data apart.
 func (s *SandboxEncoder) SetName(name string) {
 	s.name = name
 }
@@ -101,6 +103,9 @@ func (s *SandboxEncoder) Init(config interface{}) (err error) {
 		Profile:          conf.Profile,
 		Config:           conf.Config,
 		PluginType:       "encoder",
+		Globals:          s.pConfig.Globals,
+		KVCache:          s.pConfig.KVCache(),
+		Counters:         s.pConfig.Counters(),
 	}
 	globals := s.pConfig.Globals
 	s.sbc.ScriptFilename = globals.PrependShareDir(s.sbc.ScriptFilename)
@@ -132,6 +137,11 @@ func (s *SandboxEncoder) Init(config interface{}) (err error) {
 	}
 
 	s.preservationFile = filepath.Join(dataDir, s.name+sandbox.DATA_EXT)
+	if s.sbc.PreserveData {
+		if err = loadPreservation(s.pConfig, s.preservationFile); err != nil {
+			return
+		}
+	}
 	if s.sbc.PreserveData && fileExists(s.preservationFile) {
 		err = s.sb.Init(s.preservationFile)
 	} else {
@@ -155,7 +165,14 @@ func (s *SandboxEncoder) Stop() {
 	s.reportLock.Lock()
 	if s.sb != nil {
 		if s.sbc.PreserveData {
-			s.sb.Destroy(s.preservationFile)
+			err := s.sb.Destroy(s.preservationFile)
+			if err == nil {
+				err = savePreservation(s.pConfig, s.preservationFile)
+			}
+			if err != nil {
+				pipeline.LogError.Printf("Encoder '%s' can't preserve its data: %s",
+					s.name, err)
+			}
 		} else {
 			s.sb.Destroy("")
 		}
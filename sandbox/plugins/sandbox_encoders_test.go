@@ -2,11 +2,14 @@ package plugins
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 
 	"github.com/gogo/protobuf/proto"
 	"heka/message"
 	"heka/pipeline"
 	ts "heka/pipeline/testsupport"
+	"heka/sandbox"
 	"github.com/pborman/uuid"
 	"github.com/rafrombrc/gomock/gomock"
 	gs "github.com/rafrombrc/gospec/src/gospec"
@@ -122,6 +125,46 @@ func EncoderSpec(c gs.Context) {
 		})
 	})
 
+	c.Specify("A stateful SandboxEncoder", func() {
+		encoder := new(SandboxEncoder)
+		encoder.SetPipelineConfig(pConfig)
+		encoder.SetName("StateOutput-StateEncoder")
+		conf := encoder.ConfigStruct().(*SandboxEncoderConfig)
+		conf.ScriptFilename = "../lua/testsupport/encoder_state.lua"
+		conf.ModuleDirectory = "../lua/modules"
+		conf.PreserveData = true
+		preservationFile := filepath.Join(pConfig.Globals.PrependBaseDir(
+			sandbox.DATA_DIR), "StateOutput-StateEncoder.data")
+		defer os.Remove(preservationFile)
+		supply := make(chan *pipeline.PipelinePack, 1)
+		pack := pipeline.NewPipelinePack(supply)
+		pack.Message.SetTimestamp(54321)
+		err := encoder.Init(conf)
+		c.Assume(err, gs.IsNil)
+
+		c.Specify("keeps its state across messages and restarts", func() {
+			result, err := encoder.Encode(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(result), gs.Equals, "[1,1]")
+			result, err = encoder.Encode(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(result), gs.Equals, "[2,2]")
+			encoder.Stop()
+			_, err = os.Stat(preservationFile)
+			c.Expect(err, gs.IsNil)
+
+			restarted := new(SandboxEncoder)
+			restarted.SetPipelineConfig(pConfig)
+			restarted.SetName("StateOutput-StateEncoder")
+			err = restarted.Init(conf)
+			c.Assume(err, gs.IsNil)
+			result, err = restarted.Encode(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(string(result), gs.Equals, "[3,3]")
+			restarted.Stop()
+		})
+	})
+
 	c.Specify("cbuf librato encoder", func() {
 		encoder := new(SandboxEncoder)
 		encoder.SetPipelineConfig(pConfig)
@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -41,6 +42,30 @@ func fileExists(path string) bool {
 	return false
 }
 
+// Returns the key a sandbox's preserved data is checkpointed under, named
+// for its preservation file.
+func preservationKey(path string) string {
+	return "sandbox/" + strings.TrimSuffix(filepath.Base(path), DATA_EXT)
+}
+
+// Fetches a sandbox's preserved data into its preservation file, if it's
+// kept in an external checkpoint store.
+func loadPreservation(pConfig *pipeline.PipelineConfig, path string) error {
+	if err := pConfig.LoadStateFile(preservationKey(path), path); err != nil {
+		return fmt.Errorf("can't load preserved data: %s", err)
+	}
+	return nil
+}
+
+// Stores a sandbox's preservation file in the external checkpoint store, if
+// there is one.
+func savePreservation(pConfig *pipeline.PipelineConfig, path string) error {
+	if err := pConfig.SaveStateFile(preservationKey(path), path); err != nil {
+		return fmt.Errorf("can't store preserved data: %s", err)
+	}
+	return nil
+}
+
 // Heka Filter plugin that acts as a wrapper for sandboxed filter scripts.
 // Each sanboxed filter (whether statically defined in the config or
 // dynamically loaded through the sandbox manager) maps to exactly one
@@ -89,6 +114,13 @@ func (this *SandboxFilter) Init(config interface{}) (err error) {
 	globals := this.pConfig.Globals
 	this.sbc.ScriptFilename = globals.PrependShareDir(this.sbc.ScriptFilename)
 	this.sbc.PluginType = "filter"
+	this.sbc.KVCache = this.pConfig.KVCache()
+	this.sbc.Counters = this.pConfig.Counters()
+	if this.sbc.HttpClient != nil {
+		if this.sbc.Http, err = NewHttpClient(this.sbc.HttpClient); err != nil {
+			return
+		}
+	}
 	this.sampleDenominator = globals.SampleDenominator
 
 	data_dir := globals.PrependBaseDir(DATA_DIR)
@@ -110,6 +142,11 @@ func (this *SandboxFilter) Init(config interface{}) (err error) {
 	}
 
 	this.preservationFile = filepath.Join(data_dir, this.name+DATA_EXT)
+	if this.sbc.PreserveData {
+		if err = loadPreservation(this.pConfig, this.preservationFile); err != nil {
+			return
+		}
+	}
 	if this.sbc.PreserveData && fileExists(this.preservationFile) {
 		err = this.sb.Init(this.preservationFile)
 	} else {
@@ -141,6 +178,9 @@ func (this *SandboxFilter) ReportMsg(msg *message.Message) error {
 	message.NewInt64Field(msg, "InjectMessageCount", atomic.LoadInt64(&this.injectMessageCount), "count")
 	message.NewInt64Field(msg, "ProcessMessageSamples", this.processMessageSamples, "count")
 	message.NewInt64Field(msg, "TimerEventSamples", this.timerEventSamples, "count")
+	if this.sbc.Http != nil {
+		this.sbc.Http.ReportMsg(msg)
+	}
 
 	var tmp int64 = 0
 	if this.processMessageSamples > 0 {
@@ -175,6 +215,7 @@ func (this *SandboxFilter) Run(fr pipeline.FilterRunner, h pipeline.PluginHelper
 		blocking       = false
 		backpressure   = false
 		pack           *pipeline.PipelinePack
+		processing     *pipeline.PipelinePack // nil during timer events
 		retval         int
 		msgLoopCount   uint
 		injectionCount uint
@@ -203,9 +244,15 @@ func (this *SandboxFilter) Run(fr pipeline.FilterRunner, h pipeline.PluginHelper
 			if e == pipeline.AbortError {
 				return 5
 			} else {
+				if _, loops := e.(pipeline.MsgLoopsError); loops && processing != nil {
+					this.pConfig.ReportMessageLoop(processing, fr.Name())
+				}
 				return 3
 			}
 		}
+		if processing != nil {
+			pack.TraceInjection(processing, fr.Name())
+		}
 		if len(payload_type) == 0 { // heka protobuf message
 			hostname := pack.Message.GetHostname()
 			err := proto.Unmarshal([]byte(payload), pack.Message)
@@ -256,7 +303,9 @@ func (this *SandboxFilter) Run(fr pipeline.FilterRunner, h pipeline.PluginHelper
 				startTime = time.Now()
 				sample = true
 			}
+			processing = pack
 			retval = this.sb.ProcessMessage(pack)
+			processing = nil
 			if sample {
 				duration = time.Since(startTime).Nanoseconds()
 				this.reportLock.Lock()
@@ -374,6 +423,9 @@ func (this *SandboxFilter) destroy() error {
 	if this.sb != nil {
 		if this.sbc.PreserveData {
 			err = this.sb.Destroy(this.preservationFile)
+			if err == nil {
+				err = savePreservation(this.pConfig, this.preservationFile)
+			}
 		} else {
 			err = this.sb.Destroy("")
 		}
@@ -63,6 +63,8 @@ func (s *SandboxInput) Init(config interface{}) (err error) {
 	s.sbc.ScriptFilename = globals.PrependShareDir(s.sbc.ScriptFilename)
 	s.sbc.InstructionLimit = 0
 	s.sbc.PluginType = "input"
+	s.sbc.KVCache = s.pConfig.KVCache()
+	s.sbc.Counters = s.pConfig.Counters()
 
 	s.tz = time.UTC
 	if tz, ok := s.sbc.Config["tz"]; ok {
@@ -91,6 +93,11 @@ func (s *SandboxInput) Init(config interface{}) (err error) {
 	}
 
 	s.preservationFile = filepath.Join(data_dir, s.name+DATA_EXT)
+	if s.sbc.PreserveData {
+		if err = loadPreservation(s.pConfig, s.preservationFile); err != nil {
+			return
+		}
+	}
 	if s.sbc.PreserveData && fileExists(s.preservationFile) {
 		err = s.sb.Init(s.preservationFile)
 	} else {
@@ -171,6 +178,9 @@ func (s *SandboxInput) destroy() error {
 	if s.sb != nil {
 		if s.sbc.PreserveData {
 			err = s.sb.Destroy(s.preservationFile)
+			if err == nil {
+				err = savePreservation(s.pConfig, s.preservationFile)
+			}
 		} else {
 			err = s.sb.Destroy("")
 		}
@@ -145,6 +145,8 @@ func (this *SandboxManagerFilter) createRunner(dir, name string, configSection t
 		conf.InstructionLimit = this.instructionLimit
 		conf.OutputLimit = this.outputLimit
 		conf.PluginType = "filter"
+		// Dynamically loaded filters are never given network access.
+		conf.HttpClient = nil
 		return conf, nil
 	}
 	mutMaker.SetPrepConfig(prepConfig)
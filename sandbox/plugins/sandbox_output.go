@@ -66,6 +66,8 @@ func (s *SandboxOutput) Init(config interface{}) (err error) {
 	s.sbc.ScriptFilename = globals.PrependShareDir(s.sbc.ScriptFilename)
 	s.sbc.InstructionLimit = 0
 	s.sbc.PluginType = "output"
+	s.sbc.KVCache = s.pConfig.KVCache()
+	s.sbc.Counters = s.pConfig.Counters()
 
 	data_dir := globals.PrependBaseDir(DATA_DIR)
 	if !fileExists(data_dir) {
@@ -86,6 +88,11 @@ func (s *SandboxOutput) Init(config interface{}) (err error) {
 	}
 
 	s.preservationFile = filepath.Join(data_dir, s.name+DATA_EXT)
+	if s.sbc.PreserveData {
+		if err = loadPreservation(s.pConfig, s.preservationFile); err != nil {
+			return
+		}
+	}
 	if s.sbc.PreserveData && fileExists(s.preservationFile) {
 		err = s.sb.Init(s.preservationFile)
 	} else {
@@ -181,6 +188,9 @@ func (s *SandboxOutput) destroy() error {
 	if s.sb != nil {
 		if s.sbc.PreserveData {
 			err = s.sb.Destroy(s.preservationFile)
+			if err == nil {
+				err = savePreservation(s.pConfig, s.preservationFile)
+			}
 		} else {
 			err = s.sb.Destroy("")
 		}
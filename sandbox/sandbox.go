@@ -66,6 +66,16 @@ type SandboxConfig struct {
 	Config               map[string]interface{}
 	Globals              *pipeline.GlobalConfigStruct
 	PluginType           string
+	// The key/value cache shared with other plugins, nil if the sandbox
+	// can't use one.
+	KVCache *pipeline.KVCache
+	// The counters and gauges shared with other plugins, nil if the sandbox
+	// can't update any.
+	Counters *pipeline.Counters
+	// Settings of a filter's HTTP client, nil if it can't make requests.
+	HttpClient *HttpClientConfig `toml:"http_client"`
+	// The HTTP client made from HttpClient, nil if there isn't one.
+	Http *HttpClient
 }
 
 func NewSandboxConfig(globals *pipeline.GlobalConfigStruct) interface{} {